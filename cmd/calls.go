@@ -0,0 +1,136 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/calls"
+	"firestige.xyz/otus/internal/command"
+)
+
+var (
+	callsTaskID string
+	callsLimit  int
+)
+
+// callsCmd represents the calls command group
+var callsCmd = &cobra.Command{
+	Use:   "calls",
+	Short: "Query active calls",
+	Long: `Query the active-calls table of the Otus daemon.
+
+Requires calls.enabled in the task configuration.
+
+Subcommands:
+  list  - List calls alive right now
+  get   - Show one call by Call-ID`,
+}
+
+// callsListCmd represents the calls list command
+var callsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List active calls",
+	Long: `List active calls of all tasks, or of one task with --task.
+
+Examples:
+  otus calls list
+  otus calls list --task sip-capture --limit 20`,
+	Run: func(cmd *cobra.Command, args []string) {
+		runCallsList()
+	},
+}
+
+// callsGetCmd represents the calls get command
+var callsGetCmd = &cobra.Command{
+	Use:   "get <call-id>",
+	Short: "Show one active call",
+	Long:  `Show state, timing and media statistics of one active call by SIP Call-ID.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runCallsGet(args[0])
+	},
+}
+
+func init() {
+	callsCmd.AddCommand(callsListCmd)
+	callsCmd.AddCommand(callsGetCmd)
+
+	callsCmd.PersistentFlags().StringVarP(&callsTaskID, "task", "t", "",
+		"restrict to one task ID")
+	callsListCmd.Flags().IntVarP(&callsLimit, "limit", "n", 0,
+		"maximum number of calls to show (0 = all)")
+}
+
+func runCallsList() {
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	ctx := context.Background()
+
+	resp, err := client.CallsList(ctx, callsTaskID, callsLimit)
+	if err != nil {
+		exitWithError("failed to query calls", err)
+	}
+
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("calls_list failed: %s", resp.Error.Message), nil)
+	}
+
+	// Round-trip the generic result into typed calls for tabular output.
+	var result struct {
+		Calls []calls.Call `json:"calls"`
+		Count int          `json:"count"`
+	}
+	raw, err := json.Marshal(resp.Result)
+	if err == nil {
+		err = json.Unmarshal(raw, &result)
+	}
+	if err != nil {
+		exitWithError("invalid response format", err)
+	}
+
+	if result.Count == 0 {
+		fmt.Println("No active calls.")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CALL-ID\tTASK\tSTATE\tFROM\tTO\tDURATION\tRTP-PKTS\tCODEC")
+	now := time.Now()
+	for _, c := range result.Calls {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			c.CallID, c.TaskID, c.State, c.From, c.To,
+			now.Sub(c.StartTime).Truncate(time.Second), c.Media.RTPPackets, c.Media.Codec)
+	}
+	w.Flush()
+
+	if len(result.Calls) < result.Count {
+		fmt.Printf("(showing %d of %d calls)\n", len(result.Calls), result.Count)
+	}
+}
+
+func runCallsGet(callID string) {
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	ctx := context.Background()
+
+	resp, err := client.CallsGet(ctx, callsTaskID, callID)
+	if err != nil {
+		exitWithError("failed to query call", err)
+	}
+
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("calls_get failed: %s", resp.Error.Message), nil)
+	}
+
+	resultJSON, err := json.MarshalIndent(resp.Result, "", "  ")
+	if err != nil {
+		exitWithError("failed to format result", err)
+	}
+
+	fmt.Println(string(resultJSON))
+}
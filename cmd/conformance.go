@@ -0,0 +1,90 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/conformance"
+)
+
+var conformanceJSON bool
+
+// conformanceCmd runs the protocol conformance fixtures in-process
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance [fixture-dir]",
+	Short: "Replay conformance fixtures and check parser labels",
+	Long: `Replay pcap fixtures through this build's parsers and compare the
+resulting payload types and labels with the expected-labels JSON next to
+each capture. No daemon is required.
+
+Each fixture is a <name>.pcap / <name>.json pair; see
+testdata/conformance for the format. Exits non-zero on any mismatch.
+
+Examples:
+  otus conformance
+  otus conformance ./my-fixtures --json`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := "testdata/conformance"
+		if len(args) == 1 {
+			dir = args[0]
+		}
+		runConformance(dir)
+	},
+}
+
+func init() {
+	conformanceCmd.Flags().BoolVar(&conformanceJSON, "json", false,
+		"print results as JSON")
+}
+
+func runConformance(dir string) {
+	fixtures, err := conformance.Load(dir)
+	if err != nil {
+		exitWithError("failed to load fixtures", err)
+	}
+	if len(fixtures) == 0 {
+		exitWithError(fmt.Sprintf("no fixtures in %s", dir), nil)
+	}
+
+	results := make([]*conformance.Result, 0, len(fixtures))
+	failed := 0
+	for _, f := range fixtures {
+		result, err := conformance.Run(f, conformance.RegisteredParsers)
+		if err != nil {
+			exitWithError("fixture run failed", err)
+		}
+		if !result.Passed() {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if conformanceJSON {
+		out, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			exitWithError("failed to format results", err)
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, r := range results {
+			status := "PASS"
+			if !r.Passed() {
+				status = "FAIL"
+			}
+			fmt.Printf("%s  %s (%d packets, %d checked)\n", status, r.Fixture, r.Packets, r.Checked)
+			for _, m := range r.Mismatches {
+				fmt.Printf("      %s\n", m)
+			}
+		}
+		fmt.Printf("%d/%d fixtures passed\n", len(results)-failed, len(results))
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
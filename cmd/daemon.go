@@ -9,6 +9,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"firestige.xyz/otus/internal/daemon"
+	"firestige.xyz/otus/internal/service"
 )
 
 // daemonCmd represents the daemon command
@@ -23,7 +24,12 @@ The daemon will:
   3. Start UDS server for CLI control
   4. Start Kafka command consumer (if configured)
   5. Wait for tasks to be created via CLI or Kafka
-  6. Handle signals for graceful shutdown (SIGTERM, SIGINT) and reload (SIGHUP)`,
+  6. Handle signals for graceful shutdown (SIGTERM, SIGINT) and reload (SIGHUP)
+
+With --foreground=false the daemon is started in the background, detached
+from the terminal, and this command returns. When started by the Windows
+Service Control Manager (see "otus service install"), stop and parameter
+change requests take the place of the signals.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := runDaemon(); err != nil {
 			slog.Error("daemon failed", "error", err)
@@ -35,6 +41,7 @@ The daemon will:
 var (
 	daemonForeground bool
 	pidFile          string
+	serviceName      string
 )
 
 func init() {
@@ -42,9 +49,29 @@ func init() {
 		"run in foreground (default: true)")
 	daemonCmd.Flags().StringVarP(&pidFile, "pidfile", "p", "/var/run/otus.pid",
 		"PID file path")
+	daemonCmd.Flags().StringVar(&serviceName, "service-name", service.DefaultName,
+		"service name when run by the Windows Service Control Manager")
+}
+
+// daemonArgs returns the command line of a daemon with the current flags.
+func daemonArgs() []string {
+	args := []string{"daemon", "--config", configFile, "--socket", socketPath, "--pidfile", pidFile}
+	if serviceName != service.DefaultName {
+		args = append(args, "--service-name", serviceName)
+	}
+	return args
 }
 
 func runDaemon() error {
+	if !daemonForeground {
+		pid, err := service.Detach(daemonArgs())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Otus daemon started in background (PID %d)\n", pid)
+		return nil
+	}
+
 	fmt.Println("Starting Otus daemon...")
 	fmt.Printf("Config: %s\n", configFile)
 	fmt.Printf("Socket: %s\n", socketPath)
@@ -56,11 +83,6 @@ func runDaemon() error {
 		return fmt.Errorf("failed to create daemon: %w", err)
 	}
 
-	// Start all components
-	if err := d.Start(); err != nil {
-		return fmt.Errorf("failed to start daemon: %w", err)
-	}
-
-	// Run main loop (blocks until shutdown)
-	return d.Run()
+	// Start all components and run the main loop (blocks until shutdown)
+	return service.Run(serviceName, d)
 }
@@ -0,0 +1,280 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/pcapimport"
+	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+var (
+	importPcapDir    string
+	importTaskConfig string
+	importStateFile  string
+	importCheckpoint int
+)
+
+// importCmd feeds historical captures through a task's parsers to its reporters
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import a directory of historical captures through a task config",
+	Long: `Process a directory of pcap/pcapng files through the parsers, processors
+and reporters of a task config, as fast as the reporters accept the output.
+No daemon is required and nothing is captured live. Use it to backfill
+Homer or Kafka with traffic recorded while an agent was down.
+
+Files are imported in path order through a single pipeline, so flows and
+SIP dialogs spanning several files are followed as in the live task, under
+the task's ID. Task-level components (calls, top_k, tcp_analysis,
+rtcp_correlation) are not run and reporter fallbacks are not used; of a
+reporter failover group only the first tier is imported into.
+
+Progress is checkpointed to a state file (by default one per capture
+directory under {data_dir}/import) every --checkpoint packets and at the end
+of every file, after the reporters have flushed. If the import fails or is
+interrupted, running the same command again resumes at the last checkpoint;
+packets after it are sent again. Packets before it are read again and run
+through the pipeline without being reported, so flows and SIP dialogs
+spanning the checkpoint are still followed.
+
+Examples:
+  otus import --pcap /var/spool/otus/pcap --task-config voip.yaml
+  otus import --pcap ./outage --task-config voip.yaml --state /tmp/outage.json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runImport()
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importPcapDir, "pcap", "",
+		"directory of captures to import (required)")
+	importCmd.Flags().StringVarP(&importTaskConfig, "task-config", "f", "",
+		"task configuration file (required)")
+	importCmd.Flags().StringVar(&importStateFile, "state", "",
+		"resume state file (default {data_dir}/import/<pcap dir hash>.json)")
+	importCmd.Flags().IntVar(&importCheckpoint, "checkpoint", pcapimport.DefaultCheckpoint,
+		"packets between checkpoints")
+	importCmd.MarkFlagRequired("pcap")
+	importCmd.MarkFlagRequired("task-config")
+}
+
+func runImport() {
+	data, err := os.ReadFile(importTaskConfig)
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to read file %s", importTaskConfig), err)
+	}
+	cfg, err := config.ParseTaskConfigAuto(data, importTaskConfig)
+	if err != nil {
+		exitWithError("invalid task configuration", err)
+	}
+	if cfg.AnalyzeOnly() || len(cfg.Reporters) == 0 {
+		exitWithError("task has no reporters to import into", nil)
+	}
+	if importCheckpoint <= 0 {
+		exitWithError("--checkpoint must be positive", nil)
+	}
+	statePath := importStateFile
+	if statePath == "" {
+		if statePath, err = importStatePath(importPcapDir); err != nil {
+			exitWithError("failed to create state directory", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	dec := decoder.NewStandardDecoder(decoder.Config{
+		Tunnels:      cfg.Decoder.Tunnels,
+		VXLANPorts:   cfg.Decoder.VXLANPorts,
+		IPReassembly: cfg.Decoder.IPReassembly,
+	})
+	p, err := buildReplayPipeline(cfg, cfg.ID, 0, dec, task.NewFlowRegistry())
+	if err != nil {
+		exitWithError("failed to build pipeline", err)
+	}
+	sink, err := startImportSink(cfg)
+	if err != nil {
+		exitWithError("failed to start reporters", err)
+	}
+
+	im := &pcapimport.Importer{
+		Handle: func(raw core.RawPacket) error {
+			out, ok := p.Process(raw)
+			if !ok {
+				return nil
+			}
+			return sink.add(ctx, out)
+		},
+		// Output of packets reported by an earlier run is dropped.
+		Replay:     func(raw core.RawPacket) { p.Process(raw) },
+		Flush:      sink.flush,
+		StatePath:  statePath,
+		Checkpoint: importCheckpoint,
+		Progress: func(pr pcapimport.Progress) {
+			status := "..."
+			if pr.FileDone {
+				status = "done"
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d packets %s (%.0f pkt/s overall)\n",
+				pr.FileIndex, pr.Files, pr.File, pr.FilePackets, status,
+				float64(pr.Packets)/max(pr.Elapsed.Seconds(), 1e-3))
+		},
+	}
+	sum, runErr := im.Run(ctx, importPcapDir)
+	sink.stop()
+
+	s := p.Stats()
+	fmt.Printf("imported %d/%d file(s) (%d already done, %d truncated), %d packets (%d replayed) in %s\n",
+		sum.Imported, sum.Files, sum.Skipped, sum.Truncated, sum.Packets, sum.Replayed, sum.Elapsed.Round(time.Millisecond))
+	fmt.Printf("  %d decoded, %d parsed, %d decode errors, %d dropped, %d reported\n",
+		s.Decoded, s.Parsed, s.DecodeErrors, s.Dropped, sink.reported)
+	switch {
+	case errors.Is(runErr, context.Canceled):
+		exitWithError(fmt.Sprintf("interrupted; run again to resume from %s", statePath), nil)
+	case runErr != nil:
+		exitWithError(fmt.Sprintf("import failed; run again to resume from %s", statePath), runErr)
+	}
+}
+
+// importStatePath returns the default state file of a capture directory,
+// under the data_dir of the config file (the default data_dir without one),
+// so the capture directory is never written to.
+func importStatePath(pcapDir string) (string, error) {
+	dataDir := config.DefaultDataDir
+	if global, err := config.Load(configFile); err == nil && global.DataDir != "" {
+		dataDir = global.DataDir
+	}
+	abs, err := filepath.Abs(pcapDir)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(dataDir, "import")
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// importSink batches pipeline output and delivers it synchronously to every
+// reporter, so a flush returning means the output has been accepted.
+type importSink struct {
+	reporters []plugin.Reporter
+	names     []string
+	retry     []task.RetryPolicy
+	batchSize int
+	batch     []*core.OutputPacket
+	reported  uint64
+}
+
+// startImportSink creates, initialises and starts the task's reporters.
+func startImportSink(cfg *config.TaskConfig) (*importSink, error) {
+	s := &importSink{batchSize: 100}
+	groups := cfg.FailoverGroups()
+	for i, rc := range cfg.Reporters {
+		if rc.Failover != nil && groups[rc.Failover.Group][0] != i {
+			continue
+		}
+		f, err := plugin.GetReporterFactory(rc.Name)
+		if err != nil {
+			s.stop()
+			return nil, fmt.Errorf("reporter %q: %w", rc.Name, err)
+		}
+		rep := f()
+		if ta, ok := rep.(plugin.TaskAware); ok {
+			ta.SetTaskID(cfg.ID)
+		}
+		if err := rep.Init(rc.Config); err != nil {
+			s.stop()
+			return nil, fmt.Errorf("reporter %q init failed: %w", rc.Name, err)
+		}
+		// Not ctx: an interrupted import still flushes to its last checkpoint
+		if err := rep.Start(context.Background()); err != nil {
+			s.stop()
+			return nil, fmt.Errorf("reporter %q start failed: %w", rc.Name, err)
+		}
+		s.reporters = append(s.reporters, rep)
+		s.names = append(s.names, rc.Name)
+		s.retry = append(s.retry, task.NewRetryPolicy(rc.Retry))
+		if rc.BatchSize > 0 {
+			s.batchSize = min(s.batchSize, rc.BatchSize)
+		}
+	}
+	return s, nil
+}
+
+func (s *importSink) add(ctx context.Context, out core.OutputPacket) error {
+	s.batch = append(s.batch, &out)
+	if len(s.batch) < s.batchSize {
+		return nil
+	}
+	return s.send(ctx)
+}
+
+// send delivers the pending batch to every reporter, with each reporter's
+// retry policy.
+func (s *importSink) send(ctx context.Context) error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	for i, rep := range s.reporters {
+		_, err := s.retry[i].Do(ctx, func() error {
+			if br, ok := rep.(plugin.BatchReporter); ok {
+				return br.ReportBatch(ctx, s.batch)
+			}
+			for _, pkt := range s.batch {
+				if err := rep.Report(ctx, pkt); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("reporter %q: %w", s.names[i], err)
+		}
+	}
+	s.reported += uint64(len(s.batch))
+	s.batch = s.batch[:0]
+	return nil
+}
+
+// flush sends the pending batch and flushes every reporter.
+func (s *importSink) flush(ctx context.Context) error {
+	if err := s.send(ctx); err != nil {
+		return err
+	}
+	for i, rep := range s.reporters {
+		if err := rep.Flush(ctx); err != nil {
+			return fmt.Errorf("reporter %q: %w", s.names[i], err)
+		}
+	}
+	return nil
+}
+
+// stop stops the started reporters.
+func (s *importSink) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i, rep := range s.reporters {
+		if err := rep.Stop(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: reporter %q stop failed: %v\n", s.names[i], err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/pcaparchive"
+)
+
+var (
+	pcapCallID string
+	pcapFrom   string
+	pcapTo     string
+	pcapOutput string
+)
+
+// pcapCmd represents the pcap command group
+var pcapCmd = &cobra.Command{
+	Use:   "pcap",
+	Short: "Work with pcap archives",
+	Long: `Work with the pcap archives written by the pcap reporter.
+
+Subcommands:
+  extract - Copy one call or a time window out of an archive`,
+}
+
+// pcapExtractCmd represents the pcap extract command
+var pcapExtractCmd = &cobra.Command{
+	Use:   "extract <archive-dir|file>...",
+	Short: "Copy one call or a time window out of an archive",
+	Long: `Copy the packets of one call (--call-id), or of a time window (--from /
+--to), from pcap reporter archives into a single pcap. No daemon is required.
+
+With --call-id only the call indexes (.cidx) and the matching records are
+read. Files still being written have no call index yet and are skipped with a
+warning. Time windows use the time indexes (.tidx) to skip to the window.
+
+Examples:
+  otus pcap extract /var/lib/otus/archive --call-id a84b4c76e66710@pc33.atlanta.com -o call.pcap
+  otus pcap extract /var/lib/otus/archive --from 2026-10-16T08:00:00Z --to 2026-10-16T08:05:00Z -o window.pcap`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runPcapExtract(args)
+	},
+}
+
+func init() {
+	pcapCmd.AddCommand(pcapExtractCmd)
+
+	pcapExtractCmd.Flags().StringVar(&pcapCallID, "call-id", "", "SIP Call-ID to extract")
+	pcapExtractCmd.Flags().StringVar(&pcapFrom, "from", "", "window start (RFC 3339)")
+	pcapExtractCmd.Flags().StringVar(&pcapTo, "to", "", "window end (RFC 3339)")
+	pcapExtractCmd.Flags().StringVarP(&pcapOutput, "output", "o", "-", "output pcap file, - for stdout")
+}
+
+func runPcapExtract(paths []string) {
+	from, err := parseTimeFlag("from", pcapFrom)
+	if err != nil {
+		exitWithError("invalid time window", err)
+	}
+	to, err := parseTimeFlag("to", pcapTo)
+	if err != nil {
+		exitWithError("invalid time window", err)
+	}
+	if pcapCallID == "" && from.IsZero() && to.IsZero() {
+		exitWithError("--call-id or --from/--to is required", nil)
+	}
+
+	files, err := pcaparchive.Files(paths)
+	if err != nil {
+		exitWithError("failed to list archive files", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if pcapOutput != "-" {
+		f, err := os.Create(pcapOutput)
+		if err != nil {
+			exitWithError("failed to create output file", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	bw := bufio.NewWriter(out)
+	e, err := pcaparchive.NewExtractor(bw)
+	if err != nil {
+		exitWithError("failed to write output", err)
+	}
+
+	matched := 0
+	for _, file := range files {
+		var n int
+		if pcapCallID != "" {
+			var indexed bool
+			n, indexed, err = e.Call(file, pcapCallID, from, to)
+			if err == nil && !indexed {
+				fmt.Fprintf(os.Stderr, "Warning: %s has no call index, skipped\n", file)
+			}
+		} else {
+			n, err = e.Range(file, from, to)
+		}
+		if err != nil {
+			exitWithError("extract failed", err)
+		}
+		if n > 0 {
+			matched++
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		exitWithError("failed to write output", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "%d packets from %d of %d files written to %s\n",
+		e.Packets(), matched, len(files), pcapOutput)
+}
+
+// parseTimeFlag parses an optional RFC 3339 flag value.
+func parseTimeFlag(name, v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--%s: %w", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,227 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/google/gopacket/pcapgo"
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/orderlog"
+	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+var (
+	replayConfigFile string
+	replayPcap       string
+	replayTrace      bool
+)
+
+// replayOrderCmd replays a capture in the order recorded by order_log
+var replayOrderCmd = &cobra.Command{
+	Use:   "replay-order <order-log>...",
+	Short: "Replay a capture in the packet order recorded by a task",
+	Long: `Replay a capture through the parsers and processors of a task config, in
+the order its pipelines saw the packets, as recorded by order_log. No daemon
+is required.
+
+Each pipeline gets its own parser and processor instances and all share one
+flow registry, as in the daemon. Each pipeline's packets keep their recorded
+order; packets of different pipelines are interleaved by the time they
+entered their pipeline. Replay is single-threaded, so a run that reproduces a
+bug reproduces it every time.
+
+Log records are matched to the capture by capture time, length and 5-tuple
+hash, so the capture must hold the same packets with the same timestamps,
+e.g. taken with tcpdump on the same host, or be the pcap that was fed to a
+pcapstream task. Task-level components (calls, top_k, tcp_analysis,
+rtcp_correlation) are not replayed.
+
+Examples:
+  otus replay-order -f task.yaml --pcap capture.pcap /var/lib/otus/orderlog/voip-*.olog
+  otus replay-order -f task.yaml --pcap capture.pcap voip-0.olog --trace > run1.jsonl`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runReplayOrder(args)
+	},
+}
+
+func init() {
+	replayOrderCmd.Flags().StringVarP(&replayConfigFile, "file", "f", "",
+		"task configuration file (required)")
+	replayOrderCmd.Flags().StringVar(&replayPcap, "pcap", "",
+		"capture holding the logged packets (required)")
+	replayOrderCmd.Flags().BoolVar(&replayTrace, "trace", false,
+		"print every replayed packet's output as a JSON line")
+	replayOrderCmd.MarkFlagRequired("file")
+	replayOrderCmd.MarkFlagRequired("pcap")
+}
+
+// replayOutput is one --trace line.
+type replayOutput struct {
+	Pipeline    int               `json:"pipeline"`
+	Seq         uint32            `json:"seq"`
+	Dropped     bool              `json:"dropped,omitempty"`
+	PayloadType string            `json:"payload_type,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+func runReplayOrder(logs []string) {
+	data, err := os.ReadFile(replayConfigFile)
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to read file %s", replayConfigFile), err)
+	}
+	cfg, err := config.ParseTaskConfigAuto(data, replayConfigFile)
+	if err != nil {
+		exitWithError("invalid task configuration", err)
+	}
+
+	packets, err := readReplayPcap(replayPcap)
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to read %s", replayPcap), err)
+	}
+
+	dec := decoder.NewStandardDecoder(decoder.Config{
+		Tunnels:      cfg.Decoder.Tunnels,
+		VXLANPorts:   cfg.Decoder.VXLANPorts,
+		IPReassembly: cfg.Decoder.IPReassembly,
+	})
+	registry := task.NewFlowRegistry()
+	pipelines := make(map[int]*pipeline.Pipeline)
+	var buildErr error
+	enc := json.NewEncoder(os.Stdout)
+
+	stats, err := orderlog.Replay(logs, packets, func(id int, rec orderlog.Record, frame []byte) {
+		if buildErr != nil {
+			return
+		}
+		p, ok := pipelines[id]
+		if !ok {
+			if p, buildErr = buildReplayPipeline(cfg, "replay-"+cfg.ID, id, dec, registry); buildErr != nil {
+				return
+			}
+			pipelines[id] = p
+		}
+		out, ok := p.Process(core.RawPacket{
+			Data:       frame,
+			Timestamp:  rec.Captured,
+			CaptureLen: rec.CaptureLen,
+			OrigLen:    uint32(len(frame)),
+		})
+		if !replayTrace {
+			return
+		}
+		line := replayOutput{Pipeline: id, Seq: rec.Seq, Dropped: !ok}
+		if ok {
+			line.PayloadType, line.Labels = out.PayloadType, out.Labels
+		}
+		enc.Encode(line)
+	})
+	if err != nil {
+		exitWithError("replay failed", err)
+	}
+	if buildErr != nil {
+		exitWithError("failed to build pipeline", buildErr)
+	}
+
+	w := os.Stdout
+	if replayTrace {
+		w = os.Stderr
+	}
+	fmt.Fprintf(w, "replayed %d/%d records from %d pipeline(s); %d without a captured packet, %d captured packets not logged\n",
+		stats.Replayed, stats.Records, stats.Pipelines, stats.Missing, stats.Unlogged)
+	ids := slices.Sorted(maps.Keys(pipelines))
+	for _, id := range ids {
+		s := pipelines[id].Stats()
+		fmt.Fprintf(w, "  pipeline %d: %d decoded, %d parsed, %d decode errors, %d dropped\n",
+			id, s.Decoded, s.Parsed, s.DecodeErrors, s.Dropped)
+	}
+}
+
+// readReplayPcap reads every packet of a classic pcap file.
+func readReplayPcap(path string) ([]orderlog.Packet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := pcapgo.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	var packets []orderlog.Packet
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return packets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("packet %d: %w", len(packets)+1, err)
+		}
+		packets = append(packets, orderlog.Packet{
+			Data:       data,
+			Captured:   ci.Timestamp.UnixNano(),
+			CaptureLen: uint32(ci.CaptureLength),
+			FlowHash:   task.FlowHash(core.RawPacket{Data: data}),
+		})
+	}
+}
+
+// buildReplayPipeline creates pipeline id of task taskID with fresh parsers
+// and processors, initialised and wired as the task manager does.
+func buildReplayPipeline(cfg *config.TaskConfig, taskID string, id int, dec decoder.Decoder, registry *task.FlowRegistry) (*pipeline.Pipeline, error) {
+	parsers := make([]plugin.Parser, 0, len(cfg.Parsers))
+	for _, pc := range cfg.Parsers {
+		f, err := plugin.GetParserFactory(pc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("parser %q: %w", pc.Name, err)
+		}
+		parser := f()
+		if err := parser.Init(pc.Config); err != nil {
+			return nil, fmt.Errorf("parser %q init failed: %w", pc.Name, err)
+		}
+		if fra, ok := parser.(plugin.FlowRegistryAware); ok {
+			fra.SetFlowRegistry(registry)
+		}
+		if ta, ok := parser.(plugin.TaskAware); ok {
+			ta.SetTaskID(taskID)
+		}
+		parsers = append(parsers, parser)
+	}
+
+	processors := make([]plugin.Processor, 0, len(cfg.Processors))
+	for _, pc := range cfg.Processors {
+		f, err := plugin.GetProcessorFactory(pc.Name)
+		if err != nil {
+			return nil, fmt.Errorf("processor %q: %w", pc.Name, err)
+		}
+		proc := f()
+		if err := proc.Init(pc.Config); err != nil {
+			return nil, fmt.Errorf("processor %q init failed: %w", pc.Name, err)
+		}
+		if ta, ok := proc.(plugin.TaskAware); ok {
+			ta.SetTaskID(taskID)
+		}
+		processors = append(processors, proc)
+	}
+
+	return pipeline.New(pipeline.Config{
+		ID:         id,
+		TaskID:     taskID,
+		Decoder:    dec,
+		Parsers:    parsers,
+		Processors: processors,
+	}), nil
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/buildinfo"
 )
 
 var (
@@ -28,7 +30,7 @@ Features:
   - Remote control: Kafka command subscription
   - Local control: CLI via Unix Domain Socket
   - Flexible deployment: physical, VM, container`,
-	Version: "0.1.0",
+	Version: buildinfo.Version,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -46,12 +48,18 @@ func init() {
 
 	// Add subcommands
 	rootCmd.AddCommand(daemonCmd)
+	rootCmd.AddCommand(serviceCmd)
 	rootCmd.AddCommand(taskCmd)
 	rootCmd.AddCommand(stopCmd)
 	rootCmd.AddCommand(reloadCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(callsCmd)
 	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(conformanceCmd)
+	rootCmd.AddCommand(pcapCmd)
+	rootCmd.AddCommand(replayOrderCmd)
+	rootCmd.AddCommand(importCmd)
 }
 
 // exitWithError prints error message and exits with code 1
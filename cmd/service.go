@@ -0,0 +1,81 @@
+// Package cmd implements CLI commands.
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"firestige.xyz/otus/internal/service"
+)
+
+// serviceCmd represents the service command group
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage the Otus daemon as a system service",
+	Long: `Install, uninstall, start and stop the Otus daemon as a system service.
+
+On Windows the service is registered with the Service Control Manager; on
+other platforms a systemd unit is written to /etc/systemd/system. The service
+runs "otus daemon" with the --config and --socket flags given here.`,
+}
+
+var serviceInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the service, started at boot",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		// The service manager does not start it in the current directory
+		config, err := filepath.Abs(configFile)
+		if err != nil {
+			exitWithError("invalid config path", err)
+		}
+		configFile = config
+		if err := service.Install(service.Config{Name: serviceName, Args: daemonArgs()}); err != nil {
+			exitWithError("failed to install service", err)
+		}
+		fmt.Printf("Service %s installed. Run 'otus service start' to start it.\n", serviceName)
+	},
+}
+
+var serviceUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Stop and remove the service",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := service.Uninstall(serviceName); err != nil {
+			exitWithError("failed to uninstall service", err)
+		}
+		fmt.Printf("Service %s removed.\n", serviceName)
+	},
+}
+
+var serviceStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start the installed service",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := service.Start(serviceName); err != nil {
+			exitWithError("failed to start service", err)
+		}
+		fmt.Printf("Service %s started.\n", serviceName)
+	},
+}
+
+var serviceStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the service and wait until it has stopped",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := service.Stop(serviceName); err != nil {
+			exitWithError("failed to stop service", err)
+		}
+		fmt.Printf("Service %s stopped.\n", serviceName)
+	},
+}
+
+func init() {
+	serviceCmd.PersistentFlags().StringVar(&serviceName, "name", service.DefaultName, "service name")
+	serviceCmd.AddCommand(serviceInstallCmd, serviceUninstallCmd, serviceStartCmd, serviceStopCmd)
+}
@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 
 	"firestige.xyz/otus/internal/command"
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/task"
 )
 
 // taskCmd represents the task command group
@@ -22,9 +26,20 @@ var taskCmd = &cobra.Command{
 
 Subcommands:
   create  - Create a new capture task
-  delete  - Delete a running task
+  delete  - Delete a running task (or all tasks with --tag)
+  pause   - Pause a running task (or all tasks with --tag)
+  resume  - Resume a paused task (or all tasks with --tag)
+  drain   - Stop capture, report buffered packets, then stop the task
+  reconfigure - Change plugin configs or swap a reporter of a running task
+  export  - Print the normalized configuration of a task
+  clone   - Create a copy of a task with a new ID and overrides
+  topk    - Show the heavy hitters of a task
+  fragments - Show the fragment rate limit of a task and its top offenders
   list    - List all tasks
-  status  - Get task status`,
+  status  - Get task status
+
+Tasks can be grouped with "tags" in their config; --tag may be repeated and
+selects tasks carrying all given tags.`,
 }
 
 // taskCreateCmd represents the task create command
@@ -34,9 +49,16 @@ var taskCreateCmd = &cobra.Command{
 	Long: `Create a new packet capture task from a JSON or YAML configuration file.
 File format is auto-detected from extension (.json, .yaml, .yml).
 
+With --template the task is built from a template in the daemon config
+(otus.task_templates) and the file holds only the overrides, at least the
+task id. --var sets the template variables, e.g. {interface} in the
+template. The effective configuration is printed.
+
 Examples:
   otus task create -f task.json
-  otus task create -f task.yaml`,
+  otus task create -f task.yaml
+  otus task create --template sbc-edge -f overrides.yaml
+  otus task create --template sbc-edge -f overrides.yaml --var interface=bond0 --var tenant=acme`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runTaskCreate(cmd)
 	},
@@ -44,12 +66,173 @@ Examples:
 
 // taskDeleteCmd represents the task delete command
 var taskDeleteCmd = &cobra.Command{
-	Use:   "delete <task-id>",
+	Use:   "delete <task-id> | --tag <tag>",
 	Short: "Delete a running task",
-	Long:  `Delete (stop) a running packet capture task by ID.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Delete (stop) a running packet capture task by ID, or every task
+carrying the given tags.
+
+Examples:
+  otus task delete voip-monitor-01
+  otus task delete --tag debug`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(taskTags) > 0 {
+			runTaskBulk("task_delete", command.TaskDeleteParams{Tags: taskTags})
+			return
+		}
+		runTaskDelete(selectedTaskID(args))
+	},
+}
+
+// taskPauseCmd represents the task pause command
+var taskPauseCmd = &cobra.Command{
+	Use:   "pause <task-id> | --tag <tag>",
+	Short: "Pause a running task",
+	Long: `Pause a running task by ID, or every task carrying the given tags.
+
+Examples:
+  otus task pause voip-monitor-01
+  otus task pause --tag media`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskSelector("task_pause", args)
+	},
+}
+
+// taskResumeCmd represents the task resume command
+var taskResumeCmd = &cobra.Command{
+	Use:   "resume <task-id> | --tag <tag>",
+	Short: "Resume a paused task",
+	Long:  `Resume a paused task by ID, or every task carrying the given tags.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskSelector("task_resume", args)
+	},
+}
+
+// taskDrainCmd represents the task drain command
+var taskDrainCmd = &cobra.Command{
+	Use:   "drain <task-id>",
+	Short: "Drain a running task",
+	Long: `Stop capture of a running task and wait until every buffered packet has
+been reported, then stop the task. Use before host maintenance to stop
+without losing in-flight data. The task stays listed as stopped until
+deleted; the drain duration is printed and shown by "otus task status".
+
+Examples:
+  otus task drain voip-monitor-01
+  otus task drain voip-monitor-01 --timeout 10m`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskDrain(args[0])
+	},
+}
+
+// taskReconfigureCmd represents the task reconfigure command
+var taskReconfigureCmd = &cobra.Command{
+	Use:   "reconfigure <task-id>",
+	Short: "Reconfigure a running task",
+	Long: `Apply task_reconfigure params from a JSON or YAML file to a running task:
+"plugins" updates plugin configs in place, "reporter_swap" replaces a
+reporter after a shadow warm-up. Follow the swap with "otus task status".
+
+Example file:
+  reporter_swap:
+    replace: kafka
+    reporter: {name: kafka, config: {brokers: ["kafka-new:9092"], topic: otus}}
+    warmup: 10m
+
+Examples:
+  otus task reconfigure voip-monitor-01 -f swap.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskReconfigure(args[0])
+	},
+}
+
+// taskExportCmd represents the task export command
+var taskExportCmd = &cobra.Command{
+	Use:   "export <task-id>",
+	Short: "Print the normalized configuration of a task",
+	Long: `Print the configuration of a task with defaults applied, in the form
+"otus task create -f" accepts, to replicate it on another agent. Secrets are
+redacted unless --with-secrets is set. With -o the configuration is written
+to a file, as YAML for .yaml / .yml and JSON otherwise.
+
+Examples:
+  otus task export voip-monitor-01
+  otus task export voip-monitor-01 --with-secrets -o voip-monitor-01.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskExport(args[0])
+	},
+}
+
+// taskCloneCmd represents the task clone command
+var taskCloneCmd = &cobra.Command{
+	Use:   "clone <task-id> <new-task-id>",
+	Short: "Create a copy of a task with a new ID",
+	Long: `Create a task from the configuration of an existing one. --interface sets
+capture.interface of the copy; -f reads further overrides (JSON or YAML),
+merged like task template overrides. The effective configuration is printed.
+
+Examples:
+  otus task clone voip-monitor-01 voip-monitor-02 --interface eth1
+  otus task clone voip-monitor-01 voip-monitor-lab -f overrides.yaml`,
+	Args: cobra.ExactArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
-		runTaskDelete(args[0])
+		runTaskClone(args[0], args[1])
+	},
+}
+
+// taskTopKCmd represents the task topk command
+var taskTopKCmd = &cobra.Command{
+	Use:   "topk <task-id>",
+	Short: "Show the heavy hitters of a task",
+	Long: `Show the most frequent values of the keys listed in the task's top_k.keys,
+e.g. the User-Agents or source addresses sending the most SIP traffic.
+
+Examples:
+  otus task topk voip-monitor-01
+  otus task topk voip-monitor-01 --key sip.user_agent --limit 5
+  otus task topk voip-monitor-01 --reset`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskTopK(args[0])
+	},
+}
+
+// taskFragmentsCmd represents the task fragments command
+var taskFragmentsCmd = &cobra.Command{
+	Use:   "fragments <task-id>",
+	Short: "Show the fragment rate limit of a task and its top offenders",
+	Long: `Show the per-source-IP fragment rate limit of a task (decoder.fragment_rate_limit),
+its counters and the source IPs with the most rate-limited fragments.
+
+Examples:
+  otus task fragments voip-monitor-01
+  otus task fragments voip-monitor-01 --limit 50`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskFragments(args[0])
+	},
+}
+
+// taskFlagCmd represents the task flag command
+var taskFlagCmd = &cobra.Command{
+	Use:   "flag <task-id> <flag> <on|off>",
+	Short: "Turn a feature flag of a running task on or off",
+	Long: `Turn a runtime feature flag of a task on or off (flag_set). The change
+applies at once and lasts until the task is recreated.
+
+Flags: adaptive_batch, shadow_parsers, zero_copy
+
+Examples:
+  otus task flag voip-monitor-01 zero_copy off
+  otus task flag voip-monitor-01 shadow_parsers on`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTaskFlag(args[0], args[1], args[2])
 	},
 }
 
@@ -83,12 +266,32 @@ If no task-id is provided, shows status of all tasks.`,
 
 var (
 	taskConfigFile string
+	taskTemplate   string
+	taskVars       map[string]string
+	taskTags       []string
+	exportOutput   string
+	exportSecrets  bool
+	cloneInterface string
+	topKKey        string
+	topKLimit      int
+	topKReset      bool
+	fragmentsLimit int
+	drainTimeout   time.Duration
 )
 
 func init() {
 	// Add subcommands to task command
 	taskCmd.AddCommand(taskCreateCmd)
 	taskCmd.AddCommand(taskDeleteCmd)
+	taskCmd.AddCommand(taskPauseCmd)
+	taskCmd.AddCommand(taskResumeCmd)
+	taskCmd.AddCommand(taskDrainCmd)
+	taskCmd.AddCommand(taskReconfigureCmd)
+	taskCmd.AddCommand(taskExportCmd)
+	taskCmd.AddCommand(taskCloneCmd)
+	taskCmd.AddCommand(taskTopKCmd)
+	taskCmd.AddCommand(taskFragmentsCmd)
+	taskCmd.AddCommand(taskFlagCmd)
 	taskCmd.AddCommand(taskListCmd)
 	taskCmd.AddCommand(taskStatusCmd)
 
@@ -96,6 +299,102 @@ func init() {
 	taskCreateCmd.Flags().StringVarP(&taskConfigFile, "file", "f", "",
 		"task configuration file (JSON or YAML) (required)")
 	taskCreateCmd.MarkFlagRequired("file")
+	taskCreateCmd.Flags().StringVar(&taskTemplate, "template", "",
+		"create from this task template; the file holds the overrides")
+	taskCreateCmd.Flags().StringToStringVar(&taskVars, "var", nil,
+		"template variable as name=value (repeatable, requires --template)")
+
+	// Flags for task reconfigure
+	taskReconfigureCmd.Flags().StringVarP(&taskConfigFile, "file", "f", "",
+		"task_reconfigure params file (JSON or YAML) (required)")
+	taskReconfigureCmd.MarkFlagRequired("file")
+
+	// Flags for task export
+	taskExportCmd.Flags().StringVarP(&exportOutput, "output", "o", "",
+		"write to this file instead of stdout (YAML for .yaml / .yml)")
+	taskExportCmd.Flags().BoolVar(&exportSecrets, "with-secrets", false,
+		"do not redact secrets")
+
+	// Flags for task clone
+	taskCloneCmd.Flags().StringVarP(&taskConfigFile, "file", "f", "",
+		"overrides file (JSON or YAML)")
+	taskCloneCmd.Flags().StringVar(&cloneInterface, "interface", "",
+		"capture interface of the copy")
+
+	// Flags for task drain
+	taskDrainCmd.Flags().DurationVar(&drainTimeout, "timeout", task.DefaultDrainTimeout,
+		"give up and force the task out after this long")
+
+	// Flags for task topk
+	taskTopKCmd.Flags().StringVar(&topKKey, "key", "", "only show this key")
+	taskTopKCmd.Flags().IntVar(&topKLimit, "limit", 0, "values per key (0 = top_k.k)")
+	taskTopKCmd.Flags().BoolVar(&topKReset, "reset", false, "restart counting after this snapshot")
+
+	// Flags for task fragments
+	taskFragmentsCmd.Flags().IntVar(&fragmentsLimit, "limit", 0, "top offenders shown (0 = 10)")
+
+	// Tag selectors
+	for _, c := range []*cobra.Command{taskDeleteCmd, taskPauseCmd, taskResumeCmd, taskListCmd} {
+		c.Flags().StringArrayVar(&taskTags, "tag", nil,
+			"select tasks carrying this tag (repeatable; all must match)")
+	}
+}
+
+// selectedTaskID returns the task-id argument, exiting when it is missing.
+func selectedTaskID(args []string) string {
+	if len(args) == 0 {
+		exitWithError("task-id or --tag is required", nil)
+	}
+	return args[0]
+}
+
+func runTaskSelector(method string, args []string) {
+	if len(taskTags) > 0 {
+		runTaskBulk(method, command.TaskSelectorParams{Tags: taskTags})
+		return
+	}
+
+	taskID := selectedTaskID(args)
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	resp, err := client.Call(context.Background(), method, command.TaskSelectorParams{TaskID: taskID})
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to send %s command", method), err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("%s failed: %s", method, resp.Error.Message), nil)
+	}
+
+	fmt.Printf("Task %s: %v\n", taskID, resp.Result.(map[string]interface{})["status"])
+}
+
+// runTaskBulk sends a tag-selector command and prints which tasks matched.
+func runTaskBulk(method string, params interface{}) {
+	client := command.NewUDSClient(socketPath, 30*time.Second)
+	resp, err := client.Call(context.Background(), method, params)
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to send %s command", method), err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("%s failed: %s", method, resp.Error.Message), nil)
+	}
+
+	var result command.BulkResult
+	data, _ := json.Marshal(resp.Result)
+	if err := json.Unmarshal(data, &result); err != nil {
+		exitWithError("invalid response format", err)
+	}
+
+	fmt.Printf("%s %v: %d matched, %d succeeded, %d failed\n",
+		method, result.Tags, len(result.Matched), len(result.Succeeded), len(result.Failed))
+	for _, id := range result.Succeeded {
+		fmt.Printf("  ok     %s\n", id)
+	}
+	for id, msg := range result.Failed {
+		fmt.Printf("  failed %s: %s\n", id, msg)
+	}
+	if len(result.Failed) > 0 {
+		os.Exit(1)
+	}
 }
 
 func runTaskCreate(cmd *cobra.Command) {
@@ -105,6 +404,14 @@ func runTaskCreate(cmd *cobra.Command) {
 		exitWithError(fmt.Sprintf("failed to read config file %s", taskConfigFile), err)
 	}
 
+	if taskTemplate != "" {
+		runTaskCreateFromTemplate(data)
+		return
+	}
+	if len(taskVars) > 0 {
+		exitWithError("--var requires --template", nil)
+	}
+
 	// Parse task config — auto-detect JSON/YAML from file extension
 	taskConfig, err := config.ParseTaskConfigAuto(data, taskConfigFile)
 	if err != nil {
@@ -118,7 +425,7 @@ func runTaskCreate(cmd *cobra.Command) {
 	// Send create command
 	fmt.Printf("Creating task %s...\n", taskConfig.ID)
 	params := command.TaskCreateParams{Config: *taskConfig}
-	resp, err := client.TaskCreate(ctx, params)
+	resp, err := client.CallWithProgress(ctx, "task_create", params, printProgress)
 	if err != nil {
 		exitWithError("failed to send create command", err)
 	}
@@ -130,6 +437,154 @@ func runTaskCreate(cmd *cobra.Command) {
 	fmt.Printf("Task %s created successfully.\n", taskConfig.ID)
 }
 
+// printProgress prints a progress event of a command in flight.
+func printProgress(p command.Progress) {
+	fmt.Printf("  %s\n", p.Stage)
+}
+
+// runTaskCreateFromTemplate sends task_create with --template and the
+// overrides read from the file, and prints the effective configuration.
+func runTaskCreateFromTemplate(data []byte) {
+	// YAML is a superset of JSON, so one decoder covers both formats.
+	var overrides map[string]any
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		exitWithError(fmt.Sprintf("failed to parse overrides file %s", taskConfigFile), err)
+	}
+
+	client := command.NewUDSClient(socketPath, 30*time.Second)
+	params := command.TaskCreateParams{Template: taskTemplate, Overrides: overrides}
+	if len(taskVars) > 0 {
+		params.Variables = make(map[string]any, len(taskVars))
+		for k, v := range taskVars {
+			params.Variables[k] = v
+		}
+	}
+	resp, err := client.CallWithProgress(context.Background(), "task_create", params, printProgress)
+	if err != nil {
+		exitWithError("failed to send create command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_create failed: %s", resp.Error.Message), nil)
+	}
+
+	result, _ := resp.Result.(map[string]interface{})
+	fmt.Printf("Task %v created successfully from template %s.\n", result["task_id"], taskTemplate)
+	effective, _ := json.MarshalIndent(result["effective_config"], "", "  ")
+	fmt.Printf("Effective configuration:\n%s\n", effective)
+}
+
+func runTaskReconfigure(taskID string) {
+	data, err := os.ReadFile(taskConfigFile)
+	if err != nil {
+		exitWithError(fmt.Sprintf("failed to read params file %s", taskConfigFile), err)
+	}
+	// YAML is a superset of JSON; round-trip through JSON for the json tags.
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		exitWithError(fmt.Sprintf("failed to parse params file %s", taskConfigFile), err)
+	}
+	var params command.TaskReconfigureParams
+	if data, err = json.Marshal(raw); err == nil {
+		err = json.Unmarshal(data, &params)
+	}
+	if err != nil {
+		exitWithError(fmt.Sprintf("invalid params file %s", taskConfigFile), err)
+	}
+	params.TaskID = taskID
+
+	client := command.NewUDSClient(socketPath, 30*time.Second)
+	resp, err := client.Call(context.Background(), "task_reconfigure", params)
+	if err != nil {
+		exitWithError("failed to send reconfigure command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_reconfigure failed: %s", resp.Error.Message), nil)
+	}
+
+	result, _ := resp.Result.(map[string]interface{})
+	fmt.Printf("Task %s reconfigured.\n", taskID)
+	if swap, ok := result["reporter_swap"].(map[string]interface{}); ok {
+		fmt.Printf("Reporter swap %v -> %v %v, switching at %v.\n",
+			swap["replace"], swap["reporter"], swap["state"], swap["switch_at"])
+	}
+}
+
+func runTaskExport(taskID string) {
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	resp, err := client.TaskExport(context.Background(), command.TaskExportParams{
+		TaskID:      taskID,
+		WithSecrets: exportSecrets,
+	})
+	if err != nil {
+		exitWithError("failed to send export command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_export failed: %s", resp.Error.Message), nil)
+	}
+
+	result, _ := resp.Result.(map[string]interface{})
+	var data []byte
+	switch strings.ToLower(filepath.Ext(exportOutput)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(result["config"])
+	default:
+		data, err = json.MarshalIndent(result["config"], "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		exitWithError("failed to format config", err)
+	}
+
+	if exportOutput == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(exportOutput, data, 0o600); err != nil {
+		exitWithError(fmt.Sprintf("failed to write %s", exportOutput), err)
+	}
+	fmt.Printf("Task %s exported to %s.\n", taskID, exportOutput)
+}
+
+func runTaskClone(taskID, newID string) {
+	var overrides map[string]any
+	if taskConfigFile != "" {
+		data, err := os.ReadFile(taskConfigFile)
+		if err != nil {
+			exitWithError(fmt.Sprintf("failed to read overrides file %s", taskConfigFile), err)
+		}
+		// YAML is a superset of JSON, so one decoder covers both formats.
+		if err := yaml.Unmarshal(data, &overrides); err != nil {
+			exitWithError(fmt.Sprintf("failed to parse overrides file %s", taskConfigFile), err)
+		}
+	}
+	if cloneInterface != "" {
+		if overrides == nil {
+			overrides = make(map[string]any)
+		}
+		capture, _ := overrides["capture"].(map[string]any)
+		if capture == nil {
+			capture = make(map[string]any)
+		}
+		capture["interface"] = cloneInterface
+		overrides["capture"] = capture
+	}
+
+	client := command.NewUDSClient(socketPath, 30*time.Second)
+	params := command.TaskCloneParams{TaskID: taskID, NewID: newID, Overrides: overrides}
+	resp, err := client.CallWithProgress(context.Background(), "task_clone", params, printProgress)
+	if err != nil {
+		exitWithError("failed to send clone command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_clone failed: %s", resp.Error.Message), nil)
+	}
+
+	result, _ := resp.Result.(map[string]interface{})
+	fmt.Printf("Task %s cloned to %v.\n", taskID, result["task_id"])
+	effective, _ := json.MarshalIndent(result["effective_config"], "", "  ")
+	fmt.Printf("Effective configuration:\n%s\n", effective)
+}
+
 func runTaskDelete(taskID string) {
 	client := command.NewUDSClient(socketPath, 10*time.Second)
 	ctx := context.Background()
@@ -148,12 +603,103 @@ func runTaskDelete(taskID string) {
 	fmt.Printf("Task %s deleted successfully.\n", taskID)
 }
 
+func runTaskDrain(taskID string) {
+	// The daemon answers when the drain completes
+	client := command.NewUDSClient(socketPath, drainTimeout+10*time.Second)
+
+	fmt.Printf("Draining task %s...\n", taskID)
+	resp, err := client.TaskDrain(context.Background(), command.TaskDrainParams{
+		TaskID:  taskID,
+		Timeout: drainTimeout.String(),
+	})
+	if err != nil {
+		exitWithError("failed to send drain command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_drain failed: %s", resp.Error.Message), nil)
+	}
+
+	fmt.Printf("Task %s drained in %v.\n", taskID, resp.Result.(map[string]interface{})["drain_duration"])
+}
+
+func runTaskTopK(taskID string) {
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	resp, err := client.Call(context.Background(), "task_topk", command.TaskTopKParams{
+		TaskID: taskID,
+		Key:    topKKey,
+		Limit:  topKLimit,
+		Reset:  topKReset,
+	})
+	if err != nil {
+		exitWithError("failed to send topk command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_topk failed: %s", resp.Error.Message), nil)
+	}
+
+	resultJSON, err := json.MarshalIndent(resp.Result, "", "  ")
+	if err != nil {
+		exitWithError("failed to format result", err)
+	}
+	fmt.Println(string(resultJSON))
+}
+
+func runTaskFragments(taskID string) {
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	resp, err := client.Call(context.Background(), "task_fragments", command.TaskFragmentsParams{
+		TaskID: taskID,
+		Limit:  fragmentsLimit,
+	})
+	if err != nil {
+		exitWithError("failed to send fragments command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("task_fragments failed: %s", resp.Error.Message), nil)
+	}
+
+	resultJSON, err := json.MarshalIndent(resp.Result, "", "  ")
+	if err != nil {
+		exitWithError("failed to format result", err)
+	}
+	fmt.Println(string(resultJSON))
+}
+
+func runTaskFlag(taskID, flag, value string) {
+	var enabled bool
+	switch value {
+	case "on", "true":
+		enabled = true
+	case "off", "false":
+	default:
+		exitWithError(fmt.Sprintf("flag value must be on or off, got %q", value), nil)
+	}
+
+	client := command.NewUDSClient(socketPath, 10*time.Second)
+	resp, err := client.Call(context.Background(), "flag_set", command.FlagSetParams{
+		TaskID:  taskID,
+		Flag:    flag,
+		Enabled: &enabled,
+	})
+	if err != nil {
+		exitWithError("failed to send flag_set command", err)
+	}
+	if resp.Error != nil {
+		exitWithError(fmt.Sprintf("flag_set failed: %s", resp.Error.Message), nil)
+	}
+
+	resultJSON, err := json.MarshalIndent(resp.Result, "", "  ")
+	if err != nil {
+		exitWithError("failed to format result", err)
+	}
+	fmt.Println(string(resultJSON))
+}
+
 func runTaskList() {
 	client := command.NewUDSClient(socketPath, 10*time.Second)
 	ctx := context.Background()
 
 	// Send list command
-	resp, err := client.TaskList(ctx)
+	resp, err := client.Call(ctx, "task_list", command.TaskListParams{Tags: taskTags})
 	if err != nil {
 		exitWithError("failed to send list command", err)
 	}
@@ -0,0 +1,301 @@
+// Package alert implements the in-agent alert evaluator.
+//
+// Rules are evaluated periodically over per-task counter samples so that
+// capture loss, silent interfaces and failing reporters surface even when no
+// Prometheus server is scraping the agent.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// Rule types.
+const (
+	TypeDropRate            = "drop_rate"
+	TypeZeroPackets         = "zero_packets"
+	TypeReporterErrorStreak = "reporter_error_streak"
+)
+
+// State is the state carried by an alert event.
+type State string
+
+const (
+	// StateFiring indicates the rule condition started to hold.
+	StateFiring State = "firing"
+	// StateResolved indicates the rule condition no longer holds.
+	StateResolved State = "resolved"
+)
+
+// Health summarises agent health derived from active alerts.
+type Health string
+
+const (
+	// HealthOK means no alert is firing.
+	HealthOK Health = "ok"
+	// HealthDegraded means at least one alert is firing.
+	HealthDegraded Health = "degraded"
+)
+
+// Sample is a point-in-time snapshot of one task's counters.
+// Packet counters are cumulative; the evaluator computes deltas itself.
+type Sample struct {
+	TaskID              string
+	PacketsReceived     uint64
+	PacketsDropped      uint64
+	Reporter            string // reporter with the longest error streak
+	ReporterErrorStreak int64
+}
+
+// Event is emitted whenever a rule changes state for a task.
+type Event struct {
+	Rule      string    `json:"rule"`
+	Type      string    `json:"type"`
+	Severity  string    `json:"severity"`
+	TaskID    string    `json:"task_id"`
+	State     State     `json:"state"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// rule is a validated AlertRuleConfig with parsed durations.
+type rule struct {
+	config.AlertRuleConfig
+	window time.Duration // zero_packets silence window
+}
+
+// taskState tracks per-task counters between evaluations.
+type taskState struct {
+	received     uint64
+	dropped      uint64
+	lastActivity time.Time
+}
+
+// alertKey identifies an active alert.
+type alertKey struct {
+	rule   string
+	taskID string
+}
+
+// Evaluator evaluates alert rules over task samples.
+// It is safe for concurrent use.
+type Evaluator struct {
+	mu     sync.Mutex
+	rules  []rule
+	tasks  map[string]*taskState
+	active map[alertKey]Event
+}
+
+// NewEvaluator creates an evaluator from validated rule configs
+// (see config.GlobalConfig.ValidateAndApplyDefaults).
+func NewEvaluator(rules []config.AlertRuleConfig) *Evaluator {
+	e := &Evaluator{
+		rules:  make([]rule, 0, len(rules)),
+		tasks:  make(map[string]*taskState),
+		active: make(map[alertKey]Event),
+	}
+	for _, rc := range rules {
+		r := rule{AlertRuleConfig: rc}
+		if rc.Type == TypeZeroPackets {
+			r.window, _ = time.ParseDuration(rc.For)
+		}
+		if r.Severity == "" {
+			r.Severity = "warning"
+		}
+		e.rules = append(e.rules, r)
+	}
+	return e
+}
+
+// Evaluate evaluates all rules against the given samples and returns the
+// events for rules that changed state (firing or resolved) in this round.
+// Active alerts of tasks no longer present in samples are resolved.
+func (e *Evaluator) Evaluate(now time.Time, samples []Sample) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var events []Event
+	seen := make(map[string]bool, len(samples))
+
+	for _, s := range samples {
+		seen[s.TaskID] = true
+
+		prev, known := e.tasks[s.TaskID]
+		if !known {
+			// First sample establishes the baseline; rates need a previous point.
+			e.tasks[s.TaskID] = &taskState{
+				received:     s.PacketsReceived,
+				dropped:      s.PacketsDropped,
+				lastActivity: now,
+			}
+			prev = nil
+		}
+
+		var deltaRecv, deltaDrop uint64
+		if prev != nil {
+			deltaRecv = counterDelta(s.PacketsReceived, prev.received)
+			deltaDrop = counterDelta(s.PacketsDropped, prev.dropped)
+			prev.received = s.PacketsReceived
+			prev.dropped = s.PacketsDropped
+			if deltaRecv > 0 {
+				prev.lastActivity = now
+			}
+		}
+		st := e.tasks[s.TaskID]
+
+		for _, r := range e.rules {
+			var value float64
+			var firing bool
+			var msg string
+
+			switch r.Type {
+			case TypeDropRate:
+				if prev == nil {
+					continue
+				}
+				if total := deltaRecv + deltaDrop; total > 0 {
+					value = float64(deltaDrop) / float64(total) * 100
+				}
+				firing = value > r.Threshold
+				msg = fmt.Sprintf("capture drop rate %.2f%% (threshold %.2f%%)", value, r.Threshold)
+
+			case TypeZeroPackets:
+				silent := now.Sub(st.lastActivity)
+				value = silent.Seconds()
+				firing = silent >= r.window
+				msg = fmt.Sprintf("no packets received for %s (window %s)", silent.Truncate(time.Second), r.window)
+
+			case TypeReporterErrorStreak:
+				value = float64(s.ReporterErrorStreak)
+				firing = value >= r.Threshold
+				msg = fmt.Sprintf("reporter %q failed %d consecutive batches (threshold %.0f)",
+					s.Reporter, s.ReporterErrorStreak, r.Threshold)
+
+			default:
+				continue
+			}
+
+			if ev, changed := e.transition(r, s.TaskID, firing, value, msg, now); changed {
+				events = append(events, ev)
+			}
+		}
+	}
+
+	// Resolve alerts of tasks that disappeared and forget their counters.
+	for key, ev := range e.active {
+		if seen[key.taskID] {
+			continue
+		}
+		delete(e.active, key)
+		ev.State = StateResolved
+		ev.Message = "task no longer present"
+		ev.Timestamp = now
+		events = append(events, ev)
+	}
+	for id := range e.tasks {
+		if !seen[id] {
+			delete(e.tasks, id)
+		}
+	}
+
+	return events
+}
+
+// transition updates the active set and reports whether the rule changed state.
+func (e *Evaluator) transition(r rule, taskID string, firing bool, value float64, msg string, now time.Time) (Event, bool) {
+	key := alertKey{rule: r.Name, taskID: taskID}
+	_, active := e.active[key]
+
+	ev := Event{
+		Rule:      r.Name,
+		Type:      r.Type,
+		Severity:  r.Severity,
+		TaskID:    taskID,
+		Value:     value,
+		Threshold: r.Threshold,
+		Message:   msg,
+		Timestamp: now,
+	}
+
+	switch {
+	case firing && !active:
+		ev.State = StateFiring
+		e.active[key] = ev
+		return ev, true
+	case firing && active:
+		// Keep the latest value for status queries; no new event.
+		ev.State = StateFiring
+		e.active[key] = ev
+		return ev, false
+	case !firing && active:
+		delete(e.active, key)
+		ev.State = StateResolved
+		return ev, true
+	}
+	return ev, false
+}
+
+// Active returns the currently firing alerts sorted by task and rule.
+func (e *Evaluator) Active() []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]Event, 0, len(e.active))
+	for _, ev := range e.active {
+		out = append(out, ev)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TaskID != out[j].TaskID {
+			return out[i].TaskID < out[j].TaskID
+		}
+		return out[i].Rule < out[j].Rule
+	})
+	return out
+}
+
+// Health returns HealthDegraded while any alert is firing.
+func (e *Evaluator) Health() Health {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.active) > 0 {
+		return HealthDegraded
+	}
+	return HealthOK
+}
+
+// Run evaluates rules every interval until ctx is cancelled.
+// source supplies fresh samples; sink receives every state-change event.
+func (e *Evaluator) Run(ctx context.Context, interval time.Duration, source func() []Sample, sink func(Event)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("alert evaluator started", "rules", len(e.rules), "interval", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, ev := range e.Evaluate(now, source()) {
+				sink(ev)
+			}
+		}
+	}
+}
+
+// counterDelta returns cur-prev, treating a decrease as a counter reset.
+func counterDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
@@ -0,0 +1,112 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+func TestEvaluator_DropRate(t *testing.T) {
+	e := NewEvaluator([]config.AlertRuleConfig{
+		{Name: "drops", Type: TypeDropRate, Threshold: 5},
+	})
+	now := time.Now()
+
+	// Baseline: no events on first sample.
+	if ev := e.Evaluate(now, []Sample{{TaskID: "t1", PacketsReceived: 100}}); len(ev) != 0 {
+		t.Fatalf("expected no events on baseline, got %v", ev)
+	}
+
+	// 90 received, 10 dropped → 10% > 5%
+	ev := e.Evaluate(now.Add(time.Second), []Sample{{TaskID: "t1", PacketsReceived: 190, PacketsDropped: 10}})
+	if len(ev) != 1 || ev[0].State != StateFiring {
+		t.Fatalf("expected one firing event, got %v", ev)
+	}
+	if ev[0].Value != 10 {
+		t.Errorf("drop rate = %v, want 10", ev[0].Value)
+	}
+	if e.Health() != HealthDegraded {
+		t.Errorf("health = %s, want degraded", e.Health())
+	}
+
+	// Still firing: no duplicate event.
+	if ev := e.Evaluate(now.Add(2*time.Second), []Sample{{TaskID: "t1", PacketsReceived: 280, PacketsDropped: 20}}); len(ev) != 0 {
+		t.Errorf("expected no events while still firing, got %v", ev)
+	}
+
+	// Clean window → resolved.
+	ev = e.Evaluate(now.Add(3*time.Second), []Sample{{TaskID: "t1", PacketsReceived: 380, PacketsDropped: 20}})
+	if len(ev) != 1 || ev[0].State != StateResolved {
+		t.Fatalf("expected one resolved event, got %v", ev)
+	}
+	if e.Health() != HealthOK {
+		t.Errorf("health = %s, want ok", e.Health())
+	}
+}
+
+func TestEvaluator_ZeroPackets(t *testing.T) {
+	e := NewEvaluator([]config.AlertRuleConfig{
+		{Name: "silent", Type: TypeZeroPackets, For: "30s", Severity: "critical"},
+	})
+	now := time.Now()
+
+	e.Evaluate(now, []Sample{{TaskID: "t1", PacketsReceived: 10}})
+	if ev := e.Evaluate(now.Add(20*time.Second), []Sample{{TaskID: "t1", PacketsReceived: 10}}); len(ev) != 0 {
+		t.Fatalf("expected no events inside window, got %v", ev)
+	}
+
+	ev := e.Evaluate(now.Add(31*time.Second), []Sample{{TaskID: "t1", PacketsReceived: 10}})
+	if len(ev) != 1 || ev[0].State != StateFiring || ev[0].Severity != "critical" {
+		t.Fatalf("expected critical firing event, got %v", ev)
+	}
+
+	// Traffic resumes.
+	ev = e.Evaluate(now.Add(32*time.Second), []Sample{{TaskID: "t1", PacketsReceived: 11}})
+	if len(ev) != 1 || ev[0].State != StateResolved {
+		t.Fatalf("expected resolved event, got %v", ev)
+	}
+}
+
+func TestEvaluator_ReporterErrorStreak(t *testing.T) {
+	e := NewEvaluator([]config.AlertRuleConfig{
+		{Name: "reporter", Type: TypeReporterErrorStreak, Threshold: 3},
+	})
+	now := time.Now()
+
+	if ev := e.Evaluate(now, []Sample{{TaskID: "t1", Reporter: "kafka", ReporterErrorStreak: 2}}); len(ev) != 0 {
+		t.Fatalf("expected no events below threshold, got %v", ev)
+	}
+	ev := e.Evaluate(now.Add(time.Second), []Sample{{TaskID: "t1", Reporter: "kafka", ReporterErrorStreak: 3}})
+	if len(ev) != 1 || ev[0].State != StateFiring {
+		t.Fatalf("expected firing event, got %v", ev)
+	}
+	if active := e.Active(); len(active) != 1 || active[0].Rule != "reporter" {
+		t.Errorf("Active() = %v, want one reporter alert", active)
+	}
+}
+
+func TestEvaluator_TaskRemovedResolves(t *testing.T) {
+	e := NewEvaluator([]config.AlertRuleConfig{
+		{Name: "reporter", Type: TypeReporterErrorStreak, Threshold: 1},
+	})
+	now := time.Now()
+
+	e.Evaluate(now, []Sample{{TaskID: "t1", ReporterErrorStreak: 5}})
+	ev := e.Evaluate(now.Add(time.Second), nil)
+	if len(ev) != 1 || ev[0].State != StateResolved || ev[0].TaskID != "t1" {
+		t.Fatalf("expected resolved event for removed task, got %v", ev)
+	}
+	if e.Health() != HealthOK {
+		t.Errorf("health = %s, want ok", e.Health())
+	}
+}
+
+func TestCounterDelta_Reset(t *testing.T) {
+	if got := counterDelta(5, 100); got != 5 {
+		t.Errorf("counterDelta(5, 100) = %d, want 5", got)
+	}
+	if got := counterDelta(150, 100); got != 50 {
+		t.Errorf("counterDelta(150, 100) = %d, want 50", got)
+	}
+}
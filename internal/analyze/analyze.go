@@ -0,0 +1,117 @@
+// Package analyze implements the counters of analyze_only tasks.
+//
+// An analyze_only task runs the full capture → decode → parse → process
+// pipeline but, instead of exporting packets, only counts them per protocol
+// and per value of selected labels. The totals size a deployment (message
+// rates, call mix, top talkers) before full export is enabled.
+package analyze
+
+import (
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// DefaultMaxValues bounds the distinct values counted per label when the task
+// config leaves it unset.
+const DefaultMaxValues = 100
+
+// OtherValue collects label values seen after the per-label limit is reached.
+const OtherValue = "_other"
+
+// Summary is a snapshot of the counters.
+type Summary struct {
+	Since     time.Time                    `json:"since"`
+	Packets   uint64                       `json:"packets"`
+	Bytes     uint64                       `json:"bytes"`
+	Protocols map[string]uint64            `json:"protocols"`        // by payload type
+	Labels    map[string]map[string]uint64 `json:"labels,omitempty"` // label key → value → packets
+}
+
+// Counter counts output packets of one task.
+// It is safe for concurrent use.
+type Counter struct {
+	labels    []string
+	maxValues int
+
+	mu        sync.Mutex
+	since     time.Time
+	packets   uint64
+	bytes     uint64
+	protocols map[string]uint64
+	values    map[string]map[string]uint64
+}
+
+// NewCounter creates a counter tracking the values of the given label keys,
+// at most maxValues distinct values per key.
+func NewCounter(labels []string, maxValues int) *Counter {
+	if maxValues <= 0 {
+		maxValues = DefaultMaxValues
+	}
+	values := make(map[string]map[string]uint64, len(labels))
+	for _, key := range labels {
+		values[key] = make(map[string]uint64)
+	}
+	return &Counter{
+		labels:    labels,
+		maxValues: maxValues,
+		since:     time.Now(),
+		protocols: make(map[string]uint64),
+		values:    values,
+	}
+}
+
+// Observe counts one output packet.
+func (c *Counter) Observe(pkt *core.OutputPacket) {
+	protocol := pkt.PayloadType
+	if protocol == "" {
+		protocol = "raw"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.packets++
+	c.bytes += uint64(len(pkt.RawPayload))
+	c.protocols[protocol]++
+
+	for _, key := range c.labels {
+		value, ok := pkt.Labels[key]
+		if !ok {
+			continue
+		}
+		counts := c.values[key]
+		if _, seen := counts[value]; !seen && len(counts) >= c.maxValues {
+			value = OtherValue
+		}
+		counts[value]++
+	}
+}
+
+// Snapshot returns a copy of the current counters.
+func (c *Counter) Snapshot() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Summary{
+		Since:     c.since,
+		Packets:   c.packets,
+		Bytes:     c.bytes,
+		Protocols: make(map[string]uint64, len(c.protocols)),
+	}
+	for protocol, n := range c.protocols {
+		s.Protocols[protocol] = n
+	}
+	if len(c.values) > 0 {
+		s.Labels = make(map[string]map[string]uint64, len(c.values))
+		for key, counts := range c.values {
+			cp := make(map[string]uint64, len(counts))
+			for value, n := range counts {
+				cp[value] = n
+			}
+			s.Labels[key] = cp
+		}
+	}
+	return s
+}
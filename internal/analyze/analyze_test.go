@@ -0,0 +1,50 @@
+package analyze
+
+import (
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter([]string{core.LabelSIPMethod}, 2)
+
+	packets := []core.OutputPacket{
+		{PayloadType: "sip", RawPayload: make([]byte, 100), Labels: core.Labels{core.LabelSIPMethod: "INVITE"}},
+		{PayloadType: "sip", RawPayload: make([]byte, 50), Labels: core.Labels{core.LabelSIPMethod: "BYE"}},
+		{PayloadType: "sip", Labels: core.Labels{core.LabelSIPMethod: "INVITE"}},
+		{PayloadType: "sip", Labels: core.Labels{core.LabelSIPMethod: "OPTIONS"}}, // over the limit
+		{PayloadType: "rtp", RawPayload: make([]byte, 172)},
+		{},
+	}
+	for i := range packets {
+		c.Observe(&packets[i])
+	}
+
+	s := c.Snapshot()
+	if s.Packets != 6 || s.Bytes != 322 {
+		t.Errorf("packets/bytes = %d/%d, want 6/322", s.Packets, s.Bytes)
+	}
+	wantProtocols := map[string]uint64{"sip": 4, "rtp": 1, "raw": 1}
+	for protocol, want := range wantProtocols {
+		if got := s.Protocols[protocol]; got != want {
+			t.Errorf("protocols[%s] = %d, want %d", protocol, got, want)
+		}
+	}
+	wantMethods := map[string]uint64{"INVITE": 2, "BYE": 1, OtherValue: 1}
+	methods := s.Labels[core.LabelSIPMethod]
+	if len(methods) != len(wantMethods) {
+		t.Errorf("methods = %v, want %v", methods, wantMethods)
+	}
+	for value, want := range wantMethods {
+		if got := methods[value]; got != want {
+			t.Errorf("methods[%s] = %d, want %d", value, got, want)
+		}
+	}
+
+	// Snapshots are copies.
+	s.Labels[core.LabelSIPMethod]["INVITE"] = 99
+	if got := c.Snapshot().Labels[core.LabelSIPMethod]["INVITE"]; got != 2 {
+		t.Errorf("snapshot aliased counter state: INVITE = %d", got)
+	}
+}
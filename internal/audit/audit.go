@@ -0,0 +1,162 @@
+// Package audit implements the periodic self-audit of the agent.
+//
+// Interfaces, collectors and certificates are verified when a task starts and
+// then trusted until something fails. The audit re-checks them on a timer so
+// latent breakage (a removed interface, an unreachable collector, a
+// certificate about to expire) shows up as a degraded component in
+// daemon_status and metrics before an incident exposes it.
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Component kinds.
+const (
+	KindInterface   = "interface"
+	KindPlugin      = "plugin"
+	KindCertificate = "certificate"
+)
+
+// Check is one audited component.
+type Check struct {
+	Kind   string
+	Name   string
+	TaskID string // empty for agent-wide components
+	Run    func(ctx context.Context) error
+}
+
+// Component is a degraded component.
+type Component struct {
+	Kind   string    `json:"kind"`
+	Name   string    `json:"name"`
+	TaskID string    `json:"task_id,omitempty"`
+	Reason string    `json:"reason"`
+	Since  time.Time `json:"since"` // first failed check
+}
+
+// Change reports a component that became degraded or recovered.
+type Change struct {
+	Component
+	Degraded bool
+	Removed  bool // recovered because it is no longer checked (a deleted task)
+}
+
+// key identifies a component across audits.
+type key struct {
+	kind, name, taskID string
+}
+
+// Auditor runs checks and tracks the degraded components.
+// It is safe for concurrent use.
+type Auditor struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	degraded map[key]Component
+}
+
+// New creates an auditor that bounds every check by timeout.
+func New(timeout time.Duration) *Auditor {
+	return &Auditor{
+		timeout:  timeout,
+		degraded: make(map[key]Component),
+	}
+}
+
+// Audit runs all checks concurrently and returns the components that changed
+// state. Degraded components no longer among checks (a deleted task) are
+// reported as recovered and removed.
+func (a *Auditor) Audit(ctx context.Context, now time.Time, checks []Check) []Change {
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, a.timeout)
+			defer cancel()
+			errs[i] = c.Run(cctx)
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil // shutting down: the failures are ours, not the components'
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var changes []Change
+	seen := make(map[key]bool, len(checks))
+	for i, c := range checks {
+		k := key{c.Kind, c.Name, c.TaskID}
+		seen[k] = true
+		prev, degraded := a.degraded[k]
+		switch {
+		case errs[i] != nil && degraded:
+			prev.Reason = errs[i].Error()
+			a.degraded[k] = prev
+		case errs[i] != nil:
+			comp := Component{Kind: c.Kind, Name: c.Name, TaskID: c.TaskID, Reason: errs[i].Error(), Since: now}
+			a.degraded[k] = comp
+			changes = append(changes, Change{Component: comp, Degraded: true})
+		case degraded:
+			delete(a.degraded, k)
+			changes = append(changes, Change{Component: prev})
+		}
+	}
+	for k, comp := range a.degraded {
+		if !seen[k] {
+			delete(a.degraded, k)
+			changes = append(changes, Change{Component: comp, Removed: true})
+		}
+	}
+	return changes
+}
+
+// Degraded returns the degraded components sorted by kind, task and name.
+func (a *Auditor) Degraded() []Component {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make([]Component, 0, len(a.degraded))
+	for _, comp := range a.degraded {
+		out = append(out, comp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		if out[i].TaskID != out[j].TaskID {
+			return out[i].TaskID < out[j].TaskID
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Run audits once at start and then every interval until ctx is cancelled.
+// source supplies the current checks; sink receives every state change.
+func (a *Auditor) Run(ctx context.Context, interval time.Duration, source func() []Check, sink func(Change)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Info("self-audit started", "interval", interval, "timeout", a.timeout)
+
+	now := time.Now()
+	for {
+		for _, ch := range a.Audit(ctx, now, source()) {
+			sink(ch)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
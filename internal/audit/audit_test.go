@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditor_Transitions(t *testing.T) {
+	a := New(time.Second)
+	now := time.Now()
+	var kafkaErr error
+	checks := []Check{
+		{Kind: KindPlugin, Name: "reporter/kafka", TaskID: "t1", Run: func(context.Context) error { return kafkaErr }},
+		{Kind: KindInterface, Name: "eth1", TaskID: "t1", Run: func(context.Context) error { return nil }},
+	}
+
+	if ch := a.Audit(context.Background(), now, checks); len(ch) != 0 {
+		t.Fatalf("changes with healthy components: %v", ch)
+	}
+
+	kafkaErr = errors.New("no broker reachable")
+	ch := a.Audit(context.Background(), now.Add(time.Minute), checks)
+	if len(ch) != 1 || !ch[0].Degraded || ch[0].Name != "reporter/kafka" || ch[0].Reason != "no broker reachable" {
+		t.Fatalf("changes = %+v, want reporter/kafka degraded", ch)
+	}
+
+	// Still failing: no new change, reason updated, since kept
+	kafkaErr = errors.New("dial timeout")
+	if ch := a.Audit(context.Background(), now.Add(2*time.Minute), checks); len(ch) != 0 {
+		t.Errorf("changes while still degraded: %v", ch)
+	}
+	deg := a.Degraded()
+	if len(deg) != 1 || deg[0].Reason != "dial timeout" || !deg[0].Since.Equal(now.Add(time.Minute)) {
+		t.Errorf("Degraded = %+v", deg)
+	}
+
+	kafkaErr = nil
+	ch = a.Audit(context.Background(), now.Add(3*time.Minute), checks)
+	if len(ch) != 1 || ch[0].Degraded {
+		t.Fatalf("changes = %+v, want reporter/kafka recovered", ch)
+	}
+	if deg := a.Degraded(); len(deg) != 0 {
+		t.Errorf("Degraded after recovery = %+v", deg)
+	}
+}
+
+func TestAuditor_RemovedCheckRecovers(t *testing.T) {
+	a := New(time.Second)
+	failing := Check{Kind: KindInterface, Name: "eth9", TaskID: "t1", Run: func(context.Context) error {
+		return errors.New("interface eth9: no such network interface")
+	}}
+	a.Audit(context.Background(), time.Now(), []Check{failing})
+
+	// The task was deleted: its components are no longer checked
+	ch := a.Audit(context.Background(), time.Now(), nil)
+	if len(ch) != 1 || ch[0].Degraded || !ch[0].Removed || ch[0].Name != "eth9" {
+		t.Fatalf("changes = %+v, want eth9 recovered and removed", ch)
+	}
+}
+
+func TestAuditor_Timeout(t *testing.T) {
+	a := New(10 * time.Millisecond)
+	hung := Check{Kind: KindPlugin, Name: "reporter/hep", Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	ch := a.Audit(context.Background(), time.Now(), []Check{hung})
+	if len(ch) != 1 || !ch[0].Degraded || !strings.Contains(ch[0].Reason, "deadline") {
+		t.Fatalf("changes = %+v, want a degraded check past its deadline", ch)
+	}
+}
+
+func TestAuditor_CancelledAudit(t *testing.T) {
+	a := New(time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	check := Check{Kind: KindPlugin, Name: "reporter/kafka", Run: func(ctx context.Context) error { return ctx.Err() }}
+	if ch := a.Audit(ctx, time.Now(), []Check{check}); ch != nil || len(a.Degraded()) != 0 {
+		t.Errorf("a cancelled audit changed state: %v", ch)
+	}
+}
+
+func TestAuditor_DegradedSorted(t *testing.T) {
+	a := New(time.Second)
+	fail := func(context.Context) error { return errors.New("down") }
+	a.Audit(context.Background(), time.Now(), []Check{
+		{Kind: KindPlugin, Name: "reporter/kafka", TaskID: "t2", Run: fail},
+		{Kind: KindPlugin, Name: "capturer/afpacket@eth0", TaskID: "t2", Run: fail},
+		{Kind: KindCertificate, Name: "/etc/otus/ca.pem", Run: fail},
+		{Kind: KindPlugin, Name: "reporter/hep", TaskID: "t1", Run: fail},
+	})
+	var got []string
+	for _, c := range a.Degraded() {
+		got = append(got, c.TaskID+":"+c.Name)
+	}
+	want := ":/etc/otus/ca.pem,t1:reporter/hep,t2:capturer/afpacket@eth0,t2:reporter/kafka"
+	if strings.Join(got, ",") != want {
+		t.Errorf("Degraded = %v, want %s", got, want)
+	}
+}
+
+func TestCheckInterface(t *testing.T) {
+	if err := CheckInterface("otus-missing0"); err == nil {
+		t.Error("CheckInterface succeeded for a missing interface")
+	}
+}
+
+// writeCert writes a self-signed certificate valid until notAfter, followed
+// by its key, and returns the path.
+func writeCert(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "collector"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...)
+	path := filepath.Join(t.TempDir(), "cert.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Now()
+	const warn = 7 * 24 * time.Hour
+
+	if err := CheckCertificate(writeCert(t, now.Add(30*24*time.Hour)), warn, now); err != nil {
+		t.Errorf("valid certificate: %v", err)
+	}
+	if err := CheckCertificate(writeCert(t, now.Add(48*time.Hour)), warn, now); err == nil || !strings.Contains(err.Error(), "expires at") {
+		t.Errorf("expiring certificate: %v", err)
+	}
+	if err := CheckCertificate(writeCert(t, now.Add(-time.Hour)), warn, now); err == nil || !strings.Contains(err.Error(), "expired at") {
+		t.Errorf("expired certificate: %v", err)
+	}
+	if err := CheckCertificate(filepath.Join(t.TempDir(), "missing.pem"), warn, now); err == nil {
+		t.Error("missing file passed")
+	}
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not pem"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCertificate(empty, warn, now); err == nil || !strings.Contains(err.Error(), "no certificate") {
+		t.Errorf("file without certificates: %v", err)
+	}
+}
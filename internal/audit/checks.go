@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// CheckInterface returns an error unless the named interface exists and is
+// up. Capturers call it from plugin.HealthChecker.
+func CheckInterface(name string) error {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("interface %s: %w", name, err)
+	}
+	if ifi.Flags&net.FlagUp == 0 {
+		return fmt.Errorf("interface %s is down", name)
+	}
+	return nil
+}
+
+// CheckCertificate returns an error if the PEM file at path cannot be read,
+// holds no certificate, or holds one that expires within warn of now.
+func CheckCertificate(path string, warn time.Duration, now time.Time) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	found := false
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue // the key of a combined cert/key file
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parse certificate: %w", err)
+		}
+		found = true
+		switch left := cert.NotAfter.Sub(now); {
+		case left <= 0:
+			return fmt.Errorf("certificate %q expired at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+		case left <= warn:
+			return fmt.Errorf("certificate %q expires at %s", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+	if !found {
+		return fmt.Errorf("no certificate in %s", path)
+	}
+	return nil
+}
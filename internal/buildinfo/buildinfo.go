@@ -0,0 +1,35 @@
+// Package buildinfo holds the agent's version and build metadata, set at
+// link time by the Makefile and scripts/build.sh:
+//
+//	go build -ldflags "-X firestige.xyz/otus/internal/buildinfo.Version=1.2.0 \
+//	    -X firestige.xyz/otus/internal/buildinfo.GitCommit=3f2a9c1"
+package buildinfo
+
+import "runtime/debug"
+
+// Set with -ldflags -X.
+var (
+	Version   = "0.1.0"
+	GitCommit = ""
+	BuildTime = ""
+)
+
+// shortCommit is the length of a commit taken from the go tool's VCS stamp,
+// as git rev-parse --short.
+const shortCommit = 7
+
+// Commit returns GitCommit or, when the build did not set it, the revision
+// the go tool stamped into the binary; "unknown" if there is neither.
+func Commit() string {
+	if GitCommit != "" {
+		return GitCommit
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && s.Value != "" {
+				return s.Value[:min(len(s.Value), shortCommit)]
+			}
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,305 @@
+// Package calls maintains the in-memory table of active calls.
+//
+// The table is fed from parsed packet labels (SIP signaling and correlated
+// RTP/RTCP media) so operators can query which calls are alive right now
+// without a downstream store.
+package calls
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// Defaults used when the task config leaves the table unsized.
+const (
+	DefaultMaxCalls    = 10000
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// State is the signaling state of an active call.
+type State string
+
+const (
+	// StateCalling means an INVITE was seen without a provisional response yet.
+	StateCalling State = "calling"
+	// StateRinging means a 18x provisional response was seen.
+	StateRinging State = "ringing"
+	// StateAnswered means a 2xx response was seen.
+	StateAnswered State = "answered"
+)
+
+// MediaStats summarises media correlated to a call so far.
+type MediaStats struct {
+	Codec       string   `json:"codec,omitempty"`
+	RTPPackets  uint64   `json:"rtp_packets"`
+	RTPBytes    uint64   `json:"rtp_bytes"`
+	RTCPPackets uint64   `json:"rtcp_packets"`
+	Streams     int      `json:"streams"` // distinct RTP SSRCs
+	RTT         RTTStats `json:"rtt,omitzero"`
+}
+
+// RTTBucketsMs are the upper bounds of RTTStats.Histogram; the extra last
+// bucket counts longer round trips.
+var RTTBucketsMs = [...]float64{20, 50, 100, 150, 200, 300, 500, 1000}
+
+// RTTStats summarises the RTCP round-trip times (rtcp.rtt_ms) of a call.
+type RTTStats struct {
+	Samples   uint64                        `json:"samples"`
+	LastMs    float64                       `json:"last_ms"`
+	MinMs     float64                       `json:"min_ms"`
+	MaxMs     float64                       `json:"max_ms"`
+	AvgMs     float64                       `json:"avg_ms"`
+	Histogram [len(RTTBucketsMs) + 1]uint64 `json:"histogram"`
+}
+
+func (s *RTTStats) add(ms float64) {
+	if s.Samples == 0 || ms < s.MinMs {
+		s.MinMs = ms
+	}
+	if ms > s.MaxMs {
+		s.MaxMs = ms
+	}
+	s.Samples++
+	s.LastMs = ms
+	s.AvgMs += (ms - s.AvgMs) / float64(s.Samples)
+
+	i := 0
+	for i < len(RTTBucketsMs) && ms > RTTBucketsMs[i] {
+		i++
+	}
+	s.Histogram[i]++
+}
+
+// Call is a snapshot of one active call.
+type Call struct {
+	CallID     string     `json:"call_id"`
+	TaskID     string     `json:"task_id"`
+	State      State      `json:"state"`
+	From       string     `json:"from,omitempty"`
+	To         string     `json:"to,omitempty"`
+	StartTime  time.Time  `json:"start_time"`
+	AnswerTime *time.Time `json:"answer_time,omitempty"`
+	LastSeen   time.Time  `json:"last_seen"`
+	Media      MediaStats `json:"media"`
+}
+
+// entry is the mutable table record behind a Call snapshot.
+type entry struct {
+	call    Call
+	ssrcs   map[string]struct{}
+	touched time.Time // wall clock of last update, for idle expiry
+}
+
+// Table is a bounded table of active calls for one task.
+// It is safe for concurrent use by all pipelines of the task.
+type Table struct {
+	taskID      string
+	maxCalls    int
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	mu    sync.Mutex
+	calls map[string]*entry
+}
+
+// NewTable creates a call table holding at most maxCalls calls. Calls with
+// neither signaling nor media for idleTimeout are dropped.
+func NewTable(taskID string, maxCalls int, idleTimeout time.Duration) *Table {
+	if maxCalls <= 0 {
+		maxCalls = DefaultMaxCalls
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &Table{
+		taskID:      taskID,
+		maxCalls:    maxCalls,
+		idleTimeout: idleTimeout,
+		now:         time.Now,
+		calls:       make(map[string]*entry),
+	}
+}
+
+// Observe updates the table from a parsed packet's labels.
+// INVITE creates a call, provisional and 2xx responses advance its state,
+// BYE/CANCEL and failed setups remove it, and correlated RTP/RTCP packets
+// add to its media statistics.
+func (t *Table) Observe(pkt *core.OutputPacket) {
+	labels := pkt.Labels
+	if labels == nil {
+		return
+	}
+
+	if callID := labels[core.LabelSIPCallID]; callID != "" {
+		t.observeSIP(callID, pkt)
+		return
+	}
+	if callID := labels[core.LabelRTPCallID]; callID != "" {
+		t.observeMedia(callID, pkt, false)
+		return
+	}
+	if callID := labels[core.LabelRTCPCallID]; callID != "" {
+		t.observeMedia(callID, pkt, true)
+	}
+}
+
+func (t *Table) observeSIP(callID string, pkt *core.OutputPacket) {
+	labels := pkt.Labels
+	method := labels[core.LabelSIPMethod]
+	status, _ := strconv.Atoi(labels[core.LabelSIPStatusCode])
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	e, ok := t.calls[callID]
+
+	switch {
+	case method == "INVITE":
+		if !ok {
+			t.makeRoom(now)
+			e = &entry{
+				call: Call{
+					CallID:    callID,
+					TaskID:    t.taskID,
+					State:     StateCalling,
+					From:      labels[core.LabelSIPFromURI],
+					To:        labels[core.LabelSIPToURI],
+					StartTime: pkt.Timestamp,
+				},
+				ssrcs: make(map[string]struct{}),
+			}
+			t.calls[callID] = e
+		}
+	case method == "BYE" || method == "CANCEL":
+		delete(t.calls, callID)
+		return
+	case !ok:
+		// Responses and in-dialog requests never create calls.
+		return
+	case status >= 180 && status < 190:
+		if e.call.State == StateCalling {
+			e.call.State = StateRinging
+		}
+	case status >= 200 && status < 300:
+		if e.call.State != StateAnswered {
+			e.call.State = StateAnswered
+			answered := pkt.Timestamp
+			e.call.AnswerTime = &answered
+		}
+	case status >= 300:
+		// Failed setup; errors on an established dialog (e.g. re-INVITE) keep it.
+		if e.call.State != StateAnswered {
+			delete(t.calls, callID)
+			return
+		}
+	}
+
+	e.call.LastSeen = pkt.Timestamp
+	e.touched = now
+}
+
+func (t *Table) observeMedia(callID string, pkt *core.OutputPacket, rtcp bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.calls[callID]
+	if !ok {
+		return
+	}
+
+	m := &e.call.Media
+	if rtcp {
+		m.RTCPPackets++
+		if rtt, err := strconv.ParseFloat(pkt.Labels[core.LabelRTCPRTT], 64); err == nil {
+			m.RTT.add(rtt)
+		}
+	} else {
+		m.RTPPackets++
+		m.RTPBytes += uint64(len(pkt.RawPayload))
+		if codec := pkt.Labels[core.LabelRTPCodec]; codec != "" {
+			m.Codec = codec
+		}
+		if ssrc := pkt.Labels[core.LabelRTPSSRC]; ssrc != "" {
+			if _, seen := e.ssrcs[ssrc]; !seen {
+				e.ssrcs[ssrc] = struct{}{}
+				m.Streams = len(e.ssrcs)
+			}
+		}
+	}
+
+	e.call.LastSeen = pkt.Timestamp
+	e.touched = t.now()
+}
+
+// makeRoom expires idle calls and, if the table is still full, evicts the
+// least recently updated call. Caller must hold t.mu.
+func (t *Table) makeRoom(now time.Time) {
+	if len(t.calls) < t.maxCalls {
+		return
+	}
+	t.expire(now)
+
+	for len(t.calls) >= t.maxCalls {
+		var oldestID string
+		var oldest time.Time
+		for id, e := range t.calls {
+			if oldestID == "" || e.touched.Before(oldest) {
+				oldestID, oldest = id, e.touched
+			}
+		}
+		delete(t.calls, oldestID)
+	}
+}
+
+// expire removes calls idle for longer than idleTimeout. Caller must hold t.mu.
+func (t *Table) expire(now time.Time) {
+	for id, e := range t.calls {
+		if now.Sub(e.touched) > t.idleTimeout {
+			delete(t.calls, id)
+		}
+	}
+}
+
+// List returns snapshots of all active calls, oldest first.
+func (t *Table) List() []Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(t.now())
+
+	out := make([]Call, 0, len(t.calls))
+	for _, e := range t.calls {
+		out = append(out, e.call)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartTime.Equal(out[j].StartTime) {
+			return out[i].StartTime.Before(out[j].StartTime)
+		}
+		return out[i].CallID < out[j].CallID
+	})
+	return out
+}
+
+// Get returns a snapshot of the call with the given Call-ID.
+func (t *Table) Get(callID string) (Call, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.calls[callID]
+	if !ok || t.now().Sub(e.touched) > t.idleTimeout {
+		return Call{}, false
+	}
+	return e.call, true
+}
+
+// Len returns the number of calls currently in the table.
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.calls)
+}
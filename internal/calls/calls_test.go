@@ -0,0 +1,146 @@
+package calls
+
+import (
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func sipPacket(ts time.Time, callID, method, status string) *core.OutputPacket {
+	labels := core.Labels{core.LabelSIPCallID: callID}
+	if method != "" {
+		labels[core.LabelSIPMethod] = method
+		labels[core.LabelSIPFromURI] = "sip:alice@example.com"
+		labels[core.LabelSIPToURI] = "sip:bob@example.com"
+	}
+	if status != "" {
+		labels[core.LabelSIPStatusCode] = status
+	}
+	return &core.OutputPacket{Timestamp: ts, Labels: labels}
+}
+
+func rtpPacket(ts time.Time, callID, ssrc string, size int) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp: ts,
+		Labels: core.Labels{
+			core.LabelRTPCallID: callID,
+			core.LabelRTPSSRC:   ssrc,
+			core.LabelRTPCodec:  "PCMA",
+		},
+		RawPayload: make([]byte, size),
+	}
+}
+
+func TestTable_CallLifecycle(t *testing.T) {
+	table := NewTable("t1", 10, time.Minute)
+	ts := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	table.Observe(sipPacket(ts, "c1", "INVITE", ""))
+	table.Observe(sipPacket(ts.Add(time.Second), "c1", "", "180"))
+	call, ok := table.Get("c1")
+	if !ok || call.State != StateRinging || call.From != "sip:alice@example.com" || call.TaskID != "t1" {
+		t.Fatalf("after 180: %+v, ok=%v", call, ok)
+	}
+
+	table.Observe(sipPacket(ts.Add(3*time.Second), "c1", "", "200"))
+	table.Observe(rtpPacket(ts.Add(4*time.Second), "c1", "0x01", 172))
+	table.Observe(rtpPacket(ts.Add(4*time.Second), "c1", "0x02", 172))
+	table.Observe(&core.OutputPacket{Labels: core.Labels{core.LabelRTCPCallID: "c1"}})
+
+	call, _ = table.Get("c1")
+	if call.State != StateAnswered || call.AnswerTime == nil || !call.AnswerTime.Equal(ts.Add(3*time.Second)) {
+		t.Errorf("after 200: state=%s answer=%v", call.State, call.AnswerTime)
+	}
+	if call.Media.RTPPackets != 2 || call.Media.RTPBytes != 344 || call.Media.Streams != 2 ||
+		call.Media.RTCPPackets != 1 || call.Media.Codec != "PCMA" {
+		t.Errorf("media = %+v", call.Media)
+	}
+
+	// Errors on an established dialog keep the call; BYE ends it.
+	table.Observe(sipPacket(ts.Add(5*time.Second), "c1", "", "491"))
+	if _, ok := table.Get("c1"); !ok {
+		t.Fatal("answered call removed by re-INVITE failure")
+	}
+	table.Observe(sipPacket(ts.Add(6*time.Second), "c1", "BYE", ""))
+	if _, ok := table.Get("c1"); ok {
+		t.Error("call still present after BYE")
+	}
+
+	// The BYE's 200 OK must not resurrect the call.
+	table.Observe(sipPacket(ts.Add(6*time.Second), "c1", "", "200"))
+	if table.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", table.Len())
+	}
+}
+
+func TestTable_RTTStats(t *testing.T) {
+	table := NewTable("t1", 10, time.Minute)
+	ts := time.Now()
+	table.Observe(sipPacket(ts, "c1", "INVITE", ""))
+
+	for _, rtt := range []string{"40.0", "", "120.0", "2000.0"} {
+		labels := core.Labels{core.LabelRTCPCallID: "c1"}
+		if rtt != "" {
+			labels[core.LabelRTCPRTT] = rtt
+		}
+		table.Observe(&core.OutputPacket{Timestamp: ts, Labels: labels})
+	}
+
+	rtt, _ := table.Get("c1")
+	got := rtt.Media.RTT
+	if got.Samples != 3 || got.MinMs != 40 || got.MaxMs != 2000 || got.LastMs != 2000 || got.AvgMs != 720 {
+		t.Errorf("RTT = %+v", got)
+	}
+	// 40 → ≤50, 120 → ≤150, 2000 → overflow
+	if got.Histogram[1] != 1 || got.Histogram[3] != 1 || got.Histogram[len(RTTBucketsMs)] != 1 {
+		t.Errorf("Histogram = %v", got.Histogram)
+	}
+}
+
+func TestTable_FailedSetupAndUnknownMedia(t *testing.T) {
+	table := NewTable("t1", 10, time.Minute)
+	ts := time.Now()
+
+	table.Observe(sipPacket(ts, "c1", "INVITE", ""))
+	table.Observe(sipPacket(ts, "c1", "", "486"))
+	if _, ok := table.Get("c1"); ok {
+		t.Error("call present after 486 Busy Here")
+	}
+
+	table.Observe(rtpPacket(ts, "c2", "0x01", 100))
+	if table.Len() != 0 {
+		t.Error("media without signaling must not create a call")
+	}
+}
+
+func TestTable_CapacityAndIdleExpiry(t *testing.T) {
+	table := NewTable("t1", 2, time.Minute)
+	clock := time.Now()
+	table.now = func() time.Time { return clock }
+
+	table.Observe(sipPacket(clock, "c1", "INVITE", ""))
+	clock = clock.Add(time.Second)
+	table.Observe(sipPacket(clock, "c2", "INVITE", ""))
+	clock = clock.Add(time.Second)
+	table.Observe(sipPacket(clock, "c3", "INVITE", ""))
+
+	if table.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", table.Len())
+	}
+	if _, ok := table.Get("c1"); ok {
+		t.Error("least recently updated call should have been evicted")
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	if list := table.List(); len(list) != 0 {
+		t.Errorf("List() after idle timeout = %d calls, want 0", len(list))
+	}
+}
+
+func TestNewTable_Defaults(t *testing.T) {
+	table := NewTable("t1", 0, 0)
+	if table.maxCalls != DefaultMaxCalls || table.idleTimeout != DefaultIdleTimeout {
+		t.Errorf("defaults = (%d, %v)", table.maxCalls, table.idleTimeout)
+	}
+}
@@ -0,0 +1,279 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// BatchParams represents parameters for the batch command: sub-commands
+// executed in order.
+type BatchParams struct {
+	Commands []BatchItem `json:"commands"`
+}
+
+// BatchItem is one sub-command of a batch.
+type BatchItem struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// BatchItemResult is the outcome of one sub-command.
+type BatchItemResult struct {
+	Index  int         `json:"index"`
+	Method string      `json:"method"`
+	Status string      `json:"status"` // ok | failed | rolled_back | skipped
+	Result interface{} `json:"result,omitempty"`
+	Error  *ErrorInfo  `json:"error,omitempty"`
+}
+
+// Batch item statuses.
+const (
+	batchStatusOK         = "ok"
+	batchStatusFailed     = "failed"
+	batchStatusRolledBack = "rolled_back" // executed, then undone after a later failure
+	batchStatusSkipped    = "skipped"     // not executed because an earlier item failed
+)
+
+// batchUndo reverts one executed task_create, task_delete, task_pause or
+// task_resume.
+type batchUndo struct {
+	index  int
+	create *config.TaskConfig // task_create: delete this task again
+	delete *config.TaskConfig // task_delete: re-create the task from its config
+	pause  string             // task_pause: resume this task again
+	resume string             // task_resume: pause this task again
+}
+
+// handleBatch handles the batch command.
+//
+// All items are validated before any is executed: unknown methods, bad
+// params, invalid task configs and task IDs that would not exist (or would
+// already exist) at that point of the batch reject the whole batch. Items then
+// run in order; the first failure stops the batch and the task_create,
+// task_delete, task_pause and task_resume items already executed are undone
+// in reverse order. Other commands (config_reload) cannot be undone.
+func (h *CommandHandler) handleBatch(ctx context.Context, cmd Command) Response {
+	var params BatchParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if len(params.Commands) == 0 {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "batch has no commands",
+			},
+		}
+	}
+
+	if err := h.validateBatch(params.Commands); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	results := make([]BatchItemResult, len(params.Commands))
+	var undo []batchUndo
+	failed := -1
+	for i, item := range params.Commands {
+		results[i] = BatchItemResult{Index: i, Method: item.Method, Status: batchStatusSkipped}
+		if failed >= 0 {
+			continue
+		}
+
+		// Captured before execution: a deleted task is re-created from it on rollback.
+		u := h.batchUndoFor(i, item)
+
+		resp := h.dispatch(ctx, Command{
+			Method: item.Method,
+			Params: item.Params,
+			ID:     fmt.Sprintf("%s#%d", cmd.ID, i),
+		}, nil)
+		results[i].Result = resp.Result
+		results[i].Error = resp.Error
+		if resp.Error != nil {
+			results[i].Status = batchStatusFailed
+			failed = i
+			continue
+		}
+		results[i].Status = batchStatusOK
+		if u != nil {
+			undo = append(undo, *u)
+		}
+	}
+
+	if failed < 0 {
+		return Response{
+			ID: cmd.ID,
+			Result: map[string]interface{}{
+				"status":  "ok",
+				"results": results,
+			},
+		}
+	}
+
+	rolledBack := h.rollbackBatch(undo, results)
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"status":  "failed",
+			"results": results,
+		},
+		Error: &ErrorInfo{
+			Code: ErrCodeInternalError,
+			Message: fmt.Sprintf("batch item %d (%s) failed: %s; %d item(s) rolled back",
+				failed, params.Commands[failed].Method, results[failed].Error.Message, rolledBack),
+		},
+	}
+}
+
+// validateBatch checks every item without executing any. Task existence is
+// simulated through the batch so "delete X, create X" is accepted.
+func (h *CommandHandler) validateBatch(items []BatchItem) error {
+	exists := make(map[string]bool)
+	for _, id := range h.taskManager.List() {
+		exists[id] = true
+	}
+
+	for i, item := range items {
+		if !routes[item.Method].batch {
+			return fmt.Errorf("batch item %d: method %q not allowed in batch", i, item.Method)
+		}
+
+		switch item.Method {
+		case "task_create":
+			var p TaskCreateParams
+			if err := json.Unmarshal(item.Params, &p); err != nil {
+				return fmt.Errorf("batch item %d (task_create): invalid params: %v", i, err)
+			}
+			tc, err := h.taskConfig(p)
+			if err != nil {
+				return fmt.Errorf("batch item %d (task_create): %v", i, err)
+			}
+			if err := tc.Validate(); err != nil {
+				return fmt.Errorf("batch item %d (task_create): %v", i, err)
+			}
+			if exists[tc.ID] {
+				return fmt.Errorf("batch item %d (task_create): task %q already exists", i, tc.ID)
+			}
+			exists[tc.ID] = true
+		case "task_delete":
+			var p TaskDeleteParams
+			if err := json.Unmarshal(item.Params, &p); err != nil {
+				return fmt.Errorf("batch item %d (task_delete): invalid params: %v", i, err)
+			}
+			if len(p.Tags) > 0 {
+				return fmt.Errorf("batch item %d (task_delete): tag selectors are not supported in batch", i)
+			}
+			if !exists[p.TaskID] {
+				return fmt.Errorf("batch item %d (task_delete): task %q not found", i, p.TaskID)
+			}
+			delete(exists, p.TaskID)
+		case "task_pause", "task_resume":
+			var p TaskSelectorParams
+			if err := json.Unmarshal(item.Params, &p); err != nil {
+				return fmt.Errorf("batch item %d (%s): invalid params: %v", i, item.Method, err)
+			}
+			if len(p.Tags) > 0 {
+				return fmt.Errorf("batch item %d (%s): tag selectors are not supported in batch", i, item.Method)
+			}
+			if !exists[p.TaskID] {
+				return fmt.Errorf("batch item %d (%s): task %q not found", i, item.Method, p.TaskID)
+			}
+		}
+	}
+	return nil
+}
+
+// batchUndoFor returns how to undo item, or nil if it needs no undo.
+func (h *CommandHandler) batchUndoFor(index int, item BatchItem) *batchUndo {
+	switch item.Method {
+	case "task_create":
+		var p TaskCreateParams
+		if json.Unmarshal(item.Params, &p) != nil {
+			return nil
+		}
+		tc, err := h.taskConfig(p)
+		if err != nil {
+			return nil
+		}
+		return &batchUndo{index: index, create: &tc}
+	case "task_delete":
+		var p TaskDeleteParams
+		if json.Unmarshal(item.Params, &p) != nil {
+			return nil
+		}
+		t, err := h.taskManager.Get(p.TaskID)
+		if err != nil {
+			return nil
+		}
+		cfg := t.Config
+		return &batchUndo{index: index, delete: &cfg}
+	case "task_pause", "task_resume":
+		// Pause only succeeds on a running task and Resume on a paused one,
+		// so each undoes the other.
+		var p TaskSelectorParams
+		if json.Unmarshal(item.Params, &p) != nil {
+			return nil
+		}
+		if item.Method == "task_pause" {
+			return &batchUndo{index: index, pause: p.TaskID}
+		}
+		return &batchUndo{index: index, resume: p.TaskID}
+	}
+	return nil
+}
+
+// rollbackBatch undoes executed items in reverse order and returns how many
+// were rolled back. Items that cannot be undone keep status ok.
+func (h *CommandHandler) rollbackBatch(undo []batchUndo, results []BatchItemResult) int {
+	rolledBack := 0
+	for i := len(undo) - 1; i >= 0; i-- {
+		u := undo[i]
+		var err error
+		switch {
+		case u.create != nil:
+			err = h.taskManager.Delete(u.create.ID)
+		case u.delete != nil:
+			err = h.taskManager.Create(*u.delete)
+		case u.pause != "":
+			err = h.setPaused(u.pause, false)
+		case u.resume != "":
+			err = h.setPaused(u.resume, true)
+		}
+		if err != nil {
+			slog.Error("batch rollback failed", "index", u.index, "method", results[u.index].Method, "error", err)
+			continue
+		}
+		results[u.index].Status = batchStatusRolledBack
+		rolledBack++
+	}
+	return rolledBack
+}
+
+// setPaused pauses or resumes a task.
+func (h *CommandHandler) setPaused(taskID string, paused bool) error {
+	t, err := h.taskManager.Get(taskID)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return t.Pause()
+	}
+	return t.Resume()
+}
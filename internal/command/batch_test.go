@@ -0,0 +1,204 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// idleCapturer captures nothing until stopped; it lets tests create real tasks.
+type idleCapturer struct {
+	stop chan struct{}
+}
+
+func (c *idleCapturer) Name() string                { return "batch-test" }
+func (c *idleCapturer) Init(map[string]any) error   { return nil }
+func (c *idleCapturer) Start(context.Context) error { return nil }
+func (c *idleCapturer) Stats() plugin.CaptureStats  { return plugin.CaptureStats{} }
+
+func (c *idleCapturer) Stop(context.Context) error {
+	close(c.stop)
+	return nil
+}
+
+func (c *idleCapturer) Capture(ctx context.Context, _ chan<- core.RawPacket) error {
+	select {
+	case <-ctx.Done():
+	case <-c.stop:
+	}
+	return nil
+}
+
+var registerIdleCapturer sync.Once
+
+func newBatchHandler(t *testing.T) *CommandHandler {
+	t.Helper()
+	registerIdleCapturer.Do(func() {
+		plugin.RegisterCapturer("batch-test", func() plugin.Capturer { return &idleCapturer{stop: make(chan struct{})} })
+	})
+	tm := task.NewTaskManager("test-agent", nil)
+	tm.SetMaxTasks(0)
+	t.Cleanup(func() { tm.StopAll() })
+	return NewCommandHandler(tm, nil)
+}
+
+func createItem(t *testing.T, id, capture string) BatchItem {
+	t.Helper()
+	params, err := json.Marshal(TaskCreateParams{Config: config.TaskConfig{
+		ID:      id,
+		Mode:    config.TaskModeAnalyzeOnly,
+		Capture: config.CaptureConfig{Name: capture, Interface: "lo"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return BatchItem{Method: "task_create", Params: params}
+}
+
+func deleteItem(id string) BatchItem {
+	params, _ := json.Marshal(TaskDeleteParams{TaskID: id})
+	return BatchItem{Method: "task_delete", Params: params}
+}
+
+func selectorItem(method, id string) BatchItem {
+	params, _ := json.Marshal(TaskSelectorParams{TaskID: id})
+	return BatchItem{Method: method, Params: params}
+}
+
+func runBatch(t *testing.T, h *CommandHandler, items ...BatchItem) (Response, []BatchItemResult) {
+	t.Helper()
+	params, err := json.Marshal(BatchParams{Commands: items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := h.Handle(context.Background(), Command{Method: "batch", Params: params, ID: "batch-1"})
+	result, _ := resp.Result.(map[string]interface{})
+	results, _ := result["results"].([]BatchItemResult)
+	return resp, results
+}
+
+func statuses(results []BatchItemResult) string {
+	s := make([]string, len(results))
+	for i, r := range results {
+		s[i] = r.Status
+	}
+	return strings.Join(s, ",")
+}
+
+func TestBatch_ValidationRejectsWholeBatch(t *testing.T) {
+	h := newBatchHandler(t)
+
+	tests := []struct {
+		name    string
+		items   []BatchItem
+		wantErr string
+	}{
+		{"empty", nil, "no commands"},
+		{"shutdown not allowed", []BatchItem{{Method: "daemon_shutdown"}}, "not allowed"},
+		{"nested batch", []BatchItem{{Method: "batch"}}, "not allowed"},
+		{"delete unknown task", []BatchItem{createItem(t, "a", "batch-test"), deleteItem("b")}, `task "b" not found`},
+		{"create twice", []BatchItem{createItem(t, "a", "batch-test"), createItem(t, "a", "batch-test")}, "already exists"},
+		{"invalid config", []BatchItem{createItem(t, "a", "")}, "capture name"},
+		{"pause unknown task", []BatchItem{selectorItem("task_pause", "b")}, `task "b" not found`},
+		{"resume by tag", []BatchItem{{Method: "task_resume", Params: json.RawMessage(`{"tags":["x"]}`)}}, "tag selectors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := runBatch(t, h, tt.items...)
+			if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams || !strings.Contains(resp.Error.Message, tt.wantErr) {
+				t.Errorf("Error = %+v, want invalid params mentioning %q", resp.Error, tt.wantErr)
+			}
+			if n := len(h.taskManager.List()); n != 0 {
+				t.Errorf("%d task(s) created by a rejected batch", n)
+			}
+		})
+	}
+}
+
+func TestBatch_Success(t *testing.T) {
+	h := newBatchHandler(t)
+
+	resp, results := runBatch(t, h, createItem(t, "a", "batch-test"), BatchItem{Method: "task_list"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	if got := statuses(results); got != "ok,ok" {
+		t.Errorf("statuses = %s, want ok,ok", got)
+	}
+
+	// Reconfigure in one round-trip: delete and re-create the same ID.
+	resp, results = runBatch(t, h, deleteItem("a"), createItem(t, "a", "batch-test"))
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %+v", resp.Error)
+	}
+	if got := statuses(results); got != "ok,ok" {
+		t.Errorf("statuses = %s, want ok,ok", got)
+	}
+}
+
+func TestBatch_RollbackOnFailure(t *testing.T) {
+	h := newBatchHandler(t)
+
+	// Capturer "missing" passes validation but fails to resolve at execution.
+	resp, results := runBatch(t, h,
+		createItem(t, "a", "batch-test"),
+		createItem(t, "b", "missing"),
+		BatchItem{Method: "task_list"},
+	)
+	if resp.Error == nil || resp.Error.Code != ErrCodeInternalError {
+		t.Fatalf("Error = %+v, want internal error", resp.Error)
+	}
+	if got := statuses(results); got != "rolled_back,failed,skipped" {
+		t.Errorf("statuses = %s, want rolled_back,failed,skipped", got)
+	}
+	if ids := h.taskManager.List(); len(ids) != 0 {
+		t.Errorf("tasks after rollback = %v, want none", ids)
+	}
+}
+
+func TestBatch_RollbackRestoresDeletedTask(t *testing.T) {
+	h := newBatchHandler(t)
+	if resp, _ := runBatch(t, h, createItem(t, "a", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %+v", resp.Error)
+	}
+
+	_, results := runBatch(t, h, deleteItem("a"), createItem(t, "b", "missing"))
+	if got := statuses(results); got != "rolled_back,failed" {
+		t.Errorf("statuses = %s, want rolled_back,failed", got)
+	}
+	if ids := h.taskManager.List(); len(ids) != 1 || ids[0] != "a" {
+		t.Errorf("tasks after rollback = %v, want [a]", ids)
+	}
+}
+
+func TestBatch_RollbackUndoesPauseAndResume(t *testing.T) {
+	h := newBatchHandler(t)
+	if resp, _ := runBatch(t, h, createItem(t, "a", "batch-test"), createItem(t, "b", "batch-test"), selectorItem("task_pause", "b")); resp.Error != nil {
+		t.Fatalf("setup: %+v", resp.Error)
+	}
+
+	_, results := runBatch(t, h,
+		selectorItem("task_pause", "a"),
+		selectorItem("task_resume", "b"),
+		createItem(t, "c", "missing"),
+	)
+	if got := statuses(results); got != "rolled_back,rolled_back,failed" {
+		t.Errorf("statuses = %s, want rolled_back,rolled_back,failed", got)
+	}
+	for id, want := range map[string]task.TaskState{"a": task.StateRunning, "b": task.StatePaused} {
+		tk, err := h.taskManager.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tk.State(); got != want {
+			t.Errorf("task %s state = %s, want %s", id, got, want)
+		}
+	}
+}
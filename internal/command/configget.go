@@ -0,0 +1,56 @@
+package command
+
+import (
+	"context"
+	"fmt"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// ConfigSource exposes the running global configuration for config_get.
+type ConfigSource interface {
+	Config() *config.GlobalConfig
+}
+
+// SetConfigSource sets the global configuration returned by config_get.
+func (h *CommandHandler) SetConfigSource(src ConfigSource) {
+	h.configSource = src
+}
+
+// handleConfigGet returns the effective running configuration, global and
+// per task, with secrets redacted, and its hash. Controllers compare the hash
+// with the one of their intended state to detect drift.
+func (h *CommandHandler) handleConfigGet(_ context.Context, cmd Command) Response {
+	if h.configSource == nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: "config source not available",
+			},
+		}
+	}
+
+	tasks := make(map[string]config.TaskConfig)
+	for _, id := range h.taskManager.List() {
+		if t, err := h.taskManager.Get(id); err == nil {
+			tasks[id] = t.Config
+		}
+	}
+
+	snapshot, err := config.NewSnapshot(h.configSource.Config(), tasks)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: fmt.Sprintf("snapshot config failed: %v", err),
+			},
+		}
+	}
+
+	return Response{
+		ID:     cmd.ID,
+		Result: snapshot,
+	}
+}
@@ -0,0 +1,192 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DedupeStore remembers command responses by request ID so that a command
+// re-delivered by Kafka (at-least-once, e.g. after a consumer group rebalance)
+// returns the original response instead of being executed again.
+//
+// Entries expire after the configured TTL. When a file path is set the store
+// is persisted with temp-file + atomic rename after every change, so replays
+// after a daemon restart are detected too. A request ID being executed is
+// reserved (Reserve), so a copy delivered meanwhile waits for the response
+// instead of executing concurrently.
+// It is safe for concurrent use.
+type DedupeStore struct {
+	path string // empty = in-memory only
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]dedupeEntry
+	inflight map[string]chan struct{} // by method and request ID; closed by Put
+	now      func() time.Time         // test hook
+}
+
+// dedupeEntry is the on-disk format of one remembered response.
+type dedupeEntry struct {
+	Method    string    `json:"method"`
+	Response  Response  `json:"response"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewDedupeStore creates a store keeping responses for ttl. When path is not
+// empty, unexpired entries are loaded from it; a missing file is not an error.
+func NewDedupeStore(path string, ttl time.Duration) (*DedupeStore, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("dedupe store: ttl must be positive, got %v", ttl)
+	}
+	s := &DedupeStore{
+		path:     path,
+		ttl:      ttl,
+		entries:  make(map[string]dedupeEntry),
+		inflight: make(map[string]chan struct{}),
+		now:      time.Now,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("dedupe store: create directory for %q: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("dedupe store: read %q: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		// A corrupt file only loses replay protection for in-flight commands.
+		slog.Warn("dedupe store: ignoring unreadable file", "file", path, "error", err)
+		s.entries = make(map[string]dedupeEntry)
+	}
+	s.pruneLocked()
+	return s, nil
+}
+
+// Get returns the remembered response for a request ID of the given method.
+func (s *DedupeStore) Get(method, id string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.getLocked(method, id)
+}
+
+// getLocked is Get. Caller must hold s.mu.
+func (s *DedupeStore) getLocked(method, id string) (Response, bool) {
+	e, ok := s.entries[id]
+	if !ok || e.Method != method || !s.now().Before(e.ExpiresAt) {
+		return Response{}, false
+	}
+	return e.Response, true
+}
+
+// Reserve returns the remembered response for a request ID of the given
+// method and true if there is one, waiting for it while another caller holds
+// the reservation. Otherwise it reserves the request ID and returns false;
+// the caller executes the command and must then call Put. An error is
+// returned only if ctx ends while waiting.
+func (s *DedupeStore) Reserve(ctx context.Context, method, id string) (Response, bool, error) {
+	key := method + "\x00" + id
+	for {
+		s.mu.Lock()
+		if resp, ok := s.getLocked(method, id); ok {
+			s.mu.Unlock()
+			return resp, true, nil
+		}
+		done, busy := s.inflight[key]
+		if !busy {
+			s.inflight[key] = make(chan struct{})
+			s.mu.Unlock()
+			return Response{}, false, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return Response{}, false, ctx.Err()
+		}
+	}
+}
+
+// Put remembers resp for a request ID, releases its reservation, if any, and
+// persists the store.
+func (s *DedupeStore) Put(method, id string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := method + "\x00" + id
+	if done, ok := s.inflight[key]; ok {
+		delete(s.inflight, key)
+		close(done)
+	}
+	s.pruneLocked()
+	s.entries[id] = dedupeEntry{
+		Method:    method,
+		Response:  resp,
+		ExpiresAt: s.now().Add(s.ttl),
+	}
+	return s.saveLocked()
+}
+
+// Len returns the number of unexpired entries.
+func (s *DedupeStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	return len(s.entries)
+}
+
+// pruneLocked drops expired entries. Caller must hold s.mu.
+func (s *DedupeStore) pruneLocked() {
+	now := s.now()
+	for id, e := range s.entries {
+		if !now.Before(e.ExpiresAt) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+// saveLocked atomically writes all entries to s.path. Caller must hold s.mu.
+func (s *DedupeStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return fmt.Errorf("dedupe store: marshal: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), "."+filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("dedupe store: create temp file: %w", err)
+	}
+	tmpName := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("dedupe store: write temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("dedupe store: close temp file: %w", err)
+	}
+	if err := os.Rename(tmpName, s.path); err != nil {
+		_ = os.Remove(tmpName)
+		return fmt.Errorf("dedupe store: rename temp → %q: %w", s.path, err)
+	}
+	return nil
+}
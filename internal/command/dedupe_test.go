@@ -0,0 +1,163 @@
+package command
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/task"
+)
+
+func TestDedupeStore_GetPut(t *testing.T) {
+	s, err := NewDedupeStore("", time.Minute)
+	if err != nil {
+		t.Fatalf("NewDedupeStore: %v", err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	if _, ok := s.Get("task_create", "req-1"); ok {
+		t.Fatal("empty store returned a response")
+	}
+	if err := s.Put("task_create", "req-1", Response{ID: "req-1", Result: "created"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	resp, ok := s.Get("task_create", "req-1")
+	if !ok || resp.Result != "created" {
+		t.Errorf("Get = %+v, %v; want remembered response", resp, ok)
+	}
+	if _, ok := s.Get("task_delete", "req-1"); ok {
+		t.Error("request ID reused by another method must not match")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := s.Get("task_create", "req-1"); ok {
+		t.Error("expired entry returned")
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Len() = %d after expiry, want 0", n)
+	}
+}
+
+func TestDedupeStore_Reserve(t *testing.T) {
+	s, err := NewDedupeStore("", time.Minute)
+	if err != nil {
+		t.Fatalf("NewDedupeStore: %v", err)
+	}
+	ctx := context.Background()
+	if _, ok, err := s.Reserve(ctx, "task_create", "req-1"); ok || err != nil {
+		t.Fatalf("first Reserve = %v, %v; want reservation", ok, err)
+	}
+
+	// A copy delivered while the first executes waits for its response.
+	got := make(chan Response, 1)
+	go func() {
+		resp, ok, err := s.Reserve(ctx, "task_create", "req-1")
+		if !ok || err != nil {
+			t.Errorf("second Reserve = %v, %v; want remembered response", ok, err)
+		}
+		got <- resp
+	}()
+	select {
+	case <-got:
+		t.Fatal("second Reserve returned while the first was executing")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if err := s.Put("task_create", "req-1", Response{ID: "req-1", Result: "created"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if resp := <-got; resp.Result != "created" {
+		t.Errorf("second Reserve response = %+v, want the first's", resp)
+	}
+
+	// The reservation is per method, and waiting ends with ctx.
+	if _, ok, err := s.Reserve(ctx, "task_delete", "req-1"); ok || err != nil {
+		t.Fatalf("Reserve for another method = %v, %v; want reservation", ok, err)
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := s.Reserve(cctx, "task_delete", "req-1"); err == nil {
+		t.Error("Reserve on a cancelled context waited without error")
+	}
+}
+
+func TestDedupeStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "commands", "dedupe.json")
+
+	s, err := NewDedupeStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDedupeStore: %v", err)
+	}
+	if err := s.Put("task_delete", "req-9", Response{ID: "req-9", Error: &ErrorInfo{Code: ErrCodeInternalError, Message: "boom"}}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// A restarted daemon still recognises the request.
+	s2, err := NewDedupeStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("NewDedupeStore (reload): %v", err)
+	}
+	resp, ok := s2.Get("task_delete", "req-9")
+	if !ok {
+		t.Fatal("persisted entry not found after reload")
+	}
+	if resp.Error == nil || resp.Error.Message != "boom" {
+		t.Errorf("reloaded response = %+v, want original error", resp)
+	}
+}
+
+func TestDedupeStore_InvalidTTL(t *testing.T) {
+	if _, err := NewDedupeStore("", 0); err == nil {
+		t.Error("expected error for zero ttl")
+	}
+}
+
+func TestKafkaCommandConsumer_DuplicateCommand(t *testing.T) {
+	calls := 0
+	reloader := &mockConfigReloader{reloadFunc: func() error {
+		calls++
+		return nil
+	}}
+	handler := NewCommandHandler(task.NewTaskManager("test-agent", nil), reloader)
+	consumer, err := NewKafkaCommandConsumer(validCCConfig(), "node-01", handler, nil)
+	if err != nil {
+		t.Fatalf("NewKafkaCommandConsumer: %v", err)
+	}
+	t.Cleanup(func() { _ = consumer.Stop() })
+
+	store, err := NewDedupeStore("", time.Hour)
+	if err != nil {
+		t.Fatalf("NewDedupeStore: %v", err)
+	}
+	consumer.SetDedupeStore(store)
+
+	cmd := Command{Method: "config_reload", ID: "req-reload-1"}
+	first := consumer.handle(context.Background(), cmd, nil)
+	second := consumer.handle(context.Background(), cmd, nil)
+
+	if calls != 1 {
+		t.Errorf("reload executed %d times, want 1", calls)
+	}
+	if second.ID != first.ID || second.Error != nil {
+		t.Errorf("duplicate response = %+v, want original %+v", second, first)
+	}
+
+	// Commands without an ID are never deduplicated.
+	consumer.handle(context.Background(), Command{Method: "config_reload"}, nil)
+	consumer.handle(context.Background(), Command{Method: "config_reload"}, nil)
+	if calls != 3 {
+		t.Errorf("reload executed %d times, want 3", calls)
+	}
+
+	// Neither are read-only commands, nor commands from other channels.
+	consumer.handle(context.Background(), Command{Method: "task_list", ID: "req-list-1"}, nil)
+	if n := store.Len(); n != 1 {
+		t.Errorf("store has %d entries after task_list, want 1", n)
+	}
+	handler.Handle(context.Background(), cmd)
+	if calls != 4 {
+		t.Errorf("reload executed %d times, want 4", calls)
+	}
+}
@@ -0,0 +1,154 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// TaskExportParams represents parameters for task_export.
+type TaskExportParams struct {
+	TaskID      string `json:"task_id"`
+	WithSecrets bool   `json:"with_secrets,omitempty"` // do not redact secrets; UDS only
+}
+
+// TaskCloneParams represents parameters for task_clone. Overrides merge into
+// the source task's config like task template overrides.
+type TaskCloneParams struct {
+	TaskID    string         `json:"task_id"` // source task
+	NewID     string         `json:"new_id"`
+	Overrides map[string]any `json:"overrides,omitempty"`
+}
+
+// handleTaskExport returns the normalized config of a task, defaults
+// applied, in the form task_create accepts. Secrets are redacted unless
+// with_secrets is set, which only commands over the UDS socket may do.
+func (h *CommandHandler) handleTaskExport(ctx context.Context, cmd Command) Response {
+	var params TaskExportParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+	if params.WithSecrets && !isLocal(ctx) {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "with_secrets is only allowed over the UDS socket",
+			},
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+	exported, err := config.ExportTaskConfig(t.Config, params.WithSecrets)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: fmt.Sprintf("export task config failed: %v", err),
+			},
+		}
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id": params.TaskID,
+			"config":  exported,
+		},
+	}
+}
+
+// handleTaskClone creates a task from the config of an existing one, with a
+// new ID and overrides, e.g. the same task on another interface.
+func (h *CommandHandler) handleTaskClone(_ context.Context, cmd Command, progress ProgressFunc) Response {
+	var params TaskCloneParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+	clone, err := config.CloneTaskConfig(t.Config, params.NewID, params.Overrides)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+
+	if err := h.taskManager.CreateWithProgress(*clone, progress.stageFunc(cmd.ID)); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:     ErrCodeInternalError,
+				Message:  fmt.Sprintf("create task failed: %v", err),
+				Category: errorCategory(err),
+			},
+		}
+	}
+
+	// The merged config, so callers can audit what the clone produced.
+	effective, _ := config.ExportTaskConfig(*clone, false)
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id":          clone.ID,
+			"source":           params.TaskID,
+			"status":           "created",
+			"effective_config": effective,
+		},
+	}
+}
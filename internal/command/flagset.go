@@ -0,0 +1,65 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FlagSetParams represents parameters for flag_set.
+type FlagSetParams struct {
+	TaskID  string `json:"task_id"`
+	Flag    string `json:"flag"`
+	Enabled *bool  `json:"enabled"` // required
+}
+
+// handleFlagSet handles flag_set command.
+func (h *CommandHandler) handleFlagSet(_ context.Context, cmd Command) Response {
+	var params FlagSetParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" || params.Flag == "" || params.Enabled == nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id, flag and enabled are required",
+			},
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+	if err := t.SetFlag(params.Flag, *params.Enabled); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id": params.TaskID,
+			"flags":   t.Flags.Snapshot(),
+		},
+	}
+}
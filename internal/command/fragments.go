@@ -0,0 +1,75 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// defaultFragmentOffenders is the offenders returned by task_fragments
+// without limit.
+const defaultFragmentOffenders = 10
+
+// TaskFragmentsParams represents parameters for task_fragments.
+type TaskFragmentsParams struct {
+	TaskID string `json:"task_id"`
+	Limit  int    `json:"limit,omitempty"` // top offenders returned (0 = 10)
+}
+
+// handleTaskFragments handles task_fragments command: the fragment rate limit
+// of a task with its counters and the sources it limited most.
+func (h *CommandHandler) handleTaskFragments(_ context.Context, cmd Command) Response {
+	var params TaskFragmentsParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+	if t.Decoder == nil || t.Decoder.FragmentRateLimiter() == nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("task %q has no fragment rate limit (decoder.fragment_rate_limit is unset)", params.TaskID),
+			},
+		}
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = defaultFragmentOffenders
+	}
+	l := t.Decoder.FragmentRateLimiter()
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id":       params.TaskID,
+			"rate_limit":    l.Stats(),
+			"top_offenders": l.TopOffenders(limit),
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+)
+
+// TaskSelectorParams selects the tasks of task_pause / task_resume: a single
+// task by ID, or every task carrying all of the given tags.
+type TaskSelectorParams struct {
+	TaskID string   `json:"task_id,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// BulkResult summarises a command applied to the tasks matched by a tag selector.
+type BulkResult struct {
+	Tags      []string          `json:"tags"`
+	Matched   []string          `json:"matched"`
+	Succeeded []string          `json:"succeeded"`
+	Failed    map[string]string `json:"failed,omitempty"` // task ID → error
+}
+
+// selectTasks resolves the selector to task IDs.
+func (h *CommandHandler) selectTasks(params TaskSelectorParams) ([]string, error) {
+	switch {
+	case params.TaskID != "" && len(params.Tags) > 0:
+		return nil, fmt.Errorf("task_id and tags are mutually exclusive")
+	case params.TaskID != "":
+		return []string{params.TaskID}, nil
+	case len(params.Tags) > 0:
+		return h.taskManager.Select(params.Tags), nil
+	default:
+		return nil, fmt.Errorf("task_id or tags is required")
+	}
+}
+
+// applyToTasks runs fn on every task matched by tags and summarises the outcome.
+func (h *CommandHandler) applyToTasks(method string, tags []string, fn func(taskID string) error) BulkResult {
+	result := BulkResult{
+		Tags:      tags,
+		Matched:   h.taskManager.Select(tags),
+		Succeeded: []string{},
+	}
+	for _, id := range result.Matched {
+		if err := fn(id); err != nil {
+			if result.Failed == nil {
+				result.Failed = make(map[string]string)
+			}
+			result.Failed[id] = err.Error()
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	if result.Matched == nil {
+		result.Matched = []string{}
+	}
+
+	slog.Info("bulk command applied",
+		"method", method,
+		"tags", tags,
+		"matched", len(result.Matched),
+		"failed", len(result.Failed),
+	)
+	return result
+}
+
+// handleTaskPause handles task_pause command.
+func (h *CommandHandler) handleTaskPause(_ context.Context, cmd Command) Response {
+	return h.handleTaskSelector(cmd, "paused", func(taskID string) error {
+		t, err := h.taskManager.Get(taskID)
+		if err != nil {
+			return err
+		}
+		return t.Pause()
+	})
+}
+
+// handleTaskResume handles task_resume command.
+func (h *CommandHandler) handleTaskResume(_ context.Context, cmd Command) Response {
+	return h.handleTaskSelector(cmd, "running", func(taskID string) error {
+		t, err := h.taskManager.Get(taskID)
+		if err != nil {
+			return err
+		}
+		return t.Resume()
+	})
+}
+
+// handleTaskSelector applies fn to the tasks selected by the command params.
+// A single task_id fails the command on error; a tag selector returns a
+// BulkResult with per-task failures.
+func (h *CommandHandler) handleTaskSelector(cmd Command, status string, fn func(taskID string) error) Response {
+	var params TaskSelectorParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if _, err := h.selectTasks(params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	if len(params.Tags) > 0 {
+		return Response{
+			ID:     cmd.ID,
+			Result: h.applyToTasks(cmd.Method, params.Tags, fn),
+		}
+	}
+
+	if err := fn(params.TaskID); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:     ErrCodeInternalError,
+				Message:  fmt.Sprintf("%s failed: %v", cmd.Method, err),
+				Category: errorCategory(err),
+			},
+		}
+	}
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id": params.TaskID,
+			"status":  status,
+		},
+	}
+}
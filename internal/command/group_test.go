@@ -0,0 +1,98 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+func createTagged(t *testing.T, h *CommandHandler, id string, tags ...string) {
+	t.Helper()
+	err := h.taskManager.Create(config.TaskConfig{
+		ID:      id,
+		Mode:    config.TaskModeAnalyzeOnly,
+		Capture: config.CaptureConfig{Name: "batch-test", Interface: "lo"},
+		Tags:    tags,
+	})
+	if err != nil {
+		t.Fatalf("create %s: %v", id, err)
+	}
+}
+
+func handleJSON(h *CommandHandler, method string, params any) Response {
+	data, _ := json.Marshal(params)
+	return h.Handle(context.Background(), Command{Method: method, Params: data, ID: "req-" + method})
+}
+
+func TestTaskPauseResume_ByTag(t *testing.T) {
+	h := newBatchHandler(t)
+	createTagged(t, h, "rtp", "media")
+
+	resp := handleJSON(h, "task_pause", TaskSelectorParams{Tags: []string{"media"}})
+	if resp.Error != nil {
+		t.Fatalf("task_pause: %+v", resp.Error)
+	}
+	result := resp.Result.(BulkResult)
+	if strings.Join(result.Matched, ",") != "rtp" || strings.Join(result.Succeeded, ",") != "rtp" {
+		t.Errorf("pause result = %+v, want rtp matched and paused", result)
+	}
+	task, _ := h.taskManager.Get("rtp")
+	if state := task.State(); state != "paused" {
+		t.Errorf("state = %s, want paused", state)
+	}
+
+	// Pausing again fails per task but not the command.
+	result = handleJSON(h, "task_pause", TaskSelectorParams{Tags: []string{"media"}}).Result.(BulkResult)
+	if len(result.Failed) != 1 || len(result.Succeeded) != 0 {
+		t.Errorf("second pause = %+v, want one failure", result)
+	}
+
+	resp = handleJSON(h, "task_resume", TaskSelectorParams{TaskID: "rtp"})
+	if resp.Error != nil {
+		t.Fatalf("task_resume: %+v", resp.Error)
+	}
+	if state := task.State(); state != "running" {
+		t.Errorf("state = %s, want running", state)
+	}
+}
+
+func TestTaskDelete_ByTag(t *testing.T) {
+	h := newBatchHandler(t)
+	createTagged(t, h, "dbg", "debug")
+
+	// No match is not an error.
+	result := handleJSON(h, "task_delete", TaskDeleteParams{Tags: []string{"media"}}).Result.(BulkResult)
+	if len(result.Matched) != 0 {
+		t.Errorf("matched = %v, want none", result.Matched)
+	}
+
+	list := handleJSON(h, "task_list", TaskListParams{Tags: []string{"debug"}}).Result.(map[string]interface{})
+	if list["count"] != 1 {
+		t.Errorf("task_list by tag count = %v, want 1", list["count"])
+	}
+
+	result = handleJSON(h, "task_delete", TaskDeleteParams{Tags: []string{"debug"}}).Result.(BulkResult)
+	if strings.Join(result.Succeeded, ",") != "dbg" {
+		t.Errorf("delete result = %+v, want dbg deleted", result)
+	}
+	if ids := h.taskManager.List(); len(ids) != 0 {
+		t.Errorf("tasks after delete = %v, want none", ids)
+	}
+}
+
+func TestTaskSelector_InvalidParams(t *testing.T) {
+	h := newBatchHandler(t)
+
+	for _, params := range []TaskSelectorParams{
+		{},
+		{TaskID: "a", Tags: []string{"media"}},
+	} {
+		resp := handleJSON(h, "task_pause", params)
+		if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+			t.Errorf("task_pause(%+v) error = %+v, want invalid params", params, resp.Error)
+		}
+	}
+}
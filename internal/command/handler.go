@@ -6,9 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"firestige.xyz/otus/internal/alert"
+	"firestige.xyz/otus/internal/audit"
+	"firestige.xyz/otus/internal/buildinfo"
+	"firestige.xyz/otus/internal/calls"
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
 	"firestige.xyz/otus/internal/task"
 )
 
@@ -16,8 +22,26 @@ import (
 type CommandHandler struct {
 	taskManager    *task.TaskManager
 	configReloader ConfigReloader
-	shutdownFunc   func() // Called by daemon_shutdown to trigger graceful stop
-	startTime      int64  // Unix timestamp of daemon start for uptime calc
+	configSource   ConfigSource // nil = config_get unavailable
+	shutdownFunc   func()       // Called by daemon_shutdown to trigger graceful stop
+	alertSource    AlertSource  // nil when the alert evaluator is disabled
+	auditSource    AuditSource  // nil when the self-audit is disabled
+	startTime      int64        // Unix timestamp of daemon start for uptime calc
+
+	// templates are otus.task_templates, replaced on config reload.
+	templatesMu sync.RWMutex
+	templates   map[string]config.TaskTemplate
+}
+
+// AlertSource exposes in-agent alert state for daemon_status.
+type AlertSource interface {
+	Health() alert.Health
+	Active() []alert.Event
+}
+
+// AuditSource exposes the components the self-audit found degraded.
+type AuditSource interface {
+	Degraded() []audit.Component
 }
 
 // ConfigReloader is the interface for reloading global configuration.
@@ -39,6 +63,23 @@ func (h *CommandHandler) SetShutdownFunc(fn func()) {
 	h.shutdownFunc = fn
 }
 
+// SetAlertSource sets the alert evaluator reported by daemon_status.
+func (h *CommandHandler) SetAlertSource(src AlertSource) {
+	h.alertSource = src
+}
+
+// SetAuditSource sets the self-audit reported by daemon_status.
+func (h *CommandHandler) SetAuditSource(src AuditSource) {
+	h.auditSource = src
+}
+
+// SetTaskTemplates sets the templates available to task_create.
+func (h *CommandHandler) SetTaskTemplates(templates map[string]config.TaskTemplate) {
+	h.templatesMu.Lock()
+	defer h.templatesMu.Unlock()
+	h.templates = templates
+}
+
 // Command represents a control plane command.
 type Command struct {
 	Method string          `json:"method"` // e.g., "task_create", "task_delete"
@@ -57,6 +98,18 @@ type Response struct {
 type ErrorInfo struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	// Category classifies errors of task operations so controllers need not
+	// match messages: transient (retry may succeed), config (fix the config)
+	// or fatal; empty when the error carries no category.
+	Category core.ErrorCategory `json:"category,omitempty"`
+}
+
+// errorCategory returns the ErrorInfo.Category of err.
+func errorCategory(err error) core.ErrorCategory {
+	if c := core.CategoryOf(err); c != core.CategoryUnknown {
+		return c
+	}
+	return ""
 }
 
 // Error codes
@@ -70,43 +123,63 @@ const (
 
 // Handle processes a command and returns a response.
 func (h *CommandHandler) Handle(ctx context.Context, cmd Command) Response {
+	return h.HandleWithProgress(ctx, cmd, nil)
+}
+
+// HandleWithProgress is Handle sending progress events to progress (if
+// non-nil) before returning: StageAccepted first, then command-specific
+// stages. progress must not block.
+func (h *CommandHandler) HandleWithProgress(ctx context.Context, cmd Command, progress ProgressFunc) Response {
+	if progress != nil {
+		progress(Progress{ID: cmd.ID, Stage: StageAccepted})
+	}
+	return h.dispatch(ctx, cmd, progress)
+}
+
+// dispatch routes a command to its handler (see routes). progress may be nil.
+func (h *CommandHandler) dispatch(ctx context.Context, cmd Command, progress ProgressFunc) Response {
 	slog.Info("handling command", "method", cmd.Method, "id", cmd.ID)
 
-	switch cmd.Method {
-	case "task_create":
-		return h.handleTaskCreate(ctx, cmd)
-	case "task_delete":
-		return h.handleTaskDelete(ctx, cmd)
-	case "task_list":
-		return h.handleTaskList(ctx, cmd)
-	case "task_status":
-		return h.handleTaskStatus(ctx, cmd)
-	case "config_reload":
-		return h.handleConfigReload(ctx, cmd)
-	case "daemon_shutdown":
-		return h.handleDaemonShutdown(ctx, cmd)
-	case "daemon_status":
-		return h.handleDaemonStatus(ctx, cmd)
-	case "daemon_stats":
-		return h.handleDaemonStats(ctx, cmd)
-	default:
-		return Response{
-			ID: cmd.ID,
-			Error: &ErrorInfo{
-				Code:    ErrCodeMethodNotFound,
-				Message: fmt.Sprintf("method %q not found", cmd.Method),
-			},
-		}
+	m, ok := routes[cmd.Method]
+	if !ok {
+		return methodNotFound(cmd)
 	}
+	return m.handle(h, ctx, cmd, progress)
 }
 
 // TaskCreateParams represents parameters for task_create command.
+// With Template, the task config is built from that template and Overrides
+// (which must then carry at least the task id) instead of Config, and the
+// template's {name} references are expanded from Variables.
 type TaskCreateParams struct {
-	Config config.TaskConfig `json:"config"`
+	Config    config.TaskConfig `json:"config"`
+	Template  string            `json:"template,omitempty"`
+	Overrides map[string]any    `json:"overrides,omitempty"`
+	Variables map[string]any    `json:"variables,omitempty"`
+}
+
+// taskConfig returns the config of the task to create.
+func (h *CommandHandler) taskConfig(params TaskCreateParams) (config.TaskConfig, error) {
+	if params.Template == "" {
+		if len(params.Variables) > 0 {
+			return config.TaskConfig{}, fmt.Errorf("variables require a template")
+		}
+		return params.Config, nil
+	}
+	if params.Config.ID != "" {
+		return config.TaskConfig{}, fmt.Errorf("config and template are mutually exclusive; use overrides with a template")
+	}
+	h.templatesMu.RLock()
+	defer h.templatesMu.RUnlock()
+	tc, err := config.ResolveTaskTemplate(h.templates, params.Template, params.Overrides, params.Variables)
+	if err != nil {
+		return config.TaskConfig{}, err
+	}
+	return *tc, nil
 }
 
 // handleTaskCreate handles task_create command.
-func (h *CommandHandler) handleTaskCreate(ctx context.Context, cmd Command) Response {
+func (h *CommandHandler) handleTaskCreate(ctx context.Context, cmd Command, progress ProgressFunc) Response {
 	var params TaskCreateParams
 	if err := json.Unmarshal(cmd.Params, &params); err != nil {
 		return Response{
@@ -118,29 +191,50 @@ func (h *CommandHandler) handleTaskCreate(ctx context.Context, cmd Command) Resp
 		}
 	}
 
-	err := h.taskManager.Create(params.Config)
+	taskConfig, err := h.taskConfig(params)
 	if err != nil {
 		return Response{
 			ID: cmd.ID,
 			Error: &ErrorInfo{
-				Code:    ErrCodeInternalError,
-				Message: fmt.Sprintf("create task failed: %v", err),
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+
+	err = h.taskManager.CreateWithProgress(taskConfig, progress.stageFunc(cmd.ID))
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:     ErrCodeInternalError,
+				Message:  fmt.Sprintf("create task failed: %v", err),
+				Category: errorCategory(err),
 			},
 		}
 	}
 
+	result := map[string]interface{}{
+		"task_id": taskConfig.ID,
+		"status":  "created",
+	}
+	if params.Template != "" {
+		// The merged config, so callers can audit what the template produced.
+		// Secrets are redacted as in task_export.
+		result["template"] = params.Template
+		result["effective_config"], _ = config.ExportTaskConfig(taskConfig, false)
+	}
 	return Response{
-		ID: cmd.ID,
-		Result: map[string]interface{}{
-			"task_id": params.Config.ID,
-			"status":  "created",
-		},
+		ID:     cmd.ID,
+		Result: result,
 	}
 }
 
 // TaskDeleteParams represents parameters for task.delete command.
+// Tags deletes every task carrying all of them instead of a single task.
 type TaskDeleteParams struct {
-	TaskID string `json:"task_id"`
+	TaskID string   `json:"task_id"`
+	Tags   []string `json:"tags,omitempty"`
 }
 
 // handleTaskDelete handles task.delete command.
@@ -156,6 +250,22 @@ func (h *CommandHandler) handleTaskDelete(ctx context.Context, cmd Command) Resp
 		}
 	}
 
+	if _, err := h.selectTasks(TaskSelectorParams{TaskID: params.TaskID, Tags: params.Tags}); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: err.Error(),
+			},
+		}
+	}
+	if len(params.Tags) > 0 {
+		return Response{
+			ID:     cmd.ID,
+			Result: h.applyToTasks(cmd.Method, params.Tags, h.taskManager.Delete),
+		}
+	}
+
 	err := h.taskManager.Delete(params.TaskID)
 	if err != nil {
 		return Response{
@@ -176,9 +286,95 @@ func (h *CommandHandler) handleTaskDelete(ctx context.Context, cmd Command) Resp
 	}
 }
 
+// TaskDrainParams represents parameters for task_drain command.
+type TaskDrainParams struct {
+	TaskID  string `json:"task_id"`
+	Timeout string `json:"timeout,omitempty"` // Go duration; default 5m
+}
+
+// handleTaskDrain handles task_drain command: capture stops, buffered packets
+// are reported, then the task is stopped but kept for task_status.
+func (h *CommandHandler) handleTaskDrain(_ context.Context, cmd Command) Response {
+	var params TaskDrainParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+	var timeout time.Duration
+	if params.Timeout != "" {
+		d, err := time.ParseDuration(params.Timeout)
+		if err != nil || d <= 0 {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: fmt.Sprintf("invalid timeout %q", params.Timeout),
+				},
+			}
+		}
+		timeout = d
+	}
+
+	elapsed, err := h.taskManager.Drain(params.TaskID, timeout)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:     ErrCodeInternalError,
+				Message:  fmt.Sprintf("drain task failed: %v", err),
+				Category: errorCategory(err),
+			},
+		}
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id":        params.TaskID,
+			"status":         task.StateStopped,
+			"drain_duration": elapsed.String(),
+		},
+	}
+}
+
+// TaskListParams represents parameters for task_list command (optional).
+type TaskListParams struct {
+	Tags []string `json:"tags,omitempty"` // only tasks carrying all of these tags
+}
+
 // handleTaskList handles task.list command.
 func (h *CommandHandler) handleTaskList(ctx context.Context, cmd Command) Response {
+	var params TaskListParams
+	if len(cmd.Params) > 0 {
+		if err := json.Unmarshal(cmd.Params, &params); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: fmt.Sprintf("invalid params: %v", err),
+				},
+			}
+		}
+	}
+
 	taskIDs := h.taskManager.List()
+	if len(params.Tags) > 0 {
+		taskIDs = h.taskManager.Select(params.Tags)
+	}
 
 	return Response{
 		ID: cmd.ID,
@@ -223,12 +419,42 @@ func (h *CommandHandler) handleTaskStatus(ctx context.Context, cmd Command) Resp
 		}
 
 		status := task.GetStatus()
+		result := map[string]interface{}{
+			"task_id": params.TaskID,
+			"status":  status.State,
+		}
+		if status.Analysis != nil {
+			result["analysis"] = status.Analysis
+		}
+		if status.ReporterSwap != nil {
+			result["reporter_swap"] = status.ReporterSwap
+		}
+		if len(task.Config.Tags) > 0 {
+			result["tags"] = task.Config.Tags
+		}
+		if len(task.CaptureAdvice) > 0 {
+			result["capture_advice"] = task.CaptureAdvice
+		}
+		if len(status.Tuning) > 0 {
+			result["tuning"] = status.Tuning
+		}
+		if status.DrainDuration != "" {
+			result["drain_duration"] = status.DrainDuration
+		}
+		if len(status.Flush) > 0 {
+			result["flush"] = status.Flush
+		}
+		if len(task.Config.ExtraCaptures) > 0 || task.Config.Capture.Prefilter != nil {
+			result["capturers"] = task.CapturerStatsList()
+		}
+		result["counters"] = map[string]interface{}{
+			"session":  task.SessionCounters(),
+			"lifetime": task.LifetimeCounters(),
+		}
+		result["resources"] = task.Resources()
 		return Response{
-			ID: cmd.ID,
-			Result: map[string]interface{}{
-				"task_id": params.TaskID,
-				"status":  status.State,
-			},
+			ID:     cmd.ID,
+			Result: result,
 		}
 	}
 
@@ -306,13 +532,32 @@ func (h *CommandHandler) handleDaemonStatus(_ context.Context, cmd Command) Resp
 	taskIDs := h.taskManager.List()
 	uptimeSeconds := time.Now().Unix() - h.startTime
 
+	health := alert.HealthOK
+	alerts := []alert.Event{}
+	if h.alertSource != nil {
+		health = h.alertSource.Health()
+		alerts = h.alertSource.Active()
+	}
+	degraded := []audit.Component{}
+	if h.auditSource != nil {
+		degraded = h.auditSource.Degraded()
+		if len(degraded) > 0 {
+			health = alert.HealthDegraded
+		}
+	}
+
 	return Response{
 		ID: cmd.ID,
 		Result: map[string]interface{}{
-			"version":    "0.1.0",
+			"version":    buildinfo.Version,
+			"commit":     buildinfo.Commit(),
 			"uptime_sec": uptimeSeconds,
 			"tasks":      taskIDs,
 			"task_count": len(taskIDs),
+			"health":     health,
+			"alerts":     alerts,
+
+			"degraded_components": degraded,
 		},
 	}
 }
@@ -322,9 +567,13 @@ func (h *CommandHandler) handleDaemonStats(_ context.Context, cmd Command) Respo
 	statusMap := h.taskManager.Status()
 	taskStats := make(map[string]interface{})
 	for id, status := range statusMap {
-		taskStats[id] = map[string]interface{}{
+		stats := map[string]interface{}{
 			"state": status.State,
 		}
+		if t, err := h.taskManager.Get(id); err == nil {
+			stats["pipeline"] = t.PipelineStats()
+		}
+		taskStats[id] = stats
 	}
 
 	return Response{
@@ -334,3 +583,109 @@ func (h *CommandHandler) handleDaemonStats(_ context.Context, cmd Command) Respo
 		},
 	}
 }
+
+// CallsParams represents parameters for calls_list / calls_get commands.
+type CallsParams struct {
+	TaskID string `json:"task_id,omitempty"` // if empty, search all tasks
+	CallID string `json:"call_id,omitempty"` // required for calls_get
+	Limit  int    `json:"limit,omitempty"`   // calls_list: max calls returned (0 = all)
+}
+
+// callTables returns the call tables of the requested task, or of all tasks
+// with a call table when taskID is empty. A missing task is an internal
+// error, as in the other task commands; a task without a call table is
+// invalid params.
+func (h *CommandHandler) callTables(taskID string) ([]*calls.Table, *ErrorInfo) {
+	if taskID != "" {
+		t, err := h.taskManager.Get(taskID)
+		if err != nil {
+			return nil, &ErrorInfo{Code: ErrCodeInternalError, Message: err.Error()}
+		}
+		if t.Calls == nil {
+			return nil, &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("task %q has no call table (calls.enabled is false)", taskID),
+			}
+		}
+		return []*calls.Table{t.Calls}, nil
+	}
+
+	var tables []*calls.Table
+	for _, id := range h.taskManager.List() {
+		if t, err := h.taskManager.Get(id); err == nil && t.Calls != nil { // not deleted meanwhile
+			tables = append(tables, t.Calls)
+		}
+	}
+	return tables, nil
+}
+
+// handleCallsList lists active calls of one or all tasks.
+func (h *CommandHandler) handleCallsList(_ context.Context, cmd Command) Response {
+	var params CallsParams
+	if len(cmd.Params) > 0 {
+		if err := json.Unmarshal(cmd.Params, &params); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: fmt.Sprintf("invalid params: %v", err),
+				},
+			}
+		}
+	}
+
+	tables, errInfo := h.callTables(params.TaskID)
+	if errInfo != nil {
+		return Response{ID: cmd.ID, Error: errInfo}
+	}
+
+	list := []calls.Call{}
+	for _, table := range tables {
+		list = append(list, table.List()...)
+	}
+	total := len(list)
+	if params.Limit > 0 && len(list) > params.Limit {
+		list = list[:params.Limit]
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"calls": list,
+			"count": total,
+		},
+	}
+}
+
+// handleCallsGet returns one active call by Call-ID.
+func (h *CommandHandler) handleCallsGet(_ context.Context, cmd Command) Response {
+	var params CallsParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil || params.CallID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "invalid params: call_id is required",
+			},
+		}
+	}
+
+	tables, errInfo := h.callTables(params.TaskID)
+	if errInfo != nil {
+		return Response{ID: cmd.ID, Error: errInfo}
+	}
+
+	for _, table := range tables {
+		if call, ok := table.Get(params.CallID); ok {
+			return Response{ID: cmd.ID, Result: call}
+		}
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Error: &ErrorInfo{
+			Code:    ErrCodeInternalError,
+			Message: fmt.Sprintf("call %q not found", params.CallID),
+		},
+	}
+}
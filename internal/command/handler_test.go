@@ -3,10 +3,19 @@ package command
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"firestige.xyz/otus/internal/alert"
+	"firestige.xyz/otus/internal/audit"
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/featureflag"
 	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/internal/topk"
 )
 
 // mockConfigReloader is a mock implementation of ConfigReloader.
@@ -100,6 +109,36 @@ func TestCommandHandler_HandleTaskList(t *testing.T) {
 	}
 }
 
+// fakeAuditSource returns fixed degraded components.
+type fakeAuditSource []audit.Component
+
+func (f fakeAuditSource) Degraded() []audit.Component { return f }
+
+func TestCommandHandler_DaemonStatusDegradedComponents(t *testing.T) {
+	handler := NewCommandHandler(task.NewTaskManager("test-agent", nil), nil)
+	status := func() map[string]interface{} {
+		resp := handler.Handle(context.Background(), Command{Method: "daemon_status", ID: "req-s"})
+		if resp.Error != nil {
+			t.Fatalf("unexpected error: %v", resp.Error.Message)
+		}
+		return resp.Result.(map[string]interface{})
+	}
+
+	handler.SetAuditSource(fakeAuditSource{})
+	if r := status(); r["health"] != alert.HealthOK || len(r["degraded_components"].([]audit.Component)) != 0 {
+		t.Errorf("healthy status = %v", r)
+	}
+
+	handler.SetAuditSource(fakeAuditSource{{Kind: audit.KindInterface, Name: "eth1", TaskID: "t1", Reason: "interface eth1 is down"}})
+	r := status()
+	if r["health"] != alert.HealthDegraded {
+		t.Errorf("health = %v, want degraded", r["health"])
+	}
+	if deg := r["degraded_components"].([]audit.Component); len(deg) != 1 || deg[0].Name != "eth1" {
+		t.Errorf("degraded_components = %v", deg)
+	}
+}
+
 func TestCommandHandler_HandleTaskStatus(t *testing.T) {
 	tm := task.NewTaskManager("test-agent", nil)
 	handler := NewCommandHandler(tm, nil)
@@ -225,3 +264,486 @@ func TestCommandHandler_InvalidParams(t *testing.T) {
 		t.Errorf("error code = %d, want %d", resp.Error.Code, ErrCodeInvalidParams)
 	}
 }
+
+func TestCommandHandler_CreateErrorCategory(t *testing.T) {
+	tm := task.NewTaskManager("test-agent", nil)
+	handler := NewCommandHandler(tm, nil)
+
+	// An unknown capturer is a configuration error, not worth retrying
+	resp := handler.Handle(context.Background(), Command{
+		Method: "task_create",
+		Params: json.RawMessage(`{"id":"bad","capture":{"name":"no-such-capturer","interface":"lo"},"parsers":[{"name":"sip"}]}`),
+		ID:     "req-cat",
+	})
+	if resp.Error == nil {
+		t.Fatal("expected error for unknown capturer")
+	}
+	if resp.Error.Category != core.CategoryConfig {
+		t.Errorf("category = %q, want %q (%s)", resp.Error.Category, core.CategoryConfig, resp.Error.Message)
+	}
+}
+
+func TestCommandHandler_Calls(t *testing.T) {
+	tm := task.NewTaskManager("test-agent", nil)
+	handler := NewCommandHandler(tm, nil)
+
+	// No tasks: empty list, not an error.
+	resp := handler.Handle(context.Background(), Command{Method: "calls_list", ID: "req-8"})
+	if resp.Error != nil {
+		t.Fatalf("calls_list error: %v", resp.Error.Message)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["count"] != 0 {
+		t.Errorf("count = %v, want 0", result["count"])
+	}
+
+	// Unknown task.
+	resp = handler.Handle(context.Background(), Command{
+		Method: "calls_list",
+		Params: json.RawMessage(`{"task_id":"missing"}`),
+		ID:     "req-9",
+	})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInternalError {
+		t.Errorf("expected internal error for unknown task, got %+v", resp.Error)
+	}
+
+	// calls_get requires call_id.
+	resp = handler.Handle(context.Background(), Command{Method: "calls_get", Params: json.RawMessage(`{}`), ID: "req-10"})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("expected invalid params without call_id, got %+v", resp.Error)
+	}
+
+	resp = handler.Handle(context.Background(), Command{
+		Method: "calls_get",
+		Params: json.RawMessage(`{"call_id":"nope@example.com"}`),
+		ID:     "req-11",
+	})
+	if resp.Error == nil {
+		t.Error("expected not-found error for unknown call")
+	}
+}
+
+func TestCommandHandler_HandleTaskCreate_Template(t *testing.T) {
+	handler := newBatchHandler(t)
+	handler.SetTaskTemplates(map[string]config.TaskTemplate{
+		"base": {Config: map[string]any{
+			"mode":    config.TaskModeAnalyzeOnly,
+			"capture": map[string]any{"name": "batch-test", "interface": "lo", "config": map[string]any{"password": "hunter2"}},
+		}},
+		"media": {Extends: "base", Config: map[string]any{
+			"tags": []any{"media"},
+		}},
+	})
+
+	params, _ := json.Marshal(TaskCreateParams{
+		Template:  "media",
+		Overrides: map[string]any{"id": "media-1", "capture": map[string]any{"interface": "eth1"}},
+	})
+	resp := handler.Handle(context.Background(), Command{Method: "task_create", Params: params, ID: "req-t1"})
+	if resp.Error != nil {
+		t.Fatalf("task_create: %s", resp.Error.Message)
+	}
+
+	result := resp.Result.(map[string]interface{})
+	effective, ok := result["effective_config"].(map[string]any)
+	if !ok {
+		t.Fatalf("effective_config missing from result: %v", result)
+	}
+	capture := effective["capture"].(map[string]any)
+	if effective["id"] != "media-1" || capture["name"] != "batch-test" || capture["interface"] != "eth1" {
+		t.Errorf("effective config = %+v", effective)
+	}
+	if got := capture["config"].(map[string]any)["password"]; got != config.Redacted {
+		t.Errorf("capture password = %v, want redacted", got)
+	}
+	if tags, _ := effective["tags"].([]any); len(tags) != 1 || tags[0] != "media" {
+		t.Errorf("tags = %v, want [media]", effective["tags"])
+	}
+
+	params, _ = json.Marshal(TaskCreateParams{
+		Template:  "base",
+		Overrides: map[string]any{"id": "{tenant}-1", "capture": map[string]any{"interface": "{interface}"}},
+		Variables: map[string]any{"tenant": "acme", "interface": "eth2"},
+	})
+	resp = handler.Handle(context.Background(), Command{Method: "task_create", Params: params, ID: "req-t3"})
+	if resp.Error != nil {
+		t.Fatalf("task_create with variables: %s", resp.Error.Message)
+	}
+	effective = resp.Result.(map[string]interface{})["effective_config"].(map[string]any)
+	if effective["id"] != "acme-1" || effective["capture"].(map[string]any)["interface"] != "eth2" {
+		t.Errorf("effective config = %+v, want variables expanded", effective)
+	}
+
+	params, _ = json.Marshal(TaskCreateParams{Template: "signaling", Overrides: map[string]any{"id": "sig-1"}})
+	resp = handler.Handle(context.Background(), Command{Method: "task_create", Params: params, ID: "req-t2"})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("unknown template: error = %+v, want invalid params", resp.Error)
+	}
+}
+
+func TestCommandHandler_HandleTaskReconfigure_Errors(t *testing.T) {
+	handler := newBatchHandler(t)
+	if resp, _ := runBatch(t, handler, createItem(t, "analyze-1", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %s", resp.Error.Message)
+	}
+
+	tests := []struct {
+		name     string
+		params   string
+		wantCode int
+	}{
+		{"missing task_id", `{"plugins":{"sip":{}}}`, ErrCodeInvalidParams},
+		{"nothing to change", `{"task_id":"analyze-1"}`, ErrCodeInvalidParams},
+		{"missing replace", `{"task_id":"analyze-1","reporter_swap":{"reporter":{"name":"kafka"}}}`, ErrCodeInvalidParams},
+		{"bad warmup", `{"task_id":"analyze-1","reporter_swap":{"replace":"kafka","reporter":{"name":"kafka"},"warmup":"-1m"}}`, ErrCodeInvalidParams},
+		{"unknown task", `{"task_id":"nope","plugins":{"sip":{}}}`, ErrCodeInternalError},
+		{"unknown reporter plugin", `{"task_id":"analyze-1","reporter_swap":{"replace":"kafka","reporter":{"name":"no-such-reporter"}}}`, ErrCodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := handler.Handle(context.Background(), Command{Method: "task_reconfigure", Params: json.RawMessage(tt.params), ID: "req-r"})
+			if resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Errorf("error = %+v, want code %d", resp.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCommandHandler_HandleWithProgress(t *testing.T) {
+	handler := newBatchHandler(t)
+	params, _ := json.Marshal(TaskCreateParams{Config: config.TaskConfig{
+		ID:      "analyze-1",
+		Mode:    config.TaskModeAnalyzeOnly,
+		Capture: config.CaptureConfig{Name: "batch-test", Interface: "lo"},
+	}})
+
+	var events []string
+	resp := handler.HandleWithProgress(context.Background(), Command{Method: "task_create", Params: params, ID: "req-p"}, func(p Progress) {
+		if p.ID != "req-p" {
+			t.Errorf("progress ID = %q, want req-p", p.ID)
+		}
+		events = append(events, p.Stage)
+	})
+	if resp.Error != nil {
+		t.Fatalf("task_create: %s", resp.Error.Message)
+	}
+	if got, want := strings.Join(events, ","), "accepted,validating,constructing,starting"; got != want {
+		t.Errorf("stages = %q, want %q", got, want)
+	}
+}
+
+func TestCommandHandler_HandleTaskDrain(t *testing.T) {
+	handler := newBatchHandler(t)
+	if resp, _ := runBatch(t, handler, createItem(t, "analyze-1", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %s", resp.Error.Message)
+	}
+
+	for _, params := range []string{`{}`, `{"task_id":"analyze-1","timeout":"soon"}`} {
+		resp := handler.Handle(context.Background(), Command{Method: "task_drain", Params: json.RawMessage(params), ID: "req-d"})
+		if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+			t.Errorf("%s: error = %+v, want invalid params", params, resp.Error)
+		}
+	}
+
+	resp := handler.Handle(context.Background(), Command{Method: "task_drain", Params: json.RawMessage(`{"task_id":"analyze-1","timeout":"10s"}`), ID: "req-d"})
+	if resp.Error != nil {
+		t.Fatalf("task_drain: %s", resp.Error.Message)
+	}
+	result := resp.Result.(map[string]interface{})
+	if result["status"] != task.StateStopped || result["drain_duration"] == "" {
+		t.Errorf("result = %v", result)
+	}
+
+	// The drained task stays for task_status
+	resp = handler.Handle(context.Background(), Command{Method: "task_status", Params: json.RawMessage(`{"task_id":"analyze-1"}`), ID: "req-s"})
+	if resp.Error != nil {
+		t.Fatalf("task_status: %s", resp.Error.Message)
+	}
+	status := resp.Result.(map[string]interface{})
+	if status["status"] != task.StateStopped || status["drain_duration"] != result["drain_duration"] {
+		t.Errorf("task_status = %v, want stopped with drain_duration %v", status, result["drain_duration"])
+	}
+}
+
+func TestCommandHandler_HandleTaskTopK(t *testing.T) {
+	handler := newBatchHandler(t)
+	if resp, _ := runBatch(t, handler, createItem(t, "plain", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %s", resp.Error.Message)
+	}
+	params, _ := json.Marshal(TaskCreateParams{Config: config.TaskConfig{
+		ID:      "hitters",
+		Mode:    config.TaskModeAnalyzeOnly,
+		Capture: config.CaptureConfig{Name: "batch-test", Interface: "lo"},
+		TopK:    config.TopKConfig{Keys: []string{"sip.user_agent", "sip.to_user"}, K: 2},
+	}})
+	if resp := handler.Handle(context.Background(), Command{Method: "task_create", Params: params, ID: "req-k0"}); resp.Error != nil {
+		t.Fatalf("task_create: %s", resp.Error.Message)
+	}
+
+	tk, err := handler.taskManager.Get("hitters")
+	if err != nil || tk.TopK == nil {
+		t.Fatalf("task TopK = nil (err %v)", err)
+	}
+	for _, ua := range []string{"friendly-scanner", "friendly-scanner", "friendly-scanner", "Zoiper", "Zoiper", "Linphone"} {
+		tk.TopK.Observe(&core.OutputPacket{Labels: core.Labels{"sip.user_agent": ua, "sip.to_user": "100"}})
+	}
+
+	resp := handler.Handle(context.Background(), Command{
+		Method: "task_topk",
+		Params: json.RawMessage(`{"task_id":"hitters","key":"sip.user_agent","limit":1}`),
+		ID:     "req-k1",
+	})
+	if resp.Error != nil {
+		t.Fatalf("task_topk: %s", resp.Error.Message)
+	}
+	result := resp.Result.(map[string]interface{})
+	keys := result["keys"].(map[string][]topk.Item)
+	if len(keys) != 1 || len(keys["sip.user_agent"]) != 1 {
+		t.Fatalf("keys = %v, want sip.user_agent only, 1 item", keys)
+	}
+	if top := keys["sip.user_agent"][0]; top.Value != "friendly-scanner" || top.Count != 3 {
+		t.Errorf("top = %+v, want friendly-scanner×3", top)
+	}
+	if result["packets"] != uint64(6) {
+		t.Errorf("packets = %v, want 6", result["packets"])
+	}
+
+	tests := []struct {
+		name     string
+		params   string
+		wantCode int
+	}{
+		{"missing task_id", `{}`, ErrCodeInvalidParams},
+		{"unknown task", `{"task_id":"nope"}`, ErrCodeInternalError},
+		{"tracking disabled", `{"task_id":"plain"}`, ErrCodeInvalidParams},
+		{"untracked key", `{"task_id":"hitters","key":"sip.method"}`, ErrCodeInvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := handler.Handle(context.Background(), Command{Method: "task_topk", Params: json.RawMessage(tt.params), ID: "req-k2"})
+			if resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Errorf("error = %+v, want code %d", resp.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestCommandHandler_FragmentRateLimit(t *testing.T) {
+	handler := newBatchHandler(t)
+	params, _ := json.Marshal(TaskCreateParams{Config: config.TaskConfig{
+		ID:      "frags",
+		Mode:    config.TaskModeAnalyzeOnly,
+		Capture: config.CaptureConfig{Name: "batch-test", Interface: "lo"},
+		Decoder: config.DecoderConfig{IPReassembly: true},
+	}})
+	if resp := handler.Handle(context.Background(), Command{Method: "task_create", Params: params, ID: "req-f0"}); resp.Error != nil {
+		t.Fatalf("task_create: %s", resp.Error.Message)
+	}
+
+	resp := handler.Handle(context.Background(), Command{Method: "task_fragments", Params: json.RawMessage(`{"task_id":"nope"}`), ID: "req-fx"})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInternalError {
+		t.Fatalf("task_fragments of an unknown task: error = %+v, want internal error", resp.Error)
+	}
+
+	// No limit configured yet
+	resp = handler.Handle(context.Background(), Command{Method: "task_fragments", Params: json.RawMessage(`{"task_id":"frags"}`), ID: "req-f1"})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Fatalf("task_fragments before enabling: error = %+v, want invalid params", resp.Error)
+	}
+
+	resp = handler.Handle(context.Background(), Command{
+		Method: "task_reconfigure",
+		Params: json.RawMessage(`{"task_id":"frags","fragment_rate_limit":{"max_frags_per_ip":2,"window":"30s"}}`),
+		ID:     "req-f2",
+	})
+	if resp.Error != nil {
+		t.Fatalf("task_reconfigure: %s", resp.Error.Message)
+	}
+	if st := resp.Result.(map[string]interface{})["fragment_rate_limit"].(decoder.FragmentRateLimitStats); st.MaxFragsPerIP != 2 || st.Window != "30s" {
+		t.Errorf("fragment_rate_limit = %+v", st)
+	}
+
+	tk, _ := handler.taskManager.Get("frags")
+	l := tk.Decoder.FragmentRateLimiter()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		l.Allow([4]byte{203, 0, 113, 7}, now)
+	}
+	resp = handler.Handle(context.Background(), Command{Method: "task_fragments", Params: json.RawMessage(`{"task_id":"frags","limit":1}`), ID: "req-f3"})
+	if resp.Error != nil {
+		t.Fatalf("task_fragments: %s", resp.Error.Message)
+	}
+	result := resp.Result.(map[string]interface{})
+	top := result["top_offenders"].([]decoder.FragmentOffender)
+	if len(top) != 1 || top[0].SrcIP != "203.0.113.7" || top[0].Rejected != 3 {
+		t.Errorf("top_offenders = %+v, want 203.0.113.7×3", top)
+	}
+	if st := result["rate_limit"].(decoder.FragmentRateLimitStats); st.Rejected != 3 || st.LimitedSources != 1 {
+		t.Errorf("rate_limit = %+v", st)
+	}
+
+	for _, p := range []string{
+		`{"task_id":"frags","fragment_rate_limit":{"max_frags_per_ip":-1}}`,
+		`{"task_id":"frags","fragment_rate_limit":{"max_frags_per_ip":10,"window":"soon"}}`,
+	} {
+		resp := handler.Handle(context.Background(), Command{Method: "task_reconfigure", Params: json.RawMessage(p), ID: "req-f4"})
+		if resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+			t.Errorf("%s: error = %+v, want invalid params", p, resp.Error)
+		}
+	}
+}
+
+func TestCommandHandler_HandleFlagSet(t *testing.T) {
+	handler := newBatchHandler(t)
+	if resp, _ := runBatch(t, handler, createItem(t, "flagged", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %s", resp.Error.Message)
+	}
+
+	resp := handler.Handle(context.Background(), Command{
+		Method: "flag_set",
+		Params: json.RawMessage(`{"task_id":"flagged","flag":"zero_copy","enabled":false}`),
+		ID:     "req-f1",
+	})
+	if resp.Error != nil {
+		t.Fatalf("flag_set: %s", resp.Error.Message)
+	}
+	flags := resp.Result.(map[string]interface{})["flags"].(map[string]bool)
+	if flags["zero_copy"] || !flags["adaptive_batch"] {
+		t.Errorf("flags = %v, want zero_copy off, others on", flags)
+	}
+	tk, _ := handler.taskManager.Get("flagged")
+	if tk.Flags.Enabled(featureflag.ZeroCopy) {
+		t.Error("task zero_copy flag still on")
+	}
+	if st := tk.GetStatus(); st.Flags["zero_copy"] {
+		t.Errorf("status flags = %v", st.Flags)
+	}
+
+	tests := []struct {
+		name     string
+		params   string
+		wantCode int
+	}{
+		{"missing enabled", `{"task_id":"flagged","flag":"zero_copy"}`, ErrCodeInvalidParams},
+		{"unknown task", `{"task_id":"nope","flag":"zero_copy","enabled":true}`, ErrCodeInternalError},
+		{"unknown flag", `{"task_id":"flagged","flag":"warp_drive","enabled":true}`, ErrCodeInvalidParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := handler.Handle(context.Background(), Command{Method: "flag_set", Params: json.RawMessage(tt.params), ID: "req-f2"})
+			if resp.Error == nil || resp.Error.Code != tt.wantCode {
+				t.Errorf("error = %+v, want code %d", resp.Error, tt.wantCode)
+			}
+		})
+	}
+}
+
+// staticConfigSource returns a fixed global config.
+type staticConfigSource struct{ cfg *config.GlobalConfig }
+
+func (s staticConfigSource) Config() *config.GlobalConfig { return s.cfg }
+
+func TestCommandHandler_HandleConfigGet(t *testing.T) {
+	tm := task.NewTaskManager("test-agent", nil)
+	handler := NewCommandHandler(tm, nil)
+
+	resp := handler.Handle(context.Background(), Command{Method: "config_get", ID: "req-1"})
+	if resp.Error == nil {
+		t.Fatal("expected error without a config source")
+	}
+
+	cfg := &config.GlobalConfig{MaxTasks: 2}
+	cfg.Kafka.SASL.Password = "hunter2"
+	handler.SetConfigSource(staticConfigSource{cfg})
+
+	resp = handler.Handle(context.Background(), Command{Method: "config_get", ID: "req-2"})
+	if resp.Error != nil {
+		t.Fatalf("unexpected error: %v", resp.Error.Message)
+	}
+	data, err := json.Marshal(resp.Result)
+	if err != nil {
+		t.Fatalf("marshal result: %v", err)
+	}
+	var snapshot struct {
+		Global map[string]any `json:"global"`
+		Hash   string         `json:"hash"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if snapshot.Global["max_tasks"] != float64(2) {
+		t.Errorf("global.max_tasks = %v, want 2", snapshot.Global["max_tasks"])
+	}
+	if len(snapshot.Hash) != len("sha256:")+64 {
+		t.Errorf("hash = %q, want sha256:<hex>", snapshot.Hash)
+	}
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("secret leaked in config_get result")
+	}
+}
+
+func TestCommandHandler_HandleTaskExportClone(t *testing.T) {
+	handler := newBatchHandler(t)
+	if resp, _ := runBatch(t, handler, createItem(t, "analyze-1", "batch-test")); resp.Error != nil {
+		t.Fatalf("setup: %s", resp.Error.Message)
+	}
+
+	resp := handler.Handle(context.Background(), Command{Method: "task_export", Params: json.RawMessage(`{"task_id":"analyze-1"}`), ID: "req-e1"})
+	if resp.Error != nil {
+		t.Fatalf("task_export: %s", resp.Error.Message)
+	}
+	exported := resp.Result.(map[string]interface{})["config"].(map[string]any)
+	if exported["id"] != "analyze-1" || exported["workers"] != float64(1) {
+		t.Errorf("exported config = %v, want id and default workers", exported)
+	}
+
+	// The export is accepted by task_create as is
+	data, _ := json.Marshal(map[string]any{"config": exported})
+	var params TaskCreateParams
+	if err := json.Unmarshal(data, &params); err != nil || params.Config.Capture.Name != "batch-test" {
+		t.Errorf("export does not decode as task_create params: %v, %+v", err, params.Config.Capture)
+	}
+
+	resp = handler.Handle(context.Background(), Command{Method: "task_clone", ID: "req-c1",
+		Params: json.RawMessage(`{"task_id":"analyze-1","new_id":"analyze-2","overrides":{"capture":{"interface":"eth1"}}}`)})
+	if resp.Error != nil {
+		t.Fatalf("task_clone: %s", resp.Error.Message)
+	}
+	clone, err := handler.taskManager.Get("analyze-2")
+	if err != nil {
+		t.Fatalf("clone not created: %v", err)
+	}
+	if clone.Config.Capture.Interface != "eth1" || clone.Config.Mode != config.TaskModeAnalyzeOnly {
+		t.Errorf("clone config = %+v", clone.Config)
+	}
+
+	// Secrets are only exported over the UDS socket
+	withSecrets := Command{Method: "task_export", Params: json.RawMessage(`{"task_id":"analyze-1","with_secrets":true}`), ID: "req-e2"}
+	if resp := handler.Handle(context.Background(), withSecrets); resp.Error == nil || resp.Error.Code != ErrCodeInvalidParams {
+		t.Errorf("with_secrets off the socket: error = %+v, want invalid params", resp.Error)
+	}
+	if resp := handler.Handle(context.WithValue(context.Background(), localKey{}, true), withSecrets); resp.Error != nil {
+		t.Errorf("with_secrets over the socket: %s", resp.Error.Message)
+	}
+
+	for i, tt := range []struct {
+		method, params string
+		code           int
+	}{
+		{"task_export", `{}`, ErrCodeInvalidParams},
+		{"task_export", `{"task_id":"missing"}`, ErrCodeInternalError},
+		{"task_clone", `{"task_id":"missing","new_id":"x"}`, ErrCodeInternalError},
+		{"task_clone", `{"task_id":"analyze-1"}`, ErrCodeInvalidParams},
+		{"task_clone", `{"task_id":"analyze-1","new_id":"analyze-3","overrides":{"capture":{"max_pps":-1}}}`, ErrCodeInvalidParams},
+	} {
+		resp := handler.Handle(context.Background(), Command{Method: tt.method, Params: json.RawMessage(tt.params), ID: fmt.Sprintf("req-x%d", i)})
+		if resp.Error == nil || resp.Error.Code != tt.code {
+			t.Errorf("%s %s: error = %+v, want code %d", tt.method, tt.params, resp.Error, tt.code)
+		}
+	}
+	resp = handler.Handle(context.Background(), Command{Method: "task_clone", ID: "req-c2",
+		Params: json.RawMessage(`{"task_id":"analyze-1","new_id":"analyze-2"}`)})
+	if resp.Error == nil || resp.Error.Code != ErrCodeInternalError {
+		t.Errorf("clone onto an existing id: error = %+v", resp.Error)
+	}
+}
@@ -7,11 +7,14 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/tlspolicy"
 )
 
 // KafkaCommand is the wire format for commands received via Kafka (ADR-026).
@@ -27,12 +30,13 @@ import (
 //	  "payload":    { ... }
 //	}
 type KafkaCommand struct {
-	Version   string          `json:"version"`    // Protocol version ("v1")
-	Target    string          `json:"target"`     // Node hostname or "*" for broadcast
-	Command   string          `json:"command"`    // Command name (e.g., "task_create")
-	Timestamp time.Time       `json:"timestamp"`  // When the command was issued
-	RequestID string          `json:"request_id"` // Unique request ID for tracing
-	Payload   json.RawMessage `json:"payload"`    // Command-specific parameters
+	Version   string          `json:"version"`            // Protocol version ("v1")
+	Target    string          `json:"target"`             // Node hostname or "*" for broadcast
+	Command   string          `json:"command"`            // Command name (e.g., "task_create")
+	Timestamp time.Time       `json:"timestamp"`          // When the command was issued
+	RequestID string          `json:"request_id"`         // Unique request ID for tracing
+	Payload   json.RawMessage `json:"payload"`            // Command-specific parameters
+	Progress  bool            `json:"progress,omitempty"` // Publish progress events before the response
 }
 
 // messageWriter abstracts kafka.Writer for testability.
@@ -61,25 +65,38 @@ type KafkaResponse struct {
 	Timestamp time.Time   `json:"timestamp"`            // When the response was produced
 	Result    interface{} `json:"result,omitempty"`     // Command result, nil on error
 	Error     *ErrorInfo  `json:"error,omitempty"`      // Non-nil when command failed
+	Stage     string      `json:"stage,omitempty"`      // Progress event (no result or error); empty on the response
+	Event     string      `json:"event,omitempty"`      // Unsolicited event, e.g. "quality_alert" (Result is its payload); empty on responses
 }
 
+// eventQueueSize bounds the events waiting for the event writer; events
+// beyond it are dropped rather than stall the pipelines raising them.
+const eventQueueSize = 256
+
 // KafkaCommandConsumer consumes commands from Kafka and dispatches to handler.
 type KafkaCommandConsumer struct {
 	ccConfig config.CommandChannelConfig
 	hostname string        // local node hostname for target matching
-	reader   *kafka.Reader
+	readers  []*topicReader
 	writer   messageWriter // nil when response_topic is empty (ADR-029)
+	events   chan KafkaResponse
+	evWriter messageWriter // alert_topic writer, else writer; nil = events disabled
+	evClose  sync.Once
 	handler  *CommandHandler
 	ttl      time.Duration // command TTL for stale-command rejection
+	verifier Verifier      // nil when command signing is disabled
+	dedupe   *DedupeStore  // nil = no replay protection
 }
 
 // NewKafkaCommandConsumer creates a new Kafka command consumer using the global config.
-func NewKafkaCommandConsumer(ccConfig config.CommandChannelConfig, hostname string, handler *CommandHandler) (*KafkaCommandConsumer, error) {
+// tlsPolicy is the agent-wide TLS policy, applied when command_channel.kafka.tls
+// is enabled; nil uses Go defaults.
+func NewKafkaCommandConsumer(ccConfig config.CommandChannelConfig, hostname string, handler *CommandHandler, tlsPolicy *tlspolicy.Policy) (*KafkaCommandConsumer, error) {
 	kc := ccConfig.Kafka
 	if len(kc.Brokers) == 0 {
 		return nil, fmt.Errorf("brokers is required")
 	}
-	if kc.Topic == "" {
+	if len(kc.TopicNames()) == 0 {
 		return nil, fmt.Errorf("topic is required")
 	}
 	if kc.GroupID == "" {
@@ -96,6 +113,22 @@ func NewKafkaCommandConsumer(ccConfig config.CommandChannelConfig, hostname stri
 		}
 	}
 
+	verifier, err := NewVerifier(ccConfig.Signing)
+	if err != nil {
+		return nil, fmt.Errorf("command signing: %w", err)
+	}
+
+	tlsConfig, err := tlsPolicy.Client(kc.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("command channel tls: %w", err)
+	}
+	var dialer *kafka.Dialer
+	var transport kafka.RoundTripper
+	if tlsConfig != nil {
+		dialer = &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true, TLS: tlsConfig}
+		transport = &kafka.Transport{TLS: tlsConfig}
+	}
+
 	// Determine start offset
 	var startOffset int64
 	switch kc.AutoOffsetReset {
@@ -105,17 +138,43 @@ func NewKafkaCommandConsumer(ccConfig config.CommandChannelConfig, hostname stri
 		startOffset = kafka.LastOffset
 	}
 
-	// Create Kafka reader (consumer)
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        kc.Brokers,
-		Topic:          kc.Topic,
-		GroupID:        kc.GroupID,
-		StartOffset:    startOffset,
-		MinBytes:       1,
-		MaxBytes:       10 << 20,
-		CommitInterval: time.Second,
-		MaxWait:        1 * time.Second,
-	})
+	// Create one Kafka reader (consumer) per command topic
+	topics := make([]config.CommandTopicConfig, 0, len(kc.Topics)+1)
+	if kc.Topic != "" {
+		topics = append(topics, config.CommandTopicConfig{Name: kc.Topic})
+	}
+	topics = append(topics, kc.Topics...)
+
+	readers := make([]*topicReader, 0, len(topics))
+	for _, t := range topics {
+		if t.Name == "" {
+			return nil, fmt.Errorf("command topic name is required")
+		}
+		groupID := t.GroupID
+		if groupID == "" {
+			groupID = kc.GroupID
+		}
+		commands, err := commandSet(t.Commands)
+		if err != nil {
+			return nil, fmt.Errorf("command topic %q: %w", t.Name, err)
+		}
+		readers = append(readers, &topicReader{
+			topic:    t.Name,
+			groupID:  groupID,
+			commands: commands,
+			reader: kafka.NewReader(kafka.ReaderConfig{
+				Brokers:        kc.Brokers,
+				Topic:          t.Name,
+				GroupID:        groupID,
+				StartOffset:    startOffset,
+				MinBytes:       1,
+				MaxBytes:       10 << 20,
+				CommitInterval: time.Second,
+				MaxWait:        1 * time.Second,
+				Dialer:         dialer,
+			}),
+		})
+	}
 
 	// Create Kafka writer (producer) for response channel — only when response_topic is set (ADR-029)
 	var writer messageWriter
@@ -126,45 +185,141 @@ func NewKafkaCommandConsumer(ccConfig config.CommandChannelConfig, hostname stri
 			Balancer:     &kafka.Hash{},       // hostname as key → consistent partition routing
 			RequiredAcks: kafka.RequireOne,
 			Async:        false,               // synchronous write so failures are observable
+			Transport:    transport,
+		}
+	}
+
+	// Events (quality alerts) go to alert_topic, else share the response topic
+	evWriter := writer
+	if kc.AlertTopic != "" {
+		evWriter = &kafka.Writer{
+			Addr:         kafka.TCP(kc.Brokers...),
+			Topic:        kc.AlertTopic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne,
+			Transport:    transport,
 		}
 	}
 
 	return &KafkaCommandConsumer{
 		ccConfig: ccConfig,
 		hostname: hostname,
-		reader:   reader,
+		readers:  readers,
 		writer:   writer,
+		events:   make(chan KafkaResponse, eventQueueSize),
+		evWriter: evWriter,
 		handler:  handler,
 		ttl:      ttl,
+		verifier: verifier,
 	}, nil
 }
 
-// Start starts consuming commands from Kafka.
+// topicReader consumes one command topic.
+type topicReader struct {
+	topic    string
+	groupID  string
+	commands map[string]bool // allowed commands; nil = all
+	reader   *kafka.Reader
+}
+
+// commandSet returns the allowed commands of a topic; a name that is no
+// method (e.g. a typo) is an error rather than a command never allowed.
+func commandSet(commands []string) (map[string]bool, error) {
+	if len(commands) == 0 {
+		return nil, nil
+	}
+	set := make(map[string]bool, len(commands))
+	for _, c := range commands {
+		if !IsMethod(c) {
+			return nil, fmt.Errorf("unknown command %q", c)
+		}
+		set[c] = true
+	}
+	return set, nil
+}
+
+// allows reports whether command may be executed from topic. Topics without
+// a command list (and messages from unknown topics) allow every command.
+// A batch is allowed only if "batch" and every sub-command are allowed.
+func (c *KafkaCommandConsumer) allows(topic, command string, payload json.RawMessage) bool {
+	for _, r := range c.readers {
+		if r.topic != topic || r.commands == nil {
+			continue
+		}
+		if !r.commands[command] {
+			return false
+		}
+		if command == "batch" {
+			var params BatchParams
+			if json.Unmarshal(payload, &params) != nil {
+				return false
+			}
+			for _, item := range params.Commands {
+				if !r.commands[item.Method] {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Start starts consuming commands from all command topics, one goroutine per topic.
 // Blocks until context is cancelled or an unrecoverable error occurs.
 func (c *KafkaCommandConsumer) Start(ctx context.Context) error {
 	slog.Info("kafka command consumer started",
 		"brokers", c.ccConfig.Kafka.Brokers,
-		"topic", c.ccConfig.Kafka.Topic,
+		"topics", c.ccConfig.Kafka.TopicNames(),
 		"group_id", c.ccConfig.Kafka.GroupID,
 		"hostname", c.hostname,
 		"ttl", c.ttl,
 	)
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if c.evWriter != nil {
+		go c.publishEvents(ctx)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(c.readers))
+	for i, r := range c.readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = c.consume(ctx, r)
+			cancel() // an unrecoverable topic error stops the other readers too
+		}()
+	}
+	wg.Wait()
+
+	slog.Info("kafka command consumer stopped", "reason", ctx.Err())
+	for _, err := range errs {
+		if err != nil && err != context.Canceled {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// consume fetches, processes and commits messages of one command topic.
+func (c *KafkaCommandConsumer) consume(ctx context.Context, r *topicReader) error {
 	for {
 		select {
 		case <-ctx.Done():
-			slog.Info("kafka command consumer stopped", "reason", ctx.Err())
 			return ctx.Err()
 		default:
 		}
 
 		// Fetch message with context
-		msg, err := c.reader.FetchMessage(ctx)
+		msg, err := r.reader.FetchMessage(ctx)
 		if err != nil {
 			if err == context.Canceled || err == context.DeadlineExceeded {
 				return err
 			}
-			slog.Error("failed to fetch kafka message", "error", err)
+			slog.Error("failed to fetch kafka message", "topic", r.topic, "error", err)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -184,14 +339,33 @@ func (c *KafkaCommandConsumer) Start(ctx context.Context) error {
 		}
 
 		// Commit the message
-		if err := c.reader.CommitMessages(ctx, msg); err != nil {
-			slog.Error("failed to commit message", "error", err)
+		if err := r.reader.CommitMessages(ctx, msg); err != nil {
+			slog.Error("failed to commit message", "topic", r.topic, "error", err)
 		}
 	}
 }
 
 // processMessage processes a single Kafka message as a KafkaCommand (ADR-026).
 func (c *KafkaCommandConsumer) processMessage(ctx context.Context, msg kafka.Message) error {
+	// 0. Signature check: unsigned or forged commands are dropped without a
+	// response, since nothing in them can be trusted
+	if c.verifier != nil {
+		if err := verifyMessage(c.verifier, msg); err != nil {
+			reason := "invalid"
+			if errors.Is(err, errSignatureMissing) {
+				reason = "missing"
+			}
+			slog.Warn("rejecting command with bad signature",
+				"topic", msg.Topic,
+				"partition", msg.Partition,
+				"offset", msg.Offset,
+				"reason", reason,
+			)
+			metrics.CommandSignatureFailuresTotal.WithLabelValues(reason).Inc()
+			return nil
+		}
+	}
+
 	// 1. Deserialize into KafkaCommand
 	var kCmd KafkaCommand
 	if err := json.Unmarshal(msg.Value, &kCmd); err != nil {
@@ -225,8 +399,31 @@ func (c *KafkaCommandConsumer) processMessage(ctx context.Context, msg kafka.Mes
 		"request_id", kCmd.RequestID,
 		"target", kCmd.Target,
 		"version", kCmd.Version,
+		"topic", msg.Topic,
 	)
 
+	// 3b. Per-topic command scope: e.g. a broadcast topic limited to read-only commands
+	if !c.allows(msg.Topic, kCmd.Command, kCmd.Payload) {
+		slog.Warn("rejecting command not allowed on topic",
+			"command", kCmd.Command,
+			"request_id", kCmd.RequestID,
+			"topic", msg.Topic,
+		)
+		if c.writer != nil && kCmd.RequestID != "" {
+			resp := Response{
+				ID: kCmd.RequestID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeMethodNotFound,
+					Message: fmt.Sprintf("command %q not allowed on topic %q", kCmd.Command, msg.Topic),
+				},
+			}
+			if err := c.writeResponse(ctx, kCmd.Command, resp); err != nil {
+				slog.Error("failed to write kafka response", "request_id", kCmd.RequestID, "error", err)
+			}
+		}
+		return nil
+	}
+
 	// 4. Convert KafkaCommand → internal Command
 	cmd := Command{
 		Method: kCmd.Command,
@@ -234,8 +431,19 @@ func (c *KafkaCommandConsumer) processMessage(ctx context.Context, msg kafka.Mes
 		ID:     kCmd.RequestID,
 	}
 
-	// 5. Handle the command
-	response := c.handler.Handle(ctx, cmd)
+	// 5. Handle the command, publishing progress events first if asked
+	var response Response
+	if kCmd.Progress && c.writer != nil && cmd.ID != "" {
+		progress, wait := asyncProgress(func(p Progress) {
+			if err := c.writeProgress(ctx, kCmd.Command, p); err != nil {
+				slog.Debug("failed to write kafka progress", "request_id", p.ID, "stage", p.Stage, "error", err)
+			}
+		})
+		response = c.handle(ctx, cmd, progress)
+		wait()
+	} else {
+		response = c.handle(ctx, cmd, nil)
+	}
 
 	// 6. Write response back to Kafka if response channel is configured (ADR-029).
 	// We write even when the command failed so the caller learns the failure reason.
@@ -272,9 +480,48 @@ func (c *KafkaCommandConsumer) processMessage(ctx context.Context, msg kafka.Mes
 	return nil
 }
 
+// SetDedupeStore enables replay protection: a mutating command (see
+// methodSpec.dedupe) whose request ID was already handled returns the remembered
+// response instead of re-executing. Call before Start.
+func (c *KafkaCommandConsumer) SetDedupeStore(s *DedupeStore) {
+	c.dedupe = s
+}
+
+// handle runs cmd through the handler, deduplicated by request ID when it
+// mutates state. progress may be nil.
+func (c *KafkaCommandConsumer) handle(ctx context.Context, cmd Command, progress ProgressFunc) Response {
+	if c.dedupe == nil || cmd.ID == "" || !routes[cmd.Method].dedupe {
+		return c.handler.HandleWithProgress(ctx, cmd, progress)
+	}
+
+	// A copy delivered while the first is still executing waits for its
+	// response rather than executing concurrently.
+	resp, ok, err := c.dedupe.Reserve(ctx, cmd.Method, cmd.ID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: fmt.Sprintf("duplicate command still executing: %v", err),
+			},
+		}
+	}
+	if ok {
+		slog.Warn("duplicate command, returning original response", "method", cmd.Method, "id", cmd.ID)
+		metrics.CommandDuplicatesTotal.WithLabelValues(cmd.Method).Inc()
+		return resp
+	}
+
+	resp = c.handler.HandleWithProgress(ctx, cmd, progress)
+	if err := c.dedupe.Put(cmd.Method, cmd.ID, resp); err != nil {
+		slog.Error("failed to remember command response", "method", cmd.Method, "id", cmd.ID, "error", err)
+	}
+	return resp
+}
+
 // writeResponse serialises response as KafkaResponse and publishes it to the response topic.
 func (c *KafkaCommandConsumer) writeResponse(ctx context.Context, command string, resp Response) error {
-	kr := KafkaResponse{
+	return c.publish(ctx, KafkaResponse{
 		Version:   "v1",
 		Source:    c.hostname,
 		Command:   command,
@@ -282,12 +529,68 @@ func (c *KafkaCommandConsumer) writeResponse(ctx context.Context, command string
 		Timestamp: time.Now().UTC(),
 		Result:    resp.Result,
 		Error:     resp.Error,
+	})
+}
+
+// writeProgress publishes a progress event to the response topic.
+func (c *KafkaCommandConsumer) writeProgress(ctx context.Context, command string, p Progress) error {
+	return c.publish(ctx, KafkaResponse{
+		Version:   "v1",
+		Source:    c.hostname,
+		Command:   command,
+		RequestID: p.ID,
+		Timestamp: time.Now().UTC(),
+		Stage:     p.Stage,
+	})
+}
+
+// PublishEvent queues an unsolicited event for the alert topic (or the
+// response topic). It never blocks and returns false if events are disabled
+// or the queue is full.
+func (c *KafkaCommandConsumer) PublishEvent(event string, payload any) bool {
+	if c.evWriter == nil {
+		return false
+	}
+	select {
+	case c.events <- KafkaResponse{
+		Version:   "v1",
+		Source:    c.hostname,
+		Timestamp: time.Now().UTC(),
+		Result:    payload,
+		Event:     event,
+	}:
+		return true
+	default:
+		slog.Warn("kafka event queue full, dropping event", "event", event)
+		return false
 	}
+}
+
+// publishEvents writes queued events until ctx is cancelled.
+func (c *KafkaCommandConsumer) publishEvents(ctx context.Context) {
+	w := c.evWriter
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-c.events:
+			if err := c.publishTo(ctx, w, ev); err != nil {
+				slog.Error("failed to write kafka event", "event", ev.Event, "error", err)
+			}
+		}
+	}
+}
+
+func (c *KafkaCommandConsumer) publish(ctx context.Context, kr KafkaResponse) error {
+	return c.publishTo(ctx, c.writer, kr)
+}
+
+func (c *KafkaCommandConsumer) publishTo(ctx context.Context, w messageWriter, kr KafkaResponse) error {
 	data, err := json.Marshal(kr)
 	if err != nil {
 		return fmt.Errorf("marshal response: %w", err)
 	}
-	return c.writer.WriteMessages(ctx, kafka.Message{
+	return w.WriteMessages(ctx, kafka.Message{
 		Key:   []byte(c.hostname), // consistent partition routing (hostname as key)
 		Value: data,
 	})
@@ -298,6 +601,16 @@ func (c *KafkaCommandConsumer) writeResponse(ctx context.Context, command string
 func (c *KafkaCommandConsumer) Stop() error {
 	var errs []error
 
+	// evWriter stays set: pipelines may still raise events while tasks stop
+	if c.evWriter != nil && c.evWriter != c.writer {
+		c.evClose.Do(func() {
+			slog.Info("closing kafka alert writer")
+			if err := c.evWriter.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close alert writer: %w", err))
+			}
+		})
+	}
+
 	if c.writer != nil {
 		slog.Info("closing kafka response writer")
 		writer := c.writer
@@ -307,12 +620,14 @@ func (c *KafkaCommandConsumer) Stop() error {
 		}
 	}
 
-	if c.reader != nil {
+	if len(c.readers) > 0 {
 		slog.Info("closing kafka command consumer")
-		reader := c.reader
-		c.reader = nil
-		if err := reader.Close(); err != nil {
-			errs = append(errs, fmt.Errorf("close command reader: %w", err))
+		readers := c.readers
+		c.readers = nil
+		for _, r := range readers {
+			if err := r.reader.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close command reader for %s: %w", r.topic, err))
+			}
 		}
 	}
 
@@ -3,6 +3,7 @@ package command
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -61,6 +62,17 @@ func TestNewKafkaCommandConsumer(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "topics only",
+			config: config.CommandChannelConfig{
+				Kafka: config.CommandKafkaConfig{
+					Brokers: []string{"localhost:9092"},
+					GroupID: "otus-group",
+					Topics:  []config.CommandTopicConfig{{Name: "commands-site-a"}},
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "missing group_id",
 			config: config.CommandChannelConfig{
@@ -75,7 +87,7 @@ func TestNewKafkaCommandConsumer(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			consumer, err := NewKafkaCommandConsumer(tt.config, "test-node", handler)
+			consumer, err := NewKafkaCommandConsumer(tt.config, "test-node", handler, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("NewKafkaCommandConsumer() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -83,7 +95,7 @@ func TestNewKafkaCommandConsumer(t *testing.T) {
 			if !tt.wantErr && consumer == nil {
 				t.Error("expected non-nil consumer")
 			}
-			if consumer != nil && consumer.reader != nil {
+			if consumer != nil && len(consumer.readers) > 0 {
 				_ = consumer.Stop()
 			}
 		})
@@ -97,7 +109,7 @@ func TestKafkaCommandConsumer_TTLParsing(t *testing.T) {
 	cc := validCCConfig()
 	cc.CommandTTL = "10m"
 
-	consumer, err := NewKafkaCommandConsumer(cc, "test-node", handler)
+	consumer, err := NewKafkaCommandConsumer(cc, "test-node", handler, nil)
 	if err != nil {
 		t.Fatalf("NewKafkaCommandConsumer() failed: %v", err)
 	}
@@ -115,7 +127,7 @@ func TestKafkaCommandConsumer_InvalidTTL(t *testing.T) {
 	cc := validCCConfig()
 	cc.CommandTTL = "not-a-duration"
 
-	_, err := NewKafkaCommandConsumer(cc, "test-node", handler)
+	_, err := NewKafkaCommandConsumer(cc, "test-node", handler, nil)
 	if err == nil {
 		t.Fatal("expected error for invalid TTL")
 	}
@@ -125,7 +137,7 @@ func TestKafkaCommandConsumer_StartStop(t *testing.T) {
 	tm := task.NewTaskManager("test-agent", nil)
 	handler := NewCommandHandler(tm, nil)
 
-	consumer, err := NewKafkaCommandConsumer(validCCConfig(), "test-node", handler)
+	consumer, err := NewKafkaCommandConsumer(validCCConfig(), "test-node", handler, nil)
 	if err != nil {
 		t.Fatalf("NewKafkaCommandConsumer() failed: %v", err)
 	}
@@ -152,13 +164,55 @@ func TestKafkaCommandConsumer_StartStop(t *testing.T) {
 	}
 }
 
+func TestNewKafkaCommandConsumer_MultipleTopics(t *testing.T) {
+	tm := task.NewTaskManager("test-agent", nil)
+	handler := NewCommandHandler(tm, nil)
+
+	cc := validCCConfig()
+	cc.Kafka.Topics = []config.CommandTopicConfig{
+		{Name: "commands-site-a", GroupID: "otus-site-a"},
+		{Name: "commands-broadcast", Commands: []string{"task_list"}},
+	}
+
+	consumer, err := NewKafkaCommandConsumer(cc, "test-node", handler, nil)
+	if err != nil {
+		t.Fatalf("NewKafkaCommandConsumer() failed: %v", err)
+	}
+	defer consumer.Stop()
+
+	want := []struct{ topic, groupID string }{
+		{"commands", "otus-group"},
+		{"commands-site-a", "otus-site-a"},
+		{"commands-broadcast", "otus-group"},
+	}
+	if len(consumer.readers) != len(want) {
+		t.Fatalf("readers = %d, want %d", len(consumer.readers), len(want))
+	}
+	for i, w := range want {
+		r := consumer.readers[i]
+		if r.topic != w.topic || r.groupID != w.groupID {
+			t.Errorf("readers[%d] = %s/%s, want %s/%s", i, r.topic, r.groupID, w.topic, w.groupID)
+		}
+	}
+
+	if !consumer.allows("commands", "task_create", nil) {
+		t.Error("topic without command list should allow every command")
+	}
+	if !consumer.allows("commands-broadcast", "task_list", nil) {
+		t.Error("task_list should be allowed on commands-broadcast")
+	}
+	if consumer.allows("commands-broadcast", "task_create", nil) {
+		t.Error("task_create should not be allowed on commands-broadcast")
+	}
+}
+
 // ── processMessage unit tests (ADR-026) ──
 
 func newTestConsumer(t *testing.T, hostname string) *KafkaCommandConsumer {
 	t.Helper()
 	tm := task.NewTaskManager("test-agent", nil)
 	handler := NewCommandHandler(tm, nil)
-	consumer, err := NewKafkaCommandConsumer(validCCConfig(), hostname, handler)
+	consumer, err := NewKafkaCommandConsumer(validCCConfig(), hostname, handler, nil)
 	if err != nil {
 		t.Fatalf("NewKafkaCommandConsumer: %v", err)
 	}
@@ -330,7 +384,7 @@ func TestNewKafkaCommandConsumer_WriterCreatedWhenResponseTopicSet(t *testing.T)
 	tm := task.NewTaskManager("test-agent", nil)
 	handler := NewCommandHandler(tm, nil)
 
-	consumer, err := NewKafkaCommandConsumer(ccConfigWithResponseTopic(), "node-01", handler)
+	consumer, err := NewKafkaCommandConsumer(ccConfigWithResponseTopic(), "node-01", handler, nil)
 	if err != nil {
 		t.Fatalf("NewKafkaCommandConsumer: %v", err)
 	}
@@ -345,7 +399,7 @@ func TestNewKafkaCommandConsumer_WriterNilWhenResponseTopicEmpty(t *testing.T) {
 	tm := task.NewTaskManager("test-agent", nil)
 	handler := NewCommandHandler(tm, nil)
 
-	consumer, err := NewKafkaCommandConsumer(validCCConfig(), "node-01", handler)
+	consumer, err := NewKafkaCommandConsumer(validCCConfig(), "node-01", handler, nil)
 	if err != nil {
 		t.Fatalf("NewKafkaCommandConsumer: %v", err)
 	}
@@ -448,6 +502,79 @@ func TestProcessMessage_ResponseWrittenOnSuccess(t *testing.T) {
 	}
 }
 
+func TestProcessMessage_ProgressEvents(t *testing.T) {
+	mw := &mockWriter{}
+	c := newTestConsumerWithMockWriter(t, "node-01", mw)
+
+	payload, _ := json.Marshal(TaskCreateParams{Config: config.TaskConfig{ID: "bad"}}) // fails validation
+	_ = c.processMessage(context.Background(), makeMsg(KafkaCommand{
+		Version:   "v1",
+		Target:    "node-01",
+		Command:   "task_create",
+		Timestamp: time.Now(),
+		RequestID: "req-p",
+		Payload:   payload,
+		Progress:  true,
+	}))
+
+	var stages []string
+	for i, msg := range mw.messages {
+		var kr KafkaResponse
+		if err := json.Unmarshal(msg.Value, &kr); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+		if kr.RequestID != "req-p" || kr.Command != "task_create" {
+			t.Errorf("message %d = %+v", i, kr)
+		}
+		stages = append(stages, kr.Stage)
+		if last := i == len(mw.messages)-1; last != (kr.Error != nil) {
+			t.Errorf("message %d: error = %v, want only on the final response", i, kr.Error)
+		}
+	}
+	if got, want := strings.Join(stages, ","), "accepted,validating,"; got != want {
+		t.Errorf("stages = %q, want %q", got, want)
+	}
+}
+
+func TestProcessMessage_CommandNotAllowedOnTopic(t *testing.T) {
+	mw := &mockWriter{}
+	tm := task.NewTaskManager("test-agent", nil)
+	handler := NewCommandHandler(tm, nil)
+	consumer := &KafkaCommandConsumer{
+		ccConfig: validCCConfig(),
+		hostname: "node-01",
+		readers: []*topicReader{
+			{topic: "commands-broadcast", commands: map[string]bool{"task_list": true}},
+		},
+		writer:  mw,
+		handler: handler,
+		ttl:     5 * time.Minute,
+	}
+
+	msg := makeMsg(KafkaCommand{
+		Version:   "v1",
+		Target:    "*",
+		Command:   "task_delete",
+		Timestamp: time.Now(),
+		RequestID: "req-888",
+	})
+	msg.Topic = "commands-broadcast"
+	if err := consumer.processMessage(context.Background(), msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(mw.messages) != 1 {
+		t.Fatalf("expected 1 response message, got %d", len(mw.messages))
+	}
+
+	var kr KafkaResponse
+	if err := json.Unmarshal(mw.messages[0].Value, &kr); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+	if kr.Error == nil || kr.Error.Code != ErrCodeMethodNotFound {
+		t.Errorf("Error = %+v, want code %d", kr.Error, ErrCodeMethodNotFound)
+	}
+}
+
 func TestStop_ClosesWriter(t *testing.T) {
 	mw := &mockWriter{}
 	tm := task.NewTaskManager("test-agent", nil)
@@ -471,3 +598,41 @@ func TestStop_ClosesWriter(t *testing.T) {
 		t.Error("writer field should be nil after Stop()")
 	}
 }
+
+func TestPublishEvent(t *testing.T) {
+	mw := &mockWriter{}
+	c := newTestConsumerWithMockWriter(t, "node-01", mw)
+	if c.PublishEvent("quality_alert", map[string]any{"call_id": "c1"}) {
+		t.Error("event queued without response_topic or alert_topic")
+	}
+
+	c.evWriter = mw
+	if !c.PublishEvent("quality_alert", map[string]any{"call_id": "c1"}) {
+		t.Fatal("event not queued")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.publishEvents(ctx)
+		close(done)
+	}()
+	// The write is done once publishEvents returns
+	deadline := time.Now().Add(2 * time.Second)
+	for len(c.events) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(mw.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(mw.messages))
+	}
+	var kr KafkaResponse
+	if err := json.Unmarshal(mw.messages[0].Value, &kr); err != nil {
+		t.Fatal(err)
+	}
+	if kr.Event != "quality_alert" || kr.Source != "node-01" || kr.RequestID != "" ||
+		kr.Result.(map[string]any)["call_id"] != "c1" || string(mw.messages[0].Key) != "node-01" {
+		t.Errorf("event = %+v", kr)
+	}
+}
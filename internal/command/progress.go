@@ -0,0 +1,62 @@
+package command
+
+import (
+	"log/slog"
+)
+
+// StageAccepted is the first progress event of every command: the agent has
+// received it and started executing.
+const StageAccepted = "accepted"
+
+// progressBuffer bounds the events queued for a slow transport.
+const progressBuffer = 16
+
+// Progress is an interim event of a command, sent before its response when
+// the caller asks for progress. task_create and task_clone report the stages of
+// task.TaskManager.CreateWithProgress after StageAccepted.
+type Progress struct {
+	ID    string `json:"id"`    // request ID of the command
+	Stage string `json:"stage"` // e.g. "accepted", "validating"
+}
+
+// ProgressFunc receives the progress events of one command.
+type ProgressFunc func(Progress)
+
+// stageFunc adapts p to a per-stage callback for the command id; nil if p is nil.
+func (p ProgressFunc) stageFunc(id string) func(stage string) {
+	if p == nil {
+		return nil
+	}
+	return func(stage string) {
+		p(Progress{ID: id, Stage: stage})
+	}
+}
+
+// asyncProgress returns a ProgressFunc handing events to send on its own
+// goroutine, so a slow transport never blocks the command (task_create
+// reports progress with the task manager locked). Events beyond the buffer
+// are dropped. wait returns once every queued event was sent; call it before
+// sending the response, and do not use fn afterwards.
+func asyncProgress(send func(Progress)) (fn ProgressFunc, wait func()) {
+	events := make(chan Progress, progressBuffer)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for p := range events {
+			send(p)
+		}
+	}()
+
+	fn = func(p Progress) {
+		select {
+		case events <- p:
+		default:
+			slog.Warn("dropping command progress event", "request_id", p.ID, "stage", p.Stage)
+		}
+	}
+	wait = func() {
+		close(events)
+		<-done
+	}
+	return fn, wait
+}
@@ -0,0 +1,159 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// defaultSwapWarmup is the shadow period of a reporter swap without warmup.
+const defaultSwapWarmup = 5 * time.Minute
+
+// TaskReconfigureParams represents parameters for task_reconfigure.
+// Plugins are updated in place first (plugins implementing Reconfigurable),
+// then the fragment rate limit, then the reporter swap, if any, is started.
+type TaskReconfigureParams struct {
+	TaskID            string                          `json:"task_id"`
+	Plugins           map[string]map[string]any       `json:"plugins,omitempty"`             // plugin name → new config
+	FragmentRateLimit *config.FragmentRateLimitConfig `json:"fragment_rate_limit,omitempty"` // replaces decoder.fragment_rate_limit
+	ReporterSwap      *ReporterSwapParams             `json:"reporter_swap,omitempty"`       // blue/green reporter replacement
+}
+
+// ReporterSwapParams replaces reporter Replace with Reporter after Reporter
+// has run in shadow mode for Warmup.
+type ReporterSwapParams struct {
+	Replace  string                `json:"replace"`
+	Reporter config.ReporterConfig `json:"reporter"`
+	Warmup   string                `json:"warmup"` // Go duration, default 5m
+}
+
+// handleTaskReconfigure handles task_reconfigure command.
+func (h *CommandHandler) handleTaskReconfigure(_ context.Context, cmd Command) Response {
+	var params TaskReconfigureParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+	if len(params.Plugins) == 0 && params.FragmentRateLimit == nil && params.ReporterSwap == nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "plugins, fragment_rate_limit or reporter_swap is required",
+			},
+		}
+	}
+	if frl := params.FragmentRateLimit; frl != nil {
+		if err := frl.Validate(); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: fmt.Sprintf("fragment_rate_limit: %v", err),
+				},
+			}
+		}
+	}
+
+	warmup := defaultSwapWarmup
+	if swap := params.ReporterSwap; swap != nil {
+		if swap.Replace == "" {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: "reporter_swap.replace is required",
+				},
+			}
+		}
+		if swap.Warmup != "" {
+			d, err := time.ParseDuration(swap.Warmup)
+			if err != nil || d <= 0 {
+				return Response{
+					ID: cmd.ID,
+					Error: &ErrorInfo{
+						Code:    ErrCodeInvalidParams,
+						Message: fmt.Sprintf("reporter_swap.warmup must be a positive duration, got %q", swap.Warmup),
+					},
+				}
+			}
+			warmup = d
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	if len(params.Plugins) > 0 {
+		if err := t.Reconfigure(params.Plugins); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:     ErrCodeInternalError,
+					Message:  fmt.Sprintf("reconfigure task failed: %v", err),
+					Category: errorCategory(err),
+				},
+			}
+		}
+	}
+
+	result := map[string]interface{}{
+		"task_id": params.TaskID,
+		"status":  "reconfigured",
+	}
+	if frl := params.FragmentRateLimit; frl != nil {
+		if err := t.SetFragmentRateLimit(*frl); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:     ErrCodeInternalError,
+					Message:  fmt.Sprintf("reconfigure task failed: %v", err),
+					Category: errorCategory(err),
+				},
+			}
+		}
+		if l := t.Decoder.FragmentRateLimiter(); l != nil {
+			result["fragment_rate_limit"] = l.Stats()
+		}
+	}
+	if swap := params.ReporterSwap; swap != nil {
+		if err := h.taskManager.SwapReporter(params.TaskID, swap.Replace, swap.Reporter, warmup); err != nil {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:     ErrCodeInternalError,
+					Message:  fmt.Sprintf("reporter swap failed: %v", err),
+					Category: errorCategory(err),
+				},
+			}
+		}
+		result["reporter_swap"] = t.GetStatus().ReporterSwap
+	}
+
+	return Response{ID: cmd.ID, Result: result}
+}
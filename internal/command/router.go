@@ -0,0 +1,113 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// route handles one method. progress may be nil.
+type route func(h *CommandHandler, ctx context.Context, cmd Command, progress ProgressFunc) Response
+
+// methodSpec is a routes entry: a handler and the per-method policies of the
+// channels and of batch.
+type methodSpec struct {
+	handle route
+
+	// dedupe marks methods that change state, so that executing them twice
+	// differs from executing them once: Kafka deduplicates them by request ID
+	// (see DedupeStore). Read-only methods are simply re-executed; their
+	// responses are not worth persisting.
+	dedupe bool
+
+	// batch marks methods allowed inside a batch. daemon_shutdown and nested
+	// batches are excluded.
+	batch bool
+}
+
+// routes maps every method to its handler and policies. It is the only method
+// registry: the UDS and Kafka channels hand every command to CommandHandler,
+// which dispatches through this table, so a method added here is reachable on
+// all channels alike (router_test.go checks that they stay in step). There is
+// no HTTP or gRPC command channel; one added later must dispatch through
+// CommandHandler too.
+//
+// Filled in init: handleBatch dispatches through the table itself.
+var routes map[string]methodSpec
+
+func init() {
+	routes = map[string]methodSpec{
+		"task_create":      {handle: (*CommandHandler).handleTaskCreate, dedupe: true, batch: true},
+		"task_delete":      {handle: withoutProgress((*CommandHandler).handleTaskDelete), dedupe: true, batch: true},
+		"task_list":        {handle: withoutProgress((*CommandHandler).handleTaskList), batch: true},
+		"task_status":      {handle: withoutProgress((*CommandHandler).handleTaskStatus), batch: true},
+		"task_pause":       {handle: withoutProgress((*CommandHandler).handleTaskPause), dedupe: true, batch: true},
+		"task_resume":      {handle: withoutProgress((*CommandHandler).handleTaskResume), dedupe: true, batch: true},
+		"task_drain":       {handle: withoutProgress((*CommandHandler).handleTaskDrain), dedupe: true},
+		"task_reconfigure": {handle: withoutProgress((*CommandHandler).handleTaskReconfigure), dedupe: true},
+		"task_topk":        {handle: withoutProgress((*CommandHandler).handleTaskTopK)},
+		"task_fragments":   {handle: withoutProgress((*CommandHandler).handleTaskFragments)},
+		"task_export":      {handle: withoutProgress((*CommandHandler).handleTaskExport), batch: true},
+		"task_clone":       {handle: (*CommandHandler).handleTaskClone, dedupe: true},
+		"config_reload":    {handle: withoutProgress((*CommandHandler).handleConfigReload), dedupe: true, batch: true},
+		"config_get":       {handle: withoutProgress((*CommandHandler).handleConfigGet), batch: true},
+		"daemon_shutdown":  {handle: withoutProgress((*CommandHandler).handleDaemonShutdown), dedupe: true},
+		"daemon_status":    {handle: withoutProgress((*CommandHandler).handleDaemonStatus), batch: true},
+		"daemon_stats":     {handle: withoutProgress((*CommandHandler).handleDaemonStats), batch: true},
+		"calls_list":       {handle: withoutProgress((*CommandHandler).handleCallsList), batch: true},
+		"calls_get":        {handle: withoutProgress((*CommandHandler).handleCallsGet), batch: true},
+		"flag_set":         {handle: withoutProgress((*CommandHandler).handleFlagSet), dedupe: true},
+		"batch":            {handle: withoutProgress((*CommandHandler).handleBatch), dedupe: true},
+	}
+}
+
+// withoutProgress adapts a handler that reports no progress stages.
+func withoutProgress(fn func(*CommandHandler, context.Context, Command) Response) route {
+	return func(h *CommandHandler, ctx context.Context, cmd Command, _ ProgressFunc) Response {
+		return fn(h, ctx, cmd)
+	}
+}
+
+// Methods returns the names of all methods, sorted.
+func Methods() []string {
+	methods := make([]string, 0, len(routes))
+	for method := range routes {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// IsMethod reports whether method is a known method.
+func IsMethod(method string) bool {
+	_, ok := routes[method]
+	return ok
+}
+
+// methodNotFound is the response to an unknown method, on every channel.
+func methodNotFound(cmd Command) Response {
+	return Response{
+		ID: cmd.ID,
+		Error: &ErrorInfo{
+			Code:    ErrCodeMethodNotFound,
+			Message: fmt.Sprintf("method %q not found", cmd.Method),
+		},
+	}
+}
+
+// requestID converts a JSON-RPC request ID (string, number or null) to a
+// Command ID. A missing ID becomes "", like a Kafka command without
+// request_id, so the command is not deduplicated.
+func requestID(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
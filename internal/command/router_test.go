@@ -0,0 +1,195 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/task"
+)
+
+// TestRoutesCoverHandlers fails when a method handler is written but not
+// added to routes, which would leave it unreachable on every channel.
+func TestRoutesCoverHandlers(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	handlers := make(map[string]bool) // handle* methods taking (ctx, cmd, ...)
+	routed := make(map[string]bool)   // handle* methods referenced by router.go
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil || !strings.HasPrefix(fn.Name.Name, "handle") {
+				continue
+			}
+			if star, ok := fn.Recv.List[0].Type.(*ast.StarExpr); !ok || star.X.(*ast.Ident).Name != "CommandHandler" {
+				continue
+			}
+			if params := fn.Type.Params.List; len(params) > 0 {
+				if sel, ok := params[0].Type.(*ast.SelectorExpr); ok && sel.Sel.Name == "Context" {
+					handlers[fn.Name.Name] = true
+				}
+			}
+		}
+		if name == "router.go" {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok && strings.HasPrefix(sel.Sel.Name, "handle") {
+					routed[sel.Sel.Name] = true
+				}
+				return true
+			})
+		}
+	}
+
+	if len(handlers) == 0 {
+		t.Fatal("no handlers found")
+	}
+	for name := range handlers {
+		if !routed[name] {
+			t.Errorf("%s is not in routes", name)
+		}
+	}
+	if len(routed) != len(Methods()) {
+		t.Errorf("routes reference %d handlers for %d methods", len(routed), len(Methods()))
+	}
+}
+
+// TestRoutePolicies checks the per-method policies that cannot be derived:
+// batches nest no batch and cannot shut the daemon down, and the methods
+// batch can undo change state, so Kafka must not execute a replay of them.
+func TestRoutePolicies(t *testing.T) {
+	for _, method := range []string{"batch", "daemon_shutdown"} {
+		if routes[method].batch {
+			t.Errorf("%s allowed in batch", method)
+		}
+	}
+	for _, method := range []string{"task_create", "task_delete", "task_pause", "task_resume", "batch", "daemon_shutdown"} {
+		if !routes[method].dedupe {
+			t.Errorf("%s changes state but is not deduplicated", method)
+		}
+	}
+	for _, method := range []string{"task_list", "task_status", "calls_list", "config_get"} {
+		if routes[method].dedupe {
+			t.Errorf("%s is read-only but deduplicated", method)
+		}
+	}
+}
+
+// TestChannelParity sends every method over UDS and Kafka and checks both
+// channels reach the same handler: neither answers "method not found", and
+// both answer with the same error code.
+func TestChannelParity(t *testing.T) {
+	handler := NewCommandHandler(task.NewTaskManager("test-agent", nil), nil)
+
+	socketPath := filepath.Join(t.TempDir(), "otus.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := NewUDSServer(socketPath, handler)
+	go server.Start(ctx)
+	defer server.Stop()
+	client := NewUDSClient(socketPath, 5*time.Second)
+
+	mw := &mockWriter{}
+	consumer := newTestConsumerWithMockWriter(t, "node-01", mw)
+	consumer.handler = handler
+
+	params := json.RawMessage(`{}`)
+	call := func(method string) (uds, kafka *ErrorInfo) {
+		var resp *Response
+		var err error
+		for i := 0; i < 50; i++ { // until the server listens
+			if resp, err = client.Call(ctx, method, params); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("uds %s: %v", method, err)
+		}
+
+		mw.messages = nil
+		_ = consumer.processMessage(ctx, makeMsg(KafkaCommand{
+			Version:   "v1",
+			Target:    "node-01",
+			Command:   method,
+			Timestamp: time.Now(),
+			RequestID: "req-" + method,
+			Payload:   params,
+		}))
+		if len(mw.messages) != 1 {
+			t.Fatalf("kafka %s: %d responses, want 1", method, len(mw.messages))
+		}
+		var kr KafkaResponse
+		if err := json.Unmarshal(mw.messages[0].Value, &kr); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Error, kr.Error
+	}
+
+	code := func(e *ErrorInfo) int {
+		if e == nil {
+			return 0
+		}
+		return e.Code
+	}
+	for _, method := range Methods() {
+		uds, kafka := call(method)
+		if code(uds) == ErrCodeMethodNotFound || code(kafka) == ErrCodeMethodNotFound {
+			t.Errorf("%s: not found (uds %v, kafka %v)", method, uds, kafka)
+			continue
+		}
+		if code(uds) != code(kafka) {
+			t.Errorf("%s: uds error %v, kafka error %v", method, uds, kafka)
+		}
+	}
+
+	uds, kafka := call("no_such_method")
+	if code(uds) != ErrCodeMethodNotFound || code(kafka) != ErrCodeMethodNotFound {
+		t.Errorf("unknown method: uds %v, kafka %v; want method not found on both", uds, kafka)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var numeric interface{}
+	if err := json.Unmarshal([]byte(`1000000`), &numeric); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		id   interface{}
+		want string
+	}{
+		{nil, ""},
+		{"req-1", "req-1"},
+		{numeric, "1000000"},
+	} {
+		if got := requestID(tt.id); got != tt.want {
+			t.Errorf("requestID(%v) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewKafkaCommandConsumer_UnknownTopicCommand(t *testing.T) {
+	cc := validCCConfig()
+	cc.Kafka.Topics = []config.CommandTopicConfig{{Name: "commands-broadcast", Commands: []string{"task_list", "tasks_list"}}}
+	handler := NewCommandHandler(task.NewTaskManager("test-agent", nil), nil)
+	if c, err := NewKafkaCommandConsumer(cc, "node-01", handler, nil); err == nil {
+		c.Stop()
+		t.Error("topic with an unknown command accepted")
+	}
+}
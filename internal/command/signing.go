@@ -0,0 +1,138 @@
+package command
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// SignatureHeader is the Kafka message header carrying the base64 encoded
+// signature of the message value.
+const SignatureHeader = "otus-signature"
+
+// Signing algorithms (command_channel.signing.algorithm).
+const (
+	SigningHMACSHA256 = "hmac-sha256"
+	SigningEd25519    = "ed25519"
+)
+
+var (
+	errSignatureMissing = errors.New("signature missing")
+	errSignatureInvalid = errors.New("signature invalid")
+)
+
+// Verifier checks the signature of a raw command message.
+type Verifier interface {
+	Verify(data, signature []byte) error
+}
+
+// NewVerifier creates the verifier configured by cfg.
+// Returns nil when signing is disabled.
+func NewVerifier(cfg config.CommandSigningConfig) (Verifier, error) {
+	if cfg.Algorithm == "" {
+		return nil, nil
+	}
+
+	key := []byte(cfg.Key)
+	if cfg.KeyFile != "" {
+		data, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read signing key file: %w", err)
+		}
+		key = []byte(strings.TrimSpace(string(data)))
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("signing key is empty")
+	}
+
+	switch cfg.Algorithm {
+	case SigningHMACSHA256:
+		return hmacVerifier{secret: key}, nil
+	case SigningEd25519:
+		pub, err := parseEd25519PublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519Verifier{key: pub}, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+}
+
+// hmacVerifier verifies HMAC-SHA256 signatures with a shared secret.
+type hmacVerifier struct {
+	secret []byte
+}
+
+func (v hmacVerifier) Verify(data, signature []byte) error {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(data)
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return errSignatureInvalid
+	}
+	return nil
+}
+
+// ed25519Verifier verifies Ed25519 signatures. Agents only hold the public
+// key, so a leaked agent config cannot be used to sign commands.
+type ed25519Verifier struct {
+	key ed25519.PublicKey
+}
+
+func (v ed25519Verifier) Verify(data, signature []byte) error {
+	if !ed25519.Verify(v.key, data, signature) {
+		return errSignatureInvalid
+	}
+	return nil
+}
+
+// parseEd25519PublicKey accepts a PEM encoded PKIX public key or the base64
+// encoded 32-byte raw key.
+func parseEd25519PublicKey(key []byte) (ed25519.PublicKey, error) {
+	if block, _ := pem.Decode(key); block != nil {
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse ed25519 public key: %w", err)
+		}
+		pub, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key is %T, not ed25519", parsed)
+		}
+		return pub, nil
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(string(key))
+	if err != nil {
+		return nil, fmt.Errorf("decode ed25519 public key: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// verifyMessage checks the signature header of a command message.
+func verifyMessage(v Verifier, msg kafka.Message) error {
+	for _, h := range msg.Headers {
+		if h.Key != SignatureHeader {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(string(h.Value))
+		if err != nil {
+			return errSignatureInvalid
+		}
+		return v.Verify(msg.Value, sig)
+	}
+	return errSignatureMissing
+}
@@ -0,0 +1,143 @@
+package command
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+func signHMAC(secret, data []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func withSignature(msg kafka.Message, sig []byte) kafka.Message {
+	msg.Headers = append(msg.Headers, kafka.Header{
+		Key:   SignatureHeader,
+		Value: []byte(base64.StdEncoding.EncodeToString(sig)),
+	})
+	return msg
+}
+
+func TestVerifyMessage_HMAC(t *testing.T) {
+	v, err := NewVerifier(config.CommandSigningConfig{Algorithm: SigningHMACSHA256, Key: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	msg := kafka.Message{Value: []byte(`{"command":"task_list"}`)}
+
+	if err := verifyMessage(v, withSignature(msg, signHMAC([]byte("s3cret"), msg.Value))); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := verifyMessage(v, withSignature(msg, signHMAC([]byte("other"), msg.Value))); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("wrong key: err = %v, want invalid", err)
+	}
+	if err := verifyMessage(v, msg); !errors.Is(err, errSignatureMissing) {
+		t.Errorf("unsigned: err = %v, want missing", err)
+	}
+
+	tampered := withSignature(msg, signHMAC([]byte("s3cret"), msg.Value))
+	tampered.Value = []byte(`{"command":"task_delete"}`)
+	if err := verifyMessage(v, tampered); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("tampered value: err = %v, want invalid", err)
+	}
+}
+
+func TestVerifyMessage_Ed25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := kafka.Message{Value: []byte(`{"command":"task_create"}`)}
+	signed := withSignature(msg, ed25519.Sign(priv, msg.Value))
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "command.pub")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := map[string]config.CommandSigningConfig{
+		"raw key":  {Algorithm: SigningEd25519, Key: base64.StdEncoding.EncodeToString(pub)},
+		"PEM file": {Algorithm: SigningEd25519, KeyFile: keyFile},
+	}
+	for name, cfg := range configs {
+		t.Run(name, func(t *testing.T) {
+			v, err := NewVerifier(cfg)
+			if err != nil {
+				t.Fatalf("NewVerifier: %v", err)
+			}
+			if err := verifyMessage(v, signed); err != nil {
+				t.Errorf("valid signature rejected: %v", err)
+			}
+			if err := verifyMessage(v, withSignature(msg, make([]byte, ed25519.SignatureSize))); !errors.Is(err, errSignatureInvalid) {
+				t.Errorf("bad signature: err = %v, want invalid", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifier_Errors(t *testing.T) {
+	if v, err := NewVerifier(config.CommandSigningConfig{}); v != nil || err != nil {
+		t.Errorf("disabled signing = %v, %v; want nil, nil", v, err)
+	}
+
+	bad := []config.CommandSigningConfig{
+		{Algorithm: "rsa", Key: "k"},
+		{Algorithm: SigningEd25519, Key: "not-base64!"},
+		{Algorithm: SigningEd25519, Key: base64.StdEncoding.EncodeToString([]byte("short"))},
+		{Algorithm: SigningHMACSHA256, KeyFile: filepath.Join(t.TempDir(), "missing")},
+	}
+	for _, cfg := range bad {
+		if _, err := NewVerifier(cfg); err == nil {
+			t.Errorf("NewVerifier(%+v) succeeded, want error", cfg)
+		}
+	}
+}
+
+func TestProcessMessage_SignatureRequired(t *testing.T) {
+	mw := &mockWriter{}
+	c := newTestConsumerWithMockWriter(t, "node-01", mw)
+	c.verifier = hmacVerifier{secret: []byte("s3cret")}
+
+	msg := makeMsg(KafkaCommand{
+		Version:   "v1",
+		Target:    "node-01",
+		Command:   "task_list",
+		Timestamp: time.Now(),
+		RequestID: "req-signed",
+	})
+
+	// Unsigned: dropped without executing or responding.
+	if err := c.processMessage(context.Background(), msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(mw.messages) != 0 {
+		t.Fatalf("unsigned command produced %d responses, want 0", len(mw.messages))
+	}
+
+	if err := c.processMessage(context.Background(), withSignature(msg, signHMAC([]byte("s3cret"), msg.Value))); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(mw.messages) != 1 {
+		t.Errorf("signed command produced %d responses, want 1", len(mw.messages))
+	}
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"firestige.xyz/otus/internal/topk"
+)
+
+// TaskTopKParams represents parameters for task_topk.
+type TaskTopKParams struct {
+	TaskID string `json:"task_id"`
+	Key    string `json:"key,omitempty"`   // one of top_k.keys; empty = all keys
+	Limit  int    `json:"limit,omitempty"` // items per key (0 = top_k.k)
+	Reset  bool   `json:"reset,omitempty"` // restart counting after this snapshot
+}
+
+// handleTaskTopK handles task_topk command.
+func (h *CommandHandler) handleTaskTopK(_ context.Context, cmd Command) Response {
+	var params TaskTopKParams
+	if err := json.Unmarshal(cmd.Params, &params); err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("invalid params: %v", err),
+			},
+		}
+	}
+	if params.TaskID == "" {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: "task_id is required",
+			},
+		}
+	}
+
+	t, err := h.taskManager.Get(params.TaskID)
+	if err != nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInternalError,
+				Message: err.Error(),
+			},
+		}
+	}
+	if t.TopK == nil {
+		return Response{
+			ID: cmd.ID,
+			Error: &ErrorInfo{
+				Code:    ErrCodeInvalidParams,
+				Message: fmt.Sprintf("task %q tracks no heavy hitters (top_k.keys is empty)", params.TaskID),
+			},
+		}
+	}
+
+	summary := t.TopK.Snapshot(params.Reset)
+	if params.Key != "" {
+		items, ok := summary.Keys[params.Key]
+		if !ok {
+			return Response{
+				ID: cmd.ID,
+				Error: &ErrorInfo{
+					Code:    ErrCodeInvalidParams,
+					Message: fmt.Sprintf("key %q is not tracked (top_k.keys: %v)", params.Key, t.TopK.Keys()),
+				},
+			}
+		}
+		summary.Keys = map[string][]topk.Item{params.Key: items}
+	}
+	if params.Limit > 0 {
+		for key, items := range summary.Keys {
+			if len(items) > params.Limit {
+				summary.Keys[key] = items[:params.Limit]
+			}
+		}
+	}
+
+	return Response{
+		ID: cmd.ID,
+		Result: map[string]interface{}{
+			"task_id": params.TaskID,
+			"since":   summary.Since,
+			"packets": summary.Packets,
+			"keys":    summary.Keys,
+		},
+	}
+}
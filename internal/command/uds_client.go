@@ -29,6 +29,12 @@ func NewUDSClient(socketPath string, timeout time.Duration) *UDSClient {
 
 // Call sends a command and waits for response.
 func (c *UDSClient) Call(ctx context.Context, method string, params interface{}) (*Response, error) {
+	return c.CallWithProgress(ctx, method, params, nil)
+}
+
+// CallWithProgress is Call asking for progress events, which are passed to
+// progress as they arrive. A nil progress asks for none.
+func (c *UDSClient) CallWithProgress(ctx context.Context, method string, params interface{}, progress func(Progress)) (*Response, error) {
 	// Create connection with timeout
 	conn, err := net.DialTimeout("unix", c.socketPath, c.timeout)
 	if err != nil {
@@ -56,10 +62,11 @@ func (c *UDSClient) Call(ctx context.Context, method string, params interface{})
 	// Create JSON-RPC request
 	reqID := fmt.Sprintf("req-%d", time.Now().UnixNano()) // Use string ID
 	req := JSONRPCRequest{
-		JSONRPC: "2.0",
-		Method:  method,
-		Params:  paramsJSON,
-		ID:      reqID,
+		JSONRPC:  "2.0",
+		Method:   method,
+		Params:   paramsJSON,
+		ID:       reqID,
+		Progress: progress != nil,
 	}
 
 	// Send request
@@ -68,19 +75,30 @@ func (c *UDSClient) Call(ctx context.Context, method string, params interface{})
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	// Read response
+	// Read response, after any progress notifications
 	scanner := bufio.NewScanner(conn)
-	if !scanner.Scan() {
-		if err := scanner.Err(); err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
+	var jsonrpcResp JSONRPCResponse
+	for {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return nil, fmt.Errorf("failed to read response: %w", err)
+			}
+			return nil, fmt.Errorf("connection closed without response")
 		}
-		return nil, fmt.Errorf("connection closed without response")
-	}
 
-	// Parse JSON-RPC response
-	var jsonrpcResp JSONRPCResponse
-	if err := json.Unmarshal(scanner.Bytes(), &jsonrpcResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		var note JSONRPCNotification
+		if err := json.Unmarshal(scanner.Bytes(), &note); err == nil && note.Method == "progress" {
+			if progress != nil {
+				progress(note.Params)
+			}
+			continue
+		}
+
+		// Parse JSON-RPC response
+		if err := json.Unmarshal(scanner.Bytes(), &jsonrpcResp); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+		break
 	}
 
 	// Verify response ID matches (convert both to string for comparison)
@@ -114,6 +132,22 @@ func (c *UDSClient) TaskList(ctx context.Context) (*Response, error) {
 	return c.Call(ctx, "task_list", nil)
 }
 
+// TaskPause is a convenience method for task_pause command.
+func (c *UDSClient) TaskPause(ctx context.Context, params TaskSelectorParams) (*Response, error) {
+	return c.Call(ctx, "task_pause", params)
+}
+
+// TaskResume is a convenience method for task_resume command.
+func (c *UDSClient) TaskResume(ctx context.Context, params TaskSelectorParams) (*Response, error) {
+	return c.Call(ctx, "task_resume", params)
+}
+
+// TaskDrain is a convenience method for task_drain command. The call blocks
+// until the drain completes; size the client timeout accordingly.
+func (c *UDSClient) TaskDrain(ctx context.Context, params TaskDrainParams) (*Response, error) {
+	return c.Call(ctx, "task_drain", params)
+}
+
 // TaskStatus is a convenience method for task_status command.
 func (c *UDSClient) TaskStatus(ctx context.Context, taskID string) (*Response, error) {
 	params := TaskStatusParams{}
@@ -123,11 +157,26 @@ func (c *UDSClient) TaskStatus(ctx context.Context, taskID string) (*Response, e
 	return c.Call(ctx, "task_status", params)
 }
 
+// TaskExport is a convenience method for task_export command.
+func (c *UDSClient) TaskExport(ctx context.Context, params TaskExportParams) (*Response, error) {
+	return c.Call(ctx, "task_export", params)
+}
+
+// TaskClone is a convenience method for task_clone command.
+func (c *UDSClient) TaskClone(ctx context.Context, params TaskCloneParams) (*Response, error) {
+	return c.Call(ctx, "task_clone", params)
+}
+
 // ConfigReload is a convenience method for config_reload command.
 func (c *UDSClient) ConfigReload(ctx context.Context) (*Response, error) {
 	return c.Call(ctx, "config_reload", nil)
 }
 
+// ConfigGet is a convenience method for config_get command.
+func (c *UDSClient) ConfigGet(ctx context.Context) (*Response, error) {
+	return c.Call(ctx, "config_get", nil)
+}
+
 // DaemonShutdown is a convenience method for daemon_shutdown command.
 func (c *UDSClient) DaemonShutdown(ctx context.Context) (*Response, error) {
 	return c.Call(ctx, "daemon_shutdown", nil)
@@ -143,6 +192,16 @@ func (c *UDSClient) DaemonStats(ctx context.Context) (*Response, error) {
 	return c.Call(ctx, "daemon_stats", nil)
 }
 
+// CallsList is a convenience method for calls_list command.
+func (c *UDSClient) CallsList(ctx context.Context, taskID string, limit int) (*Response, error) {
+	return c.Call(ctx, "calls_list", CallsParams{TaskID: taskID, Limit: limit})
+}
+
+// CallsGet is a convenience method for calls_get command.
+func (c *UDSClient) CallsGet(ctx context.Context, taskID, callID string) (*Response, error) {
+	return c.Call(ctx, "calls_get", CallsParams{TaskID: taskID, CallID: callID})
+}
+
 // Ping sends a simple ping command to check if daemon is alive.
 // This is a convenience wrapper around task.list.
 func (c *UDSClient) Ping(ctx context.Context) error {
@@ -24,6 +24,16 @@ type UDSServer struct {
 	stopped bool
 }
 
+// localKey marks the context of commands received over the socket, which
+// only users with access to it on the host can send.
+type localKey struct{}
+
+// isLocal reports whether ctx belongs to a command received over the socket.
+func isLocal(ctx context.Context) bool {
+	local, _ := ctx.Value(localKey{}).(bool)
+	return local
+}
+
 // NewUDSServer creates a new UDS server.
 func NewUDSServer(socketPath string, handler *CommandHandler) *UDSServer {
 	return &UDSServer{
@@ -36,17 +46,28 @@ func NewUDSServer(socketPath string, handler *CommandHandler) *UDSServer {
 // Start starts the UDS server.
 // Blocks until context is cancelled or an error occurs.
 func (s *UDSServer) Start(ctx context.Context) error {
+	// Hold mu while binding so a concurrent Stop() either sees the listener
+	// or prevents it from being created at all.
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return nil
+	}
+
 	// Remove existing socket file if it exists
 	if err := os.RemoveAll(s.socketPath); err != nil {
+		s.mu.Unlock()
 		return fmt.Errorf("failed to remove existing socket: %w", err)
 	}
 
 	// Create Unix listener
 	listener, err := net.Listen("unix", s.socketPath)
 	if err != nil {
+		s.mu.Unlock()
 		return fmt.Errorf("failed to listen on socket %s: %w", s.socketPath, err)
 	}
 	s.listener = listener
+	s.mu.Unlock()
 
 	// Set socket permissions (0600 - owner only)
 	if err := os.Chmod(s.socketPath, 0600); err != nil {
@@ -110,6 +131,7 @@ func (s *UDSServer) handleConnection(ctx context.Context, conn net.Conn) {
 	}()
 
 	slog.Debug("uds connection established", "remote", conn.RemoteAddr())
+	ctx = context.WithValue(ctx, localKey{}, true)
 
 	scanner := bufio.NewScanner(conn)
 	encoder := json.NewEncoder(conn)
@@ -138,11 +160,22 @@ func (s *UDSServer) handleConnection(ctx context.Context, conn net.Conn) {
 		cmd := Command{
 			Method: req.Method,
 			Params: req.Params,
-			ID:     fmt.Sprintf("%v", req.ID), // Convert to string
+			ID:     requestID(req.ID),
 		}
 
-		// Handle command
-		resp := s.handler.Handle(ctx, cmd)
+		// Handle command; progress notifications precede the response
+		var resp Response
+		if req.Progress {
+			progress, wait := asyncProgress(func(p Progress) {
+				if err := encoder.Encode(JSONRPCNotification{JSONRPC: "2.0", Method: "progress", Params: p}); err != nil {
+					slog.Debug("failed to send progress", "error", err)
+				}
+			})
+			resp = s.handler.HandleWithProgress(ctx, cmd, progress)
+			wait()
+		} else {
+			resp = s.handler.Handle(ctx, cmd)
+		}
 
 		// Convert to JSON-RPC response
 		jsonrpcResp := JSONRPCResponse{
@@ -174,11 +207,12 @@ func (s *UDSServer) Stop() error {
 		return nil
 	}
 	s.stopped = true
+	listener := s.listener
 	s.mu.Unlock()
 
 	// Close listener
-	if s.listener != nil {
-		s.listener.Close()
+	if listener != nil {
+		listener.Close()
 	}
 
 	// Close all active connections
@@ -198,12 +232,22 @@ func (s *UDSServer) Stop() error {
 	return nil
 }
 
-// JSONRPCRequest represents a JSON-RPC 2.0 request.
+// JSONRPCRequest represents a JSON-RPC 2.0 request. Progress is an
+// extension: the server sends "progress" notifications before the response.
 type JSONRPCRequest struct {
-	JSONRPC string          `json:"jsonrpc"`
-	Method  string          `json:"method"`
-	Params  json.RawMessage `json:"params,omitempty"`
-	ID      interface{}     `json:"id"`
+	JSONRPC  string          `json:"jsonrpc"`
+	Method   string          `json:"method"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	ID       interface{}     `json:"id"`
+	Progress bool            `json:"progress,omitempty"`
+}
+
+// JSONRPCNotification represents a JSON-RPC 2.0 notification (no ID), used
+// for progress events; Params.ID names the request.
+type JSONRPCNotification struct {
+	JSONRPC string   `json:"jsonrpc"`
+	Method  string   `json:"method"`
+	Params  Progress `json:"params"`
 }
 
 // JSONRPCResponse represents a JSON-RPC 2.0 response.
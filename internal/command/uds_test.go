@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/task"
 )
 
@@ -112,6 +113,30 @@ func TestUDSServerClient_Integration(t *testing.T) {
 	}
 }
 
+func TestUDSClient_CallWithProgress(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	server := NewUDSServer(socketPath, NewCommandHandler(task.NewTaskManager("test-agent", nil), nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Start(ctx)
+	time.Sleep(100 * time.Millisecond)
+
+	client := NewUDSClient(socketPath, 5*time.Second)
+	var events []Progress
+	resp, err := client.CallWithProgress(context.Background(), "task_create",
+		TaskCreateParams{Config: config.TaskConfig{ID: "bad"}}, // fails validation
+		func(p Progress) { events = append(events, p) })
+	if err != nil {
+		t.Fatalf("CallWithProgress() error: %v", err)
+	}
+	if resp.Error == nil {
+		t.Error("expected task_create error")
+	}
+	if len(events) != 2 || events[0].Stage != StageAccepted || events[1].Stage != task.StageValidating || events[0].ID != resp.ID {
+		t.Errorf("progress = %+v, want accepted and validating for %s", events, resp.ID)
+	}
+}
+
 func TestUDSClient_ConnectionError(t *testing.T) {
 	// Try to connect to non-existent socket
 	client := NewUDSClient("/tmp/non-existent-socket.sock", 1*time.Second)
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AutostartTasks parses otus.autostart into task configs, in the declared
+// order. Each entry is a complete task config with the same keys as the JSON
+// form of task_create.
+func (cfg *GlobalConfig) AutostartTasks() ([]*TaskConfig, error) {
+	tasks := make([]*TaskConfig, 0, len(cfg.Autostart))
+	seen := make(map[string]bool, len(cfg.Autostart))
+	for i, entry := range cfg.Autostart {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return nil, fmt.Errorf("autostart[%d]: %w", i, err)
+		}
+		tc, err := ParseTaskConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("autostart[%d]: %w", i, err)
+		}
+		if seen[tc.ID] {
+			return nil, fmt.Errorf("autostart[%d]: duplicate task ID %q", i, tc.ID)
+		}
+		seen[tc.ID] = true
+		tasks = append(tasks, tc)
+	}
+	return tasks, nil
+}
+
+// validateAutostart checks that every autostart entry is a valid task config
+// and that they fit within max_tasks.
+func validateAutostart(cfg *GlobalConfig) error {
+	tasks, err := cfg.AutostartTasks()
+	if err != nil {
+		return err
+	}
+	if cfg.MaxTasks > 0 && len(tasks) > cfg.MaxTasks {
+		return fmt.Errorf("autostart declares %d tasks, more than max_tasks (%d)", len(tasks), cfg.MaxTasks)
+	}
+	return nil
+}
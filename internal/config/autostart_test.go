@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadAutostart(t *testing.T) {
+	cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  max_tasks: 2
+  autostart:
+    - id: sip-eth0
+      capture: {name: afpacket, interface: eth0}
+      parsers: [{name: sip, config: {ports: [5060]}}]
+      reporters: [{name: console}]
+    - id: sip-eth1
+      capture: {name: afpacket, interface: eth1}
+      parsers: [{name: sip}]
+      reporters: [{name: console}]
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	tasks, err := cfg.AutostartTasks()
+	if err != nil {
+		t.Fatalf("AutostartTasks: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID != "sip-eth0" || tasks[1].Capture.Interface != "eth1" {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+	if tasks[0].Capture.DispatchMode != "binding" {
+		t.Errorf("dispatch mode = %q, want defaults applied", tasks[0].Capture.DispatchMode)
+	}
+
+	for name, tc := range map[string]struct{ yaml, want string }{
+		"invalid task": {`
+  autostart:
+    - id: no-capture
+`, "autostart[0]"},
+		"duplicate ID": {`
+  max_tasks: 0
+  autostart:
+    - {id: a, capture: {name: afpacket, interface: eth0}, parsers: [{name: sip}], reporters: [{name: console}]}
+    - {id: a, capture: {name: afpacket, interface: eth1}, parsers: [{name: sip}], reporters: [{name: console}]}
+`, "duplicate task ID"},
+		"over max_tasks": {`
+  autostart:
+    - {id: a, capture: {name: afpacket, interface: eth0}, parsers: [{name: sip}], reporters: [{name: console}]}
+    - {id: b, capture: {name: afpacket, interface: eth1}, parsers: [{name: sip}], reporters: [{name: console}]}
+`, "max_tasks"},
+	} {
+		_, err := Load(writeTmpConfig(t, "otus:\n  node:\n    ip: \"10.0.0.1\""+tc.yaml))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want %q", name, err, tc.want)
+		}
+	}
+}
@@ -5,17 +5,23 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
+// DefaultDataDir is the default data_dir.
+const DefaultDataDir = "/var/lib/otus"
+
 // GlobalConfig represents the top-level global static configuration.
 // Maps to the `otus:` root key in YAML (see config-design.md §2).
 type GlobalConfig struct {
 	Node             NodeConfig             `mapstructure:"node"`
 	Control          ControlConfig          `mapstructure:"control"`
 	Kafka            GlobalKafkaConfig      `mapstructure:"kafka"`
+	TLS              TLSPolicyConfig        `mapstructure:"tls"`                // agent-wide policy for outbound TLS
 	CommandChannel   CommandChannelConfig   `mapstructure:"command_channel"`
 	Reporters        ReportersConfig        `mapstructure:"reporters"`
 	Resources        ResourcesConfig        `mapstructure:"resources"`
@@ -25,15 +31,21 @@ type GlobalConfig struct {
 	Log              LogConfig              `mapstructure:"log"`
 	DataDir          string                 `mapstructure:"data_dir"`           // ADR-030: /var/lib/otus
 	TaskPersistence  TaskPersistenceConfig  `mapstructure:"task_persistence"`   // ADR-030/031
+	Alerts           AlertsConfig           `mapstructure:"alerts"`
+	Audit            AuditConfig            `mapstructure:"audit"`              // periodic self-audit of interfaces, reporters and certificates
+	MaxTasks         int                    `mapstructure:"max_tasks"`          // concurrent tasks per agent; 0 = unlimited (default 1)
+	TaskTemplates    map[string]TaskTemplate `mapstructure:"task_templates"`    // named task configs for task_create with template
+	Autostart        []map[string]any       `mapstructure:"autostart"`          // task configs created at startup, see AutostartTasks
 }
 
 // ─── Node Identity ───
 
 // NodeConfig contains node identification settings.
 type NodeConfig struct {
-	IP       string            `mapstructure:"ip"`       // Empty = auto-detect (ADR-023)
-	Hostname string            `mapstructure:"hostname"` // Empty = os.Hostname()
-	Tags     map[string]string `mapstructure:"tags"`
+	IP         string            `mapstructure:"ip"`          // Empty = auto-detect (ADR-023)
+	PreferIPv6 bool              `mapstructure:"prefer_ipv6"` // Auto-detect picks IPv6 over IPv4
+	Hostname   string            `mapstructure:"hostname"`    // Empty = os.Hostname()
+	Tags       map[string]string `mapstructure:"tags"`
 }
 
 // ─── Control Plane ───
@@ -71,26 +83,72 @@ type TLSConfig struct {
 	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
 }
 
+// TLSPolicyConfig is the agent-wide policy applied to every outbound TLS
+// connection (Kafka, HEP over TLS). Version and cipher suites cannot be
+// overridden per connection; the CA bundle and client certificate are
+// defaults that a connection's TLSConfig may replace.
+type TLSPolicyConfig struct {
+	MinVersion   string   `mapstructure:"min_version"`   // "1.2" (default) | "1.3"
+	CipherSuites []string `mapstructure:"cipher_suites"` // TLS 1.2 suites by Go/IANA name; empty = Go defaults
+	FIPS         bool     `mapstructure:"fips"`          // restrict to FIPS 140 approved suites and curves
+	CACert       string   `mapstructure:"ca_cert"`       // CA bundle; empty = system roots
+	ClientCert   string   `mapstructure:"client_cert"`   // mutual TLS
+	ClientKey    string   `mapstructure:"client_key"`
+}
+
 // ─── Command Channel ───
 
 // CommandChannelConfig configures the remote command channel.
 type CommandChannelConfig struct {
-	Enabled    bool               `mapstructure:"enabled"`
-	Type       string             `mapstructure:"type"` // "kafka"
-	Kafka      CommandKafkaConfig `mapstructure:"kafka"`
-	CommandTTL string             `mapstructure:"command_ttl"` // Default "5m"
+	Enabled    bool                 `mapstructure:"enabled"`
+	Type       string               `mapstructure:"type"` // "kafka"
+	Kafka      CommandKafkaConfig   `mapstructure:"kafka"`
+	CommandTTL string               `mapstructure:"command_ttl"` // Default "5m"
+	DedupeTTL  string               `mapstructure:"dedupe_ttl"`  // Replay protection window by request_id; default "1h", "0" = disabled
+	Signing    CommandSigningConfig `mapstructure:"signing"`
+}
+
+// CommandSigningConfig enables signature verification of command messages.
+// The signature covers the raw Kafka message value and is carried base64
+// encoded in the "otus-signature" message header.
+type CommandSigningConfig struct {
+	Algorithm string `mapstructure:"algorithm"` // "" (disabled) | "hmac-sha256" | "ed25519"
+	Key       string `mapstructure:"key"`       // HMAC secret, or base64 Ed25519 public key
+	KeyFile   string `mapstructure:"key_file"`  // read the key from a file instead (secret mount); PEM allowed for ed25519
 }
 
 // CommandKafkaConfig contains Kafka-specific command channel settings.
 // Brokers/SASL/TLS inherit from GlobalKafkaConfig when empty/zero.
 type CommandKafkaConfig struct {
-	Brokers         []string   `mapstructure:"brokers"`
-	Topic           string     `mapstructure:"topic"`
-	ResponseTopic   string     `mapstructure:"response_topic"` // ADR-029: write responses here; empty = disabled
-	GroupID         string     `mapstructure:"group_id"`
-	AutoOffsetReset string     `mapstructure:"auto_offset_reset"`
-	SASL            SASLConfig `mapstructure:"sasl"`
-	TLS             TLSConfig  `mapstructure:"tls"`
+	Brokers         []string             `mapstructure:"brokers"`
+	Topic           string               `mapstructure:"topic"`
+	Topics          []CommandTopicConfig `mapstructure:"topics"`         // additional command topics, e.g. broadcast + per-site
+	ResponseTopic   string               `mapstructure:"response_topic"` // ADR-029: write responses here; empty = disabled
+	AlertTopic      string               `mapstructure:"alert_topic"`    // quality alerts; empty = response_topic
+	GroupID         string               `mapstructure:"group_id"`
+	AutoOffsetReset string               `mapstructure:"auto_offset_reset"`
+	SASL            SASLConfig           `mapstructure:"sasl"`
+	TLS             TLSConfig            `mapstructure:"tls"`
+}
+
+// CommandTopicConfig is one subscribed command topic. Each topic is consumed
+// by its own reader, so offsets are tracked independently per topic.
+type CommandTopicConfig struct {
+	Name     string   `mapstructure:"name"`
+	GroupID  string   `mapstructure:"group_id"` // default: command_channel.kafka.group_id
+	Commands []string `mapstructure:"commands"` // allowed commands; empty = all
+}
+
+// TopicNames returns all subscribed command topics: topic first, then topics.
+func (c *CommandKafkaConfig) TopicNames() []string {
+	var names []string
+	if c.Topic != "" {
+		names = append(names, c.Topic)
+	}
+	for _, t := range c.Topics {
+		names = append(names, t.Name)
+	}
+	return names
 }
 
 // ─── Shared Reporter Connection ───
@@ -179,6 +237,20 @@ type MetricsConfig struct {
 	Listen          string `mapstructure:"listen"`
 	Path            string `mapstructure:"path"`
 	CollectInterval string `mapstructure:"collect_interval"` // e.g. "5s", hot-reloadable
+	Filter          MetricsFilterConfig `mapstructure:"filter"` // hot-reloadable
+}
+
+// MetricsFilterConfig trims the /metrics payload of agents running many tasks.
+// Task IDs and metric names are glob patterns (path.Match).
+type MetricsFilterConfig struct {
+	TaskOptOut     []MetricsOptOut     `mapstructure:"task_opt_out"`    // per-task series not exported
+	LabelAllowlist map[string][]string `mapstructure:"label_allowlist"` // metric name → labels kept; series are summed over the others
+}
+
+// MetricsOptOut drops the series of the matching metrics for the matching tasks.
+type MetricsOptOut struct {
+	Tasks   []string `mapstructure:"tasks"`
+	Metrics []string `mapstructure:"metrics"`
 }
 
 // ─── Log (ADR-025) ───
@@ -226,8 +298,72 @@ type LokiOutputConfig struct {
 type TaskPersistenceConfig struct {
 	Enabled          bool   `mapstructure:"enabled"`           // false = disable (dev/test)
 	AutoRestart      bool   `mapstructure:"auto_restart"`      // true = auto-restart running tasks on startup
+	MaxRestarts      int    `mapstructure:"max_restarts"`      // restarts on startup of tasks that failed transiently, 0 = none
 	GCInterval       string `mapstructure:"gc_interval"`       // default "1h"
 	MaxTaskHistory   int    `mapstructure:"max_task_history"`  // 0 = disable in-process GC
+	Encryption       StoreEncryptionConfig `mapstructure:"encryption"`
+	Backend          string                `mapstructure:"backend"` // "file" ({data_dir}/tasks, default) | "s3"
+	S3               S3StoreConfig         `mapstructure:"s3"`
+}
+
+// S3StoreConfig locates the bucket of the "s3" task store. Records are kept
+// under {prefix}/{node.hostname}/tasks/. Credentials left empty are taken
+// from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3StoreConfig struct {
+	Endpoint        string `mapstructure:"endpoint"`  // default https://s3.{region}.amazonaws.com
+	Region          string `mapstructure:"region"`    // default "us-east-1"
+	Bucket          string `mapstructure:"bucket"`    // required
+	Prefix          string `mapstructure:"prefix"`    // default "otus"
+	PathStyle       bool   `mapstructure:"path_style"` // endpoint/bucket/key (MinIO, Ceph RGW)
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	Timeout         string `mapstructure:"timeout"` // per request, default "10s"
+}
+
+// StoreEncryptionConfig enables AES-256-GCM encryption of persisted task
+// records. The first key encrypts, every key decrypts: rotate by prepending
+// the new key and dropping the old one once records have been rewritten
+// (the daemon rewrites them at startup).
+type StoreEncryptionConfig struct {
+	Enabled bool        `mapstructure:"enabled"`
+	Keys    []KeySource `mapstructure:"keys"`
+}
+
+// KeySource locates a 32-byte key, stored raw or base64 encoded.
+type KeySource struct {
+	File string `mapstructure:"file"` // secret mount
+	Env  string `mapstructure:"env"`  // environment variable, e.g. injected by a KMS agent
+}
+
+// ─── Alerts ───
+
+// AlertsConfig configures the in-agent alert evaluator.
+// Rules are evaluated locally so problems surface even without a Prometheus scrape.
+type AlertsConfig struct {
+	Enabled  bool              `mapstructure:"enabled"`
+	Interval string            `mapstructure:"interval"` // evaluation period, default "10s"
+	Rules    []AlertRuleConfig `mapstructure:"rules"`
+}
+
+// AlertRuleConfig defines a single alert rule.
+type AlertRuleConfig struct {
+	Name      string  `mapstructure:"name"`
+	Type      string  `mapstructure:"type"`      // drop_rate | zero_packets | reporter_error_streak
+	Threshold float64 `mapstructure:"threshold"` // drop_rate: percent; reporter_error_streak: consecutive failed batches
+	For       string  `mapstructure:"for"`       // zero_packets: silence window (e.g. "30s")
+	Severity  string  `mapstructure:"severity"`  // warning (default) | critical
+}
+
+// ─── Self-Audit ───
+
+// AuditConfig configures the periodic self-audit. It re-checks what was only
+// verified when a task started, so a removed interface, an unreachable
+// collector or an expiring certificate is reported before it is needed.
+type AuditConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	Interval   string `mapstructure:"interval"`    // audit period, default "5m"
+	Timeout    string `mapstructure:"timeout"`     // bound of each check, default "10s"
+	CertExpiry string `mapstructure:"cert_expiry"` // degraded this long before a certificate expires, default "168h"
 }
 
 // ─── Loading ───
@@ -302,6 +438,7 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("otus.command_channel.type", "kafka")
 	v.SetDefault("otus.command_channel.kafka.auto_offset_reset", "latest")
 	v.SetDefault("otus.command_channel.command_ttl", "5m")
+	v.SetDefault("otus.command_channel.dedupe_ttl", "1h")
 
 	// Backpressure defaults
 	v.SetDefault("otus.backpressure.pipeline_channel.capacity", 65536)
@@ -318,11 +455,27 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("otus.core.decoder.ip_reassembly.max_fragments", 10000)
 
 	// Task persistence defaults (ADR-030, ADR-031)
-	v.SetDefault("otus.data_dir", "/var/lib/otus")
+	v.SetDefault("otus.data_dir", DefaultDataDir)
 	v.SetDefault("otus.task_persistence.enabled", true)
 	v.SetDefault("otus.task_persistence.auto_restart", true)
 	v.SetDefault("otus.task_persistence.gc_interval", "1h")
 	v.SetDefault("otus.task_persistence.max_task_history", 100)
+	v.SetDefault("otus.task_persistence.max_restarts", 0)
+	v.SetDefault("otus.task_persistence.backend", "file")
+	v.SetDefault("otus.task_persistence.s3.region", "us-east-1")
+	v.SetDefault("otus.task_persistence.s3.prefix", "otus")
+	v.SetDefault("otus.task_persistence.s3.timeout", "10s")
+
+	// Task limit: one task per agent unless raised (e.g. signaling + media tasks)
+	v.SetDefault("otus.max_tasks", 1)
+
+	// Alert defaults
+	v.SetDefault("otus.alerts.enabled", false)
+	v.SetDefault("otus.alerts.interval", "10s")
+	v.SetDefault("otus.audit.enabled", false)
+	v.SetDefault("otus.audit.interval", "5m")
+	v.SetDefault("otus.audit.timeout", "10s")
+	v.SetDefault("otus.audit.cert_expiry", "168h")
 
 	// Reporter defaults
 	v.SetDefault("otus.reporters.kafka.compression", "snappy")
@@ -368,17 +521,174 @@ func (cfg *GlobalConfig) ValidateAndApplyDefaults() error {
 		if len(cfg.CommandChannel.Kafka.Brokers) == 0 {
 			return fmt.Errorf("command_channel.kafka.brokers is required when command_channel.enabled=true")
 		}
-		if cfg.CommandChannel.Kafka.Topic == "" {
-			return fmt.Errorf("command_channel.kafka.topic is required when command_channel.enabled=true")
+		if len(cfg.CommandChannel.Kafka.TopicNames()) == 0 {
+			return fmt.Errorf("command_channel.kafka.topic or topics is required when command_channel.enabled=true")
+		}
+		seen := make(map[string]bool)
+		for i, name := range cfg.CommandChannel.Kafka.TopicNames() {
+			if name == "" {
+				return fmt.Errorf("command_channel.kafka.topics: entry %d has no name", i)
+			}
+			if seen[name] {
+				return fmt.Errorf("command_channel.kafka.topics: duplicate topic %q", name)
+			}
+			seen[name] = true
 		}
 		if cfg.CommandChannel.Kafka.GroupID == "" {
 			cfg.CommandChannel.Kafka.GroupID = "otus-" + cfg.Node.Hostname
 		}
+		if d, err := time.ParseDuration(cfg.CommandChannel.DedupeTTL); err != nil || d < 0 {
+			return fmt.Errorf("invalid command_channel.dedupe_ttl: %q", cfg.CommandChannel.DedupeTTL)
+		}
+		if s := cfg.CommandChannel.Signing; s.Algorithm != "" {
+			switch s.Algorithm {
+			case "hmac-sha256", "ed25519":
+			default:
+				return fmt.Errorf("unsupported command_channel.signing.algorithm: %s (hmac-sha256 or ed25519)", s.Algorithm)
+			}
+			if (s.Key == "") == (s.KeyFile == "") {
+				return fmt.Errorf("command_channel.signing: exactly one of key or key_file is required")
+			}
+		}
+	}
+
+	switch cfg.TLS.MinVersion {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("unsupported tls.min_version: %s (1.2 or 1.3)", cfg.TLS.MinVersion)
+	}
+	if (cfg.TLS.ClientCert == "") != (cfg.TLS.ClientKey == "") {
+		return fmt.Errorf("tls: client_cert and client_key must be set together")
+	}
+
+	if err := validateTaskTemplates(cfg.TaskTemplates); err != nil {
+		return err
+	}
+
+	if enc := cfg.TaskPersistence.Encryption; enc.Enabled {
+		if len(enc.Keys) == 0 {
+			return fmt.Errorf("task_persistence.encryption.keys is required when encryption is enabled")
+		}
+		for i, k := range enc.Keys {
+			if (k.File == "") == (k.Env == "") {
+				return fmt.Errorf("task_persistence.encryption.keys[%d]: exactly one of file or env is required", i)
+			}
+		}
+	}
+
+	switch tp := cfg.TaskPersistence; tp.Backend {
+	case "", "file":
+	case "s3":
+		if tp.S3.Bucket == "" {
+			return fmt.Errorf("task_persistence.s3.bucket is required when backend is s3")
+		}
+		if tp.S3.Timeout != "" {
+			if d, err := time.ParseDuration(tp.S3.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("task_persistence.s3.timeout must be a positive duration, got %q", tp.S3.Timeout)
+			}
+		}
+	default:
+		return fmt.Errorf("task_persistence.backend must be file or s3, got %q", tp.Backend)
+	}
+
+	if cfg.MaxTasks < 0 {
+		return fmt.Errorf("max_tasks must be >= 0, got %d", cfg.MaxTasks)
+	}
+
+	if err := validateAutostart(cfg); err != nil {
+		return err
+	}
+
+	if err := validateMetricsFilter(&cfg.Metrics.Filter); err != nil {
+		return err
+	}
+
+	// ── Alerts validation ──
+	if cfg.Alerts.Enabled {
+		if err := validateAlerts(&cfg.Alerts); err != nil {
+			return err
+		}
+	}
+
+	// ── Audit validation ──
+	if cfg.Audit.Enabled {
+		for _, f := range []struct{ name, value string }{
+			{"interval", cfg.Audit.Interval},
+			{"timeout", cfg.Audit.Timeout},
+			{"cert_expiry", cfg.Audit.CertExpiry},
+		} {
+			if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+				return fmt.Errorf("invalid audit.%s: %q", f.name, f.value)
+			}
+		}
 	}
 
 	return nil
 }
 
+// validateMetricsFilter checks the glob patterns of metrics.filter.
+func validateMetricsFilter(fc *MetricsFilterConfig) error {
+	for i, o := range fc.TaskOptOut {
+		if len(o.Tasks) == 0 || len(o.Metrics) == 0 {
+			return fmt.Errorf("metrics.filter.task_opt_out[%d]: tasks and metrics are required", i)
+		}
+		for _, patterns := range [][]string{o.Tasks, o.Metrics} {
+			for _, p := range patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					return fmt.Errorf("metrics.filter.task_opt_out[%d]: invalid pattern %q", i, p)
+				}
+			}
+		}
+	}
+	for name, labels := range fc.LabelAllowlist {
+		for _, l := range labels {
+			if l == "" {
+				return fmt.Errorf("metrics.filter.label_allowlist.%s: empty label name", name)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAlerts checks alert rule definitions and fills per-rule defaults.
+func validateAlerts(ac *AlertsConfig) error {
+	if d, err := time.ParseDuration(ac.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid alerts.interval: %q", ac.Interval)
+	}
+	names := make(map[string]bool, len(ac.Rules))
+	for i := range ac.Rules {
+		r := &ac.Rules[i]
+		if r.Name == "" {
+			return fmt.Errorf("alerts.rules[%d]: name is required", i)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("alerts.rules[%d]: duplicate rule name %q", i, r.Name)
+		}
+		names[r.Name] = true
+
+		switch r.Type {
+		case "drop_rate", "reporter_error_streak":
+			if r.Threshold <= 0 {
+				return fmt.Errorf("alerts.rules[%d] (%s): threshold must be > 0", i, r.Name)
+			}
+		case "zero_packets":
+			if d, err := time.ParseDuration(r.For); err != nil || d <= 0 {
+				return fmt.Errorf("alerts.rules[%d] (%s): for must be a positive duration, got %q", i, r.Name, r.For)
+			}
+		default:
+			return fmt.Errorf("alerts.rules[%d] (%s): unsupported type %q (must be drop_rate/zero_packets/reporter_error_streak)", i, r.Name, r.Type)
+		}
+
+		if r.Severity == "" {
+			r.Severity = "warning"
+		}
+		if r.Severity != "warning" && r.Severity != "critical" {
+			return fmt.Errorf("alerts.rules[%d] (%s): severity must be warning/critical, got %q", i, r.Name, r.Severity)
+		}
+	}
+	return nil
+}
+
 // resolveNodeIP resolves the node IP address (ADR-023).
 // Priority: env/config explicit value → auto-detect → error.
 func resolveNodeIP(node *NodeConfig) (string, error) {
@@ -387,40 +697,55 @@ func resolveNodeIP(node *NodeConfig) (string, error) {
 		return node.IP, nil
 	}
 
-	// 2. Auto-detect: first non-loopback, non-link-local IPv4
+	// 2. Auto-detect: first non-loopback, non-link-local address of the
+	// preferred family, falling back to the other one (IPv6-only hosts)
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return "", fmt.Errorf("cannot resolve node IP: failed to list interfaces: %w", err)
 	}
 
+	var addrs []net.Addr
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
 			continue
 		}
-		addrs, err := iface.Addrs()
+		ifAddrs, err := iface.Addrs()
 		if err != nil {
 			continue
 		}
-		for _, addr := range addrs {
-			ipNet, ok := addr.(*net.IPNet)
-			if !ok {
-				continue
-			}
-			ip4 := ipNet.IP.To4()
-			if ip4 == nil {
-				continue
-			}
-			// Skip link-local 169.254.x.x
-			if ip4[0] == 169 && ip4[1] == 254 {
-				continue
-			}
-			return ip4.String(), nil
-		}
+		addrs = append(addrs, ifAddrs...)
+	}
+	if ip := pickNodeIP(addrs, node.PreferIPv6); ip != "" {
+		return ip, nil
 	}
 
 	return "", fmt.Errorf("cannot resolve node IP: set OTUS_NODE_IP or otus.node.ip")
 }
 
+// pickNodeIP returns the first usable interface address of the preferred
+// family, else the first of the other family, else "". Loopback, link-local
+// (169.254/16, fe80::/10) and multicast addresses are not usable.
+func pickNodeIP(addrs []net.Addr, preferIPv6 bool) string {
+	var v4, v6 string
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			if v4 == "" {
+				v4 = ip4.String()
+			}
+		} else if v6 == "" {
+			v6 = ipNet.IP.String()
+		}
+	}
+	if preferIPv6 && v6 != "" || v4 == "" {
+		return v6
+	}
+	return v4
+}
+
 // applyKafkaInheritance applies ADR-024 Kafka global config inheritance.
 // Global otus.kafka fields are inherited by command_channel.kafka and reporters.kafka
 // when their local fields are empty/zero.
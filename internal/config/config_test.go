@@ -1,6 +1,7 @@
 package config
 
 import (
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -175,6 +176,31 @@ otus:
 	}
 }
 
+func TestPickNodeIP(t *testing.T) {
+	addr := func(s string) net.Addr {
+		return &net.IPNet{IP: net.ParseIP(s), Mask: net.CIDRMask(64, 128)}
+	}
+	dual := []net.Addr{addr("fe80::1"), addr("169.254.0.9"), addr("2001:db8::10"), addr("10.0.0.5")}
+	v6only := []net.Addr{addr("fe80::1"), addr("2001:db8::10")}
+
+	tests := []struct {
+		name       string
+		addrs      []net.Addr
+		preferIPv6 bool
+		want       string
+	}{
+		{"dual-stack default", dual, false, "10.0.0.5"},
+		{"dual-stack prefer IPv6", dual, true, "2001:db8::10"},
+		{"IPv6-only", v6only, false, "2001:db8::10"},
+		{"link-local only", []net.Addr{addr("fe80::1"), addr("169.254.0.9")}, true, ""},
+	}
+	for _, tt := range tests {
+		if got := pickNodeIP(tt.addrs, tt.preferIPv6); got != tt.want {
+			t.Errorf("%s: pickNodeIP = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
 // ── Kafka inheritance (ADR-024) ──
 
 func TestKafkaInheritanceSameCluster(t *testing.T) {
@@ -347,6 +373,129 @@ otus:
 	}
 }
 
+func TestCommandChannelMultipleTopics(t *testing.T) {
+	cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+    hostname: "myhost"
+  kafka:
+    brokers:
+      - "kafka:9092"
+  command_channel:
+    enabled: true
+    kafka:
+      topics:
+        - name: "otus-commands-all"
+          commands: ["task_list", "daemon_stats"]
+        - name: "otus-commands-site-a"
+          group_id: "otus-site-a"
+  log:
+    level: "info"
+    format: "json"
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	kc := cfg.CommandChannel.Kafka
+	if got := kc.TopicNames(); len(got) != 2 || got[0] != "otus-commands-all" || got[1] != "otus-commands-site-a" {
+		t.Errorf("TopicNames() = %v", got)
+	}
+	if len(kc.Topics[0].Commands) != 2 {
+		t.Errorf("Topics[0].Commands = %v, want 2 commands", kc.Topics[0].Commands)
+	}
+	if kc.Topics[1].GroupID != "otus-site-a" {
+		t.Errorf("Topics[1].GroupID = %q, want otus-site-a", kc.Topics[1].GroupID)
+	}
+}
+
+func TestCommandChannelDuplicateTopic(t *testing.T) {
+	_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  kafka:
+    brokers:
+      - "kafka:9092"
+  command_channel:
+    enabled: true
+    kafka:
+      topic: "commands"
+      topics:
+        - name: "commands"
+  log:
+    level: "info"
+    format: "json"
+`))
+	if err == nil {
+		t.Fatal("expected error: duplicate command topic")
+	}
+	if !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("error = %v, want mention of duplicate", err)
+	}
+}
+
+func TestCommandChannelInvalidDedupeTTL(t *testing.T) {
+	_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  kafka:
+    brokers:
+      - "kafka:9092"
+  command_channel:
+    enabled: true
+    dedupe_ttl: "soon"
+    kafka:
+      topic: "commands"
+  log:
+    level: "info"
+    format: "json"
+`))
+	if err == nil || !strings.Contains(err.Error(), "dedupe_ttl") {
+		t.Errorf("error = %v, want mention of dedupe_ttl", err)
+	}
+}
+
+func TestCommandChannelSigningValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing string
+		wantErr string
+	}{
+		{"hmac with key", `{algorithm: "hmac-sha256", key: "s3cret"}`, ""},
+		{"unknown algorithm", `{algorithm: "rsa", key: "k"}`, "algorithm"},
+		{"no key", `{algorithm: "ed25519"}`, "key"},
+		{"key and key_file", `{algorithm: "hmac-sha256", key: "k", key_file: "/etc/otus/key"}`, "key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  kafka:
+    brokers:
+      - "kafka:9092"
+  command_channel:
+    enabled: true
+    signing: `+tt.signing+`
+    kafka:
+      topic: "commands"
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 // ── Defaults ──
 
 func TestLoadDefaults(t *testing.T) {
@@ -391,6 +540,10 @@ otus:
 		t.Errorf("SendBuffer.HighWatermark = %f, want 0.8", cfg.Backpressure.SendBuffer.HighWatermark)
 	}
 
+	if cfg.MaxTasks != 1 {
+		t.Errorf("MaxTasks = %d, want 1", cfg.MaxTasks)
+	}
+
 	// Reporter defaults
 	if cfg.Reporters.Kafka.Compression != "snappy" {
 		t.Errorf("Reporters.Kafka.Compression = %q, want snappy", cfg.Reporters.Kafka.Compression)
@@ -439,3 +592,228 @@ otus:
 		t.Error("CommandChannel.Enabled = true, want false by default")
 	}
 }
+
+// ── Alerts ──
+
+func TestAlertsRulesValidated(t *testing.T) {
+	cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  log:
+    level: "info"
+    format: "json"
+  alerts:
+    enabled: true
+    rules:
+      - name: "capture-drops"
+        type: "drop_rate"
+        threshold: 5
+      - name: "silent"
+        type: "zero_packets"
+        for: "60s"
+        severity: "critical"
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Alerts.Interval != "10s" {
+		t.Errorf("Alerts.Interval = %q, want 10s default", cfg.Alerts.Interval)
+	}
+	if len(cfg.Alerts.Rules) != 2 {
+		t.Fatalf("len(Alerts.Rules) = %d, want 2", len(cfg.Alerts.Rules))
+	}
+	if cfg.Alerts.Rules[0].Severity != "warning" {
+		t.Errorf("Rules[0].Severity = %q, want warning default", cfg.Alerts.Rules[0].Severity)
+	}
+}
+
+func TestAlertsInvalidRuleType(t *testing.T) {
+	_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  log:
+    level: "info"
+    format: "json"
+  alerts:
+    enabled: true
+    rules:
+      - name: "bogus"
+        type: "cpu_usage"
+        threshold: 90
+`))
+	if err == nil {
+		t.Fatal("expected error: unsupported alert rule type")
+	}
+	if !strings.Contains(err.Error(), "unsupported type") {
+		t.Errorf("error = %v, want mention of unsupported type", err)
+	}
+}
+
+// ── Audit ──
+
+func TestAuditDefaultsAndValidation(t *testing.T) {
+	const base = `
+otus:
+  node:
+    ip: "10.0.0.1"
+  log:
+    level: "info"
+    format: "json"
+  audit:
+    enabled: true
+`
+	cfg, err := Load(writeTmpConfig(t, base))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Audit.Interval != "5m" || cfg.Audit.Timeout != "10s" || cfg.Audit.CertExpiry != "168h" {
+		t.Errorf("Audit = %+v, want 5m/10s/168h defaults", cfg.Audit)
+	}
+
+	_, err = Load(writeTmpConfig(t, base+`    cert_expiry: "7d"
+`))
+	if err == nil || !strings.Contains(err.Error(), "audit.cert_expiry") {
+		t.Errorf("error = %v, want invalid audit.cert_expiry", err)
+	}
+}
+
+func TestTaskPersistenceEncryptionValidation(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption string
+		wantErr    string
+	}{
+		{"file and env keys", `{enabled: true, keys: [{file: "/etc/otus/store.key"}, {env: "OTUS_STORE_KEY_OLD"}]}`, ""},
+		{"disabled without keys", `{enabled: false}`, ""},
+		{"no keys", `{enabled: true}`, "keys is required"},
+		{"file and env in one key", `{enabled: true, keys: [{file: "/k", env: "K"}]}`, "keys[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  task_persistence:
+    encryption: `+tt.encryption+`
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTaskPersistenceBackendValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr string
+	}{
+		{"s3", `backend: s3
+    s3: {bucket: otus-state, endpoint: "http://minio:9000", path_style: true}`, ""},
+		{"s3 without bucket", `backend: s3`, "bucket is required"},
+		{"s3 bad timeout", `backend: s3
+    s3: {bucket: otus-state, timeout: soon}`, "timeout"},
+		{"unknown backend", `backend: nfs`, "file or s3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  task_persistence:
+    `+tt.backend+`
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+				if s3 := cfg.TaskPersistence.S3; s3.Region != "us-east-1" || s3.Prefix != "otus" || !s3.PathStyle {
+					t.Errorf("S3 = %+v, want defaults for region and prefix", s3)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     string
+		wantErr string
+	}{
+		{"tls 1.3 fips", `{min_version: "1.3", fips: true}`, ""},
+		{"mutual tls", `{client_cert: /etc/otus/client.pem, client_key: /etc/otus/client.key}`, ""},
+		{"tls 1.1", `{min_version: "1.1"}`, "min_version"},
+		{"cert without key", `{client_cert: /etc/otus/client.pem}`, "client_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  tls: `+tt.tls+`
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Load failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetricsFilterValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		wantErr string
+	}{
+		{"opt-out and allowlist", `{task_opt_out: [{tasks: ["bulk-*"], metrics: ["otus_parser_*"]}], label_allowlist: {otus_pipeline_packets_total: [task]}}`, ""},
+		{"no metrics", `{task_opt_out: [{tasks: ["bulk-*"]}]}`, "task_opt_out[0]"},
+		{"bad pattern", `{task_opt_out: [{tasks: ["bulk-["], metrics: ["*"]}]}`, "invalid pattern"},
+		{"empty label", `{label_allowlist: {otus_pipeline_packets_total: [""]}}`, "empty label"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  metrics:
+    filter: `+tt.filter+`
+`))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load failed: %v", err)
+				}
+				if got := cfg.Metrics.Filter.LabelAllowlist["otus_pipeline_packets_total"]; len(got) != 1 || got[0] != "task" {
+					t.Errorf("LabelAllowlist = %v", cfg.Metrics.Filter.LabelAllowlist)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ExportTaskConfig returns tc keyed like a task config file, as returned by
+// task_export. Secrets are redacted unless withSecrets, in which case the
+// result can be passed back to task_create unchanged.
+func ExportTaskConfig(tc TaskConfig, withSecrets bool) (map[string]any, error) {
+	m, err := taskConfigMap(tc)
+	if err != nil {
+		return nil, err
+	}
+	if !withSecrets {
+		redactMap(m)
+	}
+	return m, nil
+}
+
+// CloneTaskConfig returns a copy of tc with the given id and overrides, which
+// merge into the copy like task template overrides. The result is validated
+// like any other task config.
+func CloneTaskConfig(tc TaskConfig, id string, overrides map[string]any) (*TaskConfig, error) {
+	if id == "" {
+		return nil, fmt.Errorf("clone of task %q: new id is required", tc.ID)
+	}
+	if id == tc.ID {
+		return nil, fmt.Errorf("clone of task %q: new id must differ", tc.ID)
+	}
+	base, err := taskConfigMap(tc)
+	if err != nil {
+		return nil, err
+	}
+	merged := mergeConfig(base, overrides)
+	merged["id"] = id
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("clone of task %q: %w", tc.ID, err)
+	}
+	clone, err := ParseTaskConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("clone of task %q: %w", tc.ID, err)
+	}
+	return clone, nil
+}
+
+// taskConfigMap converts tc to a generic map through its JSON encoding.
+func taskConfigMap(tc TaskConfig) (map[string]any, error) {
+	data, err := json.Marshal(tc)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
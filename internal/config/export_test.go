@@ -0,0 +1,83 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func exportSource(t *testing.T) *TaskConfig {
+	t.Helper()
+	tc, err := ParseTaskConfig([]byte(`{
+		"id": "sip-eth0",
+		"workers": 2,
+		"capture": {"name": "afpacket", "interface": "eth0", "bpf_filter": "udp port 5060"},
+		"parsers": [{"name": "sip"}],
+		"reporters": [{"name": "kafka", "config": {"topic": "otus", "sasl_password": "s3cret"}}]
+	}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig: %v", err)
+	}
+	return tc
+}
+
+func TestExportTaskConfig(t *testing.T) {
+	tc := exportSource(t)
+
+	m, err := ExportTaskConfig(*tc, false)
+	if err != nil {
+		t.Fatalf("ExportTaskConfig: %v", err)
+	}
+	reporter := m["reporters"].([]any)[0].(map[string]any)["config"].(map[string]any)
+	if reporter["sasl_password"] != Redacted || reporter["topic"] != "otus" {
+		t.Errorf("reporter config = %v, want the password redacted", reporter)
+	}
+	if tc.Reporters[0].Config["sasl_password"] != "s3cret" {
+		t.Error("export redacted the source config")
+	}
+
+	m, err = ExportTaskConfig(*tc, true)
+	if err != nil {
+		t.Fatalf("ExportTaskConfig: %v", err)
+	}
+	reporter = m["reporters"].([]any)[0].(map[string]any)["config"].(map[string]any)
+	if reporter["sasl_password"] != "s3cret" {
+		t.Errorf("sasl_password = %v, want it kept", reporter["sasl_password"])
+	}
+}
+
+func TestCloneTaskConfig(t *testing.T) {
+	tc := exportSource(t)
+
+	clone, err := CloneTaskConfig(*tc, "sip-eth1", map[string]any{
+		"capture": map[string]any{"interface": "eth1"},
+	})
+	if err != nil {
+		t.Fatalf("CloneTaskConfig: %v", err)
+	}
+	if clone.ID != "sip-eth1" || clone.Capture.Interface != "eth1" {
+		t.Errorf("id/interface = %q/%q", clone.ID, clone.Capture.Interface)
+	}
+	if clone.Capture.BPFFilter != "udp port 5060" || clone.Workers != 2 {
+		t.Errorf("capture = %+v, workers = %d, want them copied", clone.Capture, clone.Workers)
+	}
+	if clone.Reporters[0].Config["sasl_password"] != "s3cret" {
+		t.Error("clone lost the reporter secret")
+	}
+	if tc.Capture.Interface != "eth0" {
+		t.Error("clone changed the source config")
+	}
+
+	for _, tt := range []struct {
+		id        string
+		overrides map[string]any
+		want      string
+	}{
+		{"", nil, "new id is required"},
+		{"sip-eth0", nil, "must differ"},
+		{"sip-eth1", map[string]any{"capture": map[string]any{"max_pps": -1}}, "max_pps"},
+	} {
+		if _, err := CloneTaskConfig(*tc, tt.id, tt.overrides); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("CloneTaskConfig(%q, %v): err = %v, want %q", tt.id, tt.overrides, err, tt.want)
+		}
+	}
+}
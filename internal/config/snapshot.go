@@ -0,0 +1,156 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces secret values in snapshots.
+const Redacted = "<redacted>"
+
+// secretKeys are config keys whose values are secrets. Keys ending in
+// _password, _secret or _token are secrets too; paths to secrets
+// (key_file, client_key) are not.
+var secretKeys = map[string]bool{
+	"password":   true,
+	"passwd":     true,
+	"secret":     true,
+	"token":      true,
+	"key":        true,
+	"api_key":    true,
+	"access_key": true,
+	"secret_key": true,
+
+	"auth_key":          true, // hep reporter
+	"secret_access_key": true, // task_persistence.s3
+}
+
+// Snapshot is the effective running configuration of an agent, with secrets
+// redacted, as returned by config_get.
+type Snapshot struct {
+	Global map[string]any            `json:"global"`
+	Tasks  map[string]map[string]any `json:"tasks"`
+	Hash   string                    `json:"hash"` // sha256 over global and tasks
+}
+
+// NewSnapshot builds the snapshot of a global config and the task configs by
+// task ID. The hash is taken after redaction, so it does not change when only
+// a secret changes.
+func NewSnapshot(global *GlobalConfig, tasks map[string]TaskConfig) (*Snapshot, error) {
+	s := &Snapshot{
+		Global: redactMap(structMap(reflect.ValueOf(*global))),
+		Tasks:  make(map[string]map[string]any, len(tasks)),
+	}
+	for id, tc := range tasks {
+		data, err := json.Marshal(tc)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]any
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		s.Tasks[id] = redactMap(m)
+	}
+
+	// encoding/json sorts map keys, which makes the encoding canonical
+	data, err := json.Marshal(struct {
+		Global map[string]any            `json:"global"`
+		Tasks  map[string]map[string]any `json:"tasks"`
+	}{s.Global, s.Tasks})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	s.Hash = "sha256:" + hex.EncodeToString(sum[:])
+	return s, nil
+}
+
+// structMap converts a config struct to a map keyed like the YAML file, by
+// mapstructure tag.
+func structMap(v reflect.Value) map[string]any {
+	t := v.Type()
+	m := make(map[string]any, t.NumField())
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if name == "" || name == "-" {
+			name = strings.ToLower(f.Name)
+		}
+		m[name] = plainValue(v.Field(i))
+	}
+	return m
+}
+
+// plainValue converts a config value to maps, slices and scalars.
+func plainValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Struct:
+		return structMap(v)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return plainValue(v.Elem())
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m[iter.Key().String()] = plainValue(iter.Value())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		s := make([]any, v.Len())
+		for i := range s {
+			s[i] = plainValue(v.Index(i))
+		}
+		return s
+	default:
+		return v.Interface()
+	}
+}
+
+// redactMap replaces non-empty secret values in place, recursively.
+func redactMap(m map[string]any) map[string]any {
+	for k, v := range m {
+		if isSecretKey(k) {
+			if v != nil && v != "" {
+				m[k] = Redacted
+			}
+			continue
+		}
+		redactValue(v)
+	}
+	return m
+}
+
+func redactValue(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		redactMap(v)
+	case []any:
+		for _, e := range v {
+			redactValue(e)
+		}
+	}
+}
+
+func isSecretKey(k string) bool {
+	k = strings.ToLower(k)
+	return secretKeys[k] ||
+		strings.HasSuffix(k, "_password") ||
+		strings.HasSuffix(k, "_secret") ||
+		strings.HasSuffix(k, "_token")
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewSnapshot_Redacts(t *testing.T) {
+	global := &GlobalConfig{
+		Kafka: GlobalKafkaConfig{
+			Brokers: []string{"kafka:9092"},
+			SASL:    SASLConfig{Enabled: true, Username: "otus", Password: "hunter2"},
+		},
+		CommandChannel: CommandChannelConfig{
+			Signing: CommandSigningConfig{Algorithm: "hmac-sha256", Key: "s3cret", KeyFile: ""},
+		},
+	}
+	tasks := map[string]TaskConfig{
+		"t1": {
+			ID: "t1",
+			Reporters: []ReporterConfig{{
+				Name:   "kafka",
+				Config: map[string]any{"topic": "otus", "sasl": map[string]any{"password": "p", "username": "u"}, "auth_token": "x"},
+			}},
+		},
+	}
+
+	s, err := NewSnapshot(global, tasks)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+
+	sasl := s.Global["kafka"].(map[string]any)["sasl"].(map[string]any)
+	if sasl["password"] != Redacted || sasl["username"] != "otus" {
+		t.Errorf("kafka.sasl = %v, want password redacted, username kept", sasl)
+	}
+	signing := s.Global["command_channel"].(map[string]any)["signing"].(map[string]any)
+	if signing["key"] != Redacted {
+		t.Errorf("signing.key = %v, want redacted", signing["key"])
+	}
+	if signing["key_file"] != "" {
+		t.Errorf("empty signing.key_file = %v, want kept empty", signing["key_file"])
+	}
+
+	reporter := s.Tasks["t1"]["reporters"].([]any)[0].(map[string]any)["config"].(map[string]any)
+	if reporter["auth_token"] != Redacted || reporter["sasl"].(map[string]any)["password"] != Redacted {
+		t.Errorf("reporter config = %v, want secrets redacted", reporter)
+	}
+	if reporter["topic"] != "otus" {
+		t.Errorf("reporter topic = %v, want otus", reporter["topic"])
+	}
+}
+
+// TestNewSnapshot_DocumentedSecrets walks the secret options documented in
+// doc/api.md; a new secret option must be added here and to secretKeys.
+func TestNewSnapshot_DocumentedSecrets(t *testing.T) {
+	global := &GlobalConfig{}
+	global.Kafka.SASL.Password = "s-kafka"
+	global.CommandChannel.Kafka.SASL.Password = "s-command"
+	global.CommandChannel.Signing.Key = "s-signing"
+	global.TaskPersistence.S3.SecretAccessKey = "s-s3"
+
+	plugins := map[string]map[string]any{
+		"hep":   {"auth_key": "s-hep"},
+		"kafka": {"sasl": map[string]any{"password": "s-reporter"}},
+	}
+	tc := TaskConfig{ID: "t1"}
+	for name, cfg := range plugins {
+		tc.Reporters = append(tc.Reporters, ReporterConfig{Name: name, Config: cfg})
+	}
+
+	s, err := NewSnapshot(global, map[string]TaskConfig{"t1": tc})
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s-kafka", "s-command", "s-signing", "s-s3", "s-hep", "s-reporter"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("secret %s not redacted in %s", secret, data)
+		}
+	}
+}
+
+func TestNewSnapshot_Hash(t *testing.T) {
+	global := &GlobalConfig{MaxTasks: 1}
+	global.Kafka.SASL.Password = "initial"
+	tasks := map[string]TaskConfig{"t1": {ID: "t1", Workers: 2}, "t2": {ID: "t2", Workers: 1}}
+
+	a, err := NewSnapshot(global, tasks)
+	if err != nil {
+		t.Fatalf("NewSnapshot: %v", err)
+	}
+	b, _ := NewSnapshot(global, tasks)
+	if a.Hash != b.Hash {
+		t.Errorf("hash not stable: %s vs %s", a.Hash, b.Hash)
+	}
+
+	global.Kafka.SASL.Password = "rotated"
+	if c, _ := NewSnapshot(global, tasks); c.Hash != a.Hash {
+		t.Error("hash changed on a secret-only change")
+	}
+
+	tasks["t2"] = TaskConfig{ID: "t2", Workers: 4}
+	if c, _ := NewSnapshot(global, tasks); c.Hash == a.Hash {
+		t.Error("hash unchanged after a task config change")
+	}
+}
@@ -2,10 +2,18 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/prefilter"
 
 	"gopkg.in/yaml.v3"
 )
@@ -15,13 +23,241 @@ type TaskConfig struct {
 	ID              string                `json:"id" yaml:"id"`
 	Workers         int                   `json:"workers" yaml:"workers"`
 	Capture         CaptureConfig         `json:"capture" yaml:"capture"`
+	ExtraCaptures   []ExtraCaptureConfig  `json:"extra_captures" yaml:"extra_captures"` // more sources into the dispatcher (hybrid capture)
 	Decoder         DecoderConfig         `json:"decoder" yaml:"decoder"`
 	Parsers         []ParserConfig        `json:"parsers" yaml:"parsers"`
 	Processors      []ProcessorConfig     `json:"processors" yaml:"processors"`
 	Reporters       []ReporterConfig      `json:"reporters" yaml:"reporters"`
 	ChannelCapacity ChannelCapacityConfig `json:"channel_capacity" yaml:"channel_capacity"`
+	StopTimeout     string                `json:"stop_timeout" yaml:"stop_timeout"` // Graceful stop deadline (default 30s)
+	Calls           CallsConfig           `json:"calls" yaml:"calls"`
+	Mode            string                `json:"mode" yaml:"mode"` // "" (export) or "analyze_only"
+	Analyze         AnalyzeConfig         `json:"analyze" yaml:"analyze"`
+	TopK            TopKConfig            `json:"top_k" yaml:"top_k"`
+	Counters        CountersConfig        `json:"counters" yaml:"counters"`
+	MediaGap        MediaGapConfig        `json:"media_gap" yaml:"media_gap"`
+	QualityAlerts   QualityAlertsConfig   `json:"quality_alerts" yaml:"quality_alerts"`
+	TCPAnalysis     TCPAnalysisConfig     `json:"tcp_analysis" yaml:"tcp_analysis"`
+	TLSDecryption   TLSDecryptionConfig   `json:"tls_decryption" yaml:"tls_decryption"`
+	RTCPCorrelation RTCPCorrelationConfig `json:"rtcp_correlation" yaml:"rtcp_correlation"`
+	DropPolicy      DropPolicyConfig      `json:"drop_policy" yaml:"drop_policy"`
+	SelfTest        SelfTestConfig        `json:"self_test" yaml:"self_test"`
+	OrderLog        OrderLogConfig        `json:"order_log" yaml:"order_log"`
+	Flags           map[string]bool       `json:"flags,omitempty" yaml:"flags,omitempty"` // initial feature flags (flag_set changes them at runtime)
+	Tags            []string              `json:"tags,omitempty" yaml:"tags,omitempty"`   // groups for bulk commands, e.g. "media", "debug"
+	Registry        string                `json:"registry" yaml:"registry"`               // "task" (default) or "shared"
+	AgentMetadata   bool                  `json:"agent_metadata" yaml:"agent_metadata"`   // stamp agent version, commit and config hash on exported packets
+}
+
+// FlowRegistry scopes (TaskConfig.Registry).
+const (
+	// RegistryTask gives the task its own FlowRegistry.
+	RegistryTask = "task"
+	// RegistryShared uses the agent-wide FlowRegistry, so a signaling task and
+	// a media task on the same host see each other's call context.
+	RegistryShared = "shared"
+)
+
+// SharedRegistry reports whether the task uses the agent-wide FlowRegistry.
+func (tc *TaskConfig) SharedRegistry() bool {
+	return tc.Registry == RegistryShared
+}
+
+// TaskModeAnalyzeOnly runs the full pipeline but replaces reporters with
+// counters, for sizing a deployment before enabling export.
+const TaskModeAnalyzeOnly = "analyze_only"
+
+// AnalyzeOnly reports whether the task counts packets instead of reporting them.
+func (tc *TaskConfig) AnalyzeOnly() bool {
+	return tc.Mode == TaskModeAnalyzeOnly
+}
+
+// HasTags reports whether the task carries all of the given tags.
+func (tc *TaskConfig) HasTags(tags []string) bool {
+	for _, want := range tags {
+		found := false
+		for _, tag := range tc.Tags {
+			if tag == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a short digest of the configuration, which identifies the
+// configuration a task ran with (agent_metadata) without revealing it. Like
+// the config_get hash it is taken after redaction, so secrets cannot be
+// guessed against it.
+func (tc *TaskConfig) Hash() string {
+	m, err := taskConfigMap(*tc)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(redactMap(m))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SetPluginConfig replaces the config of the plugins named name, as
+// task_reconfigure does at runtime. Slices are copied, not changed in place,
+// so copies of tc keep their config.
+func (tc *TaskConfig) SetPluginConfig(name string, cfg map[string]any) {
+	if tc.Capture.Name == name {
+		tc.Capture.Config = cfg
+	}
+	tc.ExtraCaptures = slices.Clone(tc.ExtraCaptures)
+	for i := range tc.ExtraCaptures {
+		if tc.ExtraCaptures[i].Name == name {
+			tc.ExtraCaptures[i].Config = cfg
+		}
+	}
+	tc.Parsers = slices.Clone(tc.Parsers)
+	for i := range tc.Parsers {
+		if tc.Parsers[i].Name == name {
+			tc.Parsers[i].Config = cfg
+		}
+	}
+	tc.Processors = slices.Clone(tc.Processors)
+	for i := range tc.Processors {
+		if tc.Processors[i].Name == name {
+			tc.Processors[i].Config = cfg
+		}
+	}
+	tc.Reporters = slices.Clone(tc.Reporters)
+	for i := range tc.Reporters {
+		if tc.Reporters[i].Name == name {
+			tc.Reporters[i].Config = cfg
+		}
+	}
+}
+
+// AnalyzeConfig selects what an analyze_only task counts besides protocols.
+type AnalyzeConfig struct {
+	Labels    []string `json:"labels" yaml:"labels"`         // label keys whose values are counted
+	MaxValues int      `json:"max_values" yaml:"max_values"` // distinct values per label (default 100)
+}
+
+// TopKConfig selects the keys whose heavy hitters a task tracks (task_topk).
+type TopKConfig struct {
+	Keys     []string `json:"keys" yaml:"keys"`         // label keys, or src_ip / dst_ip; empty = disabled
+	K        int      `json:"k" yaml:"k"`               // heavy hitters reported per key (default 10)
+	Capacity int      `json:"capacity" yaml:"capacity"` // counters per key (default max(10*k, 100))
+}
+
+// CountersConfig controls persistence of a task's packet counters, so
+// lifetime totals survive agent restarts (task_status counters).
+type CountersConfig struct {
+	Persist  bool   `json:"persist" yaml:"persist"`
+	Interval string `json:"interval" yaml:"interval"` // save period, default 1m
+}
+
+// MediaGapConfig enables media_gap events for RTP streams of active calls
+// that stop receiving packets (media timeout / one-way audio).
+type MediaGapConfig struct {
+	Timeout string `json:"timeout" yaml:"timeout"` // silence before an event, e.g. "10s"; empty = disabled
+}
+
+// QualityAlertsConfig raises quality_alert events for calls whose RTCP
+// reception feedback crosses a threshold; zero disables a threshold.
+type QualityAlertsConfig struct {
+	MOSBelow      float64 `json:"mos_below" yaml:"mos_below"`             // estimated MOS (1-4.5)
+	JitterMsAbove float64 `json:"jitter_ms_above" yaml:"jitter_ms_above"` // interarrival jitter (ms)
+	LossPctAbove  float64 `json:"loss_pct_above" yaml:"loss_pct_above"`   // fraction lost (percent)
+	RTTMsAbove    float64 `json:"rtt_ms_above" yaml:"rtt_ms_above"`       // round-trip time (ms)
+	Cooldown      string  `json:"cooldown" yaml:"cooldown"`               // minimum interval between alerts of a call (default 1m)
+}
+
+// Enabled reports whether any threshold is set.
+func (c QualityAlertsConfig) Enabled() bool {
+	return c.MOSBelow > 0 || c.JitterMsAbove > 0 || c.LossPctAbove > 0 || c.RTTMsAbove > 0
+}
+
+// CallsConfig controls the in-memory active-calls table (calls_list / calls_get).
+type CallsConfig struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	MaxCalls    int    `json:"max_calls" yaml:"max_calls"`       // table capacity (default 10000)
+	IdleTimeout string `json:"idle_timeout" yaml:"idle_timeout"` // drop calls without signaling or media (default 5m)
+}
+
+// TCPAnalysisConfig enables tcp.* labels on TCP packets: flags,
+// retransmissions, out-of-order segments and the handshake RTT.
+type TCPAnalysisConfig struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	MaxConns    int    `json:"max_conns" yaml:"max_conns"`       // tracked connections (default 100000)
+	IdleTimeout string `json:"idle_timeout" yaml:"idle_timeout"` // forget idle connections (default 5m)
+}
+
+// TLSDecryptionConfig decrypts TLS on the given TCP ports (SIP over TLS) so
+// the parsers see plaintext. It is enabled by a key log or private keys.
+type TLSDecryptionConfig struct {
+	Ports       []uint16 `json:"ports" yaml:"ports"`               // TCP ports carrying TLS (default [5061])
+	KeyLogFile  string   `json:"keylog_file" yaml:"keylog_file"`   // SSLKEYLOGFILE written by an endpoint
+	PrivateKeys []string `json:"private_keys" yaml:"private_keys"` // PEM RSA server keys (TLS 1.2 RSA key exchange)
+	MaxConns    int      `json:"max_conns" yaml:"max_conns"`       // tracked connections (default 10000)
+	IdleTimeout string   `json:"idle_timeout" yaml:"idle_timeout"` // forget idle connections (default 10m)
+}
+
+// Enabled reports whether a key log or a private key is configured.
+func (c TLSDecryptionConfig) Enabled() bool {
+	return c.KeyLogFile != "" || len(c.PrivateKeys) > 0
+}
+
+// RTCPCorrelationConfig enables the task's RTP stream table: RTCP reports are
+// labeled with the counters of the RTP stream they are about.
+type RTCPCorrelationConfig struct {
+	Enabled     bool   `json:"enabled" yaml:"enabled"`
+	MaxStreams  int    `json:"max_streams" yaml:"max_streams"`   // tracked RTP streams (default 100000)
+	IdleTimeout string `json:"idle_timeout" yaml:"idle_timeout"` // forget idle streams (default 5m)
+}
+
+// OrderLogConfig enables per-pipeline packet order logs for reproducing
+// ordering bugs with "otus replay-order" (debugging only).
+type OrderLogConfig struct {
+	Enabled   bool   `json:"enabled" yaml:"enabled"`
+	Dir       string `json:"dir" yaml:"dir"`                 // required when enabled; <task>-<pipeline>.olog per pipeline
+	MaxSizeMB int    `json:"max_size_mb" yaml:"max_size_mb"` // per pipeline, recording stops when reached (default 256)
+}
+
+// DropPolicyConfig ranks payload types for admission to the send buffer
+// when it backs up, so signaling is not lost to media volume.
+type DropPolicyConfig struct {
+	Enabled   bool     `json:"enabled" yaml:"enabled"`
+	High      []string `json:"high" yaml:"high"`             // wait for space instead of dropping (default ["sip"])
+	Low       []string `json:"low" yaml:"low"`               // shed first (default ["rtp", "raw"])
+	ShedAbove float64  `json:"shed_above" yaml:"shed_above"` // send buffer fill ratio from which low is shed (default 0.8)
+	HighWait  string   `json:"high_wait" yaml:"high_wait"`   // longest wait for one high packet (default 1s)
+}
+
+// SelfTestConfig runs canary packets through the pipelines at task start;
+// the task becomes running only once they reach the sender.
+type SelfTestConfig struct {
+	Enabled bool   `json:"enabled" yaml:"enabled"`
+	Timeout string `json:"timeout" yaml:"timeout"` // wait for the canaries (default 2s)
+	Deliver bool   `json:"deliver" yaml:"deliver"` // also send the canaries to the reporters
 }
 
+// DefaultSelfTestTimeout bounds the self-test when SelfTestConfig.Timeout is unset.
+const DefaultSelfTestTimeout = 2 * time.Second
+
+// Defaults for DropPolicyConfig fields left unset.
+var (
+	DefaultDropPolicyHigh = []string{"sip"}
+	DefaultDropPolicyLow  = []string{"rtp", "raw"}
+)
+
+const (
+	DefaultDropPolicyShedAbove = 0.8
+	DefaultDropPolicyHighWait  = time.Second
+)
+
 // ChannelCapacityConfig allows tuning internal channel buffer sizes.
 type ChannelCapacityConfig struct {
 	RawStream  int `json:"raw_stream" yaml:"raw_stream"`   // per-pipeline input channel (default 1000)
@@ -31,13 +267,50 @@ type ChannelCapacityConfig struct {
 
 // CaptureConfig contains capture plugin configuration.
 type CaptureConfig struct {
-	Name             string         `json:"name" yaml:"name"`
-	DispatchMode     string         `json:"dispatch_mode" yaml:"dispatch_mode"`
-	DispatchStrategy string         `json:"dispatch_strategy" yaml:"dispatch_strategy"` // "flow-hash" (default), "round-robin"
-	Interface        string         `json:"interface" yaml:"interface"`
-	BPFFilter        string         `json:"bpf_filter" yaml:"bpf_filter"`
-	SnapLen          int            `json:"snap_len" yaml:"snap_len"`
-	Config           map[string]any `json:"config" yaml:"config"`
+	Name             string            `json:"name" yaml:"name"`
+	DispatchMode     string            `json:"dispatch_mode" yaml:"dispatch_mode"`
+	DispatchStrategy string            `json:"dispatch_strategy" yaml:"dispatch_strategy"` // "flow-hash" (default), "round-robin"
+	Interface        string            `json:"interface" yaml:"interface"`
+	BPFFilter        string            `json:"bpf_filter" yaml:"bpf_filter"`
+	SnapLen          int               `json:"snap_len" yaml:"snap_len"`
+	AutoFanout       bool              `json:"auto_fanout" yaml:"auto_fanout"`                 // afpacket: set fanout_type "hash" when binding workers have none
+	MaxPPS           uint64            `json:"max_pps,omitempty" yaml:"max_pps,omitempty"`     // packets-per-second cap held by capturers that support it, 0 = none
+	Prefilter        *prefilter.Config `json:"prefilter,omitempty" yaml:"prefilter,omitempty"` // traffic kept in the kernel (afpacket, afxdp)
+	Tuning           TuningConfig      `json:"tuning" yaml:"tuning"`
+	Config           map[string]any    `json:"config" yaml:"config"`
+}
+
+// ExtraCaptureConfig is an additional capturer of a dispatch-mode task, e.g.
+// a pcapstream of remote signaling next to local afpacket media. Its packets
+// share the dispatcher, and so the pipelines, with the main capture.
+type ExtraCaptureConfig struct {
+	Name      string         `json:"name" yaml:"name"`
+	Interface string         `json:"interface" yaml:"interface"` // identifies the source in stats
+	BPFFilter string         `json:"bpf_filter" yaml:"bpf_filter"`
+	SnapLen   int            `json:"snap_len" yaml:"snap_len"` // default: capture.snap_len
+	Config    map[string]any `json:"config" yaml:"config"`
+}
+
+// ToPluginConfig returns the map passed to the capturer's Init(), like
+// CaptureConfig.ToPluginConfig.
+func (c *ExtraCaptureConfig) ToPluginConfig() map[string]any {
+	cc := CaptureConfig{Interface: c.Interface, BPFFilter: c.BPFFilter, SnapLen: c.SnapLen, Config: c.Config}
+	return cc.ToPluginConfig()
+}
+
+// TuningConfig is OS tuning applied when capture starts and reverted when
+// the task stops. Zero values leave a setting alone.
+type TuningConfig struct {
+	BusyPollUS       int    `json:"busy_poll_us" yaml:"busy_poll_us"`             // net.core.busy_poll and busy_read
+	RmemMax          int    `json:"rmem_max" yaml:"rmem_max"`                     // net.core.rmem_max, bytes
+	RmemDefault      int    `json:"rmem_default" yaml:"rmem_default"`             // net.core.rmem_default, bytes
+	NetdevMaxBacklog int    `json:"netdev_max_backlog" yaml:"netdev_max_backlog"` // net.core.netdev_max_backlog
+	RPSCPUs          string `json:"rps_cpus" yaml:"rps_cpus"`                     // hex CPU mask for every RX queue of the interface
+}
+
+// IsZero reports whether no tuning is configured.
+func (c TuningConfig) IsZero() bool {
+	return c == TuningConfig{}
 }
 
 // ToPluginConfig returns the map that should be passed to plugin.Capturer.Init().
@@ -66,16 +339,90 @@ func (c *CaptureConfig) ToPluginConfig() map[string]any {
 	return merged
 }
 
+func (c TuningConfig) validate() error {
+	for name, v := range map[string]int{
+		"busy_poll_us":       c.BusyPollUS,
+		"rmem_max":           c.RmemMax,
+		"rmem_default":       c.RmemDefault,
+		"netdev_max_backlog": c.NetdevMaxBacklog,
+	} {
+		if v < 0 {
+			return fmt.Errorf("%s must be >= 0, got %d", name, v)
+		}
+	}
+	if c.RmemMax > 0 && c.RmemDefault > c.RmemMax {
+		return fmt.Errorf("rmem_default %d exceeds rmem_max %d", c.RmemDefault, c.RmemMax)
+	}
+	if c.RPSCPUs != "" && strings.Trim(c.RPSCPUs, "0123456789abcdefABCDEF,") != "" {
+		return fmt.Errorf("rps_cpus must be a hex CPU mask, got %q", c.RPSCPUs)
+	}
+	return nil
+}
+
 // DecoderConfig contains decoder configuration.
 type DecoderConfig struct {
 	Tunnels      []string `json:"tunnels" yaml:"tunnels"`
+	VXLANPorts   []uint16 `json:"vxlan_ports,omitempty" yaml:"vxlan_ports,omitempty"` // UDP ports carrying VXLAN (default 4789)
 	IPReassembly bool     `json:"ip_reassembly" yaml:"ip_reassembly"`
+	Metadata     []string `json:"metadata,omitempty" yaml:"metadata,omitempty"` // decoded fields carried to processors in OutputPacket.Meta
+
+	// FragmentRateLimit caps the fragments reassembled per source IP;
+	// changeable at runtime through task_reconfigure.
+	FragmentRateLimit FragmentRateLimitConfig `json:"fragment_rate_limit,omitempty" yaml:"fragment_rate_limit,omitempty"`
+}
+
+// FragmentRateLimitConfig limits the IPv4 fragments accepted for reassembly
+// from one source IP per window, against fragment floods.
+type FragmentRateLimitConfig struct {
+	MaxFragsPerIP int    `json:"max_frags_per_ip" yaml:"max_frags_per_ip"` // 0 = no limit
+	Window        string `json:"window" yaml:"window"`                     // Go duration (default 10s)
+}
+
+// Validate checks the limit and the window.
+func (c FragmentRateLimitConfig) Validate() error {
+	if c.MaxFragsPerIP < 0 {
+		return fmt.Errorf("max_frags_per_ip must not be negative")
+	}
+	if c.Window != "" {
+		if d, err := time.ParseDuration(c.Window); err != nil || d <= 0 {
+			return fmt.Errorf("window must be a positive duration, got %q", c.Window)
+		}
+	}
+	return nil
+}
+
+// WindowDuration returns the parsed window, 0 if unset (validated).
+func (c FragmentRateLimitConfig) WindowDuration() time.Duration {
+	d, _ := time.ParseDuration(c.Window)
+	return d
 }
 
 // ParserConfig contains parser plugin configuration.
 type ParserConfig struct {
-	Name   string         `json:"name" yaml:"name"`
-	Config map[string]any `json:"config" yaml:"config"`
+	Name     string                `json:"name" yaml:"name"`
+	Config   map[string]any        `json:"config" yaml:"config"`
+	Shadow   *ShadowParserConfig   `json:"shadow,omitempty" yaml:"shadow,omitempty"`     // candidate compared against this parser
+	Hardened *HardenedParserConfig `json:"hardened,omitempty" yaml:"hardened,omitempty"` // fuzz-resilience mode, nil = off
+}
+
+// HardenedParserConfig runs a parser in hardened mode for traffic that may be
+// malformed on purpose, e.g. from scanners: a panic in the parser drops only
+// the packet, payloads are truncated to MaxPayload before parsing, and the
+// payloads the parser panicked on or that were truncated are kept, redacted,
+// in CorpusDir for offline fuzzing.
+type HardenedParserConfig struct {
+	MaxPayload     int    `json:"max_payload,omitempty" yaml:"max_payload,omitempty"`           // default 65535
+	CorpusDir      string `json:"corpus_dir,omitempty" yaml:"corpus_dir,omitempty"`             // empty = keep no payloads
+	CorpusMaxFiles int    `json:"corpus_max_files,omitempty" yaml:"corpus_max_files,omitempty"` // default 1000
+}
+
+// ShadowParserConfig configures a parser that runs in shadow mode next to a
+// task parser: it sees the same packets, its labels are compared with the task
+// parser's, and its output is discarded.
+type ShadowParserConfig struct {
+	Name         string         `json:"name" yaml:"name"`
+	Config       map[string]any `json:"config" yaml:"config"`
+	IgnoreLabels []string       `json:"ignore_labels,omitempty" yaml:"ignore_labels,omitempty"` // left out of the comparison
 }
 
 // ProcessorConfig contains processor plugin configuration.
@@ -91,6 +438,55 @@ type ReporterConfig struct {
 	BatchSize    int            `json:"batch_size" yaml:"batch_size"`       // Wrapper batch size (default 100)
 	BatchTimeout string         `json:"batch_timeout" yaml:"batch_timeout"` // Wrapper batch timeout (default 50ms)
 	Fallback     string         `json:"fallback" yaml:"fallback"`           // Fallback reporter name (optional)
+	FlushTimeout string         `json:"flush_timeout" yaml:"flush_timeout"` // Flush bound at task stop (default 5s; drain: none)
+
+	// Adaptive batching: batch size moves between min and max with load
+	AdaptiveBatch bool `json:"adaptive_batch" yaml:"adaptive_batch"`
+	MinBatchSize  int  `json:"min_batch_size" yaml:"min_batch_size"` // default batch_size/10
+	MaxBatchSize  int  `json:"max_batch_size" yaml:"max_batch_size"` // default batch_size*10
+
+	Retry RetryConfig `json:"retry" yaml:"retry"`
+
+	Failover *FailoverConfig `json:"failover,omitempty" yaml:"failover,omitempty"` // failover group tier (optional)
+}
+
+// FailoverConfig makes a reporter one tier of a failover group, e.g. the
+// Kafka of the primary datacenter and that of the secondary one. A group
+// sends each batch to one tier only: the first by priority that is
+// healthy. FailAfter applies when traffic leaves the tier, FailbackAfter and
+// ProbeInterval when it returns.
+type FailoverConfig struct {
+	Group         string `json:"group" yaml:"group"`
+	Priority      int    `json:"priority" yaml:"priority"`                                 // lower carries traffic first; unique within the group
+	FailAfter     int    `json:"fail_after,omitempty" yaml:"fail_after,omitempty"`         // consecutive failed batches before the next tier takes over (default 3)
+	FailbackAfter string `json:"failback_after,omitempty" yaml:"failback_after,omitempty"` // time the tier must succeed before traffic returns (default 1m)
+	ProbeInterval string `json:"probe_interval,omitempty" yaml:"probe_interval,omitempty"` // while a lower tier carries traffic, one batch per interval is tried here first (default 10s)
+}
+
+// FailoverGroups returns the indexes in Reporters of the members of each
+// failover group, in priority order.
+func (tc *TaskConfig) FailoverGroups() map[string][]int {
+	groups := make(map[string][]int)
+	for i, rc := range tc.Reporters {
+		if rc.Failover != nil {
+			groups[rc.Failover.Group] = append(groups[rc.Failover.Group], i)
+		}
+	}
+	for _, members := range groups {
+		slices.SortStableFunc(members, func(a, b int) int {
+			return tc.Reporters[a].Failover.Priority - tc.Reporters[b].Failover.Priority
+		})
+	}
+	return groups
+}
+
+// RetryConfig controls retries of failed reporter calls (ReportBatch, or
+// Report per packet). Errors marked permanent by the reporter are not retried.
+type RetryConfig struct {
+	MaxAttempts    int     `json:"max_attempts" yaml:"max_attempts"`       // total attempts (default 1 = no retry)
+	InitialBackoff string  `json:"initial_backoff" yaml:"initial_backoff"` // delay before first retry (default 100ms)
+	MaxBackoff     string  `json:"max_backoff" yaml:"max_backoff"`         // cap for the doubling delay (default 5s)
+	Jitter         float64 `json:"jitter" yaml:"jitter"`                   // random fraction removed from each delay, 0..1 (default 0.2)
 }
 
 // Validate validates task configuration.
@@ -108,6 +504,9 @@ func (tc *TaskConfig) Validate() error {
 	}
 	if tc.Capture.DispatchMode == "" {
 		tc.Capture.DispatchMode = "binding" // Default to binding
+		if len(tc.ExtraCaptures) > 0 {
+			tc.Capture.DispatchMode = "dispatch" // extra captures feed the dispatcher
+		}
 	}
 	if tc.Capture.DispatchMode != "binding" && tc.Capture.DispatchMode != "dispatch" {
 		return fmt.Errorf("capture dispatch_mode must be 'binding' or 'dispatch', got %q", tc.Capture.DispatchMode)
@@ -118,9 +517,186 @@ func (tc *TaskConfig) Validate() error {
 	if tc.Capture.SnapLen <= 0 {
 		tc.Capture.SnapLen = 65535 // Default snap length
 	}
+	if err := tc.Capture.Tuning.validate(); err != nil {
+		return fmt.Errorf("capture.tuning: %w", err)
+	}
+	if tc.Capture.Prefilter != nil {
+		if _, err := tc.Capture.Prefilter.Rules(); err != nil {
+			return fmt.Errorf("capture.%w", err)
+		}
+	}
+	if len(tc.ExtraCaptures) > 0 && tc.Capture.DispatchMode != "dispatch" {
+		return fmt.Errorf("extra_captures require capture dispatch_mode 'dispatch'")
+	}
+	for i := range tc.ExtraCaptures {
+		ec := &tc.ExtraCaptures[i]
+		if ec.Name == "" {
+			return fmt.Errorf("extra_captures[%d]: name is required", i)
+		}
+		if ec.Interface == "" {
+			return fmt.Errorf("extra_captures[%d]: interface is required", i)
+		}
+		if ec.SnapLen <= 0 {
+			ec.SnapLen = tc.Capture.SnapLen
+		}
+	}
 
-	// At least one reporter is required
-	if len(tc.Reporters) == 0 {
+	if _, err := core.ParseMetaFields(tc.Decoder.Metadata); err != nil {
+		return fmt.Errorf("decoder.metadata: %w", err)
+	}
+	for _, port := range tc.Decoder.VXLANPorts {
+		if port == 0 {
+			return fmt.Errorf("decoder.vxlan_ports: port must be 1-65535")
+		}
+	}
+	if err := tc.Decoder.FragmentRateLimit.Validate(); err != nil {
+		return fmt.Errorf("decoder.fragment_rate_limit: %w", err)
+	}
+	if tc.Decoder.FragmentRateLimit.MaxFragsPerIP > 0 && !tc.Decoder.IPReassembly {
+		return fmt.Errorf("decoder.fragment_rate_limit requires decoder.ip_reassembly")
+	}
+
+	if tc.StopTimeout != "" {
+		if d, err := time.ParseDuration(tc.StopTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("stop_timeout must be a positive duration, got %q", tc.StopTimeout)
+		}
+	}
+
+	if tc.Calls.MaxCalls < 0 {
+		return fmt.Errorf("calls.max_calls must be >= 0, got %d", tc.Calls.MaxCalls)
+	}
+	if tc.Calls.IdleTimeout != "" {
+		if d, err := time.ParseDuration(tc.Calls.IdleTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("calls.idle_timeout must be a positive duration, got %q", tc.Calls.IdleTimeout)
+		}
+	}
+
+	if tc.Counters.Interval != "" {
+		if d, err := time.ParseDuration(tc.Counters.Interval); err != nil || d <= 0 {
+			return fmt.Errorf("counters.interval must be a positive duration, got %q", tc.Counters.Interval)
+		}
+	}
+
+	if tc.MediaGap.Timeout != "" {
+		if d, err := time.ParseDuration(tc.MediaGap.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("media_gap.timeout must be a positive duration, got %q", tc.MediaGap.Timeout)
+		}
+	}
+
+	if qa := tc.QualityAlerts; qa.MOSBelow < 0 || qa.MOSBelow > 4.5 {
+		return fmt.Errorf("quality_alerts.mos_below must be between 0 and 4.5, got %v", qa.MOSBelow)
+	} else if qa.JitterMsAbove < 0 || qa.LossPctAbove < 0 || qa.RTTMsAbove < 0 {
+		return fmt.Errorf("quality_alerts thresholds must be >= 0")
+	}
+	if tc.QualityAlerts.Cooldown != "" {
+		if d, err := time.ParseDuration(tc.QualityAlerts.Cooldown); err != nil || d <= 0 {
+			return fmt.Errorf("quality_alerts.cooldown must be a positive duration, got %q", tc.QualityAlerts.Cooldown)
+		}
+	}
+
+	if tc.TCPAnalysis.MaxConns < 0 {
+		return fmt.Errorf("tcp_analysis.max_conns must be >= 0, got %d", tc.TCPAnalysis.MaxConns)
+	}
+	if tc.TCPAnalysis.IdleTimeout != "" {
+		if d, err := time.ParseDuration(tc.TCPAnalysis.IdleTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("tcp_analysis.idle_timeout must be a positive duration, got %q", tc.TCPAnalysis.IdleTimeout)
+		}
+	}
+
+	for _, port := range tc.TLSDecryption.Ports {
+		if port == 0 {
+			return fmt.Errorf("tls_decryption.ports must not contain 0")
+		}
+	}
+	if tc.TLSDecryption.MaxConns < 0 {
+		return fmt.Errorf("tls_decryption.max_conns must be >= 0, got %d", tc.TLSDecryption.MaxConns)
+	}
+	if tc.TLSDecryption.IdleTimeout != "" {
+		if d, err := time.ParseDuration(tc.TLSDecryption.IdleTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("tls_decryption.idle_timeout must be a positive duration, got %q", tc.TLSDecryption.IdleTimeout)
+		}
+	}
+
+	if tc.RTCPCorrelation.MaxStreams < 0 {
+		return fmt.Errorf("rtcp_correlation.max_streams must be >= 0, got %d", tc.RTCPCorrelation.MaxStreams)
+	}
+	if tc.RTCPCorrelation.IdleTimeout != "" {
+		if d, err := time.ParseDuration(tc.RTCPCorrelation.IdleTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("rtcp_correlation.idle_timeout must be a positive duration, got %q", tc.RTCPCorrelation.IdleTimeout)
+		}
+	}
+
+	if tc.OrderLog.Enabled && tc.OrderLog.Dir == "" {
+		return fmt.Errorf("order_log.dir is required when order_log is enabled")
+	}
+	if tc.OrderLog.MaxSizeMB < 0 {
+		return fmt.Errorf("order_log.max_size_mb must be >= 0, got %d", tc.OrderLog.MaxSizeMB)
+	}
+
+	for name := range tc.Flags {
+		if !featureflag.Valid(name) {
+			return fmt.Errorf("flags: unknown feature flag %q (known: %v)", name, featureflag.Names())
+		}
+	}
+
+	if dp := &tc.DropPolicy; dp.Enabled {
+		if dp.ShedAbove < 0 || dp.ShedAbove > 1 {
+			return fmt.Errorf("drop_policy.shed_above must be in (0, 1], got %v", dp.ShedAbove)
+		}
+		if dp.HighWait != "" {
+			if d, err := time.ParseDuration(dp.HighWait); err != nil || d <= 0 {
+				return fmt.Errorf("drop_policy.high_wait must be a positive duration, got %q", dp.HighWait)
+			}
+		}
+		high := make(map[string]bool, len(dp.High))
+		for _, t := range dp.High {
+			high[t] = true
+		}
+		for _, t := range dp.Low {
+			if high[t] {
+				return fmt.Errorf("drop_policy: payload type %q is both high and low", t)
+			}
+		}
+	}
+
+	if tc.SelfTest.Timeout != "" {
+		if d, err := time.ParseDuration(tc.SelfTest.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("self_test.timeout must be a positive duration, got %q", tc.SelfTest.Timeout)
+		}
+	}
+
+	if tc.TopK.K < 0 || tc.TopK.Capacity < 0 {
+		return fmt.Errorf("top_k.k and top_k.capacity must be >= 0")
+	}
+	for i, key := range tc.TopK.Keys {
+		if key == "" {
+			return fmt.Errorf("top_k.keys[%d]: must not be empty", i)
+		}
+	}
+
+	switch tc.Mode {
+	case "", TaskModeAnalyzeOnly:
+	default:
+		return fmt.Errorf("invalid mode %q (must be empty or %q)", tc.Mode, TaskModeAnalyzeOnly)
+	}
+	if tc.Analyze.MaxValues < 0 {
+		return fmt.Errorf("analyze.max_values must be >= 0, got %d", tc.Analyze.MaxValues)
+	}
+
+	switch tc.Registry {
+	case "", RegistryTask, RegistryShared:
+	default:
+		return fmt.Errorf("invalid registry %q (must be %q or %q)", tc.Registry, RegistryTask, RegistryShared)
+	}
+
+	for i, tag := range tc.Tags {
+		if tag == "" {
+			return fmt.Errorf("tags[%d]: must not be empty", i)
+		}
+	}
+
+	// At least one reporter is required, except when packets are only counted
+	if len(tc.Reporters) == 0 && !tc.AnalyzeOnly() {
 		return fmt.Errorf("at least one reporter is required")
 	}
 
@@ -129,6 +705,22 @@ func (tc *TaskConfig) Validate() error {
 		if parser.Name == "" {
 			return fmt.Errorf("parser[%d]: name is required", i)
 		}
+		if sh := parser.Shadow; sh != nil {
+			if sh.Name == "" {
+				return fmt.Errorf("parser[%d]: shadow name is required", i)
+			}
+			if sh.Name == parser.Name {
+				return fmt.Errorf("parser[%d]: shadow must be a different parser than %q", i, parser.Name)
+			}
+		}
+		if h := parser.Hardened; h != nil {
+			if h.MaxPayload < 0 {
+				return fmt.Errorf("parser[%d]: hardened.max_payload must be >= 0, got %d", i, h.MaxPayload)
+			}
+			if h.CorpusMaxFiles < 0 {
+				return fmt.Errorf("parser[%d]: hardened.corpus_max_files must be >= 0, got %d", i, h.CorpusMaxFiles)
+			}
+		}
 	}
 
 	// Validate processor configs
@@ -140,11 +732,104 @@ func (tc *TaskConfig) Validate() error {
 
 	// Validate reporter configs
 	for i, reporter := range tc.Reporters {
-		if reporter.Name == "" {
-			return fmt.Errorf("reporter[%d]: name is required", i)
+		if err := reporter.Validate(); err != nil {
+			return fmt.Errorf("reporter[%d]: %w", i, err)
+		}
+	}
+	for group, members := range tc.FailoverGroups() {
+		if len(members) < 2 {
+			return fmt.Errorf("reporter[%d]: failover group %q has a single reporter", members[0], group)
+		}
+		for j, i := range members[1:] {
+			prev := tc.Reporters[members[j]].Failover.Priority
+			if tc.Reporters[i].Failover.Priority == prev {
+				return fmt.Errorf("reporter[%d]: failover group %q has two reporters with priority %d", i, group, prev)
+			}
+			if tc.Reporters[i].Fallback != "" {
+				return fmt.Errorf("reporter[%d]: fallback of failover group %q must be set on its first tier", i, group)
+			}
+			if tc.Reporters[i].hasBatchSettings() {
+				return fmt.Errorf("reporter[%d]: batch and retry settings of failover group %q must be set on its first tier", i, group)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasBatchSettings reports whether rc sets any batching or retry setting.
+// A failover group runs with those of its first tier.
+func (rc *ReporterConfig) hasBatchSettings() bool {
+	return rc.BatchSize != 0 || rc.BatchTimeout != "" || rc.AdaptiveBatch ||
+		rc.MinBatchSize != 0 || rc.MaxBatchSize != 0 || rc.Retry != (RetryConfig{})
+}
+
+// Validate validates a reporter configuration.
+func (rc *ReporterConfig) Validate() error {
+	if rc.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if rc.MinBatchSize < 0 || rc.MaxBatchSize < 0 {
+		return fmt.Errorf("min_batch_size and max_batch_size must be >= 0")
+	}
+	if rc.MaxBatchSize > 0 && rc.MinBatchSize > rc.MaxBatchSize {
+		return fmt.Errorf("min_batch_size %d exceeds max_batch_size %d", rc.MinBatchSize, rc.MaxBatchSize)
+	}
+	if rc.FlushTimeout != "" {
+		if d, err := time.ParseDuration(rc.FlushTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("flush_timeout must be a positive duration, got %q", rc.FlushTimeout)
+		}
+	}
+	if err := rc.Retry.validate(); err != nil {
+		return fmt.Errorf("retry.%w", err)
+	}
+	if rc.Failover != nil {
+		if err := rc.Failover.validate(); err != nil {
+			return fmt.Errorf("failover.%w", err)
+		}
+	}
+	return nil
+}
+
+func (fc *FailoverConfig) validate() error {
+	if fc.Group == "" {
+		return fmt.Errorf("group is required")
+	}
+	if fc.FailAfter < 0 {
+		return fmt.Errorf("fail_after must be >= 0, got %d", fc.FailAfter)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"failback_after", fc.FailbackAfter},
+		{"probe_interval", fc.ProbeInterval},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", f.name, f.value)
 		}
 	}
+	return nil
+}
 
+func (rc *RetryConfig) validate() error {
+	if rc.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts must be >= 0, got %d", rc.MaxAttempts)
+	}
+	for _, f := range []struct{ name, value string }{
+		{"initial_backoff", rc.InitialBackoff},
+		{"max_backoff", rc.MaxBackoff},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(f.value); err != nil || d <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %q", f.name, f.value)
+		}
+	}
+	if rc.Jitter < 0 || rc.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1, got %v", rc.Jitter)
+	}
 	return nil
 }
 
@@ -2,7 +2,9 @@ package config
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseValidTaskConfig(t *testing.T) {
@@ -225,6 +227,24 @@ func TestParseInvalidDispatchMode(t *testing.T) {
 	}
 }
 
+func TestParseInvalidCallsConfig(t *testing.T) {
+	for _, calls := range []string{
+		`{"enabled": true, "max_calls": -1}`,
+		`{"enabled": true, "idle_timeout": "soon"}`,
+	} {
+		configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [{"name": "console"}],
+		"calls": ` + calls + `
+	}`
+
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for calls config %s, got nil", calls)
+		}
+	}
+}
+
 func TestParseDefaultWorkers(t *testing.T) {
 	configJSON := `{
 		"id": "test-task",
@@ -444,3 +464,592 @@ func TestCaptureConfig_ToPluginConfig_EmptyInterfaceOmitted(t *testing.T) {
 		t.Error("expected 'interface' key to be absent when Interface is empty")
 	}
 }
+
+func TestParseAnalyzeOnlyConfig(t *testing.T) {
+	configJSON := `{
+		"id": "sizing",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"mode": "analyze_only",
+		"analyze": {"labels": ["sip.method"], "max_values": 50}
+	}`
+
+	tc, err := ParseTaskConfig([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("analyze_only without reporters should be valid: %v", err)
+	}
+	if !tc.AnalyzeOnly() || tc.Analyze.MaxValues != 50 || len(tc.Analyze.Labels) != 1 {
+		t.Errorf("unexpected analyze config: mode=%q analyze=%+v", tc.Mode, tc.Analyze)
+	}
+
+	for _, extra := range []string{
+		`"mode": "dry_run", "reporters": [{"name": "console"}]`,
+		`"mode": "analyze_only", "analyze": {"max_values": -1}`,
+	} {
+		configJSON := `{"id": "sizing", "capture": {"name": "afpacket", "interface": "eth0"}, ` + extra + `}`
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for %s, got nil", extra)
+		}
+	}
+}
+
+func TestParseInvalidAdaptiveBatch(t *testing.T) {
+	for _, reporter := range []string{
+		`{"name": "kafka", "adaptive_batch": true, "min_batch_size": -1}`,
+		`{"name": "kafka", "adaptive_batch": true, "min_batch_size": 500, "max_batch_size": 100}`,
+	} {
+		configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [` + reporter + `]
+	}`
+
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for reporter %s, got nil", reporter)
+		}
+	}
+}
+
+func TestParseInvalidRetryConfig(t *testing.T) {
+	for _, retry := range []string{
+		`{"max_attempts": -1}`,
+		`{"max_attempts": 3, "initial_backoff": "soon"}`,
+		`{"max_attempts": 3, "max_backoff": "-1s"}`,
+		`{"max_attempts": 3, "jitter": 1.5}`,
+	} {
+		configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [{"name": "kafka", "retry": ` + retry + `}]
+	}`
+
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for retry config %s, got nil", retry)
+		}
+	}
+}
+
+func TestParseReporterFlushTimeout(t *testing.T) {
+	configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [{"name": "kafka", "flush_timeout": "30s"}]
+	}`
+
+	tc, err := ParseTaskConfig([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if tc.Reporters[0].FlushTimeout != "30s" {
+		t.Errorf("flush_timeout = %q, want 30s", tc.Reporters[0].FlushTimeout)
+	}
+
+	for _, timeout := range []string{`"0s"`, `"later"`} {
+		configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [{"name": "kafka", "flush_timeout": ` + timeout + `}]
+	}`
+
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for flush_timeout %s, got nil", timeout)
+		}
+	}
+}
+
+func TestParseReporterFailoverGroups(t *testing.T) {
+	configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [
+			{"name": "kafka", "failover": {"group": "dc", "priority": 2}},
+			{"name": "console"},
+			{"name": "kafka", "fallback": "console", "failover": {"group": "dc", "priority": 1, "failback_after": "5m"}}
+		]
+	}`
+
+	tc, err := ParseTaskConfig([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	groups := tc.FailoverGroups()
+	if len(groups) != 1 || len(groups["dc"]) != 2 || groups["dc"][0] != 2 || groups["dc"][1] != 0 {
+		t.Errorf("FailoverGroups() = %v, want dc: [2 0]", groups)
+	}
+
+	for _, reporters := range []string{
+		`{"name": "kafka", "failover": {"group": "dc"}}`,
+		`{"name": "kafka", "failover": {"group": "dc"}}, {"name": "hep", "failover": {"group": "dc"}}`,
+		`{"name": "kafka", "failover": {"group": "dc"}}, {"name": "hep", "fallback": "x", "failover": {"group": "dc", "priority": 1}}`,
+		`{"name": "kafka", "failover": {"priority": 1}}, {"name": "hep", "failover": {"priority": 2}}`,
+		`{"name": "kafka", "failover": {"group": "dc", "probe_interval": "0s"}}, {"name": "hep", "failover": {"group": "dc", "priority": 1}}`,
+		`{"name": "kafka", "failover": {"group": "dc"}}, {"name": "hep", "batch_size": 10, "failover": {"group": "dc", "priority": 1}}`,
+		`{"name": "kafka", "failover": {"group": "dc"}}, {"name": "hep", "retry": {"max_attempts": 3}, "failover": {"group": "dc", "priority": 1}}`,
+	} {
+		configJSON := `{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [` + reporters + `]
+	}`
+
+		if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+			t.Errorf("Expected error for reporters %s, got nil", reporters)
+		}
+	}
+}
+
+func TestTaskConfigHash(t *testing.T) {
+	a := TaskConfig{ID: "a", Workers: 2, Tags: []string{"media"}}
+	b := a
+	if a.Hash() != b.Hash() || len(a.Hash()) != 16 {
+		t.Errorf("Hash() = %q and %q, want the same 16 hex digits", a.Hash(), b.Hash())
+	}
+	b.Workers = 4
+	if a.Hash() == b.Hash() {
+		t.Error("Hash() unchanged after a config change")
+	}
+
+	// secrets are redacted before hashing
+	a.Reporters = []ReporterConfig{{Name: "hep", Config: map[string]any{"auth_key": "one"}}}
+	b = a
+	b.SetPluginConfig("hep", map[string]any{"auth_key": "two"})
+	if a.Hash() != b.Hash() {
+		t.Error("Hash() changed after a secret change")
+	}
+	b.SetPluginConfig("hep", map[string]any{"auth_key": "two", "node_id": 7})
+	if a.Hash() == b.Hash() {
+		t.Error("Hash() unchanged after a plugin config change")
+	}
+	if a.Reporters[0].Config["auth_key"] != "one" {
+		t.Errorf("SetPluginConfig changed a copy: %v", a.Reporters[0].Config)
+	}
+}
+
+func TestParseTaskTags(t *testing.T) {
+	configJSON := `{
+		"id": "media-01",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"reporters": [{"name": "console"}],
+		"tags": ["media", "site-a"]
+	}`
+
+	tc, err := ParseTaskConfig([]byte(configJSON))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.HasTags([]string{"media"}) || !tc.HasTags([]string{"site-a", "media"}) || !tc.HasTags(nil) {
+		t.Errorf("HasTags: expected match for %v", tc.Tags)
+	}
+	if tc.HasTags([]string{"media", "debug"}) {
+		t.Error("HasTags: all tags must match")
+	}
+
+	configJSON = `{"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}], "tags": [""]}`
+	if _, err := ParseTaskConfig([]byte(configJSON)); err == nil {
+		t.Error("Expected error for empty tag, got nil")
+	}
+}
+
+func TestParseTaskRegistry(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "registry": "shared"}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.SharedRegistry() {
+		t.Error("expected shared registry")
+	}
+
+	if _, err := ParseTaskConfig([]byte(`{` + base + `, "registry": "global"}`)); err == nil {
+		t.Error("Expected error for invalid registry, got nil")
+	}
+}
+
+func TestParseShadowParser(t *testing.T) {
+	parse := func(parser string) (*TaskConfig, error) {
+		return ParseTaskConfig([]byte(`{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"parsers": [` + parser + `],
+		"reporters": [{"name": "kafka"}]
+	}`))
+	}
+
+	tc, err := parse(`{"name": "sip", "shadow": {"name": "sip2", "config": {"strict": true}, "ignore_labels": ["sip.user_agent"]}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse task config: %v", err)
+	}
+	if sh := tc.Parsers[0].Shadow; sh == nil || sh.Name != "sip2" || sh.Config["strict"] != true || len(sh.IgnoreLabels) != 1 {
+		t.Errorf("Shadow = %+v", sh)
+	}
+
+	for _, parser := range []string{
+		`{"name": "sip", "shadow": {}}`,
+		`{"name": "sip", "shadow": {"name": "sip"}}`,
+	} {
+		if _, err := parse(parser); err == nil {
+			t.Errorf("Expected error for parser %s, got nil", parser)
+		}
+	}
+}
+
+func TestParseHardenedParser(t *testing.T) {
+	parse := func(parser string) (*TaskConfig, error) {
+		return ParseTaskConfig([]byte(`{
+		"id": "test-task",
+		"capture": {"name": "afpacket", "interface": "eth0"},
+		"parsers": [` + parser + `],
+		"reporters": [{"name": "kafka"}]
+	}`))
+	}
+
+	tc, err := parse(`{"name": "sip", "hardened": {"max_payload": 8192, "corpus_dir": "/tmp/corpus"}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse task config: %v", err)
+	}
+	if h := tc.Parsers[0].Hardened; h == nil || h.MaxPayload != 8192 || h.CorpusDir != "/tmp/corpus" || h.CorpusMaxFiles != 0 {
+		t.Errorf("Hardened = %+v", h)
+	}
+
+	tc, err = parse(`{"name": "sip", "hardened": {}}`)
+	if err != nil {
+		t.Fatalf("Failed to parse task config: %v", err)
+	}
+	if tc.Parsers[0].Hardened == nil {
+		t.Error("empty hardened object should enable hardened mode")
+	}
+
+	for _, parser := range []string{
+		`{"name": "sip", "hardened": {"max_payload": -1}}`,
+		`{"name": "sip", "hardened": {"corpus_max_files": -1}}`,
+	} {
+		if _, err := parse(parser); err == nil {
+			t.Errorf("Expected error for parser %s, got nil", parser)
+		}
+	}
+}
+
+func TestParseTaskTopK(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "top_k": {"keys": ["sip.user_agent", "src_ip"], "k": 20}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if len(tc.TopK.Keys) != 2 || tc.TopK.K != 20 || tc.TopK.Capacity != 0 {
+		t.Errorf("TopK = %+v", tc.TopK)
+	}
+
+	for _, topK := range []string{
+		`{"keys": ["sip.user_agent", ""]}`,
+		`{"keys": ["src_ip"], "k": -1}`,
+		`{"keys": ["src_ip"], "capacity": -5}`,
+	} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "top_k": ` + topK + `}`)); err == nil {
+			t.Errorf("Expected error for top_k %s, got nil", topK)
+		}
+	}
+}
+
+func TestParseTaskCounters(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "counters": {"persist": true, "interval": "30s"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.Counters.Persist || tc.Counters.Interval != "30s" {
+		t.Errorf("Counters = %+v", tc.Counters)
+	}
+
+	if _, err := ParseTaskConfig([]byte(`{` + base + `, "counters": {"persist": true, "interval": "0s"}}`)); err == nil {
+		t.Error("Expected error for zero counters.interval, got nil")
+	}
+}
+
+func TestParseTaskMediaGap(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "media_gap": {"timeout": "10s"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if tc.MediaGap.Timeout != "10s" {
+		t.Errorf("MediaGap = %+v", tc.MediaGap)
+	}
+
+	for _, timeout := range []string{"0s", "-1s", "soon"} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "media_gap": {"timeout": "` + timeout + `"}}`)); err == nil {
+			t.Errorf("Expected error for media_gap.timeout %q, got nil", timeout)
+		}
+	}
+}
+
+func TestParseTaskQualityAlerts(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "quality_alerts": {"mos_below": 3.5, "loss_pct_above": 5, "cooldown": "30s"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.QualityAlerts.Enabled() || tc.QualityAlerts.MOSBelow != 3.5 || tc.QualityAlerts.LossPctAbove != 5 {
+		t.Errorf("QualityAlerts = %+v", tc.QualityAlerts)
+	}
+
+	for _, qa := range []string{`{"mos_below": 5}`, `{"jitter_ms_above": -1}`, `{"mos_below": 3, "cooldown": "0s"}`} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "quality_alerts": ` + qa + `}`)); err == nil {
+			t.Errorf("Expected error for quality_alerts %s, got nil", qa)
+		}
+	}
+}
+
+func TestParseTaskDecoderMetadata(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": {"metadata": ["ttl", "tcp_flags", "vlan"]}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if len(tc.Decoder.Metadata) != 3 {
+		t.Errorf("Decoder = %+v", tc.Decoder)
+	}
+
+	if _, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": {"metadata": ["dscp"]}}`)); err == nil {
+		t.Error("Expected error for unknown decoder.metadata field, got nil")
+	}
+}
+
+func TestParseTaskVXLANPorts(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": {"tunnels": ["vxlan"], "vxlan_ports": [4789, 8472]}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if len(tc.Decoder.VXLANPorts) != 2 || tc.Decoder.VXLANPorts[1] != 8472 {
+		t.Errorf("vxlan_ports = %v", tc.Decoder.VXLANPorts)
+	}
+
+	for _, ports := range []string{`[0]`, `[70000]`} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": {"vxlan_ports": ` + ports + `}}`)); err == nil {
+			t.Errorf("Expected error for vxlan_ports %s, got nil", ports)
+		}
+	}
+}
+
+func TestParseTaskFragmentRateLimit(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": {"ip_reassembly": true, "fragment_rate_limit": {"max_frags_per_ip": 500, "window": "5s"}}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if frl := tc.Decoder.FragmentRateLimit; frl.MaxFragsPerIP != 500 || frl.WindowDuration() != 5*time.Second {
+		t.Errorf("fragment_rate_limit = %+v", frl)
+	}
+
+	for _, decoder := range []string{
+		`{"ip_reassembly": true, "fragment_rate_limit": {"max_frags_per_ip": -1}}`,
+		`{"ip_reassembly": true, "fragment_rate_limit": {"max_frags_per_ip": 10, "window": "0s"}}`,
+		`{"fragment_rate_limit": {"max_frags_per_ip": 10}}`,
+	} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "decoder": ` + decoder + `}`)); err == nil {
+			t.Errorf("Expected error for decoder %s, got nil", decoder)
+		}
+	}
+}
+
+func TestParseTaskTCPAnalysis(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "tcp_analysis": {"enabled": true, "max_conns": 5000, "idle_timeout": "2m"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.TCPAnalysis.Enabled || tc.TCPAnalysis.MaxConns != 5000 {
+		t.Errorf("TCPAnalysis = %+v", tc.TCPAnalysis)
+	}
+
+	for _, bad := range []string{`{"max_conns": -1}`, `{"idle_timeout": "0s"}`, `{"idle_timeout": "later"}`} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "tcp_analysis": ` + bad + `}`)); err == nil {
+			t.Errorf("Expected error for tcp_analysis %s, got nil", bad)
+		}
+	}
+}
+
+func TestParseTaskTLSDecryption(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "tls_decryption": {"ports": [5061, 5062], "keylog_file": "/var/log/sbc/sslkeys.log", "idle_timeout": "2m"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.TLSDecryption.Enabled() || len(tc.TLSDecryption.Ports) != 2 {
+		t.Errorf("TLSDecryption = %+v", tc.TLSDecryption)
+	}
+
+	for _, bad := range []string{`{"ports": [0]}`, `{"max_conns": -1}`, `{"idle_timeout": "0s"}`} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "tls_decryption": ` + bad + `}`)); err == nil {
+			t.Errorf("Expected error for tls_decryption %s, got nil", bad)
+		}
+	}
+}
+
+func TestParseTaskOrderLog(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "order_log": {"enabled": true, "dir": "/tmp/olog", "max_size_mb": 16}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.OrderLog.Enabled || tc.OrderLog.Dir != "/tmp/olog" || tc.OrderLog.MaxSizeMB != 16 {
+		t.Errorf("OrderLog = %+v", tc.OrderLog)
+	}
+
+	for _, bad := range []string{`{"enabled": true}`, `{"max_size_mb": -1}`} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "order_log": ` + bad + `}`)); err == nil {
+			t.Errorf("Expected error for order_log %s, got nil", bad)
+		}
+	}
+}
+
+func TestParseTaskFlags(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "flags": {"zero_copy": false}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if on, ok := tc.Flags["zero_copy"]; !ok || on {
+		t.Errorf("Flags = %v", tc.Flags)
+	}
+
+	if _, err := ParseTaskConfig([]byte(`{` + base + `, "flags": {"zero_kopy": false}}`)); err == nil {
+		t.Error("Expected error for an unknown flag, got nil")
+	}
+}
+
+func TestParseTaskDropPolicy(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "drop_policy": {"enabled": true, "high": ["sip", "cdr"], "shed_above": 0.7}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.DropPolicy.Enabled || len(tc.DropPolicy.High) != 2 || tc.DropPolicy.ShedAbove != 0.7 {
+		t.Errorf("DropPolicy = %+v", tc.DropPolicy)
+	}
+
+	for _, bad := range []string{
+		`{"enabled": true, "shed_above": 1.5}`,
+		`{"enabled": true, "high_wait": "0s"}`,
+		`{"enabled": true, "high": ["sip"], "low": ["sip"]}`,
+	} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "drop_policy": ` + bad + `}`)); err == nil {
+			t.Errorf("Expected error for drop_policy %s, got nil", bad)
+		}
+	}
+}
+
+func TestParseTaskSelfTest(t *testing.T) {
+	base := `"id": "t", "capture": {"name": "afpacket", "interface": "eth0"}, "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "self_test": {"enabled": true, "timeout": "5s"}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if !tc.SelfTest.Enabled || tc.SelfTest.Timeout != "5s" || tc.SelfTest.Deliver {
+		t.Errorf("SelfTest = %+v", tc.SelfTest)
+	}
+
+	for _, timeout := range []string{"0s", "soon"} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "self_test": {"enabled": true, "timeout": "` + timeout + `"}}`)); err == nil {
+			t.Errorf("Expected error for self_test.timeout %q, got nil", timeout)
+		}
+	}
+}
+
+func TestParseTaskTuning(t *testing.T) {
+	base := `"id": "t", "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "capture": {"name": "afpacket", "interface": "eth0",
+		"tuning": {"busy_poll_us": 50, "rmem_max": 33554432, "rps_cpus": "ff,00000000"}}}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if want := (TuningConfig{BusyPollUS: 50, RmemMax: 33554432, RPSCPUs: "ff,00000000"}); tc.Capture.Tuning != want {
+		t.Errorf("Tuning = %+v, want %+v", tc.Capture.Tuning, want)
+	}
+
+	for _, tuning := range []string{
+		`{"busy_poll_us": -1}`,
+		`{"rmem_max": 1024, "rmem_default": 4096}`,
+		`{"rps_cpus": "0-3"}`,
+	} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, "capture": {"name": "afpacket", "interface": "eth0", "tuning": ` + tuning + `}}`)); err == nil {
+			t.Errorf("Expected error for capture.tuning %s, got nil", tuning)
+		}
+	}
+}
+
+func TestParseTaskExtraCaptures(t *testing.T) {
+	base := `"id": "t", "reporters": [{"name": "console"}]`
+
+	tc, err := ParseTaskConfig([]byte(`{` + base + `, "capture": {"name": "afpacket", "interface": "eth0", "snap_len": 1500},
+		"extra_captures": [{"name": "pcapstream", "interface": "remote-sbc", "config": {"path": "/run/otus/sbc.fifo"}}]}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if tc.Capture.DispatchMode != "dispatch" {
+		t.Errorf("DispatchMode = %q, want dispatch by default with extra_captures", tc.Capture.DispatchMode)
+	}
+	ec := tc.ExtraCaptures[0]
+	if ec.SnapLen != 1500 {
+		t.Errorf("extra SnapLen = %d, want capture.snap_len 1500", ec.SnapLen)
+	}
+	if pc := ec.ToPluginConfig(); pc["interface"] != "remote-sbc" || pc["path"] != "/run/otus/sbc.fifo" || pc["snap_len"] != float64(1500) {
+		t.Errorf("ToPluginConfig = %v", pc)
+	}
+
+	for _, bad := range []string{
+		`"capture": {"name": "afpacket", "interface": "eth0", "dispatch_mode": "binding"}, "extra_captures": [{"name": "pcapstream", "interface": "x"}]`,
+		`"capture": {"name": "afpacket", "interface": "eth0"}, "extra_captures": [{"interface": "x"}]`,
+		`"capture": {"name": "afpacket", "interface": "eth0"}, "extra_captures": [{"name": "pcapstream"}]`,
+	} {
+		if _, err := ParseTaskConfig([]byte(`{` + base + `, ` + bad + `}`)); err == nil {
+			t.Errorf("Expected error for %s, got nil", bad)
+		}
+	}
+}
+
+func TestParseTaskMaxPPS(t *testing.T) {
+	tc, err := ParseTaskConfig([]byte(`{"id": "t", "capture": {"name": "afpacket", "interface": "eth0", "max_pps": 200000}, "reporters": [{"name": "console"}]}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	if tc.Capture.MaxPPS != 200000 {
+		t.Errorf("MaxPPS = %d, want 200000", tc.Capture.MaxPPS)
+	}
+
+	if _, err := ParseTaskConfig([]byte(`{"id": "t", "capture": {"name": "afpacket", "interface": "eth0", "max_pps": -1}, "reporters": [{"name": "console"}]}`)); err == nil {
+		t.Error("Expected error for a negative max_pps, got nil")
+	}
+}
+
+func TestParseTaskPrefilter(t *testing.T) {
+	tc, err := ParseTaskConfig([]byte(`{"id": "t", "capture": {"name": "afpacket", "interface": "eth0",
+		"prefilter": {"ports": ["5060", "10000-20000"], "vlans": [100], "nets": ["10.0.0.0/8"]}}, "reporters": [{"name": "console"}]}`))
+	if err != nil {
+		t.Fatalf("ParseTaskConfig failed: %v", err)
+	}
+	pf := tc.Capture.Prefilter
+	if pf == nil || len(pf.Ports) != 2 || pf.VLANs[0] != 100 || pf.Nets[0] != "10.0.0.0/8" {
+		t.Errorf("Prefilter = %+v", pf)
+	}
+
+	_, err = ParseTaskConfig([]byte(`{"id": "t", "capture": {"name": "afpacket", "interface": "eth0",
+		"prefilter": {"ports": ["20000-10000"]}}, "reporters": [{"name": "console"}]}`))
+	if err == nil || !strings.Contains(err.Error(), "capture.prefilter") {
+		t.Errorf("Expected a capture.prefilter error for an inverted port range, got %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TaskTemplate is a named, partial task config in otus.task_templates.
+//
+// A template extends at most one other template; task_create with a template
+// resolves the chain root first and applies the request overrides last. Maps
+// merge key by key, lists of plugin entries (parsers, processors, reporters)
+// merge entry by entry on "name", and any other value replaces the inherited one.
+//
+// String values may reference request variables as {name}, e.g.
+// "interface": "{interface}" or "bpf_filter": "udp portrange {port_range}".
+// A string that is exactly one reference takes the variable's value as is,
+// so a variable can also supply a number or a list.
+type TaskTemplate struct {
+	Extends string         `mapstructure:"extends"` // parent template, "" = none
+	Config  map[string]any `mapstructure:"config"`  // partial TaskConfig, same keys as the JSON form
+}
+
+// ResolveTaskTemplate builds the effective task config from template name and
+// overrides, then expands the {name} references to vars. The result is
+// validated like any other task config.
+func ResolveTaskTemplate(templates map[string]TaskTemplate, name string, overrides, vars map[string]any) (*TaskConfig, error) {
+	chain, err := templateChain(templates, name)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := map[string]any{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		merged = mergeConfig(merged, templates[chain[i]].Config)
+	}
+	merged = mergeConfig(merged, overrides)
+
+	expanded, err := expandVars(merged, vars)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", name, err)
+	}
+
+	data, err := json.Marshal(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", name, err)
+	}
+	tc, err := ParseTaskConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", name, err)
+	}
+	return tc, nil
+}
+
+// templateChain returns name followed by its ancestors.
+func templateChain(templates map[string]TaskTemplate, name string) ([]string, error) {
+	var chain []string
+	seen := make(map[string]bool)
+	for cur := name; cur != ""; cur = templates[cur].Extends {
+		if _, ok := templates[cur]; !ok {
+			if cur == name {
+				return nil, fmt.Errorf("task template %q not found", name)
+			}
+			return nil, fmt.Errorf("task template %q extends unknown template %q", chain[len(chain)-1], cur)
+		}
+		if seen[cur] {
+			return nil, fmt.Errorf("task template %q: inheritance cycle: %s -> %s", name, strings.Join(chain, " -> "), cur)
+		}
+		seen[cur] = true
+		chain = append(chain, cur)
+	}
+	return chain, nil
+}
+
+// validateTaskTemplates checks that every template's chain resolves. Template
+// contents are validated when a task is created from them, since a template
+// alone is usually not a complete task config.
+func validateTaskTemplates(templates map[string]TaskTemplate) error {
+	for name := range templates {
+		if _, err := templateChain(templates, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeConfig returns a copy of base with over applied.
+func mergeConfig(base, over map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		switch ov := v.(type) {
+		case map[string]any:
+			if bv, ok := out[k].(map[string]any); ok {
+				out[k] = mergeConfig(bv, ov)
+				continue
+			}
+		case []any:
+			if bv, ok := out[k].([]any); ok {
+				if merged, ok := mergeNamedList(bv, ov); ok {
+					out[k] = merged
+					continue
+				}
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// mergeNamedList merges two lists of plugin entries by their "name" key:
+// entries of over with a name found in base are merged into it in place, the
+// others are appended. ok is false when either list has an entry without a
+// name, in which case over replaces base.
+func mergeNamedList(base, over []any) (merged []any, ok bool) {
+	index := make(map[string]int, len(base))
+	for i, e := range base {
+		name, ok := entryName(e)
+		if !ok {
+			return nil, false
+		}
+		index[name] = i
+	}
+	for _, e := range over {
+		if _, ok := entryName(e); !ok {
+			return nil, false
+		}
+	}
+
+	merged = append([]any(nil), base...)
+	for _, e := range over {
+		name, _ := entryName(e)
+		if i, found := index[name]; found {
+			merged[i] = mergeConfig(merged[i].(map[string]any), e.(map[string]any))
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, e)
+	}
+	return merged, true
+}
+
+func entryName(e any) (string, bool) {
+	m, ok := e.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	name, ok := m["name"].(string)
+	return name, ok && name != ""
+}
+
+// varRef matches a {name} variable reference. Names are identifiers, so
+// regular expression quantifiers such as {2} or {1,3} are left alone.
+var varRef = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandVars returns a copy of v with variable references in its strings
+// replaced by vars. A reference to an undefined variable is an error, so a
+// template never yields a task with a literal "{interface}".
+func expandVars(v any, vars map[string]any) (any, error) {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, e := range val {
+			x, err := expandVars(e, vars)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", k, err)
+			}
+			out[k] = x
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(val))
+		for i, e := range val {
+			x, err := expandVars(e, vars)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			out[i] = x
+		}
+		return out, nil
+	case string:
+		return expandString(val, vars)
+	default:
+		return v, nil
+	}
+}
+
+func expandString(s string, vars map[string]any) (any, error) {
+	if m := varRef.FindStringSubmatch(s); m != nil && m[0] == s {
+		if v, ok := vars[m[1]]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("undefined variable {%s}", m[1])
+	}
+
+	var missing string
+	out := varRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[1 : len(ref)-1]
+		v, ok := vars[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return ref
+		}
+		if str, ok := v.(string); ok {
+			return str
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	})
+	if missing != "" {
+		return nil, fmt.Errorf("undefined variable {%s}", missing)
+	}
+	return out, nil
+}
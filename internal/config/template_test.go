@@ -0,0 +1,162 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveTaskTemplate_Inheritance(t *testing.T) {
+	templates := map[string]TaskTemplate{
+		"base": {Config: map[string]any{
+			"workers": 2,
+			"capture": map[string]any{"name": "afpacket", "interface": "eth0", "snap_len": 65535},
+			"parsers": []any{
+				map[string]any{"name": "sip", "config": map[string]any{"ports": []any{5060}, "max_body": 4096}},
+			},
+			"reporters": []any{map[string]any{"name": "kafka", "config": map[string]any{"topic": "otus"}}},
+		}},
+		"sbc": {Extends: "base", Config: map[string]any{
+			"parsers": []any{
+				map[string]any{"name": "sip", "config": map[string]any{"ports": []any{5060, 5080}}},
+				map[string]any{"name": "rtp"},
+			},
+		}},
+	}
+
+	tc, err := ResolveTaskTemplate(templates, "sbc", map[string]any{
+		"id":      "sbc-1",
+		"capture": map[string]any{"interface": "bond0"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("ResolveTaskTemplate: %v", err)
+	}
+
+	if tc.ID != "sbc-1" || tc.Workers != 2 {
+		t.Errorf("id/workers = %q/%d", tc.ID, tc.Workers)
+	}
+	if tc.Capture.Name != "afpacket" || tc.Capture.Interface != "bond0" || tc.Capture.SnapLen != 65535 {
+		t.Errorf("capture = %+v", tc.Capture)
+	}
+	if len(tc.Parsers) != 2 || tc.Parsers[0].Name != "sip" || tc.Parsers[1].Name != "rtp" {
+		t.Fatalf("parsers = %+v", tc.Parsers)
+	}
+	sip := tc.Parsers[0].Config
+	if ports, _ := sip["ports"].([]any); len(ports) != 2 {
+		t.Errorf("sip ports = %v, want the sbc override", sip["ports"])
+	}
+	if sip["max_body"] != float64(4096) {
+		t.Errorf("sip max_body = %v, want inherited 4096", sip["max_body"])
+	}
+	if len(tc.Reporters) != 1 || tc.Reporters[0].Config["topic"] != "otus" {
+		t.Errorf("reporters = %+v", tc.Reporters)
+	}
+}
+
+func TestResolveTaskTemplate_Errors(t *testing.T) {
+	templates := map[string]TaskTemplate{
+		"base":   {Config: map[string]any{"capture": map[string]any{"name": "afpacket", "interface": "eth0"}}},
+		"orphan": {Extends: "missing"},
+		"a":      {Extends: "b"},
+		"b":      {Extends: "a"},
+	}
+	tests := []struct {
+		name      string
+		template  string
+		overrides map[string]any
+		wantErr   string
+	}{
+		{"unknown template", "nope", map[string]any{"id": "t"}, "not found"},
+		{"unknown parent", "orphan", map[string]any{"id": "t"}, "unknown template"},
+		{"cycle", "a", map[string]any{"id": "t"}, "cycle"},
+		{"incomplete config", "base", nil, "task ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveTaskTemplate(templates, tt.template, tt.overrides, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveTaskTemplate_Variables(t *testing.T) {
+	templates := map[string]TaskTemplate{
+		"edge": {Config: map[string]any{
+			"id":      "edge-{tenant}-{interface}",
+			"capture": map[string]any{"name": "afpacket", "interface": "{interface}", "bpf_filter": "udp portrange {port_range}"},
+			"parsers": []any{
+				map[string]any{"name": "sip", "config": map[string]any{"ports": "{sip_ports}", "pattern": `^\d{3}$`}},
+			},
+			"reporters": []any{map[string]any{"name": "console"}},
+		}},
+	}
+
+	tc, err := ResolveTaskTemplate(templates, "edge", nil, map[string]any{
+		"interface":  "bond0",
+		"port_range": "10000-20000",
+		"tenant":     "acme",
+		"sip_ports":  []any{5060, 5080},
+	})
+	if err != nil {
+		t.Fatalf("ResolveTaskTemplate: %v", err)
+	}
+	if tc.ID != "edge-acme-bond0" {
+		t.Errorf("id = %q, want edge-acme-bond0", tc.ID)
+	}
+	if tc.Capture.Interface != "bond0" || tc.Capture.BPFFilter != "udp portrange 10000-20000" {
+		t.Errorf("capture = %+v", tc.Capture)
+	}
+	sip := tc.Parsers[0].Config
+	if ports, _ := sip["ports"].([]any); len(ports) != 2 {
+		t.Errorf("sip ports = %v, want the variable's list", sip["ports"])
+	}
+	if sip["pattern"] != `^\d{3}$` {
+		t.Errorf("pattern = %v, quantifier must not be expanded", sip["pattern"])
+	}
+
+	_, err = ResolveTaskTemplate(templates, "edge", nil, map[string]any{"interface": "eth0", "tenant": "acme", "sip_ports": 5060})
+	if err == nil || !strings.Contains(err.Error(), "undefined variable {port_range}") {
+		t.Errorf("error = %v, want undefined variable {port_range}", err)
+	}
+}
+
+func TestLoadTaskTemplates(t *testing.T) {
+	cfg, err := Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  task_templates:
+    base:
+      config:
+        capture: {name: afpacket, interface: eth0}
+        parsers: [{name: sip, config: {ports: [5060]}}]
+        reporters: [{name: console}]
+    sbc:
+      extends: base
+      config:
+        workers: 4
+`))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	tc, err := ResolveTaskTemplate(cfg.TaskTemplates, "sbc", map[string]any{"id": "sbc-1"}, nil)
+	if err != nil {
+		t.Fatalf("ResolveTaskTemplate: %v", err)
+	}
+	if tc.Workers != 4 || tc.Capture.Interface != "eth0" || len(tc.Parsers) != 1 {
+		t.Errorf("resolved config = %+v", tc)
+	}
+
+	_, err = Load(writeTmpConfig(t, `
+otus:
+  node:
+    ip: "10.0.0.1"
+  task_templates:
+    sbc:
+      extends: base
+`))
+	if err == nil || !strings.Contains(err.Error(), "unknown template") {
+		t.Errorf("error = %v, want unknown template", err)
+	}
+}
@@ -0,0 +1,272 @@
+// Package conformance replays pcap fixtures through the parsing pipeline and
+// checks the resulting labels against language-neutral expectations.
+//
+// A fixture is a pair of files sharing a base name in one directory:
+//
+//	sip_call.pcap   capture to replay (classic pcap, Ethernet link type)
+//	sip_call.json   parsers to run and expected output per packet
+//
+// The JSON side is the contract: any implementation that produces the same
+// payload types and labels for the same capture is compatible with Otus.
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Fixture is one capture with its expected parsing results.
+type Fixture struct {
+	Name        string              `json:"-"` // base file name
+	PcapPath    string              `json:"-"`
+	Description string              `json:"description"`
+	Parsers     []ParserSpec        `json:"parsers"`
+	Packets     []PacketExpectation `json:"packets"`
+}
+
+// ParserSpec names a parser plugin and its Init config, as in a task config.
+type ParserSpec struct {
+	Name   string         `json:"name"`
+	Config map[string]any `json:"config,omitempty"`
+}
+
+// PacketExpectation describes the expected output of one captured packet.
+// Packets without an expectation are replayed (they may create flow state)
+// but not checked.
+type PacketExpectation struct {
+	Index       int               `json:"index"`                  // 1-based position in the pcap
+	Dropped     bool              `json:"dropped,omitempty"`      // expect no output (decode error)
+	PayloadType string            `json:"payload_type,omitempty"` // parser name, or "raw"
+	Labels      map[string]string `json:"labels,omitempty"`       // must be present with these values
+	Absent      []string          `json:"absent,omitempty"`       // must not be present
+}
+
+// Mismatch is one difference between expected and actual output.
+type Mismatch struct {
+	Index int    `json:"index"`
+	Field string `json:"field"`
+	Want  string `json:"want"`
+	Got   string `json:"got"`
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("packet %d: %s: want %q, got %q", m.Index, m.Field, m.Want, m.Got)
+}
+
+// Result is the outcome of running one fixture.
+type Result struct {
+	Fixture    string     `json:"fixture"`
+	Packets    int        `json:"packets"` // packets replayed
+	Checked    int        `json:"checked"` // packets with an expectation
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+}
+
+// Passed reports whether the fixture produced the expected output.
+func (r *Result) Passed() bool {
+	return len(r.Mismatches) == 0
+}
+
+// ParserFactory creates a parser instance by plugin name.
+type ParserFactory func(name string) (plugin.Parser, error)
+
+// RegisteredParsers resolves parsers from the global plugin registry.
+func RegisteredParsers(name string) (plugin.Parser, error) {
+	f, err := plugin.GetParserFactory(name)
+	if err != nil {
+		return nil, err
+	}
+	return f(), nil
+}
+
+// Load reads all fixtures in dir, sorted by name. Every *.json file must
+// have a matching *.pcap file.
+func Load(dir string) ([]*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	fixtures := make([]*Fixture, 0, len(paths))
+	for _, path := range paths {
+		f, err := loadFixture(path)
+		if err != nil {
+			return nil, err
+		}
+		fixtures = append(fixtures, f)
+	}
+	return fixtures, nil
+}
+
+func loadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	f.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	f.PcapPath = strings.TrimSuffix(path, ".json") + ".pcap"
+	if _, err := os.Stat(f.PcapPath); err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", f.Name, err)
+	}
+	if len(f.Parsers) == 0 {
+		return nil, fmt.Errorf("fixture %s: no parsers configured", f.Name)
+	}
+	for _, exp := range f.Packets {
+		if exp.Index < 1 {
+			return nil, fmt.Errorf("fixture %s: packet index must be >= 1, got %d", f.Name, exp.Index)
+		}
+	}
+	return &f, nil
+}
+
+// Run replays the fixture's capture through a pipeline built from its
+// parsers and compares the output with the expectations.
+func Run(f *Fixture, newParser ParserFactory) (*Result, error) {
+	parsers, err := buildParsers(f, newParser)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pipeline.New(pipeline.Config{
+		TaskID:  "conformance-" + f.Name,
+		Decoder: decoder.NewStandardDecoder(decoder.Config{}),
+		Parsers: parsers,
+	})
+
+	outputs, err := replay(f.PcapPath, p)
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", f.Name, err)
+	}
+
+	result := &Result{Fixture: f.Name, Packets: len(outputs)}
+	for _, exp := range f.Packets {
+		result.Checked++
+		if exp.Index > len(outputs) {
+			result.Mismatches = append(result.Mismatches, Mismatch{
+				Index: exp.Index, Field: "packet",
+				Want: "present", Got: fmt.Sprintf("capture has %d packets", len(outputs)),
+			})
+			continue
+		}
+		result.Mismatches = append(result.Mismatches, compare(exp, outputs[exp.Index-1])...)
+	}
+	return result, nil
+}
+
+// buildParsers creates, initialises and wires the fixture's parsers the same
+// way the task manager does, with one shared FlowRegistry.
+func buildParsers(f *Fixture, newParser ParserFactory) ([]plugin.Parser, error) {
+	registry := task.NewFlowRegistry()
+	parsers := make([]plugin.Parser, 0, len(f.Parsers))
+	for _, spec := range f.Parsers {
+		parser, err := newParser(spec.Name)
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: parser %q: %w", f.Name, spec.Name, err)
+		}
+		if err := parser.Init(spec.Config); err != nil {
+			return nil, fmt.Errorf("fixture %s: parser %q init failed: %w", f.Name, spec.Name, err)
+		}
+		if fra, ok := parser.(plugin.FlowRegistryAware); ok {
+			fra.SetFlowRegistry(registry)
+		}
+		parsers = append(parsers, parser)
+	}
+	return parsers, nil
+}
+
+// replay runs every packet of the capture through p, returning one output per
+// packet (nil when the pipeline dropped it).
+func replay(path string, p *pipeline.Pipeline) ([]*core.OutputPacket, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r, err := pcapgo.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs []*core.OutputPacket
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return outputs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("packet %d: %w", len(outputs)+1, err)
+		}
+
+		out, ok := p.Process(core.RawPacket{
+			Data:       data,
+			Timestamp:  ci.Timestamp,
+			CaptureLen: uint32(ci.CaptureLength),
+			OrigLen:    uint32(ci.Length),
+		})
+		if !ok {
+			outputs = append(outputs, nil)
+			continue
+		}
+		outputs = append(outputs, &out)
+	}
+}
+
+func compare(exp PacketExpectation, out *core.OutputPacket) []Mismatch {
+	if out == nil {
+		if exp.Dropped {
+			return nil
+		}
+		return []Mismatch{{Index: exp.Index, Field: "packet", Want: "output", Got: "dropped"}}
+	}
+	if exp.Dropped {
+		return []Mismatch{{Index: exp.Index, Field: "packet", Want: "dropped", Got: out.PayloadType}}
+	}
+
+	var mismatches []Mismatch
+	if exp.PayloadType != "" && exp.PayloadType != out.PayloadType {
+		mismatches = append(mismatches, Mismatch{
+			Index: exp.Index, Field: "payload_type", Want: exp.PayloadType, Got: out.PayloadType,
+		})
+	}
+
+	keys := make([]string, 0, len(exp.Labels))
+	for key := range exp.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		got, ok := out.Labels[key]
+		if !ok {
+			got = "<absent>"
+		}
+		if want := exp.Labels[key]; got != want {
+			mismatches = append(mismatches, Mismatch{Index: exp.Index, Field: key, Want: want, Got: got})
+		}
+	}
+	for _, key := range exp.Absent {
+		if got, ok := out.Labels[key]; ok {
+			mismatches = append(mismatches, Mismatch{Index: exp.Index, Field: key, Want: "<absent>", Got: got})
+		}
+	}
+	return mismatches
+}
@@ -0,0 +1,94 @@
+package conformance
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"firestige.xyz/otus/pkg/plugin"
+	"firestige.xyz/otus/plugins/parser/msrp"
+	"firestige.xyz/otus/plugins/parser/rtp"
+	"firestige.xyz/otus/plugins/parser/sip"
+)
+
+// testParsers resolves the built-in parsers without the global registry,
+// which would pull in capture plugins.
+func testParsers(name string) (plugin.Parser, error) {
+	switch name {
+	case "sip":
+		return sip.NewSIPParser(), nil
+	case "rtp":
+		return rtp.NewRTPParser(), nil
+	case "msrp":
+		return msrp.NewMSRPParser(), nil
+	}
+	return nil, fmt.Errorf("unknown parser %q", name)
+}
+
+const fixtureDir = "../../testdata/conformance"
+
+func TestFixtures(t *testing.T) {
+	fixtures, err := Load(fixtureDir)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, f := range fixtures {
+		t.Run(f.Name, func(t *testing.T) {
+			result, err := Run(f, testParsers)
+			if err != nil {
+				t.Fatalf("Run() error: %v", err)
+			}
+			if result.Checked != len(f.Packets) {
+				t.Errorf("checked %d packets, want %d", result.Checked, len(f.Packets))
+			}
+			for _, m := range result.Mismatches {
+				t.Error(m)
+			}
+		})
+	}
+}
+
+func TestRunReportsMismatches(t *testing.T) {
+	fixtures, err := Load(fixtureDir)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	f := *fixtures[len(fixtures)-1] // sip_call
+	f.Packets = []PacketExpectation{
+		{Index: 1, PayloadType: "rtp", Labels: map[string]string{"sip.method": "BYE"}, Absent: []string{"sip.call_id"}},
+		{Index: 8, PayloadType: "sip"},
+		{Index: 99},
+	}
+
+	result, err := Run(&f, testParsers)
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	want := []string{"payload_type", "sip.method", "sip.call_id", "packet", "packet"}
+	if len(result.Mismatches) != len(want) {
+		t.Fatalf("mismatches = %v, want fields %v", result.Mismatches, want)
+	}
+	for i, m := range result.Mismatches {
+		if m.Field != want[i] {
+			t.Errorf("mismatch[%d].Field = %q, want %q", i, m.Field, want[i])
+		}
+	}
+	if result.Passed() {
+		t.Error("Passed() = true with mismatches")
+	}
+}
+
+func TestLoadRequiresPcap(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "orphan.json"), []byte(`{"parsers":[{"name":"sip"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(dir); err == nil {
+		t.Error("expected error for fixture without pcap")
+	}
+}
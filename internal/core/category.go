@@ -0,0 +1,35 @@
+package core
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrorCategory classifies an error for automation: task failure reasons,
+// the restart of failed tasks and command responses carry it.
+type ErrorCategory string
+
+const (
+	CategoryTransient ErrorCategory = "transient"
+	CategoryConfig    ErrorCategory = "config"
+	CategoryFatal     ErrorCategory = "fatal"
+	CategoryUnknown   ErrorCategory = "unknown" // error wrapping no category
+)
+
+// CategoryOf returns the category of err, "" for nil. An error wrapping
+// several categories takes the first of config, fatal, transient. Besides
+// the category sentinels, ErrConfigInvalid and ErrPluginNotFound are config
+// errors, ErrPermanent is fatal and context.DeadlineExceeded is transient.
+func CategoryOf(err error) ErrorCategory {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrConfig), errors.Is(err, ErrConfigInvalid), errors.Is(err, ErrPluginNotFound):
+		return CategoryConfig
+	case errors.Is(err, ErrFatal), errors.Is(err, ErrPermanent):
+		return CategoryFatal
+	case errors.Is(err, ErrTransient), errors.Is(err, context.DeadlineExceeded):
+		return CategoryTransient
+	}
+	return CategoryUnknown
+}
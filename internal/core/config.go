@@ -0,0 +1,26 @@
+package core
+
+import "fmt"
+
+// StringList converts a JSON/YAML decoded list of a plugin config into
+// []string.
+func StringList(v any) ([]string, error) {
+	switch list := v.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return list, nil
+	case []any:
+		out := make([]string, len(list))
+		for i, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid element type at index %d", i)
+			}
+			out[i] = s
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected list of strings")
+	}
+}
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/netip"
 	"testing"
 	"time"
@@ -155,6 +157,27 @@ func TestSentinelErrors(t *testing.T) {
 			t.Error("errors.Is failed for wrapped error")
 		}
 	})
+
+	t.Run("Categories", func(t *testing.T) {
+		tests := []struct {
+			err  error
+			want ErrorCategory
+		}{
+			{nil, ""},
+			{errors.New("boom"), CategoryUnknown},
+			{fmt.Errorf("dial: %w: %w", ErrTransient, errors.New("refused")), CategoryTransient},
+			{fmt.Errorf("write: %w", context.DeadlineExceeded), CategoryTransient},
+			{fmt.Errorf("topics missing: %w", ErrConfig), CategoryConfig},
+			{fmt.Errorf("task: %w", ErrConfigInvalid), CategoryConfig},
+			{fmt.Errorf("encode: %w", ErrPermanent), CategoryFatal},
+			{errors.Join(ErrTransient, ErrConfig), CategoryConfig},
+		}
+		for _, tt := range tests {
+			if got := CategoryOf(tt.err); got != tt.want {
+				t.Errorf("CategoryOf(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		}
+	})
 }
 
 // Test packet structures with real data
@@ -252,3 +275,47 @@ func TestPacketStructures(t *testing.T) {
 		}
 	})
 }
+
+func TestOutputPacketValue(t *testing.T) {
+	out := &OutputPacket{
+		SrcIP:       netip.MustParseAddr("10.0.0.1"),
+		Labels:      Labels{LabelSIPMethod: "OPTIONS"},
+		PayloadType: "sip",
+	}
+	tests := map[string]string{
+		KeySrcIP:       "10.0.0.1",
+		KeyDstIP:       "",
+		KeyPayloadType: "sip",
+		LabelSIPMethod: "OPTIONS",
+		LabelSIPCallID: "",
+	}
+	for key, want := range tests {
+		if got := out.Value(key); got != want {
+			t.Errorf("Value(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestStringList(t *testing.T) {
+	if got, err := StringList([]any{"a", "b"}); err != nil || len(got) != 2 || got[1] != "b" {
+		t.Errorf("StringList([a b]) = %v, %v", got, err)
+	}
+	if got, err := StringList(nil); err != nil || got != nil {
+		t.Errorf("StringList(nil) = %v, %v", got, err)
+	}
+	if _, err := StringList([]any{"a", 1}); err == nil {
+		t.Error("expected error for non-string element")
+	}
+	if _, err := StringList("a"); err == nil {
+		t.Error("expected error for non-list")
+	}
+}
+
+func TestOutputPacketCallID(t *testing.T) {
+	if id := (&OutputPacket{Labels: Labels{LabelRTPCallID: "c1"}}).CallID(); id != "c1" {
+		t.Errorf("CallID() = %q, want c1", id)
+	}
+	if id := (&OutputPacket{Labels: Labels{LabelSIPMethod: "INVITE"}}).CallID(); id != "" {
+		t.Errorf("CallID() = %q without a call ID label", id)
+	}
+}
@@ -2,7 +2,10 @@
 package decoder
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"firestige.xyz/otus/internal/core"
 )
@@ -14,21 +17,32 @@ type Decoder interface {
 
 // Config contains decoder configuration.
 type Config struct {
-	// Tunnels to decapsulate (e.g., "vxlan", "gre", "geneve", "ipip")
+	// Tunnels to decapsulate (e.g., "vxlan", "gre", "geneve", "ipip", "gtpu")
 	Tunnels []string
-	// Enable IP fragment reassembly
+	// UDP destination ports carrying VXLAN (default 4789)
+	VXLANPorts []uint16
+	// Enable IPv4 and IPv6 fragment reassembly
 	IPReassembly bool
 	// Reassembly configuration
-	MaxFragments      int // Maximum fragments per flow
-	MaxReassembleSize int // Maximum reassembled packet size
-	ReassemblyTimeout int // Timeout in seconds
+	MaxFragments      int           // Maximum fragments per flow
+	MaxReassembleSize int           // Maximum reassembled packet size
+	ReassemblyTimeout int           // Timeout in seconds
+	MaxFragsPerIP     int           // Per-source-IP fragment rate limit per window (0 = disabled)
+	RateLimitWindow   time.Duration // Fragment rate limit window (default 10s)
 }
 
 // StandardDecoder is the standard implementation of Decoder.
+//
+// Ethernet (stacked VLAN/QinQ tags, MPLS label stacks), IPv4/IPv6 and
+// UDP/TCP/SCTP are decoded by a hand-rolled fast path. Frames with PPPoE or
+// IPv6 extension headers fall back to gopacket automatically, except IPv6
+// fragments when reassembly is enabled.
 type StandardDecoder struct {
 	config      Config
 	reassembler *Reassembler // nil if reassembly disabled
 	tunnels     map[string]bool
+	vxlanPorts  map[uint16]bool
+	fallbacks   atomic.Uint64 // frames decoded by the gopacket fallback
 }
 
 // NewStandardDecoder creates a new standard decoder.
@@ -53,6 +67,15 @@ func NewStandardDecoder(cfg Config) *StandardDecoder {
 	for _, t := range cfg.Tunnels {
 		sd.tunnels[t] = true
 	}
+	if sd.tunnels["vxlan"] {
+		if len(cfg.VXLANPorts) == 0 {
+			cfg.VXLANPorts = []uint16{vxlanPort}
+		}
+		sd.vxlanPorts = make(map[uint16]bool, len(cfg.VXLANPorts))
+		for _, port := range cfg.VXLANPorts {
+			sd.vxlanPorts[port] = true
+		}
+	}
 
 	// Create reassembler if enabled
 	if cfg.IPReassembly {
@@ -60,6 +83,8 @@ func NewStandardDecoder(cfg Config) *StandardDecoder {
 			MaxFragments:      cfg.MaxFragments,
 			MaxReassembleSize: cfg.MaxReassembleSize,
 			Timeout:           cfg.ReassemblyTimeout,
+			MaxFragsPerIP:     cfg.MaxFragsPerIP,
+			RateLimitWindow:   cfg.RateLimitWindow,
 		})
 	}
 
@@ -87,6 +112,10 @@ func (sd *StandardDecoder) Decode(raw core.RawPacket) (core.DecodedPacket, error
 	decoded.Ethernet = eth
 	data = payload
 
+	if fallbackEtherType(eth.EtherType) {
+		return sd.decodeFallback(raw.Data, decoded)
+	}
+
 	// Check if it's IP packet
 	if eth.EtherType != 0x0800 && eth.EtherType != 0x86DD {
 		// Non-IP packet, return early
@@ -106,54 +135,181 @@ func (sd *StandardDecoder) Decode(raw core.RawPacket) (core.DecodedPacket, error
 	data = payload
 
 	// Handle IP fragmentation (before tunnel decap — outer IP is what gets fragmented)
-	if sd.reassembler != nil && ip.Version == 4 {
-		if isIPFragment(ipRawData, ip.Version) {
-			reassembled, complete, err := sd.reassembler.Process(ipRawData, raw.Timestamp)
-			if err != nil {
-				return decoded, fmt.Errorf("reassembly failed: %w", err)
+	if sd.reassembler != nil && isIPFragment(ipRawData, ip.Version) {
+		reassembled, protocol, err := sd.reassemble(ipRawData, ip.Version, raw.Timestamp)
+		if err != nil {
+			return decoded, err
+		}
+		// Use reassembled payload (transport layer onwards)
+		data = reassembled
+		ip.Protocol, decoded.IP.Protocol = protocol, protocol
+		decoded.Reassembled = true
+	} else if ip.Version == 6 && ipv6ExtensionHeader(ip.Protocol) {
+		return sd.decodeFallback(raw.Data, decoded)
+	}
+
+	// Handle tunnels. VXLAN and GTP-U replace decoded.IP with the inner
+	// header, so parsers see the inner 5-tuple; GRE, IPIP and Geneve keep the
+	// outer addresses and record the inner ones, with the inner transport.
+	if ip.Protocol == protocolUDP && sd.vxlanPorts != nil {
+		if frame, ok := vxlanFrame(data, sd.vxlanPorts); ok {
+			inner, err := sd.decodeVXLAN(frame, raw.Timestamp, decoded)
+			if err == nil || errors.Is(err, core.ErrFragmentIncomplete) {
+				return inner, err
 			}
-			if !complete {
-				return decoded, core.ErrFragmentIncomplete
+			// Undecodable inner frame: keep the outer packet
+			return decodeL4(decoded, ip.Protocol, data)
+		}
+	}
+	if ip.Protocol == protocolUDP && sd.tunnels["gtpu"] {
+		if pdu, teid, ok := gtpuPayload(data); ok {
+			decoded.TEID = teid
+			inner, err := sd.decodeInnerIP(pdu, raw.Timestamp, decoded)
+			if err == nil || errors.Is(err, core.ErrFragmentIncomplete) {
+				return inner, err
 			}
-			// Use reassembled payload (transport layer onwards)
-			data = reassembled
-			decoded.Reassembled = true
+			decoded.TEID = 0
+			return decodeL4(decoded, ip.Protocol, data)
 		}
 	}
-
-	// Handle tunnels (VXLAN, GRE, etc.)
 	if sd.shouldDecapTunnel(ip.Protocol) {
 		innerIP, innerPayload, err := decodeTunnel(data, ip.Protocol)
 		if err == nil && innerIP.Version != 0 {
-			// Successfully decapsulated tunnel
-			decoded.IP.InnerSrcIP = innerIP.SrcIP
-			decoded.IP.InnerDstIP = innerIP.DstIP
+			decoded.IP.InnerSrcIP, decoded.IP.InnerDstIP = innerIP.SrcIP, innerIP.DstIP
+			decoded.IP.OuterSrcIP, decoded.IP.OuterDstIP = ip.SrcIP, ip.DstIP
 			ip = innerIP
 			data = innerPayload
 		}
 	}
 
-	// L4 Transport decoding
-	if ip.Protocol == 6 || ip.Protocol == 17 { // TCP or UDP
-		transport, payload, err := decodeTransport(data, ip.Protocol)
+	return decodeL4(decoded, ip.Protocol, data)
+}
+
+// decodeVXLAN decodes frame, the Ethernet frame of a VXLAN packet, into
+// decoded (see decodeInnerIP).
+func (sd *StandardDecoder) decodeVXLAN(frame []byte, ts time.Time, decoded core.DecodedPacket) (core.DecodedPacket, error) {
+	eth, data, err := decodeEthernet(frame)
+	if err != nil {
+		return decoded, fmt.Errorf("vxlan inner ethernet: %w", err)
+	}
+	if eth.EtherType != etherTypeIPv4 && eth.EtherType != etherTypeIPv6 {
+		return decoded, fmt.Errorf("vxlan inner ethertype %#04x is not IP", eth.EtherType)
+	}
+	return sd.decodeInnerIP(data, ts, decoded)
+}
+
+// decodeInnerIP decodes ipRawData, the inner IP packet of a tunnel, into
+// decoded, which holds the outer layers. The inner IP header replaces the
+// outer one; inner IPv4 fragments are reassembled when reassembly is on.
+func (sd *StandardDecoder) decodeInnerIP(ipRawData []byte, ts time.Time, decoded core.DecodedPacket) (core.DecodedPacket, error) {
+	ip, data, err := decodeIP(ipRawData)
+	if err != nil {
+		return decoded, fmt.Errorf("inner ip: %w", err)
+	}
+	if sd.reassembler != nil && isIPFragment(ipRawData, ip.Version) {
+		reassembled, protocol, err := sd.reassemble(ipRawData, ip.Version, ts)
+		if err != nil {
+			return decoded, err
+		}
+		data = reassembled
+		ip.Protocol = protocol
+		decoded.Reassembled = true
+	} else if ip.Version == 6 && ipv6ExtensionHeader(ip.Protocol) {
+		return decoded, fmt.Errorf("inner IPv6 extension headers not supported")
+	}
+
+	decoded.IP = tunneled(decoded.IP, ip)
+	return decodeL4(decoded, ip.Protocol, data)
+}
+
+// reassemble passes the IPv4 or IPv6 fragment ipRawData to the reassembler
+// and returns the datagram's payload and upper-layer protocol once it is
+// complete, else core.ErrFragmentIncomplete.
+func (sd *StandardDecoder) reassemble(ipRawData []byte, version uint8, ts time.Time) ([]byte, uint8, error) {
+	var (
+		data     []byte
+		protocol uint8
+		complete bool
+		err      error
+	)
+	if version == 6 {
+		data, protocol, complete, err = sd.reassembler.ProcessIPv6(ipRawData, ts)
+	} else {
+		data, complete, err = sd.reassembler.Process(ipRawData, ts)
+		protocol = ipRawData[9]
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("reassembly failed: %w", err)
+	}
+	if !complete {
+		return nil, 0, core.ErrFragmentIncomplete
+	}
+	return data, protocol, nil
+}
+
+// decodeL4 decodes the transport header of data, the payload of an IP
+// packet carrying protocol, into decoded.
+func decodeL4(decoded core.DecodedPacket, protocol uint8, data []byte) (core.DecodedPacket, error) {
+	if protocol == 6 || protocol == 17 { // TCP or UDP
+		transport, payload, err := decodeTransport(data, protocol)
 		if err != nil {
 			return decoded, fmt.Errorf("transport decode failed: %w", err)
 		}
 		decoded.Transport = transport
 		data = payload
 	}
+	if protocol == protocolSCTP {
+		if err := decodeSCTP(data, &decoded); err != nil {
+			return decoded, fmt.Errorf("transport decode failed: %w", err)
+		}
+		return decoded, nil
+	}
 
 	decoded.Payload = data
 	return decoded, nil
 }
 
+// decodeFallback decodes a frame the fast path cannot with gopacket.
+func (sd *StandardDecoder) decodeFallback(data []byte, decoded core.DecodedPacket) (core.DecodedPacket, error) {
+	sd.fallbacks.Add(1)
+	if err := decodeFallback(data, &decoded); err != nil {
+		return decoded, fmt.Errorf("fallback decode failed: %w", err)
+	}
+	return decoded, nil
+}
+
+// Fallbacks returns the number of frames decoded by the gopacket fallback.
+func (sd *StandardDecoder) Fallbacks() uint64 {
+	return sd.fallbacks.Load()
+}
+
+// SetFragmentRateLimit changes the per-source-IP fragment rate limit of the
+// reassembler (see Reassembler.SetRateLimit). It fails when reassembly is
+// disabled, as there is nothing to limit.
+func (sd *StandardDecoder) SetFragmentRateLimit(maxPerIP int, window time.Duration) error {
+	if sd.reassembler == nil {
+		return fmt.Errorf("ip reassembly is disabled")
+	}
+	sd.reassembler.SetRateLimit(maxPerIP, window)
+	return nil
+}
+
+// FragmentRateLimiter returns the reassembler's fragment rate limiter, nil if
+// reassembly is disabled or rate limiting was never enabled.
+func (sd *StandardDecoder) FragmentRateLimiter() *FragmentRateLimiter {
+	if sd.reassembler == nil {
+		return nil
+	}
+	return sd.reassembler.RateLimiter()
+}
+
 // shouldDecapTunnel checks if protocol should be decapsulated.
 func (sd *StandardDecoder) shouldDecapTunnel(protocol uint8) bool {
-	// GRE = 47, UDP (for VXLAN) = 17, IPIP = 4
+	// GRE = 47, UDP (for Geneve) = 17, IPIP = 4; VXLAN is checked by port
 	if protocol == 47 && sd.tunnels["gre"] {
 		return true
 	}
-	if protocol == 17 && (sd.tunnels["vxlan"] || sd.tunnels["geneve"]) {
+	if protocol == 17 && sd.tunnels["geneve"] {
 		return true
 	}
 	if protocol == 4 && sd.tunnels["ipip"] {
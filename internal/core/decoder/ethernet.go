@@ -11,15 +11,20 @@ const (
 	// Ethernet constants
 	ethernetHeaderLen = 14
 	vlanHeaderLen     = 4
+	mplsHeaderLen     = 4
 
 	// EtherType values
-	etherTypeIPv4 = 0x0800
-	etherTypeIPv6 = 0x86DD
-	etherTypeVLAN = 0x8100
-	etherTypeQinQ = 0x88A8
+	etherTypeIPv4          = 0x0800
+	etherTypeIPv6          = 0x86DD
+	etherTypeVLAN          = 0x8100
+	etherTypeQinQ          = 0x88A8
+	etherTypeQinQLegacy    = 0x9100 // pre-802.1ad QinQ
+	etherTypeMPLSUnicast   = 0x8847
+	etherTypeMPLSMulticast = 0x8848
 )
 
-// decodeEthernet decodes Ethernet frame header (including VLAN tags).
+// decodeEthernet decodes Ethernet frame header (including VLAN tags and
+// MPLS label stacks).
 // Returns EthernetHeader and remaining payload.
 func decodeEthernet(data []byte) (core.EthernetHeader, []byte, error) {
 	if len(data) < ethernetHeaderLen {
@@ -40,7 +45,7 @@ func decodeEthernet(data []byte) (core.EthernetHeader, []byte, error) {
 
 	// Handle VLAN tags (can be nested: QinQ)
 	var vlans []uint16
-	for etherType == etherTypeVLAN || etherType == etherTypeQinQ {
+	for etherType == etherTypeVLAN || etherType == etherTypeQinQ || etherType == etherTypeQinQLegacy {
 		if len(data) < offset+vlanHeaderLen {
 			return eth, nil, core.ErrPacketTooShort
 		}
@@ -55,6 +60,32 @@ func decodeEthernet(data []byte) (core.EthernetHeader, []byte, error) {
 		offset += vlanHeaderLen
 	}
 
+	// MPLS label stack (RFC 3032): 4-byte entries down to the one with the
+	// bottom-of-stack bit. The payload type is not signalled; IPv4 and IPv6
+	// are recognised by their version nibble, anything else (e.g. pseudowires)
+	// is left as MPLS payload.
+	if etherType == etherTypeMPLSUnicast || etherType == etherTypeMPLSMulticast {
+		for {
+			if len(data) < offset+mplsHeaderLen {
+				return eth, nil, core.ErrPacketTooShort
+			}
+			entry := binary.BigEndian.Uint32(data[offset : offset+mplsHeaderLen])
+			eth.MPLSLabels = append(eth.MPLSLabels, entry>>12) // upper 20 bits
+			offset += mplsHeaderLen
+			if entry&0x100 != 0 { // bottom of stack
+				break
+			}
+		}
+		if len(data) > offset {
+			switch data[offset] >> 4 {
+			case 4:
+				etherType = etherTypeIPv4
+			case 6:
+				etherType = etherTypeIPv6
+			}
+		}
+	}
+
 	eth.EtherType = etherType
 	eth.VLANs = vlans
 
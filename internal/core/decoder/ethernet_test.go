@@ -111,6 +111,83 @@ func TestDecodeEthernetWithQinQ(t *testing.T) {
 	}
 }
 
+func TestDecodeEthernetStackedVLANs(t *testing.T) {
+	data := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, // Dst MAC
+		0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF, // Src MAC
+		0x91, 0x00, // EtherType: legacy QinQ (0x9100)
+		0x00, 0x1E, // VLAN ID 30
+		0x88, 0xA8, // EtherType: QinQ (0x88A8)
+		0x00, 0x14, // VLAN ID 20
+		0x81, 0x00, // EtherType: VLAN (0x8100)
+		0x00, 0x0A, // VLAN ID 10
+		0x86, 0xDD, // Inner EtherType: IPv6
+		0x60, 0x00, // Payload
+	}
+
+	eth, payload, err := decodeEthernet(data)
+	if err != nil {
+		t.Fatalf("decodeEthernet failed: %v", err)
+	}
+	if eth.EtherType != 0x86DD {
+		t.Errorf("Expected EtherType 0x86DD, got 0x%04x", eth.EtherType)
+	}
+	if len(eth.VLANs) != 3 || eth.VLANs[0] != 30 || eth.VLANs[1] != 20 || eth.VLANs[2] != 10 {
+		t.Errorf("Expected VLANs [30 20 10], got %v", eth.VLANs)
+	}
+	if len(payload) != 2 || payload[0] != 0x60 {
+		t.Errorf("Unexpected payload %x", payload)
+	}
+}
+
+func TestDecodeEthernetMPLS(t *testing.T) {
+	header := []byte{
+		0x00, 0x11, 0x22, 0x33, 0x44, 0x55, // Dst MAC
+		0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF, // Src MAC
+		0x81, 0x00, // EtherType: VLAN (0x8100)
+		0x00, 0x0A, // VLAN ID 10
+		0x88, 0x47, // EtherType: MPLS unicast
+		0x00, 0x3E, 0x80, 0x40, // Label 1000, TTL 64
+		0x00, 0x7D, 0x01, 0x40, // Label 2000, bottom of stack, TTL 64
+	}
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		etherType uint16
+	}{
+		{"IPv4", []byte{0x45, 0x00}, 0x0800},
+		{"IPv6", []byte{0x60, 0x00}, 0x86DD},
+		{"pseudowire control word", []byte{0x00, 0x00, 0x00, 0x00}, 0x8847},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append([]byte{}, header...), tt.payload...)
+			eth, payload, err := decodeEthernet(data)
+			if err != nil {
+				t.Fatalf("decodeEthernet failed: %v", err)
+			}
+			if eth.EtherType != tt.etherType {
+				t.Errorf("Expected EtherType 0x%04x, got 0x%04x", tt.etherType, eth.EtherType)
+			}
+			if len(eth.VLANs) != 1 || eth.VLANs[0] != 10 {
+				t.Errorf("Expected VLANs [10], got %v", eth.VLANs)
+			}
+			if len(eth.MPLSLabels) != 2 || eth.MPLSLabels[0] != 1000 || eth.MPLSLabels[1] != 2000 {
+				t.Errorf("Expected MPLS labels [1000 2000], got %v", eth.MPLSLabels)
+			}
+			if len(payload) != len(tt.payload) {
+				t.Errorf("Expected %d payload bytes, got %d", len(tt.payload), len(payload))
+			}
+		})
+	}
+
+	// Label stack without a bottom-of-stack entry
+	if _, _, err := decodeEthernet(header[:len(header)-4]); err == nil {
+		t.Error("Expected error for truncated label stack, got nil")
+	}
+}
+
 func TestDecodeEthernetTooShort(t *testing.T) {
 	data := []byte{0x00, 0x11, 0x22} // Too short
 
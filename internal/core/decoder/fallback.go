@@ -0,0 +1,135 @@
+// Package decoder implements protocol decoding.
+package decoder
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// EtherTypes decoded by the gopacket fallback.
+const (
+	etherTypePPPoESession = 0x8864
+)
+
+// fallbackEtherType reports whether the fast path cannot decode past L2:
+// PPPoE between Ethernet and IP.
+func fallbackEtherType(etherType uint16) bool {
+	return etherType == etherTypePPPoESession
+}
+
+// ipv6ExtensionHeader reports whether an IPv6 next header is an extension
+// header the fast path does not skip.
+func ipv6ExtensionHeader(nextHeader uint8) bool {
+	switch layers.IPProtocol(nextHeader) {
+	case layers.IPProtocolIPv6HopByHop, layers.IPProtocolIPv6Routing, layers.IPProtocolIPv6Destination:
+		return true
+	}
+	return false
+}
+
+// decodeFallback decodes the IP and transport layers of an Ethernet frame with
+// gopacket. It is much slower than the fast path and only used for the frames
+// it cannot decode; tunnels and IPv4 reassembly are not applied.
+func decodeFallback(data []byte, decoded *core.DecodedPacket) error {
+	pkt := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+
+	var ipPayload []byte
+	switch ip := pkt.NetworkLayer().(type) {
+	case *layers.IPv4:
+		decoded.IP = core.IPHeader{
+			Version:  4,
+			SrcIP:    addrFrom(ip.SrcIP),
+			DstIP:    addrFrom(ip.DstIP),
+			Protocol: uint8(ip.Protocol),
+			TTL:      ip.TTL,
+			TotalLen: ip.Length,
+		}
+		ipPayload = ip.Payload
+	case *layers.IPv6:
+		decoded.IP = core.IPHeader{
+			Version:  6,
+			SrcIP:    addrFrom(ip.SrcIP),
+			DstIP:    addrFrom(ip.DstIP),
+			Protocol: uint8(ipv6UpperProtocol(pkt, ip)),
+			TTL:      ip.HopLimit,
+			TotalLen: uint16(ipv6HeaderLen) + ip.Length,
+		}
+		ipPayload = ip.Payload
+	default:
+		if errLayer := pkt.ErrorLayer(); errLayer != nil {
+			return errLayer.Error()
+		}
+		// No IP inside (e.g. PPP control)
+		if l := pkt.Layers(); len(l) > 0 {
+			decoded.Payload = l[len(l)-1].LayerPayload()
+		}
+		return nil
+	}
+
+	switch t := pkt.TransportLayer().(type) {
+	case *layers.UDP:
+		decoded.Transport = core.TransportHeader{
+			SrcPort:  uint16(t.SrcPort),
+			DstPort:  uint16(t.DstPort),
+			Protocol: protocolUDP,
+		}
+		decoded.Payload = t.Payload
+	case *layers.TCP:
+		decoded.Transport = core.TransportHeader{
+			SrcPort:  uint16(t.SrcPort),
+			DstPort:  uint16(t.DstPort),
+			Protocol: protocolTCP,
+			TCPFlags: tcpFlags(t),
+			SeqNum:   t.Seq,
+			AckNum:   t.Ack,
+		}
+		decoded.Payload = t.Payload
+	case *layers.SCTP:
+		return decodeSCTP(ipPayload, decoded)
+	default:
+		if errLayer := pkt.ErrorLayer(); errLayer != nil {
+			return fmt.Errorf("transport: %w", errLayer.Error())
+		}
+		decoded.Payload = ipPayload
+	}
+	return nil
+}
+
+// ipv6UpperProtocol returns the protocol after the IPv6 extension headers.
+func ipv6UpperProtocol(pkt gopacket.Packet, ip *layers.IPv6) layers.IPProtocol {
+	proto := ip.NextHeader
+	for _, l := range pkt.Layers() {
+		switch ext := l.(type) {
+		case *layers.IPv6HopByHop:
+			proto = ext.NextHeader
+		case *layers.IPv6Routing:
+			proto = ext.NextHeader
+		case *layers.IPv6Destination:
+			proto = ext.NextHeader
+		case *layers.IPv6Fragment:
+			return layers.IPProtocolIPv6Fragment // payload is a fragment, not a transport header
+		}
+	}
+	return proto
+}
+
+// tcpFlags packs the TCP flags like the fast path: URG ACK PSH RST SYN FIN.
+func tcpFlags(t *layers.TCP) uint8 {
+	var f uint8
+	for i, set := range []bool{t.FIN, t.SYN, t.RST, t.PSH, t.ACK, t.URG} {
+		if set {
+			f |= 1 << i
+		}
+	}
+	return f
+}
+
+func addrFrom(ip []byte) netip.Addr {
+	addr, _ := netip.AddrFromSlice(ip)
+	return addr
+}
@@ -0,0 +1,230 @@
+package decoder
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+var sipPayload = []byte("OPTIONS sip:bob@example.com SIP/2.0\r\n\r\n")
+
+// serialize builds a frame from gopacket layers.
+func serialize(t testing.TB, ls ...gopacket.SerializableLayer) []byte {
+	t.Helper()
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, ls...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func ethernet(etherType layers.EthernetType) *layers.Ethernet {
+	return &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF},
+		DstMAC:       net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
+		EthernetType: etherType,
+	}
+}
+
+func ipv4UDP(t testing.TB) (*layers.IPv4, *layers.UDP) {
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &layers.UDP{SrcPort: 5060, DstPort: 5080}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+	return ip, udp
+}
+
+func mplsFrame(t testing.TB) []byte {
+	ip, udp := ipv4UDP(t)
+	return serialize(t, ethernet(layers.EthernetTypeMPLSUnicast),
+		&layers.MPLS{Label: 100, StackBottom: true, TTL: 64},
+		ip, udp, gopacket.Payload(sipPayload))
+}
+
+func decodeFrame(t *testing.T, d *StandardDecoder, frame []byte) core.DecodedPacket {
+	t.Helper()
+	pkt, err := d.Decode(core.RawPacket{Data: frame, Timestamp: time.Now(),
+		CaptureLen: uint32(len(frame)), OrigLen: uint32(len(frame))})
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return pkt
+}
+
+func TestDecode_MPLS(t *testing.T) {
+	d := NewStandardDecoder(Config{})
+	pkt := decodeFrame(t, d, mplsFrame(t))
+
+	if d.Fallbacks() != 0 {
+		t.Errorf("Fallbacks() = %d, want 0 (MPLS is decoded by the fast path)", d.Fallbacks())
+	}
+	if pkt.Ethernet.EtherType != etherTypeIPv4 || len(pkt.Ethernet.MPLSLabels) != 1 || pkt.Ethernet.MPLSLabels[0] != 100 {
+		t.Errorf("Ethernet = %+v, want IPv4 under label 100", pkt.Ethernet)
+	}
+	if pkt.IP.Version != 4 || pkt.IP.SrcIP != netip.MustParseAddr("10.0.0.1") || pkt.IP.Protocol != 17 || pkt.IP.TTL != 64 {
+		t.Errorf("IP = %+v", pkt.IP)
+	}
+	if pkt.Transport.SrcPort != 5060 || pkt.Transport.DstPort != 5080 || pkt.Transport.Protocol != 17 {
+		t.Errorf("Transport = %+v", pkt.Transport)
+	}
+	if string(pkt.Payload) != string(sipPayload) {
+		t.Errorf("Payload = %q", pkt.Payload)
+	}
+}
+
+func TestDecode_FallbackPPPoE(t *testing.T) {
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 63, Protocol: layers.IPProtocolTCP,
+		SrcIP: net.IP{192, 0, 2, 1}, DstIP: net.IP{192, 0, 2, 2}}
+	tcp := &layers.TCP{SrcPort: 40000, DstPort: 5060, Seq: 1000, Ack: 2000, SYN: true, ACK: true, Window: 1024}
+	if err := tcp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+	frame := serialize(t, ethernet(layers.EthernetTypePPPoESession),
+		&layers.PPPoE{Version: 1, Type: 1, Code: layers.PPPoECodeSession, SessionId: 7},
+		&layers.PPP{PPPType: layers.PPPTypeIPv4},
+		ip, tcp, gopacket.Payload(sipPayload))
+
+	pkt := decodeFrame(t, NewStandardDecoder(Config{}), frame)
+	if pkt.IP.DstIP != netip.MustParseAddr("192.0.2.2") || pkt.IP.Protocol != 6 {
+		t.Errorf("IP = %+v", pkt.IP)
+	}
+	tr := pkt.Transport
+	if tr.SrcPort != 40000 || tr.SeqNum != 1000 || tr.AckNum != 2000 || tr.TCPFlags != 0x12 {
+		t.Errorf("Transport = %+v, want SYN|ACK", tr)
+	}
+	if string(pkt.Payload) != string(sipPayload) {
+		t.Errorf("Payload = %q", pkt.Payload)
+	}
+}
+
+func TestDecode_FallbackIPv6HopByHop(t *testing.T) {
+	ip := &layers.IPv6{Version: 6, HopLimit: 32, NextHeader: layers.IPProtocolIPv6HopByHop,
+		SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2")}
+	hbh := &layers.IPv6HopByHop{}
+	hbh.NextHeader = layers.IPProtocolUDP
+	hbh.Options = []*layers.IPv6HopByHopOption{{OptionType: 1, OptionData: make([]byte, 4)}} // PadN to 8 bytes
+	udp := &layers.UDP{SrcPort: 10000, DstPort: 20000}
+	if err := udp.SetNetworkLayerForChecksum(ip); err != nil {
+		t.Fatal(err)
+	}
+	ip.HopByHop = hbh
+	frame := serialize(t, ethernet(layers.EthernetTypeIPv6), ip, udp, gopacket.Payload(sipPayload))
+
+	d := NewStandardDecoder(Config{})
+	pkt := decodeFrame(t, d, frame)
+	if d.Fallbacks() != 1 {
+		t.Errorf("Fallbacks() = %d, want 1", d.Fallbacks())
+	}
+	if pkt.IP.Version != 6 || pkt.IP.Protocol != 17 || pkt.IP.TTL != 32 || pkt.IP.SrcIP != netip.MustParseAddr("2001:db8::1") {
+		t.Errorf("IP = %+v", pkt.IP)
+	}
+	if pkt.Transport.SrcPort != 10000 || pkt.Transport.DstPort != 20000 || string(pkt.Payload) != string(sipPayload) {
+		t.Errorf("Transport = %+v, Payload = %q", pkt.Transport, pkt.Payload)
+	}
+}
+
+func TestDecode_FastPathSkipsFallback(t *testing.T) {
+	ip, udp := ipv4UDP(t)
+	frame := serialize(t, ethernet(layers.EthernetTypeIPv4), ip, udp, gopacket.Payload(sipPayload))
+
+	d := NewStandardDecoder(Config{})
+	fast := decodeFrame(t, d, frame)
+	if d.Fallbacks() != 0 {
+		t.Fatalf("Fallbacks() = %d for Ethernet/IPv4/UDP", d.Fallbacks())
+	}
+
+	// The fallback decodes the same frame identically.
+	var slow core.DecodedPacket
+	slow.Ethernet = fast.Ethernet
+	if err := decodeFallback(frame, &slow); err != nil {
+		t.Fatal(err)
+	}
+	if slow.IP != fast.IP || slow.Transport != fast.Transport || string(slow.Payload) != string(fast.Payload) {
+		t.Errorf("fallback = %+v / %+v, fast path = %+v / %+v", slow.IP, slow.Transport, fast.IP, fast.Transport)
+	}
+}
+
+// The benchmarks compare the fast path with gopacket on Ethernet/IPv4/UDP:
+// gopacket.NewPacket (the fallback) and a preallocated DecodingLayerParser.
+
+var benchSink core.DecodedPacket
+
+func benchmarkFrame(b *testing.B) []byte {
+	ip, udp := ipv4UDP(b)
+	return serialize(b, ethernet(layers.EthernetTypeIPv4), ip, udp, gopacket.Payload(sipPayload))
+}
+
+func BenchmarkDecode_FastPath(b *testing.B) {
+	frame := benchmarkFrame(b)
+	d := NewStandardDecoder(Config{})
+	raw := core.RawPacket{Data: frame, CaptureLen: uint32(len(frame)), OrigLen: uint32(len(frame))}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pkt, err := d.Decode(raw)
+		if err != nil {
+			b.Fatal(err)
+		}
+		benchSink = pkt
+	}
+}
+
+func BenchmarkDecode_Gopacket(b *testing.B) {
+	frame := benchmarkFrame(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var pkt core.DecodedPacket
+		if err := decodeFallback(frame, &pkt); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode_GopacketLayerParser(b *testing.B) {
+	frame := benchmarkFrame(b)
+	var (
+		eth     layers.Ethernet
+		ip4     layers.IPv4
+		udp     layers.UDP
+		payload gopacket.Payload
+	)
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ip4, &udp, &payload)
+	parser.IgnoreUnsupported = true // UDP 5060 would continue into gopacket's SIP layer
+	decoded := make([]gopacket.LayerType, 0, 4)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := parser.DecodeLayers(frame, &decoded); err != nil {
+			b.Fatal(err)
+		}
+		benchSink = core.DecodedPacket{
+			IP: core.IPHeader{Version: 4, SrcIP: addrFrom(ip4.SrcIP), DstIP: addrFrom(ip4.DstIP),
+				Protocol: uint8(ip4.Protocol), TTL: ip4.TTL, TotalLen: ip4.Length},
+			Transport: core.TransportHeader{SrcPort: uint16(udp.SrcPort), DstPort: uint16(udp.DstPort), Protocol: protocolUDP},
+			Payload:   udp.Payload,
+		}
+	}
+}
+
+func BenchmarkDecode_MPLS(b *testing.B) {
+	frame := mplsFrame(b)
+	d := NewStandardDecoder(Config{})
+	raw := core.RawPacket{Data: frame, CaptureLen: uint32(len(frame)), OrigLen: uint32(len(frame))}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := d.Decode(raw); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
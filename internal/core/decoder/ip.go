@@ -136,7 +136,11 @@ func isIPFragment(ipData []byte, version uint8) bool {
 		fragmentOffset := flagsOffset & 0x1FFF       // Fragment offset
 		return moreFragments || fragmentOffset != 0
 	}
-	// IPv6 fragmentation is handled via extension headers
-	// Simplified: assume no fragmentation for now
-	return false
+	// IPv6: a Fragment extension header with an offset or the M flag
+	// (atomic fragments are not fragments)
+	off, ok := ipv6FragmentHeader(ipData)
+	if !ok {
+		return false
+	}
+	return binary.BigEndian.Uint16(ipData[off+2:off+4])&0xFFF9 != 0
 }
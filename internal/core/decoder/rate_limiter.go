@@ -2,23 +2,43 @@
 package decoder
 
 import (
+	"net/netip"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"firestige.xyz/otus/internal/metrics"
 )
 
+// defaultRateLimitWindow is the rate limit window when none is configured.
+const defaultRateLimitWindow = 10 * time.Second
+
+// maxOffenders bounds the rate-limited sources remembered for TopOffenders,
+// so a flood from spoofed addresses cannot grow it without limit.
+const maxOffenders = 1024
+
 // FragmentRateLimiter tracks per-source-IP fragment counts to prevent
 // fragment flood DoS attacks. It uses a sliding window approach: counts
 // are stored per window and automatically rotated.
 type FragmentRateLimiter struct {
-	mu           sync.Mutex
-	current      map[[4]byte]*atomic.Int64 // source IP → fragment count in current window
-	windowStart  time.Time
-	windowSize   time.Duration
-	maxPerWindow int64
+	mu          sync.Mutex
+	current     map[netip.Addr]*atomic.Int64 // source IP → fragment count in current window
+	windowStart time.Time
+	windowSize  time.Duration
+	offenders   map[netip.Addr]*offender // rate-limited sources, at most maxOffenders
+
+	maxPerWindow atomic.Int64 // 0 = disabled (after SetLimits)
 
 	// Metrics
-	rejected atomic.Int64 // total rejected fragments
+	rejected       atomic.Int64 // total rejected fragments
+	limitedSources atomic.Int64 // windows in which a source hit the limit
+}
+
+// offender counts the fragments rejected from one source.
+type offender struct {
+	rejected int64
+	lastSeen time.Time
 }
 
 // FragmentRateLimiterConfig configures per-IP fragment rate limiting.
@@ -27,30 +47,71 @@ type FragmentRateLimiterConfig struct {
 	RateLimitWindow time.Duration // Window size (default 10s)
 }
 
+// FragmentOffender is a source whose fragments were rate-limited.
+type FragmentOffender struct {
+	SrcIP    string    `json:"src_ip"`
+	Rejected int64     `json:"rejected"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// FragmentRateLimitStats is a snapshot of a FragmentRateLimiter.
+type FragmentRateLimitStats struct {
+	MaxFragsPerIP  int    `json:"max_frags_per_ip"` // 0 = disabled
+	Window         string `json:"window"`
+	Rejected       int64  `json:"rejected"`        // fragments rejected
+	LimitedSources int64  `json:"limited_sources"` // windows in which a source hit the limit
+	ActiveIPs      int    `json:"active_ips"`      // sources in the current window
+}
+
 // NewFragmentRateLimiter creates a rate limiter. Returns nil if disabled (MaxFragsPerIP <= 0).
 func NewFragmentRateLimiter(cfg FragmentRateLimiterConfig) *FragmentRateLimiter {
 	if cfg.MaxFragsPerIP <= 0 {
 		return nil
 	}
 	if cfg.RateLimitWindow <= 0 {
-		cfg.RateLimitWindow = 10 * time.Second
+		cfg.RateLimitWindow = defaultRateLimitWindow
 	}
-	return &FragmentRateLimiter{
-		current:      make(map[[4]byte]*atomic.Int64),
-		windowStart:  time.Now(),
-		windowSize:   cfg.RateLimitWindow,
-		maxPerWindow: int64(cfg.MaxFragsPerIP),
+	l := &FragmentRateLimiter{
+		current:     make(map[netip.Addr]*atomic.Int64),
+		windowStart: time.Now(),
+		windowSize:  cfg.RateLimitWindow,
+		offenders:   make(map[netip.Addr]*offender),
 	}
+	l.maxPerWindow.Store(int64(cfg.MaxFragsPerIP))
+	return l
 }
 
-// Allow checks if a fragment from the given source IP is allowed.
+// SetLimits changes the limit and window at runtime; maxPerIP <= 0 disables
+// limiting and window <= 0 keeps the current window. Counters and offenders
+// are kept; a changed window starts a new one at the next fragment.
+func (l *FragmentRateLimiter) SetLimits(maxPerIP int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if window > 0 && window != l.windowSize {
+		l.windowSize = window
+		l.windowStart = time.Time{}
+	}
+	l.maxPerWindow.Store(int64(max(maxPerIP, 0)))
+}
+
+// Allow checks if a fragment from the given IPv4 source is allowed.
 // Returns true if allowed, false if rate-limited.
 func (l *FragmentRateLimiter) Allow(srcIP [4]byte, now time.Time) bool {
+	return l.AllowAddr(netip.AddrFrom4(srcIP), now)
+}
+
+// AllowAddr is Allow for an IPv4 or IPv6 source.
+func (l *FragmentRateLimiter) AllowAddr(srcIP netip.Addr, now time.Time) bool {
+	limit := l.maxPerWindow.Load()
+	if limit <= 0 {
+		return true
+	}
+
 	l.mu.Lock()
 
 	// Rotate window if expired
 	if now.Sub(l.windowStart) >= l.windowSize {
-		l.current = make(map[[4]byte]*atomic.Int64)
+		l.current = make(map[netip.Addr]*atomic.Int64)
 		l.windowStart = now
 	}
 
@@ -63,13 +124,50 @@ func (l *FragmentRateLimiter) Allow(srcIP [4]byte, now time.Time) bool {
 
 	// Atomic increment + check (lock-free hot path after map lookup)
 	count := counter.Add(1)
-	if count > l.maxPerWindow {
-		l.rejected.Add(1)
+	if count > limit {
+		l.reject(srcIP, now, count == limit+1)
 		return false
 	}
 	return true
 }
 
+// reject records a rate-limited fragment; first is set for the first one of
+// the source in the current window.
+func (l *FragmentRateLimiter) reject(srcIP netip.Addr, now time.Time, first bool) {
+	l.rejected.Add(1)
+	metrics.ReassemblyRateLimitedFragments.Inc()
+	if first {
+		l.limitedSources.Add(1)
+		metrics.ReassemblyRateLimitedSources.Inc()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	o, ok := l.offenders[srcIP]
+	if !ok {
+		if len(l.offenders) >= maxOffenders {
+			l.evictOffender()
+		}
+		o = &offender{}
+		l.offenders[srcIP] = o
+	}
+	o.rejected++
+	o.lastSeen = now
+}
+
+// evictOffender drops the offender with the fewest rejected fragments.
+// Must be called with l.mu held.
+func (l *FragmentRateLimiter) evictOffender() {
+	var victim netip.Addr
+	least := int64(-1)
+	for ip, o := range l.offenders {
+		if least < 0 || o.rejected < least {
+			victim, least = ip, o.rejected
+		}
+	}
+	delete(l.offenders, victim)
+}
+
 // Rejected returns the total number of rejected fragments.
 func (l *FragmentRateLimiter) Rejected() int64 {
 	return l.rejected.Load()
@@ -81,3 +179,42 @@ func (l *FragmentRateLimiter) ActiveIPs() int {
 	defer l.mu.Unlock()
 	return len(l.current)
 }
+
+// Stats returns the current limits and counters.
+func (l *FragmentRateLimiter) Stats() FragmentRateLimitStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return FragmentRateLimitStats{
+		MaxFragsPerIP:  int(l.maxPerWindow.Load()),
+		Window:         l.windowSize.String(),
+		Rejected:       l.rejected.Load(),
+		LimitedSources: l.limitedSources.Load(),
+		ActiveIPs:      len(l.current),
+	}
+}
+
+// TopOffenders returns up to n sources with the most rejected fragments, most
+// first; n <= 0 returns all remembered sources.
+func (l *FragmentRateLimiter) TopOffenders(n int) []FragmentOffender {
+	l.mu.Lock()
+	out := make([]FragmentOffender, 0, len(l.offenders))
+	for ip, o := range l.offenders {
+		out = append(out, FragmentOffender{
+			SrcIP:    ip.String(),
+			Rejected: o.rejected,
+			LastSeen: o.lastSeen,
+		})
+	}
+	l.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rejected != out[j].Rejected {
+			return out[i].Rejected > out[j].Rejected
+		}
+		return out[i].SrcIP < out[j].SrcIP
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -113,7 +113,7 @@ func TestReassembler_RateLimitRejectsFragments(t *testing.T) {
 	r := NewReassembler(ReassemblyConfig{
 		MaxFragments:    100,
 		MaxFragsPerIP:   2,
-		RateLimitWindow: 60,
+		RateLimitWindow: 60 * time.Second,
 	})
 
 	// Build 3 different fragments from the same source IP
@@ -162,6 +162,82 @@ func TestReassembler_RateLimitDisabledByDefault(t *testing.T) {
 	}
 }
 
+func TestFragmentRateLimiter_SetLimits(t *testing.T) {
+	l := NewFragmentRateLimiter(FragmentRateLimiterConfig{MaxFragsPerIP: 1})
+	srcIP := [4]byte{10, 0, 0, 1}
+	now := time.Now()
+
+	l.Allow(srcIP, now)
+	if l.Allow(srcIP, now) {
+		t.Fatal("2nd fragment should be rejected at limit 1")
+	}
+
+	// Raising the limit applies to the current window
+	l.SetLimits(3, 0)
+	if !l.Allow(srcIP, now) {
+		t.Error("3rd fragment should be allowed at limit 3")
+	}
+
+	// Disabled: everything passes
+	l.SetLimits(0, 0)
+	for i := 0; i < 10; i++ {
+		if !l.Allow(srcIP, now) {
+			t.Fatal("fragment rejected with limiting disabled")
+		}
+	}
+
+	// A new window starts over
+	l.SetLimits(1, time.Minute)
+	if !l.Allow(srcIP, now) || l.Allow(srcIP, now) {
+		t.Error("want 1 fragment allowed in the new window")
+	}
+	st := l.Stats()
+	if st.MaxFragsPerIP != 1 || st.Window != "1m0s" || st.Rejected != 2 || st.LimitedSources != 2 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestFragmentRateLimiter_TopOffenders(t *testing.T) {
+	l := NewFragmentRateLimiter(FragmentRateLimiterConfig{MaxFragsPerIP: 1})
+	now := time.Now()
+	for ip, n := range map[[4]byte]int{{10, 0, 0, 1}: 4, {10, 0, 0, 2}: 2, {10, 0, 0, 3}: 1} {
+		for i := 0; i < n; i++ {
+			l.Allow(ip, now)
+		}
+	}
+
+	top := l.TopOffenders(2)
+	if len(top) != 2 || top[0].SrcIP != "10.0.0.1" || top[0].Rejected != 3 || top[1].SrcIP != "10.0.0.2" {
+		t.Errorf("top offenders = %+v, want 10.0.0.1×3 then 10.0.0.2", top)
+	}
+	if all := l.TopOffenders(0); len(all) != 2 {
+		t.Errorf("offenders = %+v, want the 2 limited sources", all)
+	}
+}
+
+func TestReassembler_SetRateLimit(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{MaxFragments: 100})
+	if r.RateLimiter() != nil {
+		t.Fatal("rate limiter created while disabled")
+	}
+
+	r.SetRateLimit(1, time.Minute)
+	now := time.Now()
+	src := [4]byte{192, 168, 1, 100}
+	if _, _, err := r.Process(makeIPv4Fragment(src, [4]byte{10, 0, 0, 1}, 1, 0, true, 20), now); err != nil {
+		t.Fatalf("1st fragment: %v", err)
+	}
+	if _, _, err := r.Process(makeIPv4Fragment(src, [4]byte{10, 0, 0, 1}, 2, 0, true, 20), now); err == nil {
+		t.Fatal("2nd fragment should be rejected after enabling the limit")
+	}
+
+	l := r.RateLimiter()
+	r.SetRateLimit(0, 0)
+	if r.RateLimiter() != l || l.Rejected() != 1 {
+		t.Error("disabling should keep the limiter and its counters")
+	}
+}
+
 // makeIPv4Fragment builds a raw IPv4 fragment packet for testing.
 func makeIPv4Fragment(srcIP, dstIP [4]byte, id, fragOffset8 uint16, moreFragments bool, payloadSize int) []byte {
 	ihl := 20
@@ -5,7 +5,9 @@ import (
 	"container/list"
 	"encoding/binary"
 	"fmt"
+	"net/netip"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"firestige.xyz/otus/internal/metrics"
@@ -21,20 +23,23 @@ const (
 
 // ReassemblyConfig contains configuration for IP reassembly.
 type ReassemblyConfig struct {
-	MaxFragments      int // Maximum fragments per flow (default 100)
-	MaxReassembleSize int // Maximum reassembled packet size (default 65535)
-	Timeout           int // Timeout in seconds (default 60)
-	MaxFragsPerIP     int // Per-source-IP fragment rate limit per window (0 = disabled)
-	RateLimitWindow   int // Rate limit window in seconds (default 10)
+	MaxFragments      int           // Maximum fragments per flow (default 100)
+	MaxReassembleSize int           // Maximum reassembled packet size (default 65535)
+	Timeout           int           // Timeout in seconds (default 60)
+	MaxFragsPerIP     int           // Per-source-IP fragment rate limit per window (0 = disabled)
+	RateLimitWindow   time.Duration // Rate limit window (default 10s)
 }
 
-// fragmentKey uniquely identifies a fragmented IPv4 datagram.
-// Uses fixed-size arrays to avoid string allocation in the hot path.
+// fragmentKey uniquely identifies a fragmented IPv4 or IPv6 datagram.
+// Uses fixed-size arrays to avoid string allocation in the hot path; IPv4
+// addresses take the first 4 bytes. IPv6 datagrams are identified by source,
+// destination and identification only (RFC 8200 §4.5).
 type fragmentKey struct {
-	srcIP    [4]byte
-	dstIP    [4]byte
+	srcIP    [16]byte
+	dstIP    [16]byte
 	protocol uint8
-	id       uint16
+	id       uint32
+	v6       bool
 }
 
 // fragment represents a single IP fragment's payload and position.
@@ -54,15 +59,18 @@ type fragmentList struct {
 	highest       uint16    // highest byte position seen = max(offset + fragLen)
 	current       uint16    // total unique bytes accumulated
 	finalReceived bool      // true when the last fragment (MF=0) is received
+	nextHeader    uint8     // IPv6: next header of the first fragment's Fragment header
 	lastSeen      time.Time // timestamp of last fragment for timeout cleanup
 }
 
-// Reassembler handles IPv4 fragment reassembly using BSD-Right algorithm.
+// Reassembler handles IPv4 and IPv6 fragment reassembly using BSD-Right
+// algorithm. IPv6 fragments (RFC 8200 Fragment extension header) go through
+// ProcessIPv6 and share the limits, rate limiter and timeout of IPv4.
 type Reassembler struct {
 	mu          sync.Mutex
 	flows       map[fragmentKey]*fragmentList
 	config      ReassemblyConfig
-	rateLimiter *FragmentRateLimiter // nil if rate limiting disabled
+	rateLimiter atomic.Pointer[FragmentRateLimiter] // nil until rate limiting is first enabled
 }
 
 // NewReassembler creates a new IP fragment reassembler.
@@ -80,11 +88,8 @@ func NewReassembler(cfg ReassemblyConfig) *Reassembler {
 	r := &Reassembler{
 		flows:  make(map[fragmentKey]*fragmentList),
 		config: cfg,
-		rateLimiter: NewFragmentRateLimiter(FragmentRateLimiterConfig{
-			MaxFragsPerIP:   cfg.MaxFragsPerIP,
-			RateLimitWindow: time.Duration(cfg.RateLimitWindow) * time.Second,
-		}),
 	}
+	r.SetRateLimit(cfg.MaxFragsPerIP, cfg.RateLimitWindow)
 
 	// Start cleanup goroutine for expired fragments
 	go r.cleanup()
@@ -145,21 +150,29 @@ func (r *Reassembler) Process(ipData []byte, timestamp time.Time) ([]byte, bool,
 		return nil, false, err
 	}
 
-	// Per-source-IP rate limiting (DoS protection)
-	var srcIPKey [4]byte
-	copy(srcIPKey[:], ipData[12:16])
-	if r.rateLimiter != nil && !r.rateLimiter.Allow(srcIPKey, timestamp) {
-		return nil, false, fmt.Errorf("fragment rate limit exceeded for source IP %d.%d.%d.%d",
-			srcIPKey[0], srcIPKey[1], srcIPKey[2], srcIPKey[3])
-	}
-
 	// Build fragment key from raw bytes
 	key := fragmentKey{
 		protocol: ipData[9],
-		id:       id,
+		id:       uint32(id),
 	}
 	copy(key.srcIP[:], ipData[12:16])
 	copy(key.dstIP[:], ipData[16:20])
+	src := netip.AddrFrom4([4]byte(ipData[12:16]))
+
+	result, _, complete, err := r.reassemble(key, src, byteOffset, moreFragments, 0, ipData[ihl:totalLen], timestamp)
+	return result, complete, err
+}
+
+// reassemble adds the fragment payload at byteOffset to the datagram key
+// from src and returns the datagram's payload once it is complete, with the
+// nextHeader passed with its first fragment (IPv6).
+func (r *Reassembler) reassemble(key fragmentKey, src netip.Addr, byteOffset uint16, moreFragments bool, nextHeader uint8, data []byte, timestamp time.Time) ([]byte, uint8, bool, error) {
+	fragPayloadLen := uint16(len(data))
+
+	// Per-source-IP rate limiting (DoS protection)
+	if l := r.rateLimiter.Load(); l != nil && !l.AllowAddr(src, timestamp) {
+		return nil, 0, false, fmt.Errorf("fragment rate limit exceeded for source IP %s", src)
+	}
 
 	// Get or create fragment list for this flow
 	r.mu.Lock()
@@ -173,7 +186,7 @@ func (r *Reassembler) Process(ipData []byte, timestamp time.Time) ([]byte, bool,
 
 	// Copy fragment payload (the original buffer may be reused by the capture ring)
 	payload := make([]byte, fragPayloadLen)
-	copy(payload, ipData[ihl:totalLen])
+	copy(payload, data)
 
 	fl.mu.Lock()
 	defer fl.mu.Unlock()
@@ -183,7 +196,7 @@ func (r *Reassembler) Process(ipData []byte, timestamp time.Time) ([]byte, bool,
 		fl.mu.Unlock()
 		r.evictFlow(key)
 		fl.mu.Lock()
-		return nil, false, fmt.Errorf("fragment list exceeded max size %d", ipv4MaxFragListLen)
+		return nil, 0, false, fmt.Errorf("fragment list exceeded max size %d", ipv4MaxFragListLen)
 	}
 
 	// Check per-flow fragment count limit from config
@@ -191,10 +204,13 @@ func (r *Reassembler) Process(ipData []byte, timestamp time.Time) ([]byte, bool,
 		fl.mu.Unlock()
 		r.evictFlow(key)
 		fl.mu.Lock()
-		return nil, false, fmt.Errorf("fragment count exceeded limit %d", r.config.MaxFragments)
+		return nil, 0, false, fmt.Errorf("fragment count exceeded limit %d", r.config.MaxFragments)
 	}
 
 	fl.lastSeen = timestamp
+	if byteOffset == 0 {
+		fl.nextHeader = nextHeader
+	}
 
 	// Record if this is the last fragment
 	if !moreFragments {
@@ -220,12 +236,34 @@ func (r *Reassembler) Process(ipData []byte, timestamp time.Time) ([]byte, bool,
 		r.evictFlow(key)
 		fl.mu.Lock()
 		if err != nil {
-			return nil, false, err
+			return nil, 0, false, err
 		}
-		return result, true, nil
+		return result, fl.nextHeader, true, nil
+	}
+
+	return nil, 0, false, nil
+}
+
+// SetRateLimit changes the per-source-IP fragment rate limit at runtime;
+// maxPerIP <= 0 disables it and window <= 0 keeps the current window (10s
+// for a new limiter). The limiter, with its counters, is kept once created.
+func (r *Reassembler) SetRateLimit(maxPerIP int, window time.Duration) {
+	if l := r.rateLimiter.Load(); l != nil {
+		l.SetLimits(maxPerIP, window)
+		return
 	}
+	if l := NewFragmentRateLimiter(FragmentRateLimiterConfig{
+		MaxFragsPerIP:   maxPerIP,
+		RateLimitWindow: window,
+	}); l != nil && !r.rateLimiter.CompareAndSwap(nil, l) {
+		r.rateLimiter.Load().SetLimits(maxPerIP, window)
+	}
+}
 
-	return nil, false, nil
+// RateLimiter returns the fragment rate limiter, nil if rate limiting was
+// never enabled.
+func (r *Reassembler) RateLimiter() *FragmentRateLimiter {
+	return r.rateLimiter.Load()
 }
 
 // securityChecks validates fragment parameters to prevent attacks.
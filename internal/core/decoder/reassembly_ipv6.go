@@ -0,0 +1,124 @@
+// Package decoder implements protocol decoding.
+package decoder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// IPv6 extension headers that can precede or follow the Fragment header
+// (RFC 8200 §4).
+const (
+	ipv6HopByHop      = 0
+	ipv6Routing       = 43
+	ipv6Fragment      = 44
+	ipv6Destination   = 60
+	ipv6FragHeaderLen = 8
+)
+
+// ipv6FragmentHeader returns the offset of the Fragment header in the IPv6
+// packet ipData, skipping the Hop-by-Hop, Routing and Destination Options
+// headers of the unfragmentable part; ok is false if there is none.
+func ipv6FragmentHeader(ipData []byte) (offset int, ok bool) {
+	if len(ipData) < ipv6HeaderLen {
+		return 0, false
+	}
+	next, off := ipData[6], ipv6HeaderLen
+	for {
+		switch next {
+		case ipv6Fragment:
+			return off, len(ipData) >= off+ipv6FragHeaderLen
+		case ipv6HopByHop, ipv6Routing, ipv6Destination:
+			if len(ipData) < off+2 {
+				return 0, false
+			}
+			next = ipData[off]
+			off += (int(ipData[off+1]) + 1) * 8
+		default:
+			return 0, false
+		}
+	}
+}
+
+// skipIPv6Extensions skips the Hop-by-Hop, Routing and Destination Options
+// headers at the start of data, which carries next, and returns the
+// upper-layer protocol and its payload. A truncated header is left in place.
+func skipIPv6Extensions(next uint8, data []byte) (uint8, []byte) {
+	for next == ipv6HopByHop || next == ipv6Routing || next == ipv6Destination {
+		if len(data) < 2 {
+			break
+		}
+		n := (int(data[1]) + 1) * 8
+		if len(data) < n {
+			break
+		}
+		next, data = data[0], data[n:]
+	}
+	return next, data
+}
+
+// ProcessIPv6 processes raw IPv6 packet bytes (including the IPv6 header)
+// carrying a Fragment header. Fragments are keyed by source, destination and
+// identification and reassembled with the BSD-Right policy, limits and rate
+// limiter of Process. Extension headers after the Fragment header are
+// skipped, so the returned protocol is the upper-layer one.
+// Returns:
+//   - Atomic fragment (offset 0, M=0, RFC 6946): (payload, protocol, true, nil) — no copy
+//   - Fragment not yet complete: (nil, 0, false, nil) — waiting for more fragments
+//   - Fragment reassembled: (reassembledPayload, protocol, true, nil) — complete datagram
+//   - Error: (nil, 0, false, err) — no Fragment header, security check failed or limits exceeded
+func (r *Reassembler) ProcessIPv6(ipData []byte, timestamp time.Time) ([]byte, uint8, bool, error) {
+	fh, ok := ipv6FragmentHeader(ipData)
+	if !ok {
+		return nil, 0, false, fmt.Errorf("no IPv6 fragment header")
+	}
+
+	end := ipv6HeaderLen + int(binary.BigEndian.Uint16(ipData[4:6]))
+	if end < fh+ipv6FragHeaderLen || end > len(ipData) {
+		end = len(ipData) // Clamp to actual data length if bogus
+	}
+
+	// Fragment header layout:
+	//   byte 0:     Next Header
+	//   bytes 2-3:  Fragment Offset(13) + Res(2) + M(1)
+	//   bytes 4-7:  Identification
+	hdr := ipData[fh : fh+ipv6FragHeaderLen]
+	next := hdr[0]
+	offsetFlags := binary.BigEndian.Uint16(hdr[2:4])
+	fragOffset := offsetFlags >> 3
+	moreFragments := offsetFlags&1 != 0
+	data := ipData[fh+ipv6FragHeaderLen : end]
+
+	if !moreFragments && fragOffset == 0 {
+		protocol, payload := skipIPv6Extensions(next, data)
+		return payload, protocol, true, nil
+	}
+
+	// Every fragment but the last carries a multiple of 8 bytes (RFC 8200 §4.5)
+	if moreFragments && len(data)%8 != 0 {
+		return nil, 0, false, fmt.Errorf("IPv6 fragment length %d is not a multiple of 8", len(data))
+	}
+	if len(data) > ipv4MaxSize {
+		return nil, 0, false, fmt.Errorf("IPv6 fragment too large: %d bytes", len(data))
+	}
+	if err := r.securityChecks(uint16(len(data)), fragOffset); err != nil {
+		return nil, 0, false, err
+	}
+
+	key := fragmentKey{
+		id: binary.BigEndian.Uint32(hdr[4:8]),
+		v6: true,
+	}
+	copy(key.srcIP[:], ipData[8:24])
+	copy(key.dstIP[:], ipData[24:40])
+	src := netip.AddrFrom16(key.srcIP)
+
+	result, protocol, complete, err := r.reassemble(key, src, fragOffset*8, moreFragments, next, data, timestamp)
+	if err != nil || !complete {
+		return nil, 0, false, err
+	}
+	protocol, result = skipIPv6Extensions(protocol, result)
+	return result, protocol, true, nil
+}
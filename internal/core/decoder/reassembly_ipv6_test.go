@@ -0,0 +1,207 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+var (
+	v6Src = netip.MustParseAddr("2001:db8::1")
+	v6Dst = netip.MustParseAddr("2001:db8::2")
+)
+
+// buildIPv6Fragment constructs a raw IPv6 packet with a Fragment header.
+// ext are extension headers of the unfragmentable part, each a complete
+// header whose first byte is overwritten with the following header's number.
+// fragOffset is in 8-byte units.
+func buildIPv6Fragment(src netip.Addr, next uint8, fragID uint32, fragOffset uint16, moreFragments bool, payload []byte, ext ...[]byte) []byte {
+	pkt := make([]byte, ipv6HeaderLen)
+	pkt[0] = 0x60
+	pkt[7] = 64
+	copy(pkt[8:24], src.AsSlice())
+	copy(pkt[24:40], v6Dst.AsSlice())
+
+	headers := append(ext, make([]byte, ipv6FragHeaderLen))
+	pkt[6] = ipv6HopByHop
+	if len(ext) == 0 {
+		pkt[6] = ipv6Fragment
+	}
+	for i, h := range headers[:len(headers)-1] {
+		h[0] = ipv6Destination
+		if i == len(headers)-2 {
+			h[0] = ipv6Fragment
+		}
+		pkt = append(pkt, h...)
+	}
+
+	frag := headers[len(headers)-1]
+	frag[0] = next
+	offsetFlags := fragOffset << 3
+	if moreFragments {
+		offsetFlags |= 1
+	}
+	binary.BigEndian.PutUint16(frag[2:4], offsetFlags)
+	binary.BigEndian.PutUint32(frag[4:8], fragID)
+	pkt = append(pkt, frag...)
+	pkt = append(pkt, payload...)
+	binary.BigEndian.PutUint16(pkt[4:6], uint16(len(pkt)-ipv6HeaderLen))
+	return pkt
+}
+
+func TestReassemblerIPv6_TwoFragments(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{})
+	now := time.Now()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 6) // 96 bytes
+
+	// Out of order, with a Hop-by-Hop header before the Fragment header
+	hbh := make([]byte, 8)
+	result, protocol, complete, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 0xdead, 8, false, data[64:], hbh), now)
+	if err != nil || complete || result != nil {
+		t.Fatalf("last fragment first: result=%v complete=%v err=%v", result, complete, err)
+	}
+	result, protocol, complete, err = r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 0xdead, 0, true, data[:64], hbh), now)
+	if err != nil || !complete {
+		t.Fatalf("first fragment: complete=%v err=%v", complete, err)
+	}
+	if protocol != 17 || !bytes.Equal(result, data) {
+		t.Errorf("reassembled protocol %d, %d bytes, want UDP and the original %d bytes", protocol, len(result), len(data))
+	}
+
+	r.mu.Lock()
+	flows := len(r.flows)
+	r.mu.Unlock()
+	if flows != 0 {
+		t.Errorf("%d flows left after reassembly", flows)
+	}
+}
+
+func TestReassemblerIPv6_OverlapKeepsFirst(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{})
+	now := time.Now()
+
+	r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 1, 0, true, bytes.Repeat([]byte{0xAA}, 16)), now)
+	// Overlaps bytes 8-15 with other data: BSD-Right keeps the first copy
+	r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 1, 1, true, bytes.Repeat([]byte{0xBB}, 16)), now)
+	result, _, complete, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 1, 3, false, []byte{0xCC}), now)
+	if err != nil || !complete {
+		t.Fatalf("complete=%v err=%v", complete, err)
+	}
+	want := append(append(bytes.Repeat([]byte{0xAA}, 16), bytes.Repeat([]byte{0xBB}, 8)...), 0xCC)
+	if !bytes.Equal(result, want) {
+		t.Errorf("result = % x, want % x", result, want)
+	}
+}
+
+func TestReassemblerIPv6_DestinationOptionsAfterFragment(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{})
+	now := time.Now()
+
+	// The fragmentable part starts with a Destination Options header
+	dst := make([]byte, 8)
+	dst[0] = 17
+	udp := bytes.Repeat([]byte{0x55}, 24)
+	data := append(dst, udp...)
+
+	r.ProcessIPv6(buildIPv6Fragment(v6Src, ipv6Destination, 2, 0, true, data[:16]), now)
+	result, protocol, complete, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, ipv6Destination, 2, 2, false, data[16:]), now)
+	if err != nil || !complete || protocol != 17 || !bytes.Equal(result, udp) {
+		t.Errorf("protocol %d result % x complete=%v err=%v, want UDP after the options", protocol, result, complete, err)
+	}
+}
+
+func TestReassemblerIPv6_AtomicFragment(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{})
+	pkt := buildIPv6Fragment(v6Src, 17, 3, 0, false, []byte("atomic"))
+	result, protocol, complete, err := r.ProcessIPv6(pkt, time.Now())
+	if err != nil || !complete || protocol != 17 || string(result) != "atomic" {
+		t.Errorf("atomic fragment: %q protocol %d complete=%v err=%v", result, protocol, complete, err)
+	}
+	if isIPFragment(pkt, 6) {
+		t.Error("atomic fragment reported as a fragment")
+	}
+}
+
+func TestReassemblerIPv6_Errors(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{})
+	now := time.Now()
+
+	// Non-final fragment not a multiple of 8 bytes
+	if _, _, _, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 4, 0, true, make([]byte, 12)), now); err == nil ||
+		!strings.Contains(err.Error(), "multiple of 8") {
+		t.Errorf("odd fragment length: err = %v", err)
+	}
+	// Past the maximum datagram size
+	if _, _, _, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, 4, 8190, false, make([]byte, 100)), now); err == nil {
+		t.Error("oversized fragment accepted")
+	}
+	// No Fragment header
+	plain := buildIPv6Fragment(v6Src, 17, 4, 0, false, nil)
+	plain[6] = 17
+	if _, _, _, err := r.ProcessIPv6(plain, now); err == nil {
+		t.Error("packet without a Fragment header accepted")
+	}
+}
+
+func TestReassemblerIPv6_RateLimit(t *testing.T) {
+	r := NewReassembler(ReassemblyConfig{MaxFragsPerIP: 2, RateLimitWindow: time.Minute})
+	now := time.Now()
+	for i := range 3 {
+		_, _, _, err := r.ProcessIPv6(buildIPv6Fragment(v6Src, 17, uint32(10+i), 0, true, make([]byte, 8)), now)
+		if i < 2 && err != nil {
+			t.Fatalf("fragment %d: %v", i, err)
+		}
+		if i == 2 && (err == nil || !strings.Contains(err.Error(), "2001:db8::1")) {
+			t.Errorf("third fragment: err = %v, want rate limited", err)
+		}
+	}
+	if top := r.RateLimiter().TopOffenders(1); len(top) != 1 || top[0].SrcIP != "2001:db8::1" {
+		t.Errorf("top offenders = %+v", top)
+	}
+}
+
+func TestDecode_IPv6Fragments(t *testing.T) {
+	d := NewStandardDecoder(Config{IPReassembly: true})
+	udp := append([]byte{0x13, 0xc4, 0x13, 0xd8, 0, byte(8 + len(sipPayload)), 0, 0}, sipPayload...)
+	eth := []byte{0, 0x11, 0x22, 0x33, 0x44, 0x55, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x86, 0xdd}
+
+	for i, frag := range [][]byte{
+		buildIPv6Fragment(v6Src, 17, 9, 0, true, udp[:16]),
+		buildIPv6Fragment(v6Src, 17, 9, 2, false, udp[16:]),
+	} {
+		frame := append(append([]byte{}, eth...), frag...)
+		pkt, err := d.Decode(core.RawPacket{Data: frame, Timestamp: time.Now()})
+		if i == 0 {
+			if !errors.Is(err, core.ErrFragmentIncomplete) {
+				t.Fatalf("first fragment: err = %v, want ErrFragmentIncomplete", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("last fragment: %v", err)
+		}
+		if !pkt.Reassembled || pkt.IP.Protocol != 17 || pkt.IP.SrcIP != v6Src || pkt.Transport.DstPort != 5080 ||
+			!bytes.Equal(pkt.Payload, sipPayload) {
+			t.Errorf("reassembled = %v, IP %+v, dst port %d, payload %q", pkt.Reassembled, pkt.IP, pkt.Transport.DstPort, pkt.Payload)
+		}
+	}
+	if d.Fallbacks() != 0 {
+		t.Errorf("Fallbacks() = %d, want the fast path", d.Fallbacks())
+	}
+
+	// Without reassembly, IPv6 fragments are left to the fallback decoder
+	d = NewStandardDecoder(Config{})
+	frame := append(append([]byte{}, eth...), buildIPv6Fragment(v6Src, 17, 9, 0, true, udp[:16], make([]byte, 8))...)
+	if _, err := d.Decode(core.RawPacket{Data: frame, Timestamp: time.Now()}); err != nil {
+		t.Fatalf("Decode without reassembly: %v", err)
+	}
+	if d.Fallbacks() != 1 {
+		t.Errorf("Fallbacks() = %d, want 1", d.Fallbacks())
+	}
+}
@@ -447,7 +447,7 @@ func TestReassembler_FlowEvictionAfterComplete(t *testing.T) {
 
 	// Flow should be cleaned up
 	r.mu.Lock()
-	key := fragmentKey{protocol: 17, id: fragID}
+	key := fragmentKey{protocol: 17, id: uint32(fragID)}
 	copy(key.srcIP[:], src[:])
 	copy(key.dstIP[:], dst[:])
 	_, exists := r.flows[key]
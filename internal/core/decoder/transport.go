@@ -10,10 +10,25 @@ import (
 const (
 	udpHeaderLen    = 8
 	tcpHeaderMinLen = 20
+	sctpHeaderLen   = 12
 
 	// Protocol numbers
-	protocolTCP = 6
-	protocolUDP = 17
+	protocolTCP  = 6
+	protocolUDP  = 17
+	protocolSCTP = 132
+)
+
+// SCTP chunks (RFC 9260, RFC 8260)
+const (
+	sctpChunkHeaderLen = 4
+	sctpChunkData      = 0
+	sctpChunkIData     = 64
+	sctpDataHeaderLen  = 16 // chunk header, TSN, stream ID, SSN, PPID
+	sctpIDataHeaderLen = 20 // chunk header, TSN, stream ID, reserved, MID, PPID/FSN
+
+	// sctpUnfragmented is the B (beginning) and E (ending) flags of a DATA
+	// chunk carrying a whole user message.
+	sctpUnfragmented = 0x03
 )
 
 // decodeTransport decodes transport layer header (TCP/UDP).
@@ -25,7 +40,7 @@ func decodeTransport(data []byte, protocol uint8) (core.TransportHeader, []byte,
 	case protocolUDP:
 		return decodeUDP(data)
 	default:
-		// Unsupported transport protocol (e.g., SCTP, ICMP)
+		// Unsupported transport protocol (e.g., ICMP); SCTP is decodeSCTP
 		return core.TransportHeader{Protocol: protocol}, data, nil
 	}
 }
@@ -93,3 +108,73 @@ func decodeTCP(data []byte) (core.TransportHeader, []byte, error) {
 	payload := data[headerLen:]
 	return transport, payload, nil
 }
+
+// decodeSCTP decodes the SCTP common header and the DATA and I-DATA chunks
+// of the packet into decoded. The payload is the user data of the chunks carrying whole
+// user messages, concatenated in chunk order (a single chunk is not copied);
+// fragments of larger messages are not reassembled and are skipped, as are
+// control chunks (INIT, SACK, HEARTBEAT, ...) bundled with the data.
+func decodeSCTP(data []byte, decoded *core.DecodedPacket) error {
+	if len(data) < sctpHeaderLen {
+		return core.ErrPacketTooShort
+	}
+
+	transport := core.TransportHeader{
+		Protocol: protocolSCTP,
+	}
+	var sctp core.SCTPData
+
+	// Source Port (2 bytes at offset 0)
+	transport.SrcPort = binary.BigEndian.Uint16(data[0:2])
+
+	// Destination Port (2 bytes at offset 2)
+	transport.DstPort = binary.BigEndian.Uint16(data[2:4])
+
+	// Verification Tag (4 bytes at offset 4) and CRC32c Checksum (4 bytes at
+	// offset 8) - not needed for decoding
+
+	var payload []byte
+	copied := false
+	for chunks := data[sctpHeaderLen:]; len(chunks) >= sctpChunkHeaderLen; {
+		typ, flags := chunks[0], chunks[1]
+		length := int(binary.BigEndian.Uint16(chunks[2:4]))
+		if length < sctpChunkHeaderLen || length > len(chunks) {
+			break // malformed or truncated by the snap length
+		}
+		chunk := chunks[:length]
+		// Chunks are padded to a multiple of 4 bytes; the last may omit it
+		chunks = chunks[min((length+3)&^3, len(chunks)):]
+
+		headerLen := 0
+		switch typ {
+		case sctpChunkData:
+			headerLen = sctpDataHeaderLen
+		case sctpChunkIData:
+			headerLen = sctpIDataHeaderLen
+		}
+		if headerLen == 0 || length < headerLen || flags&sctpUnfragmented != sctpUnfragmented {
+			continue
+		}
+
+		if len(sctp.Streams) == 0 {
+			if typ == sctpChunkData {
+				sctp.PPID = binary.BigEndian.Uint32(chunk[12:16])
+			} else {
+				sctp.PPID = binary.BigEndian.Uint32(chunk[16:20])
+			}
+		}
+		sctp.Streams = append(sctp.Streams, binary.BigEndian.Uint16(chunk[8:10]))
+
+		switch userData := chunk[headerLen:]; {
+		case payload == nil:
+			payload = userData
+		case !copied:
+			payload = append(append(make([]byte, 0, len(payload)+len(userData)), payload...), userData...)
+			copied = true
+		default:
+			payload = append(payload, userData...)
+		}
+	}
+	decoded.Transport, decoded.Payload, decoded.SCTP = transport, payload, sctp
+	return nil
+}
@@ -1,7 +1,12 @@
 package decoder
 
 import (
+	"encoding/binary"
+	"slices"
 	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
 )
 
 func TestDecodeUDP(t *testing.T) {
@@ -164,6 +169,135 @@ func TestDecodeTransportUnsupported(t *testing.T) {
 	}
 }
 
+// sctpChunk builds a DATA (type 0) or I-DATA (type 64) chunk, padded to 4
+// bytes, or a control chunk of another type carrying data as its value.
+func sctpChunk(typ, flags uint8, stream uint16, ppid uint32, data string) []byte {
+	var header []byte
+	switch typ {
+	case sctpChunkData:
+		header = make([]byte, sctpDataHeaderLen)
+		binary.BigEndian.PutUint32(header[4:8], 1) // TSN
+		binary.BigEndian.PutUint16(header[8:10], stream)
+		binary.BigEndian.PutUint32(header[12:16], ppid)
+	case sctpChunkIData:
+		header = make([]byte, sctpIDataHeaderLen)
+		binary.BigEndian.PutUint32(header[4:8], 1) // TSN
+		binary.BigEndian.PutUint16(header[8:10], stream)
+		binary.BigEndian.PutUint32(header[16:20], ppid)
+	default:
+		header = make([]byte, sctpChunkHeaderLen)
+	}
+	header[0], header[1] = typ, flags
+	chunk := append(header, data...)
+	binary.BigEndian.PutUint16(chunk[2:4], uint16(len(chunk)))
+	for len(chunk)%4 != 0 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// sctpPacket builds an SCTP packet from 5060 to 5060 with the chunks.
+func sctpPacket(chunks ...[]byte) []byte {
+	data := []byte{
+		0x13, 0xC4, 0x13, 0xC4, // Src Port: 5060, Dst Port: 5060
+		0x01, 0x02, 0x03, 0x04, // Verification Tag
+		0x00, 0x00, 0x00, 0x00, // Checksum
+	}
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return data
+}
+
+func TestDecodeSCTP(t *testing.T) {
+	const invite = "INVITE sip:bob@example.com SIP/2.0\r\n\r\n"
+	const bye = "BYE sip:bob@example.com SIP/2.0\r\n\r\n"
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		payload string
+		streams []uint16
+		ppid    uint32
+	}{
+		{"single DATA chunk", sctpPacket(sctpChunk(sctpChunkData, 0x03, 2, 0, invite)), invite, []uint16{2}, 0},
+		{
+			"bundled SACK and DATA chunks",
+			sctpPacket(
+				sctpChunk(3, 0, 0, 0, "sack-body-12"), // SACK
+				sctpChunk(sctpChunkData, 0x03, 0, 46, invite),
+				sctpChunk(sctpChunkData, 0x07, 3, 46, bye), // unordered
+			),
+			invite + bye, []uint16{0, 3}, 46,
+		},
+		{
+			"fragments are skipped",
+			sctpPacket(
+				sctpChunk(sctpChunkData, 0x02, 1, 0, "INVITE sip:"), // B only
+				sctpChunk(sctpChunkData, 0x03, 4, 0, bye),
+			),
+			bye, []uint16{4}, 0,
+		},
+		{"I-DATA chunk", sctpPacket(sctpChunk(sctpChunkIData, 0x03, 5, 7, invite)), invite, []uint16{5}, 7},
+		{"control chunks only", sctpPacket(sctpChunk(4, 0, 0, 0, "heartbeat")), "", nil, 0},
+		{
+			"truncated chunk",
+			sctpPacket(sctpChunk(sctpChunkData, 0x03, 0, 0, bye), sctpChunk(sctpChunkData, 0x03, 1, 0, invite)[:30]),
+			bye, []uint16{0}, 0,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var decoded core.DecodedPacket
+			if err := decodeSCTP(tc.data, &decoded); err != nil {
+				t.Fatalf("decodeSCTP failed: %v", err)
+			}
+			transport, payload, sctp := decoded.Transport, decoded.Payload, decoded.SCTP
+			if transport.Protocol != 132 || transport.SrcPort != 5060 || transport.DstPort != 5060 {
+				t.Errorf("transport = %+v", transport)
+			}
+			if string(payload) != tc.payload {
+				t.Errorf("payload = %q, want %q", payload, tc.payload)
+			}
+			if !slices.Equal(sctp.Streams, tc.streams) || sctp.PPID != tc.ppid {
+				t.Errorf("streams %v ppid %d, want %v %d", sctp.Streams, sctp.PPID, tc.streams, tc.ppid)
+			}
+		})
+	}
+
+	if err := decodeSCTP(make([]byte, 11), &core.DecodedPacket{}); err != core.ErrPacketTooShort {
+		t.Errorf("short header: err = %v, want ErrPacketTooShort", err)
+	}
+}
+
+func TestStandardDecoderSCTP(t *testing.T) {
+	const options = "OPTIONS sip:sbc.example.com SIP/2.0\r\n\r\n"
+	sctp := sctpPacket(sctpChunk(sctpChunkData, 0x03, 0, 0, options))
+
+	packet := makeSimpleUDPPacket()[:34]
+	packet[23] = protocolSCTP
+	binary.BigEndian.PutUint16(packet[16:18], uint16(20+len(sctp)))
+	packet = append(packet, sctp...)
+
+	decoded, err := NewStandardDecoder(Config{}).Decode(core.RawPacket{
+		Data: packet, Timestamp: time.Now(), CaptureLen: uint32(len(packet)), OrigLen: uint32(len(packet)),
+	})
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Transport.Protocol != 132 || decoded.Transport.DstPort != 5060 || string(decoded.Payload) != options {
+		t.Errorf("transport %+v, payload %q", decoded.Transport, decoded.Payload)
+	}
+
+	// The fallback decodes the same packet identically.
+	var slow core.DecodedPacket
+	if err := decodeFallback(packet, &slow); err != nil {
+		t.Fatal(err)
+	}
+	if slow.Transport != decoded.Transport || string(slow.Payload) != options || !slices.Equal(slow.SCTP.Streams, decoded.SCTP.Streams) {
+		t.Errorf("fallback transport %+v, payload %q, sctp %+v", slow.Transport, slow.Payload, slow.SCTP)
+	}
+}
+
 func BenchmarkDecodeUDP(b *testing.B) {
 	data := []byte{
 		0x13, 0x88, 0x13, 0x89,
@@ -13,13 +13,26 @@ const (
 	protocolIPIP = 4
 
 	// Well-known UDP ports
-	vxlanPort  = 4789
+	vxlanPort  = 4789 // default of Config.VXLANPorts
 	genevePort = 6081
+	gtpuPort   = 2152
 
 	// Header lengths
 	vxlanHeaderLen  = 8
 	geneveHeaderLen = 8
 	greHeaderMinLen = 4
+
+	vxlanFlagVNI = 0x08 // I flag: the VNI is valid
+
+	// GTPv1-U (3GPP TS 29.281)
+	gtpuHeaderLen  = 8
+	gtpuOptLen     = 4    // sequence number, N-PDU number, next extension type
+	gtpuVersion1   = 1    // version field (top 3 bits of the flags)
+	gtpuFlagPT     = 0x10 // protocol type: GTP (not GTP')
+	gtpuFlagsOpt   = 0x07 // E, S, PN: the optional fields are present
+	gtpuFlagExt    = 0x04 // E: extension headers follow
+	gtpuMsgGPDU    = 0xff // G-PDU, carrying a user plane packet
+	gtpuMaxExtHdrs = 16   // bound on the extension header chain
 )
 
 // decodeTunnel attempts to decapsulate tunnel protocols.
@@ -31,17 +44,9 @@ func decodeTunnel(data []byte, protocol uint8) (core.IPHeader, []byte, error) {
 	case protocolIPIP:
 		return decodeIPIP(data)
 	case protocolUDP:
-		// Check for VXLAN or Geneve based on port
-		// Need to parse UDP header first
-		if len(data) >= 8 {
-			dstPort := binary.BigEndian.Uint16(data[2:4])
-			udpPayload := data[8:]
-
-			if dstPort == vxlanPort {
-				return decodeVXLAN(udpPayload)
-			} else if dstPort == genevePort {
-				return decodeGeneve(udpPayload)
-			}
+		// Geneve by port; VXLAN is decoded by StandardDecoder.decodeVXLAN
+		if len(data) >= udpHeaderLen && binary.BigEndian.Uint16(data[2:4]) == genevePort {
+			return decodeGeneve(data[udpHeaderLen:])
 		}
 		return core.IPHeader{}, data, nil
 	default:
@@ -49,45 +54,70 @@ func decodeTunnel(data []byte, protocol uint8) (core.IPHeader, []byte, error) {
 	}
 }
 
-// decodeVXLAN decapsulates VXLAN tunnel.
-func decodeVXLAN(data []byte) (core.IPHeader, []byte, error) {
-	if len(data) < vxlanHeaderLen {
-		return core.IPHeader{}, data, nil
-	}
-
-	// VXLAN header format:
-	// 0-3: Flags (1 byte) + Reserved (3 bytes)
-	// 4-7: VNI (3 bytes) + Reserved (1 byte)
-
-	// Check if VNI flag is set (bit 3 of first byte)
-	flags := data[0]
-	if (flags & 0x08) == 0 {
-		// Invalid VXLAN packet
-		return core.IPHeader{}, data, nil
-	}
-
-	// Skip VXLAN header (8 bytes)
-	// Inner Ethernet frame starts after VXLAN header
-	innerFrame := data[vxlanHeaderLen:]
-
-	// Skip inner Ethernet header (assume 14 bytes, no VLAN)
-	if len(innerFrame) < ethernetHeaderLen {
-		return core.IPHeader{}, data, nil
+// vxlanFrame returns the Ethernet frame carried by udp, a UDP header and
+// its payload, when udp is addressed to one of ports and starts with a valid
+// VXLAN header (RFC 7348: the I flag set).
+func vxlanFrame(udp []byte, ports map[uint16]bool) ([]byte, bool) {
+	if len(udp) < udpHeaderLen+vxlanHeaderLen || !ports[binary.BigEndian.Uint16(udp[2:4])] {
+		return nil, false
 	}
-
-	// Get inner EtherType
-	etherType := binary.BigEndian.Uint16(innerFrame[12:14])
-	if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
-		return core.IPHeader{}, data, nil
+	vxlan := udp[udpHeaderLen:]
+	if vxlan[0]&vxlanFlagVNI == 0 {
+		return nil, false
 	}
+	return vxlan[vxlanHeaderLen:], true
+}
 
-	// Decode inner IP packet
-	innerIP, payload, err := decodeIP(innerFrame[ethernetHeaderLen:])
-	if err != nil {
-		return core.IPHeader{}, data, nil
+// gtpuPayload returns the user plane IP packet and TEID carried by udp, a
+// UDP header and its payload, when it is a GTPv1-U G-PDU to port 2152.
+// Signalling messages (echo, error indication, end marker) are not
+// decapsulated.
+func gtpuPayload(udp []byte) ([]byte, uint32, bool) {
+	if len(udp) < udpHeaderLen+gtpuHeaderLen || binary.BigEndian.Uint16(udp[2:4]) != gtpuPort {
+		return nil, 0, false
+	}
+	gtp := udp[udpHeaderLen:]
+	flags := gtp[0]
+	if flags>>5 != gtpuVersion1 || flags&gtpuFlagPT == 0 || gtp[1] != gtpuMsgGPDU {
+		return nil, 0, false
+	}
+	teid := binary.BigEndian.Uint32(gtp[4:8])
+	// The length field counts the bytes after the mandatory header
+	end := gtpuHeaderLen + int(binary.BigEndian.Uint16(gtp[2:4]))
+	if end > len(gtp) {
+		return nil, 0, false
+	}
+	gtp = gtp[:end]
+
+	off := gtpuHeaderLen
+	if flags&gtpuFlagsOpt != 0 {
+		off += gtpuOptLen
+		if off > len(gtp) {
+			return nil, 0, false
+		}
+		// Extension headers: length in 4-byte units, next type in the last byte
+		next := gtp[off-1]
+		for i := 0; flags&gtpuFlagExt != 0 && next != 0; i++ {
+			if i == gtpuMaxExtHdrs || off >= len(gtp) || gtp[off] == 0 {
+				return nil, 0, false
+			}
+			n := int(gtp[off]) * 4
+			if off+n > len(gtp) {
+				return nil, 0, false
+			}
+			next = gtp[off+n-1]
+			off += n
+		}
 	}
+	return gtp[off:], teid, true
+}
 
-	return innerIP, payload, nil
+// tunneled returns the inner header of a VXLAN or GTP-U packet, with the
+// addresses of both headers recorded.
+func tunneled(outer, inner core.IPHeader) core.IPHeader {
+	inner.InnerSrcIP, inner.InnerDstIP = inner.SrcIP, inner.DstIP
+	inner.OuterSrcIP, inner.OuterDstIP = outer.SrcIP, outer.DstIP
+	return inner
 }
 
 // decodeGeneve decapsulates Geneve tunnel.
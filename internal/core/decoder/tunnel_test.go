@@ -0,0 +1,187 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// buildVXLAN builds SIP over UDP in a VLAN-tagged Ethernet frame, carried
+// by VXLAN between two hypervisors on port.
+func buildVXLAN(t testing.TB, port layers.UDPPort, valid bool) []byte {
+	outerIP := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IP{172, 16, 0, 1}, DstIP: net.IP{172, 16, 0, 2}}
+	outerUDP := &layers.UDP{SrcPort: 49152, DstPort: port}
+	if err := outerUDP.SetNetworkLayerForChecksum(outerIP); err != nil {
+		t.Fatal(err)
+	}
+	ip, udp := ipv4UDP(t)
+	return serialize(t, ethernet(layers.EthernetTypeIPv4), outerIP, outerUDP,
+		&layers.VXLAN{ValidIDFlag: valid, VNI: 100},
+		ethernet(layers.EthernetTypeDot1Q),
+		&layers.Dot1Q{VLANIdentifier: 10, Type: layers.EthernetTypeIPv4},
+		ip, udp, gopacket.Payload(sipPayload))
+}
+
+func TestDecode_VXLAN(t *testing.T) {
+	d := NewStandardDecoder(Config{Tunnels: []string{"vxlan"}})
+	pkt := decodeFrame(t, d, buildVXLAN(t, 4789, true))
+
+	if pkt.IP.SrcIP != netip.MustParseAddr("10.0.0.1") || pkt.IP.DstIP != netip.MustParseAddr("10.0.0.2") ||
+		pkt.Transport.SrcPort != 5060 || pkt.Transport.DstPort != 5080 || pkt.IP.Protocol != 17 {
+		t.Errorf("5-tuple = %v:%d → %v:%d/%d, want the inner one",
+			pkt.IP.SrcIP, pkt.Transport.SrcPort, pkt.IP.DstIP, pkt.Transport.DstPort, pkt.IP.Protocol)
+	}
+	if pkt.IP.OuterSrcIP != netip.MustParseAddr("172.16.0.1") || pkt.IP.OuterDstIP != netip.MustParseAddr("172.16.0.2") ||
+		pkt.IP.InnerSrcIP != pkt.IP.SrcIP {
+		t.Errorf("tunnel addresses = %+v", pkt.IP)
+	}
+	if !bytes.Equal(pkt.Payload, sipPayload) {
+		t.Errorf("payload = %q", pkt.Payload)
+	}
+	if d.Fallbacks() != 0 {
+		t.Errorf("Fallbacks() = %d, want 0", d.Fallbacks())
+	}
+}
+
+func TestDecode_VXLANNotDecapsulated(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg   Config
+		frame []byte
+	}{
+		"disabled":     {Config{}, buildVXLAN(t, 4789, true)},
+		"other port":   {Config{Tunnels: []string{"vxlan"}}, buildVXLAN(t, 8472, true)},
+		"no VNI flag":  {Config{Tunnels: []string{"vxlan"}}, buildVXLAN(t, 4789, false)},
+		"geneve only":  {Config{Tunnels: []string{"geneve"}}, buildVXLAN(t, 4789, true)},
+		"bad inner IP": {Config{Tunnels: []string{"vxlan"}}, buildVXLAN(t, 4789, true)[:14+20+8+8+14+4+10]},
+	} {
+		pkt := decodeFrame(t, NewStandardDecoder(tc.cfg), tc.frame)
+		if pkt.IP.SrcIP != netip.MustParseAddr("172.16.0.1") || pkt.IP.OuterSrcIP.IsValid() || pkt.Transport.SrcPort != 49152 {
+			t.Errorf("%s: decoded %v:%d, want the outer packet", name, pkt.IP.SrcIP, pkt.Transport.SrcPort)
+		}
+	}
+}
+
+func TestDecode_VXLANPorts(t *testing.T) {
+	d := NewStandardDecoder(Config{Tunnels: []string{"vxlan"}, VXLANPorts: []uint16{8472}})
+	if pkt := decodeFrame(t, d, buildVXLAN(t, 8472, true)); pkt.Transport.DstPort != 5080 {
+		t.Errorf("port 8472: dst port %d, want inner 5080", pkt.Transport.DstPort)
+	}
+	if pkt := decodeFrame(t, d, buildVXLAN(t, 4789, true)); pkt.Transport.DstPort != 4789 {
+		t.Errorf("port 4789 not configured: dst port %d, want outer 4789", pkt.Transport.DstPort)
+	}
+}
+
+func TestDecode_VXLANInnerFragments(t *testing.T) {
+	d := NewStandardDecoder(Config{Tunnels: []string{"vxlan"}, IPReassembly: true})
+	udp := append([]byte{0x13, 0xc4, 0x13, 0xd8, 0, byte(8 + len(sipPayload)), 0, 0}, sipPayload...)
+	for i, frag := range [][]byte{
+		buildIPv4Fragment([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 17, 7, 0, true, udp[:16]),
+		buildIPv4Fragment([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 17, 7, 2, false, udp[16:]), // offset in 8-byte units
+	} {
+		outerIP := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP,
+			SrcIP: net.IP{172, 16, 0, 1}, DstIP: net.IP{172, 16, 0, 2}}
+		outerUDP := &layers.UDP{SrcPort: 49152, DstPort: 4789}
+		if err := outerUDP.SetNetworkLayerForChecksum(outerIP); err != nil {
+			t.Fatal(err)
+		}
+		frame := serialize(t, ethernet(layers.EthernetTypeIPv4), outerIP, outerUDP,
+			&layers.VXLAN{ValidIDFlag: true, VNI: 100},
+			ethernet(layers.EthernetTypeIPv4), gopacket.Payload(frag))
+
+		pkt, err := d.Decode(core.RawPacket{Data: frame, Timestamp: time.Now()})
+		if i == 0 {
+			if !errors.Is(err, core.ErrFragmentIncomplete) {
+				t.Fatalf("first fragment: err = %v, want ErrFragmentIncomplete", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("last fragment: %v", err)
+		}
+		if !pkt.Reassembled || pkt.Transport.DstPort != 5080 || !bytes.Equal(pkt.Payload, sipPayload) {
+			t.Errorf("reassembled = %v, dst port %d, payload %q", pkt.Reassembled, pkt.Transport.DstPort, pkt.Payload)
+		}
+	}
+}
+
+func TestDecode_GRE(t *testing.T) {
+	outerIP := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolGRE,
+		SrcIP: net.IP{172, 16, 0, 1}, DstIP: net.IP{172, 16, 0, 2}}
+	ip, udp := ipv4UDP(t)
+	frame := serialize(t, ethernet(layers.EthernetTypeIPv4), outerIP,
+		&layers.GRE{Protocol: layers.EthernetTypeIPv4}, ip, udp, gopacket.Payload(sipPayload))
+
+	pkt := decodeFrame(t, NewStandardDecoder(Config{Tunnels: []string{"gre"}}), frame)
+	// Unlike VXLAN, GRE keeps the outer addresses
+	if pkt.IP.SrcIP != netip.MustParseAddr("172.16.0.1") || pkt.IP.InnerSrcIP != netip.MustParseAddr("10.0.0.1") ||
+		pkt.IP.OuterSrcIP != netip.MustParseAddr("172.16.0.1") || pkt.Transport.DstPort != 5080 {
+		t.Errorf("decoded %+v %+v, want the outer addresses and inner ports", pkt.IP, pkt.Transport)
+	}
+}
+
+// gtpu builds a GTPv1-U header for payload; ext adds the optional fields
+// and a PDU session container extension header (as on N3).
+func gtpu(msgType byte, teid uint32, ext bool, payload []byte) []byte {
+	h := []byte{0x30, msgType, 0, 0, 0, 0, 0, 0}
+	if ext {
+		h[0] |= gtpuFlagExt
+		h = append(h, 0, 0, 0, 0x85)       // sequence, N-PDU, next: PDU session container
+		h = append(h, 1, 0x10, 0x09, 0x00) // 4 bytes, QFI 9, no next extension
+	}
+	binary.BigEndian.PutUint16(h[2:], uint16(len(h)-gtpuHeaderLen+len(payload)))
+	binary.BigEndian.PutUint32(h[4:], teid)
+	return append(h, payload...)
+}
+
+func buildGTPU(t testing.TB, gtp []byte) []byte {
+	outerIP := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IP{172, 16, 0, 1}, DstIP: net.IP{172, 16, 0, 2}}
+	outerUDP := &layers.UDP{SrcPort: 2152, DstPort: 2152}
+	if err := outerUDP.SetNetworkLayerForChecksum(outerIP); err != nil {
+		t.Fatal(err)
+	}
+	return serialize(t, ethernet(layers.EthernetTypeIPv4), outerIP, outerUDP, gopacket.Payload(gtp))
+}
+
+func TestDecode_GTPU(t *testing.T) {
+	ip, udp := ipv4UDP(t)
+	inner := serialize(t, ip, udp, gopacket.Payload(sipPayload))
+	d := NewStandardDecoder(Config{Tunnels: []string{"gtpu"}})
+
+	for _, ext := range []bool{false, true} {
+		pkt := decodeFrame(t, d, buildGTPU(t, gtpu(gtpuMsgGPDU, 0x1a2b3c4d, ext, inner)))
+		if pkt.TEID != 0x1a2b3c4d || pkt.IP.SrcIP != netip.MustParseAddr("10.0.0.1") ||
+			pkt.Transport.DstPort != 5080 || !bytes.Equal(pkt.Payload, sipPayload) {
+			t.Errorf("ext=%v: TEID %#x, %v → port %d, payload %q, want the inner packet",
+				ext, pkt.TEID, pkt.IP.SrcIP, pkt.Transport.DstPort, pkt.Payload)
+		}
+		if pkt.IP.OuterSrcIP != netip.MustParseAddr("172.16.0.1") {
+			t.Errorf("ext=%v: outer source = %v", ext, pkt.IP.OuterSrcIP)
+		}
+	}
+
+	// Not decapsulated: signalling, truncated, or gtpu not enabled
+	for name, tc := range map[string]struct {
+		d     *StandardDecoder
+		frame []byte
+	}{
+		"echo request": {d, buildGTPU(t, gtpu(1, 0, false, nil))},
+		"truncated":    {d, buildGTPU(t, gtpu(gtpuMsgGPDU, 1, true, inner)[:14])},
+		"disabled":     {NewStandardDecoder(Config{}), buildGTPU(t, gtpu(gtpuMsgGPDU, 1, false, inner))},
+	} {
+		pkt := decodeFrame(t, tc.d, tc.frame)
+		if pkt.TEID != 0 || pkt.IP.SrcIP != netip.MustParseAddr("172.16.0.1") || pkt.Transport.DstPort != 2152 {
+			t.Errorf("%s: TEID %#x, %v:%d, want the outer packet", name, pkt.TEID, pkt.IP.SrcIP, pkt.Transport.DstPort)
+		}
+	}
+}
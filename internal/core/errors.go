@@ -17,6 +17,14 @@ var (
 	ErrPacketTooShort   = errors.New("otus: packet too short")
 	ErrUnsupportedProto = errors.New("otus: unsupported protocol")
 
+	// Application parser errors (wrapped by parsers; bucketed in parser metrics)
+	ErrBadVersion = errors.New("otus: unsupported protocol version")
+
+	// ErrIgnored is wrapped by parsers that recognise a packet but are
+	// configured to ignore it: the pipeline drops it instead of trying the
+	// next parser or emitting it as raw.
+	ErrIgnored = errors.New("otus: ignored by parser configuration")
+
 	// IP reassembly errors
 	ErrReassemblyTimeout  = errors.New("otus: fragment reassembly timeout")
 	ErrReassemblyLimit    = errors.New("otus: fragment reassembly limit exceeded")
@@ -26,6 +34,22 @@ var (
 	ErrPluginNotFound   = errors.New("otus: plugin not found")
 	ErrPluginInitFailed = errors.New("otus: plugin init failed")
 
+	// Reporter errors (wrapped by reporters to mark failures that retrying cannot fix,
+	// e.g. serialization or authorization errors); categorized as ErrFatal
+	ErrPermanent = errors.New("otus: permanent failure")
+
+	// ErrThrottled is wrapped by reporters refusing a packet to stay under a
+	// configured rate limit. It is not a reporter failure: the packet goes to
+	// the fallback, without retries, error streaks or failover.
+	ErrThrottled = errors.New("otus: throttled by rate limit")
+
+	// Error categories, wrapped by plugins in errors of Start, Report and
+	// Handle (and Capture) so the task, its restart policy and controllers
+	// can react without matching messages; see CategoryOf.
+	ErrTransient = errors.New("otus: transient failure")     // may succeed when retried
+	ErrConfig    = errors.New("otus: configuration error")   // needs a config change
+	ErrFatal     = errors.New("otus: unrecoverable failure") // neither retry nor config helps
+
 	// Configuration errors
 	ErrConfigInvalid = errors.New("otus: invalid configuration")
 
@@ -13,6 +13,27 @@ const (
 	LabelSIPStatusCode = "sip.status_code"
 	LabelSIPVia        = "sip.via" // Comma-separated list of Via headers
 
+	// LabelSIPHeaderPrefix prefixes configured extra_headers, e.g.
+	// P-Asserted-Identity → sip.header.p_asserted_identity
+	LabelSIPHeaderPrefix = "sip.header."
+
+	LabelSIPTransport     = "sip.transport"      // "ws" when carried in WebSocket frames (RFC 7118)
+	LabelSIPParseWarnings = "sip.parse_warnings" // comma-separated parse defects of malformed messages
+
+	LabelSIPISUP            = "sip.isup"              // "true" when a SIP-I/SIP-T body carries ISUP
+	LabelSIPISUPMessageType = "sip.isup_message_type" // ISUP message type, e.g. "IAM", "ACM", "ANM"
+
+	LabelSIPCaller = "sip.caller" // E.164-normalized From user (e164 processor)
+	LabelSIPCallee = "sip.callee" // E.164-normalized To user (e164 processor)
+
+	LabelSIPRetransmission      = "sip.retransmission"       // "true" when the same transaction message was already seen
+	LabelSIPRetransmissionCount = "sip.retransmission_count" // Retransmission ordinal (1 = first retransmission)
+
+	LabelSIPFromTag     = "sip.from_tag"
+	LabelSIPToTag       = "sip.to_tag"
+	LabelSIPDialogState = "sip.dialog_state" // "early", "confirmed" or "terminated"
+	LabelSIPSDP         = "sip.sdp"          // SDP body role: "offer" or "answer"
+
 	// RTP / RTCP label constants
 	LabelRTPVersion     = "rtp.version"
 	LabelRTPPayloadType = "rtp.payload_type" // RTP payload type number (0-127)
@@ -23,11 +44,139 @@ const (
 	LabelRTPCodec       = "rtp.codec"        // Codec name from SDP (e.g. "PCMU")
 	LabelRTPMarker      = "rtp.marker"       // Marker bit ("true"/"false")
 	LabelRTPExtension   = "rtp.has_ext"      // Header extension present ("true"/"false")
+	LabelRTPMediaState  = "rtp.media_state"  // "early" (180/183 SDP) or "confirmed" (200 OK)
+	LabelRTPPayloadLen  = "rtp.payload_len"  // Media payload bytes stripped by payload_sample_packets (decimal)
+	LabelRTPDirection   = "rtp.direction"    // "forward" (SDP offerer → answerer) or "reverse", on flows registered by the SIP parser
+
+	// RTP stream events, on flows registered by the SIP parser only
+	LabelRTPStreamEvent     = "rtp.stream_event"      // "ssrc_change", "ssrc_conflict", "pt_change"; comma-separated
+	LabelRTPPrevSSRC        = "rtp.prev_ssrc"         // SSRC before an ssrc_change (hex)
+	LabelRTPPrevPayloadType = "rtp.prev_payload_type" // Payload type before a pt_change
+
+	// DTMF (RFC 4733 telephone-event), on packets of a telephone-event
+	// payload type learned from SDP or configured
+	LabelRTPDTMFDigit      = "rtp.dtmf_digit"       // "0"-"9", "*", "#", "A"-"D", "flash", else the event number
+	LabelRTPDTMFDurationMs = "rtp.dtmf_duration_ms" // Duration of the event so far (ms, decimal)
+	LabelRTPDTMFEnd        = "rtp.dtmf_end"         // "true" on the end packets of the event
+
+	// RTP stream quality at the capture point (rtp parser quality_interval),
+	// on the packet closing each interval of a stream of a registered call
+	LabelRTPLossPct  = "rtp.loss_pct"  // Sequence numbers missing in the interval (percent, 1 decimal)
+	LabelRTPJitterMs = "rtp.jitter_ms" // RFC 3550 interarrival jitter from capture times (ms, 1 decimal)
+	LabelRTPMOS      = "rtp.mos"       // E-model MOS estimate from loss and jitter (1-4.5, 2 decimals)
 
 	// RTCP uses rtcp.* prefix to distinguish from media RTP
 	LabelRTCPPayloadType = "rtcp.payload_type" // RTCP packet type (200-209)
 	LabelRTCPCallID      = "rtcp.call_id"      // Correlated SIP call-id
 	LabelRTCPSSRC        = "rtcp.ssrc"         // Sender/source SSRC (hex)
 	LabelRTCPCodec       = "rtcp.codec"        // Codec from SDP for this RTCP flow
+	LabelRTCPMediaState  = "rtcp.media_state"  // "early" or "confirmed"
+	LabelRTCPRTT         = "rtcp.rtt_ms"       // Round-trip time from a report block's LSR/DLSR (ms, decimal)
+	LabelRTCPReportSSRC  = "rtcp.report_ssrc"  // SSRC of the source the labeled report block is about (hex)
+	LabelRTCPDirection   = "rtcp.direction"    // "forward" or "reverse", as rtp.direction
+
+	// Reception feedback of the labeled SR/RR report block
+	LabelRTCPLossPct        = "rtcp.loss_pct"        // Fraction lost since the reporter's previous report (percent, 1 decimal)
+	LabelRTCPCumulativeLost = "rtcp.cumulative_lost" // Packets lost since the start of reception (decimal, may be negative)
+	LabelRTCPJitter         = "rtcp.jitter"          // Interarrival jitter in RTP timestamp units (decimal)
+	LabelRTCPJitterMs       = "rtcp.jitter_ms"       // rtcp.jitter at the clock rate of rtcp.codec (ms, 1 decimal)
+	LabelRTCPLSR            = "rtcp.lsr"             // Middle 32 bits of the NTP timestamp of the last SR received (hex)
+	LabelRTCPDLSRMs         = "rtcp.dlsr_ms"         // Delay since that SR (ms, 1 decimal)
+
+	// Sender info of an SR
+	LabelRTCPSenderPackets = "rtcp.sender_packets" // RTP packets sent since the sender started (decimal)
+	LabelRTCPSenderOctets  = "rtcp.sender_octets"  // RTP payload octets sent since the sender started (decimal)
+
+	// RTCP XR VoIP Metrics report block (RFC 3611 §4.7), from the packet or
+	// an XR packet later in the same compound packet. Metrics the endpoint
+	// reports as unavailable are not labeled.
+	LabelRTCPXRSSRC            = "rtcp.xr_ssrc"                // SSRC of the source the block is about (hex)
+	LabelRTCPXRLossPct         = "rtcp.xr_loss_pct"            // Packets lost in the network (percent, 1 decimal)
+	LabelRTCPXRDiscardPct      = "rtcp.xr_discard_pct"         // Packets discarded by the jitter buffer (percent, 1 decimal)
+	LabelRTCPXRBurstDensityPct = "rtcp.xr_burst_density_pct"   // Packets lost or discarded within bursts (percent, 1 decimal)
+	LabelRTCPXRGapDensityPct   = "rtcp.xr_gap_density_pct"     // Packets lost or discarded within gaps (percent, 1 decimal)
+	LabelRTCPXRBurstDurationMs = "rtcp.xr_burst_duration_ms"   // Mean burst duration (ms, decimal)
+	LabelRTCPXRGapDurationMs   = "rtcp.xr_gap_duration_ms"     // Mean gap duration (ms, decimal)
+	LabelRTCPXRRTTMs           = "rtcp.xr_rtt_ms"              // Round trip delay measured by the endpoint (ms, decimal)
+	LabelRTCPXREndSystemMs     = "rtcp.xr_end_system_delay_ms" // Endpoint's internal delay (ms, decimal)
+	LabelRTCPXRSignalDBm       = "rtcp.xr_signal_dbm"          // Voice signal level (dBm0, signed decimal)
+	LabelRTCPXRNoiseDBm        = "rtcp.xr_noise_dbm"           // Noise level during silence (dBm0, signed decimal)
+	LabelRTCPXRRFactor         = "rtcp.xr_r_factor"            // R factor (0-100, decimal)
+	LabelRTCPXRMOSLQ           = "rtcp.xr_mos_lq"              // Listening quality MOS (1.0-5.0, 1 decimal)
+	LabelRTCPXRMOSCQ           = "rtcp.xr_mos_cq"              // Conversational quality MOS (1.0-5.0, 1 decimal)
+	LabelRTCPXRJBNominalMs     = "rtcp.xr_jb_nominal_ms"       // Current nominal jitter buffer delay (ms, decimal)
+	LabelRTCPXRJBMaxMs         = "rtcp.xr_jb_max_ms"           // Current maximum jitter buffer delay (ms, decimal)
+
+	// Stream table of tasks with rtcp_correlation: the reported source's RTP
+	// as seen at the capture point, since that source's previous report
+	LabelRTCPStreamPackets      = "rtcp.stream_packets"       // RTP packets in the interval (decimal)
+	LabelRTCPStreamBytes        = "rtcp.stream_bytes"         // RTP bytes (header included) in the interval (decimal)
+	LabelRTCPStreamLost         = "rtcp.stream_lost"          // Sequence numbers missing in the interval (decimal)
+	LabelRTCPStreamPacketsTotal = "rtcp.stream_packets_total" // RTP packets since the stream was first seen (decimal)
+
+	// MSRP (RFC 4975) label constants
+	LabelMSRPTransactionID = "msrp.transaction_id" // Transaction identifier from the start line
+	LabelMSRPMethod        = "msrp.method"         // SEND, REPORT, AUTH (requests only)
+	LabelMSRPStatusCode    = "msrp.status_code"    // Response status code (responses only)
+	LabelMSRPToPath        = "msrp.to_path"        // To-Path header
+	LabelMSRPFromPath      = "msrp.from_path"      // From-Path header
+	LabelMSRPMessageID     = "msrp.message_id"     // Message-ID header
+	LabelMSRPByteRange     = "msrp.byte_range"     // Byte-Range header, e.g. "1-25/25"
+	LabelMSRPContentType   = "msrp.content_type"   // Content-Type of the chunk
+	LabelMSRPChunk         = "msrp.chunk"          // "complete" ($), "more" (+) or "aborted" (#)
+	LabelMSRPCallID        = "msrp.call_id"        // Correlated SIP call-id
+	LabelMSRPMediaState    = "msrp.media_state"    // "early" or "confirmed"
+
+	// Alert events emitted by the in-agent evaluator (PayloadType "alert")
+	LabelAlertRule     = "alert.rule"     // Rule name from otus.alerts.rules
+	LabelAlertState    = "alert.state"    // "firing" or "resolved"
+	LabelAlertSeverity = "alert.severity" // "warning" or "critical"
+
+	// Media gap events emitted by tasks with media_gap configured (PayloadType "media_gap")
+	LabelMediaGapCallID = "media_gap.call_id" // SIP call-id of the stopped stream
+	LabelMediaGapIdle   = "media_gap.idle"    // Seconds since the last RTP packet (decimal)
+	LabelMediaGapOneWay = "media_gap.one_way" // "true" if the reverse direction is still active
+
+	// Call quality alerts emitted by tasks with quality_alerts configured (PayloadType "quality_alert")
+	LabelQualityAlertCallID   = "quality_alert.call_id"  // SIP call-id of the degraded call
+	LabelQualityAlertExceeded = "quality_alert.exceeded" // Measurements past their threshold, e.g. "mos,loss"
+	LabelQualityAlertMOS      = "quality_alert.mos"      // Estimated MOS (2 decimals)
+
+	// TCP segment analysis of tasks with tcp_analysis enabled
+	LabelTCPFlags          = "tcp.flags"          // e.g. "SYN,ACK", "PSH,ACK"
+	LabelTCPRetransmission = "tcp.retransmission" // "true" when the segment's data was already seen
+	LabelTCPOutOfOrder     = "tcp.out_of_order"   // "true" when the segment fills an earlier gap
+	LabelTCPRTT            = "tcp.rtt_ms"         // On SYN-ACK: milliseconds since the SYN (1 decimal)
+
+	// Decrypted TLS application data of tasks with tls_decryption keys
+	LabelTLSVersion     = "tls.version"      // "1.2" or "1.3"
+	LabelTLSCipherSuite = "tls.cipher_suite" // IANA name, e.g. "TLS_AES_128_GCM_SHA256"
+
+	// Summaries emitted by the rollup processor (PayloadType "rollup")
+	LabelRollupWindow  = "rollup.window"  // Window length, e.g. "1m0s"
+	LabelRollupPackets = "rollup.packets" // Packets aggregated in the window (decimal)
+	LabelRollupBytes   = "rollup.bytes"   // Application payload bytes aggregated (decimal)
+
+	// Summaries emitted by the callsample processor (PayloadType "call_sample")
+	LabelCallSampleWindow         = "call_sample.window"          // Window length, e.g. "1m0s"
+	LabelCallSampleRate           = "call_sample.rate"            // Configured fraction of calls kept, e.g. "0.1"
+	LabelCallSampleSampledCalls   = "call_sample.sampled_calls"   // Selected calls seen in the window (decimal)
+	LabelCallSampleDroppedCalls   = "call_sample.dropped_calls"   // Calls not selected seen in the window (decimal)
+	LabelCallSampleDroppedPackets = "call_sample.dropped_packets" // Packets of calls not selected (decimal)
+
+	// Decapsulated GTP-U user plane traffic (decoder.tunnels "gtpu")
+	LabelGTPTEID = "gtp.teid" // Tunnel endpoint ID (hex, 0xXXXXXXXX)
+
+	// SCTP DATA chunks whose user data is the payload
+	LabelSCTPStreamID = "sctp.stream_id" // Stream identifier of each chunk, comma-separated, e.g. "0" or "0,3"
+	LabelSCTPPPID     = "sctp.ppid"      // Payload protocol identifier of the first chunk (decimal)
+
+	// Retention hint stamped by the retention processor, e.g. "30d"
+	LabelRetentionClass = "retention.class"
+
+	// Build of the exporting agent, stamped by tasks with agent_metadata set
+	LabelAgentVersion    = "agent.version"     // e.g. "1.4.2"
+	LabelAgentCommit     = "agent.commit"      // short git commit
+	LabelAgentConfigHash = "agent.config_hash" // digest of the task configuration (hex)
 	// More labels will be added as protocols are implemented
 )
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// MetaFields selects the decoded-layer details copied into
+// OutputPacket.Meta. It is configured per task (decoder.metadata).
+type MetaFields uint8
+
+const (
+	MetaTTL         MetaFields = 1 << iota // IPv4 TTL / IPv6 hop limit
+	MetaTCPFlags                           // TCP flags, sequence and acknowledgment numbers
+	MetaVLAN                               // VLAN IDs, outer first
+	MetaMAC                                // source and destination MAC
+	MetaIPLen                              // IP total length
+	MetaTunnel                             // inner and outer addresses after tunnel decapsulation
+	MetaReassembled                        // whether the packet was reassembled from fragments
+	MetaMPLS                               // MPLS labels, outer first
+)
+
+// metaFieldNames are the decoder.metadata names of the fields.
+var metaFieldNames = map[string]MetaFields{
+	"ttl":         MetaTTL,
+	"tcp_flags":   MetaTCPFlags,
+	"vlan":        MetaVLAN,
+	"mac":         MetaMAC,
+	"ip_len":      MetaIPLen,
+	"tunnel":      MetaTunnel,
+	"reassembled": MetaReassembled,
+	"mpls":        MetaMPLS,
+}
+
+// ParseMetaFields parses decoder.metadata names.
+func ParseMetaFields(names []string) (MetaFields, error) {
+	var f MetaFields
+	for _, name := range names {
+		bit, ok := metaFieldNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown metadata field %q", name)
+		}
+		f |= bit
+	}
+	return f, nil
+}
+
+// DecodeMeta carries decoded-layer details beyond the network context of an
+// OutputPacket, for processors. Only the fields selected by the task are set.
+type DecodeMeta struct {
+	TTL         uint8      `json:"ttl,omitempty"`
+	TCPFlags    uint8      `json:"tcp_flags,omitempty"`
+	SeqNum      uint32     `json:"seq,omitempty"`
+	AckNum      uint32     `json:"ack,omitempty"`
+	VLANs       []uint16   `json:"vlans,omitempty"`
+	SrcMAC      [6]byte    `json:"-"`
+	DstMAC      [6]byte    `json:"-"`
+	IPTotalLen  uint16     `json:"ip_len,omitempty"`
+	InnerSrcIP  netip.Addr `json:"inner_src_ip,omitzero"`
+	InnerDstIP  netip.Addr `json:"inner_dst_ip,omitzero"`
+	OuterSrcIP  netip.Addr `json:"outer_src_ip,omitzero"`
+	OuterDstIP  netip.Addr `json:"outer_dst_ip,omitzero"`
+	Reassembled bool       `json:"reassembled,omitempty"`
+	MPLSLabels  []uint32   `json:"mpls_labels,omitempty"`
+}
+
+// Extract copies the selected fields of a decoded packet. It returns nil
+// when no field is selected, so tasks without metadata allocate nothing.
+func (f MetaFields) Extract(d *DecodedPacket) *DecodeMeta {
+	if f == 0 {
+		return nil
+	}
+	m := &DecodeMeta{}
+	if f&MetaTTL != 0 {
+		m.TTL = d.IP.TTL
+	}
+	if f&MetaTCPFlags != 0 && d.Transport.Protocol == 6 {
+		m.TCPFlags = d.Transport.TCPFlags
+		m.SeqNum = d.Transport.SeqNum
+		m.AckNum = d.Transport.AckNum
+	}
+	if f&MetaVLAN != 0 {
+		m.VLANs = d.Ethernet.VLANs
+	}
+	if f&MetaMAC != 0 {
+		m.SrcMAC = d.Ethernet.SrcMAC
+		m.DstMAC = d.Ethernet.DstMAC
+	}
+	if f&MetaIPLen != 0 {
+		m.IPTotalLen = d.IP.TotalLen
+	}
+	if f&MetaTunnel != 0 {
+		m.InnerSrcIP = d.IP.InnerSrcIP
+		m.InnerDstIP = d.IP.InnerDstIP
+		m.OuterSrcIP = d.IP.OuterSrcIP
+		m.OuterDstIP = d.IP.OuterDstIP
+	}
+	if f&MetaReassembled != 0 {
+		m.Reassembled = d.Reassembled
+	}
+	if f&MetaMPLS != 0 {
+		m.MPLSLabels = d.Ethernet.MPLSLabels
+	}
+	return m
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseMetaFields(t *testing.T) {
+	f, err := ParseMetaFields([]string{"ttl", "tcp_flags", "vlan"})
+	if err != nil || f != MetaTTL|MetaTCPFlags|MetaVLAN {
+		t.Errorf("ParseMetaFields = %b, %v", f, err)
+	}
+	if f, err := ParseMetaFields(nil); err != nil || f != 0 {
+		t.Errorf("ParseMetaFields(nil) = %b, %v", f, err)
+	}
+	if _, err := ParseMetaFields([]string{"ttl", "dscp"}); err == nil {
+		t.Error("ParseMetaFields accepted an unknown field")
+	}
+}
+
+func TestMetaFields_Extract(t *testing.T) {
+	d := &DecodedPacket{
+		Ethernet:  EthernetHeader{SrcMAC: [6]byte{0xAA}, VLANs: []uint16{100, 200}},
+		IP:        IPHeader{TTL: 63, TotalLen: 1500, InnerSrcIP: netip.MustParseAddr("10.1.1.1")},
+		Transport: TransportHeader{Protocol: 6, TCPFlags: 0x12, SeqNum: 7, AckNum: 9},
+	}
+
+	if m := MetaFields(0).Extract(d); m != nil {
+		t.Errorf("Extract with no fields = %+v, want nil", m)
+	}
+
+	m := (MetaTTL | MetaTCPFlags | MetaVLAN).Extract(d)
+	if m.TTL != 63 || m.TCPFlags != 0x12 || m.SeqNum != 7 || m.AckNum != 9 || len(m.VLANs) != 2 || m.VLANs[1] != 200 {
+		t.Errorf("Extract = %+v", m)
+	}
+	// Unselected fields stay zero.
+	if m.SrcMAC != ([6]byte{}) || m.IPTotalLen != 0 || m.InnerSrcIP.IsValid() {
+		t.Errorf("Extract set unselected fields: %+v", m)
+	}
+
+	// TCP fields are only taken from TCP packets.
+	d.Transport = TransportHeader{Protocol: 17}
+	if m := MetaTCPFlags.Extract(d); m.TCPFlags != 0 || m.SeqNum != 0 {
+		t.Errorf("Extract on UDP = %+v", m)
+	}
+}
@@ -24,7 +24,15 @@ type DecodedPacket struct {
 	Payload     []byte // Application layer payload, zero-copy slice
 	CaptureLen  uint32
 	OrigLen     uint32
-	Reassembled bool // Whether packet went through IP fragment reassembly
+	Reassembled bool     // Whether packet went through IP fragment reassembly
+	TEID        uint32   // GTP-U tunnel endpoint ID after decapsulation; 0 if not GTP-U
+	SCTP        SCTPData // DATA chunks of an SCTP packet; zero if not SCTP
+}
+
+// SCTPData describes the SCTP DATA chunks whose user data is the payload.
+type SCTPData struct {
+	Streams []uint16 // stream identifier of each chunk, in packet order
+	PPID    uint32   // payload protocol identifier of the first chunk
 }
 
 // OutputPacket is the final output sent to reporters.
@@ -42,6 +50,9 @@ type OutputPacket struct {
 	DstPort  uint16
 	Protocol uint8
 
+	// Decoded-layer details selected by the task's decoder.metadata; nil if none
+	Meta *DecodeMeta
+
 	// Labels — Parser / Processor annotations
 	Labels Labels
 
@@ -50,3 +61,47 @@ type OutputPacket struct {
 	Payload     any    // Concrete type determined by PayloadType, Reporter does type assertion
 	RawPayload  []byte // Raw payload (optional preservation)
 }
+
+// callIDLabels are the labels read for the call of a packet, first match wins.
+var callIDLabels = []string{
+	LabelSIPCallID,
+	LabelRTPCallID,
+	LabelRTCPCallID,
+	LabelMSRPCallID,
+}
+
+// CallID returns the call a packet belongs to, "" if none.
+func (p *OutputPacket) CallID() string {
+	for _, label := range callIDLabels {
+		if id := p.Labels[label]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// Pseudo keys that Value reads from the packet envelope instead of its labels.
+const (
+	KeySrcIP       = "src_ip"
+	KeyDstIP       = "dst_ip"
+	KeyPayloadType = "payload_type"
+)
+
+// Value returns the value of a label or pseudo key, "" when absent.
+func (p *OutputPacket) Value(key string) string {
+	switch key {
+	case KeySrcIP:
+		if p.SrcIP.IsValid() {
+			return p.SrcIP.String()
+		}
+		return ""
+	case KeyDstIP:
+		if p.DstIP.IsValid() {
+			return p.DstIP.String()
+		}
+		return ""
+	case KeyPayloadType:
+		return p.PayloadType
+	}
+	return p.Labels[key]
+}
@@ -5,10 +5,11 @@ import "net/netip"
 
 // EthernetHeader represents L2 Ethernet frame header.
 type EthernetHeader struct {
-	SrcMAC    [6]byte
-	DstMAC    [6]byte
-	EtherType uint16   // 0x0800=IPv4, 0x86DD=IPv6, 0x8100=VLAN
-	VLANs     []uint16 // 0~2 VLAN IDs (QinQ scenarios have 2)
+	SrcMAC     [6]byte
+	DstMAC     [6]byte
+	EtherType  uint16   // 0x0800=IPv4, 0x86DD=IPv6, 0x8100=VLAN; after tags and labels
+	VLANs      []uint16 // VLAN IDs, outer first (QinQ scenarios have 2)
+	MPLSLabels []uint32 // MPLS label stack, outer first; nil without MPLS
 }
 
 // IPHeader represents L3 IP header (IPv4/IPv6).
@@ -19,12 +20,17 @@ type IPHeader struct {
 	Protocol uint8 // TCP=6, UDP=17, SCTP=132
 	TTL      uint8
 	TotalLen uint16
-	// Inner IP addresses after tunnel decapsulation (zero value if not tunneled)
+	// After tunnel decapsulation the header above is the inner one; these
+	// hold the inner and the outer (tunnel endpoint) addresses. Zero value if
+	// not tunneled.
 	InnerSrcIP netip.Addr
 	InnerDstIP netip.Addr
+	OuterSrcIP netip.Addr
+	OuterDstIP netip.Addr
 }
 
-// TransportHeader represents L4 transport layer header (TCP/UDP).
+// TransportHeader represents L4 transport layer header (TCP/UDP/SCTP).
+// SCTP chunk details are in DecodedPacket.SCTP.
 type TransportHeader struct {
 	SrcPort  uint16
 	DstPort  uint16
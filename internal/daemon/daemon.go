@@ -8,20 +8,32 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"firestige.xyz/otus/internal/alert"
+	"firestige.xyz/otus/internal/audit"
+	"firestige.xyz/otus/internal/buildinfo"
 	"firestige.xyz/otus/internal/command"
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
 	logpkg "firestige.xyz/otus/internal/log"
 	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/objstore"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/internal/seal"
 	"firestige.xyz/otus/internal/task"
+	"firestige.xyz/otus/internal/tlspolicy"
 )
 
 // Daemon manages the otus daemon process lifecycle.
 type Daemon struct {
 	// Configuration
+	mu         sync.RWMutex // guards config, which Reload replaces
 	config     *config.GlobalConfig
 	configPath string
 	socketPath string
@@ -33,11 +45,15 @@ type Daemon struct {
 	udsServer     *command.UDSServer
 	kafkaConsumer *command.KafkaCommandConsumer // nil if command channel disabled
 	metricsServer *metrics.Server               // nil if metrics disabled
+	alerts        *alert.Evaluator              // nil if alerts disabled
+	audit         *audit.Auditor                // nil if the self-audit is disabled
+	tlsPolicy     *tlspolicy.Policy             // agent-wide policy for outbound TLS
 
 	// Lifecycle management
 	ctx          context.Context
 	cancel       context.CancelFunc
 	shutdownChan chan struct{}
+	shutdownOnce sync.Once
 	sigChan      chan os.Signal // promoted from Run() local for cleanup in Stop()
 }
 
@@ -67,7 +83,8 @@ func New(configPath, socketPath, pidFile string) (*Daemon, error) {
 // Start initializes and starts all daemon components.
 func (d *Daemon) Start() error {
 	slog.Info("starting otus daemon",
-		"version", "0.1.0",
+		"version", buildinfo.Version,
+		"commit", buildinfo.Commit(),
 		"hostname", d.config.Node.Hostname,
 		"config", d.configPath,
 		"socket", d.socketPath,
@@ -88,21 +105,55 @@ func (d *Daemon) Start() error {
 		return fmt.Errorf("failed to start metrics server: %w", err)
 	}
 
+	// Load the TLS policy before anything dials out; a bad CA bundle or
+	// certificate must fail startup rather than weaken connections later.
+	policy, err := tlspolicy.New(d.config.TLS)
+	if err != nil {
+		return fmt.Errorf("failed to load tls policy: %w", err)
+	}
+	d.tlsPolicy = policy
+
 	// 4. Create task manager with optional persistence store.
 	var taskStore task.TaskStore
-	if d.config.TaskPersistence.Enabled {
+	if d.config.TaskPersistence.Enabled && d.config.TaskPersistence.Backend == "s3" {
+		// Remote state is what survives a reimage: no silent fallback to
+		// an unpersisted agent
+		store, err := newS3TaskStore(d.config.TaskPersistence.S3, d.config.Node.Hostname, policy)
+		if err != nil {
+			return fmt.Errorf("failed to initialise s3 task store: %w", err)
+		}
+		if err := initStoreEncryption(store, d.config.TaskPersistence.Encryption); err != nil {
+			return err
+		}
+		taskStore = store
+	} else if d.config.TaskPersistence.Enabled {
 		storeDir := filepath.Join(d.config.DataDir, "tasks")
 		store, storeErr := task.NewFileTaskStore(storeDir)
 		if storeErr != nil {
 			slog.Warn("failed to initialise task store, persistence disabled",
 				"dir", storeDir, "error", storeErr)
 		} else {
+			// Encryption is not downgraded on error: records with PII must
+			// never silently fall back to plaintext.
+			if err := initStoreEncryption(store, d.config.TaskPersistence.Encryption); err != nil {
+				return err
+			}
 			taskStore = store
 		}
 	}
 	d.taskManager = task.NewTaskManager(d.config.Node.Hostname, taskStore)
-
-	// Restore previously active tasks from the persistent store.
+	d.taskManager.SetParentContext(d.ctx)
+	d.taskManager.SetMaxTasks(d.config.MaxTasks)
+	d.taskManager.SetMaxRestarts(d.config.TaskPersistence.MaxRestarts)
+	d.taskManager.SetTLSPolicy(d.tlsPolicy)
+
+	// Create the tasks declared in the config, then restore previously
+	// active tasks from the persistent store; declared tasks win.
+	autostart, err := d.config.AutostartTasks()
+	if err != nil {
+		return fmt.Errorf("invalid autostart: %w", err)
+	}
+	d.taskManager.Autostart(autostart)
 	if d.config.TaskPersistence.Enabled && taskStore != nil {
 		d.taskManager.Restore(d.config.TaskPersistence.AutoRestart)
 	}
@@ -121,7 +172,7 @@ func (d *Daemon) Start() error {
 			for {
 				select {
 				case <-ticker.C:
-					d.taskManager.GCOldTasks(d.config.TaskPersistence.MaxTaskHistory)
+					d.taskManager.GCOldTasks(d.Config().TaskPersistence.MaxTaskHistory)
 				case <-d.ctx.Done():
 					return
 				}
@@ -131,13 +182,25 @@ func (d *Daemon) Start() error {
 
 	// 5. Create command handler
 	d.cmdHandler = command.NewCommandHandler(d.taskManager, d)
+	d.cmdHandler.SetTaskTemplates(d.config.TaskTemplates)
+	d.cmdHandler.SetConfigSource(d)
 
 	// 6. Wire shutdown handler so daemon_shutdown command can trigger graceful stop
 	d.cmdHandler.SetShutdownFunc(func() {
 		slog.Info("shutdown triggered via daemon_shutdown command")
-		close(d.shutdownChan)
+		d.TriggerShutdown()
 	})
 
+	// 6b. Start in-agent alert evaluator (if enabled)
+	if d.config.Alerts.Enabled {
+		d.startAlerts()
+	}
+
+	// 6c. Start the periodic self-audit (if enabled)
+	if d.config.Audit.Enabled {
+		d.startAudit()
+	}
+
 	// 7. Start UDS server for CLI control
 	d.udsServer = command.NewUDSServer(d.socketPath, d.cmdHandler)
 	go func() {
@@ -171,10 +234,20 @@ func (d *Daemon) Stop() {
 		d.kafkaConsumer = nil // prevent double-stop on repeated calls
 	}
 
-	// 2. Stop all running tasks
+	// 2. Stop all running tasks in parallel, each bounded by its own deadline
 	slog.Info("stopping all tasks")
-	if err := d.taskManager.StopAll(); err != nil {
-		slog.Error("error stopping tasks", "error", err)
+	failed := 0
+	for _, r := range d.taskManager.StopAll() {
+		if r.Error != "" {
+			failed++
+			slog.Error("task stop result",
+				"task_id", r.TaskID, "state", r.State, "duration", r.Duration, "error", r.Error)
+			continue
+		}
+		slog.Info("task stop result", "task_id", r.TaskID, "state", r.State, "duration", r.Duration)
+	}
+	if failed > 0 {
+		slog.Error("some tasks did not stop cleanly", "failed", failed)
 	}
 
 	// 3. Stop UDS server (no new CLI commands)
@@ -260,6 +333,10 @@ func (d *Daemon) Run() error {
 // Cold (requires restart): node.hostname, task definitions, listen addresses.
 // Implements ConfigReloader interface for CommandHandler.
 func (d *Daemon) Reload() error {
+	// Held throughout, so SIGHUP and config_reload do not interleave.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
 	slog.Info("reloading configuration", "path", d.configPath)
 
 	newConfig, err := config.Load(d.configPath)
@@ -271,13 +348,12 @@ func (d *Daemon) Reload() error {
 	hotReloaded := []string{}
 
 	// 1. Re-initialize logging with new config (log level + format)
-	oldLevel := d.config.Log.Level
-	oldFormat := d.config.Log.Format
+	oldConfig := d.config
 	d.config = newConfig
 	if err := d.initLogging(); err != nil {
 		slog.Error("failed to reinitialize logging", "error", err)
 		// Non-fatal: old logging continues
-	} else if newConfig.Log.Level != oldLevel || newConfig.Log.Format != oldFormat {
+	} else if newConfig.Log.Level != oldConfig.Log.Level || newConfig.Log.Format != oldConfig.Log.Format {
 		hotReloaded = append(hotReloaded, "log")
 	}
 
@@ -293,12 +369,24 @@ func (d *Daemon) Reload() error {
 		}
 	}
 
+	// 2a. Scrape filter applies to the next scrape
+	if d.metricsServer != nil {
+		d.metricsServer.SetFilter(metricsFilter(newConfig.Metrics.Filter))
+		hotReloaded = append(hotReloaded, "metrics_filter")
+	}
+
+	// 2b. Task templates apply to the next task_create
+	if d.cmdHandler != nil {
+		d.cmdHandler.SetTaskTemplates(newConfig.TaskTemplates)
+		hotReloaded = append(hotReloaded, "task_templates")
+	}
+
 	// 3. Warn about cold-reload items that changed
 	requiresRestart := []string{}
-	if newConfig.Node.Hostname != d.config.Node.Hostname {
+	if newConfig.Node.Hostname != oldConfig.Node.Hostname {
 		requiresRestart = append(requiresRestart, "node.hostname")
 	}
-	if newConfig.Metrics.Listen != d.config.Metrics.Listen {
+	if newConfig.Metrics.Listen != oldConfig.Metrics.Listen {
 		requiresRestart = append(requiresRestart, "metrics.listen")
 	}
 
@@ -310,14 +398,18 @@ func (d *Daemon) Reload() error {
 	return nil
 }
 
-// TriggerShutdown triggers graceful shutdown from external caller (e.g., daemon_shutdown command).
+// Config returns the running global configuration.
+// Implements ConfigSource interface for CommandHandler.
+func (d *Daemon) Config() *config.GlobalConfig {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.config
+}
+
+// TriggerShutdown triggers graceful shutdown from external caller (e.g.,
+// daemon_shutdown command, Windows service stop). Safe to call repeatedly.
 func (d *Daemon) TriggerShutdown() {
-	select {
-	case d.shutdownChan <- struct{}{}:
-		// Shutdown signal sent
-	default:
-		// Channel already has a value or is closed, no-op
-	}
+	d.shutdownOnce.Do(func() { close(d.shutdownChan) })
 }
 
 // initLogging initializes the logging system from config.
@@ -337,12 +429,100 @@ func (d *Daemon) initLogging() error {
 	return nil
 }
 
+// sealableStore is a task store that can encrypt its records.
+type sealableStore interface {
+	SetKeyring(k *seal.Keyring)
+	Rotate() (int, error)
+}
+
+// newS3TaskStore creates the task store of an agent in S3-compatible object
+// storage. Empty credentials are taken from the AWS_* environment variables.
+// An https endpoint is reached under the agent-wide TLS policy.
+func newS3TaskStore(cfg config.S3StoreConfig, agentID string, policy *tlspolicy.Policy) (*task.S3TaskStore, error) {
+	timeout, _ := time.ParseDuration(cfg.Timeout) // validated; "" → default
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	tlsConfig, err := policy.Client(config.TLSConfig{Enabled: strings.HasPrefix(endpoint, "https://")})
+	if err != nil {
+		return nil, err
+	}
+	keyID, secret, token := cfg.AccessKeyID, cfg.SecretAccessKey, ""
+	if keyID == "" && secret == "" {
+		keyID, secret, token = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")
+	}
+	client, err := objstore.New(objstore.Config{
+		Endpoint:        endpoint,
+		Region:          cfg.Region,
+		Bucket:          cfg.Bucket,
+		AccessKeyID:     keyID,
+		SecretAccessKey: secret,
+		SessionToken:    token,
+		PathStyle:       cfg.PathStyle,
+		Timeout:         timeout,
+		TLS:             tlsConfig,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("task store: s3", "endpoint", endpoint, "bucket", cfg.Bucket, "prefix", cfg.Prefix, "agent", agentID)
+	return task.NewS3TaskStore(client, cfg.Prefix, agentID), nil
+}
+
+// initStoreEncryption enables at-rest encryption of task records and rewrites
+// records not yet sealed with the active key (plaintext, or an older key after
+// a rotation).
+func initStoreEncryption(store sealableStore, cfg config.StoreEncryptionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	keyring, err := seal.LoadKeyring(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load task store encryption keys: %w", err)
+	}
+	store.SetKeyring(keyring)
+
+	rewritten, err := store.Rotate()
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt task store: %w", err)
+	}
+	slog.Info("task store encryption enabled",
+		"key_id", keyring.ActiveKeyID(), "keys", len(cfg.Keys), "rewritten", rewritten)
+	return nil
+}
+
+// newDedupeStore returns the request_id deduplication store of the Kafka
+// command consumer, nil when disabled. Responses are persisted under
+// data_dir so replays across restarts are detected; if the directory is
+// unusable the store falls back to memory.
+func (d *Daemon) newDedupeStore() *command.DedupeStore {
+	ttl, err := time.ParseDuration(d.config.CommandChannel.DedupeTTL)
+	if err != nil || ttl <= 0 {
+		return nil
+	}
+
+	path := filepath.Join(d.config.DataDir, "commands", "dedupe.json")
+	store, err := command.NewDedupeStore(path, ttl)
+	if err != nil {
+		slog.Warn("failed to initialise persistent dedupe store, using memory only",
+			"file", path, "error", err)
+		if store, err = command.NewDedupeStore("", ttl); err != nil {
+			slog.Error("failed to initialise dedupe store", "error", err)
+			return nil
+		}
+	}
+	slog.Info("command dedupe enabled", "ttl", ttl, "entries", store.Len())
+	return store
+}
+
 // startKafkaConsumer starts the Kafka command consumer in background.
 func (d *Daemon) startKafkaConsumer() error {
 	consumer, err := command.NewKafkaCommandConsumer(
 		d.config.CommandChannel,
 		d.config.Node.Hostname,
 		d.cmdHandler,
+		d.tlsPolicy,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create kafka consumer: %w", err)
@@ -350,6 +530,16 @@ func (d *Daemon) startKafkaConsumer() error {
 
 	d.kafkaConsumer = consumer
 
+	// Replay protection for at-least-once delivery (consumer group rebalances)
+	if store := d.newDedupeStore(); store != nil {
+		consumer.SetDedupeStore(store)
+	}
+
+	// Call quality alerts go to the controller for closed-loop actions
+	d.taskManager.SetQualityAlertSink(func(a qualityalert.Alert) {
+		consumer.PublishEvent(qualityalert.PayloadType, a)
+	})
+
 	// Start consumer in background goroutine
 	go func() {
 		if err := consumer.Start(d.ctx); err != nil && err != context.Canceled {
@@ -360,6 +550,168 @@ func (d *Daemon) startKafkaConsumer() error {
 	return nil
 }
 
+// startAlerts starts the alert evaluator and exposes it via daemon_status.
+func (d *Daemon) startAlerts() {
+	interval, err := time.ParseDuration(d.config.Alerts.Interval)
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	d.alerts = alert.NewEvaluator(d.config.Alerts.Rules)
+	d.cmdHandler.SetAlertSource(d.alerts)
+	go d.alerts.Run(d.ctx, interval, d.alertSamples, d.emitAlert)
+}
+
+// alertSamples snapshots the counters of every active task for the alert evaluator.
+func (d *Daemon) alertSamples() []alert.Sample {
+	ids := d.taskManager.List()
+	samples := make([]alert.Sample, 0, len(ids))
+	for _, id := range ids {
+		t, err := d.taskManager.Get(id)
+		if err != nil {
+			continue // deleted concurrently
+		}
+		stats := t.CaptureStats()
+		reporter, streak := t.ReporterErrorStreak()
+		samples = append(samples, alert.Sample{
+			TaskID:              id,
+			PacketsReceived:     stats.PacketsReceived,
+			PacketsDropped:      stats.PacketsDropped,
+			Reporter:            reporter,
+			ReporterErrorStreak: streak,
+		})
+	}
+	return samples
+}
+
+// emitAlert logs an alert event, updates the firing gauge and forwards the
+// event to the task's reporters as an "alert" payload.
+func (d *Daemon) emitAlert(ev alert.Event) {
+	if ev.State == alert.StateFiring {
+		slog.Warn("alert firing", "rule", ev.Rule, "task_id", ev.TaskID,
+			"severity", ev.Severity, "value", ev.Value, "message", ev.Message)
+		metrics.AlertsFiring.WithLabelValues(ev.TaskID, ev.Rule, ev.Severity).Set(1)
+	} else {
+		slog.Info("alert resolved", "rule", ev.Rule, "task_id", ev.TaskID, "message", ev.Message)
+		metrics.AlertsFiring.WithLabelValues(ev.TaskID, ev.Rule, ev.Severity).Set(0)
+	}
+
+	t, err := d.taskManager.Get(ev.TaskID)
+	if err != nil {
+		return
+	}
+	pkt := core.OutputPacket{
+		TaskID:      ev.TaskID,
+		AgentID:     d.Config().Node.Hostname,
+		Timestamp:   ev.Timestamp,
+		PayloadType: "alert",
+		Payload:     ev,
+		Labels: core.Labels{
+			core.LabelAlertRule:     ev.Rule,
+			core.LabelAlertState:    string(ev.State),
+			core.LabelAlertSeverity: ev.Severity,
+		},
+	}
+	if !t.Emit(pkt) {
+		slog.Debug("alert event not delivered to reporters", "task_id", ev.TaskID, "rule", ev.Rule)
+	}
+}
+
+// startAudit starts the periodic self-audit and exposes its degraded
+// components via daemon_status.
+func (d *Daemon) startAudit() {
+	interval, err := time.ParseDuration(d.config.Audit.Interval)
+	if err != nil || interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	timeout, err := time.ParseDuration(d.config.Audit.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	certExpiry, err := time.ParseDuration(d.config.Audit.CertExpiry)
+	if err != nil || certExpiry <= 0 {
+		certExpiry = 7 * 24 * time.Hour
+	}
+
+	// Agent-wide certificates are read now: Reload replaces d.config
+	// without synchronisation
+	var certs []string
+	for _, path := range []string{
+		d.config.TLS.CACert, d.config.TLS.ClientCert,
+		d.config.Kafka.TLS.CACert, d.config.Kafka.TLS.ClientCert,
+		d.config.CommandChannel.Kafka.TLS.CACert, d.config.CommandChannel.Kafka.TLS.ClientCert,
+		d.config.Reporters.Kafka.TLS.CACert, d.config.Reporters.Kafka.TLS.ClientCert,
+	} {
+		if path != "" && !slices.Contains(certs, path) {
+			certs = append(certs, path)
+		}
+	}
+
+	d.audit = audit.New(timeout)
+	d.cmdHandler.SetAuditSource(d.audit)
+	checks := func() []audit.Check {
+		return d.auditChecks(certs, certExpiry)
+	}
+	go d.audit.Run(d.ctx, interval, checks, emitAudit)
+}
+
+// auditChecks returns the self-audit checks: the agent-wide certificates,
+// then for each task the plugins implementing plugin.HealthChecker and the
+// certificates named in its reporters' tls settings.
+func (d *Daemon) auditChecks(certs []string, certExpiry time.Duration) []audit.Check {
+	var checks []audit.Check
+	certCheck := func(taskID, path string) audit.Check {
+		return audit.Check{
+			Kind:   audit.KindCertificate,
+			Name:   path,
+			TaskID: taskID,
+			Run: func(context.Context) error {
+				return audit.CheckCertificate(path, certExpiry, time.Now())
+			},
+		}
+	}
+	for _, path := range certs {
+		checks = append(checks, certCheck("", path))
+	}
+
+	for _, id := range d.taskManager.List() {
+		t, err := d.taskManager.Get(id)
+		if err != nil {
+			continue // deleted concurrently
+		}
+		for _, p := range t.HealthCheckers() {
+			checks = append(checks, audit.Check{
+				Kind:   audit.KindPlugin,
+				Name:   p.Name,
+				TaskID: id,
+				Run:    p.Checker.HealthCheck,
+			})
+		}
+		for _, path := range t.ReporterCertificates() {
+			checks = append(checks, certCheck(id, path))
+		}
+	}
+	return checks
+}
+
+// emitAudit logs a component state change and updates the degraded gauge.
+// The series of a component no longer checked is deleted; the task deletes
+// the rest of its series when it stops.
+func emitAudit(ch audit.Change) {
+	switch {
+	case ch.Degraded:
+		slog.Warn("self-audit: component degraded", "kind", ch.Kind, "component", ch.Name,
+			"task_id", ch.TaskID, "reason", ch.Reason)
+		metrics.AuditDegraded.WithLabelValues(ch.TaskID, ch.Kind, ch.Name).Set(1)
+	case ch.Removed:
+		slog.Info("self-audit: component removed", "kind", ch.Kind, "component", ch.Name, "task_id", ch.TaskID)
+		metrics.AuditDegraded.DeleteLabelValues(ch.TaskID, ch.Kind, ch.Name)
+	default:
+		slog.Info("self-audit: component recovered", "kind", ch.Kind, "component", ch.Name, "task_id", ch.TaskID)
+		metrics.AuditDegraded.WithLabelValues(ch.TaskID, ch.Kind, ch.Name).Set(0)
+	}
+}
+
 // startMetrics starts the metrics HTTP server if enabled.
 func (d *Daemon) startMetrics() error {
 	if !d.config.Metrics.Enabled {
@@ -368,6 +720,7 @@ func (d *Daemon) startMetrics() error {
 	}
 
 	d.metricsServer = metrics.NewServer(d.config.Metrics.Listen, d.config.Metrics.Path)
+	d.metricsServer.SetFilter(metricsFilter(d.config.Metrics.Filter))
 	if err := d.metricsServer.Start(d.ctx); err != nil {
 		return fmt.Errorf("failed to start metrics server: %w", err)
 	}
@@ -380,6 +733,18 @@ func (d *Daemon) startMetrics() error {
 	return nil
 }
 
+// metricsFilter builds the scrape filter of metrics.filter; nil when empty.
+func metricsFilter(fc config.MetricsFilterConfig) *metrics.Filter {
+	if len(fc.TaskOptOut) == 0 && len(fc.LabelAllowlist) == 0 {
+		return nil
+	}
+	rules := make([]metrics.FilterRule, len(fc.TaskOptOut))
+	for i, o := range fc.TaskOptOut {
+		rules[i] = metrics.FilterRule{Tasks: o.Tasks, Metrics: o.Metrics}
+	}
+	return metrics.NewFilter(rules, fc.LabelAllowlist)
+}
+
 // writePIDFile writes the current process ID to the PID file.
 func (d *Daemon) writePIDFile() error {
 	if d.pidFile == "" {
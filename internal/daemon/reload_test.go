@@ -184,3 +184,47 @@ otus:
 		t.Fatalf("expected collect_interval 15s, got %s", d.config.Metrics.CollectInterval)
 	}
 }
+
+// TestDaemon_ReloadConcurrentConfig runs Reload against config_get readers;
+// run with -race.
+func TestDaemon_ReloadConcurrentConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yml")
+	if err := os.WriteFile(configPath, []byte(`
+otus:
+  node:
+    hostname: test-reload-race
+  metrics:
+    enabled: false
+  command_channel:
+    enabled: false
+`), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	d, err := New(configPath, filepath.Join(tmpDir, "otus.sock"), filepath.Join(tmpDir, "otus.pid"))
+	if err != nil {
+		t.Fatalf("new daemon: %v", err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer d.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			if d.Config().Node.Hostname != "test-reload-race" {
+				t.Error("Config() returned another hostname")
+				return
+			}
+		}
+	}()
+	for range 5 {
+		if err := d.Reload(); err != nil {
+			t.Fatalf("reload: %v", err)
+		}
+	}
+	<-done
+}
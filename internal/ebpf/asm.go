@@ -0,0 +1,279 @@
+// Package ebpf assembles and loads the small eBPF programs Otus attaches
+// itself, without a compiler toolchain or an eBPF library: the XDP redirect
+// program of the afxdp capturer and the capture prefilters, which are built
+// as classic BPF and translated (Classic).
+//
+// Programs are slices of Insn; jumps name a Label instead of an offset and
+// Assemble resolves them. Encoding assumes a little-endian host.
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Registers.
+const (
+	R0 uint8 = iota // return value, helper result
+	R1              // first argument, context on entry
+	R2
+	R3
+	R4
+	R5
+	R6 // callee-saved
+	R7
+	R8
+	R9
+	R10 // read-only frame pointer
+)
+
+// Instruction classes, sizes, modes and operations (linux/bpf.h).
+const (
+	classLD    = 0x00
+	classLDX   = 0x01
+	classST    = 0x02
+	classSTX   = 0x03
+	classALU   = 0x04
+	classJMP   = 0x05
+	classJMP32 = 0x06
+	classALU64 = 0x07
+
+	SizeW  = 0x00 // 4 bytes
+	SizeH  = 0x08 // 2 bytes
+	SizeB  = 0x10 // 1 byte
+	SizeDW = 0x18 // 8 bytes
+
+	modeIMM    = 0x00
+	modeABS    = 0x20
+	modeIND    = 0x40
+	modeMEM    = 0x60
+	modeATOMIC = 0xc0
+
+	srcK = 0x00
+	srcX = 0x08
+
+	opAtomicAdd = 0x00
+	opMov       = 0xb0
+	opEnd       = 0xd0
+	toBE        = 0x08
+	opJA        = 0x00
+	opCall      = 0x80
+	opExit      = 0x90
+
+	pseudoMapFD = 1 // BPF_PSEUDO_MAP_FD: ld_imm64 imm is a map fd
+)
+
+// ALU operations.
+const (
+	ALUAdd = 0x00
+	ALUSub = 0x10
+	ALUMul = 0x20
+	ALUDiv = 0x30
+	ALUOr  = 0x40
+	ALUAnd = 0x50
+	ALULsh = 0x60
+	ALURsh = 0x70
+	ALUNeg = 0x80
+	ALUMod = 0x90
+	ALUXor = 0xa0
+)
+
+// Jump conditions.
+const (
+	JEq  = 0x10
+	JGt  = 0x20
+	JGe  = 0x30
+	JSet = 0x40
+	JNe  = 0x50
+	JLt  = 0xa0
+	JLe  = 0xb0
+)
+
+// Helper functions.
+const (
+	FuncMapLookupElem = 1
+	FuncGetPrandomU32 = 7
+	FuncRedirectMap   = 51
+)
+
+// Insn is one eBPF instruction (struct bpf_insn). Target names the Label a
+// jump goes to; Assemble sets Off from it. An Insn made by Label marks a
+// position and is not emitted.
+type Insn struct {
+	Code     uint8
+	Dst, Src uint8
+	Off      int16
+	Imm      int32
+	Target   string
+	label    string
+}
+
+// Label marks the position of the next instruction as name.
+func Label(name string) Insn { return Insn{label: name} }
+
+// Mov64Imm is dst = imm.
+func Mov64Imm(dst uint8, imm int32) Insn {
+	return Insn{Code: classALU64 | opMov | srcK, Dst: dst, Imm: imm}
+}
+
+// Mov64Reg is dst = src.
+func Mov64Reg(dst, src uint8) Insn {
+	return Insn{Code: classALU64 | opMov | srcX, Dst: dst, Src: src}
+}
+
+// Mov32Imm is dst = (u32)imm, zero-extended.
+func Mov32Imm(dst uint8, imm int32) Insn {
+	return Insn{Code: classALU | opMov | srcK, Dst: dst, Imm: imm}
+}
+
+// Mov32Reg is dst = (u32)src, zero-extended.
+func Mov32Reg(dst, src uint8) Insn {
+	return Insn{Code: classALU | opMov | srcX, Dst: dst, Src: src}
+}
+
+// ALU32Imm is dst = (u32)(dst op imm).
+func ALU32Imm(op, dst uint8, imm int32) Insn {
+	return Insn{Code: classALU | op | srcK, Dst: dst, Imm: imm}
+}
+
+// ALU32Reg is dst = (u32)(dst op src).
+func ALU32Reg(op, dst, src uint8) Insn {
+	return Insn{Code: classALU | op | srcX, Dst: dst, Src: src}
+}
+
+// ALU64Imm is dst = dst op imm.
+func ALU64Imm(op, dst uint8, imm int32) Insn {
+	return Insn{Code: classALU64 | op | srcK, Dst: dst, Imm: imm}
+}
+
+// ALU64Reg is dst = dst op src.
+func ALU64Reg(op, dst, src uint8) Insn {
+	return Insn{Code: classALU64 | op | srcX, Dst: dst, Src: src}
+}
+
+// ToBE converts the low bits (16, 32 or 64) of dst from host to network
+// byte order.
+func ToBE(dst uint8, bits int32) Insn {
+	return Insn{Code: classALU | opEnd | toBE, Dst: dst, Imm: bits}
+}
+
+// LoadMem is dst = *(size *)(src + off).
+func LoadMem(size, dst, src uint8, off int16) Insn {
+	return Insn{Code: classLDX | modeMEM | size, Dst: dst, Src: src, Off: off}
+}
+
+// StoreMem is *(size *)(dst + off) = src.
+func StoreMem(size, dst, src uint8, off int16) Insn {
+	return Insn{Code: classSTX | modeMEM | size, Dst: dst, Src: src, Off: off}
+}
+
+// StoreImm is *(size *)(dst + off) = imm.
+func StoreImm(size, dst uint8, off int16, imm int32) Insn {
+	return Insn{Code: classST | modeMEM | size, Dst: dst, Off: off, Imm: imm}
+}
+
+// AtomicAdd64 is lock *(u64 *)(dst + off) += src.
+func AtomicAdd64(dst, src uint8, off int16) Insn {
+	return Insn{Code: classSTX | modeATOMIC | SizeDW, Dst: dst, Src: src, Off: off, Imm: opAtomicAdd}
+}
+
+// LoadAbs is R0 = packet[k] in network byte order, for socket filters: the
+// context must be in R6 and R1-R5 are clobbered. A load past the end of the
+// packet ends the program with 0.
+func LoadAbs(size uint8, k int32) Insn {
+	return Insn{Code: classLD | modeABS | size, Imm: k}
+}
+
+// LoadInd is R0 = packet[src + k], like LoadAbs.
+func LoadInd(size, src uint8, k int32) Insn {
+	return Insn{Code: classLD | modeIND | size, Src: src, Imm: k}
+}
+
+// LoadMapFD is dst = the map with file descriptor fd. It takes two
+// instruction slots.
+func LoadMapFD(dst uint8, fd int) []Insn {
+	return []Insn{
+		{Code: classLD | modeIMM | SizeDW, Dst: dst, Src: pseudoMapFD, Imm: int32(fd)},
+		{}, // second half of ld_imm64
+	}
+}
+
+// Jump is goto target.
+func Jump(target string) Insn {
+	return Insn{Code: classJMP | opJA, Target: target}
+}
+
+// JumpImm is if dst op imm goto target, comparing 64 bits.
+func JumpImm(op, dst uint8, imm int32, target string) Insn {
+	return Insn{Code: classJMP | op | srcK, Dst: dst, Imm: imm, Target: target}
+}
+
+// JumpReg is if dst op src goto target, comparing 64 bits.
+func JumpReg(op, dst, src uint8, target string) Insn {
+	return Insn{Code: classJMP | op | srcX, Dst: dst, Src: src, Target: target}
+}
+
+// Jump32Imm is if (u32)dst op (u32)imm goto target.
+func Jump32Imm(op, dst uint8, imm int32, target string) Insn {
+	return Insn{Code: classJMP32 | op | srcK, Dst: dst, Imm: imm, Target: target}
+}
+
+// Jump32Reg is if (u32)dst op (u32)src goto target.
+func Jump32Reg(op, dst, src uint8, target string) Insn {
+	return Insn{Code: classJMP32 | op | srcX, Dst: dst, Src: src, Target: target}
+}
+
+// Call calls helper function fn with arguments in R1-R5.
+func Call(fn int32) Insn {
+	return Insn{Code: classJMP | opCall, Imm: fn}
+}
+
+// Exit returns R0.
+func Exit() Insn {
+	return Insn{Code: classJMP | opExit}
+}
+
+// Assemble resolves jump targets and returns insns in the kernel's struct
+// bpf_insn layout.
+func Assemble(insns []Insn) ([]byte, error) {
+	labels := make(map[string]int)
+	n := 0
+	for _, in := range insns {
+		if in.label != "" {
+			if _, dup := labels[in.label]; dup {
+				return nil, fmt.Errorf("ebpf: duplicate label %q", in.label)
+			}
+			labels[in.label] = n
+			continue
+		}
+		n++
+	}
+
+	buf := make([]byte, 0, 8*n)
+	pos := 0
+	for _, in := range insns {
+		if in.label != "" {
+			continue
+		}
+		if in.Target != "" {
+			at, ok := labels[in.Target]
+			if !ok {
+				return nil, fmt.Errorf("ebpf: undefined label %q", in.Target)
+			}
+			off := at - pos - 1
+			if off < math.MinInt16 || off > math.MaxInt16 {
+				return nil, fmt.Errorf("ebpf: jump to %q out of range", in.Target)
+			}
+			in.Off = int16(off)
+		}
+		var b [8]byte
+		b[0] = in.Code
+		b[1] = in.Src<<4 | in.Dst&0x0f
+		binary.LittleEndian.PutUint16(b[2:], uint16(in.Off))
+		binary.LittleEndian.PutUint32(b[4:], uint32(in.Imm))
+		buf = append(buf, b[:]...)
+		pos++
+	}
+	return buf, nil
+}
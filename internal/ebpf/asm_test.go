@@ -0,0 +1,98 @@
+package ebpf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+func TestAssemble(t *testing.T) {
+	code, err := Assemble([]Insn{
+		Mov64Reg(R6, R1),           // 0: bf 16
+		JumpImm(JEq, R6, 0, "out"), // 1: 15 06 +2
+		LoadMapFD(R1, 5)[0],        // 2: 18 11 imm 5 (first slot)
+		LoadMapFD(R1, 5)[1],        // 3: second slot
+		Label("out"),               //
+		Mov64Imm(R0, -1),           // 4: b7 00 imm -1
+		Exit(),                     // 5: 95
+	})
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	want := []byte{
+		0xbf, 0x16, 0, 0, 0, 0, 0, 0,
+		0x15, 0x06, 2, 0, 0, 0, 0, 0,
+		0x18, 0x11, 0, 0, 5, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0xb7, 0x00, 0, 0, 0xff, 0xff, 0xff, 0xff,
+		0x95, 0, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(code, want) {
+		t.Errorf("code =\n% x\nwant\n% x", code, want)
+	}
+}
+
+func TestAssembleLabels(t *testing.T) {
+	if _, err := Assemble([]Insn{Jump("nowhere"), Exit()}); err == nil || !strings.Contains(err.Error(), "nowhere") {
+		t.Errorf("undefined label: err = %v", err)
+	}
+	if _, err := Assemble([]Insn{Label("a"), Label("a"), Exit()}); err == nil {
+		t.Error("duplicate label: expected error")
+	}
+	// A backward jump
+	code, err := Assemble([]Insn{Label("top"), Mov64Imm(R0, 0), Jump("top")})
+	if err != nil {
+		t.Fatalf("Assemble: %v", err)
+	}
+	if off := int16(code[10]) | int16(code[11])<<8; off != -2 {
+		t.Errorf("backward offset = %d, want -2", off)
+	}
+}
+
+func TestClassic(t *testing.T) {
+	ret := func(k uint32) []Insn { return []Insn{Mov32Imm(R0, int32(k)), Exit()} }
+	insns, err := Classic([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpBitsNotSet, Val: 0x100, SkipTrue: 1},
+		bpf.RetConstant{Val: 1},
+		bpf.RetConstant{Val: 0},
+	}, SocketFilter, "p", ret)
+	if err != nil {
+		t.Fatalf("Classic: %v", err)
+	}
+	// "jset" jumps on bits set: the targets of the inverted test swap
+	var jmp *Insn
+	for i := range insns {
+		if insns[i].Code&0x07 == classJMP32 {
+			jmp = &insns[i]
+		}
+	}
+	if jmp == nil || jmp.Code&0xf0 != JSet || jmp.Target != "p.2" {
+		t.Errorf("jump = %+v, want jset to p.2", jmp)
+	}
+	for _, ins := range insns {
+		if ins.label == "p.abort" {
+			t.Error("socket filter without aborts has an abort block")
+		}
+	}
+	if _, err := Assemble(insns); err != nil {
+		t.Errorf("Assemble: %v", err)
+	}
+
+	xdp, err := Classic([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.RetConstant{Val: 0},
+	}, XDP, "p", ret)
+	if err != nil {
+		t.Fatalf("Classic XDP: %v", err)
+	}
+	if last := xdp[len(xdp)-3]; last.label != "p.abort" {
+		t.Errorf("XDP load without an abort block: %+v", last)
+	}
+
+	if _, err := Classic([]bpf.Instruction{bpf.RetA{}}, SocketFilter, "p", ret); err == nil {
+		t.Error("ret a: expected error")
+	}
+}
@@ -0,0 +1,281 @@
+package ebpf
+
+import (
+	"fmt"
+	"math"
+
+	"golang.org/x/net/bpf"
+)
+
+// Target is the program type a classic program is translated for.
+type Target int
+
+const (
+	// SocketFilter loads packet bytes with LoadAbs / LoadInd on the skb.
+	SocketFilter Target = iota
+	// XDP reads packet bytes directly, checking bounds against data_end.
+	XDP
+)
+
+// Registers of a translated classic program. The caller's prologue must
+// set the context register (Mov64Reg(RegCtx, R1)).
+const (
+	RegA   = R0 // accumulator
+	RegX   = R7 // index register
+	RegCtx = R6 // program context
+	regTmp = R8
+)
+
+// scratchOff is the stack offset of classic scratch memory word M[n].
+func scratchOff(n int) int16 { return int16(-64 + 4*n) }
+
+// ScratchSize is the stack space at the top of the frame used for classic
+// scratch memory; other code of the program must use the stack below it.
+const ScratchSize = 64
+
+// xdp_md field offsets.
+const (
+	xdpMdData    = 0
+	xdpMdDataEnd = 4
+)
+
+// __sk_buff field offsets.
+const (
+	skbLen         = 0
+	skbVLANPresent = 20
+	skbVLANTCI     = 24
+)
+
+// Classic translates the classic BPF program prog for target, as the kernel
+// does for classic socket filters, so that it can be part of a larger eBPF
+// program: instruction i is labelled "<name>.<i>" and each "ret #k" is
+// replaced by ret(k), which should jump or exit. A load outside the packet
+// and a division by zero, which end a classic program with 0, jump to
+// "<name>.abort", which runs ret(0). "ret a" is not supported.
+//
+// Extensions supported are len, rand and, for socket filters, vlan_avail
+// and vlan_tci; an XDP program sees VLAN tags in the packet and vlan_avail
+// is 0.
+func Classic(prog []bpf.Instruction, target Target, name string, ret func(k uint32) []Insn) ([]Insn, error) {
+	label := func(i int) string { return fmt.Sprintf("%s.%d", name, i) }
+	abort := name + ".abort"
+
+	var out []Insn
+	aborts := false // the verifier rejects unreachable code
+	for i, ins := range prog {
+		out = append(out, Label(label(i)))
+		next := label(i + 1)
+		switch ins := ins.(type) {
+		case bpf.LoadConstant:
+			out = append(out, Mov32Imm(classicReg(ins.Dst), int32(ins.Val)))
+		case bpf.LoadScratch:
+			out = append(out, LoadMem(SizeW, classicReg(ins.Dst), R10, scratchOff(ins.N)))
+		case bpf.StoreScratch:
+			out = append(out, StoreMem(SizeW, R10, classicReg(ins.Src), scratchOff(ins.N)))
+		case bpf.LoadAbsolute:
+			aborts = aborts || target == XDP
+			code, err := loadPacket(target, ins.Off, ins.Size, false, abort)
+			if err != nil {
+				return nil, fmt.Errorf("ebpf: %s.%d: %w", name, i, err)
+			}
+			out = append(out, code...)
+		case bpf.LoadIndirect:
+			aborts = aborts || target == XDP
+			code, err := loadPacket(target, ins.Off, ins.Size, true, abort)
+			if err != nil {
+				return nil, fmt.Errorf("ebpf: %s.%d: %w", name, i, err)
+			}
+			out = append(out, code...)
+		case bpf.LoadMemShift:
+			// X = 4 * (packet[k] & 0xf), keeping A
+			aborts = aborts || target == XDP
+			code, err := loadPacket(target, ins.Off, 1, false, abort)
+			if err != nil {
+				return nil, fmt.Errorf("ebpf: %s.%d: %w", name, i, err)
+			}
+			out = append(out, Mov64Reg(regTmp, RegA))
+			out = append(out, code...)
+			out = append(out,
+				ALU32Imm(ALUAnd, RegA, 0xf),
+				ALU32Imm(ALULsh, RegA, 2),
+				Mov32Reg(RegX, RegA),
+				Mov64Reg(RegA, regTmp))
+		case bpf.LoadExtension:
+			code, err := loadExtension(target, ins.Num)
+			if err != nil {
+				return nil, fmt.Errorf("ebpf: %s.%d: %w", name, i, err)
+			}
+			out = append(out, code...)
+		case bpf.ALUOpConstant:
+			out = append(out, ALU32Imm(aluOp(ins.Op), RegA, int32(ins.Val)))
+		case bpf.ALUOpX:
+			if ins.Op == bpf.ALUOpDiv || ins.Op == bpf.ALUOpMod {
+				aborts = true
+				out = append(out, Jump32Imm(JEq, RegX, 0, abort))
+			}
+			out = append(out, ALU32Reg(aluOp(ins.Op), RegA, RegX))
+		case bpf.NegateA:
+			out = append(out, Insn{Code: classALU | ALUNeg, Dst: RegA})
+		case bpf.TAX:
+			out = append(out, Mov32Reg(RegX, RegA))
+		case bpf.TXA:
+			out = append(out, Mov32Reg(RegA, RegX))
+		case bpf.Jump:
+			out = append(out, Jump(label(i+1+int(ins.Skip))))
+		case bpf.JumpIf:
+			op, invert := jumpOp(ins.Cond)
+			out = append(out, condJump(Jump32Imm(op, RegA, int32(ins.Val), ""), invert,
+				label(i+1+int(ins.SkipTrue)), label(i+1+int(ins.SkipFalse)), next)...)
+		case bpf.JumpIfX:
+			op, invert := jumpOp(ins.Cond)
+			out = append(out, condJump(Jump32Reg(op, RegA, RegX, ""), invert,
+				label(i+1+int(ins.SkipTrue)), label(i+1+int(ins.SkipFalse)), next)...)
+		case bpf.RetConstant:
+			out = append(out, ret(ins.Val)...)
+		default:
+			return nil, fmt.Errorf("ebpf: %s.%d: unsupported classic instruction %v", name, i, ins)
+		}
+	}
+	if aborts {
+		out = append(out, Label(abort))
+		out = append(out, ret(0)...)
+	}
+	return out, nil
+}
+
+// condJump returns jmp going to ifTrue, else to ifFalse, falling through
+// when ifFalse is next.
+func condJump(jmp Insn, invert bool, ifTrue, ifFalse, next string) []Insn {
+	if invert {
+		ifTrue, ifFalse = ifFalse, ifTrue
+	}
+	jmp.Target = ifTrue
+	if ifFalse == next {
+		return []Insn{jmp}
+	}
+	return []Insn{jmp, Jump(ifFalse)}
+}
+
+func classicReg(r bpf.Register) uint8 {
+	if r == bpf.RegX {
+		return RegX
+	}
+	return RegA
+}
+
+// loadPacket returns the code loading size bytes at off (plus X if indexed)
+// into A.
+func loadPacket(target Target, off uint32, size int, indexed bool, abort string) ([]Insn, error) {
+	var sz uint8
+	switch size {
+	case 1:
+		sz = SizeB
+	case 2:
+		sz = SizeH
+	case 4:
+		sz = SizeW
+	default:
+		return nil, fmt.Errorf("invalid load size %d", size)
+	}
+	if off > math.MaxInt16-4 {
+		return nil, fmt.Errorf("load offset %d out of range", off)
+	}
+
+	if target == SocketFilter {
+		if indexed {
+			return []Insn{LoadInd(sz, RegX, int32(off))}, nil
+		}
+		return []Insn{LoadAbs(sz, int32(off))}, nil
+	}
+
+	code := []Insn{
+		LoadMem(SizeW, R2, RegCtx, xdpMdData),
+		LoadMem(SizeW, R3, RegCtx, xdpMdDataEnd),
+	}
+	if indexed {
+		code = append(code, ALU64Reg(ALUAdd, R2, RegX))
+	}
+	code = append(code,
+		Mov64Reg(R4, R2),
+		ALU64Imm(ALUAdd, R4, int32(off)+int32(size)),
+		JumpReg(JGt, R4, R3, abort),
+		LoadMem(sz, RegA, R2, int16(off)))
+	if size > 1 {
+		code = append(code, ToBE(RegA, int32(8*size)))
+	}
+	return code, nil
+}
+
+func loadExtension(target Target, ext bpf.Extension) ([]Insn, error) {
+	switch ext {
+	case bpf.ExtLen:
+		if target == SocketFilter {
+			return []Insn{LoadMem(SizeW, RegA, RegCtx, skbLen)}, nil
+		}
+		return []Insn{
+			LoadMem(SizeW, RegA, RegCtx, xdpMdDataEnd),
+			LoadMem(SizeW, R2, RegCtx, xdpMdData),
+			ALU32Reg(ALUSub, RegA, R2),
+		}, nil
+	case bpf.ExtRand:
+		return []Insn{Call(FuncGetPrandomU32)}, nil
+	case bpf.ExtVLANTagPresent:
+		if target == SocketFilter {
+			return []Insn{LoadMem(SizeW, RegA, RegCtx, skbVLANPresent)}, nil
+		}
+		return []Insn{Mov32Imm(RegA, 0)}, nil
+	case bpf.ExtVLANTag:
+		if target == SocketFilter {
+			return []Insn{LoadMem(SizeW, RegA, RegCtx, skbVLANTCI)}, nil
+		}
+		return []Insn{Mov32Imm(RegA, 0)}, nil
+	}
+	return nil, fmt.Errorf("unsupported extension %d", ext)
+}
+
+func aluOp(op bpf.ALUOp) uint8 {
+	switch op {
+	case bpf.ALUOpAdd:
+		return ALUAdd
+	case bpf.ALUOpSub:
+		return ALUSub
+	case bpf.ALUOpMul:
+		return ALUMul
+	case bpf.ALUOpDiv:
+		return ALUDiv
+	case bpf.ALUOpOr:
+		return ALUOr
+	case bpf.ALUOpAnd:
+		return ALUAnd
+	case bpf.ALUOpShiftLeft:
+		return ALULsh
+	case bpf.ALUOpShiftRight:
+		return ALURsh
+	case bpf.ALUOpMod:
+		return ALUMod
+	default: // bpf.ALUOpXor
+		return ALUXor
+	}
+}
+
+// jumpOp returns the eBPF jump for cond, and whether its targets swap.
+func jumpOp(cond bpf.JumpTest) (op uint8, invert bool) {
+	switch cond {
+	case bpf.JumpEqual:
+		return JEq, false
+	case bpf.JumpNotEqual:
+		return JNe, false
+	case bpf.JumpGreaterThan:
+		return JGt, false
+	case bpf.JumpLessThan:
+		return JLt, false
+	case bpf.JumpGreaterOrEqual:
+		return JGe, false
+	case bpf.JumpLessOrEqual:
+		return JLe, false
+	case bpf.JumpBitsSet:
+		return JSet, false
+	default: // bpf.JumpBitsNotSet
+		return JSet, true
+	}
+}
@@ -0,0 +1,124 @@
+//go:build linux
+
+package ebpf
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapCreateAttr is the BPF_MAP_CREATE part of union bpf_attr.
+type mapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+}
+
+// progLoadAttr is the BPF_PROG_LOAD part of union bpf_attr.
+type progLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+	progFlags   uint32
+	progName    [16]byte
+}
+
+// mapElemAttr is the BPF_MAP_*_ELEM part of union bpf_attr.
+type mapElemAttr struct {
+	mapFD uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+func sysBPF(cmd uintptr, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// CreateMap creates a map of mapType (unix.BPF_MAP_TYPE_*) and returns its
+// file descriptor.
+func CreateMap(mapType, keySize, valueSize, maxEntries uint32) (int, error) {
+	attr := mapCreateAttr{
+		mapType:    mapType,
+		keySize:    keySize,
+		valueSize:  valueSize,
+		maxEntries: maxEntries,
+	}
+	return sysBPF(unix.BPF_MAP_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// LoadProgram loads insns as a program of progType (unix.BPF_PROG_TYPE_*)
+// and returns its file descriptor. A program rejected by the verifier fails
+// with the verifier log.
+func LoadProgram(progType uint32, name string, insns []Insn) (int, error) {
+	code, err := Assemble(insns)
+	if err != nil {
+		return -1, err
+	}
+	license := []byte("Apache-2.0\x00")
+	logBuf := make([]byte, 64*1024)
+	attr := progLoadAttr{
+		progType: progType,
+		insnCnt:  uint32(len(code) / 8),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(logBuf)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	copy(attr.progName[:len(attr.progName)-1], name)
+	fd, err := sysBPF(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return -1, fmt.Errorf("%w: %s", err, cString(logBuf))
+	}
+	return fd, nil
+}
+
+// UpdateUint32 sets key to value in a map with u32 keys and values.
+func UpdateUint32(mapFD int, key, value uint32) error {
+	attr := mapElemAttr{
+		mapFD: uint32(mapFD),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value))),
+		flags: unix.BPF_ANY,
+	}
+	_, err := sysBPF(unix.BPF_MAP_UPDATE_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+// LookupUint64 returns the value of key in a map with u32 keys and u64
+// values.
+func LookupUint64(mapFD int, key uint32) (uint64, error) {
+	var value uint64
+	attr := mapElemAttr{
+		mapFD: uint32(mapFD),
+		key:   uint64(uintptr(unsafe.Pointer(&key))),
+		value: uint64(uintptr(unsafe.Pointer(&value))),
+	}
+	_, err := sysBPF(unix.BPF_MAP_LOOKUP_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return value, err
+}
+
+// cString returns b up to its first NUL.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,97 @@
+// Package featureflag holds the runtime feature flags of a task: switches
+// for risky code paths that can be turned off on a running task with the
+// flag_set command, without a config redeploy or a restart.
+//
+// Flags only gate features the task is configured to use; turning a flag on
+// never enables a feature the task config leaves off.
+package featureflag
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+)
+
+// Known flags.
+const (
+	// ZeroCopy hands capture ring-buffer memory to the pipelines without a
+	// copy (afpacket). Off: each frame is copied before it is queued.
+	ZeroCopy = "zero_copy"
+	// ShadowParsers runs the candidate parsers of parsers[].shadow, e.g. a
+	// new SIP parser. Off: shadow parsers see no packets.
+	ShadowParsers = "shadow_parsers"
+	// AdaptiveBatch lets reporters with adaptive_batch move their batch
+	// size. Off: they flush at the configured batch_size.
+	AdaptiveBatch = "adaptive_batch"
+)
+
+// defaults are the values of flags a task config does not set.
+var defaults = map[string]bool{
+	ZeroCopy:      true,
+	ShadowParsers: true,
+	AdaptiveBatch: true,
+}
+
+// Names returns the known flags, sorted.
+func Names() []string {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Valid reports whether name is a known flag.
+func Valid(name string) bool {
+	_, ok := defaults[name]
+	return ok
+}
+
+// Set is the flags of one task. It is safe for concurrent use; a nil Set
+// has every flag at its default.
+type Set struct {
+	flags map[string]*atomic.Bool // fixed at New, values change
+}
+
+// New returns a Set with the given values over the defaults. Unknown names
+// are ignored; config validation rejects them.
+func New(values map[string]bool) *Set {
+	s := &Set{flags: make(map[string]*atomic.Bool, len(defaults))}
+	for name, on := range defaults {
+		if v, ok := values[name]; ok {
+			on = v
+		}
+		b := new(atomic.Bool)
+		b.Store(on)
+		s.flags[name] = b
+	}
+	return s
+}
+
+// Enabled reports whether flag name is on. Unknown flags are off.
+func (s *Set) Enabled(name string) bool {
+	if s == nil {
+		return defaults[name]
+	}
+	b, ok := s.flags[name]
+	return ok && b.Load()
+}
+
+// Set turns flag name on or off and returns its previous value.
+func (s *Set) Set(name string, on bool) (bool, error) {
+	b, ok := s.flags[name]
+	if !ok {
+		return false, fmt.Errorf("unknown feature flag %q (known: %v)", name, Names())
+	}
+	return b.Swap(on), nil
+}
+
+// Snapshot returns the current value of every flag.
+func (s *Set) Snapshot() map[string]bool {
+	out := make(map[string]bool, len(defaults))
+	for name := range defaults {
+		out[name] = s.Enabled(name)
+	}
+	return out
+}
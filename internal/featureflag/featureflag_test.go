@@ -0,0 +1,48 @@
+package featureflag
+
+import "testing"
+
+func TestSet(t *testing.T) {
+	s := New(map[string]bool{ShadowParsers: false, "bogus": true})
+	if !s.Enabled(ZeroCopy) || !s.Enabled(AdaptiveBatch) {
+		t.Error("unset flags should keep their defaults")
+	}
+	if s.Enabled(ShadowParsers) {
+		t.Error("shadow_parsers should be off as configured")
+	}
+	if s.Enabled("bogus") {
+		t.Error("unknown flags should be off")
+	}
+
+	prev, err := s.Set(ZeroCopy, false)
+	if err != nil || !prev {
+		t.Errorf("Set = %v, %v; want true, nil", prev, err)
+	}
+	if s.Enabled(ZeroCopy) {
+		t.Error("zero_copy should be off after Set")
+	}
+	if _, err := s.Set("bogus", true); err == nil {
+		t.Error("expected error for an unknown flag")
+	}
+
+	snap := s.Snapshot()
+	if len(snap) != 3 || snap[ZeroCopy] || snap[ShadowParsers] || !snap[AdaptiveBatch] {
+		t.Errorf("snapshot = %v", snap)
+	}
+
+	var nilSet *Set
+	if !nilSet.Enabled(ZeroCopy) || nilSet.Enabled("bogus") {
+		t.Error("nil set should report defaults")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, name := range Names() {
+		if !Valid(name) {
+			t.Errorf("Valid(%q) = false", name)
+		}
+	}
+	if Valid("bogus") {
+		t.Error("Valid(bogus) = true")
+	}
+}
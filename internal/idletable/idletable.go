@@ -0,0 +1,81 @@
+// Package idletable holds per-flow state (RTP streams, TCP connections) of
+// the trackers that follow traffic across packets, forgetting the flows that
+// went idle so memory stays bounded without per-entry timers.
+package idletable
+
+import "time"
+
+// Table holds state V per key K and forgets the entries idle for longer
+// than its TTL, sweeping on Touch at most once per sweep interval. It is not
+// safe for concurrent use.
+type Table[K comparable, V any] struct {
+	ttl        time.Duration
+	sweepEvery time.Duration
+	max        int // entries held; 0 = unbounded
+
+	entries   map[K]*entry[V]
+	lastSweep time.Time
+}
+
+type entry[V any] struct {
+	state V
+	seen  time.Time
+}
+
+// New creates a table forgetting entries idle for ttl, swept at most once
+// per sweepEvery, holding at most max entries (0 = unbounded).
+func New[K comparable, V any](ttl, sweepEvery time.Duration, max int) *Table[K, V] {
+	return &Table[K, V]{
+		ttl:        ttl,
+		sweepEvery: sweepEvery,
+		max:        max,
+		entries:    make(map[K]*entry[V]),
+	}
+}
+
+// Get returns the state of key without marking it seen.
+func (t *Table[K, V]) Get(key K) (*V, bool) {
+	e, ok := t.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return &e.state, true
+}
+
+// Touch returns the state of key, seen at now, and whether it is a new,
+// zero state. A new key is not added to a full table: Touch returns nil.
+func (t *Table[K, V]) Touch(key K, now time.Time) (state *V, created bool) {
+	t.sweep(now)
+	e, ok := t.entries[key]
+	if !ok {
+		if t.max > 0 && len(t.entries) >= t.max {
+			return nil, false
+		}
+		e = &entry[V]{}
+		t.entries[key] = e
+	}
+	e.seen = now
+	return &e.state, !ok
+}
+
+// Delete forgets key.
+func (t *Table[K, V]) Delete(key K) {
+	delete(t.entries, key)
+}
+
+// Len returns the number of entries held.
+func (t *Table[K, V]) Len() int {
+	return len(t.entries)
+}
+
+func (t *Table[K, V]) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.sweepEvery {
+		return
+	}
+	t.lastSweep = now
+	for key, e := range t.entries {
+		if now.Sub(e.seen) > t.ttl {
+			delete(t.entries, key)
+		}
+	}
+}
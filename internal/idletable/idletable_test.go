@@ -0,0 +1,30 @@
+package idletable
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTable_SweepAndMax(t *testing.T) {
+	tb := New[string, int](time.Minute, time.Second, 2)
+	now := time.Unix(1700000000, 0)
+
+	v, created := tb.Touch("a", now)
+	if !created || *v != 0 {
+		t.Fatalf("Touch(a) = %d, %v", *v, created)
+	}
+	*v = 7
+	if v, created := tb.Touch("a", now); created || *v != 7 {
+		t.Errorf("Touch(a) again = %d, %v", *v, created)
+	}
+	tb.Touch("b", now.Add(50*time.Second))
+	if v, _ := tb.Touch("c", now); v != nil {
+		t.Error("full table added a stream")
+	}
+
+	// a is idle for over a minute and swept; b is not.
+	tb.Touch("b", now.Add(90*time.Second))
+	if _, ok := tb.Get("a"); ok || tb.Len() != 1 {
+		t.Errorf("after sweep: a present %v, %d streams", ok, tb.Len())
+	}
+}
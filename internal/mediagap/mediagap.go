@@ -0,0 +1,114 @@
+// Package mediagap detects RTP streams that stop while their call is up.
+//
+// The SIP parser registers the media flows of a call in the task's
+// FlowRegistry and removes them on BYE/CANCEL; the RTP parser touches a flow
+// for every RTP packet. A registered flow that was seen once and then stays
+// silent for the timeout is a media gap: a media timeout when both directions
+// stopped, one-way audio when the reverse direction is still flowing.
+package mediagap
+
+import (
+	"net/netip"
+	"time"
+
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// PayloadType of media gap event packets.
+const PayloadType = "media_gap"
+
+// Gap is one RTP stream that stopped. It is the payload of media_gap events.
+type Gap struct {
+	CallID     string     `json:"call_id"`
+	Codec      string     `json:"codec,omitempty"`
+	MediaState string     `json:"media_state,omitempty"`
+	SrcIP      netip.Addr `json:"src_ip"`
+	DstIP      netip.Addr `json:"dst_ip"`
+	SrcPort    uint16     `json:"src_port"`
+	DstPort    uint16     `json:"dst_port"`
+	LastSeen   time.Time  `json:"last_seen"`
+	Idle       float64    `json:"idle_seconds"`
+	OneWay     bool       `json:"one_way"` // the reverse direction is still active
+
+	// Statistics of both directions of the stream, when the flow is a
+	// plugin.Flow
+	FirstSeen      time.Time `json:"first_seen,omitzero"`       // first packet in either direction
+	Packets        uint64    `json:"packets,omitempty"`         // packets from src to dst
+	ReversePackets uint64    `json:"reverse_packets,omitempty"` // packets from dst to src
+}
+
+// Detector finds media gaps in a FlowRegistry. Each gap is reported once;
+// a stream that resumes and stops again is reported again.
+// It is not safe for concurrent use.
+type Detector struct {
+	registry plugin.FlowRegistry
+	activity plugin.FlowActivity
+	timeout  time.Duration
+	reported map[plugin.FlowKey]time.Time // last seen of streams already reported
+}
+
+// NewDetector creates a detector for streams silent for timeout. It returns
+// nil if registry does not record flow activity.
+func NewDetector(registry plugin.FlowRegistry, timeout time.Duration) *Detector {
+	activity, ok := registry.(plugin.FlowActivity)
+	if !ok {
+		return nil
+	}
+	return &Detector{
+		registry: registry,
+		activity: activity,
+		timeout:  timeout,
+		reported: make(map[plugin.FlowKey]time.Time),
+	}
+}
+
+// Check returns the streams that became gaps since the last call.
+func (d *Detector) Check(now time.Time) []Gap {
+	var gaps []Gap
+	d.registry.Range(func(key plugin.FlowKey, value any) bool {
+		ctx, ok := plugin.FlowContext(value)
+		if !ok || key.Proto != 17 || ctx["codec"] == "RTCP" {
+			return true
+		}
+		last, ok := d.activity.LastSeen(key)
+		if !ok || now.Sub(last) < d.timeout {
+			return true
+		}
+		if reported, ok := d.reported[key]; ok && reported.Equal(last) {
+			return true
+		}
+		d.reported[key] = last
+
+		back, ok := d.activity.LastSeen(key.Reverse())
+		gap := Gap{
+			CallID:     ctx["call_id"],
+			Codec:      ctx["codec"],
+			MediaState: ctx["media_state"],
+			SrcIP:      key.SrcIP,
+			DstIP:      key.DstIP,
+			SrcPort:    key.SrcPort,
+			DstPort:    key.DstPort,
+			LastSeen:   last,
+			Idle:       now.Sub(last).Seconds(),
+			OneWay:     ok && now.Sub(back) < d.timeout,
+		}
+		if flow, ok := value.(*plugin.Flow); ok {
+			stats := flow.Stats()
+			gap.FirstSeen = stats.FirstSeen
+			gap.Packets, gap.ReversePackets = stats.Forward.Packets, stats.Reverse.Packets
+			if !flow.IsForward(key) {
+				gap.Packets, gap.ReversePackets = gap.ReversePackets, gap.Packets
+			}
+		}
+		gaps = append(gaps, gap)
+		return true
+	})
+
+	// Forget streams whose call ended or whose media resumed.
+	for key, reported := range d.reported {
+		if last, ok := d.activity.LastSeen(key); !ok || !last.Equal(reported) {
+			delete(d.reported, key)
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,152 @@
+package mediagap
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// fakeRegistry is a FlowRegistry with explicit last-seen times.
+type fakeRegistry struct {
+	flows map[plugin.FlowKey]any
+	seen  map[plugin.FlowKey]time.Time
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{flows: make(map[plugin.FlowKey]any), seen: make(map[plugin.FlowKey]time.Time)}
+}
+
+func (r *fakeRegistry) Get(key plugin.FlowKey) (any, bool) {
+	v, ok := r.flows[key]
+	return v, ok
+}
+func (r *fakeRegistry) Set(key plugin.FlowKey, value any) { r.flows[key] = value }
+func (r *fakeRegistry) Delete(key plugin.FlowKey)         { delete(r.flows, key); delete(r.seen, key) }
+func (r *fakeRegistry) Count() int                        { return len(r.flows) }
+func (r *fakeRegistry) Clear()                            { r.flows = make(map[plugin.FlowKey]any) }
+func (r *fakeRegistry) Range(f func(plugin.FlowKey, any) bool) {
+	for k, v := range r.flows {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+func (r *fakeRegistry) Touch(key plugin.FlowKey, now time.Time) { r.seen[key] = now }
+func (r *fakeRegistry) LastSeen(key plugin.FlowKey) (time.Time, bool) {
+	t, ok := r.seen[key]
+	return t, ok
+}
+
+// plainRegistry hides the activity methods of a fakeRegistry.
+type plainRegistry struct{ plugin.FlowRegistry }
+
+var (
+	aToB = plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 10000, DstPort: 20000, Proto: 17}
+	bToA = plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.2"), DstIP: netip.MustParseAddr("10.0.0.1"), SrcPort: 20000, DstPort: 10000, Proto: 17}
+)
+
+func registerCall(r *fakeRegistry, callID string) {
+	ctx := map[string]string{"call_id": callID, "codec": "PCMA", "media_state": "confirmed"}
+	r.Set(aToB, ctx)
+	r.Set(bToA, ctx)
+}
+
+func TestDetector_OneWayAndTimeout(t *testing.T) {
+	r := newFakeRegistry()
+	registerCall(r, "call-1")
+	d := NewDetector(r, 10*time.Second)
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	// Streams that never started are not gaps.
+	if gaps := d.Check(base.Add(time.Minute)); len(gaps) != 0 {
+		t.Fatalf("gaps before any media = %v", gaps)
+	}
+
+	// A→B stops at base, B→A keeps flowing: one-way audio.
+	r.Touch(aToB, base)
+	r.Touch(bToA, base.Add(15*time.Second))
+	gaps := d.Check(base.Add(20 * time.Second))
+	if len(gaps) != 1 {
+		t.Fatalf("gaps = %v, want A→B only", gaps)
+	}
+	g := gaps[0]
+	if g.CallID != "call-1" || g.SrcPort != 10000 || !g.OneWay || g.Idle != 20 || g.Codec != "PCMA" {
+		t.Errorf("gap = %+v", g)
+	}
+
+	// Reported once; then B→A stops too and is not one-way.
+	gaps = d.Check(base.Add(30 * time.Second))
+	if len(gaps) != 1 || gaps[0].SrcPort != 20000 || gaps[0].OneWay {
+		t.Fatalf("gaps = %+v, want B→A media timeout", gaps)
+	}
+	if gaps := d.Check(base.Add(40 * time.Second)); len(gaps) != 0 {
+		t.Errorf("gaps reported twice: %v", gaps)
+	}
+
+	// Media resumes and stops again: reported again.
+	r.Touch(aToB, base.Add(45*time.Second))
+	if gaps := d.Check(base.Add(50 * time.Second)); len(gaps) != 0 {
+		t.Errorf("gaps while A→B is active: %v", gaps)
+	}
+	if gaps := d.Check(base.Add(60 * time.Second)); len(gaps) != 1 || gaps[0].SrcPort != 10000 {
+		t.Errorf("gaps = %v, want A→B again", gaps)
+	}
+}
+
+func TestDetector_FlowStats(t *testing.T) {
+	r := newFakeRegistry()
+	flow := plugin.NewFlow(aToB, map[string]string{"call_id": "call-1", "codec": "PCMA"})
+	r.Set(aToB, flow)
+	r.Set(bToA, flow)
+	d := NewDetector(r, 10*time.Second)
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	flow.Observe(aToB, 172, base.Add(-time.Minute))
+	for i := range 3 {
+		flow.Observe(bToA, 172, base.Add(time.Duration(i)*time.Second))
+	}
+	r.Touch(aToB, base.Add(-time.Minute))
+	r.Touch(bToA, base.Add(2*time.Second))
+
+	// B→A stops: its packets first, A→B's as the reverse.
+	gaps := d.Check(base.Add(20 * time.Second))
+	if len(gaps) != 2 {
+		t.Fatalf("gaps = %+v, want both directions", gaps)
+	}
+	for _, g := range gaps {
+		want := [2]uint64{1, 3}
+		if g.SrcPort == bToA.SrcPort {
+			want = [2]uint64{3, 1}
+		}
+		if g.Packets != want[0] || g.ReversePackets != want[1] || !g.FirstSeen.Equal(base.Add(-time.Minute)) {
+			t.Errorf("gap %d→%d = %+v, want packets %v", g.SrcPort, g.DstPort, g, want)
+		}
+	}
+}
+
+func TestDetector_EndedCallsAndRTCP(t *testing.T) {
+	r := newFakeRegistry()
+	registerCall(r, "call-1")
+	rtcp := plugin.FlowKey{SrcIP: aToB.SrcIP, DstIP: aToB.DstIP, SrcPort: 10001, DstPort: 20001, Proto: 17}
+	r.Set(rtcp, map[string]string{"call_id": "call-1", "codec": "RTCP"})
+	d := NewDetector(r, 10*time.Second)
+	base := time.Now()
+
+	r.Touch(rtcp, base)
+	r.Touch(aToB, base)
+	r.Touch(bToA, base)
+	// BYE removes the flows before the timeout.
+	r.Delete(aToB)
+	r.Delete(bToA)
+	if gaps := d.Check(base.Add(time.Minute)); len(gaps) != 0 {
+		t.Errorf("gaps = %v, want none for ended calls and RTCP", gaps)
+	}
+}
+
+func TestNewDetector_NoActivity(t *testing.T) {
+	if d := NewDetector(plainRegistry{newFakeRegistry()}, time.Second); d != nil {
+		t.Error("NewDetector returned a detector for a registry without activity")
+	}
+}
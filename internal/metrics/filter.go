@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// taskLabel is the label carrying the task ID on per-task series.
+const taskLabel = "task"
+
+// FilterRule drops metrics of matching tasks from scrapes. Tasks and Metrics
+// are path.Match patterns, e.g. "debug-*" and "otus_parser_*".
+type FilterRule struct {
+	Tasks   []string
+	Metrics []string
+}
+
+// Filter trims scrapes of agents with many tasks: per-task opt-outs drop the
+// high-cardinality series of some tasks, and label allowlists sum the series
+// of a metric over the labels that are not kept.
+type Filter struct {
+	rules []FilterRule
+	allow map[string][]string // metric name → labels kept, sorted
+}
+
+// NewFilter creates a filter. allow maps metric names to the labels kept.
+func NewFilter(rules []FilterRule, allow map[string][]string) *Filter {
+	f := &Filter{rules: rules, allow: make(map[string][]string, len(allow))}
+	for name, labels := range allow {
+		f.allow[name] = slices.Sorted(slices.Values(labels))
+	}
+	return f
+}
+
+// Apply filters gathered metric families. With tasks set, only series of
+// those tasks are kept. A nil filter only scopes to tasks.
+func (f *Filter) Apply(families []*dto.MetricFamily, tasks []string) []*dto.MetricFamily {
+	out := families[:0]
+	for _, mf := range families {
+		name := mf.GetName()
+		kept := mf.Metric[:0]
+		for _, m := range mf.Metric {
+			task, ok := labelValue(m, taskLabel)
+			if len(tasks) > 0 && (!ok || !slices.Contains(tasks, task)) {
+				continue
+			}
+			if ok && f.optedOut(task, name) {
+				continue
+			}
+			kept = append(kept, m)
+		}
+		if f != nil {
+			if labels, ok := f.allow[name]; ok {
+				kept = aggregate(mf.GetType(), kept, labels)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		mf.Metric = kept
+		out = append(out, mf)
+	}
+	return out
+}
+
+// optedOut reports whether a rule drops metric name for task.
+func (f *Filter) optedOut(task, name string) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.rules {
+		if matchAny(r.Tasks, task) && matchAny(r.Metrics, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func labelValue(m *dto.Metric, name string) (string, bool) {
+	for _, lp := range m.GetLabel() {
+		if lp.GetName() == name {
+			return lp.GetValue(), true
+		}
+	}
+	return "", false
+}
+
+// aggregate sums series that agree on the kept labels. Summary quantiles
+// cannot be summed and are dropped; counts and sums are kept.
+func aggregate(typ dto.MetricType, metrics []*dto.Metric, keep []string) []*dto.Metric {
+	groups := make(map[string]*dto.Metric)
+	var out []*dto.Metric
+	for _, m := range metrics {
+		var labels []*dto.LabelPair
+		var key strings.Builder
+		for _, lp := range m.GetLabel() {
+			if _, found := slices.BinarySearch(keep, lp.GetName()); found {
+				labels = append(labels, lp)
+				key.WriteString(lp.GetName())
+				key.WriteByte(0)
+				key.WriteString(lp.GetValue())
+				key.WriteByte(0)
+			}
+		}
+		acc, ok := groups[key.String()]
+		if !ok {
+			m.Label = labels
+			m.TimestampMs = nil
+			if m.Summary != nil {
+				m.Summary.Quantile = nil
+			}
+			groups[key.String()] = m
+			out = append(out, m)
+			continue
+		}
+		merge(typ, acc, m)
+	}
+	return out
+}
+
+// merge adds the values of m to acc.
+func merge(typ dto.MetricType, acc, m *dto.Metric) {
+	switch typ {
+	case dto.MetricType_COUNTER:
+		acc.Counter.Value = ptr(acc.Counter.GetValue() + m.Counter.GetValue())
+	case dto.MetricType_GAUGE:
+		acc.Gauge.Value = ptr(acc.Gauge.GetValue() + m.Gauge.GetValue())
+	case dto.MetricType_UNTYPED:
+		acc.Untyped.Value = ptr(acc.Untyped.GetValue() + m.Untyped.GetValue())
+	case dto.MetricType_SUMMARY:
+		acc.Summary.SampleCount = ptr(acc.Summary.GetSampleCount() + m.Summary.GetSampleCount())
+		acc.Summary.SampleSum = ptr(acc.Summary.GetSampleSum() + m.Summary.GetSampleSum())
+	case dto.MetricType_HISTOGRAM:
+		h, o := acc.Histogram, m.Histogram
+		h.SampleCount = ptr(h.GetSampleCount() + o.GetSampleCount())
+		h.SampleSum = ptr(h.GetSampleSum() + o.GetSampleSum())
+		// Series of one histogram share their bucket bounds
+		for i, b := range h.Bucket {
+			if i < len(o.Bucket) {
+				b.CumulativeCount = ptr(b.GetCumulativeCount() + o.Bucket[i].GetCumulativeCount())
+			}
+		}
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gatherTest registers per-task series on a fresh registry and gathers them.
+func gatherTest(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	packets := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_packets_total"}, []string{"task", "pipeline"})
+	latency := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "test_latency_seconds", Buckets: []float64{0.1, 1}}, []string{"task", "pipeline"})
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_up"})
+	reg.MustRegister(packets, latency, up)
+
+	packets.WithLabelValues("sip-a", "0").Add(3)
+	packets.WithLabelValues("sip-a", "1").Add(4)
+	packets.WithLabelValues("bulk-1", "0").Add(10)
+	latency.WithLabelValues("sip-a", "0").Observe(0.05)
+	latency.WithLabelValues("sip-a", "1").Observe(0.5)
+	latency.WithLabelValues("bulk-1", "0").Observe(0.05)
+	up.Set(1)
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	return mfs
+}
+
+func family(mfs []*dto.MetricFamily, name string) *dto.MetricFamily {
+	for _, mf := range mfs {
+		if mf.GetName() == name {
+			return mf
+		}
+	}
+	return nil
+}
+
+func TestFilter_TaskScope(t *testing.T) {
+	var f *Filter
+	mfs := f.Apply(gatherTest(t), []string{"bulk-1"})
+
+	if family(mfs, "test_up") != nil {
+		t.Error("series without a task label kept in a task-scoped scrape")
+	}
+	packets := family(mfs, "test_packets_total")
+	if packets == nil || len(packets.Metric) != 1 {
+		t.Fatalf("test_packets_total = %v, want the bulk-1 series only", packets)
+	}
+	if v, _ := labelValue(packets.Metric[0], "task"); v != "bulk-1" {
+		t.Errorf("task = %q, want bulk-1", v)
+	}
+}
+
+func TestFilter_TaskOptOut(t *testing.T) {
+	f := NewFilter([]FilterRule{{Tasks: []string{"bulk-*"}, Metrics: []string{"test_latency_*"}}}, nil)
+	mfs := f.Apply(gatherTest(t), nil)
+
+	if got := len(family(mfs, "test_packets_total").Metric); got != 3 {
+		t.Errorf("test_packets_total series = %d, want 3", got)
+	}
+	for _, m := range family(mfs, "test_latency_seconds").Metric {
+		if v, _ := labelValue(m, "task"); v == "bulk-1" {
+			t.Error("opted-out bulk-1 latency series kept")
+		}
+	}
+	if family(mfs, "test_up") == nil {
+		t.Error("test_up dropped")
+	}
+}
+
+func TestFilter_LabelAllowlist(t *testing.T) {
+	f := NewFilter(nil, map[string][]string{
+		"test_packets_total":   {"task"},
+		"test_latency_seconds": {"task"},
+	})
+	mfs := f.Apply(gatherTest(t), nil)
+
+	sums := map[string]float64{}
+	for _, m := range family(mfs, "test_packets_total").Metric {
+		if len(m.Label) != 1 {
+			t.Fatalf("labels = %v, want task only", m.Label)
+		}
+		sums[m.Label[0].GetValue()] = m.Counter.GetValue()
+	}
+	if sums["sip-a"] != 7 || sums["bulk-1"] != 10 {
+		t.Errorf("summed counters = %v, want sip-a 7, bulk-1 10", sums)
+	}
+
+	for _, m := range family(mfs, "test_latency_seconds").Metric {
+		if v, _ := labelValue(m, "task"); v != "sip-a" {
+			continue
+		}
+		h := m.Histogram
+		if h.GetSampleCount() != 2 {
+			t.Errorf("sample count = %d, want 2", h.GetSampleCount())
+		}
+		if got := h.Bucket[0].GetCumulativeCount(); got != 1 {
+			t.Errorf("le=0.1 bucket = %d, want 1", got)
+		}
+		if got := h.Bucket[1].GetCumulativeCount(); got != 2 {
+			t.Errorf("le=1 bucket = %d, want 2", got)
+		}
+	}
+}
+
+func TestServer_TaskIDQuery(t *testing.T) {
+	PipelinePacketsTotal.WithLabelValues("scrape-a", "0", "test").Inc()
+	PipelinePacketsTotal.WithLabelValues("scrape-b", "0", "test").Inc()
+
+	s := NewServer("", "")
+	rec := httptest.NewRecorder()
+	s.serveMetrics(rec, httptest.NewRequest("GET", "/metrics?task_id=scrape-a", nil))
+	body, _ := io.ReadAll(rec.Result().Body)
+
+	if !strings.Contains(string(body), `task="scrape-a"`) {
+		t.Error("scrape-a series missing")
+	}
+	if strings.Contains(string(body), `task="scrape-b"`) {
+		t.Error("scrape-b series served to a scrape-a scrape")
+	}
+	if strings.Contains(string(body), "go_goroutines") {
+		t.Error("agent-wide series served to a task-scoped scrape")
+	}
+}
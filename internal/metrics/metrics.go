@@ -34,6 +34,88 @@ var (
 		[]string{"task", "pipeline", "stage"},
 	)
 
+	// ParserPacketsTotal counts per-parser outcomes: CanHandle hit/miss and
+	// Handle success/error/ignored
+	ParserPacketsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_parser_packets_total",
+			Help: "Total number of packets offered to each parser by result (hit, miss, success, error, ignored)",
+		},
+		[]string{"task", "parser", "result"},
+	)
+
+	// ParserErrorsTotal counts parser Handle errors by reason
+	ParserErrorsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_parser_errors_total",
+			Help: "Total number of parser errors by reason (too_short, bad_version, parse_error, panic)",
+		},
+		[]string{"task", "parser", "reason"},
+	)
+
+	// ParserTruncatedTotal counts payloads cut to a hardened parser's max_payload
+	ParserTruncatedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_parser_truncated_total",
+			Help: "Total number of payloads truncated before a hardened parser",
+		},
+		[]string{"task", "parser"},
+	)
+
+	// ParserShadowPacketsTotal counts shadow parser comparisons by result
+	ParserShadowPacketsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_parser_shadow_packets_total",
+			Help: "Total number of packets compared between a parser and its shadow by result (match, diverged, primary_only, shadow_only)",
+		},
+		[]string{"task", "parser", "shadow", "result"},
+	)
+
+	// ParserShadowLabelDiffsTotal counts diverged packets by differing label
+	ParserShadowLabelDiffsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_parser_shadow_label_diffs_total",
+			Help: "Total number of diverged packets by label that differs between a parser and its shadow",
+		},
+		[]string{"task", "parser", "shadow", "label"},
+	)
+
+	// TopKPackets exposes the heavy hitters of tasks with top_k configured
+	TopKPackets = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_topk_packets",
+			Help: "Estimated packets of the current heavy hitters per task and key",
+		},
+		[]string{"task", "key", "value"},
+	)
+
+	// TaskCPUSecondsTotal approximates pipeline CPU time by the time spent processing
+	TaskCPUSecondsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_task_cpu_seconds_total",
+			Help: "Approximate CPU seconds spent by task pipelines (processing time)",
+		},
+		[]string{"task", "pipeline"},
+	)
+
+	// TaskAllocBytesTotal estimates heap allocations of a task by its share of pipeline time
+	TaskAllocBytesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_task_alloc_bytes_total",
+			Help: "Estimated bytes allocated on behalf of a task",
+		},
+		[]string{"task"},
+	)
+
+	// TaskChannelBytes tracks the memory of a task's packet channel buffers
+	TaskChannelBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_task_channel_bytes",
+			Help: "Bytes of packet channel buffers allocated for a task",
+		},
+		[]string{"task"},
+	)
+
 	// PipelineLatencySeconds measures pipeline stage latency
 	PipelineLatencySeconds = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -61,6 +143,32 @@ var (
 		},
 	)
 
+	// ReassemblyRateLimitedFragments counts fragments dropped by the per-source rate limit
+	ReassemblyRateLimitedFragments = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "otus_reassembly_rate_limited_fragments_total",
+			Help: "IP fragments dropped by the per-source-IP fragment rate limit",
+		},
+	)
+
+	// ReassemblyRateLimitedSources counts windows in which a source hit the fragment rate limit
+	ReassemblyRateLimitedSources = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "otus_reassembly_rate_limited_sources_total",
+			Help: "Rate limit windows in which a source IP exceeded the fragment rate limit",
+		},
+	)
+
+	// DecoderFallbackTotal counts frames decoded by the gopacket fallback
+	// instead of the fast path, updated each metrics collection interval
+	DecoderFallbackTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_decoder_fallback_total",
+			Help: "Frames decoded by the gopacket fallback decoder",
+		},
+		[]string{"task"},
+	)
+
 	// ReporterBatchSize tracks Kafka batch size distribution (for ReporterWrapper)
 	ReporterBatchSize = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -71,6 +179,52 @@ var (
 		[]string{"task", "reporter"},
 	)
 
+	// ReporterFlushesTotal counts ReporterWrapper batch flushes by trigger
+	// (size: batch full, timeout: batch timeout elapsed, close: task stopping)
+	ReporterFlushesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_flushes_total",
+			Help: "Total number of reporter batch flushes by reason",
+		},
+		[]string{"task", "reporter", "reason"},
+	)
+
+	// ReporterBatchTarget tracks the current batch size target of adaptive batching
+	ReporterBatchTarget = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_reporter_batch_target",
+			Help: "Current batch size a reporter flushes at (adaptive batching)",
+		},
+		[]string{"task", "reporter"},
+	)
+
+	// FeatureFlagEnabled tracks the runtime feature flags of each task (1 = on)
+	FeatureFlagEnabled = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_feature_flag_enabled",
+			Help: "Whether a task feature flag is on (1) or off (0)",
+		},
+		[]string{"task", "flag"},
+	)
+
+	// ReporterRetriesTotal counts retried ReportBatch/Report calls (path: batch, report)
+	ReporterRetriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_retries_total",
+			Help: "Total number of reporter call retries",
+		},
+		[]string{"task", "reporter", "path"},
+	)
+
+	// ReporterRetriesExhaustedTotal counts calls that still failed after all retry attempts
+	ReporterRetriesExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_retries_exhausted_total",
+			Help: "Total number of reporter calls that failed after all retry attempts",
+		},
+		[]string{"task", "reporter", "path"},
+	)
+
 	// ReporterErrorsTotal counts reporter errors by name and error type
 	ReporterErrorsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -80,6 +234,75 @@ var (
 		[]string{"task", "reporter", "error_type"},
 	)
 
+	// ReporterShadowBatchesTotal counts batches of a reporter warming up in
+	// shadow mode during a reporter swap (result: ok, error)
+	ReporterShadowBatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_shadow_batches_total",
+			Help: "Total number of batches sent by shadow reporters during a reporter swap",
+		},
+		[]string{"task", "reporter", "result"},
+	)
+
+	// ReporterSwapsTotal counts finished reporter swaps (result: switched, aborted)
+	ReporterSwapsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_swaps_total",
+			Help: "Total number of finished reporter swaps by result",
+		},
+		[]string{"task", "result"},
+	)
+
+	// ReporterFailoverTier tracks the tier of a reporter failover group that
+	// carries traffic (0 = first by priority)
+	ReporterFailoverTier = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_reporter_failover_tier",
+			Help: "Tier of a reporter failover group that carries traffic",
+		},
+		[]string{"task", "group"},
+	)
+
+	// ReporterFailoversTotal counts tier changes of reporter failover groups
+	// (direction: failover, failback)
+	ReporterFailoversTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_reporter_failovers_total",
+			Help: "Total number of reporter failover group tier changes by direction",
+		},
+		[]string{"task", "group", "direction"},
+	)
+
+	// HEPThrottledFramesTotal counts HEP frames over a server's rate limit,
+	// handed to the reporter's fallback instead of being sent
+	HEPThrottledFramesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_hep_throttled_frames_total",
+			Help: "Total number of HEP frames not sent because the server's rate limit was exceeded",
+		},
+		[]string{"task", "server"},
+	)
+
+	// HEPDeduplicatedFramesTotal counts copies of SIP messages the HEP
+	// reporter did not send because the message was sent within its dedup window
+	HEPDeduplicatedFramesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_hep_deduplicated_frames_total",
+			Help: "Total number of HEP frames not sent because the same SIP message was sent within the dedup window",
+		},
+		[]string{"task"},
+	)
+
+	// LabelValuesSuppressedTotal counts label values hashed or dropped by the
+	// cardinality guard processor
+	LabelValuesSuppressedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_label_values_suppressed_total",
+			Help: "Total number of label values hashed or dropped because the label exceeded its distinct-value limit",
+		},
+		[]string{"task", "label", "action"},
+	)
+
 	// FlowRegistrySize tracks the current number of flows in a task's FlowRegistry
 	FlowRegistrySize = promauto.NewGaugeVec(
 		prometheus.GaugeOpts{
@@ -88,6 +311,151 @@ var (
 		},
 		[]string{"task"},
 	)
+
+	// RTCPRoundTripSeconds observes round-trip times computed from RTCP report blocks
+	RTCPRoundTripSeconds = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "otus_rtcp_rtt_seconds",
+			Help:    "Media round-trip time from RTCP SR/RR LSR and DLSR in seconds",
+			Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 1, 2},
+		},
+	)
+
+	// RTPStreamEventsTotal counts SSRC and payload-type changes on RTP flows of known calls
+	RTPStreamEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_rtp_stream_events_total",
+			Help: "Total number of RTP stream events (ssrc_change, ssrc_conflict, pt_change)",
+		},
+		[]string{"task", "event"},
+	)
+
+	// SIPMessagesTotal counts SIP messages by sending peer (denominator for retransmission rate)
+	SIPMessagesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_sip_messages_total",
+			Help: "Total number of SIP messages by sending peer",
+		},
+		[]string{"peer"},
+	)
+
+	// SIPRetransmissionsTotal counts SIP transaction retransmissions by sending peer
+	SIPRetransmissionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_sip_retransmissions_total",
+			Help: "Total number of SIP retransmissions by sending peer",
+		},
+		[]string{"peer"},
+	)
+
+	// SIPParseWarningsTotal counts malformed SIP messages by parse warning
+	SIPParseWarningsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_sip_parse_warnings_total",
+			Help: "Total number of SIP parse warnings by kind",
+		},
+		[]string{"warning"},
+	)
+
+	// AlertsFiring tracks in-agent alert rules currently firing (1) or resolved (0)
+	AlertsFiring = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_alerts_firing",
+			Help: "In-agent alert rules currently firing (1=firing, 0=resolved)",
+		},
+		[]string{"task", "rule", "severity"},
+	)
+
+	// AuditDegraded tracks components the self-audit found degraded (1) or recovered (0)
+	AuditDegraded = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "otus_audit_degraded",
+			Help: "Components the periodic self-audit found degraded (1=degraded, 0=recovered); task is empty for agent-wide components",
+		},
+		[]string{"task", "kind", "component"},
+	)
+
+	// SendDropsTotal counts packets pipelines dropped at the task's send buffer, by drop-policy priority
+	SendDropsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_send_drops_total",
+			Help: "Total number of packets dropped at the send buffer by priority (high, normal, low)",
+		},
+		[]string{"task", "pipeline", "priority"},
+	)
+
+	// TCPSegmentsTotal counts retransmitted and out-of-order TCP segments of tasks with tcp_analysis
+	TCPSegmentsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_tcp_segments_total",
+			Help: "Total number of TCP segment events (retransmission, out_of_order)",
+		},
+		[]string{"task", "event"},
+	)
+
+	// TLSRecordsTotal counts TLS application data records of tasks with tls_decryption, by outcome
+	TLSRecordsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_tls_records_total",
+			Help: "Total number of TLS application data records by decryption result (decrypted, no_key, failed, unsupported)",
+		},
+		[]string{"task", "result"},
+	)
+
+	// RTCPReportsCorrelatedTotal counts RTCP report blocks of tasks with rtcp_correlation, by whether the RTP stream was found
+	RTCPReportsCorrelatedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_rtcp_reports_correlated_total",
+			Help: "Total number of RTCP reports looked up in the task's RTP stream table (matched, unmatched)",
+		},
+		[]string{"task", "result"},
+	)
+
+	// TCPHandshakeRTTSeconds observes SYN to SYN-ACK times of tasks with tcp_analysis
+	TCPHandshakeRTTSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "otus_tcp_handshake_rtt_seconds",
+			Help:    "TCP handshake round-trip time from SYN to SYN-ACK",
+			Buckets: []float64{.001, .005, .01, .02, .05, .1, .2, .5, 1},
+		},
+		[]string{"task"},
+	)
+
+	// MediaGapsTotal counts RTP streams that stopped while their call was up
+	MediaGapsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_media_gaps_total",
+			Help: "Total number of RTP streams that stopped while their call was active",
+		},
+		[]string{"task", "one_way"},
+	)
+
+	// QualityAlertsTotal counts call quality alerts by exceeded measurement
+	QualityAlertsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_quality_alerts_total",
+			Help: "Total number of call quality alerts by measurement past its threshold",
+		},
+		[]string{"task", "metric"},
+	)
+
+	// CommandDuplicatesTotal counts re-delivered commands answered from the dedupe store
+	CommandDuplicatesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_command_duplicates_total",
+			Help: "Total number of duplicate commands answered with the original response",
+		},
+		[]string{"method"},
+	)
+
+	// CommandSignatureFailuresTotal counts command messages dropped by signature verification
+	CommandSignatureFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "otus_command_signature_failures_total",
+			Help: "Total number of command messages rejected for a missing or invalid signature",
+		},
+		[]string{"reason"},
+	)
 )
 
 // TaskStatusValue represents task status as a numeric value for Prometheus gauge
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // Server is the HTTP server for Prometheus metrics.
@@ -16,6 +19,7 @@ type Server struct {
 	addr   string
 	path   string
 	server *http.Server
+	filter atomic.Pointer[Filter]
 }
 
 // NewServer creates a new metrics server.
@@ -32,7 +36,7 @@ func NewServer(addr, path string) *Server {
 // Start starts the metrics HTTP server.
 func (s *Server) Start(ctx context.Context) error {
 	mux := http.NewServeMux()
-	mux.Handle(s.path, promhttp.Handler())
+	mux.HandleFunc(s.path, s.serveMetrics)
 
 	s.server = &http.Server{
 		Addr:         s.addr,
@@ -53,6 +57,28 @@ func (s *Server) Start(ctx context.Context) error {
 	return nil
 }
 
+// SetFilter replaces the filter applied to scrapes; nil disables filtering.
+// It is safe to call while the server runs.
+func (s *Server) SetFilter(f *Filter) {
+	s.filter.Store(f)
+}
+
+// serveMetrics serves the default registry through the filter. Repeated
+// ?task_id= parameters scope the scrape to those tasks' series.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	filter := s.filter.Load()
+	tasks := r.URL.Query()["task_id"]
+	if filter == nil && len(tasks) == 0 {
+		promhttp.Handler().ServeHTTP(w, r)
+		return
+	}
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		return filter.Apply(mfs, tasks), err
+	})
+	promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
 // Stop gracefully stops the metrics server.
 func (s *Server) Stop(ctx context.Context) error {
 	if s.server == nil {
@@ -0,0 +1,205 @@
+// Package nicadvisor checks that a capture interface's receive side matches
+// the task's workers.
+//
+// A task with many workers still runs on one CPU when the NIC delivers all
+// packets on a single RX queue, or when every queue interrupt is pinned to
+// the same CPU; nothing fails, the capture just silently drops under load.
+// The advisor reads the RX queues, RPS masks and IRQ affinity from sysfs and
+// procfs and turns mismatches into recommendations.
+package nicadvisor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Recommendation codes.
+const (
+	CodeNoFanout      = "no_fanout"            // binding workers without fanout receive every packet
+	CodeSingleRxQueue = "single_rx_queue"      // one RX queue and no RPS
+	CodeFewerWorkers  = "workers_below_queues" // binding workers leave RX queues unused
+	CodeMoreWorkers   = "workers_above_cpus"   // more pipelines than CPUs
+	CodeIRQSingleCPU  = "irq_single_cpu"       // all queue IRQs on one CPU
+)
+
+// Recommendation is one finding about a capture interface.
+type Recommendation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// IRQ is one interrupt of an interface and the CPUs it may run on.
+type IRQ struct {
+	Number int    `json:"number"`
+	CPUs   string `json:"cpus"` // smp_affinity_list, e.g. "0-3"
+}
+
+// Interface is the receive side of a network interface.
+type Interface struct {
+	Name     string `json:"name"`
+	Virtual  bool   `json:"virtual"` // no backing device: no RSS, no IRQs
+	RxQueues int    `json:"rx_queues"`
+	RPS      bool   `json:"rps"` // some RX queue has a non-empty rps_cpus mask
+	IRQs     []IRQ  `json:"irqs,omitempty"`
+}
+
+// Setup is the part of a task's configuration the advice depends on.
+type Setup struct {
+	Workers      int
+	DispatchMode string // "binding" or "dispatch"
+	FanoutType   string // afpacket fanout_type; "" = no fanout
+	NumCPU       int
+}
+
+// Inspector reads interfaces from a sysfs and procfs root.
+type Inspector struct {
+	SysRoot  string // default "/sys"
+	ProcRoot string // default "/proc"
+}
+
+// Inspect reads the RX queues, RPS masks and queue IRQs of an interface.
+func (in Inspector) Inspect(name string) (Interface, error) {
+	sys, proc := in.SysRoot, in.ProcRoot
+	if sys == "" {
+		sys = "/sys"
+	}
+	if proc == "" {
+		proc = "/proc"
+	}
+	dir := filepath.Join(sys, "class", "net", name)
+	if _, err := os.Stat(dir); err != nil {
+		return Interface{}, fmt.Errorf("interface %q: %w", name, err)
+	}
+
+	nic := Interface{Name: name}
+	if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+		nic.Virtual = true
+	}
+
+	queues, _ := filepath.Glob(filepath.Join(dir, "queues", "rx-*"))
+	nic.RxQueues = len(queues)
+	for _, q := range queues {
+		if mask, err := os.ReadFile(filepath.Join(q, "rps_cpus")); err == nil && !emptyMask(string(mask)) {
+			nic.RPS = true
+			break
+		}
+	}
+
+	numbers := interfaceIRQs(filepath.Join(proc, "interrupts"), name)
+	if len(numbers) == 0 {
+		numbers = deviceIRQs(filepath.Join(dir, "device", "msi_irqs"))
+	}
+	for _, n := range numbers {
+		cpus, err := os.ReadFile(filepath.Join(proc, "irq", strconv.Itoa(n), "smp_affinity_list"))
+		if err != nil {
+			continue
+		}
+		nic.IRQs = append(nic.IRQs, IRQ{Number: n, CPUs: strings.TrimSpace(string(cpus))})
+	}
+	return nic, nil
+}
+
+// Advise compares an interface with a task setup.
+func Advise(nic Interface, s Setup) []Recommendation {
+	var recs []Recommendation
+	add := func(code, format string, args ...any) {
+		recs = append(recs, Recommendation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	binding := s.DispatchMode != "dispatch"
+
+	if binding && s.Workers > 1 && s.FanoutType == "" {
+		add(CodeNoFanout, "%d binding workers share %s without fanout: each receives every packet; set fanout_type: hash", s.Workers, nic.Name)
+	}
+	if s.NumCPU > 0 && s.Workers > s.NumCPU {
+		add(CodeMoreWorkers, "%d workers on %d CPUs: pipelines compete for CPU; set workers to at most %d", s.Workers, s.NumCPU, s.NumCPU)
+	}
+	if nic.Virtual {
+		return recs
+	}
+
+	if nic.RxQueues == 1 && !nic.RPS && s.Workers > 1 {
+		add(CodeSingleRxQueue, "%s has a single RX queue and no RPS: all packets are received on one CPU; enable more queues (ethtool -L %s combined N) or RPS (queues/rx-0/rps_cpus)", nic.Name, nic.Name)
+	}
+	if binding && nic.RxQueues > s.Workers && (s.NumCPU == 0 || s.Workers < s.NumCPU) {
+		want := nic.RxQueues
+		if s.NumCPU > 0 && want > s.NumCPU {
+			want = s.NumCPU
+		}
+		add(CodeFewerWorkers, "%s has %d RX queues but the task has %d workers; set workers to %d", nic.Name, nic.RxQueues, s.Workers, want)
+	}
+	if len(nic.IRQs) > 1 {
+		cpus := nic.IRQs[0].CPUs
+		same := isSingleCPU(cpus)
+		for _, irq := range nic.IRQs[1:] {
+			if irq.CPUs != cpus {
+				same = false
+				break
+			}
+		}
+		if same {
+			add(CodeIRQSingleCPU, "all %d IRQs of %s are pinned to CPU %s; spread them across CPUs (irqbalance or /proc/irq/N/smp_affinity_list)", len(nic.IRQs), nic.Name, cpus)
+		}
+	}
+	return recs
+}
+
+// interfaceIRQs returns the IRQs of /proc/interrupts named after the
+// interface ("eth0", "eth0-TxRx-0", "eth0-rx-1", ...).
+func interfaceIRQs(path, name string) []int {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var irqs []int
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(fields[0], ":"))
+		if err != nil {
+			continue // header or named interrupts (NMI, LOC, ...)
+		}
+		dev := fields[len(fields)-1]
+		if dev == name || strings.HasPrefix(dev, name+"-") {
+			irqs = append(irqs, n)
+		}
+	}
+	return irqs
+}
+
+// deviceIRQs returns the MSI interrupts of the interface's PCI device, for
+// drivers that do not name their IRQs after the interface.
+func deviceIRQs(dir string) []int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var irqs []int
+	for _, e := range entries {
+		if n, err := strconv.Atoi(e.Name()); err == nil {
+			irqs = append(irqs, n)
+		}
+	}
+	sort.Ints(irqs)
+	return irqs
+}
+
+// emptyMask reports whether a hex CPU mask ("00000000,0000000f") is all zero.
+func emptyMask(mask string) bool {
+	return strings.Trim(strings.TrimSpace(mask), "0,") == ""
+}
+
+// isSingleCPU reports whether an affinity list names exactly one CPU.
+func isSingleCPU(list string) bool {
+	_, err := strconv.Atoi(list)
+	return err == nil
+}
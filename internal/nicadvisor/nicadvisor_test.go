@@ -0,0 +1,124 @@
+package nicadvisor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates files under root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func codes(recs []Recommendation) map[string]bool {
+	m := make(map[string]bool, len(recs))
+	for _, r := range recs {
+		m[r.Code] = true
+	}
+	return m
+}
+
+func TestInspect(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"sys/class/net/eth0/device/vendor":         "0x8086\n",
+		"sys/class/net/eth0/queues/rx-0/rps_cpus":  "00000000,00000000\n",
+		"sys/class/net/eth0/queues/rx-1/rps_cpus":  "00000000,00000000\n",
+		"sys/class/net/veth0/queues/rx-0/rps_cpus": "0000000f\n",
+		"sys/class/net/eth1/device/msi_irqs/60":    "msix\n",
+		"sys/class/net/eth1/device/msi_irqs/61":    "msix\n",
+		"sys/class/net/eth1/queues/rx-0/rps_cpus":  "0\n",
+		"proc/irq/40/smp_affinity_list":            "0\n",
+		"proc/irq/41/smp_affinity_list":            "0\n",
+		"proc/irq/60/smp_affinity_list":            "0-3\n",
+		"proc/irq/61/smp_affinity_list":            "2\n",
+		"proc/interrupts": "           CPU0       CPU1\n" +
+			"  40:       100          0  IR-PCI-MSI 1048576-edge      eth0-TxRx-0\n" +
+			"  41:        50          0  IR-PCI-MSI 1048577-edge      eth0-TxRx-1\n" +
+			"  42:         1          0  IR-PCI-MSI 1048578-edge      eth00\n" +
+			" NMI:         0          0   Non-maskable interrupts\n",
+	})
+	in := Inspector{SysRoot: filepath.Join(root, "sys"), ProcRoot: filepath.Join(root, "proc")}
+
+	eth0, err := in.Inspect("eth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eth0.Virtual || eth0.RxQueues != 2 || eth0.RPS || len(eth0.IRQs) != 2 || eth0.IRQs[1] != (IRQ{41, "0"}) {
+		t.Errorf("eth0 = %+v", eth0)
+	}
+
+	// IRQs not named after the interface come from the device's MSI list.
+	eth1, err := in.Inspect("eth1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eth1.RxQueues != 1 || len(eth1.IRQs) != 2 || eth1.IRQs[0] != (IRQ{60, "0-3"}) {
+		t.Errorf("eth1 = %+v", eth1)
+	}
+
+	veth, err := in.Inspect("veth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !veth.Virtual || !veth.RPS || len(veth.IRQs) != 0 {
+		t.Errorf("veth0 = %+v", veth)
+	}
+
+	if _, err := in.Inspect("eth9"); err == nil {
+		t.Error("Inspect of a missing interface succeeded")
+	}
+}
+
+func TestAdvise(t *testing.T) {
+	singleQueue := Interface{Name: "eth0", RxQueues: 1, IRQs: []IRQ{{40, "0"}}}
+	manyQueues := Interface{Name: "eth0", RxQueues: 8, IRQs: []IRQ{{40, "0"}, {41, "0"}, {42, "0"}}}
+	spread := Interface{Name: "eth0", RxQueues: 4, IRQs: []IRQ{{40, "0"}, {41, "1"}, {42, "2"}, {43, "3"}}}
+
+	tests := []struct {
+		name  string
+		nic   Interface
+		setup Setup
+		want  []string
+	}{
+		{"balanced", spread, Setup{Workers: 4, FanoutType: "hash", NumCPU: 8}, nil},
+		{"single queue", singleQueue, Setup{Workers: 4, FanoutType: "hash", NumCPU: 8}, []string{CodeSingleRxQueue}},
+		{"single queue with RPS", Interface{Name: "eth0", RxQueues: 1, RPS: true}, Setup{Workers: 4, FanoutType: "hash", NumCPU: 8}, nil},
+		{"single queue single worker", singleQueue, Setup{Workers: 1, FanoutType: "hash", NumCPU: 8}, nil},
+		{"no fanout", spread, Setup{Workers: 4, NumCPU: 8}, []string{CodeNoFanout}},
+		{"no fanout in dispatch mode", spread, Setup{Workers: 4, DispatchMode: "dispatch", NumCPU: 8}, nil},
+		{"unused queues and pinned IRQs", manyQueues, Setup{Workers: 2, FanoutType: "hash", NumCPU: 4}, []string{CodeFewerWorkers, CodeIRQSingleCPU}},
+		{"too many workers", spread, Setup{Workers: 16, FanoutType: "hash", NumCPU: 8}, []string{CodeMoreWorkers}},
+		{"virtual interface", Interface{Name: "veth0", Virtual: true, RxQueues: 1}, Setup{Workers: 4, FanoutType: "hash", NumCPU: 8}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recs := Advise(tt.nic, tt.setup)
+			got := codes(recs)
+			if len(recs) != len(tt.want) {
+				t.Fatalf("Advise() = %+v, want codes %v", recs, tt.want)
+			}
+			for _, c := range tt.want {
+				if !got[c] {
+					t.Errorf("Advise() = %+v, missing %s", recs, c)
+				}
+			}
+		})
+	}
+
+	// The recommended worker count is capped at the CPU count.
+	recs := Advise(manyQueues, Setup{Workers: 2, FanoutType: "hash", NumCPU: 4})
+	if recs[0].Message != "eth0 has 8 RX queues but the task has 2 workers; set workers to 4" {
+		t.Errorf("message = %q", recs[0].Message)
+	}
+}
@@ -0,0 +1,308 @@
+// Package objstore is a minimal client for S3-compatible object storage
+// (AWS S3, MinIO, Ceph RGW, ...): get, conditional put, delete and list of
+// small objects, with requests signed by AWS Signature Version 4.
+package objstore
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each request when Config.Timeout is unset.
+const DefaultTimeout = 10 * time.Second
+
+// maxObjectSize bounds the objects Get reads.
+const maxObjectSize = 16 << 20
+
+var (
+	// ErrNotFound is returned for a missing object.
+	ErrNotFound = errors.New("object not found")
+	// ErrPreconditionFailed is returned by Put when the object changed
+	// since the ETag the caller passed, or exists when it should not.
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Config locates a bucket and the credentials to access it.
+type Config struct {
+	Endpoint        string // e.g. "https://s3.eu-west-1.amazonaws.com", "http://minio:9000"
+	Region          string // signing region, e.g. "us-east-1"
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string        // temporary credentials only
+	PathStyle       bool          // endpoint/bucket/key instead of bucket.endpoint/key
+	Timeout         time.Duration // per request (default 10s)
+	TLS             *tls.Config   // for https endpoints; nil = Go defaults
+}
+
+// Client accesses one bucket. It is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	base *url.URL // bucket URL, without trailing slash
+	http *http.Client
+	now  func() time.Time
+}
+
+// New creates a client. It does not contact the endpoint.
+func New(cfg Config) (*Client, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("objstore: bucket is required")
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("objstore: region is required")
+	}
+	base, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("objstore: endpoint %q must be an http(s) URL", cfg.Endpoint)
+	}
+	if cfg.PathStyle {
+		base.Path += "/" + cfg.Bucket
+	} else {
+		base.Host = cfg.Bucket + "." + base.Host
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.TLS != nil {
+		transport.TLSClientConfig = cfg.TLS
+	}
+	return &Client{cfg: cfg, base: base, http: &http.Client{Timeout: cfg.Timeout, Transport: transport}, now: time.Now}, nil
+}
+
+// Get returns the content and ETag of the object at key.
+func (c *Client) Get(key string) ([]byte, string, error) {
+	resp, err := c.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxObjectSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("objstore: get %q: %w", key, err)
+	}
+	if len(data) > maxObjectSize {
+		return nil, "", fmt.Errorf("objstore: get %q: object larger than %d bytes", key, maxObjectSize)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// Head returns the ETag of the object at key.
+func (c *Client) Head(key string) (string, error) {
+	resp, err := c.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Put writes the object at key if it is unchanged since etag, or, with an
+// empty etag, if it does not exist yet; otherwise it returns
+// ErrPreconditionFailed. It returns the ETag of the new object.
+func (c *Client) Put(key string, data []byte, etag string) (string, error) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	if etag != "" {
+		header.Set("If-Match", etag)
+	} else {
+		header.Set("If-None-Match", "*")
+	}
+	resp, err := c.do(http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Delete removes the object at key. A missing object is not an error.
+func (c *Client) Delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// listResult is the ListObjectsV2 response body.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys starting with prefix, in lexical order.
+func (c *Client) List(prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("objstore: list %q: %w", prefix, err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key ("" for the bucket) and returns the
+// response if its status is 2xx; its body must be closed.
+func (c *Client) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *c.base
+	u.Path += "/" + key
+	u.RawPath = uriEncode(u.Path, false) // sent as signed
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("objstore: %s %q: %w", method, key, err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.sign(req, body, c.now().UTC())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("objstore: %s %q: %w", method, key, err)
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("objstore: %s %q: %w", method, key, ErrNotFound)
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409: a concurrent conditional write to the same key is in progress
+		return nil, fmt.Errorf("objstore: %s %q: %w", method, key, ErrPreconditionFailed)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("objstore: %s %q: %s: %s", method, key, resp.Status, bytes.TrimSpace(msg))
+}
+
+// sign adds the AWS Signature Version 4 Authorization header to req. Every
+// header set on req is signed, with host, x-amz-date, x-amz-content-sha256
+// and, for temporary credentials, x-amz-security-token.
+func (c *Client) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + c.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), now.Format("20060102"))
+	for _, part := range []string{c.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalQuery encodes query sorted by name, as SigV4 requires; the same
+// string is sent, so the signed and the sent query cannot differ.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, v := range query[name] {
+			parts = append(parts, uriEncode(name, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes s except for the RFC 3986 unreserved characters
+// and, unless encodeSlash, "/".
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
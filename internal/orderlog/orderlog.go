@@ -0,0 +1,238 @@
+// Package orderlog records the order in which packets enter each pipeline of
+// a task, and replays a capture in that order, so ordering-dependent bugs in
+// parsers and processors can be reproduced outside the daemon.
+//
+// Each pipeline writes its own log. A log holds no packet data, only one
+// fixed-size record per packet: its sequence number in the pipeline, the
+// 5-tuple hash used for flow-hash dispatch, its capture length and time, and
+// the time it entered the pipeline. Replay matches the records against a
+// capture of the same traffic, e.g. taken with tcpdump next to the agent.
+//
+// File layout, big-endian:
+//
+//	Offset  Size  Description
+//	------  ----  -----------
+//	0       8     Magic: "OTUSOLOG"
+//	8       1     Version: 1
+//	9       1     Reserved
+//	10      2     Pipeline ID
+//	12      2     Task ID length n
+//	14      n     Task ID
+//	14+n    …     Records, 28 bytes each
+//
+// Record:
+//
+//	0   4  Sequence number in the pipeline, from 0
+//	4   4  5-tuple hash
+//	8   4  Capture length
+//	12  8  Capture time, Unix nanoseconds
+//	20  8  Pipeline entry time, Unix nanoseconds
+package orderlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+const (
+	magic     = "OTUSOLOG"
+	version   = 1
+	headerLen = 14
+	recordLen = 28
+
+	// flushInterval bounds how much of the log a crash can lose.
+	flushInterval = time.Second
+)
+
+// HashFunc returns the 5-tuple hash of a raw packet.
+type HashFunc func(pkt core.RawPacket) uint32
+
+// Header identifies the pipeline a log was recorded for.
+type Header struct {
+	TaskID     string
+	PipelineID int
+}
+
+// Record is one packet entering a pipeline.
+type Record struct {
+	Seq        uint32
+	FlowHash   uint32
+	CaptureLen uint32
+	Captured   time.Time
+	Entered    time.Time
+}
+
+// Writer appends the records of one pipeline to a log file. It is not safe
+// for concurrent use: the pipeline's goroutine is its only writer.
+type Writer struct {
+	path string
+	file *os.File
+	w    *bufio.Writer
+	hash HashFunc
+
+	seq       uint32
+	size      int64
+	maxSize   int64 // 0 = unlimited
+	stopped   bool  // full or failed; later packets are not recorded
+	lastFlush time.Time
+	buf       [recordLen]byte
+}
+
+// Create creates or truncates the log at path. maxSize bounds the file size
+// in bytes, 0 = unlimited; recording stops when it is reached.
+func Create(path string, h Header, maxSize int64, hash HashFunc) (*Writer, error) {
+	if len(h.TaskID) > 0xFFFF {
+		return nil, fmt.Errorf("order log: task id too long")
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("order log: %w", err)
+	}
+
+	hdr := make([]byte, headerLen, headerLen+len(h.TaskID))
+	copy(hdr, magic)
+	hdr[8] = version
+	binary.BigEndian.PutUint16(hdr[10:], uint16(h.PipelineID))
+	binary.BigEndian.PutUint16(hdr[12:], uint16(len(h.TaskID)))
+	hdr = append(hdr, h.TaskID...)
+	if _, err := file.Write(hdr); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("order log: %w", err)
+	}
+
+	return &Writer{
+		path:      path,
+		file:      file,
+		w:         bufio.NewWriterSize(file, 64<<10),
+		hash:      hash,
+		size:      int64(len(hdr)),
+		maxSize:   maxSize,
+		lastFlush: time.Now(),
+	}, nil
+}
+
+// Record appends the record of a packet entering the pipeline. Write errors
+// and a full log stop recording with a warning rather than failing the
+// pipeline.
+func (w *Writer) Record(pkt core.RawPacket) {
+	if w.stopped {
+		return
+	}
+	if w.maxSize > 0 && w.size+recordLen > w.maxSize {
+		w.stop("order log full, recording stopped", nil)
+		return
+	}
+
+	now := time.Now()
+	binary.BigEndian.PutUint32(w.buf[0:], w.seq)
+	binary.BigEndian.PutUint32(w.buf[4:], w.hash(pkt))
+	binary.BigEndian.PutUint32(w.buf[8:], pkt.CaptureLen)
+	binary.BigEndian.PutUint64(w.buf[12:], uint64(pkt.Timestamp.UnixNano()))
+	binary.BigEndian.PutUint64(w.buf[20:], uint64(now.UnixNano()))
+	if _, err := w.w.Write(w.buf[:]); err != nil {
+		w.stop("order log write failed, recording stopped", err)
+		return
+	}
+	w.seq++
+	w.size += recordLen
+
+	if now.Sub(w.lastFlush) >= flushInterval {
+		w.lastFlush = now
+		if err := w.w.Flush(); err != nil {
+			w.stop("order log write failed, recording stopped", err)
+		}
+	}
+}
+
+func (w *Writer) stop(msg string, err error) {
+	w.stopped = true
+	attrs := []any{"path", w.path, "records", w.seq}
+	if err != nil {
+		attrs = append(attrs, "error", err)
+	}
+	slog.Warn(msg, attrs...)
+}
+
+// Records returns the number of records written.
+func (w *Writer) Records() uint32 {
+	return w.seq
+}
+
+// Close flushes and closes the log.
+func (w *Writer) Close() error {
+	err := w.w.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Reader reads the records of one log.
+type Reader struct {
+	file   *os.File
+	r      *bufio.Reader
+	header Header
+	buf    [recordLen]byte
+}
+
+// Open opens a log and reads its header.
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{file: file, r: bufio.NewReader(file)}
+
+	var hdr [headerLen]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil || string(hdr[:8]) != magic {
+		file.Close()
+		return nil, fmt.Errorf("%s: not an order log", path)
+	}
+	if hdr[8] != version {
+		file.Close()
+		return nil, fmt.Errorf("%s: unsupported order log version %d", path, hdr[8])
+	}
+	taskID := make([]byte, binary.BigEndian.Uint16(hdr[12:]))
+	if _, err := io.ReadFull(r.r, taskID); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: truncated header", path)
+	}
+	r.header = Header{TaskID: string(taskID), PipelineID: int(binary.BigEndian.Uint16(hdr[10:]))}
+	return r, nil
+}
+
+// Header returns the log's header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next record, or io.EOF after the last one. A record cut
+// short by a crash of the recording agent also ends the log.
+func (r *Reader) Next() (Record, error) {
+	if _, err := io.ReadFull(r.r, r.buf[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return Record{}, err
+	}
+	return Record{
+		Seq:        binary.BigEndian.Uint32(r.buf[0:]),
+		FlowHash:   binary.BigEndian.Uint32(r.buf[4:]),
+		CaptureLen: binary.BigEndian.Uint32(r.buf[8:]),
+		Captured:   time.Unix(0, int64(binary.BigEndian.Uint64(r.buf[12:]))),
+		Entered:    time.Unix(0, int64(binary.BigEndian.Uint64(r.buf[20:]))),
+	}, nil
+}
+
+// Close closes the log.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
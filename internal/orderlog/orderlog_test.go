@@ -0,0 +1,139 @@
+package orderlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// firstByteHash stands in for the 5-tuple hash.
+func firstByteHash(pkt core.RawPacket) uint32 {
+	return uint32(pkt.Data[0])
+}
+
+func raw(b byte, ts time.Time) core.RawPacket {
+	return core.RawPacket{Data: []byte{b, 0, 0}, Timestamp: ts, CaptureLen: 3, OrigLen: 3}
+}
+
+func writeLog(t *testing.T, path string, pipelineID int, pkts ...core.RawPacket) {
+	t.Helper()
+	w, err := Create(path, Header{TaskID: "voip", PipelineID: pipelineID}, 0, firstByteHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pkts {
+		w.Record(p)
+		time.Sleep(time.Millisecond) // distinct entry times across logs
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "voip-1.olog")
+	t0 := time.Unix(1700000000, 123456789)
+	writeLog(t, path, 1, raw(7, t0), raw(9, t0.Add(time.Millisecond)))
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if h := r.Header(); h != (Header{TaskID: "voip", PipelineID: 1}) {
+		t.Errorf("header = %+v", h)
+	}
+	for i, want := range []struct {
+		hash     uint32
+		captured time.Time
+	}{{7, t0}, {9, t0.Add(time.Millisecond)}} {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if rec.Seq != uint32(i) || rec.FlowHash != want.hash || rec.CaptureLen != 3 || !rec.Captured.Equal(want.captured) || rec.Entered.IsZero() {
+			t.Errorf("record %d = %+v", i, rec)
+		}
+	}
+	if _, err := r.Next(); err == nil {
+		t.Error("expected EOF")
+	}
+
+	// A record cut short by a crash ends the log.
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, data[:len(data)-5], 0o600)
+	_, recs, err := readAll(path)
+	if err != nil || len(recs) != 1 {
+		t.Errorf("truncated log: %d records, err %v", len(recs), err)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.olog")); err == nil {
+		t.Error("expected error for a missing log")
+	}
+	os.WriteFile(path, []byte("not a log at all"), 0o600)
+	if _, err := Open(path); err == nil {
+		t.Error("expected error for a foreign file")
+	}
+}
+
+func TestWriter_MaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "t-0.olog")
+	w, err := Create(path, Header{TaskID: "t"}, headerLen+1+2*recordLen, firstByteHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		w.Record(raw(byte(i), time.Now()))
+	}
+	if w.Records() != 2 {
+		t.Errorf("records = %d, want 2", w.Records())
+	}
+	w.Close()
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Unix(1700000000, 0)
+	// Pipeline 0 saw packets a then c, pipeline 1 saw b; pipeline 1's log
+	// also has a packet the capture lacks.
+	p0 := filepath.Join(dir, "voip-0.olog")
+	p1 := filepath.Join(dir, "voip-1.olog")
+	w0, _ := Create(p0, Header{TaskID: "voip", PipelineID: 0}, 0, firstByteHash)
+	w1, _ := Create(p1, Header{TaskID: "voip", PipelineID: 1}, 0, firstByteHash)
+	w0.Record(raw('a', t0))
+	time.Sleep(time.Millisecond)
+	w1.Record(raw('b', t0.Add(time.Second)))
+	time.Sleep(time.Millisecond)
+	w1.Record(raw('x', t0.Add(3*time.Second)))
+	time.Sleep(time.Millisecond)
+	w0.Record(raw('c', t0.Add(2*time.Second)))
+	w0.Close()
+	w1.Close()
+
+	var packets []Packet
+	for i, b := range []byte{'c', 'a', 'b', 'z'} { // capture order differs from pipeline order
+		ts := map[byte]time.Time{'a': t0, 'b': t0.Add(time.Second), 'c': t0.Add(2 * time.Second), 'z': t0.Add(time.Duration(i) * time.Hour)}[b]
+		packets = append(packets, Packet{Data: []byte{b, 0, 0}, Captured: ts.UnixNano(), CaptureLen: 3, FlowHash: uint32(b)})
+	}
+
+	var got []string
+	stats, err := Replay([]string{p1, p0}, packets, func(id int, rec Record, pkt []byte) {
+		got = append(got, string(rune('0'+id))+string(pkt[0]))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"0a", "1b", "0c"}; len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+	if stats != (ReplayStats{Pipelines: 2, Records: 4, Replayed: 3, Missing: 1, Unlogged: 1}) {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	if _, err := Replay([]string{p0, p0}, packets, func(int, Record, []byte) {}); err == nil {
+		t.Error("expected error for two logs of one pipeline")
+	}
+}
@@ -0,0 +1,116 @@
+package orderlog
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReplayStats summarizes a replay.
+type ReplayStats struct {
+	Pipelines int `json:"pipelines"`
+	Records   int `json:"records"`  // records in the logs
+	Replayed  int `json:"replayed"` // records matched to a captured packet
+	Missing   int `json:"missing"`  // records without a captured packet
+	Unlogged  int `json:"unlogged"` // captured packets no record matched
+}
+
+// ProcessFunc receives one replayed packet and the pipeline it entered.
+type ProcessFunc func(pipelineID int, rec Record, pkt []byte)
+
+// Packet is a captured packet offered to Replay.
+type Packet struct {
+	Data       []byte
+	Captured   int64 // Unix nanoseconds
+	CaptureLen uint32
+	FlowHash   uint32
+}
+
+// packetKey identifies a captured packet for matching. Identical packets
+// captured at the same instant match in capture order.
+type packetKey struct {
+	captured int64
+	hash     uint32
+	length   uint32
+}
+
+// Replay reads the logs, one per pipeline, and calls process for each record
+// matched to one of packets, in recorded order. Each pipeline's records keep
+// their sequence order; across pipelines, records are interleaved by entry
+// time, the closest the logs get to the original concurrency.
+func Replay(paths []string, packets []Packet, process ProcessFunc) (ReplayStats, error) {
+	var stats ReplayStats
+	logs := make([][]Record, 0, len(paths))
+	ids := make([]int, 0, len(paths))
+	seen := make(map[int]string, len(paths))
+	for _, path := range paths {
+		h, recs, err := readAll(path)
+		if err != nil {
+			return stats, err
+		}
+		if prev, ok := seen[h.PipelineID]; ok {
+			return stats, fmt.Errorf("%s and %s both log pipeline %d", prev, path, h.PipelineID)
+		}
+		seen[h.PipelineID] = path
+		logs = append(logs, recs)
+		ids = append(ids, h.PipelineID)
+		stats.Records += len(recs)
+	}
+	stats.Pipelines = len(logs)
+
+	index := make(map[packetKey][]int, len(packets))
+	for i, p := range packets {
+		k := packetKey{p.Captured, p.FlowHash, p.CaptureLen}
+		index[k] = append(index[k], i)
+	}
+
+	next := make([]int, len(logs))
+	for {
+		// The pipeline whose next record entered first
+		pick := -1
+		for i, recs := range logs {
+			if next[i] == len(recs) {
+				continue
+			}
+			if pick < 0 || recs[next[i]].Entered.Before(logs[pick][next[pick]].Entered) {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		rec := logs[pick][next[pick]]
+		next[pick]++
+
+		k := packetKey{rec.Captured.UnixNano(), rec.FlowHash, rec.CaptureLen}
+		matches := index[k]
+		if len(matches) == 0 {
+			stats.Missing++
+			continue
+		}
+		index[k] = matches[1:]
+		stats.Replayed++
+		process(ids[pick], rec, packets[matches[0]].Data)
+	}
+	stats.Unlogged = len(packets) - stats.Replayed
+	return stats, nil
+}
+
+func readAll(path string) (Header, []Record, error) {
+	r, err := Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer r.Close()
+
+	var recs []Record
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return r.Header(), recs, nil
+		}
+		if err != nil {
+			return Header{}, nil, fmt.Errorf("%s: %w", path, err)
+		}
+		recs = append(recs, rec)
+	}
+}
@@ -0,0 +1,173 @@
+// Package ostune applies OS tuning for latency-sensitive capture: busy
+// polling, socket receive buffer limits, the backlog queue and RPS masks.
+//
+// Tuning by hand drifts between boxes and outlives the capture it was made
+// for. A Tuner writes the sysctls and sysfs files when a task starts, records
+// the previous values and restores them when the task stops. Tasks sharing a
+// setting share the change: the previous value is restored when the last one
+// stops, and a task asking for a different value fails to start instead of
+// silently overriding another task's tuning.
+package ostune
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Settings is the tuning a task asks for. Zero values leave a setting alone.
+type Settings struct {
+	Interface        string // capture interface, for RPSCPUs
+	BusyPollUS       int    // net.core.busy_poll and net.core.busy_read (SO_BUSY_POLL default), µs
+	RmemMax          int    // net.core.rmem_max, bytes
+	RmemDefault      int    // net.core.rmem_default, bytes
+	NetdevMaxBacklog int    // net.core.netdev_max_backlog, packets
+	RPSCPUs          string // hex CPU mask for every RX queue of Interface, e.g. "f"
+}
+
+// Change is one file the tuner wrote.
+type Change struct {
+	Path string `json:"path"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+}
+
+// Tuner writes settings under a sysfs and procfs root.
+type Tuner struct {
+	SysRoot  string // default "/sys"
+	ProcRoot string // default "/proc"
+
+	mu   sync.Mutex
+	held map[string]*hold // path → shared change
+}
+
+// hold is a change shared by the tasks that applied it.
+type hold struct {
+	old, value string
+	refs       int
+}
+
+// Default is the process-wide tuner: tasks must share one to share changes.
+var Default = &Tuner{}
+
+// Apply writes the settings and returns the changes made. On error nothing
+// stays applied.
+func (t *Tuner) Apply(s Settings) ([]Change, error) {
+	writes, err := t.plan(s)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.held == nil {
+		t.held = make(map[string]*hold)
+	}
+
+	var changes []Change
+	for _, w := range writes {
+		c, err := t.apply(w.path, w.value)
+		if err != nil {
+			t.revert(changes)
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// Revert releases changes returned by Apply, restoring previous values no
+// other task still holds. It returns the first error; all changes are
+// released regardless.
+func (t *Tuner) Revert(changes []Change) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.revert(changes)
+}
+
+// write is one file to set.
+type write struct {
+	path, value string
+}
+
+// plan lists the files to write for s.
+func (t *Tuner) plan(s Settings) ([]write, error) {
+	sys, proc := t.SysRoot, t.ProcRoot
+	if sys == "" {
+		sys = "/sys"
+	}
+	if proc == "" {
+		proc = "/proc"
+	}
+	sysctl := func(name string) string {
+		return filepath.Join(proc, "sys", "net", "core", name)
+	}
+
+	var writes []write
+	if s.BusyPollUS > 0 {
+		v := strconv.Itoa(s.BusyPollUS)
+		writes = append(writes, write{sysctl("busy_poll"), v}, write{sysctl("busy_read"), v})
+	}
+	if s.RmemMax > 0 {
+		writes = append(writes, write{sysctl("rmem_max"), strconv.Itoa(s.RmemMax)})
+	}
+	if s.RmemDefault > 0 {
+		writes = append(writes, write{sysctl("rmem_default"), strconv.Itoa(s.RmemDefault)})
+	}
+	if s.NetdevMaxBacklog > 0 {
+		writes = append(writes, write{sysctl("netdev_max_backlog"), strconv.Itoa(s.NetdevMaxBacklog)})
+	}
+	if s.RPSCPUs != "" {
+		queues, _ := filepath.Glob(filepath.Join(sys, "class", "net", s.Interface, "queues", "rx-*"))
+		if len(queues) == 0 {
+			return nil, fmt.Errorf("rps_cpus: interface %q has no RX queues", s.Interface)
+		}
+		for _, q := range queues {
+			writes = append(writes, write{filepath.Join(q, "rps_cpus"), s.RPSCPUs})
+		}
+	}
+	return writes, nil
+}
+
+// apply writes value to path, or joins the hold of another task.
+func (t *Tuner) apply(path, value string) (Change, error) {
+	if h, ok := t.held[path]; ok {
+		if h.value != value {
+			return Change{}, fmt.Errorf("%s: set to %s by another task, want %s", path, h.value, value)
+		}
+		h.refs++
+		return Change{Path: path, Old: h.old, New: value}, nil
+	}
+
+	old, err := os.ReadFile(path)
+	if err != nil {
+		return Change{}, err
+	}
+	if err := os.WriteFile(path, []byte(value+"\n"), 0o644); err != nil {
+		return Change{}, err
+	}
+	h := &hold{old: strings.TrimSpace(string(old)), value: value, refs: 1}
+	t.held[path] = h
+	return Change{Path: path, Old: h.old, New: value}, nil
+}
+
+func (t *Tuner) revert(changes []Change) error {
+	var first error
+	for i := len(changes) - 1; i >= 0; i-- {
+		h, ok := t.held[changes[i].Path]
+		if !ok {
+			continue
+		}
+		if h.refs--; h.refs > 0 {
+			continue
+		}
+		delete(t.held, changes[i].Path)
+		if err := os.WriteFile(changes[i].Path, []byte(h.old+"\n"), 0o644); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,129 @@
+package ostune
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestTuner creates a tuner over a fake procfs and sysfs with eth0 having
+// two RX queues.
+func newTestTuner(t *testing.T) *Tuner {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"proc/sys/net/core/busy_poll":             "0\n",
+		"proc/sys/net/core/busy_read":             "0\n",
+		"proc/sys/net/core/rmem_max":              "212992\n",
+		"proc/sys/net/core/rmem_default":          "212992\n",
+		"proc/sys/net/core/netdev_max_backlog":    "1000\n",
+		"sys/class/net/eth0/queues/rx-0/rps_cpus": "00000000\n",
+		"sys/class/net/eth0/queues/rx-1/rps_cpus": "00000000\n",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Tuner{SysRoot: filepath.Join(root, "sys"), ProcRoot: filepath.Join(root, "proc")}
+}
+
+func (t *Tuner) read(tb testing.TB, rel string) string {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(t.ProcRoot), rel))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func TestApplyRevert(t *testing.T) {
+	tuner := newTestTuner(t)
+	changes, err := tuner.Apply(Settings{
+		Interface:  "eth0",
+		BusyPollUS: 50,
+		RmemMax:    33554432,
+		RPSCPUs:    "f",
+	})
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if len(changes) != 5 {
+		t.Fatalf("changes = %v, want busy_poll, busy_read, rmem_max and 2 rps_cpus", changes)
+	}
+	if changes[2].Old != "212992" || changes[2].New != "33554432" {
+		t.Errorf("rmem_max change = %+v", changes[2])
+	}
+	for rel, want := range map[string]string{
+		"proc/sys/net/core/busy_read":             "50",
+		"proc/sys/net/core/rmem_max":              "33554432",
+		"proc/sys/net/core/netdev_max_backlog":    "1000",
+		"sys/class/net/eth0/queues/rx-1/rps_cpus": "f",
+	} {
+		if got := tuner.read(t, rel); got != want {
+			t.Errorf("%s = %q, want %q", rel, got, want)
+		}
+	}
+
+	if err := tuner.Revert(changes); err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	if got := tuner.read(t, "proc/sys/net/core/busy_read"); got != "0" {
+		t.Errorf("busy_read after revert = %q, want 0", got)
+	}
+	if got := tuner.read(t, "sys/class/net/eth0/queues/rx-0/rps_cpus"); got != "00000000" {
+		t.Errorf("rps_cpus after revert = %q, want 00000000", got)
+	}
+}
+
+func TestApply_Shared(t *testing.T) {
+	tuner := newTestTuner(t)
+	a, err := tuner.Apply(Settings{RmemMax: 1 << 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tuner.Apply(Settings{RmemMax: 1 << 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0].Old != "212992" {
+		t.Errorf("shared change Old = %q, want the value before the first task", b[0].Old)
+	}
+
+	if _, err := tuner.Apply(Settings{RmemMax: 1 << 20}); err == nil {
+		t.Error("conflicting value applied")
+	}
+
+	_ = tuner.Revert(a)
+	if got := tuner.read(t, "proc/sys/net/core/rmem_max"); got != "16777216" {
+		t.Errorf("rmem_max = %q, reverted while another task holds it", got)
+	}
+	_ = tuner.Revert(b)
+	if got := tuner.read(t, "proc/sys/net/core/rmem_max"); got != "212992" {
+		t.Errorf("rmem_max = %q, want 212992 after the last task", got)
+	}
+}
+
+func TestApply_RollbackOnError(t *testing.T) {
+	tuner := newTestTuner(t)
+	if _, err := tuner.Apply(Settings{BusyPollUS: 50, Interface: "eth9", RPSCPUs: "f"}); err == nil {
+		t.Fatal("Apply succeeded for an interface without RX queues")
+	}
+
+	if err := os.Remove(filepath.Join(tuner.ProcRoot, "sys/net/core/netdev_max_backlog")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tuner.Apply(Settings{BusyPollUS: 50, NetdevMaxBacklog: 5000}); err == nil {
+		t.Fatal("Apply succeeded with a missing sysctl")
+	}
+	if got := tuner.read(t, "proc/sys/net/core/busy_poll"); got != "0" {
+		t.Errorf("busy_poll = %q, want 0 after a failed Apply", got)
+	}
+	if len(tuner.held) != 0 {
+		t.Errorf("held = %v, want none after a failed Apply", tuner.held)
+	}
+}
@@ -0,0 +1,218 @@
+// Package pcaparchive implements the indexed pcap archive written by the pcap
+// reporter and read by "otus pcap extract".
+//
+// An archive is a directory of classic pcap files (nanosecond timestamps,
+// LINKTYPE_RAW) with two sidecars per file:
+//
+//	<file>.tidx  time index: fixed 16-byte records (unix nanoseconds, file
+//	             offset; big endian), one per index interval, in time order,
+//	             so a start time is found by binary search without reading
+//	             the capture. Appended while the file is written.
+//	<file>.cidx  call index: one line per call, "call-id<TAB>offsets", sorted
+//	             by call-id; offsets are the record positions of the call's
+//	             packets, the first absolute and the rest as deltas. Written
+//	             when the file is closed.
+//
+// Extracting a call reads only the call indexes and the records they point
+// at, so its cost does not grow with the size of the archive.
+package pcaparchive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+const (
+	// Extensions of the sidecar files.
+	TimeIndexExt = ".tidx"
+	CallIndexExt = ".cidx"
+
+	// DefaultIndexInterval is the spacing of time index records.
+	DefaultIndexInterval = time.Second
+
+	// LinkType of archive files: frames start at the IP header.
+	LinkType = layers.LinkTypeRaw
+
+	snapLen          = 65535
+	fileHeaderLen    = 24
+	recordHeaderLen  = 16
+	timeRecordLen    = 16
+	callIndexHeading = "# otus call index v1"
+)
+
+// Writer writes one archive file and its sidecars. It is not safe for
+// concurrent use.
+type Writer struct {
+	path     string
+	file     *os.File
+	buf      *bufio.Writer
+	pcap     *pcapgo.Writer
+	offset   int64 // position of the next record
+	packets  uint64
+	interval time.Duration
+
+	// Sidecars; nil when the writer was created without an index.
+	tidx      *os.File
+	nextIndex time.Time
+	calls     map[string][]int64
+}
+
+// Create creates the archive file path, truncating it. With index set, the
+// time index is written next to it, one record per interval (0 = default),
+// and the call index on Close.
+func Create(path string, index bool, interval time.Duration) (*Writer, error) {
+	if interval <= 0 {
+		interval = DefaultIndexInterval
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("pcap archive: %w", err)
+	}
+	w := &Writer{
+		path:     path,
+		file:     f,
+		buf:      bufio.NewWriterSize(f, 64*1024),
+		offset:   fileHeaderLen,
+		interval: interval,
+	}
+	w.pcap = pcapgo.NewWriterNanos(w.buf)
+	if err := w.pcap.WriteFileHeader(snapLen, LinkType); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("pcap archive: write header: %w", err)
+	}
+	if index {
+		if w.tidx, err = os.Create(path + TimeIndexExt); err != nil {
+			_ = f.Close()
+			return nil, fmt.Errorf("pcap archive: %w", err)
+		}
+		w.calls = make(map[string][]int64)
+	}
+	return w, nil
+}
+
+// Path returns the path of the archive file.
+func (w *Writer) Path() string { return w.path }
+
+// Size returns the number of bytes written to the archive file.
+func (w *Writer) Size() int64 { return w.offset }
+
+// Packets returns the number of packets written.
+func (w *Writer) Packets() uint64 { return w.packets }
+
+// WritePacket appends one frame captured at ts; callID (may be empty) adds it
+// to the call index.
+func (w *Writer) WritePacket(ts time.Time, frame []byte, callID string) error {
+	if w.tidx != nil && !ts.Before(w.nextIndex) {
+		var rec [timeRecordLen]byte
+		binary.BigEndian.PutUint64(rec[0:8], uint64(ts.UnixNano()))
+		binary.BigEndian.PutUint64(rec[8:16], uint64(w.offset))
+		if _, err := w.tidx.Write(rec[:]); err != nil {
+			return fmt.Errorf("pcap archive: write time index: %w", err)
+		}
+		w.nextIndex = ts.Truncate(w.interval).Add(w.interval)
+	}
+
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(frame), Length: len(frame)}
+	if err := w.pcap.WritePacket(ci, frame); err != nil {
+		return fmt.Errorf("pcap archive: write packet: %w", err)
+	}
+	if w.calls != nil && callID != "" {
+		id := escapeCallID(callID)
+		w.calls[id] = append(w.calls[id], w.offset)
+	}
+	w.offset += recordHeaderLen + int64(len(frame))
+	w.packets++
+	return nil
+}
+
+// Flush writes buffered packets to the archive file.
+func (w *Writer) Flush() error {
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("pcap archive: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the archive file, writes the call index and closes all files.
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if cerr := w.file.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("pcap archive: %w", cerr)
+	}
+	if w.tidx != nil {
+		if cerr := w.tidx.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("pcap archive: %w", cerr)
+		}
+		if cerr := writeCallIndex(w.path+CallIndexExt, w.calls); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// writeCallIndex writes calls sorted by call-id, via a temp file so a
+// present call index is always complete.
+func writeCallIndex(path string, calls map[string][]int64) error {
+	ids := make([]string, 0, len(calls))
+	for id := range calls {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("pcap archive: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	bw.WriteString(callIndexHeading + "\n")
+	var line []byte
+	for _, id := range ids {
+		line = append(line[:0], id...)
+		line = append(line, '\t')
+		prev := int64(0)
+		for i, off := range calls[id] {
+			if i > 0 {
+				line = append(line, ',')
+			}
+			line = strconv.AppendInt(line, off-prev, 10)
+			prev = off
+		}
+		line = append(line, '\n')
+		bw.Write(line)
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("pcap archive: write call index: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("pcap archive: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("pcap archive: %w", err)
+	}
+	return nil
+}
+
+// callIDEscaper keeps a call-id on one index line; Call-IDs never legally
+// contain these characters, but the index must not be corrupted if one does.
+var callIDEscaper = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ")
+
+func escapeCallID(id string) string {
+	if !strings.ContainsAny(id, "\t\n\r") {
+		return id
+	}
+	return callIDEscaper.Replace(id)
+}
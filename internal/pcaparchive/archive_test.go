@@ -0,0 +1,158 @@
+package pcaparchive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/pcapgo"
+)
+
+// writeArchive writes 30 packets, one every 100ms from base, alternating
+// between calls "a@host" and "b@host"; every third packet has no call.
+func writeArchive(t *testing.T, path string, index bool, base time.Time) {
+	t.Helper()
+	w, err := Create(path, index, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		callID := ""
+		switch i % 3 {
+		case 0:
+			callID = "a@host"
+		case 1:
+			callID = "b@host"
+		}
+		frame := bytes.Repeat([]byte{byte(i)}, 20+i)
+		if err := w.WritePacket(base.Add(time.Duration(i)*100*time.Millisecond), frame, callID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readAll returns the frames of a pcap produced by an Extractor.
+func readAll(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	r, err := pcapgo.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.LinkType() != LinkType {
+		t.Errorf("link type = %v, want %v", r.LinkType(), LinkType)
+	}
+	var frames [][]byte
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		frames = append(frames, data)
+	}
+	return frames
+}
+
+func TestExtractCall(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	writeArchive(t, filepath.Join(dir, "t1-0800.pcap"), true, base)
+	writeArchive(t, filepath.Join(dir, "t1-0801.pcap"), true, base.Add(time.Minute))
+	writeArchive(t, filepath.Join(dir, "t1-0802.pcap"), false, base.Add(2*time.Minute))
+
+	files, err := Files([]string{dir})
+	if err != nil || len(files) != 3 {
+		t.Fatalf("Files = %v, %v; want 3 files", files, err)
+	}
+
+	var out bytes.Buffer
+	e, err := NewExtractor(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unindexed := 0
+	for _, f := range files {
+		_, indexed, err := e.Call(f, "a@host", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Call(%s): %v", f, err)
+		}
+		if !indexed {
+			unindexed++
+		}
+	}
+	if unindexed != 1 {
+		t.Errorf("unindexed files = %d, want 1", unindexed)
+	}
+
+	frames := readAll(t, out.Bytes())
+	if len(frames) != 20 || e.Packets() != 20 {
+		t.Fatalf("extracted %d frames (Packets %d), want 10 per indexed file", len(frames), e.Packets())
+	}
+	for _, f := range frames {
+		if i := int(f[0]); i%3 != 0 || len(f) != 20+i {
+			t.Errorf("frame %d (len %d) does not belong to a@host", i, len(f))
+		}
+	}
+
+	// Unknown calls and time windows outside the call extract nothing.
+	n, _, err := e.Call(files[0], "nope@host", time.Time{}, time.Time{})
+	if err != nil || n != 0 {
+		t.Errorf("unknown call: n = %d, err = %v", n, err)
+	}
+	n, _, err = e.Call(files[0], "a@host", base.Add(time.Hour), time.Time{})
+	if err != nil || n != 0 {
+		t.Errorf("later window: n = %d, err = %v", n, err)
+	}
+}
+
+func TestExtractRange(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	indexed := filepath.Join(dir, "indexed.pcap")
+	plain := filepath.Join(dir, "plain.pcap")
+	writeArchive(t, indexed, true, base)
+	writeArchive(t, plain, false, base)
+
+	if info, err := os.Stat(indexed + TimeIndexExt); err != nil || info.Size() != 3*timeRecordLen {
+		t.Fatalf("time index: %v, want one record per second of traffic", err)
+	}
+
+	// Packets 12..25 fall into [1.2s, 2.5s].
+	for _, path := range []string{indexed, plain} {
+		var out bytes.Buffer
+		e, err := NewExtractor(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := e.Range(path, base.Add(1200*time.Millisecond), base.Add(2500*time.Millisecond))
+		if err != nil {
+			t.Fatalf("Range(%s): %v", path, err)
+		}
+		frames := readAll(t, out.Bytes())
+		if n != 14 || len(frames) != 14 || frames[0][0] != 12 || frames[13][0] != 25 {
+			t.Errorf("Range(%s) = %d frames, want packets 12..25", filepath.Base(path), len(frames))
+		}
+	}
+}
+
+func TestCallIndexEscapesCallID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "odd.pcap")
+	w, err := Create(path, true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WritePacket(time.Now(), []byte{1}, "odd\tid")
+	w.WritePacket(time.Now(), []byte{2}, "plain")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	offsets, err := lookupCall(path+CallIndexExt, "odd\tid")
+	if err != nil || len(offsets) != 1 || offsets[0] != fileHeaderLen {
+		t.Errorf("lookupCall = %v, %v; want [%d]", offsets, err, fileHeaderLen)
+	}
+}
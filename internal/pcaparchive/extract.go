@@ -0,0 +1,290 @@
+package pcaparchive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// magicNanos is the little-endian magic of nanosecond pcap files.
+const magicNanos = 0xa1b23c4d
+
+// Files returns the archive files (*.pcap) named by paths, descending into
+// directories, sorted by path.
+func Files(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".pcap") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("pcap archive: %w", err)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Extractor copies packets out of archive files into a single pcap.
+type Extractor struct {
+	out     *pcapgo.Writer
+	packets int
+}
+
+// NewExtractor writes the pcap file header to w.
+func NewExtractor(w io.Writer) (*Extractor, error) {
+	out := pcapgo.NewWriterNanos(w)
+	if err := out.WriteFileHeader(snapLen, LinkType); err != nil {
+		return nil, fmt.Errorf("pcap archive: write header: %w", err)
+	}
+	return &Extractor{out: out}, nil
+}
+
+// Packets returns the number of packets extracted so far.
+func (e *Extractor) Packets() int { return e.packets }
+
+// Call copies the packets of callID in file path with timestamps in
+// [from, to] (zero = unbounded). indexed is false when the file has no call
+// index, e.g. while it is still being written; it is skipped then.
+func (e *Extractor) Call(path, callID string, from, to time.Time) (n int, indexed bool, err error) {
+	offsets, err := lookupCall(path+CallIndexExt, callID)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil || len(offsets) == 0 {
+		return 0, true, err
+	}
+
+	f, err := openArchive(path)
+	if err != nil {
+		return 0, true, err
+	}
+	defer f.Close()
+
+	for _, off := range offsets {
+		ts, data, _, err := readRecord(f, off)
+		if err != nil {
+			return n, true, fmt.Errorf("pcap archive: %s at %d: %w", path, off, err)
+		}
+		if inWindow(ts, from, to) {
+			if err := e.write(ts, data); err != nil {
+				return n, true, err
+			}
+			n++
+		}
+	}
+	return n, true, nil
+}
+
+// Range copies the packets in file path with timestamps in [from, to] (zero
+// = unbounded). The time index, when present, limits reading to the part of
+// the file written during the window.
+func (e *Extractor) Range(path string, from, to time.Time) (int, error) {
+	f, err := openArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	start, end, err := timeBounds(path+TimeIndexExt, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for off := start; end < 0 || off < end; {
+		ts, data, next, err := readRecord(f, off)
+		if errors.Is(err, io.EOF) {
+			break // end of file, or a record still being written
+		}
+		if err != nil {
+			return n, fmt.Errorf("pcap archive: %s at %d: %w", path, off, err)
+		}
+		if inWindow(ts, from, to) {
+			if err := e.write(ts, data); err != nil {
+				return n, err
+			}
+			n++
+		}
+		off = next
+	}
+	return n, nil
+}
+
+func (e *Extractor) write(ts time.Time, data []byte) error {
+	ci := gopacket.CaptureInfo{Timestamp: ts, CaptureLength: len(data), Length: len(data)}
+	if err := e.out.WritePacket(ci, data); err != nil {
+		return fmt.Errorf("pcap archive: write packet: %w", err)
+	}
+	e.packets++
+	return nil
+}
+
+func inWindow(ts, from, to time.Time) bool {
+	return (from.IsZero() || !ts.Before(from)) && (to.IsZero() || !ts.After(to))
+}
+
+// openArchive opens an archive file and checks its header.
+func openArchive(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("pcap archive: %w", err)
+	}
+	var hdr [fileHeaderLen]byte
+	if _, err := f.ReadAt(hdr[:], 0); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("pcap archive: %s: read header: %w", path, err)
+	}
+	if binary.LittleEndian.Uint32(hdr[0:4]) != magicNanos {
+		f.Close()
+		return nil, fmt.Errorf("pcap archive: %s is not an archive file (want nanosecond pcap)", path)
+	}
+	return f, nil
+}
+
+// readRecord reads the packet record at off and returns the offset of the
+// next one. A truncated record reads as io.EOF.
+func readRecord(r io.ReaderAt, off int64) (ts time.Time, data []byte, next int64, err error) {
+	var hdr [recordHeaderLen]byte
+	if _, err := r.ReadAt(hdr[:], off); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return time.Time{}, nil, 0, err
+	}
+	sec := binary.LittleEndian.Uint32(hdr[0:4])
+	nsec := binary.LittleEndian.Uint32(hdr[4:8])
+	capLen := binary.LittleEndian.Uint32(hdr[8:12])
+	if capLen > snapLen {
+		return time.Time{}, nil, 0, fmt.Errorf("corrupt record (length %d)", capLen)
+	}
+	data = make([]byte, capLen)
+	if _, err := r.ReadAt(data, off+recordHeaderLen); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return time.Time{}, nil, 0, err
+	}
+	return time.Unix(int64(sec), int64(nsec)), data, off + recordHeaderLen + int64(capLen), nil
+}
+
+// timeBounds binary-searches the time index at path for the file offsets
+// enclosing [from, to]; end is -1 for "to the end of the file". Without a
+// time index the whole file is covered.
+func timeBounds(path string, from, to time.Time) (start, end int64, err error) {
+	start, end = fileHeaderLen, -1
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return start, end, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("pcap archive: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, fmt.Errorf("pcap archive: %w", err)
+	}
+
+	count := int(info.Size() / timeRecordLen)
+	var readErr error
+	record := func(i int) (time.Time, int64) {
+		var rec [timeRecordLen]byte
+		if _, err := f.ReadAt(rec[:], int64(i)*timeRecordLen); err != nil && readErr == nil {
+			readErr = err
+		}
+		return time.Unix(0, int64(binary.BigEndian.Uint64(rec[0:8]))),
+			int64(binary.BigEndian.Uint64(rec[8:16]))
+	}
+
+	if !from.IsZero() {
+		// Packets before the first record after from may still be in the window.
+		i := sort.Search(count, func(i int) bool {
+			ts, _ := record(i)
+			return ts.After(from)
+		})
+		if i > 0 {
+			_, start = record(i - 1)
+		}
+	}
+	if !to.IsZero() {
+		i := sort.Search(count, func(i int) bool {
+			ts, _ := record(i)
+			return ts.After(to)
+		})
+		if i < count {
+			_, end = record(i)
+		}
+	}
+	if readErr != nil {
+		return 0, 0, fmt.Errorf("pcap archive: %s: %w", path, readErr)
+	}
+	return start, end, nil
+}
+
+// lookupCall binary-searches the call index at path for callID and returns
+// the record offsets of its packets.
+func lookupCall(path, callID string) ([]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		if line := sc.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("pcap archive: %s: %w", path, err)
+	}
+
+	id := escapeCallID(callID)
+	i := sort.Search(len(lines), func(i int) bool {
+		return lineID(lines[i]) >= id
+	})
+	if i == len(lines) || lineID(lines[i]) != id {
+		return nil, nil
+	}
+
+	_, list, _ := strings.Cut(lines[i], "\t")
+	fields := strings.Split(list, ",")
+	offsets := make([]int64, len(fields))
+	prev := int64(0)
+	for j, s := range fields {
+		delta, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pcap archive: %s: corrupt entry for %q", path, callID)
+		}
+		prev += delta
+		offsets[j] = prev
+	}
+	return offsets, nil
+}
+
+func lineID(line string) string {
+	id, _, _ := strings.Cut(line, "\t")
+	return id
+}
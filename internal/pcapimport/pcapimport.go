@@ -0,0 +1,357 @@
+// Package pcapimport feeds a directory of historical captures through a
+// packet handler as fast as it can read them, for backfilling collectors
+// after an outage.
+//
+// Progress is checkpointed to a state file: after every Checkpoint packets
+// and at the end of each file the importer flushes the handler and records
+// how many packets of the file have been delivered. A rerun with the same
+// state file skips finished files and the delivered prefix of the file it
+// stopped in, so an interrupted import resumes instead of starting over.
+// Skipped packets are still read and passed to Replay, which rebuilds the
+// handler's state (flows, SIP dialogs) without delivering anything. Packets
+// handled after the last checkpoint are handled again on resume: delivery is
+// at least once.
+package pcapimport
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// DefaultCheckpoint is the number of packets between checkpoints.
+const DefaultCheckpoint = 10000
+
+// pcapngMagic is the block type of a pcapng section header.
+const pcapngMagic = 0x0A0D0D0A
+
+// Files returns the captures (*.pcap, *.pcapng, *.cap) under dir, sorted by
+// path. Rotated captures are named by start time, so this is also the order
+// they were written in.
+func Files(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".pcap", ".pcapng", ".cap":
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pcap import: %w", err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// FileState is the import position in one capture.
+type FileState struct {
+	Packets uint64 `json:"packets"` // packets delivered (flushed)
+	Done    bool   `json:"done,omitempty"`
+}
+
+// State is the persisted import position, keyed by path relative to the
+// imported directory.
+type State struct {
+	Files map[string]*FileState `json:"files"`
+}
+
+// LoadState reads a state file; a missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	s := &State{Files: make(map[string]*FileState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pcap import: read state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("pcap import: state %s: %w", path, err)
+	}
+	if s.Files == nil {
+		s.Files = make(map[string]*FileState)
+	}
+	return s, nil
+}
+
+// Save writes the state atomically, so a crash leaves the previous
+// checkpoint intact.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("pcap import: write state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("pcap import: write state: %w", err)
+	}
+	return nil
+}
+
+// Progress is reported at every checkpoint and at the end of every file.
+type Progress struct {
+	File        string        // current file, relative to the directory
+	FileIndex   int           // 1-based
+	Files       int           // captures in the directory
+	FilePackets uint64        // packets of File delivered so far, resumed ones included
+	Packets     uint64        // packets handled by this run
+	Elapsed     time.Duration // since Run started
+	FileDone    bool
+}
+
+// Summary is the outcome of a run.
+type Summary struct {
+	Files     int    // captures in the directory
+	Imported  int    // files finished by this run
+	Skipped   int    // files finished by an earlier run
+	Packets   uint64 // packets handled by this run
+	Replayed  uint64 // packets delivered by an earlier run, passed to Replay
+	Truncated int    // files ending in a partial record
+	Elapsed   time.Duration
+}
+
+// Importer reads captures and hands their packets to Handle.
+type Importer struct {
+	// Handle processes one packet. An error aborts the import at the last
+	// checkpoint.
+	Handle func(pkt core.RawPacket) error
+	// Flush delivers everything handled so far; it runs before every
+	// checkpoint is recorded.
+	Flush func(ctx context.Context) error
+	// Replay, if set, receives the packets delivered by an earlier run,
+	// which are skipped on resume, so that state spanning them is rebuilt.
+	// Its output must not be delivered.
+	Replay func(pkt core.RawPacket)
+	// StatePath is the state file; empty disables resuming.
+	StatePath string
+	// Checkpoint is the number of packets between checkpoints;
+	// 0 means DefaultCheckpoint.
+	Checkpoint int
+	// Progress, if set, receives progress reports.
+	Progress func(Progress)
+}
+
+// Run imports the captures under dir in Files order. When ctx is cancelled
+// it checkpoints the current position and returns ctx.Err().
+func (im *Importer) Run(ctx context.Context, dir string) (Summary, error) {
+	start := time.Now()
+	var sum Summary
+
+	files, err := Files(dir)
+	if err != nil {
+		return sum, err
+	}
+	sum.Files = len(files)
+
+	state := &State{Files: make(map[string]*FileState)}
+	if im.StatePath != "" {
+		if state, err = LoadState(im.StatePath); err != nil {
+			return sum, err
+		}
+	}
+
+	every := uint64(im.Checkpoint)
+	if every == 0 {
+		every = DefaultCheckpoint
+	}
+
+	for i, path := range files {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			rel = path
+		}
+		st := state.Files[rel]
+		if st == nil {
+			st = &FileState{}
+			state.Files[rel] = st
+		}
+		if st.Done {
+			sum.Skipped++
+			if im.Replay == nil {
+				continue
+			}
+			if _, err := readFile(ctx, path, func(pkt core.RawPacket) error {
+				im.Replay(pkt)
+				sum.Replayed++
+				return nil
+			}); err != nil {
+				sum.Elapsed = time.Since(start)
+				return sum, fmt.Errorf("%s: %w", rel, err)
+			}
+			if ctx.Err() != nil {
+				sum.Elapsed = time.Since(start)
+				return sum, ctx.Err()
+			}
+			continue
+		}
+
+		progress := Progress{File: rel, FileIndex: i + 1, Files: len(files)}
+		// checkpoint records the first n packets of the file as delivered
+		// once Flush succeeds.
+		checkpoint := func(ctx context.Context, n uint64, done bool) error {
+			if err := im.Flush(ctx); err != nil {
+				return fmt.Errorf("flush: %w", err)
+			}
+			st.Packets, st.Done = n, done
+			if im.StatePath != "" {
+				if err := state.Save(im.StatePath); err != nil {
+					return err
+				}
+			}
+			if im.Progress != nil {
+				progress.FilePackets = n
+				progress.Packets = sum.Packets
+				progress.Elapsed = time.Since(start)
+				progress.FileDone = done
+				im.Progress(progress)
+			}
+			return nil
+		}
+
+		// read counts packets into the file, handled those passed to Handle
+		// successfully; st.Packets lags them until a checkpoint.
+		var read, handled uint64
+		truncated, err := readFile(ctx, path, func(pkt core.RawPacket) error {
+			read++
+			if read <= st.Packets {
+				// delivered by an earlier run
+				if im.Replay != nil {
+					im.Replay(pkt)
+					sum.Replayed++
+				}
+				return nil
+			}
+			if err := im.Handle(pkt); err != nil {
+				return err
+			}
+			handled = read
+			sum.Packets++
+			if read%every == 0 {
+				return checkpoint(ctx, read, false)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			// Interrupted: keep what was handled, on a fresh context
+			// since ctx no longer lets the flush run.
+			if handled > st.Packets {
+				flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				if err := checkpoint(flushCtx, handled, false); err != nil {
+					slog.Warn("pcap import: final checkpoint failed", "file", rel, "error", err)
+				}
+				cancel()
+			}
+			sum.Elapsed = time.Since(start)
+			return sum, ctx.Err()
+		}
+		if err != nil {
+			sum.Elapsed = time.Since(start)
+			return sum, fmt.Errorf("%s: %w", rel, err)
+		}
+		if truncated {
+			sum.Truncated++
+			slog.Warn("capture ends in a partial record", "file", rel, "packets", read)
+		}
+
+		if err := checkpoint(ctx, read, true); err != nil {
+			sum.Elapsed = time.Since(start)
+			return sum, fmt.Errorf("%s: %w", rel, err)
+		}
+		sum.Imported++
+	}
+
+	sum.Elapsed = time.Since(start)
+	return sum, nil
+}
+
+// packetReader is implemented by both pcapgo.Reader and pcapgo.NgReader.
+type packetReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// readFile calls handle for every packet of a classic pcap or pcapng file
+// until EOF, a handle error or the cancellation of ctx. A file cut short in
+// the middle of a record, as the last capture of a crashed agent is, ends
+// there and is reported as truncated.
+func readFile(ctx context.Context, path string, handle func(core.RawPacket) error) (truncated bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return false, fmt.Errorf("read header: %w", err)
+	}
+	var r packetReader
+	if binary.LittleEndian.Uint32(magic) == pcapngMagic {
+		r, err = pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+	} else {
+		r, err = pcapgo.NewReader(br)
+	}
+	if err != nil {
+		return false, fmt.Errorf("read header: %w", err)
+	}
+
+	// The decoder starts at the Ethernet header.
+	if lt := r.LinkType(); lt != layers.LinkTypeEthernet {
+		return false, fmt.Errorf("unsupported link type %s: %w", lt, core.ErrConfig)
+	}
+
+	for n := 0; ; n++ {
+		if n%1024 == 0 && ctx.Err() != nil {
+			return false, nil
+		}
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return true, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("packet %d: %w", n+1, err)
+		}
+		// ReadPacketData returns a fresh buffer per packet, so data can be
+		// handed over as is.
+		if err := handle(core.RawPacket{
+			Data:           data,
+			Timestamp:      ci.Timestamp,
+			CaptureLen:     uint32(ci.CaptureLength),
+			OrigLen:        uint32(ci.Length),
+			InterfaceIndex: ci.InterfaceIndex,
+		}); err != nil {
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package pcapimport
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// writePcap writes n packets to dir/name; each packet's first byte is its
+// 1-based index.
+func writePcap(t *testing.T, dir, name string, n int, lt layers.LinkType) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(65535, lt); err != nil {
+		t.Fatal(err)
+	}
+	base := time.Unix(1700000000, 0)
+	for i := 1; i <= n; i++ {
+		data := make([]byte, 60)
+		data[0] = byte(i)
+		ci := gopacket.CaptureInfo{Timestamp: base.Add(time.Duration(i) * time.Millisecond), CaptureLength: 60, Length: 60}
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// recorder is a Handle/Flush pair that counts packets and flushes.
+type recorder struct {
+	handled []byte // first byte of every handled packet
+	flushed int    // packets handled at the last flush
+	failAt  int    // fail Handle of the failAt-th packet; 0 = never
+}
+
+func (r *recorder) importer(statePath string, checkpoint int) *Importer {
+	return &Importer{
+		Handle: func(pkt core.RawPacket) error {
+			if r.failAt > 0 && len(r.handled)+1 == r.failAt {
+				return errors.New("collector unreachable")
+			}
+			r.handled = append(r.handled, pkt.Data[0])
+			return nil
+		},
+		Flush: func(context.Context) error {
+			r.flushed = len(r.handled)
+			return nil
+		},
+		StatePath:  statePath,
+		Checkpoint: checkpoint,
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "b.pcap", 1, layers.LinkTypeEthernet)
+	writePcap(t, dir, "sub/a.PCAP", 1, layers.LinkTypeEthernet)
+	writePcap(t, dir, "a.cap", 1, layers.LinkTypeEthernet)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644)
+
+	files, err := Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		got = append(got, rel)
+	}
+	if want := "a.cap,b.pcap,sub/a.PCAP"; strings.Join(got, ",") != want {
+		t.Errorf("Files = %v, want %s", got, want)
+	}
+}
+
+func TestRun_ImportAndSkipDone(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "001.pcap", 5, layers.LinkTypeEthernet)
+	writePcap(t, dir, "002.pcap", 3, layers.LinkTypeEthernet)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	r := &recorder{}
+	im := r.importer(statePath, 2)
+	var reports []Progress
+	im.Progress = func(p Progress) { reports = append(reports, p) }
+	sum, err := im.Run(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Files != 2 || sum.Imported != 2 || sum.Packets != 8 || len(r.handled) != 8 || r.flushed != 8 {
+		t.Fatalf("summary %+v, handled %d, flushed %d", sum, len(r.handled), r.flushed)
+	}
+	// 001: checkpoints at 2 and 4, end at 5; 002: checkpoint at 2, end at 3
+	if len(reports) != 5 || !reports[2].FileDone || reports[2].FilePackets != 5 || reports[4].Packets != 8 {
+		t.Errorf("progress = %+v", reports)
+	}
+
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := state.Files["002.pcap"]; s == nil || !s.Done || s.Packets != 3 {
+		t.Errorf("state of 002.pcap = %+v", s)
+	}
+
+	// A rerun finds nothing left to do
+	r = &recorder{}
+	sum, err = r.importer(statePath, 2).Run(context.Background(), dir)
+	if err != nil || sum.Skipped != 2 || sum.Packets != 0 || len(r.handled) != 0 {
+		t.Errorf("rerun: summary %+v, err %v, handled %d", sum, err, len(r.handled))
+	}
+}
+
+func TestRun_ResumeAfterFailure(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "001.pcap", 7, layers.LinkTypeEthernet)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	// Packet 6 fails: the checkpoint at 4 is the last one recorded
+	r := &recorder{failAt: 6}
+	if _, err := r.importer(statePath, 2).Run(context.Background(), dir); err == nil || !strings.Contains(err.Error(), "001.pcap: collector unreachable") {
+		t.Fatalf("Run = %v, want the handler error", err)
+	}
+
+	r = &recorder{}
+	sum, err := r.importer(statePath, 2).Run(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.handled) != "\x05\x06\x07" || sum.Packets != 3 || sum.Imported != 1 {
+		t.Errorf("resumed with packets %v, summary %+v", r.handled, sum)
+	}
+}
+
+func TestRun_ResumeReplays(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "001.pcap", 3, layers.LinkTypeEthernet)
+	writePcap(t, dir, "002.pcap", 7, layers.LinkTypeEthernet)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	// 002.pcap packet 6 fails: 001.pcap is done, 002.pcap checkpointed at 4
+	r := &recorder{failAt: 9}
+	if _, err := r.importer(statePath, 2).Run(context.Background(), dir); err == nil {
+		t.Fatal("Run succeeded, want the handler error")
+	}
+
+	r = &recorder{}
+	im := r.importer(statePath, 2)
+	var replayed []byte
+	im.Replay = func(pkt core.RawPacket) { replayed = append(replayed, pkt.Data[0]) }
+	sum, err := im.Run(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the earlier run's packets in file order, then the rest is handled
+	if string(replayed) != "\x01\x02\x03\x01\x02\x03\x04" || sum.Replayed != 7 {
+		t.Errorf("replayed %v, summary %+v", replayed, sum)
+	}
+	if string(r.handled) != "\x05\x06\x07" || sum.Packets != 3 {
+		t.Errorf("handled %v, summary %+v", r.handled, sum)
+	}
+}
+
+func TestRun_CancelCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "001.pcap", 10, layers.LinkTypeEthernet)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &recorder{}
+	im := r.importer(statePath, 100)
+	handle := im.Handle
+	im.Handle = func(pkt core.RawPacket) error {
+		if err := handle(pkt); err != nil {
+			return err
+		}
+		if len(r.handled) == 3 {
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	}
+	if _, err := im.Run(ctx, dir); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run = %v, want context.Canceled", err)
+	}
+	state, err := LoadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packet 3 was handled before the cancellation surfaced as its error,
+	// but is not counted: the importer cannot tell it was delivered.
+	if s := state.Files["001.pcap"]; s == nil || s.Done || s.Packets != 2 || r.flushed != 3 {
+		t.Errorf("state after cancel = %+v, flushed %d", s, r.flushed)
+	}
+}
+
+func TestRun_TruncatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writePcap(t, dir, "001.pcap", 3, layers.LinkTypeEthernet)
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-10); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &recorder{}
+	sum, err := r.importer("", 0).Run(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Truncated != 1 || sum.Imported != 1 || len(r.handled) != 2 {
+		t.Errorf("summary %+v, handled %d", sum, len(r.handled))
+	}
+}
+
+func TestRun_UnsupportedLinkType(t *testing.T) {
+	dir := t.TempDir()
+	writePcap(t, dir, "any.pcap", 1, layers.LinkTypeLinuxSLL)
+
+	r := &recorder{}
+	_, err := r.importer("", 0).Run(context.Background(), dir)
+	if !errors.Is(err, core.ErrConfig) {
+		t.Errorf("Run = %v, want a link type error", err)
+	}
+}
+
+func TestLoadState_Missing(t *testing.T) {
+	s, err := LoadState(filepath.Join(t.TempDir(), "none.json"))
+	if err != nil || s.Files == nil || len(s.Files) != 0 {
+		t.Errorf("LoadState = %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Priority ranks output packets when the task's send buffer backs up.
+type Priority uint8
+
+const (
+	PriorityNormal Priority = iota // dropped only when the buffer is full
+	PriorityLow                    // shed first, once the buffer passes the shed threshold
+	PriorityHigh                   // waits for space instead of being dropped
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// DropPolicy decides which packets a pipeline drops when the send buffer
+// backs up, by payload type: low-priority packets (media) are shed early so
+// the remaining headroom is left to the others, and high-priority packets
+// (signaling) wait for the sender instead of being dropped.
+//
+// Without a policy every packet is normal: dropped only when the buffer is
+// full.
+type DropPolicy struct {
+	priorities map[string]Priority // by OutputPacket.PayloadType
+	shedAbove  float64             // buffer fill ratio from which low-priority packets are shed
+	highWait   time.Duration       // longest a high-priority packet waits for space
+}
+
+// NewDropPolicy creates a policy. shedAbove is a fraction of the send buffer
+// in (0, 1]; highWait bounds how long a pipeline stalls for one packet.
+func NewDropPolicy(high, low []string, shedAbove float64, highWait time.Duration) *DropPolicy {
+	p := &DropPolicy{
+		priorities: make(map[string]Priority, len(high)+len(low)),
+		shedAbove:  shedAbove,
+		highWait:   highWait,
+	}
+	for _, t := range low {
+		p.priorities[t] = PriorityLow
+	}
+	for _, t := range high {
+		p.priorities[t] = PriorityHigh
+	}
+	return p
+}
+
+// Priority returns the priority of a payload type.
+func (p *DropPolicy) Priority(payloadType string) Priority {
+	if p == nil {
+		return PriorityNormal
+	}
+	return p.priorities[payloadType]
+}
+
+// shed reports whether a low-priority packet is shed at the buffer's fill.
+func (p *DropPolicy) shed(queued, capacity int) bool {
+	return float64(queued) >= p.shedAbove*float64(capacity)
+}
+
+// dropCounters caches otus_send_drops_total per priority.
+type dropCounters [3]prometheus.Counter
+
+func newDropCounters(taskID string, pipelineID int) dropCounters {
+	var c dropCounters
+	for _, prio := range []Priority{PriorityNormal, PriorityLow, PriorityHigh} {
+		c[prio] = metrics.SendDropsTotal.WithLabelValues(taskID, strconv.Itoa(pipelineID), prio.String())
+	}
+	return c
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestPipeline_DropPolicy(t *testing.T) {
+	policy := NewDropPolicy([]string{"sip"}, []string{"rtp"}, 0.5, 20*time.Millisecond)
+	p := New(Config{TaskID: "drop-task", Decoder: NewMockDecoder(), DropPolicy: policy})
+	ctx := context.Background()
+	output := make(chan core.OutputPacket, 4)
+	send := func(payloadType string) {
+		if !p.send(ctx, output, core.OutputPacket{PayloadType: payloadType}) {
+			t.Fatal("send returned false with a live context")
+		}
+	}
+
+	// Below the shed threshold everything is admitted.
+	send("rtp")
+	send("raw")
+	if len(output) != 2 {
+		t.Fatalf("queued = %d, want 2", len(output))
+	}
+
+	// At half full, media is shed while other packets still get in.
+	send("rtp")
+	send("raw")
+	if len(output) != 3 || p.dropCount.Load() != 1 {
+		t.Fatalf("queued = %d, dropped = %d; want 3 and 1 (rtp shed)", len(output), p.dropCount.Load())
+	}
+	send("sip")
+	if len(output) != 4 {
+		t.Fatalf("queued = %d, want 4", len(output))
+	}
+
+	// Full: normal packets are dropped, signaling waits for the sender.
+	send("raw")
+	if p.dropCount.Load() != 2 {
+		t.Errorf("dropped = %d, want 2", p.dropCount.Load())
+	}
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		<-output
+	}()
+	send("sip")
+	if p.dropCount.Load() != 2 || len(output) != 4 {
+		t.Errorf("sip was not admitted after waiting: dropped = %d, queued = %d", p.dropCount.Load(), len(output))
+	}
+
+	// A sender that does not drain within high_wait drops signaling too.
+	start := time.Now()
+	send("sip")
+	if p.dropCount.Load() != 3 || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("dropped = %d after %v, want 3 after high_wait", p.dropCount.Load(), time.Since(start))
+	}
+}
+
+func TestPipeline_NoDropPolicy(t *testing.T) {
+	p := New(Config{TaskID: "drop-task", Decoder: NewMockDecoder()})
+	output := make(chan core.OutputPacket, 1)
+	p.send(context.Background(), output, core.OutputPacket{PayloadType: "sip"})
+
+	// Without a policy a full output drops every payload type immediately.
+	start := time.Now()
+	p.send(context.Background(), output, core.OutputPacket{PayloadType: "sip"})
+	if p.dropCount.Load() != 1 || time.Since(start) > 10*time.Millisecond {
+		t.Errorf("dropped = %d after %v, want an immediate drop", p.dropCount.Load(), time.Since(start))
+	}
+}
@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// HardenedParser runs a task parser in hardened mode, for traffic that may be
+// malformed on purpose, e.g. from scanners: a panic in the parser fails only
+// the packet, payloads are truncated before the parser sees them and the
+// offending payloads can be kept for offline fuzzing.
+type HardenedParser struct {
+	MaxPayload int     // bytes offered to the parser, 0 = no limit
+	Corpus     *Corpus // optional, keeps offending payloads
+}
+
+// errParserPanic is the parse error of a packet the parser panicked on.
+var errParserPanic = errors.New("parser panicked")
+
+// Reasons a payload is kept in the corpus.
+const (
+	corpusPanic     = "panic"
+	corpusTruncated = "truncated"
+)
+
+// hardenedRunner applies one HardenedParser and caches its counters.
+type hardenedRunner struct {
+	taskID     string
+	parser     plugin.Parser
+	maxPayload int
+	corpus     *Corpus
+	truncated  prometheus.Counter
+	panics     atomic.Uint64 // for sampled logging
+}
+
+// newHardenedRunners returns one runner per parser, nil where the parser is
+// not hardened.
+func newHardenedRunners(taskID string, parsers []plugin.Parser, hardened []*HardenedParser) []*hardenedRunner {
+	out := make([]*hardenedRunner, len(parsers))
+	for i, h := range hardened {
+		if h == nil || i >= len(parsers) {
+			continue
+		}
+		out[i] = &hardenedRunner{
+			taskID:     taskID,
+			parser:     parsers[i],
+			maxPayload: h.MaxPayload,
+			corpus:     h.Corpus,
+			truncated:  metrics.ParserTruncatedTotal.WithLabelValues(taskID, parsers[i].Name()),
+		}
+	}
+	return out
+}
+
+// handle runs CanHandle and Handle on pkt, truncated to the payload limit.
+// hit reports whether the parser accepted the packet; a panic in either call
+// counts as a hit failing with errParserPanic.
+func (r *hardenedRunner) handle(pkt *core.DecodedPacket) (payload any, labels core.Labels, hit bool, err error) {
+	if r.maxPayload > 0 && len(pkt.Payload) > r.maxPayload {
+		r.truncated.Inc()
+		r.corpus.Add(r.parser.Name(), corpusTruncated, pkt.Payload)
+		truncated := *pkt
+		truncated.Payload = pkt.Payload[:r.maxPayload:r.maxPayload]
+		pkt = &truncated
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			payload, labels, hit, err = nil, nil, true, errParserPanic
+			r.recovered(v, pkt.Payload)
+		}
+	}()
+	if !r.parser.CanHandle(pkt) {
+		return nil, nil, false, nil
+	}
+	payload, labels, err = r.parser.Handle(pkt)
+	return payload, labels, true, err
+}
+
+// recovered logs a parser panic, sampled, and keeps the payload.
+func (r *hardenedRunner) recovered(v any, payload []byte) {
+	if n := r.panics.Add(1); n%1000 == 1 {
+		slog.Warn("parser panicked, packet dropped",
+			"task_id", r.taskID, "parser", r.parser.Name(),
+			"panic", fmt.Sprint(v), "total_panics", n,
+			"stack", string(debug.Stack()))
+	}
+	r.corpus.Add(r.parser.Name(), corpusPanic, payload)
+}
+
+// Corpus keeps redacted payloads a hardened parser panicked on or truncated,
+// one file per distinct payload, as seeds for offline fuzzing. It is shared
+// by the pipelines of a task and stops adding files at its limit.
+type Corpus struct {
+	dir      string
+	maxFiles int
+
+	mu    sync.Mutex
+	files int // files in dir, including those of earlier runs
+	full  bool
+}
+
+// NewCorpus creates dir if needed and returns a corpus keeping at most
+// maxFiles files in it.
+func NewCorpus(dir string, maxFiles int) (*Corpus, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("parser corpus: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("parser corpus: %w", err)
+	}
+	return &Corpus{dir: dir, maxFiles: maxFiles, files: len(entries)}, nil
+}
+
+// Add writes the redacted payload to <parser>-<reason>-<hash>; payloads
+// already in the corpus are skipped. Add on a nil Corpus does nothing.
+func (c *Corpus) Add(parser, reason string, payload []byte) {
+	if c == nil {
+		return
+	}
+	data := RedactPayload(payload)
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("%s-%s-%s", parser, reason, hex.EncodeToString(sum[:8]))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.full {
+		return
+	}
+	if c.files >= c.maxFiles {
+		c.full = true
+		slog.Warn("parser corpus full, not keeping more payloads", "dir", c.dir, "max_files", c.maxFiles)
+		return
+	}
+
+	f, err := os.OpenFile(filepath.Join(c.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if errors.Is(err, fs.ErrExist) {
+		return
+	}
+	if err == nil {
+		_, err = f.Write(data)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		slog.Warn("parser corpus write failed", "dir", c.dir, "error", err)
+		return
+	}
+	c.files++
+	slog.Info("parser payload kept in corpus", "parser", parser, "reason", reason, "file", name)
+}
+
+// Headers whose values carry credentials, lower-cased.
+var credentialHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"www-authenticate":    true,
+	"proxy-authenticate":  true,
+	"authentication-info": true,
+}
+
+// RedactPayload returns a copy of a SIP/SDP payload with the values of
+// credential headers, SDP k= lines, SDES inline keys and the user parts of
+// sip:, sips: and tel: URIs masked: digits become '0' and letters 'x'. The
+// length and all other bytes are kept, so the payload still exercises the
+// same parser paths.
+func RedactPayload(payload []byte) []byte {
+	out := bytes.Clone(payload)
+	for start := 0; start < len(out); {
+		end := bytes.IndexByte(out[start:], '\n')
+		if end < 0 {
+			end = len(out)
+		} else {
+			end += start
+		}
+		redactLine(out[start:end])
+		start = end + 1
+	}
+	return out
+}
+
+func redactLine(line []byte) {
+	if name, _, found := bytes.Cut(line, []byte(":")); found && credentialHeaders[string(bytes.ToLower(bytes.TrimSpace(name)))] {
+		mask(line[len(name)+1:])
+		return
+	}
+	if bytes.HasPrefix(line, []byte("k=")) {
+		mask(line[2:])
+		return
+	}
+	if i := bytes.Index(line, []byte("inline:")); i >= 0 && bytes.HasPrefix(line, []byte("a=crypto:")) {
+		key := line[i+len("inline:"):]
+		if end := bytes.IndexAny(key, "| \r"); end >= 0 {
+			key = key[:end]
+		}
+		mask(key)
+	}
+
+	lower := bytes.ToLower(line)
+	for _, scheme := range []string{"sip:", "sips:", "tel:"} {
+		for off := 0; ; {
+			i := bytes.Index(lower[off:], []byte(scheme))
+			if i < 0 {
+				break
+			}
+			user := line[off+i+len(scheme):]
+			off += i + len(scheme)
+			end := bytes.IndexAny(user, "@>;, \t\r\"")
+			if end < 0 {
+				end = len(user)
+			}
+			switch {
+			case scheme == "tel:":
+				mask(user[:end])
+			case end < len(user) && user[end] == '@':
+				mask(user[:end])
+			case end < len(user) && user[end] == ';':
+				// user parameters: the user part still ends at '@'
+				if at := bytes.IndexAny(user, "@> \t\r"); at >= 0 && user[at] == '@' {
+					mask(user[:at])
+				}
+			}
+		}
+	}
+}
+
+// mask replaces digits with '0' and letters with 'x' in place.
+func mask(b []byte) {
+	for i, c := range b {
+		switch {
+		case c >= '0' && c <= '9':
+			b[i] = '0'
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			b[i] = 'x'
+		}
+	}
+}
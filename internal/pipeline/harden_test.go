@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// panickingParser panics on payloads starting with "BOOM" and records the
+// payload length it was offered.
+type panickingParser struct {
+	MockParser
+	lastLen int
+}
+
+func (p *panickingParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
+	p.lastLen = len(pkt.Payload)
+	if bytes.HasPrefix(pkt.Payload, []byte("BOOM")) {
+		var labels core.Labels
+		labels["crash"] = "yes" // nil map write
+	}
+	return nil, core.Labels{"ok": "1"}, nil
+}
+
+func TestPipeline_HardenedParser(t *testing.T) {
+	dir := t.TempDir()
+	corpus, err := NewCorpus(dir, 10)
+	if err != nil {
+		t.Fatalf("NewCorpus: %v", err)
+	}
+	parser := &panickingParser{MockParser: *NewMockParser("hardened-sip", true)}
+	p := New(Config{
+		TaskID:   "hardened-task",
+		Decoder:  NewMockDecoder(),
+		Parsers:  []plugin.Parser{parser},
+		Hardened: []*HardenedParser{{MaxPayload: 16, Corpus: corpus}},
+	})
+
+	boom := "BOOM sip:alice@example.com"
+	for _, payload := range []string{boom, boom, "INVITE", strings.Repeat("A", 40)} {
+		p.processPacket(core.RawPacket{Data: []byte(payload)})
+	}
+
+	if got := testutil.ToFloat64(p.parserStat[0].errorsByReason[reasonPanic]); got != 2 {
+		t.Errorf("panic errors = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(p.parserStat[0].success); got != 2 {
+		t.Errorf("success = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(p.hardened[0].truncated); got != 3 {
+		t.Errorf("truncated = %v, want 3", got)
+	}
+	if parser.lastLen != 16 {
+		t.Errorf("parser saw %d bytes, want 16", parser.lastLen)
+	}
+
+	// One file per distinct payload and reason: boom truncated, boom panic
+	// (on the truncated payload) and the long payload.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("corpus has %d files, want 3", len(entries))
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("alice")) {
+			t.Errorf("%s not redacted: %q", e.Name(), data)
+		}
+	}
+}
+
+func TestCorpus_MaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "seed"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	corpus, err := NewCorpus(dir, 3)
+	if err != nil {
+		t.Fatalf("NewCorpus: %v", err)
+	}
+	for _, payload := range []string{"a", "a", "b", "c", "d"} {
+		corpus.Add("sip", corpusPanic, []byte(payload))
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("corpus has %d files, want 3 (seed, a, b)", len(entries))
+	}
+
+	var nilCorpus *Corpus
+	nilCorpus.Add("sip", corpusPanic, []byte("a")) // must not panic
+}
+
+func TestRedactPayload(t *testing.T) {
+	in := "INVITE sip:+4930123@example.com;user=phone SIP/2.0\r\n" +
+		"From: \"Alice\" <sip:alice;day=tue@example.com>;tag=1\r\n" +
+		"To: <tel:+4930999;phone-context=example.com>\r\n" +
+		"Contact: <sip:example.com:5060>\r\n" +
+		"Proxy-Authorization: Digest username=\"alice\", response=\"9f1c\"\r\n" +
+		"\r\n" +
+		"k=base64:abc123\r\n" +
+		"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:abcDEF123=|2^20|1:32\r\n"
+	want := "INVITE sip:+0000000@example.com;user=phone SIP/2.0\r\n" +
+		"From: \"Alice\" <sip:xxxxx;xxx=xxx@example.com>;tag=1\r\n" +
+		"To: <tel:+0000000;phone-context=example.com>\r\n" +
+		"Contact: <sip:example.com:5060>\r\n" +
+		"Proxy-Authorization: xxxxxx xxxxxxxx=\"xxxxx\", xxxxxxxx=\"0x0x\"\r\n" +
+		"\r\n" +
+		"k=xxxx00:xxx000\r\n" +
+		"a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:xxxxxx000=|2^20|1:32\r\n"
+
+	got := RedactPayload([]byte(in))
+	if string(got) != want {
+		t.Errorf("RedactPayload =\n%s\nwant\n%s", got, want)
+	}
+}
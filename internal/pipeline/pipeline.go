@@ -3,15 +3,28 @@ package pipeline
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"time"
 
+	"firestige.xyz/otus/internal/calls"
 	"firestige.xyz/otus/internal/core"
 	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/featureflag"
 	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/orderlog"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/internal/streamtable"
+	"firestige.xyz/otus/internal/tcpanalysis"
+	"firestige.xyz/otus/internal/tlsdecrypt"
+	"firestige.xyz/otus/internal/topk"
 	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // Pipeline represents a single-threaded packet processing chain.
@@ -24,10 +37,30 @@ type Pipeline struct {
 	decoder    decoder.Decoder
 	parsers    []plugin.Parser
 	processors []plugin.Processor
+	calls      *calls.Table          // nil when the task has no call table
+	topK       *topk.Tracker         // nil when the task tracks no heavy hitters
+	tcp        *tcpanalysis.Tracker  // nil when the task does not analyze TCP
+	tls        *tlsdecrypt.Decryptor // nil when the task does not decrypt TLS
+	streams    *streamtable.Table    // nil when the task does not correlate RTCP
+	quality    *qualityalert.Monitor // nil when the task raises no quality alerts
+	orderLog   *orderlog.Writer      // nil unless the task records packet order
+	flags      *featureflag.Set      // nil = defaults
+	meta       core.MetaFields
 	metrics    *Metrics
-	dropCount  atomic.Uint64 // total drops for sampled logging
+	parserStat []parserCounters  // per-parser Prometheus counters, same order as parsers
+	shadows    []*shadowRunner   // per-parser shadow, same order as parsers, nil = none
+	hardened   []*hardenedRunner // per-parser hardening, same order as parsers, nil = none
+	flushers   []int             // indexes of processors implementing plugin.FlushingProcessor
+	dropCount  atomic.Uint64     // total drops for sampled logging
+	dropPolicy *DropPolicy       // nil = drop only when the output is full
+	dropStat   dropCounters      // otus_send_drops_total by priority
+	busy       atomic.Int64      // nanoseconds spent processing, see Busy
 }
 
+// totalBusy is the busy time of all pipelines of the process, the
+// denominator when attributing process-wide allocations to tasks.
+var totalBusy atomic.Int64
+
 // Config contains pipeline configuration.
 type Config struct {
 	ID         int
@@ -36,6 +69,18 @@ type Config struct {
 	Decoder    decoder.Decoder
 	Parsers    []plugin.Parser
 	Processors []plugin.Processor
+	Shadows    []*ShadowParser       // optional, same order as Parsers, nil = no shadow
+	Hardened   []*HardenedParser     // optional, same order as Parsers, nil = not hardened
+	Calls      *calls.Table          // optional task-level active-calls table
+	TopK       *topk.Tracker         // optional task-level heavy-hitter tracker
+	TCP        *tcpanalysis.Tracker  // optional task-level TCP segment analysis
+	TLS        *tlsdecrypt.Decryptor // optional task-level TLS decryption
+	Streams    *streamtable.Table    // optional task-level RTP stream table
+	Quality    *qualityalert.Monitor // optional task-level call quality alerts
+	OrderLog   *orderlog.Writer      // optional packet order log, closed when Run returns
+	Flags      *featureflag.Set      // optional task feature flags, nil = defaults
+	Meta       core.MetaFields       // decoded fields copied into OutputPacket.Meta
+	DropPolicy *DropPolicy           // optional priority-aware admission to the output
 }
 
 // New creates a new pipeline.
@@ -47,7 +92,85 @@ func New(cfg Config) *Pipeline {
 		decoder:    cfg.Decoder,
 		parsers:    cfg.Parsers,
 		processors: cfg.Processors,
+		calls:      cfg.Calls,
+		topK:       cfg.TopK,
+		tcp:        cfg.TCP,
+		tls:        cfg.TLS,
+		streams:    cfg.Streams,
+		quality:    cfg.Quality,
+		orderLog:   cfg.OrderLog,
+		flags:      cfg.Flags,
+		meta:       cfg.Meta,
 		metrics:    NewMetrics(cfg.TaskID, cfg.ID),
+		parserStat: newParserCounters(cfg.TaskID, cfg.Parsers),
+		shadows:    newShadowRunners(cfg.TaskID, cfg.Parsers, cfg.Shadows),
+		hardened:   newHardenedRunners(cfg.TaskID, cfg.Parsers, cfg.Hardened),
+		flushers:   flushingProcessors(cfg.Processors),
+		dropPolicy: cfg.DropPolicy,
+		dropStat:   newDropCounters(cfg.TaskID, cfg.ID),
+	}
+}
+
+// processorFlushInterval is how often Run flushes processors that hold packets back.
+const processorFlushInterval = time.Second
+
+func flushingProcessors(processors []plugin.Processor) []int {
+	var idx []int
+	for i, proc := range processors {
+		if _, ok := proc.(plugin.FlushingProcessor); ok {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// Parser error reasons reported in otus_parser_errors_total.
+const (
+	reasonTooShort   = "too_short"
+	reasonBadVersion = "bad_version"
+	reasonParseError = "parse_error"
+	reasonPanic      = "panic"
+)
+
+// parserCounters caches the labelled counters of one parser so the hot path
+// avoids a label lookup per packet.
+type parserCounters struct {
+	hit, miss, success, errored, ignored prometheus.Counter
+	errorsByReason                       map[string]prometheus.Counter
+}
+
+func newParserCounters(taskID string, parsers []plugin.Parser) []parserCounters {
+	out := make([]parserCounters, len(parsers))
+	for i, parser := range parsers {
+		name := parser.Name()
+		out[i] = parserCounters{
+			hit:     metrics.ParserPacketsTotal.WithLabelValues(taskID, name, "hit"),
+			miss:    metrics.ParserPacketsTotal.WithLabelValues(taskID, name, "miss"),
+			success: metrics.ParserPacketsTotal.WithLabelValues(taskID, name, "success"),
+			errored: metrics.ParserPacketsTotal.WithLabelValues(taskID, name, "error"),
+			ignored: metrics.ParserPacketsTotal.WithLabelValues(taskID, name, "ignored"),
+			errorsByReason: map[string]prometheus.Counter{
+				reasonTooShort:   metrics.ParserErrorsTotal.WithLabelValues(taskID, name, reasonTooShort),
+				reasonBadVersion: metrics.ParserErrorsTotal.WithLabelValues(taskID, name, reasonBadVersion),
+				reasonParseError: metrics.ParserErrorsTotal.WithLabelValues(taskID, name, reasonParseError),
+				reasonPanic:      metrics.ParserErrorsTotal.WithLabelValues(taskID, name, reasonPanic),
+			},
+		}
+	}
+	return out
+}
+
+// parseErrorReason buckets a parser error by the core sentinel it wraps.
+func parseErrorReason(err error) string {
+	switch {
+	case errors.Is(err, core.ErrPacketTooShort):
+		return reasonTooShort
+	case errors.Is(err, core.ErrBadVersion):
+		return reasonBadVersion
+	case errors.Is(err, errParserPanic):
+		return reasonPanic
+	default:
+		return reasonParseError
 	}
 }
 
@@ -62,41 +185,146 @@ func (p *Pipeline) Run(ctx context.Context, input <-chan core.RawPacket, output
 		slog.Info("pipeline stopped", "task_id", p.taskID, "pipeline_id", p.id)
 	}()
 
+	if p.orderLog != nil {
+		defer func() {
+			if err := p.orderLog.Close(); err != nil {
+				slog.Warn("order log close error", "task_id", p.taskID, "pipeline_id", p.id, "error", err)
+			}
+		}()
+	}
+
+	// Only pipelines with flushing processors need the ticker.
+	var flushTick <-chan time.Time
+	if len(p.flushers) > 0 {
+		ticker := time.NewTicker(processorFlushInterval)
+		defer ticker.Stop()
+		flushTick = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 
+		case now := <-flushTick:
+			if !p.flush(ctx, output, now, false) {
+				return
+			}
+
 		case raw, ok := <-input:
 			if !ok {
-				// Input stream closed
+				// Input stream closed: release what processors still hold
+				p.flush(ctx, output, time.Now(), true)
 				return
 			}
 
-			p.metrics.Received.Add(1)
+			if p.orderLog != nil {
+				p.orderLog.Record(raw)
+			}
 
 			// Process packet synchronously (zero channel internal passing)
-			if result, ok := p.processPacket(raw); ok {
-				// Non-blocking send to output
-				select {
-				case output <- result:
-					// Sent successfully
-				case <-ctx.Done():
+			if result, ok := p.Process(raw); ok {
+				if !p.send(ctx, output, result) {
 					return
-				default:
-					// Output channel full, drop packet
-					p.metrics.Dropped.Add(1)
-					if p.dropCount.Add(1)%1000 == 1 {
-						slog.Warn("pipeline output full, dropping packets",
-							"task_id", p.taskID, "pipeline_id", p.id,
-							"total_dropped", p.dropCount.Load())
-					}
 				}
 			}
 		}
 	}
 }
 
+// send hands a packet to the output, dropping it when the output is full.
+// Under a drop policy low-priority packets are dropped earlier and
+// high-priority ones wait for space first. It returns false once ctx is done.
+func (p *Pipeline) send(ctx context.Context, output chan<- core.OutputPacket, pkt core.OutputPacket) bool {
+	prio := p.dropPolicy.Priority(pkt.PayloadType)
+	if prio == PriorityLow && p.dropPolicy.shed(len(output), cap(output)) {
+		p.drop(prio)
+		return true
+	}
+
+	select {
+	case output <- pkt:
+		return true
+	case <-ctx.Done():
+		return false
+	default:
+	}
+
+	if prio == PriorityHigh {
+		timer := time.NewTimer(p.dropPolicy.highWait)
+		defer timer.Stop()
+		select {
+		case output <- pkt:
+			return true
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+	}
+
+	// Output channel full, drop packet
+	p.drop(prio)
+	return true
+}
+
+// drop counts a packet dropped at the output.
+func (p *Pipeline) drop(prio Priority) {
+	p.metrics.Dropped.Add(1)
+	p.dropStat[prio].Inc()
+	if p.dropCount.Add(1)%1000 == 1 {
+		slog.Warn("pipeline output full, dropping packets",
+			"task_id", p.taskID, "pipeline_id", p.id,
+			"priority", prio.String(),
+			"total_dropped", p.dropCount.Load())
+	}
+}
+
+// flush collects the packets released by flushing processors and passes each
+// through the processors after the one that released it. It returns false
+// once ctx is done.
+func (p *Pipeline) flush(ctx context.Context, output chan<- core.OutputPacket, now time.Time, final bool) bool {
+	defer p.addBusy(time.Now())
+	pipelineID := strconv.Itoa(p.id)
+	for _, i := range p.flushers {
+		for _, pkt := range p.processors[i].(plugin.FlushingProcessor).Flush(now, final) {
+			if !p.runProcessors(&pkt, i+1, pipelineID) {
+				continue
+			}
+			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "output").Inc()
+			if !p.send(ctx, output, pkt) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Process runs one packet through the decode→parse→process chain outside of
+// Run, e.g. for offline replay. It must not be called concurrently with Run.
+func (p *Pipeline) Process(raw core.RawPacket) (core.OutputPacket, bool) {
+	defer p.addBusy(time.Now())
+	p.metrics.Received.Add(1)
+	return p.processPacket(raw)
+}
+
+func (p *Pipeline) addBusy(start time.Time) {
+	d := int64(time.Since(start))
+	p.busy.Add(d)
+	totalBusy.Add(d)
+}
+
+// Busy returns the time the pipeline spent processing packets and flushing
+// processors. Pipelines are CPU-bound, so it approximates the CPU time of the
+// pipeline goroutine.
+func (p *Pipeline) Busy() time.Duration {
+	return time.Duration(p.busy.Load())
+}
+
+// TotalBusy returns the busy time of all pipelines of the process.
+func TotalBusy() time.Duration {
+	return time.Duration(totalBusy.Load())
+}
+
 // processPacket processes a single packet through the entire pipeline.
 // Returns the output packet and a boolean indicating whether to forward it.
 func (p *Pipeline) processPacket(raw core.RawPacket) (core.OutputPacket, bool) {
@@ -118,6 +346,29 @@ func (p *Pipeline) processPacket(raw core.RawPacket) (core.OutputPacket, bool) {
 	decodeLatency := time.Since(startTime).Seconds()
 	metrics.PipelineLatencySeconds.WithLabelValues(p.taskID, "decode").Observe(decodeLatency)
 
+	// TLS segments are replaced by their decrypted application data; those
+	// carrying none (handshake, partial records) are dropped. Application
+	// data that cannot be decrypted passes through unchanged.
+	var tlsPlain tlsdecrypt.Plaintext
+	segment := &decoded // as captured, for TCP analysis
+	if p.tls != nil && decoded.Transport.Protocol == 6 {
+		pt, ok := p.tls.Decrypt(&decoded)
+		if ok && len(pt.Data) == 0 {
+			if p.tcp != nil {
+				p.tcp.Observe(&decoded, make(core.Labels)) // keep the segment in the TCP state
+			}
+			p.metrics.Dropped.Add(1)
+			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "dropped").Inc()
+			return core.OutputPacket{}, false
+		}
+		if ok {
+			encrypted := decoded
+			segment = &encrypted
+			tlsPlain = pt
+			decoded.Payload = pt.Data
+		}
+	}
+
 	// Step 2: Parse application layer
 	parseStart := time.Now()
 	var parsedPayload any
@@ -125,28 +376,31 @@ func (p *Pipeline) processPacket(raw core.RawPacket) (core.OutputPacket, bool) {
 	var payloadType string
 	var parserMatched bool
 
-	for _, parser := range p.parsers {
-		if parser.CanHandle(&decoded) {
-			payload, labels, err := parser.Handle(&decoded)
-			if err != nil {
-				p.metrics.ParseErrors.Add(1)
-				metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "parse_error").Inc()
-				slog.Debug("parser failed", "parser", parser.Name(), "error", err)
-				continue
-			}
-
-			// Use first successful parser.
-			// Note: parsedPayload may be nil (e.g. SIP parser returns nil — raw bytes are
-			// preserved in OutputPacket.RawPayload). parserMatched tracks whether a parser
-			// succeeded regardless of the payload value.
-			parsedPayload = payload
-			parsedLabels = labels
-			payloadType = parser.Name()
-			parserMatched = true
-			p.metrics.Parsed.Add(1)
-			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "parsed").Inc()
-			break
+	for i, parser := range p.parsers {
+		payload, labels, ok, ignored := p.parse(i, &decoded, pipelineID)
+		if ignored {
+			p.metrics.Dropped.Add(1)
+			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "dropped").Inc()
+			return core.OutputPacket{}, false
+		}
+		if shadow := p.shadows[i]; shadow != nil && p.flags.Enabled(featureflag.ShadowParsers) {
+			shadow.compare(&decoded, ok, labels)
+		}
+		if !ok {
+			continue
 		}
+
+		// Use first successful parser.
+		// Note: parsedPayload may be nil (e.g. SIP parser returns nil — raw bytes are
+		// preserved in OutputPacket.RawPayload). parserMatched tracks whether a parser
+		// succeeded regardless of the payload value.
+		parsedPayload = payload
+		parsedLabels = labels
+		payloadType = parser.Name()
+		parserMatched = true
+		p.metrics.Parsed.Add(1)
+		metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "parsed").Inc()
+		break
 	}
 
 	// Measure parse latency
@@ -174,23 +428,69 @@ func (p *Pipeline) processPacket(raw core.RawPacket) (core.OutputPacket, bool) {
 		SrcPort:     decoded.Transport.SrcPort,
 		DstPort:     decoded.Transport.DstPort,
 		Protocol:    decoded.IP.Protocol,
+		Meta:        p.meta.Extract(&decoded),
 		Labels:      parsedLabels,
 		PayloadType: payloadType,
 		Payload:     parsedPayload,
 		RawPayload:  decoded.Payload,
 	}
 
+	// TCP labels come before processors so they can act on them.
+	if p.tcp != nil && decoded.Transport.Protocol == 6 {
+		if output.Labels == nil {
+			output.Labels = make(core.Labels)
+		}
+		p.tcp.Observe(segment, output.Labels)
+	}
+
+	if tlsPlain.Version != "" {
+		if output.Labels == nil {
+			output.Labels = make(core.Labels)
+		}
+		output.Labels[core.LabelTLSVersion] = tlsPlain.Version
+		output.Labels[core.LabelTLSCipherSuite] = tlsPlain.CipherSuite
+	}
+
+	// The GTP-U TEID correlates mobile user plane traffic with its bearer.
+	if decoded.TEID != 0 {
+		if output.Labels == nil {
+			output.Labels = make(core.Labels)
+		}
+		output.Labels[core.LabelGTPTEID] = fmt.Sprintf("0x%08x", decoded.TEID)
+	}
+
+	// SCTP stream IDs tell apart messages multiplexed on one association.
+	if streams := decoded.SCTP.Streams; len(streams) > 0 {
+		if output.Labels == nil {
+			output.Labels = make(core.Labels)
+		}
+		ids := make([]string, len(streams))
+		for i, id := range streams {
+			ids[i] = strconv.Itoa(int(id))
+		}
+		output.Labels[core.LabelSCTPStreamID] = strings.Join(ids, ",")
+		output.Labels[core.LabelSCTPPPID] = strconv.FormatUint(uint64(decoded.SCTP.PPID), 10)
+	}
+
+	// RTCP correlation labels come before processors so they can act on them.
+	if p.streams != nil && parserMatched {
+		p.streams.Observe(&output)
+	}
+
+	// Track call state before processors so filtering doesn't hide calls.
+	if p.calls != nil && parserMatched {
+		p.calls.Observe(&output)
+	}
+
+	// Quality alerts see every RTCP report, after the call table is updated.
+	if p.quality != nil && parserMatched {
+		p.quality.Observe(&output)
+	}
+
 	// Step 4: Process through processors
 	processStart := time.Now()
-	for _, processor := range p.processors {
-		keep := processor.Process(&output)
-		p.metrics.Processed.Add(1)
-		if !keep {
-			// Processor dropped packet
-			p.metrics.Dropped.Add(1)
-			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "dropped").Inc()
-			return core.OutputPacket{}, false
-		}
+	if !p.runProcessors(&output, 0, pipelineID) {
+		return core.OutputPacket{}, false
 	}
 
 	// Measure processor latency
@@ -203,11 +503,71 @@ func (p *Pipeline) processPacket(raw core.RawPacket) (core.OutputPacket, bool) {
 	totalLatency := time.Since(startTime).Seconds()
 	metrics.PipelineLatencySeconds.WithLabelValues(p.taskID, "total").Observe(totalLatency)
 
+	// Heavy hitters see packets after processors, e.g. with normalized numbers.
+	if p.topK != nil {
+		p.topK.Observe(&output)
+	}
+
 	metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "output").Inc()
 
 	return output, true
 }
 
+// runProcessors runs pkt through the processors from index from on and
+// reports whether it is kept.
+func (p *Pipeline) runProcessors(pkt *core.OutputPacket, from int, pipelineID string) bool {
+	for _, processor := range p.processors[from:] {
+		keep := processor.Process(pkt)
+		p.metrics.Processed.Add(1)
+		if !keep {
+			// Processor dropped packet
+			p.metrics.Dropped.Add(1)
+			metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "dropped").Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// parse offers the packet to parser i and counts the outcome; ok is false if
+// the parser rejected or failed on it, ignored is true if the parser's
+// configuration drops it (core.ErrIgnored).
+func (p *Pipeline) parse(i int, decoded *core.DecodedPacket, pipelineID string) (payload any, labels core.Labels, ok, ignored bool) {
+	parser, stat := p.parsers[i], &p.parserStat[i]
+	var err error
+	if h := p.hardened[i]; h != nil {
+		var hit bool
+		payload, labels, hit, err = h.handle(decoded)
+		if !hit {
+			stat.miss.Inc()
+			return nil, nil, false, false
+		}
+		stat.hit.Inc()
+	} else {
+		if !parser.CanHandle(decoded) {
+			stat.miss.Inc()
+			return nil, nil, false, false
+		}
+		stat.hit.Inc()
+		payload, labels, err = parser.Handle(decoded)
+	}
+	if errors.Is(err, core.ErrIgnored) {
+		stat.ignored.Inc()
+		return nil, nil, false, true
+	}
+	if err != nil {
+		reason := parseErrorReason(err)
+		stat.errored.Inc()
+		stat.errorsByReason[reason].Inc()
+		p.metrics.ParseErrors.Add(1)
+		metrics.PipelinePacketsTotal.WithLabelValues(p.taskID, pipelineID, "parse_error").Inc()
+		slog.Debug("parser failed", "parser", parser.Name(), "reason", reason, "error", err)
+		return nil, nil, false, false
+	}
+	stat.success.Inc()
+	return payload, labels, true, false
+}
+
 // Stats returns pipeline statistics.
 func (p *Pipeline) Stats() Stats {
 	return Stats{
@@ -234,11 +594,22 @@ func (p *Pipeline) Processors() []plugin.Processor {
 // Stats represents pipeline statistics.
 // Reporter statistics (Reported, ReportErrors) are tracked at Task level.
 type Stats struct {
-	Received     uint64
-	Decoded      uint64
-	DecodeErrors uint64
-	Parsed       uint64
-	ParseErrors  uint64
-	Processed    uint64
-	Dropped      uint64
+	Received     uint64 `json:"received"`
+	Decoded      uint64 `json:"decoded"`
+	DecodeErrors uint64 `json:"decode_errors"`
+	Parsed       uint64 `json:"parsed"`
+	ParseErrors  uint64 `json:"parse_errors"`
+	Processed    uint64 `json:"processed"`
+	Dropped      uint64 `json:"dropped"`
+}
+
+// Add accumulates other into s, for summing the pipelines of a task.
+func (s *Stats) Add(other Stats) {
+	s.Received += other.Received
+	s.Decoded += other.Decoded
+	s.DecodeErrors += other.DecodeErrors
+	s.Parsed += other.Parsed
+	s.ParseErrors += other.ParseErrors
+	s.Processed += other.Processed
+	s.Dropped += other.Dropped
 }
@@ -2,13 +2,18 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 	"net/netip"
 	"sync"
 	"testing"
 	"time"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/tlsdecrypt"
+	"firestige.xyz/otus/internal/topk"
 	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 // Mock implementations for testing
@@ -412,3 +417,311 @@ func TestPipeline_NoParser(t *testing.T) {
 		t.Errorf("Expected 1 received packet, got %d", stats.Received)
 	}
 }
+
+func TestParseErrorReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("rtp: payload too short (4 bytes): %w", core.ErrPacketTooShort), "too_short"},
+		{fmt.Errorf("rtp: unexpected RTP version 1: %w", core.ErrBadVersion), "bad_version"},
+		{core.ErrConfigInvalid, "parse_error"},
+	}
+	for _, tt := range tests {
+		if got := parseErrorReason(tt.err); got != tt.want {
+			t.Errorf("parseErrorReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestPipeline_ParserCounters(t *testing.T) {
+	miss := NewMockParser("counter-miss", false)
+	failing := NewMockParser("counter-fail", true)
+	failing.shouldFail = true
+	ok := NewMockParser("counter-ok", true)
+
+	p := New(Config{
+		TaskID:  "counter-task",
+		Decoder: NewMockDecoder(),
+		Parsers: []plugin.Parser{miss, failing, ok},
+	})
+	for i := 0; i < 3; i++ {
+		p.processPacket(core.RawPacket{Data: []byte("packet")})
+	}
+
+	counts := map[string]float64{
+		"counter-miss/miss":    testutil.ToFloat64(p.parserStat[0].miss),
+		"counter-fail/hit":     testutil.ToFloat64(p.parserStat[1].hit),
+		"counter-fail/error":   testutil.ToFloat64(p.parserStat[1].errored),
+		"counter-fail/reason":  testutil.ToFloat64(p.parserStat[1].errorsByReason[reasonParseError]),
+		"counter-ok/success":   testutil.ToFloat64(p.parserStat[2].success),
+		"counter-ok/no-errors": 3 - testutil.ToFloat64(p.parserStat[2].errored),
+	}
+	for name, got := range counts {
+		if got != 3 {
+			t.Errorf("%s = %v, want 3", name, got)
+		}
+	}
+}
+
+// ignoringParser recognises every packet and ignores it.
+type ignoringParser struct {
+	MockParser
+}
+
+func (m *ignoringParser) Handle(*core.DecodedPacket) (any, core.Labels, error) {
+	return nil, nil, fmt.Errorf("mock: %w", core.ErrIgnored)
+}
+
+func TestPipeline_ParserIgnored(t *testing.T) {
+	ignoring := &ignoringParser{MockParser: *NewMockParser("ignore", true)}
+	next := NewMockParser("ignore-next", true)
+
+	p := New(Config{
+		TaskID:  "ignore-task",
+		Decoder: NewMockDecoder(),
+		Parsers: []plugin.Parser{ignoring, next},
+	})
+	if _, ok := p.processPacket(core.RawPacket{Data: []byte("packet")}); ok {
+		t.Fatal("ignored packet was output")
+	}
+	if got := testutil.ToFloat64(p.parserStat[0].ignored); got != 1 {
+		t.Errorf("ignored = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(p.parserStat[0].errored); got != 0 {
+		t.Errorf("errored = %v, want 0", got)
+	}
+	if next.HandledCount() != 0 {
+		t.Error("ignored packet was offered to the next parser")
+	}
+	if got := p.metrics.Dropped.Load(); got != 1 {
+		t.Errorf("dropped = %d, want 1", got)
+	}
+}
+
+// countingProcessor holds packets back and releases one count packet per flush.
+type countingProcessor struct {
+	MockProcessor
+	held int
+}
+
+func (c *countingProcessor) Process(*core.OutputPacket) bool {
+	c.held++
+	return false
+}
+
+func (c *countingProcessor) Flush(_ time.Time, final bool) []core.OutputPacket {
+	if c.held == 0 {
+		return nil
+	}
+	out := core.OutputPacket{PayloadType: "count", Labels: core.Labels{"count": fmt.Sprint(c.held), "final": fmt.Sprint(final)}}
+	c.held = 0
+	return []core.OutputPacket{out}
+}
+
+func TestPipeline_FlushingProcessor(t *testing.T) {
+	inputChan := make(chan core.RawPacket, 10)
+	outputChan := make(chan core.OutputPacket, 10)
+
+	counter := &countingProcessor{MockProcessor: MockProcessor{name: "counter"}}
+	after := NewMockProcessor("after", false)
+	pipeline := New(Config{
+		TaskID:     "flush-task",
+		Decoder:    NewMockDecoder(),
+		Parsers:    []plugin.Parser{NewMockParser("parser", true)},
+		Processors: []plugin.Processor{counter, after},
+	})
+
+	for i := 0; i < 3; i++ {
+		inputChan <- core.RawPacket{Data: []byte("packet")}
+	}
+	close(inputChan)
+
+	// Closing the input flushes what the processor still holds.
+	pipeline.Run(context.Background(), inputChan, outputChan)
+	close(outputChan)
+
+	var outputs []core.OutputPacket
+	for out := range outputChan {
+		outputs = append(outputs, out)
+	}
+	if len(outputs) != 1 || outputs[0].Labels["count"] != "3" || outputs[0].Labels["final"] != "true" {
+		t.Fatalf("outputs = %+v, want one final count of 3", outputs)
+	}
+	// Released packets continue through the processors after the flushing one.
+	if after.ProcessedCount() != 1 {
+		t.Errorf("processor after flusher saw %d packets, want 1", after.ProcessedCount())
+	}
+}
+
+func TestPipeline_TopK(t *testing.T) {
+	for _, drop := range []bool{false, true} {
+		tracker := topk.NewTracker([]string{"protocol"}, 0, 0)
+		pipeline := New(Config{
+			TaskID:     "topk-task",
+			Decoder:    NewMockDecoder(),
+			Parsers:    []plugin.Parser{NewMockParser("parser", true)},
+			Processors: []plugin.Processor{NewMockProcessor("filter", drop)},
+			TopK:       tracker,
+		})
+
+		for i := 0; i < 2; i++ {
+			pipeline.processPacket(core.RawPacket{Data: []byte("packet")})
+		}
+
+		// Only packets that survive the processors are counted.
+		want := uint64(2)
+		if drop {
+			want = 0
+		}
+		if sum := tracker.Snapshot(false); sum.Packets != want {
+			t.Errorf("drop=%v: packets = %d, want %d", drop, sum.Packets, want)
+		}
+		if !drop {
+			if top := tracker.Top("protocol", 1); len(top) != 1 || top[0].Value != "SIP" || top[0].Count != 2 {
+				t.Errorf("top = %+v, want SIP×2", top)
+			}
+		}
+	}
+}
+
+func TestPipeline_Busy(t *testing.T) {
+	pipeline := New(Config{
+		TaskID:  "busy-task",
+		Decoder: NewMockDecoder(),
+		Parsers: []plugin.Parser{NewMockParser("parser", true)},
+	})
+	if pipeline.Busy() != 0 {
+		t.Fatalf("Busy() = %v before any packet", pipeline.Busy())
+	}
+
+	before := TotalBusy()
+	for i := 0; i < 10; i++ {
+		pipeline.Process(core.RawPacket{Data: []byte("packet")})
+	}
+	busy := pipeline.Busy()
+	if busy <= 0 {
+		t.Errorf("Busy() = %v after processing, want > 0", busy)
+	}
+	if total := TotalBusy() - before; total < busy {
+		t.Errorf("TotalBusy grew by %v, want at least the pipeline's %v", total, busy)
+	}
+}
+
+// metaProcessor records the decode metadata processors see.
+type metaProcessor struct {
+	MockProcessor
+	seen []*core.DecodeMeta
+}
+
+func (m *metaProcessor) Process(pkt *core.OutputPacket) bool {
+	m.seen = append(m.seen, pkt.Meta)
+	return true
+}
+
+func TestPipeline_DecodeMeta(t *testing.T) {
+	for _, fields := range []core.MetaFields{0, core.MetaTTL | core.MetaVLAN} {
+		proc := &metaProcessor{}
+		pipeline := New(Config{
+			TaskID:     "meta-task",
+			Decoder:    NewMockDecoder(),
+			Parsers:    []plugin.Parser{NewMockParser("parser", true)},
+			Processors: []plugin.Processor{proc},
+			Meta:       fields,
+		})
+		out, ok := pipeline.processPacket(core.RawPacket{Data: []byte("packet")})
+		if !ok || len(proc.seen) != 1 || proc.seen[0] != out.Meta {
+			t.Fatalf("fields=%b: output %v, processor saw %v", fields, ok, proc.seen)
+		}
+		if fields == 0 && out.Meta != nil {
+			t.Errorf("Meta = %+v without metadata fields", out.Meta)
+		}
+		if fields != 0 && out.Meta == nil {
+			t.Errorf("Meta = nil with fields %b", fields)
+		}
+	}
+}
+
+// teidDecoder decodes like MockDecoder, as GTP-U traffic of one bearer.
+type teidDecoder struct{ MockDecoder }
+
+func (d *teidDecoder) Decode(raw core.RawPacket) (core.DecodedPacket, error) {
+	decoded, err := d.MockDecoder.Decode(raw)
+	decoded.TEID = 0x1a2b3c4d
+	return decoded, err
+}
+
+func TestPipeline_GTPTEIDLabel(t *testing.T) {
+	pipeline := New(Config{
+		TaskID:  "gtp-task",
+		Decoder: &teidDecoder{},
+		Parsers: []plugin.Parser{NewMockParser("parser", true)},
+	})
+	out, ok := pipeline.processPacket(core.RawPacket{Data: []byte("packet")})
+	if !ok || out.Labels[core.LabelGTPTEID] != "0x1a2b3c4d" {
+		t.Errorf("labels = %v, want gtp.teid 0x1a2b3c4d", out.Labels)
+	}
+}
+
+// sctpDecoder decodes like MockDecoder, as SCTP with two bundled DATA chunks.
+type sctpDecoder struct{ MockDecoder }
+
+func (d *sctpDecoder) Decode(raw core.RawPacket) (core.DecodedPacket, error) {
+	decoded, err := d.MockDecoder.Decode(raw)
+	decoded.IP.Protocol, decoded.Transport.Protocol = 132, 132
+	decoded.SCTP = core.SCTPData{Streams: []uint16{0, 3}, PPID: 46}
+	return decoded, err
+}
+
+func TestPipeline_SCTPLabels(t *testing.T) {
+	pipeline := New(Config{
+		TaskID:  "sctp-task",
+		Decoder: &sctpDecoder{},
+		Parsers: []plugin.Parser{NewMockParser("parser", true)},
+	})
+	out, ok := pipeline.processPacket(core.RawPacket{Data: []byte("packet")})
+	if !ok || out.Labels[core.LabelSCTPStreamID] != "0,3" || out.Labels[core.LabelSCTPPPID] != "46" {
+		t.Errorf("labels = %v, want sctp.stream_id 0,3 and sctp.ppid 46", out.Labels)
+	}
+}
+
+// tlsDecoder decodes like MockDecoder, as consecutive segments of a TCP
+// connection to port 5061.
+type tlsDecoder struct {
+	MockDecoder
+	seq uint32
+}
+
+func (d *tlsDecoder) Decode(raw core.RawPacket) (core.DecodedPacket, error) {
+	decoded, err := d.MockDecoder.Decode(raw)
+	decoded.IP.Protocol = 6
+	decoded.Transport = core.TransportHeader{SrcPort: 40000, DstPort: 5061, Protocol: 6, TCPFlags: 0x18, SeqNum: d.seq}
+	d.seq += uint32(len(raw.Data))
+	return decoded, err
+}
+
+func TestPipeline_TLSDecryption(t *testing.T) {
+	tls, err := tlsdecrypt.New("tls-task", tlsdecrypt.Config{KeyLogFile: t.TempDir() + "/sslkeys.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline := New(Config{
+		TaskID:  "tls-task",
+		Decoder: &tlsDecoder{},
+		Parsers: []plugin.Parser{NewMockParser("parser", true)},
+		TLS:     tls,
+	})
+
+	// A segment without application data is consumed by the decryptor
+	changeCipherSpec := []byte{20, 3, 3, 0, 1, 1}
+	if _, ok := pipeline.processPacket(core.RawPacket{Data: changeCipherSpec}); ok {
+		t.Error("ChangeCipherSpec segment was output")
+	}
+
+	// Application data without a key passes through as captured
+	appData := []byte{23, 3, 3, 0, 4, 0xde, 0xad, 0xbe, 0xef}
+	out, ok := pipeline.processPacket(core.RawPacket{Data: appData})
+	if !ok || string(out.RawPayload) != string(appData) || out.Labels[core.LabelTLSVersion] != "" {
+		t.Errorf("undecryptable record: output %v, payload %x, labels %v", ok, out.RawPayload, out.Labels)
+	}
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"log/slog"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ShadowParser is a candidate parser run next to a task parser on the same
+// packets, e.g. a rewritten SIP parser before it replaces the current one.
+// Its labels are compared with the task parser's and only the outcome is
+// counted; its output never reaches processors or reporters.
+type ShadowParser struct {
+	Parser       plugin.Parser
+	IgnoreLabels []string // label keys left out of the comparison
+}
+
+// Shadow comparison results reported in otus_parser_shadow_packets_total.
+const (
+	shadowMatch       = "match"        // both parsed the packet with equal labels, or both rejected it
+	shadowDiverged    = "diverged"     // both parsed the packet, labels differ
+	shadowPrimaryOnly = "primary_only" // only the task parser parsed the packet
+	shadowShadowOnly  = "shadow_only"  // only the shadow parser parsed the packet
+)
+
+// shadowRunner runs one shadow parser and caches its counters.
+type shadowRunner struct {
+	taskID, primary string
+	parser          plugin.Parser
+	ignore          map[string]bool
+	results         map[string]prometheus.Counter
+}
+
+// newShadowRunners returns one runner per parser, nil where the parser has
+// no shadow.
+func newShadowRunners(taskID string, parsers []plugin.Parser, shadows []*ShadowParser) []*shadowRunner {
+	out := make([]*shadowRunner, len(parsers))
+	for i, s := range shadows {
+		if s == nil || i >= len(parsers) {
+			continue
+		}
+		primary, shadow := parsers[i].Name(), s.Parser.Name()
+		r := &shadowRunner{
+			taskID:  taskID,
+			primary: primary,
+			parser:  s.Parser,
+			ignore:  make(map[string]bool, len(s.IgnoreLabels)),
+			results: make(map[string]prometheus.Counter, 4),
+		}
+		for _, l := range s.IgnoreLabels {
+			r.ignore[l] = true
+		}
+		for _, result := range []string{shadowMatch, shadowDiverged, shadowPrimaryOnly, shadowShadowOnly} {
+			r.results[result] = metrics.ParserShadowPacketsTotal.WithLabelValues(taskID, primary, shadow, result)
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// compare runs the shadow parser on pkt and compares its outcome with the
+// task parser's: ok reports whether the task parser parsed pkt, with labels.
+func (r *shadowRunner) compare(pkt *core.DecodedPacket, ok bool, labels core.Labels) {
+	var shadowOK bool
+	var shadowLabels core.Labels
+	if r.parser.CanHandle(pkt) {
+		var err error
+		_, shadowLabels, err = r.parser.Handle(pkt)
+		shadowOK = err == nil
+	}
+
+	switch {
+	case !ok && !shadowOK:
+		r.results[shadowMatch].Inc()
+	case !shadowOK:
+		r.results[shadowPrimaryOnly].Inc()
+	case !ok:
+		r.results[shadowShadowOnly].Inc()
+	default:
+		diffs := r.diff(labels, shadowLabels)
+		if len(diffs) == 0 {
+			r.results[shadowMatch].Inc()
+			return
+		}
+		r.results[shadowDiverged].Inc()
+		for _, key := range diffs {
+			metrics.ParserShadowLabelDiffsTotal.WithLabelValues(r.taskID, r.primary, r.parser.Name(), key).Inc()
+		}
+		slog.Debug("shadow parser diverged", "task_id", r.taskID,
+			"parser", r.primary, "shadow", r.parser.Name(), "labels", diffs)
+	}
+}
+
+// diff returns the label keys whose values differ between a and b.
+func (r *shadowRunner) diff(a, b core.Labels) []string {
+	var keys []string
+	for k, v := range a {
+		if r.ignore[k] {
+			continue
+		}
+		if bv, found := b[k]; !found || bv != v {
+			keys = append(keys, k)
+		}
+	}
+	for k := range b {
+		if r.ignore[k] {
+			continue
+		}
+		if _, found := a[k]; !found {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
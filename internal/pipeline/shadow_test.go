@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// labelParser parses packets whose payload starts with prefix into fixed labels.
+type labelParser struct {
+	name   string
+	prefix string
+	labels core.Labels
+}
+
+func (p *labelParser) Name() string                       { return p.name }
+func (p *labelParser) Init(map[string]any) error          { return nil }
+func (p *labelParser) Start(context.Context) error        { return nil }
+func (p *labelParser) Stop(context.Context) error         { return nil }
+func (p *labelParser) CanHandle(*core.DecodedPacket) bool { return true }
+func (p *labelParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
+	if len(pkt.Payload) < len(p.prefix) || string(pkt.Payload[:len(p.prefix)]) != p.prefix {
+		return nil, nil, core.ErrPacketTooShort
+	}
+	return nil, p.labels, nil
+}
+
+func TestPipeline_ShadowParser(t *testing.T) {
+	primary := &labelParser{name: "shadow-sip", prefix: "SIP", labels: core.Labels{"sip.method": "INVITE", "sip.ua": "a"}}
+	candidate := &labelParser{name: "shadow-sip2", prefix: "S", labels: core.Labels{"sip.method": "INVITE", "sip.ua": "b", "sip.new": "x"}}
+	p := New(Config{
+		TaskID:  "shadow-task",
+		Decoder: NewMockDecoder(),
+		Parsers: []plugin.Parser{primary},
+		Shadows: []*ShadowParser{{Parser: candidate, IgnoreLabels: []string{"sip.ua"}}},
+	})
+
+	for _, payload := range []string{"SIP", "SIP", "SX", "RTP"} {
+		out, ok := p.processPacket(core.RawPacket{Data: []byte(payload)})
+		if !ok {
+			t.Fatalf("packet %q dropped", payload)
+		}
+		// The shadow never changes the output.
+		if payload == "SX" && out.PayloadType != "raw" {
+			t.Errorf("packet %q: PayloadType = %q, want raw", payload, out.PayloadType)
+		}
+	}
+
+	results := map[string]float64{
+		shadowDiverged:    2, // sip.new only in the shadow; sip.ua ignored
+		shadowShadowOnly:  1, // "SX"
+		shadowMatch:       1, // "RTP": both reject
+		shadowPrimaryOnly: 0,
+	}
+	for result, want := range results {
+		if got := testutil.ToFloat64(p.shadows[0].results[result]); got != want {
+			t.Errorf("%s = %v, want %v", result, got, want)
+		}
+	}
+	diffs := metrics.ParserShadowLabelDiffsTotal
+	if got := testutil.ToFloat64(diffs.WithLabelValues("shadow-task", "shadow-sip", "shadow-sip2", "sip.new")); got != 2 {
+		t.Errorf("sip.new diffs = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(diffs.WithLabelValues("shadow-task", "shadow-sip", "shadow-sip2", "sip.ua")); got != 0 {
+		t.Errorf("ignored sip.ua diffs = %v, want 0", got)
+	}
+}
+
+func TestPipeline_ShadowParserFlag(t *testing.T) {
+	flags := featureflag.New(map[string]bool{featureflag.ShadowParsers: false})
+	p := New(Config{
+		TaskID:  "shadow-flag-task",
+		Decoder: NewMockDecoder(),
+		Parsers: []plugin.Parser{&labelParser{name: "flag-sip", prefix: "SIP"}},
+		Shadows: []*ShadowParser{{Parser: &labelParser{name: "flag-sip2", prefix: "SIP"}}},
+		Flags:   flags,
+	})
+
+	p.processPacket(core.RawPacket{Data: []byte("SIP")})
+	if got := testutil.ToFloat64(p.shadows[0].results[shadowMatch]); got != 0 {
+		t.Errorf("shadow ran with shadow_parsers off: match = %v", got)
+	}
+
+	flags.Set(featureflag.ShadowParsers, true)
+	p.processPacket(core.RawPacket{Data: []byte("SIP")})
+	if got := testutil.ToFloat64(p.shadows[0].results[shadowMatch]); got != 1 {
+		t.Errorf("match = %v, want 1 after turning shadow_parsers on", got)
+	}
+}
@@ -0,0 +1,138 @@
+//go:build linux
+
+package prefilter
+
+import (
+	"fmt"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/ebpf"
+)
+
+const (
+	xdpDrop           = 1  // XDP_DROP
+	xdpMdRxQueueIndex = 16 // offsetof(struct xdp_md, rx_queue_index)
+
+	// keyOff is the stack slot of the counter key, below classic scratch
+	// memory.
+	keyOff = -(ebpf.ScratchSize + 4)
+
+	// Labels; the classic stages are named "prefilter" and "filter".
+	dropLabel    = "prefilter.drop"
+	droppedLabel = "prefilter.dropped"
+	filterStart  = "filter.0"
+)
+
+// Counter counts the packets the rules drop in a kernel array map, in one
+// slot per socket filter or per RX queue of an XDP program.
+type Counter struct {
+	fd int
+}
+
+// NewCounter creates a counter with slots slots.
+func NewCounter(slots int) (*Counter, error) {
+	fd, err := ebpf.CreateMap(unix.BPF_MAP_TYPE_ARRAY, 4, 8, uint32(slots))
+	if err != nil {
+		return nil, fmt.Errorf("prefilter: create counter map: %w (needs CAP_BPF or CAP_SYS_ADMIN)", err)
+	}
+	return &Counter{fd: fd}, nil
+}
+
+// Load returns the packets dropped in slot, 0 if it cannot be read.
+func (c *Counter) Load(slot int) uint64 {
+	v, err := ebpf.LookupUint64(c.fd, uint32(slot))
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// Close releases the map; programs using it keep it alive.
+func (c *Counter) Close() error {
+	return unix.Close(c.fd)
+}
+
+// SocketProgram returns an eBPF socket filter running the rules, then the
+// classic socket filter filter (nil = keep every packet). Packets the rules
+// drop are counted in slot 0 of counter.
+func (r *Rules) SocketProgram(counter *Counter, filter []bpf.RawInstruction) ([]ebpf.Insn, error) {
+	pre, err := r.Program(true)
+	if err != nil {
+		return nil, err
+	}
+	next := []bpf.Instruction{bpf.RetConstant{Val: Keep}}
+	if len(filter) > 0 {
+		var ok bool
+		if next, ok = bpf.Disassemble(filter); !ok {
+			return nil, fmt.Errorf("prefilter: bpf_filter has instructions that cannot be translated")
+		}
+	}
+
+	insns := []ebpf.Insn{ebpf.Mov64Reg(ebpf.RegCtx, ebpf.R1)}
+	code, err := ebpf.Classic(pre, ebpf.SocketFilter, "prefilter", r.stage(filterStart))
+	if err != nil {
+		return nil, err
+	}
+	insns = append(insns, code...)
+	code, err = ebpf.Classic(next, ebpf.SocketFilter, "filter", func(k uint32) []ebpf.Insn {
+		return []ebpf.Insn{ebpf.Mov32Imm(ebpf.R0, int32(k)), ebpf.Exit()}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("prefilter: bpf_filter: %w", err)
+	}
+	insns = append(insns, code...)
+	return append(insns, countDrop(counter, false, 0)...), nil
+}
+
+// XDP returns the rules as the start of an XDP program, with the context in
+// ebpf.RegCtx: packets the rules drop are counted in the slot of their RX
+// queue and dropped (XDP_DROP), the others go on at label next.
+func (r *Rules) XDP(counter *Counter, next string) ([]ebpf.Insn, error) {
+	pre, err := r.Program(false)
+	if err != nil {
+		return nil, err
+	}
+	insns, err := ebpf.Classic(pre, ebpf.XDP, "prefilter", r.stage(next))
+	if err != nil {
+		return nil, err
+	}
+	return append(insns, countDrop(counter, true, xdpDrop)...), nil
+}
+
+// stage returns the code replacing the rules' returns: a drop is counted,
+// a kept packet goes on at next.
+func (r *Rules) stage(next string) func(k uint32) []ebpf.Insn {
+	return func(k uint32) []ebpf.Insn {
+		if k == Drop {
+			return []ebpf.Insn{ebpf.Jump(dropLabel)}
+		}
+		return []ebpf.Insn{ebpf.Jump(next)}
+	}
+}
+
+// countDrop returns the code at dropLabel adding 1 to the counter slot, 0
+// or the RX queue, and returning ret.
+func countDrop(counter *Counter, byQueue bool, ret int32) []ebpf.Insn {
+	insns := []ebpf.Insn{ebpf.Label(dropLabel)}
+	if byQueue {
+		insns = append(insns,
+			ebpf.LoadMem(ebpf.SizeW, ebpf.R1, ebpf.RegCtx, xdpMdRxQueueIndex),
+			ebpf.StoreMem(ebpf.SizeW, ebpf.R10, ebpf.R1, keyOff))
+	} else {
+		insns = append(insns, ebpf.StoreImm(ebpf.SizeW, ebpf.R10, keyOff, 0))
+	}
+	insns = append(insns,
+		ebpf.Mov64Reg(ebpf.R2, ebpf.R10),
+		ebpf.ALU64Imm(ebpf.ALUAdd, ebpf.R2, keyOff))
+	insns = append(insns, ebpf.LoadMapFD(ebpf.R1, counter.fd)...)
+	return append(insns,
+		ebpf.Call(ebpf.FuncMapLookupElem),
+		ebpf.JumpImm(ebpf.JEq, ebpf.R0, 0, droppedLabel),
+		ebpf.Mov64Imm(ebpf.R1, 1),
+		ebpf.AtomicAdd64(ebpf.R0, ebpf.R1, 0),
+		ebpf.Label(droppedLabel),
+		ebpf.Mov64Imm(ebpf.R0, ret),
+		ebpf.Exit())
+}
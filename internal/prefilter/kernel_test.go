@@ -0,0 +1,93 @@
+//go:build linux
+
+package prefilter
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/ebpf"
+)
+
+func TestKernelPrograms(t *testing.T) {
+	r := &Rules{Ports: []PortRange{{5060, 5060}}, VLANs: []uint16{100}, Nets: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	counter := &Counter{fd: 9}
+
+	filter, _ := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 1},
+		bpf.RetConstant{Val: 65535},
+		bpf.RetConstant{Val: 0},
+	})
+	sock, err := r.SocketProgram(counter, filter)
+	if err != nil {
+		t.Fatalf("SocketProgram: %v", err)
+	}
+	if _, err := ebpf.Assemble(sock); err != nil {
+		t.Errorf("socket program: %v", err)
+	}
+
+	xdp, err := r.XDP(counter, "redirect")
+	if err != nil {
+		t.Fatalf("XDP: %v", err)
+	}
+	xdp = append(xdp, ebpf.Label("redirect"), ebpf.Exit())
+	code, err := ebpf.Assemble(xdp)
+	if err != nil {
+		t.Fatalf("xdp program: %v", err)
+	}
+	// No ld_abs / ld_ind in XDP
+	for i := 0; i < len(code); i += 8 {
+		if c := code[i]; c&0x07 == 0 && (c&0xe0 == 0x20 || c&0xe0 == 0x40) {
+			t.Errorf("insn %d: packet load %#x in XDP program", i/8, c)
+		}
+	}
+
+	if _, err := r.SocketProgram(counter, []bpf.RawInstruction{{Op: 0xff}}); err == nil || !strings.Contains(err.Error(), "bpf_filter") {
+		t.Errorf("undecodable bpf_filter: err = %v", err)
+	}
+}
+
+// TestKernelVerifier loads the programs into the kernel; it needs CAP_BPF.
+func TestKernelVerifier(t *testing.T) {
+	counter, err := NewCounter(4)
+	if err != nil {
+		t.Skipf("no eBPF: %v", err)
+	}
+	defer counter.Close()
+
+	r := &Rules{
+		Ports: []PortRange{{5060, 5061}, {10000, 20000}},
+		VLANs: []uint16{100},
+		Nets:  []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")},
+	}
+	sock, err := r.SocketProgram(counter, nil)
+	if err != nil {
+		t.Fatalf("SocketProgram: %v", err)
+	}
+	fd, err := ebpf.LoadProgram(unix.BPF_PROG_TYPE_SOCKET_FILTER, "test", sock)
+	if err != nil {
+		t.Fatalf("socket filter rejected: %v", err)
+	}
+	unix.Close(fd)
+
+	xdp, err := r.XDP(counter, "pass")
+	if err != nil {
+		t.Fatalf("XDP: %v", err)
+	}
+	xdp = append(xdp, ebpf.Label("pass"), ebpf.Mov64Imm(ebpf.R0, 2), ebpf.Exit())
+	xdp = append([]ebpf.Insn{ebpf.Mov64Reg(ebpf.RegCtx, ebpf.R1)}, xdp...)
+	fd, err = ebpf.LoadProgram(unix.BPF_PROG_TYPE_XDP, "test", xdp)
+	if err != nil {
+		t.Fatalf("XDP program rejected: %v", err)
+	}
+	unix.Close(fd)
+
+	if n := counter.Load(0); n != 0 {
+		t.Errorf("fresh counter = %d", n)
+	}
+}
@@ -0,0 +1,102 @@
+// Package prefilter drops traffic a task does not capture in the kernel,
+// before it is copied to user space: capturers attach the rules of a task's
+// capture.prefilter (ports, VLANs, networks) as an eBPF socket filter
+// (afpacket) or in their XDP program (afxdp), and count what the rules drop
+// in a kernel map.
+//
+// The rules are compiled to classic BPF (Program) and translated to eBPF
+// (internal/ebpf), so that their logic can be tested in user space.
+package prefilter
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// maxEntries bounds each rule list, keeping the program well under the
+// verifier's limits.
+const maxEntries = 64
+
+// Config is the capture.prefilter of a task. A packet is kept when it
+// matches every non-empty list.
+type Config struct {
+	Ports []string `json:"ports" yaml:"ports"` // "5060" or "10000-20000", source or destination TCP/UDP/SCTP port
+	VLANs []int    `json:"vlans" yaml:"vlans"` // outer 802.1Q / 802.1ad VLAN ID
+	Nets  []string `json:"nets" yaml:"nets"`   // IPv4 / IPv6 prefix or address, source or destination
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Lo, Hi uint16
+}
+
+// Rules is a parsed Config.
+type Rules struct {
+	Ports []PortRange
+	VLANs []uint16
+	Nets  []netip.Prefix
+}
+
+// Rules parses and validates c.
+func (c *Config) Rules() (*Rules, error) {
+	if len(c.Ports) == 0 && len(c.VLANs) == 0 && len(c.Nets) == 0 {
+		return nil, fmt.Errorf("prefilter: at least one of ports, vlans or nets is required")
+	}
+	if len(c.Ports) > maxEntries || len(c.VLANs) > maxEntries || len(c.Nets) > maxEntries {
+		return nil, fmt.Errorf("prefilter: at most %d ports, vlans and nets each", maxEntries)
+	}
+
+	r := &Rules{}
+	for _, s := range c.Ports {
+		pr, err := parsePortRange(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Ports = append(r.Ports, pr)
+	}
+	for _, v := range c.VLANs {
+		if v < 0 || v > 4095 {
+			return nil, fmt.Errorf("prefilter: vlan %d out of range 0-4095", v)
+		}
+		r.VLANs = append(r.VLANs, uint16(v))
+	}
+	for _, s := range c.Nets {
+		p, err := parseNet(s)
+		if err != nil {
+			return nil, err
+		}
+		r.Nets = append(r.Nets, p)
+	}
+	return r, nil
+}
+
+func parsePortRange(s string) (PortRange, error) {
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	if !isRange {
+		hi = lo
+	}
+	l, err1 := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+	h, err2 := strconv.ParseUint(strings.TrimSpace(hi), 10, 16)
+	if err1 != nil || err2 != nil || l > h {
+		return PortRange{}, fmt.Errorf("prefilter: invalid port or port range %q", s)
+	}
+	return PortRange{Lo: uint16(l), Hi: uint16(h)}, nil
+}
+
+func parseNet(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("prefilter: invalid net %q", s)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("prefilter: invalid net %q", s)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,198 @@
+package prefilter
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"golang.org/x/net/bpf"
+)
+
+// frame builds an Ethernet frame with the given VLAN tags, an IP header of
+// the family of src and an L4 header with ports.
+func frame(vlans []uint16, src, dst string, proto uint8, sport, dport uint16) []byte {
+	b := make([]byte, 12)
+	for _, v := range vlans {
+		b = binary.BigEndian.AppendUint16(b, 0x8100)
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	s, d := netip.MustParseAddr(src), netip.MustParseAddr(dst)
+	if s.Is4() {
+		b = binary.BigEndian.AppendUint16(b, 0x0800)
+		ip := make([]byte, 20)
+		ip[0] = 0x45
+		ip[9] = proto
+		copy(ip[12:], s.AsSlice())
+		copy(ip[16:], d.AsSlice())
+		b = append(b, ip...)
+	} else {
+		b = binary.BigEndian.AppendUint16(b, 0x86dd)
+		ip := make([]byte, 40)
+		ip[0] = 0x60
+		ip[6] = proto
+		copy(ip[8:], s.AsSlice())
+		copy(ip[24:], d.AsSlice())
+		b = append(b, ip...)
+	}
+	b = binary.BigEndian.AppendUint16(b, sport)
+	b = binary.BigEndian.AppendUint16(b, dport)
+	return append(b, make([]byte, 16)...)
+}
+
+func run(t *testing.T, r *Rules, pkt []byte) bool {
+	t.Helper()
+	prog, err := r.Program(false)
+	if err != nil {
+		t.Fatalf("Program: %v", err)
+	}
+	vm, err := bpf.NewVM(prog)
+	if err != nil {
+		t.Fatalf("NewVM: %v", err)
+	}
+	n, err := vm.Run(pkt)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return n > 0
+}
+
+func TestConfigRules(t *testing.T) {
+	r, err := (&Config{
+		Ports: []string{"5060", "10000-20000"},
+		VLANs: []int{100},
+		Nets:  []string{"10.1.2.3/8", "2001:db8::1"},
+	}).Rules()
+	if err != nil {
+		t.Fatalf("Rules: %v", err)
+	}
+	if r.Ports[0] != (PortRange{5060, 5060}) || r.Ports[1] != (PortRange{10000, 20000}) {
+		t.Errorf("Ports = %v", r.Ports)
+	}
+	if r.Nets[0].String() != "10.0.0.0/8" || r.Nets[1].String() != "2001:db8::1/128" {
+		t.Errorf("Nets = %v", r.Nets)
+	}
+
+	for _, bad := range []Config{
+		{},
+		{Ports: []string{"20000-10000"}},
+		{Ports: []string{"70000"}},
+		{VLANs: []int{4096}},
+		{Nets: []string{"10.0.0.0/33"}},
+		{Nets: []string{"host"}},
+	} {
+		if _, err := bad.Rules(); err == nil {
+			t.Errorf("Rules(%+v): expected error", bad)
+		}
+	}
+}
+
+func TestProgramPorts(t *testing.T) {
+	r := &Rules{Ports: []PortRange{{5060, 5060}, {10000, 20000}}}
+	tests := []struct {
+		name string
+		pkt  []byte
+		keep bool
+	}{
+		{"sip dst", frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 40000, 5060), true},
+		{"sip src", frame(nil, "10.0.0.1", "10.0.0.2", protoTCP, 5060, 40000), true},
+		{"rtp range", frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 30000, 15000), true},
+		{"range end", frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 30000, 20000), true},
+		{"other", frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 30000, 20001), false},
+		{"icmp", frame(nil, "10.0.0.1", "10.0.0.2", 1, 5060, 5060), false},
+		{"ipv6", frame(nil, "2001:db8::1", "2001:db8::2", protoSCTP, 1, 5060), true},
+		{"ipv6 other", frame(nil, "2001:db8::1", "2001:db8::2", protoUDP, 1, 2), false},
+		{"ipv6 fragment", frame(nil, "2001:db8::1", "2001:db8::2", 44, 1, 2), true},
+		{"vlan", frame([]uint16{100}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 5060), true},
+		{"qinq", frame([]uint16{100, 200}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 5060), true},
+	}
+	for _, tt := range tests {
+		if got := run(t, r, tt.pkt); got != tt.keep {
+			t.Errorf("%s: keep = %v, want %v", tt.name, got, tt.keep)
+		}
+	}
+
+	// Non-first fragment: no ports, kept for reassembly
+	frag := frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2)
+	binary.BigEndian.PutUint16(frag[14+6:], 185)
+	if !run(t, r, frag) {
+		t.Error("non-first fragment dropped")
+	}
+
+	// IPv4 options move the ports
+	opts := frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2)
+	opts[14] = 0x46
+	opts = append(opts[:34], append([]byte{0, 0, 0, 0}, opts[34:]...)...)
+	binary.BigEndian.PutUint16(opts[40:], 5060)
+	if !run(t, r, opts) {
+		t.Error("IPv4 with options dropped")
+	}
+
+	arp := frame(nil, "10.0.0.1", "10.0.0.2", 0, 5060, 5060)
+	binary.BigEndian.PutUint16(arp[12:], 0x0806)
+	if run(t, r, arp) {
+		t.Error("ARP kept with ports set")
+	}
+}
+
+func TestProgramVLANs(t *testing.T) {
+	r := &Rules{VLANs: []uint16{100, 4000}}
+	tests := []struct {
+		name string
+		pkt  []byte
+		keep bool
+	}{
+		{"untagged", frame(nil, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2), false},
+		{"vlan 100", frame([]uint16{100}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2), true},
+		{"vlan 100 pcp", frame([]uint16{0xe000 | 100}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2), true},
+		{"vlan 200", frame([]uint16{200}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2), false},
+		{"inner 100", frame([]uint16{200, 100}, "10.0.0.1", "10.0.0.2", protoUDP, 1, 2), false},
+		{"outer 4000", frame([]uint16{4000, 7}, "2001:db8::1", "2001:db8::2", protoUDP, 1, 2), true},
+	}
+	for _, tt := range tests {
+		if got := run(t, r, tt.pkt); got != tt.keep {
+			t.Errorf("%s: keep = %v, want %v", tt.name, got, tt.keep)
+		}
+	}
+}
+
+func TestProgramNets(t *testing.T) {
+	r, err := (&Config{Nets: []string{"192.168.0.0/16", "10.0.0.7", "2001:db8:aa00::/40"}, Ports: []string{"5060"}}).Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		pkt  []byte
+		keep bool
+	}{
+		{"src /16", frame(nil, "192.168.3.4", "8.8.8.8", protoUDP, 1, 5060), true},
+		{"dst host", frame(nil, "8.8.8.8", "10.0.0.7", protoUDP, 1, 5060), true},
+		{"host neighbour", frame(nil, "8.8.8.8", "10.0.0.8", protoUDP, 1, 5060), false},
+		{"net but port", frame(nil, "192.168.3.4", "8.8.8.8", protoUDP, 1, 5061), false},
+		{"v6 /40", frame(nil, "2001:db8:aaff::1", "2001:db9::2", protoUDP, 5060, 1), true},
+		{"v6 outside", frame(nil, "2001:db8:ab00::1", "2001:db9::2", protoUDP, 5060, 1), false},
+	}
+	for _, tt := range tests {
+		if got := run(t, r, tt.pkt); got != tt.keep {
+			t.Errorf("%s: keep = %v, want %v", tt.name, got, tt.keep)
+		}
+	}
+}
+
+func TestProgramHWVLAN(t *testing.T) {
+	r := &Rules{VLANs: []uint16{100}}
+	prog, err := r.Program(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ext, ok := prog[0].(bpf.LoadExtension); !ok || ext.Num != bpf.ExtVLANTagPresent {
+		t.Errorf("first instruction = %v, want ld vlan_avail", prog[0])
+	}
+	// Without VLANs there is nothing to look for in the metadata
+	r = &Rules{Ports: []PortRange{{5060, 5060}}}
+	if prog, _ = r.Program(true); len(prog) > 0 {
+		if _, ok := prog[0].(bpf.LoadExtension); ok {
+			t.Errorf("ports only: program starts with %v", prog[0])
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package prefilter
+
+import (
+	"fmt"
+
+	"golang.org/x/net/bpf"
+)
+
+// Return values of Program.
+const (
+	Keep = 0x40000 // whole packet
+	Drop = 0
+)
+
+// maxInstructions is the kernel's limit for classic programs (BPF_MAXINSNS).
+const maxInstructions = 4096
+
+// Frame layout.
+const (
+	etherTypeOff  = 12
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100 // 802.1Q
+	etherTypeQinQ = 0x88a8 // 802.1ad
+
+	protoTCP  = 6
+	protoUDP  = 17
+	protoSCTP = 132
+)
+
+// IPv6 extension headers: ports behind them are not looked for and the
+// packet is kept.
+var ipv6ExtHeaders = []uint32{0, 43, 44, 50, 51, 60}
+
+// Program returns the rules as a classic BPF program returning Keep or
+// Drop. With hwVLAN the outer VLAN tag is also looked for in the packet
+// metadata, where the kernel keeps tags stripped by the NIC (socket filters
+// only).
+//
+// Non-IP packets are dropped when ports or nets are set. IP fragments other
+// than the first carry no ports and pass the port check, so that they can
+// still be reassembled; so do IPv6 packets with extension headers.
+func (r *Rules) Program(hwVLAN bool) ([]bpf.Instruction, error) {
+	var b builder
+
+	// L2: on every path to "l3", A is the EtherType and X the L3 offset.
+	if hwVLAN && len(r.VLANs) > 0 {
+		b.emit(
+			bpf.LoadExtension{Num: bpf.ExtVLANTagPresent},
+			bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0, SkipTrue: 0, SkipFalse: 1})
+		b.jump("inline")
+		b.emit(
+			bpf.LoadExtension{Num: bpf.ExtVLANTag},
+			bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xfff})
+		r.vlans(&b, "hw_vlan_ok")
+		b.mark("hw_vlan_ok")
+		// The stripped tag was the outer one; an inner tag is inline.
+		b.emit(bpf.LoadAbsolute{Off: etherTypeOff, Size: 2})
+		b.jumpIf(bpf.JumpEqual, etherTypeVLAN, "hw_inner")
+		b.emit(bpf.LoadConstant{Dst: bpf.RegX, Val: 14})
+		b.jump("l3")
+		b.mark("hw_inner")
+		b.emit(
+			bpf.LoadAbsolute{Off: 16, Size: 2},
+			bpf.LoadConstant{Dst: bpf.RegX, Val: 18})
+		b.jump("l3")
+		b.mark("inline")
+	}
+	b.emit(bpf.LoadAbsolute{Off: etherTypeOff, Size: 2})
+	b.jumpIf(bpf.JumpEqual, etherTypeVLAN, "tagged")
+	b.jumpIf(bpf.JumpEqual, etherTypeQinQ, "tagged")
+	if len(r.VLANs) > 0 {
+		b.jump("drop")
+	} else {
+		b.emit(bpf.LoadConstant{Dst: bpf.RegX, Val: 14})
+		b.jump("l3")
+	}
+	b.mark("tagged")
+	if len(r.VLANs) > 0 {
+		b.emit(
+			bpf.LoadAbsolute{Off: 14, Size: 2},
+			bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xfff})
+		r.vlans(&b, "vlan_ok")
+		b.mark("vlan_ok")
+	}
+	b.emit(bpf.LoadAbsolute{Off: 16, Size: 2})
+	b.jumpIf(bpf.JumpEqual, etherTypeVLAN, "inner")
+	b.emit(bpf.LoadConstant{Dst: bpf.RegX, Val: 18})
+	b.jump("l3")
+	b.mark("inner")
+	b.emit(
+		bpf.LoadAbsolute{Off: 20, Size: 2},
+		bpf.LoadConstant{Dst: bpf.RegX, Val: 22})
+	b.jump("l3")
+
+	b.mark("l3")
+	if len(r.Ports) == 0 && len(r.Nets) == 0 {
+		b.jump("keep")
+	} else {
+		b.jumpIf(bpf.JumpEqual, etherTypeIPv4, "ipv4")
+		b.jumpIf(bpf.JumpEqual, etherTypeIPv6, "ipv6")
+		b.jump("drop")
+		r.ipv4(&b)
+		r.ipv6(&b)
+		if len(r.Ports) > 0 {
+			r.ports(&b)
+		}
+	}
+
+	b.mark("keep")
+	b.emit(bpf.RetConstant{Val: Keep})
+	b.mark("drop")
+	b.emit(bpf.RetConstant{Val: Drop})
+	return b.program()
+}
+
+// vlans checks the VLAN ID in A, going to ok on a match.
+func (r *Rules) vlans(b *builder, ok string) {
+	for _, v := range r.VLANs {
+		b.jumpIf(bpf.JumpEqual, uint32(v), ok)
+	}
+	b.jump("drop")
+}
+
+func (r *Rules) ipv4(b *builder) {
+	b.mark("ipv4")
+	if len(r.Nets) > 0 {
+		r.nets(b, true, 12, "ipv4_net_ok")
+		r.nets(b, true, 16, "ipv4_net_ok")
+		b.jump("drop")
+		b.mark("ipv4_net_ok")
+	}
+	if len(r.Ports) == 0 {
+		b.jump("keep")
+		return
+	}
+	// Non-first fragment
+	b.emit(bpf.LoadIndirect{Off: 6, Size: 2})
+	b.jumpIf(bpf.JumpBitsSet, 0x1fff, "keep")
+	b.emit(bpf.LoadIndirect{Off: 9, Size: 1})
+	r.l4Protos(b, "ipv4_l4")
+	b.jump("drop")
+	b.mark("ipv4_l4")
+	// X += IHL * 4
+	b.emit(
+		bpf.LoadIndirect{Off: 0, Size: 1},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: 0xf},
+		bpf.ALUOpConstant{Op: bpf.ALUOpShiftLeft, Val: 2},
+		bpf.ALUOpX{Op: bpf.ALUOpAdd},
+		bpf.TAX{})
+	b.jump("ports")
+}
+
+func (r *Rules) ipv6(b *builder) {
+	b.mark("ipv6")
+	if len(r.Nets) > 0 {
+		r.nets(b, false, 8, "ipv6_net_ok")
+		r.nets(b, false, 24, "ipv6_net_ok")
+		b.jump("drop")
+		b.mark("ipv6_net_ok")
+	}
+	if len(r.Ports) == 0 {
+		b.jump("keep")
+		return
+	}
+	b.emit(bpf.LoadIndirect{Off: 6, Size: 1})
+	r.l4Protos(b, "ipv6_l4")
+	for _, h := range ipv6ExtHeaders {
+		b.jumpIf(bpf.JumpEqual, h, "keep")
+	}
+	b.jump("drop")
+	b.mark("ipv6_l4")
+	b.emit(
+		bpf.TXA{},
+		bpf.ALUOpConstant{Op: bpf.ALUOpAdd, Val: 40},
+		bpf.TAX{})
+	b.jump("ports")
+}
+
+// l4Protos checks the protocol in A, going to ok for a protocol with ports.
+func (r *Rules) l4Protos(b *builder, ok string) {
+	for _, p := range []uint32{protoTCP, protoUDP, protoSCTP} {
+		b.jumpIf(bpf.JumpEqual, p, ok)
+	}
+}
+
+// nets checks the address at X+off against the nets of one family, going to
+// ok on a match.
+func (r *Rules) nets(b *builder, v4 bool, off uint32, ok string) {
+	for _, n := range r.Nets {
+		if n.Addr().Is4() != v4 {
+			continue
+		}
+		addr := n.Addr().AsSlice()
+		var words []bpf.Instruction // ld, [and], jeq per compared word
+		for w := 0; w < len(addr)/4 && 32*w < n.Bits(); w++ {
+			bits := min(32, n.Bits()-32*w)
+			mask := uint32(0xffffffff) << (32 - bits)
+			val := uint32(addr[4*w])<<24 | uint32(addr[4*w+1])<<16 | uint32(addr[4*w+2])<<8 | uint32(addr[4*w+3])
+			words = append(words, bpf.LoadIndirect{Off: off + uint32(4*w), Size: 4})
+			if bits < 32 {
+				words = append(words, bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask})
+			}
+			words = append(words, bpf.JumpIf{Cond: bpf.JumpEqual, Val: val & mask})
+		}
+		// A mismatch in any word skips the rest of the net, including the
+		// final jump to ok.
+		rest := 1
+		for i := len(words) - 1; i >= 0; i-- {
+			if j, isJump := words[i].(bpf.JumpIf); isJump {
+				j.SkipFalse = uint8(rest)
+				words[i] = j
+			}
+			rest++
+		}
+		b.emit(words...)
+		b.jump(ok)
+	}
+}
+
+// ports checks the source and destination ports at X, going to keep on a
+// match.
+func (r *Rules) ports(b *builder) {
+	b.mark("ports")
+	for _, off := range []uint32{0, 2} {
+		b.emit(bpf.LoadIndirect{Off: off, Size: 2})
+		for _, p := range r.Ports {
+			if p.Lo == p.Hi {
+				b.jumpIf(bpf.JumpEqual, uint32(p.Lo), "keep")
+				continue
+			}
+			b.emit(
+				bpf.JumpIf{Cond: bpf.JumpLessThan, Val: uint32(p.Lo), SkipTrue: 2},
+				bpf.JumpIf{Cond: bpf.JumpGreaterThan, Val: uint32(p.Hi), SkipTrue: 1})
+			b.jump("keep")
+		}
+	}
+	b.jump("drop")
+}
+
+// builder assembles a classic program with forward jumps to labels. Long
+// jumps use ja, whose offset is not limited to 255 like conditional ones.
+type builder struct {
+	insns  []bpf.Instruction
+	labels map[string]int
+	jumps  map[int]string // index of a ja → target label
+}
+
+func (b *builder) emit(insns ...bpf.Instruction) {
+	b.insns = append(b.insns, insns...)
+}
+
+func (b *builder) mark(label string) {
+	if b.labels == nil {
+		b.labels = make(map[string]int)
+	}
+	b.labels[label] = len(b.insns)
+}
+
+func (b *builder) jump(label string) {
+	if b.jumps == nil {
+		b.jumps = make(map[int]string)
+	}
+	b.jumps[len(b.insns)] = label
+	b.insns = append(b.insns, bpf.Jump{})
+}
+
+// jumpIf goes to label if A cond val.
+func (b *builder) jumpIf(cond bpf.JumpTest, val uint32, label string) {
+	b.emit(bpf.JumpIf{Cond: cond, Val: val, SkipTrue: 0, SkipFalse: 1})
+	b.jump(label)
+}
+
+func (b *builder) program() ([]bpf.Instruction, error) {
+	for i, label := range b.jumps {
+		at, ok := b.labels[label]
+		if !ok || at <= i {
+			return nil, fmt.Errorf("prefilter: bad jump to %q", label)
+		}
+		b.insns[i] = bpf.Jump{Skip: uint32(at - i - 1)}
+	}
+	if len(b.insns) > maxInstructions {
+		return nil, fmt.Errorf("prefilter: program too large (%d instructions)", len(b.insns))
+	}
+	return b.insns, nil
+}
@@ -0,0 +1,250 @@
+// Package qualityalert raises alerts when the call quality reported by RTCP
+// crosses configured thresholds.
+//
+// Every SR/RR the RTP parser correlates with a call carries the reception
+// feedback of one report block (rtcp.loss_pct, rtcp.jitter and, once an SR
+// was seen, rtcp.rtt_ms). The monitor converts it to milliseconds, estimates
+// the MOS with a simplified E-model (ITU-T G.107) and emits an Alert when a
+// measurement is worse than its threshold, at most once per call per
+// cooldown, so the controller can act on degraded calls (reroute, open a
+// ticket) without scanning every report.
+package qualityalert
+
+import (
+	"math"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/calls"
+	"firestige.xyz/otus/internal/core"
+)
+
+// PayloadType of quality alert event packets.
+const PayloadType = "quality_alert"
+
+// Measurements that can cross a threshold (Alert.Exceeded).
+const (
+	MetricMOS    = "mos"
+	MetricJitter = "jitter"
+	MetricLoss   = "loss"
+	MetricRTT    = "rtt"
+)
+
+const (
+	// DefaultCooldown is the minimum interval between alerts of one call.
+	DefaultCooldown = time.Minute
+
+	// defaultClockRate converts jitter when the codec gives no clock rate
+	// (RTCP on its own port, or SDP without rtpmap): 8 kHz narrowband.
+	defaultClockRate = 8000
+
+	// maxTracked bounds the calls whose last alert is remembered.
+	maxTracked = 10000
+)
+
+// Thresholds are the limits of a call's quality; zero disables a check.
+type Thresholds struct {
+	MOSBelow      float64 // alert when the estimated MOS is below
+	JitterMsAbove float64 // alert when interarrival jitter exceeds (ms)
+	LossPctAbove  float64 // alert when the fraction lost exceeds (percent)
+	RTTMsAbove    float64 // alert when the round-trip time exceeds (ms)
+}
+
+// Enabled reports whether any threshold is set.
+func (t Thresholds) Enabled() bool {
+	return t.MOSBelow > 0 || t.JitterMsAbove > 0 || t.LossPctAbove > 0 || t.RTTMsAbove > 0
+}
+
+// Alert is one call whose quality crossed a threshold. It is the payload of
+// quality_alert events.
+type Alert struct {
+	TaskID    string     `json:"task_id"`
+	CallID    string     `json:"call_id"`
+	From      string     `json:"from,omitempty"` // SIP From URI, when the task has a call table
+	To        string     `json:"to,omitempty"`   // SIP To URI, when the task has a call table
+	SrcIP     netip.Addr `json:"src_ip"`         // sender of the RTCP report
+	DstIP     netip.Addr `json:"dst_ip"`
+	SrcPort   uint16     `json:"src_port"`
+	DstPort   uint16     `json:"dst_port"`
+	Direction string     `json:"direction,omitempty"` // rtcp.direction of the report
+	Codec     string     `json:"codec,omitempty"`
+	SSRC      string     `json:"ssrc,omitempty"` // source the report block is about
+	MOS       float64    `json:"mos"`
+	JitterMs  float64    `json:"jitter_ms"`
+	LossPct   float64    `json:"loss_pct"`
+	RTTMs     *float64   `json:"rtt_ms,omitempty"` // nil until an SR of the call was seen
+	Exceeded  []string   `json:"exceeded"`         // measurements past their threshold
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// Monitor checks the RTCP reports of a task against Thresholds.
+// It is safe for concurrent use by all pipelines of the task.
+type Monitor struct {
+	taskID     string
+	thresholds Thresholds
+	cooldown   time.Duration
+	calls      *calls.Table // optional, for From / To
+	emit       func(Alert)
+
+	mu   sync.Mutex
+	last map[string]time.Time // call ID → timestamp of its last alert
+}
+
+// NewMonitor creates a monitor calling emit for every alert. table, if not
+// nil, supplies the From and To of alerted calls. It returns nil if no
+// threshold is set.
+func NewMonitor(taskID string, t Thresholds, cooldown time.Duration, table *calls.Table, emit func(Alert)) *Monitor {
+	if !t.Enabled() {
+		return nil
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCooldown
+	}
+	return &Monitor{
+		taskID:     taskID,
+		thresholds: t,
+		cooldown:   cooldown,
+		calls:      table,
+		emit:       emit,
+		last:       make(map[string]time.Time),
+	}
+}
+
+// Observe checks the report block feedback labeled on a correlated RTCP
+// packet and emits an alert if it crosses a threshold.
+func (m *Monitor) Observe(pkt *core.OutputPacket) {
+	labels := pkt.Labels
+	callID := labels[core.LabelRTCPCallID]
+	if callID == "" || labels[core.LabelRTCPLossPct] == "" {
+		return
+	}
+
+	loss, _ := strconv.ParseFloat(labels[core.LabelRTCPLossPct], 64)
+	jitterUnits, _ := strconv.ParseFloat(labels[core.LabelRTCPJitter], 64)
+	codec := labels[core.LabelRTCPCodec]
+	jitter := jitterUnits * 1000 / float64(ClockRate(codec))
+
+	var rtt *float64
+	if v, err := strconv.ParseFloat(labels[core.LabelRTCPRTT], 64); err == nil {
+		rtt = &v
+	}
+	mos := MOS(loss, jitter, valueOr(rtt, 0))
+
+	exceeded := m.exceeded(mos, jitter, loss, rtt)
+	if len(exceeded) == 0 || !m.due(callID, pkt.Timestamp) {
+		return
+	}
+
+	alert := Alert{
+		TaskID:    m.taskID,
+		CallID:    callID,
+		SrcIP:     pkt.SrcIP,
+		DstIP:     pkt.DstIP,
+		SrcPort:   pkt.SrcPort,
+		DstPort:   pkt.DstPort,
+		Direction: labels[core.LabelRTCPDirection],
+		Codec:     codec,
+		SSRC:      labels[core.LabelRTCPReportSSRC],
+		MOS:       round(mos, 2),
+		JitterMs:  round(jitter, 1),
+		LossPct:   loss,
+		RTTMs:     rtt,
+		Exceeded:  exceeded,
+		Timestamp: pkt.Timestamp,
+	}
+	if m.calls != nil {
+		if call, ok := m.calls.Get(callID); ok {
+			alert.From, alert.To = call.From, call.To
+		}
+	}
+	m.emit(alert)
+}
+
+// exceeded returns the measurements past their threshold.
+func (m *Monitor) exceeded(mos, jitter, loss float64, rtt *float64) []string {
+	t := m.thresholds
+	var out []string
+	if t.MOSBelow > 0 && mos < t.MOSBelow {
+		out = append(out, MetricMOS)
+	}
+	if t.JitterMsAbove > 0 && jitter > t.JitterMsAbove {
+		out = append(out, MetricJitter)
+	}
+	if t.LossPctAbove > 0 && loss > t.LossPctAbove {
+		out = append(out, MetricLoss)
+	}
+	if t.RTTMsAbove > 0 && rtt != nil && *rtt > t.RTTMsAbove {
+		out = append(out, MetricRTT)
+	}
+	return out
+}
+
+// due reports whether callID may alert at ts and, if so, records it.
+func (m *Monitor) due(callID string, ts time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if last, ok := m.last[callID]; ok && ts.Sub(last) < m.cooldown {
+		return false
+	}
+	if len(m.last) >= maxTracked {
+		for id, last := range m.last {
+			if ts.Sub(last) >= m.cooldown {
+				delete(m.last, id)
+			}
+		}
+		if len(m.last) >= maxTracked {
+			return false
+		}
+	}
+	m.last[callID] = ts
+	return true
+}
+
+// MOS estimates the mean opinion score (1-4.5) of a call from its loss
+// (percent), jitter and round-trip time (ms) with the simplified E-model
+// commonly used for G.711: the jitter buffer is assumed to hold twice the
+// jitter, and codec-specific impairment is ignored.
+func MOS(lossPct, jitterMs, rttMs float64) float64 {
+	delay := rttMs/2 + 2*jitterMs + 10
+	r := 93.2 - delay/40
+	if delay >= 160 {
+		r = 93.2 - (delay-120)/10
+	}
+	r -= 2.5 * lossPct
+
+	switch {
+	case r <= 0:
+		return 1
+	case r >= 100:
+		return 4.5
+	}
+	return 1 + 0.035*r + 7e-6*r*(r-60)*(100-r)
+}
+
+// ClockRate returns the RTP clock rate of an SDP codec such as "PCMU/8000"
+// or "opus/48000/2".
+func ClockRate(codec string) int {
+	if _, rest, ok := strings.Cut(codec, "/"); ok {
+		rate, _, _ := strings.Cut(rest, "/")
+		if n, err := strconv.Atoi(rate); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultClockRate
+}
+
+func valueOr(v *float64, def float64) float64 {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow10(decimals)
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,120 @@
+package qualityalert
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/calls"
+	"firestige.xyz/otus/internal/core"
+)
+
+func rtcpPacket(ts time.Time, callID, lossPct, jitter, rtt string) *core.OutputPacket {
+	labels := core.Labels{
+		core.LabelRTCPCallID:     callID,
+		core.LabelRTCPCodec:      "PCMU/8000",
+		core.LabelRTCPReportSSRC: "0x0000ABCD",
+		core.LabelRTCPLossPct:    lossPct,
+		core.LabelRTCPJitter:     jitter,
+	}
+	if rtt != "" {
+		labels[core.LabelRTCPRTT] = rtt
+	}
+	return &core.OutputPacket{
+		Timestamp: ts,
+		SrcIP:     netip.MustParseAddr("10.0.0.1"),
+		DstIP:     netip.MustParseAddr("10.0.0.2"),
+		SrcPort:   40001,
+		DstPort:   50001,
+		Labels:    labels,
+	}
+}
+
+func TestMOS(t *testing.T) {
+	if got := MOS(0, 0, 0); got < 4.3 || got > 4.5 {
+		t.Errorf("clean call MOS = %.2f, want ~4.4", got)
+	}
+	if a, b := MOS(1, 10, 50), MOS(5, 10, 50); b >= a {
+		t.Errorf("MOS with 5%% loss %.2f not below 1%% loss %.2f", b, a)
+	}
+	if a, b := MOS(0, 10, 100), MOS(0, 10, 600); b >= a {
+		t.Errorf("MOS with 600ms RTT %.2f not below 100ms %.2f", b, a)
+	}
+	if got := MOS(60, 0, 0); got != 1 {
+		t.Errorf("MOS at 60%% loss = %.2f, want 1", got)
+	}
+}
+
+func TestClockRate(t *testing.T) {
+	for codec, want := range map[string]int{
+		"PCMU/8000":    8000,
+		"opus/48000/2": 48000,
+		"G722/8000":    8000,
+		"RTCP":         defaultClockRate,
+		"":             defaultClockRate,
+		"PCMA/x":       defaultClockRate,
+	} {
+		if got := ClockRate(codec); got != want {
+			t.Errorf("ClockRate(%q) = %d, want %d", codec, got, want)
+		}
+	}
+}
+
+func TestNewMonitorDisabled(t *testing.T) {
+	if m := NewMonitor("t1", Thresholds{}, 0, nil, func(Alert) {}); m != nil {
+		t.Error("monitor without thresholds is not nil")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	table := calls.NewTable("t1", 10, time.Minute)
+	ts := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	table.Observe(&core.OutputPacket{Timestamp: ts, Labels: core.Labels{
+		core.LabelSIPCallID:  "c1",
+		core.LabelSIPMethod:  "INVITE",
+		core.LabelSIPFromURI: "sip:alice@example.com",
+		core.LabelSIPToURI:   "sip:bob@example.com",
+	}})
+
+	var alerts []Alert
+	m := NewMonitor("t1", Thresholds{MOSBelow: 3.8, JitterMsAbove: 30, LossPctAbove: 3, RTTMsAbove: 300},
+		time.Minute, table, func(a Alert) { alerts = append(alerts, a) })
+
+	// Good quality: 0.4% loss, 10 ms jitter (80 units at 8 kHz), 40 ms RTT
+	m.Observe(rtcpPacket(ts, "c1", "0.4", "80", "40.0"))
+	// SIP and RTP packets are ignored
+	m.Observe(&core.OutputPacket{Timestamp: ts, Labels: core.Labels{core.LabelRTPCallID: "c1"}})
+	if len(alerts) != 0 {
+		t.Fatalf("alerts on a good call: %+v", alerts)
+	}
+
+	// 8% loss and 40 ms jitter
+	m.Observe(rtcpPacket(ts.Add(5*time.Second), "c1", "8.0", "320", ""))
+	if len(alerts) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(alerts))
+	}
+	a := alerts[0]
+	if !reflect.DeepEqual(a.Exceeded, []string{MetricMOS, MetricJitter, MetricLoss}) {
+		t.Errorf("exceeded = %v", a.Exceeded)
+	}
+	if a.CallID != "c1" || a.TaskID != "t1" || a.From != "sip:alice@example.com" || a.To != "sip:bob@example.com" ||
+		a.SrcPort != 40001 || a.SSRC != "0x0000ABCD" || a.JitterMs != 40 || a.LossPct != 8 || a.RTTMs != nil {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// Within the cooldown the call stays quiet; another call alerts
+	m.Observe(rtcpPacket(ts.Add(30*time.Second), "c1", "9.0", "0", "500"))
+	m.Observe(rtcpPacket(ts.Add(30*time.Second), "c2", "0", "0", "500"))
+	if len(alerts) != 2 || alerts[1].CallID != "c2" || !reflect.DeepEqual(alerts[1].Exceeded, []string{MetricRTT}) {
+		t.Fatalf("after cooldown check: %+v", alerts)
+	}
+	if alerts[1].From != "" {
+		t.Errorf("call c2 is not in the call table but has From %q", alerts[1].From)
+	}
+
+	m.Observe(rtcpPacket(ts.Add(70*time.Second), "c1", "9.0", "0", ""))
+	if len(alerts) != 3 {
+		t.Errorf("got %d alerts after the cooldown, want 3", len(alerts))
+	}
+}
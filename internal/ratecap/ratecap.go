@@ -0,0 +1,154 @@
+// Package ratecap helps capturers hold a packets-per-second cap themselves,
+// at the cheapest layer they have: a capturer with an in-kernel filter
+// samples there (Sampler, SampleFilter), one reading a ring polls it no
+// faster than the cap (Limiter) and leaves the excess to be dropped by the
+// kernel or NIC.
+//
+// Rates are measured over a sliding window of one second in ten slots.
+// None of the types is safe for concurrent use; each belongs to one capture
+// loop.
+package ratecap
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+const (
+	windowSlots  = 10
+	slotDuration = 100 * time.Millisecond // windowSlots × slotDuration = 1s
+
+	// SlotDuration is how long a Limiter with no budget left waits at most
+	// for budget to free up.
+	SlotDuration = slotDuration
+)
+
+// Window sums values added over the last second.
+type Window struct {
+	sums [windowSlots]float64
+	ids  [windowSlots]int64 // slot number of each sum
+}
+
+func slotID(now time.Time) int64 {
+	return now.UnixNano() / int64(slotDuration)
+}
+
+// Add adds n at now.
+func (w *Window) Add(now time.Time, n float64) {
+	id := slotID(now)
+	i := id % windowSlots
+	if w.ids[i] != id {
+		w.ids[i], w.sums[i] = id, 0
+	}
+	w.sums[i] += n
+}
+
+// Sum returns the total added in the second up to now, i.e. the rate per
+// second.
+func (w *Window) Sum(now time.Time) float64 {
+	id := slotID(now)
+	var total float64
+	for i, sid := range w.ids {
+		if sid <= id && id-sid < windowSlots {
+			total += w.sums[i]
+		}
+	}
+	return total
+}
+
+// Limiter admits at most a cap of packets in any one-second window.
+type Limiter struct {
+	window Window
+}
+
+// Budget returns how many packets can be taken at now under maxPPS, or -1
+// when maxPPS is 0 (no cap).
+func (l *Limiter) Budget(now time.Time, maxPPS uint64) int {
+	if maxPPS == 0 {
+		return -1
+	}
+	return int(max(0, float64(maxPPS)-l.window.Sum(now)))
+}
+
+// Take records n packets taken at now.
+func (l *Limiter) Take(now time.Time, n int) {
+	if n > 0 {
+		l.window.Add(now, float64(n))
+	}
+}
+
+// Sampler picks the fraction of packets a capturer keeps so that the
+// offered rate, estimated from the packets it still sees, stays under a cap.
+type Sampler struct {
+	window Window
+	keep   float64
+}
+
+// Keep returns the fraction of packets currently kept, 1 when not sampling.
+func (s *Sampler) Keep() float64 {
+	if s.keep == 0 {
+		return 1
+	}
+	return s.keep
+}
+
+// Observe records n packets seen at now under the current keep fraction.
+func (s *Sampler) Observe(now time.Time, n int) {
+	s.window.Add(now, float64(n)/s.Keep())
+}
+
+// Update returns the keep fraction for maxPPS (0 = no cap) and whether it
+// changed. Changes under 10% are ignored so that the filter is not swapped
+// on noise.
+func (s *Sampler) Update(now time.Time, maxPPS uint64) (float64, bool) {
+	keep := 1.0
+	if offered := s.window.Sum(now); maxPPS > 0 && offered > float64(maxPPS) {
+		keep = float64(maxPPS) / offered
+	}
+	cur := s.Keep()
+	if keep >= 0.95 {
+		keep = 1
+	}
+	if keep == cur || (keep != 1 && math.Abs(keep-cur) < 0.1*cur) {
+		return cur, false
+	}
+	s.keep = keep
+	return keep, true
+}
+
+// bpfAccept is the return value accepting a whole packet.
+const bpfAccept = 0x40000
+
+// SampleFilter returns a classic BPF program keeping a random keep fraction
+// of the packets accepted by filter (nil = all packets). The kernel drops
+// the others before they reach the socket.
+func SampleFilter(keep float64, filter []bpf.RawInstruction) ([]bpf.RawInstruction, error) {
+	if len(filter) == 0 {
+		var err error
+		if filter, err = bpf.Assemble([]bpf.Instruction{bpf.RetConstant{Val: bpfAccept}}); err != nil {
+			return nil, err
+		}
+	}
+	if keep >= 1 {
+		return filter, nil
+	}
+	if keep <= 0 {
+		return nil, fmt.Errorf("ratecap: keep fraction must be > 0, got %v", keep)
+	}
+
+	// Keep the packet when a random u32 is below keep × 2^32.
+	threshold := uint32(min(keep*(1<<32), math.MaxUint32))
+	prefix, err := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadExtension{Num: bpf.ExtRand},
+		bpf.JumpIf{Cond: bpf.JumpGreaterOrEqual, Val: threshold, SkipTrue: 0, SkipFalse: 1},
+		bpf.RetConstant{Val: 0},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Jumps are relative, so filter runs unchanged after the prefix.
+	return append(prefix, filter...), nil
+}
@@ -0,0 +1,130 @@
+package ratecap
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+var base = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+func TestWindow(t *testing.T) {
+	var w Window
+	for i := range 20 {
+		w.Add(base.Add(time.Duration(i)*50*time.Millisecond), 10)
+	}
+	// 20 adds over 1s: the window at the last add holds all of them.
+	if got := w.Sum(base.Add(950 * time.Millisecond)); got != 200 {
+		t.Errorf("Sum = %v, want 200", got)
+	}
+	// Half a second later the first 10 adds have left the window.
+	if got := w.Sum(base.Add(1450 * time.Millisecond)); got != 100 {
+		t.Errorf("Sum = %v, want 100", got)
+	}
+	if got := w.Sum(base.Add(time.Minute)); got != 0 {
+		t.Errorf("Sum after a minute = %v, want 0", got)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	var l Limiter
+	if got := l.Budget(base, 0); got != -1 {
+		t.Errorf("Budget without cap = %d, want -1", got)
+	}
+	if got := l.Budget(base, 1000); got != 1000 {
+		t.Fatalf("Budget = %d, want 1000", got)
+	}
+	l.Take(base, 600)
+	l.Take(base.Add(500*time.Millisecond), 400)
+	if got := l.Budget(base.Add(900*time.Millisecond), 1000); got != 0 {
+		t.Errorf("Budget at the cap = %d, want 0", got)
+	}
+	// The first 600 leave the window after a second.
+	if got := l.Budget(base.Add(time.Second), 1000); got != 600 {
+		t.Errorf("Budget after a second = %d, want 600", got)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	var s Sampler
+	observe := func(from time.Time, pps int) time.Time {
+		// One second of traffic at pps, as seen after sampling.
+		seen := int(float64(pps) * s.Keep())
+		for i := range 10 {
+			s.Observe(from.Add(time.Duration(i)*100*time.Millisecond), seen/10)
+		}
+		return from.Add(900 * time.Millisecond)
+	}
+
+	now := observe(base, 5000)
+	if keep, changed := s.Update(now, 10000); changed || keep != 1 {
+		t.Errorf("under the cap: keep = %v, changed = %v", keep, changed)
+	}
+
+	now = observe(now.Add(100*time.Millisecond), 40000)
+	if keep, changed := s.Update(now, 10000); !changed || keep != 0.25 {
+		t.Errorf("4× the cap: keep = %v, changed = %v, want 0.25", keep, changed)
+	}
+
+	// The estimate accounts for sampling: the same offered load keeps the
+	// fraction.
+	now = observe(now.Add(100*time.Millisecond), 42000)
+	if keep, changed := s.Update(now, 10000); changed || keep != 0.25 {
+		t.Errorf("steady load: keep = %v, changed = %v", keep, changed)
+	}
+
+	// Load drops: back to keeping everything, also when the cap is removed.
+	now = observe(now.Add(100*time.Millisecond), 8000)
+	if keep, changed := s.Update(now, 10000); !changed || keep != 1 {
+		t.Errorf("load dropped: keep = %v, changed = %v", keep, changed)
+	}
+	now = observe(now.Add(100*time.Millisecond), 40000)
+	if keep, _ := s.Update(now, 0); keep != 1 {
+		t.Errorf("no cap: keep = %v, want 1", keep)
+	}
+}
+
+func TestSampleFilter(t *testing.T) {
+	user, err := bpf.Assemble([]bpf.Instruction{
+		bpf.LoadAbsolute{Off: 12, Size: 2},
+		bpf.JumpIf{Cond: bpf.JumpEqual, Val: 0x0800, SkipFalse: 1},
+		bpf.RetConstant{Val: 65535},
+		bpf.RetConstant{Val: 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prog, err := SampleFilter(1, user)
+	if err != nil || len(prog) != len(user) {
+		t.Fatalf("keep 1: %d instructions, %v; want the filter unchanged", len(prog), err)
+	}
+
+	prog, err = SampleFilter(0.25, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	insns, ok := bpf.Disassemble(prog)
+	if !ok || len(insns) != 3+len(user) {
+		t.Fatalf("program = %v", insns)
+	}
+	if insns[0] != (bpf.LoadExtension{Num: bpf.ExtRand}) {
+		t.Errorf("insn 0 = %#v", insns[0])
+	}
+	// jge 2^30 → drop, disassembled as its inverse
+	if insns[1] != (bpf.JumpIf{Cond: bpf.JumpLessThan, Val: 1 << 30, SkipTrue: 1}) {
+		t.Errorf("insn 1 = %#v, want a jump over the drop below 2^30", insns[1])
+	}
+	if insns[2] != (bpf.RetConstant{Val: 0}) || insns[3] != (bpf.LoadAbsolute{Off: 12, Size: 2}) {
+		t.Errorf("insns 2-3 = %#v, %#v", insns[2], insns[3])
+	}
+
+	prog, err = SampleFilter(0.5, nil)
+	if err != nil || len(prog) != 4 {
+		t.Fatalf("no filter: %d instructions, %v", len(prog), err)
+	}
+	if _, err := SampleFilter(0, nil); err == nil {
+		t.Error("keep 0 accepted")
+	}
+}
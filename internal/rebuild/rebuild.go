@@ -0,0 +1,120 @@
+// Package rebuild turns output packets back into wire packets for reporters
+// that emit packets: pcap archives and traffic forwarding.
+//
+// Output packets carry the application payload and the 5-tuple but not the
+// original frame, so headers are rebuilt: TTL / hop limit 64, and TCP
+// segments with PSH|ACK and zero sequence numbers. That is enough for
+// analyzers to decode the payload, not to reassemble streams.
+package rebuild
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+const (
+	protoTCP = 6
+	protoUDP = 17
+
+	// MaxPacketLen is the largest rebuilt IP packet (the IPv4 total length).
+	MaxPacketLen = 65535
+)
+
+var serializeOpts = gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+
+// Link is the Ethernet header of rebuilt frames.
+type Link struct {
+	SrcMAC net.HardwareAddr
+	DstMAC net.HardwareAddr
+	VLAN   uint16 // 802.1Q VLAN ID; 0 = untagged
+}
+
+// Packet rebuilds an IP packet (LINKTYPE_RAW) around pkt's payload. The
+// result is only valid until the next call with the same buf.
+func Packet(buf gopacket.SerializeBuffer, pkt *core.OutputPacket) ([]byte, error) {
+	return serialize(buf, pkt, nil, 0)
+}
+
+// Frame rebuilds an Ethernet frame around pkt's payload, tagged when
+// link.VLAN is set. The result is only valid until the next call with the
+// same buf.
+func Frame(buf gopacket.SerializeBuffer, pkt *core.OutputPacket, link Link) ([]byte, error) {
+	eth := &layers.Ethernet{SrcMAC: link.SrcMAC, DstMAC: link.DstMAC}
+	head, headLen := []gopacket.SerializableLayer{eth}, 14
+	etherType := layers.EthernetTypeIPv4
+	if src, dst := pkt.SrcIP.Unmap(), pkt.DstIP.Unmap(); !src.Is4() || !dst.Is4() {
+		etherType = layers.EthernetTypeIPv6
+	}
+	if link.VLAN != 0 {
+		eth.EthernetType = layers.EthernetTypeDot1Q
+		head, headLen = append(head, &layers.Dot1Q{VLANIdentifier: link.VLAN, Type: etherType}), headLen+4
+	} else {
+		eth.EthernetType = etherType
+	}
+	return serialize(buf, pkt, head, headLen)
+}
+
+// serialize rebuilds the IP packet of pkt after the link-layer headers head,
+// headLen bytes long.
+func serialize(buf gopacket.SerializeBuffer, pkt *core.OutputPacket, head []gopacket.SerializableLayer, headLen int) ([]byte, error) {
+	var network gopacket.NetworkLayer
+	var ip gopacket.SerializableLayer
+	if src, dst := pkt.SrcIP.Unmap(), pkt.DstIP.Unmap(); src.Is4() && dst.Is4() {
+		v4 := &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocol(pkt.Protocol),
+			SrcIP:    net.IP(src.AsSlice()),
+			DstIP:    net.IP(dst.AsSlice()),
+		}
+		network, ip = v4, v4
+	} else {
+		v6 := &layers.IPv6{
+			Version:    6,
+			HopLimit:   64,
+			NextHeader: layers.IPProtocol(pkt.Protocol),
+			SrcIP:      ip16(pkt.SrcIP),
+			DstIP:      ip16(pkt.DstIP),
+		}
+		network, ip = v6, v6
+	}
+
+	stack := append(head, ip)
+	switch pkt.Protocol {
+	case protoUDP:
+		udp := &layers.UDP{SrcPort: layers.UDPPort(pkt.SrcPort), DstPort: layers.UDPPort(pkt.DstPort)}
+		udp.SetNetworkLayerForChecksum(network)
+		stack = append(stack, udp)
+	case protoTCP:
+		tcp := &layers.TCP{
+			SrcPort: layers.TCPPort(pkt.SrcPort),
+			DstPort: layers.TCPPort(pkt.DstPort),
+			PSH:     true,
+			ACK:     true,
+			Window:  65535,
+		}
+		tcp.SetNetworkLayerForChecksum(network)
+		stack = append(stack, tcp)
+	}
+	stack = append(stack, gopacket.Payload(pkt.RawPayload))
+
+	if err := gopacket.SerializeLayers(buf, serializeOpts, stack...); err != nil {
+		return nil, fmt.Errorf("rebuild packet: %w", err)
+	}
+	if n := len(buf.Bytes()) - headLen; n > MaxPacketLen {
+		return nil, fmt.Errorf("rebuild packet: %d bytes exceeds %d", n, MaxPacketLen)
+	}
+	return buf.Bytes(), nil
+}
+
+// ip16 returns addr in 16-byte form; IPv4 addresses become IPv4-mapped.
+func ip16(addr netip.Addr) net.IP {
+	b := addr.As16()
+	return net.IP(b[:])
+}
@@ -0,0 +1,52 @@
+package rebuild
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestFrame_IPv6TCP(t *testing.T) {
+	pkt := &core.OutputPacket{
+		SrcIP:      netip.MustParseAddr("2001:db8::1"),
+		DstIP:      netip.MustParseAddr("2001:db8::2"),
+		SrcPort:    5061,
+		DstPort:    40000,
+		Protocol:   6,
+		RawPayload: []byte("SIP/2.0 200 OK\r\n\r\n"),
+	}
+	link := Link{SrcMAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{2, 0, 0, 0, 0, 2}}
+
+	frame, err := Frame(gopacket.NewSerializeBuffer(), pkt, link)
+	if err != nil {
+		t.Fatalf("Frame: %v", err)
+	}
+	decoded := gopacket.NewPacket(frame, layers.LayerTypeEthernet, gopacket.Default)
+	if eth, _ := decoded.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); eth == nil || eth.EthernetType != layers.EthernetTypeIPv6 {
+		t.Fatalf("ethernet = %+v, want IPv6 EtherType", eth)
+	}
+	tcp, _ := decoded.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if tcp == nil || tcp.SrcPort != 5061 || !tcp.PSH || !tcp.ACK {
+		t.Fatalf("tcp = %+v", tcp)
+	}
+	if string(tcp.Payload) != string(pkt.RawPayload) {
+		t.Errorf("payload = %q", tcp.Payload)
+	}
+}
+
+func TestPacket_TooLarge(t *testing.T) {
+	pkt := &core.OutputPacket{
+		SrcIP:      netip.MustParseAddr("10.0.0.1"),
+		DstIP:      netip.MustParseAddr("10.0.0.2"),
+		Protocol:   17,
+		RawPayload: make([]byte, MaxPacketLen),
+	}
+	if _, err := Packet(gopacket.NewSerializeBuffer(), pkt); err == nil {
+		t.Error("expected error for a packet over MaxPacketLen")
+	}
+}
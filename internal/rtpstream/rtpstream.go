@@ -0,0 +1,66 @@
+// Package rtpstream holds the per-stream RTP state shared by the rtp
+// parser's trackers and the task's stream table: sequence numbers extended
+// to 32 bits with the packets received against them (RFC 3550 Appendix A.1).
+package rtpstream
+
+// Seq counts the packets of one RTP stream and tracks its highest sequence
+// number, extended to 32 bits to survive wrap-around.
+type Seq struct {
+	packets uint64
+	cycles  uint32 // wrap-arounds of the 16-bit sequence number, shifted left 16
+	maxSeq  uint16
+}
+
+// NewSeq starts the state of a stream whose first packet carries sequence
+// number first. It starts one below, so that packet is not counted as lost.
+func NewSeq(first uint16) Seq {
+	s := Seq{maxSeq: first - 1}
+	if first == 0 {
+		s.cycles -= 1 << 16
+	}
+	return s
+}
+
+// Observe counts a packet. The highest sequence number advances on in-order
+// packets, allowing for gaps; late and duplicate packets only count. It
+// returns the sequence numbers the packet advanced by: 1 in order, more
+// after a gap, 0 for late and duplicate packets.
+func (s *Seq) Observe(seq uint16) uint16 {
+	s.packets++
+	delta := seq - s.maxSeq
+	if delta == 0 || delta >= 1<<15 {
+		return 0
+	}
+	if seq < s.maxSeq {
+		s.cycles += 1 << 16
+	}
+	s.maxSeq = seq
+	return delta
+}
+
+// ExtSeq returns the extended highest sequence number.
+func (s *Seq) ExtSeq() uint32 { return s.cycles | uint32(s.maxSeq) }
+
+// Packets returns the packets counted, duplicates included.
+func (s *Seq) Packets() uint64 { return s.packets }
+
+// Mark is a position of a Seq that Since counts from.
+type Mark struct {
+	packets uint64
+	extSeq  uint32
+}
+
+// Mark returns the current position.
+func (s *Seq) Mark() Mark { return Mark{packets: s.packets, extSeq: s.ExtSeq()} }
+
+// Since returns the packets received since m, the sequence numbers the
+// stream advanced by (the packets expected) and the packets lost: expected
+// but not received, 0 when duplicates outnumber the losses.
+func (s *Seq) Since(m Mark) (received, expected, lost uint64) {
+	received = s.packets - m.packets
+	expected = uint64(s.ExtSeq() - m.extSeq)
+	if expected > received {
+		lost = expected - received
+	}
+	return received, expected, lost
+}
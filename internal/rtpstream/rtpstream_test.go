@@ -0,0 +1,40 @@
+package rtpstream
+
+import "testing"
+
+func TestSeq_WrapAroundAndLoss(t *testing.T) {
+	s := NewSeq(65534)
+	m := s.Mark()
+	for _, seq := range []uint16{65534, 65535, 1, 1, 0, 3} {
+		s.Observe(seq)
+	}
+	// 65534..3 is 6 sequence numbers; 2 is missing, 1 is duplicated.
+	received, expected, lost := s.Since(m)
+	if received != 6 || expected != 6 || lost != 0 {
+		t.Errorf("Since = (%d, %d, %d), want (6, 6, 0)", received, expected, lost)
+	}
+	if s.ExtSeq() != 1<<16|3 {
+		t.Errorf("ExtSeq = %#x, want 0x10003", s.ExtSeq())
+	}
+
+	m = s.Mark()
+	if d := s.Observe(7); d != 4 {
+		t.Errorf("Observe after a gap advanced by %d, want 4", d)
+	}
+	if d := s.Observe(5); d != 0 {
+		t.Errorf("late packet advanced by %d, want 0", d)
+	}
+	if _, expected, lost := s.Since(m); expected != 4 || lost != 2 {
+		t.Errorf("Since = expected %d, lost %d, want 4 and 2", expected, lost)
+	}
+}
+
+func TestSeq_StartsAtZero(t *testing.T) {
+	s := NewSeq(0)
+	m := s.Mark()
+	s.Observe(0)
+	s.Observe(1)
+	if _, expected, lost := s.Since(m); expected != 2 || lost != 0 {
+		t.Errorf("Since = expected %d, lost %d, want 2 and 0", expected, lost)
+	}
+}
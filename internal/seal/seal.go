@@ -0,0 +1,168 @@
+// Package seal implements AES-256-GCM encryption of data at rest with a
+// keyring for key rotation.
+//
+// The first key of a Keyring encrypts; every key decrypts. A key is rotated by
+// putting the new key first and keeping the old one until all data sealed with
+// it has been rewritten.
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// Cipher is the only supported algorithm, recorded in every Envelope.
+const Cipher = "AES-256-GCM"
+
+// KeySize is the required key length in bytes.
+const KeySize = 32
+
+// Envelope is sealed data as stored on disk. []byte fields are base64 in JSON.
+type Envelope struct {
+	Cipher string `json:"cipher"`
+	KeyID  string `json:"key_id"`
+	Nonce  []byte `json:"nonce"`
+	Data   []byte `json:"data"`
+}
+
+type key struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring holds the keys used to seal and open envelopes.
+type Keyring struct {
+	keys []key
+}
+
+// NewKeyring creates a keyring; keys[0] is the active key.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("seal: no keys")
+	}
+	k := &Keyring{}
+	seen := make(map[string]bool)
+	for i, raw := range keys {
+		if len(raw) != KeySize {
+			return nil, fmt.Errorf("seal: key %d is %d bytes, want %d", i, len(raw), KeySize)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, fmt.Errorf("seal: key %d: %w", i, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("seal: key %d: %w", i, err)
+		}
+		id := KeyID(raw)
+		if seen[id] {
+			return nil, fmt.Errorf("seal: key %d is listed twice", i)
+		}
+		seen[id] = true
+		k.keys = append(k.keys, key{id: id, aead: aead})
+	}
+	return k, nil
+}
+
+// LoadKeyring reads the configured key sources in order.
+func LoadKeyring(cfg config.StoreEncryptionConfig) (*Keyring, error) {
+	keys := make([][]byte, 0, len(cfg.Keys))
+	for i, src := range cfg.Keys {
+		raw, err := readKey(src)
+		if err != nil {
+			return nil, fmt.Errorf("seal: key %d: %w", i, err)
+		}
+		keys = append(keys, raw)
+	}
+	return NewKeyring(keys...)
+}
+
+// readKey returns the key from a file or environment variable. The value is
+// either the 32 raw bytes or their base64 encoding.
+func readKey(src config.KeySource) ([]byte, error) {
+	var data []byte
+	switch {
+	case src.File != "":
+		b, err := os.ReadFile(src.File)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	case src.Env != "":
+		v, ok := os.LookupEnv(src.Env)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", src.Env)
+		}
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("file or env is required")
+	}
+
+	if len(data) == KeySize {
+		return data, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key is neither %d raw bytes nor base64", KeySize)
+	}
+	return decoded, nil
+}
+
+// KeyID identifies a key without revealing it: the first 8 bytes of its
+// SHA-256, hex encoded.
+func KeyID(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ActiveKeyID returns the ID of the key that seals new data.
+func (k *Keyring) ActiveKeyID() string {
+	return k.keys[0].id
+}
+
+// Seal encrypts plaintext with the active key. aad is authenticated but not
+// stored; the same aad must be passed to Open, which binds the envelope to its
+// owner (e.g. a task ID) so envelopes cannot be swapped between records.
+func (k *Keyring) Seal(plaintext, aad []byte) (*Envelope, error) {
+	active := k.keys[0]
+	nonce := make([]byte, active.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("seal: nonce: %w", err)
+	}
+	return &Envelope{
+		Cipher: Cipher,
+		KeyID:  active.id,
+		Nonce:  nonce,
+		Data:   active.aead.Seal(nil, nonce, plaintext, aad),
+	}, nil
+}
+
+// Open decrypts e with the key it was sealed with.
+func (k *Keyring) Open(e *Envelope, aad []byte) ([]byte, error) {
+	if e.Cipher != Cipher {
+		return nil, fmt.Errorf("seal: unsupported cipher %q", e.Cipher)
+	}
+	for _, key := range k.keys {
+		if key.id != e.KeyID {
+			continue
+		}
+		if len(e.Nonce) != key.aead.NonceSize() {
+			return nil, fmt.Errorf("seal: invalid nonce length %d", len(e.Nonce))
+		}
+		plaintext, err := key.aead.Open(nil, e.Nonce, e.Data, aad)
+		if err != nil {
+			return nil, fmt.Errorf("seal: decrypt with key %s: authentication failed", e.KeyID)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("seal: key %s is not in the keyring", e.KeyID)
+}
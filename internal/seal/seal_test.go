@@ -0,0 +1,112 @@
+package seal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := NewKeyring(testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	plaintext := []byte(`{"sip":"INVITE sip:alice@example.com"}`)
+
+	env, err := k.Seal(plaintext, []byte("task-a"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if env.KeyID != KeyID(testKey(1)) || bytes.Contains(env.Data, []byte("alice")) {
+		t.Errorf("envelope = %+v, want sealed with key %s", env, KeyID(testKey(1)))
+	}
+
+	got, err := k.Open(env, []byte("task-a"))
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("Open = %q, %v; want %q", got, err, plaintext)
+	}
+
+	// Bound to its owner: the same envelope does not open for another task.
+	if _, err := k.Open(env, []byte("task-b")); err == nil {
+		t.Error("Open with wrong aad succeeded")
+	}
+
+	env.Data[0] ^= 0xff
+	if _, err := k.Open(env, []byte("task-a")); err == nil {
+		t.Error("Open of tampered data succeeded")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, _ := NewKeyring(testKey(1))
+	env, err := old.Seal([]byte("state"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyring(testKey(2), testKey(1))
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	if rotated.ActiveKeyID() != KeyID(testKey(2)) {
+		t.Errorf("ActiveKeyID = %s, want the first key", rotated.ActiveKeyID())
+	}
+	if got, err := rotated.Open(env, nil); err != nil || string(got) != "state" {
+		t.Errorf("old envelope after rotation = %q, %v", got, err)
+	}
+
+	retired, _ := NewKeyring(testKey(2))
+	if _, err := retired.Open(env, nil); err == nil || !strings.Contains(err.Error(), "not in the keyring") {
+		t.Errorf("Open with retired key error = %v, want not in the keyring", err)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	rawFile := filepath.Join(dir, "raw.key")
+	b64File := filepath.Join(dir, "b64.key")
+	if err := os.WriteFile(rawFile, testKey(1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b64File, []byte(base64.StdEncoding.EncodeToString(testKey(2))+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OTUS_TEST_STORE_KEY", base64.StdEncoding.EncodeToString(testKey(3)))
+
+	k, err := LoadKeyring(config.StoreEncryptionConfig{Enabled: true, Keys: []config.KeySource{
+		{Env: "OTUS_TEST_STORE_KEY"},
+		{File: rawFile},
+		{File: b64File},
+	}})
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	if k.ActiveKeyID() != KeyID(testKey(3)) || len(k.keys) != 3 {
+		t.Errorf("keyring = %d keys, active %s", len(k.keys), k.ActiveKeyID())
+	}
+
+	for _, src := range []config.KeySource{
+		{Env: "OTUS_TEST_STORE_KEY_UNSET"},
+		{File: filepath.Join(dir, "missing")},
+		{},
+	} {
+		if _, err := LoadKeyring(config.StoreEncryptionConfig{Keys: []config.KeySource{src}}); err == nil {
+			t.Errorf("LoadKeyring(%+v) succeeded, want error", src)
+		}
+	}
+	if _, err := NewKeyring([]byte("short")); err == nil {
+		t.Error("NewKeyring accepted a short key")
+	}
+	if _, err := NewKeyring(testKey(1), testKey(1)); err == nil {
+		t.Error("NewKeyring accepted a duplicate key")
+	}
+}
@@ -0,0 +1,98 @@
+// Package service manages the daemon's lifecycle through the platform's
+// service manager: the Windows Service Control Manager, or systemd elsewhere.
+// It also detaches the daemon into the background for hosts without either.
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultName is the name the service is installed under.
+const DefaultName = "otus"
+
+// Daemon is the part of daemon.Daemon run as a service.
+type Daemon interface {
+	Start() error     // starts all components
+	Run() error       // blocks until shutdown
+	Reload() error    // reloads the configuration (SIGHUP, or a service parameter change)
+	TriggerShutdown() // makes Run stop the daemon and return
+}
+
+// Config describes an installed service.
+type Config struct {
+	Name        string   // service name (default "otus")
+	DisplayName string   // Windows only
+	Description string   //
+	Executable  string   // absolute path of the binary (default: the running one)
+	Args        []string // command line after the executable, e.g. daemon -c /etc/otus/config.yml
+}
+
+// withDefaults fills in the name, description and executable.
+func (c Config) withDefaults() (Config, error) {
+	if c.Name == "" {
+		c.Name = DefaultName
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = "Otus"
+	}
+	if c.Description == "" {
+		c.Description = "Otus Network Packet Capture Daemon"
+	}
+	if c.Executable == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return c, fmt.Errorf("service: locate executable: %w", err)
+		}
+		c.Executable = exe
+	}
+	exe, err := filepath.Abs(c.Executable)
+	if err != nil {
+		return c, fmt.Errorf("service: %w", err)
+	}
+	c.Executable = exe
+	return c, nil
+}
+
+// Run starts d and runs it until shutdown: under the service manager when the
+// process was started by it (Windows), else in the foreground, where signals
+// control it (systemd and consoles).
+func Run(name string, d Daemon) error {
+	managed, err := IsManaged()
+	if err != nil {
+		return err
+	}
+	if managed {
+		return runManaged(name, d)
+	}
+	if err := d.Start(); err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+	return d.Run()
+}
+
+// Detach starts the executable with args as a background process detached
+// from the terminal (its own session on Unix, no console on Windows), with
+// standard streams discarded, and returns its PID.
+func Detach(args []string) (int, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("service: locate executable: %w", err)
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return 0, fmt.Errorf("service: %w", err)
+	}
+	defer null.Close()
+
+	proc, err := os.StartProcess(exe, append([]string{exe}, args...), &os.ProcAttr{
+		Files: []*os.File{null, null, null},
+		Sys:   detachAttr(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("service: start background process: %w", err)
+	}
+	pid := proc.Pid
+	return pid, proc.Release()
+}
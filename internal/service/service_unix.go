@@ -0,0 +1,143 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/template"
+)
+
+// unitDir is where Install writes the systemd unit.
+var unitDir = "/etc/systemd/system"
+
+// systemctl runs systemctl; replaced in tests.
+var systemctl = func(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// unitTemplate follows configs/otus.service.
+var unitTemplate = template.Must(template.New("unit").Parse(`[Unit]
+Description={{.Description}}
+Documentation=https://github.com/firestige/otus
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+User=root
+Group=root
+ExecStartPre=-systemd-tmpfiles --create /etc/tmpfiles.d/otus.conf
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+KillMode=mixed
+KillSignal=SIGTERM
+TimeoutStopSec=30
+Restart=on-failure
+RestartSec=5s
+LimitNOFILE=65536
+AmbientCapabilities=CAP_NET_RAW CAP_NET_ADMIN
+StandardOutput=journal
+StandardError=journal
+SyslogIdentifier={{.Name}}
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// IsManaged reports whether the process runs under a service manager that
+// needs a control handler. systemd controls the daemon by signals, so never.
+func IsManaged() (bool, error) {
+	return false, nil
+}
+
+func runManaged(string, Daemon) error {
+	return fmt.Errorf("service: no service control handler on this platform")
+}
+
+// Install writes a systemd unit running cfg.Executable with cfg.Args and
+// enables it at boot.
+func Install(cfg Config) error {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return err
+	}
+	path := unitPath(cfg.Name)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("service: %s already exists", path)
+	}
+
+	var b strings.Builder
+	err = unitTemplate.Execute(&b, struct{ Name, Description, ExecStart string }{
+		Name:        cfg.Name,
+		Description: cfg.Description,
+		ExecStart:   execStart(cfg.Executable, cfg.Args),
+	})
+	if err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", cfg.Name)
+}
+
+// Uninstall stops and disables the service and removes its unit.
+func Uninstall(name string) error {
+	path := unitPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("service: %s is not installed: %w", name, err)
+	}
+	if err := systemctl("disable", "--now", name); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+	return systemctl("daemon-reload")
+}
+
+// Start starts the installed service.
+func Start(name string) error {
+	return systemctl("start", name)
+}
+
+// Stop stops the service and waits until it has stopped.
+func Stop(name string) error {
+	return systemctl("stop", name)
+}
+
+func unitPath(name string) string {
+	return filepath.Join(unitDir, name+".service")
+}
+
+// execStart quotes the command line for ExecStart; systemd expands "$" and
+// "%" specifiers, so those are escaped too.
+func execStart(exe string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	for _, s := range append([]string{exe}, args...) {
+		s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$").Replace(s)
+		if s == "" || strings.ContainsAny(s, " \t'") {
+			s = `"` + s + `"`
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+// detachAttr starts the background process in a new session, so it keeps
+// running when the terminal closes.
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
@@ -0,0 +1,102 @@
+//go:build !windows
+
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSystemctl records systemctl invocations.
+func fakeSystemctl(t *testing.T) *[]string {
+	t.Helper()
+	var calls []string
+	orig := systemctl
+	systemctl = func(args ...string) error {
+		calls = append(calls, strings.Join(args, " "))
+		return nil
+	}
+	t.Cleanup(func() { systemctl = orig })
+	return &calls
+}
+
+func TestInstallUninstall(t *testing.T) {
+	orig := unitDir
+	unitDir = t.TempDir()
+	t.Cleanup(func() { unitDir = orig })
+	calls := fakeSystemctl(t)
+
+	cfg := Config{
+		Name:       "otus-edge",
+		Executable: "/opt/otus tools/otus",
+		Args:       []string{"daemon", "--config", "/etc/otus/config.yml"},
+	}
+	if err := Install(cfg); err != nil {
+		t.Fatal(err)
+	}
+	unit, err := os.ReadFile(filepath.Join(unitDir, "otus-edge.service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `ExecStart="/opt/otus tools/otus" daemon --config /etc/otus/config.yml` + "\n"; !strings.Contains(string(unit), want) {
+		t.Errorf("unit lacks %q:\n%s", want, unit)
+	}
+	if !strings.Contains(string(unit), "SyslogIdentifier=otus-edge\n") {
+		t.Errorf("unit lacks the syslog identifier:\n%s", unit)
+	}
+	if got := strings.Join(*calls, ","); got != "daemon-reload,enable otus-edge" {
+		t.Errorf("systemctl calls = %s", got)
+	}
+
+	if err := Install(cfg); err == nil {
+		t.Error("second Install succeeded")
+	}
+
+	*calls = nil
+	if err := Uninstall("otus-edge"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(*calls, ","); got != "disable --now otus-edge,daemon-reload" {
+		t.Errorf("systemctl calls = %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(unitDir, "otus-edge.service")); !os.IsNotExist(err) {
+		t.Error("unit not removed")
+	}
+	if err := Uninstall("otus-edge"); err == nil {
+		t.Error("Uninstall of a missing service succeeded")
+	}
+}
+
+func TestExecStart(t *testing.T) {
+	got := execStart("/usr/local/bin/otus", []string{"daemon", "-c", "/etc/otus/100%.yml", "--name", `a"b`, ""})
+	want := `/usr/local/bin/otus daemon -c /etc/otus/100%%.yml --name a\"b ""`
+	if got != want {
+		t.Errorf("execStart = %s, want %s", got, want)
+	}
+}
+
+// fakeDaemon records the lifecycle calls of Run.
+type fakeDaemon struct {
+	calls    []string
+	startErr error
+}
+
+func (d *fakeDaemon) Start() error     { d.calls = append(d.calls, "start"); return d.startErr }
+func (d *fakeDaemon) Run() error       { d.calls = append(d.calls, "run"); return nil }
+func (d *fakeDaemon) Reload() error    { return nil }
+func (d *fakeDaemon) TriggerShutdown() {}
+
+func TestRunForeground(t *testing.T) {
+	d := &fakeDaemon{}
+	if err := Run(DefaultName, d); err != nil || strings.Join(d.calls, ",") != "start,run" {
+		t.Errorf("Run = %v, calls %v", err, d.calls)
+	}
+
+	d = &fakeDaemon{startErr: errors.New("bind failed")}
+	if err := Run(DefaultName, d); err == nil || strings.Join(d.calls, ",") != "start" {
+		t.Errorf("Run with a failing start = %v, calls %v", err, d.calls)
+	}
+}
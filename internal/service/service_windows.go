@@ -0,0 +1,180 @@
+//go:build windows
+
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// stopTimeout bounds how long Stop waits for the service to stop; the
+// daemon stops its tasks within 30s.
+const stopTimeout = 40 * time.Second
+
+// IsManaged reports whether the process was started by the Service Control
+// Manager.
+func IsManaged() (bool, error) {
+	managed, err := svc.IsWindowsService()
+	if err != nil {
+		return false, fmt.Errorf("service: %w", err)
+	}
+	return managed, nil
+}
+
+// runManaged runs d as the service name until the SCM stops it.
+func runManaged(name string, d Daemon) error {
+	return svc.Run(name, &handler{daemon: d})
+}
+
+// handler maps SCM control requests to the daemon: stop and shutdown stop
+// it, a parameter change (sc control otus paramchange) reloads the
+// configuration as SIGHUP does on Unix.
+type handler struct {
+	daemon Daemon
+}
+
+func (h *handler) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	if err := h.daemon.Start(); err != nil {
+		slog.Error("failed to start daemon", "error", err)
+		return true, 1
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- h.daemon.Run() }()
+
+	const accepts = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptParamChange
+	status <- svc.Status{State: svc.Running, Accepts: accepts}
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				slog.Error("daemon failed", "error", err)
+				return true, 1
+			}
+			return false, 0
+		case req := <-requests:
+			switch req.Cmd {
+			case svc.Interrogate:
+				status <- req.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				h.daemon.TriggerShutdown()
+			case svc.ParamChange:
+				if err := h.daemon.Reload(); err != nil {
+					slog.Error("failed to reload config", "error", err)
+				}
+				status <- req.CurrentStatus
+			}
+		}
+	}
+}
+
+// Install registers the service with the SCM, started automatically at boot
+// and restarted when it fails.
+func Install(cfg Config) error {
+	cfg, err := cfg.withDefaults()
+	if err != nil {
+		return err
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service: connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(cfg.Name); err == nil {
+		s.Close()
+		return fmt.Errorf("service: %s already exists", cfg.Name)
+	}
+	s, err := m.CreateService(cfg.Name, cfg.Executable, mgr.Config{
+		DisplayName: cfg.DisplayName,
+		Description: cfg.Description,
+		StartType:   mgr.StartAutomatic,
+	}, cfg.Args...)
+	if err != nil {
+		return fmt.Errorf("service: create %s: %w", cfg.Name, err)
+	}
+	defer s.Close()
+
+	restart := []mgr.RecoveryAction{{Type: mgr.ServiceRestart, Delay: 5 * time.Second}}
+	if err := s.SetRecoveryActions(restart, uint32((24 * time.Hour).Seconds())); err != nil {
+		return fmt.Errorf("service: set recovery actions: %w", err)
+	}
+	return nil
+}
+
+// Uninstall stops the service if it runs and removes it from the SCM.
+func Uninstall(name string) error {
+	if err := Stop(name); err != nil && !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		return err
+	}
+	return withService(name, func(s *mgr.Service) error {
+		if err := s.Delete(); err != nil {
+			return fmt.Errorf("service: delete %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// Start starts the installed service.
+func Start(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("service: start %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+// Stop stops the service and waits until it has stopped.
+func Stop(name string) error {
+	return withService(name, func(s *mgr.Service) error {
+		st, err := s.Control(svc.Stop)
+		if err != nil {
+			return fmt.Errorf("service: stop %s: %w", name, err)
+		}
+		deadline := time.Now().Add(stopTimeout)
+		for st.State != svc.Stopped {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("service: %s did not stop within %s", name, stopTimeout)
+			}
+			time.Sleep(300 * time.Millisecond)
+			if st, err = s.Query(); err != nil {
+				return fmt.Errorf("service: query %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// withService calls fn with the installed service name.
+func withService(name string, fn func(*mgr.Service) error) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("service: connect to service manager: %w", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf("service: %s is not installed: %w", name, err)
+	}
+	defer s.Close()
+	return fn(s)
+}
+
+// detachAttr starts the background process without a console, in its own
+// process group so console Ctrl+C does not reach it.
+func detachAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_NEW_PROCESS_GROUP | windows.DETACHED_PROCESS,
+		HideWindow:    true,
+	}
+}
@@ -0,0 +1,171 @@
+// Package streamtable correlates RTCP reception reports with the RTP stream
+// they are about, so one exported packet per report interval carries both
+// what the capture point saw of the stream and what the receiving endpoint
+// reported for it.
+//
+// RTP packets update per-stream counters. An SR/RR whose report block names a
+// stream (rtcp.report_ssrc, set by the rtp parser) is labeled with the
+// stream's counters since the previous report about it. A stream is keyed by
+// SSRC and sender IP: the RTP source address, and the destination of the
+// report, which goes back to the sender.
+package streamtable
+
+import (
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/rtpstream"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults for Table limits left unset.
+const (
+	DefaultMaxStreams  = 100000
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// Report results counted in otus_rtcp_reports_correlated_total.
+const (
+	ResultMatched   = "matched"
+	ResultUnmatched = "unmatched"
+)
+
+type streamKey struct {
+	ssrc   uint32
+	sender netip.Addr
+}
+
+// stream holds the counters of one RTP stream.
+type stream struct {
+	seq   rtpstream.Seq
+	bytes uint64
+
+	// Counters at the previous report about the stream.
+	report      rtpstream.Mark
+	reportBytes uint64
+}
+
+// Table holds the RTP streams of one task. It is shared by the task's
+// pipelines and safe for concurrent use.
+type Table struct {
+	matched, unmatched prometheus.Counter
+
+	mu      sync.Mutex
+	streams *idletable.Table[streamKey, stream] // swept every tenth of the idle timeout
+}
+
+// NewTable creates a stream table for a task. Zero limits use the defaults.
+func NewTable(taskID string, maxStreams int, idleTimeout time.Duration) *Table {
+	if maxStreams <= 0 {
+		maxStreams = DefaultMaxStreams
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &Table{
+		matched:   metrics.RTCPReportsCorrelatedTotal.WithLabelValues(taskID, ResultMatched),
+		unmatched: metrics.RTCPReportsCorrelatedTotal.WithLabelValues(taskID, ResultUnmatched),
+		streams:   idletable.New[streamKey, stream](idleTimeout, idleTimeout/10, maxStreams),
+	}
+}
+
+// Observe counts an RTP packet, or labels an RTCP report with the counters of
+// the stream it reports on. Other packets are ignored. The rtp parser outputs
+// both as payload type "rtp", telling them apart by label prefix.
+func (t *Table) Observe(pkt *core.OutputPacket) {
+	if pkt.PayloadType != "rtp" {
+		return
+	}
+	if _, ok := pkt.Labels[core.LabelRTCPPayloadType]; ok {
+		t.observeReport(pkt)
+		return
+	}
+	t.observeRTP(pkt)
+}
+
+func (t *Table) observeRTP(pkt *core.OutputPacket) {
+	ssrc, ok := parseSSRC(pkt.Labels[core.LabelRTPSSRC])
+	if !ok {
+		return
+	}
+	seq, err := strconv.ParseUint(pkt.Labels[core.LabelRTPSeq], 10, 16)
+	if err != nil {
+		return
+	}
+	size := uint64(len(pkt.RawPayload))
+	if v := pkt.Labels[core.LabelRTPPayloadLen]; v != "" {
+		// The payload was stripped by payload_sample_packets: count it anyway.
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			size += n
+		}
+	}
+	now := timestamp(pkt)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, created := t.streams.Touch(streamKey{ssrc: ssrc, sender: pkt.SrcIP}, now)
+	if s == nil {
+		return // table full
+	}
+	if created {
+		s.seq = rtpstream.NewSeq(uint16(seq))
+		s.report = s.seq.Mark()
+	}
+	s.seq.Observe(uint16(seq))
+	s.bytes += size
+}
+
+func (t *Table) observeReport(pkt *core.OutputPacket) {
+	ssrc, ok := parseSSRC(pkt.Labels[core.LabelRTCPReportSSRC])
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.streams.Get(streamKey{ssrc: ssrc, sender: pkt.DstIP})
+	if !ok {
+		t.unmatched.Inc()
+		return
+	}
+	t.matched.Inc()
+
+	packets, _, lost := s.seq.Since(s.report)
+	pkt.Labels[core.LabelRTCPStreamPackets] = strconv.FormatUint(packets, 10)
+	pkt.Labels[core.LabelRTCPStreamBytes] = strconv.FormatUint(s.bytes-s.reportBytes, 10)
+	pkt.Labels[core.LabelRTCPStreamLost] = strconv.FormatUint(lost, 10)
+	pkt.Labels[core.LabelRTCPStreamPacketsTotal] = strconv.FormatUint(s.seq.Packets(), 10)
+
+	s.report, s.reportBytes = s.seq.Mark(), s.bytes
+}
+
+// Len returns the number of tracked streams.
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.streams.Len()
+}
+
+// parseSSRC parses the hex form of the rtp.ssrc and rtcp.* SSRC labels.
+func parseSSRC(v string) (uint32, bool) {
+	if len(v) < 3 || v[:2] != "0x" {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(v[2:], 16, 32)
+	return uint32(n), err == nil
+}
+
+func timestamp(pkt *core.OutputPacket) time.Time {
+	if pkt.Timestamp.IsZero() {
+		return time.Now()
+	}
+	return pkt.Timestamp
+}
@@ -0,0 +1,119 @@
+package streamtable
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+var (
+	caller = netip.MustParseAddr("10.0.0.1")
+	callee = netip.MustParseAddr("10.0.0.2")
+	base   = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+)
+
+// rtpPacket builds an RTP output packet of ssrc sent by caller.
+func rtpPacket(ssrc uint32, seq uint16, size int) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp:   base.Add(time.Duration(seq) * 20 * time.Millisecond),
+		SrcIP:       caller,
+		DstIP:       callee,
+		PayloadType: "rtp",
+		Labels: core.Labels{
+			core.LabelRTPSSRC: fmt.Sprintf("0x%08X", ssrc),
+			core.LabelRTPSeq:  fmt.Sprintf("%d", seq),
+		},
+		RawPayload: make([]byte, size),
+	}
+}
+
+// report builds the callee's RR about ssrc.
+func report(ssrc uint32) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp:   base.Add(5 * time.Second),
+		SrcIP:       callee,
+		DstIP:       caller,
+		PayloadType: "rtp",
+		Labels: core.Labels{
+			core.LabelRTCPPayloadType: "201",
+			core.LabelRTCPSSRC:        "0xBBBB0002",
+			core.LabelRTCPReportSSRC:  fmt.Sprintf("0x%08X", ssrc),
+		},
+	}
+}
+
+func TestTable_ReportIntervals(t *testing.T) {
+	tbl := NewTable("streams-test", 0, 0)
+
+	// First interval: seq 65530..65535, 0..3 with 2 lost across the wrap.
+	for _, seq := range []uint16{65530, 65531, 65532, 65534, 65535, 0, 2, 3} {
+		tbl.Observe(rtpPacket(0xAAAA0001, seq, 172))
+	}
+	rr := report(0xAAAA0001)
+	tbl.Observe(rr)
+	want := map[string]string{
+		core.LabelRTCPStreamPackets:      "8",
+		core.LabelRTCPStreamBytes:        "1376",
+		core.LabelRTCPStreamLost:         "2",
+		core.LabelRTCPStreamPacketsTotal: "8",
+	}
+	for k, v := range want {
+		if rr.Labels[k] != v {
+			t.Errorf("first report: %s = %q, want %q", k, rr.Labels[k], v)
+		}
+	}
+
+	// Second interval: a late packet of the first one and two new ones.
+	for _, seq := range []uint16{1, 4, 5} {
+		tbl.Observe(rtpPacket(0xAAAA0001, seq, 172))
+	}
+	rr = report(0xAAAA0001)
+	tbl.Observe(rr)
+	if rr.Labels[core.LabelRTCPStreamPackets] != "3" || rr.Labels[core.LabelRTCPStreamLost] != "0" ||
+		rr.Labels[core.LabelRTCPStreamPacketsTotal] != "11" {
+		t.Errorf("second report labels = %v", rr.Labels)
+	}
+}
+
+func TestTable_UnmatchedReport(t *testing.T) {
+	tbl := NewTable("streams-test", 0, 0)
+	tbl.Observe(rtpPacket(0xAAAA0001, 1, 172))
+
+	// Unknown SSRC, and a report that does not go back to the sender.
+	other := report(0xCCCC0003)
+	tbl.Observe(other)
+	misrouted := report(0xAAAA0001)
+	misrouted.DstIP = netip.MustParseAddr("10.0.0.9")
+	tbl.Observe(misrouted)
+
+	for _, rr := range []*core.OutputPacket{other, misrouted} {
+		if _, ok := rr.Labels[core.LabelRTCPStreamPackets]; ok {
+			t.Errorf("unmatched report labeled: %v", rr.Labels)
+		}
+	}
+}
+
+func TestTable_Limits(t *testing.T) {
+	tbl := NewTable("streams-test", 1, time.Minute)
+	tbl.Observe(rtpPacket(0xAAAA0001, 1, 172))
+	tbl.Observe(rtpPacket(0xAAAA0002, 1, 172))
+	if tbl.Len() != 1 {
+		t.Fatalf("Len() = %d, want max_streams 1", tbl.Len())
+	}
+
+	// The first stream goes idle; a packet after the timeout sweeps it.
+	late := rtpPacket(0xAAAA0002, 1, 172)
+	late.Timestamp = base.Add(2 * time.Minute)
+	tbl.Observe(late)
+	if tbl.Len() != 1 {
+		t.Errorf("Len() = %d after the idle sweep, want only the new stream", tbl.Len())
+	}
+	rr := report(0xAAAA0002)
+	tbl.Observe(rr)
+	if rr.Labels[core.LabelRTCPStreamPackets] != "1" {
+		t.Errorf("report about the new stream = %v", rr.Labels)
+	}
+}
@@ -0,0 +1,45 @@
+package task
+
+import (
+	"firestige.xyz/otus/internal/buildinfo"
+	"firestige.xyz/otus/internal/core"
+)
+
+// agentMetadata returns the labels identifying the agent build and task
+// configuration behind every exported packet, or nil unless agent_metadata
+// is set. Reporters carry them as they carry labels; Kafka and HEP also
+// give them headers and chunks of their own.
+func (t *Task) agentMetadata() core.Labels {
+	if meta := t.agentMeta.Load(); meta != nil {
+		return *meta
+	}
+	return nil
+}
+
+// refreshAgentMetadata recomputes the agent metadata from t.Config, at Start
+// and whenever the config changes at runtime, so the config hash follows
+// task_reconfigure. The caller holds mu.
+func (t *Task) refreshAgentMetadata() {
+	if !t.Config.AgentMetadata {
+		t.agentMeta.Store(nil)
+		return
+	}
+	t.agentMeta.Store(&core.Labels{
+		core.LabelAgentVersion:    buildinfo.Version,
+		core.LabelAgentCommit:     buildinfo.Commit(),
+		core.LabelAgentConfigHash: t.Config.Hash(),
+	})
+}
+
+// stampAgentMetadata adds meta to the labels of pkt.
+func stampAgentMetadata(pkt *core.OutputPacket, meta core.Labels) {
+	if meta == nil {
+		return
+	}
+	if pkt.Labels == nil {
+		pkt.Labels = make(core.Labels, len(meta))
+	}
+	for k, v := range meta {
+		pkt.Labels[k] = v
+	}
+}
@@ -0,0 +1,63 @@
+package task
+
+import (
+	"context"
+	"testing"
+
+	"firestige.xyz/otus/internal/buildinfo"
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+func TestTask_AgentMetadata(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		task := newStopTestTask("t-meta", "", newFrameCapturer("cap", udpFrame(5060, 5060, []byte("OPTIONS"))))
+		task.Config.AgentMetadata = enabled
+		rep := &mockReporter{name: "rep"}
+		labels := make(chan core.Labels, 1)
+		rep.reportHook = func(_ context.Context, pkt *core.OutputPacket) error {
+			labels <- pkt.Labels
+			return nil
+		}
+		task.Reporters = []plugin.Reporter{rep}
+		if err := task.Start(); err != nil {
+			t.Fatalf("Start() error: %v", err)
+		}
+		if _, err := task.Drain(0); err != nil {
+			t.Fatalf("Drain() error: %v", err)
+		}
+
+		got := <-labels
+		if !enabled {
+			if _, ok := got[core.LabelAgentVersion]; ok {
+				t.Errorf("labels = %v, want no agent metadata", got)
+			}
+			continue
+		}
+		if got[core.LabelAgentVersion] != buildinfo.Version || got[core.LabelAgentCommit] != buildinfo.Commit() ||
+			got[core.LabelAgentConfigHash] != task.Config.Hash() {
+			t.Errorf("labels = %v, want agent version, commit and config hash", got)
+		}
+	}
+}
+
+func TestTask_AgentMetadata_Reconfigure(t *testing.T) {
+	rep := &reconfigurableReporter{mockReporter: mockReporter{name: "kafka"}}
+	task := newLifecycleTestTask([]plugin.Capturer{&mockCapturer{name: "cap0"}}, []plugin.Reporter{rep}, nil, nil)
+	task.Config.AgentMetadata = true
+	task.Config.Reporters = []config.ReporterConfig{{Name: "kafka", Config: map[string]any{"topic": "old"}}}
+	task.refreshAgentMetadata()
+	before := task.agentMetadata()[core.LabelAgentConfigHash]
+
+	if err := task.Reconfigure(map[string]map[string]any{"kafka": {"topic": "new"}}); err != nil {
+		t.Fatalf("Reconfigure() error: %v", err)
+	}
+	if got := task.Config.Reporters[0].Config["topic"]; got != "new" {
+		t.Errorf("config topic = %v, want new", got)
+	}
+	after := task.agentMetadata()[core.LabelAgentConfigHash]
+	if after == before || after != task.Config.Hash() {
+		t.Errorf("config hash = %s (was %s), want %s", after, before, task.Config.Hash())
+	}
+}
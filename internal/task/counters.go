@@ -0,0 +1,80 @@
+package task
+
+import (
+	"time"
+
+	"firestige.xyz/otus/internal/pipeline"
+)
+
+// defaultCountersInterval is the save period of counters.persist without
+// counters.interval.
+const defaultCountersInterval = time.Minute
+
+// Counters are cumulative packet counters of a task.
+type Counters struct {
+	Since           time.Time      `json:"since"` // start of counting
+	PacketsReceived uint64         `json:"packets_received"`
+	PacketsDropped  uint64         `json:"packets_dropped"` // capture drops, kernel and interface
+	Pipeline        pipeline.Stats `json:"pipeline"`
+}
+
+// Add accumulates other into c, keeping c's start.
+func (c *Counters) Add(other Counters) {
+	c.PacketsReceived += other.PacketsReceived
+	c.PacketsDropped += other.PacketsDropped
+	c.Pipeline.Add(other.Pipeline)
+}
+
+// SessionCounters returns the counters since the task was last started.
+func (t *Task) SessionCounters() Counters {
+	t.mu.RLock()
+	since := t.startedAt
+	t.mu.RUnlock()
+
+	capture := t.CaptureStats()
+	return Counters{
+		Since:           since,
+		PacketsReceived: capture.PacketsReceived,
+		PacketsDropped:  capture.PacketsDropped + capture.PacketsIfDropped,
+		Pipeline:        t.PipelineStats(),
+	}
+}
+
+// LifetimeCounters returns the counters carried over from earlier runs of
+// the task (counters.persist) plus the session counters.
+func (t *Task) LifetimeCounters() Counters {
+	session := t.SessionCounters()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.restored == nil {
+		session.Since = t.createdAt
+		return session
+	}
+	lifetime := *t.restored
+	lifetime.Add(session)
+	return lifetime
+}
+
+// restoreCounters sets the counters carried over from earlier runs.
+func (t *Task) restoreCounters(c Counters) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.restored = &c
+}
+
+// persistCountersLoop saves t every interval until it stops, so an unclean
+// shutdown loses at most one interval of its lifetime counters.
+func (m *TaskManager) persistCountersLoop(t *Task, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-ticker.C:
+			m.persist(t)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package task
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTaskManager_PersistCounters(t *testing.T) {
+	store := newTestStore(t)
+	cfg := sharedRegistryTaskConfig("lifetime", "")
+	cfg.Counters.Persist = true
+
+	// A record left by an earlier run of the agent.
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.Save(PersistedTask{
+		Config:   cfg,
+		State:    StateRunning,
+		Counters: &Counters{Since: since, PacketsReceived: 1000, PacketsDropped: 7},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewTaskManager("test-agent", store)
+	if err := m.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	task, _ := m.Get("lifetime")
+	task.Capturers[0].(*mockCapturer).setStats(50, 1)
+
+	if s := task.SessionCounters(); s.PacketsReceived != 50 || s.PacketsDropped != 1 {
+		t.Errorf("session counters = %+v, want 50 received, 1 dropped", s)
+	}
+	l := task.LifetimeCounters()
+	if l.PacketsReceived != 1050 || l.PacketsDropped != 8 || !l.Since.Equal(since) {
+		t.Errorf("lifetime counters = %+v, want 1050 received, 8 dropped since %v", l, since)
+	}
+
+	// Stopping saves the lifetime counters for the next run.
+	m.StopAll()
+	pt, err := store.Load("lifetime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt.Counters == nil || pt.Counters.PacketsReceived != 1050 || !pt.Counters.Since.Equal(since) {
+		t.Errorf("persisted counters = %+v, want 1050 received since %v", pt.Counters, since)
+	}
+
+	// Deleting a task discards its history.
+	m2 := NewTaskManager("test-agent", store)
+	if err := m2.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := m2.Delete("lifetime"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("lifetime"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load after Delete: error = %v, want not exist", err)
+	}
+}
+
+func TestTaskManager_PersistCountersPeriodically(t *testing.T) {
+	store := newTestStore(t)
+	cfg := sharedRegistryTaskConfig("periodic", "")
+	cfg.Counters.Persist = true
+	cfg.Counters.Interval = "20ms"
+
+	m := NewTaskManager("test-agent", store)
+	defer m.StopAll()
+	if err := m.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	task, _ := m.Get("periodic")
+	task.Capturers[0].(*mockCapturer).setStats(42, 0)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if pt, err := store.Load("periodic"); err == nil && pt.Counters != nil && pt.Counters.PacketsReceived == 42 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("counters were not persisted while the task was running")
+}
@@ -0,0 +1,53 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultDrainTimeout bounds a Drain when the caller gives no timeout.
+const DefaultDrainTimeout = 5 * time.Minute
+
+// Drain stops intake and lets the task finish what it has: capturers stop,
+// then the pipelines, the sender and the reporters work off every buffered
+// packet before the task becomes Stopped. Unlike Stop, the reporter flush is
+// not capped unless a reporter sets flush_timeout; only timeout bounds the
+// drain. Past it the task is forced out
+// and marked Failed, as after a Stop past its deadline.
+//
+// The task stays in its manager for task_status. Drain returns how long the
+// drain took.
+func (t *Task) Drain(timeout time.Duration) (time.Duration, error) {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	t.mu.Lock()
+	if t.state != StateRunning {
+		t.mu.Unlock()
+		return 0, fmt.Errorf("cannot drain task in state %s", t.state)
+	}
+	t.setState(StateDraining)
+	t.mu.Unlock()
+
+	slog.Info("draining task", "task_id", t.Config.ID, "timeout", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := t.runShutdown(ctx, 0)
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	t.drainDuration = elapsed
+	t.mu.Unlock()
+
+	if err != nil {
+		return elapsed, err
+	}
+	slog.Info("task drained", "task_id", t.Config.ID, "duration", elapsed)
+	return elapsed, nil
+}
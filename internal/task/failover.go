@@ -0,0 +1,156 @@
+package task
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Reporter failover groups.
+//
+// The reporters of a failover group, e.g. the Kafka clusters of a primary
+// and a secondary datacenter, share one ReporterWrapper, which sends each
+// batch to one tier only: the active one. After FailAfter consecutive
+// failed batches traffic moves to the next tier, which also takes the batch
+// that failed. While a lower tier is active, the tier above it gets one
+// batch per ProbeInterval first (the batch goes on to the active tier if
+// the probe fails); traffic returns once its probes have succeeded for
+// FailbackAfter, one tier at a time. A batch no tier accepted goes to the
+// group's fallback, if any. Probes are not retried; otherwise the group
+// batches and retries with the settings of its first tier.
+
+const (
+	defaultFailAfter     = 3
+	defaultFailbackAfter = time.Minute
+	defaultProbeInterval = 10 * time.Second
+)
+
+// Failover directions for otus_reporter_failovers_total.
+const (
+	directionFailover = "failover"
+	directionFailback = "failback"
+)
+
+// FailoverTier is one tier of a reporter failover group.
+type FailoverTier struct {
+	Reporter      plugin.Reporter
+	FailAfter     int           // consecutive failed batches before the next tier takes over (default 3)
+	FailbackAfter time.Duration // time the tier must succeed before traffic returns (default 1m)
+	ProbeInterval time.Duration // probe period while a lower tier is active (default 10s)
+}
+
+// failoverTier is a tier and its health. Only batchLoop touches it.
+type failoverTier struct {
+	FailoverTier
+	streak       int       // consecutive failed batches while active
+	healthySince time.Time // first of the current run of successful probes
+	lastProbe    time.Time
+}
+
+func newFailoverTiers(tiers []FailoverTier) []failoverTier {
+	out := make([]failoverTier, 0, len(tiers))
+	for _, t := range tiers {
+		if t.FailAfter <= 0 {
+			t.FailAfter = defaultFailAfter
+		}
+		if t.FailbackAfter <= 0 {
+			t.FailbackAfter = defaultFailbackAfter
+		}
+		if t.ProbeInterval <= 0 {
+			t.ProbeInterval = defaultProbeInterval
+		}
+		out = append(out, failoverTier{FailoverTier: t})
+	}
+	return out
+}
+
+// Group returns the failover group of the wrapper, "" if it wraps a single
+// reporter.
+func (w *ReporterWrapper) Group() string {
+	return w.group
+}
+
+// ActiveTier returns the reporter of the failover group tier carrying
+// traffic and its index; the primary reporter and 0 outside a group.
+func (w *ReporterWrapper) ActiveTier() (plugin.Reporter, int) {
+	if len(w.tiers) == 0 {
+		return w.primary, 0
+	}
+	i := int(w.active.Load())
+	return w.tiers[i].Reporter, i
+}
+
+// deliver sends a batch to the primary reporter, or for a failover group to
+// the active tier, failing over and back as described above. Like sendBatch
+// it returns the packets left unsent and the last failure; only the packets
+// a tier did not take move on to the next one.
+func (w *ReporterWrapper) deliver(ctx context.Context, batch []*core.OutputPacket) ([]*core.OutputPacket, error) {
+	if len(w.tiers) == 0 {
+		return w.sendBatch(ctx, w.primary, batch, w.retry)
+	}
+
+	now := w.now()
+	active := int(w.active.Load())
+	if active > 0 {
+		up := &w.tiers[active-1]
+		if now.Sub(up.lastProbe) >= up.ProbeInterval {
+			up.lastProbe = now
+			// A single attempt: a failed probe only delays the batch,
+			// which the active tier takes with the full retry policy.
+			unsent, err := w.sendBatch(ctx, up.Reporter, batch, RetryPolicy{})
+			if err == nil {
+				if up.healthySince.IsZero() {
+					up.healthySince = now
+				}
+				if now.Sub(up.healthySince) >= up.FailbackAfter {
+					w.switchTier(active-1, directionFailback)
+				}
+				return unsent, nil
+			}
+			slog.Debug("failover probe failed", "task_id", w.taskID, "group", w.group,
+				"reporter", up.Reporter.Name(), "error", err)
+			up.healthySince = time.Time{}
+			batch = unsent
+		}
+	}
+
+	var err error
+	for i := active; i < len(w.tiers); i++ {
+		t := &w.tiers[i]
+		var unsent []*core.OutputPacket
+		if unsent, err = w.sendBatch(ctx, t.Reporter, batch, w.retry); err == nil {
+			t.streak = 0
+			return unsent, nil
+		}
+		batch = unsent
+		t.streak++
+		if t.streak < t.FailAfter || i == len(w.tiers)-1 {
+			return batch, err
+		}
+		// The next tier takes over, starting with this batch. The tier
+		// left is probed after its interval.
+		t.streak = 0
+		t.healthySince = time.Time{}
+		t.lastProbe = now
+		slog.Warn("reporter failover group failing over", "task_id", w.taskID, "group", w.group,
+			"from", t.Reporter.Name(), "to", w.tiers[i+1].Reporter.Name(), "error", err)
+		w.switchTier(i+1, directionFailover)
+	}
+	return batch, err
+}
+
+// switchTier makes tier i the active one.
+func (w *ReporterWrapper) switchTier(i int, direction string) {
+	w.active.Store(int64(i))
+	w.tiers[i].streak = 0
+	metrics.ReporterFailoverTier.WithLabelValues(w.taskID, w.group).Set(float64(i))
+	metrics.ReporterFailoversTotal.WithLabelValues(w.taskID, w.group, direction).Inc()
+	if direction == directionFailback {
+		slog.Info("reporter failover group failing back", "task_id", w.taskID, "group", w.group,
+			"reporter", w.tiers[i].Reporter.Name())
+	}
+}
@@ -0,0 +1,160 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// failingReporter is a batch reporter whose failure can be switched on.
+func failingReporter(name string) *mockBatchReporter {
+	return &mockBatchReporter{mockReporter: mockReporter{name: name}}
+}
+
+func (m *mockBatchReporter) setFailing(failing bool) {
+	m.batchMu.Lock()
+	defer m.batchMu.Unlock()
+	m.batchErr = nil
+	if failing {
+		m.batchErr = errors.New("broker unreachable")
+	}
+}
+
+func newFailoverWrapper(tiers ...FailoverTier) (*ReporterWrapper, *time.Time) {
+	w := NewReporterWrapper(WrapperConfig{TaskID: "failover-test", Group: "dc", Tiers: tiers})
+	now := time.Unix(1700000000, 0)
+	w.now = func() time.Time { return now }
+	return w, &now
+}
+
+func deliverOne(t *testing.T, w *ReporterWrapper) error {
+	t.Helper()
+	_, err := w.deliver(context.Background(), []*core.OutputPacket{{PayloadType: "sip"}})
+	return err
+}
+
+func TestFailover_FailsOverAndBack(t *testing.T) {
+	dc1, dc2 := failingReporter("kafka-dc1"), failingReporter("kafka-dc2")
+	w, now := newFailoverWrapper(
+		FailoverTier{Reporter: dc1, FailAfter: 2, FailbackAfter: time.Minute, ProbeInterval: 10 * time.Second},
+		FailoverTier{Reporter: dc2},
+	)
+	if w.Name() != "kafka-dc1" || w.Group() != "dc" {
+		t.Fatalf("wrapper name %q group %q", w.Name(), w.Group())
+	}
+
+	dc1.setFailing(true)
+	if err := deliverOne(t, w); err == nil {
+		t.Error("first failed batch reported success")
+	}
+	if _, i := w.ActiveTier(); i != 0 {
+		t.Fatalf("active tier %d after one failure, want 0", i)
+	}
+	// The second failure fails over; dc2 takes the failed batch.
+	if err := deliverOne(t, w); err != nil {
+		t.Errorf("failover batch error: %v", err)
+	}
+	if rep, i := w.ActiveTier(); i != 1 || rep != dc2 {
+		t.Fatalf("active tier %d (%s), want 1", i, rep.Name())
+	}
+	if n := len(dc2.packets()); n != 1 {
+		t.Errorf("dc2 got %d packets, want 1", n)
+	}
+
+	// dc1 recovers: it is probed once per interval and traffic returns
+	// only after its probes succeeded for a minute.
+	dc1.setFailing(false)
+	*now = now.Add(5 * time.Second)
+	deliverOne(t, w) // probe not due yet
+	if n := len(dc1.packets()); n != 0 {
+		t.Errorf("dc1 probed before the interval (%d packets)", n)
+	}
+	*now = now.Add(5 * time.Second)
+	deliverOne(t, w) // probe: delivered by dc1
+	if n := len(dc1.packets()); n != 1 {
+		t.Errorf("dc1 got %d packets from the probe, want 1", n)
+	}
+	deliverOne(t, w) // between probes: dc2
+	if _, i := w.ActiveTier(); i != 1 || len(dc2.packets()) != 3 {
+		t.Fatalf("active tier %d, dc2 %d packets after the first probe", i, len(dc2.packets()))
+	}
+
+	// A failed probe restarts the hysteresis.
+	dc1.setFailing(true)
+	*now = now.Add(10 * time.Second)
+	if err := deliverOne(t, w); err != nil {
+		t.Errorf("batch after a failed probe: %v", err)
+	}
+	dc1.setFailing(false)
+	for range 6 {
+		*now = now.Add(10 * time.Second)
+		deliverOne(t, w)
+		if _, i := w.ActiveTier(); i != 1 {
+			t.Fatal("failed back before a minute of successful probes")
+		}
+	}
+	*now = now.Add(10 * time.Second)
+	deliverOne(t, w)
+	if _, i := w.ActiveTier(); i != 0 {
+		t.Errorf("active tier %d after a minute of successful probes, want 0", i)
+	}
+}
+
+func TestFailover_AllTiersDownUsesFallback(t *testing.T) {
+	dc1, dc2 := failingReporter("kafka-dc1"), failingReporter("kafka-dc2")
+	dc1.setFailing(true)
+	dc2.setFailing(true)
+	spill := &mockReporter{name: "spill"}
+	w := NewReporterWrapper(WrapperConfig{
+		TaskID:       "failover-test",
+		Group:        "dc",
+		Tiers:        []FailoverTier{{Reporter: dc1, FailAfter: 1}, {Reporter: dc2}},
+		Fallback:     spill,
+		BatchSize:    2,
+		BatchTimeout: time.Second,
+	})
+	w.Start(context.Background())
+	for range 4 {
+		w.Send(&core.OutputPacket{PayloadType: "sip"})
+	}
+	w.Close()
+
+	if n := len(spill.packets()); n != 4 {
+		t.Errorf("fallback got %d packets, want 4", n)
+	}
+	if _, i := w.ActiveTier(); i != 1 {
+		t.Errorf("active tier %d, want the last one", i)
+	}
+	if w.ErrorStreak() != 2 {
+		t.Errorf("error streak %d, want 2", w.ErrorStreak())
+	}
+}
+
+func TestFailover_ProbeNotRetried(t *testing.T) {
+	dc1, dc2 := failingReporter("kafka-dc1"), failingReporter("kafka-dc2")
+	w := NewReporterWrapper(WrapperConfig{
+		TaskID: "failover-test",
+		Group:  "dc",
+		Tiers:  []FailoverTier{{Reporter: dc1, FailAfter: 1, ProbeInterval: time.Second}, {Reporter: dc2}},
+		Retry:  RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	now := time.Unix(1700000000, 0)
+	w.now = func() time.Time { return now }
+
+	dc1.setFailing(true)
+	deliverOne(t, w) // fails over after three attempts
+	if n := len(dc1.getBatchCalls()); n != 3 {
+		t.Fatalf("dc1 got %d attempts before failing over, want 3", n)
+	}
+
+	now = now.Add(time.Second)
+	if err := deliverOne(t, w); err != nil {
+		t.Errorf("batch after a failed probe: %v", err)
+	}
+	if n := len(dc1.getBatchCalls()); n != 4 {
+		t.Errorf("dc1 got %d probe attempts, want 1", n-3)
+	}
+}
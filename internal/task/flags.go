@@ -0,0 +1,50 @@
+package task
+
+import (
+	"log/slog"
+
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// SetFlag turns a feature flag of the task on or off. The change applies to
+// the running task at once and lasts until the task is recreated, which
+// starts again from the flags of its config.
+func (t *Task) SetFlag(name string, on bool) error {
+	prev, err := t.Flags.Set(name, on)
+	if err != nil {
+		return err
+	}
+	t.publishFlag(name, on)
+	if prev != on {
+		slog.Info("feature flag changed", "task_id", t.Config.ID, "flag", name, "enabled", on)
+	}
+	return nil
+}
+
+// publishFlags exports every flag of the task as otus_feature_flag_enabled;
+// statsCollectorLoop removes the series when the task stops.
+func (t *Task) publishFlags() {
+	for name, on := range t.Flags.Snapshot() {
+		t.publishFlag(name, on)
+	}
+}
+
+func (t *Task) publishFlag(name string, on bool) {
+	v := 0.0
+	if on {
+		v = 1
+	}
+	metrics.FeatureFlagEnabled.WithLabelValues(t.Config.ID, name).Set(v)
+}
+
+// setFeatureFlags hands the task's flags to plugins implementing
+// plugin.FeatureFlagAware.
+func setFeatureFlags(flags *featureflag.Set, plugins ...plugin.Plugin) {
+	for _, p := range plugins {
+		if fa, ok := p.(plugin.FeatureFlagAware); ok {
+			fa.SetFeatureFlags(flags)
+		}
+	}
+}
@@ -4,18 +4,23 @@ package task
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"firestige.xyz/otus/pkg/plugin"
 )
 
 // FlowRegistry provides per-Task flow state storage.
-// It is shared across all pipelines within a task and is thread-safe.
+// It is shared across all pipelines within a task and is thread-safe; with
+// registry: shared one instance is also shared across tasks.
 // Typical use case: SIP parser tracking INVITE → 200 OK → ACK dialog state.
 type FlowRegistry struct {
 	data  sync.Map // map[plugin.FlowKey]any - stores arbitrary flow state
+	seen  sync.Map // map[plugin.FlowKey]*atomic.Int64 - last seen, unix nanoseconds
 	count atomic.Int64
 }
 
+var _ plugin.FlowActivity = (*FlowRegistry)(nil)
+
 // NewFlowRegistry creates a new flow registry.
 func NewFlowRegistry() *FlowRegistry {
 	return &FlowRegistry{}
@@ -42,6 +47,34 @@ func (r *FlowRegistry) Delete(key plugin.FlowKey) {
 	if loaded {
 		r.count.Add(-1)
 	}
+	r.seen.Delete(key)
+}
+
+// Touch records that a packet of the flow was seen at now. Flows that are
+// not registered are ignored, so activity never outlives its flow.
+func (r *FlowRegistry) Touch(key plugin.FlowKey, now time.Time) {
+	if _, ok := r.data.Load(key); !ok {
+		return
+	}
+	if v, ok := r.seen.Load(key); ok {
+		v.(*atomic.Int64).Store(now.UnixNano())
+		return
+	}
+	ts := new(atomic.Int64)
+	ts.Store(now.UnixNano())
+	if v, loaded := r.seen.LoadOrStore(key, ts); loaded {
+		v.(*atomic.Int64).Store(now.UnixNano())
+	}
+}
+
+// LastSeen returns when a packet of the flow was last touched, or false if
+// none has been since it was registered.
+func (r *FlowRegistry) LastSeen(key plugin.FlowKey) (time.Time, bool) {
+	v, ok := r.seen.Load(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, v.(*atomic.Int64).Load()), true
 }
 
 // Range iterates over all flows in the registry.
@@ -63,10 +96,35 @@ func (r *FlowRegistry) Count() int {
 }
 
 // Clear removes all flows from the registry.
+// Safe to call while other goroutines use the registry: only entries actually
+// removed here are subtracted from the count.
 func (r *FlowRegistry) Clear() {
 	r.data.Range(func(key, _ any) bool {
-		r.data.Delete(key)
-		r.count.Add(-1)
+		if _, loaded := r.data.LoadAndDelete(key); loaded {
+			r.count.Add(-1)
+		}
+		r.seen.Delete(key)
 		return true
 	})
 }
+
+// shadowFlowRegistry is the FlowRegistry of shadow parsers. Get falls back to
+// the task registry, so a shadow parser sees flows set up by the task's
+// parsers; Set, Delete, Range, Count and Clear only touch the shadow's own
+// entries, so it never changes the flows the task's parsers rely on.
+type shadowFlowRegistry struct {
+	*FlowRegistry // shadow-owned entries
+	base          plugin.FlowRegistry
+}
+
+func newShadowFlowRegistry(base plugin.FlowRegistry) *shadowFlowRegistry {
+	return &shadowFlowRegistry{FlowRegistry: NewFlowRegistry(), base: base}
+}
+
+// Get returns the shadow's own entry for key, else the task registry's.
+func (r *shadowFlowRegistry) Get(key plugin.FlowKey) (any, bool) {
+	if v, ok := r.FlowRegistry.Get(key); ok {
+		return v, true
+	}
+	return r.base.Get(key)
+}
@@ -4,6 +4,7 @@ import (
 	"net/netip"
 	"sync"
 	"testing"
+	"time"
 
 	"firestige.xyz/otus/pkg/plugin"
 )
@@ -215,3 +216,62 @@ func TestFlowRegistryCountAccuracy(t *testing.T) {
 		t.Fatalf("After Clear(), Count()=%d, want 0", got)
 	}
 }
+
+func TestShadowFlowRegistry(t *testing.T) {
+	base := NewFlowRegistry()
+	shadow := newShadowFlowRegistry(base)
+
+	taskKey := plugin.FlowKey{DstIP: netip.MustParseAddr("10.0.0.1"), DstPort: 10000, Proto: 17}
+	shadowKey := plugin.FlowKey{DstIP: netip.MustParseAddr("10.0.0.2"), DstPort: 20000, Proto: 17}
+	base.Set(taskKey, "task")
+
+	// Task flows are visible to the shadow.
+	if v, ok := shadow.Get(taskKey); !ok || v != "task" {
+		t.Errorf("shadow Get(task flow) = %v, %v", v, ok)
+	}
+
+	// Shadow writes stay in the shadow.
+	shadow.Set(shadowKey, "shadow")
+	shadow.Set(taskKey, "overridden")
+	if _, ok := base.Get(shadowKey); ok {
+		t.Error("shadow Set leaked into the task registry")
+	}
+	if v, _ := base.Get(taskKey); v != "task" {
+		t.Errorf("task flow = %v after shadow Set, want unchanged", v)
+	}
+	if v, _ := shadow.Get(taskKey); v != "overridden" {
+		t.Errorf("shadow Get = %v, want its own entry", v)
+	}
+
+	shadow.Clear()
+	if base.Count() != 1 || shadow.Count() != 0 {
+		t.Errorf("counts after shadow Clear: task=%d shadow=%d, want 1 and 0", base.Count(), shadow.Count())
+	}
+}
+
+func TestFlowRegistryActivity(t *testing.T) {
+	r := NewFlowRegistry()
+	key := plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 10000, DstPort: 20000, Proto: 17}
+	now := time.Now()
+
+	// Unregistered flows are not tracked.
+	r.Touch(key, now)
+	if _, ok := r.LastSeen(key); ok {
+		t.Error("LastSeen set for an unregistered flow")
+	}
+
+	r.Set(key, "call")
+	if _, ok := r.LastSeen(key); ok {
+		t.Error("LastSeen set before the first Touch")
+	}
+	r.Touch(key, now)
+	r.Touch(key, now.Add(time.Second))
+	if last, ok := r.LastSeen(key); !ok || !last.Equal(now.Add(time.Second)) {
+		t.Errorf("LastSeen = %v, %v; want %v", last, ok, now.Add(time.Second))
+	}
+
+	r.Delete(key)
+	if _, ok := r.LastSeen(key); ok {
+		t.Error("LastSeen survived Delete")
+	}
+}
@@ -0,0 +1,114 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// stopFlushTimeout caps the reporter flush of a graceful Stop for reporters
+// without flush_timeout.
+const stopFlushTimeout = 5 * time.Second
+
+// FlushResult is the outcome of one reporter's final flush at task stop.
+// Flushed and Remaining are set for reporters implementing
+// plugin.PendingReporter only.
+type FlushResult struct {
+	Reporter  string `json:"reporter"`
+	Duration  string `json:"duration"`
+	TimedOut  bool   `json:"timed_out,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Flushed   *int   `json:"flushed,omitempty"`   // items delivered by the flush
+	Remaining *int   `json:"remaining,omitempty"` // items still buffered after it
+}
+
+// flushTimeout returns the flush bound of reporter i: its flush_timeout, or
+// def. A shadow reporter of a swap, past the configured reporters, gets def.
+func (t *Task) flushTimeout(i int, def time.Duration) time.Duration {
+	if i < len(t.Config.Reporters) {
+		if d, err := time.ParseDuration(t.Config.Reporters[i].FlushTimeout); err == nil && d > 0 {
+			return d
+		}
+	}
+	return def
+}
+
+// flushReporters flushes and stops all reporters in parallel, each bounded by
+// ctx and its flush timeout (def if it sets none; 0 is no bound), and records
+// the outcomes for Status. Stop gets a fresh timeout, so a flush that used up
+// its own still lets the reporter close.
+func (t *Task) flushReporters(ctx context.Context, def time.Duration) {
+	results := make([]FlushResult, len(t.Reporters))
+	var wg sync.WaitGroup
+	for i, rep := range t.Reporters {
+		timeout := t.flushTimeout(i, def)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = t.flushReporter(ctx, i, rep, timeout)
+
+			stopCtx, cancel := withOptionalTimeout(ctx, timeout)
+			defer cancel()
+			if err := rep.Stop(stopCtx); err != nil {
+				slog.Warn("reporter stop error", "task_id", t.Config.ID, "reporter_id", i, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	t.mu.Lock()
+	t.flush = results
+	t.mu.Unlock()
+}
+
+// flushReporter runs the final Flush of reporter i.
+func (t *Task) flushReporter(ctx context.Context, i int, rep plugin.Reporter, timeout time.Duration) FlushResult {
+	flushCtx, cancel := withOptionalTimeout(ctx, timeout)
+	defer cancel()
+
+	pr, pending := rep.(plugin.PendingReporter)
+	before := 0
+	if pending {
+		before = pr.Pending()
+	}
+
+	slog.Debug("flushing reporter", "task_id", t.Config.ID, "reporter_id", i, "timeout", timeout)
+	start := time.Now()
+	err := rep.Flush(flushCtx)
+	res := FlushResult{
+		Reporter: rep.Name(),
+		Duration: time.Since(start).String(),
+		TimedOut: errors.Is(flushCtx.Err(), context.DeadlineExceeded),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	if pending {
+		remaining := pr.Pending()
+		flushed := max(before-remaining, 0)
+		res.Flushed, res.Remaining = &flushed, &remaining
+	}
+
+	if err != nil || res.TimedOut {
+		args := []any{"task_id", t.Config.ID, "reporter_id", i, "reporter", res.Reporter,
+			"timed_out", res.TimedOut, "error", err}
+		if res.Remaining != nil {
+			args = append(args, "remaining", *res.Remaining)
+		}
+		slog.Warn("reporter flush incomplete", args...)
+	}
+	return res
+}
+
+// withOptionalTimeout derives a context from ctx bounded by timeout, unless
+// timeout is 0.
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
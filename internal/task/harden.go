@@ -0,0 +1,46 @@
+package task
+
+import (
+	"log/slog"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/pipeline"
+)
+
+// Hardened parser defaults.
+const (
+	defaultHardenedMaxPayload = 65535
+	defaultCorpusMaxFiles     = 1000
+)
+
+// hardenedParsers returns the hardening of each task parser, nil where a
+// parser is not hardened. A corpus is shared by the parser's instances in
+// all pipelines.
+func hardenedParsers(cfg config.TaskConfig) ([]*pipeline.HardenedParser, error) {
+	out := make([]*pipeline.HardenedParser, len(cfg.Parsers))
+	for i, pc := range cfg.Parsers {
+		h := pc.Hardened
+		if h == nil {
+			continue
+		}
+		hp := &pipeline.HardenedParser{MaxPayload: h.MaxPayload}
+		if hp.MaxPayload == 0 {
+			hp.MaxPayload = defaultHardenedMaxPayload
+		}
+		if h.CorpusDir != "" {
+			maxFiles := h.CorpusMaxFiles
+			if maxFiles == 0 {
+				maxFiles = defaultCorpusMaxFiles
+			}
+			corpus, err := pipeline.NewCorpus(h.CorpusDir, maxFiles)
+			if err != nil {
+				return nil, err
+			}
+			hp.Corpus = corpus
+		}
+		out[i] = hp
+		slog.Info("parser hardened mode enabled", "task_id", cfg.ID, "parser", pc.Name,
+			"max_payload", hp.MaxPayload, "corpus_dir", h.CorpusDir)
+	}
+	return out, nil
+}
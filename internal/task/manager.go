@@ -2,15 +2,28 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sort"
 	"sync"
 	"time"
 
+	"firestige.xyz/otus/internal/analyze"
+	"firestige.xyz/otus/internal/calls"
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
 	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/nicadvisor"
 	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/internal/streamtable"
+	"firestige.xyz/otus/internal/tcpanalysis"
+	"firestige.xyz/otus/internal/tlsdecrypt"
+	"firestige.xyz/otus/internal/tlspolicy"
+	"firestige.xyz/otus/internal/topk"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
@@ -24,6 +37,45 @@ type TaskManager struct {
 
 	// store is the persistence backend (noopStore when disabled).
 	store TaskStore
+
+	// persistMu orders store writes, which may be remote (S3), and is held
+	// without mu: a save checks under it that its task was not deleted, and
+	// Delete removes a record under it.
+	persistMu sync.Mutex
+
+	// parentCtx is the parent of every task context (Background by default).
+	parentCtx context.Context
+
+	// maxTasks bounds concurrent tasks; 0 = unlimited.
+	maxTasks int
+
+	// maxRestarts bounds the Restore restarts of a task that failed with a
+	// transient error; 0 = never restart failed tasks.
+	maxRestarts int
+
+	// declared holds the IDs of the tasks created by Autostart; Restore
+	// leaves their persisted records alone.
+	declared map[string]bool
+
+	// qualitySink receives the quality alerts of all tasks for the control
+	// plane; nil = reporters only.
+	qualitySink func(qualityalert.Alert)
+
+	// tlsPolicy is handed to TLS-capable reporters (nil = Go defaults).
+	tlsPolicy *tlspolicy.Policy
+
+	// shared is the agent-wide FlowRegistry for tasks with registry: shared.
+	// It is cleared when the last task using it is deleted (sharedRefs, guarded by mu).
+	shared     *FlowRegistry
+	sharedRefs int
+}
+
+// StopResult records the outcome of stopping a single task.
+type StopResult struct {
+	TaskID   string        `json:"task_id"`
+	State    TaskState     `json:"state"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
 }
 
 // NewTaskManager creates a new task manager.
@@ -33,12 +85,61 @@ func NewTaskManager(agentID string, store TaskStore) *TaskManager {
 		store = noopStore{}
 	}
 	return &TaskManager{
-		tasks:   make(map[string]*Task),
-		agentID: agentID,
-		store:   store,
+		tasks:     make(map[string]*Task),
+		agentID:   agentID,
+		store:     store,
+		parentCtx: context.Background(),
+		maxTasks:  1,
+		shared:    NewFlowRegistry(),
 	}
 }
 
+// SetMaxTasks sets the maximum number of concurrent tasks (default 1).
+// 0 means unlimited.
+func (m *TaskManager) SetMaxTasks(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxTasks = n
+}
+
+// SetMaxRestarts sets how often Restore restarts a task whose last run
+// failed with a transient error (core.CategoryTransient); 0 disables it.
+func (m *TaskManager) SetMaxRestarts(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxRestarts = n
+}
+
+// SetQualityAlertSink sets the function every quality alert is handed to,
+// besides the task's reporters. It must not block: it runs on a pipeline.
+func (m *TaskManager) SetQualityAlertSink(sink func(qualityalert.Alert)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.qualitySink = sink
+}
+
+// SetTLSPolicy sets the agent-wide TLS policy given to reporters that
+// implement plugin.TLSPolicyAware.
+func (m *TaskManager) SetTLSPolicy(p *tlspolicy.Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tlsPolicy = p
+}
+
+// SharedRegistry returns the agent-wide FlowRegistry used by tasks configured
+// with registry: shared.
+func (m *TaskManager) SharedRegistry() *FlowRegistry {
+	return m.shared
+}
+
+// SetParentContext sets the context from which new task contexts are derived.
+// Tasks created afterwards are cancelled when ctx is cancelled.
+func (m *TaskManager) SetParentContext(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.parentCtx = ctx
+}
+
 // Create creates and starts a new task from configuration.
 // This implements the strict 7-phase assembly process described in architecture.md:
 // 1. Validate  - check TaskConfig completeness
@@ -51,24 +152,51 @@ func NewTaskManager(agentID string, store TaskStore) *TaskManager {
 //
 // Each phase completes fully before the next begins (strict separation).
 func (m *TaskManager) Create(cfg config.TaskConfig) error {
+	return m.CreateWithProgress(cfg, nil)
+}
+
+// Creation stages reported by CreateWithProgress.
+const (
+	StageValidating   = "validating"   // phases 1-2
+	StageConstructing = "constructing" // phases 3-6
+	StageStarting     = "starting"     // phase 7, including the self-test
+)
+
+// CreateWithProgress is Create reporting each stage to progress as it
+// begins. progress runs with the manager locked and must not block; nil
+// reports nothing.
+func (m *TaskManager) CreateWithProgress(cfg config.TaskConfig, progress func(stage string)) error {
+	if progress == nil {
+		progress = func(string) {}
+	}
+
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	task, err := m.create(cfg, progress)
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	m.persist(task)
+	return nil
+}
 
-	// Phase 1 limitation: maximum 1 task
-	if len(m.tasks) >= 1 {
-		return fmt.Errorf("phase 1 limitation: maximum 1 task allowed (current: %d)", len(m.tasks))
+// create builds, starts and registers a task. The caller holds m.mu.
+func (m *TaskManager) create(cfg config.TaskConfig, progress func(stage string)) (*Task, error) {
+	if m.maxTasks > 0 && len(m.tasks) >= m.maxTasks {
+		return nil, fmt.Errorf("maximum %d task(s) allowed (current: %d)", m.maxTasks, len(m.tasks))
 	}
 
 	// Check for duplicate ID
 	if _, exists := m.tasks[cfg.ID]; exists {
-		return fmt.Errorf("task %q already exists", cfg.ID)
+		return nil, fmt.Errorf("task %q already exists", cfg.ID)
 	}
 
 	slog.Info("creating task", "task_id", cfg.ID)
 
 	// ========== Phase 1: Validate ==========
+	progress(StageValidating)
 	if err := cfg.Validate(); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return nil, fmt.Errorf("validation failed: %w: %w", core.ErrConfigInvalid, err)
 	}
 
 	numPipelines := cfg.Workers
@@ -79,51 +207,111 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 
 	capFactory, err := plugin.GetCapturerFactory(cfg.Capture.Name)
 	if err != nil {
-		return fmt.Errorf("capturer %q: %w", cfg.Capture.Name, err)
+		return nil, fmt.Errorf("capturer %q: %w", cfg.Capture.Name, err)
+	}
+	extraFactories := make([]plugin.CapturerFactory, len(cfg.ExtraCaptures))
+	for i, ec := range cfg.ExtraCaptures {
+		f, err := plugin.GetCapturerFactory(ec.Name)
+		if err != nil {
+			return nil, fmt.Errorf("extra capturer %q: %w", ec.Name, err)
+		}
+		extraFactories[i] = f
 	}
 
 	parserFactories := make([]plugin.ParserFactory, len(cfg.Parsers))
 	for i, pc := range cfg.Parsers {
 		f, err := plugin.GetParserFactory(pc.Name)
 		if err != nil {
-			return fmt.Errorf("parser %q: %w", pc.Name, err)
+			return nil, fmt.Errorf("parser %q: %w", pc.Name, err)
 		}
 		parserFactories[i] = f
 	}
 
+	// Shadow parsers: nil where a parser has no shadow
+	shadowFactories := make([]plugin.ParserFactory, len(cfg.Parsers))
+	for i, pc := range cfg.Parsers {
+		if pc.Shadow == nil {
+			continue
+		}
+		f, err := plugin.GetParserFactory(pc.Shadow.Name)
+		if err != nil {
+			return nil, fmt.Errorf("parser %q shadow %q: %w", pc.Name, pc.Shadow.Name, err)
+		}
+		shadowFactories[i] = f
+	}
+
 	processorFactories := make([]plugin.ProcessorFactory, len(cfg.Processors))
 	for i, pc := range cfg.Processors {
 		f, err := plugin.GetProcessorFactory(pc.Name)
 		if err != nil {
-			return fmt.Errorf("processor %q: %w", pc.Name, err)
+			return nil, fmt.Errorf("processor %q: %w", pc.Name, err)
 		}
 		processorFactories[i] = f
 	}
 
-	repFactories := make([]plugin.ReporterFactory, len(cfg.Reporters))
-	for i, rc := range cfg.Reporters {
+	// analyze_only tasks count packets instead of reporting them; configured
+	// reporters are neither constructed nor connected.
+	reporterConfigs := cfg.Reporters
+	if cfg.AnalyzeOnly() {
+		reporterConfigs = nil
+	}
+	repFactories := make([]plugin.ReporterFactory, len(reporterConfigs))
+	for i, rc := range reporterConfigs {
 		f, err := plugin.GetReporterFactory(rc.Name)
 		if err != nil {
-			return fmt.Errorf("reporter %q: %w", rc.Name, err)
+			return nil, fmt.Errorf("reporter %q: %w", rc.Name, err)
 		}
 		repFactories[i] = f
 	}
 
+	// TLS decryption keys are loaded here so that a bad key fails the task
+	// before any plugin is constructed
+	var tlsDecryptor *tlsdecrypt.Decryptor
+	if td := cfg.TLSDecryption; td.Enabled() {
+		idle, _ := time.ParseDuration(td.IdleTimeout) // validated; "" → default
+		tlsDecryptor, err = tlsdecrypt.New(cfg.ID, tlsdecrypt.Config{
+			Ports:       td.Ports,
+			KeyLogFile:  td.KeyLogFile,
+			PrivateKeys: td.PrivateKeys,
+			MaxConns:    td.MaxConns,
+			IdleTimeout: idle,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("tls_decryption: %w: %w", core.ErrConfig, err)
+		}
+	}
+
 	// ========== Phase 3: Construct ==========
+	progress(StageConstructing)
 	// Create all empty instances. No Init or Wire yet.
 	slog.Debug("constructing plugin instances", "task_id", cfg.ID)
 
-	task := NewTask(cfg)
+	task := NewTaskWithContext(m.parentCtx, cfg)
+
+	// Capture interface advice: RX queues / IRQs vs workers, optional auto fanout
+	captureConfig, advice := adviseCapture(cfg, nicadvisor.Inspector{})
+	task.CaptureAdvice = advice
+
+	// Lifetime counters: continue from the last record of a task with this ID
+	if cfg.Counters.Persist {
+		if pt, err := m.store.Load(cfg.ID); err == nil && pt.Counters != nil {
+			task.restoreCounters(*pt.Counters)
+		}
+	}
 
 	// Capturers: binding mode = N instances, dispatch mode = 1 instance
 	numCapturers := 1
 	if cfg.Capture.DispatchMode == "binding" {
 		numCapturers = numPipelines
 	}
-	task.Capturers = make([]plugin.Capturer, numCapturers)
+	task.Capturers = make([]plugin.Capturer, numCapturers, numCapturers+len(extraFactories))
 	for i := range task.Capturers {
 		task.Capturers[i] = capFactory()
 	}
+	// Extra captures (dispatch mode only, validated) follow the main capturer
+	for _, f := range extraFactories {
+		task.Capturers = append(task.Capturers, f())
+	}
 
 	// Reporters: M instances (one per configured reporter)
 	task.Reporters = make([]plugin.Reporter, len(repFactories))
@@ -131,22 +319,103 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 		task.Reporters[i] = repFactories[i]()
 	}
 
-	// FlowRegistry: 1 per Task (shared across pipelines)
-	task.Registry = NewFlowRegistry()
+	// FlowRegistry: 1 per Task (shared across pipelines); registry: shared
+	// tasks use the agent-wide registry instead, selected in Phase 5
+	if !cfg.SharedRegistry() {
+		task.Registry = NewFlowRegistry()
+	}
+
+	// Call table: 1 per Task (shared across pipelines), optional
+	if cfg.Calls.Enabled {
+		idle, _ := time.ParseDuration(cfg.Calls.IdleTimeout) // validated; "" → default
+		task.Calls = calls.NewTable(cfg.ID, cfg.Calls.MaxCalls, idle)
+	}
+
+	// Call quality alerts: 1 per Task (shared across pipelines), optional
+	if qa := cfg.QualityAlerts; qa.Enabled() {
+		cooldown, _ := time.ParseDuration(qa.Cooldown) // validated; "" → default
+		task.Quality = qualityalert.NewMonitor(cfg.ID, qualityalert.Thresholds{
+			MOSBelow:      qa.MOSBelow,
+			JitterMsAbove: qa.JitterMsAbove,
+			LossPctAbove:  qa.LossPctAbove,
+			RTTMsAbove:    qa.RTTMsAbove,
+		}, cooldown, task.Calls, func(a qualityalert.Alert) { m.emitQualityAlert(task, a) })
+	}
+
+	// Heavy hitters: 1 per Task (shared across pipelines), optional
+	if len(cfg.TopK.Keys) > 0 {
+		task.TopK = topk.NewTracker(cfg.TopK.Keys, cfg.TopK.K, cfg.TopK.Capacity)
+	}
+
+	// TCP segment analysis: 1 per Task (shared across pipelines), optional
+	if cfg.TCPAnalysis.Enabled {
+		idle, _ := time.ParseDuration(cfg.TCPAnalysis.IdleTimeout) // validated; "" → default
+		task.TCP = tcpanalysis.NewTracker(cfg.ID, cfg.TCPAnalysis.MaxConns, idle)
+	}
+
+	// TLS decryption: 1 per Task (shared across pipelines), optional
+	task.TLS = tlsDecryptor
+
+	// RTP stream table for RTCP correlation: 1 per Task (shared across pipelines), optional
+	if cfg.RTCPCorrelation.Enabled {
+		idle, _ := time.ParseDuration(cfg.RTCPCorrelation.IdleTimeout) // validated; "" → default
+		task.Streams = streamtable.NewTable(cfg.ID, cfg.RTCPCorrelation.MaxStreams, idle)
+	}
+
+	// Analyzer: replaces reporters in analyze_only mode
+	if cfg.AnalyzeOnly() {
+		task.Analyzer = analyze.NewCounter(cfg.Analyze.Labels, cfg.Analyze.MaxValues)
+	}
+
+	// Send buffer admission by payload type, optional
+	var dropPolicy *pipeline.DropPolicy
+	if dp := cfg.DropPolicy; dp.Enabled {
+		high, low := dp.High, dp.Low
+		if high == nil {
+			high = config.DefaultDropPolicyHigh
+		}
+		if low == nil {
+			low = config.DefaultDropPolicyLow
+		}
+		shedAbove := dp.ShedAbove
+		if shedAbove == 0 {
+			shedAbove = config.DefaultDropPolicyShedAbove
+		}
+		highWait, _ := time.ParseDuration(dp.HighWait) // validated
+		if highWait == 0 {
+			highWait = config.DefaultDropPolicyHighWait
+		}
+		dropPolicy = pipeline.NewDropPolicy(high, low, shedAbove, highWait)
+	}
+
+	// Decoded fields carried to processors (validated)
+	meta, _ := core.ParseMetaFields(cfg.Decoder.Metadata)
 
 	// Decoder: 1 per Task (stateless, shared across pipelines)
 	sharedDecoder := decoder.NewStandardDecoder(decoder.Config{
-		Tunnels:      cfg.Decoder.Tunnels,
-		IPReassembly: cfg.Decoder.IPReassembly,
+		Tunnels:         cfg.Decoder.Tunnels,
+		VXLANPorts:      cfg.Decoder.VXLANPorts,
+		IPReassembly:    cfg.Decoder.IPReassembly,
+		MaxFragsPerIP:   cfg.Decoder.FragmentRateLimit.MaxFragsPerIP,
+		RateLimitWindow: cfg.Decoder.FragmentRateLimit.WindowDuration(),
 	})
+	task.Decoder = sharedDecoder
 
 	// Parsers and Processors: N copies (one set per Pipeline)
 	allParsers := make([][]plugin.Parser, numPipelines)
+	allShadows := make([][]*pipeline.ShadowParser, numPipelines)
 	allProcessors := make([][]plugin.Processor, numPipelines)
 	for i := 0; i < numPipelines; i++ {
 		allParsers[i] = make([]plugin.Parser, len(cfg.Parsers))
+		allShadows[i] = make([]*pipeline.ShadowParser, len(cfg.Parsers))
 		for j := range cfg.Parsers {
 			allParsers[i][j] = parserFactories[j]()
+			if shadowFactories[j] != nil {
+				allShadows[i][j] = &pipeline.ShadowParser{
+					Parser:       shadowFactories[j](),
+					IgnoreLabels: cfg.Parsers[j].Shadow.IgnoreLabels,
+				}
+			}
 		}
 		allProcessors[i] = make([]plugin.Processor, len(cfg.Processors))
 		for j := range cfg.Processors {
@@ -158,17 +427,42 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 	// Inject plugin-specific config into all instances uniformly.
 	slog.Debug("initializing all plugin instances", "task_id", cfg.ID)
 
-	// Init Capturers
-	for _, cap := range task.Capturers {
-		if err := cap.Init(cfg.Capture.ToPluginConfig()); err != nil {
-			return fmt.Errorf("capturer init failed: %w", err)
+	// Init Capturers; queue-aware capturers learn their queue first so Init
+	// can validate it against the plugin config
+	for _, capturer := range task.Capturers {
+		setFeatureFlags(task.Flags, capturer)
+	}
+	task.SetMaxPPS(cfg.Capture.MaxPPS)
+	if err := task.setPrefilter(); err != nil {
+		return nil, err
+	}
+	for i, capturer := range task.Capturers[:numCapturers] {
+		if qa, ok := capturer.(plugin.QueueAware); ok {
+			qa.SetQueue(i, numCapturers)
+		}
+		if err := capturer.Init(captureConfig); err != nil {
+			return nil, fmt.Errorf("capturer init failed: %w", initError(err))
+		}
+	}
+	for i, capturer := range task.Capturers[numCapturers:] {
+		if qa, ok := capturer.(plugin.QueueAware); ok {
+			qa.SetQueue(0, 1)
+		}
+		if err := capturer.Init(cfg.ExtraCaptures[i].ToPluginConfig()); err != nil {
+			return nil, fmt.Errorf("extra capturer %q init failed: %w", cfg.ExtraCaptures[i].Name, initError(err))
 		}
 	}
 
-	// Init Reporters
+	// Init Reporters; TLS-capable reporters get the agent-wide policy first
 	for i, rep := range task.Reporters {
+		if ta, ok := rep.(plugin.TLSPolicyAware); ok {
+			ta.SetTLSPolicy(m.tlsPolicy)
+		}
+		if ta, ok := rep.(plugin.TaskAware); ok {
+			ta.SetTaskID(cfg.ID)
+		}
 		if err := rep.Init(cfg.Reporters[i].Config); err != nil {
-			return fmt.Errorf("reporter %q init failed: %w", cfg.Reporters[i].Name, err)
+			return nil, fmt.Errorf("reporter %q init failed: %w", cfg.Reporters[i].Name, initError(err))
 		}
 	}
 
@@ -176,12 +470,20 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 	for i := 0; i < numPipelines; i++ {
 		for j, parser := range allParsers[i] {
 			if err := parser.Init(cfg.Parsers[j].Config); err != nil {
-				return fmt.Errorf("pipeline %d parser %q init failed: %w", i, cfg.Parsers[j].Name, err)
+				return nil, fmt.Errorf("pipeline %d parser %q init failed: %w", i, cfg.Parsers[j].Name, initError(err))
+			}
+		}
+		for j, shadow := range allShadows[i] {
+			if shadow == nil {
+				continue
+			}
+			if err := shadow.Parser.Init(cfg.Parsers[j].Shadow.Config); err != nil {
+				return nil, fmt.Errorf("pipeline %d parser %q shadow %q init failed: %w", i, cfg.Parsers[j].Name, cfg.Parsers[j].Shadow.Name, initError(err))
 			}
 		}
 		for j, proc := range allProcessors[i] {
 			if err := proc.Init(cfg.Processors[j].Config); err != nil {
-				return fmt.Errorf("pipeline %d processor %q init failed: %w", i, cfg.Processors[j].Name, err)
+				return nil, fmt.Errorf("pipeline %d processor %q init failed: %w", i, cfg.Processors[j].Name, initError(err))
 			}
 		}
 	}
@@ -190,6 +492,12 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 	// Inject Task-level shared resources into plugins that need them.
 	slog.Debug("wiring shared resources", "task_id", cfg.ID)
 
+	// The agent-wide registry is safe for concurrent use by several tasks:
+	// all access goes through FlowRegistry's sync.Map and atomic counter.
+	if cfg.SharedRegistry() {
+		task.Registry = m.shared
+	}
+
 	for i := 0; i < numPipelines; i++ {
 		for _, parser := range allParsers[i] {
 			if fra, ok := parser.(plugin.FlowRegistryAware); ok {
@@ -199,6 +507,30 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 					"pipeline_id", i,
 					"parser_name", parser.Name())
 			}
+			if ta, ok := parser.(plugin.TaskAware); ok {
+				ta.SetTaskID(cfg.ID)
+			}
+		}
+		for _, proc := range allProcessors[i] {
+			if ta, ok := proc.(plugin.TaskAware); ok {
+				ta.SetTaskID(cfg.ID)
+			}
+		}
+	}
+
+	// Shadow parsers read the task's flow state but keep their writes to
+	// themselves, so a diverging candidate cannot corrupt it.
+	if slices.ContainsFunc(cfg.Parsers, func(pc config.ParserConfig) bool { return pc.Shadow != nil }) {
+		shadowRegistry := newShadowFlowRegistry(task.Registry)
+		for i := 0; i < numPipelines; i++ {
+			for _, shadow := range allShadows[i] {
+				if shadow == nil {
+					continue
+				}
+				if fra, ok := shadow.Parser.(plugin.FlowRegistryAware); ok {
+					fra.SetFlowRegistry(shadowRegistry)
+				}
+			}
 		}
 	}
 
@@ -206,6 +538,16 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 	// Build Pipelines from fully initialized and wired plugins.
 	slog.Debug("assembling pipelines", "task_id", cfg.ID)
 
+	hardened, err := hardenedParsers(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	orderLogs, err := openOrderLogs(cfg, numPipelines)
+	if err != nil {
+		return nil, err
+	}
+
 	for i := 0; i < numPipelines; i++ {
 		p := pipeline.New(pipeline.Config{
 			ID:         i,
@@ -214,6 +556,18 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 			Decoder:    sharedDecoder,
 			Parsers:    allParsers[i],
 			Processors: allProcessors[i],
+			Shadows:    allShadows[i],
+			Hardened:   hardened,
+			Calls:      task.Calls,
+			TopK:       task.TopK,
+			TCP:        task.TCP,
+			TLS:        task.TLS,
+			Streams:    task.Streams,
+			Quality:    task.Quality,
+			OrderLog:   orderLogs[i],
+			Flags:      task.Flags,
+			Meta:       meta,
+			DropPolicy: dropPolicy,
 		})
 		task.Pipelines = append(task.Pipelines, p)
 	}
@@ -225,8 +579,18 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 		reporterByName[rep.Name()] = rep
 	}
 
+	// The members of a failover group share one wrapper, built at the
+	// group's first tier.
+	groups := cfg.FailoverGroups()
 	for i, rep := range task.Reporters {
 		rcfg := cfg.Reporters[i]
+		var members []int
+		if rcfg.Failover != nil {
+			members = groups[rcfg.Failover.Group]
+			if members[0] != i {
+				continue
+			}
+		}
 		var fallback plugin.Reporter
 		if rcfg.Fallback != "" {
 			if fb, ok := reporterByName[rcfg.Fallback]; ok {
@@ -236,57 +600,55 @@ func (m *TaskManager) Create(cfg config.TaskConfig) error {
 					"task_id", cfg.ID, "reporter", rcfg.Name, "fallback", rcfg.Fallback)
 			}
 		}
-
-		var batchTimeout time.Duration
-		if rcfg.BatchTimeout != "" {
-			if parsed, err := time.ParseDuration(rcfg.BatchTimeout); err == nil {
-				batchTimeout = parsed
-			} else {
-				slog.Warn("invalid batch_timeout, using default",
-					"task_id", cfg.ID, "reporter", rcfg.Name, "value", rcfg.BatchTimeout, "error", err)
-			}
-		}
-
-		w := NewReporterWrapper(WrapperConfig{
-			Primary:      rep,
-			Fallback:     fallback,
-			TaskID:       cfg.ID,
-			BatchSize:    rcfg.BatchSize,
-			BatchTimeout: batchTimeout,
-		})
+		w := newReporterWrapper(cfg.ID, rep, rcfg, fallback, task.Flags, failoverTiers(task.Reporters, cfg.Reporters, members)...)
 		task.ReporterWrappers = append(task.ReporterWrappers, w)
 	}
 
 	// ========== Phase 7: Start ==========
+	progress(StageStarting)
 	slog.Debug("starting task", "task_id", cfg.ID)
 
 	if err := task.Start(); err != nil {
 		task.cancel() // Release context resources on failed start
-		return fmt.Errorf("task start failed: %w", err)
+		return nil, fmt.Errorf("task start failed: %w", err)
 	}
 
-	// Register task in manager and persist initial running state.
+	// Register task in manager; the caller persists its initial running state.
 	m.tasks[cfg.ID] = task
-	m.saveTask(task)
+	if cfg.SharedRegistry() {
+		m.sharedRefs++
+	}
+	if cfg.Counters.Persist {
+		interval, _ := time.ParseDuration(cfg.Counters.Interval) // validated; "" → default
+		if interval <= 0 {
+			interval = defaultCountersInterval
+		}
+		go m.persistCountersLoop(task, interval)
+	}
+	if cfg.MediaGap.Timeout != "" {
+		timeout, _ := time.ParseDuration(cfg.MediaGap.Timeout) // validated
+		go m.mediaGapLoop(task, timeout)
+	}
 
 	slog.Info("task created successfully",
 		"task_id", cfg.ID,
 		"pipelines", numPipelines,
 		"capturers", numCapturers,
-		"reporters", len(cfg.Reporters),
+		"reporters", len(task.Reporters),
+		"analyze_only", cfg.AnalyzeOnly(),
+		"shared_registry", cfg.SharedRegistry(),
 		"dispatch_mode", cfg.Capture.DispatchMode,
 		"state", task.State())
 
-	return nil
+	return task, nil
 }
 
 // Delete stops and removes a task.
 func (m *TaskManager) Delete(taskID string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	task, exists := m.tasks[taskID]
 	if !exists {
+		m.mu.Unlock()
 		return fmt.Errorf("task %q not found", taskID)
 	}
 
@@ -298,19 +660,105 @@ func (m *TaskManager) Delete(taskID string) error {
 		// Continue with deletion even if stop failed
 	}
 
-	// Persist the final stopped state, then remove the on-disk record.
-	m.saveTask(task)
-	if err := m.store.Delete(taskID); err != nil {
-		slog.Warn("failed to delete persisted task record", "task_id", taskID, "error", err)
-	}
-
 	// Remove from manager
 	delete(m.tasks, taskID)
 
+	// Flow state in the shared registry outlives a single task, but not the
+	// last task using it.
+	if task.Config.SharedRegistry() {
+		m.sharedRefs--
+		if m.sharedRefs == 0 {
+			m.shared.Clear()
+		}
+	}
+	m.mu.Unlock()
+
+	// Persist the final stopped state, then remove the on-disk record, unless
+	// a task with the same ID was created meanwhile and owns it now.
+	m.persistMu.Lock()
+	m.saveTask(task)
+	m.mu.RLock()
+	_, recreated := m.tasks[taskID]
+	m.mu.RUnlock()
+	if !recreated {
+		if err := m.store.Delete(taskID); err != nil {
+			slog.Warn("failed to delete persisted task record", "task_id", taskID, "error", err)
+		}
+	}
+	m.persistMu.Unlock()
+
 	slog.Info("task deleted", "task_id", taskID)
 	return nil
 }
 
+// Drain drains a running task (see Task.Drain) and persists its final
+// state. Unlike Delete the task stays in the manager.
+func (m *TaskManager) Drain(taskID string, timeout time.Duration) (time.Duration, error) {
+	task, err := m.Get(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	elapsed, err := task.Drain(timeout)
+	m.persist(task)
+	return elapsed, err
+}
+
+// SwapReporter replaces reporter replace of a running task with a new
+// reporter built from rc, after the new one has run in shadow mode for warmup
+// (see ReporterSwap). It returns once the new reporter is running; the task
+// config is persisted with the new reporter when the swap switches.
+func (m *TaskManager) SwapReporter(taskID, replace string, rc config.ReporterConfig, warmup time.Duration) error {
+	m.mu.RLock()
+	t, exists := m.tasks[taskID]
+	tlsPolicy := m.tlsPolicy
+	m.mu.RUnlock()
+	if !exists {
+		return fmt.Errorf("task %q not found", taskID)
+	}
+	if warmup <= 0 {
+		return fmt.Errorf("warmup must be positive")
+	}
+	if err := rc.Validate(); err != nil {
+		return err
+	}
+	if rc.Failover != nil {
+		return fmt.Errorf("reporter %q: failover group reporters cannot be swapped in", rc.Name)
+	}
+
+	factory, err := plugin.GetReporterFactory(rc.Name)
+	if err != nil {
+		return fmt.Errorf("reporter %q: %w", rc.Name, err)
+	}
+	rep := factory()
+	if ta, ok := rep.(plugin.TLSPolicyAware); ok {
+		ta.SetTLSPolicy(tlsPolicy)
+	}
+	if ta, ok := rep.(plugin.TaskAware); ok {
+		ta.SetTaskID(taskID)
+	}
+	if err := rep.Init(rc.Config); err != nil {
+		return fmt.Errorf("reporter %q init failed: %w", rc.Name, err)
+	}
+
+	var fallback plugin.Reporter
+	if rc.Fallback != "" {
+		t.mu.RLock()
+		for _, r := range t.Reporters {
+			if r.Name() == rc.Fallback {
+				fallback = r
+			}
+		}
+		t.mu.RUnlock()
+		if fallback == nil {
+			return fmt.Errorf("fallback reporter %q not found", rc.Fallback)
+		}
+	}
+	w := newReporterWrapper(taskID, rep, rc, fallback, t.Flags)
+
+	return t.SwapReporter(replace, rep, rc, w, warmup, func() { m.persist(t) })
+}
+
 // Get retrieves a task by ID.
 func (m *TaskManager) Get(taskID string) (*Task, error) {
 	m.mu.RLock()
@@ -337,6 +785,26 @@ func (m *TaskManager) List() []string {
 	return ids
 }
 
+// Select returns the IDs of tasks carrying all of the given tags, sorted.
+// An empty tag list matches no task.
+func (m *TaskManager) Select(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []string
+	for id, task := range m.tasks {
+		if task.Config.HasTags(tags) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 // Status returns status for all tasks.
 func (m *TaskManager) Status() map[string]Status {
 	m.mu.RLock()
@@ -358,30 +826,57 @@ func (m *TaskManager) Count() int {
 	return len(m.tasks)
 }
 
-// StopAll stops all tasks (useful for shutdown).
-func (m *TaskManager) StopAll() error {
+// StopAll stops all tasks in parallel (useful for shutdown).
+// Each task is bounded by its own stop timeout, so a slow task cannot delay
+// the others. Results are returned sorted by task ID.
+func (m *TaskManager) StopAll() []StopResult {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 
 	slog.Info("stopping all tasks", "count", len(m.tasks))
 
-	var lastErr error
-	for id, task := range m.tasks {
-		if err := task.Stop(); err != nil {
-			slog.Warn("error stopping task", "task_id", id, "error", err)
-			lastErr = err
-		}
-	}
+	results := make([]StopResult, 0, len(m.tasks))
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	for id, t := range m.tasks {
+		wg.Add(1)
+		go func(id string, t *Task) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := t.Stop()
+			r := StopResult{
+				TaskID:   id,
+				State:    t.State(),
+				Duration: time.Since(start),
+			}
+			if err != nil {
+				slog.Warn("error stopping task", "task_id", id, "error", err)
+				r.Error = err.Error()
+			}
 
-	// Persist stopped state for all tasks before clearing.
-	for _, t := range m.tasks {
-		m.saveTask(t)
+			resultsMu.Lock()
+			results = append(results, r)
+			resultsMu.Unlock()
+		}(id, t)
 	}
+	wg.Wait()
 
 	// Clear all tasks
+	stopped := m.tasks
 	m.tasks = make(map[string]*Task)
+	m.mu.Unlock()
 
-	return lastErr
+	// Persist the final states outside m.mu.
+	m.persistMu.Lock()
+	for _, t := range stopped {
+		m.saveTask(t)
+	}
+	m.persistMu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].TaskID < results[j].TaskID
+	})
+	return results
 }
 
 // UpdateMetricsInterval propagates a new metrics collection interval to all running tasks.
@@ -397,17 +892,43 @@ func (m *TaskManager) UpdateMetricsInterval(d time.Duration) {
 	slog.Info("metrics interval updated for all tasks", "interval", d, "task_count", len(m.tasks))
 }
 
+// initError marks a plugin Init error without a category as a config
+// error: Init only reads the plugin config.
+func initError(err error) error {
+	if core.CategoryOf(err) == core.CategoryUnknown {
+		return fmt.Errorf("%w: %w", core.ErrConfig, err)
+	}
+	return err
+}
+
+// persist saves the current state of t unless it was deleted meanwhile.
+// Call it without m.mu: the store may be remote.
+func (m *TaskManager) persist(t *Task) {
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	m.mu.RLock()
+	current := m.tasks[t.Config.ID] == t
+	m.mu.RUnlock()
+	if current {
+		m.saveTask(t)
+	}
+}
+
 // saveTask persists the current state of a task to the configured store.
-// It is safe to call without holding m.mu; it acquires only the task's own read lock.
+// The caller holds m.persistMu and not m.mu; it acquires only the task's
+// own read lock.
 func (m *TaskManager) saveTask(t *Task) {
 	status := t.GetStatus()
 	pt := PersistedTask{
-		Version:       persistenceVersion,
-		Config:        t.Config,
-		State:         status.State,
-		CreatedAt:     status.CreatedAt,
-		FailureReason: status.FailureReason,
-		RestartCount:  0, // incremented on auto-restart (future enhancement)
+		Version:         persistenceVersion,
+		Config:          t.Config,
+		State:           status.State,
+		CreatedAt:       status.CreatedAt,
+		FailureReason:   status.FailureReason,
+		FailureCategory: status.FailureCategory,
+		RestartCount:    status.Restarts,
+		Flush:           status.Flush,
 	}
 	if !status.StartedAt.IsZero() {
 		pt.StartedAt = &status.StartedAt
@@ -415,18 +936,54 @@ func (m *TaskManager) saveTask(t *Task) {
 	if !status.StoppedAt.IsZero() {
 		pt.StoppedAt = &status.StoppedAt
 	}
+	if t.Config.Counters.Persist {
+		counters := t.LifetimeCounters()
+		pt.Counters = &counters
+	}
 	if err := m.store.Save(pt); err != nil {
 		slog.Warn("failed to persist task state", "task_id", t.Config.ID, "error", err)
 	}
 }
 
+// Autostart creates the tasks declared in the daemon config (otus.autostart)
+// in order. It runs before Restore: a declared task takes precedence over a
+// persisted task with the same ID, which Restore then skips even if the
+// declared task failed to start, so the config file stays the source of truth
+// for the tasks it declares. Declared tasks also take their task slots first.
+// A task that fails to start is logged and does not stop the others.
+func (m *TaskManager) Autostart(tasks []*config.TaskConfig) {
+	m.mu.Lock()
+	if m.declared == nil {
+		m.declared = make(map[string]bool, len(tasks))
+	}
+	for _, tc := range tasks {
+		m.declared[tc.ID] = true
+	}
+	m.mu.Unlock()
+
+	for _, tc := range tasks {
+		slog.Info("task autostart: creating declared task", "task_id", tc.ID)
+		if err := m.Create(*tc); err != nil {
+			slog.Error("task autostart: failed to create task",
+				"task_id", tc.ID, "error", err, "category", core.CategoryOf(err))
+		}
+	}
+}
+
 // Restore reads persisted tasks from the store and re-creates those that were
 // active at the time of the last shutdown. Tasks in a terminal state are left
-// as on-disk history only and do not consume an active task slot.
+// as on-disk history only and do not consume an active task slot, and tasks
+// declared by Autostart are skipped.
 //
 // autoRestart controls whether tasks in running/starting/stopping state are
-// automatically re-created.
+// automatically re-created. Tasks that failed with a transient error are
+// re-created too, at most SetMaxRestarts times in a row.
 func (m *TaskManager) Restore(autoRestart bool) {
+	m.mu.RLock()
+	maxRestarts := m.maxRestarts
+	declared := m.declared
+	m.mu.RUnlock()
+
 	persisted, err := m.store.List()
 	if err != nil {
 		slog.Error("task restore: failed to list persisted tasks", "error", err)
@@ -434,6 +991,11 @@ func (m *TaskManager) Restore(autoRestart bool) {
 	}
 
 	for _, pt := range persisted {
+		if declared[pt.Config.ID] {
+			slog.Info("task restore: skipping task declared in autostart",
+				"task_id", pt.Config.ID, "state", pt.State)
+			continue
+		}
 		switch pt.State {
 		case StateRunning, StateStarting, StateStopping:
 			if !autoRestart {
@@ -448,9 +1010,29 @@ func (m *TaskManager) Restore(autoRestart bool) {
 					"task_id", pt.Config.ID, "error", err)
 			}
 
+		case StateFailed:
+			if pt.FailureCategory != core.CategoryTransient || pt.RestartCount >= maxRestarts {
+				slog.Debug("task restore: not restarting failed task",
+					"task_id", pt.Config.ID, "category", pt.FailureCategory, "restarts", pt.RestartCount)
+				continue
+			}
+			slog.Info("task restore: restarting task after transient failure",
+				"task_id", pt.Config.ID, "reason", pt.FailureReason, "restart", pt.RestartCount+1)
+			if err := m.Create(pt.Config); err != nil {
+				slog.Error("task restore: failed to restart task",
+					"task_id", pt.Config.ID, "error", err, "category", core.CategoryOf(err))
+				continue
+			}
+			if t, err := m.Get(pt.Config.ID); err == nil {
+				t.mu.Lock()
+				t.restarts = pt.RestartCount + 1
+				t.mu.Unlock()
+				m.persist(t)
+			}
+
 		default:
-			// Terminal states (stopped, failed, created) are on-disk history only;
-			// they do not consume an active task slot.
+			// Terminal states (stopped, created, failed other than transiently)
+			// are on-disk history only; they do not consume an active task slot.
 			slog.Debug("task restore: skipping terminal task (history)",
 				"task_id", pt.Config.ID, "state", pt.State)
 		}
@@ -499,3 +1081,67 @@ func (m *TaskManager) GCOldTasks(maxHistory int) {
 		}
 	}
 }
+
+// newReporterWrapper builds the batching wrapper for reporter rep configured
+// by rcfg, or for the failover group of tiers, rep being the first.
+func newReporterWrapper(taskID string, rep plugin.Reporter, rcfg config.ReporterConfig, fallback plugin.Reporter, flags *featureflag.Set, tiers ...FailoverTier) *ReporterWrapper {
+	var batchTimeout time.Duration
+	if rcfg.BatchTimeout != "" {
+		if parsed, err := time.ParseDuration(rcfg.BatchTimeout); err == nil {
+			batchTimeout = parsed
+		} else {
+			slog.Warn("invalid batch_timeout, using default",
+				"task_id", taskID, "reporter", rcfg.Name, "value", rcfg.BatchTimeout, "error", err)
+		}
+	}
+
+	var group string
+	if len(tiers) > 0 {
+		group = rcfg.Failover.Group
+	}
+
+	return NewReporterWrapper(WrapperConfig{
+		Primary:      rep,
+		Fallback:     fallback,
+		Group:        group,
+		Tiers:        tiers,
+		TaskID:       taskID,
+		BatchSize:    rcfg.BatchSize,
+		BatchTimeout: batchTimeout,
+		Adaptive:     rcfg.AdaptiveBatch,
+		MinBatchSize: rcfg.MinBatchSize,
+		MaxBatchSize: rcfg.MaxBatchSize,
+		Flags:        flags,
+		Retry:        NewRetryPolicy(rcfg.Retry),
+	})
+}
+
+// failoverTiers returns the tiers of the failover group whose members are
+// the given indexes of reps and their configs, validated.
+func failoverTiers(reps []plugin.Reporter, rcfgs []config.ReporterConfig, members []int) []FailoverTier {
+	tiers := make([]FailoverTier, 0, len(members))
+	for _, i := range members {
+		fc := rcfgs[i].Failover
+		failback, _ := time.ParseDuration(fc.FailbackAfter) // "" → default
+		probe, _ := time.ParseDuration(fc.ProbeInterval)
+		tiers = append(tiers, FailoverTier{
+			Reporter:      reps[i],
+			FailAfter:     fc.FailAfter,
+			FailbackAfter: failback,
+			ProbeInterval: probe,
+		})
+	}
+	return tiers
+}
+
+// NewRetryPolicy converts a validated reporter retry config.
+func NewRetryPolicy(rc config.RetryConfig) RetryPolicy {
+	initial, _ := time.ParseDuration(rc.InitialBackoff) // "" → default
+	maxBackoff, _ := time.ParseDuration(rc.MaxBackoff)
+	return RetryPolicy{
+		MaxAttempts:    rc.MaxAttempts,
+		InitialBackoff: initial,
+		MaxBackoff:     maxBackoff,
+		Jitter:         rc.Jitter,
+	}
+}
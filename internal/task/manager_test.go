@@ -1,7 +1,16 @@
 package task
 
 import (
+	"context"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/pkg/plugin"
 )
 
 func TestNewTaskManager(t *testing.T) {
@@ -73,10 +82,10 @@ func TestTaskManagerDelete(t *testing.T) {
 func TestTaskManagerStopAll(t *testing.T) {
 	manager := NewTaskManager("test-agent", nil)
 
-	// StopAll on empty manager should not error
-	err := manager.StopAll()
-	if err != nil {
-		t.Errorf("Expected no error from StopAll on empty manager, got %v", err)
+	// StopAll on empty manager should report no results
+	results := manager.StopAll()
+	if len(results) != 0 {
+		t.Errorf("Expected no stop results on empty manager, got %d", len(results))
 	}
 
 	if manager.Count() != 0 {
@@ -84,5 +93,330 @@ func TestTaskManagerStopAll(t *testing.T) {
 	}
 }
 
+func TestTaskManagerSelect(t *testing.T) {
+	manager := NewTaskManager("test-agent", nil)
+	for id, tags := range map[string][]string{
+		"sip":   {"signaling", "site-a"},
+		"rtp-a": {"media", "site-a"},
+		"rtp-b": {"media", "site-b"},
+		"plain": nil,
+	} {
+		manager.tasks[id] = &Task{Config: config.TaskConfig{ID: id, Tags: tags}}
+	}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{[]string{"media"}, []string{"rtp-a", "rtp-b"}},
+		{[]string{"media", "site-a"}, []string{"rtp-a"}},
+		{[]string{"site-a"}, []string{"rtp-a", "sip"}},
+		{[]string{"debug"}, nil},
+		{nil, nil},
+	}
+	for _, tt := range tests {
+		got := manager.Select(tt.tags)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Select(%v) = %v, want %v", tt.tags, got, tt.want)
+		}
+	}
+}
+
+// registryParser records the FlowRegistry injected in the Wire phase.
+type registryParser struct {
+	registry plugin.FlowRegistry
+}
+
+func (p *registryParser) Name() string                                 { return "registry-recorder" }
+func (p *registryParser) Init(map[string]any) error                    { return nil }
+func (p *registryParser) Start(context.Context) error                  { return nil }
+func (p *registryParser) Stop(context.Context) error                   { return nil }
+func (p *registryParser) CanHandle(*core.DecodedPacket) bool           { return false }
+func (p *registryParser) SetFlowRegistry(registry plugin.FlowRegistry) { p.registry = registry }
+func (p *registryParser) Handle(*core.DecodedPacket) (any, core.Labels, error) {
+	return nil, nil, nil
+}
+
+var registerSharedRegistryPlugins sync.Once
+
+func sharedRegistryTaskConfig(id, registry string) config.TaskConfig {
+	registerSharedRegistryPlugins.Do(func() {
+		plugin.RegisterCapturer("shared-registry-mock", func() plugin.Capturer { return &mockCapturer{name: "shared-registry-mock"} })
+		plugin.RegisterParser("registry-recorder", func() plugin.Parser { return &registryParser{} })
+	})
+	return config.TaskConfig{
+		ID:       id,
+		Mode:     config.TaskModeAnalyzeOnly,
+		Capture:  config.CaptureConfig{Name: "shared-registry-mock", Interface: "lo"},
+		Parsers:  []config.ParserConfig{{Name: "registry-recorder"}},
+		Registry: registry,
+	}
+}
+
+func wiredRegistry(t *testing.T, m *TaskManager, id string) plugin.FlowRegistry {
+	t.Helper()
+	task, err := m.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task.Pipelines[0].Parsers()[0].(*registryParser).registry
+}
+
+func TestTaskManagerSharedRegistry(t *testing.T) {
+	m := NewTaskManager("test-agent", nil)
+	m.SetMaxTasks(0)
+	defer m.StopAll()
+
+	for _, cfg := range []config.TaskConfig{
+		sharedRegistryTaskConfig("signaling", config.RegistryShared),
+		sharedRegistryTaskConfig("media", config.RegistryShared),
+		sharedRegistryTaskConfig("other", ""),
+	} {
+		if err := m.Create(cfg); err != nil {
+			t.Fatalf("Create(%s): %v", cfg.ID, err)
+		}
+	}
+
+	if wiredRegistry(t, m, "signaling") != m.SharedRegistry() || wiredRegistry(t, m, "media") != m.SharedRegistry() {
+		t.Fatal("registry: shared tasks must be wired to the agent-wide registry")
+	}
+	if wiredRegistry(t, m, "other") == plugin.FlowRegistry(m.SharedRegistry()) {
+		t.Fatal("registry: task must get its own registry")
+	}
+
+	// Call context set by the signaling task is visible to the media task.
+	key := plugin.FlowKey{SrcPort: 10000, DstPort: 20000, Proto: 17}
+	wiredRegistry(t, m, "signaling").Set(key, map[string]string{"call_id": "abc"})
+	if _, ok := wiredRegistry(t, m, "media").Get(key); !ok {
+		t.Error("media task does not see flow registered by signaling task")
+	}
+
+	// Shared state survives until the last sharing task is deleted.
+	if err := m.Delete("signaling"); err != nil {
+		t.Fatal(err)
+	}
+	if m.SharedRegistry().Count() != 1 {
+		t.Errorf("shared registry count = %d after first delete, want 1", m.SharedRegistry().Count())
+	}
+	if err := m.Delete("media"); err != nil {
+		t.Fatal(err)
+	}
+	if m.SharedRegistry().Count() != 0 {
+		t.Errorf("shared registry count = %d after last delete, want 0", m.SharedRegistry().Count())
+	}
+}
+
+func TestTaskManagerMaxTasks(t *testing.T) {
+	m := NewTaskManager("test-agent", nil)
+	defer m.StopAll()
+
+	if err := m.Create(sharedRegistryTaskConfig("first", "")); err != nil {
+		t.Fatalf("Create(first): %v", err)
+	}
+	if err := m.Create(sharedRegistryTaskConfig("second", "")); err == nil {
+		t.Error("default limit of 1 task not enforced")
+	}
+
+	m.SetMaxTasks(2)
+	if err := m.Create(sharedRegistryTaskConfig("second", "")); err != nil {
+		t.Errorf("Create(second) with max_tasks 2: %v", err)
+	}
+}
+
 // Note: Full integration tests with actual plugin registration will be in
 // separate integration test files after plugins are implemented.
+
+// frameCapturer emits a fixed set of frames, then waits for Stop.
+type frameCapturer struct {
+	mockCapturer
+	frames [][]byte
+	stop   chan struct{}
+}
+
+func newFrameCapturer(name string, frames ...[]byte) *frameCapturer {
+	return &frameCapturer{mockCapturer: mockCapturer{name: name}, frames: frames, stop: make(chan struct{})}
+}
+
+func (c *frameCapturer) Stop(context.Context) error {
+	close(c.stop)
+	return nil
+}
+
+func (c *frameCapturer) Capture(ctx context.Context, out chan<- core.RawPacket) error {
+	for _, f := range c.frames {
+		out <- core.RawPacket{Data: f, CaptureLen: uint32(len(f)), OrigLen: uint32(len(f))}
+	}
+	c.setStats(uint64(len(c.frames)), 0)
+	select {
+	case <-c.stop:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+var registerHybridPlugins sync.Once
+
+func TestTaskManagerExtraCaptures(t *testing.T) {
+	registerHybridPlugins.Do(func() {
+		plugin.RegisterCapturer("hybrid-local", func() plugin.Capturer {
+			return newFrameCapturer("hybrid-local", udpFrame(40000, 40002, []byte{0x80}))
+		})
+		plugin.RegisterCapturer("hybrid-remote", func() plugin.Capturer {
+			sip := []byte("OPTIONS")
+			return newFrameCapturer("hybrid-remote", udpFrame(5060, 5060, sip), udpFrame(5060, 5060, sip))
+		})
+	})
+
+	m := NewTaskManager("test-agent", nil)
+	defer m.StopAll()
+	cfg := config.TaskConfig{
+		ID:            "hybrid",
+		Workers:       2,
+		Mode:          config.TaskModeAnalyzeOnly,
+		Capture:       config.CaptureConfig{Name: "hybrid-local", Interface: "eth0"},
+		ExtraCaptures: []config.ExtraCaptureConfig{{Name: "hybrid-remote", Interface: "hep0"}},
+	}
+	if err := m.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	task, _ := m.Get("hybrid")
+	if task.Config.Capture.DispatchMode != "dispatch" || len(task.Capturers) != 2 {
+		t.Fatalf("dispatch_mode = %q, capturers = %d; want dispatch with 2", task.Config.Capture.DispatchMode, len(task.Capturers))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for task.Analyzer.Snapshot().Packets < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := task.Analyzer.Snapshot().Packets; got != 3 {
+		t.Errorf("packets = %d, want 3 from both capturers", got)
+	}
+
+	stats := task.CapturerStatsList()
+	if len(stats) != 2 || stats[0].Interface != "eth0" || stats[1].Name != "hybrid-remote" ||
+		stats[1].Interface != "hep0" || stats[1].PacketsReceived != 2 {
+		t.Errorf("capturer stats = %+v", stats)
+	}
+}
+
+func TestTaskManagerRestoreFailed(t *testing.T) {
+	store := newTestStore(t)
+	for id, cat := range map[string]core.ErrorCategory{
+		"transient": core.CategoryTransient,
+		"config":    core.CategoryConfig,
+	} {
+		if err := store.Save(PersistedTask{
+			Config:          sharedRegistryTaskConfig(id, ""),
+			State:           StateFailed,
+			FailureReason:   "capturer error",
+			FailureCategory: cat,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Restarts are off by default
+	m := NewTaskManager("test-agent", store)
+	m.Restore(true)
+	if n := m.Count(); n != 0 {
+		t.Fatalf("restored %d failed tasks without max_restarts", n)
+	}
+
+	m.SetMaxRestarts(1)
+	m.Restore(true)
+	defer m.StopAll()
+	if _, err := m.Get("config"); err == nil {
+		t.Error("task that failed on its configuration was restarted")
+	}
+	task, err := m.Get("transient")
+	if err != nil {
+		t.Fatalf("transient failure not restarted: %v", err)
+	}
+	if s := task.GetStatus(); s.Restarts != 1 {
+		t.Errorf("restarts = %d, want 1", s.Restarts)
+	}
+	pt, err := store.Load("transient")
+	if err != nil || pt.RestartCount != 1 {
+		t.Fatalf("persisted restart count = %d (%v), want 1", pt.RestartCount, err)
+	}
+
+	// The budget is spent: a second transient failure stays down
+	pt.State = StateFailed
+	if err := store.Save(pt); err != nil {
+		t.Fatal(err)
+	}
+	m2 := NewTaskManager("test-agent", store)
+	m2.SetMaxRestarts(1)
+	m2.Restore(true)
+	if n := m2.Count(); n != 0 {
+		t.Errorf("restored %d tasks past max_restarts", n)
+	}
+
+	// A failure after a stable run does not count against the budget
+	task.mu.Lock()
+	task.startedAt = time.Now().Add(-stableRunDuration)
+	task.fail("capturer error", core.ErrTransient)
+	task.mu.Unlock()
+	if s := task.GetStatus(); s.Restarts != 0 {
+		t.Errorf("restarts after a stable run = %d, want 0", s.Restarts)
+	}
+}
+
+func TestTaskManagerAutostartPrecedence(t *testing.T) {
+	store := newTestStore(t)
+	for _, id := range []string{"declared", "broken", "persisted"} {
+		if err := store.Save(PersistedTask{Config: sharedRegistryTaskConfig(id, ""), State: StateRunning}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	declared := sharedRegistryTaskConfig("declared", "shared")
+	broken := sharedRegistryTaskConfig("broken", "")
+	broken.Capture.Name = "no-such-capturer"
+
+	m := NewTaskManager("test-agent", store)
+	m.SetMaxTasks(0)
+	m.Autostart([]*config.TaskConfig{&declared, &broken})
+	m.Restore(true)
+	defer m.StopAll()
+
+	task, err := m.Get("declared")
+	if err != nil {
+		t.Fatalf("declared task not created: %v", err)
+	}
+	if task.Config.Registry != "shared" {
+		t.Errorf("registry = %q, want the declared config to win over the persisted one", task.Config.Registry)
+	}
+	if _, err := m.Get("broken"); err == nil {
+		t.Error("persisted config restored for a declared task that failed to start")
+	}
+	if _, err := m.Get("persisted"); err != nil {
+		t.Errorf("undeclared persisted task not restored: %v", err)
+	}
+}
+
+func TestTaskManagerQualityAlertSink(t *testing.T) {
+	m := NewTaskManager("test-agent", nil)
+	var got []qualityalert.Alert
+	m.SetQualityAlertSink(func(a qualityalert.Alert) { got = append(got, a) })
+
+	cfg := sharedRegistryTaskConfig("quality", "")
+	cfg.QualityAlerts.LossPctAbove = 5
+	if err := m.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer m.StopAll()
+	task, _ := m.Get("quality")
+	if task.Quality == nil {
+		t.Fatal("no quality monitor for a task with quality_alerts")
+	}
+
+	task.Quality.Observe(&core.OutputPacket{Timestamp: time.Now(), Labels: core.Labels{
+		core.LabelRTCPCallID:  "c1",
+		core.LabelRTCPLossPct: "12.5",
+		core.LabelRTCPJitter:  "40",
+	}})
+	if len(got) != 1 || got[0].CallID != "c1" || got[0].TaskID != "quality" {
+		t.Errorf("sink got %+v", got)
+	}
+}
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"log/slog"
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/mediagap"
+	"firestige.xyz/otus/internal/metrics"
+)
+
+// mediaGapLoop checks t's FlowRegistry for RTP streams silent for timeout
+// and emits a media_gap event for each, until t stops. With registry: shared
+// it sees the streams of every task on the registry.
+func (m *TaskManager) mediaGapLoop(t *Task, timeout time.Duration) {
+	detector := mediagap.NewDetector(t.Registry, timeout)
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, gap := range detector.Check(now) {
+				m.emitMediaGap(t, gap, now)
+			}
+		}
+	}
+}
+
+// emitMediaGap logs gap and forwards it to t's reporters.
+func (m *TaskManager) emitMediaGap(t *Task, gap mediagap.Gap, now time.Time) {
+	oneWay := strconv.FormatBool(gap.OneWay)
+	slog.Info("media gap detected", "task_id", t.Config.ID, "call_id", gap.CallID,
+		"src", gap.SrcIP, "dst", gap.DstIP, "idle_seconds", gap.Idle, "one_way", gap.OneWay)
+	metrics.MediaGapsTotal.WithLabelValues(t.Config.ID, oneWay).Inc()
+
+	pkt := core.OutputPacket{
+		TaskID:      t.Config.ID,
+		AgentID:     m.agentID,
+		Timestamp:   now,
+		SrcIP:       gap.SrcIP,
+		DstIP:       gap.DstIP,
+		SrcPort:     gap.SrcPort,
+		DstPort:     gap.DstPort,
+		Protocol:    17,
+		PayloadType: mediagap.PayloadType,
+		Payload:     gap,
+		Labels: core.Labels{
+			core.LabelMediaGapCallID: gap.CallID,
+			core.LabelMediaGapIdle:   strconv.FormatFloat(gap.Idle, 'f', 0, 64),
+			core.LabelMediaGapOneWay: oneWay,
+		},
+	}
+	if !t.Emit(pkt) {
+		slog.Debug("media gap event not delivered to reporters", "task_id", t.Config.ID, "call_id", gap.CallID)
+	}
+}
@@ -0,0 +1,51 @@
+package task
+
+import (
+	"log/slog"
+	"runtime"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/nicadvisor"
+)
+
+// adviseCapture checks the capture interface of an afpacket task against its
+// workers and logs the recommendations. With capture.auto_fanout, binding
+// workers without fanout get fanout_type "hash" instead of a recommendation.
+// It returns the capturer plugin config to use and the remaining advice.
+func adviseCapture(cfg config.TaskConfig, in nicadvisor.Inspector) (map[string]any, []nicadvisor.Recommendation) {
+	pluginCfg := cfg.Capture.ToPluginConfig()
+	if cfg.Capture.Name != "afpacket" {
+		return pluginCfg, nil
+	}
+
+	fanout := "hash" // afpacket default when fanout_type is not set
+	if v, ok := pluginCfg["fanout_type"].(string); ok {
+		fanout = v
+	}
+	nic, err := in.Inspect(cfg.Capture.Interface)
+	if err != nil {
+		slog.Debug("capture interface not inspected", "task_id", cfg.ID, "error", err)
+		nic = nicadvisor.Interface{Name: cfg.Capture.Interface, Virtual: true}
+	}
+	recs := nicadvisor.Advise(nic, nicadvisor.Setup{
+		Workers:      cfg.Workers,
+		DispatchMode: cfg.Capture.DispatchMode,
+		FanoutType:   fanout,
+		NumCPU:       runtime.NumCPU(),
+	})
+
+	advice := recs[:0]
+	for _, r := range recs {
+		if r.Code == nicadvisor.CodeNoFanout && cfg.Capture.AutoFanout {
+			pluginCfg["fanout_type"] = "hash"
+			slog.Info("capture fanout enabled", "task_id", cfg.ID, "interface", nic.Name, "fanout_type", "hash")
+			continue
+		}
+		slog.Warn("capture recommendation", "task_id", cfg.ID, "interface", nic.Name, "code", r.Code, "message", r.Message)
+		advice = append(advice, r)
+	}
+	if len(advice) == 0 {
+		return pluginCfg, nil
+	}
+	return pluginCfg, advice
+}
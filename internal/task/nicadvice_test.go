@@ -0,0 +1,51 @@
+package task
+
+import (
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/nicadvisor"
+)
+
+func TestAdviseCapture_AutoFanout(t *testing.T) {
+	in := nicadvisor.Inspector{SysRoot: t.TempDir(), ProcRoot: t.TempDir()} // interface not found
+	cfg := config.TaskConfig{
+		ID:      "t1",
+		Workers: 2,
+		Capture: config.CaptureConfig{
+			Name:         "afpacket",
+			Interface:    "eth0",
+			DispatchMode: "binding",
+			Config:       map[string]any{"fanout_type": ""},
+		},
+	}
+
+	hasNoFanout := func(advice []nicadvisor.Recommendation) bool {
+		for _, r := range advice {
+			if r.Code == nicadvisor.CodeNoFanout {
+				return true
+			}
+		}
+		return false
+	}
+
+	pluginCfg, advice := adviseCapture(cfg, in)
+	if pluginCfg["fanout_type"] != "" || !hasNoFanout(advice) {
+		t.Errorf("without auto_fanout: fanout_type=%q advice=%+v", pluginCfg["fanout_type"], advice)
+	}
+
+	cfg.Capture.AutoFanout = true
+	pluginCfg, advice = adviseCapture(cfg, in)
+	if pluginCfg["fanout_type"] != "hash" || hasNoFanout(advice) {
+		t.Errorf("with auto_fanout: fanout_type=%q advice=%+v", pluginCfg["fanout_type"], advice)
+	}
+	if cfg.Capture.Config["fanout_type"] != "" {
+		t.Error("auto_fanout modified the task config")
+	}
+
+	// Other capturers are not inspected.
+	cfg.Capture.Name = "pcapstream"
+	if _, advice := adviseCapture(cfg, in); advice != nil {
+		t.Errorf("pcapstream advice = %+v", advice)
+	}
+}
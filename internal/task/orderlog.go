@@ -0,0 +1,56 @@
+package task
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/orderlog"
+)
+
+const defaultOrderLogSizeMB = 256
+
+// FlowHash returns the 5-tuple hash flow-hash dispatch distributes packets
+// by. Order logs record it to match their records against a capture.
+func FlowHash(pkt core.RawPacket) uint32 {
+	return flowHash(pkt)
+}
+
+// OrderLogPath returns the order log of a task's pipeline in dir.
+func OrderLogPath(dir, taskID string, pipelineID int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%d.olog", taskID, pipelineID))
+}
+
+// openOrderLogs creates the order log of each pipeline when the task records
+// packet order, else returns a nil writer per pipeline. The pipelines close
+// their logs when they stop.
+func openOrderLogs(cfg config.TaskConfig, numPipelines int) ([]*orderlog.Writer, error) {
+	logs := make([]*orderlog.Writer, numPipelines)
+	if !cfg.OrderLog.Enabled {
+		return logs, nil
+	}
+	if err := os.MkdirAll(cfg.OrderLog.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("order log: %w", err)
+	}
+	sizeMB := cfg.OrderLog.MaxSizeMB
+	if sizeMB == 0 {
+		sizeMB = defaultOrderLogSizeMB
+	}
+	for i := range logs {
+		w, err := orderlog.Create(OrderLogPath(cfg.OrderLog.Dir, cfg.ID, i),
+			orderlog.Header{TaskID: cfg.ID, PipelineID: i}, int64(sizeMB)<<20, FlowHash)
+		if err != nil {
+			for _, opened := range logs[:i] {
+				opened.Close()
+			}
+			return nil, err
+		}
+		logs[i] = w
+	}
+	slog.Warn("packet order logging enabled, for debugging only",
+		"task_id", cfg.ID, "dir", cfg.OrderLog.Dir, "max_size_mb", sizeMB)
+	return logs, nil
+}
@@ -0,0 +1,28 @@
+package task
+
+import (
+	"fmt"
+
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// setPrefilter hands capture.prefilter to the task's capturers; extra
+// capturers are not filtered. A capturer that cannot drop traffic in the
+// kernel fails the task rather than capture what the prefilter excludes.
+func (t *Task) setPrefilter() error {
+	if t.Config.Capture.Prefilter == nil {
+		return nil
+	}
+	rules, err := t.Config.Capture.Prefilter.Rules()
+	if err != nil {
+		return fmt.Errorf("capture.%w", err)
+	}
+	for _, c := range t.Capturers[:len(t.Capturers)-len(t.Config.ExtraCaptures)] {
+		pa, ok := c.(plugin.PrefilterAware)
+		if !ok {
+			return fmt.Errorf("capture.prefilter: capturer %q does not support a prefilter", c.Name())
+		}
+		pa.SetPrefilter(rules)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/prefilter"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+type prefilterCapturer struct {
+	mockCapturer
+	rules *prefilter.Rules
+}
+
+func (c *prefilterCapturer) SetPrefilter(rules *prefilter.Rules) { c.rules = rules }
+
+func TestSetPrefilter(t *testing.T) {
+	cfg := config.TaskConfig{
+		ID:            "t1",
+		ExtraCaptures: []config.ExtraCaptureConfig{{Name: "pcapstream", Interface: "x"}},
+	}
+	cfg.Capture.Prefilter = &prefilter.Config{Ports: []string{"5060"}}
+
+	main := &prefilterCapturer{}
+	task := NewTask(cfg)
+	task.Capturers = []plugin.Capturer{main, &mockCapturer{}}
+	if err := task.setPrefilter(); err != nil {
+		t.Fatalf("setPrefilter: %v", err)
+	}
+	if main.rules == nil || main.rules.Ports[0] != (prefilter.PortRange{Lo: 5060, Hi: 5060}) {
+		t.Errorf("rules = %+v, want port 5060", main.rules)
+	}
+
+	task.Capturers = []plugin.Capturer{&mockCapturer{}, &mockCapturer{}}
+	if err := task.setPrefilter(); err == nil || !strings.Contains(err.Error(), "does not support") {
+		t.Errorf("unaware capturer: err = %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package task
+
+import (
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/qualityalert"
+)
+
+// emitQualityAlert logs a, forwards it to t's reporters and hands it to the
+// quality alert sink for the control plane.
+func (m *TaskManager) emitQualityAlert(t *Task, a qualityalert.Alert) {
+	slog.Warn("call quality alert", "task_id", t.Config.ID, "call_id", a.CallID,
+		"exceeded", a.Exceeded, "mos", a.MOS, "jitter_ms", a.JitterMs, "loss_pct", a.LossPct)
+	for _, metric := range a.Exceeded {
+		metrics.QualityAlertsTotal.WithLabelValues(t.Config.ID, metric).Inc()
+	}
+
+	m.mu.RLock()
+	sink := m.qualitySink
+	m.mu.RUnlock()
+	if sink != nil {
+		sink(a)
+	}
+
+	pkt := core.OutputPacket{
+		TaskID:      t.Config.ID,
+		AgentID:     m.agentID,
+		Timestamp:   a.Timestamp,
+		SrcIP:       a.SrcIP,
+		DstIP:       a.DstIP,
+		SrcPort:     a.SrcPort,
+		DstPort:     a.DstPort,
+		Protocol:    17,
+		PayloadType: qualityalert.PayloadType,
+		Payload:     a,
+		Labels: core.Labels{
+			core.LabelQualityAlertCallID:   a.CallID,
+			core.LabelQualityAlertExceeded: strings.Join(a.Exceeded, ","),
+			core.LabelQualityAlertMOS:      strconv.FormatFloat(a.MOS, 'f', 2, 64),
+		},
+	}
+	if !t.Emit(pkt) {
+		slog.Debug("quality alert not delivered to reporters", "task_id", t.Config.ID, "call_id", a.CallID)
+	}
+}
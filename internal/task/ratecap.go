@@ -0,0 +1,34 @@
+package task
+
+import (
+	"log/slog"
+
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// SetMaxPPS advertises a packets-per-second cap for the task's capture to
+// its capturers implementing plugin.RateCapAware, split evenly between the
+// capturers reading the interface; extra capturers are not capped. 0 removes
+// the cap. It can be called while the task runs, e.g. by a resource
+// governor shedding load.
+func (t *Task) SetMaxPPS(pps uint64) {
+	capturers := t.Capturers[:len(t.Capturers)-len(t.Config.ExtraCaptures)]
+	if len(capturers) == 0 {
+		return
+	}
+	share := pps / uint64(len(capturers))
+	if pps > 0 && share == 0 {
+		share = 1
+	}
+	capped := false
+	for _, c := range capturers {
+		if rc, ok := c.(plugin.RateCapAware); ok {
+			rc.SetMaxPPS(share)
+			capped = true
+		}
+	}
+	if pps > 0 && !capped {
+		slog.Warn("capturer cannot hold a pps cap, max_pps ignored",
+			"task_id", t.Config.ID, "capturer", t.Config.Capture.Name, "max_pps", pps)
+	}
+}
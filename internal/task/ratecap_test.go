@@ -0,0 +1,43 @@
+package task
+
+import (
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+type rateCapCapturer struct {
+	mockCapturer
+	maxPPS uint64
+}
+
+func (c *rateCapCapturer) SetMaxPPS(pps uint64) { c.maxPPS = pps }
+
+func TestSetMaxPPS(t *testing.T) {
+	a, b := &rateCapCapturer{}, &rateCapCapturer{}
+	extra := &rateCapCapturer{}
+	task := NewTask(config.TaskConfig{
+		ID:            "t1",
+		ExtraCaptures: []config.ExtraCaptureConfig{{Name: "pcapstream", Interface: "x"}},
+	})
+	task.Capturers = []plugin.Capturer{a, b, extra}
+
+	task.SetMaxPPS(100001)
+	if a.maxPPS != 50000 || b.maxPPS != 50000 {
+		t.Errorf("shares = %d, %d, want 50000 each", a.maxPPS, b.maxPPS)
+	}
+	if extra.maxPPS != 0 {
+		t.Errorf("extra capturer capped at %d, want uncapped", extra.maxPPS)
+	}
+
+	task.SetMaxPPS(1)
+	if a.maxPPS != 1 || b.maxPPS != 1 {
+		t.Errorf("shares = %d, %d, want at least 1", a.maxPPS, b.maxPPS)
+	}
+
+	task.SetMaxPPS(0)
+	if a.maxPPS != 0 || b.maxPPS != 0 {
+		t.Errorf("shares = %d, %d, want 0 (no cap)", a.maxPPS, b.maxPPS)
+	}
+}
@@ -0,0 +1,209 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Reporter swap states (ReporterSwap.State).
+const (
+	SwapWarming  = "warming"  // new reporter runs in shadow mode next to the old one
+	SwapSwitched = "switched" // old reporter retired, new reporter carries traffic
+	SwapAborted  = "aborted"  // shadow batches failed, new reporter retired
+)
+
+// ReporterSwap is the progress of a blue/green reporter swap.
+//
+// During the warm-up both reporters receive every packet; the new one runs in
+// shadow mode, so its failures only show in metrics. When the warm-up ends the
+// task switches to the new reporter if none of its batches failed, and
+// retires it otherwise. Either way the retired reporter's pending batches are
+// flushed first, so the swap duplicates packets during the warm-up but never
+// drops them.
+type ReporterSwap struct {
+	Replace      string    `json:"replace"`  // reporter being replaced
+	Reporter     string    `json:"reporter"` // reporter warming up
+	State        string    `json:"state"`
+	StartedAt    time.Time `json:"started_at"`
+	SwitchAt     time.Time `json:"switch_at"` // end of the warm-up
+	FinishedAt   time.Time `json:"finished_at,omitempty"`
+	ShadowErrors int64     `json:"shadow_errors"` // failed shadow batches at switch time
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// SwapReporter starts replacing reporter replace with rep, an initialized
+// but not started reporter configured by rc, wrapped by w. The swap finishes
+// in the background after warmup; onDone, if set, runs once it has switched
+// or aborted.
+func (t *Task) SwapReporter(replace string, rep plugin.Reporter, rc config.ReporterConfig, w *ReporterWrapper, warmup time.Duration, onDone func()) error {
+	t.mu.Lock()
+	old, err := t.swappableWrapper(replace)
+	if err != nil {
+		t.mu.Unlock()
+		return err
+	}
+	now := time.Now()
+	prev := t.swap
+	t.swap = &ReporterSwap{
+		Replace:   replace,
+		Reporter:  rc.Name,
+		State:     SwapWarming,
+		StartedAt: now,
+		SwitchAt:  now.Add(warmup),
+	}
+	t.mu.Unlock()
+
+	if err := rep.Start(t.ctx); err != nil {
+		t.mu.Lock()
+		t.swap = prev
+		t.mu.Unlock()
+		return fmt.Errorf("start reporter %q: %w", rc.Name, err)
+	}
+	w.SetShadow(true)
+	w.Start(t.ctx)
+
+	t.mu.Lock()
+	if t.state != StateRunning && t.state != StatePaused {
+		t.swap = prev
+		t.mu.Unlock()
+		w.Close()
+		t.stopReporter(rep)
+		return fmt.Errorf("task %q stopped while starting reporter %q", t.Config.ID, rc.Name)
+	}
+	t.Reporters = append(slices.Clone(t.Reporters), rep)
+	t.ReporterWrappers = append(slices.Clone(t.ReporterWrappers), w)
+	targets := slices.Clone(t.ReporterWrappers)
+	t.mu.Unlock()
+
+	if !t.setSendTargets(targets) {
+		// The sender already exited; shutdown stops rep, but never saw w.
+		w.Close()
+		return fmt.Errorf("task %q stopped while starting reporter %q", t.Config.ID, rc.Name)
+	}
+
+	slog.Info("reporter swap started", "task_id", t.Config.ID,
+		"replace", replace, "reporter", rc.Name, "warmup", warmup)
+
+	go t.finishSwap(old, w, rc, warmup, onDone)
+	return nil
+}
+
+// swappableWrapper returns the wrapper of reporter name if a swap may start
+// (must hold mu).
+func (t *Task) swappableWrapper(name string) (*ReporterWrapper, error) {
+	if t.state != StateRunning && t.state != StatePaused {
+		return nil, fmt.Errorf("cannot swap reporter of task in state %s", t.state)
+	}
+	if t.Analyzer != nil {
+		return nil, fmt.Errorf("task %q is analyze_only and has no reporters", t.Config.ID)
+	}
+	if t.swap != nil && t.swap.State == SwapWarming {
+		return nil, fmt.Errorf("reporter swap %s -> %s already in progress", t.swap.Replace, t.swap.Reporter)
+	}
+
+	var old *ReporterWrapper
+	for _, w := range t.ReporterWrappers {
+		if w.Name() == name {
+			old = w
+			break
+		}
+	}
+	if old == nil {
+		return nil, fmt.Errorf("reporter %q not found", name)
+	}
+	if old.Group() != "" {
+		return nil, fmt.Errorf("reporter %q is in failover group %q", name, old.Group())
+	}
+	for _, w := range t.ReporterWrappers {
+		if w.fallback == old.primary {
+			return nil, fmt.Errorf("reporter %q is the fallback of %q", name, w.Name())
+		}
+	}
+	return old, nil
+}
+
+// finishSwap waits for the warm-up, then keeps one of old and w and retires
+// the other.
+func (t *Task) finishSwap(old, w *ReporterWrapper, rc config.ReporterConfig, warmup time.Duration, onDone func()) {
+	timer := time.NewTimer(warmup)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.ctx.Done():
+		return // task stopped: shutdown flushes and stops both reporters
+	}
+
+	t.mu.Lock()
+	if t.state != StateRunning && t.state != StatePaused {
+		t.mu.Unlock()
+		return
+	}
+
+	swap := t.swap
+	swap.ShadowErrors = w.ShadowErrors()
+	retire := old
+	if swap.ShadowErrors > 0 {
+		retire = w
+		swap.State = SwapAborted
+		swap.Reason = fmt.Sprintf("%d shadow batches failed", swap.ShadowErrors)
+	} else {
+		swap.State = SwapSwitched
+		w.SetShadow(false)
+		// Reporters and Config.Reporters share indexes up to the shadow
+		// reporter appended at the end.
+		i := slices.Index(t.Reporters, old.primary)
+		t.Config.Reporters = append(slices.Delete(slices.Clone(t.Config.Reporters), i, i+1), rc)
+		t.refreshAgentMetadata()
+	}
+	swap.FinishedAt = time.Now()
+	t.Reporters = slices.DeleteFunc(slices.Clone(t.Reporters), func(r plugin.Reporter) bool { return r == retire.primary })
+	t.ReporterWrappers = slices.DeleteFunc(slices.Clone(t.ReporterWrappers), func(rw *ReporterWrapper) bool { return rw == retire })
+	targets := slices.Clone(t.ReporterWrappers)
+	t.mu.Unlock()
+
+	// Once the sender has the new set, nothing sends to the retired wrapper.
+	// If the sender already exited it closed the wrapper itself.
+	if t.setSendTargets(targets) {
+		retire.Close()
+	}
+	t.stopReporter(retire.primary)
+
+	metrics.ReporterSwapsTotal.WithLabelValues(t.Config.ID, swap.State).Inc()
+	slog.Info("reporter swap finished", "task_id", t.Config.ID,
+		"replace", swap.Replace, "reporter", swap.Reporter,
+		"state", swap.State, "shadow_errors", swap.ShadowErrors)
+
+	if onDone != nil {
+		onDone()
+	}
+}
+
+// setSendTargets hands senderLoop a new wrapper set. It returns false if the
+// sender has already exited.
+func (t *Task) setSendTargets(targets []*ReporterWrapper) bool {
+	select {
+	case t.targetsCh <- targets:
+		return true
+	case <-t.doneCh:
+		return false
+	}
+}
+
+// stopReporter flushes and stops a reporter removed from the task.
+func (t *Task) stopReporter(rep plugin.Reporter) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rep.Flush(ctx); err != nil {
+		slog.Warn("reporter flush error", "task_id", t.Config.ID, "reporter", rep.Name(), "error", err)
+	}
+	if err := rep.Stop(ctx); err != nil {
+		slog.Warn("reporter stop error", "task_id", t.Config.ID, "reporter", rep.Name(), "error", err)
+	}
+}
@@ -0,0 +1,136 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// newSwapTestTask starts a task with a single wrapped reporter r0.
+func newSwapTestTask(t *testing.T, r0 *mockReporter) *Task {
+	t.Helper()
+	task := newTestTask([]plugin.Reporter{r0}, []plugin.Capturer{&mockCapturer{name: "cap0"}})
+	task.Config.Reporters = []config.ReporterConfig{{Name: r0.name}}
+	task.ReporterWrappers = []*ReporterWrapper{
+		NewReporterWrapper(WrapperConfig{Primary: r0, TaskID: task.Config.ID, BatchSize: 1}),
+	}
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { task.Stop() })
+	return task
+}
+
+// swapAndWait runs a swap from r0 to r1, emitting one packet during the
+// warm-up, and waits for it to finish.
+func swapAndWait(t *testing.T, task *Task, r1 *mockReporter) {
+	t.Helper()
+	w := NewReporterWrapper(WrapperConfig{Primary: r1, TaskID: task.Config.ID, BatchSize: 1})
+	done := make(chan struct{})
+	err := task.SwapReporter("r0", r1, config.ReporterConfig{Name: r1.name}, w, 200*time.Millisecond, func() { close(done) })
+	if err != nil {
+		t.Fatalf("SwapReporter: %v", err)
+	}
+	if st := task.GetStatus().ReporterSwap; st == nil || st.State != SwapWarming {
+		t.Fatalf("swap status = %+v, want warming", st)
+	}
+	if !task.Emit(core.OutputPacket{TaskID: task.Config.ID}) {
+		t.Fatal("Emit failed")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("swap did not finish")
+	}
+}
+
+func TestTask_SwapReporter_Switch(t *testing.T) {
+	r0 := &mockReporter{name: "r0"}
+	r1 := &mockReporter{name: "r1"}
+	task := newSwapTestTask(t, r0)
+
+	swapAndWait(t, task, r1)
+
+	if st := task.GetStatus().ReporterSwap; st.State != SwapSwitched || st.ShadowErrors != 0 {
+		t.Errorf("swap status = %+v, want switched", st)
+	}
+	// Both reporters saw the warm-up packet.
+	if len(r0.packets()) != 1 || len(r1.packets()) != 1 {
+		t.Errorf("packets r0=%d r1=%d, want 1 each", len(r0.packets()), len(r1.packets()))
+	}
+	if !r0.stopped.Load() || r1.stopped.Load() {
+		t.Errorf("stopped r0=%v r1=%v, want only r0 stopped", r0.stopped.Load(), r1.stopped.Load())
+	}
+	if len(task.Reporters) != 1 || task.Reporters[0] != plugin.Reporter(r1) {
+		t.Errorf("Reporters = %v, want [r1]", task.Reporters)
+	}
+	if len(task.Config.Reporters) != 1 || task.Config.Reporters[0].Name != "r1" {
+		t.Errorf("Config.Reporters = %+v, want [r1]", task.Config.Reporters)
+	}
+
+	// Traffic after the switch goes to r1 only.
+	task.Emit(core.OutputPacket{TaskID: task.Config.ID})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(r1.packets()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(r0.packets()) != 1 || len(r1.packets()) != 2 {
+		t.Errorf("after switch packets r0=%d r1=%d, want 1 and 2", len(r0.packets()), len(r1.packets()))
+	}
+}
+
+func TestTask_SwapReporter_AbortOnShadowErrors(t *testing.T) {
+	r0 := &mockReporter{name: "r0"}
+	r1 := &mockReporter{name: "r1", reportHook: func(context.Context, *core.OutputPacket) error {
+		return errors.New("connection refused")
+	}}
+	task := newSwapTestTask(t, r0)
+
+	swapAndWait(t, task, r1)
+
+	st := task.GetStatus().ReporterSwap
+	if st.State != SwapAborted || st.ShadowErrors == 0 {
+		t.Errorf("swap status = %+v, want aborted with shadow errors", st)
+	}
+	if !r1.stopped.Load() || r0.stopped.Load() {
+		t.Errorf("stopped r0=%v r1=%v, want only r1 stopped", r0.stopped.Load(), r1.stopped.Load())
+	}
+	if len(task.Reporters) != 1 || task.Reporters[0] != plugin.Reporter(r0) || task.Config.Reporters[0].Name != "r0" {
+		t.Errorf("Reporters = %v, want [r0] kept", task.Reporters)
+	}
+	// Shadow failures never counted against the live reporter set.
+	if name, streak := task.ReporterErrorStreak(); streak != 0 {
+		t.Errorf("ReporterErrorStreak = %s/%d, want 0", name, streak)
+	}
+}
+
+func TestTask_SwapReporter_Rejected(t *testing.T) {
+	r0 := &mockReporter{name: "r0"}
+	task := newSwapTestTask(t, r0)
+
+	newWrapper := func(r *mockReporter) *ReporterWrapper {
+		return NewReporterWrapper(WrapperConfig{Primary: r, TaskID: task.Config.ID})
+	}
+
+	r1 := &mockReporter{name: "r1"}
+	if err := task.SwapReporter("missing", r1, config.ReporterConfig{Name: "r1"}, newWrapper(r1), time.Hour, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("unknown reporter: error = %v, want not found", err)
+	}
+	if r1.started.Load() {
+		t.Error("rejected swap started its reporter")
+	}
+
+	if err := task.SwapReporter("r0", r1, config.ReporterConfig{Name: "r1"}, newWrapper(r1), time.Hour, nil); err != nil {
+		t.Fatalf("SwapReporter: %v", err)
+	}
+	r2 := &mockReporter{name: "r2"}
+	if err := task.SwapReporter("r0", r2, config.ReporterConfig{Name: "r2"}, newWrapper(r2), time.Hour, nil); err == nil || !strings.Contains(err.Error(), "already in progress") {
+		t.Errorf("second swap: error = %v, want already in progress", err)
+	}
+}
@@ -3,10 +3,13 @@ package task
 
 import (
 	"context"
+	"errors"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/featureflag"
 	"firestige.xyz/otus/internal/metrics"
 	"firestige.xyz/otus/pkg/plugin"
 )
@@ -15,6 +18,17 @@ const (
 	defaultWrapperBatchSize    = 100
 	defaultWrapperBatchTimeout = 50 * time.Millisecond
 	defaultWrapperChanCap      = 10000
+
+	// Adaptive batching bounds relative to the configured batch size when
+	// min/max are not set.
+	adaptiveRange = 10
+)
+
+// Flush reasons for otus_reporter_flushes_total.
+const (
+	flushSize    = "size"
+	flushTimeout = "timeout"
+	flushClose   = "close"
 )
 
 // ReporterWrapper wraps a Reporter with batching and optional fallback.
@@ -22,25 +36,70 @@ const (
 //
 //	senderLoop → ReporterWrapper.Send() → batchLoop → Reporter.ReportBatch()/Report()
 //	                                                 └→ fallback Reporter (on primary failure)
+//
+// For a failover group the wrapper holds the group's tiers and sends each
+// batch to the active one (see failover.go); primary is the first tier.
 type ReporterWrapper struct {
 	primary  plugin.Reporter
 	fallback plugin.Reporter // nil if no fallback configured
 
+	group  string         // failover group name, "" if not a group
+	tiers  []failoverTier // failover group tiers in priority order
+	active atomic.Int64   // index of the tier carrying traffic
+	now    func() time.Time
+
 	taskID       string // for Prometheus label
 	batchSize    int
 	batchTimeout time.Duration
 
+	// Adaptive batching: the flush size moves within [minBatch, maxBatch]
+	// while the adaptive_batch flag is on.
+	adaptive    bool
+	flags       *featureflag.Set
+	minBatch    int
+	maxBatch    int
+	batchTarget atomic.Int64 // current flush size
+
+	retry RetryPolicy // applied to each ReportBatch / Report call
+
 	batchCh chan *core.OutputPacket
 	doneCh  chan struct{}
+
+	// errorStreak counts consecutive failed primary batches (reset on success).
+	errorStreak atomic.Int64
+
+	// shadow marks a reporter warming up during a reporter swap: it receives
+	// every packet, but failures only count in metrics (no fallback) and do
+	// not feed alerting. shadowErrors counts its failed batches.
+	shadow       atomic.Bool
+	shadowErrors atomic.Int64
 }
 
 // WrapperConfig contains configuration for creating a ReporterWrapper.
 type WrapperConfig struct {
 	Primary      plugin.Reporter
 	Fallback     plugin.Reporter // nil if no fallback
+	Group        string          // failover group name (with Tiers)
+	Tiers        []FailoverTier  // failover group in priority order; Primary is Tiers[0]
 	TaskID       string          // task ID for Prometheus labels
 	BatchSize    int
 	BatchTimeout time.Duration
+
+	// Adaptive grows the batch size while batches fill before the timeout
+	// and shrinks it while timeouts flush small batches. BatchSize is the
+	// starting point; MinBatchSize/MaxBatchSize default to BatchSize/10 and
+	// BatchSize*10.
+	Adaptive     bool
+	MinBatchSize int
+	MaxBatchSize int
+
+	// Flags are the task's feature flags; adaptive_batch off pins the batch
+	// size to BatchSize. nil = defaults.
+	Flags *featureflag.Set
+
+	// Retry is applied to the primary reporter's ReportBatch call, or to each
+	// Report call for reporters without batch support. Zero value: no retries.
+	Retry RetryPolicy
 }
 
 // NewReporterWrapper creates a new wrapper around a Reporter.
@@ -54,15 +113,40 @@ func NewReporterWrapper(cfg WrapperConfig) *ReporterWrapper {
 		batchTimeout = defaultWrapperBatchTimeout
 	}
 
-	return &ReporterWrapper{
+	w := &ReporterWrapper{
 		primary:      cfg.Primary,
 		fallback:     cfg.Fallback,
+		group:        cfg.Group,
+		tiers:        newFailoverTiers(cfg.Tiers),
+		now:          time.Now,
 		taskID:       cfg.TaskID,
 		batchSize:    batchSize,
 		batchTimeout: batchTimeout,
+		adaptive:     cfg.Adaptive,
+		flags:        cfg.Flags,
+		retry:        cfg.Retry,
+		minBatch:     batchSize,
+		maxBatch:     batchSize,
 		batchCh:      make(chan *core.OutputPacket, defaultWrapperChanCap),
 		doneCh:       make(chan struct{}),
 	}
+	if cfg.Adaptive {
+		w.minBatch = cfg.MinBatchSize
+		if w.minBatch <= 0 {
+			w.minBatch = max(1, batchSize/adaptiveRange)
+		}
+		w.maxBatch = cfg.MaxBatchSize
+		if w.maxBatch <= 0 {
+			w.maxBatch = batchSize * adaptiveRange
+		}
+		w.minBatch = min(w.minBatch, batchSize)
+		w.maxBatch = max(w.maxBatch, batchSize)
+	}
+	if len(w.tiers) > 0 {
+		w.primary = w.tiers[0].Reporter
+	}
+	w.batchTarget.Store(int64(batchSize))
+	return w
 }
 
 // Start starts the batchLoop goroutine. Does NOT start the underlying reporters
@@ -82,6 +166,37 @@ func (w *ReporterWrapper) Close() {
 	<-w.doneCh
 }
 
+// Name returns the name of the wrapped primary reporter.
+func (w *ReporterWrapper) Name() string {
+	return w.primary.Name()
+}
+
+// BatchTarget returns the batch size the wrapper currently flushes at.
+// It only differs from the configured batch size with adaptive batching.
+func (w *ReporterWrapper) BatchTarget() int {
+	return int(w.batchTarget.Load())
+}
+
+// ErrorStreak returns the number of consecutive failed primary batches.
+func (w *ReporterWrapper) ErrorStreak() int64 {
+	return w.errorStreak.Load()
+}
+
+// SetShadow switches shadow mode on or off.
+func (w *ReporterWrapper) SetShadow(shadow bool) {
+	w.shadow.Store(shadow)
+}
+
+// Shadow reports whether the wrapper is in shadow mode.
+func (w *ReporterWrapper) Shadow() bool {
+	return w.shadow.Load()
+}
+
+// ShadowErrors returns the number of batches that failed in shadow mode.
+func (w *ReporterWrapper) ShadowErrors() int64 {
+	return w.shadowErrors.Load()
+}
+
 // batchLoop collects packets into batches and flushes on size or timeout.
 func (w *ReporterWrapper) batchLoop(ctx context.Context) {
 	defer close(w.doneCh)
@@ -90,24 +205,59 @@ func (w *ReporterWrapper) batchLoop(ctx context.Context) {
 	ticker := time.NewTicker(w.batchTimeout)
 	defer ticker.Stop()
 
-	flush := func() {
+	reporterName := w.primary.Name()
+	target := w.batchSize
+	metrics.ReporterBatchTarget.WithLabelValues(w.taskID, reporterName).Set(float64(target))
+	if w.group != "" {
+		metrics.ReporterFailoverTier.WithLabelValues(w.taskID, w.group).Set(float64(w.active.Load()))
+	}
+
+	flush := func(reason string) {
+		if w.adaptive && reason != flushClose {
+			next := w.batchSize
+			if w.flags.Enabled(featureflag.AdaptiveBatch) {
+				next = w.nextBatchTarget(target, len(batch), reason)
+			}
+			if next != target {
+				target = next
+				w.batchTarget.Store(int64(target))
+				metrics.ReporterBatchTarget.WithLabelValues(w.taskID, reporterName).Set(float64(target))
+			}
+		}
 		if len(batch) == 0 {
 			return
 		}
-		if err := w.sendBatch(ctx, batch); err != nil {
+		metrics.ReporterFlushesTotal.WithLabelValues(w.taskID, reporterName, reason).Inc()
+		unsent, err := w.deliver(ctx, batch)
+		if w.shadow.Load() {
+			result := "ok"
+			if err != nil {
+				result = "error"
+				w.shadowErrors.Add(1)
+			}
+			metrics.ReporterShadowBatchesTotal.WithLabelValues(w.taskID, reporterName, result).Inc()
+			batch = batch[:0]
+			return
+		}
+		if err != nil {
+			w.errorStreak.Add(1)
 			slog.Warn("primary reporter batch failed",
-				"reporter", w.primary.Name(),
+				"reporter", w.Name(),
 				"batch_size", len(batch),
+				"unsent", len(unsent),
 				"error", err)
-			// Fallback: send each packet to fallback reporter
-			if w.fallback != nil {
-				for _, pkt := range batch {
-					if fbErr := w.fallback.Report(ctx, pkt); fbErr != nil {
-						metrics.ReporterErrorsTotal.WithLabelValues(w.taskID, w.fallback.Name(), "fallback").Inc()
-						slog.Warn("fallback reporter also failed",
-							"reporter", w.fallback.Name(),
-							"error", fbErr)
-					}
+		} else {
+			w.errorStreak.Store(0)
+		}
+		// Fallback: send each packet the primary did not take (failed or
+		// throttled) to the fallback reporter
+		if w.fallback != nil {
+			for _, pkt := range unsent {
+				if fbErr := w.fallback.Report(ctx, pkt); fbErr != nil {
+					metrics.ReporterErrorsTotal.WithLabelValues(w.taskID, w.fallback.Name(), "fallback").Inc()
+					slog.Warn("fallback reporter also failed",
+						"reporter", w.fallback.Name(),
+						"error", fbErr)
 				}
 			}
 		}
@@ -119,44 +269,90 @@ func (w *ReporterWrapper) batchLoop(ctx context.Context) {
 		case pkt, ok := <-w.batchCh:
 			if !ok {
 				// Channel closed — flush remaining and exit
-				flush()
+				flush(flushClose)
 				return
 			}
 			batch = append(batch, pkt)
-			if len(batch) >= w.batchSize {
-				flush()
+			if len(batch) >= target {
+				flush(flushSize)
 			}
 		case <-ticker.C:
-			flush()
+			flush(flushTimeout)
 		}
 	}
 }
 
-// sendBatch sends a batch of packets using BatchReporter if available,
-// otherwise falls back to calling Report() one-by-one.
-func (w *ReporterWrapper) sendBatch(ctx context.Context, batch []*core.OutputPacket) error {
-	reporterName := w.primary.Name()
+// nextBatchTarget adapts the flush size after a flush of n packets: batches
+// filling up before the timeout mean sustained load, so the size doubles to
+// cut per-batch overhead; timeouts flushing less than half the target mean
+// low traffic, so the size halves to keep packets from waiting on a batch
+// that will not fill.
+func (w *ReporterWrapper) nextBatchTarget(target, n int, reason string) int {
+	switch {
+	case reason == flushSize:
+		return min(target*2, w.maxBatch)
+	case reason == flushTimeout && n < target/2:
+		return max(target/2, w.minBatch)
+	}
+	return target
+}
+
+// sendBatch sends a batch of packets to rep using BatchReporter if
+// available, otherwise falls back to calling Report() one-by-one, each call
+// under retry. It returns the packets rep did not take and the last failure;
+// packets rep throttled (core.ErrThrottled) are returned without failing the
+// batch.
+func (w *ReporterWrapper) sendBatch(ctx context.Context, rep plugin.Reporter, batch []*core.OutputPacket, retry RetryPolicy) ([]*core.OutputPacket, error) {
+	reporterName := rep.Name()
 
 	// Record batch size metric
 	metrics.ReporterBatchSize.WithLabelValues(w.taskID, reporterName).
 		Observe(float64(len(batch)))
 
 	// Prefer BatchReporter interface for high-throughput reporters (e.g., Kafka)
-	if br, ok := w.primary.(plugin.BatchReporter); ok {
-		if err := br.ReportBatch(ctx, batch); err != nil {
-			metrics.ReporterErrorsTotal.WithLabelValues(w.taskID, reporterName, "batch").Inc()
-			return err
+	if br, ok := rep.(plugin.BatchReporter); ok {
+		err := w.withRetry(ctx, retry, reporterName, "batch", func() error {
+			return br.ReportBatch(ctx, batch)
+		})
+		switch {
+		case err == nil:
+			return nil, nil
+		case errors.Is(err, core.ErrThrottled):
+			return batch, nil
 		}
-		return nil
+		metrics.ReporterErrorsTotal.WithLabelValues(w.taskID, reporterName, "batch").Inc()
+		return batch, err
 	}
 
 	// Fallback: sequential Report() calls
+	var unsent []*core.OutputPacket
 	var lastErr error
 	for _, pkt := range batch {
-		if err := w.primary.Report(ctx, pkt); err != nil {
+		err := w.withRetry(ctx, retry, reporterName, "report", func() error {
+			return rep.Report(ctx, pkt)
+		})
+		if err == nil {
+			continue
+		}
+		unsent = append(unsent, pkt)
+		if !errors.Is(err, core.ErrThrottled) {
 			metrics.ReporterErrorsTotal.WithLabelValues(w.taskID, reporterName, "report").Inc()
 			lastErr = err
 		}
 	}
-	return lastErr
+	return unsent, lastErr
+}
+
+// withRetry runs fn under retry, recording retry metrics of reporterName for
+// path ("batch" or "report").
+func (w *ReporterWrapper) withRetry(ctx context.Context, retry RetryPolicy, reporterName, path string, fn func() error) error {
+	attempts, err := retry.Do(ctx, fn, func(attempt int, err error) {
+		metrics.ReporterRetriesTotal.WithLabelValues(w.taskID, reporterName, path).Inc()
+		slog.Debug("retrying reporter call",
+			"reporter", reporterName, "path", path, "attempt", attempt, "error", err)
+	})
+	if err != nil && attempts > 1 {
+		metrics.ReporterRetriesExhaustedTotal.WithLabelValues(w.taskID, reporterName, path).Inc()
+	}
+	return err
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/featureflag"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
@@ -174,6 +175,43 @@ func TestReporterWrapper_NonBatchReporterFallsBack(t *testing.T) {
 	}
 }
 
+func TestReporterWrapper_ThrottledPacketsFallBack(t *testing.T) {
+	// Odd packets are over the reporter's rate limit: only those go to the
+	// fallback, and throttling is not a failure.
+	var sent atomic.Int32
+	rep := &mockReporter{name: "hep", reportHook: func(_ context.Context, pkt *core.OutputPacket) error {
+		if pkt.SrcPort%2 == 1 {
+			return fmt.Errorf("hep reporter: 10.0.0.1:9060: %w", core.ErrThrottled)
+		}
+		sent.Add(1)
+		return nil
+	}}
+	fallback := &mockReporter{name: "spill"}
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      rep,
+		Fallback:     fallback,
+		BatchSize:    4,
+		BatchTimeout: time.Second,
+		Retry:        RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	w.Start(context.Background())
+	for i := 0; i < 4; i++ {
+		w.Send(&core.OutputPacket{SrcPort: uint16(i)})
+	}
+	w.Close()
+
+	if sent.Load() != 2 {
+		t.Errorf("reporter sent %d packets, want 2", sent.Load())
+	}
+	spilled := fallback.packets()
+	if len(spilled) != 2 || spilled[0].SrcPort != 1 || spilled[1].SrcPort != 3 {
+		t.Errorf("fallback got %v, want the 2 throttled packets", spilled)
+	}
+	if w.ErrorStreak() != 0 {
+		t.Errorf("error streak %d after throttling, want 0", w.ErrorStreak())
+	}
+}
+
 func TestReporterWrapper_FlushOnClose(t *testing.T) {
 	// Verify that Close() flushes remaining packets even if batch is not full.
 	var received atomic.Int32
@@ -275,3 +313,149 @@ func TestReporterWrapper_ErrorMetricsRecorded(t *testing.T) {
 		t.Error("expected primary batch call")
 	}
 }
+
+func TestReporterWrapper_AdaptiveGrowsUnderLoad(t *testing.T) {
+	br := &mockBatchReporter{mockReporter: mockReporter{name: "adaptive-grow"}}
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      br,
+		TaskID:       "task-adaptive",
+		BatchSize:    4,
+		BatchTimeout: 10 * time.Second, // only size-triggered flushes
+		Adaptive:     true,
+		MaxBatchSize: 16,
+	})
+	w.Start(context.Background())
+
+	for i := 0; i < 4+8+16+16; i++ {
+		w.Send(&core.OutputPacket{SrcPort: uint16(i)})
+	}
+	w.Close()
+
+	want := []int{4, 8, 16, 16}
+	calls := br.getBatchCalls()
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("batch sizes = %v, want %v", calls, want)
+	}
+	if got := w.BatchTarget(); got != 16 {
+		t.Errorf("BatchTarget() = %d, want 16 (max)", got)
+	}
+}
+
+func TestReporterWrapper_AdaptiveShrinksWhenIdle(t *testing.T) {
+	br := &mockBatchReporter{mockReporter: mockReporter{name: "adaptive-shrink"}}
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      br,
+		TaskID:       "task-adaptive",
+		BatchSize:    64,
+		BatchTimeout: 5 * time.Millisecond,
+		Adaptive:     true,
+		MinBatchSize: 2,
+	})
+	w.Start(context.Background())
+	defer w.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for w.BatchTarget() != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := w.BatchTarget(); got != 2 {
+		t.Errorf("BatchTarget() = %d after idle timeouts, want 2 (min)", got)
+	}
+}
+
+func TestReporterWrapper_FixedBatchIgnoresLoad(t *testing.T) {
+	br := &mockBatchReporter{mockReporter: mockReporter{name: "fixed"}}
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      br,
+		TaskID:       "task-fixed",
+		BatchSize:    4,
+		BatchTimeout: 10 * time.Second,
+	})
+	w.Start(context.Background())
+	for i := 0; i < 12; i++ {
+		w.Send(&core.OutputPacket{SrcPort: uint16(i)})
+	}
+	w.Close()
+
+	if calls := br.getBatchCalls(); fmt.Sprint(calls) != "[4 4 4]" {
+		t.Errorf("batch sizes = %v, want [4 4 4]", calls)
+	}
+	if got := w.BatchTarget(); got != 4 {
+		t.Errorf("BatchTarget() = %d, want 4", got)
+	}
+}
+
+func TestReporterWrapper_AdaptiveFlagOff(t *testing.T) {
+	br := &mockBatchReporter{mockReporter: mockReporter{name: "adaptive-flag"}}
+	flags := featureflag.New(map[string]bool{featureflag.AdaptiveBatch: false})
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      br,
+		TaskID:       "task-adaptive-flag",
+		BatchSize:    4,
+		BatchTimeout: 10 * time.Second,
+		Adaptive:     true,
+		MaxBatchSize: 16,
+		Flags:        flags,
+	})
+	w.Start(context.Background())
+	for i := 0; i < 8; i++ {
+		w.Send(&core.OutputPacket{SrcPort: uint16(i)})
+	}
+	// Batches are flushed by the wrapper goroutine; wait for both before
+	// turning the flag on.
+	deadline := time.Now().Add(2 * time.Second)
+	for len(br.getBatchCalls()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	flags.Set(featureflag.AdaptiveBatch, true)
+	for i := 0; i < 4+8; i++ {
+		w.Send(&core.OutputPacket{SrcPort: uint16(i)})
+	}
+	w.Close()
+
+	if calls := br.getBatchCalls(); fmt.Sprint(calls) != "[4 4 4 8]" {
+		t.Errorf("batch sizes = %v, want [4 4 4 8]", calls)
+	}
+}
+
+// flakyBatchReporter fails the first failures ReportBatch calls.
+type flakyBatchReporter struct {
+	mockBatchReporter
+	failures atomic.Int32
+}
+
+func (f *flakyBatchReporter) ReportBatch(ctx context.Context, pkts []*core.OutputPacket) error {
+	if f.failures.Add(-1) >= 0 {
+		return fmt.Errorf("broker unavailable")
+	}
+	return f.mockBatchReporter.ReportBatch(ctx, pkts)
+}
+
+func TestReporterWrapper_RetriesBatch(t *testing.T) {
+	primary := &flakyBatchReporter{mockBatchReporter: mockBatchReporter{mockReporter: mockReporter{name: "flaky"}}}
+	primary.failures.Store(2)
+	fallback := &mockReporter{name: "fallback"}
+
+	w := NewReporterWrapper(WrapperConfig{
+		Primary:      primary,
+		Fallback:     fallback,
+		TaskID:       "task-retry",
+		BatchSize:    2,
+		BatchTimeout: 10 * time.Second,
+		Retry:        RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond},
+	})
+	w.Start(context.Background())
+	w.Send(&core.OutputPacket{SrcPort: 1})
+	w.Send(&core.OutputPacket{SrcPort: 2})
+	w.Close()
+
+	if got := len(primary.packets()); got != 2 {
+		t.Errorf("primary reported %d packets after retries, want 2", got)
+	}
+	if got := len(fallback.packets()); got != 0 {
+		t.Errorf("fallback used %d times although retry succeeded", got)
+	}
+	if w.ErrorStreak() != 0 {
+		t.Errorf("ErrorStreak() = %d, want 0", w.ErrorStreak())
+	}
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	rtmetrics "runtime/metrics"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/pipeline"
+)
+
+// heapAllocsMetric is the runtime's cumulative count of heap-allocated bytes.
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// Resources is the approximate resource usage of a task since it started
+// (task_status resources). Go cannot attribute CPU or memory to goroutines,
+// so:
+//   - CPU is the time pipelines spent processing packets, which are CPU-bound;
+//   - allocations are the process-wide heap allocations since the task
+//     started, shared out by the task's share of all pipelines' busy time;
+//   - channel memory is the size of the task's packet channel buffers.
+type Resources struct {
+	CPUSeconds         float64   `json:"cpu_seconds"`
+	PipelineCPUSeconds []float64 `json:"pipeline_cpu_seconds"`
+	AllocBytes         uint64    `json:"alloc_bytes"`
+	ChannelBytes       uint64    `json:"channel_bytes"`
+	QueuedPackets      int       `json:"queued_packets"`
+}
+
+// resourceBase is the process state when a task started, the origin of its
+// allocation share.
+type resourceBase struct {
+	allocs uint64
+	busy   time.Duration
+}
+
+func currentResourceBase() resourceBase {
+	return resourceBase{allocs: heapAllocs(), busy: pipeline.TotalBusy()}
+}
+
+func heapAllocs() uint64 {
+	sample := []rtmetrics.Sample{{Name: heapAllocsMetric}}
+	rtmetrics.Read(sample)
+	if sample[0].Value.Kind() != rtmetrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// Resources returns the task's approximate resource usage.
+func (t *Task) Resources() Resources {
+	t.mu.RLock()
+	base := t.resourceBase
+	t.mu.RUnlock()
+
+	var r Resources
+	var busy time.Duration
+	for _, p := range t.Pipelines {
+		b := p.Busy()
+		busy += b
+		r.PipelineCPUSeconds = append(r.PipelineCPUSeconds, b.Seconds())
+	}
+	r.CPUSeconds = busy.Seconds()
+
+	if total := pipeline.TotalBusy() - base.busy; total > 0 {
+		share := float64(busy) / float64(total)
+		if share > 1 {
+			share = 1
+		}
+		r.AllocBytes = uint64(float64(heapAllocs()-base.allocs) * share)
+	}
+
+	rawSize := uint64(unsafe.Sizeof(core.RawPacket{}))
+	for _, ch := range t.rawStreams {
+		r.ChannelBytes += uint64(cap(ch)) * rawSize
+		r.QueuedPackets += len(ch)
+	}
+	if t.captureCh != nil {
+		r.ChannelBytes += uint64(cap(t.captureCh)) * rawSize
+		r.QueuedPackets += len(t.captureCh)
+	}
+	r.ChannelBytes += uint64(cap(t.sendBuffer)) * uint64(unsafe.Sizeof(core.OutputPacket{}))
+	r.QueuedPackets += len(t.sendBuffer)
+	return r
+}
+
+// updateResourceMetrics adds the usage since last to the task's resource
+// metrics and returns the current usage for the next call.
+func (t *Task) updateResourceMetrics(last Resources) Resources {
+	r := t.Resources()
+	for i, cpu := range r.PipelineCPUSeconds {
+		prev := 0.0
+		if i < len(last.PipelineCPUSeconds) {
+			prev = last.PipelineCPUSeconds[i]
+		}
+		if cpu > prev {
+			metrics.TaskCPUSecondsTotal.WithLabelValues(t.Config.ID, strconv.Itoa(i)).Add(cpu - prev)
+		}
+	}
+	if r.AllocBytes > last.AllocBytes {
+		metrics.TaskAllocBytesTotal.WithLabelValues(t.Config.ID).Add(float64(r.AllocBytes - last.AllocBytes))
+	}
+	metrics.TaskChannelBytes.WithLabelValues(t.Config.ID).Set(float64(r.ChannelBytes))
+	return r
+}
@@ -0,0 +1,42 @@
+package task
+
+import (
+	"testing"
+	"unsafe"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestTask_Resources(t *testing.T) {
+	m := NewTaskManager("test-agent", nil)
+	cfg := sharedRegistryTaskConfig("resources", "")
+	cfg.Workers = 2
+	cfg.ChannelCapacity.RawStream = 10
+	cfg.ChannelCapacity.SendBuffer = 20
+	if err := m.Create(cfg); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	defer m.StopAll()
+	task, _ := m.Get("resources")
+
+	r := task.Resources()
+	if len(r.PipelineCPUSeconds) != 2 {
+		t.Fatalf("pipeline_cpu_seconds = %v, want one per pipeline", r.PipelineCPUSeconds)
+	}
+	raw, out := uint64(unsafe.Sizeof(core.RawPacket{})), uint64(unsafe.Sizeof(core.OutputPacket{}))
+	want := 2*10*raw + 20*out
+	if task.captureCh != nil {
+		want += uint64(cap(task.captureCh)) * raw
+	}
+	if r.ChannelBytes != want {
+		t.Errorf("channel_bytes = %d, want %d", r.ChannelBytes, want)
+	}
+
+	for i := 0; i < 100; i++ {
+		task.Pipelines[1].Process(core.RawPacket{Data: []byte("packet")})
+	}
+	r = task.Resources()
+	if r.PipelineCPUSeconds[0] != 0 || r.PipelineCPUSeconds[1] <= 0 || r.CPUSeconds != r.PipelineCPUSeconds[1] {
+		t.Errorf("cpu = %v / %v, want the processing time of pipeline 1 only", r.CPUSeconds, r.PipelineCPUSeconds)
+	}
+}
@@ -0,0 +1,89 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+const (
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicy retries a failing operation with exponential backoff and jitter.
+// The zero value makes a single attempt (no retries).
+type RetryPolicy struct {
+	MaxAttempts    int           // total attempts including the first; <= 1 disables retries
+	InitialBackoff time.Duration // delay before the first retry (default 100ms)
+	MaxBackoff     time.Duration // cap on the doubled delay (default 5s)
+	Jitter         float64       // fraction of each delay randomised away, 0..1 (default 0.2)
+}
+
+// withDefaults fills unset backoff parameters.
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = defaultRetryJitter
+	}
+	return p
+}
+
+// Do calls fn until it succeeds, returns a non-retryable error, the attempts
+// are used up or ctx is done. onRetry, if non-nil, is called before each
+// retry. It returns the number of attempts made and the last error.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error, onRetry func(attempt int, err error)) (int, error) {
+	p = p.withDefaults()
+
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !isRetryable(err) {
+			return attempt, err
+		}
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+
+		// Jitter spreads retries of many wrappers hitting the same backend.
+		delay := backoff - time.Duration(p.Jitter*rand.Float64()*float64(backoff))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, p.MaxBackoff)
+	}
+}
+
+// isRetryable classifies reporter errors: failures categorized config or
+// fatal (core.CategoryOf), throttling and cancellations are final, anything
+// else (network, broker) may be transient.
+func isRetryable(err error) bool {
+	if errors.Is(err, core.ErrThrottled) {
+		return false
+	}
+	switch core.CategoryOf(err) {
+	case core.CategoryConfig, core.CategoryFatal:
+		return false
+	}
+	return !errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
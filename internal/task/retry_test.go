@@ -0,0 +1,123 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestRetryPolicy_RetriesUntilSuccess(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	calls, retries := 0, 0
+	attempts, err := p.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	}, func(int, error) { retries++ })
+
+	if err != nil || attempts != 3 || retries != 2 {
+		t.Errorf("Do() = (%d, %v) with %d retries, want (3, nil) with 2", attempts, err, retries)
+	}
+}
+
+func TestRetryPolicy_StopsAtMaxAttempts(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+	sentinel := errors.New("broker unavailable")
+
+	calls := 0
+	attempts, err := p.Do(context.Background(), func() error {
+		calls++
+		return sentinel
+	}, nil)
+
+	if !errors.Is(err, sentinel) || attempts != 3 || calls != 3 {
+		t.Errorf("Do() = (%d, %v) after %d calls, want 3 attempts ending in %v", attempts, err, calls, sentinel)
+	}
+}
+
+func TestRetryPolicy_ZeroValueSingleAttempt(t *testing.T) {
+	calls := 0
+	attempts, err := RetryPolicy{}.Do(context.Background(), func() error {
+		calls++
+		return errors.New("fail")
+	}, nil)
+	if err == nil || attempts != 1 || calls != 1 {
+		t.Errorf("zero policy made %d attempts, want 1", calls)
+	}
+}
+
+func TestRetryPolicy_PermanentErrorNotRetried(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	calls := 0
+	_, err := p.Do(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("serialize: %w", core.ErrPermanent)
+	}, nil)
+	if calls != 1 || !errors.Is(err, core.ErrPermanent) {
+		t.Errorf("permanent error retried: %d calls, err %v", calls, err)
+	}
+}
+
+func TestRetryPolicy_ConfigErrorNotRetried(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}
+
+	calls := 0
+	_, err := p.Do(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("topic missing: %w", core.ErrConfig)
+	}, nil)
+	if calls != 1 || !errors.Is(err, core.ErrConfig) {
+		t.Errorf("config error retried: %d calls, err %v", calls, err)
+	}
+
+	calls = 0
+	p.Do(context.Background(), func() error {
+		calls++
+		return fmt.Errorf("dial: %w", core.ErrTransient)
+	}, nil)
+	if calls != 5 {
+		t.Errorf("transient error made %d attempts, want 5", calls)
+	}
+}
+
+func TestRetryPolicy_ContextCancelStopsBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan int)
+	go func() {
+		attempts, _ := p.Do(ctx, func() error { return errors.New("fail") }, nil)
+		done <- attempts
+	}()
+	cancel()
+
+	select {
+	case attempts := <-done:
+		if attempts != 1 {
+			t.Errorf("attempts = %d, want 1", attempts)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Do() did not return after context cancel")
+	}
+}
+
+func TestRetryPolicy_BackoffCappedWithJitter(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 4, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 15 * time.Millisecond, Jitter: 0.5}
+
+	start := time.Now()
+	p.Do(context.Background(), func() error { return errors.New("fail") }, nil)
+	elapsed := time.Since(start)
+
+	// Delays: 10ms, 15ms, 15ms, each reduced by up to 50%.
+	if elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("elapsed %v outside jittered backoff bounds", elapsed)
+	}
+}
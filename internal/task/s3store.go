@@ -0,0 +1,210 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"firestige.xyz/otus/internal/objstore"
+	"firestige.xyz/otus/internal/seal"
+)
+
+// ErrStoreConflict is returned by S3TaskStore.Save when the record was
+// changed by another writer since this store last read or wrote it.
+var ErrStoreConflict = errors.New("record changed by another writer")
+
+// objectStore is the part of objstore.Client used by S3TaskStore.
+type objectStore interface {
+	Get(key string) ([]byte, string, error)
+	Head(key string) (string, error)
+	Put(key string, data []byte, etag string) (string, error)
+	Delete(key string) error
+	List(prefix string) ([]string, error)
+}
+
+// S3TaskStore persists tasks as objects {prefix}/{agent}/tasks/{id}.json in
+// S3-compatible object storage, so task state survives the loss of the
+// agent's disk (e.g. reimaged edge hosts).
+//
+// Writes are optimistic: a record this store has read or written is only
+// overwritten if its ETag is unchanged. A record changed behind its back
+// (another agent configured with the same agent ID and prefix) fails the
+// save with ErrStoreConflict; the next save of the task overwrites it.
+type S3TaskStore struct {
+	objects objectStore
+	prefix  string        // key prefix of the records, ends with "/"
+	keyring *seal.Keyring // nil = plaintext records
+
+	mu    sync.Mutex
+	etags map[string]string // task ID → ETag last read or written
+}
+
+// NewS3TaskStore creates a store for the agent's records under prefix.
+func NewS3TaskStore(client *objstore.Client, prefix, agentID string) *S3TaskStore {
+	return newS3TaskStore(client, prefix, agentID)
+}
+
+func newS3TaskStore(objects objectStore, prefix, agentID string) *S3TaskStore {
+	p := agentID + "/tasks/"
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		p = prefix + "/" + p
+	}
+	return &S3TaskStore{objects: objects, prefix: p, etags: make(map[string]string)}
+}
+
+// SetKeyring enables encryption, as FileTaskStore.SetKeyring.
+func (s *S3TaskStore) SetKeyring(k *seal.Keyring) {
+	s.keyring = k
+}
+
+// Save writes pt if its record is unchanged since this store last read or
+// wrote it. A record the store has not seen is overwritten.
+func (s *S3TaskStore) Save(pt PersistedTask) error {
+	data, err := encodeTask(pt, s.keyring)
+	if err != nil {
+		return err
+	}
+	id := pt.Config.ID
+	key := s.key(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag, known := s.etags[id]
+	if !known {
+		if etag, err = s.objects.Head(key); err != nil && !errors.Is(err, objstore.ErrNotFound) {
+			return fmt.Errorf("task store: save %q: %w", id, err)
+		}
+	}
+	newETag, err := s.objects.Put(key, data, etag)
+	if errors.Is(err, objstore.ErrPreconditionFailed) {
+		delete(s.etags, id)
+		return fmt.Errorf("task store: save %q: %w", id, ErrStoreConflict)
+	}
+	if err != nil {
+		return fmt.Errorf("task store: save %q: %w", id, err)
+	}
+	s.etags[id] = newETag
+
+	slog.Debug("task state persisted", "task_id", id, "state", pt.State, "key", key)
+	return nil
+}
+
+// Load reads the record of task id.
+// Returns an error satisfying errors.Is(err, os.ErrNotExist) when not found.
+func (s *S3TaskStore) Load(id string) (PersistedTask, error) {
+	pt, _, err := s.load(id)
+	return pt, err
+}
+
+func (s *S3TaskStore) load(id string) (PersistedTask, string, error) {
+	data, etag, err := s.objects.Get(s.key(id))
+	if errors.Is(err, objstore.ErrNotFound) {
+		return PersistedTask{}, "", fmt.Errorf("task store: %q not found: %w", id, os.ErrNotExist)
+	}
+	if err != nil {
+		return PersistedTask{}, "", fmt.Errorf("task store: read %q: %w", id, err)
+	}
+	pt, keyID, err := decodeTask(id, data, s.keyring)
+	if err != nil {
+		return PersistedTask{}, "", err
+	}
+	s.mu.Lock()
+	s.etags[id] = etag
+	s.mu.Unlock()
+	return pt, keyID, nil
+}
+
+// Delete removes the record of task id.
+// Returns nil when the record does not exist (idempotent).
+func (s *S3TaskStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.objects.Delete(s.key(id)); err != nil {
+		return fmt.Errorf("task store: delete %q: %w", id, err)
+	}
+	delete(s.etags, id)
+	slog.Debug("task state object removed", "task_id", id)
+	return nil
+}
+
+// List reads all records of the agent.
+// Records that cannot be read or decoded are logged and skipped.
+func (s *S3TaskStore) List() ([]PersistedTask, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []PersistedTask
+	for _, id := range ids {
+		pt, err := s.Load(id)
+		if err != nil {
+			slog.Warn("task store: skipping unreadable object",
+				"key", s.key(id),
+				"error", err,
+			)
+			continue
+		}
+		tasks = append(tasks, pt)
+	}
+	return tasks, nil
+}
+
+// Rotate rewrites every record not sealed with the active key, as
+// FileTaskStore.Rotate.
+func (s *S3TaskStore) Rotate() (int, error) {
+	if s.keyring == nil {
+		return 0, nil
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	for _, id := range ids {
+		pt, keyID, err := s.load(id)
+		if err != nil {
+			slog.Warn("task store: skipping unreadable object during key rotation",
+				"key", s.key(id),
+				"error", err,
+			)
+			continue
+		}
+		if keyID == s.keyring.ActiveKeyID() {
+			continue
+		}
+		if err := s.Save(pt); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
+
+// ids returns the task IDs of all {id}.json objects under the prefix.
+func (s *S3TaskStore) ids() ([]string, error) {
+	keys, err := s.objects.List(s.prefix)
+	if err != nil {
+		return nil, fmt.Errorf("task store: list %q: %w", s.prefix, err)
+	}
+	var ids []string
+	for _, key := range keys {
+		name := strings.TrimPrefix(key, s.prefix)
+		if strings.Contains(name, "/") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	return ids, nil
+}
+
+// key returns the object key of the record of task id.
+func (s *S3TaskStore) key(id string) string {
+	return s.prefix + id + ".json"
+}
+
+// Ensure S3TaskStore satisfies the TaskStore interface at compile time.
+var _ TaskStore = (*S3TaskStore)(nil)
@@ -0,0 +1,156 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"firestige.xyz/otus/internal/objstore"
+)
+
+// memObjects is an in-memory objectStore with S3's conditional writes; the
+// ETag of an object is its write generation.
+type memObjects struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	etags   map[string]string
+	writes  int
+}
+
+func newMemObjects() *memObjects {
+	return &memObjects{objects: make(map[string][]byte), etags: make(map[string]string)}
+}
+
+func (m *memObjects) Get(key string) ([]byte, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, "", objstore.ErrNotFound
+	}
+	return data, m.etags[key], nil
+}
+
+func (m *memObjects) Head(key string) (string, error) {
+	_, etag, err := m.Get(key)
+	return etag, err
+}
+
+func (m *memObjects) Put(key string, data []byte, etag string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.etags[key] != etag {
+		return "", objstore.ErrPreconditionFailed
+	}
+	m.writes++
+	m.objects[key] = data
+	m.etags[key] = fmt.Sprintf(`"%d"`, m.writes)
+	return m.etags[key], nil
+}
+
+func (m *memObjects) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	delete(m.etags, key)
+	return nil
+}
+
+func (m *memObjects) List(prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func TestS3TaskStore_SaveLoadList(t *testing.T) {
+	objects := newMemObjects()
+	store := newS3TaskStore(objects, "/otus/", "edge-01")
+	other := newS3TaskStore(objects, "otus", "edge-02")
+
+	for _, id := range []string{"a", "b"} {
+		if err := store.Save(testPersistedTask(id, "running")); err != nil {
+			t.Fatalf("Save(%s): %v", id, err)
+		}
+	}
+	if err := other.Save(testPersistedTask("c", "running")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objects.objects["otus/edge-01/tasks/a.json"]; !ok {
+		t.Fatalf("keys = %v, want otus/edge-01/tasks/a.json", objects.objects)
+	}
+
+	// A reimaged agent starts with an empty store and finds its records
+	fresh := newS3TaskStore(objects, "otus", "edge-01")
+	list, err := fresh.List()
+	if err != nil || len(list) != 2 || list[0].Config.ID != "a" || list[1].Config.ID != "b" {
+		t.Fatalf("List = %+v, %v; want a and b", list, err)
+	}
+	if _, err := fresh.Load("c"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Load of another agent's task: err = %v, want ErrNotExist", err)
+	}
+
+	if err := fresh.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Delete("a"); err != nil {
+		t.Errorf("second Delete: %v", err)
+	}
+	if list, _ := fresh.List(); len(list) != 1 {
+		t.Errorf("List after Delete = %d records, want 1", len(list))
+	}
+}
+
+func TestS3TaskStore_Conflict(t *testing.T) {
+	objects := newMemObjects()
+	first := newS3TaskStore(objects, "otus", "edge-01")
+	second := newS3TaskStore(objects, "otus", "edge-01") // same agent ID on another host
+
+	if err := first.Save(testPersistedTask("t", "running")); err != nil {
+		t.Fatal(err)
+	}
+	// A store that has not seen the record overwrites it
+	if err := second.Save(testPersistedTask("t", "stopped")); err != nil {
+		t.Fatalf("Save of an unseen record: %v", err)
+	}
+
+	// The first store's version is stale now
+	if err := first.Save(testPersistedTask("t", "failed")); !errors.Is(err, ErrStoreConflict) {
+		t.Fatalf("Save over a changed record: err = %v, want ErrStoreConflict", err)
+	}
+	if pt, _ := second.Load("t"); pt.State != "stopped" {
+		t.Errorf("state = %s after the conflict, want stopped", pt.State)
+	}
+	// The conflict was reported; the next save overwrites
+	if err := first.Save(testPersistedTask("t", "failed")); err != nil {
+		t.Errorf("Save after a reported conflict: %v", err)
+	}
+}
+
+func TestS3TaskStore_Rotate(t *testing.T) {
+	objects := newMemObjects()
+	store := newS3TaskStore(objects, "", "edge-01")
+	if err := store.Save(testPersistedTask("legacy", "stopped")); err != nil {
+		t.Fatal(err)
+	}
+	store.SetKeyring(testKeyring(t, 1))
+	if strings.Contains(string(objects.objects["edge-01/tasks/legacy.json"]), "encrypted") {
+		t.Fatal("record encrypted before Rotate")
+	}
+	if n, err := store.Rotate(); err != nil || n != 1 {
+		t.Fatalf("Rotate = %d, %v; want 1 rewritten", n, err)
+	}
+	if !strings.Contains(string(objects.objects["edge-01/tasks/legacy.json"]), "encrypted") {
+		t.Error("record not encrypted after Rotate")
+	}
+}
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+)
+
+// Canary packets travel between two TEST-NET-1 addresses (RFC 5737), which
+// never appear in captured traffic.
+var (
+	canarySrc = netip.MustParseAddr("192.0.2.1")
+	canaryDst = netip.MustParseAddr("192.0.2.2")
+)
+
+// selfTest tracks the canary packets injected at task start. Once created it
+// stays on the task: canaries reaching the sender after the test are still
+// kept from the reporters unless deliver is set.
+type selfTest struct {
+	deliver bool
+	seen    []atomic.Bool // per pipeline: a canary reached the sender
+	pending atomic.Int32  // pipelines without a canary yet
+	done    chan struct{} // closed when pending reaches 0
+}
+
+func newSelfTest(pipelines int, deliver bool) *selfTest {
+	s := &selfTest{
+		deliver: deliver,
+		seen:    make([]atomic.Bool, pipelines),
+		done:    make(chan struct{}),
+	}
+	s.pending.Store(int32(pipelines))
+	return s
+}
+
+// observe records a packet at the sender and reports whether it is a canary
+// to keep from the reporters.
+func (s *selfTest) observe(pkt *core.OutputPacket) bool {
+	if pkt.SrcIP != canarySrc || pkt.DstIP != canaryDst {
+		return false
+	}
+	if i := pkt.PipelineID; i >= 0 && i < len(s.seen) && s.seen[i].CompareAndSwap(false, true) {
+		if s.pending.Add(-1) == 0 {
+			close(s.done)
+		}
+	}
+	return !s.deliver
+}
+
+// missing returns the pipelines whose canaries have not reached the sender.
+func (s *selfTest) missing() []int {
+	var ids []int
+	for i := range s.seen {
+		if !s.seen[i].Load() {
+			ids = append(ids, i)
+		}
+	}
+	return ids
+}
+
+// runSelfTest injects a SIP and an RTP canary into every pipeline and waits
+// for at least one canary of each to reach the sender. It runs after the
+// pipelines and the sender start and before capture starts, so wiring errors
+// fail task_create instead of silently losing traffic.
+func (t *Task) runSelfTest() error {
+	timeout := config.DefaultSelfTestTimeout
+	if t.Config.SelfTest.Timeout != "" {
+		timeout, _ = time.ParseDuration(t.Config.SelfTest.Timeout) // validated
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, timeout)
+	defer cancel()
+
+	canaries := canaryFrames(t.Config.ID)
+	for _, stream := range t.rawStreams {
+		for _, frame := range canaries {
+			pkt := core.RawPacket{
+				Data:       frame,
+				Timestamp:  time.Now(),
+				CaptureLen: uint32(len(frame)),
+				OrigLen:    uint32(len(frame)),
+			}
+			select {
+			case stream <- pkt:
+			case <-ctx.Done():
+				return fmt.Errorf("self-test: pipeline input full: %w", ctx.Err())
+			}
+		}
+	}
+
+	select {
+	case <-t.selfTest.done:
+		slog.Info("task self-test passed", "task_id", t.Config.ID, "pipelines", len(t.Pipelines))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("self-test: no canary from pipelines %v reached the sender within %s", t.selfTest.missing(), timeout)
+	}
+}
+
+// abortStart releases what Start started before a failed self-test or
+// tuning: pipelines, the sender and the reporters. Capture has not started.
+// The caller holds t.mu.
+func (t *Task) abortStart() {
+	t.cancel() // pipelines exit without draining their input
+	t.pipelineWg.Wait()
+	close(t.sendBuffer)
+	<-t.doneCh
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer stopCancel()
+	for i, rep := range t.Reporters {
+		if err := rep.Stop(stopCtx); err != nil {
+			slog.Error("self-test: failed to stop reporter", "task_id", t.Config.ID, "reporter_id", i, "error", err)
+		}
+	}
+}
+
+// canaryFrames builds the canary Ethernet frames: a SIP OPTIONS request and
+// an RTP packet of PCMU silence.
+func canaryFrames(taskID string) [][]byte {
+	sip := "OPTIONS sip:otus-canary@192.0.2.2 SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.0.2.1:5060;branch=z9hG4bK-otus-canary\r\n" +
+		"Max-Forwards: 70\r\n" +
+		"From: <sip:otus-canary@192.0.2.1>;tag=otus-canary\r\n" +
+		"To: <sip:otus-canary@192.0.2.2>\r\n" +
+		"Call-ID: otus-canary-" + taskID + "\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"Content-Length: 0\r\n\r\n"
+
+	rtp := make([]byte, 12+160)
+	rtp[0] = 0x80                                   // version 2
+	rtp[3] = 1                                      // sequence number 1, payload type 0 (PCMU)
+	copy(rtp[8:12], []byte{0x07, 0x15, 0xca, 0x1a}) // SSRC
+	for i := 12; i < len(rtp); i++ {
+		rtp[i] = 0xff // µ-law silence
+	}
+
+	return [][]byte{
+		udpFrame(5060, 5060, []byte(sip)),
+		udpFrame(40000, 40002, rtp),
+	}
+}
+
+func udpFrame(srcPort, dstPort uint16, payload []byte) []byte {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		DstMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{
+		Version:  4,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    canarySrc.AsSlice(),
+		DstIP:    canaryDst.AsSlice(),
+	}
+	udp := &layers.UDP{SrcPort: layers.UDPPort(srcPort), DstPort: layers.UDPPort(dstPort)}
+	_ = udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload(payload)); err != nil {
+		panic(fmt.Sprintf("canary frame: %v", err)) // fixed layers, cannot fail
+	}
+	return buf.Bytes()
+}
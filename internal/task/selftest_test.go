@@ -0,0 +1,87 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// dropAllProcessor drops every packet, like a misconfigured filter.
+type dropAllProcessor struct{}
+
+func (dropAllProcessor) Name() string                    { return "drop-all" }
+func (dropAllProcessor) Init(map[string]any) error       { return nil }
+func (dropAllProcessor) Start(context.Context) error     { return nil }
+func (dropAllProcessor) Stop(context.Context) error      { return nil }
+func (dropAllProcessor) Process(*core.OutputPacket) bool { return false }
+
+func newSelfTestTask(rep *mockReporter, deliver bool, processors ...plugin.Processor) *Task {
+	task := newTestTask([]plugin.Reporter{rep}, []plugin.Capturer{&mockCapturer{name: "cap0"}})
+	task.Config.SelfTest = config.SelfTestConfig{Enabled: true, Timeout: "500ms", Deliver: deliver}
+	task.Pipelines = []*pipeline.Pipeline{pipeline.New(pipeline.Config{
+		ID:         0,
+		TaskID:     task.Config.ID,
+		AgentID:    "test-agent",
+		Decoder:    decoder.NewStandardDecoder(decoder.Config{}),
+		Processors: processors,
+	})}
+	return task
+}
+
+func TestTask_SelfTestPasses(t *testing.T) {
+	rep := &mockReporter{name: "r0"}
+	task := newSelfTestTask(rep, false)
+
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	defer task.Stop()
+
+	if got := task.State(); got != StateRunning {
+		t.Errorf("state = %s, want running", got)
+	}
+	if n := len(rep.packets()); n != 0 {
+		t.Errorf("reporter got %d canary packets, want 0 without deliver", n)
+	}
+}
+
+func TestTask_SelfTestDeliver(t *testing.T) {
+	rep := &mockReporter{name: "r0"}
+	task := newSelfTestTask(rep, true)
+
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	task.Stop()
+
+	pkts := rep.packets()
+	if len(pkts) != 2 {
+		t.Fatalf("reporter got %d packets, want the 2 canaries", len(pkts))
+	}
+	if pkts[0].SrcIP != canarySrc || pkts[0].DstPort != 5060 {
+		t.Errorf("first canary = %v:%d, want SIP from %v", pkts[0].SrcIP, pkts[0].DstPort, canarySrc)
+	}
+}
+
+func TestTask_SelfTestFails(t *testing.T) {
+	rep := &mockReporter{name: "r0"}
+	task := newSelfTestTask(rep, false, dropAllProcessor{})
+
+	err := task.Start()
+	if err == nil || !strings.Contains(err.Error(), "self-test") {
+		t.Fatalf("Start() error = %v, want self-test failure", err)
+	}
+	status := task.GetStatus()
+	if status.State != StateFailed {
+		t.Errorf("state = %s, want failed", status.State)
+	}
+	if !rep.stopped.Load() {
+		t.Error("reporter not stopped after failed self-test")
+	}
+}
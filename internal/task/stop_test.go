@@ -0,0 +1,268 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// stuckCapturer ignores Stop() and only returns from Capture when its
+// context is cancelled, simulating a capturer that hangs on shutdown.
+type stuckCapturer struct {
+	mockCapturer
+}
+
+func (c *stuckCapturer) Capture(ctx context.Context, _ chan<- core.RawPacket) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newStopTestTask(id, stopTimeout string, cap plugin.Capturer) *Task {
+	cfg := config.TaskConfig{
+		ID:      id,
+		Workers: 1,
+		Capture: config.CaptureConfig{
+			Name:         "mock",
+			Interface:    "lo",
+			DispatchMode: "binding",
+		},
+		StopTimeout: stopTimeout,
+	}
+	t := NewTask(cfg)
+	t.Capturers = []plugin.Capturer{cap}
+	t.Reporters = []plugin.Reporter{&mockReporter{name: "rep"}}
+	t.Pipelines = []*pipeline.Pipeline{pipeline.New(pipeline.Config{
+		ID:      0,
+		TaskID:  id,
+		AgentID: "test-agent",
+		Decoder: decoder.NewStandardDecoder(decoder.Config{}),
+	})}
+	return t
+}
+
+func TestTask_StopTimeoutDefault(t *testing.T) {
+	task := newStopTestTask("t-default", "", &mockCapturer{name: "cap"})
+	if got := task.StopTimeout(); got != defaultStopTimeout {
+		t.Errorf("StopTimeout() = %v, want %v", got, defaultStopTimeout)
+	}
+
+	task = newStopTestTask("t-custom", "2s", &mockCapturer{name: "cap"})
+	if got := task.StopTimeout(); got != 2*time.Second {
+		t.Errorf("StopTimeout() = %v, want 2s", got)
+	}
+}
+
+func TestTask_StopDeadlineExceeded(t *testing.T) {
+	task := newStopTestTask("t-stuck", "50ms", &stuckCapturer{mockCapturer{name: "cap"}})
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	start := time.Now()
+	err := task.Stop()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Stop() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Stop() took %v, deadline not enforced", elapsed)
+	}
+
+	status := task.GetStatus()
+	if status.State != StateFailed {
+		t.Errorf("state = %s, want failed", status.State)
+	}
+	if status.FailureReason == "" {
+		t.Error("expected failure reason to be recorded")
+	}
+
+	// Forced cancel must let the background shutdown finish without
+	// overwriting the failed state.
+	select {
+	case <-task.doneCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sender loop did not exit after forced cancel")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if task.State() != StateFailed {
+		t.Errorf("state after background shutdown = %s, want failed", task.State())
+	}
+}
+
+func TestTask_ParentContextCancelsTask(t *testing.T) {
+	parent, cancel := context.WithCancel(context.Background())
+	task := NewTaskWithContext(parent, config.TaskConfig{ID: "t-parent", Workers: 1})
+
+	cancel()
+	select {
+	case <-task.ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task context not cancelled with parent")
+	}
+}
+
+func TestTaskManager_StopAllParallel(t *testing.T) {
+	manager := NewTaskManager("test-agent", nil)
+
+	stuck := newStopTestTask("a-stuck", "200ms", &stuckCapturer{mockCapturer{name: "cap"}})
+	healthy := newStopTestTask("b-healthy", "", &mockCapturer{name: "cap"})
+	for _, task := range []*Task{stuck, healthy} {
+		if err := task.Start(); err != nil {
+			t.Fatalf("Start(%s) error: %v", task.ID(), err)
+		}
+		manager.tasks[task.ID()] = task
+	}
+
+	start := time.Now()
+	results := manager.StopAll()
+	elapsed := time.Since(start)
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 stop results, got %d", len(results))
+	}
+	if results[0].TaskID != "a-stuck" || results[1].TaskID != "b-healthy" {
+		t.Errorf("results not sorted by task ID: %+v", results)
+	}
+	if results[0].Error == "" || results[0].State != StateFailed {
+		t.Errorf("stuck task result = %+v, want failed with error", results[0])
+	}
+	if results[1].Error != "" || results[1].State != StateStopped {
+		t.Errorf("healthy task result = %+v, want stopped without error", results[1])
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("StopAll took %v, expected bounded by per-task deadline", elapsed)
+	}
+	if manager.Count() != 0 {
+		t.Errorf("expected count 0 after StopAll, got %d", manager.Count())
+	}
+}
+
+func TestTask_Drain(t *testing.T) {
+	frames := make([][]byte, 20)
+	for i := range frames {
+		frames[i] = udpFrame(5060, 5060, []byte("OPTIONS"))
+	}
+	task := newStopTestTask("t-drain", "", newFrameCapturer("cap", frames...))
+	rep := &mockReporter{name: "rep"}
+	var reported atomic.Int32
+	rep.reportHook = func(context.Context, *core.OutputPacket) error {
+		time.Sleep(time.Millisecond) // slower than capture: packets queue up
+		reported.Add(1)
+		return nil
+	}
+	task.Reporters = []plugin.Reporter{rep}
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	elapsed, err := task.Drain(0)
+	if err != nil {
+		t.Fatalf("Drain() error: %v", err)
+	}
+	if got := reported.Load(); got != int32(len(frames)) {
+		t.Errorf("reported %d packets, want %d", got, len(frames))
+	}
+	status := task.GetStatus()
+	if status.State != StateStopped {
+		t.Errorf("state = %s, want stopped", status.State)
+	}
+	if elapsed <= 0 || status.DrainDuration != elapsed.String() {
+		t.Errorf("drain duration = %q, returned %v", status.DrainDuration, elapsed)
+	}
+	if !rep.stopped.Load() {
+		t.Error("reporter not stopped")
+	}
+
+	if _, err := task.Drain(0); err == nil {
+		t.Error("Drain() of a stopped task succeeded")
+	}
+}
+
+func TestTask_DrainTimeout(t *testing.T) {
+	task := newStopTestTask("t-drain-stuck", "", &stuckCapturer{mockCapturer{name: "cap"}})
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	if _, err := task.Drain(50 * time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Drain() error = %v, want DeadlineExceeded", err)
+	}
+	if task.State() != StateFailed {
+		t.Errorf("state = %s, want failed", task.State())
+	}
+}
+
+// bufferingReporter holds pending items and flushes them one per 10ms until
+// its context ends.
+type bufferingReporter struct {
+	mockReporter
+	pending atomic.Int32
+}
+
+func (r *bufferingReporter) Pending() int { return int(r.pending.Load()) }
+func (r *bufferingReporter) Flush(ctx context.Context) error {
+	for r.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+			r.pending.Add(-1)
+		}
+	}
+	return nil
+}
+
+func TestTask_StopFlushResults(t *testing.T) {
+	task := newStopTestTask("t-flush", "", &mockCapturer{name: "cap"})
+	task.Config.Reporters = []config.ReporterConfig{
+		{Name: "slow", FlushTimeout: "100ms"},
+		{Name: "fast"},
+		{Name: "plain"},
+	}
+	slow, fast := &bufferingReporter{mockReporter: mockReporter{name: "slow"}}, &bufferingReporter{mockReporter: mockReporter{name: "fast"}}
+	slow.pending.Store(1000)
+	fast.pending.Store(3)
+	task.Reporters = []plugin.Reporter{slow, fast, &mockReporter{name: "plain"}}
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	store := newTestStore(t)
+	manager := NewTaskManager("test-agent", store)
+	manager.tasks[task.ID()] = task
+	if _, err := manager.Drain(task.ID(), 5*time.Second); err != nil {
+		t.Fatalf("Drain() error: %v", err)
+	}
+
+	flush := task.GetStatus().Flush
+	if len(flush) != 3 {
+		t.Fatalf("flush results = %+v, want 3", flush)
+	}
+	if r := flush[0]; !r.TimedOut || r.Error == "" || r.Flushed == nil || *r.Flushed == 0 || *r.Remaining == 0 || *r.Flushed+*r.Remaining != 1000 {
+		t.Errorf("slow reporter = %+v, want a partial flush cut by flush_timeout", r)
+	}
+	if r := flush[1]; r.TimedOut || r.Error != "" || r.Flushed == nil || *r.Flushed != 3 || *r.Remaining != 0 {
+		t.Errorf("fast reporter = %+v, want 3 flushed", r)
+	}
+	if r := flush[2]; r.Reporter != "plain" || r.Flushed != nil || r.Remaining != nil {
+		t.Errorf("plain reporter = %+v, want no counts", r)
+	}
+	if !slow.stopped.Load() || !fast.stopped.Load() {
+		t.Error("reporters not stopped")
+	}
+
+	pt, err := store.Load(task.ID())
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(pt.Flush) != 3 || *pt.Flush[1].Flushed != 3 || !pt.Flush[0].TimedOut {
+		t.Errorf("persisted flush = %+v", pt.Flush)
+	}
+}
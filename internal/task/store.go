@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/seal"
 )
 
 // TaskStore is the persistence interface for task state (ADR-030).
@@ -31,23 +33,37 @@ type TaskStore interface {
 
 // PersistedTask is the on-disk wire format for a task (ADR-030 v1).
 type PersistedTask struct {
-	Version       string            `json:"version"`                  // "v1"
-	Config        config.TaskConfig `json:"config"`                   // full TaskConfig
-	State         TaskState         `json:"state"`                    // last known state
+	Version       string            `json:"version"` // "v1"
+	Config        config.TaskConfig `json:"config"`  // full TaskConfig
+	State         TaskState         `json:"state"`   // last known state
 	CreatedAt     time.Time         `json:"created_at"`
 	StartedAt     *time.Time        `json:"started_at,omitempty"`
 	StoppedAt     *time.Time        `json:"stopped_at,omitempty"`
 	FailureReason string            `json:"failure_reason,omitempty"`
-	RestartCount  int               `json:"restart_count"`
+	// FailureCategory classifies FailureReason; Restore restarts failed
+	// tasks only for transient failures
+	FailureCategory core.ErrorCategory `json:"failure_category,omitempty"`
+	RestartCount    int                `json:"restart_count"`      // restarts after transient failures
+	Counters        *Counters          `json:"counters,omitempty"` // lifetime counters; counters.persist only
+	Flush           []FlushResult      `json:"flush,omitempty"`    // final reporter flush of the last stop
 }
 
 // persistenceVersion is the current wire format version.
 const persistenceVersion = "v1"
 
+// encryptedTask is the on-disk format of a sealed PersistedTask. The task ID
+// is the additional authenticated data, so a record only opens under its own
+// file name.
+type encryptedTask struct {
+	Version   string         `json:"version"`
+	Encrypted *seal.Envelope `json:"encrypted"`
+}
+
 // FileTaskStore persists tasks as individual JSON files under a directory.
 // Write operations use temp-file + atomic rename to guarantee crash safety.
 type FileTaskStore struct {
-	dir string // absolute path to the tasks directory
+	dir     string        // absolute path to the tasks directory
+	keyring *seal.Keyring // nil = plaintext records
 }
 
 // NewFileTaskStore creates a FileTaskStore rooted at dir.
@@ -63,13 +79,9 @@ func NewFileTaskStore(dir string) (*FileTaskStore, error) {
 // Using os.CreateTemp ensures concurrent saves for the same ID each get their
 // own temp file, preventing races on the .tmp path.
 func (s *FileTaskStore) Save(pt PersistedTask) error {
-	if pt.Version == "" {
-		pt.Version = persistenceVersion
-	}
-
-	data, err := json.MarshalIndent(pt, "", "  ")
+	data, err := encodeTask(pt, s.keyring)
 	if err != nil {
-		return fmt.Errorf("task store: marshal %q: %w", pt.Config.ID, err)
+		return err
 	}
 
 	// Create a unique temp file in the same directory so rename is atomic.
@@ -99,21 +111,113 @@ func (s *FileTaskStore) Save(pt PersistedTask) error {
 	return nil
 }
 
+// SetKeyring enables encryption: records are sealed with the keyring's active
+// key on Save, and sealed records are opened with any of its keys on Load.
+// Plaintext records written before encryption was enabled still load; Rotate
+// rewrites them.
+func (s *FileTaskStore) SetKeyring(k *seal.Keyring) {
+	s.keyring = k
+}
+
 // Load reads and deserialises the persisted Task with the given id.
 // Returns an error satisfying errors.Is(err, os.ErrNotExist) when not found.
 func (s *FileTaskStore) Load(id string) (PersistedTask, error) {
+	pt, _, err := s.load(id)
+	return pt, err
+}
+
+// load reads the record for id and also returns the ID of the key it was
+// sealed with ("" for a plaintext record).
+func (s *FileTaskStore) load(id string) (PersistedTask, string, error) {
 	data, err := os.ReadFile(s.path(id))
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return PersistedTask{}, fmt.Errorf("task store: %q not found: %w", id, os.ErrNotExist)
+			return PersistedTask{}, "", fmt.Errorf("task store: %q not found: %w", id, os.ErrNotExist)
+		}
+		return PersistedTask{}, "", fmt.Errorf("task store: read %q: %w", id, err)
+	}
+	return decodeTask(id, data, s.keyring)
+}
+
+// encodeTask returns the stored form of pt, sealed if keyring is not nil.
+func encodeTask(pt PersistedTask, keyring *seal.Keyring) ([]byte, error) {
+	if pt.Version == "" {
+		pt.Version = persistenceVersion
+	}
+
+	data, err := json.MarshalIndent(pt, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("task store: marshal %q: %w", pt.Config.ID, err)
+	}
+	if keyring != nil {
+		env, err := keyring.Seal(data, []byte(pt.Config.ID))
+		if err != nil {
+			return nil, fmt.Errorf("task store: encrypt %q: %w", pt.Config.ID, err)
+		}
+		data, err = json.MarshalIndent(encryptedTask{Version: pt.Version, Encrypted: env}, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("task store: marshal %q: %w", pt.Config.ID, err)
+		}
+	}
+	return data, nil
+}
+
+// decodeTask parses the stored record of task id and also returns the ID of
+// the key it was sealed with ("" for a plaintext record).
+func decodeTask(id string, data []byte, keyring *seal.Keyring) (PersistedTask, string, error) {
+	var enc encryptedTask
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return PersistedTask{}, "", fmt.Errorf("task store: unmarshal %q: %w", id, err)
+	}
+	keyID := ""
+	if enc.Encrypted != nil {
+		if keyring == nil {
+			return PersistedTask{}, "", fmt.Errorf("task store: %q is encrypted but no key is configured", id)
 		}
-		return PersistedTask{}, fmt.Errorf("task store: read %q: %w", id, err)
+		var err error
+		if data, err = keyring.Open(enc.Encrypted, []byte(id)); err != nil {
+			return PersistedTask{}, "", fmt.Errorf("task store: decrypt %q: %w", id, err)
+		}
+		keyID = enc.Encrypted.KeyID
 	}
+
 	var pt PersistedTask
 	if err := json.Unmarshal(data, &pt); err != nil {
-		return PersistedTask{}, fmt.Errorf("task store: unmarshal %q: %w", id, err)
+		return PersistedTask{}, "", fmt.Errorf("task store: unmarshal %q: %w", id, err)
+	}
+	return pt, keyID, nil
+}
+
+// Rotate rewrites every record not sealed with the active key — plaintext
+// records and records sealed with an older key — and returns how many were
+// rewritten. Records that cannot be read are logged and left in place.
+func (s *FileTaskStore) Rotate() (int, error) {
+	if s.keyring == nil {
+		return 0, nil
+	}
+	ids, err := s.ids()
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	for _, id := range ids {
+		pt, keyID, err := s.load(id)
+		if err != nil {
+			slog.Warn("task store: skipping unreadable file during key rotation",
+				"file", s.path(id),
+				"error", err,
+			)
+			continue
+		}
+		if keyID == s.keyring.ActiveKeyID() {
+			continue
+		}
+		if err := s.Save(pt); err != nil {
+			return rewritten, err
+		}
+		rewritten++
 	}
-	return pt, nil
+	return rewritten, nil
 }
 
 // Delete removes the persisted file for id.
@@ -134,6 +238,28 @@ func (s *FileTaskStore) Delete(id string) error {
 // Files that cannot be read or decoded are logged and skipped.
 // Unrecognised file names (including .tmp files) are ignored.
 func (s *FileTaskStore) List() ([]PersistedTask, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []PersistedTask
+	for _, id := range ids {
+		pt, err := s.Load(id)
+		if err != nil {
+			slog.Warn("task store: skipping unreadable file",
+				"file", s.path(id),
+				"error", err,
+			)
+			continue
+		}
+		tasks = append(tasks, pt)
+	}
+	return tasks, nil
+}
+
+// ids returns the task IDs of all {id}.json files in the directory.
+func (s *FileTaskStore) ids() ([]string, error) {
 	entries, err := os.ReadDir(s.dir)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
@@ -142,7 +268,7 @@ func (s *FileTaskStore) List() ([]PersistedTask, error) {
 		return nil, fmt.Errorf("task store: read directory %q: %w", s.dir, err)
 	}
 
-	var tasks []PersistedTask
+	var ids []string
 	for _, e := range entries {
 		if e.IsDir() {
 			continue
@@ -151,18 +277,9 @@ func (s *FileTaskStore) List() ([]PersistedTask, error) {
 		if !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".tmp") {
 			continue
 		}
-		id := strings.TrimSuffix(name, ".json")
-		pt, err := s.Load(id)
-		if err != nil {
-			slog.Warn("task store: skipping unreadable file",
-				"file", filepath.Join(s.dir, name),
-				"error", err,
-			)
-			continue
-		}
-		tasks = append(tasks, pt)
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
 	}
-	return tasks, nil
+	return ids, nil
 }
 
 // path returns the absolute path to the JSON file for a given task ID.
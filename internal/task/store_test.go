@@ -1,6 +1,7 @@
 package task
 
 import (
+	"bytes"
 	"errors"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/seal"
 )
 
 func testPersistedTask(id, state string) PersistedTask {
@@ -257,6 +259,90 @@ func TestFileTaskStore_List_IgnoresTmpFiles(t *testing.T) {
 	}
 }
 
+// ---------------------------------------------------------------------------
+// Encryption at rest
+// ---------------------------------------------------------------------------
+
+func testKeyring(t *testing.T, keys ...byte) *seal.Keyring {
+	t.Helper()
+	raw := make([][]byte, len(keys))
+	for i, b := range keys {
+		raw[i] = bytes.Repeat([]byte{b}, seal.KeySize)
+	}
+	k, err := seal.NewKeyring(raw...)
+	if err != nil {
+		t.Fatalf("NewKeyring: %v", err)
+	}
+	return k
+}
+
+func TestFileTaskStore_Encrypted(t *testing.T) {
+	store := newTestStore(t)
+	store.SetKeyring(testKeyring(t, 1))
+	pt := testPersistedTask("enc1", "running")
+	pt.FailureReason = "From: <sip:alice@example.com>"
+
+	if err := store.Save(pt); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	data, err := os.ReadFile(store.path("enc1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "alice") || !strings.Contains(string(data), seal.Cipher) {
+		t.Errorf("record on disk is not encrypted: %s", data)
+	}
+
+	got, err := store.Load("enc1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got.FailureReason != pt.FailureReason {
+		t.Errorf("FailureReason = %q, want %q", got.FailureReason, pt.FailureReason)
+	}
+
+	// A record copied under another task's name does not open.
+	if err := os.WriteFile(store.path("enc2"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load("enc2"); err == nil {
+		t.Error("Load of a record renamed to another task succeeded")
+	}
+
+	// Without the key the record is unreadable, not silently empty.
+	plain, _ := NewFileTaskStore(store.dir)
+	if _, err := plain.Load("enc1"); err == nil || !strings.Contains(err.Error(), "no key") {
+		t.Errorf("Load without key error = %v, want no key configured", err)
+	}
+}
+
+func TestFileTaskStore_Rotate(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(testPersistedTask("legacy", "stopped")); err != nil {
+		t.Fatal(err)
+	}
+	store.SetKeyring(testKeyring(t, 1))
+	if err := store.Save(testPersistedTask("old", "running")); err != nil {
+		t.Fatal(err)
+	}
+
+	// New key first, old key kept for reading: both records are rewritten.
+	store.SetKeyring(testKeyring(t, 2, 1))
+	if n, err := store.Rotate(); err != nil || n != 2 {
+		t.Fatalf("Rotate = %d, %v; want 2 rewritten", n, err)
+	}
+	if n, err := store.Rotate(); err != nil || n != 0 {
+		t.Errorf("second Rotate = %d, %v; want 0 rewritten", n, err)
+	}
+
+	// The old key can now be retired.
+	store.SetKeyring(testKeyring(t, 2))
+	list, err := store.List()
+	if err != nil || len(list) != 2 {
+		t.Errorf("List after retiring old key = %d records, %v; want 2", len(list), err)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // noopStore
 // ---------------------------------------------------------------------------
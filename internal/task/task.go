@@ -5,17 +5,33 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"hash"
 	"hash/fnv"
 	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"firestige.xyz/otus/internal/analyze"
+	"firestige.xyz/otus/internal/calls"
 	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/featureflag"
 	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/nicadvisor"
+	"firestige.xyz/otus/internal/ostune"
 	"firestige.xyz/otus/internal/pipeline"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/internal/streamtable"
+	"firestige.xyz/otus/internal/tcpanalysis"
+	"firestige.xyz/otus/internal/tlsdecrypt"
+	"firestige.xyz/otus/internal/tlspolicy"
+	"firestige.xyz/otus/internal/topk"
 	"firestige.xyz/otus/pkg/plugin"
+
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // TaskState represents the state of a task in its lifecycle.
@@ -30,6 +46,8 @@ const (
 	StateRunning TaskState = "running"
 	// StateStopping indicates task is in the process of stopping.
 	StateStopping TaskState = "stopping"
+	// StateDraining indicates capture has stopped and buffered packets are being reported.
+	StateDraining TaskState = "draining"
 	// StateStopped indicates task has stopped cleanly.
 	StateStopped TaskState = "stopped"
 	// StatePaused indicates task is temporarily paused.
@@ -53,15 +71,28 @@ type Task struct {
 	Reporters        []plugin.Reporter
 	ReporterWrappers []*ReporterWrapper // batching + fallback wrappers around Reporters
 	Registry         *FlowRegistry
+	Calls            *calls.Table             // active-calls table; nil unless calls.enabled
+	Analyzer         *analyze.Counter         // replaces reporters; nil unless mode is analyze_only
+	TopK             *topk.Tracker            // heavy hitters; nil unless top_k.keys is set
+	TCP              *tcpanalysis.Tracker     // TCP segment labels; nil unless tcp_analysis.enabled
+	TLS              *tlsdecrypt.Decryptor    // SIP over TLS decryption; nil without tls_decryption keys
+	Streams          *streamtable.Table       // RTP stream table; nil unless rtcp_correlation.enabled
+	Quality          *qualityalert.Monitor    // call quality alerts; nil unless quality_alerts sets a threshold
+	Flags            *featureflag.Set         // runtime feature flags, from config flags, changed by flag_set
+	Decoder          *decoder.StandardDecoder // shared by the pipelines
+
+	// Capture interface recommendations found at creation; nil if none
+	CaptureAdvice []nicadvisor.Recommendation
 
 	// Pipeline instances (N copies)
 	Pipelines []*pipeline.Pipeline
 
 	// Runtime channels
-	captureCh  chan core.RawPacket    // dispatch mode only: Capturer → Dispatcher
-	rawStreams []chan core.RawPacket  // one per pipeline
-	sendBuffer chan core.OutputPacket // Pipelines → Sender → Reporters
-	doneCh     chan struct{}          // Signals sender goroutine has exited
+	captureCh  chan core.RawPacket     // dispatch mode only: Capturer → Dispatcher
+	rawStreams []chan core.RawPacket   // one per pipeline
+	sendBuffer chan core.OutputPacket  // Pipelines → Sender → Reporters
+	doneCh     chan struct{}           // Signals sender goroutine has exited
+	targetsCh  chan []*ReporterWrapper // new wrapper set for senderLoop (reporter swap)
 
 	// Goroutine synchronization
 	pipelineWg sync.WaitGroup // Tracks pipeline goroutines
@@ -74,22 +105,53 @@ type Task struct {
 	startedAt     time.Time
 	stoppedAt     time.Time
 	failureReason string
+	failureCat    core.ErrorCategory // category of the failure, see core.CategoryOf
+	restarts      int                // restarts after transient failures (Restore)
+	drainDuration time.Duration      // of the last Drain; 0 if none
+	flush         []FlushResult      // of the last shutdown, per reporter; nil if none
 
 	// Hot-reloadable settings
-	metricsInterval atomic.Int64 // nanoseconds; 0 = use default (5s)
+	metricsInterval atomic.Int64                // nanoseconds; 0 = use default (5s)
+	agentMeta       atomic.Pointer[core.Labels] // stamped on exported packets; nil unless agent_metadata
 
 	// Dispatch strategy for multi-pipeline distribution
 	dispatchStrategy DispatchStrategy
 
+	// Progress of the current or last reporter swap (guarded by mu); nil if none
+	swap *ReporterSwap
+
+	// Counters of earlier runs loaded from the task store (guarded by mu); nil if none
+	restored *Counters
+
+	// Process state at Start, for resource attribution (guarded by mu)
+	resourceBase resourceBase
+
+	// Canary tracking of the start self-test; nil unless self_test.enabled
+	selfTest *selfTest
+
+	// OS tuning applied at capture start (capture.tuning), reverted at stop
+	tuner  *ostune.Tuner
+	tuning []ostune.Change // guarded by mu
+
 	// Context and cancellation
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
+// defaultStopTimeout bounds a graceful Stop when TaskConfig.StopTimeout is unset.
+const defaultStopTimeout = 30 * time.Second
+
 // NewTask creates a new task instance in Created state.
 // It does NOT start the task - call Start() to begin processing.
 func NewTask(cfg config.TaskConfig) *Task {
-	ctx, cancel := context.WithCancel(context.Background())
+	return NewTaskWithContext(context.Background(), cfg)
+}
+
+// NewTaskWithContext creates a new task whose context is a child of parent.
+// Cancelling parent force-stops the task's goroutines, but each task still
+// owns its own cancel func so tasks can be stopped independently.
+func NewTaskWithContext(parent context.Context, cfg config.TaskConfig) *Task {
+	ctx, cancel := context.WithCancel(parent)
 
 	numPipelines := cfg.Workers
 	if numPipelines < 1 {
@@ -121,9 +183,12 @@ func NewTask(cfg config.TaskConfig) *Task {
 		rawStreams:       rawStreams,
 		sendBuffer:       make(chan core.OutputPacket, sendCap),
 		doneCh:           make(chan struct{}),
+		targetsCh:        make(chan []*ReporterWrapper),
 		state:            StateCreated,
 		createdAt:        time.Now(),
 		dispatchStrategy: NewDispatchStrategy(cfg.Capture.DispatchStrategy),
+		Flags:            featureflag.New(cfg.Flags),
+		tuner:            ostune.Default,
 		ctx:              ctx,
 		cancel:           cancel,
 	}
@@ -176,6 +241,26 @@ func (t *Task) setState(s TaskState) {
 	metrics.TaskStatus.WithLabelValues(taskID, string(s)).Set(statusValue)
 }
 
+// fail moves the task to StateFailed for reason, categorized by err.
+// Must be called with t.mu held.
+func (t *Task) fail(reason string, err error) {
+	t.setState(StateFailed)
+	t.failureReason = reason
+	t.failureCat = core.CategoryOf(err)
+	if t.failureCat == "" {
+		t.failureCat = core.CategoryUnknown
+	}
+	// max_restarts bounds restarts in a row: a run that stayed up for
+	// stableRunDuration starts a new series.
+	if !t.startedAt.IsZero() && time.Since(t.startedAt) >= stableRunDuration {
+		t.restarts = 0
+	}
+}
+
+// stableRunDuration is how long a restarted task must run before its
+// restart count is reset.
+const stableRunDuration = 10 * time.Minute
+
 // Start starts the task and transitions it to Running state.
 // It starts all components in reverse dependency order:
 // Reporters → Sender → Pipelines → Capturers
@@ -192,6 +277,7 @@ func (t *Task) Start() error {
 
 	t.setState(StateStarting)
 	t.startedAt = time.Now()
+	t.resourceBase = currentResourceBase()
 
 	// Step 1: Start Reporters (data sinks)
 	startedReporters := 0
@@ -208,8 +294,7 @@ func (t *Task) Start() error {
 				}
 			}
 			rollbackCancel()
-			t.setState(StateFailed)
-			t.failureReason = fmt.Sprintf("reporter[%d] start failed: %v", i, err)
+			t.fail(fmt.Sprintf("reporter[%d] start failed: %v", i, err), err)
 			return fmt.Errorf("reporter[%d] start failed: %w", i, err)
 		}
 		startedReporters++
@@ -221,7 +306,11 @@ func (t *Task) Start() error {
 	}
 
 	// Step 3: Start Sender goroutine (consumes sendBuffer → all Wrappers)
-	go t.senderLoop()
+	if t.Config.SelfTest.Enabled {
+		t.selfTest = newSelfTest(len(t.Pipelines), t.Config.SelfTest.Deliver)
+	}
+	t.refreshAgentMetadata()
+	go t.senderLoop(t.ReporterWrappers)
 
 	// Step 3: Start Pipelines (processing chains)
 	for i, p := range t.Pipelines {
@@ -233,25 +322,47 @@ func (t *Task) Start() error {
 		}(i, p)
 	}
 
+	// Step 3b: Self-test: canaries must pass the pipelines before capture starts
+	if t.selfTest != nil {
+		if err := t.runSelfTest(); err != nil {
+			slog.Warn("task self-test failed", "task_id", t.Config.ID, "error", err)
+			t.abortStart()
+			t.fail(err.Error(), err)
+			return err
+		}
+	}
+
+	// Step 3c: OS tuning, before capture sockets are opened
+	if !t.Config.Capture.Tuning.IsZero() {
+		if err := t.applyTuning(); err != nil {
+			slog.Warn("capture tuning failed", "task_id", t.Config.ID, "error", err)
+			t.abortStart()
+			t.fail(err.Error(), err)
+			return err
+		}
+	}
+
 	// Step 4: Start Capturers (data sources)
 	if t.Config.Capture.DispatchMode == "binding" {
 		// Binding mode: each capturer writes directly to its pipeline's rawStream
-		for i, cap := range t.Capturers {
-			slog.Debug("starting capturer (binding)", "task_id", t.Config.ID, "capturer_id", i, "name", cap.Name())
+		for i, capturer := range t.Capturers {
+			slog.Debug("starting capturer (binding)", "task_id", t.Config.ID, "capturer_id", i, "name", capturer.Name())
 			t.captureWg.Add(1)
 			go func(c plugin.Capturer, stream chan<- core.RawPacket) {
 				defer t.captureWg.Done()
 				t.captureLoop(c, stream)
-			}(cap, t.rawStreams[i])
+			}(capturer, t.rawStreams[i])
 		}
 	} else {
-		// Dispatch mode: single capturer → dispatcher → rawStreams
-		slog.Debug("starting capturer (dispatch)", "task_id", t.Config.ID, "name", t.Capturers[0].Name())
-		t.captureWg.Add(1)
-		go func() {
-			defer t.captureWg.Done()
-			t.captureLoop(t.Capturers[0], t.captureCh)
-		}()
+		// Dispatch mode: capturer (plus extra captures) → dispatcher → rawStreams
+		for i, capturer := range t.Capturers {
+			slog.Debug("starting capturer (dispatch)", "task_id", t.Config.ID, "capturer_id", i, "name", capturer.Name())
+			t.captureWg.Add(1)
+			go func(c plugin.Capturer) {
+				defer t.captureWg.Done()
+				t.captureLoop(c, t.captureCh)
+			}(capturer)
+		}
 		go t.dispatchLoop()
 	}
 
@@ -269,10 +380,33 @@ func (t *Task) Start() error {
 	return nil
 }
 
-// Stop stops the task gracefully.
+// Stop stops the task gracefully, bounded by the task's stop timeout.
+// See StopContext for the shutdown sequence.
+func (t *Task) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), t.StopTimeout())
+	defer cancel()
+	return t.StopContext(ctx)
+}
+
+// StopTimeout returns the configured graceful stop deadline (default 30s).
+func (t *Task) StopTimeout() time.Duration {
+	if t.Config.StopTimeout != "" {
+		if d, err := time.ParseDuration(t.Config.StopTimeout); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultStopTimeout
+}
+
+// StopContext stops the task gracefully.
 // It stops components in forward dependency order:
 // Capturers → Pipelines (WaitGroup) → Sender → Reporters.Flush
-func (t *Task) Stop() error {
+//
+// If ctx expires before the sequence completes, the task context is cancelled
+// to force the remaining goroutines out, the task is marked Failed and an error
+// wrapping ctx.Err() is returned. The shutdown sequence keeps draining in the
+// background so resources are still released.
+func (t *Task) StopContext(ctx context.Context) error {
 	t.mu.Lock()
 
 	if t.state != StateRunning {
@@ -284,11 +418,45 @@ func (t *Task) Stop() error {
 	t.mu.Unlock()
 
 	slog.Info("stopping task", "task_id", t.Config.ID)
+	return t.runShutdown(ctx, stopFlushTimeout)
+}
 
+// runShutdown runs the shutdown sequence bounded by ctx. The caller has moved
+// the task to Stopping or Draining.
+func (t *Task) runShutdown(ctx context.Context, flushTimeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.shutdown(ctx, flushTimeout)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		// Deadline exceeded: force goroutines out via the task context.
+		t.cancel()
+
+		t.mu.Lock()
+		if t.state == StateStopping || t.state == StateDraining {
+			t.fail(fmt.Sprintf("stop did not complete: %v", ctx.Err()), ctx.Err())
+			t.stoppedAt = time.Now()
+		}
+		t.mu.Unlock()
+
+		slog.Error("task stop deadline exceeded, forced cancel", "task_id", t.Config.ID, "error", ctx.Err())
+		return fmt.Errorf("task %q stop: %w", t.Config.ID, ctx.Err())
+	}
+}
+
+// shutdown runs the ordered stop sequence. Reporter flush/stop is bounded by
+// ctx and by each reporter's flush_timeout, or flushTimeout if it sets none
+// and flushTimeout is non-zero.
+func (t *Task) shutdown(ctx context.Context, flushTimeout time.Duration) {
 	// Step 1: Signal all capturers to stop (cancel context).
-	for i, cap := range t.Capturers {
+	for i, capturer := range t.Capturers {
 		slog.Debug("stopping capturer", "task_id", t.Config.ID, "capturer_id", i)
-		if err := cap.Stop(t.ctx); err != nil {
+		if err := capturer.Stop(t.ctx); err != nil {
 			slog.Warn("capturer stop error", "task_id", t.Config.ID, "capturer_id", i, "error", err)
 		}
 	}
@@ -297,6 +465,7 @@ func (t *Task) Stop() error {
 	// output channels. Closing a rawStream while a captureLoop goroutine is
 	// still running would cause a send-on-closed-channel panic.
 	t.captureWg.Wait()
+	t.revertTuning()
 
 	// Step 2: Close input channels so pipelines drain and exit.
 	if t.Config.Capture.DispatchMode == "dispatch" {
@@ -323,26 +492,17 @@ func (t *Task) Stop() error {
 	t.cancel()
 
 	// Step 7: Flush and stop all reporters
-	flushCtx, flushCancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer flushCancel()
-
-	for i, rep := range t.Reporters {
-		slog.Debug("flushing reporter", "task_id", t.Config.ID, "reporter_id", i)
-		if err := rep.Flush(flushCtx); err != nil {
-			slog.Warn("reporter flush error", "task_id", t.Config.ID, "reporter_id", i, "error", err)
-		}
-		if err := rep.Stop(flushCtx); err != nil {
-			slog.Warn("reporter stop error", "task_id", t.Config.ID, "reporter_id", i, "error", err)
-		}
-	}
+	t.flushReporters(ctx, flushTimeout)
 
+	// A forced stop (deadline exceeded) has already marked the task Failed.
 	t.mu.Lock()
-	t.setState(StateStopped)
-	t.stoppedAt = time.Now()
+	if t.state == StateStopping || t.state == StateDraining {
+		t.setState(StateStopped)
+		t.stoppedAt = time.Now()
+	}
 	t.mu.Unlock()
 
 	slog.Info("task stopped", "task_id", t.Config.ID)
-	return nil
 }
 
 // Pause pauses the task by calling Pause() on all pausable plugins.
@@ -359,8 +519,8 @@ func (t *Task) Pause() error {
 	slog.Info("pausing task", "task_id", t.Config.ID)
 
 	// Pause capturers (stop packet ingestion first)
-	for i, cap := range t.Capturers {
-		if p, ok := cap.(plugin.Pausable); ok {
+	for i, capturer := range t.Capturers {
+		if p, ok := capturer.(plugin.Pausable); ok {
 			if err := p.Pause(); err != nil {
 				slog.Warn("capturer pause error", "task_id", t.Config.ID, "capturer_id", i, "error", err)
 			}
@@ -437,8 +597,8 @@ func (t *Task) Resume() error {
 	}
 
 	// Resume capturers last (start packet ingestion after everything is ready)
-	for i, cap := range t.Capturers {
-		if p, ok := cap.(plugin.Pausable); ok {
+	for i, capturer := range t.Capturers {
+		if p, ok := capturer.(plugin.Pausable); ok {
 			if err := p.Resume(); err != nil {
 				slog.Warn("capturer resume error", "task_id", t.Config.ID, "capturer_id", i, "error", err)
 			}
@@ -457,16 +617,16 @@ func (t *Task) Reconfigure(pluginConfigs map[string]map[string]any) error {
 		t.mu.RUnlock()
 		return fmt.Errorf("cannot reconfigure task in state %s", t.state)
 	}
-	t.mu.RUnlock()
 
 	slog.Info("reconfiguring task plugins", "task_id", t.Config.ID, "plugins", len(pluginConfigs))
 
 	var errs []error
 
-	// Reconfigure all plugin types
+	// Reconfigure all plugin types; the read lock keeps a reporter swap from
+	// changing Reporters while they are collected
 	allPlugins := make(map[string]plugin.Plugin)
-	for _, cap := range t.Capturers {
-		allPlugins[cap.Name()] = cap
+	for _, capturer := range t.Capturers {
+		allPlugins[capturer.Name()] = capturer
 	}
 	for _, rep := range t.Reporters {
 		allPlugins[rep.Name()] = rep
@@ -479,6 +639,7 @@ func (t *Task) Reconfigure(pluginConfigs map[string]map[string]any) error {
 			allPlugins[proc.Name()] = proc
 		}
 	}
+	t.mu.RUnlock()
 
 	for pluginName, cfg := range pluginConfigs {
 		p, ok := allPlugins[pluginName]
@@ -496,6 +657,10 @@ func (t *Task) Reconfigure(pluginConfigs map[string]map[string]any) error {
 			slog.Warn("plugin reconfigure failed", "task_id", t.Config.ID, "plugin", pluginName, "error", err)
 		} else {
 			slog.Info("plugin reconfigured", "task_id", t.Config.ID, "plugin", pluginName)
+			t.mu.Lock()
+			t.Config.SetPluginConfig(pluginName, cfg)
+			t.refreshAgentMetadata()
+			t.mu.Unlock()
 		}
 	}
 
@@ -505,15 +670,42 @@ func (t *Task) Reconfigure(pluginConfigs map[string]map[string]any) error {
 	return nil
 }
 
+// SetFragmentRateLimit changes the per-source-IP fragment rate limit of the
+// task's decoder. Only works on running or paused tasks with ip_reassembly.
+func (t *Task) SetFragmentRateLimit(cfg config.FragmentRateLimitConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("fragment_rate_limit: %w", err)
+	}
+	t.mu.RLock()
+	state := t.state
+	t.mu.RUnlock()
+	if state != StateRunning && state != StatePaused {
+		return fmt.Errorf("cannot reconfigure task in state %s", state)
+	}
+	if t.Decoder == nil {
+		return fmt.Errorf("fragment_rate_limit: task has no decoder")
+	}
+	if err := t.Decoder.SetFragmentRateLimit(cfg.MaxFragsPerIP, cfg.WindowDuration()); err != nil {
+		return fmt.Errorf("fragment_rate_limit: %w", err)
+	}
+	t.mu.Lock()
+	t.Config.Decoder.FragmentRateLimit = cfg
+	t.refreshAgentMetadata()
+	t.mu.Unlock()
+	slog.Info("fragment rate limit reconfigured", "task_id", t.Config.ID,
+		"max_frags_per_ip", cfg.MaxFragsPerIP, "window", cfg.Window)
+	return nil
+}
+
 // captureLoop runs a single capturer, writing packets to the given output channel.
-func (t *Task) captureLoop(cap plugin.Capturer, output chan<- core.RawPacket) {
-	if err := cap.Capture(t.ctx, output); err != nil {
+func (t *Task) captureLoop(capturer plugin.Capturer, output chan<- core.RawPacket) {
+	if err := capturer.Capture(t.ctx, output); err != nil {
 		if t.ctx.Err() == nil {
 			// Only log error if context wasn't cancelled
-			slog.Error("capturer error", "task_id", t.Config.ID, "error", err)
+			slog.Error("capturer error", "task_id", t.Config.ID, "error", err,
+				"category", core.CategoryOf(err))
 			t.mu.Lock()
-			t.setState(StateFailed)
-			t.failureReason = fmt.Sprintf("capturer error: %v", err)
+			t.fail(fmt.Sprintf("capturer error: %v", err), err)
 			t.mu.Unlock()
 		}
 	}
@@ -556,7 +748,10 @@ func (t *Task) dispatchLoop() {
 }
 
 // flowHash computes a hash from a RawPacket's IP 5-tuple for flow-affine distribution.
-// It extracts (srcIP, dstIP, srcPort, dstPort, proto) from the raw Ethernet frame.
+// It extracts (srcIP, dstIP, srcPort, dstPort, proto) from the raw Ethernet frame,
+// behind any stack of VLAN tags (802.1Q, 802.1ad QinQ) and IPv6 extension headers.
+// Fragments hash without ports, so all fragments of a datagram reach the same
+// pipeline for reassembly.
 // Falls back to hashing raw bytes if the frame cannot be parsed.
 func flowHash(pkt core.RawPacket) uint32 {
 	h := fnv.New32a()
@@ -571,14 +766,38 @@ func flowHash(pkt core.RawPacket) uint32 {
 	etherType := binary.BigEndian.Uint16(data[12:14])
 	ipStart := 14
 
-	// Handle 802.1Q VLAN tagging
-	if etherType == 0x8100 {
-		if len(data) < 18 {
+	// Handle VLAN tags: 802.1Q, 802.1ad and the legacy 0x9100 QinQ
+	for etherType == 0x8100 || etherType == 0x88A8 || etherType == 0x9100 {
+		if len(data) < ipStart+4 {
 			h.Write(data)
 			return h.Sum32()
 		}
-		etherType = binary.BigEndian.Uint16(data[16:18])
-		ipStart = 18
+		etherType = binary.BigEndian.Uint16(data[ipStart+2 : ipStart+4])
+		ipStart += 4
+	}
+
+	// Skip MPLS labels down to the bottom of the stack; the payload is IP
+	// if its version nibble says so
+	if etherType == 0x8847 || etherType == 0x8848 {
+		for {
+			if len(data) < ipStart+4 {
+				h.Write(data)
+				return h.Sum32()
+			}
+			bottom := data[ipStart+2]&0x01 != 0
+			ipStart += 4
+			if bottom {
+				break
+			}
+		}
+		if len(data) > ipStart {
+			switch data[ipStart] >> 4 {
+			case 4:
+				etherType = 0x0800
+			case 6:
+				etherType = 0x86DD
+			}
+		}
 	}
 
 	var proto byte
@@ -600,30 +819,29 @@ func flowHash(pkt core.RawPacket) uint32 {
 		h.Write(ipHdr[16:20]) // dst IP
 		h.Write([]byte{proto})
 
-		// Extract transport ports (TCP=6, UDP=17, SCTP=132)
-		transHdr := ipHdr[ihl:]
-		if (proto == 6 || proto == 17 || proto == 132) && len(transHdr) >= 4 {
-			h.Write(transHdr[0:2]) // src port
-			h.Write(transHdr[2:4]) // dst port
+		// Fragments (MF set or non-zero offset) carry no ports past the first
+		if binary.BigEndian.Uint16(ipHdr[6:8])&0x3FFF != 0 {
+			break
 		}
 
+		// Extract transport ports (TCP=6, UDP=17, SCTP=132)
+		writePorts(h, proto, ipHdr[ihl:])
+
 	case 0x86DD: // IPv6
 		ipHdr := data[ipStart:]
 		if len(ipHdr) < 40 {
 			h.Write(data)
 			return h.Sum32()
 		}
-		proto = ipHdr[6]      // next header
 		h.Write(ipHdr[8:24])  // src IP (16 bytes)
 		h.Write(ipHdr[24:40]) // dst IP (16 bytes)
-		h.Write([]byte{proto})
 
-		// Extract transport ports
-		transHdr := ipHdr[40:]
-		if (proto == 6 || proto == 17 || proto == 132) && len(transHdr) >= 4 {
-			h.Write(transHdr[0:2]) // src port
-			h.Write(transHdr[2:4]) // dst port
+		proto, transHdr, fragment := skipIPv6Extensions(ipHdr[6], ipHdr[40:])
+		h.Write([]byte{proto})
+		if fragment {
+			break
 		}
+		writePorts(h, proto, transHdr)
 
 	default:
 		// Non-IP frame: hash raw bytes
@@ -637,27 +855,88 @@ func flowHash(pkt core.RawPacket) uint32 {
 	return h.Sum32()
 }
 
+// writePorts hashes the source and destination ports of TCP, UDP and SCTP.
+func writePorts(h hash.Hash32, proto byte, transHdr []byte) {
+	if (proto == 6 || proto == 17 || proto == 132) && len(transHdr) >= 4 {
+		h.Write(transHdr[0:2]) // src port
+		h.Write(transHdr[2:4]) // dst port
+	}
+}
+
+// skipIPv6Extensions walks the IPv6 extension header chain starting at next
+// header nh. It returns the upper-layer protocol, its header, and whether the
+// packet is a fragment. A truncated chain yields the last header reached.
+func skipIPv6Extensions(nh byte, payload []byte) (byte, []byte, bool) {
+	for {
+		switch nh {
+		case 0, 43, 60: // hop-by-hop, routing, destination options
+			if len(payload) < 8 {
+				return nh, nil, false
+			}
+			n := (int(payload[1]) + 1) * 8
+			if len(payload) < n {
+				return nh, nil, false
+			}
+			nh, payload = payload[0], payload[n:]
+		case 44: // fragment
+			if len(payload) < 8 {
+				return nh, nil, true
+			}
+			return payload[0], payload[8:], true
+		default:
+			return nh, payload, false
+		}
+	}
+}
+
 // senderLoop consumes OutputPackets from sendBuffer and distributes them to ReporterWrappers.
 // If no wrappers are configured, falls back to direct Reporter.Report() calls.
-// It runs until sendBuffer is closed.
-func (t *Task) senderLoop() {
+// It runs until sendBuffer is closed. targets is the initial wrapper set; a
+// reporter swap replaces it through targetsCh.
+func (t *Task) senderLoop(targets []*ReporterWrapper) {
 	defer close(t.doneCh)
 
-	if len(t.ReporterWrappers) > 0 {
-		// Batched path: distribute to wrappers
+	if t.Analyzer != nil {
+		// analyze_only: count instead of reporting
 		for pkt := range t.sendBuffer {
-			p := pkt // copy for pointer safety
-			for _, w := range t.ReporterWrappers {
-				w.Send(&p)
+			if t.selfTest != nil && t.selfTest.observe(&pkt) {
+				continue
+			}
+			t.Analyzer.Observe(&pkt)
+		}
+	} else if len(targets) > 0 {
+		// Batched path: distribute to wrappers. The wrapper set only changes
+		// here, between packets, so a wrapper removed by a reporter swap is
+		// never sent to after the swap closes it.
+	loop:
+		for {
+			select {
+			case pkt, ok := <-t.sendBuffer:
+				if !ok {
+					break loop
+				}
+				if t.selfTest != nil && t.selfTest.observe(&pkt) {
+					continue
+				}
+				p := pkt // copy for pointer safety
+				stampAgentMetadata(&p, t.agentMetadata())
+				for _, w := range targets {
+					w.Send(&p)
+				}
+			case targets = <-t.targetsCh:
 			}
 		}
 		// sendBuffer closed — close all wrapper channels and wait for flush
-		for _, w := range t.ReporterWrappers {
+		for _, w := range targets {
 			w.Close()
 		}
 	} else {
 		// Legacy path: direct Reporter.Report() calls (no wrappers)
 		for pkt := range t.sendBuffer {
+			if t.selfTest != nil && t.selfTest.observe(&pkt) {
+				continue
+			}
+			stampAgentMetadata(&pkt, t.agentMetadata())
 			for i, rep := range t.Reporters {
 				if err := rep.Report(t.ctx, &pkt); err != nil {
 					slog.Warn("reporter error", "task_id", t.Config.ID, "reporter_id", i, "error", err)
@@ -677,8 +956,18 @@ type Status struct {
 	StartedAt     time.Time `json:"started_at,omitempty"`
 	StoppedAt     time.Time `json:"stopped_at,omitempty"`
 	FailureReason string    `json:"failure_reason,omitempty"`
-	Uptime        string    `json:"uptime,omitempty"`
-	PipelineCount int       `json:"pipeline_count"`
+	// FailureCategory classifies FailureReason: transient | config | fatal | unknown
+	FailureCategory core.ErrorCategory `json:"failure_category,omitempty"`
+	Restarts        int                `json:"restarts,omitempty"` // restarts after transient failures
+	Uptime          string             `json:"uptime,omitempty"`
+	DrainDuration   string             `json:"drain_duration,omitempty"` // of the last task_drain
+	PipelineCount   int                `json:"pipeline_count"`
+
+	Analysis     *analyze.Summary `json:"analysis,omitempty"`      // analyze_only tasks only
+	ReporterSwap *ReporterSwap    `json:"reporter_swap,omitempty"` // current or last reporter swap
+	Tuning       []ostune.Change  `json:"tuning,omitempty"`        // OS tuning in effect
+	Flags        map[string]bool  `json:"flags"`                   // runtime feature flags
+	Flush        []FlushResult    `json:"flush,omitempty"`         // final reporter flush, once stopped
 }
 
 // GetStatus returns current task status.
@@ -687,13 +976,38 @@ func (t *Task) GetStatus() Status {
 	defer t.mu.RUnlock()
 
 	status := Status{
-		ID:            t.Config.ID,
-		State:         t.state,
-		CreatedAt:     t.createdAt,
-		StartedAt:     t.startedAt,
-		StoppedAt:     t.stoppedAt,
-		FailureReason: t.failureReason,
-		PipelineCount: len(t.Pipelines),
+		ID:              t.Config.ID,
+		State:           t.state,
+		CreatedAt:       t.createdAt,
+		StartedAt:       t.startedAt,
+		StoppedAt:       t.stoppedAt,
+		FailureReason:   t.failureReason,
+		FailureCategory: t.failureCat,
+		Restarts:        t.restarts,
+		PipelineCount:   len(t.Pipelines),
+		Flags:           t.Flags.Snapshot(),
+	}
+
+	if t.Analyzer != nil {
+		summary := t.Analyzer.Snapshot()
+		status.Analysis = &summary
+	}
+
+	if t.swap != nil {
+		swap := *t.swap
+		status.ReporterSwap = &swap
+	}
+
+	if t.drainDuration > 0 {
+		status.DrainDuration = t.drainDuration.String()
+	}
+
+	if len(t.flush) > 0 {
+		status.Flush = append([]FlushResult(nil), t.flush...)
+	}
+
+	if len(t.tuning) > 0 {
+		status.Tuning = append([]ostune.Change(nil), t.tuning...)
 	}
 
 	if t.state == StateRunning && !t.startedAt.IsZero() {
@@ -703,6 +1017,159 @@ func (t *Task) GetStatus() Status {
 	return status
 }
 
+// CaptureStats returns capture counters summed across all capturers.
+func (t *Task) CaptureStats() plugin.CaptureStats {
+	var total plugin.CaptureStats
+	for _, capturer := range t.Capturers {
+		s := capturer.Stats()
+		total.PacketsReceived += s.PacketsReceived
+		total.PacketsDropped += s.PacketsDropped
+		total.PacketsIfDropped += s.PacketsIfDropped
+		total.PacketsPrefiltered += s.PacketsPrefiltered
+	}
+	return total
+}
+
+// CapturerStats are the counters of one capturer.
+type CapturerStats struct {
+	Name             string `json:"name"`
+	Interface        string `json:"interface"`
+	PacketsReceived  uint64 `json:"packets_received"`
+	PacketsDropped   uint64 `json:"packets_dropped"`
+	PacketsIfDropped uint64 `json:"packets_if_dropped"`
+
+	PacketsPrefiltered uint64 `json:"packets_prefiltered,omitempty"`
+}
+
+// CapturerStatsList returns the counters of each capturer: the main capture
+// first, then extra captures in configuration order.
+func (t *Task) CapturerStatsList() []CapturerStats {
+	list := make([]CapturerStats, len(t.Capturers))
+	for i, capturer := range t.Capturers {
+		stats := capturer.Stats()
+		list[i] = CapturerStats{
+			Name:             capturer.Name(),
+			Interface:        t.capturerInterface(i),
+			PacketsReceived:  stats.PacketsReceived,
+			PacketsDropped:   stats.PacketsDropped,
+			PacketsIfDropped: stats.PacketsIfDropped,
+
+			PacketsPrefiltered: stats.PacketsPrefiltered,
+		}
+	}
+	return list
+}
+
+// capturerInterface returns the interface of capturer i. Extra captures
+// follow the main capturer, which is alone in dispatch mode.
+func (t *Task) capturerInterface(i int) string {
+	if n := len(t.Config.ExtraCaptures); n > 0 && i > 0 && i <= n {
+		return t.Config.ExtraCaptures[i-1].Interface
+	}
+	return t.Config.Capture.Interface
+}
+
+// PipelineStats returns pipeline counters summed across all pipelines.
+func (t *Task) PipelineStats() pipeline.Stats {
+	var total pipeline.Stats
+	for _, pl := range t.Pipelines {
+		total.Add(pl.Stats())
+	}
+	return total
+}
+
+// ReporterErrorStreak returns the reporter with the longest run of consecutive
+// failed batches and the length of that run (0 when all reporters are healthy).
+func (t *Task) ReporterErrorStreak() (string, int64) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var name string
+	var worst int64
+	for _, w := range t.ReporterWrappers {
+		if w.Shadow() {
+			continue // shadow failures are metrics only
+		}
+		if s := w.ErrorStreak(); s > worst {
+			name, worst = w.Name(), s
+		}
+	}
+	return name, worst
+}
+
+// PluginHealth is a plugin of a running task that implements
+// plugin.HealthChecker.
+type PluginHealth struct {
+	Name    string // "capturer/<name>@<interface>" or "reporter/<name>"
+	Checker plugin.HealthChecker
+}
+
+// HealthCheckers returns the capturers and reporters of a running or paused
+// task that implement plugin.HealthChecker, for the self-audit. Binding-mode
+// capturers sharing an interface are listed once.
+func (t *Task) HealthCheckers() []PluginHealth {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.state != StateRunning && t.state != StatePaused {
+		return nil
+	}
+	var out []PluginHealth
+	seen := make(map[string]bool)
+	add := func(name string, p any) {
+		if hc, ok := p.(plugin.HealthChecker); ok && !seen[name] {
+			seen[name] = true
+			out = append(out, PluginHealth{Name: name, Checker: hc})
+		}
+	}
+	for i, capturer := range t.Capturers {
+		add("capturer/"+capturer.Name()+"@"+t.capturerInterface(i), capturer)
+	}
+	for _, rep := range t.Reporters {
+		add("reporter/"+rep.Name(), rep)
+	}
+	return out
+}
+
+// ReporterCertificates returns the CA bundles and client certificates named
+// in the tls settings of the task's reporters, each once.
+func (t *Task) ReporterCertificates() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var paths []string
+	for _, rc := range t.Config.Reporters {
+		tlsMap, _ := rc.Config["tls"].(map[string]any)
+		conn := tlspolicy.ParseConn(tlsMap)
+		for _, path := range []string{conn.CACert, conn.ClientCert} {
+			if path != "" && !slices.Contains(paths, path) {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+// Emit injects an out-of-band packet (e.g. an alert event) into the task's
+// send buffer so it reaches all reporters. It never blocks and returns false
+// if the task is not running or the buffer is full.
+func (t *Task) Emit(pkt core.OutputPacket) bool {
+	// Holding the read lock keeps Stop from closing sendBuffer underneath us:
+	// Stop must take the write lock to leave StateRunning first.
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.state != StateRunning && t.state != StatePaused {
+		return false
+	}
+	select {
+	case t.sendBuffer <- pkt:
+		return true
+	default:
+		return false
+	}
+}
+
 // ID returns the task ID.
 func (t *Task) ID() string {
 	return t.Config.ID
@@ -730,19 +1197,28 @@ func (t *Task) UpdateMetricsInterval(d time.Duration) {
 // Uses per-capturer tracking to correctly compute deltas in binding mode (multiple capturers).
 func (t *Task) statsCollectorLoop() {
 	interval := t.getMetricsInterval()
+	t.publishFlags()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	// Per-capturer last-seen counters to avoid cross-capturer delta contamination.
 	type capStats struct {
-		packetsReceived uint64
-		packetsDropped  uint64
+		packetsReceived    uint64
+		packetsDropped     uint64
+		packetsPrefiltered uint64
 	}
 	lastStats := make([]capStats, len(t.Capturers))
+	var lastResources Resources
+	var lastFallbacks uint64
 
 	for {
 		select {
 		case <-t.ctx.Done():
+			if t.TopK != nil {
+				metrics.TopKPackets.DeletePartialMatch(prometheus.Labels{"task": t.Config.ID})
+			}
+			metrics.FeatureFlagEnabled.DeletePartialMatch(prometheus.Labels{"task": t.Config.ID})
+			metrics.AuditDegraded.DeletePartialMatch(prometheus.Labels{"task": t.Config.ID})
 			return
 		case <-ticker.C:
 			// Check if interval was updated (hot-reload)
@@ -751,8 +1227,8 @@ func (t *Task) statsCollectorLoop() {
 				ticker.Reset(interval)
 				slog.Info("metrics collect interval updated", "task_id", t.Config.ID, "interval", interval)
 			}
-			for i, cap := range t.Capturers {
-				stats := cap.Stats()
+			for i, capturer := range t.Capturers {
+				stats := capturer.Stats()
 
 				// Calculate per-capturer deltas with underflow protection
 				deltaReceived := stats.PacketsReceived - lastStats[i].packetsReceived
@@ -767,10 +1243,9 @@ func (t *Task) statsCollectorLoop() {
 				}
 
 				if deltaReceived > 0 {
-					ifaceName, _ := t.Config.Capture.Config["interface"].(string)
 					metrics.CapturePacketsTotal.WithLabelValues(
 						t.Config.ID,
-						ifaceName,
+						t.capturerInterface(i),
 					).Add(float64(deltaReceived))
 				}
 
@@ -781,10 +1256,22 @@ func (t *Task) statsCollectorLoop() {
 					).Add(float64(deltaDropped))
 				}
 
+				deltaPrefiltered := stats.PacketsPrefiltered - lastStats[i].packetsPrefiltered
+				if stats.PacketsPrefiltered < lastStats[i].packetsPrefiltered {
+					deltaPrefiltered = stats.PacketsPrefiltered
+				}
+				if deltaPrefiltered > 0 {
+					metrics.CaptureDropsTotal.WithLabelValues(
+						t.Config.ID,
+						"prefilter",
+					).Add(float64(deltaPrefiltered))
+				}
+
 				// Update per-capturer tracking
 				lastStats[i] = capStats{
-					packetsReceived: stats.PacketsReceived,
-					packetsDropped:  stats.PacketsDropped,
+					packetsReceived:    stats.PacketsReceived,
+					packetsDropped:     stats.PacketsDropped,
+					packetsPrefiltered: stats.PacketsPrefiltered,
 				}
 
 				slog.Debug("capturer stats collected",
@@ -796,9 +1283,34 @@ func (t *Task) statsCollectorLoop() {
 					"delta_dropped", deltaDropped)
 			}
 
+			if t.Decoder != nil {
+				fallbacks := t.Decoder.Fallbacks()
+				if fallbacks > lastFallbacks {
+					metrics.DecoderFallbackTotal.WithLabelValues(t.Config.ID).Add(float64(fallbacks - lastFallbacks))
+				}
+				lastFallbacks = fallbacks
+			}
+
 			// Update flow registry size gauge
 			metrics.FlowRegistrySize.WithLabelValues(t.Config.ID).
 				Set(float64(t.Registry.Count()))
+
+			lastResources = t.updateResourceMetrics(lastResources)
+
+			if t.TopK != nil {
+				t.updateTopKMetrics()
+			}
+		}
+	}
+}
+
+// updateTopKMetrics replaces the task's otus_topk_packets series with the
+// current heavy hitters, so values that dropped out of the top k disappear.
+func (t *Task) updateTopKMetrics() {
+	metrics.TopKPackets.DeletePartialMatch(prometheus.Labels{"task": t.Config.ID})
+	for key, items := range t.TopK.Snapshot(false).Keys {
+		for _, item := range items {
+			metrics.TopKPackets.WithLabelValues(t.Config.ID, key, item.Value).Set(float64(item.Count))
 		}
 	}
 }
@@ -1,10 +1,15 @@
 package task
 
 import (
+	"context"
+	"net/netip"
 	"testing"
 
+	"firestige.xyz/otus/internal/analyze"
 	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/core/decoder"
+	"firestige.xyz/otus/internal/pipeline"
 )
 
 func TestTaskStateTransitions(t *testing.T) {
@@ -262,4 +267,161 @@ func TestFlowHash(t *testing.T) {
 			t.Error("VLAN tagged packet should produce a non-zero hash")
 		}
 	})
+
+	t.Run("QinQ tagged frame hashes like untagged", func(t *testing.T) {
+		plain := buildIPv4UDP([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 5060, 5060)
+		tagged := append([]byte(nil), plain.Data[:12]...)
+		tagged = append(tagged, 0x88, 0xA8, 0x00, 0x64, 0x81, 0x00, 0x00, 0x0A) // S-tag 100, C-tag 10
+		tagged = append(tagged, plain.Data[12:]...)
+		if flowHash(plain) != flowHash(core.RawPacket{Data: tagged}) {
+			t.Error("QinQ tags should not change the flow hash")
+		}
+	})
+
+	t.Run("MPLS labeled frame hashes like unlabeled", func(t *testing.T) {
+		plain := buildIPv4UDP([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 5060, 5060)
+		labeled := append([]byte(nil), plain.Data[:12]...)
+		labeled = append(labeled, 0x81, 0x00, 0x00, 0x0A) // C-tag 10
+		labeled = append(labeled, 0x88, 0x47)
+		labeled = append(labeled, 0x00, 0x3E, 0x80, 0x40, 0x00, 0x7D, 0x01, 0x40) // labels 1000, 2000 (bottom)
+		labeled = append(labeled, plain.Data[14:]...)
+		if flowHash(plain) != flowHash(core.RawPacket{Data: labeled}) {
+			t.Error("VLAN tags and MPLS labels should not change the flow hash")
+		}
+
+		// Per-packet fields (IP ID) must not leak into the hash
+		other := append([]byte(nil), labeled...)
+		other[len(labeled)-len(plain.Data)+14+4] = 0x12
+		if flowHash(core.RawPacket{Data: labeled}) != flowHash(core.RawPacket{Data: other}) {
+			t.Error("packets of one MPLS flow should produce identical hash")
+		}
+	})
+
+	t.Run("IPv4 fragments hash together", func(t *testing.T) {
+		first := buildIPv4UDP([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 5060, 5060)
+		first.Data[20] = 0x20 // MF
+		later := buildIPv4UDP([4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}, 0, 0)
+		later.Data[21] = 0xB9 // offset 185 × 8 bytes, no ports
+		if flowHash(first) != flowHash(later) {
+			t.Error("fragments of one datagram should produce identical hash")
+		}
+	})
+}
+
+// buildIPv6UDP builds an IPv6/UDP Ethernet frame with optional extension
+// headers (each given as its next-header value and body, 8-byte aligned).
+func buildIPv6UDP(src, dst string, srcPort, dstPort uint16, ext ...[]byte) core.RawPacket {
+	frame := make([]byte, 14+40)
+	frame[12] = 0x86 // ethertype = IPv6
+	frame[13] = 0xDD
+	frame[14] = 0x60 // version=6
+	copy(frame[22:38], netip.MustParseAddr(src).AsSlice())
+	copy(frame[38:54], netip.MustParseAddr(dst).AsSlice())
+
+	nh := 20 // offset of the next header field to fill
+	for _, e := range ext {
+		frame[nh] = e[0]
+		nh = len(frame)
+		frame = append(frame, e[1:]...)
+	}
+	frame[nh] = 17 // UDP
+	frame = append(frame, byte(srcPort>>8), byte(srcPort), byte(dstPort>>8), byte(dstPort), 0, 8, 0, 0)
+	return core.RawPacket{Data: frame}
+}
+
+func TestFlowHash_IPv6(t *testing.T) {
+	hopByHop := []byte{0, 0, 0, 1, 4, 0, 0, 0, 0} // PadN
+	destOpts := []byte{60, 0, 1, 1, 12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	fragment := func(offset uint16, more bool) []byte {
+		fo := offset << 3
+		if more {
+			fo |= 1
+		}
+		return []byte{44, 0, 0, byte(fo >> 8), byte(fo), 0, 0, 0x12, 0x34}
+	}
+
+	t.Run("ports distinguish flows", func(t *testing.T) {
+		a := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5060, 5060)
+		b := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5061, 5060)
+		if flowHash(a) == flowHash(b) {
+			t.Error("different src ports should (very likely) produce different hash")
+		}
+	})
+
+	t.Run("extension headers are skipped", func(t *testing.T) {
+		plain := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5060, 5060)
+		ext := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5060, 5060, hopByHop, destOpts)
+		if flowHash(plain) != flowHash(ext) {
+			t.Error("extension headers should not change the flow hash")
+		}
+		other := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5062, 5060, hopByHop, destOpts)
+		if flowHash(ext) == flowHash(other) {
+			t.Error("ports behind extension headers should be hashed")
+		}
+	})
+
+	t.Run("fragments hash together", func(t *testing.T) {
+		first := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5060, 5060, fragment(0, true))
+		later := buildIPv6UDP("2001:db8::1", "2001:db8::2", 0, 0, fragment(185, false))
+		if flowHash(first) != flowHash(later) {
+			t.Error("fragments of one datagram should produce identical hash")
+		}
+	})
+
+	t.Run("truncated extension chain falls back", func(t *testing.T) {
+		pkt := buildIPv6UDP("2001:db8::1", "2001:db8::2", 5060, 5060, hopByHop)
+		pkt.Data = pkt.Data[:14+40+4]
+		_ = flowHash(pkt) // must not panic
+	})
+}
+
+func TestTaskPipelineStats(t *testing.T) {
+	task := NewTask(config.TaskConfig{ID: "test-task-stats", Workers: 2})
+
+	for i := 0; i < 2; i++ {
+		p := pipeline.New(pipeline.Config{
+			ID:      i,
+			TaskID:  task.Config.ID,
+			Decoder: decoder.NewStandardDecoder(decoder.Config{}),
+		})
+		task.Pipelines = append(task.Pipelines, p)
+
+		// Truncated frames fail to decode; Run returns once input is drained.
+		input := make(chan core.RawPacket, i+1)
+		for j := 0; j <= i; j++ {
+			input <- core.RawPacket{Data: []byte{0x00}}
+		}
+		close(input)
+		p.Run(context.Background(), input, make(chan core.OutputPacket, 1))
+	}
+
+	stats := task.PipelineStats()
+	if stats.Received != 3 {
+		t.Errorf("Received = %d, want 3", stats.Received)
+	}
+	if stats.DecodeErrors != 3 {
+		t.Errorf("DecodeErrors = %d, want 3", stats.DecodeErrors)
+	}
+}
+
+func TestTaskAnalyzeOnly(t *testing.T) {
+	task := NewTask(config.TaskConfig{ID: "test-task-analyze", Mode: config.TaskModeAnalyzeOnly})
+	task.Analyzer = analyze.NewCounter([]string{core.LabelSIPMethod}, 0)
+
+	go task.senderLoop(nil)
+	task.sendBuffer <- core.OutputPacket{PayloadType: "sip", Labels: core.Labels{core.LabelSIPMethod: "INVITE"}}
+	task.sendBuffer <- core.OutputPacket{PayloadType: "rtp"}
+	close(task.sendBuffer)
+	<-task.doneCh
+
+	status := task.GetStatus()
+	if status.Analysis == nil {
+		t.Fatal("expected analysis in status of analyze_only task")
+	}
+	if status.Analysis.Packets != 2 || status.Analysis.Protocols["sip"] != 1 {
+		t.Errorf("unexpected analysis: %+v", status.Analysis)
+	}
+	if got := status.Analysis.Labels[core.LabelSIPMethod]["INVITE"]; got != 1 {
+		t.Errorf("INVITE count = %d, want 1", got)
+	}
 }
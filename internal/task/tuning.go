@@ -0,0 +1,47 @@
+package task
+
+import (
+	"fmt"
+	"log/slog"
+
+	"firestige.xyz/otus/internal/ostune"
+)
+
+// applyTuning applies capture.tuning and records the changes for task
+// status. The caller holds t.mu.
+func (t *Task) applyTuning() error {
+	tc := t.Config.Capture.Tuning
+	changes, err := t.tuner.Apply(ostune.Settings{
+		Interface:        t.Config.Capture.Interface,
+		BusyPollUS:       tc.BusyPollUS,
+		RmemMax:          tc.RmemMax,
+		RmemDefault:      tc.RmemDefault,
+		NetdevMaxBacklog: tc.NetdevMaxBacklog,
+		RPSCPUs:          tc.RPSCPUs,
+	})
+	if err != nil {
+		return fmt.Errorf("capture tuning: %w", err)
+	}
+	for _, c := range changes {
+		slog.Info("capture tuning applied", "task_id", t.Config.ID, "path", c.Path, "old", c.Old, "new", c.New)
+	}
+	t.tuning = changes
+	return nil
+}
+
+// revertTuning restores what applyTuning changed, once capture has stopped.
+func (t *Task) revertTuning() {
+	t.mu.Lock()
+	changes := t.tuning
+	t.tuning = nil
+	t.mu.Unlock()
+
+	if len(changes) == 0 {
+		return
+	}
+	if err := t.tuner.Revert(changes); err != nil {
+		slog.Warn("capture tuning revert failed", "task_id", t.Config.ID, "error", err)
+		return
+	}
+	slog.Info("capture tuning reverted", "task_id", t.Config.ID, "changes", len(changes))
+}
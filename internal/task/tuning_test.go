@@ -0,0 +1,63 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/config"
+	"firestige.xyz/otus/internal/ostune"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+func TestTask_TuningAppliedAndReverted(t *testing.T) {
+	root := t.TempDir()
+	sysctl := filepath.Join(root, "sys", "net", "core", "busy_poll")
+	if err := os.MkdirAll(filepath.Dir(sysctl), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"busy_poll", "busy_read"} {
+		if err := os.WriteFile(filepath.Join(filepath.Dir(sysctl), name), []byte("0\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	task := newTestTask([]plugin.Reporter{&mockReporter{name: "r0"}}, []plugin.Capturer{&mockCapturer{name: "cap0"}})
+	task.Config.Capture.Tuning = config.TuningConfig{BusyPollUS: 50}
+	task.tuner = &ostune.Tuner{ProcRoot: root}
+
+	if err := task.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	if got := task.GetStatus().Tuning; len(got) != 2 || got[0].New != "50" {
+		t.Errorf("status tuning = %+v, want busy_poll and busy_read set to 50", got)
+	}
+	if data, _ := os.ReadFile(sysctl); strings.TrimSpace(string(data)) != "50" {
+		t.Errorf("busy_poll = %q while running, want 50", data)
+	}
+
+	if err := task.Stop(); err != nil {
+		t.Fatalf("Stop() error: %v", err)
+	}
+	if data, _ := os.ReadFile(sysctl); strings.TrimSpace(string(data)) != "0" {
+		t.Errorf("busy_poll = %q after stop, want 0", data)
+	}
+	if got := task.GetStatus().Tuning; got != nil {
+		t.Errorf("status tuning = %+v after stop, want none", got)
+	}
+}
+
+func TestTask_TuningFailureFailsStart(t *testing.T) {
+	task := newTestTask([]plugin.Reporter{&mockReporter{name: "r0"}}, []plugin.Capturer{&mockCapturer{name: "cap0"}})
+	task.Config.Capture.Tuning = config.TuningConfig{RmemMax: 1 << 24}
+	task.tuner = &ostune.Tuner{ProcRoot: t.TempDir()} // no sysctls
+
+	err := task.Start()
+	if err == nil || !strings.Contains(err.Error(), "capture tuning") {
+		t.Fatalf("Start() error = %v, want capture tuning failure", err)
+	}
+	if got := task.State(); got != StateFailed {
+		t.Errorf("state = %s, want failed", got)
+	}
+}
@@ -0,0 +1,198 @@
+// Package tcpanalysis labels TCP segments for troubleshooting signaling over
+// TCP: their flags, retransmissions and out-of-order segments, and the
+// handshake round-trip time.
+//
+// There is no stream reassembly; each direction of a connection tracks the
+// next expected sequence number and the last gap in it. A segment below the
+// next sequence number that fills the gap arrived out of order, any other one
+// is a retransmission. Segment lengths come from the captured payload, so
+// truncated captures (snap_len) under-count them.
+package tcpanalysis
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/tcpconn"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults for Tracker limits left unset.
+const (
+	DefaultMaxConns    = 100000
+	DefaultIdleTimeout = 5 * time.Minute
+)
+
+// Segment events counted in otus_tcp_segments_total.
+const (
+	EventRetransmission = "retransmission"
+	EventOutOfOrder     = "out_of_order"
+)
+
+// flagNames orders tcp.flags values, e.g. "SYN,ACK".
+var flagNames = []struct {
+	bit  uint8
+	name string
+}{
+	{tcpconn.FlagSYN, "SYN"}, {tcpconn.FlagFIN, "FIN"}, {tcpconn.FlagRST, "RST"},
+	{tcpconn.FlagPSH, "PSH"}, {tcpconn.FlagACK, "ACK"}, {tcpconn.FlagURG, "URG"},
+}
+
+// direction is the sequence state of one direction of a connection.
+type direction struct {
+	started  bool
+	next     uint32 // next expected sequence number
+	hole     bool   // a gap [holeFrom, holeTo) is outstanding
+	holeFrom uint32
+	holeTo   uint32
+}
+
+type conn struct {
+	dirs   [2]direction // [0] is sent by key.A
+	synAt  time.Time    // last SYN without ACK, zero once the RTT is taken
+	synDir int
+}
+
+// Tracker holds the TCP connections of one task. It is shared by the task's
+// pipelines and safe for concurrent use.
+type Tracker struct {
+	retransmissions, outOfOrder prometheus.Counter
+	handshakeRTT                prometheus.Observer
+
+	mu    sync.Mutex
+	conns *idletable.Table[tcpconn.Key, conn]
+}
+
+// NewTracker creates a tracker for a task. Zero limits use the defaults.
+func NewTracker(taskID string, maxConns int, idleTimeout time.Duration) *Tracker {
+	if maxConns <= 0 {
+		maxConns = DefaultMaxConns
+	}
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleTimeout
+	}
+	return &Tracker{
+		retransmissions: metrics.TCPSegmentsTotal.WithLabelValues(taskID, EventRetransmission),
+		outOfOrder:      metrics.TCPSegmentsTotal.WithLabelValues(taskID, EventOutOfOrder),
+		handshakeRTT:    metrics.TCPHandshakeRTTSeconds.WithLabelValues(taskID),
+		conns:           tcpconn.NewTable[conn](maxConns, idleTimeout),
+	}
+}
+
+// Observe labels a decoded TCP packet. Non-TCP packets are ignored.
+func (t *Tracker) Observe(d *core.DecodedPacket, labels core.Labels) {
+	tr := &d.Transport
+	if tr.Protocol != 6 {
+		return
+	}
+	flags := tr.TCPFlags
+	labels[core.LabelTCPFlags] = flagString(flags)
+
+	now := d.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key, dir := tcpconn.KeyOf(d)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, _ := t.conns.Touch(key, now)
+	if c == nil {
+		return
+	}
+
+	// Handshake RTT: SYN to SYN-ACK, as seen from the capture point
+	switch {
+	case flags&(tcpconn.FlagSYN|tcpconn.FlagACK) == tcpconn.FlagSYN:
+		c.synAt, c.synDir = now, dir
+	case flags&(tcpconn.FlagSYN|tcpconn.FlagACK) == tcpconn.FlagSYN|tcpconn.FlagACK && !c.synAt.IsZero() && c.synDir != dir:
+		rtt := now.Sub(c.synAt)
+		c.synAt = time.Time{}
+		labels[core.LabelTCPRTT] = strconv.FormatFloat(float64(rtt)/float64(time.Millisecond), 'f', 1, 64)
+		t.handshakeRTT.Observe(rtt.Seconds())
+	}
+
+	segLen := uint32(len(d.Payload))
+	if flags&tcpconn.FlagSYN != 0 {
+		segLen++
+	}
+	if flags&tcpconn.FlagFIN != 0 {
+		segLen++
+	}
+	switch c.dirs[dir].observe(tr.SeqNum, segLen) {
+	case EventRetransmission:
+		labels[core.LabelTCPRetransmission] = "true"
+		t.retransmissions.Inc()
+	case EventOutOfOrder:
+		labels[core.LabelTCPOutOfOrder] = "true"
+		t.outOfOrder.Inc()
+	}
+
+	if flags&tcpconn.FlagRST != 0 {
+		t.conns.Delete(key)
+	}
+}
+
+// observe advances the direction by a segment and returns its event, if any.
+func (s *direction) observe(seq, segLen uint32) string {
+	if segLen == 0 {
+		return "" // pure ACK or window update: no sequence space
+	}
+	end := seq + segLen
+	if !s.started {
+		s.started, s.next = true, end
+		return ""
+	}
+
+	switch diff := int32(seq - s.next); {
+	case diff == 0:
+		s.next = end
+		return ""
+	case diff > 0:
+		// Segments are missing before this one: remember the gap
+		s.hole, s.holeFrom, s.holeTo = true, s.next, seq
+		s.next = end
+		return ""
+	}
+
+	// Below the next expected sequence number
+	if int32(end-s.next) > 0 {
+		s.next = end
+	}
+	if s.hole && int32(seq-s.holeFrom) >= 0 && int32(end-s.holeTo) <= 0 {
+		if seq == s.holeFrom {
+			s.holeFrom = end
+		} else if end == s.holeTo {
+			s.holeTo = seq
+		}
+		if int32(s.holeTo-s.holeFrom) <= 0 {
+			s.hole = false
+		}
+		return EventOutOfOrder
+	}
+	return EventRetransmission
+}
+
+// Len returns the number of tracked connections.
+func (t *Tracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.conns.Len()
+}
+
+func flagString(flags uint8) string {
+	var names []string
+	for _, f := range flagNames {
+		if flags&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
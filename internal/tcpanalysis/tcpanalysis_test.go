@@ -0,0 +1,122 @@
+package tcpanalysis
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/tcpconn"
+)
+
+var (
+	client = netip.MustParseAddrPort("10.0.0.1:40000")
+	server = netip.MustParseAddrPort("10.0.0.2:5060")
+	base   = time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+)
+
+// segment builds a TCP packet sent by from at base+offset.
+func segment(from netip.AddrPort, offset time.Duration, flags uint8, seq uint32, payload string) *core.DecodedPacket {
+	to := server
+	if from == server {
+		to = client
+	}
+	return &core.DecodedPacket{
+		Timestamp: base.Add(offset),
+		IP:        core.IPHeader{Version: 4, SrcIP: from.Addr(), DstIP: to.Addr(), Protocol: 6},
+		Transport: core.TransportHeader{SrcPort: from.Port(), DstPort: to.Port(), Protocol: 6, TCPFlags: flags, SeqNum: seq},
+		Payload:   []byte(payload),
+	}
+}
+
+func observe(tr *Tracker, d *core.DecodedPacket) core.Labels {
+	labels := core.Labels{}
+	tr.Observe(d, labels)
+	return labels
+}
+
+func TestTracker_HandshakeAndFlags(t *testing.T) {
+	tr := NewTracker("tcp-test", 0, 0)
+
+	syn := observe(tr, segment(client, 0, tcpconn.FlagSYN, 1000, ""))
+	if syn[core.LabelTCPFlags] != "SYN" || syn[core.LabelTCPRTT] != "" {
+		t.Errorf("SYN labels = %v", syn)
+	}
+	synAck := observe(tr, segment(server, 12500*time.Microsecond, tcpconn.FlagSYN|tcpconn.FlagACK, 5000, ""))
+	if synAck[core.LabelTCPFlags] != "SYN,ACK" || synAck[core.LabelTCPRTT] != "12.5" {
+		t.Errorf("SYN-ACK labels = %v, want rtt 12.5", synAck)
+	}
+	// A retransmitted SYN-ACK is labelled but yields no second RTT sample.
+	again := observe(tr, segment(server, time.Second, tcpconn.FlagSYN|tcpconn.FlagACK, 5000, ""))
+	if again[core.LabelTCPRTT] != "" || again[core.LabelTCPRetransmission] != "true" {
+		t.Errorf("retransmitted SYN-ACK labels = %v", again)
+	}
+
+	data := observe(tr, segment(client, 2*time.Second, tcpconn.FlagPSH|tcpconn.FlagACK, 1001, "INVITE"))
+	if data[core.LabelTCPFlags] != "PSH,ACK" || len(data) != 1 {
+		t.Errorf("data labels = %v", data)
+	}
+	if tr.Len() != 1 {
+		t.Errorf("Len() = %d, want 1 connection for both directions", tr.Len())
+	}
+
+	observe(tr, segment(server, 3*time.Second, tcpconn.FlagRST|tcpconn.FlagACK, 5001, ""))
+	if tr.Len() != 0 {
+		t.Errorf("Len() = %d after RST", tr.Len())
+	}
+}
+
+func TestTracker_RetransmissionAndOutOfOrder(t *testing.T) {
+	tr := NewTracker("tcp-test", 0, 0)
+	observe(tr, segment(client, 0, tcpconn.FlagACK, 100, "aaaa")) // next = 104
+
+	// 104..108 is lost or late; 108..112 arrives first.
+	if l := observe(tr, segment(client, 1*time.Millisecond, tcpconn.FlagACK, 108, "cccc")); len(l) != 1 {
+		t.Errorf("segment after gap labels = %v", l)
+	}
+	// The gap is filled: out of order.
+	if l := observe(tr, segment(client, 2*time.Millisecond, tcpconn.FlagACK, 104, "bbbb")); l[core.LabelTCPOutOfOrder] != "true" {
+		t.Errorf("gap filler labels = %v, want out_of_order", l)
+	}
+	// The same data again: retransmission.
+	if l := observe(tr, segment(client, 200*time.Millisecond, tcpconn.FlagACK, 104, "bbbb")); l[core.LabelTCPRetransmission] != "true" || l[core.LabelTCPOutOfOrder] != "" {
+		t.Errorf("duplicate labels = %v, want retransmission", l)
+	}
+	// Pure ACKs carry no sequence space.
+	if l := observe(tr, segment(client, 300*time.Millisecond, tcpconn.FlagACK, 100, "")); len(l) != 1 {
+		t.Errorf("pure ACK labels = %v", l)
+	}
+	// In-order data continues normally, across the 32-bit wrap too.
+	if l := observe(tr, segment(client, 400*time.Millisecond, tcpconn.FlagACK, 112, "dddd")); len(l) != 1 {
+		t.Errorf("in-order labels = %v", l)
+	}
+
+	wrap := NewTracker("tcp-test", 0, 0)
+	observe(wrap, segment(client, 0, tcpconn.FlagACK, 0xFFFFFFFE, "aaaa"))
+	if l := observe(wrap, segment(client, time.Millisecond, tcpconn.FlagACK, 2, "bbbb")); len(l) != 1 {
+		t.Errorf("wrapped in-order labels = %v", l)
+	}
+	if l := observe(wrap, segment(client, 2*time.Millisecond, tcpconn.FlagACK, 0xFFFFFFFE, "aaaa")); l[core.LabelTCPRetransmission] != "true" {
+		t.Errorf("wrapped retransmission labels = %v", l)
+	}
+}
+
+func TestTracker_Limits(t *testing.T) {
+	tr := NewTracker("tcp-test", 1, time.Minute)
+	observe(tr, segment(client, 0, tcpconn.FlagSYN, 1, ""))
+
+	other := netip.MustParseAddrPort("10.0.0.3:40001")
+	d := segment(client, time.Second, tcpconn.FlagSYN, 1, "")
+	d.IP.SrcIP, d.Transport.SrcPort = other.Addr(), other.Port()
+	if l := observe(tr, d); l[core.LabelTCPFlags] != "SYN" || tr.Len() != 1 {
+		t.Errorf("over max_conns: labels = %v, Len() = %d", l, tr.Len())
+	}
+
+	// Idle connections are swept.
+	later := *d
+	later.Timestamp = base.Add(2 * time.Minute)
+	observe(tr, &later)
+	if tr.Len() != 1 {
+		t.Errorf("Len() = %d after idle sweep, want only the new connection", tr.Len())
+	}
+}
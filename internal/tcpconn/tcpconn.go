@@ -0,0 +1,46 @@
+// Package tcpconn keys TCP connections regardless of direction, for the
+// trackers that follow TCP segments across packets (tcpanalysis,
+// tlsdecrypt).
+package tcpconn
+
+import (
+	"net/netip"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+)
+
+// TCP flag bits of core.TransportHeader.TCPFlags.
+const (
+	FlagFIN = 0x01
+	FlagSYN = 0x02
+	FlagRST = 0x04
+	FlagPSH = 0x08
+	FlagACK = 0x10
+	FlagURG = 0x20
+)
+
+// Key identifies a connection regardless of direction: A is the lower
+// endpoint.
+type Key struct {
+	A, B netip.AddrPort
+}
+
+// KeyOf returns the connection of a TCP packet and the direction the packet
+// was sent in: 0 by key.A, 1 by key.B.
+func KeyOf(pkt *core.DecodedPacket) (key Key, dir int) {
+	src := netip.AddrPortFrom(pkt.IP.SrcIP, pkt.Transport.SrcPort)
+	dst := netip.AddrPortFrom(pkt.IP.DstIP, pkt.Transport.DstPort)
+	if dst.Compare(src) < 0 {
+		return Key{dst, src}, 1
+	}
+	return Key{src, dst}, 0
+}
+
+// NewTable creates a table of per-connection state V holding at most
+// maxConns connections and forgetting those idle for idle, swept at most
+// once per tenth of it.
+func NewTable[V any](maxConns int, idle time.Duration) *idletable.Table[Key, V] {
+	return idletable.New[Key, V](idle, idle/10, maxConns)
+}
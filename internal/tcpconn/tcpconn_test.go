@@ -0,0 +1,28 @@
+package tcpconn
+
+import (
+	"net/netip"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestKeyOf(t *testing.T) {
+	client := netip.MustParseAddrPort("10.0.0.2:40000")
+	server := netip.MustParseAddrPort("10.0.0.1:5060")
+	packet := func(from, to netip.AddrPort) *core.DecodedPacket {
+		return &core.DecodedPacket{
+			IP:        core.IPHeader{SrcIP: from.Addr(), DstIP: to.Addr()},
+			Transport: core.TransportHeader{SrcPort: from.Port(), DstPort: to.Port(), Protocol: 6},
+		}
+	}
+
+	up, upDir := KeyOf(packet(client, server))
+	down, downDir := KeyOf(packet(server, client))
+	if up != down {
+		t.Errorf("keys differ by direction: %v, %v", up, down)
+	}
+	if up.A != server || upDir != 1 || downDir != 0 {
+		t.Errorf("KeyOf = %v, dirs %d/%d; want A = %v, dirs 1/0", up, upDir, downDir, server)
+	}
+}
@@ -0,0 +1,263 @@
+package tlsdecrypt
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	_ "crypto/sha1" // crypto.SHA1 for CBC suites
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/binary"
+)
+
+// suite is a cipher suite Decrypt supports.
+type suite struct {
+	keyLen         int
+	mac            crypto.Hash // record MAC of CBC suites; 0 for AEAD
+	prfHash        crypto.Hash // TLS 1.2 PRF
+	hash           crypto.Hash // TLS 1.3 HKDF
+	rsaKeyExchange bool
+}
+
+// suites12 are the TLS 1.2 suites: AES-GCM and AES-CBC with RSA, DHE and
+// ECDHE key exchange.
+var suites12 = map[uint16]*suite{
+	0x009C: {keyLen: 16, prfHash: crypto.SHA256, rsaKeyExchange: true}, // TLS_RSA_WITH_AES_128_GCM_SHA256
+	0x009D: {keyLen: 32, prfHash: crypto.SHA384, rsaKeyExchange: true}, // TLS_RSA_WITH_AES_256_GCM_SHA384
+	0x009E: {keyLen: 16, prfHash: crypto.SHA256},                       // TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+	0x009F: {keyLen: 32, prfHash: crypto.SHA384},                       // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384
+	0xC02B: {keyLen: 16, prfHash: crypto.SHA256},                       // TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256
+	0xC02C: {keyLen: 32, prfHash: crypto.SHA384},                       // TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384
+	0xC02F: {keyLen: 16, prfHash: crypto.SHA256},                       // TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	0xC030: {keyLen: 32, prfHash: crypto.SHA384},                       // TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384
+
+	0x002F: {keyLen: 16, mac: crypto.SHA1, prfHash: crypto.SHA256, rsaKeyExchange: true},   // TLS_RSA_WITH_AES_128_CBC_SHA
+	0x0035: {keyLen: 32, mac: crypto.SHA1, prfHash: crypto.SHA256, rsaKeyExchange: true},   // TLS_RSA_WITH_AES_256_CBC_SHA
+	0x003C: {keyLen: 16, mac: crypto.SHA256, prfHash: crypto.SHA256, rsaKeyExchange: true}, // TLS_RSA_WITH_AES_128_CBC_SHA256
+	0x003D: {keyLen: 32, mac: crypto.SHA256, prfHash: crypto.SHA256, rsaKeyExchange: true}, // TLS_RSA_WITH_AES_256_CBC_SHA256
+	0x0033: {keyLen: 16, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_DHE_RSA_WITH_AES_128_CBC_SHA
+	0x0039: {keyLen: 32, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_DHE_RSA_WITH_AES_256_CBC_SHA
+	0x0067: {keyLen: 16, mac: crypto.SHA256, prfHash: crypto.SHA256},                       // TLS_DHE_RSA_WITH_AES_128_CBC_SHA256
+	0x006B: {keyLen: 32, mac: crypto.SHA256, prfHash: crypto.SHA256},                       // TLS_DHE_RSA_WITH_AES_256_CBC_SHA256
+	0xC009: {keyLen: 16, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA
+	0xC00A: {keyLen: 32, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA
+	0xC013: {keyLen: 16, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA
+	0xC014: {keyLen: 32, mac: crypto.SHA1, prfHash: crypto.SHA256},                         // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA
+	0xC023: {keyLen: 16, mac: crypto.SHA256, prfHash: crypto.SHA256},                       // TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256
+	0xC024: {keyLen: 32, mac: crypto.SHA384, prfHash: crypto.SHA384},                       // TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA384
+	0xC027: {keyLen: 16, mac: crypto.SHA256, prfHash: crypto.SHA256},                       // TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256
+	0xC028: {keyLen: 32, mac: crypto.SHA384, prfHash: crypto.SHA384},                       // TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA384
+}
+
+// suites13 are the TLS 1.3 AES-GCM suites.
+var suites13 = map[uint16]*suite{
+	0x1301: {keyLen: 16, hash: crypto.SHA256}, // TLS_AES_128_GCM_SHA256
+	0x1302: {keyLen: 32, hash: crypto.SHA384}, // TLS_AES_256_GCM_SHA384
+}
+
+// lookupSuite returns cipher suite id of a protocol version, nil if either
+// is not supported.
+func lookupSuite(id, version uint16) *suite {
+	switch version {
+	case versionTLS12:
+		return suites12[id]
+	case versionTLS13:
+		return suites13[id]
+	}
+	return nil
+}
+
+// recordCipher decrypts the records of one direction.
+type recordCipher struct {
+	aead  cipher.AEAD  // GCM
+	iv    []byte       // TLS 1.2 GCM salt (4 bytes) or TLS 1.3 IV (12 bytes)
+	block cipher.Block // CBC
+	mac   crypto.Hash
+	key   []byte // MAC key
+	etm   bool   // encrypt-then-MAC (RFC 7366)
+	tls13 bool
+}
+
+// ciphers12 derives the client and server record ciphers of a TLS 1.2
+// session from its master secret (RFC 5246 §6.3).
+func (s *suite) ciphers12(master, clientRandom, serverRandom []byte, etm bool) (client, server *recordCipher) {
+	macLen, ivLen := 0, 4
+	if s.mac != 0 {
+		macLen, ivLen = s.mac.Size(), 16
+	}
+	block := prf12(s.prfHash, master, "key expansion", concat(serverRandom, clientRandom), 2*(macLen+s.keyLen+ivLen))
+
+	next := func(n int) []byte {
+		b := block[:n]
+		block = block[n:]
+		return b
+	}
+	clientMAC, serverMAC := next(macLen), next(macLen)
+	clientKey, serverKey := next(s.keyLen), next(s.keyLen)
+	clientIV, serverIV := next(ivLen), next(ivLen)
+
+	build := func(key, macKey, iv []byte) *recordCipher {
+		b, _ := aes.NewCipher(key) // key length fixed by the suite
+		if s.mac != 0 {
+			return &recordCipher{block: b, mac: s.mac, key: macKey, etm: etm}
+		}
+		aead, _ := cipher.NewGCM(b)
+		return &recordCipher{aead: aead, iv: iv}
+	}
+	return build(clientKey, clientMAC, clientIV), build(serverKey, serverMAC, serverIV)
+}
+
+// cipher13 derives the record cipher of a TLS 1.3 traffic secret
+// (RFC 8446 §7.3).
+func (s *suite) cipher13(secret []byte) *recordCipher {
+	b, _ := aes.NewCipher(s.expandLabel(secret, "key", s.keyLen))
+	aead, _ := cipher.NewGCM(b)
+	return &recordCipher{aead: aead, iv: s.expandLabel(secret, "iv", 12), tls13: true}
+}
+
+// expandLabel is HKDF-Expand-Label with an empty context (RFC 8446 §7.1).
+func (s *suite) expandLabel(secret []byte, label string, length int) []byte {
+	info := make([]byte, 0, 4+6+len(label))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(6+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+	out, _ := hkdf.Expand(s.hash.New, secret, string(info), length)
+	return out
+}
+
+// prf12 is the TLS 1.2 pseudorandom function P_hash (RFC 5246 §5).
+func prf12(h crypto.Hash, secret []byte, label string, seed []byte, n int) []byte {
+	labelSeed := append([]byte(label), seed...)
+	mac := hmac.New(h.New, secret)
+	mac.Write(labelSeed)
+	a := mac.Sum(nil)
+
+	out := make([]byte, 0, n+h.Size())
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(labelSeed)
+		out = mac.Sum(out)
+
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+	}
+	return out[:n]
+}
+
+// open decrypts and authenticates a record (header included) with sequence
+// number seq. It returns the plaintext and content type: the record's, or
+// the inner content type of TLS 1.3.
+func (rc *recordCipher) open(rec []byte, seq uint64) ([]byte, uint8, bool) {
+	switch {
+	case rc.tls13:
+		return rc.open13(rec, seq)
+	case rc.aead != nil:
+		return rc.openGCM(rec, seq)
+	}
+	return rc.openCBC(rec, seq)
+}
+
+func (rc *recordCipher) open13(rec []byte, seq uint64) ([]byte, uint8, bool) {
+	nonce := make([]byte, len(rc.iv))
+	copy(nonce, rc.iv)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	plain, err := rc.aead.Open(nil, nonce, rec[recordHeaderLen:], rec[:recordHeaderLen])
+	if err != nil {
+		return nil, 0, false
+	}
+	// TLSInnerPlaintext: content, content type, zero padding
+	i := len(plain) - 1
+	for i >= 0 && plain[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return nil, 0, false
+	}
+	return plain[:i], plain[i], true
+}
+
+func (rc *recordCipher) openGCM(rec []byte, seq uint64) ([]byte, uint8, bool) {
+	// GenericAEADCipher: explicit nonce(8) || ciphertext || tag
+	payload := rec[recordHeaderLen:]
+	if len(payload) < 8+rc.aead.Overhead() {
+		return nil, 0, false
+	}
+	nonce := concat(rc.iv, payload[:8])
+	ciphertext := payload[8:]
+	plain, err := rc.aead.Open(nil, nonce, ciphertext,
+		additionalData(seq, rec, len(ciphertext)-rc.aead.Overhead()))
+	if err != nil {
+		return nil, 0, false
+	}
+	return plain, rec[0], true
+}
+
+func (rc *recordCipher) openCBC(rec []byte, seq uint64) ([]byte, uint8, bool) {
+	// GenericBlockCipher: IV || E(content || MAC || padding), or with
+	// encrypt-then-MAC: IV || E(content || padding) || MAC
+	payload := rec[recordHeaderLen:]
+	macLen, bs := rc.mac.Size(), rc.block.BlockSize()
+	var mac []byte
+	if rc.etm {
+		if len(payload) < macLen {
+			return nil, 0, false
+		}
+		payload, mac = payload[:len(payload)-macLen], payload[len(payload)-macLen:]
+		if !hmac.Equal(mac, rc.sum(seq, rec, payload)) {
+			return nil, 0, false
+		}
+	}
+	if len(payload) < 2*bs || len(payload)%bs != 0 {
+		return nil, 0, false
+	}
+	plain := make([]byte, len(payload)-bs)
+	cipher.NewCBCDecrypter(rc.block, payload[:bs]).CryptBlocks(plain, payload[bs:])
+
+	pad := int(plain[len(plain)-1])
+	if pad+1 > len(plain) {
+		return nil, 0, false
+	}
+	for _, b := range plain[len(plain)-1-pad:] {
+		if int(b) != pad {
+			return nil, 0, false
+		}
+	}
+	plain = plain[:len(plain)-1-pad]
+	if rc.etm {
+		return plain, rec[0], true
+	}
+
+	if len(plain) < macLen {
+		return nil, 0, false
+	}
+	plain, mac = plain[:len(plain)-macLen], plain[len(plain)-macLen:]
+	if !hmac.Equal(mac, rc.sum(seq, rec, plain)) {
+		return nil, 0, false
+	}
+	return plain, rec[0], true
+}
+
+// sum returns the record MAC of data (RFC 5246 §6.2.3.1).
+func (rc *recordCipher) sum(seq uint64, rec, data []byte) []byte {
+	h := hmac.New(rc.mac.New, rc.key)
+	h.Write(additionalData(seq, rec, len(data)))
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// additionalData is seq_num || type || version || length.
+func additionalData(seq uint64, rec []byte, length int) []byte {
+	ad := make([]byte, 13)
+	binary.BigEndian.PutUint64(ad, seq)
+	copy(ad[8:11], rec[:3])
+	binary.BigEndian.PutUint16(ad[11:], uint16(length))
+	return ad
+}
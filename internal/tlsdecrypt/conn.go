@@ -0,0 +1,518 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/binary"
+	"time"
+)
+
+// TLS record content types.
+const (
+	recordChangeCipherSpec = 20
+	recordAlert            = 21
+	recordHandshake        = 22
+	recordApplicationData  = 23
+
+	recordHeaderLen = 5
+	maxRecordLen    = 1<<14 + 2048 // TLSCiphertext.length limit (RFC 5246 §6.2.3)
+)
+
+// Handshake message types.
+const (
+	handshakeClientHello       = 1
+	handshakeServerHello       = 2
+	handshakeClientKeyExchange = 16
+	handshakeKeyUpdate         = 24
+)
+
+// Extensions read from the ServerHello.
+const (
+	extEncryptThenMAC       = 22
+	extExtendedMasterSecret = 23
+	extSupportedVersions    = 43
+)
+
+const (
+	versionTLS12 = 0x0303
+	versionTLS13 = 0x0304
+
+	// maxSeqSkip is how many lost records are searched past after a gap.
+	maxSeqSkip = 32
+)
+
+// helloRetryRandom is the ServerHello.random of a TLS 1.3 HelloRetryRequest
+// (RFC 8446 §4.1.3).
+var helloRetryRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11, 0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E, 0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// conn is the TLS session state of one TCP connection.
+type conn struct {
+	dirs   [2]half // [0] is sent by tcpconn.Key.A
+	client int     // direction of the ClientHello, -1 until seen
+
+	clientRandom, serverRandom []byte
+	clientSessionID            []byte
+	serverSessionID            []byte
+	version                    uint16 // negotiated, 0 until the ServerHello
+	suiteID                    uint16
+	suite                      *suite // nil if unsupported
+	ems, etm                   bool   // extended master secret, encrypt-then-MAC
+	resumed                    bool
+
+	// transcript holds the handshake messages up to the ClientKeyExchange,
+	// the session hash of the extended master secret.
+	transcript     []byte
+	transcriptDone bool
+
+	master    []byte           // TLS 1.2
+	ciphers   [2]*recordCipher // TLS 1.2 by role: [0] client, [1] server
+	lastTried time.Time        // last key lookup that found no secret
+}
+
+// half is one direction of a connection.
+type half struct {
+	started bool
+	next    uint32 // next expected TCP sequence number
+	fin     bool
+	desync  bool // record boundary lost: resynchronise on the next header
+	gap     bool // records may have been lost: search the sequence number
+
+	buf []byte // incomplete record
+	hs  []byte // incomplete plaintext handshake message
+
+	encrypted  bool          // past ChangeCipherSpec (TLS 1.2) or the ServerHello (TLS 1.3)
+	cipher     *recordCipher // nil until the keys are known
+	seq        uint64        // record sequence number
+	secret     []byte        // TLS 1.3 traffic secret, for KeyUpdate
+	appStarted bool          // TLS 1.3: past the records of the encrypted handshake
+}
+
+func newConn() *conn {
+	return &conn{client: -1}
+}
+
+// accept returns the bytes of a segment not seen before. A gap before the
+// segment drops the incomplete record and marks the stream for
+// resynchronisation.
+func (h *half) accept(seq uint32, data []byte) []byte {
+	end := seq + uint32(len(data))
+	if !h.started {
+		// Mid-stream: the segment need not start on a record boundary
+		h.started, h.next, h.desync = true, end, true
+		return data
+	}
+	switch diff := int32(seq - h.next); {
+	case diff > 0:
+		h.buf, h.hs = h.buf[:0], nil
+		h.desync, h.gap = true, true
+	case diff < 0:
+		skip := uint32(-diff)
+		if skip >= uint32(len(data)) {
+			return nil // retransmission
+		}
+		data = data[skip:]
+	}
+	if int32(end-h.next) > 0 {
+		h.next = end
+	}
+	return data
+}
+
+// feed appends data to direction dir and processes its complete records.
+// undecrypted is true if application data could not be decrypted.
+func (d *Decryptor) feed(c *conn, dir int, data []byte, now time.Time) (out []byte, undecrypted bool) {
+	h := &c.dirs[dir]
+	h.buf = append(h.buf, data...)
+	for {
+		if h.desync && !h.resync() {
+			break
+		}
+		if len(h.buf) < recordHeaderLen {
+			break
+		}
+		n := int(binary.BigEndian.Uint16(h.buf[3:5]))
+		if !plausibleHeader(h.buf) {
+			h.desync = true
+			continue
+		}
+		if len(h.buf) < recordHeaderLen+n {
+			break
+		}
+		rec := h.buf[:recordHeaderLen+n]
+		plain, result := d.record(c, dir, rec, now)
+		if result == ResultFailed && h.gap {
+			// Likely a false header found by resynchronisation: rescan past it
+			h.buf = h.buf[1:]
+			h.desync = true
+			continue
+		}
+		if result != "" {
+			d.count(result)
+		}
+		if result != "" && result != ResultDecrypted {
+			undecrypted = true
+		}
+		out = append(out, plain...)
+		h.buf = h.buf[recordHeaderLen+n:]
+	}
+	if len(h.buf) > maxBuffered {
+		h.buf, h.desync = h.buf[:0], true
+	}
+	// Release the segment-sized array once drained
+	if len(h.buf) == 0 {
+		h.buf = nil
+	}
+	return out, undecrypted
+}
+
+// resync drops bytes up to the next plausible record header and reports
+// whether one was found.
+func (h *half) resync() bool {
+	for i := 0; i+recordHeaderLen <= len(h.buf); i++ {
+		if plausibleHeader(h.buf[i:]) {
+			h.buf, h.desync = h.buf[i:], false
+			return true
+		}
+	}
+	if len(h.buf) >= recordHeaderLen {
+		h.buf = append(h.buf[:0], h.buf[len(h.buf)-recordHeaderLen+1:]...)
+	}
+	return false
+}
+
+// plausibleHeader reports whether b starts with a TLS record header.
+func plausibleHeader(b []byte) bool {
+	n := int(binary.BigEndian.Uint16(b[3:5]))
+	return b[0] >= recordChangeCipherSpec && b[0] <= recordApplicationData &&
+		b[1] == 3 && b[2] <= 4 && n > 0 && n <= maxRecordLen
+}
+
+// record processes one complete record and returns its application data.
+// result is the outcome of an application data record, "" for other records.
+func (d *Decryptor) record(c *conn, dir int, rec []byte, now time.Time) (plain []byte, result string) {
+	h := &c.dirs[dir]
+	if c.version == versionTLS13 {
+		return d.record13(c, dir, rec, now)
+	}
+
+	switch rec[0] {
+	case recordChangeCipherSpec:
+		h.encrypted, h.seq = true, 0
+		h.cipher = d.cipher12(c, dir, now)
+		return nil, ""
+	case recordHandshake:
+		if !h.encrypted {
+			d.handshake(c, dir, rec[recordHeaderLen:])
+			return nil, ""
+		}
+	}
+	if !h.encrypted {
+		return nil, ""
+	}
+
+	if h.cipher == nil {
+		h.cipher = d.cipher12(c, dir, now)
+	}
+	switch {
+	case c.suite == nil:
+		result = ResultUnsupported
+	case h.cipher == nil:
+		result = ResultNoKey
+	}
+	if result != "" {
+		h.seq++
+		if rec[0] != recordApplicationData {
+			return nil, ""
+		}
+		return nil, result
+	}
+
+	plain, _, ok := h.open(rec)
+	if rec[0] != recordApplicationData {
+		return nil, "" // Finished, alerts
+	}
+	if !ok {
+		return nil, ResultFailed
+	}
+	return plain, ResultDecrypted
+}
+
+// record13 processes a record of a TLS 1.3 connection. After the
+// ServerHello every record but the compatibility ChangeCipherSpec is
+// encrypted, first with handshake keys, then with the application traffic
+// keys taken from the key log; records the latter cannot open before the
+// first one they can belong to the handshake.
+func (d *Decryptor) record13(c *conn, dir int, rec []byte, now time.Time) ([]byte, string) {
+	h := &c.dirs[dir]
+	switch {
+	case rec[0] == recordHandshake && !h.encrypted:
+		d.handshake(c, dir, rec[recordHeaderLen:])
+		return nil, ""
+	case rec[0] != recordApplicationData:
+		return nil, ""
+	case c.suite == nil:
+		return nil, ResultUnsupported
+	}
+	if h.cipher == nil && !d.cipher13(c, dir, now) {
+		return nil, ResultNoKey
+	}
+
+	if !h.appStarted {
+		h.seq = 0
+		plain, typ, ok := h.cipher.open(rec, 0)
+		if !ok {
+			return nil, "" // handshake record
+		}
+		h.appStarted, h.seq = true, 1
+		return h.inner13(c, plain, typ)
+	}
+
+	plain, typ, ok := h.open(rec)
+	if !ok {
+		return nil, ResultFailed
+	}
+	return h.inner13(c, plain, typ)
+}
+
+// inner13 handles the inner plaintext of a TLS 1.3 record.
+func (h *half) inner13(c *conn, plain []byte, typ uint8) ([]byte, string) {
+	switch typ {
+	case recordApplicationData:
+		return plain, ResultDecrypted
+	case recordHandshake:
+		// Post-handshake messages: NewSessionTicket, KeyUpdate
+		for len(plain) >= 4 {
+			n := int(plain[1])<<16 | int(plain[2])<<8 | int(plain[3])
+			if plain[0] == handshakeKeyUpdate && h.secret != nil {
+				h.secret = c.suite.expandLabel(h.secret, "traffic upd", c.suite.hash.Size())
+				h.cipher, h.seq = c.suite.cipher13(h.secret), 0
+			}
+			if 4+n > len(plain) {
+				break
+			}
+			plain = plain[4+n:]
+		}
+	}
+	return nil, ""
+}
+
+// open decrypts a record with the next sequence number or, after a gap, one
+// of the following ones.
+func (h *half) open(rec []byte) ([]byte, uint8, bool) {
+	tries := uint64(1)
+	if h.gap {
+		tries = maxSeqSkip + 1
+	}
+	for i := range tries {
+		if plain, typ, ok := h.cipher.open(rec, h.seq+i); ok {
+			h.seq += i + 1
+			h.gap = false
+			return plain, typ, true
+		}
+	}
+	if !h.gap {
+		h.seq++
+	}
+	return nil, 0, false
+}
+
+// handshake processes the plaintext handshake messages of a record.
+func (d *Decryptor) handshake(c *conn, dir int, fragment []byte) {
+	h := &c.dirs[dir]
+	h.hs = append(h.hs, fragment...)
+	for len(h.hs) >= 4 {
+		n := int(h.hs[1])<<16 | int(h.hs[2])<<8 | int(h.hs[3])
+		if n > maxBuffered {
+			h.hs = nil
+			return
+		}
+		if len(h.hs) < 4+n {
+			return
+		}
+		d.handshakeMessage(c, dir, h.hs[:4+n])
+		h.hs = h.hs[4+n:]
+	}
+	if len(h.hs) == 0 {
+		h.hs = nil
+	}
+}
+
+func (d *Decryptor) handshakeMessage(c *conn, dir int, msg []byte) {
+	if !c.transcriptDone {
+		if len(c.transcript)+len(msg) > maxBuffered {
+			c.transcript, c.transcriptDone = nil, true
+		} else {
+			c.transcript = append(c.transcript, msg...)
+		}
+	}
+	body := msg[4:]
+
+	switch msg[0] {
+	case handshakeClientHello:
+		// version(2) random(32) session_id<0..32>
+		if len(body) < 35 || len(body) < 35+int(body[34]) {
+			return
+		}
+		c.client = dir
+		c.clientRandom = bytes.Clone(body[2:34])
+		c.clientSessionID = bytes.Clone(body[35 : 35+int(body[34])])
+
+	case handshakeServerHello:
+		d.serverHello(c, body)
+
+	case handshakeClientKeyExchange:
+		c.transcriptDone = true
+		if c.suite != nil && c.suite.rsaKeyExchange && len(d.rsaKeys) > 0 && len(body) >= 2 {
+			d.decryptPreMaster(c, body[2:])
+		}
+	}
+}
+
+// serverHello reads the negotiated version, cipher suite and extensions.
+func (d *Decryptor) serverHello(c *conn, body []byte) {
+	// version(2) random(32) session_id<0..32> cipher_suite(2) compression(1) extensions<0..2^16-1>
+	if len(body) < 35 {
+		return
+	}
+	random := body[2:34]
+	if bytes.Equal(random, helloRetryRandom) {
+		return // the client sends a second ClientHello
+	}
+	sidLen := int(body[34])
+	rest := body[35:]
+	if len(rest) < sidLen+3 {
+		return
+	}
+	c.serverRandom = bytes.Clone(random)
+	c.serverSessionID = bytes.Clone(rest[:sidLen])
+	c.version = binary.BigEndian.Uint16(body[:2])
+	c.suiteID = binary.BigEndian.Uint16(rest[sidLen:])
+	rest = rest[sidLen+3:]
+
+	if len(rest) >= 2 {
+		exts := rest[2:]
+		if n := int(binary.BigEndian.Uint16(rest)); n < len(exts) {
+			exts = exts[:n]
+		}
+		for len(exts) >= 4 {
+			typ, n := binary.BigEndian.Uint16(exts), int(binary.BigEndian.Uint16(exts[2:]))
+			if len(exts) < 4+n {
+				break
+			}
+			data := exts[4 : 4+n]
+			switch typ {
+			case extSupportedVersions:
+				if n == 2 {
+					c.version = binary.BigEndian.Uint16(data)
+				}
+			case extExtendedMasterSecret:
+				c.ems = true
+			case extEncryptThenMAC:
+				c.etm = true
+			}
+			exts = exts[4+n:]
+		}
+	}
+
+	c.suite = lookupSuite(c.suiteID, c.version)
+	if c.version == versionTLS13 {
+		// Everything after the ServerHello is encrypted
+		c.dirs[0].encrypted, c.dirs[1].encrypted = true, true
+		return
+	}
+	c.resumed = len(c.serverSessionID) > 0 && bytes.Equal(c.serverSessionID, c.clientSessionID)
+}
+
+// decryptPreMaster recovers the master secret of an RSA key exchange with
+// the configured private keys.
+func (d *Decryptor) decryptPreMaster(c *conn, encrypted []byte) {
+	for _, key := range d.rsaKeys {
+		preMaster, err := rsa.DecryptPKCS1v15(nil, key, encrypted)
+		if err != nil || len(preMaster) != 48 {
+			continue
+		}
+		if c.ems {
+			sessionHash := c.suite.prfHash.New()
+			sessionHash.Write(c.transcript)
+			c.master = prf12(c.suite.prfHash, preMaster, "extended master secret", sessionHash.Sum(nil), 48)
+		} else {
+			c.master = prf12(c.suite.prfHash, preMaster, "master secret", concat(c.clientRandom, c.serverRandom), 48)
+		}
+		d.remember(c.serverSessionID, c.master)
+		return
+	}
+}
+
+// cipher12 returns the record cipher of direction dir of a TLS 1.2
+// connection, deriving the keys on first use; nil if its secret is unknown.
+func (d *Decryptor) cipher12(c *conn, dir int, now time.Time) *recordCipher {
+	if c.suite == nil || c.client < 0 || c.serverRandom == nil {
+		return nil
+	}
+	role := 0
+	if dir != c.client {
+		role = 1
+	}
+	if c.ciphers[role] != nil {
+		return c.ciphers[role]
+	}
+
+	if c.master == nil && c.resumed {
+		c.master = d.resumptions[string(c.serverSessionID)]
+	}
+	if c.master == nil && d.keyLog != nil && !d.recentlyTried(c, now) {
+		if s := d.keyLog.lookup(c.clientRandom, now); s != nil && s.master != nil {
+			c.master = s.master
+		} else {
+			c.lastTried = now
+		}
+	}
+	if c.master == nil {
+		return nil
+	}
+	c.ciphers[0], c.ciphers[1] = c.suite.ciphers12(c.master, c.clientRandom, c.serverRandom, c.etm)
+	return c.ciphers[role]
+}
+
+// cipher13 installs the application traffic keys of direction dir of a
+// TLS 1.3 connection and reports whether they are known.
+func (d *Decryptor) cipher13(c *conn, dir int, now time.Time) bool {
+	if c.client < 0 || d.keyLog == nil || d.recentlyTried(c, now) {
+		return false
+	}
+	s := d.keyLog.lookup(c.clientRandom, now)
+	secret := []byte(nil)
+	if s != nil {
+		secret = s.serverTraffic
+		if dir == c.client {
+			secret = s.clientTraffic
+		}
+	}
+	if secret == nil {
+		c.lastTried = now
+		return false
+	}
+	h := &c.dirs[dir]
+	h.secret, h.cipher = secret, c.suite.cipher13(secret)
+	return true
+}
+
+// recentlyTried reports whether a key lookup of c found nothing within the
+// key log check interval, which is retried only once the log may have grown.
+func (d *Decryptor) recentlyTried(c *conn, now time.Time) bool {
+	return !c.lastTried.IsZero() && now.Sub(c.lastTried) < keyLogCheckInterval
+}
+
+func (c *conn) versionName() string {
+	if c.version == versionTLS13 {
+		return "1.3"
+	}
+	return "1.2"
+}
+
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
@@ -0,0 +1,143 @@
+package tlsdecrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	// keyLogCheckInterval is the minimum interval between checks of the key
+	// log for new lines, and between key lookups of one session that found
+	// nothing.
+	keyLogCheckInterval = 100 * time.Millisecond
+
+	// maxKeyLogSessions bounds the sessions kept from the key log; the
+	// oldest are forgotten first.
+	maxKeyLogSessions = 100000
+)
+
+// secrets are the key log lines of one session.
+type secrets struct {
+	master                       []byte // TLS 1.2 CLIENT_RANDOM
+	clientTraffic, serverTraffic []byte // TLS 1.3 *_TRAFFIC_SECRET_0
+}
+
+// keyLog reads an NSS key log (SSLKEYLOGFILE) incrementally as the endpoint
+// appends to it. A file that shrinks was rotated and is read from the start.
+type keyLog struct {
+	path      string
+	offset    int64 // bytes consumed, up to the last complete line
+	lastCheck time.Time
+
+	sessions map[string]*secrets // client random → secrets
+	order    []string            // client randoms, oldest first
+}
+
+func newKeyLog(path string) *keyLog {
+	return &keyLog{path: path, sessions: make(map[string]*secrets)}
+}
+
+// lookup returns the secrets of the session with clientRandom, reading new
+// lines of the log if it has none.
+func (k *keyLog) lookup(clientRandom []byte, now time.Time) *secrets {
+	if s := k.sessions[string(clientRandom)]; s != nil {
+		return s
+	}
+	if !k.refresh(now) {
+		return nil
+	}
+	return k.sessions[string(clientRandom)]
+}
+
+// refresh reads the lines appended since the last read and reports whether
+// there were any. The log is checked at most once per keyLogCheckInterval.
+func (k *keyLog) refresh(now time.Time) bool {
+	if now.Sub(k.lastCheck) < keyLogCheckInterval {
+		return false
+	}
+	k.lastCheck = now
+
+	f, err := os.Open(k.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("tls decryption: cannot read key log", "path", k.path, "error", err)
+		}
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	if info.Size() < k.offset {
+		k.offset = 0 // rotated or truncated
+	}
+	if info.Size() == k.offset {
+		return false
+	}
+	data := make([]byte, info.Size()-k.offset)
+	n, err := f.ReadAt(data, k.offset)
+	if err != nil && err != io.EOF {
+		slog.Warn("tls decryption: cannot read key log", "path", k.path, "error", err)
+		return false
+	}
+	data = data[:n]
+
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return false // no complete line yet
+	}
+	k.offset += int64(end + 1)
+	for _, line := range bytes.Split(data[:end], []byte("\n")) {
+		k.parseLine(line)
+	}
+	return true
+}
+
+// parseLine records a "<label> <client random> <secret>" line. Comments,
+// other labels (handshake and early secrets) and malformed lines are skipped.
+func (k *keyLog) parseLine(line []byte) {
+	fields := bytes.Fields(line)
+	if len(fields) != 3 {
+		return
+	}
+	random, err := hex.DecodeString(string(fields[1]))
+	if err != nil || len(random) != 32 {
+		return
+	}
+	secret, err := hex.DecodeString(string(fields[2]))
+	if err != nil {
+		return
+	}
+
+	s := k.sessions[string(random)]
+	if s == nil {
+		s = &secrets{}
+	}
+	switch string(fields[0]) {
+	case "CLIENT_RANDOM":
+		s.master = secret
+	case "CLIENT_TRAFFIC_SECRET_0":
+		s.clientTraffic = secret
+	case "SERVER_TRAFFIC_SECRET_0":
+		s.serverTraffic = secret
+	default:
+		return
+	}
+	if _, known := k.sessions[string(random)]; !known {
+		k.add(string(random), s)
+	}
+}
+
+func (k *keyLog) add(random string, s *secrets) {
+	if len(k.order) >= maxKeyLogSessions {
+		delete(k.sessions, k.order[0])
+		k.order = k.order[1:]
+	}
+	k.sessions[random] = s
+	k.order = append(k.order, random)
+}
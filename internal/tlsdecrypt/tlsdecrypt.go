@@ -0,0 +1,246 @@
+// Package tlsdecrypt decrypts TLS on configured TCP ports, so that SIP over
+// TLS (SIPS, port 5061) can be parsed and exported like plain SIP.
+//
+// Sessions are decrypted passively, with the secrets an endpoint writes to an
+// SSLKEYLOGFILE key log (TLS 1.2 CLIENT_RANDOM, TLS 1.3
+// CLIENT_TRAFFIC_SECRET_0 and SERVER_TRAFFIC_SECRET_0) or, for TLS 1.2
+// sessions with RSA key exchange, with the server's RSA private key.
+// TLS 1.2 with AES-GCM and AES-CBC cipher suites and TLS 1.3 with AES-GCM are
+// supported; ChaCha20-Poly1305, TLS 1.0/1.1, renegotiation and 0-RTT data are
+// not. The ClientHello and ServerHello of a session must be captured.
+//
+// Each direction of a connection is a byte stream in TCP sequence order.
+// There is no reordering: bytes seen before are skipped and, after a gap, the
+// stream resynchronises on the next plausible record header and the record
+// sequence number is searched past the lost records.
+package tlsdecrypt
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/tcpconn"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults for Config fields left unset.
+const (
+	DefaultPort        = 5061
+	DefaultMaxConns    = 10000
+	DefaultIdleTimeout = 10 * time.Minute
+)
+
+// Application data record outcomes counted in otus_tls_records_total.
+const (
+	ResultDecrypted   = "decrypted"
+	ResultNoKey       = "no_key"      // no secret for the session (yet)
+	ResultFailed      = "failed"      // authentication failed, e.g. after lost segments
+	ResultUnsupported = "unsupported" // protocol version or cipher suite
+)
+
+const (
+	// maxResumptions bounds the TLS 1.2 sessions whose master secret,
+	// recovered with a private key, is kept for resumption.
+	maxResumptions = 10000
+
+	// maxBuffered bounds the bytes buffered per direction for a record or
+	// handshake message; larger ones are treated as a lost record boundary.
+	maxBuffered = 1 << 18
+)
+
+// Config configures a Decryptor.
+type Config struct {
+	Ports       []uint16      // TCP ports carrying TLS (default 5061)
+	KeyLogFile  string        // SSLKEYLOGFILE written by an endpoint; read as it grows
+	PrivateKeys []string      // PEM files with RSA server keys
+	MaxConns    int           // tracked connections (default 10000)
+	IdleTimeout time.Duration // forget idle connections (default 10m)
+}
+
+// Plaintext is the application data decrypted from one TCP segment.
+type Plaintext struct {
+	Data        []byte
+	Version     string // "1.2" or "1.3"
+	CipherSuite string // IANA name, e.g. "TLS_AES_128_GCM_SHA256"
+}
+
+// Decryptor decrypts the TLS connections of one task. It is shared by the
+// task's pipelines and safe for concurrent use.
+type Decryptor struct {
+	ports   map[uint16]bool
+	keyLog  *keyLog // nil without keylog_file
+	rsaKeys []*rsa.PrivateKey
+
+	records map[string]prometheus.Counter // by result
+
+	mu          sync.Mutex
+	conns       *idletable.Table[tcpconn.Key, *conn]
+	resumptions map[string][]byte // TLS 1.2 session ID → master secret
+}
+
+// New creates a decryptor for a task and loads its private keys. A key log
+// that does not exist yet is read once the endpoint creates it.
+func New(taskID string, cfg Config) (*Decryptor, error) {
+	ports := cfg.Ports
+	if len(ports) == 0 {
+		ports = []uint16{DefaultPort}
+	}
+	maxConns, idle := cfg.MaxConns, cfg.IdleTimeout
+	if maxConns <= 0 {
+		maxConns = DefaultMaxConns
+	}
+	if idle <= 0 {
+		idle = DefaultIdleTimeout
+	}
+	d := &Decryptor{
+		ports:       make(map[uint16]bool, len(ports)),
+		records:     make(map[string]prometheus.Counter),
+		conns:       tcpconn.NewTable[*conn](maxConns, idle),
+		resumptions: make(map[string][]byte),
+	}
+	for _, port := range ports {
+		d.ports[port] = true
+	}
+	for _, result := range []string{ResultDecrypted, ResultNoKey, ResultFailed, ResultUnsupported} {
+		d.records[result] = metrics.TLSRecordsTotal.WithLabelValues(taskID, result)
+	}
+
+	for _, file := range cfg.PrivateKeys {
+		key, err := loadRSAKey(file)
+		if err != nil {
+			return nil, err
+		}
+		d.rsaKeys = append(d.rsaKeys, key)
+	}
+	if cfg.KeyLogFile != "" {
+		if _, err := os.Stat(cfg.KeyLogFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("keylog_file: %w", err)
+		}
+		d.keyLog = newKeyLog(cfg.KeyLogFile)
+		d.keyLog.refresh(time.Now())
+	}
+	return d, nil
+}
+
+// loadRSAKey reads a PKCS #1 or PKCS #8 RSA private key from a PEM file.
+func loadRSAKey(file string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("private key %s: no PEM data", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private key %s: %w", file, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s: %T is not an RSA key; only RSA key exchange can be decrypted with a private key", file, parsed)
+	}
+	return key, nil
+}
+
+// Decrypt feeds a TCP segment on a TLS port into its connection.
+//
+// ok is false for packets Decrypt leaves alone: not TCP on a TLS port,
+// without payload, or carrying application data that cannot be decrypted.
+// Otherwise pt.Data holds the plaintext of the application data records the
+// segment completes, empty if it carried none (handshake messages, alerts,
+// part of a record, retransmitted bytes).
+func (d *Decryptor) Decrypt(pkt *core.DecodedPacket) (pt Plaintext, ok bool) {
+	tr := &pkt.Transport
+	if tr.Protocol != 6 || !(d.ports[tr.SrcPort] || d.ports[tr.DstPort]) {
+		return Plaintext{}, false
+	}
+	now := pkt.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	key, dir := tcpconn.KeyOf(pkt)
+	flags := tr.TCPFlags
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	state, created := d.conns.Touch(key, now)
+	if state == nil {
+		return Plaintext{}, false
+	}
+	if created || flags&(tcpconn.FlagSYN|tcpconn.FlagACK) == tcpconn.FlagSYN {
+		// A SYN starts over: the 4-tuple may be reused by a new connection
+		*state = newConn()
+	}
+	c := *state
+
+	h := &c.dirs[dir]
+	if flags&tcpconn.FlagSYN != 0 {
+		h.started, h.next = true, tr.SeqNum+1
+	}
+	if flags&tcpconn.FlagRST != 0 {
+		d.conns.Delete(key)
+		return Plaintext{}, false
+	}
+	if flags&tcpconn.FlagFIN != 0 {
+		h.fin = true
+		if c.dirs[1-dir].fin {
+			defer d.conns.Delete(key)
+		}
+	}
+	if len(pkt.Payload) == 0 {
+		return Plaintext{}, false
+	}
+
+	data := h.accept(tr.SeqNum, pkt.Payload)
+	out, undecrypted := d.feed(c, dir, data, now)
+	switch {
+	case len(out) > 0:
+		return Plaintext{Data: out, Version: c.versionName(), CipherSuite: tls.CipherSuiteName(c.suiteID)}, true
+	case undecrypted:
+		return Plaintext{}, false
+	}
+	return Plaintext{}, true
+}
+
+// remember keeps the master secret of a TLS 1.2 session for resumption.
+// The caller holds d.mu.
+func (d *Decryptor) remember(sessionID, master []byte) {
+	if len(sessionID) == 0 {
+		return
+	}
+	if len(d.resumptions) >= maxResumptions {
+		for id := range d.resumptions {
+			delete(d.resumptions, id)
+			if len(d.resumptions) < maxResumptions/2 {
+				break
+			}
+		}
+	}
+	d.resumptions[string(sessionID)] = master
+}
+
+// Len returns the number of tracked connections.
+func (d *Decryptor) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.conns.Len()
+}
+
+func (d *Decryptor) count(result string) {
+	d.records[result].Inc()
+}
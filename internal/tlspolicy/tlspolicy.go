@@ -0,0 +1,157 @@
+// Package tlspolicy builds client TLS configurations from the agent-wide
+// TLS policy (otus.tls), so every outbound connection uses the same minimum
+// version, cipher suites and trust settings.
+package tlspolicy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// fipsCipherSuites are the FIPS 140 approved TLS 1.2 suites supported by Go:
+// ECDHE key exchange with AES-GCM.
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the FIPS 140 approved key exchange curves.
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// Policy is a parsed TLS policy. A nil *Policy applies Go defaults.
+type Policy struct {
+	minVersion   uint16
+	cipherSuites []uint16
+	curves       []tls.CurveID
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+}
+
+// New parses cfg, loading the CA bundle and client certificate it names.
+func New(cfg config.TLSPolicyConfig) (*Policy, error) {
+	p := &Policy{minVersion: tls.VersionTLS12}
+	if cfg.MinVersion == "1.3" {
+		p.minVersion = tls.VersionTLS13
+	}
+
+	for _, name := range cfg.CipherSuites {
+		id, ok := cipherSuiteID(name)
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown or insecure cipher suite %q", name)
+		}
+		p.cipherSuites = append(p.cipherSuites, id)
+	}
+
+	if cfg.FIPS {
+		if len(p.cipherSuites) == 0 {
+			p.cipherSuites = fipsCipherSuites
+		}
+		for _, id := range p.cipherSuites {
+			if !slices.Contains(fipsCipherSuites, id) {
+				return nil, fmt.Errorf("tls: cipher suite %s is not FIPS approved", tls.CipherSuiteName(id))
+			}
+		}
+		p.curves = fipsCurves
+	}
+
+	if cfg.CACert != "" {
+		pool, err := loadCAs(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		p.rootCAs = pool
+	}
+
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %w", err)
+		}
+		p.certificates = []tls.Certificate{cert}
+	}
+
+	return p, nil
+}
+
+// Client returns the client tls.Config for a connection, or nil when the
+// connection does not enable TLS. The connection's CA bundle and client
+// certificate, when set, replace the policy defaults; version, cipher suites
+// and curves always come from the policy.
+func (p *Policy) Client(conn config.TLSConfig) (*tls.Config, error) {
+	if !conn.Enabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: conn.InsecureSkipVerify,
+	}
+	if p != nil {
+		cfg.MinVersion = p.minVersion
+		cfg.CipherSuites = p.cipherSuites
+		cfg.CurvePreferences = p.curves
+		cfg.RootCAs = p.rootCAs
+		cfg.Certificates = p.certificates
+	}
+
+	if conn.CACert != "" {
+		pool, err := loadCAs(conn.CACert)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if conn.ClientCert != "" || conn.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(conn.ClientCert, conn.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// ParseConn reads a connection's TLS settings from a plugin config map
+// (the "tls" key of a reporter config), using the same keys as TLSConfig.
+func ParseConn(m map[string]any) config.TLSConfig {
+	var c config.TLSConfig
+	if m == nil {
+		return c
+	}
+	c.Enabled, _ = m["enabled"].(bool)
+	c.CACert, _ = m["ca_cert"].(string)
+	c.ClientCert, _ = m["client_cert"].(string)
+	c.ClientKey, _ = m["client_key"].(string)
+	c.InsecureSkipVerify, _ = m["insecure_skip_verify"].(bool)
+	return c
+}
+
+// cipherSuiteID resolves a suite name among Go's secure TLS 1.2 suites.
+func cipherSuiteID(name string) (uint16, bool) {
+	for _, s := range tls.CipherSuites() {
+		if s.Name == name && slices.Contains(s.SupportedVersions, tls.VersionTLS12) {
+			return s.ID, true
+		}
+	}
+	return 0, false
+}
+
+func loadCAs(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tls: read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("tls: no certificates in CA bundle %s", path)
+	}
+	return pool, nil
+}
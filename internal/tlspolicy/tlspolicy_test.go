@@ -0,0 +1,155 @@
+package tlspolicy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/config"
+)
+
+// writeCert writes a self-signed certificate and its key as PEM files.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "otus-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestClient_Disabled(t *testing.T) {
+	p, err := New(config.TLSPolicyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := p.Client(config.TLSConfig{})
+	if err != nil || cfg != nil {
+		t.Errorf("Client(disabled) = %v, %v; want nil, nil", cfg, err)
+	}
+}
+
+func TestClient_NilPolicy(t *testing.T) {
+	var p *Policy
+	cfg, err := p.Client(config.TLSConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+	}
+}
+
+func TestClient_AppliesPolicy(t *testing.T) {
+	certFile, keyFile := writeCert(t)
+	p, err := New(config.TLSPolicyConfig{
+		MinVersion:   "1.3",
+		CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		CACert:       certFile,
+		ClientCert:   certFile,
+		ClientKey:    keyFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := p.Client(config.TLSConfig{Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want TLS 1.3", cfg.MinVersion)
+	}
+	if len(cfg.CipherSuites) != 1 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384 {
+		t.Errorf("CipherSuites = %v", cfg.CipherSuites)
+	}
+	if cfg.RootCAs == nil || len(cfg.Certificates) != 1 {
+		t.Errorf("policy CA bundle or client certificate not applied")
+	}
+}
+
+func TestClient_ConnectionOverridesCA(t *testing.T) {
+	policyCA, _ := writeCert(t)
+	connCA, _ := writeCert(t)
+	p, err := New(config.TLSPolicyConfig{CACert: policyCA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := p.Client(config.TLSConfig{Enabled: true, CACert: connCA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RootCAs.Equal(p.rootCAs) {
+		t.Error("connection ca_cert did not replace the policy CA bundle")
+	}
+}
+
+func TestNew_FIPS(t *testing.T) {
+	p, err := New(config.TLSPolicyConfig{FIPS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _ := p.Client(config.TLSConfig{Enabled: true})
+	if len(cfg.CipherSuites) != len(fipsCipherSuites) || len(cfg.CurvePreferences) != len(fipsCurves) {
+		t.Errorf("FIPS suites/curves not applied: %v %v", cfg.CipherSuites, cfg.CurvePreferences)
+	}
+
+	_, err = New(config.TLSPolicyConfig{FIPS: true, CipherSuites: []string{"TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"}})
+	if err == nil || !strings.Contains(err.Error(), "not FIPS approved") {
+		t.Errorf("error = %v, want not FIPS approved", err)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	for _, cfg := range []config.TLSPolicyConfig{
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{CipherSuites: []string{"TLS_AES_128_GCM_SHA256"}}, // TLS 1.3 suites are not configurable
+		{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded, want error", cfg)
+		}
+	}
+}
+
+func TestParseConn(t *testing.T) {
+	c := ParseConn(map[string]any{"enabled": true, "ca_cert": "/ca.pem", "insecure_skip_verify": true})
+	if !c.Enabled || c.CACert != "/ca.pem" || !c.InsecureSkipVerify {
+		t.Errorf("ParseConn = %+v", c)
+	}
+}
@@ -0,0 +1,214 @@
+// Package topk implements streaming heavy-hitter tracking.
+//
+// Each tracked key (a label such as sip.user_agent, or the source address)
+// keeps a space-saving sketch: a fixed number of counters that always holds
+// every value seen more than packets/capacity times, so "who is hammering us"
+// is answerable from the agent in bounded memory, however many distinct
+// values the traffic carries.
+package topk
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// Defaults for TopKConfig fields left unset.
+const (
+	DefaultK = 10
+
+	// capacityFactor sizes a sketch relative to k when capacity is unset.
+	capacityFactor = 10
+	minCapacity    = 100
+)
+
+// Item is a heavy hitter. Count may overestimate the true count by at most
+// Error; Count-Error is a guaranteed lower bound.
+type Item struct {
+	Value string `json:"value"`
+	Count uint64 `json:"count"`
+	Error uint64 `json:"error"`
+}
+
+// Summary is a snapshot of a tracker.
+type Summary struct {
+	Since   time.Time         `json:"since"`
+	Packets uint64            `json:"packets"` // packets observed
+	Keys    map[string][]Item `json:"keys"`    // key → top items, highest count first
+}
+
+// Tracker tracks the heavy hitters of several keys of one task.
+// It is safe for concurrent use.
+type Tracker struct {
+	keys     []string
+	k        int
+	capacity int
+
+	mu       sync.Mutex
+	since    time.Time
+	packets  uint64
+	sketches map[string]*sketch
+}
+
+// NewTracker creates a tracker reporting the top k values of each key, with
+// capacity counters per key (0 = max(10*k, 100)).
+func NewTracker(keys []string, k, capacity int) *Tracker {
+	if k <= 0 {
+		k = DefaultK
+	}
+	if capacity <= 0 {
+		capacity = max(capacityFactor*k, minCapacity)
+	}
+	capacity = max(capacity, k)
+
+	t := &Tracker{keys: keys, k: k, capacity: capacity}
+	t.reset()
+	return t
+}
+
+// Keys returns the tracked keys.
+func (t *Tracker) Keys() []string {
+	return t.keys
+}
+
+func (t *Tracker) reset() {
+	t.since = time.Now()
+	t.packets = 0
+	t.sketches = make(map[string]*sketch, len(t.keys))
+	for _, key := range t.keys {
+		t.sketches[key] = newSketch(t.capacity)
+	}
+}
+
+// Observe counts one output packet.
+func (t *Tracker) Observe(pkt *core.OutputPacket) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.packets++
+	for _, key := range t.keys {
+		if v := pkt.Value(key); v != "" {
+			t.sketches[key].add(v)
+		}
+	}
+}
+
+// Top returns up to n heavy hitters of key (n <= 0 = k), highest count first.
+func (t *Tracker) Top(key string, n int) []Item {
+	if n <= 0 || n > t.k {
+		n = t.k
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sketches[key]
+	if !ok {
+		return nil
+	}
+	return s.top(n)
+}
+
+// Snapshot returns the top k of every key; reset restarts counting afterwards.
+func (t *Tracker) Snapshot(reset bool) Summary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sum := Summary{
+		Since:   t.since,
+		Packets: t.packets,
+		Keys:    make(map[string][]Item, len(t.keys)),
+	}
+	for _, key := range t.keys {
+		sum.Keys[key] = t.sketches[key].top(t.k)
+	}
+	if reset {
+		t.reset()
+	}
+	return sum
+}
+
+// sketch is a space-saving sketch (Metwally et al.): when all counters are
+// taken, a new value replaces the smallest counter and inherits its count as
+// overestimation error. Counters sit in a min-heap, so both cases are O(log n).
+type sketch struct {
+	capacity int
+	index    map[string]*counter
+	heap     counterHeap
+}
+
+type counter struct {
+	value string
+	count uint64
+	err   uint64
+	pos   int // heap index
+}
+
+func newSketch(capacity int) *sketch {
+	return &sketch{capacity: capacity, index: make(map[string]*counter, capacity)}
+}
+
+func (s *sketch) add(v string) {
+	if c, ok := s.index[v]; ok {
+		c.count++
+		heap.Fix(&s.heap, c.pos)
+		return
+	}
+	if len(s.heap) < s.capacity {
+		c := &counter{value: v, count: 1}
+		s.index[v] = c
+		heap.Push(&s.heap, c)
+		return
+	}
+	// Evict the smallest counter; its count bounds the new value's error.
+	c := s.heap[0]
+	delete(s.index, c.value)
+	c.value, c.err = v, c.count
+	c.count++
+	s.index[v] = c
+	heap.Fix(&s.heap, 0)
+}
+
+func (s *sketch) top(n int) []Item {
+	items := make([]Item, len(s.heap))
+	for i, c := range s.heap {
+		items[i] = Item{Value: c.value, Count: c.count, Error: c.err}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Value < items[j].Value
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
+
+// counterHeap is a min-heap of counters by count.
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *counterHeap) Push(x any) {
+	c := x.(*counter)
+	c.pos = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *counterHeap) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,71 @@
+package topk
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker([]string{core.KeySrcIP, "sip.user_agent"}, 2, 4)
+
+	observe := func(src, ua string, n int) {
+		for i := 0; i < n; i++ {
+			tr.Observe(&core.OutputPacket{
+				SrcIP:  netip.MustParseAddr(src),
+				Labels: core.Labels{"sip.user_agent": ua},
+			})
+		}
+	}
+	observe("10.0.0.1", "friendly-scanner", 50)
+	observe("10.0.0.2", "Asterisk", 20)
+	// Many one-off sources churn the small sketch but cannot displace the
+	// heavy hitters.
+	for i := 0; i < 30; i++ {
+		observe(fmt.Sprintf("192.168.0.%d", i), "", 1)
+	}
+
+	top := tr.Top(core.KeySrcIP, 0)
+	if len(top) != 2 || top[0].Value != "10.0.0.1" || top[1].Value != "10.0.0.2" {
+		t.Fatalf("top src_ip = %+v, want 10.0.0.1, 10.0.0.2", top)
+	}
+	if top[0].Count-top[0].Error > 50 || top[0].Count < 50 {
+		t.Errorf("10.0.0.1 count = %d±%d, want bounds around 50", top[0].Count, top[0].Error)
+	}
+
+	// Packets without the label are not counted for it.
+	ua := tr.Top("sip.user_agent", 1)
+	if len(ua) != 1 || ua[0] != (Item{Value: "friendly-scanner", Count: 50}) {
+		t.Errorf("top user agent = %+v", ua)
+	}
+	if tr.Top("sip.method", 0) != nil {
+		t.Error("untracked key returned items")
+	}
+
+	s := tr.Snapshot(true)
+	if s.Packets != 100 || len(s.Keys[core.KeySrcIP]) != 2 {
+		t.Errorf("snapshot = %+v", s)
+	}
+	if s := tr.Snapshot(false); s.Packets != 0 || len(s.Keys[core.KeySrcIP]) != 0 {
+		t.Errorf("snapshot after reset = %+v, want empty", s)
+	}
+}
+
+func TestSketchErrorBound(t *testing.T) {
+	s := newSketch(3)
+	for _, v := range []string{"a", "a", "a", "b", "c", "d"} {
+		s.add(v)
+	}
+	// "d" evicted the smallest counter (count 1) and inherits it as error.
+	items := s.top(3)
+	if items[0] != (Item{Value: "a", Count: 3}) {
+		t.Errorf("top = %+v", items[0])
+	}
+	for _, it := range items[1:] {
+		if it.Value == "d" && (it.Count != 2 || it.Error != 1) {
+			t.Errorf("d = %+v, want count 2 error 1", it)
+		}
+	}
+}
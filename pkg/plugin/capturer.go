@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/prefilter"
 )
 
 // Capturer captures raw packets from network interface.
@@ -16,7 +17,33 @@ type Capturer interface {
 
 // CaptureStats represents capture statistics.
 type CaptureStats struct {
-	PacketsReceived  uint64
-	PacketsDropped   uint64
-	PacketsIfDropped uint64
+	PacketsReceived    uint64
+	PacketsDropped     uint64
+	PacketsIfDropped   uint64
+	PacketsPrefiltered uint64 // dropped in the kernel by the prefilter
+}
+
+// QueueAware is an optional interface for capturers that read one of several
+// receive queues. Before Init, capturer i of count is told SetQueue(i, count):
+// in binding mode count equals the number of pipelines and the queue read by
+// capturer i feeds pipeline i; in dispatch mode the single capturer gets (0, 1).
+type QueueAware interface {
+	SetQueue(index, count int)
+}
+
+// RateCapAware is an optional interface for capturers that can hold a
+// packets-per-second cap themselves, as cheaply as they can: e.g. by sampling
+// in the kernel or by reading their ring no faster than the cap and leaving
+// the excess to be dropped before it is copied. SetMaxPPS may be called
+// before Init and at any time while Capture runs; 0 removes the cap.
+type RateCapAware interface {
+	SetMaxPPS(pps uint64)
+}
+
+// PrefilterAware is an optional interface for capturers that can drop the
+// traffic outside a task's capture.prefilter in the kernel and count it in
+// CaptureStats.PacketsPrefiltered. SetPrefilter is called before Init; a task
+// with a prefilter fails to start when its capturer does not implement it.
+type PrefilterAware interface {
+	SetPrefilter(rules *prefilter.Rules)
 }
@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Flow is the canonical bidirectional state of a stream. The SIP parser
+// registers one Flow under both directional FlowKeys of a media stream, so
+// the packets seen under either key are counted in the same object and a
+// report can describe the stream from both sides.
+//
+// Key is the forward direction (for media, offerer to answerer); packets
+// under the reversed key count as reverse. Context is read-only once the
+// Flow is registered; WithContext replaces it. The statistics are safe for
+// concurrent use by the pipelines of a task.
+type Flow struct {
+	Key     FlowKey
+	Context map[string]string // e.g. call_id, codec, media_state
+
+	counters *flowCounters
+}
+
+type flowCounters struct {
+	forward, reverse flowDirection
+	firstSeen        atomic.Int64 // unix nanoseconds, 0 = no packet yet
+}
+
+type flowDirection struct {
+	packets  atomic.Uint64
+	bytes    atomic.Uint64
+	lastSeen atomic.Int64 // unix nanoseconds
+}
+
+// FlowDirectionStats are the statistics of one direction of a Flow.
+type FlowDirectionStats struct {
+	Packets  uint64    `json:"packets"`
+	Bytes    uint64    `json:"bytes"`
+	LastSeen time.Time `json:"last_seen,omitzero"`
+}
+
+// FlowStats is a snapshot of a Flow's statistics.
+type FlowStats struct {
+	Forward   FlowDirectionStats `json:"forward"`
+	Reverse   FlowDirectionStats `json:"reverse"`
+	FirstSeen time.Time          `json:"first_seen,omitzero"`
+	LastSeen  time.Time          `json:"last_seen,omitzero"`
+}
+
+// NewFlow returns a Flow with forward direction key and call context ctx.
+func NewFlow(key FlowKey, ctx map[string]string) *Flow {
+	return &Flow{Key: key, Context: ctx, counters: new(flowCounters)}
+}
+
+// WithContext returns a Flow with the same key and statistics as f and call
+// context ctx, e.g. when a re-INVITE changes the media state of a stream.
+func (f *Flow) WithContext(ctx map[string]string) *Flow {
+	return &Flow{Key: f.Key, Context: ctx, counters: f.counters}
+}
+
+// Reverse returns the FlowKey of the opposite direction.
+func (k FlowKey) Reverse() FlowKey {
+	return FlowKey{
+		SrcIP:   k.DstIP,
+		DstIP:   k.SrcIP,
+		SrcPort: k.DstPort,
+		DstPort: k.SrcPort,
+		Proto:   k.Proto,
+	}
+}
+
+// IsForward reports whether key is the Flow's forward direction.
+func (f *Flow) IsForward(key FlowKey) bool {
+	return key == f.Key
+}
+
+// Observe counts a packet of size bytes seen under key at now.
+func (f *Flow) Observe(key FlowKey, size int, now time.Time) {
+	c := f.counters
+	d := &c.reverse
+	if f.IsForward(key) {
+		d = &c.forward
+	}
+	ns := now.UnixNano()
+	d.packets.Add(1)
+	d.bytes.Add(uint64(size))
+	d.lastSeen.Store(ns)
+	c.firstSeen.CompareAndSwap(0, ns)
+}
+
+// Stats returns a snapshot of the Flow's statistics.
+func (f *Flow) Stats() FlowStats {
+	s := FlowStats{
+		Forward:   f.counters.forward.stats(),
+		Reverse:   f.counters.reverse.stats(),
+		FirstSeen: unixNano(f.counters.firstSeen.Load()),
+	}
+	s.LastSeen = s.Forward.LastSeen
+	if s.Reverse.LastSeen.After(s.LastSeen) {
+		s.LastSeen = s.Reverse.LastSeen
+	}
+	return s
+}
+
+func (d *flowDirection) stats() FlowDirectionStats {
+	return FlowDirectionStats{
+		Packets:  d.packets.Load(),
+		Bytes:    d.bytes.Load(),
+		LastSeen: unixNano(d.lastSeen.Load()),
+	}
+}
+
+func unixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// FlowContext returns the call context of a FlowRegistry value: the Context
+// of a *Flow or a plain map[string]string.
+func FlowContext(value any) (map[string]string, bool) {
+	switch v := value.(type) {
+	case *Flow:
+		return v.Context, true
+	case map[string]string:
+		return v, true
+	}
+	return nil, false
+}
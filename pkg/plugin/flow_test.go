@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestFlow_Stats(t *testing.T) {
+	fwd := FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 4000, DstPort: 5000, Proto: 17}
+	rev := fwd.Reverse()
+	if rev.SrcPort != 5000 || rev.DstIP != fwd.SrcIP || rev.Reverse() != fwd {
+		t.Fatalf("Reverse() = %+v", rev)
+	}
+
+	f := NewFlow(fwd, map[string]string{"call_id": "c1"})
+	if s := f.Stats(); !s.FirstSeen.IsZero() || s.Forward.Packets != 0 {
+		t.Errorf("stats of a new flow = %+v", s)
+	}
+
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	f.Observe(fwd, 172, base)
+	f.Observe(rev, 60, base.Add(time.Second))
+	f.Observe(fwd, 172, base.Add(2*time.Second))
+
+	// A new context keeps the key and the statistics.
+	g := f.WithContext(map[string]string{"call_id": "c1", "media_state": "confirmed"})
+	g.Observe(rev, 60, base.Add(3*time.Second))
+
+	s := f.Stats()
+	if s.Forward.Packets != 2 || s.Forward.Bytes != 344 || !s.Forward.LastSeen.Equal(base.Add(2*time.Second)) {
+		t.Errorf("forward = %+v", s.Forward)
+	}
+	if s.Reverse.Packets != 2 || s.Reverse.Bytes != 120 {
+		t.Errorf("reverse = %+v", s.Reverse)
+	}
+	if !s.FirstSeen.Equal(base) || !s.LastSeen.Equal(base.Add(3*time.Second)) {
+		t.Errorf("first/last seen = %v / %v", s.FirstSeen, s.LastSeen)
+	}
+	if g.Key != fwd || g.Context["media_state"] != "confirmed" || f.Context["media_state"] != "" {
+		t.Errorf("WithContext = %+v", g)
+	}
+}
+
+func TestFlowContext(t *testing.T) {
+	ctx := map[string]string{"call_id": "c1"}
+	for _, value := range []any{ctx, NewFlow(FlowKey{}, ctx)} {
+		if got, ok := FlowContext(value); !ok || got["call_id"] != "c1" {
+			t.Errorf("FlowContext(%T) = %v, %v", value, got, ok)
+		}
+	}
+	if _, ok := FlowContext("state"); ok {
+		t.Error("FlowContext accepted a string")
+	}
+}
@@ -1,9 +1,23 @@
 // Package plugin defines the plugin lifecycle interface.
 package plugin
 
-import "context"
+import (
+	"context"
+
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/tlspolicy"
+)
 
 // Plugin is the base interface for all plugins.
+//
+// Errors of Init, Start and the per-type methods (Capture, Handle, Report)
+// should wrap a category sentinel (core.ErrTransient, core.ErrConfig,
+// core.ErrFatal) where the plugin knows it, e.g.
+//
+//	fmt.Errorf("dial %q: %w: %w", addr, core.ErrTransient, err)
+//
+// Task failures, reporter retries, the restart of failed tasks and command
+// responses act on the category; Init errors without one count as config.
 type Plugin interface {
 	Name() string
 	Init(cfg map[string]any) error
@@ -25,3 +39,34 @@ type Pausable interface {
 type Reconfigurable interface {
 	Reconfigure(cfg map[string]any) error
 }
+
+// TaskAware is an optional interface for parsers, processors and reporters
+// that label their own metrics by task. The task ID is set during the Wire
+// phase, for reporters before Init.
+type TaskAware interface {
+	SetTaskID(taskID string)
+}
+
+// TLSPolicyAware is an optional interface for plugins that open outbound TLS
+// connections. The agent-wide TLS policy (otus.tls) is set before Init, so
+// Init can build its connections from it; the policy may be nil.
+type TLSPolicyAware interface {
+	SetTLSPolicy(p *tlspolicy.Policy)
+}
+
+// FeatureFlagAware is an optional interface for plugins with code paths
+// gated by the task's runtime feature flags. The flags are set before Init
+// and may change at any time afterwards (flag_set), so plugins check them
+// where they take effect rather than caching the value.
+type FeatureFlagAware interface {
+	SetFeatureFlags(flags *featureflag.Set)
+}
+
+// HealthChecker is an optional interface for plugins that can verify, while
+// running, what they only checked at Start: a capturer that its interface is
+// still present and up, a reporter that its collectors still accept
+// connections. The periodic self-audit (otus.audit) calls it with a deadline;
+// a non-nil error marks the plugin degraded until a later check passes.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
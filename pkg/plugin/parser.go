@@ -3,6 +3,7 @@ package plugin
 
 import (
 	"net/netip"
+	"time"
 
 	"firestige.xyz/otus/internal/core"
 )
@@ -25,6 +26,14 @@ type FlowRegistry interface {
 	Clear()
 }
 
+// FlowActivity is an optional interface of a FlowRegistry that records when
+// packets of a registered flow were last seen. The RTP parser touches media
+// flows so the task can detect streams that stop while their call is up.
+type FlowActivity interface {
+	Touch(key FlowKey, now time.Time)
+	LastSeen(key FlowKey) (time.Time, bool)
+}
+
 // FlowKey uniquely identifies a network flow using 5-tuple.
 type FlowKey struct {
 	SrcIP   netip.Addr
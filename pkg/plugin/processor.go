@@ -1,10 +1,24 @@
 // Package plugin defines plugin interfaces.
 package plugin
 
-import "firestige.xyz/otus/internal/core"
+import (
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
 
 // Processor processes output packets.
 type Processor interface {
 	Plugin
 	Process(pkt *core.OutputPacket) (keep bool)
 }
+
+// FlushingProcessor is an optional interface for processors that hold packets
+// back and later release packets of their own, e.g. aggregates. The pipeline
+// calls Flush from its own goroutine, so never concurrently with Process:
+// about once per second, and with final set when its input closes. Returned
+// packets continue through the processors after this one.
+type FlushingProcessor interface {
+	Processor
+	Flush(now time.Time, final bool) []core.OutputPacket
+}
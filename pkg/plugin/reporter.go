@@ -22,3 +22,15 @@ type BatchReporter interface {
 	Reporter
 	ReportBatch(ctx context.Context, pkts []*core.OutputPacket) error
 }
+
+// PendingReporter is an optional interface for reporters that hold output
+// beyond Report, e.g. flows awaiting export. Pending returns the number of
+// buffered items not yet delivered; a task reads it around its final Flush
+// to report how much was flushed and how much was left behind. Reporters
+// that deliver within Report and ReportBatch (kafka, hep) hold nothing once
+// the task's last batches are delivered, before that Flush, and do not
+// implement it.
+type PendingReporter interface {
+	Reporter
+	Pending() int
+}
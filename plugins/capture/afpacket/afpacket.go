@@ -1,3 +1,5 @@
+//go:build linux
+
 // Package afpacket implements AF_PACKET_V3 capture plugin.
 package afpacket
 
@@ -12,8 +14,14 @@ import (
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
 
+	"firestige.xyz/otus/internal/audit"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/ebpf"
+	"firestige.xyz/otus/internal/featureflag"
+	"firestige.xyz/otus/internal/prefilter"
+	"firestige.xyz/otus/internal/ratecap"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
@@ -45,15 +53,28 @@ type AFPacketCapturer struct {
 	name   string
 	config Config
 
+	// Task feature flags; zero_copy off copies each frame out of the ring
+	flags *featureflag.Set
+
+	// Packets-per-second cap held by sampling in the socket filter, 0 = none
+	maxPPS atomic.Uint64
+
+	// Prefilter rules run in the socket filter before bpf_filter, nil = none
+	prefilter *prefilter.Rules
+
 	// Runtime state
-	handle *afpacket.TPacket
-	ctx    context.Context
-	cancel context.CancelFunc
+	handle  *afpacket.TPacket
+	filter  []bpf.RawInstruction // compiled bpf_filter, nil = none
+	keep    float64              // fraction of packets the socket filter keeps
+	counter atomic.Pointer[prefilter.Counter]
+	ctx     context.Context
+	cancel  context.CancelFunc
 
 	// Statistics (atomic counters)
 	packetsReceived  atomic.Uint64
 	packetsDropped   atomic.Uint64
 	packetsIfDropped atomic.Uint64
+	prefiltered      atomic.Uint64 // prefilter drops when Capture returned
 }
 
 // NewAFPacketCapturer creates a new AF_PACKET capturer instance.
@@ -68,6 +89,24 @@ func (c *AFPacketCapturer) Name() string {
 	return c.name
 }
 
+// SetFeatureFlags implements plugin.FeatureFlagAware.
+func (c *AFPacketCapturer) SetFeatureFlags(flags *featureflag.Set) {
+	c.flags = flags
+}
+
+// SetMaxPPS implements plugin.RateCapAware: above the cap the socket filter
+// keeps a random sample of packets, so the excess is dropped in the kernel
+// before it reaches the ring.
+func (c *AFPacketCapturer) SetMaxPPS(pps uint64) {
+	c.maxPPS.Store(pps)
+}
+
+// SetPrefilter implements plugin.PrefilterAware: the rules run in an eBPF
+// socket filter ahead of bpf_filter, so dropped packets never reach the ring.
+func (c *AFPacketCapturer) SetPrefilter(rules *prefilter.Rules) {
+	c.prefilter = rules
+}
+
 // Init initializes the capturer with configuration.
 func (c *AFPacketCapturer) Init(cfg map[string]any) error {
 	// Parse configuration
@@ -145,6 +184,15 @@ func (c *AFPacketCapturer) Stop(ctx context.Context) error {
 	return nil
 }
 
+// HealthCheck implements plugin.HealthChecker: the interface must still be
+// present and up.
+func (c *AFPacketCapturer) HealthCheck(_ context.Context) error {
+	if c.config.Interface == "" {
+		return nil // all interfaces
+	}
+	return audit.CheckInterface(c.config.Interface)
+}
+
 // Capture captures packets from the network interface.
 // This is a blocking call that runs until ctx is cancelled or an error occurs.
 func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPacket) error {
@@ -160,7 +208,7 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 
 	handle, err := afpacket.NewTPacket(opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create TPacket handle: %w", err)
+		return fmt.Errorf("failed to create TPacket handle: %w: %w", core.ErrConfig, err)
 	}
 	c.handle = handle
 	defer func() {
@@ -185,13 +233,33 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 
 	slog.Info("afpacket capture started", "interface", c.config.Interface)
 
-	// Apply BPF filter if specified
+	// Apply the socket filter: prefilter rules and BPF filter if specified
+	c.filter, c.keep = nil, 1
 	if c.config.BPFFilter != "" {
-		if err := c.applyBPFFilter(); err != nil {
+		if c.filter, err = c.compileBPFFilter(); err != nil {
+			return fmt.Errorf("failed to apply BPF filter: %w: %w", core.ErrConfig, err)
+		}
+	}
+	if c.prefilter != nil {
+		counter, err := prefilter.NewCounter(1)
+		if err != nil {
+			return fmt.Errorf("afpacket: %w", err)
+		}
+		c.counter.Store(counter)
+		defer func() {
+			c.prefiltered.Store(counter.Load(0))
+			c.counter.Store(nil)
+			counter.Close()
+		}()
+	}
+	if c.filter != nil || c.prefilter != nil {
+		if err := c.setFilter(1); err != nil {
 			return fmt.Errorf("failed to apply BPF filter: %w", err)
 		}
-		slog.Debug("BPF filter applied", "filter", c.config.BPFFilter)
+		slog.Debug("BPF filter applied", "filter", c.config.BPFFilter, "prefilter", c.prefilter != nil)
 	}
+	var sampler ratecap.Sampler
+	lastUpdate := time.Now()
 
 	// Initialize socket stats
 	if err := c.handle.InitSocketStats(); err != nil {
@@ -214,6 +282,14 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 		default:
 		}
 
+		// Sampling follows the pps cap, re-checked every window slot.
+		if now := time.Now(); now.Sub(lastUpdate) >= ratecap.SlotDuration {
+			lastUpdate = now
+			if keep, changed := sampler.Update(now, c.maxPPS.Load()); changed {
+				c.setSampling(keep)
+			}
+		}
+
 		data, ci, err := c.handle.ZeroCopyReadPacketData()
 		if err != nil {
 			// On any read error, check context first (covers poll timeout, EAGAIN, etc.).
@@ -227,6 +303,7 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 
 		// Update statistics
 		c.packetsReceived.Add(1)
+		sampler.Observe(ci.Timestamp, 1)
 
 		// Update drop counters from socket stats
 		if socketStats, _, statsErr := c.handle.SocketStats(); statsErr == nil {
@@ -236,7 +313,12 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 		// Build RawPacket from zero-copy ring-buffer data.
 		// NOTE: data is only valid until the next ZeroCopyReadPacketData call;
 		// the pipeline must consume or copy it before we loop (same contract as
-		// the previous PacketSource NoCopy=true approach).
+		// the previous PacketSource NoCopy=true approach). With the zero_copy
+		// flag off the frame is copied, for ruling out ring reuse when chasing
+		// corrupted packets.
+		if !c.flags.Enabled(featureflag.ZeroCopy) {
+			data = append([]byte(nil), data...)
+		}
 		raw := core.RawPacket{
 			Data:           data,
 			Timestamp:      ci.Timestamp,
@@ -262,12 +344,12 @@ func (c *AFPacketCapturer) Capture(ctx context.Context, output chan<- core.RawPa
 	}
 }
 
-// applyBPFFilter compiles and applies a BPF filter to the capture handle.
-func (c *AFPacketCapturer) applyBPFFilter() error {
+// compileBPFFilter compiles the BPF filter of the configuration.
+func (c *AFPacketCapturer) compileBPFFilter() ([]bpf.RawInstruction, error) {
 	// Compile BPF filter using pcap (returns pcap.BPFInstruction slice)
 	pcapInsns, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, c.config.SnapLen, c.config.BPFFilter)
 	if err != nil {
-		return fmt.Errorf("failed to compile BPF filter %q: %w", c.config.BPFFilter, err)
+		return nil, fmt.Errorf("failed to compile BPF filter %q: %w", c.config.BPFFilter, err)
 	}
 
 	// Convert pcap.BPFInstruction to bpf.RawInstruction
@@ -282,21 +364,68 @@ func (c *AFPacketCapturer) applyBPFFilter() error {
 		}
 	}
 
-	// Apply to TPacket handle
-	if err := c.handle.SetBPF(rawInsns); err != nil {
-		return fmt.Errorf("failed to set BPF: %w", err)
+	return rawInsns, nil
+}
+
+// setFilter attaches the socket filter keeping a keep fraction of the
+// packets accepted by the prefilter rules and bpf_filter. Without rules it
+// is a classic filter; with them an eBPF program counting the packets the
+// rules drop.
+func (c *AFPacketCapturer) setFilter(keep float64) error {
+	prog, err := ratecap.SampleFilter(keep, c.filter)
+	if err != nil {
+		return err
+	}
+	counter := c.counter.Load()
+	if counter == nil {
+		if err := c.handle.SetBPF(prog); err != nil {
+			return fmt.Errorf("failed to set BPF: %w", err)
+		}
+		return nil
 	}
 
+	insns, err := c.prefilter.SocketProgram(counter, prog)
+	if err != nil {
+		return err
+	}
+	fd, err := ebpf.LoadProgram(unix.BPF_PROG_TYPE_SOCKET_FILTER, "otus_prefilter", insns)
+	if err != nil {
+		return fmt.Errorf("failed to load prefilter: %w", err)
+	}
+	defer unix.Close(fd) // the socket holds the attached program
+	if err := c.handle.SetEBPF(int32(fd)); err != nil {
+		return fmt.Errorf("failed to attach prefilter: %w", err)
+	}
 	return nil
 }
 
+// setSampling replaces the socket filter with one keeping a keep fraction of
+// the packets bpf_filter accepts. On failure the current filter stays.
+func (c *AFPacketCapturer) setSampling(keep float64) {
+	if err := c.setFilter(keep); err != nil {
+		slog.Warn("afpacket failed to set sampling filter",
+			"interface", c.config.Interface, "keep", keep, "error", err)
+		return
+	}
+	slog.Info("afpacket sampling to hold max_pps",
+		"interface", c.config.Interface, "max_pps", c.maxPPS.Load(),
+		"keep", fmt.Sprintf("%.3f", keep), "previous_keep", fmt.Sprintf("%.3f", c.keep))
+	c.keep = keep
+}
+
 // Stats returns capture statistics.
 func (c *AFPacketCapturer) Stats() plugin.CaptureStats {
-	return plugin.CaptureStats{
+	stats := plugin.CaptureStats{
 		PacketsReceived:  c.packetsReceived.Load(),
 		PacketsDropped:   c.packetsDropped.Load(),
 		PacketsIfDropped: c.packetsIfDropped.Load(),
 	}
+	if counter := c.counter.Load(); counter != nil {
+		stats.PacketsPrefiltered = counter.Load(0)
+	} else {
+		stats.PacketsPrefiltered = c.prefiltered.Load()
+	}
+	return stats
 }
 
 // parseFanoutType converts fanout type string to afpacket constant.
@@ -0,0 +1,267 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/audit"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/prefilter"
+	"firestige.xyz/otus/internal/ratecap"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	// pollTimeoutMs bounds how long an idle capturer takes to notice Stop.
+	pollTimeoutMs = 100
+	// statsInterval is how often the kernel drop counters are read.
+	statsInterval = time.Second
+)
+
+// AFXDPCapturer implements the Capturer interface using an AF_XDP socket.
+type AFXDPCapturer struct {
+	name   string
+	config Config
+	index  int
+	count  int
+
+	// Packets-per-second cap held by pacing reads from the RX ring, 0 = none
+	maxPPS atomic.Uint64
+
+	// Prefilter rules added to the XDP program, nil = none
+	prefilter *prefilter.Rules
+
+	// Runtime state
+	ctx    context.Context
+	cancel context.CancelFunc
+	prog   atomic.Pointer[xdpProgram] // while Capture runs, for Stats
+
+	// Statistics (atomic counters)
+	packetsReceived  atomic.Uint64
+	packetsDropped   atomic.Uint64
+	packetsIfDropped atomic.Uint64
+	prefiltered      atomic.Uint64 // prefilter drops when Capture returned
+}
+
+// NewAFXDPCapturer creates a new AF_XDP capturer instance.
+func NewAFXDPCapturer() plugin.Capturer {
+	return &AFXDPCapturer{
+		name:  pluginName,
+		count: 1,
+	}
+}
+
+// Name returns the plugin name.
+func (c *AFXDPCapturer) Name() string {
+	return c.name
+}
+
+// SetQueue implements plugin.QueueAware.
+func (c *AFXDPCapturer) SetQueue(index, count int) {
+	c.index, c.count = index, count
+}
+
+// SetMaxPPS implements plugin.RateCapAware: above the cap the capturer
+// stops reading the RX ring, so the excess is dropped by the kernel when the
+// ring is full and counted in PacketsIfDropped.
+func (c *AFXDPCapturer) SetMaxPPS(pps uint64) {
+	c.maxPPS.Store(pps)
+}
+
+// SetPrefilter implements plugin.PrefilterAware: the rules run in the XDP
+// program before the redirect, so dropped packets never reach the RX ring.
+func (c *AFXDPCapturer) SetPrefilter(rules *prefilter.Rules) {
+	c.prefilter = rules
+}
+
+// Init initializes the capturer with configuration.
+func (c *AFXDPCapturer) Init(cfg map[string]any) error {
+	config, err := parseConfig(cfg, c.index, c.count)
+	if err != nil {
+		return err
+	}
+	c.config = config
+
+	slog.Debug("afxdp initialized",
+		"interface", c.config.Interface,
+		"queue", c.config.queue(c.index),
+		"frames", c.config.Frames,
+		"fill_ring", c.config.FillRing,
+		"rx_ring", c.config.RxRing,
+		"zero_copy", c.config.ZeroCopy,
+		"xdp_mode", c.config.XDPMode)
+
+	return nil
+}
+
+// Start starts the capturer (no-op for afxdp, actual work in Capture).
+func (c *AFXDPCapturer) Start(ctx context.Context) error {
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+// Stop stops the capturer by cancelling the context. The socket and its
+// rings are released by Capture once its read loop has returned.
+func (c *AFXDPCapturer) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
+
+// HealthCheck implements plugin.HealthChecker: the interface must still be
+// present and up.
+func (c *AFXDPCapturer) HealthCheck(_ context.Context) error {
+	return audit.CheckInterface(c.config.Interface)
+}
+
+// Capture reads packets from the capturer's RX queue until ctx or the Start
+// context is cancelled.
+func (c *AFXDPCapturer) Capture(ctx context.Context, output chan<- core.RawPacket) error {
+	ifi, err := net.InterfaceByName(c.config.Interface)
+	if err != nil {
+		return fmt.Errorf("afxdp: %w", err)
+	}
+	queue := c.config.queue(c.index)
+
+	prog, err := acquireProgram(c.config.Interface, c.config.XDPMode, c.prefilter)
+	if err != nil {
+		return err
+	}
+	defer releaseProgram(c.config.Interface)
+	c.prog.Store(prog)
+	defer func() {
+		c.prefiltered.Store(prog.prefiltered(queue))
+		c.prog.Store(nil)
+	}()
+
+	// Zero-copy needs the program in the driver.
+	zeroCopy := c.config.ZeroCopy
+	if zeroCopy == zeroCopyAuto && prog.modeName() == xdpModeGeneric {
+		zeroCopy = zeroCopyOff
+	}
+	sock, err := c.open(ifi.Index, queue, zeroCopy)
+	if err != nil {
+		return err
+	}
+	defer sock.close()
+
+	if err := prog.register(queue, sock.fd); err != nil {
+		return err
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	done := ctx.Done()
+	var stopped <-chan struct{}
+	if c.ctx != nil {
+		stopped = c.ctx.Done()
+	}
+
+	slog.Info("afxdp capture started",
+		"interface", c.config.Interface,
+		"queue", queue,
+		"zero_copy", sock.zeroCopy,
+		"xdp_mode", prog.modeName())
+
+	// Frames go back to the fill ring as soon as a batch is read, so each
+	// packet is copied out of the UMEM.
+	snapLen := c.config.SnapLen
+	var now time.Time
+	deliver := func(data []byte) {
+		c.packetsReceived.Add(1)
+		capLen := len(data)
+		if snapLen > 0 && capLen > snapLen {
+			capLen = snapLen
+		}
+		raw := core.RawPacket{
+			Data:           append([]byte(nil), data[:capLen]...),
+			Timestamp:      now,
+			CaptureLen:     uint32(capLen),
+			OrigLen:        uint32(len(data)),
+			InterfaceIndex: ifi.Index,
+		}
+		// Non-blocking send: prefer drop over stalling the RX ring.
+		select {
+		case output <- raw:
+		default:
+			c.packetsDropped.Add(1)
+		}
+	}
+
+	var limiter ratecap.Limiter
+	lastStats := time.Now()
+	for {
+		select {
+		case <-done:
+			slog.Info("afxdp capture stopped", "interface", c.config.Interface, "queue", queue)
+			return nil
+		case <-stopped:
+			slog.Info("afxdp capture stopped", "interface", c.config.Interface, "queue", queue)
+			return nil
+		default:
+		}
+
+		// AF_XDP frames carry no timestamp; a batch shares its read time.
+		now = time.Now()
+		batch := c.config.BatchSize
+		if budget := limiter.Budget(now, c.maxPPS.Load()); budget >= 0 {
+			batch = min(batch, budget)
+		}
+		if batch == 0 {
+			// Over max_pps: leave the ring until the window frees budget.
+			time.Sleep(ratecap.SlotDuration)
+		} else if n := sock.receive(batch, deliver); n > 0 {
+			limiter.Take(now, n)
+		} else if err := sock.wait(pollTimeoutMs); err != nil {
+			return fmt.Errorf("afxdp: poll: %w", err)
+		}
+
+		if now.Sub(lastStats) >= statsInterval {
+			lastStats = now
+			if dropped, err := sock.dropped(); err == nil {
+				c.packetsIfDropped.Store(dropped)
+			}
+		}
+	}
+}
+
+// open creates the socket in the configured zero-copy mode; auto falls back
+// to copy mode when the driver lacks zero-copy support.
+func (c *AFXDPCapturer) open(ifindex, queue int, zeroCopy string) (*xsk, error) {
+	if zeroCopy == zeroCopyOff {
+		return openXSK(c.config, ifindex, queue, unix.XDP_COPY)
+	}
+	sock, err := openXSK(c.config, ifindex, queue, unix.XDP_ZEROCOPY)
+	if err == nil || zeroCopy == zeroCopyOn {
+		return sock, err
+	}
+	slog.Info("afxdp zero-copy unavailable, using copy mode",
+		"interface", c.config.Interface, "queue", queue, "error", err)
+	return openXSK(c.config, ifindex, queue, unix.XDP_COPY)
+}
+
+// Stats returns capture statistics.
+func (c *AFXDPCapturer) Stats() plugin.CaptureStats {
+	stats := plugin.CaptureStats{
+		PacketsReceived:  c.packetsReceived.Load(),
+		PacketsDropped:   c.packetsDropped.Load(),
+		PacketsIfDropped: c.packetsIfDropped.Load(),
+	}
+	if prog := c.prog.Load(); prog != nil {
+		stats.PacketsPrefiltered = prog.prefiltered(c.config.queue(c.index))
+	} else {
+		stats.PacketsPrefiltered = c.prefiltered.Load()
+	}
+	return stats
+}
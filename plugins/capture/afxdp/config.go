@@ -0,0 +1,174 @@
+//go:build linux
+
+// Package afxdp implements an AF_XDP capture plugin.
+//
+// Each capturer opens one XDP socket (XSK) bound to one RX queue of the
+// interface. A minimal XDP program, shared by all capturers of an interface,
+// redirects every packet of a queue with a socket to that socket through an
+// XSKMAP; queues without a socket pass packets to the kernel stack. Packets
+// are DMAed (zero-copy mode) or copied (copy mode) by the driver into a
+// per-socket UMEM area and read from the RX ring without libpcap or
+// per-packet syscalls.
+//
+// In binding mode capturer i reads RX queue queue+i and feeds pipeline i, so
+// the interface should have one combined channel per pipeline (ethtool -L).
+// In dispatch mode a single capturer reads RX queue queue.
+//
+// Redirected packets no longer reach the kernel stack: use AF_XDP on a
+// dedicated capture interface (SPAN / TAP port), not on a host's data port.
+package afxdp
+
+import (
+	"fmt"
+)
+
+const (
+	pluginName = "afxdp"
+
+	// Default configuration values
+	defaultFrameSize = 4096
+	defaultFillRing  = 2048
+	defaultRxRing    = 2048
+	defaultBatchSize = 64
+
+	// xskMapEntries bounds the RX queue index a socket can be bound to.
+	xskMapEntries = 256
+)
+
+// Zero-copy modes (Config.ZeroCopy).
+const (
+	zeroCopyAuto = "auto" // zero-copy when the driver supports it, else copy
+	zeroCopyOn   = "on"   // zero-copy or fail
+	zeroCopyOff  = "off"  // copy mode
+)
+
+// XDP program attach modes (Config.XDPMode).
+const (
+	xdpModeAuto    = "auto"    // native, falling back to generic
+	xdpModeNative  = "native"  // in the driver (XDP_FLAGS_DRV_MODE)
+	xdpModeGeneric = "generic" // after skb allocation (XDP_FLAGS_SKB_MODE), any driver
+)
+
+// Config represents afxdp-specific configuration.
+type Config struct {
+	Interface string `json:"interface"`  // required
+	SnapLen   int    `json:"snap_len"`   // optional, default: whole frame
+	Queue     int    `json:"queue"`      // optional, first RX queue, default 0
+	FrameSize int    `json:"frame_size"` // optional, UMEM frame size: 2048 or 4096, default 4096
+	Frames    int    `json:"frames"`     // optional, UMEM frames, default fill_ring + rx_ring
+	FillRing  int    `json:"fill_ring"`  // optional, fill queue entries (power of 2), default 2048
+	RxRing    int    `json:"rx_ring"`    // optional, RX ring entries (power of 2), default 2048
+	BatchSize int    `json:"batch_size"` // optional, RX descriptors read per batch, default 64
+	ZeroCopy  string `json:"zero_copy"`  // optional: auto|on|off (or true/false), default auto
+	XDPMode   string `json:"xdp_mode"`   // optional: auto|native|generic, default auto
+}
+
+// parseConfig parses the plugin config for capturer index of count.
+func parseConfig(cfg map[string]any, index, count int) (Config, error) {
+	c := Config{
+		FrameSize: defaultFrameSize,
+		FillRing:  defaultFillRing,
+		RxRing:    defaultRxRing,
+		BatchSize: defaultBatchSize,
+		ZeroCopy:  zeroCopyAuto,
+		XDPMode:   xdpModeAuto,
+	}
+
+	if iface, ok := cfg["interface"].(string); ok && iface != "" {
+		c.Interface = iface
+	} else {
+		return c, fmt.Errorf("afxdp: interface is required")
+	}
+
+	// XDP sockets cannot take a classic BPF filter; the XDP program sees
+	// every packet of the queue.
+	if filter, ok := cfg["bpf_filter"].(string); ok && filter != "" {
+		return c, fmt.Errorf("afxdp: bpf_filter is not supported, filter in the parsers or use afpacket")
+	}
+
+	if snapLen, ok := cfg["snap_len"].(float64); ok {
+		c.SnapLen = int(snapLen)
+	}
+
+	if queue, ok := cfg["queue"].(float64); ok {
+		c.Queue = int(queue)
+	}
+
+	if frameSize, ok := cfg["frame_size"].(float64); ok {
+		c.FrameSize = int(frameSize)
+	}
+
+	if fill, ok := cfg["fill_ring"].(float64); ok {
+		c.FillRing = int(fill)
+	}
+
+	if rx, ok := cfg["rx_ring"].(float64); ok {
+		c.RxRing = int(rx)
+	}
+
+	c.Frames = c.FillRing + c.RxRing
+	if frames, ok := cfg["frames"].(float64); ok {
+		c.Frames = int(frames)
+	}
+
+	if batch, ok := cfg["batch_size"].(float64); ok {
+		c.BatchSize = int(batch)
+	}
+
+	switch zc := cfg["zero_copy"].(type) {
+	case nil:
+	case bool:
+		c.ZeroCopy = zeroCopyOff
+		if zc {
+			c.ZeroCopy = zeroCopyOn
+		}
+	case string:
+		c.ZeroCopy = zc
+	default:
+		return c, fmt.Errorf("afxdp: zero_copy must be auto, on or off, got %v", zc)
+	}
+
+	if mode, ok := cfg["xdp_mode"].(string); ok {
+		c.XDPMode = mode
+	}
+
+	switch {
+	case c.SnapLen < 0:
+		return c, fmt.Errorf("afxdp: snap_len must be >= 0")
+	case c.FrameSize != 2048 && c.FrameSize != 4096:
+		return c, fmt.Errorf("afxdp: frame_size must be 2048 or 4096, got %d", c.FrameSize)
+	case !powerOfTwo(c.FillRing):
+		return c, fmt.Errorf("afxdp: fill_ring must be a power of 2, got %d", c.FillRing)
+	case !powerOfTwo(c.RxRing):
+		return c, fmt.Errorf("afxdp: rx_ring must be a power of 2, got %d", c.RxRing)
+	case c.Frames < c.FillRing:
+		// Frames the fill queue cannot be stocked with would leave the
+		// driver without buffers.
+		return c, fmt.Errorf("afxdp: frames (%d) must be at least fill_ring (%d)", c.Frames, c.FillRing)
+	case c.BatchSize < 1 || c.BatchSize > c.RxRing:
+		return c, fmt.Errorf("afxdp: batch_size must be between 1 and rx_ring (%d)", c.RxRing)
+	case c.ZeroCopy != zeroCopyAuto && c.ZeroCopy != zeroCopyOn && c.ZeroCopy != zeroCopyOff:
+		return c, fmt.Errorf("afxdp: zero_copy must be auto, on or off, got %q", c.ZeroCopy)
+	case c.XDPMode != xdpModeAuto && c.XDPMode != xdpModeNative && c.XDPMode != xdpModeGeneric:
+		return c, fmt.Errorf("afxdp: xdp_mode must be auto, native or generic, got %q", c.XDPMode)
+	case c.ZeroCopy == zeroCopyOn && c.XDPMode == xdpModeGeneric:
+		return c, fmt.Errorf("afxdp: zero_copy needs the XDP program in the driver, not xdp_mode generic")
+	case c.Queue < 0 || c.Queue+count > xskMapEntries:
+		return c, fmt.Errorf("afxdp: queues %d..%d out of range [0, %d)", c.Queue, c.Queue+count-1, xskMapEntries)
+	}
+
+	if index < 0 || index >= count {
+		return c, fmt.Errorf("afxdp: capturer index %d out of range [0, %d)", index, count)
+	}
+
+	return c, nil
+}
+
+// queue returns the RX queue read by capturer index.
+func (c Config) queue(index int) int {
+	return c.Queue + index
+}
+
+func powerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
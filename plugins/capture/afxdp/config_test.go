@@ -0,0 +1,89 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"testing"
+)
+
+func TestParseConfig_Defaults(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{"interface": "eth1", "snap_len": float64(65535)}, 0, 1)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	want := Config{
+		Interface: "eth1",
+		SnapLen:   65535,
+		FrameSize: defaultFrameSize,
+		Frames:    defaultFillRing + defaultRxRing,
+		FillRing:  defaultFillRing,
+		RxRing:    defaultRxRing,
+		BatchSize: defaultBatchSize,
+		ZeroCopy:  zeroCopyAuto,
+		XDPMode:   xdpModeAuto,
+	}
+	if cfg != want {
+		t.Errorf("defaults = %+v, want %+v", cfg, want)
+	}
+	if got := cfg.queue(0); got != 0 {
+		t.Errorf("queue(0) = %d, want 0", got)
+	}
+}
+
+func TestParseConfig_Sizing(t *testing.T) {
+	raw := map[string]any{
+		"interface":  "eth1",
+		"queue":      float64(4),
+		"frame_size": float64(2048),
+		"fill_ring":  float64(4096),
+		"rx_ring":    float64(1024),
+		"batch_size": float64(128),
+		"zero_copy":  true,
+		"xdp_mode":   "native",
+	}
+	for index := 0; index < 4; index++ {
+		cfg, err := parseConfig(raw, index, 4)
+		if err != nil {
+			t.Fatalf("parseConfig(%d): %v", index, err)
+		}
+		if cfg.Frames != 5120 || cfg.FrameSize != 2048 || cfg.ZeroCopy != zeroCopyOn || cfg.XDPMode != xdpModeNative {
+			t.Errorf("config = %+v", cfg)
+		}
+		if got := cfg.queue(index); got != 4+index {
+			t.Errorf("queue(%d) = %d, want %d", index, got, 4+index)
+		}
+	}
+
+	cfg, err := parseConfig(map[string]any{"interface": "eth1", "zero_copy": false, "frames": float64(8192)}, 0, 1)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.ZeroCopy != zeroCopyOff || cfg.Frames != 8192 {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   map[string]any
+		count int
+	}{
+		{"no interface", map[string]any{}, 1},
+		{"bpf filter", map[string]any{"interface": "eth1", "bpf_filter": "udp"}, 1},
+		{"frame size", map[string]any{"interface": "eth1", "frame_size": float64(1500)}, 1},
+		{"fill ring not power of 2", map[string]any{"interface": "eth1", "fill_ring": float64(1000)}, 1},
+		{"rx ring not power of 2", map[string]any{"interface": "eth1", "rx_ring": float64(0)}, 1},
+		{"too few frames", map[string]any{"interface": "eth1", "frames": float64(1024)}, 1},
+		{"batch larger than ring", map[string]any{"interface": "eth1", "batch_size": float64(4096)}, 1},
+		{"zero_copy value", map[string]any{"interface": "eth1", "zero_copy": "always"}, 1},
+		{"xdp_mode value", map[string]any{"interface": "eth1", "xdp_mode": "offload"}, 1},
+		{"zero copy in generic mode", map[string]any{"interface": "eth1", "zero_copy": "on", "xdp_mode": "generic"}, 1},
+		{"queues beyond map", map[string]any{"interface": "eth1", "queue": float64(254)}, 4},
+	}
+	for _, tt := range tests {
+		if _, err := parseConfig(tt.cfg, 0, tt.count); err == nil {
+			t.Errorf("%s: parseConfig succeeded, want error", tt.name)
+		}
+	}
+}
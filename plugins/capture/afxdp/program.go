@@ -0,0 +1,40 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"firestige.xyz/otus/internal/ebpf"
+	"firestige.xyz/otus/internal/prefilter"
+)
+
+const (
+	xdpPass           = 2  // XDP_PASS
+	xdpMdRxQueueIndex = 16 // offsetof(struct xdp_md, rx_queue_index)
+)
+
+// redirectProgram returns the XDP program
+//
+//	if (!prefilter(ctx)) { count; return XDP_DROP; }
+//	return bpf_redirect_map(&xsks, ctx->rx_queue_index, XDP_PASS);
+//
+// for the XSKMAP mapFD: packets of a queue with a socket in the map go to
+// the socket, all others to the kernel stack (the XDP_PASS fallback in the
+// flags argument needs Linux 5.3). Without rules there is no prefilter.
+func redirectProgram(mapFD int, rules *prefilter.Rules, counter *prefilter.Counter) ([]ebpf.Insn, error) {
+	insns := []ebpf.Insn{ebpf.Mov64Reg(ebpf.RegCtx, ebpf.R1)}
+	if rules != nil {
+		pre, err := rules.XDP(counter, "redirect")
+		if err != nil {
+			return nil, err
+		}
+		insns = append(insns, pre...)
+	}
+	insns = append(insns,
+		ebpf.Label("redirect"),
+		ebpf.LoadMem(ebpf.SizeW, ebpf.R2, ebpf.RegCtx, xdpMdRxQueueIndex)) // r2 = ctx->rx_queue_index
+	insns = append(insns, ebpf.LoadMapFD(ebpf.R1, mapFD)...) // r1 = &xsks
+	return append(insns,
+		ebpf.Mov64Imm(ebpf.R3, xdpPass), // r3 = XDP_PASS
+		ebpf.Call(ebpf.FuncRedirectMap),
+		ebpf.Exit()), nil
+}
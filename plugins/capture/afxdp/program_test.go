@@ -0,0 +1,115 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/ebpf"
+	"firestige.xyz/otus/internal/prefilter"
+)
+
+func TestRedirectProgram(t *testing.T) {
+	insns, err := redirectProgram(7, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ebpf.Assemble(insns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0xbf, 0x16, 0, 0, 0, 0, 0, 0, // r6 = r1
+		0x61, 0x62, 16, 0, 0, 0, 0, 0, // r2 = *(u32 *)(r6 + 16)
+		0x18, 0x11, 0, 0, 7, 0, 0, 0, // r1 = map fd 7 (ld_imm64, src = BPF_PSEUDO_MAP_FD)
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0xb7, 0x03, 0, 0, 2, 0, 0, 0, // r3 = XDP_PASS
+		0x85, 0x00, 0, 0, 51, 0, 0, 0, // call bpf_redirect_map
+		0x95, 0x00, 0, 0, 0, 0, 0, 0, // exit
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("program =\n% x\nwant\n% x", got, want)
+	}
+
+	rules, err := (&prefilter.Config{Ports: []string{"5060"}}).Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if insns, err = redirectProgram(7, rules, &prefilter.Counter{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = ebpf.Assemble(insns); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(got, want[8:]) {
+		t.Error("prefiltered program does not end with the redirect")
+	}
+}
+
+func TestSetLinkXDPMessage(t *testing.T) {
+	msg := setLinkXDPMessage(3, -1, unix.XDP_FLAGS_SKB_MODE)
+	ne := binary.NativeEndian
+	if int(ne.Uint32(msg)) != len(msg) || ne.Uint16(msg[4:]) != unix.RTM_SETLINK {
+		t.Fatalf("header = % x", msg[:16])
+	}
+	ifi := msg[unix.SizeofNlMsghdr:]
+	if ne.Uint32(ifi[4:]) != 3 {
+		t.Errorf("ifindex = %d, want 3", ne.Uint32(ifi[4:]))
+	}
+	xdp := ifi[unix.SizeofIfInfomsg:]
+	if ne.Uint16(xdp[2:]) != unix.IFLA_XDP|unix.NLA_F_NESTED {
+		t.Errorf("attr type = %#x, want nested IFLA_XDP", ne.Uint16(xdp[2:]))
+	}
+	if fd := int32(ne.Uint32(xdp[8:])); fd != -1 {
+		t.Errorf("IFLA_XDP_FD = %d, want -1", fd)
+	}
+	if flags := ne.Uint32(xdp[16:]); flags != unix.XDP_FLAGS_SKB_MODE {
+		t.Errorf("IFLA_XDP_FLAGS = %#x", flags)
+	}
+
+	ack := make([]byte, unix.SizeofNlMsghdr+4)
+	ne.PutUint16(ack[4:], unix.NLMSG_ERROR)
+	if err := parseAck(ack); err != nil {
+		t.Errorf("parseAck(ok) = %v", err)
+	}
+	code := -int32(unix.EBUSY)
+	ne.PutUint32(ack[unix.SizeofNlMsghdr:], uint32(code))
+	if err := parseAck(ack); err != unix.EBUSY {
+		t.Errorf("parseAck = %v, want EBUSY", err)
+	}
+}
+
+func TestAcquireProgram_Mismatch(t *testing.T) {
+	rules, err := (&prefilter.Config{Ports: []string{"5060"}}).Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	programsMu.Lock()
+	programs["test0"] = &xdpProgram{refs: 1, mode: xdpModeNative, rules: rules}
+	programsMu.Unlock()
+	defer func() {
+		programsMu.Lock()
+		delete(programs, "test0")
+		programsMu.Unlock()
+	}()
+
+	same, err := (&prefilter.Config{Ports: []string{"5060"}}).Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := acquireProgram("test0", xdpModeNative, same); err != nil || p.refs != 2 {
+		t.Errorf("same mode and rules: refs = %v, err = %v; want the shared program", p, err)
+	}
+	if _, err := acquireProgram("test0", xdpModeGeneric, rules); !errors.Is(err, core.ErrConfig) {
+		t.Errorf("other mode: err = %v, want ErrConfig", err)
+	}
+	if _, err := acquireProgram("test0", xdpModeNative, nil); !errors.Is(err, core.ErrConfig) {
+		t.Errorf("other rules: err = %v, want ErrConfig", err)
+	}
+}
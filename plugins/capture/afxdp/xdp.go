@@ -0,0 +1,250 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"reflect"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/ebpf"
+	"firestige.xyz/otus/internal/prefilter"
+)
+
+// xdpProgram is the redirect program attached to one interface, shared by
+// the capturers reading its queues.
+type xdpProgram struct {
+	ifindex int
+	mapFD   int
+	progFD  int
+	flags   uint32             // XDP_FLAGS_* the program was attached with
+	counter *prefilter.Counter // prefilter drops per RX queue, nil = no prefilter
+	refs    int
+
+	// requested by the first capturer; later ones must match
+	mode  string
+	rules *prefilter.Rules
+}
+
+var (
+	programsMu sync.Mutex
+	programs   = make(map[string]*xdpProgram)
+)
+
+// acquireProgram attaches the redirect program, with the prefilter rules if
+// any, to iface on first use and returns it. Later capturers of the
+// interface share the program, so they must request the same XDP mode and
+// rules: an interface runs one XDP program.
+func acquireProgram(iface, mode string, rules *prefilter.Rules) (*xdpProgram, error) {
+	programsMu.Lock()
+	defer programsMu.Unlock()
+
+	if p, ok := programs[iface]; ok {
+		if p.mode != mode || !reflect.DeepEqual(p.rules, rules) {
+			return nil, fmt.Errorf("%w: afxdp: %s already captured with another xdp_mode or prefilter", core.ErrConfig, iface)
+		}
+		p.refs++
+		return p, nil
+	}
+
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("afxdp: %w", err)
+	}
+
+	mapFD, err := ebpf.CreateMap(unix.BPF_MAP_TYPE_XSKMAP, 4, 4, xskMapEntries)
+	if err != nil {
+		return nil, fmt.Errorf("afxdp: create XSKMAP: %w (needs CAP_BPF/CAP_NET_ADMIN and Linux 5.3+)", err)
+	}
+	p := &xdpProgram{ifindex: ifi.Index, mapFD: mapFD, refs: 1, mode: mode, rules: rules}
+	if err := p.load(rules); err != nil {
+		p.close()
+		return nil, err
+	}
+
+	if err := p.attach(mode); err != nil {
+		p.close()
+		if errors.Is(err, unix.EBUSY) {
+			return nil, fmt.Errorf("afxdp: %s already runs an XDP program", iface)
+		}
+		return nil, fmt.Errorf("afxdp: attach XDP program to %s: %w", iface, err)
+	}
+	programs[iface] = p
+	slog.Info("afxdp program attached", "interface", iface, "mode", p.modeName(), "prefilter", rules != nil)
+	return p, nil
+}
+
+// load loads the program, creating the prefilter drop counter first.
+func (p *xdpProgram) load(rules *prefilter.Rules) error {
+	if rules != nil {
+		counter, err := prefilter.NewCounter(xskMapEntries)
+		if err != nil {
+			return fmt.Errorf("afxdp: %w", err)
+		}
+		p.counter = counter
+	}
+	insns, err := redirectProgram(p.mapFD, rules, p.counter)
+	if err != nil {
+		return fmt.Errorf("afxdp: %w", err)
+	}
+	p.progFD, err = ebpf.LoadProgram(unix.BPF_PROG_TYPE_XDP, "otus_xsk", insns)
+	if err != nil {
+		p.progFD = -1
+		return fmt.Errorf("afxdp: load XDP program: %w", err)
+	}
+	return nil
+}
+
+// releaseProgram detaches the program once its last capturer is done.
+func releaseProgram(iface string) {
+	programsMu.Lock()
+	defer programsMu.Unlock()
+
+	p, ok := programs[iface]
+	if !ok {
+		return
+	}
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+	if err := setLinkXDP(p.ifindex, -1, p.flags&^unix.XDP_FLAGS_UPDATE_IF_NOEXIST); err != nil {
+		slog.Warn("afxdp failed to detach XDP program", "interface", iface, "error", err)
+	}
+	p.close()
+	delete(programs, iface)
+	slog.Info("afxdp program detached", "interface", iface)
+}
+
+func (p *xdpProgram) close() {
+	if p.progFD > 0 {
+		unix.Close(p.progFD)
+	}
+	if p.counter != nil {
+		p.counter.Close()
+	}
+	unix.Close(p.mapFD)
+}
+
+// prefiltered returns the packets of RX queue queue dropped by the
+// prefilter.
+func (p *xdpProgram) prefiltered(queue int) uint64 {
+	if p.counter == nil {
+		return 0
+	}
+	return p.counter.Load(queue)
+}
+
+// attach attaches the program in the given xdp_mode. An interface that
+// already runs an XDP program is left alone.
+func (p *xdpProgram) attach(mode string) error {
+	flags := uint32(unix.XDP_FLAGS_UPDATE_IF_NOEXIST)
+	switch mode {
+	case xdpModeNative:
+		p.flags = flags | unix.XDP_FLAGS_DRV_MODE
+	case xdpModeGeneric:
+		p.flags = flags | unix.XDP_FLAGS_SKB_MODE
+	default:
+		p.flags = flags | unix.XDP_FLAGS_DRV_MODE
+		err := setLinkXDP(p.ifindex, p.progFD, p.flags)
+		if err == nil || errors.Is(err, unix.EBUSY) || errors.Is(err, unix.EEXIST) {
+			return err
+		}
+		slog.Info("afxdp native XDP unavailable, using generic mode", "ifindex", p.ifindex, "error", err)
+		p.flags = flags | unix.XDP_FLAGS_SKB_MODE
+	}
+	return setLinkXDP(p.ifindex, p.progFD, p.flags)
+}
+
+func (p *xdpProgram) modeName() string {
+	if p.flags&unix.XDP_FLAGS_SKB_MODE != 0 {
+		return xdpModeGeneric
+	}
+	return xdpModeNative
+}
+
+// register points the program at socket fd for RX queue queue.
+func (p *xdpProgram) register(queue, fd int) error {
+	if err := ebpf.UpdateUint32(p.mapFD, uint32(queue), uint32(fd)); err != nil {
+		return fmt.Errorf("afxdp: register queue %d: %w", queue, err)
+	}
+	return nil
+}
+
+// setLinkXDP attaches program fd to an interface over rtnetlink, or
+// detaches the current program when fd is -1.
+func setLinkXDP(ifindex, fd int, flags uint32) error {
+	sock, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(sock)
+
+	msg := setLinkXDPMessage(ifindex, fd, flags)
+	if err := unix.Sendto(sock, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	n, _, err := unix.Recvfrom(sock, buf, 0)
+	if err != nil {
+		return err
+	}
+	return parseAck(buf[:n])
+}
+
+// parseAck returns the error carried by a netlink acknowledgement.
+func parseAck(b []byte) error {
+	if len(b) < unix.SizeofNlMsghdr+4 {
+		return fmt.Errorf("short netlink reply")
+	}
+	if binary.NativeEndian.Uint16(b[4:]) != unix.NLMSG_ERROR {
+		return nil
+	}
+	if code := int32(binary.NativeEndian.Uint32(b[unix.SizeofNlMsghdr:])); code != 0 {
+		return unix.Errno(-code)
+	}
+	return nil
+}
+
+// setLinkXDPMessage builds the RTM_SETLINK request setting IFLA_XDP.
+func setLinkXDPMessage(ifindex, fd int, flags uint32) []byte {
+	const (
+		attrLen = unix.SizeofNlAttr + 4 // u32 payload
+		xdpLen  = unix.SizeofNlAttr + 2*attrLen
+		msgLen  = unix.SizeofNlMsghdr + unix.SizeofIfInfomsg + xdpLen
+	)
+	b := make([]byte, msgLen)
+	ne := binary.NativeEndian
+
+	ne.PutUint32(b[0:], msgLen)
+	ne.PutUint16(b[4:], unix.RTM_SETLINK)
+	ne.PutUint16(b[6:], unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	ne.PutUint32(b[8:], 1) // seq
+
+	ifi := b[unix.SizeofNlMsghdr:]
+	ifi[0] = unix.AF_UNSPEC
+	ne.PutUint32(ifi[4:], uint32(ifindex))
+
+	xdp := ifi[unix.SizeofIfInfomsg:]
+	ne.PutUint16(xdp[0:], xdpLen)
+	ne.PutUint16(xdp[2:], unix.IFLA_XDP|unix.NLA_F_NESTED)
+
+	fdAttr := xdp[unix.SizeofNlAttr:]
+	ne.PutUint16(fdAttr[0:], attrLen)
+	ne.PutUint16(fdAttr[2:], unix.IFLA_XDP_FD)
+	ne.PutUint32(fdAttr[4:], uint32(int32(fd)))
+
+	flagsAttr := fdAttr[attrLen:]
+	ne.PutUint16(flagsAttr[0:], attrLen)
+	ne.PutUint16(flagsAttr[2:], unix.IFLA_XDP_FLAGS)
+	ne.PutUint32(flagsAttr[4:], flags)
+	return b
+}
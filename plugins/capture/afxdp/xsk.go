@@ -0,0 +1,216 @@
+//go:build linux
+
+package afxdp
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ring is a single-producer / single-consumer ring shared with the kernel.
+// For the fill ring this process is the producer, for the RX ring the
+// consumer.
+type ring struct {
+	mem      []byte
+	producer *uint32
+	consumer *uint32
+	descs    unsafe.Pointer
+	mask     uint32
+}
+
+func mapRing(fd int, pgoff int64, off unix.XDPRingOffset, entries, entrySize int) (ring, error) {
+	mem, err := unix.Mmap(fd, pgoff, int(off.Desc)+entries*entrySize,
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		return ring{}, err
+	}
+	return ring{
+		mem:      mem,
+		producer: (*uint32)(unsafe.Pointer(&mem[off.Producer])),
+		consumer: (*uint32)(unsafe.Pointer(&mem[off.Consumer])),
+		descs:    unsafe.Pointer(&mem[off.Desc]),
+		mask:     uint32(entries - 1),
+	}, nil
+}
+
+func (r *ring) unmap() {
+	if r.mem != nil {
+		unix.Munmap(r.mem)
+		r.mem = nil
+	}
+}
+
+// fillAddr returns fill ring entry i.
+func (r *ring) fillAddr(i uint32) *uint64 {
+	return (*uint64)(unsafe.Add(r.descs, uintptr(i&r.mask)*8))
+}
+
+// rxDesc returns RX ring entry i.
+func (r *ring) rxDesc(i uint32) *unix.XDPDesc {
+	return (*unix.XDPDesc)(unsafe.Add(r.descs, uintptr(i&r.mask)*unsafe.Sizeof(unix.XDPDesc{})))
+}
+
+// xsk is an XDP socket bound to one RX queue with its own UMEM.
+type xsk struct {
+	fd        int
+	umem      []byte
+	frameSize uint64
+	fill      ring
+	rx        ring
+	free      []uint64 // UMEM frames owned by this process
+	zeroCopy  bool
+}
+
+// openXSK creates a socket for the queue of ifindex. bindFlags is
+// XDP_ZEROCOPY or XDP_COPY.
+func openXSK(cfg Config, ifindex, queue int, bindFlags uint16) (*xsk, error) {
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("afxdp: socket: %w (needs CAP_NET_RAW and Linux 5.4+)", err)
+	}
+	s := &xsk{fd: fd, frameSize: uint64(cfg.FrameSize), zeroCopy: bindFlags&unix.XDP_ZEROCOPY != 0}
+	if err := s.setup(cfg, ifindex, queue, bindFlags); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *xsk) setup(cfg Config, ifindex, queue int, bindFlags uint16) error {
+	var err error
+	s.umem, err = unix.Mmap(-1, 0, cfg.Frames*cfg.FrameSize,
+		unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_POPULATE)
+	if err != nil {
+		return fmt.Errorf("afxdp: allocate UMEM: %w", err)
+	}
+
+	reg := unix.XDPUmemReg{
+		Addr: uint64(uintptr(unsafe.Pointer(&s.umem[0]))),
+		Len:  uint64(len(s.umem)),
+		Size: uint32(cfg.FrameSize),
+	}
+	if err := setsockopt(s.fd, unix.XDP_UMEM_REG, unsafe.Pointer(&reg), unsafe.Sizeof(reg)); err != nil {
+		return fmt.Errorf("afxdp: register UMEM: %w", err)
+	}
+	for _, r := range []struct{ opt, entries int }{
+		{unix.XDP_UMEM_FILL_RING, cfg.FillRing},
+		{unix.XDP_UMEM_COMPLETION_RING, cfg.FillRing}, // required by bind, unused for RX
+		{unix.XDP_RX_RING, cfg.RxRing},
+	} {
+		if err := unix.SetsockoptInt(s.fd, unix.SOL_XDP, r.opt, r.entries); err != nil {
+			return fmt.Errorf("afxdp: size rings: %w", err)
+		}
+	}
+
+	var off unix.XDPMmapOffsets
+	if err := getsockopt(s.fd, unix.XDP_MMAP_OFFSETS, unsafe.Pointer(&off), unsafe.Sizeof(off)); err != nil {
+		return fmt.Errorf("afxdp: ring offsets: %w", err)
+	}
+	if s.fill, err = mapRing(s.fd, unix.XDP_UMEM_PGOFF_FILL_RING, off.Fr, cfg.FillRing, 8); err != nil {
+		return fmt.Errorf("afxdp: map fill ring: %w", err)
+	}
+	if s.rx, err = mapRing(s.fd, unix.XDP_PGOFF_RX_RING, off.Rx, cfg.RxRing, int(unsafe.Sizeof(unix.XDPDesc{}))); err != nil {
+		return fmt.Errorf("afxdp: map RX ring: %w", err)
+	}
+
+	sa := &unix.SockaddrXDP{Flags: bindFlags, Ifindex: uint32(ifindex), QueueID: uint32(queue)}
+	if err := unix.Bind(s.fd, sa); err != nil {
+		return fmt.Errorf("afxdp: bind queue %d: %w", queue, err)
+	}
+
+	s.free = make([]uint64, cfg.Frames)
+	for i := range s.free {
+		s.free[i] = uint64(i) * s.frameSize
+	}
+	s.refill()
+	return nil
+}
+
+// refill hands free frames to the kernel, as many as the fill ring takes.
+func (s *xsk) refill() {
+	prod := *s.fill.producer
+	space := s.fill.mask + 1 - (prod - atomic.LoadUint32(s.fill.consumer))
+	n := min(uint32(len(s.free)), space)
+	if n == 0 {
+		return
+	}
+	for i := uint32(0); i < n; i++ {
+		*s.fill.fillAddr(prod + i) = s.free[len(s.free)-1-int(i)]
+	}
+	s.free = s.free[:len(s.free)-int(n)]
+	atomic.StoreUint32(s.fill.producer, prod+n)
+}
+
+// receive calls fn for up to max received frames, then returns their frames
+// to the fill ring. The data passed to fn is only valid during the call.
+func (s *xsk) receive(max int, fn func(data []byte)) int {
+	cons := *s.rx.consumer
+	n := min(atomic.LoadUint32(s.rx.producer)-cons, uint32(max))
+	for i := uint32(0); i < n; i++ {
+		d := s.rx.rxDesc(cons + i)
+		fn(s.umem[d.Addr : d.Addr+uint64(d.Len)])
+		// In aligned mode the address may include headroom; the frame
+		// starts at the frame size boundary.
+		s.free = append(s.free, d.Addr&^(s.frameSize-1))
+	}
+	if n > 0 {
+		atomic.StoreUint32(s.rx.consumer, cons+n)
+		s.refill()
+	}
+	return int(n)
+}
+
+// wait blocks until the RX ring has frames or timeoutMs passes.
+func (s *xsk) wait(timeoutMs int) error {
+	fds := []unix.PollFd{{Fd: int32(s.fd), Events: unix.POLLIN}}
+	_, err := unix.Poll(fds, timeoutMs)
+	if errors.Is(err, unix.EINTR) {
+		return nil
+	}
+	return err
+}
+
+// dropped returns the kernel's drop counters for the socket: packets
+// dropped for lack of fill ring frames or RX ring space.
+func (s *xsk) dropped() (uint64, error) {
+	var st unix.XDPStatistics
+	if err := getsockopt(s.fd, unix.XDP_STATISTICS, unsafe.Pointer(&st), unsafe.Sizeof(st)); err != nil {
+		return 0, err
+	}
+	return st.Rx_dropped + st.Rx_ring_full, nil
+}
+
+func (s *xsk) close() {
+	s.rx.unmap()
+	s.fill.unmap()
+	if s.fd >= 0 {
+		unix.Close(s.fd)
+		s.fd = -1
+	}
+	if s.umem != nil {
+		unix.Munmap(s.umem)
+		s.umem = nil
+	}
+}
+
+func setsockopt(fd, name int, val unsafe.Pointer, size uintptr) error {
+	_, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(fd), unix.SOL_XDP, uintptr(name), uintptr(val), size, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// getsockopt reads a SOL_XDP option; older kernels may fill less than size.
+func getsockopt(fd, name int, val unsafe.Pointer, size uintptr) error {
+	n := uint32(size)
+	_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.SOL_XDP, uintptr(name), uintptr(val), uintptr(unsafe.Pointer(&n)), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package dpdk implements a DPDK poll-mode capture plugin.
+//
+// The capturer itself needs the DPDK libraries and is only built with the
+// "dpdk" build tag (make build-dpdk). Configuration parsing and the queue /
+// lcore mapping below are plain Go so they build and test everywhere.
+//
+// In binding mode capturer i polls RX queue i of the port from a thread pinned
+// to lcores[i] and feeds pipeline i, so each lcore serves exactly one pipeline
+// end to end. In dispatch mode a single capturer polls every RX queue and the
+// task's dispatcher spreads packets by flow hash.
+package dpdk
+
+import (
+	"fmt"
+)
+
+const (
+	pluginName = "dpdk"
+
+	// Default configuration values
+	defaultRxDescriptors = 1024
+	defaultMbufs         = 8191 // 2^n-1 is optimal for rte_mempool
+	defaultMbufCache     = 256
+	defaultBurstSize     = 32
+	maxBurstSize         = 512
+)
+
+// Config represents dpdk-specific configuration.
+type Config struct {
+	Port          string   `json:"port"`           // optional, DPDK port name or PCI address, default capture.interface
+	EALArgs       []string `json:"eal_args"`       // optional, rte_eal_init arguments (first task to start wins)
+	RxQueues      int      `json:"rx_queues"`      // optional, default: number of capturers
+	RxDescriptors int      `json:"rx_descriptors"` // optional, default 1024
+	Mbufs         int      `json:"mbufs"`          // optional, mbuf pool size, default 8191
+	BurstSize     int      `json:"burst_size"`     // optional, rte_eth_rx_burst size, default 32
+	Lcores        []int    `json:"lcores"`         // optional, CPU per capturer polling thread; empty = no pinning
+	Promiscuous   bool     `json:"promiscuous"`    // optional, default true
+}
+
+// parseConfig parses the plugin config for capturer index of count.
+func parseConfig(cfg map[string]any, index, count int) (Config, error) {
+	c := Config{
+		RxQueues:      count,
+		RxDescriptors: defaultRxDescriptors,
+		Mbufs:         defaultMbufs,
+		BurstSize:     defaultBurstSize,
+		Promiscuous:   true,
+	}
+
+	if iface, ok := cfg["interface"].(string); ok {
+		c.Port = iface
+	}
+	if port, ok := cfg["port"].(string); ok && port != "" {
+		c.Port = port
+	}
+	if c.Port == "" {
+		return c, fmt.Errorf("dpdk: port or interface is required")
+	}
+
+	if args, ok := cfg["eal_args"].([]any); ok {
+		for _, a := range args {
+			s, ok := a.(string)
+			if !ok {
+				return c, fmt.Errorf("dpdk: eal_args must be strings, got %v", a)
+			}
+			c.EALArgs = append(c.EALArgs, s)
+		}
+	}
+
+	if rxQueues, ok := cfg["rx_queues"].(float64); ok {
+		c.RxQueues = int(rxQueues)
+	}
+
+	if rxDesc, ok := cfg["rx_descriptors"].(float64); ok {
+		c.RxDescriptors = int(rxDesc)
+	}
+
+	if mbufs, ok := cfg["mbufs"].(float64); ok {
+		c.Mbufs = int(mbufs)
+	}
+
+	if burst, ok := cfg["burst_size"].(float64); ok {
+		c.BurstSize = int(burst)
+	}
+
+	if lcores, ok := cfg["lcores"].([]any); ok {
+		for _, l := range lcores {
+			n, ok := l.(float64)
+			if !ok || n < 0 {
+				return c, fmt.Errorf("dpdk: lcores must be non-negative integers, got %v", l)
+			}
+			c.Lcores = append(c.Lcores, int(n))
+		}
+	}
+
+	if promisc, ok := cfg["promiscuous"].(bool); ok {
+		c.Promiscuous = promisc
+	}
+
+	switch {
+	case c.RxQueues < 1:
+		return c, fmt.Errorf("dpdk: rx_queues must be at least 1")
+	case count > 1 && c.RxQueues != count:
+		// Binding mode: one queue per pipeline, or packets of the extra
+		// queues would never be read.
+		return c, fmt.Errorf("dpdk: rx_queues (%d) must equal the number of pipelines (%d) in binding mode", c.RxQueues, count)
+	case c.RxDescriptors < 1:
+		return c, fmt.Errorf("dpdk: rx_descriptors must be positive")
+	case c.Mbufs < c.RxQueues*c.RxDescriptors:
+		return c, fmt.Errorf("dpdk: mbufs (%d) must cover rx_queues × rx_descriptors (%d)", c.Mbufs, c.RxQueues*c.RxDescriptors)
+	case c.BurstSize < 1 || c.BurstSize > maxBurstSize:
+		return c, fmt.Errorf("dpdk: burst_size must be between 1 and %d", maxBurstSize)
+	case len(c.Lcores) > 0 && len(c.Lcores) < count:
+		return c, fmt.Errorf("dpdk: lcores lists %d CPUs for %d capturers", len(c.Lcores), count)
+	}
+
+	if index < 0 || index >= count {
+		return c, fmt.Errorf("dpdk: capturer index %d out of range [0, %d)", index, count)
+	}
+
+	return c, nil
+}
+
+// queues returns the RX queues polled by capturer index of count: its own
+// queue in binding mode, all queues for a single capturer.
+func (c Config) queues(index, count int) []uint16 {
+	if count > 1 {
+		return []uint16{uint16(index)}
+	}
+	q := make([]uint16, c.RxQueues)
+	for i := range q {
+		q[i] = uint16(i)
+	}
+	return q
+}
+
+// lcore returns the CPU the polling thread of capturer index is pinned to,
+// or -1 for no pinning.
+func (c Config) lcore(index int) int {
+	if index < len(c.Lcores) {
+		return c.Lcores[index]
+	}
+	return -1
+}
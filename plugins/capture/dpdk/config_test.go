@@ -0,0 +1,72 @@
+package dpdk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseConfig_Defaults(t *testing.T) {
+	cfg, err := parseConfig(map[string]any{"interface": "0000:3b:00.0"}, 0, 1)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if cfg.Port != "0000:3b:00.0" || cfg.RxQueues != 1 || cfg.BurstSize != defaultBurstSize || !cfg.Promiscuous {
+		t.Errorf("defaults = %+v", cfg)
+	}
+	if got := cfg.lcore(0); got != -1 {
+		t.Errorf("lcore(0) = %d, want -1 (no pinning)", got)
+	}
+}
+
+func TestParseConfig_BindingQueues(t *testing.T) {
+	raw := map[string]any{
+		"interface": "eth0",
+		"port":      "net_ixgbe0",
+		"eal_args":  []any{"-l", "2-5", "-a", "0000:3b:00.0"},
+		"lcores":    []any{float64(2), float64(3), float64(4), float64(5)},
+	}
+	for index := 0; index < 4; index++ {
+		cfg, err := parseConfig(raw, index, 4)
+		if err != nil {
+			t.Fatalf("parseConfig(%d): %v", index, err)
+		}
+		if cfg.Port != "net_ixgbe0" || cfg.RxQueues != 4 {
+			t.Errorf("config = %+v, want port net_ixgbe0 with 4 queues", cfg)
+		}
+		if got := cfg.queues(index, 4); !reflect.DeepEqual(got, []uint16{uint16(index)}) {
+			t.Errorf("queues(%d) = %v, want [%d]", index, got, index)
+		}
+		if got := cfg.lcore(index); got != index+2 {
+			t.Errorf("lcore(%d) = %d, want %d", index, got, index+2)
+		}
+	}
+
+	// A single (dispatch mode) capturer polls every queue.
+	cfg, err := parseConfig(map[string]any{"interface": "eth0", "rx_queues": float64(3)}, 0, 1)
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if got := cfg.queues(0, 1); !reflect.DeepEqual(got, []uint16{0, 1, 2}) {
+		t.Errorf("queues = %v, want [0 1 2]", got)
+	}
+}
+
+func TestParseConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   map[string]any
+		count int
+	}{
+		{"no port", map[string]any{}, 1},
+		{"queues differ from pipelines", map[string]any{"interface": "eth0", "rx_queues": float64(2)}, 4},
+		{"too few lcores", map[string]any{"interface": "eth0", "lcores": []any{float64(2)}}, 2},
+		{"pool too small", map[string]any{"interface": "eth0", "mbufs": float64(512)}, 1},
+		{"burst too large", map[string]any{"interface": "eth0", "burst_size": float64(4096)}, 1},
+		{"non-string eal arg", map[string]any{"interface": "eth0", "eal_args": []any{float64(1)}}, 1},
+	}
+	for _, tt := range tests {
+		if _, err := parseConfig(tt.cfg, 0, tt.count); err == nil {
+			t.Errorf("%s: parseConfig succeeded, want error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+//go:build dpdk
+
+package dpdk
+
+/*
+#cgo pkg-config: libdpdk
+
+#define _GNU_SOURCE
+#include <sched.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include <rte_eal.h>
+#include <rte_errno.h>
+#include <rte_ethdev.h>
+#include <rte_lcore.h>
+#include <rte_mbuf.h>
+
+// Symmetric RSS key: both directions of a flow hash to the same queue, like
+// the AF_PACKET fanout hash, so a pipeline sees a whole dialog.
+static uint8_t otus_rss_key[52] = {
+	0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d,
+	0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a,
+	0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d,
+	0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a, 0x6d, 0x5a,
+};
+
+static int otus_errno(void) { return rte_errno; }
+
+static int otus_port_setup(uint16_t port, uint16_t nb_rx, uint16_t nb_desc,
+                           struct rte_mempool *pool, int promisc) {
+	struct rte_eth_dev_info info;
+	struct rte_eth_conf conf;
+	int ret, q;
+
+	ret = rte_eth_dev_info_get(port, &info);
+	if (ret < 0)
+		return ret;
+
+	memset(&conf, 0, sizeof(conf));
+	if (nb_rx > 1) {
+		conf.rxmode.mq_mode = RTE_ETH_MQ_RX_RSS;
+		conf.rx_adv_conf.rss_conf.rss_key = otus_rss_key;
+		conf.rx_adv_conf.rss_conf.rss_key_len = info.hash_key_size ? info.hash_key_size : 40;
+		conf.rx_adv_conf.rss_conf.rss_hf =
+			(RTE_ETH_RSS_IP | RTE_ETH_RSS_UDP | RTE_ETH_RSS_TCP) & info.flow_type_rss_offloads;
+	}
+
+	ret = rte_eth_dev_configure(port, nb_rx, 0, &conf);
+	if (ret < 0)
+		return ret;
+	for (q = 0; q < nb_rx; q++) {
+		ret = rte_eth_rx_queue_setup(port, q, nb_desc, rte_eth_dev_socket_id(port), NULL, pool);
+		if (ret < 0)
+			return ret;
+	}
+	ret = rte_eth_dev_start(port);
+	if (ret < 0)
+		return ret;
+	if (promisc)
+		rte_eth_promiscuous_enable(port);
+	return 0;
+}
+
+static uint16_t otus_rx_burst(uint16_t port, uint16_t queue, struct rte_mbuf **bufs, uint16_t n) {
+	return rte_eth_rx_burst(port, queue, bufs, n);
+}
+
+static void *otus_mbuf_data(struct rte_mbuf *m) { return rte_pktmbuf_mtod(m, void *); }
+static uint16_t otus_mbuf_data_len(struct rte_mbuf *m) { return rte_pktmbuf_data_len(m); }
+static uint32_t otus_mbuf_pkt_len(struct rte_mbuf *m) { return rte_pktmbuf_pkt_len(m); }
+static void otus_mbuf_free(struct rte_mbuf *m) { rte_pktmbuf_free(m); }
+
+static uint64_t otus_port_imissed(uint16_t port) {
+	struct rte_eth_stats stats;
+	if (rte_eth_stats_get(port, &stats) != 0)
+		return 0;
+	return stats.imissed;
+}
+
+// otus_pin_thread pins the calling thread to cpu.
+static int otus_pin_thread(int cpu) {
+	cpu_set_t set;
+	CPU_ZERO(&set);
+	CPU_SET(cpu, &set);
+	return sched_setaffinity(0, sizeof(set), &set);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// EAL is initialised once per process, by the first capturer to start.
+var (
+	ealOnce sync.Once
+	ealErr  error
+)
+
+// initEAL runs rte_eal_init with args. The argv strings are intentionally
+// never freed: EAL may keep references to them.
+func initEAL(args []string) error {
+	ealOnce.Do(func() {
+		argv := make([]*C.char, 0, len(args)+1)
+		argv = append(argv, C.CString("otus"))
+		for _, a := range args {
+			argv = append(argv, C.CString(a))
+		}
+		cArgv := (**C.char)(C.malloc(C.size_t(len(argv)) * C.size_t(unsafe.Sizeof(uintptr(0)))))
+		copy(unsafe.Slice(cArgv, len(argv)), argv)
+
+		if ret := C.rte_eal_init(C.int(len(argv)), cArgv); ret < 0 {
+			ealErr = fmt.Errorf("rte_eal_init failed: %s", C.GoString(C.rte_strerror(C.otus_errno())))
+			return
+		}
+		slog.Info("dpdk EAL initialized", "args", args)
+	})
+	return ealErr
+}
+
+// port is a started DPDK port shared by the capturers polling its queues.
+type port struct {
+	id   C.uint16_t
+	pool *C.struct_rte_mempool
+	refs int
+}
+
+var (
+	portsMu sync.Mutex
+	ports   = make(map[string]*port)
+)
+
+// acquirePort configures and starts the port on first use and returns it.
+func acquirePort(cfg Config) (*port, error) {
+	portsMu.Lock()
+	defer portsMu.Unlock()
+
+	if p, ok := ports[cfg.Port]; ok {
+		p.refs++
+		return p, nil
+	}
+
+	name := C.CString(cfg.Port)
+	defer C.free(unsafe.Pointer(name))
+
+	var id C.uint16_t
+	if ret := C.rte_eth_dev_get_port_by_name(name, &id); ret != 0 {
+		return nil, fmt.Errorf("dpdk port %q not found (is it bound to a DPDK driver and listed in eal_args?)", cfg.Port)
+	}
+
+	poolName := C.CString(fmt.Sprintf("otus_%d", id))
+	defer C.free(unsafe.Pointer(poolName))
+	pool := C.rte_pktmbuf_pool_create(poolName, C.uint(cfg.Mbufs), defaultMbufCache, 0,
+		C.RTE_MBUF_DEFAULT_BUF_SIZE, C.int(C.rte_eth_dev_socket_id(id)))
+	if pool == nil {
+		return nil, fmt.Errorf("failed to create mbuf pool: %s", C.GoString(C.rte_strerror(C.otus_errno())))
+	}
+
+	promisc := 0
+	if cfg.Promiscuous {
+		promisc = 1
+	}
+	if ret := C.otus_port_setup(id, C.uint16_t(cfg.RxQueues), C.uint16_t(cfg.RxDescriptors), pool, C.int(promisc)); ret < 0 {
+		C.rte_mempool_free(pool)
+		return nil, fmt.Errorf("failed to set up dpdk port %q: %s", cfg.Port, C.GoString(C.rte_strerror(-ret)))
+	}
+
+	p := &port{id: id, pool: pool, refs: 1}
+	ports[cfg.Port] = p
+	slog.Info("dpdk port started", "port", cfg.Port, "port_id", int(id), "rx_queues", cfg.RxQueues)
+	return p, nil
+}
+
+// releasePort stops the port once its last capturer is done.
+func releasePort(name string) {
+	portsMu.Lock()
+	defer portsMu.Unlock()
+
+	p, ok := ports[name]
+	if !ok {
+		return
+	}
+	p.refs--
+	if p.refs > 0 {
+		return
+	}
+	C.rte_eth_dev_stop(p.id)
+	C.rte_mempool_free(p.pool)
+	delete(ports, name)
+	slog.Info("dpdk port stopped", "port", name)
+}
+
+// DPDKCapturer implements the Capturer interface using DPDK poll-mode drivers.
+type DPDKCapturer struct {
+	name   string
+	config Config
+	index  int
+	count  int
+
+	// Runtime state
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Statistics (atomic counters)
+	packetsReceived  atomic.Uint64
+	packetsDropped   atomic.Uint64
+	packetsIfDropped atomic.Uint64
+}
+
+// NewDPDKCapturer creates a new DPDK capturer instance.
+func NewDPDKCapturer() plugin.Capturer {
+	return &DPDKCapturer{
+		name:  pluginName,
+		count: 1,
+	}
+}
+
+// Name returns the plugin name.
+func (c *DPDKCapturer) Name() string {
+	return c.name
+}
+
+// SetQueue implements plugin.QueueAware.
+func (c *DPDKCapturer) SetQueue(index, count int) {
+	c.index, c.count = index, count
+}
+
+// Init initializes the capturer with configuration.
+func (c *DPDKCapturer) Init(cfg map[string]any) error {
+	config, err := parseConfig(cfg, c.index, c.count)
+	if err != nil {
+		return err
+	}
+	c.config = config
+
+	slog.Debug("dpdk initialized",
+		"port", c.config.Port,
+		"queues", c.config.queues(c.index, c.count),
+		"lcore", c.config.lcore(c.index),
+		"burst_size", c.config.BurstSize)
+
+	return nil
+}
+
+// Start initialises EAL (once per process) so EAL errors fail the task start.
+func (c *DPDKCapturer) Start(ctx context.Context) error {
+	if err := initEAL(c.config.EALArgs); err != nil {
+		return err
+	}
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+// Stop stops the capturer by cancelling the context. The port is released by
+// Capture once its poll loop has returned, never while a burst is in flight.
+func (c *DPDKCapturer) Stop(ctx context.Context) error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	return nil
+}
+
+// Capture polls the capturer's RX queues until ctx or the Start context is
+// cancelled. The polling goroutine is locked to its OS thread, pinned to the
+// configured lcore and registered with EAL so mbuf frees use the per-lcore
+// mempool cache.
+func (c *DPDKCapturer) Capture(ctx context.Context, output chan<- core.RawPacket) error {
+	p, err := acquirePort(c.config)
+	if err != nil {
+		return err
+	}
+	defer releasePort(c.config.Port)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if lc := c.config.lcore(c.index); lc >= 0 {
+		if ret := C.otus_pin_thread(C.int(lc)); ret != 0 {
+			slog.Warn("dpdk failed to pin polling thread", "port", c.config.Port, "lcore", lc)
+		}
+	}
+	if C.rte_thread_register() == 0 {
+		defer C.rte_thread_unregister()
+	}
+
+	queues := c.config.queues(c.index, c.count)
+	burst := c.config.BurstSize
+	bufs := make([]*C.struct_rte_mbuf, burst)
+
+	done := ctx.Done()
+	var stopped <-chan struct{}
+	if c.ctx != nil {
+		stopped = c.ctx.Done()
+	}
+
+	slog.Info("dpdk capture started",
+		"port", c.config.Port,
+		"queues", queues,
+		"lcore", c.config.lcore(c.index))
+
+	for polls := 0; ; polls++ {
+		select {
+		case <-done:
+			slog.Info("dpdk capture stopped", "port", c.config.Port, "queues", queues)
+			return nil
+		case <-stopped:
+			slog.Info("dpdk capture stopped", "port", c.config.Port, "queues", queues)
+			return nil
+		default:
+		}
+
+		for _, q := range queues {
+			n := int(C.otus_rx_burst(p.id, C.uint16_t(q), &bufs[0], C.uint16_t(burst)))
+			now := time.Now()
+			for i := 0; i < n; i++ {
+				m := bufs[i]
+				dataLen := C.otus_mbuf_data_len(m)
+				raw := core.RawPacket{
+					Data:           C.GoBytes(C.otus_mbuf_data(m), C.int(dataLen)),
+					Timestamp:      now,
+					CaptureLen:     uint32(dataLen),
+					OrigLen:        uint32(C.otus_mbuf_pkt_len(m)),
+					InterfaceIndex: int(p.id),
+				}
+				C.otus_mbuf_free(m)
+				c.packetsReceived.Add(1)
+
+				// Non-blocking send: prefer drop over stalling the RX ring.
+				select {
+				case output <- raw:
+				default:
+					c.packetsDropped.Add(1)
+				}
+			}
+		}
+
+		// NIC drops are port-wide: only capturer 0 reports them so the
+		// per-task sum is not multiplied by the number of queues.
+		if c.index == 0 && polls%4096 == 0 {
+			c.packetsIfDropped.Store(uint64(C.otus_port_imissed(p.id)))
+		}
+	}
+}
+
+// Stats returns capture statistics.
+func (c *DPDKCapturer) Stats() plugin.CaptureStats {
+	return plugin.CaptureStats{
+		PacketsReceived:  c.packetsReceived.Load(),
+		PacketsDropped:   c.packetsDropped.Load(),
+		PacketsIfDropped: c.packetsIfDropped.Load(),
+	}
+}
@@ -0,0 +1,138 @@
+//go:build linux
+
+package erspan
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// GRE header flags and protocol types (RFC 2784, RFC 2890).
+const (
+	greChecksum = 0x8000
+	greRouting  = 0x4000
+	greKey      = 0x2000
+	greSeq      = 0x1000
+	greVersion  = 0x0007
+
+	protoERSPAN2 = 0x88be // ERSPAN Type I and II
+	protoERSPAN3 = 0x22eb // ERSPAN Type III
+	protoTEB     = 0x6558 // Transparent Ethernet Bridging (gretap)
+	protoIPv4    = 0x0800
+	protoIPv6    = 0x86dd
+)
+
+// ERSPAN header lengths and fields.
+const (
+	erspan2Len       = 8
+	erspan3Len       = 12
+	erspan3SubLen    = 8 // platform-specific subheader, when O is set
+	erspanVersion2   = 1 // Ver field of Type II
+	erspanVersion3   = 2 // Ver field of Type III
+	erspanSessionMsk = 0x03ff
+	erspan3FrameIP   = 2 // FT field: the payload is an IP packet
+)
+
+// errNotMirror marks a GRE packet that is not mirrored traffic, e.g. of a
+// GRE tunnel terminating on the host.
+var errNotMirror = errors.New("not mirrored traffic")
+
+// mirror describes one decapsulated packet.
+type mirror struct {
+	// ethType is the EtherType of an IP payload, which needs an Ethernet
+	// header; 0 when the payload is an Ethernet frame.
+	ethType uint16
+	// erspan is set for ERSPAN, with its session ID.
+	erspan  bool
+	session uint16
+}
+
+// decap strips the GRE and mirror headers from b, a GRE packet without its
+// IP header, and returns the mirrored payload, a slice of b.
+func decap(b []byte) ([]byte, mirror, error) {
+	var m mirror
+	if len(b) < 4 {
+		return nil, m, fmt.Errorf("short GRE header (%d bytes)", len(b))
+	}
+	flags := binary.BigEndian.Uint16(b)
+	proto := binary.BigEndian.Uint16(b[2:])
+	if v := flags & greVersion; v != 0 {
+		return nil, m, fmt.Errorf("%w: GRE version %d", errNotMirror, v)
+	}
+	if flags&greRouting != 0 {
+		return nil, m, fmt.Errorf("GRE source routing not supported")
+	}
+	off := 4
+	for _, f := range []uint16{greChecksum, greKey, greSeq} {
+		if flags&f != 0 {
+			off += 4
+		}
+	}
+	if len(b) < off {
+		return nil, m, fmt.Errorf("short GRE header (%d bytes, want %d)", len(b), off)
+	}
+	b = b[off:]
+
+	switch proto {
+	case protoERSPAN2:
+		// Type I has no sequence number and no ERSPAN header
+		if flags&greSeq == 0 {
+			m.erspan = true
+			return b, m, nil
+		}
+		if len(b) < erspan2Len {
+			return nil, m, fmt.Errorf("short ERSPAN Type II header")
+		}
+		if v := b[0] >> 4; v != erspanVersion2 {
+			return nil, m, fmt.Errorf("ERSPAN Type II header with version %d", v)
+		}
+		m.erspan = true
+		m.session = binary.BigEndian.Uint16(b[2:]) & erspanSessionMsk
+		return b[erspan2Len:], m, nil
+	case protoERSPAN3:
+		if len(b) < erspan3Len {
+			return nil, m, fmt.Errorf("short ERSPAN Type III header")
+		}
+		if v := b[0] >> 4; v != erspanVersion3 {
+			return nil, m, fmt.Errorf("ERSPAN Type III header with version %d", v)
+		}
+		m.erspan = true
+		m.session = binary.BigEndian.Uint16(b[2:]) & erspanSessionMsk
+		w := binary.BigEndian.Uint16(b[10:])
+		n := erspan3Len
+		if w&1 != 0 {
+			n += erspan3SubLen
+		}
+		if len(b) < n {
+			return nil, m, fmt.Errorf("short ERSPAN Type III subheader")
+		}
+		b = b[n:]
+		if (w>>10)&0x1f == erspan3FrameIP {
+			return ipPayload(b, m)
+		}
+		return b, m, nil
+	case protoTEB:
+		return b, m, nil
+	case protoIPv4, protoIPv6:
+		m.ethType = proto
+		return b, m, nil
+	}
+	return nil, m, fmt.Errorf("%w: GRE protocol %#04x", errNotMirror, proto)
+}
+
+// ipPayload returns b, an IP packet, with the EtherType of its version.
+func ipPayload(b []byte, m mirror) ([]byte, mirror, error) {
+	if len(b) == 0 {
+		return nil, m, fmt.Errorf("empty IP payload")
+	}
+	switch b[0] >> 4 {
+	case 4:
+		m.ethType = protoIPv4
+	case 6:
+		m.ethType = protoIPv6
+	default:
+		return nil, m, fmt.Errorf("IP payload with version %d", b[0]>>4)
+	}
+	return b, m, nil
+}
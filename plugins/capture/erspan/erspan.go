@@ -0,0 +1,297 @@
+//go:build linux
+
+// Package erspan implements a capture plugin that receives traffic mirrored
+// by switches and routers over GRE: ERSPAN Type I, II and III, Ethernet over
+// GRE (gretap, protocol 0x6558) and IP over GRE. The mirror encapsulation is
+// stripped and the inner frame emitted, so Otus can sit off a SPAN-over-GRE
+// session instead of inline; IP payloads get an Ethernet header with zero
+// addresses.
+//
+// GRE is read from a raw IP socket (CAP_NET_RAW), which receives a copy of
+// every GRE packet for the host, so the capturer is standalone: one per task.
+package erspan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"firestige.xyz/otus/internal/audit"
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+	"firestige.xyz/otus/plugins/capture/internal/standalone"
+)
+
+const (
+	pluginName = "erspan"
+
+	// anyInterface receives GRE from every interface.
+	anyInterface = "any"
+
+	// Default configuration values
+	defaultSnapLen    = 65535
+	defaultReadBuffer = 8 << 20
+
+	// maxSession is the largest ERSPAN session ID (10 bits).
+	maxSession = 1023
+
+	ethHeaderLen = 14
+)
+
+// Config represents erspan-specific configuration.
+type Config struct {
+	Interface  string          `json:"interface"`   // required, receiving interface or "any"
+	Listen     string          `json:"listen"`      // optional, local address the mirror sends to, default 0.0.0.0; an IPv6 address reads GRE over IPv6
+	Sessions   map[uint16]bool `json:"sessions"`    // optional, ERSPAN session IDs to accept, default all
+	PlainGRE   bool            `json:"plain_gre"`   // optional, accept gretap and IP over GRE too, default true
+	SnapLen    int             `json:"snap_len"`    // optional, inner frame bytes kept, default 65535
+	ReadBuffer int             `json:"read_buffer"` // optional, socket receive buffer bytes, default 8 MiB
+}
+
+// ERSPANCapturer implements the Capturer interface over mirrored GRE traffic.
+type ERSPANCapturer struct {
+	standalone.Lifecycle
+
+	name   string
+	config Config
+
+	// Statistics (atomic counters)
+	packetsReceived atomic.Uint64
+	packetsDropped  atomic.Uint64
+	packetsSkipped  atomic.Uint64 // GRE that is not accepted mirrored traffic
+}
+
+// NewERSPANCapturer creates a new ERSPAN capturer instance.
+func NewERSPANCapturer() plugin.Capturer {
+	return &ERSPANCapturer{
+		name: pluginName,
+	}
+}
+
+// Name returns the plugin name.
+func (c *ERSPANCapturer) Name() string {
+	return c.name
+}
+
+// Init initializes the capturer with configuration.
+func (c *ERSPANCapturer) Init(cfg map[string]any) error {
+	if err := c.CheckSingle(pluginName, "would each receive every mirrored packet"); err != nil {
+		return err
+	}
+
+	c.config = Config{
+		Listen:     "0.0.0.0",
+		PlainGRE:   true,
+		SnapLen:    defaultSnapLen,
+		ReadBuffer: defaultReadBuffer,
+	}
+
+	if iface, ok := cfg["interface"].(string); ok && iface != "" {
+		c.config.Interface = iface
+	} else {
+		return fmt.Errorf("erspan: interface is required")
+	}
+
+	if listen, ok := cfg["listen"].(string); ok && listen != "" {
+		if _, err := netip.ParseAddr(listen); err != nil {
+			return fmt.Errorf("erspan: invalid listen address %q", listen)
+		}
+		c.config.Listen = listen
+	}
+
+	if sessions, ok := cfg["sessions"].([]any); ok && len(sessions) > 0 {
+		c.config.Sessions = make(map[uint16]bool, len(sessions))
+		for _, s := range sessions {
+			id, ok := s.(float64)
+			if !ok || id < 0 || id > maxSession || id != float64(int(id)) {
+				return fmt.Errorf("erspan: invalid session %v (0-%d)", s, maxSession)
+			}
+			c.config.Sessions[uint16(id)] = true
+		}
+	}
+
+	if filter, ok := cfg["bpf_filter"].(string); ok && filter != "" {
+		slog.Warn("erspan: bpf_filter is not supported and is ignored", "bpf_filter", filter)
+	}
+
+	if plain, ok := cfg["plain_gre"].(bool); ok {
+		c.config.PlainGRE = plain
+	}
+
+	if snapLen, ok := cfg["snap_len"].(float64); ok && snapLen > 0 {
+		if snapLen < ethHeaderLen {
+			// frame writes the Ethernet header of IP payloads in full
+			return fmt.Errorf("erspan: snap_len must be at least %d, got %v", ethHeaderLen, snapLen)
+		}
+		c.config.SnapLen = int(snapLen)
+	}
+
+	if rb, ok := cfg["read_buffer"].(float64); ok {
+		if rb < 0 {
+			return fmt.Errorf("erspan: read_buffer must not be negative")
+		}
+		c.config.ReadBuffer = int(rb)
+	}
+
+	slog.Debug("erspan initialized",
+		"interface", c.config.Interface,
+		"listen", c.config.Listen,
+		"sessions", len(c.config.Sessions),
+		"plain_gre", c.config.PlainGRE)
+
+	return nil
+}
+
+// HealthCheck implements plugin.HealthChecker: a bound interface must still
+// be present and up.
+func (c *ERSPANCapturer) HealthCheck(_ context.Context) error {
+	if c.config.Interface == anyInterface {
+		return nil
+	}
+	return audit.CheckInterface(c.config.Interface)
+}
+
+// Capture reads GRE packets until ctx is cancelled and emits the mirrored
+// frames.
+func (c *ERSPANCapturer) Capture(ctx context.Context, output chan<- core.RawPacket) error {
+	ctx, cancel := c.Context(ctx)
+	defer cancel()
+
+	conn, ifIndex, err := c.listen(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	slog.Info("erspan capture started", "interface", c.config.Interface, "listen", c.config.Listen)
+
+	buf := make([]byte, 65535)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				slog.Info("erspan capture stopped", "interface", c.config.Interface,
+					"packets", c.packetsReceived.Load(), "skipped", c.packetsSkipped.Load())
+				return nil
+			}
+			return fmt.Errorf("erspan: read: %w: %w", core.ErrTransient, err)
+		}
+		now := time.Now()
+
+		data, origLen, ok := c.frame(buf[:n])
+		if !ok {
+			continue
+		}
+		c.packetsReceived.Add(1)
+
+		raw := core.RawPacket{
+			Data:           data,
+			Timestamp:      now,
+			CaptureLen:     uint32(len(data)),
+			OrigLen:        uint32(origLen),
+			InterfaceIndex: ifIndex,
+		}
+
+		// Non-blocking send: prefer drop over blocking the read loop.
+		select {
+		case output <- raw:
+		case <-ctx.Done():
+			slog.Info("erspan capture stopped", "interface", c.config.Interface)
+			return nil
+		default:
+			c.packetsDropped.Add(1)
+		}
+	}
+}
+
+// frame decapsulates a GRE packet and returns a copy of the mirrored frame
+// cut to snap_len, with its original length; ok is false for packets that
+// are skipped.
+func (c *ERSPANCapturer) frame(gre []byte) (data []byte, origLen int, ok bool) {
+	payload, m, err := decap(gre)
+	if err == nil {
+		switch {
+		case m.erspan && c.config.Sessions != nil && !c.config.Sessions[m.session]:
+			err = fmt.Errorf("%w: ERSPAN session %d", errNotMirror, m.session)
+		case !m.erspan && !c.config.PlainGRE:
+			err = fmt.Errorf("%w: plain GRE", errNotMirror)
+		}
+	}
+	if err != nil {
+		c.packetsSkipped.Add(1)
+		slog.Debug("erspan packet skipped", "error", err)
+		return nil, 0, false
+	}
+
+	hdr := 0
+	if m.ethType != 0 {
+		hdr = ethHeaderLen
+	}
+	origLen = hdr + len(payload)
+	data = make([]byte, min(origLen, c.config.SnapLen))
+	if hdr > 0 {
+		binary.BigEndian.PutUint16(data[12:], m.ethType)
+	}
+	copy(data[hdr:], payload)
+	return data, origLen, true
+}
+
+// listen opens the raw GRE socket, bound to the interface unless it is
+// "any", and returns it with the interface index.
+func (c *ERSPANCapturer) listen(ctx context.Context) (net.PacketConn, int, error) {
+	network := "ip4:gre"
+	if addr := netip.MustParseAddr(c.config.Listen); addr.Is6() && !addr.Is4In6() {
+		network = "ip6:gre"
+	}
+
+	ifIndex := 0
+	lc := net.ListenConfig{}
+	if c.config.Interface != anyInterface {
+		ifi, err := net.InterfaceByName(c.config.Interface)
+		if err != nil {
+			return nil, 0, fmt.Errorf("erspan: %w: %w", core.ErrConfig, err)
+		}
+		ifIndex = ifi.Index
+		lc.Control = func(_, _ string, rc syscall.RawConn) error {
+			var serr error
+			err := rc.Control(func(fd uintptr) {
+				serr = unix.SetsockoptString(int(fd), unix.SOL_SOCKET, unix.SO_BINDTODEVICE, c.config.Interface)
+			})
+			if err != nil {
+				return err
+			}
+			return serr
+		}
+	}
+
+	conn, err := lc.ListenPacket(ctx, network, c.config.Listen)
+	if err != nil {
+		return nil, 0, fmt.Errorf("erspan: listen %s %s: %w: %w (needs CAP_NET_RAW)", network, c.config.Listen, core.ErrConfig, err)
+	}
+	if c.config.ReadBuffer > 0 {
+		if err := conn.(*net.IPConn).SetReadBuffer(c.config.ReadBuffer); err != nil {
+			slog.Warn("erspan: failed to set read buffer", "bytes", c.config.ReadBuffer, "error", err)
+		}
+	}
+	return conn, ifIndex, nil
+}
+
+// Stats returns capture statistics.
+func (c *ERSPANCapturer) Stats() plugin.CaptureStats {
+	return plugin.CaptureStats{
+		PacketsReceived: c.packetsReceived.Load(),
+		PacketsDropped:  c.packetsDropped.Load(),
+	}
+}
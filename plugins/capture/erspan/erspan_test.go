@@ -0,0 +1,195 @@
+//go:build linux
+
+package erspan
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// inner is a mirrored Ethernet frame.
+var inner = append(bytes.Repeat([]byte{0xaa}, 12), 0x08, 0x00, 0x45, 0, 0, 20)
+
+func gre(flags, proto uint16, extra int, payload ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, flags)
+	b = binary.BigEndian.AppendUint16(b, proto)
+	b = append(b, make([]byte, extra)...)
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func erspan2(session uint16) []byte {
+	h := make([]byte, erspan2Len)
+	binary.BigEndian.PutUint16(h, erspanVersion2<<12|100) // VLAN 100
+	binary.BigEndian.PutUint16(h[2:], session)
+	return h
+}
+
+func erspan3(session uint16, frameType uint16, sub bool) []byte {
+	h := make([]byte, erspan3Len)
+	binary.BigEndian.PutUint16(h, erspanVersion3<<12)
+	binary.BigEndian.PutUint16(h[2:], session)
+	w := frameType << 10
+	if sub {
+		w |= 1
+		h = append(h, make([]byte, erspan3SubLen)...)
+	}
+	binary.BigEndian.PutUint16(h[10:], w)
+	return h
+}
+
+func TestDecap(t *testing.T) {
+	ipPkt := inner[14:]
+	tests := []struct {
+		name    string
+		pkt     []byte
+		want    []byte
+		ethType uint16
+		session uint16
+		erspan  bool
+	}{
+		{"type I", gre(0, protoERSPAN2, 0, inner), inner, 0, 0, true},
+		{"type II", gre(greSeq, protoERSPAN2, 4, erspan2(42), inner), inner, 0, 42, true},
+		{"type II key", gre(greSeq|greKey|greChecksum, protoERSPAN2, 12, erspan2(7), inner), inner, 0, 7, true},
+		{"type III", gre(greSeq, protoERSPAN3, 4, erspan3(1023, 0, false), inner), inner, 0, 1023, true},
+		{"type III subheader", gre(greSeq, protoERSPAN3, 4, erspan3(5, 0, true), inner), inner, 0, 5, true},
+		{"type III ip", gre(greSeq, protoERSPAN3, 4, erspan3(5, erspan3FrameIP, false), ipPkt), ipPkt, protoIPv4, 5, true},
+		{"gretap", gre(greKey, protoTEB, 4, inner), inner, 0, 0, false},
+		{"ip over gre", gre(0, protoIPv6, 0, ipPkt), ipPkt, protoIPv6, 0, false},
+	}
+	for _, tt := range tests {
+		got, m, err := decap(tt.pkt)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) || m.ethType != tt.ethType || m.session != tt.session || m.erspan != tt.erspan {
+			t.Errorf("%s: got % x %+v, want % x ethType %#x session %d", tt.name, got, m, tt.want, tt.ethType, tt.session)
+		}
+	}
+
+	for name, pkt := range map[string][]byte{
+		"short":          {0, 0},
+		"pptp":           gre(1, 0x880b, 0),
+		"routing":        gre(greRouting, protoTEB, 0, inner),
+		"short options":  gre(greKey|greSeq, protoERSPAN2, 4),
+		"bad version":    gre(greSeq, protoERSPAN2, 4, erspan3(1, 0, false), inner),
+		"short type III": gre(greSeq, protoERSPAN3, 4, erspan3(1, 0, true)[:14]),
+		"other protocol": gre(0, 0x8847, 0, inner),
+	} {
+		if _, _, err := decap(pkt); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	c := NewERSPANCapturer().(*ERSPANCapturer)
+	err := c.Init(map[string]any{"interface": "any", "sessions": []any{float64(1), float64(42)}, "plain_gre": false, "snap_len": float64(128)})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if !c.config.Sessions[42] || c.config.PlainGRE || c.config.SnapLen != 128 || c.config.Listen != "0.0.0.0" {
+		t.Errorf("config = %+v", c.config)
+	}
+
+	for _, cfg := range []map[string]any{
+		{},
+		{"interface": "any", "listen": "gateway"},
+		{"interface": "any", "sessions": []any{float64(1024)}},
+		{"interface": "any", "read_buffer": float64(-1)},
+		{"interface": "any", "snap_len": float64(13)},
+	} {
+		if err := NewERSPANCapturer().Init(cfg); err == nil {
+			t.Errorf("Init(%v): expected error", cfg)
+		}
+	}
+
+	c = NewERSPANCapturer().(*ERSPANCapturer)
+	c.SetQueue(0, 2)
+	if err := c.Init(map[string]any{"interface": "any"}); err == nil || !strings.Contains(err.Error(), "dispatch") {
+		t.Errorf("two capturers: err = %v", err)
+	}
+}
+
+func TestFrame(t *testing.T) {
+	c := NewERSPANCapturer().(*ERSPANCapturer)
+	if err := c.Init(map[string]any{"interface": "any", "sessions": []any{float64(42)}, "snap_len": float64(16)}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, origLen, ok := c.frame(gre(greSeq, protoERSPAN2, 4, erspan2(42), inner))
+	if !ok || !bytes.Equal(data, inner[:16]) || origLen != len(inner) {
+		t.Errorf("frame = % x (%d), ok %v, want snap_len cut of the inner frame", data, origLen, ok)
+	}
+	if _, _, ok := c.frame(gre(greSeq, protoERSPAN2, 4, erspan2(43), inner)); ok {
+		t.Error("session 43 accepted")
+	}
+
+	// IP payloads get an Ethernet header
+	data, _, ok = c.frame(gre(0, protoIPv4, 0, inner[14:]))
+	if !ok || binary.BigEndian.Uint16(data[12:]) != protoIPv4 || !bytes.Equal(data[14:], inner[14:16]) {
+		t.Errorf("ip over gre = % x", data)
+	}
+	if got := c.packetsSkipped.Load(); got != 1 {
+		t.Errorf("skipped = %d, want 1", got)
+	}
+}
+
+// TestCaptureLoopback sends ERSPAN over loopback; it needs CAP_NET_RAW.
+func TestCaptureLoopback(t *testing.T) {
+	send, err := net.ListenPacket("ip4:gre", "127.0.0.1")
+	if err != nil {
+		t.Skipf("no raw sockets: %v", err)
+	}
+	defer send.Close()
+
+	c := NewERSPANCapturer().(*ERSPANCapturer)
+	if err := c.Init(map[string]any{"interface": "lo", "listen": "127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	output := make(chan core.RawPacket, 8)
+	done := make(chan error, 1)
+	go func() { done <- c.Capture(ctx, output) }()
+
+	dst := &net.IPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	var got core.RawPacket
+wait:
+	for {
+		select {
+		case got = <-output:
+			break wait
+		case <-tick.C:
+			// The socket may not be open yet
+			send.WriteTo(gre(greSeq, protoERSPAN3, 4, erspan3(9, 0, false), inner), dst)
+		case <-deadline:
+			t.Fatal("no packet captured")
+		}
+	}
+	if !bytes.Equal(got.Data, inner) || got.InterfaceIndex == 0 {
+		t.Errorf("captured % x on interface %d, want the inner frame on lo", got.Data, got.InterfaceIndex)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Capture: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Capture did not return after cancel")
+	}
+}
@@ -0,0 +1,64 @@
+// Package standalone holds the lifecycle shared by capturers whose source
+// can only be read by one capturer: a byte stream read once, or a raw socket
+// that receives a copy of every packet. A task using such a capturer must
+// run a single capturer: dispatch_mode "dispatch", or "binding" with one
+// worker.
+package standalone
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lifecycle implements Start, Stop and plugin.QueueAware for a standalone
+// capturer doing its work in Capture. The capturer embeds it, calls
+// CheckSingle from Init and runs Capture under Context.
+type Lifecycle struct {
+	count int // capturers of the task (SetQueue)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// SetQueue records how many capturers the task runs, for CheckSingle.
+func (l *Lifecycle) SetQueue(index, count int) {
+	l.count = count
+}
+
+// CheckSingle returns an error when the task runs more than one capturer.
+// what names what each of them would do, e.g. "would read the same stream".
+func (l *Lifecycle) CheckSingle(name, what string) error {
+	if l.count > 1 {
+		return fmt.Errorf("%s: %d capturers %s; use dispatch_mode \"dispatch\" or one worker", name, l.count, what)
+	}
+	return nil
+}
+
+// Start starts the capturer (no-op, actual work in Capture).
+func (l *Lifecycle) Start(ctx context.Context) error {
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	return nil
+}
+
+// Stop stops the capturer by cancelling the context of Capture, which
+// closes its source so a blocked read returns.
+func (l *Lifecycle) Stop(ctx context.Context) error {
+	if l.cancel != nil {
+		l.cancel()
+	}
+	return nil
+}
+
+// Context returns a context cancelled when either ctx is done or, once
+// Start has run, the capturer is stopped. Capture calls cancel on return.
+func (l *Lifecycle) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.ctx == nil {
+		return context.WithCancel(ctx)
+	}
+	merged, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(l.ctx, cancel)
+	return merged, func() {
+		stop()
+		cancel()
+	}
+}
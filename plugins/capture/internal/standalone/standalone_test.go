@@ -0,0 +1,44 @@
+package standalone
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLifecycle_CheckSingle(t *testing.T) {
+	var l Lifecycle
+	if err := l.CheckSingle("test", "would read the same stream"); err != nil {
+		t.Errorf("no SetQueue: err = %v", err)
+	}
+	l.SetQueue(0, 1)
+	if err := l.CheckSingle("test", "would read the same stream"); err != nil {
+		t.Errorf("one capturer: err = %v", err)
+	}
+	l.SetQueue(0, 2)
+	if err := l.CheckSingle("test", "would read the same stream"); err == nil || !strings.Contains(err.Error(), "dispatch") {
+		t.Errorf("two capturers: err = %v", err)
+	}
+}
+
+func TestLifecycle_StopCancelsCapture(t *testing.T) {
+	var l Lifecycle
+	ctx, cancel := l.Context(context.Background())
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("cancel before Start did not cancel the context")
+	}
+
+	if err := l.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = l.Context(context.Background())
+	defer cancel()
+	if ctx.Err() != nil {
+		t.Fatal("context done before Stop")
+	}
+	if err := l.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-ctx.Done()
+}
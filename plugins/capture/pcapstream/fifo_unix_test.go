@@ -0,0 +1,62 @@
+//go:build unix
+
+package pcapstream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestCapture_FIFOReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.fifo")
+	if err := syscall.Mkfifo(path, 0o600); err != nil {
+		t.Skipf("mkfifo: %v", err)
+	}
+	c := newCapturer(t, map[string]any{"path": path}, nil)
+
+	output := make(chan core.RawPacket, 10)
+	done := make(chan error, 1)
+	go func() { done <- c.Capture(context.Background(), output) }()
+
+	// Two writers in turn: classic pcap, then pcapng.
+	for _, stream := range [][]byte{
+		pcapStream(t, layers.LinkTypeEthernet, frame(1), frame(2)),
+		pcapngSection(t, frame(3)),
+	} {
+		if err := os.WriteFile(path, stream, 0o600); err != nil {
+			t.Fatalf("write fifo: %v", err)
+		}
+	}
+
+	for i := byte(1); i <= 3; i++ {
+		select {
+		case pkt := <-output:
+			if pkt.Data[0] != i {
+				t.Errorf("packet %d = %x", i, pkt.Data[0])
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for packet %d", i)
+		}
+	}
+
+	// Stop while blocked waiting for the next writer.
+	if err := c.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Capture: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Capture did not return after Stop")
+	}
+}
@@ -0,0 +1,349 @@
+// Package pcapstream implements a capture plugin that reads pcap or pcapng data
+// from stdin or a named pipe (FIFO), e.g. "tcpdump -w - | otus ..." or a
+// remote tshark/dumpcap writing into a FIFO.
+//
+// One stream can only be read once, so the capturer is standalone: one per
+// task.
+package pcapstream
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+	"firestige.xyz/otus/plugins/capture/internal/standalone"
+)
+
+const (
+	pluginName = "pcapstream"
+
+	// stdinPath selects standard input as the stream source.
+	stdinPath = "-"
+
+	// Default configuration values
+	defaultReopenDelay = time.Second
+
+	// pcapngMagic is the block type of a pcapng Section Header Block.
+	pcapngMagic = 0x0A0D0D0A
+)
+
+// Config represents pcapstream-specific configuration.
+type Config struct {
+	Path        string        `json:"path"`         // optional, "-" (default) = stdin, otherwise a FIFO path
+	Reopen      bool          `json:"reopen"`       // optional, reopen the FIFO when the writer goes away, default true
+	ReopenDelay time.Duration `json:"reopen_delay"` // optional, wait before reopening after a stream error, default 1s
+}
+
+// PcapStreamCapturer implements the Capturer interface over a pcap/pcapng byte stream.
+type PcapStreamCapturer struct {
+	standalone.Lifecycle
+
+	name   string
+	config Config
+
+	// stdin is the source for Path "-"; replaced in tests.
+	stdin io.ReadCloser
+
+	// Runtime state
+	mu      sync.Mutex
+	current io.Closer // stream being read, closed on shutdown to unblock reads
+
+	// Statistics (atomic counters)
+	packetsReceived atomic.Uint64
+	streams         atomic.Uint64
+}
+
+// NewPcapStreamCapturer creates a new pcap stream capturer instance.
+func NewPcapStreamCapturer() plugin.Capturer {
+	return &PcapStreamCapturer{
+		name:  pluginName,
+		stdin: os.Stdin,
+	}
+}
+
+// Name returns the plugin name.
+func (c *PcapStreamCapturer) Name() string {
+	return c.name
+}
+
+// Init initializes the capturer with configuration.
+func (c *PcapStreamCapturer) Init(cfg map[string]any) error {
+	if err := c.CheckSingle(pluginName, "would read the same stream"); err != nil {
+		return err
+	}
+
+	c.config = Config{
+		Path:        stdinPath,
+		Reopen:      true,
+		ReopenDelay: defaultReopenDelay,
+	}
+
+	if path, ok := cfg["path"].(string); ok && path != "" {
+		c.config.Path = path
+	}
+
+	if reopen, ok := cfg["reopen"].(bool); ok {
+		c.config.Reopen = reopen
+	}
+
+	if delay, ok := cfg["reopen_delay"].(string); ok {
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return fmt.Errorf("pcapstream: invalid reopen_delay %q", delay)
+		}
+		c.config.ReopenDelay = d
+	}
+
+	if c.config.Path != stdinPath {
+		info, err := os.Stat(c.config.Path)
+		if err != nil {
+			return fmt.Errorf("pcapstream: %w", err)
+		}
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("pcapstream: %s is not a named pipe", c.config.Path)
+		}
+	}
+
+	slog.Debug("pcapstream initialized",
+		"path", c.config.Path,
+		"reopen", c.config.Reopen,
+		"reopen_delay", c.config.ReopenDelay)
+
+	return nil
+}
+
+// Capture reads packets from the stream until ctx is cancelled or the stream
+// ends. For a FIFO with reopen enabled, a writer closing its end (tcpdump or
+// tshark restarting) is not the end: the FIFO is reopened and the next writer's
+// stream, with its own pcap header or pcapng section header, is read.
+func (c *PcapStreamCapturer) Capture(ctx context.Context, output chan<- core.RawPacket) error {
+	ctx, cancel := c.Context(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		c.closeCurrent()
+	}()
+
+	slog.Info("pcapstream capture started", "path", c.config.Path)
+
+	for {
+		src, err := c.open(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				slog.Info("pcapstream capture stopped", "path", c.config.Path)
+				return nil
+			}
+			return fmt.Errorf("failed to open %s: %w: %w", c.config.Path, core.ErrTransient, err)
+		}
+
+		c.streams.Add(1)
+		err = c.readStream(ctx, src, output)
+		c.closeCurrent()
+
+		if ctx.Err() != nil {
+			slog.Info("pcapstream capture stopped", "path", c.config.Path)
+			return nil
+		}
+
+		if c.config.Path == stdinPath || !c.config.Reopen {
+			if err != nil {
+				return err
+			}
+			slog.Info("pcapstream stream ended", "path", c.config.Path,
+				"packets", c.packetsReceived.Load())
+			return nil
+		}
+
+		if err != nil {
+			// Corrupt or unsupported stream: back off so a misbehaving writer
+			// does not spin the loop, then wait for the next one.
+			slog.Warn("pcapstream stream error, reopening", "path", c.config.Path,
+				"error", err, "delay", c.config.ReopenDelay)
+			select {
+			case <-ctx.Done():
+				slog.Info("pcapstream capture stopped", "path", c.config.Path)
+				return nil
+			case <-time.After(c.config.ReopenDelay):
+			}
+			continue
+		}
+		slog.Info("pcapstream writer closed, reopening", "path", c.config.Path,
+			"streams", c.streams.Load())
+	}
+}
+
+// open returns the stream source. Opening a FIFO blocks until a writer
+// connects, so it runs in a goroutine that ctx can abandon; a FIFO opened after
+// cancellation is closed straight away.
+func (c *PcapStreamCapturer) open(ctx context.Context) (io.Reader, error) {
+	if c.config.Path == stdinPath {
+		c.setCurrent(c.stdin)
+		return c.stdin, nil
+	}
+
+	type result struct {
+		f   *os.File
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		f, err := os.Open(c.config.Path)
+		done <- result{f, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		c.setCurrent(r.f)
+		if ctx.Err() != nil {
+			c.closeCurrent()
+			return nil, ctx.Err()
+		}
+		return r.f, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.f != nil {
+				r.f.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// packetReader is implemented by both pcapgo.Reader and pcapgo.NgReader.
+type packetReader interface {
+	gopacket.PacketDataSource
+	LinkType() layers.LinkType
+}
+
+// readStream reads one writer's stream until EOF. The format is detected from
+// the first four bytes. A pcapng stream may carry further section headers
+// (e.g. dumpcap ring restarts), which the pcapng reader handles in-line; a
+// classic pcap stream is checked for a new file header before every record,
+// since a writer restarting while the FIFO stays open starts over mid-stream.
+func (c *PcapStreamCapturer) readStream(ctx context.Context, src io.Reader, output chan<- core.RawPacket) error {
+	br := bufio.NewReader(src)
+	for {
+		magic, err := br.Peek(4)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// Writer connected and left without sending anything.
+				return nil
+			}
+			return fmt.Errorf("read stream header: %w", err)
+		}
+
+		var r packetReader
+		ng := binary.LittleEndian.Uint32(magic) == pcapngMagic
+		if ng {
+			r, err = pcapgo.NewNgReader(br, pcapgo.DefaultNgReaderOptions)
+		} else {
+			r, err = pcapgo.NewReader(br)
+		}
+		if err != nil {
+			return fmt.Errorf("read stream header: %w", err)
+		}
+
+		// The decoder starts at the Ethernet header.
+		if lt := r.LinkType(); lt != layers.LinkTypeEthernet {
+			return fmt.Errorf("unsupported link type %s: %w", lt, core.ErrConfig)
+		}
+
+		restart, err := c.readPackets(ctx, r, br, !ng, output)
+		if !restart {
+			return err
+		}
+		slog.Info("pcapstream header found mid-stream, restarting", "path", c.config.Path)
+	}
+}
+
+// readPackets forwards packets from r until EOF. With checkHeader set, br (the
+// reader under r) is peeked before each record and restart is reported when a
+// file header follows; pcapgo.Reader does not buffer, so the peek is exact.
+func (c *PcapStreamCapturer) readPackets(ctx context.Context, r packetReader, br *bufio.Reader, checkHeader bool, output chan<- core.RawPacket) (restart bool, err error) {
+	for {
+		if checkHeader {
+			if next, err := br.Peek(4); err == nil && isHeaderMagic(next) {
+				return true, nil
+			}
+		}
+
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrClosed) {
+				return false, nil
+			}
+			return false, fmt.Errorf("read packet: %w", err)
+		}
+
+		c.packetsReceived.Add(1)
+
+		// ReadPacketData returns a fresh buffer per packet, so data can be
+		// handed over as is.
+		raw := core.RawPacket{
+			Data:           data,
+			Timestamp:      ci.Timestamp,
+			CaptureLen:     uint32(ci.CaptureLength),
+			OrigLen:        uint32(ci.Length),
+			InterfaceIndex: ci.InterfaceIndex,
+		}
+
+		// Blocking send: unlike a NIC, a stream applies back-pressure to its
+		// writer, so nothing needs to be dropped here.
+		select {
+		case output <- raw:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+}
+
+// isHeaderMagic reports whether b starts a pcap file header or a pcapng section
+// header. Read as a record timestamp these values fall in 1975, 2011, 2055 or
+// 2083 (to the second), far from a live capture's clock.
+func isHeaderMagic(b []byte) bool {
+	switch binary.BigEndian.Uint32(b) {
+	case pcapngMagic, 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1:
+		return true
+	}
+	return false
+}
+
+func (c *PcapStreamCapturer) setCurrent(cl io.Closer) {
+	c.mu.Lock()
+	c.current = cl
+	c.mu.Unlock()
+}
+
+func (c *PcapStreamCapturer) closeCurrent() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != nil {
+		c.current.Close()
+		c.current = nil
+	}
+}
+
+// Stats returns capture statistics.
+func (c *PcapStreamCapturer) Stats() plugin.CaptureStats {
+	return plugin.CaptureStats{
+		PacketsReceived: c.packetsReceived.Load(),
+	}
+}
@@ -0,0 +1,125 @@
+package pcapstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func frame(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 60)
+}
+
+func pcapStream(t *testing.T, linkType layers.LinkType, frames ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := pcapgo.NewWriter(&buf)
+	if err := w.WriteFileHeader(65535, linkType); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(1700000000, 0), CaptureLength: len(f), Length: len(f)}
+		if err := w.WritePacket(ci, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func pcapngSection(t *testing.T, frames ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := pcapgo.NewNgWriter(&buf, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range frames {
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(1700000000, 0), CaptureLength: len(f), Length: len(f)}
+		if err := w.WritePacket(ci, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newCapturer(t *testing.T, cfg map[string]any, stdin []byte) *PcapStreamCapturer {
+	t.Helper()
+	c := NewPcapStreamCapturer().(*PcapStreamCapturer)
+	c.stdin = io.NopCloser(bytes.NewReader(stdin))
+	if err := c.Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if err := c.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return c
+}
+
+func TestCapture_StdinPcapngSections(t *testing.T) {
+	// A second section header mid-stream, as written by a restarted dumpcap.
+	stream := append(pcapngSection(t, frame(1), frame(2)), pcapngSection(t, frame(3))...)
+	c := newCapturer(t, map[string]any{}, stream)
+
+	output := make(chan core.RawPacket, 10)
+	if err := c.Capture(context.Background(), output); err != nil {
+		t.Fatalf("Capture: %v", err)
+	}
+	if len(output) != 3 {
+		t.Fatalf("got %d packets, want 3", len(output))
+	}
+	for i := byte(1); i <= 3; i++ {
+		pkt := <-output
+		if pkt.Data[0] != i || pkt.CaptureLen != 60 {
+			t.Errorf("packet %d = %x (len %d)", i, pkt.Data[0], pkt.CaptureLen)
+		}
+	}
+	if got := c.Stats().PacketsReceived; got != 3 {
+		t.Errorf("PacketsReceived = %d, want 3", got)
+	}
+}
+
+func TestCapture_UnsupportedLinkType(t *testing.T) {
+	c := newCapturer(t, map[string]any{"path": "-"}, pcapStream(t, layers.LinkTypeLinuxSLL, frame(1)))
+
+	err := c.Capture(context.Background(), make(chan core.RawPacket, 1))
+	if err == nil || !strings.Contains(err.Error(), "unsupported link type") {
+		t.Errorf("Capture error = %v, want unsupported link type", err)
+	}
+}
+
+func TestInit_Errors(t *testing.T) {
+	regular := filepath.Join(t.TempDir(), "capture.pcap")
+	if err := os.WriteFile(regular, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cfg := range []map[string]any{
+		{"path": regular},
+		{"path": filepath.Join(t.TempDir(), "missing")},
+		{"reopen_delay": "soon"},
+	} {
+		if err := NewPcapStreamCapturer().Init(cfg); err == nil {
+			t.Errorf("Init(%v) succeeded, want error", cfg)
+		}
+	}
+
+	c := NewPcapStreamCapturer().(*PcapStreamCapturer)
+	c.SetQueue(0, 2)
+	if err := c.Init(map[string]any{}); err == nil || !strings.Contains(err.Error(), "dispatch") {
+		t.Errorf("two capturers: err = %v", err)
+	}
+}
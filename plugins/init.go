@@ -3,27 +3,46 @@ package plugins
 
 import (
 	"firestige.xyz/otus/pkg/plugin"
-	"firestige.xyz/otus/plugins/capture/afpacket"
+	"firestige.xyz/otus/plugins/capture/pcapstream"
+	"firestige.xyz/otus/plugins/parser/msrp"
 	"firestige.xyz/otus/plugins/parser/rtp"
 	"firestige.xyz/otus/plugins/parser/sip"
+	"firestige.xyz/otus/plugins/processor/callsample"
+	"firestige.xyz/otus/plugins/processor/cardinality"
+	"firestige.xyz/otus/plugins/processor/e164"
+	"firestige.xyz/otus/plugins/processor/retention"
+	"firestige.xyz/otus/plugins/processor/rollup"
 	"firestige.xyz/otus/plugins/reporter/console"
+	"firestige.xyz/otus/plugins/reporter/forward"
 	"firestige.xyz/otus/plugins/reporter/hep"
+	"firestige.xyz/otus/plugins/reporter/ipfix"
 	"firestige.xyz/otus/plugins/reporter/kafka"
+	"firestige.xyz/otus/plugins/reporter/pcap"
 )
 
 func init() {
 	// Register capture plugins
-	plugin.RegisterCapturer("afpacket", afpacket.NewAFPacketCapturer)
+	plugin.RegisterCapturer("pcapstream", pcapstream.NewPcapStreamCapturer)
 
 	// Register parser plugins
 	plugin.RegisterParser("sip", sip.NewSIPParser)
 	plugin.RegisterParser("rtp", rtp.NewRTPParser)
+	plugin.RegisterParser("msrp", msrp.NewMSRPParser)
 
 	// Register reporter plugins
 	plugin.RegisterReporter("console", console.NewConsoleReporter)
+	plugin.RegisterReporter("forward", forward.NewForwardReporter)
 	plugin.RegisterReporter("hep", hep.NewHEPReporter)
+	plugin.RegisterReporter("ipfix", ipfix.NewIPFIXReporter)
 	plugin.RegisterReporter("kafka", kafka.NewKafkaReporter)
+	plugin.RegisterReporter("pcap", pcap.NewPcapReporter)
+
+	// Register processor plugins
+	plugin.RegisterProcessor("callsample", callsample.NewProcessor)
+	plugin.RegisterProcessor("cardinality", cardinality.NewProcessor)
+	plugin.RegisterProcessor("e164", e164.NewProcessor)
+	plugin.RegisterProcessor("retention", retention.NewProcessor)
+	plugin.RegisterProcessor("rollup", rollup.NewProcessor)
 
 	// More plugins will be registered here as they are implemented
-	// processor plugins
 }
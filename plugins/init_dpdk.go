@@ -0,0 +1,13 @@
+//go:build dpdk
+
+package plugins
+
+import (
+	"firestige.xyz/otus/pkg/plugin"
+	"firestige.xyz/otus/plugins/capture/dpdk"
+)
+
+// The DPDK capturer links against libdpdk and is only built with -tags dpdk.
+func init() {
+	plugin.RegisterCapturer("dpdk", dpdk.NewDPDKCapturer)
+}
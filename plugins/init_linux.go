@@ -0,0 +1,16 @@
+package plugins
+
+import (
+	"firestige.xyz/otus/pkg/plugin"
+	"firestige.xyz/otus/plugins/capture/afpacket"
+	"firestige.xyz/otus/plugins/capture/afxdp"
+	"firestige.xyz/otus/plugins/capture/erspan"
+)
+
+// The afpacket, afxdp and erspan capturers use Linux sockets and are only
+// built for Linux.
+func init() {
+	plugin.RegisterCapturer("afpacket", afpacket.NewAFPacketCapturer)
+	plugin.RegisterCapturer("afxdp", afxdp.NewAFXDPCapturer)
+	plugin.RegisterCapturer("erspan", erspan.NewERSPANCapturer)
+}
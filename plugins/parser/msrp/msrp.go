@@ -0,0 +1,249 @@
+// Package msrp implements an MSRP (RFC 4975) parser for RCS / IM sessions.
+//
+// MSRP runs over TCP between endpoints negotiated by SIP with an
+// "m=message <port> TCP/MSRP" SDP line. The SIP parser registers each side's
+// listener endpoint (from a=path) in the shared FlowRegistry with no source
+// address, since the connecting side uses an ephemeral port. The MSRP parser
+// matches packets to or from a registered listener to attach call context,
+// and falls back to the "MSRP " start-line prefix for uncorrelated traffic.
+//
+// Only the first MSRP message in a TCP segment is parsed.
+package msrp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	tcpProto = 6
+
+	// Minimum start line: "MSRP a SEND" plus line ending.
+	minMessageLen = 12
+)
+
+var msrpPrefix = []byte("MSRP ")
+
+// MSRPParser parses MSRP requests and responses.
+//
+// It implements plugin.Parser and plugin.FlowRegistryAware.
+type MSRPParser struct {
+	name         string
+	flowRegistry plugin.FlowRegistry
+}
+
+// NewMSRPParser creates a new MSRPParser instance.
+func NewMSRPParser() plugin.Parser {
+	return &MSRPParser{name: "msrp"}
+}
+
+// Name returns the plugin identifier used in task configuration.
+func (p *MSRPParser) Name() string { return p.name }
+
+// Init initialises the parser; no configuration is required.
+func (p *MSRPParser) Init(_ map[string]any) error { return nil }
+
+// Start is a no-op — MSRPParser has no goroutines or background resources.
+func (p *MSRPParser) Start(_ context.Context) error { return nil }
+
+// Stop is a no-op for the same reason.
+func (p *MSRPParser) Stop(_ context.Context) error { return nil }
+
+// SetFlowRegistry satisfies plugin.FlowRegistryAware.
+func (p *MSRPParser) SetFlowRegistry(registry plugin.FlowRegistry) {
+	p.flowRegistry = registry
+}
+
+// CanHandle accepts TCP segments that start with an MSRP start line.
+// Continuation segments of large chunks do not, and are left to other parsers.
+func (p *MSRPParser) CanHandle(pkt *core.DecodedPacket) bool {
+	if pkt.Transport.Protocol != tcpProto {
+		return false
+	}
+	return len(pkt.Payload) >= minMessageLen && bytes.HasPrefix(pkt.Payload, msrpPrefix)
+}
+
+// Handle parses the MSRP start line and headers and returns labels.
+// The payload (first return value) is nil, consistent with the SIP parser.
+func (p *MSRPParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
+	msg, err := parseMessage(pkt.Payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("msrp: %w", err)
+	}
+
+	labels := core.Labels{
+		core.LabelMSRPTransactionID: msg.transactionID,
+	}
+	if msg.method != "" {
+		labels[core.LabelMSRPMethod] = msg.method
+	}
+	if msg.statusCode != 0 {
+		labels[core.LabelMSRPStatusCode] = strconv.Itoa(msg.statusCode)
+	}
+	setIfNotEmpty(labels, core.LabelMSRPToPath, msg.toPath)
+	setIfNotEmpty(labels, core.LabelMSRPFromPath, msg.fromPath)
+	setIfNotEmpty(labels, core.LabelMSRPMessageID, msg.messageID)
+	setIfNotEmpty(labels, core.LabelMSRPByteRange, msg.byteRange)
+	setIfNotEmpty(labels, core.LabelMSRPContentType, msg.contentType)
+	setIfNotEmpty(labels, core.LabelMSRPChunk, msg.chunk)
+
+	p.enrichFromRegistry(pkt, labels)
+
+	return nil, labels, nil
+}
+
+// enrichFromRegistry adds call context when either endpoint is a registered
+// MSRP listener (destination first: client → listener is the common case).
+func (p *MSRPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labels) {
+	if p.flowRegistry == nil {
+		return
+	}
+
+	keys := [2]plugin.FlowKey{
+		{DstIP: pkt.IP.DstIP, DstPort: pkt.Transport.DstPort, Proto: tcpProto},
+		{DstIP: pkt.IP.SrcIP, DstPort: pkt.Transport.SrcPort, Proto: tcpProto},
+	}
+	for _, key := range keys {
+		val, ok := p.flowRegistry.Get(key)
+		if !ok {
+			continue
+		}
+		ctx, ok := plugin.FlowContext(val)
+		if !ok {
+			continue
+		}
+		setIfNotEmpty(labels, core.LabelMSRPCallID, ctx["call_id"])
+		setIfNotEmpty(labels, core.LabelMSRPMediaState, ctx["media_state"])
+		return
+	}
+}
+
+// message is a parsed MSRP message (headers only).
+type message struct {
+	transactionID string
+	method        string // request method, empty for responses
+	statusCode    int    // response status, 0 for requests
+	toPath        string
+	fromPath      string
+	messageID     string
+	byteRange     string
+	contentType   string
+	chunk         string // end-line continuation flag, if the end-line was captured
+}
+
+// parseMessage parses an MSRP start line, headers and, if present in the
+// segment, the end-line continuation flag.
+//
+//	MSRP a786hjs2 SEND
+//	To-Path: msrp://biloxi.example.com:12763/kjhd37s2s20w2a;tcp
+//	From-Path: msrp://atlanta.example.com:7654/jshA7weztas;tcp
+//	Message-ID: 87652491
+//	Byte-Range: 1-25/25
+//	Content-Type: text/plain
+//
+//	Hey Bob, are you there?
+//	-------a786hjs2$
+func parseMessage(b []byte) (*message, error) {
+	lineEnd := bytes.Index(b, []byte("\r\n"))
+	if lineEnd == -1 {
+		return nil, fmt.Errorf("start line not terminated: %w", core.ErrPacketTooShort)
+	}
+
+	// MSRP <transact-id> <method> | MSRP <transact-id> <status-code> [comment]
+	parts := strings.SplitN(string(b[:lineEnd]), " ", 4)
+	if len(parts) < 3 || parts[0] != "MSRP" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid start line")
+	}
+
+	msg := &message{transactionID: parts[1]}
+	if code, err := strconv.Atoi(parts[2]); err == nil {
+		if code < 200 || code > 999 {
+			return nil, fmt.Errorf("invalid status code %d", code)
+		}
+		msg.statusCode = code
+	} else {
+		msg.method = parts[2]
+	}
+
+	rest := b[lineEnd+2:]
+	for len(rest) > 0 {
+		end := bytes.Index(rest, []byte("\r\n"))
+		if end == -1 {
+			end = len(rest) // torn segment: last header is partial
+		}
+		line := rest[:end]
+		if end+2 <= len(rest) {
+			rest = rest[end+2:]
+		} else {
+			rest = nil
+		}
+
+		if len(line) == 0 {
+			break // end of headers, body follows
+		}
+		if msg.parseEndLine(line) {
+			return msg, nil // no body
+		}
+
+		colon := bytes.IndexByte(line, ':')
+		if colon == -1 {
+			continue
+		}
+		value := string(bytes.TrimSpace(line[colon+1:]))
+		switch strings.ToLower(string(line[:colon])) {
+		case "to-path":
+			msg.toPath = value
+		case "from-path":
+			msg.fromPath = value
+		case "message-id":
+			msg.messageID = value
+		case "byte-range":
+			msg.byteRange = value
+		case "content-type":
+			msg.contentType = value
+		}
+	}
+
+	// End-line after the body: "-------" transact-id flag
+	endLine := []byte("\r\n-------" + msg.transactionID)
+	if idx := bytes.LastIndex(rest, endLine); idx != -1 {
+		line := rest[idx+2:]
+		if end := bytes.Index(line, []byte("\r\n")); end != -1 {
+			line = line[:end]
+		}
+		msg.parseEndLine(line)
+	}
+
+	return msg, nil
+}
+
+// parseEndLine records the continuation flag if line is this message's end-line.
+func (m *message) parseEndLine(line []byte) bool {
+	prefix := "-------" + m.transactionID
+	if len(line) != len(prefix)+1 || string(line[:len(prefix)]) != prefix {
+		return false
+	}
+	switch line[len(prefix)] {
+	case '$':
+		m.chunk = "complete"
+	case '+':
+		m.chunk = "more"
+	case '#':
+		m.chunk = "aborted"
+	default:
+		return false
+	}
+	return true
+}
+
+func setIfNotEmpty(labels core.Labels, key, value string) {
+	if value != "" {
+		labels[key] = value
+	}
+}
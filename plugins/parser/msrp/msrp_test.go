@@ -0,0 +1,162 @@
+package msrp
+
+import (
+	"net/netip"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+type mockFlowRegistry struct {
+	flows map[plugin.FlowKey]any
+}
+
+func newMockFlowRegistry() *mockFlowRegistry {
+	return &mockFlowRegistry{flows: make(map[plugin.FlowKey]any)}
+}
+
+func (m *mockFlowRegistry) Get(key plugin.FlowKey) (any, bool) {
+	v, ok := m.flows[key]
+	return v, ok
+}
+func (m *mockFlowRegistry) Set(key plugin.FlowKey, value any) { m.flows[key] = value }
+func (m *mockFlowRegistry) Delete(key plugin.FlowKey)         { delete(m.flows, key) }
+func (m *mockFlowRegistry) Count() int                        { return len(m.flows) }
+func (m *mockFlowRegistry) Clear()                            { m.flows = make(map[plugin.FlowKey]any) }
+func (m *mockFlowRegistry) Range(f func(plugin.FlowKey, any) bool) {
+	for k, v := range m.flows {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+const sendRequest = "MSRP a786hjs2 SEND\r\n" +
+	"To-Path: msrp://10.0.0.2:12763/kjhd37s2s20w2a;tcp\r\n" +
+	"From-Path: msrp://10.0.0.1:7654/jshA7weztas;tcp\r\n" +
+	"Message-ID: 87652491\r\n" +
+	"Byte-Range: 1-25/25\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hey Bob, are you there?\r\n" +
+	"-------a786hjs2$\r\n"
+
+func tcpPacket(payload string, src, dst string) *core.DecodedPacket {
+	s := netip.MustParseAddrPort(src)
+	d := netip.MustParseAddrPort(dst)
+	return &core.DecodedPacket{
+		IP:        core.IPHeader{SrcIP: s.Addr(), DstIP: d.Addr(), Protocol: 6},
+		Transport: core.TransportHeader{SrcPort: s.Port(), DstPort: d.Port(), Protocol: 6},
+		Payload:   []byte(payload),
+	}
+}
+
+func TestHandle_SendWithCallContext(t *testing.T) {
+	p := NewMSRPParser().(*MSRPParser)
+	registry := newMockFlowRegistry()
+	p.SetFlowRegistry(registry)
+	registry.Set(plugin.FlowKey{DstIP: netip.MustParseAddr("10.0.0.2"), DstPort: 12763, Proto: 6},
+		map[string]string{"call_id": "im-call@example.com", "media_state": "confirmed"})
+
+	// Client connects from an ephemeral port to the listener.
+	pkt := tcpPacket(sendRequest, "10.0.0.1:53211", "10.0.0.2:12763")
+	if !p.CanHandle(pkt) {
+		t.Fatal("CanHandle() = false for MSRP SEND")
+	}
+	_, labels, err := p.Handle(pkt)
+	if err != nil {
+		t.Fatalf("Handle() error: %v", err)
+	}
+
+	want := map[string]string{
+		core.LabelMSRPTransactionID: "a786hjs2",
+		core.LabelMSRPMethod:        "SEND",
+		core.LabelMSRPToPath:        "msrp://10.0.0.2:12763/kjhd37s2s20w2a;tcp",
+		core.LabelMSRPFromPath:      "msrp://10.0.0.1:7654/jshA7weztas;tcp",
+		core.LabelMSRPMessageID:     "87652491",
+		core.LabelMSRPByteRange:     "1-25/25",
+		core.LabelMSRPContentType:   "text/plain",
+		core.LabelMSRPChunk:         "complete",
+		core.LabelMSRPCallID:        "im-call@example.com",
+		core.LabelMSRPMediaState:    "confirmed",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, labels[k], v)
+		}
+	}
+
+	// Response from the listener back to the client.
+	resp := "MSRP a786hjs2 200 OK\r\n" +
+		"To-Path: msrp://10.0.0.1:7654/jshA7weztas;tcp\r\n" +
+		"From-Path: msrp://10.0.0.2:12763/kjhd37s2s20w2a;tcp\r\n" +
+		"-------a786hjs2$\r\n"
+	_, labels, err = p.Handle(tcpPacket(resp, "10.0.0.2:12763", "10.0.0.1:53211"))
+	if err != nil {
+		t.Fatalf("Handle(response) error: %v", err)
+	}
+	if labels[core.LabelMSRPStatusCode] != "200" || labels[core.LabelMSRPMethod] != "" {
+		t.Errorf("response labels = %v", labels)
+	}
+	if labels[core.LabelMSRPCallID] != "im-call@example.com" || labels[core.LabelMSRPChunk] != "complete" {
+		t.Errorf("response correlation = %v", labels)
+	}
+}
+
+func TestHandle_ChunkFlags(t *testing.T) {
+	p := NewMSRPParser()
+	tests := map[string]string{
+		"$": "complete",
+		"+": "more",
+		"#": "aborted",
+	}
+	for flag, want := range tests {
+		payload := "MSRP d93kswow SEND\r\n" +
+			"Message-ID: 12339sdqwer\r\n" +
+			"Byte-Range: 1-1024/4096\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"\r\n" +
+			"chunk\r\n" +
+			"-------d93kswow" + flag + "\r\n"
+		_, labels, err := p.Handle(tcpPacket(payload, "10.0.0.1:1", "10.0.0.2:2"))
+		if err != nil {
+			t.Fatalf("Handle() error: %v", err)
+		}
+		if labels[core.LabelMSRPChunk] != want {
+			t.Errorf("flag %s: chunk = %q, want %q", flag, labels[core.LabelMSRPChunk], want)
+		}
+	}
+
+	// Torn segment: end-line not captured.
+	_, labels, err := p.Handle(tcpPacket("MSRP x1 SEND\r\nMessage-ID: m1\r\n\r\npartial bo", "10.0.0.1:1", "10.0.0.2:2"))
+	if err != nil {
+		t.Fatalf("Handle(torn) error: %v", err)
+	}
+	if _, ok := labels[core.LabelMSRPChunk]; ok || labels[core.LabelMSRPMessageID] != "m1" {
+		t.Errorf("torn segment labels = %v", labels)
+	}
+}
+
+func TestCanHandleAndErrors(t *testing.T) {
+	p := NewMSRPParser()
+
+	udp := tcpPacket(sendRequest, "10.0.0.1:1", "10.0.0.2:2")
+	udp.Transport.Protocol = 17
+	if p.CanHandle(udp) {
+		t.Error("CanHandle() accepted UDP")
+	}
+	if p.CanHandle(tcpPacket("GET / HTTP/1.1\r\n\r\n", "10.0.0.1:1", "10.0.0.2:80")) {
+		t.Error("CanHandle() accepted HTTP")
+	}
+
+	for _, bad := range []string{
+		"MSRP a786hjs2 SEND",           // unterminated
+		"MSRP  SEND\r\n",               // empty transaction id
+		"MSRP a786hjs2 100 Trying\r\n", // status out of range
+	} {
+		if _, _, err := p.Handle(tcpPacket(bad, "10.0.0.1:1", "10.0.0.2:2")); err == nil {
+			t.Errorf("Handle(%q) expected error", bad)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package rtp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/qualityalert"
+)
+
+// DTMF (RFC 4733 telephone-event, formerly RFC 2833). A key press is sent as
+// a series of packets with the same RTP timestamp, the event's start, and a
+// growing duration; the last one has the end bit set and is usually sent
+// three times. Every packet of the event is labeled, so the digit of an IVR
+// interaction is on the end packet with its final duration.
+//
+// Telephone-event is a dynamic payload type: for flows of a call it is
+// learned from the a=rtpmap lines of the SDP (the flow's telephone_event
+// context); dtmf_payload_types adds payload types for flows without one.
+const dtmfEventLen = 4 // event, E/R/volume, duration
+
+// dtmfDigits maps events 0-16 to their key (RFC 4733 §3.2).
+var dtmfDigits = [...]string{
+	"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
+	"*", "#", "A", "B", "C", "D", "flash",
+}
+
+// initDTMF applies the dtmf_payload_types key.
+func (p *RTPParser) initDTMF(config map[string]any) error {
+	v, ok := config["dtmf_payload_types"]
+	if !ok {
+		return nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("rtp: dtmf_payload_types must be a list of payload types")
+	}
+	for i, item := range list {
+		n, ok := item.(float64)
+		if !ok || n < 0 || n > 127 || n != float64(int(n)) {
+			return fmt.Errorf("rtp: dtmf_payload_types[%d]: invalid payload type %v", i, item)
+		}
+		p.dtmfPT[int(n)] = true
+	}
+	return nil
+}
+
+// observeDTMF labels a telephone-event packet with rtp.dtmf_digit,
+// rtp.dtmf_duration_ms and rtp.dtmf_end. flowCtx is the call context of a
+// registered flow, nil otherwise.
+func (p *RTPParser) observeDTMF(pkt *core.DecodedPacket, pt uint8, flowCtx map[string]string, labels core.Labels) {
+	if !p.dtmfPT[pt] && !hasPayloadType(flowCtx["telephone_event"], pt) {
+		return
+	}
+	b := pkt.Payload
+	if b[0]&0x20 != 0 { // padding: the last octet counts it
+		pad := int(b[len(b)-1])
+		if pad > len(b)-rtpMinLength {
+			return // padding reaching into the header: malformed
+		}
+		b = b[:len(b)-pad]
+	}
+	n := rtpHeaderLen(b)
+	if len(b)-n < dtmfEventLen {
+		return
+	}
+	ev := b[n : n+dtmfEventLen]
+
+	digit := strconv.Itoa(int(ev[0]))
+	if int(ev[0]) < len(dtmfDigits) {
+		digit = dtmfDigits[ev[0]]
+	}
+	// The duration is in timestamp units of the event's clock, which
+	// matches the audio codec's.
+	duration := int(ev[2])<<8 | int(ev[3])
+	labels[core.LabelRTPDTMFDigit] = digit
+	labels[core.LabelRTPDTMFDurationMs] = strconv.Itoa(duration * 1000 / qualityalert.ClockRate(labels[core.LabelRTPCodec]))
+	labels[core.LabelRTPDTMFEnd] = boolStr(ev[1]&0x80 != 0)
+}
+
+// hasPayloadType reports whether the comma-separated list pts contains pt.
+func hasPayloadType(pts string, pt uint8) bool {
+	for pts != "" {
+		var s string
+		s, pts, _ = strings.Cut(pts, ",")
+		if n, err := strconv.Atoi(s); err == nil && n == int(pt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package rtp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/internal/qualityalert"
+	"firestige.xyz/otus/internal/rtpstream"
+)
+
+// Stream quality at the capture point (quality_interval). For each stream
+// (flow and SSRC) of a call registered by the SIP parser, the parser tracks
+// the extended highest sequence number, the packets received and the
+// interarrival jitter of RFC 3550 §6.4.1, computed from capture times and RTP
+// timestamps. The first packet past each interval closes it: it is labeled
+// with the interval's rtp.loss_pct, rtp.jitter_ms and rtp.mos, and its
+// payload is a Quality report. Unlike rtcp.* feedback this needs no RTCP and
+// measures the network up to the capture point; a stream's last, partial
+// interval is not reported.
+
+// Quality is the quality of one RTP stream over one interval. It is the
+// payload of the RTP packet closing the interval.
+type Quality struct {
+	CallID    string    `json:"call_id"`
+	SSRC      string    `json:"ssrc"`
+	Codec     string    `json:"codec,omitempty"`
+	Direction string    `json:"direction,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Packets   uint64    `json:"packets"`  // received in the interval, duplicates included
+	Expected  uint64    `json:"expected"` // sequence numbers the interval advanced by
+	Lost      uint64    `json:"lost"`
+	Gaps      uint64    `json:"gaps"`      // runs of missing sequence numbers
+	LossPct   float64   `json:"loss_pct"`  // lost / expected
+	JitterMs  float64   `json:"jitter_ms"` // RFC 3550 interarrival jitter at the interval's end
+	MOS       float64   `json:"mos"`       // E-model estimate from loss and jitter, see qualityalert.MOS
+}
+
+// qualityState is the running measurement of one stream.
+type qualityState struct {
+	seq   rtpstream.Seq
+	base  rtpstream.Mark // position before the interval
+	gaps  uint64
+	start time.Time
+
+	jitter      float64   // in RTP timestamp units
+	lastArrival time.Time // of the previous packet used for jitter; zero if none
+	lastTS      uint32
+}
+
+// qualityTracker holds the stream quality state of one parser instance.
+// Like streamTracker it is per pipeline and needs no locking.
+type qualityTracker struct {
+	interval time.Duration // 0 = disabled
+	streams  *idletable.Table[ssrcKey, qualityState]
+}
+
+// initQuality applies the quality_interval key.
+func (p *RTPParser) initQuality(config map[string]any) error {
+	v, ok := config["quality_interval"].(string)
+	if !ok || v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("rtp: invalid quality_interval %q", v)
+	}
+	p.quality = qualityTracker{interval: d, streams: newSSRCTable[qualityState]()}
+	return nil
+}
+
+// observeQuality counts an RTP packet of a registered flow and, when it
+// closes its stream's interval, labels it and returns the interval's Quality.
+func (p *RTPParser) observeQuality(pkt *core.DecodedPacket, key ssrcKey, pt uint8, seq uint16, ts uint32, labels core.Labels) *Quality {
+	q := &p.quality
+	if q.interval == 0 {
+		return nil
+	}
+	now := pkt.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	s, created := q.streams.Touch(key, now)
+	if created {
+		s.seq = rtpstream.NewSeq(seq)
+		s.base, s.start = s.seq.Mark(), now
+	}
+	if s.seq.Observe(seq) > 1 {
+		s.gaps++
+	}
+
+	// Comfort noise and telephone-events keep or jump the timestamp
+	// without following the media clock, so they would read as jitter.
+	rate := float64(qualityalert.ClockRate(labels[core.LabelRTPCodec]))
+	if !p.streams.ignorePT[pt] {
+		if !s.lastArrival.IsZero() {
+			// D(i-1,i) = (Rj - Ri) - (Sj - Si), in timestamp units
+			d := now.Sub(s.lastArrival).Seconds()*rate - float64(int32(ts-s.lastTS))
+			if d < 0 {
+				d = -d
+			}
+			s.jitter += (d - s.jitter) / 16
+		}
+		s.lastArrival, s.lastTS = now, ts
+	}
+
+	if now.Sub(s.start) < q.interval {
+		return nil
+	}
+
+	packets, expected, lost := s.seq.Since(s.base)
+	var lossPct float64
+	if expected > 0 {
+		lossPct = float64(lost) / float64(expected) * 100
+	}
+	jitterMs := s.jitter * 1000 / rate
+	report := &Quality{
+		CallID:    labels[core.LabelRTPCallID],
+		SSRC:      fmt.Sprintf("0x%08X", key.ssrc),
+		Codec:     labels[core.LabelRTPCodec],
+		Direction: labels[core.LabelRTPDirection],
+		Start:     s.start,
+		End:       now,
+		Packets:   packets,
+		Expected:  expected,
+		Lost:      lost,
+		Gaps:      s.gaps,
+		LossPct:   math.Round(lossPct*10) / 10,
+		JitterMs:  math.Round(jitterMs*10) / 10,
+		MOS:       math.Round(qualityalert.MOS(lossPct, jitterMs, 0)*100) / 100,
+	}
+	labels[core.LabelRTPLossPct] = strconv.FormatFloat(lossPct, 'f', 1, 64)
+	labels[core.LabelRTPJitterMs] = strconv.FormatFloat(jitterMs, 'f', 1, 64)
+	labels[core.LabelRTPMOS] = strconv.FormatFloat(report.MOS, 'f', 2, 64)
+
+	s.base, s.gaps, s.start = s.seq.Mark(), 0, now
+	return report
+}
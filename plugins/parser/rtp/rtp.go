@@ -11,15 +11,31 @@
 //     checks (V=2, payload-type range, minimum length) to decide whether the datagram
 //     looks like RTP or RTCP.
 //
+// RTP packets of registered flows are touched in the FlowRegistry (when it
+// implements plugin.FlowActivity) so the task can report media gaps.
+//
 // RTCP is distinguished from RTP by payload-type values 200–209 (SR, RR, SDES, BYE…).
+// SR/RR report blocks yield the reporter's loss and jitter feedback and the
+// round-trip time (rtcp.rtt_ms, see rtt.go), RTCP XR VoIP Metrics blocks the
+// endpoint's own quality measurements (rtcp.xr_*, see xr.go), and
+// SSRC / payload-type changes on registered flows are labeled as stream events
+// (rtp.stream_event, see streams.go). With quality_interval, the loss, jitter
+// and MOS of each stream of a registered call are reported periodically
+// (rtp.loss_pct, rtp.jitter_ms, rtp.mos, see quality.go). Telephone-event
+// packets carry the DTMF key, duration and end bit (rtp.dtmf_*, see dtmf.go).
 package rtp
 
 import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/patrickmn/go-cache"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/qualityalert"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
@@ -32,24 +48,69 @@ const (
 	rtcpMinLength = 8  // Fixed RTCP common header + sender SSRC
 )
 
+// Values of rtp.direction / rtcp.direction.
+const (
+	flowForward = "forward"
+	flowReverse = "reverse"
+)
+
 // RTPParser parses RTP and RTCP datagrams.
 //
-// It implements plugin.Parser and plugin.FlowRegistryAware.
+// It implements plugin.Parser, plugin.FlowRegistryAware and plugin.TaskAware.
 type RTPParser struct {
 	name         string
+	taskID       string
 	flowRegistry plugin.FlowRegistry
+	srCache      *cache.Cache // SR sender SSRC + NTP middle → capture time (see rtt.go)
+	streams      streamConfig
+	tracker      *streamTracker
+	sampler      payloadSampler
+	quality      qualityTracker
+	dtmfPT       [128]bool // dtmf_payload_types (see dtmf.go)
 }
 
 // NewRTPParser creates a new RTPParser instance.
 func NewRTPParser() plugin.Parser {
-	return &RTPParser{name: "rtp"}
+	return &RTPParser{
+		name:    "rtp",
+		srCache: newSRCache(),
+		streams: defaultStreamConfig(),
+		tracker: newStreamTracker(),
+	}
 }
 
 // Name returns the plugin identifier used in task configuration.
 func (p *RTPParser) Name() string { return p.name }
 
-// Init initialises the parser; no configuration is required for Phase 2.
-func (p *RTPParser) Init(_ map[string]any) error { return nil }
+// Init initializes the parser with configuration.
+//
+// Supported keys (all optional):
+//   - detect_ssrc_change, detect_ssrc_conflict, detect_pt_change (bool, default true)
+//   - ssrc_conflict_window (duration string, default "5s"): how recently another
+//     source must have sent an SSRC for it to conflict
+//   - ignore_payload_types ([]int, default [13, 101]): payload types that never
+//     count as a payload-type change, e.g. comfort noise and telephone-event
+//   - payload_sample_packets (int, default 0 = all): keep the media payload of
+//     only the first N packets of each stream (flow and SSRC); later packets
+//     are output with the RTP header only and rtp.payload_len
+//   - quality_interval (duration string, default "" = disabled): report the
+//     loss, jitter and MOS of each stream of a registered call once per
+//     interval (see quality.go)
+//   - dtmf_payload_types ([]int, default []): telephone-event payload types
+//     decoded on every flow, in addition to those learned from SDP
+//     (see dtmf.go)
+func (p *RTPParser) Init(config map[string]any) error {
+	if err := p.initStreamConfig(config); err != nil {
+		return err
+	}
+	if err := p.initQuality(config); err != nil {
+		return err
+	}
+	if err := p.initDTMF(config); err != nil {
+		return err
+	}
+	return p.initPayloadSampling(config)
+}
 
 // Start is a no-op — RTPParser has no goroutines or background resources.
 func (p *RTPParser) Start(_ context.Context) error { return nil }
@@ -64,6 +125,11 @@ func (p *RTPParser) SetFlowRegistry(registry plugin.FlowRegistry) {
 	p.flowRegistry = registry
 }
 
+// SetTaskID satisfies plugin.TaskAware; stream events are counted per task.
+func (p *RTPParser) SetTaskID(taskID string) {
+	p.taskID = taskID
+}
+
 // CanHandle decides whether the packet should be processed by this parser.
 //
 // Decision order (cheapest first):
@@ -96,10 +162,11 @@ func (p *RTPParser) CanHandle(pkt *core.DecodedPacket) bool {
 // Handle parses the RTP or RTCP header and returns annotated labels.
 //
 // The payload (first return value) is nil — all metadata is surfaced as labels,
-// consistent with the SIP parser's convention.
+// consistent with the SIP parser's convention — except for the RTP packet
+// closing a quality interval, whose payload is the stream's *Quality.
 func (p *RTPParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
 	if len(pkt.Payload) < 2 {
-		return nil, nil, fmt.Errorf("rtp: payload too short (%d bytes)", len(pkt.Payload))
+		return nil, nil, fmt.Errorf("rtp: payload too short (%d bytes): %w", len(pkt.Payload), core.ErrPacketTooShort)
 	}
 
 	// Byte 0: V(2) P(1) X(1) CC(4)
@@ -124,7 +191,7 @@ func (p *RTPParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
 // handleRTP parses the 12-byte fixed RTP header and populates labels.
 func (p *RTPParser) handleRTP(pkt *core.DecodedPacket, pt uint8) (any, core.Labels, error) {
 	if len(pkt.Payload) < rtpMinLength {
-		return nil, nil, fmt.Errorf("rtp: payload too short for RTP header (%d bytes)", len(pkt.Payload))
+		return nil, nil, fmt.Errorf("rtp: payload too short for RTP header (%d bytes): %w", len(pkt.Payload), core.ErrPacketTooShort)
 	}
 
 	b := pkt.Payload
@@ -132,7 +199,7 @@ func (p *RTPParser) handleRTP(pkt *core.DecodedPacket, pt uint8) (any, core.Labe
 	// Byte 0: V(7:6) P(5) X(4) CC(3:0)
 	version := (b[0] >> 6) & 0x3
 	if version != 2 {
-		return nil, nil, fmt.Errorf("rtp: unexpected RTP version %d", version)
+		return nil, nil, fmt.Errorf("rtp: unexpected RTP version %d: %w", version, core.ErrBadVersion)
 	}
 	hasExtension := (b[0]>>4)&0x1 == 1
 	marker := (b[1]>>7)&0x1 == 1
@@ -156,23 +223,35 @@ func (p *RTPParser) handleRTP(pkt *core.DecodedPacket, pt uint8) (any, core.Labe
 		core.LabelRTPExtension:   boolStr(hasExtension),
 	}
 
-	// Enrich with SIP call context from FlowRegistry.
-	p.enrichFromRegistry(pkt, labels, false)
+	// Enrich with SIP call context from FlowRegistry; stream events and
+	// quality only apply to flows of known calls.
+	var quality *Quality
+	key, flowCtx, ok := p.enrichFromRegistry(pkt, labels, false)
+	if ok {
+		p.observeStream(pkt, key, ssrc, pt, labels)
+		quality = p.observeQuality(pkt, ssrcKey{flow: key, ssrc: ssrc}, pt, seq, ts, labels)
+	}
+	// Before sampling, which may strip the event payload.
+	p.observeDTMF(pkt, pt, flowCtx, labels)
+	p.samplePayload(pkt, ssrc, labels)
 
+	if quality != nil {
+		return quality, labels, nil
+	}
 	return nil, labels, nil
 }
 
 // handleRTCP parses the 8-byte RTCP common header and populates labels.
 func (p *RTPParser) handleRTCP(pkt *core.DecodedPacket, pt uint8) (any, core.Labels, error) {
 	if len(pkt.Payload) < rtcpMinLength {
-		return nil, nil, fmt.Errorf("rtp: payload too short for RTCP header (%d bytes)", len(pkt.Payload))
+		return nil, nil, fmt.Errorf("rtp: payload too short for RTCP header (%d bytes): %w", len(pkt.Payload), core.ErrPacketTooShort)
 	}
 
 	b := pkt.Payload
 
 	version := (b[0] >> 6) & 0x3
 	if version != 2 {
-		return nil, nil, fmt.Errorf("rtp: unexpected RTCP version %d", version)
+		return nil, nil, fmt.Errorf("rtp: unexpected RTCP version %d: %w", version, core.ErrBadVersion)
 	}
 
 	// Bytes 4–7: SSRC of sender (SR/RR) or first SSRC (SDES/BYE/APP)
@@ -183,17 +262,33 @@ func (p *RTPParser) handleRTCP(pkt *core.DecodedPacket, pt uint8) (any, core.Lab
 		core.LabelRTCPSSRC:       fmt.Sprintf("0x%08X", ssrc),
 	}
 
+	// Reception feedback and round-trip time from SR/RR report blocks.
+	p.observeReports(pkt, pt, labels)
+
+	// Endpoint-measured VoIP metrics from XR anywhere in the compound packet.
+	observeXR(pkt.Payload, labels)
+
 	// Enrich with SIP call context from FlowRegistry.
 	p.enrichFromRegistry(pkt, labels, true)
 
+	// Report block jitter in ms needs the clock rate of the negotiated codec.
+	if codec := labels[core.LabelRTCPCodec]; codec != "" {
+		if jitter, err := strconv.ParseUint(labels[core.LabelRTCPJitter], 10, 32); err == nil {
+			ms := float64(jitter) * 1000 / float64(qualityalert.ClockRate(codec))
+			labels[core.LabelRTCPJitterMs] = strconv.FormatFloat(ms, 'f', 1, 64)
+		}
+	}
+
 	return nil, labels, nil
 }
 
-// enrichFromRegistry looks up the FlowRegistry and adds call_id / codec labels.
-// isRTCP controls which label keys to use (rtcp.* vs rtp.*).
-func (p *RTPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labels, isRTCP bool) {
+// enrichFromRegistry looks up the FlowRegistry and adds call_id / codec / media_state labels.
+// isRTCP controls which label keys to use (rtcp.* vs rtp.*). It returns the
+// flow key, the flow's call context, and whether the flow is registered with
+// call context.
+func (p *RTPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labels, isRTCP bool) (plugin.FlowKey, map[string]string, bool) {
 	if p.flowRegistry == nil {
-		return
+		return plugin.FlowKey{}, nil, false
 	}
 
 	key := plugin.FlowKey{
@@ -206,12 +301,28 @@ func (p *RTPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labe
 
 	val, ok := p.flowRegistry.Get(key)
 	if !ok {
-		return
+		return key, nil, false
 	}
 
-	ctx, ok := val.(map[string]string)
+	ctx, ok := plugin.FlowContext(val)
 	if !ok {
-		return
+		return key, nil, false
+	}
+
+	now := time.Now()
+	// RTCP keeps flowing on held or broken calls, so only RTP counts as activity.
+	if activity, ok := p.flowRegistry.(plugin.FlowActivity); ok && !isRTCP {
+		activity.Touch(key, now)
+	}
+
+	// Both directions of a stream share one Flow.
+	direction := ""
+	if flow, ok := val.(*plugin.Flow); ok {
+		flow.Observe(key, len(pkt.Payload), now)
+		direction = flowReverse
+		if flow.IsForward(key) {
+			direction = flowForward
+		}
 	}
 
 	if isRTCP {
@@ -221,6 +332,12 @@ func (p *RTPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labe
 		if codec, ok := ctx["codec"]; ok && codec != "" {
 			labels[core.LabelRTCPCodec] = codec
 		}
+		if state, ok := ctx["media_state"]; ok && state != "" {
+			labels[core.LabelRTCPMediaState] = state
+		}
+		if direction != "" {
+			labels[core.LabelRTCPDirection] = direction
+		}
 	} else {
 		if callID, ok := ctx["call_id"]; ok && callID != "" {
 			labels[core.LabelRTPCallID] = callID
@@ -228,7 +345,14 @@ func (p *RTPParser) enrichFromRegistry(pkt *core.DecodedPacket, labels core.Labe
 		if codec, ok := ctx["codec"]; ok && codec != "" {
 			labels[core.LabelRTPCodec] = codec
 		}
+		if state, ok := ctx["media_state"]; ok && state != "" {
+			labels[core.LabelRTPMediaState] = state
+		}
+		if direction != "" {
+			labels[core.LabelRTPDirection] = direction
+		}
 	}
+	return key, ctx, true
 }
 
 // looksLikeRTPorRTCP returns true when the payload passes lightweight header checks.
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"net/netip"
 	"testing"
+	"time"
 
 	"firestige.xyz/otus/internal/core"
 	"firestige.xyz/otus/pkg/plugin"
@@ -122,6 +123,29 @@ func TestLifecycle(t *testing.T) {
 	}
 }
 
+func TestInit_StreamConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		wantErr bool
+	}{
+		{"empty", map[string]any{}, false},
+		{"full", map[string]any{"detect_ssrc_change": false, "detect_ssrc_conflict": true, "detect_pt_change": false,
+			"ssrc_conflict_window": "2s", "ignore_payload_types": []any{float64(13), float64(96)}}, false},
+		{"bad window", map[string]any{"ssrc_conflict_window": "0s"}, true},
+		{"ignore not a list", map[string]any{"ignore_payload_types": float64(13)}, true},
+		{"ignore out of range", map[string]any{"ignore_payload_types": []any{float64(128)}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewRTPParser().Init(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestSetFlowRegistry(t *testing.T) {
 	p := NewRTPParser().(*RTPParser)
 	reg := newMockFlowRegistry()
@@ -242,7 +266,7 @@ func TestHandle_RTP_WithFlowRegistry(t *testing.T) {
 	srcIP := netip.MustParseAddr("10.0.0.1")
 	dstIP := netip.MustParseAddr("10.0.0.2")
 	reg.Set(plugin.FlowKey{SrcIP: srcIP, DstIP: dstIP, SrcPort: 6000, DstPort: 7000, Proto: 17},
-		map[string]string{"call_id": "call-xyz-789", "codec": "G711A"})
+		map[string]string{"call_id": "call-xyz-789", "codec": "G711A", "media_state": "early"})
 
 	payload := makeRTPPayload(8, 1, 100, 0x11223344, false, false)
 	pkt := makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, payload)
@@ -257,6 +281,88 @@ func TestHandle_RTP_WithFlowRegistry(t *testing.T) {
 	if got := labels[core.LabelRTPCodec]; got != "G711A" {
 		t.Errorf("LabelRTPCodec = %q; want %q", got, "G711A")
 	}
+	if got := labels[core.LabelRTPMediaState]; got != "early" {
+		t.Errorf("LabelRTPMediaState = %q; want %q", got, "early")
+	}
+}
+
+func TestHandle_BidirectionalFlow(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+
+	fwd := plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17}
+	flow := plugin.NewFlow(fwd, map[string]string{"call_id": "call-bidi", "codec": "PCMA"})
+	reg.Set(fwd, flow)
+	reg.Set(fwd.Reverse(), flow)
+
+	rtp := makeRTPPayload(8, 1, 100, 0x11223344, false, false)
+	for _, tc := range []struct {
+		src, dst         string
+		srcPort, dstPort uint16
+		want             string
+	}{
+		{"10.0.0.1", "10.0.0.2", 6000, 7000, "forward"},
+		{"10.0.0.2", "10.0.0.1", 7000, 6000, "reverse"},
+		{"10.0.0.2", "10.0.0.1", 7000, 6000, "reverse"},
+	} {
+		_, labels, err := p.Handle(makeDecodedPacket(tc.src, tc.dst, tc.srcPort, tc.dstPort, rtp))
+		if err != nil {
+			t.Fatalf("Handle() error: %v", err)
+		}
+		if got := labels[core.LabelRTPDirection]; got != tc.want {
+			t.Errorf("%s → %s: LabelRTPDirection = %q, want %q", tc.src, tc.dst, got, tc.want)
+		}
+		if labels[core.LabelRTPCallID] != "call-bidi" {
+			t.Errorf("LabelRTPCallID = %q", labels[core.LabelRTPCallID])
+		}
+	}
+
+	stats := flow.Stats()
+	if stats.Forward.Packets != 1 || stats.Reverse.Packets != 2 || stats.Reverse.Bytes != uint64(2*len(rtp)) {
+		t.Errorf("flow stats = %+v", stats)
+	}
+	if stats.FirstSeen.IsZero() || stats.LastSeen.Before(stats.FirstSeen) {
+		t.Errorf("first/last seen = %v / %v", stats.FirstSeen, stats.LastSeen)
+	}
+}
+
+// activityFlowRegistry is a mockFlowRegistry that records Touch calls.
+type activityFlowRegistry struct {
+	*mockFlowRegistry
+	touched map[plugin.FlowKey]int
+}
+
+func (m *activityFlowRegistry) Touch(key plugin.FlowKey, _ time.Time) { m.touched[key]++ }
+func (m *activityFlowRegistry) LastSeen(plugin.FlowKey) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func TestHandle_TouchesFlowActivity(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	reg := &activityFlowRegistry{mockFlowRegistry: newMockFlowRegistry(), touched: make(map[plugin.FlowKey]int)}
+	p.SetFlowRegistry(reg)
+
+	srcIP := netip.MustParseAddr("10.0.0.1")
+	dstIP := netip.MustParseAddr("10.0.0.2")
+	key := plugin.FlowKey{SrcIP: srcIP, DstIP: dstIP, SrcPort: 6000, DstPort: 7000, Proto: 17}
+	reg.Set(key, map[string]string{"call_id": "call-1", "codec": "PCMA"})
+
+	for _, payload := range [][]byte{
+		makeRTPPayload(8, 1, 100, 0x11223344, false, false),
+		makeRTPPayload(8, 2, 260, 0x11223344, false, false),
+		makeRTCPPayload(200, 0x11223344), // RTCP is not media activity
+	} {
+		if _, _, err := p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, payload)); err != nil {
+			t.Fatalf("Handle() error: %v", err)
+		}
+	}
+	// Unregistered flows are not touched.
+	p.Handle(makeDecodedPacket("10.0.0.9", "10.0.0.2", 6000, 7000, makeRTPPayload(8, 1, 100, 1, false, false)))
+
+	if len(reg.touched) != 1 || reg.touched[key] != 2 {
+		t.Errorf("touched = %v, want 2 touches of the registered flow", reg.touched)
+	}
 }
 
 func TestHandle_RTP_NoFlowRegistry(t *testing.T) {
@@ -511,3 +617,514 @@ func TestEnrichFromRegistry_WrongType(t *testing.T) {
 		t.Error("LabelRTPCallID should not be present when registry value has wrong type")
 	}
 }
+
+// ---------------------------------------------------------------------------
+// Round-trip time
+// ---------------------------------------------------------------------------
+
+// makeSR builds an SR from ssrc with the given NTP middle 32 bits and no
+// report blocks.
+func makeSR(ssrc, ntpMiddle uint32) []byte {
+	b := make([]byte, srHeaderLen)
+	b[0] = 0x80
+	b[1] = rtcpPTSR
+	binary.BigEndian.PutUint16(b[2:4], srHeaderLen/4-1)
+	binary.BigEndian.PutUint32(b[4:8], ssrc)
+	binary.BigEndian.PutUint32(b[10:14], ntpMiddle)
+	return b
+}
+
+// makeRR builds an RR from ssrc with one report block about source, followed
+// by an SDES packet as in a compound RTCP packet.
+func makeRR(ssrc, source, lsr, dlsr uint32) []byte {
+	b := make([]byte, rrHeaderLen+reportBlockLen, rrHeaderLen+reportBlockLen+8)
+	b[0] = 0x81 // RC=1
+	b[1] = rtcpPTRR
+	binary.BigEndian.PutUint16(b[2:4], (rrHeaderLen+reportBlockLen)/4-1)
+	binary.BigEndian.PutUint32(b[4:8], ssrc)
+	binary.BigEndian.PutUint32(b[8:12], source)
+	binary.BigEndian.PutUint32(b[24:28], lsr)
+	binary.BigEndian.PutUint32(b[28:32], dlsr)
+	return append(b, makeRTCPPayload(202, ssrc)...)
+}
+
+func TestHandle_RTCP_RoundTripTime(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	sr := makeDecodedPacket("10.0.0.1", "10.0.0.2", 6001, 7001, makeSR(0xAAAA0001, 0x12345678))
+	sr.Timestamp = base
+	if _, labels, err := p.Handle(sr); err != nil || labels[core.LabelRTCPRTT] != "" {
+		t.Fatalf("SR: labels = %v, err = %v", labels, err)
+	}
+
+	// The peer held the SR for 0.5s (DLSR 32768/65536) and its RR is
+	// captured 0.58s after the SR: 80ms round trip.
+	rr := makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, makeRR(0xBBBB0002, 0xAAAA0001, 0x12345678, 32768))
+	rr.Timestamp = base.Add(580 * time.Millisecond)
+	_, labels, err := p.Handle(rr)
+	if err != nil {
+		t.Fatalf("RR: %v", err)
+	}
+	if labels[core.LabelRTCPRTT] != "80.0" || labels[core.LabelRTCPReportSSRC] != "0xAAAA0001" {
+		t.Errorf("RR labels = %v, want rtt 80.0 about 0xAAAA0001", labels)
+	}
+
+	// Reports echoing an SR that was not captured, or none at all, carry no RTT.
+	for _, lsr := range []uint32{0x0BADF00D, 0} {
+		rr := makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, makeRR(0xBBBB0002, 0xAAAA0001, lsr, 0))
+		rr.Timestamp = base.Add(time.Second)
+		if _, labels, _ := p.Handle(rr); labels[core.LabelRTCPRTT] != "" {
+			t.Errorf("LSR %#x: rtt = %q, want none", lsr, labels[core.LabelRTCPRTT])
+		}
+	}
+}
+
+func TestHandle_RTCP_ReportFeedback(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+
+	b := makeRR(0xBBBB0002, 0xAAAA0001, 0, 0)
+	b[12] = 64                                // fraction lost 64/256
+	b[13], b[14], b[15] = 0xFF, 0xFF, 0xFE    // cumulative lost -2 (duplicates)
+	binary.BigEndian.PutUint32(b[20:24], 120) // jitter
+	rr := makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, b)
+	_, labels, err := p.Handle(rr)
+	if err != nil {
+		t.Fatalf("Handle() error: %v", err)
+	}
+	want := map[string]string{
+		core.LabelRTCPReportSSRC:     "0xAAAA0001",
+		core.LabelRTCPLossPct:        "25.0",
+		core.LabelRTCPCumulativeLost: "-2",
+		core.LabelRTCPJitter:         "120",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, labels[k], v)
+		}
+	}
+	if _, ok := labels[core.LabelRTCPRTT]; ok {
+		t.Error("rtt labeled without a captured SR")
+	}
+}
+
+func TestHandle_RTCP_SenderInfoAndLSR(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+
+	sr := makeSR(0xAAAA0001, 0x12345678)
+	binary.BigEndian.PutUint32(sr[20:24], 1500)   // sender's packet count
+	binary.BigEndian.PutUint32(sr[24:28], 240000) // sender's octet count
+	_, labels, _ := p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6001, 7001, sr))
+	if labels[core.LabelRTCPSenderPackets] != "1500" || labels[core.LabelRTCPSenderOctets] != "240000" {
+		t.Errorf("SR labels = %v", labels)
+	}
+
+	// DLSR 16384/65536 s
+	rr := makeRR(0xBBBB0002, 0xAAAA0001, 0x12345678, 16384)
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, rr))
+	if labels[core.LabelRTCPLSR] != "0x12345678" || labels[core.LabelRTCPDLSRMs] != "250.0" {
+		t.Errorf("RR labels = %v, want lsr 0x12345678, dlsr 250.0", labels)
+	}
+	if _, ok := labels[core.LabelRTCPSenderPackets]; ok {
+		t.Error("sender info labeled on an RR")
+	}
+
+	// No SR received yet: neither LSR nor DLSR
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, makeRR(0xBBBB0002, 0xAAAA0001, 0, 0)))
+	if _, ok := labels[core.LabelRTCPLSR]; ok {
+		t.Errorf("lsr labeled without an SR: %v", labels)
+	}
+}
+
+func TestHandle_RTCP_JitterMs(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.2"), DstIP: netip.MustParseAddr("10.0.0.1"), SrcPort: 7001, DstPort: 6001, Proto: 17},
+		map[string]string{"call_id": "c1", "codec": "opus/48000/2"})
+
+	b := makeRR(0xBBBB0002, 0xAAAA0001, 0, 0)
+	binary.BigEndian.PutUint32(b[20:24], 960) // jitter, 20ms at 48kHz
+	_, labels, _ := p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, b))
+	if labels[core.LabelRTCPJitterMs] != "20.0" {
+		t.Errorf("rtcp.jitter_ms = %q, want 20.0", labels[core.LabelRTCPJitterMs])
+	}
+
+	// Without a codec the clock rate is unknown
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.1", 7001, 6001, b))
+	if _, ok := labels[core.LabelRTCPJitterMs]; ok {
+		t.Error("rtcp.jitter_ms labeled without a codec")
+	}
+}
+
+// makeXR builds an XR packet from ssrc with a Statistics Summary block
+// (skipped) followed by a VoIP Metrics block about source.
+func makeXR(ssrc, source uint32) []byte {
+	const summaryLen = 40
+	b := make([]byte, xrHeaderLen+summaryLen+voipMetricsLen)
+	b[0] = 0x80
+	b[1] = rtcpPTXR
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)/4-1))
+	binary.BigEndian.PutUint32(b[4:8], ssrc)
+
+	s := b[xrHeaderLen:]
+	s[0] = 6 // Statistics Summary
+	binary.BigEndian.PutUint16(s[2:4], summaryLen/4-1)
+
+	m := b[xrHeaderLen+summaryLen:]
+	m[0] = xrBTVoIPMetrics
+	binary.BigEndian.PutUint16(m[2:4], voipMetricsLen/4-1)
+	binary.BigEndian.PutUint32(m[4:8], source)
+	m[8], m[9] = 13, 5 // loss 5.1%, discard 2.0%
+	m[10], m[11] = 128, 3
+	binary.BigEndian.PutUint16(m[12:14], 120) // burst duration
+	binary.BigEndian.PutUint16(m[14:16], 5000)
+	binary.BigEndian.PutUint16(m[16:18], 85) // round trip delay
+	binary.BigEndian.PutUint16(m[18:20], 40)
+	m[20] = byte(0xEC) // signal -20 dBm0
+	m[21] = xrUnavailable
+	m[24] = 78 // R factor
+	m[25] = xrUnavailable
+	m[26], m[27] = 39, xrUnavailable // MOS-LQ 3.9, MOS-CQ unavailable
+	binary.BigEndian.PutUint16(m[30:32], 60)
+	binary.BigEndian.PutUint16(m[32:34], 120)
+	return b
+}
+
+func TestHandle_RTCP_XRVoIPMetrics(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+
+	// RR, SDES, XR: the XR block is found past the first packet
+	b := append(makeRR(0xBBBB0002, 0xAAAA0001, 0, 0), makeXR(0xBBBB0002, 0xAAAA0001)...)
+	_, labels, err := p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, b))
+	if err != nil {
+		t.Fatalf("Handle() error: %v", err)
+	}
+	want := map[string]string{
+		core.LabelRTCPPayloadType:       "201",
+		core.LabelRTCPXRSSRC:            "0xAAAA0001",
+		core.LabelRTCPXRLossPct:         "5.1",
+		core.LabelRTCPXRDiscardPct:      "2.0",
+		core.LabelRTCPXRBurstDensityPct: "50.0",
+		core.LabelRTCPXRGapDensityPct:   "1.2",
+		core.LabelRTCPXRBurstDurationMs: "120",
+		core.LabelRTCPXRGapDurationMs:   "5000",
+		core.LabelRTCPXRRTTMs:           "85",
+		core.LabelRTCPXREndSystemMs:     "40",
+		core.LabelRTCPXRSignalDBm:       "-20",
+		core.LabelRTCPXRRFactor:         "78",
+		core.LabelRTCPXRMOSLQ:           "3.9",
+		core.LabelRTCPXRJBNominalMs:     "60",
+		core.LabelRTCPXRJBMaxMs:         "120",
+	}
+	for k, v := range want {
+		if labels[k] != v {
+			t.Errorf("%s = %q, want %q", k, labels[k], v)
+		}
+	}
+	for _, k := range []string{core.LabelRTCPXRNoiseDBm, core.LabelRTCPXRMOSCQ} {
+		if _, ok := labels[k]; ok {
+			t.Errorf("unavailable metric %s labeled", k)
+		}
+	}
+
+	// A standalone XR packet
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, makeXR(0xBBBB0002, 0xAAAA0001)))
+	if labels[core.LabelRTCPPayloadType] != "207" || labels[core.LabelRTCPXRMOSLQ] != "3.9" {
+		t.Errorf("standalone XR labels = %v", labels)
+	}
+
+	// A truncated XR block is ignored
+	xr := makeXR(0xBBBB0002, 0xAAAA0001)
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.2", "10.0.0.1", 7001, 6001, xr[:len(xr)-8]))
+	if _, ok := labels[core.LabelRTCPXRSSRC]; ok {
+		t.Errorf("truncated XR labeled: %v", labels)
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Stream events
+// ---------------------------------------------------------------------------
+
+func TestHandle_StreamEvents(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+	p.SetTaskID("t1")
+
+	ctx := map[string]string{"call_id": "call-1", "codec": "PCMA"}
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17}, ctx)
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.3"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17}, ctx)
+
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	steps := []struct {
+		src       string
+		pt        uint8
+		ssrc      uint32
+		at        time.Duration
+		wantEvent string
+	}{
+		{"10.0.0.1", 8, 0x1111, 0, ""},
+		{"10.0.0.1", 8, 0x1111, 20 * time.Millisecond, ""},
+		{"10.0.0.1", 101, 0x1111, 40 * time.Millisecond, ""}, // telephone-event is ignored
+		{"10.0.0.1", 8, 0x1111, 60 * time.Millisecond, ""},
+		{"10.0.0.1", 0, 0x2222, 80 * time.Millisecond, "ssrc_change,pt_change"},
+		{"10.0.0.3", 0, 0x2222, 100 * time.Millisecond, "ssrc_conflict"}, // failover peer, same SSRC
+		{"10.0.0.3", 0, 0x2222, 120 * time.Millisecond, ""},
+		{"10.0.0.1", 0, 0x2222, 10 * time.Second, ""}, // outside the conflict window
+		{"10.0.0.9", 0, 0x9999, 10 * time.Second, ""}, // unregistered flow
+	}
+	for i, st := range steps {
+		pkt := makeDecodedPacket(st.src, "10.0.0.2", 6000, 7000, makeRTPPayload(st.pt, uint16(i), 0, st.ssrc, false, false))
+		pkt.Timestamp = base.Add(st.at)
+		_, labels, err := p.Handle(pkt)
+		if err != nil {
+			t.Fatalf("step %d: Handle() error: %v", i, err)
+		}
+		if got := labels[core.LabelRTPStreamEvent]; got != st.wantEvent {
+			t.Errorf("step %d: stream_event = %q, want %q", i, got, st.wantEvent)
+		}
+		if i == 4 && (labels[core.LabelRTPPrevSSRC] != "0x00001111" || labels[core.LabelRTPPrevPayloadType] != "8") {
+			t.Errorf("step %d: prev labels = %v", i, labels)
+		}
+	}
+}
+
+func TestHandle_StreamEventsDisabled(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	if err := p.Init(map[string]any{"detect_ssrc_change": false, "detect_pt_change": false}); err != nil {
+		t.Fatal(err)
+	}
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17},
+		map[string]string{"call_id": "call-1"})
+
+	for i, ssrc := range []uint32{0x1111, 0x2222} {
+		_, labels, _ := p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, makeRTPPayload(uint8(i), 1, 0, ssrc, false, false)))
+		if ev := labels[core.LabelRTPStreamEvent]; ev != "" {
+			t.Errorf("packet %d: stream_event = %q with detection disabled", i, ev)
+		}
+	}
+}
+
+func TestHandle_PayloadSampling(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	if err := p.Init(map[string]any{"payload_sample_packets": float64(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	media := func(ssrc uint32) []byte {
+		return append(makeRTPPayload(0, 1, 0, ssrc, false, false), make([]byte, 160)...)
+	}
+	steps := []struct {
+		ssrc    uint32
+		wantLen int
+	}{
+		{0x1111, 172},
+		{0x1111, 172},
+		{0x1111, 12},  // third packet of the stream: header only
+		{0x2222, 172}, // a new SSRC is a new stream
+		{0x1111, 12},
+	}
+	for i, st := range steps {
+		pkt := makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, media(st.ssrc))
+		_, labels, err := p.Handle(pkt)
+		if err != nil {
+			t.Fatalf("step %d: Handle() error: %v", i, err)
+		}
+		if len(pkt.Payload) != st.wantLen {
+			t.Errorf("step %d: payload length = %d, want %d", i, len(pkt.Payload), st.wantLen)
+		}
+		wantLabel := ""
+		if st.wantLen == 12 {
+			wantLabel = "160"
+		}
+		if got := labels[core.LabelRTPPayloadLen]; got != wantLabel {
+			t.Errorf("step %d: payload_len = %q, want %q", i, got, wantLabel)
+		}
+	}
+}
+
+func TestRTPHeaderLen(t *testing.T) {
+	b := append(makeRTPPayload(0, 1, 0, 1, false, true), 0, 0, 0, 1, 0xaa, 0xbb, 0xcc, 0xdd, 0xff)
+	if got := rtpHeaderLen(b); got != 20 {
+		t.Errorf("rtpHeaderLen(extension) = %d, want 20", got)
+	}
+	c := makeRTPPayload(0, 1, 0, 1, false, false)
+	c[0] |= 2 // two CSRCs, but the packet ends after the fixed header
+	if got := rtpHeaderLen(c); got != 12 {
+		t.Errorf("rtpHeaderLen(truncated) = %d, want 12", got)
+	}
+}
+
+func TestInit_PayloadSamplingInvalid(t *testing.T) {
+	for _, v := range []any{float64(-1), float64(1.5), "10"} {
+		if err := NewRTPParser().Init(map[string]any{"payload_sample_packets": v}); err == nil {
+			t.Errorf("payload_sample_packets %v accepted", v)
+		}
+	}
+}
+
+func TestHandle_Quality(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	if err := p.Init(map[string]any{"quality_interval": "1s"}); err != nil {
+		t.Fatal(err)
+	}
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17},
+		map[string]string{"call_id": "call-1", "codec": "PCMU/8000"})
+
+	base := time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC)
+	send := func(src string, seq uint16, at time.Duration) (any, core.Labels) {
+		pkt := makeDecodedPacket(src, "10.0.0.2", 6000, 7000, makeRTPPayload(0, seq, uint32(seq)*160, 0x1111, false, false))
+		pkt.Timestamp = base.Add(at)
+		payload, labels, err := p.Handle(pkt)
+		if err != nil {
+			t.Fatalf("seq %d: Handle() error: %v", seq, err)
+		}
+		return payload, labels
+	}
+
+	// First interval: 20ms packetization, sequence numbers 10 and 11 lost,
+	// every other packet 10ms late
+	var payload any
+	var labels core.Labels
+	for seq := uint16(0); seq <= 50; seq++ {
+		if seq == 10 || seq == 11 {
+			continue
+		}
+		at := time.Duration(seq) * 20 * time.Millisecond
+		if seq%2 == 1 {
+			at += 10 * time.Millisecond
+		}
+		payload, labels = send("10.0.0.1", seq, at)
+		if seq < 50 && (payload != nil || labels[core.LabelRTPMOS] != "") {
+			t.Fatalf("seq %d: quality reported inside the interval: %v", seq, labels)
+		}
+	}
+	q, ok := payload.(*Quality)
+	if !ok {
+		t.Fatalf("payload = %T, want *Quality", payload)
+	}
+	if q.CallID != "call-1" || q.SSRC != "0x00001111" || q.Packets != 49 || q.Expected != 51 || q.Lost != 2 || q.Gaps != 1 {
+		t.Errorf("quality = %+v", q)
+	}
+	if labels[core.LabelRTPLossPct] != "3.9" {
+		t.Errorf("loss_pct = %q, want 3.9", labels[core.LabelRTPLossPct])
+	}
+	if q.JitterMs < 8 || q.JitterMs > 10 {
+		t.Errorf("jitter_ms = %v, want close to 10", q.JitterMs)
+	}
+	if q.MOS <= 1 || q.MOS >= 4.5 || labels[core.LabelRTPMOS] == "" {
+		t.Errorf("mos = %v, label %q", q.MOS, labels[core.LabelRTPMOS])
+	}
+
+	// The next interval starts after the closing packet
+	if payload, _ := send("10.0.0.1", 51, 1020*time.Millisecond); payload != nil {
+		t.Errorf("new interval reported at once: %+v", payload)
+	}
+
+	// Unregistered flows are not analyzed
+	for seq := uint16(0); seq < 3; seq++ {
+		if payload, labels := send("10.0.0.9", seq, time.Duration(seq)*time.Second); payload != nil || labels[core.LabelRTPMOS] != "" {
+			t.Errorf("unregistered flow reported: %v", labels)
+		}
+	}
+}
+
+func TestInit_QualityIntervalInvalid(t *testing.T) {
+	for _, v := range []string{"0s", "-1s", "soon"} {
+		if err := NewRTPParser().Init(map[string]any{"quality_interval": v}); err == nil {
+			t.Errorf("quality_interval %q accepted", v)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// DTMF
+// ---------------------------------------------------------------------------
+
+// makeDTMF builds a telephone-event packet (RFC 4733 §2.3).
+func makeDTMF(pt, event uint8, end bool, duration uint16) []byte {
+	b := makeRTPPayload(pt, 1, 16000, 0x00004444, false, false)
+	flags := byte(10) // volume -10 dBm0
+	if end {
+		flags |= 0x80
+	}
+	return append(b, event, flags, byte(duration>>8), byte(duration))
+}
+
+func TestHandle_DTMF(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	reg := newMockFlowRegistry()
+	p.SetFlowRegistry(reg)
+	reg.Set(plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 6000, DstPort: 7000, Proto: 17},
+		map[string]string{"call_id": "ivr-1", "codec": "PCMU/8000", "telephone_event": "96,101"})
+
+	_, labels, err := p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, makeDTMF(101, 5, false, 400)))
+	if err != nil {
+		t.Fatalf("Handle() error: %v", err)
+	}
+	if labels[core.LabelRTPDTMFDigit] != "5" || labels[core.LabelRTPDTMFDurationMs] != "50" || labels[core.LabelRTPDTMFEnd] != "false" {
+		t.Errorf("DTMF labels = %v", labels)
+	}
+
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, makeDTMF(101, 11, true, 1600)))
+	if labels[core.LabelRTPDTMFDigit] != "#" || labels[core.LabelRTPDTMFDurationMs] != "200" || labels[core.LabelRTPDTMFEnd] != "true" {
+		t.Errorf("end packet labels = %v", labels)
+	}
+
+	// A payload type not learned for the flow is media, not an event
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.1", "10.0.0.2", 6000, 7000, makeDTMF(0, 5, false, 400)))
+	if _, ok := labels[core.LabelRTPDTMFDigit]; ok {
+		t.Errorf("PCMU packet labeled as DTMF: %v", labels)
+	}
+
+	// Unregistered flows need dtmf_payload_types
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.4", 6000, 7000, makeDTMF(101, 5, false, 400)))
+	if _, ok := labels[core.LabelRTPDTMFDigit]; ok {
+		t.Errorf("unregistered flow labeled as DTMF: %v", labels)
+	}
+}
+
+func TestHandle_DTMFConfigured(t *testing.T) {
+	p := NewRTPParser().(*RTPParser)
+	if err := p.Init(map[string]any{"dtmf_payload_types": []any{float64(100)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Padding after the event is ignored; event 16 is flash
+	b := append(makeDTMF(100, 16, true, 800), 0, 0, 0, 4)
+	b[0] |= 0x20
+	_, labels, _ := p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.4", 6000, 7000, b))
+	if labels[core.LabelRTPDTMFDigit] != "flash" || labels[core.LabelRTPDTMFDurationMs] != "100" {
+		t.Errorf("labels = %v", labels)
+	}
+
+	// Events without a key are labeled with their number; a short payload is not labeled
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.4", 6000, 7000, makeDTMF(100, 66, false, 0)))
+	if labels[core.LabelRTPDTMFDigit] != "66" {
+		t.Errorf("event 66 labeled %q", labels[core.LabelRTPDTMFDigit])
+	}
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.4", 6000, 7000, makeDTMF(100, 1, false, 0)[:14]))
+	if _, ok := labels[core.LabelRTPDTMFDigit]; ok {
+		t.Errorf("truncated event labeled: %v", labels)
+	}
+
+	// Padding covering the header is bogus and must not empty the packet
+	b = makeDTMF(100, 5, false, 400)
+	b[0] |= 0x20
+	b[len(b)-1] = byte(len(b))
+	_, labels, _ = p.Handle(makeDecodedPacket("10.0.0.3", "10.0.0.4", 6000, 7000, b))
+	if _, ok := labels[core.LabelRTPDTMFDigit]; ok {
+		t.Errorf("packet with padding over the header labeled: %v", labels)
+	}
+
+	for _, v := range []any{"101", []any{float64(128)}, []any{"x"}} {
+		if err := NewRTPParser().Init(map[string]any{"dtmf_payload_types": v}); err == nil {
+			t.Errorf("dtmf_payload_types %v accepted", v)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+)
+
+// Round-trip time from RTCP (RFC 3550 §6.4.1): a report block echoes the
+// middle 32 bits of the NTP timestamp of the last SR it received (LSR) and the
+// delay since then (DLSR). The parser remembers when it captured each SR, so
+//
+//	rtt = capture time of the report - capture time of the SR - DLSR
+//
+// is the round trip from the capture point to the reporting endpoint and back,
+// without relying on the endpoints' clocks. The SR and the reports echoing it
+// must reach the same pipeline.
+const (
+	rtcpPTSR = 200
+	rtcpPTRR = 201
+
+	srHeaderLen     = 28 // common header + SSRC + sender info
+	rrHeaderLen     = 8  // common header + SSRC
+	reportBlockLen  = 24
+	srTTL           = time.Minute // longer than any sane report interval
+	srCleanup       = time.Minute
+	dlsrUnitsPerSec = 65536
+)
+
+// srKey identifies an SR by its sender SSRC and the NTP middle 32 bits that
+// report blocks echo as LSR.
+func srKey(ssrc, ntpMiddle uint32) string {
+	return fmt.Sprintf("%08x:%08x", ssrc, ntpMiddle)
+}
+
+// newSRCache returns the per-parser cache of SR capture times.
+func newSRCache() *cache.Cache {
+	return cache.New(srTTL, srCleanup)
+}
+
+// observeReports records SRs, labels an SR's sender info (rtcp.sender_packets,
+// rtcp.sender_octets) and labels the report block a SR/RR carries about a
+// source: rtcp.report_ssrc with the reporter's feedback (rtcp.loss_pct,
+// rtcp.cumulative_lost, rtcp.jitter, rtcp.lsr, rtcp.dlsr_ms), and
+// rtcp.rtt_ms when the block's LSR matches a recorded SR. The first block
+// with a round-trip time is labeled, else the first block. Only the first
+// packet of a compound RTCP packet is read.
+func (p *RTPParser) observeReports(pkt *core.DecodedPacket, pt uint8, labels core.Labels) {
+	b := pkt.Payload
+	if n := (int(binary.BigEndian.Uint16(b[2:4])) + 1) * 4; n < len(b) {
+		b = b[:n]
+	}
+	now := pkt.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	var blocks []byte
+	switch pt {
+	case rtcpPTSR:
+		if len(b) < srHeaderLen {
+			return
+		}
+		ssrc := binary.BigEndian.Uint32(b[4:8])
+		p.srCache.SetDefault(srKey(ssrc, binary.BigEndian.Uint32(b[10:14])), now)
+		labels[core.LabelRTCPSenderPackets] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(b[20:24])), 10)
+		labels[core.LabelRTCPSenderOctets] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(b[24:28])), 10)
+		blocks = b[srHeaderLen:]
+	case rtcpPTRR:
+		blocks = b[rrHeaderLen:]
+	default:
+		return
+	}
+
+	var first []byte
+	count := int(b[0] & 0x1F)
+	for i := 0; i < count && len(blocks) >= reportBlockLen; i++ {
+		block := blocks[:reportBlockLen]
+		blocks = blocks[reportBlockLen:]
+		if first == nil {
+			first = block
+		}
+
+		lsr := binary.BigEndian.Uint32(block[16:20])
+		if lsr == 0 {
+			continue // no SR received yet
+		}
+		source := binary.BigEndian.Uint32(block[0:4])
+		v, ok := p.srCache.Get(srKey(source, lsr))
+		if !ok {
+			continue
+		}
+		dlsr := time.Duration(binary.BigEndian.Uint32(block[20:24])) * time.Second / dlsrUnitsPerSec
+		rtt := now.Sub(v.(time.Time)) - dlsr
+		if rtt < 0 {
+			continue
+		}
+		labels[core.LabelRTCPRTT] = strconv.FormatFloat(float64(rtt)/float64(time.Millisecond), 'f', 1, 64)
+		metrics.RTCPRoundTripSeconds.Observe(rtt.Seconds())
+		labelReportBlock(block, labels)
+		return
+	}
+	if first != nil {
+		labelReportBlock(first, labels)
+	}
+}
+
+// labelReportBlock labels the source a report block is about and the
+// reception quality the reporter measured for it (RFC 3550 §6.4.1).
+func labelReportBlock(block []byte, labels core.Labels) {
+	labels[core.LabelRTCPReportSSRC] = fmt.Sprintf("0x%08X", binary.BigEndian.Uint32(block[0:4]))
+	labels[core.LabelRTCPLossPct] = strconv.FormatFloat(float64(block[4])*100/256, 'f', 1, 64)
+	// Cumulative lost is a signed 24-bit count: duplicates can make it negative.
+	lost := int32(binary.BigEndian.Uint32(block[4:8])<<8) >> 8
+	labels[core.LabelRTCPCumulativeLost] = strconv.Itoa(int(lost))
+	labels[core.LabelRTCPJitter] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(block[12:16])), 10)
+	// LSR 0: the reporter has not received an SR, DLSR is 0 as well
+	if lsr := binary.BigEndian.Uint32(block[16:20]); lsr != 0 {
+		dlsr := float64(binary.BigEndian.Uint32(block[20:24])) * 1000 / dlsrUnitsPerSec
+		labels[core.LabelRTCPLSR] = fmt.Sprintf("0x%08X", lsr)
+		labels[core.LabelRTCPDLSRMs] = strconv.FormatFloat(dlsr, 'f', 1, 64)
+	}
+}
@@ -0,0 +1,78 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// payloadSampler keeps the full payload of the first packets of each RTP
+// stream, enough to verify the codec, and strips the media payload of the
+// rest so only the RTP header is output. Streams are identified by flow and
+// SSRC; like streamTracker it is per parser and needs no locking.
+type payloadSampler struct {
+	limit   int                            // full-payload packets per stream; 0 = keep all
+	streams *idletable.Table[ssrcKey, int] // full-payload packets kept
+}
+
+// initPayloadSampling applies the payload_sample_packets key.
+func (p *RTPParser) initPayloadSampling(config map[string]any) error {
+	v, ok := config["payload_sample_packets"]
+	if !ok {
+		return nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 0 || n != float64(int(n)) {
+		return fmt.Errorf("rtp: payload_sample_packets must be a non-negative integer, got %v", v)
+	}
+	p.sampler = payloadSampler{limit: int(n), streams: newSSRCTable[int]()}
+	return nil
+}
+
+// samplePayload counts the packet against its stream and, past the limit,
+// truncates pkt.Payload to the RTP header and labels the stripped length.
+func (p *RTPParser) samplePayload(pkt *core.DecodedPacket, ssrc uint32, labels core.Labels) {
+	s := &p.sampler
+	if s.limit == 0 {
+		return
+	}
+	now := pkt.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	key := ssrcKey{
+		flow: plugin.FlowKey{
+			SrcIP:   pkt.IP.SrcIP,
+			DstIP:   pkt.IP.DstIP,
+			SrcPort: pkt.Transport.SrcPort,
+			DstPort: pkt.Transport.DstPort,
+			Proto:   17,
+		},
+		ssrc: ssrc,
+	}
+	kept, _ := s.streams.Touch(key, now)
+	if *kept < s.limit {
+		*kept++
+		return
+	}
+
+	n := rtpHeaderLen(pkt.Payload)
+	labels[core.LabelRTPPayloadLen] = strconv.Itoa(len(pkt.Payload) - n)
+	pkt.Payload = pkt.Payload[:n]
+}
+
+// rtpHeaderLen returns the length of the RTP header including CSRCs and the
+// header extension, capped at the packet length.
+func rtpHeaderLen(b []byte) int {
+	n := rtpMinLength + 4*int(b[0]&0x0F)
+	if b[0]&0x10 != 0 && len(b) >= n+4 {
+		n += 4 + 4*int(binary.BigEndian.Uint16(b[n+2:n+4]))
+	}
+	return min(n, len(b))
+}
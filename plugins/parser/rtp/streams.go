@@ -0,0 +1,176 @@
+package rtp
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/idletable"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Stream events (rtp.stream_event). They are detected on RTP flows registered
+// by the SIP parser only, so heuristic matches of non-RTP traffic with random
+// "SSRCs" never raise them. SBC failovers typically show up as an SSRC
+// change, or as the old and new media source sending the same SSRC at once.
+const (
+	eventSSRCChange   = "ssrc_change"   // the flow's SSRC changed mid-call
+	eventSSRCConflict = "ssrc_conflict" // another source sent the same SSRC within ssrc_conflict_window
+	eventPTChange     = "pt_change"     // the flow's payload type changed
+
+	defaultSSRCConflictWindow = 5 * time.Second
+
+	// streamTTL bounds the per-flow and per-SSRC state of idle streams.
+	streamTTL = 5 * time.Minute
+)
+
+// defaultIgnorePayloadTypes are payload types that interleave with the codec
+// without changing it: comfort noise (13) and the usual telephone-event (101).
+var defaultIgnorePayloadTypes = []uint8{13, 101}
+
+// streamConfig selects which stream events are detected.
+type streamConfig struct {
+	ssrcChange     bool
+	ssrcConflict   bool
+	ptChange       bool
+	conflictWindow time.Duration
+	ignorePT       [128]bool
+}
+
+func defaultStreamConfig() streamConfig {
+	c := streamConfig{
+		ssrcChange:     true,
+		ssrcConflict:   true,
+		ptChange:       true,
+		conflictWindow: defaultSSRCConflictWindow,
+	}
+	for _, pt := range defaultIgnorePayloadTypes {
+		c.ignorePT[pt] = true
+	}
+	return c
+}
+
+// ssrcKey identifies an RTP stream: a flow carries several SSRCs over an
+// SSRC change.
+type ssrcKey struct {
+	flow plugin.FlowKey
+	ssrc uint32
+}
+
+// newSSRCTable returns a table of per-stream state forgetting streams idle
+// for streamTTL.
+func newSSRCTable[V any]() *idletable.Table[ssrcKey, V] {
+	return idletable.New[ssrcKey, V](streamTTL, streamTTL, 0)
+}
+
+// streamState is the last SSRC and payload type seen on a flow.
+type streamState struct {
+	ssrc uint32
+	pt   uint8
+}
+
+// ssrcOwner is the last source that sent an SSRC.
+type ssrcOwner struct {
+	src  netip.AddrPort
+	seen time.Time
+}
+
+// streamTracker holds the stream state of one parser instance. Parsers are
+// per pipeline and a flow always reaches the same pipeline, so it needs no
+// locking; SSRC conflicts are only seen between flows of the same pipeline.
+type streamTracker struct {
+	flows  *idletable.Table[plugin.FlowKey, streamState]
+	owners *idletable.Table[uint32, ssrcOwner]
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{
+		flows:  idletable.New[plugin.FlowKey, streamState](streamTTL, streamTTL, 0),
+		owners: idletable.New[uint32, ssrcOwner](streamTTL, streamTTL, 0),
+	}
+}
+
+// initStreamConfig applies the stream event keys of the parser config.
+func (p *RTPParser) initStreamConfig(config map[string]any) error {
+	for key, dst := range map[string]*bool{
+		"detect_ssrc_change":   &p.streams.ssrcChange,
+		"detect_ssrc_conflict": &p.streams.ssrcConflict,
+		"detect_pt_change":     &p.streams.ptChange,
+	} {
+		if v, ok := config[key].(bool); ok {
+			*dst = v
+		}
+	}
+	if v, ok := config["ssrc_conflict_window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("rtp: invalid ssrc_conflict_window %q", v)
+		}
+		p.streams.conflictWindow = d
+	}
+	if v, ok := config["ignore_payload_types"]; ok {
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("rtp: ignore_payload_types must be a list of payload types")
+		}
+		p.streams.ignorePT = [128]bool{}
+		for i, item := range list {
+			n, ok := item.(float64)
+			if !ok || n < 0 || n > 127 || n != float64(int(n)) {
+				return fmt.Errorf("rtp: ignore_payload_types[%d]: invalid payload type %v", i, item)
+			}
+			p.streams.ignorePT[int(n)] = true
+		}
+	}
+	return nil
+}
+
+// observeStream detects the stream events of an RTP packet on a registered
+// flow, labels and counts them.
+func (p *RTPParser) observeStream(pkt *core.DecodedPacket, key plugin.FlowKey, ssrc uint32, pt uint8, labels core.Labels) {
+	now := pkt.Timestamp
+	if now.IsZero() {
+		now = time.Now()
+	}
+	t := p.tracker
+
+	var events []string
+	cfg := &p.streams
+
+	if cfg.ssrcConflict {
+		src := netip.AddrPortFrom(key.SrcIP, key.SrcPort)
+		if owner, ok := t.owners.Get(ssrc); ok && owner.src != src && now.Sub(owner.seen) < cfg.conflictWindow {
+			events = append(events, eventSSRCConflict)
+		}
+		owner, _ := t.owners.Touch(ssrc, now)
+		*owner = ssrcOwner{src: src, seen: now}
+	}
+
+	state, created := t.flows.Touch(key, now)
+	if created {
+		*state = streamState{ssrc: ssrc, pt: pt}
+	} else {
+		if cfg.ssrcChange && ssrc != state.ssrc {
+			events = append(events, eventSSRCChange)
+			labels[core.LabelRTPPrevSSRC] = fmt.Sprintf("0x%08X", state.ssrc)
+		}
+		if !cfg.ignorePT[pt] {
+			if cfg.ptChange && pt != state.pt && !cfg.ignorePT[state.pt] {
+				events = append(events, eventPTChange)
+				labels[core.LabelRTPPrevPayloadType] = fmt.Sprintf("%d", state.pt)
+			}
+			state.pt = pt
+		}
+		state.ssrc = ssrc
+	}
+
+	if len(events) > 0 {
+		labels[core.LabelRTPStreamEvent] = strings.Join(events, ",")
+		for _, ev := range events {
+			metrics.RTPStreamEventsTotal.WithLabelValues(p.taskID, ev).Inc()
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package rtp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// RTCP Extended Reports (RFC 3611). Endpoints that support XR send a VoIP
+// Metrics block (§4.7) with their own view of the call: loss and jitter
+// buffer discards, burst/gap structure, delays, and an R factor and MOS
+// computed by the endpoint. XR is sent in a compound packet after the SR/RR,
+// so every packet of the compound is searched.
+const (
+	rtcpPTXR = 207
+
+	xrHeaderLen      = 8 // common header + SSRC of the packet sender
+	xrBlockHeaderLen = 4 // BT, type-specific, block length
+	xrBTVoIPMetrics  = 7
+	voipMetricsLen   = 36 // header included
+
+	// xrUnavailable marks an unavailable signal/noise level, R factor or
+	// MOS (RFC 3611 §4.7.5, §4.7.6).
+	xrUnavailable = 127
+)
+
+// observeXR labels the first VoIP Metrics block of the XR packets in a
+// (compound) RTCP packet.
+func observeXR(b []byte, labels core.Labels) {
+	for len(b) >= 4 {
+		n := (int(binary.BigEndian.Uint16(b[2:4])) + 1) * 4
+		if b[0]>>6 != 2 || n > len(b) {
+			return
+		}
+		if b[1] == rtcpPTXR && n >= xrHeaderLen && labelVoIPMetrics(b[xrHeaderLen:n], labels) {
+			return
+		}
+		b = b[n:]
+	}
+}
+
+// labelVoIPMetrics labels the first VoIP Metrics block among the report
+// blocks of an XR packet and reports whether it found one.
+func labelVoIPMetrics(blocks []byte, labels core.Labels) bool {
+	for len(blocks) >= xrBlockHeaderLen {
+		n := xrBlockHeaderLen + int(binary.BigEndian.Uint16(blocks[2:4]))*4
+		if n > len(blocks) {
+			return false
+		}
+		if blocks[0] != xrBTVoIPMetrics || n < voipMetricsLen {
+			blocks = blocks[n:]
+			continue
+		}
+
+		m := blocks[:voipMetricsLen]
+		pct := func(v byte) string { return strconv.FormatFloat(float64(v)*100/256, 'f', 1, 64) }
+		u16 := func(off int) string { return strconv.Itoa(int(binary.BigEndian.Uint16(m[off : off+2]))) }
+
+		labels[core.LabelRTCPXRSSRC] = fmt.Sprintf("0x%08X", binary.BigEndian.Uint32(m[4:8]))
+		labels[core.LabelRTCPXRLossPct] = pct(m[8])
+		labels[core.LabelRTCPXRDiscardPct] = pct(m[9])
+		labels[core.LabelRTCPXRBurstDensityPct] = pct(m[10])
+		labels[core.LabelRTCPXRGapDensityPct] = pct(m[11])
+		labels[core.LabelRTCPXRBurstDurationMs] = u16(12)
+		labels[core.LabelRTCPXRGapDurationMs] = u16(14)
+		labels[core.LabelRTCPXRRTTMs] = u16(16)
+		labels[core.LabelRTCPXREndSystemMs] = u16(18)
+		// Signal and noise levels are signed dBm0
+		if v := int8(m[20]); v != xrUnavailable {
+			labels[core.LabelRTCPXRSignalDBm] = strconv.Itoa(int(v))
+		}
+		if v := int8(m[21]); v != xrUnavailable {
+			labels[core.LabelRTCPXRNoiseDBm] = strconv.Itoa(int(v))
+		}
+		if m[24] != xrUnavailable {
+			labels[core.LabelRTCPXRRFactor] = strconv.Itoa(int(m[24]))
+		}
+		// MOS values are in tenths
+		if m[26] != xrUnavailable {
+			labels[core.LabelRTCPXRMOSLQ] = strconv.FormatFloat(float64(m[26])/10, 'f', 1, 64)
+		}
+		if m[27] != xrUnavailable {
+			labels[core.LabelRTCPXRMOSCQ] = strconv.FormatFloat(float64(m[27])/10, 'f', 1, 64)
+		}
+		labels[core.LabelRTCPXRJBNominalMs] = u16(30)
+		labels[core.LabelRTCPXRJBMaxMs] = u16(32)
+		return true
+	}
+	return false
+}
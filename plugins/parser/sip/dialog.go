@@ -0,0 +1,409 @@
+package sip
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Dialog tracking (RFC 3261 §12-13) and offer/answer (RFC 3264, RFC 6337).
+//
+// A call is the state of one Call-ID. Its INVITE creates a dialog for every
+// To-tag that answers it, so a forked INVITE has an early dialog per fork;
+// a 2xx confirms its dialog and ends the other early ones, a final error
+// response or CANCEL ends the early dialogs, and BYE ends its dialog.
+//
+// An SDP body is an offer or an answer depending on what is outstanding:
+// the offer of an INVITE is answered in a provisional or 2xx response; an
+// INVITE without SDP gets the offer in a reliable provisional or 2xx
+// response and the answer in PRACK or ACK; re-INVITE and UPDATE renegotiate
+// an existing dialog. Every completed offer/answer exchange registers the
+// dialog's media flows and removes those the dialog no longer uses, so
+// flows follow hold, re-INVITE and mid-call media changes.
+
+// Dialog states in sip.dialog_state.
+const (
+	dialogEarly      = "early"
+	dialogConfirmed  = "confirmed"
+	dialogTerminated = "terminated"
+)
+
+// SDP roles in sip.sdp.
+const (
+	sdpOffer  = "offer"
+	sdpAnswer = "answer"
+)
+
+// sipSession is the dialog state of one Call-ID.
+type sipSession struct {
+	callID    string
+	createdAt time.Time
+
+	// The latest INVITE outside a dialog (the initial one, or its repeat
+	// after a 3xx redirect or an authentication challenge), its From-tag
+	// and its offer, answered in each dialog it creates; nil if it had no
+	// SDP.
+	inviteCSeq string
+	callerTag  string
+	offer      *sdpInfo
+
+	dialogs map[string]*dialog // by the tag of the INVITE's answerer
+}
+
+// dialog is one dialog of a call.
+type dialog struct {
+	state   string
+	pending *pendingOffer // outstanding offer made in the dialog
+
+	// The last completed exchange, offerer's SDP first, and the CSeq of the
+	// transaction that completed it.
+	offer, answer *sdpInfo
+	answeredTx    string
+
+	flows []plugin.FlowKey // registered for the last exchange
+}
+
+// pendingOffer is an offer waiting for its answer.
+type pendingOffer struct {
+	sdp        *sdpInfo
+	cseq       string // transaction that made it
+	inResponse bool   // made in a response: answered in PRACK or ACK
+}
+
+// dialogFor returns the dialog of an in-dialog message: the answerer's tag
+// is the To-tag of messages from the caller's side and the From-tag of
+// messages from the answerer's side.
+func (s *sipSession) dialogFor(fromTag, toTag string) *dialog {
+	if d, ok := s.dialogs[toTag]; ok {
+		return d
+	}
+	return s.dialogs[fromTag]
+}
+
+// cseqParts splits a CSeq header value into sequence number and method.
+func cseqParts(cseq string) (num, method string) {
+	num, method, _ = strings.Cut(strings.TrimSpace(cseq), " ")
+	return num, strings.TrimSpace(method)
+}
+
+// trackDialog updates the dialog state of the call a message belongs to,
+// registers media flows on completed offer/answer exchanges, and labels the
+// message with sip.dialog_state and sip.sdp.
+func (p *SIPParser) trackDialog(msg *sipMessage, labels core.Labels) {
+	if msg.callID == "" {
+		return
+	}
+	var s *sipSession
+	if v, ok := p.sessionCache.Get(msg.callID); ok {
+		s = v.(*sipSession)
+	}
+
+	var d *dialog
+	if msg.method != "" {
+		d = p.trackRequest(s, msg, labels)
+	} else if s != nil {
+		d = p.trackResponse(s, msg, labels)
+	}
+	if d != nil {
+		labels[core.LabelSIPDialogState] = d.state
+	}
+}
+
+// trackRequest handles a request and returns its dialog, if any.
+func (p *SIPParser) trackRequest(s *sipSession, msg *sipMessage, labels core.Labels) *dialog {
+	if msg.method == "INVITE" && msg.toTag == "" {
+		// Initial INVITE, or a new one after a redirect or challenge
+		if s == nil {
+			s = &sipSession{
+				callID:    msg.callID,
+				createdAt: time.Now(),
+				dialogs:   make(map[string]*dialog),
+			}
+		} else if s.inviteCSeq != msg.cseq {
+			// New INVITE after a 3xx or 401/407: forget the rejected one
+			for tag, d := range s.dialogs {
+				if d.state == dialogTerminated {
+					delete(s.dialogs, tag)
+				}
+			}
+		}
+		s.inviteCSeq = msg.cseq
+		s.callerTag = msg.fromTag
+		s.offer = msg.sdp
+		if msg.sdp != nil {
+			labels[core.LabelSIPSDP] = sdpOffer
+		}
+		p.sessionCache.Set(msg.callID, s, defaultSessionTTL)
+		return nil
+	}
+
+	if msg.method == "CANCEL" {
+		if s == nil {
+			p.cleanupFlows(msg.callID)
+			return nil
+		}
+		for _, d := range s.dialogs {
+			if d.state == dialogEarly {
+				p.terminateDialog(s, d)
+			}
+		}
+		s.offer = nil
+		p.expireSession(s)
+		return nil
+	}
+
+	var d *dialog
+	if s != nil {
+		d = s.dialogFor(msg.fromTag, msg.toTag)
+	}
+	if d == nil {
+		switch msg.method {
+		case "BYE":
+			// Dialog never seen: end whatever media the call has.
+			if s != nil {
+				for _, d := range s.dialogs {
+					p.terminateDialog(s, d)
+				}
+				p.expireSession(s)
+			}
+			p.cleanupFlows(msg.callID)
+			return nil
+		case "INVITE", "UPDATE":
+			// Renegotiation of a dialog set up before capture started
+			if msg.sdp == nil {
+				return nil
+			}
+			if s == nil {
+				s = &sipSession{callID: msg.callID, createdAt: time.Now(), dialogs: make(map[string]*dialog)}
+				p.sessionCache.Set(msg.callID, s, defaultSessionTTL)
+			}
+			d = &dialog{state: dialogConfirmed}
+			s.dialogs[msg.toTag] = d
+		default:
+			return nil
+		}
+	}
+
+	switch msg.method {
+	case "INVITE", "UPDATE":
+		if msg.sdp != nil {
+			d.pending = &pendingOffer{sdp: msg.sdp, cseq: msg.cseq}
+			labels[core.LabelSIPSDP] = sdpOffer
+		}
+	case "PRACK":
+		if msg.sdp == nil {
+			break
+		}
+		if d.pending != nil && d.pending.inResponse {
+			p.negotiate(s, d, d.pending.sdp, msg.sdp, msg.cseq, labels)
+		} else {
+			d.pending = &pendingOffer{sdp: msg.sdp, cseq: msg.cseq}
+			labels[core.LabelSIPSDP] = sdpOffer
+		}
+	case "ACK":
+		num, _ := cseqParts(msg.cseq)
+		if msg.sdp != nil && d.pending != nil && d.pending.inResponse {
+			if pendingNum, _ := cseqParts(d.pending.cseq); pendingNum == num {
+				p.negotiate(s, d, d.pending.sdp, msg.sdp, msg.cseq, labels)
+			}
+		}
+	case "BYE":
+		p.terminateDialog(s, d)
+		p.expireSession(s)
+	}
+	return d
+}
+
+// trackResponse handles a response and returns its dialog, if any.
+func (p *SIPParser) trackResponse(s *sipSession, msg *sipMessage, labels core.Labels) *dialog {
+	_, method := cseqParts(msg.cseq)
+	code := msg.statusCode
+
+	if method == "INVITE" && msg.cseq == s.inviteCSeq && msg.fromTag == s.callerTag {
+		return p.trackInviteResponse(s, msg, labels)
+	}
+
+	d := s.dialogFor(msg.fromTag, msg.toTag)
+	if d == nil {
+		return nil
+	}
+	switch method {
+	case "INVITE", "UPDATE", "PRACK":
+		switch {
+		case code < 200:
+		case code >= 300:
+			// Rejected renegotiation (e.g. 488, 491): the previous
+			// exchange stays in effect.
+			if d.pending != nil && d.pending.cseq == msg.cseq {
+				d.pending = nil
+			}
+		case msg.sdp == nil:
+		case d.pending != nil && !d.pending.inResponse && d.pending.cseq == msg.cseq:
+			p.negotiate(s, d, d.pending.sdp, msg.sdp, msg.cseq, labels)
+		case d.answeredTx == msg.cseq:
+			labels[core.LabelSIPSDP] = sdpAnswer // retransmission
+		case method == "INVITE":
+			// re-INVITE without SDP: the offer is in the 2xx
+			d.pending = &pendingOffer{sdp: msg.sdp, cseq: msg.cseq, inResponse: true}
+			labels[core.LabelSIPSDP] = sdpOffer
+		}
+	}
+	return d
+}
+
+// trackInviteResponse handles a response to the call's latest INVITE
+// outside a dialog, which creates, confirms or ends the dialog of its
+// To-tag.
+func (p *SIPParser) trackInviteResponse(s *sipSession, msg *sipMessage, labels core.Labels) *dialog {
+	code := msg.statusCode
+	if code == 100 {
+		return nil // hop-by-hop, no dialog
+	}
+
+	d := s.dialogs[msg.toTag]
+	if d == nil {
+		if code >= 300 {
+			// Rejected before any dialog: nothing to end but the call
+			p.expireSession(s)
+			return &dialog{state: dialogTerminated}
+		}
+		d = &dialog{state: dialogEarly}
+		s.dialogs[msg.toTag] = d
+	}
+	if d.state == dialogTerminated {
+		return d
+	}
+	if code >= 300 {
+		p.terminateDialog(s, d)
+		p.expireSession(s)
+		return d
+	}
+
+	confirmed := code >= 200 && d.state == dialogEarly
+	if code >= 200 {
+		d.state = dialogConfirmed
+	}
+
+	negotiated := false
+	switch {
+	case msg.sdp == nil:
+	case s.offer != nil:
+		// Answer to the INVITE's offer; every fork answers it
+		if d.answeredTx == msg.cseq && sameSDP(d.answer, msg.sdp) {
+			labels[core.LabelSIPSDP] = sdpAnswer
+			break
+		}
+		p.negotiate(s, d, s.offer, msg.sdp, msg.cseq, labels)
+		negotiated = true
+	case d.pending != nil && d.pending.inResponse && d.pending.cseq == msg.cseq:
+		// The offer again (reliable provisional, then 2xx)
+		d.pending.sdp = msg.sdp
+		labels[core.LabelSIPSDP] = sdpOffer
+	case d.offer == nil:
+		// INVITE without SDP: the offer is in the response
+		d.pending = &pendingOffer{sdp: msg.sdp, cseq: msg.cseq, inResponse: true}
+		labels[core.LabelSIPSDP] = sdpOffer
+	default:
+		// The offer again after PRACK answered it
+		labels[core.LabelSIPSDP] = sdpOffer
+	}
+
+	if confirmed {
+		// The media of an answer given in a provisional response is now
+		// confirmed; the caller talks to this fork only.
+		if !negotiated && d.offer != nil {
+			p.registerDialog(s, d)
+		}
+		for _, other := range s.dialogs {
+			if other != d && other.state == dialogEarly {
+				p.terminateDialog(s, other)
+			}
+		}
+	}
+	return d
+}
+
+// negotiate completes an offer/answer exchange of a dialog and registers
+// its media flows.
+func (p *SIPParser) negotiate(s *sipSession, d *dialog, offer, answer *sdpInfo, cseq string, labels core.Labels) {
+	d.offer, d.answer = offer, answer
+	d.answeredTx = cseq
+	d.pending = nil
+	labels[core.LabelSIPSDP] = sdpAnswer
+	p.registerDialog(s, d)
+}
+
+// registerDialog registers the media flows of a dialog's last exchange and
+// removes those of earlier exchanges no longer in use.
+func (p *SIPParser) registerDialog(s *sipSession, d *dialog) {
+	if p.flowRegistry == nil || d.offer == nil || d.answer == nil {
+		return
+	}
+	state := mediaStateConfirmed
+	if d.state == dialogEarly {
+		state = mediaStateEarly
+	}
+	keys := p.registerMediaFlows(s.callID, d.offer, d.answer, state)
+	var stale []plugin.FlowKey
+	for _, key := range d.flows {
+		if !slices.Contains(keys, key) {
+			stale = append(stale, key)
+		}
+	}
+	d.flows = keys
+	p.removeFlows(s, stale)
+}
+
+// terminateDialog ends a dialog and removes its media flows.
+func (p *SIPParser) terminateDialog(s *sipSession, d *dialog) {
+	d.state = dialogTerminated
+	d.pending = nil
+	flows := d.flows
+	d.flows = nil
+	p.removeFlows(s, flows)
+}
+
+// removeFlows removes flows from FlowRegistry unless another live dialog of
+// the call uses them, e.g. forks answering with the same media relay.
+func (p *SIPParser) removeFlows(s *sipSession, keys []plugin.FlowKey) {
+	if p.flowRegistry == nil {
+		return
+	}
+	for _, key := range keys {
+		inUse := false
+		for _, d := range s.dialogs {
+			if d.state != dialogTerminated && slices.Contains(d.flows, key) {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			p.flowRegistry.Delete(key)
+		}
+	}
+}
+
+// expireSession shortens the lifetime of a call without live dialogs to
+// the retransmission window, so late responses are still labeled.
+func (p *SIPParser) expireSession(s *sipSession) {
+	for _, d := range s.dialogs {
+		if d.state != dialogTerminated {
+			return
+		}
+	}
+	p.sessionCache.Set(s.callID, s, p.retransmissionWindow)
+}
+
+// sameSDP reports whether two parsed session descriptions negotiate the
+// same media.
+func sameSDP(a, b *sdpInfo) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.connectionIP == b.connectionIP && slices.EqualFunc(a.mediaStreams, b.mediaStreams, func(x, y mediaStream) bool {
+		return x.rtpPort == y.rtpPort && x.rtcpPort == y.rtcpPort && x.connectionIP == y.connectionIP && x.codec == y.codec
+	})
+}
@@ -0,0 +1,271 @@
+package sip
+
+import (
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// dialogCall sends the messages of one call through a parser.
+type dialogCall struct {
+	t        *testing.T
+	parser   *SIPParser
+	registry *mockFlowRegistry
+	callID   string
+}
+
+func newDialogCall(t *testing.T) *dialogCall {
+	parser := NewSIPParser().(*SIPParser)
+	registry := newMockFlowRegistry()
+	parser.SetFlowRegistry(registry)
+	return &dialogCall{t: t, parser: parser, registry: registry, callID: "dialog-call@example.com"}
+}
+
+func audioSDP(ip string, port int) string {
+	return "v=0\r\n" +
+		"c=IN IP4 " + ip + "\r\n" +
+		"t=0 0\r\n" +
+		"m=audio " + strconv.Itoa(port) + " RTP/AVP 0\r\n" +
+		"a=rtpmap:0 PCMU/8000\r\n" +
+		"a=rtcp-mux\r\n"
+}
+
+// send handles one message; toTag and body may be empty.
+func (c *dialogCall) send(firstLine, fromTag, toTag, cseq, body string) core.Labels {
+	c.t.Helper()
+	from := "<sip:alice@example.com>;tag=" + fromTag
+	to := "<sip:bob@example.com>"
+	if toTag != "" {
+		to += ";tag=" + toTag
+	}
+	payload := firstLine + "\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK-" + cseq[:1] + "\r\n" +
+		"From: " + from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Call-ID: " + c.callID + "\r\n" +
+		"CSeq: " + cseq + "\r\n"
+	if body != "" {
+		payload += "Content-Type: application/sdp\r\n"
+	}
+	payload += "\r\n" + body
+	_, labels, err := c.parser.Handle(&core.DecodedPacket{
+		Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+		Payload:   []byte(payload),
+	})
+	if err != nil {
+		c.t.Fatalf("Handle(%s) error: %v", firstLine, err)
+	}
+	return labels
+}
+
+// media returns the flow context of the stream between two endpoints, nil
+// if it is not registered.
+func (c *dialogCall) media(a string, portA int, b string, portB int) map[string]string {
+	key := plugin.FlowKey{
+		SrcIP:   netip.MustParseAddr(a),
+		DstIP:   netip.MustParseAddr(b),
+		SrcPort: uint16(portA),
+		DstPort: uint16(portB),
+		Proto:   17,
+	}
+	v, ok := c.registry.Get(key)
+	if !ok {
+		return nil
+	}
+	return v.(*plugin.Flow).Context
+}
+
+func TestDialogForking(t *testing.T) {
+	c := newDialogCall(t)
+	labels := c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", audioSDP("10.0.0.1", 20000))
+	if labels[core.LabelSIPSDP] != sdpOffer || labels[core.LabelSIPFromTag] != "a1" {
+		t.Errorf("INVITE labels = %v", labels)
+	}
+	if _, ok := labels[core.LabelSIPDialogState]; ok {
+		t.Errorf("INVITE has dialog state %q", labels[core.LabelSIPDialogState])
+	}
+
+	// Two forks answer with early media.
+	labels = c.send("SIP/2.0 183 Session Progress", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	if labels[core.LabelSIPDialogState] != dialogEarly || labels[core.LabelSIPSDP] != sdpAnswer || labels[core.LabelSIPToTag] != "b1" {
+		t.Errorf("183 labels = %v", labels)
+	}
+	c.send("SIP/2.0 183 Session Progress", "a1", "b2", "1 INVITE", audioSDP("10.0.0.3", 40000))
+	if c.media("10.0.0.1", 20000, "10.0.0.2", 30000)["media_state"] != mediaStateEarly ||
+		c.media("10.0.0.1", 20000, "10.0.0.3", 40000)["media_state"] != mediaStateEarly {
+		t.Fatal("early media of both forks not registered")
+	}
+
+	// The second fork answers: its dialog is confirmed, the other one ends.
+	labels = c.send("SIP/2.0 200 OK", "a1", "b2", "1 INVITE", audioSDP("10.0.0.3", 40000))
+	if labels[core.LabelSIPDialogState] != dialogConfirmed {
+		t.Errorf("200 OK dialog state = %q", labels[core.LabelSIPDialogState])
+	}
+	if c.media("10.0.0.1", 20000, "10.0.0.2", 30000) != nil {
+		t.Error("media of the cancelled fork still registered")
+	}
+	if c.media("10.0.0.1", 20000, "10.0.0.3", 40000)["media_state"] != mediaStateConfirmed {
+		t.Error("media of the answering fork not confirmed")
+	}
+
+	// Late 183 of the ended fork does not bring its media back.
+	labels = c.send("SIP/2.0 183 Session Progress", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	if labels[core.LabelSIPDialogState] != dialogTerminated || c.media("10.0.0.1", 20000, "10.0.0.2", 30000) != nil {
+		t.Errorf("late 183 of ended fork: labels %v", labels)
+	}
+
+	labels = c.send("BYE sip:alice@example.com SIP/2.0", "b2", "a1", "2 BYE", "")
+	if labels[core.LabelSIPDialogState] != dialogTerminated || c.registry.Count() != 0 {
+		t.Errorf("after BYE: state %q, %d flows", labels[core.LabelSIPDialogState], c.registry.Count())
+	}
+}
+
+func TestDialogReInvite(t *testing.T) {
+	c := newDialogCall(t)
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", audioSDP("10.0.0.1", 20000))
+	c.send("SIP/2.0 200 OK", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	c.send("ACK sip:bob@example.com SIP/2.0", "a1", "b1", "1 ACK", "")
+
+	// The callee moves its media; the old stream is removed once answered.
+	labels := c.send("INVITE sip:alice@example.com SIP/2.0", "b1", "a1", "1 INVITE", audioSDP("10.0.0.2", 31000))
+	if labels[core.LabelSIPSDP] != sdpOffer || labels[core.LabelSIPDialogState] != dialogConfirmed {
+		t.Errorf("re-INVITE labels = %v", labels)
+	}
+	if c.media("10.0.0.1", 20000, "10.0.0.2", 30000) == nil {
+		t.Error("media removed before the re-INVITE was answered")
+	}
+	labels = c.send("SIP/2.0 200 OK", "b1", "a1", "1 INVITE", audioSDP("10.0.0.1", 20000))
+	if labels[core.LabelSIPSDP] != sdpAnswer {
+		t.Errorf("re-INVITE 200 OK labels = %v", labels)
+	}
+	if c.media("10.0.0.1", 20000, "10.0.0.2", 30000) != nil {
+		t.Error("stale media still registered after the re-INVITE")
+	}
+	ctx := c.media("10.0.0.2", 31000, "10.0.0.1", 20000)
+	if ctx == nil || ctx["call_id"] != c.callID || ctx["media_state"] != mediaStateConfirmed {
+		t.Errorf("renegotiated media context = %v", ctx)
+	}
+
+	// A rejected renegotiation keeps the media.
+	c.send("UPDATE sip:bob@example.com SIP/2.0", "a1", "b1", "2 UPDATE", audioSDP("10.0.0.1", 22000))
+	c.send("SIP/2.0 488 Not Acceptable Here", "a1", "b1", "2 UPDATE", "")
+	if c.media("10.0.0.2", 31000, "10.0.0.1", 20000) == nil {
+		t.Error("media removed by a rejected UPDATE")
+	}
+
+	// An accepted UPDATE moves it.
+	c.send("UPDATE sip:bob@example.com SIP/2.0", "a1", "b1", "3 UPDATE", audioSDP("10.0.0.1", 22000))
+	c.send("SIP/2.0 200 OK", "a1", "b1", "3 UPDATE", audioSDP("10.0.0.2", 31000))
+	if c.media("10.0.0.2", 31000, "10.0.0.1", 20000) != nil || c.media("10.0.0.1", 22000, "10.0.0.2", 31000) == nil {
+		t.Error("media not moved by the UPDATE")
+	}
+}
+
+func TestDialogLateOffer(t *testing.T) {
+	c := newDialogCall(t)
+	labels := c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", "")
+	if _, ok := labels[core.LabelSIPSDP]; ok {
+		t.Errorf("INVITE without SDP labeled %q", labels[core.LabelSIPSDP])
+	}
+	labels = c.send("SIP/2.0 200 OK", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	if labels[core.LabelSIPSDP] != sdpOffer || c.registry.Count() != 0 {
+		t.Errorf("200 OK with offer: labels %v, %d flows", labels, c.registry.Count())
+	}
+	labels = c.send("ACK sip:bob@example.com SIP/2.0", "a1", "b1", "1 ACK", audioSDP("10.0.0.1", 20000))
+	if labels[core.LabelSIPSDP] != sdpAnswer {
+		t.Errorf("ACK labels = %v", labels)
+	}
+	if ctx := c.media("10.0.0.1", 20000, "10.0.0.2", 30000); ctx == nil || ctx["media_state"] != mediaStateConfirmed {
+		t.Errorf("media answered in ACK = %v", ctx)
+	}
+}
+
+func TestDialogPRACK(t *testing.T) {
+	c := newDialogCall(t)
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", "")
+	c.send("SIP/2.0 183 Session Progress", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	labels := c.send("PRACK sip:bob@example.com SIP/2.0", "a1", "b1", "2 PRACK", audioSDP("10.0.0.1", 20000))
+	if labels[core.LabelSIPSDP] != sdpAnswer || labels[core.LabelSIPDialogState] != dialogEarly {
+		t.Errorf("PRACK labels = %v", labels)
+	}
+	if ctx := c.media("10.0.0.1", 20000, "10.0.0.2", 30000); ctx == nil || ctx["media_state"] != mediaStateEarly {
+		t.Errorf("media answered in PRACK = %v", ctx)
+	}
+
+	// The 2xx repeats the offer already answered and confirms the media.
+	labels = c.send("SIP/2.0 200 OK", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	if labels[core.LabelSIPSDP] != sdpOffer {
+		t.Errorf("200 OK labels = %v", labels)
+	}
+	if ctx := c.media("10.0.0.1", 20000, "10.0.0.2", 30000); ctx["media_state"] != mediaStateConfirmed {
+		t.Errorf("media after 200 OK = %v", ctx)
+	}
+	labels = c.send("ACK sip:bob@example.com SIP/2.0", "a1", "b1", "1 ACK", "")
+	if _, ok := labels[core.LabelSIPSDP]; ok || c.media("10.0.0.1", 20000, "10.0.0.2", 30000) == nil {
+		t.Errorf("ACK labels = %v", labels)
+	}
+}
+
+func TestDialogRejectedAndRetried(t *testing.T) {
+	c := newDialogCall(t)
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", audioSDP("10.0.0.1", 20000))
+	labels := c.send("SIP/2.0 407 Proxy Authentication Required", "a1", "p1", "1 INVITE", "")
+	if labels[core.LabelSIPDialogState] != dialogTerminated {
+		t.Errorf("407 labels = %v", labels)
+	}
+
+	// The authenticated INVITE is a new transaction of the same call.
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "2 INVITE", audioSDP("10.0.0.1", 20000))
+	c.send("SIP/2.0 302 Moved Temporarily", "a1", "r1", "2 INVITE", "")
+	c.send("INVITE sip:carol@example.com SIP/2.0", "a1", "", "3 INVITE", audioSDP("10.0.0.1", 20000))
+	labels = c.send("SIP/2.0 200 OK", "a1", "c1", "3 INVITE", audioSDP("10.0.0.4", 50000))
+	if labels[core.LabelSIPDialogState] != dialogConfirmed || c.media("10.0.0.1", 20000, "10.0.0.4", 50000) == nil {
+		t.Errorf("200 OK after redirect: labels %v", labels)
+	}
+}
+
+func TestDialogCancel(t *testing.T) {
+	c := newDialogCall(t)
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "", "1 INVITE", audioSDP("10.0.0.1", 20000))
+	c.send("SIP/2.0 183 Session Progress", "a1", "b1", "1 INVITE", audioSDP("10.0.0.2", 30000))
+	if c.registry.Count() == 0 {
+		t.Fatal("early media not registered")
+	}
+	c.send("CANCEL sip:bob@example.com SIP/2.0", "a1", "", "1 CANCEL", "")
+	if c.registry.Count() != 0 {
+		t.Errorf("%d flows after CANCEL", c.registry.Count())
+	}
+	labels := c.send("SIP/2.0 487 Request Terminated", "a1", "b1", "1 INVITE", "")
+	if labels[core.LabelSIPDialogState] != dialogTerminated {
+		t.Errorf("487 labels = %v", labels)
+	}
+}
+
+func TestDialogMidCall(t *testing.T) {
+	// Capture starts after the call was set up: the first re-INVITE
+	// registers its media.
+	c := newDialogCall(t)
+	c.send("INVITE sip:bob@example.com SIP/2.0", "a1", "b1", "5 INVITE", audioSDP("10.0.0.1", 20000))
+	labels := c.send("SIP/2.0 200 OK", "a1", "b1", "5 INVITE", audioSDP("10.0.0.2", 30000))
+	if labels[core.LabelSIPDialogState] != dialogConfirmed || c.media("10.0.0.1", 20000, "10.0.0.2", 30000) == nil {
+		t.Errorf("mid-call re-INVITE: labels %v", labels)
+	}
+}
+
+func TestHeaderTag(t *testing.T) {
+	tests := map[string]string{
+		`"Bob" <sip:bob@example.com>;tag=a6c85cf`:            "a6c85cf",
+		`<sip:bob@example.com;transport=tcp>;TAG=x1;foo=bar`: "x1",
+		`sip:bob@example.com;tag=1928301774`:                 "1928301774",
+		`<sip:bob@example.com;tag=uri-param>`:                "",
+		`<sip:bob@example.com>`:                              "",
+	}
+	for value, want := range tests {
+		if got := headerTag(value); got != want {
+			t.Errorf("headerTag(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
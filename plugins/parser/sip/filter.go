@@ -0,0 +1,186 @@
+package sip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// messageFilter drops predictable noise (OPTIONS keepalives, SUBSCRIBE/NOTIFY
+// churn, 100 Trying) before the message is parsed: it only reads the start
+// line and, for responses, the CSeq method.
+type messageFilter struct {
+	methods       map[string]bool // allowlist; nil = all
+	ignoreMethods map[string]bool
+	codes         []codeRange // allowlist for responses; nil = all
+	ignoreCodes   []codeRange
+}
+
+// codeRange is a status code or, for a class such as "4xx", its range.
+type codeRange struct {
+	lo, hi int
+}
+
+// newMessageFilter reads the methods, ignore_methods, status_codes and
+// ignore_status_codes keys. It returns nil when none is set.
+func newMessageFilter(config map[string]any) (*messageFilter, error) {
+	f := &messageFilter{}
+	var err error
+	if f.methods, err = methodSet(config, "methods"); err != nil {
+		return nil, err
+	}
+	if f.ignoreMethods, err = methodSet(config, "ignore_methods"); err != nil {
+		return nil, err
+	}
+	if f.codes, err = codeRanges(config, "status_codes"); err != nil {
+		return nil, err
+	}
+	if f.ignoreCodes, err = codeRanges(config, "ignore_status_codes"); err != nil {
+		return nil, err
+	}
+	if f.methods == nil && f.ignoreMethods == nil && f.codes == nil && f.ignoreCodes == nil {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// ignores reports whether the message is dropped, and why. Messages whose
+// method cannot be told are kept and left to the parser.
+func (f *messageFilter) ignores(payload []byte) (string, bool) {
+	method, code := peekMessage(payload)
+	if method != "" {
+		if f.methods != nil && !f.methods[method] {
+			return "method " + method + " not allowed", true
+		}
+		if f.ignoreMethods[method] {
+			return "method " + method + " ignored", true
+		}
+	}
+	if code != 0 {
+		if f.codes != nil && !matchCode(f.codes, code) {
+			return "status code " + strconv.Itoa(code) + " not allowed", true
+		}
+		if matchCode(f.ignoreCodes, code) {
+			return "status code " + strconv.Itoa(code) + " ignored", true
+		}
+	}
+	return "", false
+}
+
+func matchCode(ranges []codeRange, code int) bool {
+	for _, r := range ranges {
+		if code >= r.lo && code <= r.hi {
+			return true
+		}
+	}
+	return false
+}
+
+// peekMessage returns the method of a request, or the status code and CSeq
+// method of a response, without parsing the headers.
+func peekMessage(payload []byte) (method string, code int) {
+	line, rest, _ := bytes.Cut(payload, []byte("\n"))
+	line = bytes.TrimRight(line, "\r")
+
+	if status, ok := bytes.CutPrefix(line, []byte("SIP/2.0 ")); ok {
+		if len(status) < 3 {
+			return "", 0
+		}
+		code, err := strconv.Atoi(string(status[:3]))
+		if err != nil {
+			return "", 0
+		}
+		return cseqMethod(rest), code
+	}
+
+	token, _, ok := bytes.Cut(line, []byte(" "))
+	if !ok || !isToken(string(token)) {
+		return "", 0
+	}
+	return strings.ToUpper(string(token)), 0
+}
+
+// cseqMethod finds the method of the CSeq header in the header section.
+func cseqMethod(headers []byte) string {
+	for len(headers) > 0 {
+		var line []byte
+		line, headers, _ = bytes.Cut(headers, []byte("\n"))
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 0 {
+			break // end of headers
+		}
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if !ok || !bytes.EqualFold(bytes.TrimSpace(name), []byte("cseq")) {
+			continue
+		}
+		fields := bytes.Fields(value)
+		if len(fields) != 2 {
+			return ""
+		}
+		return strings.ToUpper(string(fields[1]))
+	}
+	return ""
+}
+
+func methodSet(config map[string]any, key string) (map[string]bool, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("sip: %s must be a list of methods", key)
+	}
+	set := make(map[string]bool, len(list))
+	for i, item := range list {
+		s, _ := item.(string)
+		if !isToken(s) {
+			return nil, fmt.Errorf("sip: %s[%d]: invalid method %v", key, i, item)
+		}
+		set[strings.ToUpper(s)] = true
+	}
+	return set, nil
+}
+
+// codeRanges reads a list of status codes (404) and classes ("4xx").
+func codeRanges(config map[string]any, key string) ([]codeRange, error) {
+	v, ok := config[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("sip: %s must be a list of status codes", key)
+	}
+	ranges := make([]codeRange, 0, len(list))
+	for i, item := range list {
+		r, ok := parseCodeRange(item)
+		if !ok {
+			return nil, fmt.Errorf("sip: %s[%d]: invalid status code %v, want 100-699 or a class like \"4xx\"", key, i, item)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func parseCodeRange(v any) (codeRange, bool) {
+	switch v := v.(type) {
+	case float64:
+		if v != float64(int(v)) || v < 100 || v > 699 {
+			return codeRange{}, false
+		}
+		return codeRange{int(v), int(v)}, true
+	case string:
+		if len(v) == 3 && v[0] >= '1' && v[0] <= '6' && strings.EqualFold(v[1:], "xx") {
+			lo := int(v[0]-'0') * 100
+			return codeRange{lo, lo + 99}, true
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > 699 {
+			return codeRange{}, false
+		}
+		return codeRange{n, n}, true
+	}
+	return codeRange{}, false
+}
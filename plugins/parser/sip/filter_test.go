@@ -0,0 +1,99 @@
+package sip
+
+import (
+	"errors"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func sipPacket(startLine, cseq string) *core.DecodedPacket {
+	payload := startLine + "\r\n" +
+		"Call-ID: filter-test@example.com\r\n" +
+		"From: <sip:alice@example.com>;tag=1\r\n" +
+		"To: <sip:bob@example.com>\r\n" +
+		"CSeq: " + cseq + "\r\n" +
+		"Content-Length: 0\r\n\r\n"
+	return &core.DecodedPacket{Payload: []byte(payload), Transport: core.TransportHeader{DstPort: 5060}}
+}
+
+func TestHandle_MessageFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    map[string]any
+		startLine string
+		cseq      string
+		ignored   bool
+	}{
+		{"ignored method", map[string]any{"ignore_methods": []any{"options", "NOTIFY"}},
+			"OPTIONS sip:bob@example.com SIP/2.0", "1 OPTIONS", true},
+		{"response to ignored method", map[string]any{"ignore_methods": []any{"OPTIONS"}},
+			"SIP/2.0 200 OK", "1 OPTIONS", true},
+		{"other method kept", map[string]any{"ignore_methods": []any{"OPTIONS"}},
+			"INVITE sip:bob@example.com SIP/2.0", "1 INVITE", false},
+		{"method not allowed", map[string]any{"methods": []any{"INVITE", "BYE"}},
+			"SUBSCRIBE sip:bob@example.com SIP/2.0", "1 SUBSCRIBE", true},
+		{"method allowed", map[string]any{"methods": []any{"INVITE", "BYE"}},
+			"SIP/2.0 180 Ringing", "1 INVITE", false},
+		{"ignored status class", map[string]any{"ignore_status_codes": []any{"1xx"}},
+			"SIP/2.0 100 Trying", "1 INVITE", true},
+		{"ignored status code", map[string]any{"ignore_status_codes": []any{float64(401)}},
+			"SIP/2.0 401 Unauthorized", "1 REGISTER", true},
+		{"status code allowed", map[string]any{"status_codes": []any{"2xx", "486"}},
+			"SIP/2.0 486 Busy Here", "1 INVITE", false},
+		{"status code not allowed", map[string]any{"status_codes": []any{"2xx", "486"}},
+			"SIP/2.0 183 Session Progress", "1 INVITE", true},
+		{"requests ignore status codes", map[string]any{"status_codes": []any{"2xx"}},
+			"INVITE sip:bob@example.com SIP/2.0", "1 INVITE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewSIPParser().(*SIPParser)
+			if err := parser.Init(tt.config); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			_, labels, err := parser.Handle(sipPacket(tt.startLine, tt.cseq))
+			if tt.ignored {
+				if !errors.Is(err, core.ErrIgnored) {
+					t.Fatalf("Handle error = %v, want ErrIgnored", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Handle: %v", err)
+			}
+			if labels[core.LabelSIPCallID] == "" {
+				t.Errorf("labels = %v, want a parsed message", labels)
+			}
+		})
+	}
+}
+
+func TestHandle_MessageFilterSkipsRetransmissionTracking(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(map[string]any{"ignore_methods": []any{"OPTIONS"}}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	for range 2 {
+		_, _, _ = parser.Handle(sipPacket("OPTIONS sip:bob@example.com SIP/2.0", "1 OPTIONS"))
+	}
+	if n := parser.txCache.ItemCount(); n != 0 {
+		t.Errorf("tracked %d transactions, want 0", n)
+	}
+}
+
+func TestInit_MessageFilterErrors(t *testing.T) {
+	tests := []map[string]any{
+		{"methods": "INVITE"},
+		{"ignore_methods": []any{"BAD METHOD"}},
+		{"ignore_methods": []any{float64(1)}},
+		{"status_codes": []any{float64(99)}},
+		{"ignore_status_codes": []any{"7xx"}},
+		{"ignore_status_codes": []any{float64(180.5)}},
+	}
+	for _, config := range tests {
+		if err := NewSIPParser().Init(config); err == nil {
+			t.Errorf("Init(%v) succeeded, want error", config)
+		}
+	}
+}
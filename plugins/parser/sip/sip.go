@@ -7,20 +7,40 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/netip"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/patrickmn/go-cache"
 
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
 const (
 	defaultSessionTTL = 24 * time.Hour
 	defaultCleanup    = 1 * time.Hour
+
+	// defaultRetransmissionWindow is 64*T1 (RFC 3261 §17.1.1.2), the lifetime
+	// of a client transaction during which retransmissions can occur.
+	defaultRetransmissionWindow = 32 * time.Second
+
+	// extra_headers limits: values longer than this are truncated, and at most
+	// maxExtraHeaders header names may be configured.
+	defaultMaxHeaderValueLen = 256
+	maxExtraHeaders          = 32
+
+	// Media state stored in flow context ("media_state").
+	mediaStateEarly     = "early"     // negotiated by 180/183 SDP, call not yet answered
+	mediaStateConfirmed = "confirmed" // negotiated or confirmed by 200 OK
 )
 
 // SIPParser parses SIP signaling messages.
@@ -28,14 +48,26 @@ type SIPParser struct {
 	name         string
 	sessionCache *cache.Cache        // Call-ID → *sipSession
 	flowRegistry plugin.FlowRegistry // Injected via SetFlowRegistry
-}
 
-// sipSession tracks SIP call state for correlating INVITE/200 OK.
-type sipSession struct {
-	callID    string
-	offerSDP  *sdpInfo // SDP from INVITE
-	answerSDP *sdpInfo // SDP from 200 OK
-	createdAt time.Time
+	// Retransmission detection: transaction message key → times seen
+	detectRetransmissions bool
+	retransmissionWindow  time.Duration
+	txCache               *cache.Cache
+
+	// extraHeaders maps lower-case header name → label key (sip.header.*)
+	extraHeaders      map[string]string
+	maxHeaderValueLen int
+
+	decodeISUP bool // decode ISUP message type from SIP-I bodies
+
+	strict bool // drop malformed messages instead of keeping them with sip.parse_warnings
+
+	filter *messageFilter // methods and status codes to ignore; nil = none
+
+	// SIP over WebSocket: candidate ports and connections seen upgrading to "sip"
+	wsPorts   map[uint16]struct{}
+	wsConns   *cache.Cache
+	wsStreams *cache.Cache // stream key → *wsStream, while a message is incomplete
 }
 
 // sdpInfo contains parsed SDP information.
@@ -51,15 +83,30 @@ type mediaStream struct {
 	rtcpPort     uint16     // RTCP port (rtpPort+1 or from a=rtcp:)
 	rtcpMux      bool       // Whether RTCP is multiplexed on RTP port
 	codec        string     // From a=rtpmap: (optional, for labels)
+	dtmfPTs      []string   // Payload types of a=rtpmap: telephone-event (RFC 4733)
 	direction    string     // sendrecv/sendonly/recvonly/inactive
 	connectionIP netip.Addr // Media-level c= IP (overrides session-level per RFC 4566)
+	proto        string     // Transport from m= line (e.g. "RTP/AVP", "TCP/MSRP")
+	path         string     // MSRP a=path: URI (m=message only)
 }
 
 // NewSIPParser creates a new SIP parser.
 func NewSIPParser() plugin.Parser {
+	wsPorts := make(map[uint16]struct{}, len(defaultWebSocketPorts))
+	for _, port := range defaultWebSocketPorts {
+		wsPorts[port] = struct{}{}
+	}
 	return &SIPParser{
-		name:         "sip",
-		sessionCache: cache.New(defaultSessionTTL, defaultCleanup),
+		name:                  "sip",
+		sessionCache:          cache.New(defaultSessionTTL, defaultCleanup),
+		detectRetransmissions: true,
+		retransmissionWindow:  defaultRetransmissionWindow,
+		txCache:               cache.New(defaultRetransmissionWindow, defaultRetransmissionWindow),
+		maxHeaderValueLen:     defaultMaxHeaderValueLen,
+		decodeISUP:            true,
+		wsPorts:               wsPorts,
+		wsConns:               cache.New(defaultWSConnTTL, defaultCleanup),
+		wsStreams:             cache.New(wsStreamTTL, defaultCleanup),
 	}
 }
 
@@ -69,8 +116,97 @@ func (p *SIPParser) Name() string {
 }
 
 // Init initializes the parser with configuration.
+//
+// Supported keys:
+//   - detect_retransmissions (bool, default true)
+//   - retransmission_window (duration string, default "32s")
+//   - extra_headers ([]string): additional headers exported as sip.header.<name> labels
+//   - max_header_value_len (int, default 256): truncation limit for extra header values
+//   - decode_isup (bool, default true): label the ISUP message type of SIP-I bodies
+//   - strict (bool, default false): drop malformed messages instead of keeping
+//     them with partial labels and sip.parse_warnings
+//   - websocket_ports ([]int, default [80, 443, 5066, 8088]): ports probed for
+//     SIP over WebSocket frames; connections upgraded to the "sip" subprotocol
+//     are recognised on any port
+//   - methods / ignore_methods ([]string): parse only these request methods, or
+//     ignore these; responses follow the method of their CSeq
+//   - status_codes / ignore_status_codes ([]int or class strings like "1xx"):
+//     parse only these responses, or ignore these
+//
+// Ignored messages are dropped before labels, retransmission tracking and
+// flow handling.
 func (p *SIPParser) Init(config map[string]any) error {
-	// Future: configurable TTL, cleanup interval
+	if v, ok := config["detect_retransmissions"].(bool); ok {
+		p.detectRetransmissions = v
+	}
+	if v, ok := config["retransmission_window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("sip: invalid retransmission_window %q", v)
+		}
+		p.retransmissionWindow = d
+		p.txCache = cache.New(d, d)
+	}
+	if v, ok := config["max_header_value_len"].(float64); ok {
+		if v < 1 {
+			return fmt.Errorf("sip: max_header_value_len must be > 0")
+		}
+		p.maxHeaderValueLen = int(v)
+	}
+	if v, ok := config["decode_isup"].(bool); ok {
+		p.decodeISUP = v
+	}
+	if v, ok := config["strict"].(bool); ok {
+		p.strict = v
+	}
+	if err := p.initExtraHeaders(config["extra_headers"]); err != nil {
+		return err
+	}
+	if err := p.initWebSocketPorts(config["websocket_ports"]); err != nil {
+		return err
+	}
+	filter, err := newMessageFilter(config)
+	if err != nil {
+		return err
+	}
+	p.filter = filter
+	return nil
+}
+
+// initExtraHeaders validates the extra_headers list and builds the
+// header name → label key index.
+func (p *SIPParser) initExtraHeaders(v any) error {
+	var names []string
+	switch list := v.(type) {
+	case nil:
+		return nil
+	case []string:
+		names = list
+	case []any:
+		for i, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("sip: extra_headers[%d]: expected string", i)
+			}
+			names = append(names, name)
+		}
+	default:
+		return fmt.Errorf("sip: extra_headers must be a list of header names")
+	}
+
+	if len(names) > maxExtraHeaders {
+		return fmt.Errorf("sip: extra_headers: at most %d headers allowed, got %d", maxExtraHeaders, len(names))
+	}
+
+	p.extraHeaders = make(map[string]string, len(names))
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, ": \t\r\n") {
+			return fmt.Errorf("sip: extra_headers[%d]: invalid header name %q", i, name)
+		}
+		lower := strings.ToLower(name)
+		p.extraHeaders[lower] = core.LabelSIPHeaderPrefix + strings.ReplaceAll(lower, "-", "_")
+	}
 	return nil
 }
 
@@ -82,6 +218,9 @@ func (p *SIPParser) Start(ctx context.Context) error {
 // Stop stops the parser.
 func (p *SIPParser) Stop(ctx context.Context) error {
 	p.sessionCache.Flush()
+	p.txCache.Flush()
+	p.wsConns.Flush()
+	p.wsStreams.Flush()
 	return nil
 }
 
@@ -91,7 +230,7 @@ func (p *SIPParser) SetFlowRegistry(registry plugin.FlowRegistry) {
 }
 
 // CanHandle checks if this packet is likely SIP.
-// Fast check: port 5060/5061 or SIP magic bytes.
+// Fast check: port 5060/5061, SIP magic bytes, or a WebSocket frame carrying SIP.
 func (p *SIPParser) CanHandle(pkt *core.DecodedPacket) bool {
 	// Check standard SIP ports
 	if pkt.Transport.SrcPort == 5060 || pkt.Transport.DstPort == 5060 ||
@@ -99,6 +238,10 @@ func (p *SIPParser) CanHandle(pkt *core.DecodedPacket) bool {
 		return true
 	}
 
+	if p.canHandleWebSocket(pkt) {
+		return true
+	}
+
 	// Check SIP magic in payload (fast prefix check, no regex)
 	if len(pkt.Payload) < 8 {
 		return false
@@ -122,6 +265,21 @@ func (p *SIPParser) CanHandle(pkt *core.DecodedPacket) bool {
 func (p *SIPParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
 	labels := make(core.Labels)
 
+	// SIP over WebSocket: replace the frames with the unmasked SIP messages
+	// so downstream consumers (RawPayload) see plain SIP text.
+	if sip, ok, err := p.readWebSocket(pkt); err != nil {
+		return nil, nil, err
+	} else if ok {
+		pkt.Payload = sip
+		labels[core.LabelSIPTransport] = transportWS
+	}
+
+	if p.filter != nil {
+		if reason, ignored := p.filter.ignores(pkt.Payload); ignored {
+			return nil, nil, fmt.Errorf("sip: %s: %w", reason, core.ErrIgnored)
+		}
+	}
+
 	// Parse SIP headers
 	sipMsg, err := p.parseSIPMessage(pkt.Payload)
 	if err != nil {
@@ -147,17 +305,117 @@ func (p *SIPParser) Handle(pkt *core.DecodedPacket) (any, core.Labels, error) {
 	if len(sipMsg.viaList) > 0 {
 		labels[core.LabelSIPVia] = strings.Join(sipMsg.viaList, ",")
 	}
+	if sipMsg.fromTag != "" {
+		labels[core.LabelSIPFromTag] = sipMsg.fromTag
+	}
+	if sipMsg.toTag != "" {
+		labels[core.LabelSIPToTag] = sipMsg.toTag
+	}
 
-	// Handle session state and flow registration
-	// BYE/CANCEL don't require SDP, but INVITE/200 OK do
-	if p.flowRegistry != nil {
-		p.handleSDP(sipMsg, pkt)
+	if len(sipMsg.warnings) > 0 {
+		labels[core.LabelSIPParseWarnings] = strings.Join(sipMsg.warnings, ",")
+		for _, w := range sipMsg.warnings {
+			metrics.SIPParseWarningsTotal.WithLabelValues(w).Inc()
+		}
+	}
+
+	if sipMsg.hasISUP {
+		labels[core.LabelSIPISUP] = "true"
+		if sipMsg.isupType != "" {
+			labels[core.LabelSIPISUPMessageType] = sipMsg.isupType
+		}
 	}
 
+	for key, value := range sipMsg.extra {
+		if v := sanitizeHeaderValue(value, p.maxHeaderValueLen); v != "" {
+			labels[key] = v
+		}
+	}
+
+	if p.detectRetransmissions {
+		p.trackRetransmission(sipMsg, pkt, labels)
+	}
+
+	// Dialog state, offer/answer and media flow registration
+	p.trackDialog(sipMsg, labels)
+
 	// No structured payload, only labels (raw payload in OutputPacket.RawPayload)
 	return nil, labels, nil
 }
 
+// trackRetransmission labels messages already seen within the retransmission
+// window. A transaction message is identified by the top Via branch (Call-ID
+// for RFC 2543 peers without a branch), CSeq, method or status code and the
+// sender address, so a retransmitted INVITE and its retransmitted 200 OK are
+// each counted on their own.
+func (p *SIPParser) trackRetransmission(msg *sipMessage, pkt *core.DecodedPacket, labels core.Labels) {
+	txID := ""
+	if len(msg.viaList) > 0 {
+		txID = viaBranch(msg.viaList[0])
+	}
+	if txID == "" {
+		txID = msg.callID
+	}
+	if txID == "" || msg.cseq == "" {
+		return
+	}
+
+	kind := msg.method
+	if kind == "" {
+		kind = strconv.Itoa(msg.statusCode)
+	}
+	peer := pkt.IP.SrcIP.String()
+	key := txID + "|" + msg.cseq + "|" + kind + "|" + peer + ":" + strconv.Itoa(int(pkt.Transport.SrcPort))
+
+	metrics.SIPMessagesTotal.WithLabelValues(peer).Inc()
+
+	if err := p.txCache.Add(key, 0, p.retransmissionWindow); err == nil {
+		return // first occurrence
+	}
+	count, err := p.txCache.IncrementInt(key, 1)
+	if err != nil {
+		return // expired between Add and Increment; treat as original
+	}
+
+	labels[core.LabelSIPRetransmission] = "true"
+	labels[core.LabelSIPRetransmissionCount] = strconv.Itoa(count)
+	metrics.SIPRetransmissionsTotal.WithLabelValues(peer).Inc()
+}
+
+// sanitizeHeaderValue makes an untrusted header value safe for use as a label:
+// invalid UTF-8 and control characters are dropped and the result is
+// truncated to maxLen bytes on a rune boundary.
+func sanitizeHeaderValue(value string, maxLen int) string {
+	var b strings.Builder
+	b.Grow(min(len(value), maxLen))
+	for _, r := range value {
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			continue
+		}
+		if b.Len()+utf8.RuneLen(r) > maxLen {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// viaBranch extracts the branch parameter from a Via header value.
+// Example: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776;rport → z9hG4bK776
+func viaBranch(via string) string {
+	// A single Via header may carry several comma-separated hops; use the topmost.
+	if comma := strings.IndexByte(via, ','); comma != -1 {
+		via = via[:comma]
+	}
+	for _, param := range strings.Split(via, ";") {
+		param = strings.TrimSpace(param)
+		if len(param) > 7 && strings.EqualFold(param[:7], "branch=") {
+			return param[7:]
+		}
+	}
+	return ""
+}
+
 // sipMessage represents parsed SIP message.
 type sipMessage struct {
 	method     string   // Request method (INVITE, BYE, etc.) or empty for response
@@ -165,15 +423,87 @@ type sipMessage struct {
 	callID     string   // Call-ID header
 	fromURI    string   // From header URI
 	toURI      string   // To header URI
+	fromTag    string   // From tag parameter
+	toTag      string   // To tag parameter
 	viaList    []string // Via headers (in order)
 	cseq       string   // CSeq header
 	sdp        *sdpInfo // Parsed SDP body (if Content-Type: application/sdp)
+
+	extra map[string]string // label key → raw value for configured extra_headers
+
+	contentType string // Content-Type header (full value incl. parameters)
+	hasISUP     bool   // Multipart body carries an application/isup part
+	isupType    string // Decoded ISUP message type (e.g. "IAM"), if enabled
+
+	contentLength int      // Content-Length header (0 if absent)
+	warnings      []string // Parse defects (warn* constants), in order found
+}
+
+// Parse warnings reported in sip.parse_warnings.
+const (
+	warnBareLF        = "bare_lf"        // lines terminated by LF instead of CRLF
+	warnNoHeaderEnd   = "no_header_end"  // header section not terminated by an empty line
+	warnTruncatedBody = "truncated_body" // fewer body bytes than Content-Length
+	warnBadFolding    = "bad_folding"    // continuation line without a preceding header
+	warnBadHeader     = "bad_header"     // header line without ':' or invalid value
+	warnInvalidUTF8   = "invalid_utf8"   // non-UTF-8 bytes in the header section
+	warnBadStartLine  = "bad_start_line" // malformed Request-Line or Status-Line
+)
+
+// warn records a parse warning once.
+func (m *sipMessage) warn(w string) {
+	for _, existing := range m.warnings {
+		if existing == w {
+			return
+		}
+	}
+	m.warnings = append(m.warnings, w)
+}
+
+// hasFatalWarning reports whether a warning other than the repairable
+// bare_lf / invalid_utf8 was recorded.
+func (m *sipMessage) hasFatalWarning() bool {
+	for _, w := range m.warnings {
+		if w != warnBareLF && w != warnInvalidUTF8 {
+			return true
+		}
+	}
+	return false
+}
+
+// isContinuation reports whether a header line is a folded continuation.
+func isContinuation(line []byte) bool {
+	return len(line) > 0 && (line[0] == ' ' || line[0] == '\t')
+}
+
+// isToken reports whether s is a non-empty SIP token (RFC 3261 §25.1),
+// as required for request methods.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("-.!%*_+`'~", c) != -1:
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 // parseSIPMessage parses SIP message headers and SDP body.
+//
+// Structural defects (bare LF line endings, unterminated headers, torn
+// bodies, bad folding, invalid UTF-8, malformed start lines) are recorded in
+// msg.warnings. Bare LF and invalid UTF-8 are repaired in place; other
+// defects are parsed around as far as possible, and the message is only
+// rejected when nothing SIP-like could be recovered, or in strict mode.
 func (p *SIPParser) parseSIPMessage(payload []byte) (*sipMessage, error) {
 	if len(payload) < 8 {
-		return nil, fmt.Errorf("payload too short")
+		return nil, fmt.Errorf("payload too short (%d bytes): %w", len(payload), core.ErrPacketTooShort)
 	}
 
 	msg := &sipMessage{
@@ -181,47 +511,67 @@ func (p *SIPParser) parseSIPMessage(payload []byte) (*sipMessage, error) {
 	}
 
 	// Split headers and body by \r\n\r\n or \n\n
-	headerEnd := bytes.Index(payload, []byte("\r\n\r\n"))
+	headerEnd, sepLen := bytes.Index(payload, []byte("\r\n\r\n")), 4
 	if headerEnd == -1 {
-		headerEnd = bytes.Index(payload, []byte("\n\n"))
+		headerEnd, sepLen = bytes.Index(payload, []byte("\n\n")), 2
 		if headerEnd == -1 {
-			headerEnd = len(payload) // No body
+			headerEnd, sepLen = len(payload), 0 // No body
+			msg.warn(warnNoHeaderEnd)
 		}
 	}
 
 	headerData := payload[:headerEnd]
+	if !utf8.Valid(headerData) {
+		msg.warn(warnInvalidUTF8)
+		headerData = bytes.ToValidUTF8(headerData, nil)
+	}
 	lines := bytes.Split(headerData, []byte("\n"))
-
-	// Parse first line (Request-Line or Status-Line)
-	if len(lines) == 0 {
-		return nil, fmt.Errorf("empty message")
+	for i, line := range lines {
+		// The last header line lost its line ending to the header/body split.
+		if i < len(lines)-1 && !bytes.HasSuffix(line, []byte("\r")) {
+			msg.warn(warnBareLF)
+			break
+		}
 	}
 
+	// Parse first line (Request-Line or Status-Line)
 	firstLine := string(bytes.TrimSpace(lines[0]))
 	if strings.HasPrefix(firstLine, "SIP/2.0 ") {
 		// Status-Line: SIP/2.0 200 OK
 		parts := strings.SplitN(firstLine, " ", 3)
-		if len(parts) >= 2 {
-			code, _ := strconv.Atoi(parts[1])
+		code, err := strconv.Atoi(parts[1])
+		if err != nil || code < 100 || code > 699 {
+			msg.warn(warnBadStartLine)
+		} else {
 			msg.statusCode = code
 		}
 	} else {
 		// Request-Line: INVITE sip:bob@example.com SIP/2.0
 		parts := strings.SplitN(firstLine, " ", 3)
-		if len(parts) >= 1 {
+		if len(parts) != 3 || parts[2] != "SIP/2.0" || !isToken(parts[0]) {
+			msg.warn(warnBadStartLine)
+		}
+		if isToken(parts[0]) {
 			msg.method = parts[0]
 		}
 	}
 
 	// Parse headers
 	for i := 1; i < len(lines); i++ {
+		if isContinuation(lines[i]) {
+			// Folded line without a preceding header (directly after the start line).
+			msg.warn(warnBadFolding)
+			continue
+		}
 		line := bytes.TrimSpace(lines[i])
 		if len(line) == 0 {
 			continue
 		}
 
-		// Header folding: lines starting with space/tab are continuations
-		for i+1 < len(lines) && (lines[i+1][0] == ' ' || lines[i+1][0] == '\t') {
+		// Header folding: lines starting with space/tab are continuations.
+		// Cap line first so appends copy instead of overwriting the payload.
+		line = line[:len(line):len(line)]
+		for i+1 < len(lines) && isContinuation(lines[i+1]) {
 			i++
 			line = append(line, ' ')
 			line = append(line, bytes.TrimSpace(lines[i])...)
@@ -229,6 +579,7 @@ func (p *SIPParser) parseSIPMessage(payload []byte) (*sipMessage, error) {
 
 		colonIdx := bytes.IndexByte(line, ':')
 		if colonIdx == -1 {
+			msg.warn(warnBadHeader)
 			continue
 		}
 
@@ -241,22 +592,63 @@ func (p *SIPParser) parseSIPMessage(payload []byte) (*sipMessage, error) {
 			msg.callID = value
 		case "from", "f":
 			msg.fromURI = extractURI(value)
+			msg.fromTag = headerTag(value)
 		case "to", "t":
 			msg.toURI = extractURI(value)
+			msg.toTag = headerTag(value)
 		case "via", "v":
 			msg.viaList = append(msg.viaList, value)
 		case "cseq":
 			msg.cseq = value
+		case "content-type", "c":
+			msg.contentType = value
+		case "content-length", "l":
+			if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+				msg.contentLength = n
+			} else {
+				msg.warn(warnBadHeader)
+			}
+		default:
+			if key, ok := p.extraHeaders[strings.ToLower(name)]; ok {
+				if msg.extra == nil {
+					msg.extra = make(map[string]string, len(p.extraHeaders))
+				}
+				if prev, dup := msg.extra[key]; dup {
+					value = prev + "," + value
+				}
+				msg.extra[key] = value
+			}
+		}
+	}
+
+	bodyStart := headerEnd + sepLen
+	if sepLen > 0 && len(payload)-bodyStart < msg.contentLength {
+		msg.warn(warnTruncatedBody)
+	}
+
+	if len(msg.warnings) > 0 {
+		if p.strict && msg.hasFatalWarning() {
+			return nil, fmt.Errorf("malformed message: %s", strings.Join(msg.warnings, ","))
+		}
+		if msg.method == "" && msg.statusCode == 0 && msg.callID == "" {
+			return nil, fmt.Errorf("no SIP content recovered: %s", strings.Join(msg.warnings, ","))
 		}
 	}
 
-	// Parse SDP body if present
-	bodyStart := headerEnd + 4 // skip \r\n\r\n
+	// Parse body if present: plain SDP or multipart (SIP-I: SDP + ISUP)
 	if bodyStart < len(payload) {
 		bodyData := payload[bodyStart:]
-		if bytes.Contains(headerData, []byte("application/sdp")) {
-			sdp, err := p.parseSDPBody(bodyData)
-			if err == nil {
+		mediaType, params, err := mime.ParseMediaType(msg.contentType)
+		switch {
+		case err == nil && mediaType == "application/sdp":
+			if sdp, err := p.parseSDPBody(bodyData); err == nil {
+				msg.sdp = sdp
+			}
+		case err == nil && strings.HasPrefix(mediaType, "multipart/"):
+			p.parseMultipartBody(msg, bodyData, params["boundary"])
+		case msg.contentType == "" && bytes.Contains(headerData, []byte("application/sdp")):
+			// Content-Type not recognised by name; keep the lenient legacy match.
+			if sdp, err := p.parseSDPBody(bodyData); err == nil {
 				msg.sdp = sdp
 			}
 		}
@@ -265,6 +657,73 @@ func (p *SIPParser) parseSIPMessage(payload []byte) (*sipMessage, error) {
 	return msg, nil
 }
 
+// parseMultipartBody walks a multipart body (RFC 5621), taking the first SDP
+// part as the session description and recording an encapsulated ISUP part
+// (SIP-I / SIP-T, ITU-T Q.1912.5).
+func (p *SIPParser) parseMultipartBody(msg *sipMessage, body []byte, boundary string) {
+	if boundary == "" {
+		return
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextRawPart()
+		if err != nil {
+			return // io.EOF or malformed multipart: keep what was parsed so far
+		}
+		data, err := io.ReadAll(io.LimitReader(part, int64(len(body))))
+		if err != nil {
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "application/sdp":
+			if msg.sdp == nil {
+				if sdp, err := p.parseSDPBody(data); err == nil {
+					msg.sdp = sdp
+				}
+			}
+		case "application/isup":
+			msg.hasISUP = true
+			if p.decodeISUP && len(data) > 0 {
+				msg.isupType = isupMessageType(data[0])
+			}
+		}
+	}
+}
+
+// isupMessageTypes maps ISUP message type codes (ITU-T Q.763 Table 4) to
+// their abbreviations for the messages commonly encapsulated in SIP-I.
+var isupMessageTypes = map[byte]string{
+	0x01: "IAM",
+	0x02: "SAM",
+	0x03: "INR",
+	0x04: "INF",
+	0x05: "COT",
+	0x06: "ACM",
+	0x07: "CON",
+	0x08: "FOT",
+	0x09: "ANM",
+	0x0C: "REL",
+	0x0D: "SUS",
+	0x0E: "RES",
+	0x10: "RLC",
+	0x2C: "CPG",
+}
+
+// isupMessageType returns the abbreviation for an ISUP message type code.
+// In SIP-I the ISUP body starts directly with the message type (no CIC).
+func isupMessageType(code byte) string {
+	if name, ok := isupMessageTypes[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", code)
+}
+
 // extractURI extracts URI from From/To header value.
 // Example: "Alice" <sip:alice@example.com>;tag=1234 → sip:alice@example.com
 func extractURI(value string) string {
@@ -292,6 +751,21 @@ func extractURI(value string) string {
 	return value[start+1 : start+end]
 }
 
+// headerTag returns the tag parameter of a From or To header value.
+// Example: "Bob" <sip:bob@example.com>;tag=a6c85cf → a6c85cf
+func headerTag(value string) string {
+	if end := strings.IndexByte(value, '>'); end != -1 {
+		value = value[end+1:]
+	}
+	for _, param := range strings.Split(value, ";")[1:] {
+		param = strings.TrimSpace(param)
+		if len(param) > 4 && strings.EqualFold(param[:4], "tag=") {
+			return param[4:]
+		}
+	}
+	return ""
+}
+
 // parseSDPBody parses SDP body (c=, m=, a= lines).
 func (p *SIPParser) parseSDPBody(body []byte) (*sdpInfo, error) {
 	sdp := &sdpInfo{
@@ -345,6 +819,7 @@ func (p *SIPParser) parseSDPBody(body []byte) (*sdpInfo, error) {
 
 			currentMedia = &mediaStream{
 				mediaType: parts[0],
+				proto:     parts[2],
 				rtpPort:   uint16(port),
 				rtcpPort:  uint16(port) + 1, // Default RTCP port
 				direction: "sendrecv",       // Default direction
@@ -373,12 +848,25 @@ func (p *SIPParser) parseSDPBody(body []byte) (*sdpInfo, error) {
 			}
 
 			// a=rtpmap:0 PCMU/8000 (only save first codec)
+			// a=rtpmap:101 telephone-event/8000
 			if strings.HasPrefix(value, "rtpmap:") {
-				if currentMedia.codec == "" {
-					parts := strings.SplitN(value[7:], " ", 2)
-					if len(parts) == 2 {
+				parts := strings.SplitN(value[7:], " ", 2)
+				if len(parts) == 2 {
+					if currentMedia.codec == "" {
 						currentMedia.codec = parts[1]
 					}
+					if encoding, _, _ := strings.Cut(parts[1], "/"); strings.EqualFold(encoding, "telephone-event") {
+						currentMedia.dtmfPTs = append(currentMedia.dtmfPTs, parts[0])
+					}
+				}
+				continue
+			}
+
+			// a=path:msrp://host:port/session;tcp (RFC 4975 §8.2)
+			if strings.HasPrefix(value, "path:") {
+				// Multi-hop paths list relays first; the last URI is the endpoint.
+				if uris := strings.Fields(value[5:]); len(uris) > 0 {
+					currentMedia.path = uris[len(uris)-1]
 				}
 				continue
 			}
@@ -425,75 +913,25 @@ func parseConnectionLine(value string) netip.Addr {
 	return ip
 }
 
-// handleSDP processes SDP based on SIP message type.
-func (p *SIPParser) handleSDP(sipMsg *sipMessage, pkt *core.DecodedPacket) {
-	if sipMsg.callID == "" {
-		return
-	}
-
-	// Determine SIP message type
-	isInvite := sipMsg.method == "INVITE"
-	is200OK := sipMsg.statusCode == 200 && strings.Contains(sipMsg.cseq, "INVITE")
-	isBye := sipMsg.method == "BYE"
-	isCancel := sipMsg.method == "CANCEL"
-
-	// Handle BYE/CANCEL (no SDP needed)
-	if isBye || isCancel {
-		p.cleanupFlows(sipMsg.callID)
-		p.sessionCache.Delete(sipMsg.callID)
-		return
-	}
-
-	// For INVITE and 200 OK, SDP is required
-	if sipMsg.sdp == nil {
-		return
-	}
-
-	switch {
-	case isInvite:
-		// Store offer SDP in session cache
-		session := &sipSession{
-			callID:    sipMsg.callID,
-			offerSDP:  sipMsg.sdp,
-			createdAt: time.Now(),
-		}
-		p.sessionCache.Set(sipMsg.callID, session, defaultSessionTTL)
-
-	case is200OK:
-		// Retrieve offer SDP and register bidirectional flows
-		if cached, found := p.sessionCache.Get(sipMsg.callID); found {
-			session := cached.(*sipSession)
-			session.answerSDP = sipMsg.sdp
-
-			// Register media flows
-			p.registerMediaFlows(session, pkt)
-		}
-	}
-}
-
-// registerMediaFlows registers RTP/RTCP flows to FlowRegistry.
-// Creates bidirectional FlowKeys for each media stream.
-func (p *SIPParser) registerMediaFlows(session *sipSession, pkt *core.DecodedPacket) {
-	if session.offerSDP == nil || session.answerSDP == nil {
-		return
-	}
-
-	offerBaseIP := session.offerSDP.connectionIP
-	answerBaseIP := session.answerSDP.connectionIP
+// registerMediaFlows registers the RTP/RTCP flows negotiated by an offer and
+// its answer to FlowRegistry and returns their keys. Creates bidirectional
+// FlowKeys for each media stream. Re-registering the same streams (183 →
+// 200 OK) overwrites the flow context with the new state.
+func (p *SIPParser) registerMediaFlows(callID string, offer, answer *sdpInfo, state string) []plugin.FlowKey {
+	offerBaseIP := offer.connectionIP
+	answerBaseIP := answer.connectionIP
 
 	if !offerBaseIP.IsValid() && !answerBaseIP.IsValid() {
-		return
+		return nil
 	}
 
 	// Match media streams by index (audio/video order should match)
-	maxStreams := len(session.offerSDP.mediaStreams)
-	if len(session.answerSDP.mediaStreams) < maxStreams {
-		maxStreams = len(session.answerSDP.mediaStreams)
-	}
+	maxStreams := min(len(offer.mediaStreams), len(answer.mediaStreams))
 
+	var keys []plugin.FlowKey
 	for i := 0; i < maxStreams; i++ {
-		offerMedia := session.offerSDP.mediaStreams[i]
-		answerMedia := session.answerSDP.mediaStreams[i]
+		offerMedia := offer.mediaStreams[i]
+		answerMedia := answer.mediaStreams[i]
 
 		// Per-media c= overrides session-level c= (RFC 4566 §5.7)
 		offerIP := offerMedia.connectionIP
@@ -509,33 +947,62 @@ func (p *SIPParser) registerMediaFlows(session *sipSession, pkt *core.DecodedPac
 			continue
 		}
 
-		// Register RTP flows
-		p.registerBidirectionalFlow(
+		// MSRP sessions run over TCP to the a=path listener, not RTP.
+		if isMSRP(offerMedia) {
+			for _, side := range []struct {
+				ip netip.Addr
+				m  mediaStream
+			}{{offerIP, offerMedia}, {answerIP, answerMedia}} {
+				if key, ok := p.registerMSRPEndpoint(side.ip, side.m, callID, state); ok {
+					keys = append(keys, key)
+				}
+			}
+			continue
+		}
+
+		// A stream rejected with port 0 (RFC 3264 §6) carries no media.
+		if offerMedia.rtpPort == 0 || answerMedia.rtpPort == 0 {
+			continue
+		}
+
+		// Register RTP flows. Each side sends telephone-events with the
+		// payload type the other side declared, so both sets apply.
+		keys = append(keys, p.registerBidirectionalFlow(
 			offerIP, answerIP,
 			offerMedia.rtpPort, answerMedia.rtpPort,
-			session.callID, offerMedia.codec,
-		)
+			callID, offerMedia.codec, state,
+			dtmfPayloadTypes(offerMedia, answerMedia),
+		)...)
 
 		// Register RTCP flows (if not muxed)
 		if !offerMedia.rtcpMux && !answerMedia.rtcpMux {
-			p.registerBidirectionalFlow(
+			keys = append(keys, p.registerBidirectionalFlow(
 				offerIP, answerIP,
 				offerMedia.rtcpPort, answerMedia.rtcpPort,
-				session.callID, "RTCP",
-			)
+				callID, "RTCP", state, "",
+			)...)
 		}
 	}
+	return keys
 }
 
-// registerBidirectionalFlow registers two FlowKeys (A→B and B→A).
+// registerBidirectionalFlow registers one plugin.Flow under both FlowKeys
+// (A→B and B→A), with A→B, the offerer's side, as the forward direction.
+// A stream registered again, e.g. on 200 OK or a re-INVITE, keeps its
+// direction and statistics. dtmfPTs, if not empty, is the comma-separated
+// telephone-event payload types of the stream. It returns both keys.
 func (p *SIPParser) registerBidirectionalFlow(
 	ipA, ipB netip.Addr,
 	portA, portB uint16,
-	callID, codec string,
-) {
+	callID, codec, state, dtmfPTs string,
+) []plugin.FlowKey {
 	flowContext := map[string]string{
-		"call_id": callID,
-		"codec":   codec,
+		"call_id":     callID,
+		"codec":       codec,
+		"media_state": state,
+	}
+	if dtmfPTs != "" {
+		flowContext["telephone_event"] = dtmfPTs
 	}
 
 	// Flow A → B
@@ -546,17 +1013,91 @@ func (p *SIPParser) registerBidirectionalFlow(
 		DstPort: portB,
 		Proto:   17, // UDP
 	}
-	p.flowRegistry.Set(keyAtoB, flowContext)
-
 	// Flow B → A
-	keyBtoA := plugin.FlowKey{
-		SrcIP:   ipB,
-		DstIP:   ipA,
-		SrcPort: portB,
-		DstPort: portA,
-		Proto:   17, // UDP
+	keyBtoA := keyAtoB.Reverse()
+
+	flow := plugin.NewFlow(keyAtoB, flowContext)
+	if v, ok := p.flowRegistry.Get(keyAtoB); ok {
+		if prev, ok := v.(*plugin.Flow); ok && (prev.IsForward(keyAtoB) || prev.IsForward(keyBtoA)) {
+			flow = prev.WithContext(flowContext)
+		}
+	}
+	p.flowRegistry.Set(keyAtoB, flow)
+	p.flowRegistry.Set(keyBtoA, flow)
+	return []plugin.FlowKey{keyAtoB, keyBtoA}
+}
+
+// dtmfPayloadTypes returns the telephone-event payload types declared by
+// either side of a media stream, comma-separated and without duplicates.
+func dtmfPayloadTypes(offer, answer mediaStream) string {
+	pts := slices.Clone(offer.dtmfPTs)
+	for _, pt := range answer.dtmfPTs {
+		if !slices.Contains(pts, pt) {
+			pts = append(pts, pt)
+		}
+	}
+	return strings.Join(pts, ",")
+}
+
+// isMSRP reports whether an m= line negotiates an MSRP session
+// (m=message <port> TCP/MSRP or TCP/TLS/MSRP).
+func isMSRP(m mediaStream) bool {
+	return m.mediaType == "message" && strings.HasSuffix(m.proto, "/MSRP")
+}
+
+// registerMSRPEndpoint registers the MSRP listener of one side of a session.
+// The connecting side uses an ephemeral port, so the FlowKey has no source:
+// the MSRP parser matches packets to or from the listener endpoint.
+// The a=path URI is authoritative for the endpoint when its host is an IP.
+// It returns the key registered, false if the endpoint has no port.
+func (p *SIPParser) registerMSRPEndpoint(ip netip.Addr, m mediaStream, callID, state string) (plugin.FlowKey, bool) {
+	port := m.rtpPort
+	if host, pathPort, ok := msrpPathEndpoint(m.path); ok {
+		if addr, err := netip.ParseAddr(host); err == nil {
+			ip = addr
+		}
+		port = pathPort
+	}
+	if port == 0 {
+		return plugin.FlowKey{}, false
+	}
+
+	key := plugin.FlowKey{DstIP: ip, DstPort: port, Proto: 6}
+	p.flowRegistry.Set(key, plugin.NewFlow(key, map[string]string{
+		"call_id":     callID,
+		"codec":       "MSRP",
+		"media_state": state,
+		"msrp_path":   m.path,
+	}))
+	return key, true
+}
+
+// msrpPathEndpoint extracts host and port from an MSRP URI.
+// Example: msrp://10.0.0.1:7394/jshA7we;tcp → 10.0.0.1, 7394
+func msrpPathEndpoint(uri string) (string, uint16, bool) {
+	rest, ok := strings.CutPrefix(uri, "msrps://")
+	if !ok {
+		if rest, ok = strings.CutPrefix(uri, "msrp://"); !ok {
+			return "", 0, false
+		}
+	}
+	if slash := strings.IndexByte(rest, '/'); slash != -1 {
+		rest = rest[:slash]
+	}
+	ap, err := netip.ParseAddrPort(rest)
+	if err == nil {
+		return ap.Addr().String(), ap.Port(), true
+	}
+	// Hostname authority: keep the port, caller falls back to the SDP c= address.
+	colon := strings.LastIndexByte(rest, ':')
+	if colon == -1 {
+		return "", 0, false
+	}
+	port, err := strconv.ParseUint(rest[colon+1:], 10, 16)
+	if err != nil {
+		return "", 0, false
 	}
-	p.flowRegistry.Set(keyBtoA, flowContext)
+	return rest[:colon], uint16(port), true
 }
 
 // cleanupFlows removes flows associated with a call from FlowRegistry.
@@ -567,7 +1108,7 @@ func (p *SIPParser) cleanupFlows(callID string) {
 
 	// Iterate FlowRegistry and delete matching flows
 	p.flowRegistry.Range(func(key plugin.FlowKey, value any) bool {
-		if ctx, ok := value.(map[string]string); ok {
+		if ctx, ok := plugin.FlowContext(value); ok {
 			if ctx["call_id"] == callID {
 				p.flowRegistry.Delete(key)
 			}
@@ -3,6 +3,7 @@ package sip
 import (
 	"context"
 	"net/netip"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -795,6 +796,541 @@ func TestMultiChannelMediaStreams(t *testing.T) {
 	}
 }
 
+func TestEarlyMediaFlows(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	registry := newMockFlowRegistry()
+	parser.SetFlowRegistry(registry)
+
+	sdp := func(ip string, port int) string {
+		return "v=0\r\n" +
+			"c=IN IP4 " + ip + "\r\n" +
+			"t=0 0\r\n" +
+			"m=audio " + strconv.Itoa(port) + " RTP/AVP 0\r\n" +
+			"a=rtpmap:0 PCMU/8000\r\n" +
+			"a=rtcp-mux\r\n"
+	}
+	msg := func(firstLine, body string) *core.DecodedPacket {
+		return &core.DecodedPacket{
+			Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+			Payload: []byte(firstLine + "\r\n" +
+				"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK-early\r\n" +
+				"Call-ID: early-call@example.com\r\n" +
+				"CSeq: 1 INVITE\r\n" +
+				"Content-Type: application/sdp\r\n" +
+				"\r\n" + body),
+		}
+	}
+
+	parser.Handle(msg("INVITE sip:bob@example.com SIP/2.0", sdp("10.0.0.1", 30000)))
+	parser.Handle(msg("SIP/2.0 183 Session Progress", sdp("10.0.0.2", 40000)))
+
+	key := plugin.FlowKey{
+		SrcIP:   netip.MustParseAddr("10.0.0.2"),
+		DstIP:   netip.MustParseAddr("10.0.0.1"),
+		SrcPort: 40000,
+		DstPort: 30000,
+		Proto:   17,
+	}
+	val, ok := registry.Get(key)
+	if !ok {
+		t.Fatal("early media flow not registered on 183")
+	}
+	flow := val.(*plugin.Flow)
+	if ctx := flow.Context; ctx["call_id"] != "early-call@example.com" || ctx["media_state"] != "early" {
+		t.Errorf("flow context after 183 = %v, want early media for call", ctx)
+	}
+	// Both directions share one Flow; the offerer's side is forward.
+	if back, _ := registry.Get(key.Reverse()); back != val {
+		t.Error("directions of the stream are not the same Flow")
+	}
+	if flow.IsForward(key) || !flow.IsForward(key.Reverse()) {
+		t.Errorf("forward key = %+v, want the offerer's side", flow.Key)
+	}
+	flow.Observe(key, 160, time.Now())
+
+	// 200 OK without SDP confirms the early answer.
+	parser.Handle(&core.DecodedPacket{
+		Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+		Payload: []byte("SIP/2.0 200 OK\r\n" +
+			"Call-ID: early-call@example.com\r\n" +
+			"CSeq: 1 INVITE\r\n" +
+			"\r\n"),
+	})
+	val, _ = registry.Get(key)
+	flow = val.(*plugin.Flow)
+	if got := flow.Context["media_state"]; got != "confirmed" {
+		t.Errorf("media_state after 200 OK = %q, want confirmed", got)
+	}
+	if stats := flow.Stats(); stats.Reverse.Packets != 1 || stats.Forward.Packets != 0 {
+		t.Errorf("stats after 200 OK = %+v, want the early media packet kept", stats)
+	}
+}
+
+func TestTelephoneEventFlows(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	registry := newMockFlowRegistry()
+	parser.SetFlowRegistry(registry)
+
+	sdp := func(ip string, port int, rtpmaps string) string {
+		return "v=0\r\n" +
+			"c=IN IP4 " + ip + "\r\n" +
+			"t=0 0\r\n" +
+			"m=audio " + strconv.Itoa(port) + " RTP/AVP 0 101 96\r\n" +
+			"a=rtpmap:0 PCMU/8000\r\n" + rtpmaps
+	}
+	msg := func(firstLine, body string) *core.DecodedPacket {
+		return &core.DecodedPacket{
+			Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+			Payload: []byte(firstLine + "\r\n" +
+				"Call-ID: dtmf-call@example.com\r\n" +
+				"CSeq: 1 INVITE\r\n" +
+				"Content-Type: application/sdp\r\n" +
+				"\r\n" + body),
+		}
+	}
+
+	// The answerer declares another payload type for the same event
+	parser.Handle(msg("INVITE sip:ivr@example.com SIP/2.0", sdp("10.0.0.1", 30000,
+		"a=rtpmap:101 telephone-event/8000\r\na=fmtp:101 0-16\r\n")))
+	parser.Handle(msg("SIP/2.0 200 OK", sdp("10.0.0.2", 40000,
+		"a=rtpmap:96 TELEPHONE-EVENT/8000\r\na=rtpmap:101 telephone-event/8000\r\n")))
+
+	rtp := plugin.FlowKey{SrcIP: netip.MustParseAddr("10.0.0.1"), DstIP: netip.MustParseAddr("10.0.0.2"), SrcPort: 30000, DstPort: 40000, Proto: 17}
+	val, ok := registry.Get(rtp)
+	if !ok {
+		t.Fatal("RTP flow not registered")
+	}
+	ctx := val.(*plugin.Flow).Context
+	if ctx["telephone_event"] != "101,96" || ctx["codec"] != "PCMU/8000" {
+		t.Errorf("RTP flow context = %v, want telephone_event 101,96", ctx)
+	}
+
+	rtcp := plugin.FlowKey{SrcIP: rtp.SrcIP, DstIP: rtp.DstIP, SrcPort: 30001, DstPort: 40001, Proto: 17}
+	val, _ = registry.Get(rtcp)
+	if _, ok := val.(*plugin.Flow).Context["telephone_event"]; ok {
+		t.Error("RTCP flow has telephone_event")
+	}
+}
+
+func TestMSRPEndpointRegistration(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	registry := newMockFlowRegistry()
+	parser.SetFlowRegistry(registry)
+
+	sdp := func(ip, path string) string {
+		return "v=0\r\n" +
+			"c=IN IP4 " + ip + "\r\n" +
+			"t=0 0\r\n" +
+			"m=message 7394 TCP/MSRP *\r\n" +
+			"a=accept-types:text/plain\r\n" +
+			"a=path:" + path + "\r\n"
+	}
+	msg := func(firstLine, body string) *core.DecodedPacket {
+		return &core.DecodedPacket{
+			Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+			Payload: []byte(firstLine + "\r\n" +
+				"Call-ID: im-call@example.com\r\n" +
+				"CSeq: 1 INVITE\r\n" +
+				"Content-Type: application/sdp\r\n" +
+				"\r\n" + body),
+		}
+	}
+
+	parser.Handle(msg("INVITE sip:bob@example.com SIP/2.0",
+		sdp("10.0.0.1", "msrp://10.0.0.1:7654/jshA7weztas;tcp")))
+	// Answerer's path names a hostname: port from path, address from c=.
+	parser.Handle(msg("SIP/2.0 200 OK",
+		sdp("10.0.0.2", "msrp://bob.example.com:12763/kjhd37s2s20w2a;tcp")))
+
+	for _, key := range []plugin.FlowKey{
+		{DstIP: netip.MustParseAddr("10.0.0.1"), DstPort: 7654, Proto: 6},
+		{DstIP: netip.MustParseAddr("10.0.0.2"), DstPort: 12763, Proto: 6},
+	} {
+		val, ok := registry.Get(key)
+		if !ok {
+			t.Fatalf("MSRP endpoint %v not registered", key)
+		}
+		if ctx := val.(*plugin.Flow).Context; ctx["call_id"] != "im-call@example.com" || ctx["codec"] != "MSRP" {
+			t.Errorf("flow context = %v", ctx)
+		}
+	}
+	if registry.Count() != 2 {
+		t.Errorf("registered %d flows, want 2 (no RTP flows for m=message)", registry.Count())
+	}
+}
+
+func TestRetransmissionDetection(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+
+	invite := []byte("INVITE sip:bob@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 192.168.1.100:5060;branch=z9hG4bK-retx-1\r\n" +
+		"Call-ID: retx-call@example.com\r\n" +
+		"From: <sip:alice@example.com>;tag=1\r\n" +
+		"To: <sip:bob@example.com>\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"\r\n")
+	pkt := &core.DecodedPacket{
+		IP:        core.IPHeader{SrcIP: netip.MustParseAddr("192.168.1.100"), DstIP: netip.MustParseAddr("192.168.1.200")},
+		Transport: core.TransportHeader{SrcPort: 5060, DstPort: 5060},
+		Payload:   invite,
+	}
+
+	_, labels, err := parser.Handle(pkt)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if _, ok := labels[core.LabelSIPRetransmission]; ok {
+		t.Error("first INVITE must not be labeled as retransmission")
+	}
+
+	for want := 1; want <= 2; want++ {
+		_, labels, err = parser.Handle(pkt)
+		if err != nil {
+			t.Fatalf("Handle failed: %v", err)
+		}
+		if labels[core.LabelSIPRetransmission] != "true" {
+			t.Fatalf("retransmission %d not labeled", want)
+		}
+		if got := labels[core.LabelSIPRetransmissionCount]; got != strconv.Itoa(want) {
+			t.Errorf("retransmission_count = %q, want %d", got, want)
+		}
+	}
+
+	// A new transaction (different branch, CSeq) is not a retransmission.
+	reinvite := []byte(strings.Replace(strings.Replace(string(invite),
+		"z9hG4bK-retx-1", "z9hG4bK-retx-2", 1), "CSeq: 1 INVITE", "CSeq: 2 INVITE", 1))
+	_, labels, _ = parser.Handle(&core.DecodedPacket{IP: pkt.IP, Transport: pkt.Transport, Payload: reinvite})
+	if _, ok := labels[core.LabelSIPRetransmission]; ok {
+		t.Error("new transaction must not be labeled as retransmission")
+	}
+
+	// The response to the INVITE is tracked independently of the request.
+	resp := []byte("SIP/2.0 100 Trying\r\n" +
+		"Via: SIP/2.0/UDP 192.168.1.100:5060;branch=z9hG4bK-retx-1\r\n" +
+		"Call-ID: retx-call@example.com\r\n" +
+		"CSeq: 1 INVITE\r\n" +
+		"\r\n")
+	_, labels, _ = parser.Handle(&core.DecodedPacket{IP: pkt.IP, Transport: pkt.Transport, Payload: resp})
+	if _, ok := labels[core.LabelSIPRetransmission]; ok {
+		t.Error("first response must not be labeled as retransmission")
+	}
+}
+
+func TestRetransmissionConfig(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(map[string]any{"detect_retransmissions": false}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	payload := []byte("OPTIONS sip:bob@example.com SIP/2.0\r\n" +
+		"Via: SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK-opt\r\n" +
+		"Call-ID: opt@example.com\r\n" +
+		"CSeq: 1 OPTIONS\r\n" +
+		"\r\n")
+	pkt := &core.DecodedPacket{Payload: payload}
+	parser.Handle(pkt)
+	_, labels, _ := parser.Handle(pkt)
+	if _, ok := labels[core.LabelSIPRetransmission]; ok {
+		t.Error("retransmission labeled with detection disabled")
+	}
+
+	if err := NewSIPParser().Init(map[string]any{"retransmission_window": "bogus"}); err == nil {
+		t.Error("expected error for invalid retransmission_window")
+	}
+}
+
+func TestExtraHeaders(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	err := parser.Init(map[string]any{
+		"extra_headers":        []any{"P-Asserted-Identity", "X-Customer-ID", "X-Long"},
+		"max_header_value_len": float64(16),
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	payload := []byte("INVITE sip:bob@example.com SIP/2.0\r\n" +
+		"Call-ID: hdr-call@example.com\r\n" +
+		"p-asserted-identity: <sip:+1234@x>\r\n" +
+		"P-Asserted-Identity: <tel:+1234>\r\n" +
+		"X-Customer-ID: cust\x01-42\xff\r\n" +
+		"X-Long: 0123456789abcdefXYZ\r\n" +
+		"X-Other: ignored\r\n" +
+		"\r\n")
+
+	_, labels, err := parser.Handle(&core.DecodedPacket{Payload: payload})
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+
+	if got := labels["sip.header.p_asserted_identity"]; got != "<sip:+1234@x>,<t" {
+		t.Errorf("P-Asserted-Identity label = %q", got)
+	}
+	if got := labels["sip.header.x_customer_id"]; got != "cust-42" {
+		t.Errorf("X-Customer-ID label = %q, want sanitized cust-42", got)
+	}
+	if got := labels["sip.header.x_long"]; got != "0123456789abcdef" {
+		t.Errorf("X-Long label = %q, want truncated to 16 bytes", got)
+	}
+	if _, ok := labels["sip.header.x_other"]; ok {
+		t.Error("unconfigured header must not be exported")
+	}
+}
+
+func TestExtraHeaders_InvalidConfig(t *testing.T) {
+	tests := []map[string]any{
+		{"extra_headers": "X-Foo"},
+		{"extra_headers": []any{"X Foo"}},
+		{"extra_headers": []any{42}},
+		{"max_header_value_len": float64(0)},
+	}
+	for _, cfg := range tests {
+		if err := NewSIPParser().Init(cfg); err == nil {
+			t.Errorf("Init(%v) expected error", cfg)
+		}
+	}
+}
+
+func TestSanitizeHeaderValue(t *testing.T) {
+	if got := sanitizeHeaderValue("héllo wörld", 7); got != "héllo" {
+		t.Errorf("rune-safe truncation = %q, want héllo", got)
+	}
+	if got := sanitizeHeaderValue("a\tb\x00c", 64); got != "abc" {
+		t.Errorf("control stripping = %q, want abc", got)
+	}
+}
+
+func TestMultipartSIPIBody(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	registry := newMockFlowRegistry()
+	parser.SetFlowRegistry(registry)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	body := "--unique-boundary-1\r\n" +
+		"Content-Type: application/sdp\r\n" +
+		"\r\n" +
+		"v=0\r\n" +
+		"o=- 1 1 IN IP4 10.0.0.1\r\n" +
+		"s=-\r\n" +
+		"c=IN IP4 10.0.0.1\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 20000 RTP/AVP 8\r\n" +
+		"a=rtpmap:8 PCMA/8000\r\n" +
+		"\r\n" +
+		"--unique-boundary-1\r\n" +
+		"Content-Type: application/ISUP; version=itu-t92+\r\n" +
+		"Content-Disposition: signal; handling=optional\r\n" +
+		"\r\n" +
+		"\x01\x00\x20\x00\x0a\x03\x02\r\n" +
+		"--unique-boundary-1--\r\n"
+
+	payload := []byte("INVITE sip:+8613800138000@example.com SIP/2.0\r\n" +
+		"Call-ID: sipi-call@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=unique-boundary-1\r\n" +
+		"\r\n" + body)
+
+	_, labels, err := parser.Handle(&core.DecodedPacket{Payload: payload})
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if labels[core.LabelSIPISUP] != "true" {
+		t.Errorf("sip.isup = %q, want true", labels[core.LabelSIPISUP])
+	}
+	if got := labels[core.LabelSIPISUPMessageType]; got != "IAM" {
+		t.Errorf("sip.isup_message_type = %q, want IAM", got)
+	}
+
+	msg, err := parser.parseSIPMessage(payload)
+	if err != nil {
+		t.Fatalf("parseSIPMessage failed: %v", err)
+	}
+	if msg.sdp == nil || len(msg.sdp.mediaStreams) != 1 || msg.sdp.mediaStreams[0].rtpPort != 20000 {
+		t.Fatalf("SDP part not parsed from multipart body: %+v", msg.sdp)
+	}
+
+	// Decoding disabled: presence only.
+	parser = NewSIPParser().(*SIPParser)
+	if err := parser.Init(map[string]any{"decode_isup": false}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	_, labels, _ = parser.Handle(&core.DecodedPacket{Payload: payload})
+	if labels[core.LabelSIPISUP] != "true" {
+		t.Error("expected sip.isup with decoding disabled")
+	}
+	if _, ok := labels[core.LabelSIPISUPMessageType]; ok {
+		t.Error("unexpected sip.isup_message_type with decode_isup=false")
+	}
+}
+
+// malformedCorpus holds compact-form and malformed SIP messages seen from
+// real-world peers and torn captures.
+var malformedCorpus = []struct {
+	name     string
+	payload  string
+	strictOK bool   // accepted in strict mode
+	warnings string // expected sip.parse_warnings ("" = none)
+	callID   string // expected sip.call_id ("" = not checked)
+}{
+	{
+		name: "compact form",
+		payload: "INVITE sip:bob@example.com SIP/2.0\r\n" +
+			"v: SIP/2.0/UDP 10.0.0.1;branch=z9hG4bKc1\r\n" +
+			"i: compact@example.com\r\n" +
+			"f: <sip:alice@example.com>;tag=1\r\n" +
+			"t: <sip:bob@example.com>\r\n" +
+			"CSeq: 1 INVITE\r\n" +
+			"l: 0\r\n" +
+			"\r\n",
+		strictOK: true,
+		callID:   "compact@example.com",
+	},
+	{
+		name: "bare LF line endings",
+		payload: "BYE sip:bob@example.com SIP/2.0\n" +
+			"Call-ID: lf@example.com\n" +
+			"CSeq: 2 BYE\n" +
+			"\n",
+		strictOK: true,
+		warnings: "bare_lf",
+		callID:   "lf@example.com",
+	},
+	{
+		name: "non-UTF8 header bytes",
+		payload: "OPTIONS sip:bob@example.com SIP/2.0\r\n" +
+			"Call-ID: utf8\xc3\x28@example.com\r\n" +
+			"\r\n",
+		strictOK: true,
+		warnings: "invalid_utf8",
+		callID:   "utf8(@example.com",
+	},
+	{
+		name: "torn packet without header end",
+		payload: "INVITE sip:bob@example.com SIP/2.0\r\n" +
+			"Call-ID: torn@example.com\r\n" +
+			"From: <sip:alice@exa",
+		warnings: "no_header_end",
+		callID:   "torn@example.com",
+	},
+	{
+		name: "truncated body",
+		payload: "INVITE sip:bob@example.com SIP/2.0\r\n" +
+			"Call-ID: short@example.com\r\n" +
+			"Content-Type: application/sdp\r\n" +
+			"Content-Length: 200\r\n" +
+			"\r\n" +
+			"v=0\r\n",
+		warnings: "truncated_body",
+		callID:   "short@example.com",
+	},
+	{
+		name: "folding after start line",
+		payload: "INVITE sip:bob@example.com SIP/2.0\r\n" +
+			"  stray continuation\r\n" +
+			"Call-ID: fold@example.com\r\n" +
+			"Subject: multi\r\n" +
+			"\t line\r\n" +
+			"\r\n",
+		warnings: "bad_folding",
+		callID:   "fold@example.com",
+	},
+	{
+		name: "header without colon",
+		payload: "INVITE sip:bob@example.com SIP/2.0\r\n" +
+			"Call-ID: colon@example.com\r\n" +
+			"Garbage header line\r\n" +
+			"\r\n",
+		warnings: "bad_header",
+		callID:   "colon@example.com",
+	},
+	{
+		name: "bad status code",
+		payload: "SIP/2.0 2OO OK\r\n" +
+			"Call-ID: status@example.com\r\n" +
+			"\r\n",
+		warnings: "bad_start_line",
+		callID:   "status@example.com",
+	},
+	{
+		name: "several defects",
+		payload: "INVITE sip:bob@example.com\n" +
+			"Call-ID: multi@example.com\n" +
+			"Via SIP/2.0/UDP 10.0.0.1\n",
+		warnings: "no_header_end,bare_lf,bad_start_line,bad_header",
+		callID:   "multi@example.com",
+	},
+}
+
+func TestMalformedCorpus(t *testing.T) {
+	strict := NewSIPParser().(*SIPParser)
+	if err := strict.Init(map[string]any{"strict": true}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	lenient := NewSIPParser().(*SIPParser)
+	if err := lenient.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	for _, tc := range malformedCorpus {
+		t.Run(tc.name, func(t *testing.T) {
+			pkt := &core.DecodedPacket{Payload: []byte(tc.payload)}
+
+			_, _, err := strict.Handle(pkt)
+			if tc.strictOK && err != nil {
+				t.Errorf("strict: unexpected error: %v", err)
+			}
+			if !tc.strictOK && err == nil {
+				t.Error("strict: expected malformed message to be rejected")
+			}
+
+			_, labels, err := lenient.Handle(pkt)
+			if err != nil {
+				t.Fatalf("lenient: unexpected error: %v", err)
+			}
+			if got := labels[core.LabelSIPParseWarnings]; got != tc.warnings {
+				t.Errorf("sip.parse_warnings = %q, want %q", got, tc.warnings)
+			}
+			if tc.callID != "" && labels[core.LabelSIPCallID] != tc.callID {
+				t.Errorf("sip.call_id = %q, want %q", labels[core.LabelSIPCallID], tc.callID)
+			}
+		})
+	}
+}
+
+func TestMalformedRejectsGarbage(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	if _, _, err := parser.Handle(&core.DecodedPacket{Payload: []byte("\x00\x01 binary junk\n\n")}); err == nil {
+		t.Error("expected error when no SIP content can be recovered")
+	}
+}
+
+func TestIsupMessageType(t *testing.T) {
+	tests := map[byte]string{0x01: "IAM", 0x06: "ACM", 0x09: "ANM", 0x0C: "REL", 0x10: "RLC", 0x2F: "0x2F"}
+	for code, want := range tests {
+		if got := isupMessageType(code); got != want {
+			t.Errorf("isupMessageType(0x%02X) = %q, want %q", code, got, want)
+		}
+	}
+}
+
+func TestViaBranch(t *testing.T) {
+	tests := map[string]string{
+		"SIP/2.0/UDP 10.0.0.1:5060;branch=z9hG4bK776;rport":                     "z9hG4bK776",
+		"SIP/2.0/UDP 10.0.0.1:5060;rport;Branch=z9hG4bKabc":                     "z9hG4bKabc",
+		"SIP/2.0/UDP a:5060;branch=z9hG4bKtop, SIP/2.0/UDP b;branch=z9hG4bKlow": "z9hG4bKtop",
+		"SIP/2.0/UDP 10.0.0.1:5060":                                             "",
+	}
+	for via, want := range tests {
+		if got := viaBranch(via); got != want {
+			t.Errorf("viaBranch(%q) = %q, want %q", via, got, want)
+		}
+	}
+}
+
 func BenchmarkCanHandle(b *testing.B) {
 	parser := NewSIPParser().(*SIPParser)
 	pkt := &core.DecodedPacket{
@@ -0,0 +1,398 @@
+package sip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// SIP over WebSocket (RFC 7118), as sent by WebRTC gateways.
+//
+// Connections are recognised either by an observed HTTP upgrade negotiating
+// the "sip" subprotocol or, for captures that start mid-connection, by the
+// configured WebSocket ports. Client frames are masked (RFC 6455 §5.3) and
+// are unmasked before parsing. WSS (TLS) payloads cannot be decoded here
+// unless the task decrypts them (tls_decryption).
+//
+// Framing is tracked per direction of a connection: frames split across TCP
+// segments, several frames in one segment and messages fragmented into
+// continuation frames are reassembled; control frames are skipped.
+
+const (
+	// defaultWSConnTTL bounds how long an upgraded connection is remembered
+	// without traffic.
+	defaultWSConnTTL = time.Hour
+
+	// wsStreamTTL bounds how long a partly received message is kept.
+	wsStreamTTL = time.Minute
+
+	// maxWSMessageSize bounds the bytes buffered per direction for a frame
+	// or fragmented message that spans segments.
+	maxWSMessageSize = 64 << 10
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8 // first control opcode
+
+	transportWS = "ws"
+)
+
+// defaultWebSocketPorts are common SIP-over-WebSocket listeners: HTTP(S),
+// the Kamailio/OpenSIPS convention 5066 and the Asterisk HTTP server 8088.
+var defaultWebSocketPorts = []uint16{80, 443, 5066, 8088}
+
+// sipPrefixes are the start-line prefixes accepted as SIP (same set as CanHandle).
+var sipPrefixes = [][]byte{
+	[]byte("SIP/2.0 "), []byte("INVITE "), []byte("REGISTER"), []byte("BYE "),
+	[]byte("CANCEL "), []byte("ACK "), []byte("OPTIONS "), []byte("SUBSCRI"),
+	[]byte("NOTIFY "),
+}
+
+// initWebSocketPorts parses the websocket_ports list.
+func (p *SIPParser) initWebSocketPorts(v any) error {
+	if v == nil {
+		return nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("sip: websocket_ports must be a list of ports")
+	}
+	ports := make(map[uint16]struct{}, len(list))
+	for i, item := range list {
+		n, ok := item.(float64)
+		if !ok || n < 1 || n > 65535 || n != float64(int(n)) {
+			return fmt.Errorf("sip: websocket_ports[%d]: invalid port %v", i, item)
+		}
+		ports[uint16(n)] = struct{}{}
+	}
+	p.wsPorts = ports
+	return nil
+}
+
+// canHandleWebSocket reports whether pkt is a WebSocket frame carrying SIP,
+// or continues one received earlier on its connection. HTTP upgrade
+// handshakes negotiating the "sip" subprotocol are remembered for the
+// connection but are not themselves handled.
+func (p *SIPParser) canHandleWebSocket(pkt *core.DecodedPacket) bool {
+	if _, ok := p.wsStreams.Get(wsStreamKey(pkt)); ok {
+		return true
+	}
+
+	payload := pkt.Payload
+	if len(payload) < 2 {
+		return false
+	}
+
+	if isSIPWebSocketUpgrade(payload) {
+		p.wsConns.Set(wsConnKey(pkt), struct{}{}, defaultWSConnTTL)
+		return false
+	}
+
+	if !isWSDataFrameStart(payload[0]) {
+		return false
+	}
+	if !p.isWebSocketPort(pkt) {
+		if _, known := p.wsConns.Get(wsConnKey(pkt)); !known {
+			return false
+		}
+	}
+
+	var head [8]byte
+	n := unmaskWSFrame(payload, head[:])
+	return n > 0 && hasSIPPrefix(head[:n])
+}
+
+// wsStream is the framing state of one direction of a WebSocket connection
+// between segments.
+type wsStream struct {
+	seq     uint32 // TCP sequence number of the last segment consumed
+	pending []byte // start of a frame continued in a later segment
+	message []byte // unmasked payload of the message being assembled
+	open    bool   // message is a usable text/binary message awaiting FIN
+}
+
+// errWSIncomplete is returned when a segment completes no message; the
+// packet is dropped (core.ErrIgnored) and the message is emitted with the
+// segment that completes it.
+var errWSIncomplete = fmt.Errorf("sip: websocket message continues in a later segment: %w", core.ErrIgnored)
+
+// readWebSocket returns the SIP messages completed by pkt, a segment of a
+// WebSocket connection carrying SIP, concatenated. ok is false if pkt is not
+// WebSocket; err is errWSIncomplete if it completes no message.
+func (p *SIPParser) readWebSocket(pkt *core.DecodedPacket) (sip []byte, ok bool, err error) {
+	if pkt.CaptureLen < pkt.OrigLen {
+		// Truncated by the snap length: later bytes are missing anyway, so
+		// decode what was captured of the first frame.
+		sip, ok = unwrapWebSocket(pkt.Payload)
+		return sip, ok, nil
+	}
+
+	key := wsStreamKey(pkt)
+	payload := pkt.Payload
+	var st *wsStream
+	if v, found := p.wsStreams.Get(key); found {
+		st = v.(*wsStream)
+		if pkt.Transport.SeqNum == st.seq {
+			return nil, true, errWSIncomplete // retransmission of a consumed segment
+		}
+		if startsSIPFrame(payload) {
+			st = nil // the rest of the previous frame was lost
+		}
+	}
+	if st == nil {
+		if !startsSIPFrame(payload) {
+			return nil, false, nil
+		}
+		st = &wsStream{}
+	}
+
+	data := payload
+	if len(st.pending) > 0 {
+		data = append(st.pending, payload...)
+		st.pending = nil
+	}
+	for len(data) > 0 {
+		hdrLen, length, complete := wsFrameSize(data)
+		if !complete {
+			break
+		}
+		if hdrLen+length > maxWSMessageSize {
+			p.wsStreams.Delete(key)
+			return nil, true, fmt.Errorf("sip: websocket frame of %d bytes exceeds %d", length, maxWSMessageSize)
+		}
+		if len(data) < hdrLen+length {
+			break
+		}
+		sip = append(sip, st.consume(data[:hdrLen+length])...)
+		data = data[hdrLen+length:]
+	}
+
+	if len(data) > 0 || st.open {
+		st.pending = append([]byte(nil), data...)
+		st.seq = pkt.Transport.SeqNum
+		p.wsStreams.Set(key, st, wsStreamTTL)
+	} else {
+		p.wsStreams.Delete(key)
+	}
+	if len(sip) == 0 {
+		return nil, true, errWSIncomplete
+	}
+	return sip, true, nil
+}
+
+// consume applies one complete frame and returns the SIP message it
+// completes, if any.
+func (st *wsStream) consume(frame []byte) []byte {
+	b0 := frame[0]
+	switch op := b0 & 0x0F; {
+	case op >= wsOpClose:
+		return nil // control frames may be interleaved with fragments
+	case op == wsOpText || op == wsOpBinary:
+		st.message = st.message[:0]
+		st.open = b0&0x70 == 0 // compressed (RSV1) messages cannot be parsed
+	case op == wsOpContinuation && st.open:
+	default:
+		st.open = false // continuation without a start, or reserved opcode
+	}
+	if !st.open {
+		return nil
+	}
+
+	start := len(st.message)
+	_, length, _ := wsFrameHeader(frame)
+	st.message = append(st.message, make([]byte, length)...)
+	unmaskWSFrame(frame, st.message[start:])
+	if len(st.message) > maxWSMessageSize {
+		st.message, st.open = nil, false
+		return nil
+	}
+	if b0&0x80 == 0 {
+		return nil // FIN not set: more fragments follow
+	}
+
+	st.open = false
+	if !hasSIPPrefix(st.message) {
+		return nil
+	}
+	return st.message
+}
+
+// startsSIPFrame reports whether b starts with a text/binary frame whose
+// payload starts like SIP.
+func startsSIPFrame(b []byte) bool {
+	if len(b) < 2 || !isWSDataFrameStart(b[0]) {
+		return false
+	}
+	var head [8]byte
+	n := unmaskWSFrame(b, head[:])
+	return n > 0 && hasSIPPrefix(head[:n])
+}
+
+// unwrapWebSocket returns the unmasked SIP message carried by a WebSocket
+// frame, or false if payload is not a text/binary frame carrying SIP.
+func unwrapWebSocket(payload []byte) ([]byte, bool) {
+	if len(payload) < 2 || !isWSDataFrameStart(payload[0]) {
+		return nil, false
+	}
+	_, length, ok := wsFrameHeader(payload)
+	if !ok {
+		return nil, false
+	}
+	out := make([]byte, length)
+	out = out[:unmaskWSFrame(payload, out)]
+	if !hasSIPPrefix(out) {
+		return nil, false
+	}
+	return out, true
+}
+
+// isWSDataFrameStart checks the first frame byte: no RSV bits (compressed
+// frames cannot be parsed), text or binary opcode. FIN is clear when the
+// message continues in continuation frames.
+func isWSDataFrameStart(b byte) bool {
+	op := b & 0x0F
+	return b&0x70 == 0 && (op == wsOpText || op == wsOpBinary)
+}
+
+// wsFrameSize returns the header and payload length of the frame starting
+// at b; complete is false if b does not hold the whole header.
+func wsFrameSize(b []byte) (hdrLen, length int, complete bool) {
+	if len(b) < 2 {
+		return 0, 0, false
+	}
+	plen := uint64(b[1] & 0x7F)
+	hdrLen = 2
+	switch plen {
+	case 126:
+		if len(b) < 4 {
+			return 0, 0, false
+		}
+		plen = uint64(binary.BigEndian.Uint16(b[2:4]))
+		hdrLen = 4
+	case 127:
+		if len(b) < 10 {
+			return 0, 0, false
+		}
+		plen = binary.BigEndian.Uint64(b[2:10])
+		hdrLen = 10
+	}
+	if b[1]&0x80 != 0 {
+		hdrLen += 4
+	}
+	if plen > maxWSMessageSize {
+		plen = maxWSMessageSize + 1 // callers only compare against the limit
+	}
+	return hdrLen, int(plen), len(b) >= hdrLen
+}
+
+// wsFrameHeader returns the header length and the payload length available
+// in b (truncated to the captured bytes).
+func wsFrameHeader(b []byte) (hdrLen int, length int, ok bool) {
+	masked := b[1]&0x80 != 0
+	plen := uint64(b[1] & 0x7F)
+	hdrLen = 2
+
+	switch plen {
+	case 126:
+		if len(b) < 4 {
+			return 0, 0, false
+		}
+		plen = uint64(binary.BigEndian.Uint16(b[2:4]))
+		hdrLen = 4
+	case 127:
+		if len(b) < 10 {
+			return 0, 0, false
+		}
+		plen = binary.BigEndian.Uint64(b[2:10])
+		hdrLen = 10
+	}
+	if masked {
+		hdrLen += 4
+	}
+	if len(b) < hdrLen {
+		return 0, 0, false
+	}
+
+	avail := uint64(len(b) - hdrLen)
+	if plen > avail {
+		plen = avail // torn frame: decode what was captured
+	}
+	return hdrLen, int(plen), true
+}
+
+// unmaskWSFrame copies up to len(dst) payload bytes of frame b into dst,
+// applying the masking key if present, and returns the number copied.
+func unmaskWSFrame(b []byte, dst []byte) int {
+	hdrLen, length, ok := wsFrameHeader(b)
+	if !ok {
+		return 0
+	}
+	n := copy(dst, b[hdrLen:hdrLen+length])
+	if b[1]&0x80 != 0 {
+		key := b[hdrLen-4 : hdrLen]
+		for i := 0; i < n; i++ {
+			dst[i] ^= key[i%4]
+		}
+	}
+	return n
+}
+
+// isSIPWebSocketUpgrade detects the HTTP upgrade request or 101 response of a
+// WebSocket handshake negotiating the "sip" subprotocol (RFC 7118 §4).
+func isSIPWebSocketUpgrade(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte("GET ")) && !bytes.HasPrefix(b, []byte("HTTP/1.1 101")) {
+		return false
+	}
+	headerEnd := bytes.Index(b, []byte("\r\n\r\n"))
+	if headerEnd == -1 {
+		headerEnd = len(b)
+	}
+	for _, line := range bytes.Split(b[:headerEnd], []byte("\r\n")) {
+		colon := bytes.IndexByte(line, ':')
+		if colon == -1 || !bytes.EqualFold(bytes.TrimSpace(line[:colon]), []byte("Sec-WebSocket-Protocol")) {
+			continue
+		}
+		for _, proto := range bytes.Split(line[colon+1:], []byte(",")) {
+			if bytes.EqualFold(bytes.TrimSpace(proto), []byte("sip")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasSIPPrefix(b []byte) bool {
+	for _, prefix := range sipPrefixes {
+		if bytes.HasPrefix(b, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *SIPParser) isWebSocketPort(pkt *core.DecodedPacket) bool {
+	_, src := p.wsPorts[pkt.Transport.SrcPort]
+	_, dst := p.wsPorts[pkt.Transport.DstPort]
+	return src || dst
+}
+
+// wsStreamKey identifies one direction of a connection.
+func wsStreamKey(pkt *core.DecodedPacket) string {
+	return netip.AddrPortFrom(pkt.IP.SrcIP, pkt.Transport.SrcPort).String() + ">" +
+		netip.AddrPortFrom(pkt.IP.DstIP, pkt.Transport.DstPort).String()
+}
+
+// wsConnKey identifies a connection independent of direction.
+func wsConnKey(pkt *core.DecodedPacket) string {
+	a := netip.AddrPortFrom(pkt.IP.SrcIP, pkt.Transport.SrcPort)
+	b := netip.AddrPortFrom(pkt.IP.DstIP, pkt.Transport.DstPort)
+	if b.Compare(a) < 0 {
+		a, b = b, a
+	}
+	return a.String() + "-" + b.String()
+}
@@ -0,0 +1,274 @@
+package sip
+
+import (
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// wsFrame builds a single-frame WebSocket text message, masked as clients must.
+func wsFrame(payload []byte, mask bool) []byte {
+	frame := []byte{0x80 | wsOpText}
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	default:
+		frame = append(frame, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	}
+	if !mask {
+		return append(frame, payload...)
+	}
+	key := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, key...)
+	for i, b := range payload {
+		frame = append(frame, b^key[i%4])
+	}
+	return frame
+}
+
+func wsPacket(payload []byte, srcPort, dstPort uint16) *core.DecodedPacket {
+	return &core.DecodedPacket{
+		IP: core.IPHeader{
+			SrcIP: netip.MustParseAddr("10.0.0.1"),
+			DstIP: netip.MustParseAddr("10.0.0.2"),
+		},
+		Transport: core.TransportHeader{SrcPort: srcPort, DstPort: dstPort, Protocol: 6},
+		Payload:   payload,
+	}
+}
+
+// reversed swaps the IP addresses of a packet built by wsPacket.
+func reversed(pkt *core.DecodedPacket) *core.DecodedPacket {
+	pkt.IP.SrcIP, pkt.IP.DstIP = pkt.IP.DstIP, pkt.IP.SrcIP
+	return pkt
+}
+
+const wsSIPMessage = "REGISTER sip:example.com SIP/2.0\r\n" +
+	"Via: SIP/2.0/WSS df7jal23ls0d.invalid;branch=z9hG4bKasudf\r\n" +
+	"From: <sip:alice@example.com>;tag=65bnmj.34asd\r\n" +
+	"To: <sip:alice@example.com>\r\n" +
+	"Call-ID: aiuy7k9njasd@example.com\r\n" +
+	"CSeq: 1 REGISTER\r\n" +
+	"Contact: <sip:alice@df7jal23ls0d.invalid;transport=ws>\r\n" +
+	"\r\n"
+
+func TestWebSocket_MaskedFrameOnWSPort(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	pkt := wsPacket(wsFrame([]byte(wsSIPMessage), true), 50000, 8088)
+	if !parser.CanHandle(pkt) {
+		t.Fatal("CanHandle() = false for masked SIP frame on port 8088")
+	}
+
+	_, labels, err := parser.Handle(pkt)
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if labels[core.LabelSIPTransport] != "ws" {
+		t.Errorf("sip.transport = %q, want ws", labels[core.LabelSIPTransport])
+	}
+	if labels[core.LabelSIPCallID] != "aiuy7k9njasd@example.com" || labels[core.LabelSIPMethod] != "REGISTER" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+	if string(pkt.Payload) != wsSIPMessage {
+		t.Error("payload not replaced with unmasked SIP message")
+	}
+}
+
+func TestWebSocket_UpgradeOnCustomPort(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(map[string]any{"websocket_ports": []any{}}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// Server → client frame (unmasked, 16-bit length) before any upgrade: unknown connection.
+	frame := wsFrame([]byte(wsSIPMessage), false)
+	if parser.CanHandle(reversed(wsPacket(frame, 9000, 50000))) {
+		t.Fatal("frame on unknown connection and non-WS port must not be handled")
+	}
+
+	upgrade := []byte("GET /ws HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Protocol: sip\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"\r\n")
+	if parser.CanHandle(wsPacket(upgrade, 50000, 9000)) {
+		t.Error("upgrade request itself must not be handled")
+	}
+
+	// Reverse direction of the upgraded connection.
+	pkt := reversed(wsPacket(frame, 9000, 50000))
+	if !parser.CanHandle(pkt) {
+		t.Fatal("CanHandle() = false for frame on upgraded connection")
+	}
+	if _, labels, err := parser.Handle(pkt); err != nil || labels[core.LabelSIPTransport] != "ws" {
+		t.Errorf("Handle() = (%v, %v)", labels, err)
+	}
+}
+
+func TestWebSocket_NonSIPFrames(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	if parser.CanHandle(wsPacket(wsFrame([]byte(`{"type":"ping"}`), true), 50000, 80)) {
+		t.Error("non-SIP WebSocket frame must not be handled")
+	}
+	if parser.CanHandle(wsPacket([]byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01}, 50000, 443)) {
+		t.Error("TLS record must not be handled")
+	}
+	if _, ok := unwrapWebSocket([]byte{0x81}); ok {
+		t.Error("unwrapWebSocket accepted a 1-byte frame")
+	}
+}
+
+// segment returns a packet of the client → server direction at seq.
+func segment(payload []byte, seq uint32) *core.DecodedPacket {
+	pkt := wsPacket(payload, 50000, 8088)
+	pkt.Transport.SeqNum = seq
+	return pkt
+}
+
+// handleSegment offers pkt to parser like the pipeline does.
+func handleSegment(t *testing.T, parser *SIPParser, pkt *core.DecodedPacket) (core.Labels, error) {
+	t.Helper()
+	if !parser.CanHandle(pkt) {
+		t.Fatalf("CanHandle() = false for segment at seq %d", pkt.Transport.SeqNum)
+	}
+	_, labels, err := parser.Handle(pkt)
+	return labels, err
+}
+
+func TestWebSocket_FrameSplitAcrossSegments(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	frame := wsFrame([]byte(wsSIPMessage), true)
+	first, second := frame[:40], frame[40:]
+	if _, err := handleSegment(t, parser, segment(first, 1000)); !errors.Is(err, core.ErrIgnored) {
+		t.Fatalf("first part: err = %v, want ErrIgnored", err)
+	}
+	// A retransmission of the first part is not buffered twice
+	if _, err := handleSegment(t, parser, segment(first, 1000)); !errors.Is(err, core.ErrIgnored) {
+		t.Fatalf("retransmitted part: err = %v, want ErrIgnored", err)
+	}
+
+	pkt := segment(second, 1040)
+	labels, err := handleSegment(t, parser, pkt)
+	if err != nil {
+		t.Fatalf("second part: %v", err)
+	}
+	if labels[core.LabelSIPCallID] != "aiuy7k9njasd@example.com" || labels[core.LabelSIPTransport] != "ws" {
+		t.Errorf("unexpected labels: %v", labels)
+	}
+	if string(pkt.Payload) != wsSIPMessage {
+		t.Errorf("payload = %q", pkt.Payload)
+	}
+	if parser.wsStreams.ItemCount() != 0 {
+		t.Error("stream state kept after the message completed")
+	}
+}
+
+func TestWebSocket_FragmentedMessage(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// Text frame without FIN, a ping, then the final continuation frame
+	msg := []byte(wsSIPMessage)
+	start := wsFrame(msg[:100], true)
+	start[0] &^= 0x80
+	ping := wsFrame(nil, true)
+	ping[0] = 0x80 | 0x9
+	end := wsFrame(msg[100:], true)
+	end[0] = 0x80 | wsOpContinuation
+
+	if _, err := handleSegment(t, parser, segment(start, 1)); !errors.Is(err, core.ErrIgnored) {
+		t.Fatalf("first fragment: err = %v, want ErrIgnored", err)
+	}
+	pkt := segment(append(append([]byte(nil), ping...), end...), uint32(1+len(start)))
+	labels, err := handleSegment(t, parser, pkt)
+	if err != nil {
+		t.Fatalf("last fragment: %v", err)
+	}
+	if labels[core.LabelSIPMethod] != "REGISTER" || string(pkt.Payload) != wsSIPMessage {
+		t.Errorf("labels %v, payload %q", labels, pkt.Payload)
+	}
+}
+
+func TestWebSocket_SeveralFramesPerSegment(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// Two messages and the start of a third
+	frame := wsFrame([]byte(wsSIPMessage), true)
+	data := append(append(append([]byte(nil), frame...), frame...), frame[:10]...)
+	pkt := segment(data, 1)
+	if _, err := handleSegment(t, parser, pkt); err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+	if string(pkt.Payload) != wsSIPMessage+wsSIPMessage {
+		t.Errorf("payload = %q, want both messages", pkt.Payload)
+	}
+
+	pkt = segment(frame[10:], uint32(1+len(data)))
+	if _, err := handleSegment(t, parser, pkt); err != nil || string(pkt.Payload) != wsSIPMessage {
+		t.Errorf("third message: payload %q, err %v", pkt.Payload, err)
+	}
+}
+
+func TestWebSocket_LostSegment(t *testing.T) {
+	parser := NewSIPParser().(*SIPParser)
+	if err := parser.Init(nil); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	frame := wsFrame([]byte(wsSIPMessage), true)
+	if _, err := handleSegment(t, parser, segment(frame[:40], 1)); !errors.Is(err, core.ErrIgnored) {
+		t.Fatalf("err = %v, want ErrIgnored", err)
+	}
+	// The rest of the frame never arrives; the next frame starts afresh
+	pkt := segment(frame, 500)
+	if _, err := handleSegment(t, parser, pkt); err != nil || string(pkt.Payload) != wsSIPMessage {
+		t.Errorf("payload %q, err %v", pkt.Payload, err)
+	}
+
+	// Frames larger than the buffer limit are rejected
+	huge := []byte{0x81, 127, 0, 0, 0, 0, 0, 0x10, 0, 0}
+	huge = append(huge, "INVITE sip:bob@example.com SIP/2.0\r\n"...)
+	if _, err := handleSegment(t, parser, segment(huge, 9000)); err == nil || errors.Is(err, core.ErrIgnored) {
+		t.Errorf("oversized frame: err = %v", err)
+	}
+}
+
+func TestWebSocket_InvalidPortsConfig(t *testing.T) {
+	for _, cfg := range []map[string]any{
+		{"websocket_ports": "8088"},
+		{"websocket_ports": []any{float64(0)}},
+		{"websocket_ports": []any{"8088"}},
+	} {
+		if err := NewSIPParser().Init(cfg); err == nil {
+			t.Errorf("Init(%v) expected error", cfg)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package callsample implements the per-call sampling processor. A call is
+// selected or not by a hash of its SIP Call-ID, so every packet of a
+// selected call is kept: its SIP messages (sip.call_id) and the RTP, RTCP
+// and MSRP of the media flows the SIP parser registered for it in the
+// FlowRegistry (rtp.call_id, rtcp.call_id, msrp.call_id). Packets of other
+// calls are dropped and only counted into per-window summaries.
+//
+// The decision needs no state shared between pipelines, tasks or agents:
+// every processor configured with the same rate and seed selects the same
+// calls, including when SIP and media are captured by different agents.
+package callsample
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultWindow = time.Minute
+
+	// PayloadType of summary packets.
+	PayloadType = "call_sample"
+)
+
+// callIDLabels are the labels carrying the Call-ID of a call's packets, by
+// payload type.
+var callIDLabels = map[string]string{
+	"sip":  core.LabelSIPCallID,
+	"rtp":  core.LabelRTPCallID,
+	"rtcp": core.LabelRTCPCallID,
+	"msrp": core.LabelMSRPCallID,
+}
+
+// Summary is the payload of a summary packet: the traffic of the calls that
+// were not selected in one window.
+type Summary struct {
+	WindowStart    time.Time         `json:"window_start"`
+	WindowEnd      time.Time         `json:"window_end"`
+	Rate           float64           `json:"rate"`
+	SampledCalls   int               `json:"sampled_calls"`
+	DroppedCalls   int               `json:"dropped_calls"`
+	Packets        map[string]uint64 `json:"packets"` // by payload type
+	Bytes          map[string]uint64 `json:"bytes"`   // application payload bytes, by payload type
+	DroppedPackets uint64            `json:"dropped_packets"`
+}
+
+// Processor keeps the packets of selected calls.
+type Processor struct {
+	name string
+
+	rate      float64
+	threshold uint64 // hash values below it are selected
+	all       bool   // rate 1: every call is selected
+	seed      string
+	window    time.Duration
+
+	windows map[time.Time]*window // open windows by start
+}
+
+// window holds the counts of one summary window.
+type window struct {
+	start      time.Time
+	taskID     string
+	agentID    string
+	pipelineID int
+	sampled    map[string]struct{} // Call-IDs
+	dropped    map[string]struct{}
+	packets    map[string]uint64
+	bytes      map[string]uint64
+	total      uint64
+}
+
+// NewProcessor creates a new call sampling processor.
+func NewProcessor() plugin.Processor {
+	return &Processor{
+		name:    "callsample",
+		window:  defaultWindow,
+		windows: make(map[time.Time]*window),
+	}
+}
+
+// Name returns the plugin name.
+func (p *Processor) Name() string {
+	return p.name
+}
+
+// Init initializes the processor with configuration.
+//
+// Supported keys:
+//   - rate (float, required): fraction of calls kept, 0 to 1
+//   - seed (string, default ""): mixed into the hash; processors with the
+//     same rate and seed select the same calls
+//   - window (string, default "1m"): summary window, a Go duration
+func (p *Processor) Init(config map[string]any) error {
+	rate, ok := config["rate"].(float64)
+	if !ok || rate < 0 || rate > 1 {
+		return fmt.Errorf("callsample: rate must be a number between 0 and 1, got %v", config["rate"])
+	}
+	p.rate = rate
+	p.all = rate == 1
+	p.threshold = uint64(rate * math.MaxUint64)
+	p.seed, _ = config["seed"].(string)
+
+	if v, ok := config["window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("callsample: window must be a duration of at least 1s, got %q", v)
+		}
+		p.window = d
+	}
+	return nil
+}
+
+// Start starts the processor.
+func (p *Processor) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Selected reports whether the call is kept.
+func (p *Processor) Selected(callID string) bool {
+	if p.all {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(p.seed))
+	h.Write([]byte{0})
+	h.Write([]byte(callID))
+	return h.Sum64() < p.threshold
+}
+
+// Process keeps the packets of selected calls and counts the others.
+// Packets without a Call-ID, e.g. media of flows no SIP dialog registered,
+// pass unchanged.
+func (p *Processor) Process(pkt *core.OutputPacket) bool {
+	label, ok := callIDLabels[pkt.PayloadType]
+	if !ok {
+		return true
+	}
+	callID := pkt.Labels[label]
+	if callID == "" {
+		return true
+	}
+
+	w := p.windowOf(pkt)
+	if p.Selected(callID) {
+		w.sampled[callID] = struct{}{}
+		return true
+	}
+	w.dropped[callID] = struct{}{}
+	w.packets[pkt.PayloadType]++
+	w.bytes[pkt.PayloadType] += uint64(len(pkt.RawPayload))
+	w.total++
+	return false
+}
+
+// windowOf returns the window of the packet's timestamp, opening it if needed.
+func (p *Processor) windowOf(pkt *core.OutputPacket) *window {
+	ts := pkt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	start := ts.Truncate(p.window)
+	w, ok := p.windows[start]
+	if !ok {
+		w = &window{
+			start:      start,
+			taskID:     pkt.TaskID,
+			agentID:    pkt.AgentID,
+			pipelineID: pkt.PipelineID,
+			sampled:    make(map[string]struct{}),
+			dropped:    make(map[string]struct{}),
+			packets:    make(map[string]uint64),
+			bytes:      make(map[string]uint64),
+		}
+		p.windows[start] = w
+	}
+	return w
+}
+
+// Flush releases one summary packet for every window that ended by now, or
+// for all windows when final is set.
+func (p *Processor) Flush(now time.Time, final bool) []core.OutputPacket {
+	var closed []*window
+	for start, w := range p.windows {
+		if final || !start.Add(p.window).After(now) {
+			closed = append(closed, w)
+			delete(p.windows, start)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].start.Before(closed[j].start) })
+
+	out := make([]core.OutputPacket, 0, len(closed))
+	for _, w := range closed {
+		out = append(out, p.summary(w))
+	}
+	return out
+}
+
+// summary builds the summary packet of one window.
+func (p *Processor) summary(w *window) core.OutputPacket {
+	labels := core.Labels{
+		core.LabelCallSampleWindow:         p.window.String(),
+		core.LabelCallSampleRate:           strconv.FormatFloat(p.rate, 'f', -1, 64),
+		core.LabelCallSampleSampledCalls:   strconv.Itoa(len(w.sampled)),
+		core.LabelCallSampleDroppedCalls:   strconv.Itoa(len(w.dropped)),
+		core.LabelCallSampleDroppedPackets: strconv.FormatUint(w.total, 10),
+	}
+	return core.OutputPacket{
+		TaskID:      w.taskID,
+		AgentID:     w.agentID,
+		PipelineID:  w.pipelineID,
+		Timestamp:   w.start,
+		PayloadType: PayloadType,
+		Labels:      labels,
+		Payload: &Summary{
+			WindowStart:    w.start,
+			WindowEnd:      w.start.Add(p.window),
+			Rate:           p.rate,
+			SampledCalls:   len(w.sampled),
+			DroppedCalls:   len(w.dropped),
+			Packets:        w.packets,
+			Bytes:          w.bytes,
+			DroppedPackets: w.total,
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package callsample
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func newTestProcessor(t *testing.T, cfg map[string]any) *Processor {
+	t.Helper()
+	p := NewProcessor().(*Processor)
+	if err := p.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return p
+}
+
+func callPacket(ts time.Time, payloadType, callID string) *core.OutputPacket {
+	return &core.OutputPacket{
+		TaskID:      "sample-task",
+		Timestamp:   ts,
+		PayloadType: payloadType,
+		Labels:      core.Labels{callIDLabels[payloadType]: callID},
+		RawPayload:  make([]byte, 100),
+	}
+}
+
+// callIDs returns a call selected and a call not selected by p.
+func callIDs(t *testing.T, p *Processor) (selected, dropped string) {
+	t.Helper()
+	for i := 0; selected == "" || dropped == ""; i++ {
+		if i == 1000 {
+			t.Fatal("no selected and dropped call among 1000 Call-IDs")
+		}
+		id := fmt.Sprintf("call-%d@example.com", i)
+		if p.Selected(id) {
+			selected = id
+		} else {
+			dropped = id
+		}
+	}
+	return selected, dropped
+}
+
+func TestProcessor_KeepsWholeCall(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{"rate": 0.5})
+	kept, dropped := callIDs(t, p)
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, pt := range []string{"sip", "rtp", "rtcp", "msrp"} {
+		if !p.Process(callPacket(base, pt, kept)) {
+			t.Errorf("%s packet of the selected call dropped", pt)
+		}
+		if p.Process(callPacket(base, pt, dropped)) {
+			t.Errorf("%s packet of the unselected call kept", pt)
+		}
+	}
+	p.Process(callPacket(base.Add(time.Second), "rtp", dropped))
+
+	// Uncorrelated media and other payload types pass unchanged.
+	if !p.Process(&core.OutputPacket{PayloadType: "rtp", Labels: core.Labels{}}) {
+		t.Error("RTP without call-id dropped")
+	}
+	if !p.Process(&core.OutputPacket{PayloadType: "alert"}) {
+		t.Error("alert dropped")
+	}
+
+	out := p.Flush(base.Add(time.Minute), false)
+	if len(out) != 1 {
+		t.Fatalf("Flush = %d packets, want 1", len(out))
+	}
+	sum := out[0]
+	if sum.PayloadType != PayloadType || sum.TaskID != "sample-task" || !sum.Timestamp.Equal(base) {
+		t.Errorf("summary envelope = %+v", sum)
+	}
+	if sum.Labels[core.LabelCallSampleSampledCalls] != "1" || sum.Labels[core.LabelCallSampleDroppedCalls] != "1" ||
+		sum.Labels[core.LabelCallSampleDroppedPackets] != "5" || sum.Labels[core.LabelCallSampleRate] != "0.5" {
+		t.Errorf("summary labels = %v", sum.Labels)
+	}
+	s := sum.Payload.(*Summary)
+	if s.Packets["rtp"] != 2 || s.Packets["sip"] != 1 || s.Bytes["rtp"] != 200 || !s.WindowEnd.Equal(base.Add(time.Minute)) {
+		t.Errorf("summary payload = %+v", s)
+	}
+	if len(p.windows) != 0 {
+		t.Errorf("%d windows left after flush", len(p.windows))
+	}
+}
+
+func TestProcessor_ConsistentSelection(t *testing.T) {
+	a := newTestProcessor(t, map[string]any{"rate": 0.1, "seed": "dc1"})
+	b := newTestProcessor(t, map[string]any{"rate": 0.1, "seed": "dc1"})
+	other := newTestProcessor(t, map[string]any{"rate": 0.1, "seed": "dc2"})
+
+	var selected, differ int
+	for i := range 10000 {
+		id := fmt.Sprintf("%08x-call@10.0.0.1", i)
+		if a.Selected(id) != b.Selected(id) {
+			t.Fatalf("Selected(%q) differs between processors with the same seed", id)
+		}
+		if a.Selected(id) {
+			selected++
+		}
+		if a.Selected(id) != other.Selected(id) {
+			differ++
+		}
+	}
+	if selected < 900 || selected > 1100 {
+		t.Errorf("selected %d of 10000 calls at rate 0.1", selected)
+	}
+	if differ == 0 {
+		t.Error("seed does not change the selection")
+	}
+}
+
+func TestProcessor_RateBounds(t *testing.T) {
+	all := newTestProcessor(t, map[string]any{"rate": float64(1)})
+	none := newTestProcessor(t, map[string]any{"rate": float64(0)})
+	for i := range 100 {
+		id := fmt.Sprintf("call-%d", i)
+		if !all.Selected(id) || none.Selected(id) {
+			t.Fatalf("call %q: rate 1 selected %v, rate 0 selected %v", id, all.Selected(id), none.Selected(id))
+		}
+	}
+}
+
+func TestProcessor_InitErrors(t *testing.T) {
+	for _, cfg := range []map[string]any{
+		{},
+		{"rate": 1.5},
+		{"rate": "0.1"},
+		{"rate": 0.1, "window": "100ms"},
+	} {
+		if err := NewProcessor().Init(cfg); err == nil {
+			t.Errorf("Init(%v) succeeded, want error", cfg)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Package cardinality implements the label cardinality guard processor.
+// Labels with unbounded values, such as Call-IDs or Via branch parameters,
+// can blow up the indexes of downstream stores. The guard counts the distinct
+// values of configured labels per window (default one minute); once a label
+// has max_values of them, new values in the rest of the window are hashed
+// into a fixed number of buckets, or the label is dropped. Values already
+// seen in the window pass unchanged, so ongoing calls keep their labels.
+//
+// Counting is per pipeline: a task of n pipelines passes at most
+// n × max_values distinct values of a label per window.
+package cardinality
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultWindow      = time.Minute
+	defaultMaxValues   = 10000
+	defaultHashBuckets = 1024
+
+	// hashPrefix marks hashed values, so they cannot be mistaken for
+	// real ones.
+	hashPrefix = "~"
+)
+
+// Actions on values over the limit.
+const (
+	ActionHash = "hash"
+	ActionDrop = "drop"
+)
+
+// Processor bounds the distinct values of labels per window.
+type Processor struct {
+	name   string
+	taskID string
+
+	labels  []string
+	max     int
+	window  time.Duration
+	action  string
+	buckets uint32
+
+	start  time.Time                      // start of the current window
+	seen   map[string]map[string]struct{} // label → distinct values this window
+	warned map[string]bool                // labels over the limit this window, logged
+}
+
+// NewProcessor creates a new cardinality guard processor.
+func NewProcessor() plugin.Processor {
+	return &Processor{
+		name:    "cardinality",
+		max:     defaultMaxValues,
+		window:  defaultWindow,
+		action:  ActionHash,
+		buckets: defaultHashBuckets,
+	}
+}
+
+// Name returns the plugin name.
+func (p *Processor) Name() string {
+	return p.name
+}
+
+// SetTaskID implements plugin.TaskAware; suppressions are counted per task.
+func (p *Processor) SetTaskID(taskID string) {
+	p.taskID = taskID
+}
+
+// Init initializes the processor with configuration.
+//
+// Supported keys:
+//   - labels ([]string): guarded label keys, required
+//   - max_values (int): distinct values per label and window (default 10000)
+//   - window (string): counting window (default "1m")
+//   - action (string): "hash" (default) replaces new values over the limit
+//     with one of hash_buckets values; "drop" removes the label
+//   - hash_buckets (int): distinct hashed values per label (default 1024)
+func (p *Processor) Init(config map[string]any) error {
+	if config == nil {
+		return fmt.Errorf("cardinality: configuration is required")
+	}
+
+	raw, _ := config["labels"].([]any)
+	for i, v := range raw {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return fmt.Errorf("cardinality: labels[%d] must be a non-empty string", i)
+		}
+		p.labels = append(p.labels, s)
+	}
+	if len(p.labels) == 0 {
+		return fmt.Errorf("cardinality: labels is required")
+	}
+
+	if v, ok := config["max_values"].(float64); ok {
+		if v < 1 {
+			return fmt.Errorf("cardinality: max_values must be >= 1, got %v", v)
+		}
+		p.max = int(v)
+	}
+	if v, ok := config["window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("cardinality: window must be a positive duration, got %q", v)
+		}
+		p.window = d
+	}
+	if v, ok := config["action"].(string); ok && v != "" {
+		if v != ActionHash && v != ActionDrop {
+			return fmt.Errorf("cardinality: action must be %q or %q, got %q", ActionHash, ActionDrop, v)
+		}
+		p.action = v
+	}
+	if v, ok := config["hash_buckets"].(float64); ok {
+		if v < 1 || v > 1<<32-1 {
+			return fmt.Errorf("cardinality: hash_buckets must be in [1, %d], got %v", uint32(1<<32-1), v)
+		}
+		p.buckets = uint32(v)
+	}
+
+	p.seen = make(map[string]map[string]struct{}, len(p.labels))
+	p.warned = make(map[string]bool, len(p.labels))
+	return nil
+}
+
+// Start starts the processor.
+func (p *Processor) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Process hashes or drops guarded labels whose value is new in a window that
+// already holds max_values distinct values. Packets are never dropped.
+func (p *Processor) Process(pkt *core.OutputPacket) bool {
+	if len(pkt.Labels) == 0 {
+		return true
+	}
+	ts := pkt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if start := ts.Truncate(p.window); start.After(p.start) {
+		p.start = start
+		clear(p.seen)
+		clear(p.warned)
+	}
+
+	for _, label := range p.labels {
+		v, ok := pkt.Labels[label]
+		if !ok {
+			continue
+		}
+		values := p.seen[label]
+		if values == nil {
+			values = make(map[string]struct{})
+			p.seen[label] = values
+		}
+		if _, ok := values[v]; ok {
+			continue
+		}
+		if len(values) < p.max {
+			values[v] = struct{}{}
+			continue
+		}
+
+		if p.action == ActionDrop {
+			delete(pkt.Labels, label)
+		} else {
+			pkt.Labels[label] = p.hash(v)
+		}
+		metrics.LabelValuesSuppressedTotal.WithLabelValues(p.taskID, label, p.action).Inc()
+		if !p.warned[label] {
+			p.warned[label] = true
+			slog.Warn("label cardinality limit reached",
+				"task_id", p.taskID,
+				"label", label,
+				"max_values", p.max,
+				"window_start", p.start,
+				"action", p.action)
+		}
+	}
+	return true
+}
+
+// hash maps a value to one of p.buckets values.
+func (p *Processor) hash(v string) string {
+	h := fnv.New32a()
+	h.Write([]byte(v))
+	return hashPrefix + strconv.FormatUint(uint64(h.Sum32()%p.buckets), 16)
+}
@@ -0,0 +1,137 @@
+package cardinality
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+)
+
+func newTestProcessor(t *testing.T, cfg map[string]any) *Processor {
+	t.Helper()
+	p := NewProcessor().(*Processor)
+	p.SetTaskID(t.Name())
+	if err := p.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return p
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		wantErr bool
+	}{
+		{"minimal", map[string]any{"labels": []any{"sip.call_id"}}, false},
+		{"full", map[string]any{"labels": []any{"sip.call_id"}, "max_values": float64(10), "window": "10s", "action": "drop", "hash_buckets": float64(16)}, false},
+		{"nil config", nil, true},
+		{"no labels", map[string]any{}, true},
+		{"empty label", map[string]any{"labels": []any{""}}, true},
+		{"bad max_values", map[string]any{"labels": []any{"a"}, "max_values": float64(0)}, true},
+		{"bad window", map[string]any{"labels": []any{"a"}, "window": "soon"}, true},
+		{"bad action", map[string]any{"labels": []any{"a"}, "action": "truncate"}, true},
+		{"bad hash_buckets", map[string]any{"labels": []any{"a"}, "hash_buckets": float64(0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewProcessor().Init(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func packet(ts time.Time, callID string) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp:   ts,
+		PayloadType: "sip",
+		Labels:      core.Labels{core.LabelSIPCallID: callID, core.LabelSIPMethod: "INVITE"},
+	}
+}
+
+func TestProcess_Hash(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"labels":       []any{core.LabelSIPCallID},
+		"max_values":   float64(2),
+		"hash_buckets": float64(4),
+	})
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, tc := range []struct {
+		callID string
+		hashed bool
+	}{
+		{"a", false},
+		{"b", false},
+		{"c", true},
+		{"a", false}, // seen this window
+		{"d", true},
+	} {
+		pkt := packet(t0.Add(time.Duration(i)*time.Second), tc.callID)
+		if !p.Process(pkt) {
+			t.Fatalf("packet %d dropped", i)
+		}
+		got := pkt.Labels[core.LabelSIPCallID]
+		if hashed := strings.HasPrefix(got, hashPrefix); hashed != tc.hashed {
+			t.Errorf("packet %d: %s → %q, hashed %v, want %v", i, tc.callID, got, hashed, tc.hashed)
+		}
+		if pkt.Labels[core.LabelSIPMethod] != "INVITE" {
+			t.Errorf("packet %d: unguarded label changed", i)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.LabelValuesSuppressedTotal.WithLabelValues(t.Name(), core.LabelSIPCallID, ActionHash)); got != 2 {
+		t.Errorf("suppressed = %v, want 2", got)
+	}
+
+	// Hashing is stable and bounded.
+	a, b := p.hash("x"), p.hash("x")
+	if a != b {
+		t.Errorf("hash not stable: %q, %q", a, b)
+	}
+	buckets := map[string]bool{}
+	for i := range 100 {
+		buckets[p.hash(string(rune('a'+i)))] = true
+	}
+	if len(buckets) > 4 {
+		t.Errorf("%d hashed values, want at most 4", len(buckets))
+	}
+
+	// A new window starts over.
+	pkt := packet(t0.Add(time.Minute), "c")
+	p.Process(pkt)
+	if got := pkt.Labels[core.LabelSIPCallID]; got != "c" {
+		t.Errorf("next window: %q, want unchanged", got)
+	}
+}
+
+func TestProcess_Drop(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"labels":     []any{core.LabelSIPCallID},
+		"max_values": float64(1),
+		"action":     "drop",
+	})
+	t0 := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	p.Process(packet(t0, "a"))
+	pkt := packet(t0, "b")
+	if !p.Process(pkt) {
+		t.Fatal("packet dropped")
+	}
+	if _, ok := pkt.Labels[core.LabelSIPCallID]; ok {
+		t.Errorf("label kept: %q", pkt.Labels[core.LabelSIPCallID])
+	}
+	if got := testutil.ToFloat64(metrics.LabelValuesSuppressedTotal.WithLabelValues(t.Name(), core.LabelSIPCallID, ActionDrop)); got != 1 {
+		t.Errorf("suppressed = %v, want 1", got)
+	}
+
+	// Packets without labels pass untouched.
+	if !p.Process(&core.OutputPacket{Timestamp: t0}) {
+		t.Error("unlabeled packet dropped")
+	}
+}
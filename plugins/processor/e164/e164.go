@@ -0,0 +1,231 @@
+// Package e164 implements the caller/callee normalization processor.
+// It extracts the user part of SIP From/To URIs and normalizes it into
+// E.164 form (+<country code><subscriber number>) using a configurable dial
+// plan, so downstream joins against billing systems share one number format.
+package e164
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultInternationalPrefix = "00"
+	defaultNationalPrefix      = "0"
+
+	// E.164 numbers carry at most 15 digits; shorter than 7 are service codes.
+	minE164Digits = 7
+	maxE164Digits = 15
+)
+
+// Processor normalizes SIP caller/callee into E.164 labels.
+type Processor struct {
+	name string
+
+	countryCode         string       // e.g. "86"; empty = never prepend
+	internationalPrefix string       // e.g. "00" (ITU) or "011" (NANP)
+	nationalPrefix      string       // trunk prefix, e.g. "0"
+	nationalLengths     map[int]bool // digit counts of national numbers dialed without the trunk prefix
+	stripPrefixes       []string     // carrier/tech prefixes removed before matching
+	rules               []rule       // dial-plan rewrite rules, first match wins
+}
+
+// rule rewrites a number matching pattern into replace ($1-style groups).
+type rule struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// visualSeparators are removed from user parts before normalization (RFC 3966).
+var visualSeparators = strings.NewReplacer("-", "", ".", "", "(", "", ")", "", " ", "")
+
+// NewProcessor creates a new E.164 normalization processor.
+func NewProcessor() plugin.Processor {
+	return &Processor{
+		name:                "e164",
+		internationalPrefix: defaultInternationalPrefix,
+		nationalPrefix:      defaultNationalPrefix,
+	}
+}
+
+// Name returns the plugin name.
+func (p *Processor) Name() string {
+	return p.name
+}
+
+// Init initializes the processor with configuration.
+//
+// Supported keys:
+//   - country_code (string): prepended to national numbers, e.g. "86"
+//   - international_prefix (string, default "00")
+//   - national_prefix (string, default "0")
+//   - national_lengths ([]int): digit counts of national numbers dialed
+//     without national_prefix, e.g. [11] for Chinese mobiles; such numbers
+//     get country_code prepended. Other numbers without an international or
+//     national prefix are not normalized.
+//   - strip_prefixes ([]string): removed before matching, e.g. ["*67", "17951"]
+//   - rules ([]{match, replace}): regex rewrites applied before prefix handling
+func (p *Processor) Init(config map[string]any) error {
+	if config == nil {
+		return nil
+	}
+
+	if v, ok := config["country_code"].(string); ok {
+		p.countryCode = strings.TrimPrefix(v, "+")
+	}
+	if v, ok := config["international_prefix"].(string); ok {
+		p.internationalPrefix = v
+	}
+	if v, ok := config["national_prefix"].(string); ok {
+		p.nationalPrefix = v
+	}
+
+	if raw, ok := config["national_lengths"].([]any); ok {
+		if p.countryCode == "" {
+			return fmt.Errorf("e164: national_lengths requires country_code")
+		}
+		p.nationalLengths = make(map[int]bool, len(raw))
+		for i, item := range raw {
+			n, ok := item.(float64)
+			if !ok || n < 1 || n > maxE164Digits || n != float64(int(n)) {
+				return fmt.Errorf("e164: national_lengths[%d]: expected a digit count", i)
+			}
+			p.nationalLengths[int(n)] = true
+		}
+	}
+
+	prefixes, err := core.StringList(config["strip_prefixes"])
+	if err != nil {
+		return fmt.Errorf("e164: strip_prefixes: %w", err)
+	}
+	p.stripPrefixes = prefixes
+
+	if raw, ok := config["rules"].([]any); ok {
+		for i, item := range raw {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return fmt.Errorf("e164: rules[%d]: expected object", i)
+			}
+			match, _ := m["match"].(string)
+			replace, _ := m["replace"].(string)
+			if match == "" {
+				return fmt.Errorf("e164: rules[%d]: match is required", i)
+			}
+			re, err := regexp.Compile(match)
+			if err != nil {
+				return fmt.Errorf("e164: rules[%d]: invalid match: %w", i, err)
+			}
+			p.rules = append(p.rules, rule{pattern: re, replace: replace})
+		}
+	}
+
+	return nil
+}
+
+// Start starts the processor.
+func (p *Processor) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Process adds sip.caller / sip.callee labels when From/To normalize to E.164.
+// Packets are never dropped.
+func (p *Processor) Process(pkt *core.OutputPacket) bool {
+	if pkt.Labels == nil {
+		return true
+	}
+
+	if from, ok := pkt.Labels[core.LabelSIPFromURI]; ok {
+		if num, ok := p.Normalize(userPart(from)); ok {
+			pkt.Labels[core.LabelSIPCaller] = num
+		}
+	}
+	if to, ok := pkt.Labels[core.LabelSIPToURI]; ok {
+		if num, ok := p.Normalize(userPart(to)); ok {
+			pkt.Labels[core.LabelSIPCallee] = num
+		}
+	}
+
+	return true
+}
+
+// Normalize converts a dialed number into E.164 ("+" followed by 7-15 digits).
+// It returns false when the input cannot be interpreted as a phone number
+// (e.g. alphanumeric SIP users).
+func (p *Processor) Normalize(number string) (string, bool) {
+	n := visualSeparators.Replace(number)
+	if n == "" {
+		return "", false
+	}
+
+	for _, prefix := range p.stripPrefixes {
+		if prefix != "" && strings.HasPrefix(n, prefix) {
+			n = n[len(prefix):]
+			break
+		}
+	}
+
+	for _, r := range p.rules {
+		if r.pattern.MatchString(n) {
+			n = r.pattern.ReplaceAllString(n, r.replace)
+			break
+		}
+	}
+
+	var digits string
+	switch {
+	case strings.HasPrefix(n, "+"):
+		digits = n[1:]
+	case p.internationalPrefix != "" && strings.HasPrefix(n, p.internationalPrefix):
+		digits = n[len(p.internationalPrefix):]
+	case p.countryCode != "" && p.nationalPrefix != "" && strings.HasPrefix(n, p.nationalPrefix):
+		digits = p.countryCode + n[len(p.nationalPrefix):]
+	case p.nationalLengths[len(n)]:
+		digits = p.countryCode + n
+	default:
+		// Without a prefix the number may be national or international
+		// without "+"; guessing would produce wrong numbers.
+		return "", false
+	}
+
+	if len(digits) < minE164Digits || len(digits) > maxE164Digits || !isDigits(digits) {
+		return "", false
+	}
+	return "+" + digits, true
+}
+
+// userPart extracts the user part of a sip:, sips: or tel: URI.
+// Example: sip:+86-10-1234-5678;phone-context=x@example.com → +86-10-1234-5678
+func userPart(uri string) string {
+	for _, scheme := range []string{"sip:", "sips:", "tel:"} {
+		if len(uri) >= len(scheme) && strings.EqualFold(uri[:len(scheme)], scheme) {
+			uri = uri[len(scheme):]
+			break
+		}
+	}
+	if at := strings.IndexByte(uri, '@'); at != -1 {
+		uri = uri[:at]
+	}
+	if semi := strings.IndexByte(uri, ';'); semi != -1 {
+		uri = uri[:semi]
+	}
+	return uri
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package e164
+
+import (
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func newTestProcessor(t *testing.T, cfg map[string]any) *Processor {
+	t.Helper()
+	p := NewProcessor().(*Processor)
+	if err := p.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return p
+}
+
+func TestNormalize(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"country_code":     "86",
+		"national_lengths": []any{float64(11)},
+		"strip_prefixes":   []any{"17951"},
+		"rules": []any{
+			// Local 8-digit Beijing numbers → add area code
+			map[string]any{"match": `^([2-9]\d{7})$`, "replace": "010$1"},
+		},
+	})
+
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"+8613800138000", "+8613800138000", true},
+		{"008613800138000", "+8613800138000", true},
+		{"013800138000", "+8613800138000", true},
+		{"13800138000", "+8613800138000", true},
+		{"8613800138000", "", false},
+		{"1795101012345678", "+861012345678", true},
+		{"62345678", "+861062345678", true},
+		{"+1 (415) 555-0100", "+14155550100", true},
+		{"alice", "", false},
+		{"110", "", false},
+		{"+1234567890123456", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := p.Normalize(tt.in)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Normalize(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalize_NANP(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"country_code":         "1",
+		"international_prefix": "011",
+		"national_prefix":      "1",
+	})
+
+	if got, ok := p.Normalize("01144207946000"); !ok || got != "+44207946000" {
+		t.Errorf("Normalize(011...) = (%q, %v)", got, ok)
+	}
+	if got, ok := p.Normalize("14155550100"); !ok || got != "+14155550100" {
+		t.Errorf("Normalize(1...) = (%q, %v)", got, ok)
+	}
+	// Without national_lengths a number lacking any prefix is not guessed.
+	if got, ok := p.Normalize("4155550100"); ok {
+		t.Errorf("Normalize(4155550100) = %q, want no number", got)
+	}
+}
+
+func TestProcess_Labels(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{"country_code": "86"})
+
+	pkt := &core.OutputPacket{
+		Labels: core.Labels{
+			core.LabelSIPFromURI: "sip:013800138000@ims.example.com;user=phone",
+			core.LabelSIPToURI:   "tel:+86-10-1234-5678",
+		},
+	}
+	if !p.Process(pkt) {
+		t.Fatal("Process() must keep packets")
+	}
+	if got := pkt.Labels[core.LabelSIPCaller]; got != "+8613800138000" {
+		t.Errorf("caller = %q, want +8613800138000", got)
+	}
+	if got := pkt.Labels[core.LabelSIPCallee]; got != "+861012345678" {
+		t.Errorf("callee = %q, want +861012345678", got)
+	}
+
+	// Non-numeric users produce no labels.
+	pkt = &core.OutputPacket{Labels: core.Labels{core.LabelSIPFromURI: "sip:alice@example.com"}}
+	p.Process(pkt)
+	if _, ok := pkt.Labels[core.LabelSIPCaller]; ok {
+		t.Error("unexpected caller label for alphanumeric user")
+	}
+
+	// Packets without labels pass through.
+	if !p.Process(&core.OutputPacket{}) {
+		t.Error("Process() must keep packets without labels")
+	}
+}
+
+func TestInit_InvalidRule(t *testing.T) {
+	p := NewProcessor()
+	err := p.Init(map[string]any{
+		"rules": []any{map[string]any{"match": "([", "replace": ""}},
+	})
+	if err == nil {
+		t.Error("expected error for invalid regex")
+	}
+
+	err = NewProcessor().Init(map[string]any{"strip_prefixes": []any{1}})
+	if err == nil {
+		t.Error("expected error for non-string strip prefix")
+	}
+
+	err = NewProcessor().Init(map[string]any{"national_lengths": []any{float64(11)}})
+	if err == nil {
+		t.Error("expected error for national_lengths without country_code")
+	}
+}
+
+func TestUserPart(t *testing.T) {
+	tests := map[string]string{
+		"sip:+8613800138000@example.com;user=phone": "+8613800138000",
+		"SIPS:alice@example.com":                    "alice",
+		"tel:+1-415-555-0100;phone-context=x":       "+1-415-555-0100",
+		"1000":                                      "1000",
+	}
+	for in, want := range tests {
+		if got := userPart(in); got != want {
+			t.Errorf("userPart(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
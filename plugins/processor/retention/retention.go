@@ -0,0 +1,140 @@
+// Package retention implements the retention hint processor. It stamps a
+// retention class label (e.g. "30d" for call records, "3d" for raw RTP) by
+// payload type and label rules, which the Kafka and HEP reporters carry in
+// a header or chunk so downstream storage tiers can enforce retention
+// without inspecting payloads.
+package retention
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+// Processor stamps core.LabelRetentionClass.
+type Processor struct {
+	name string
+
+	rules        []rule // first match wins
+	defaultClass string // when no rule matches; empty = no label
+}
+
+// rule assigns class to packets of payloadTypes whose labels match.
+type rule struct {
+	payloadTypes []string                  // empty = any
+	labels       map[string]*regexp.Regexp // all must match
+	class        string
+}
+
+// NewProcessor creates a new retention processor.
+func NewProcessor() plugin.Processor {
+	return &Processor{name: "retention"}
+}
+
+// Name returns the plugin name.
+func (p *Processor) Name() string {
+	return p.name
+}
+
+// Init initializes the processor with configuration.
+//
+// Supported keys:
+//   - default (string): class of packets no rule matches; empty = none
+//   - rules ([]{payload_types, labels, class}): payload_types ([]string,
+//     empty = any) and labels (label → regexp, all must match) select
+//     packets; first match wins
+func (p *Processor) Init(config map[string]any) error {
+	if config == nil {
+		return fmt.Errorf("retention: configuration is required")
+	}
+	p.defaultClass, _ = config["default"].(string)
+
+	raw, _ := config["rules"].([]any)
+	for i, item := range raw {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return fmt.Errorf("retention: rules[%d]: expected object", i)
+		}
+		r := rule{}
+		r.class, _ = m["class"].(string)
+		if r.class == "" {
+			return fmt.Errorf("retention: rules[%d]: class is required", i)
+		}
+		if types, ok := m["payload_types"].([]any); ok {
+			for j, t := range types {
+				s, ok := t.(string)
+				if !ok || s == "" {
+					return fmt.Errorf("retention: rules[%d].payload_types[%d] must be a non-empty string", i, j)
+				}
+				r.payloadTypes = append(r.payloadTypes, s)
+			}
+		}
+		if labels, ok := m["labels"].(map[string]any); ok {
+			r.labels = make(map[string]*regexp.Regexp, len(labels))
+			for k, v := range labels {
+				expr, ok := v.(string)
+				if !ok {
+					return fmt.Errorf("retention: rules[%d].labels.%s must be a string", i, k)
+				}
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return fmt.Errorf("retention: rules[%d].labels.%s: %w", i, k, err)
+				}
+				r.labels[k] = re
+			}
+		}
+		p.rules = append(p.rules, r)
+	}
+
+	if len(p.rules) == 0 && p.defaultClass == "" {
+		return fmt.Errorf("retention: rules or default is required")
+	}
+	return nil
+}
+
+// Start starts the processor.
+func (p *Processor) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Process stamps the retention class of the first matching rule, or the
+// default. Packets are never dropped.
+func (p *Processor) Process(pkt *core.OutputPacket) bool {
+	class := p.defaultClass
+	for i := range p.rules {
+		if p.rules[i].matches(pkt) {
+			class = p.rules[i].class
+			break
+		}
+	}
+	if class == "" {
+		return true
+	}
+	if pkt.Labels == nil {
+		pkt.Labels = make(core.Labels, 1)
+	}
+	pkt.Labels[core.LabelRetentionClass] = class
+	return true
+}
+
+func (r *rule) matches(pkt *core.OutputPacket) bool {
+	if len(r.payloadTypes) > 0 && !slices.Contains(r.payloadTypes, pkt.PayloadType) {
+		return false
+	}
+	for k, re := range r.labels {
+		v, ok := pkt.Labels[k]
+		if !ok || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package retention
+
+import (
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func newTestProcessor(t *testing.T, cfg map[string]any) *Processor {
+	t.Helper()
+	p := NewProcessor().(*Processor)
+	if err := p.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return p
+}
+
+func TestProcess(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"default": "7d",
+		"rules": []any{
+			map[string]any{"payload_types": []any{"rtp"}, "class": "3d"},
+			map[string]any{
+				"payload_types": []any{"sip"},
+				"labels":        map[string]any{core.LabelSIPMethod: "^(INVITE|BYE)$"},
+				"class":         "30d",
+			},
+		},
+	})
+
+	tests := []struct {
+		name string
+		pkt  *core.OutputPacket
+		want string
+	}{
+		{"rtp", &core.OutputPacket{PayloadType: "rtp"}, "3d"},
+		{"sip invite", &core.OutputPacket{PayloadType: "sip", Labels: core.Labels{core.LabelSIPMethod: "INVITE"}}, "30d"},
+		{"sip options", &core.OutputPacket{PayloadType: "sip", Labels: core.Labels{core.LabelSIPMethod: "OPTIONS"}}, "7d"},
+		{"sip no method", &core.OutputPacket{PayloadType: "sip"}, "7d"},
+	}
+	for _, tt := range tests {
+		if !p.Process(tt.pkt) {
+			t.Errorf("%s: packet dropped", tt.name)
+		}
+		if got := tt.pkt.Labels[core.LabelRetentionClass]; got != tt.want {
+			t.Errorf("%s: class = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProcess_NoDefault(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"rules": []any{map[string]any{"payload_types": []any{"rtp"}, "class": "3d"}},
+	})
+
+	pkt := &core.OutputPacket{PayloadType: "sip"}
+	if !p.Process(pkt) {
+		t.Fatal("packet dropped")
+	}
+	if _, ok := pkt.Labels[core.LabelRetentionClass]; ok {
+		t.Error("class stamped without a matching rule or default")
+	}
+}
+
+func TestInit_Errors(t *testing.T) {
+	for name, cfg := range map[string]map[string]any{
+		"nil":        nil,
+		"empty":      {},
+		"no class":   {"rules": []any{map[string]any{"payload_types": []any{"rtp"}}}},
+		"bad regexp": {"rules": []any{map[string]any{"labels": map[string]any{"k": "("}, "class": "1d"}}},
+		"bad rule":   {"rules": []any{"rtp"}},
+		"bad type":   {"rules": []any{map[string]any{"payload_types": []any{1.0}, "class": "1d"}}},
+	} {
+		if err := NewProcessor().Init(cfg); err == nil {
+			t.Errorf("%s: Init() succeeded, want error", name)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package rollup implements the time-window aggregation processor.
+// Matching packets are counted per window (default one minute) and per
+// combination of key labels, e.g. sip.method × sip.status_code × src_ip, and
+// reported as one summary packet per combination when the window closes, so
+// bulk traffic of little individual value (OPTIONS keepalives, REGISTER
+// refreshes) costs one event per minute instead of one per packet.
+package rollup
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultWindow  = time.Minute
+	defaultMaxKeys = 10000
+
+	// PayloadType of summary packets.
+	PayloadType = "rollup"
+
+	// otherValue replaces every key value once a window holds max_keys
+	// combinations, so cardinality stays bounded.
+	otherValue = "_other"
+)
+
+// Summary is the payload of a summary packet.
+type Summary struct {
+	WindowStart time.Time         `json:"window_start"`
+	WindowEnd   time.Time         `json:"window_end"`
+	Keys        map[string]string `json:"keys"`
+	Packets     uint64            `json:"packets"`
+	Bytes       uint64            `json:"bytes"` // application payload bytes
+}
+
+// Processor aggregates matching packets into per-window summaries.
+type Processor struct {
+	name string
+
+	window  time.Duration
+	keys    []string
+	match   map[string]map[string]bool // key → accepted values; all keys must match
+	keep    bool                       // also pass the original packets on
+	maxKeys int
+
+	windows map[time.Time]*window // open windows by start
+}
+
+// window holds the groups of one aggregation window.
+type window struct {
+	start      time.Time
+	taskID     string
+	agentID    string
+	pipelineID int
+	groups     map[string]*group
+}
+
+type group struct {
+	values  []string
+	packets uint64
+	bytes   uint64
+}
+
+// NewProcessor creates a new rollup processor.
+func NewProcessor() plugin.Processor {
+	return &Processor{
+		name:    "rollup",
+		window:  defaultWindow,
+		maxKeys: defaultMaxKeys,
+		windows: make(map[time.Time]*window),
+	}
+}
+
+// Name returns the plugin name.
+func (p *Processor) Name() string {
+	return p.name
+}
+
+// Init initializes the processor with configuration.
+//
+// Supported keys:
+//   - keys ([]string, required): labels to group by; src_ip, dst_ip and
+//     payload_type read the packet envelope
+//   - window (string, default "1m"): aggregation window, a Go duration
+//   - match (map[string][]string): only aggregate packets whose keys have one
+//     of the listed values, e.g. {"sip.method": ["OPTIONS", "REGISTER"]};
+//     empty = all packets
+//   - keep (bool, default false): also pass the aggregated packets on
+//   - max_keys (int, default 10000): key combinations per window; further
+//     combinations are counted under "_other"
+func (p *Processor) Init(config map[string]any) error {
+	keys, err := core.StringList(config["keys"])
+	if err != nil {
+		return fmt.Errorf("rollup: keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("rollup: keys is required")
+	}
+	p.keys = keys
+
+	if v, ok := config["window"].(string); ok && v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("rollup: window must be a duration of at least 1s, got %q", v)
+		}
+		p.window = d
+	}
+
+	if raw, ok := config["match"].(map[string]any); ok {
+		p.match = make(map[string]map[string]bool, len(raw))
+		for key, v := range raw {
+			values, err := core.StringList(v)
+			if err != nil {
+				return fmt.Errorf("rollup: match.%s: %w", key, err)
+			}
+			set := make(map[string]bool, len(values))
+			for _, value := range values {
+				set[value] = true
+			}
+			p.match[key] = set
+		}
+	}
+
+	if v, ok := config["keep"].(bool); ok {
+		p.keep = v
+	}
+	if v, ok := config["max_keys"]; ok {
+		var n int
+		switch v := v.(type) {
+		case float64:
+			n = int(v)
+		case int:
+			n = v
+		}
+		if n < 1 {
+			return fmt.Errorf("rollup: max_keys must be a number >= 1, got %v", v)
+		}
+		p.maxKeys = n
+	}
+	return nil
+}
+
+// Start starts the processor.
+func (p *Processor) Start(ctx context.Context) error {
+	return nil
+}
+
+// Stop stops the processor.
+func (p *Processor) Stop(ctx context.Context) error {
+	return nil
+}
+
+// Process counts matching packets into the window of their timestamp. They
+// are dropped unless keep is set; other packets pass unchanged.
+func (p *Processor) Process(pkt *core.OutputPacket) bool {
+	if !p.matches(pkt) {
+		return true
+	}
+
+	ts := pkt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	start := ts.Truncate(p.window)
+	w, ok := p.windows[start]
+	if !ok {
+		w = &window{
+			start:      start,
+			taskID:     pkt.TaskID,
+			agentID:    pkt.AgentID,
+			pipelineID: pkt.PipelineID,
+			groups:     make(map[string]*group),
+		}
+		p.windows[start] = w
+	}
+
+	values := make([]string, len(p.keys))
+	for i, key := range p.keys {
+		values[i] = pkt.Value(key)
+	}
+	id := strings.Join(values, "\x00")
+	g, ok := w.groups[id]
+	if !ok {
+		if len(w.groups) >= p.maxKeys {
+			for i := range values {
+				values[i] = otherValue
+			}
+			id = strings.Join(values, "\x00")
+			g = w.groups[id]
+		}
+		if g == nil {
+			g = &group{values: values}
+			w.groups[id] = g
+		}
+	}
+	g.packets++
+	g.bytes += uint64(len(pkt.RawPayload))
+
+	return p.keep
+}
+
+// Flush releases one summary packet per key combination of every window that
+// ended by now, or of all windows when final is set.
+func (p *Processor) Flush(now time.Time, final bool) []core.OutputPacket {
+	var closed []*window
+	for start, w := range p.windows {
+		if final || !start.Add(p.window).After(now) {
+			closed = append(closed, w)
+			delete(p.windows, start)
+		}
+	}
+	sort.Slice(closed, func(i, j int) bool { return closed[i].start.Before(closed[j].start) })
+
+	var out []core.OutputPacket
+	for _, w := range closed {
+		ids := make([]string, 0, len(w.groups))
+		for id := range w.groups {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			out = append(out, p.summary(w, w.groups[id]))
+		}
+	}
+	return out
+}
+
+// summary builds the summary packet of one group.
+func (p *Processor) summary(w *window, g *group) core.OutputPacket {
+	keys := make(map[string]string, len(p.keys))
+	labels := make(core.Labels, len(p.keys)+3)
+	for i, key := range p.keys {
+		keys[key] = g.values[i]
+		labels[key] = g.values[i]
+	}
+	labels[core.LabelRollupWindow] = p.window.String()
+	labels[core.LabelRollupPackets] = strconv.FormatUint(g.packets, 10)
+	labels[core.LabelRollupBytes] = strconv.FormatUint(g.bytes, 10)
+
+	return core.OutputPacket{
+		TaskID:      w.taskID,
+		AgentID:     w.agentID,
+		PipelineID:  w.pipelineID,
+		Timestamp:   w.start,
+		PayloadType: PayloadType,
+		Labels:      labels,
+		Payload: &Summary{
+			WindowStart: w.start,
+			WindowEnd:   w.start.Add(p.window),
+			Keys:        keys,
+			Packets:     g.packets,
+			Bytes:       g.bytes,
+		},
+	}
+}
+
+// matches reports whether pkt passes the match filter.
+func (p *Processor) matches(pkt *core.OutputPacket) bool {
+	for key, values := range p.match {
+		if !values[pkt.Value(key)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package rollup
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func newTestProcessor(t *testing.T, cfg map[string]any) *Processor {
+	t.Helper()
+	p := NewProcessor().(*Processor)
+	if err := p.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return p
+}
+
+func sipPacket(ts time.Time, method, src string) *core.OutputPacket {
+	return &core.OutputPacket{
+		TaskID:      "rollup-task",
+		Timestamp:   ts,
+		SrcIP:       netip.MustParseAddr(src),
+		PayloadType: "sip",
+		Labels:      core.Labels{core.LabelSIPMethod: method},
+		RawPayload:  make([]byte, 100),
+	}
+}
+
+func TestProcessor_Rollup(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{
+		"keys":  []any{"sip.method", "src_ip"},
+		"match": map[string]any{"sip.method": []any{"OPTIONS", "REGISTER"}},
+	})
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		if p.Process(sipPacket(base.Add(time.Duration(i)*time.Second), "OPTIONS", "10.0.0.1")) {
+			t.Error("aggregated packet kept, want dropped")
+		}
+	}
+	p.Process(sipPacket(base.Add(5*time.Second), "REGISTER", "10.0.0.1"))
+	p.Process(sipPacket(base.Add(70*time.Second), "OPTIONS", "10.0.0.1")) // next window
+	if !p.Process(sipPacket(base, "INVITE", "10.0.0.1")) {
+		t.Error("unmatched packet dropped, want kept")
+	}
+
+	if out := p.Flush(base.Add(59*time.Second), false); len(out) != 0 {
+		t.Fatalf("Flush before window end = %d packets, want 0", len(out))
+	}
+
+	out := p.Flush(base.Add(time.Minute), false)
+	if len(out) != 2 {
+		t.Fatalf("Flush = %d packets, want 2 (OPTIONS, REGISTER)", len(out))
+	}
+	opts := out[0]
+	if opts.PayloadType != PayloadType || opts.TaskID != "rollup-task" || !opts.Timestamp.Equal(base) {
+		t.Errorf("summary envelope = %+v", opts)
+	}
+	if opts.Labels[core.LabelSIPMethod] != "OPTIONS" || opts.Labels["src_ip"] != "10.0.0.1" ||
+		opts.Labels[core.LabelRollupPackets] != "3" || opts.Labels[core.LabelRollupBytes] != "300" {
+		t.Errorf("summary labels = %v", opts.Labels)
+	}
+	if s := opts.Payload.(*Summary); s.Packets != 3 || !s.WindowEnd.Equal(base.Add(time.Minute)) {
+		t.Errorf("summary payload = %+v", s)
+	}
+
+	// The open window is released on the final flush.
+	out = p.Flush(base.Add(time.Minute), true)
+	if len(out) != 1 || out[0].Labels[core.LabelRollupPackets] != "1" {
+		t.Errorf("final Flush = %+v, want the second window", out)
+	}
+	if len(p.windows) != 0 {
+		t.Errorf("%d windows left after final flush", len(p.windows))
+	}
+}
+
+func TestProcessor_MaxKeys(t *testing.T) {
+	p := newTestProcessor(t, map[string]any{"keys": []any{"src_ip"}, "max_keys": float64(2), "keep": true})
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, src := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.1"} {
+		if !p.Process(sipPacket(base, "OPTIONS", src)) {
+			t.Error("packet dropped with keep: true")
+		}
+	}
+
+	counts := map[string]string{}
+	for _, pkt := range p.Flush(base, true) {
+		counts[pkt.Labels["src_ip"]] = pkt.Labels[core.LabelRollupPackets]
+	}
+	want := map[string]string{"10.0.0.1": "2", "10.0.0.2": "1", otherValue: "2"}
+	if len(counts) != len(want) {
+		t.Fatalf("summaries = %v, want %v", counts, want)
+	}
+	for k, v := range want {
+		if counts[k] != v {
+			t.Errorf("summaries = %v, want %v", counts, want)
+			break
+		}
+	}
+}
+
+func TestProcessor_InitErrors(t *testing.T) {
+	for _, cfg := range []map[string]any{
+		nil,
+		{"keys": []any{}},
+		{"keys": []any{"sip.method"}, "window": "100ms"},
+		{"keys": []any{"sip.method"}, "window": "soon"},
+		{"keys": []any{"sip.method"}, "max_keys": float64(0)},
+		{"keys": []any{"sip.method"}, "match": map[string]any{"sip.method": "OPTIONS"}},
+	} {
+		if err := NewProcessor().Init(cfg); err == nil {
+			t.Errorf("Init(%v) succeeded, want error", cfg)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"sync/atomic"
 
 	"firestige.xyz/otus/internal/core"
@@ -115,10 +116,10 @@ func (r *ConsoleReporter) reportJSON(pkt *core.OutputPacket) error {
 
 // reportText outputs packet in human-readable text format.
 func (r *ConsoleReporter) reportText(pkt *core.OutputPacket) error {
-	fmt.Printf("[%s] %s:%d → %s:%d proto=%d type=%s",
+	fmt.Printf("[%s] %s → %s proto=%d type=%s",
 		pkt.Timestamp.Format("15:04:05.000"),
-		pkt.SrcIP, pkt.SrcPort,
-		pkt.DstIP, pkt.DstPort,
+		netip.AddrPortFrom(pkt.SrcIP, pkt.SrcPort),
+		netip.AddrPortFrom(pkt.DstIP, pkt.DstPort),
 		pkt.Protocol,
 		pkt.PayloadType,
 	)
@@ -0,0 +1,276 @@
+// Package forward implements a reporter that re-emits packets as Ethernet
+// frames, on a network interface or inside a VXLAN tunnel, making the agent a
+// selective traffic forwarder for analyzers that need real packets.
+//
+// Packets carry the application payload and the 5-tuple but not the original
+// frame, so frames are rebuilt (see internal/rebuild) with configurable MAC
+// addresses and an optional 802.1Q tag. Packets without a network context,
+// e.g. rollup summaries or alerts, are skipped.
+//
+// Example task reporter configuration:
+//
+//	reporters:
+//	  - name: forward
+//	    config:
+//	      interface: eth2               # or vxlan: "10.0.0.9:4789" with vni
+//	      vlan: 30                      # optional 802.1Q tag
+//	      dst_mac: "00:1b:21:aa:bb:cc"  # the analyzer's port
+//	      payload_types: ["sip"]        # optional, default all
+package forward
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/rebuild"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultVXLANPort = "4789"
+	vxlanHeaderLen   = 8
+	maxVNI           = 1<<24 - 1
+	maxVLAN          = 4094
+)
+
+// Locally administered defaults for MACs left unset.
+var (
+	defaultSrcMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	defaultDstMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+)
+
+// Config represents forward reporter configuration.
+type Config struct {
+	Interface    string           `json:"interface"`     // send on this interface (needs CAP_NET_RAW)
+	VXLAN        string           `json:"vxlan"`         // or to this VTEP, host[:port] (default port 4789)
+	VNI          uint32           `json:"vni"`           // VXLAN network identifier
+	VLAN         uint16           `json:"vlan"`          // 802.1Q VLAN ID of the frames; 0 = untagged
+	SrcMAC       net.HardwareAddr `json:"src_mac"`       // default: the interface's MAC, 02:00:00:00:00:01 for vxlan
+	DstMAC       net.HardwareAddr `json:"dst_mac"`       // default 02:00:00:00:00:02
+	PayloadTypes []string         `json:"payload_types"` // forwarded payload types; empty = all
+}
+
+// frameWriter sends Ethernet frames.
+type frameWriter interface {
+	WritePacketData(frame []byte) error
+	Close()
+}
+
+// ForwardReporter re-emits packets as Ethernet frames.
+type ForwardReporter struct {
+	name   string
+	config Config
+
+	mu     sync.Mutex
+	writer frameWriter // nil until Start
+	buf    gopacket.SerializeBuffer
+
+	sent    atomic.Uint64
+	skipped atomic.Uint64
+}
+
+// NewForwardReporter creates a new forward reporter instance.
+func NewForwardReporter() plugin.Reporter {
+	return &ForwardReporter{
+		name: "forward",
+		buf:  gopacket.NewSerializeBuffer(),
+	}
+}
+
+// Name returns the plugin name.
+func (r *ForwardReporter) Name() string {
+	return r.name
+}
+
+// Init initializes the reporter with configuration.
+func (r *ForwardReporter) Init(config map[string]any) error {
+	if config == nil {
+		return fmt.Errorf("forward reporter: configuration is required")
+	}
+
+	var cfg Config
+	cfg.Interface, _ = config["interface"].(string)
+	cfg.VXLAN, _ = config["vxlan"].(string)
+	if (cfg.Interface == "") == (cfg.VXLAN == "") {
+		return fmt.Errorf("forward reporter: exactly one of interface or vxlan is required")
+	}
+	if cfg.VXLAN != "" {
+		if _, _, err := net.SplitHostPort(cfg.VXLAN); err != nil {
+			cfg.VXLAN = net.JoinHostPort(cfg.VXLAN, defaultVXLANPort)
+		}
+		if v, ok := config["vni"].(float64); ok {
+			if v < 0 || v > maxVNI {
+				return fmt.Errorf("forward reporter: vni must be in [0, %d], got %v", maxVNI, v)
+			}
+			cfg.VNI = uint32(v)
+		}
+	}
+
+	if v, ok := config["vlan"].(float64); ok {
+		if v < 0 || v > maxVLAN {
+			return fmt.Errorf("forward reporter: vlan must be in [0, %d], got %v", maxVLAN, v)
+		}
+		cfg.VLAN = uint16(v)
+	}
+
+	for key, dst := range map[string]*net.HardwareAddr{"src_mac": &cfg.SrcMAC, "dst_mac": &cfg.DstMAC} {
+		v, ok := config[key].(string)
+		if !ok || v == "" {
+			continue
+		}
+		mac, err := net.ParseMAC(v)
+		if err != nil || len(mac) != 6 {
+			return fmt.Errorf("forward reporter: invalid %s %q", key, v)
+		}
+		*dst = mac
+	}
+	if cfg.DstMAC == nil {
+		cfg.DstMAC = defaultDstMAC
+	}
+
+	if v, ok := config["payload_types"].([]any); ok {
+		for i, t := range v {
+			s, ok := t.(string)
+			if !ok || s == "" {
+				return fmt.Errorf("forward reporter: payload_types[%d] must be a non-empty string", i)
+			}
+			cfg.PayloadTypes = append(cfg.PayloadTypes, s)
+		}
+	}
+
+	r.config = cfg
+	return nil
+}
+
+// Start opens the interface or the tunnel socket.
+func (r *ForwardReporter) Start(_ context.Context) error {
+	var err error
+	if r.config.Interface != "" {
+		err = r.openInterface()
+	} else {
+		err = r.openVXLAN()
+	}
+	if err != nil {
+		return fmt.Errorf("forward reporter: %w", err)
+	}
+	slog.Info("forward reporter started",
+		"interface", r.config.Interface,
+		"vxlan", r.config.VXLAN,
+		"vlan", r.config.VLAN,
+		"payload_types", r.config.PayloadTypes)
+	return nil
+}
+
+func (r *ForwardReporter) openInterface() error {
+	iface, err := net.InterfaceByName(r.config.Interface)
+	if err != nil {
+		return fmt.Errorf("%w: %w", core.ErrConfig, err)
+	}
+	if r.config.SrcMAC == nil {
+		r.config.SrcMAC = iface.HardwareAddr
+	}
+	w, err := openPacketSocket(iface.Name)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", iface.Name, err)
+	}
+	r.writer = w
+	return nil
+}
+
+func (r *ForwardReporter) openVXLAN() error {
+	if r.config.SrcMAC == nil {
+		r.config.SrcMAC = defaultSrcMAC
+	}
+	addr, err := net.ResolveUDPAddr("udp", r.config.VXLAN)
+	if err != nil {
+		return fmt.Errorf("resolve %q: %w: %w", r.config.VXLAN, core.ErrTransient, err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return fmt.Errorf("dial %q: %w: %w", r.config.VXLAN, core.ErrTransient, err)
+	}
+	r.writer = newVXLANWriter(conn, r.config.VNI)
+	return nil
+}
+
+// Stop closes the interface or the tunnel socket.
+func (r *ForwardReporter) Stop(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer != nil {
+		r.writer.Close()
+		r.writer = nil
+	}
+	slog.Info("forward reporter stopped", "sent", r.sent.Load(), "skipped", r.skipped.Load())
+	return nil
+}
+
+// Report rebuilds pkt as an Ethernet frame and sends it.
+func (r *ForwardReporter) Report(_ context.Context, pkt *core.OutputPacket) error {
+	if pkt == nil {
+		return fmt.Errorf("nil packet")
+	}
+	if !pkt.SrcIP.IsValid() || !pkt.DstIP.IsValid() || len(pkt.RawPayload) == 0 ||
+		(len(r.config.PayloadTypes) > 0 && !slices.Contains(r.config.PayloadTypes, pkt.PayloadType)) {
+		r.skipped.Add(1)
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil {
+		return fmt.Errorf("forward reporter: not started")
+	}
+	frame, err := rebuild.Frame(r.buf, pkt, rebuild.Link{
+		SrcMAC: r.config.SrcMAC,
+		DstMAC: r.config.DstMAC,
+		VLAN:   r.config.VLAN,
+	})
+	if err != nil {
+		r.skipped.Add(1)
+		return fmt.Errorf("forward reporter: %w: %w", core.ErrPermanent, err)
+	}
+	if err := r.writer.WritePacketData(frame); err != nil {
+		return fmt.Errorf("forward reporter: send: %w: %w", core.ErrTransient, err)
+	}
+	r.sent.Add(1)
+	return nil
+}
+
+// Flush is a no-op: frames are sent immediately.
+func (r *ForwardReporter) Flush(_ context.Context) error { return nil }
+
+// vxlanWriter sends frames to a VTEP, each in one UDP datagram (RFC 7348).
+type vxlanWriter struct {
+	conn *net.UDPConn
+	buf  []byte // VXLAN header, then the frame of the current write
+}
+
+func newVXLANWriter(conn *net.UDPConn, vni uint32) *vxlanWriter {
+	w := &vxlanWriter{conn: conn, buf: make([]byte, vxlanHeaderLen, vxlanHeaderLen+1518)}
+	w.buf[0] = 0x08 // I flag: the VNI is valid
+	binary.BigEndian.PutUint32(w.buf[4:], vni<<8)
+	return w
+}
+
+// WritePacketData sends one frame. The caller serializes writes.
+func (w *vxlanWriter) WritePacketData(frame []byte) error {
+	w.buf = append(w.buf[:vxlanHeaderLen], frame...)
+	_, err := w.conn.Write(w.buf)
+	return err
+}
+
+func (w *vxlanWriter) Close() {
+	_ = w.conn.Close()
+}
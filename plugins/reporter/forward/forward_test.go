@@ -0,0 +1,143 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func sipPacket() *core.OutputPacket {
+	return &core.OutputPacket{
+		SrcIP:       netip.MustParseAddr("10.0.0.1"),
+		DstIP:       netip.MustParseAddr("10.0.0.2"),
+		SrcPort:     5060,
+		DstPort:     5060,
+		Protocol:    17,
+		PayloadType: "sip",
+		RawPayload:  []byte("OPTIONS sip:bob@example.com SIP/2.0\r\n\r\n"),
+	}
+}
+
+// captureWriter records written frames.
+type captureWriter struct{ frames [][]byte }
+
+func (w *captureWriter) WritePacketData(frame []byte) error {
+	w.frames = append(w.frames, append([]byte(nil), frame...))
+	return nil
+}
+func (w *captureWriter) Close() {}
+
+func TestForwardReporter_Init(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		wantErr bool
+	}{
+		{"interface", map[string]any{"interface": "eth2"}, false},
+		{"vxlan", map[string]any{"vxlan": "10.0.0.9", "vni": float64(100), "vlan": float64(30), "dst_mac": "00:1b:21:aa:bb:cc", "payload_types": []any{"sip"}}, false},
+		{"nil config", nil, true},
+		{"neither", map[string]any{}, true},
+		{"both", map[string]any{"interface": "eth2", "vxlan": "10.0.0.9:4789"}, true},
+		{"bad vni", map[string]any{"vxlan": "10.0.0.9", "vni": float64(1 << 24)}, true},
+		{"bad vlan", map[string]any{"interface": "eth2", "vlan": float64(4095)}, true},
+		{"bad mac", map[string]any{"interface": "eth2", "src_mac": "nope"}, true},
+		{"bad payload type", map[string]any{"interface": "eth2", "payload_types": []any{1}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewForwardReporter().Init(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	r := NewForwardReporter().(*ForwardReporter)
+	if err := r.Init(map[string]any{"vxlan": "10.0.0.9"}); err != nil {
+		t.Fatal(err)
+	}
+	if r.config.VXLAN != "10.0.0.9:4789" {
+		t.Errorf("vxlan = %q, want default port 4789", r.config.VXLAN)
+	}
+}
+
+func TestForwardReporter_ReportVLAN(t *testing.T) {
+	r := NewForwardReporter().(*ForwardReporter)
+	if err := r.Init(map[string]any{"interface": "eth2", "vlan": float64(30), "src_mac": "02:00:00:00:00:0a", "payload_types": []any{"sip"}}); err != nil {
+		t.Fatal(err)
+	}
+	w := &captureWriter{}
+	r.writer = w
+
+	rtp := sipPacket()
+	rtp.PayloadType = "rtp"
+	for _, pkt := range []*core.OutputPacket{sipPacket(), rtp, {PayloadType: "sip"}} {
+		if err := r.Report(context.Background(), pkt); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+	}
+	if len(w.frames) != 1 || r.skipped.Load() != 2 {
+		t.Fatalf("frames = %d, skipped = %d; want 1 SIP frame, 2 skipped", len(w.frames), r.skipped.Load())
+	}
+
+	pkt := gopacket.NewPacket(w.frames[0], layers.LayerTypeEthernet, gopacket.Default)
+	eth, _ := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if eth == nil || eth.SrcMAC.String() != "02:00:00:00:00:0a" || eth.DstMAC.String() != defaultDstMAC.String() {
+		t.Fatalf("ethernet = %+v", eth)
+	}
+	dot1q, _ := pkt.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+	if dot1q == nil || dot1q.VLANIdentifier != 30 {
+		t.Fatalf("dot1q = %+v, want VLAN 30", dot1q)
+	}
+	udp, _ := pkt.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if udp == nil || udp.DstPort != 5060 || string(udp.Payload) != string(sipPacket().RawPayload) {
+		t.Fatalf("udp = %+v", udp)
+	}
+}
+
+func TestForwardReporter_VXLAN(t *testing.T) {
+	vtep, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vtep.Close()
+
+	r := NewForwardReporter().(*ForwardReporter)
+	if err := r.Init(map[string]any{"vxlan": vtep.LocalAddr().String(), "vni": float64(100)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop(context.Background())
+
+	if err := r.Report(context.Background(), sipPacket()); err != nil {
+		t.Fatalf("Report: %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	_ = vtep.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := vtep.Read(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	pkt := gopacket.NewPacket(buf[:n], layers.LayerTypeVXLAN, gopacket.Default)
+	vx, _ := pkt.Layer(layers.LayerTypeVXLAN).(*layers.VXLAN)
+	if vx == nil || !vx.ValidIDFlag || vx.VNI != 100 {
+		t.Fatalf("vxlan = %+v, want VNI 100", vx)
+	}
+	eth, _ := pkt.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	if eth == nil || eth.SrcMAC.String() != defaultSrcMAC.String() {
+		t.Fatalf("inner ethernet = %+v", eth)
+	}
+	if pkt.Layer(layers.LayerTypeUDP) == nil || pkt.ApplicationLayer() == nil {
+		t.Error("inner UDP payload not decoded")
+	}
+}
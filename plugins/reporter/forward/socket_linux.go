@@ -0,0 +1,9 @@
+package forward
+
+import "github.com/google/gopacket/afpacket"
+
+// openPacketSocket opens an AF_PACKET socket sending on iface.
+func openPacketSocket(iface string) (frameWriter, error) {
+	// The socket only sends; keep its receive ring minimal
+	return afpacket.NewTPacket(afpacket.OptInterface(iface), afpacket.OptNumBlocks(1))
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package forward
+
+import (
+	"fmt"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// openPacketSocket fails: sending on an interface needs AF_PACKET, so only
+// vxlan output is available off Linux.
+func openPacketSocket(string) (frameWriter, error) {
+	return nil, fmt.Errorf("%w: interface output is only supported on Linux; use vxlan", core.ErrConfig)
+}
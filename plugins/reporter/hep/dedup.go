@@ -0,0 +1,203 @@
+package hep
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+const defaultDedupMaxEntries = 100000
+
+// DedupConfig suppresses copies of a SIP message, so a message captured at
+// several points (both sides of a proxy or SBC, several mirror ports, or a
+// siptrace relayed by another agent through a captured link) reaches the
+// collector once. Copies are SIP messages with the same Call-ID, From and
+// To tags, CSeq, method or status code and body seen within Window of the
+// first one, so responses of forked branches (other To tags) are kept;
+// headers rewritten hop by hop (Via, Max-Forwards, Record-Route) do not
+// count. Retransmissions within the window are suppressed too, so Window
+// should stay below the SIP T1 timer (500ms) to keep them.
+type DedupConfig struct {
+	Window     time.Duration `json:"window"`      // 0 = off
+	MaxEntries int           `json:"max_entries"` // messages remembered, oldest forgotten first; default 100000
+}
+
+// parseDedup reads the dedup reporter config.
+func parseDedup(m map[string]any) (DedupConfig, error) {
+	dc := DedupConfig{MaxEntries: defaultDedupMaxEntries}
+	v, _ := m["window"].(string)
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return dc, fmt.Errorf("dedup.window must be a positive duration, got %q", v)
+	}
+	dc.Window = d
+	if v, ok := m["max_entries"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return dc, fmt.Errorf("dedup.max_entries must be a positive integer")
+		}
+		dc.MaxEntries = int(v)
+	}
+	return dc, nil
+}
+
+// dedupKey identifies a SIP message across capture points.
+type dedupKey struct {
+	callID  string
+	fromTag string
+	toTag   string // empty in requests outside a dialog
+	cseq    string
+	start   string // method or status code
+	body    uint64 // FNV-64a of the message body
+}
+
+// dedupFilter remembers the SIP messages sent within the window in two
+// generations: cur, started at curStart, and prev before it. cur becomes
+// prev once it is a window old or holds half of maxEntries, dropping the
+// generation before; so the oldest messages are forgotten first, in O(1),
+// and memory stays bounded. A message is a copy only while its first
+// capture is within the window.
+type dedupFilter struct {
+	window time.Duration
+	genMax int // entries per generation
+
+	mu       sync.Mutex
+	cur      map[dedupKey]time.Time // first capture time
+	prev     map[dedupKey]time.Time
+	curStart time.Time
+}
+
+// filter returns the dedup filter of the config, nil when off.
+func (dc DedupConfig) filter() *dedupFilter {
+	if dc.Window <= 0 {
+		return nil
+	}
+	return &dedupFilter{
+		window: dc.Window,
+		genMax: max(dc.MaxEntries/2, 1),
+		cur:    make(map[dedupKey]time.Time),
+		prev:   make(map[dedupKey]time.Time),
+	}
+}
+
+// duplicate reports whether pkt is a copy of a SIP message seen within the
+// window, and remembers it otherwise. Packets other than SIP messages with
+// a Call-ID and CSeq are never duplicates. A nil filter has none.
+func (f *dedupFilter) duplicate(pkt *core.OutputPacket) bool {
+	if f == nil || pkt.PayloadType != "sip" {
+		return false
+	}
+	key, ok := sipDedupKey(pkt)
+	if !ok {
+		return false
+	}
+	ts := pkt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, gen := range [...]map[dedupKey]time.Time{f.cur, f.prev} {
+		if first, ok := gen[key]; ok {
+			if d := ts.Sub(first); d < f.window && d > -f.window {
+				return true
+			}
+		}
+	}
+	if ts.Sub(f.curStart) >= f.window || len(f.cur) >= f.genMax {
+		f.rotate(ts)
+	}
+	f.cur[key] = ts
+	return false
+}
+
+// forget forgets pkt, which was not sent.
+func (f *dedupFilter) forget(pkt *core.OutputPacket) {
+	if f == nil || pkt.PayloadType != "sip" {
+		return
+	}
+	if key, ok := sipDedupKey(pkt); ok {
+		f.mu.Lock()
+		delete(f.cur, key)
+		delete(f.prev, key)
+		f.mu.Unlock()
+	}
+}
+
+// rotate starts a new generation at now, forgetting the one before prev
+// (must hold mu). When cur itself started two windows before now, none of
+// its messages can match any more and it is forgotten too.
+func (f *dedupFilter) rotate(now time.Time) {
+	clear(f.prev)
+	if now.Sub(f.curStart) < 2*f.window {
+		f.prev, f.cur = f.cur, f.prev
+	} else {
+		clear(f.cur)
+	}
+	f.curStart = now
+}
+
+// sipDedupKey returns the dedup key of a SIP message.
+func sipDedupKey(pkt *core.OutputPacket) (dedupKey, bool) {
+	callID := pkt.Labels[core.LabelSIPCallID]
+	if callID == "" {
+		return dedupKey{}, false
+	}
+	head, body, _ := bytes.Cut(pkt.RawPayload, []byte("\r\n\r\n"))
+	cseq := headerValue(head, "CSeq")
+	if cseq == "" {
+		return dedupKey{}, false
+	}
+	start := pkt.Labels[core.LabelSIPMethod]
+	if start == "" {
+		start = pkt.Labels[core.LabelSIPStatusCode]
+	}
+	h := fnv.New64a()
+	h.Write(body)
+	return dedupKey{
+		callID:  callID,
+		fromTag: tagParam(headerValue(head, "From", "f")),
+		toTag:   tagParam(headerValue(head, "To", "t")),
+		cseq:    cseq,
+		start:   start,
+		body:    h.Sum64(),
+	}, true
+}
+
+// tagParam returns the tag parameter of a From or To header value.
+func tagParam(v string) string {
+	if i := strings.LastIndexByte(v, '>'); i >= 0 {
+		v = v[i+1:] // parameters of the URI are not header parameters
+	}
+	params := strings.Split(v, ";")
+	for _, p := range params[1:] {
+		k, val, _ := strings.Cut(p, "=")
+		if strings.EqualFold(strings.TrimSpace(k), "tag") {
+			return strings.TrimSpace(val)
+		}
+	}
+	return ""
+}
+
+// headerValue returns the value of the first header in a SIP message head
+// with one of names (a name and its compact form), with whitespace collapsed.
+func headerValue(head []byte, names ...string) string {
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		k, v, ok := bytes.Cut(line, []byte(":"))
+		if !ok {
+			continue
+		}
+		k = bytes.TrimSpace(k)
+		for _, name := range names {
+			if bytes.EqualFold(k, []byte(name)) {
+				return string(bytes.Join(bytes.Fields(v), []byte(" ")))
+			}
+		}
+	}
+	return ""
+}
@@ -37,11 +37,16 @@
 //
 //	48  From identity     string  (SIP From-URI or srcIP:port)
 //	49  To   identity     string  (SIP To-URI   or dstIP:port)
+//	50  Retention class   string  (retention.class label, e.g. "30d")
+//	51  Agent version     string  (agent.version label)
+//	52  Agent commit      string  (agent.commit label)
+//	53  Config hash       string  (agent.config_hash label)
 package hep
 
 import (
 	"encoding/binary"
 	"fmt"
+	"net/netip"
 	"time"
 
 	"firestige.xyz/otus/internal/core"
@@ -79,8 +84,12 @@ const (
 	chunkNodeName  = uint16(19) // capture node hostname / name
 
 	// Custom chunk IDs (project-specific, per spec).
-	chunkFrom = uint16(48) // originating identity (SIP From-URI or srcIP:port)
-	chunkTo   = uint16(49) // terminating identity  (SIP To-URI   or dstIP:port)
+	chunkFrom      = uint16(48) // originating identity (SIP From-URI or srcIP:port)
+	chunkTo        = uint16(49) // terminating identity  (SIP To-URI   or dstIP:port)
+	chunkRetention = uint16(50) // retention class hint (retention.class label)
+	chunkAgentVer  = uint16(51) // agent version (agent.version label)
+	chunkAgentRev  = uint16(52) // agent git commit (agent.commit label)
+	chunkConfHash  = uint16(53) // task configuration digest (agent.config_hash label)
 )
 
 // IP-family values used in chunk 1.
@@ -193,6 +202,25 @@ func Encode(pkt *core.OutputPacket, opts EncodeOptions) ([]byte, error) {
 		buf = appendBytes(buf, chunkTo, []byte(to))
 	}
 
+	// ── Chunk 50: retention class ────────────────────────────────────────────
+	if class := pkt.Labels[core.LabelRetentionClass]; class != "" {
+		buf = appendBytes(buf, chunkRetention, []byte(class))
+	}
+
+	// ── Chunks 51–53: agent build (agent_metadata) ───────────────────────────
+	for _, c := range []struct {
+		chunk uint16
+		label string
+	}{
+		{chunkAgentVer, core.LabelAgentVersion},
+		{chunkAgentRev, core.LabelAgentCommit},
+		{chunkConfHash, core.LabelAgentConfigHash},
+	} {
+		if v := pkt.Labels[c.label]; v != "" {
+			buf = appendBytes(buf, c.chunk, []byte(v))
+		}
+	}
+
 	// Back-fill total frame length.
 	if len(buf) > 0xFFFF {
 		return nil, fmt.Errorf("hep: frame too large (%d bytes, max 65535)", len(buf))
@@ -221,21 +249,21 @@ func resolveProtoType(payloadType string) uint8 {
 }
 
 // resolveFrom extracts the originating identity for chunk 48.
-// Priority: SIP From-URI label → srcIP:srcPort.
+// Priority: SIP From-URI label → srcIP:srcPort ([srcIP]:srcPort for IPv6).
 func resolveFrom(pkt *core.OutputPacket) string {
 	if v := pkt.Labels[core.LabelSIPFromURI]; v != "" {
 		return v
 	}
-	return fmt.Sprintf("%s:%d", pkt.SrcIP, pkt.SrcPort)
+	return netip.AddrPortFrom(pkt.SrcIP, pkt.SrcPort).String()
 }
 
 // resolveTo extracts the terminating identity for chunk 49.
-// Priority: SIP To-URI label → dstIP:dstPort.
+// Priority: SIP To-URI label → dstIP:dstPort ([dstIP]:dstPort for IPv6).
 func resolveTo(pkt *core.OutputPacket) string {
 	if v := pkt.Labels[core.LabelSIPToURI]; v != "" {
 		return v
 	}
-	return fmt.Sprintf("%s:%d", pkt.DstIP, pkt.DstPort)
+	return netip.AddrPortFrom(pkt.DstIP, pkt.DstPort).String()
 }
 
 // resolveCorrelationID returns a call/session correlation string for chunk 17.
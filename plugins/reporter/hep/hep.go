@@ -1,7 +1,7 @@
-// Package hep implements a HEPv3 UDP reporter plugin.
+// Package hep implements a HEPv3 UDP/TLS reporter plugin.
 //
 // Each OutputPacket is encoded as a HEPv3 frame (see encoder.go) and sent over
-// UDP to one of the configured remote capture servers.  Routing is flow-stable:
+// UDP, or TLS over TCP, to one of the configured remote capture servers.  Routing is flow-stable:
 // the target server is selected by hashing the 5-tuple (srcIP, srcPort, dstIP,
 // dstPort, protocol) modulo len(servers), so all packets from the same network
 // flow always reach the same server — important for session correlation in tools
@@ -16,35 +16,70 @@
 //	      - "10.0.0.2:9060"
 //	    capture_id: 2001
 //	    auth_key:   "mysecret"   # optional
+//	    transport:  tls          # optional, default udp
+//	    tls:                     # optional, version/ciphers from otus.tls
+//	      ca_cert: /etc/otus/homer-ca.pem
+//	    rate_limit:              # optional, frames/s per server; over-limit frames go to fallback
+//	      frames_per_second: 20000
+//	      servers: {"10.0.0.2:9060": 5000}
+//	    dedup:                   # optional, send each SIP message once per window
+//	      window: 200ms
 package hep
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"log/slog"
 	"net"
+	"sync"
 	"sync/atomic"
+	"time"
 
+	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/metrics"
+	"firestige.xyz/otus/internal/tlspolicy"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
+const (
+	transportUDP = "udp"
+	transportTLS = "tls"
+
+	tlsDialTimeout  = 5 * time.Second
+	tlsWriteTimeout = 5 * time.Second
+)
+
 // ─── Reporter ──────────────────────────────────────────────────────────────
 
-// HEPReporter sends OutputPackets as HEPv3 frames via UDP.
+// HEPReporter sends OutputPackets as HEPv3 frames via UDP or TLS.
 type HEPReporter struct {
 	name   string
+	taskID string
 	config Config
 
-	// One pre-dialed UDP connection per configured server.
-	// Connections are created in Start() and closed in Stop().
-	conns []*net.UDPConn
+	tlsPolicy *tlspolicy.Policy // agent-wide TLS policy, set before Init
+	tlsConfig *tls.Config       // built in Init when transport is tls
+
+	// One pre-dialed connection per configured server, UDP or TLS depending
+	// on the transport. Connections are created in Start() and closed in Stop().
+	conns    []*net.UDPConn
+	tlsConns []*tlsConn
+
+	// Per-server token buckets, indexed like Servers; nil = unlimited.
+	limiters []*tokenBucket
+
+	dedup *dedupFilter // nil = off
 
 	// Statistics (exported via metrics if wired up in the future).
-	sentCount  atomic.Uint64
-	errorCount atomic.Uint64
+	sentCount      atomic.Uint64
+	errorCount     atomic.Uint64
+	throttledCount atomic.Uint64
+	dedupedCount   atomic.Uint64
 }
 
 // Config holds HEP reporter configuration.
@@ -66,6 +101,20 @@ type Config struct {
 	// Typically set to the hostname or datacenter label of this agent.
 	// Leave empty to omit the chunk.
 	NodeName string `json:"node_name"`
+
+	// Transport is "udp" (default) or "tls". Over TLS, frames are written
+	// back to back on one TCP stream per server.
+	Transport string `json:"transport"`
+
+	// TLS holds the CA bundle and client certificate for transport tls;
+	// version and cipher suites follow the agent-wide policy.
+	TLS config.TLSConfig `json:"tls"`
+
+	// RateLimit caps the frames per second sent to each server.
+	RateLimit RateLimitConfig `json:"rate_limit"`
+
+	// Dedup sends copies of a SIP message captured more than once only once.
+	Dedup DedupConfig `json:"dedup"`
 }
 
 // ─── Constructor ───────────────────────────────────────────────────────────
@@ -80,6 +129,12 @@ func NewHEPReporter() plugin.Reporter {
 // Name returns the plugin identifier.
 func (r *HEPReporter) Name() string { return r.name }
 
+// SetTLSPolicy implements plugin.TLSPolicyAware.
+func (r *HEPReporter) SetTLSPolicy(p *tlspolicy.Policy) { r.tlsPolicy = p }
+
+// SetTaskID implements plugin.TaskAware; throttled frames are counted per task.
+func (r *HEPReporter) SetTaskID(taskID string) { r.taskID = taskID }
+
 // Init validates and applies configuration.
 func (r *HEPReporter) Init(config map[string]any) error {
 	if config == nil {
@@ -129,23 +184,68 @@ func (r *HEPReporter) Init(config map[string]any) error {
 		cfg.NodeName = v
 	}
 
+	// Optional: transport, tls
+	cfg.Transport = transportUDP
+	if v, ok := config["transport"].(string); ok && v != "" {
+		cfg.Transport = v
+	}
+	if v, ok := config["tls"].(map[string]any); ok {
+		cfg.TLS = tlspolicy.ParseConn(v)
+	}
+	switch cfg.Transport {
+	case transportUDP:
+	case transportTLS:
+		cfg.TLS.Enabled = true
+		tlsConfig, err := r.tlsPolicy.Client(cfg.TLS)
+		if err != nil {
+			return fmt.Errorf("hep reporter: %w", err)
+		}
+		r.tlsConfig = tlsConfig
+	default:
+		return fmt.Errorf("hep reporter: invalid transport %q (must be udp or tls)", cfg.Transport)
+	}
+
+	// Optional: rate_limit
+	if v, ok := config["rate_limit"].(map[string]any); ok {
+		rl, err := parseRateLimit(v, cfg.Servers)
+		if err != nil {
+			return fmt.Errorf("hep reporter: %w", err)
+		}
+		cfg.RateLimit = rl
+	}
+	r.limiters = cfg.RateLimit.limiters(cfg.Servers)
+
+	// Optional: dedup
+	if v, ok := config["dedup"].(map[string]any); ok {
+		dc, err := parseDedup(v)
+		if err != nil {
+			return fmt.Errorf("hep reporter: %w", err)
+		}
+		cfg.Dedup = dc
+	}
+	r.dedup = cfg.Dedup.filter()
+
 	r.config = cfg
 	return nil
 }
 
-// Start opens UDP connections to all configured servers.
+// Start opens connections to all configured servers.
 func (r *HEPReporter) Start(_ context.Context) error {
+	if r.config.Transport == transportTLS {
+		return r.startTLS()
+	}
+
 	r.conns = make([]*net.UDPConn, 0, len(r.config.Servers))
 	for _, srv := range r.config.Servers {
 		addr, err := net.ResolveUDPAddr("udp", srv)
 		if err != nil {
 			r.closeConns() // clean up any already-opened connections
-			return fmt.Errorf("hep reporter: resolve %q: %w", srv, err)
+			return fmt.Errorf("hep reporter: resolve %q: %w: %w", srv, core.ErrTransient, err)
 		}
 		conn, err := net.DialUDP("udp", nil, addr)
 		if err != nil {
 			r.closeConns()
-			return fmt.Errorf("hep reporter: dial %q: %w", srv, err)
+			return fmt.Errorf("hep reporter: dial %q: %w: %w", srv, core.ErrTransient, err)
 		}
 		r.conns = append(r.conns, conn)
 	}
@@ -156,17 +256,46 @@ func (r *HEPReporter) Start(_ context.Context) error {
 	return nil
 }
 
-// Stop closes all UDP connections and logs final statistics.
+// startTLS dials every server up front so that an unreachable collector or a
+// certificate problem fails the task at start rather than on the first packet.
+func (r *HEPReporter) startTLS() error {
+	r.tlsConns = make([]*tlsConn, 0, len(r.config.Servers))
+	for _, srv := range r.config.Servers {
+		c := &tlsConn{addr: srv, config: r.tlsConfig}
+		if err := c.dial(); err != nil {
+			r.closeConns()
+			// A rejected certificate needs a config change; anything else
+			// may be a collector not up yet
+			category := core.ErrTransient
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				category = core.ErrConfig
+			}
+			return fmt.Errorf("hep reporter: dial %q: %w: %w", srv, category, err)
+		}
+		r.tlsConns = append(r.tlsConns, c)
+	}
+	slog.Info("hep reporter started",
+		"servers", r.config.Servers,
+		"transport", transportTLS,
+		"capture_id", r.config.CaptureID,
+	)
+	return nil
+}
+
+// Stop closes all connections and logs final statistics.
 func (r *HEPReporter) Stop(_ context.Context) error {
 	r.closeConns()
 	slog.Info("hep reporter stopped",
 		"sent", r.sentCount.Load(),
 		"errors", r.errorCount.Load(),
+		"throttled", r.throttledCount.Load(),
+		"deduplicated", r.dedupedCount.Load(),
 	)
 	return nil
 }
 
-// closeConns closes all open UDP connections, ignoring errors.
+// closeConns closes all open connections, ignoring errors.
 func (r *HEPReporter) closeConns() {
 	for _, c := range r.conns {
 		if c != nil {
@@ -174,16 +303,40 @@ func (r *HEPReporter) closeConns() {
 		}
 	}
 	r.conns = nil
+	for _, c := range r.tlsConns {
+		c.close()
+	}
+	r.tlsConns = nil
 }
 
 // ─── Reporter interface ────────────────────────────────────────────────────
 
 // Report encodes pkt as a HEPv3 frame and sends it to a flow-stable server.
-func (r *HEPReporter) Report(_ context.Context, pkt *core.OutputPacket) error {
+// Copies of a SIP message already sent are skipped with dedup on. Frames
+// over the server's rate limit fail with core.ErrThrottled.
+func (r *HEPReporter) Report(_ context.Context, pkt *core.OutputPacket) (err error) {
 	if pkt == nil {
 		return fmt.Errorf("hep reporter: nil packet")
 	}
 
+	if r.dedup.duplicate(pkt) {
+		r.dedupedCount.Add(1)
+		metrics.HEPDeduplicatedFramesTotal.WithLabelValues(r.taskID).Inc()
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			r.dedup.forget(pkt) // a retry or a later copy may still send it
+		}
+	}()
+
+	idx := selectIndex(pkt, len(r.config.Servers))
+	if lim := r.limiters[idx]; lim != nil && !lim.allow(time.Now()) {
+		r.throttledCount.Add(1)
+		metrics.HEPThrottledFramesTotal.WithLabelValues(r.taskID, r.config.Servers[idx]).Inc()
+		return fmt.Errorf("hep reporter: %s: %w", r.config.Servers[idx], core.ErrThrottled)
+	}
+
 	frame, err := Encode(pkt, EncodeOptions{
 		CaptureID: r.config.CaptureID,
 		AuthKey:   r.config.AuthKey,
@@ -191,35 +344,72 @@ func (r *HEPReporter) Report(_ context.Context, pkt *core.OutputPacket) error {
 	})
 	if err != nil {
 		r.errorCount.Add(1)
-		return fmt.Errorf("hep reporter: encode: %w", err)
+		return fmt.Errorf("hep reporter: encode: %w: %w", core.ErrPermanent, err)
+	}
+
+	if len(r.tlsConns) > 0 {
+		conn := r.tlsConns[idx]
+		if err = conn.write(frame); err != nil {
+			r.errorCount.Add(1)
+			return fmt.Errorf("hep reporter: send to %s: %w: %w", conn.addr, core.ErrTransient, err)
+		}
+		r.sentCount.Add(1)
+		return nil
 	}
 
-	conn := r.selectConn(pkt)
+	conn := r.conns[idx]
 	if _, err = conn.Write(frame); err != nil {
 		r.errorCount.Add(1)
-		return fmt.Errorf("hep reporter: send to %s: %w", conn.RemoteAddr(), err)
+		return fmt.Errorf("hep reporter: send to %s: %w: %w", conn.RemoteAddr(), core.ErrTransient, err)
 	}
 
 	r.sentCount.Add(1)
 	return nil
 }
 
-// Flush is a no-op for the HEP UDP reporter — packets are sent immediately.
+// HealthCheck implements plugin.HealthChecker. Over TLS every server must
+// complete a fresh handshake, which also catches an expired server or client
+// certificate; over UDP, which has no handshake, every server is dialed
+// afresh, so its name and port must still resolve to a routable address
+// (nothing is sent).
+func (r *HEPReporter) HealthCheck(ctx context.Context) error {
+	var errs []error
+	for _, srv := range r.config.Servers {
+		var conn net.Conn
+		var err error
+		if r.config.Transport == transportTLS {
+			conn, err = (&tls.Dialer{Config: r.tlsConfig}).DialContext(ctx, "tcp", srv)
+		} else {
+			conn, err = (&net.Dialer{}).DialContext(ctx, "udp", srv)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dial %q: %w", srv, err))
+			continue
+		}
+		_ = conn.Close()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("hep reporter: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Flush is a no-op for the HEP reporter — packets are sent immediately.
 func (r *HEPReporter) Flush(_ context.Context) error { return nil }
 
 // ─── Flow-stable routing ───────────────────────────────────────────────────
 
-// selectConn returns the UDP connection for the server that owns pkt's flow.
+// selectIndex returns the index of the server, out of n, that owns pkt's flow.
 //
 // The mapping is computed as:
 //
-//	idx = FNV-32a(srcIP‖srcPort‖dstIP‖dstPort‖protocol) % len(conns)
+//	idx = FNV-32a(srcIP‖srcPort‖dstIP‖dstPort‖protocol) % n
 //
 // Using FNV-32a (non-cryptographic, fast) is appropriate here — we only need
 // uniform distribution and stability, not security.
-func (r *HEPReporter) selectConn(pkt *core.OutputPacket) *net.UDPConn {
-	if len(r.conns) == 1 {
-		return r.conns[0]
+func selectIndex(pkt *core.OutputPacket, n int) int {
+	if n == 1 {
+		return 0
 	}
 
 	h := fnv.New32a()
@@ -240,6 +430,59 @@ func (r *HEPReporter) selectConn(pkt *core.OutputPacket) *net.UDPConn {
 
 	_, _ = h.Write([]byte{pkt.Protocol})
 
-	idx := h.Sum32() % uint32(len(r.conns))
-	return r.conns[idx]
+	return int(h.Sum32() % uint32(n))
+}
+
+// ─── TLS transport ─────────────────────────────────────────────────────────
+
+// tlsConn is a TLS stream to one server. Report may be called from several
+// pipelines at once, so writes are serialized to keep frames contiguous.
+// After a write error the connection is dropped and redialed on the next
+// write, so a collector restart costs the frames sent while it was down.
+type tlsConn struct {
+	addr   string
+	config *tls.Config
+
+	mu   sync.Mutex
+	conn *tls.Conn
+}
+
+func (c *tlsConn) dial() error {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: tlsDialTimeout},
+		Config:    c.config,
+	}
+	conn, err := dialer.Dial("tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn.(*tls.Conn)
+	return nil
+}
+
+func (c *tlsConn) write(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return err
+		}
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(tlsWriteTimeout))
+	if _, err := c.conn.Write(frame); err != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *tlsConn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+		c.conn = nil
+	}
 }
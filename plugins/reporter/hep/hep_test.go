@@ -1,10 +1,24 @@
 package hep
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
 	"net"
 	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -336,6 +350,57 @@ func TestEncode_Chunk49_To_Fallback(t *testing.T) {
 	}
 }
 
+// TestEncode_Chunk48_49_IPv6Fallback verifies IPv6 fallbacks bracket the address.
+func TestEncode_Chunk48_49_IPv6Fallback(t *testing.T) {
+	pkt := makePacket()
+	delete(pkt.Labels, core.LabelSIPFromURI)
+	delete(pkt.Labels, core.LabelSIPToURI)
+	pkt.SrcIP = netip.MustParseAddr("2001:db8::1")
+	pkt.DstIP = netip.MustParseAddr("2001:db8::2")
+
+	frame, _ := Encode(pkt, EncodeOptions{})
+	pf := parseFrame(t, frame)
+
+	if got, want := string(pf.chunks[chunkFrom]), "[2001:db8::1]:5060"; got != want {
+		t.Errorf("chunk 48 fallback = %q, want %q", got, want)
+	}
+	if got, want := string(pf.chunks[chunkTo]), "[2001:db8::2]:5060"; got != want {
+		t.Errorf("chunk 49 fallback = %q, want %q", got, want)
+	}
+}
+
+// TestEncode_Chunk50_Retention verifies chunk 50 carries the retention class
+// and is omitted without one.
+func TestEncode_Chunk50_Retention(t *testing.T) {
+	pkt := makePacket()
+	frame, _ := Encode(pkt, EncodeOptions{})
+	if _, ok := parseFrame(t, frame).chunks[chunkRetention]; ok {
+		t.Error("chunk 50 present without retention label")
+	}
+
+	pkt.Labels[core.LabelRetentionClass] = "30d"
+	frame, _ = Encode(pkt, EncodeOptions{})
+	if got := string(parseFrame(t, frame).chunks[chunkRetention]); got != "30d" {
+		t.Errorf("chunk 50 (retention) = %q, want %q", got, "30d")
+	}
+}
+
+// TestEncode_AgentMetadata verifies chunks 51–53 carry the agent_metadata
+// labels.
+func TestEncode_AgentMetadata(t *testing.T) {
+	pkt := makePacket()
+	pkt.Labels[core.LabelAgentVersion] = "1.4.2"
+	pkt.Labels[core.LabelAgentCommit] = "3f2a9c1"
+	pkt.Labels[core.LabelAgentConfigHash] = "0123456789abcdef"
+	frame, _ := Encode(pkt, EncodeOptions{})
+	pf := parseFrame(t, frame)
+	for chunk, want := range map[uint16]string{chunkAgentVer: "1.4.2", chunkAgentRev: "3f2a9c1", chunkConfHash: "0123456789abcdef"} {
+		if got := string(pf.chunks[chunk]); got != want {
+			t.Errorf("chunk %d = %q, want %q", chunk, got, want)
+		}
+	}
+}
+
 func TestEncode_NilPacket(t *testing.T) {
 	_, err := Encode(nil, EncodeOptions{})
 	if err == nil {
@@ -391,48 +456,37 @@ func TestInit_ValidConfig(t *testing.T) {
 
 // ─── Reporter flow-routing tests ───────────────────────────────────────────
 
-// TestSelectConn_SingleServer verifies it always returns the only connection.
-func TestSelectConn_SingleServer(t *testing.T) {
-	r := &HEPReporter{
-		conns: []*net.UDPConn{nil}, // nil ok — we only test selection logic
-	}
-	pkt := makePacket()
-	if got := r.selectConn(pkt); got != r.conns[0] {
-		t.Error("single-server: expected conns[0]")
+// TestSelectIndex_SingleServer verifies it always returns the only server.
+func TestSelectIndex_SingleServer(t *testing.T) {
+	if got := selectIndex(makePacket(), 1); got != 0 {
+		t.Errorf("single-server: selectIndex = %d, want 0", got)
 	}
 }
 
-// TestSelectConn_Stability verifies the same packet always maps to the same server.
-func TestSelectConn_Stability(t *testing.T) {
-	conns := make([]*net.UDPConn, 3)
-	r := &HEPReporter{conns: conns}
+// TestSelectIndex_Stability verifies the same packet always maps to the same server.
+func TestSelectIndex_Stability(t *testing.T) {
 	pkt := makePacket()
 
-	first := r.selectConn(pkt)
+	first := selectIndex(pkt, 3)
 	for i := 0; i < 20; i++ {
-		if r.selectConn(pkt) != first {
-			t.Fatal("selectConn returned different server for the same packet")
+		if selectIndex(pkt, 3) != first {
+			t.Fatal("selectIndex returned different server for the same packet")
 		}
 	}
 }
 
-// TestSelectConn_Distribution verifies different flows go to different servers.
-func TestSelectConn_Distribution(t *testing.T) {
-	conns := make([]*net.UDPConn, 4)
-	for i := range conns {
-		conns[i] = &net.UDPConn{} // distinct pointers
-	}
-	r := &HEPReporter{conns: conns}
-
-	seen := make(map[*net.UDPConn]bool)
+// TestSelectIndex_Distribution verifies different flows go to different servers.
+func TestSelectIndex_Distribution(t *testing.T) {
+	const servers = 4
+	seen := make(map[int]bool)
 	for srcPort := uint16(1024); srcPort < 1224; srcPort++ {
 		pkt := makePacket()
 		pkt.SrcPort = srcPort
-		seen[r.selectConn(pkt)] = true
+		seen[selectIndex(pkt, servers)] = true
 	}
 	// With 200 distinct source ports we expect all 4 servers to be used.
-	if len(seen) < len(conns) {
-		t.Errorf("only %d/%d servers used — distribution problem", len(seen), len(conns))
+	if len(seen) < servers {
+		t.Errorf("only %d/%d servers used — distribution problem", len(seen), servers)
 	}
 }
 
@@ -500,3 +554,436 @@ func TestReport_SendsHEPFrame(t *testing.T) {
 		t.Errorf("chunk 49 (to) = %q", got)
 	}
 }
+
+func TestHealthCheck_UDP(t *testing.T) {
+	for _, tc := range []struct {
+		server string
+		ok     bool
+	}{
+		{"127.0.0.1:9060", true},
+		{"127.0.0.1:no-such-port", false},
+		{"no-such-host.invalid:9060", false},
+	} {
+		r := NewHEPReporter().(*HEPReporter)
+		if err := r.Init(map[string]any{"servers": []any{tc.server}}); err != nil {
+			t.Fatalf("Init(%s): %v", tc.server, err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		err := r.HealthCheck(ctx)
+		cancel()
+		if (err == nil) != tc.ok {
+			t.Errorf("HealthCheck(%s) = %v, want ok %v", tc.server, err, tc.ok)
+		}
+	}
+}
+
+// ─── Rate limiting ─────────────────────────────────────────────────────────
+
+// TestTokenBucket verifies bursts are capped and tokens refill over time.
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := time.Unix(1000, 0)
+	if !b.allow(now) || !b.allow(now) {
+		t.Fatal("burst of 2 not admitted")
+	}
+	if b.allow(now) {
+		t.Fatal("third frame admitted within the burst")
+	}
+	if !b.allow(now.Add(100 * time.Millisecond)) {
+		t.Error("no token refilled after 100ms at 10/s")
+	}
+
+	later := now.Add(time.Hour)
+	admitted := 0
+	for b.allow(later) {
+		admitted++
+	}
+	if admitted != 2 {
+		t.Errorf("admitted %d frames after an idle hour, want the burst of 2", admitted)
+	}
+}
+
+// TestReport_RateLimited verifies frames over a server's limit are throttled
+// and counted.
+func TestReport_RateLimited(t *testing.T) {
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	r := NewHEPReporter().(*HEPReporter)
+	if err := r.Init(map[string]any{
+		"servers": []any{ln.LocalAddr().String()},
+		"rate_limit": map[string]any{
+			"frames_per_second": float64(0.001),
+			"burst":             float64(2),
+		},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer r.Stop(ctx) //nolint:errcheck
+
+	for i := 0; i < 2; i++ {
+		if err := r.Report(ctx, makePacket()); err != nil {
+			t.Fatalf("Report %d: %v", i, err)
+		}
+	}
+	if err := r.Report(ctx, makePacket()); !errors.Is(err, core.ErrThrottled) {
+		t.Fatalf("Report over the limit = %v, want core.ErrThrottled", err)
+	}
+	if r.sentCount.Load() != 2 || r.throttledCount.Load() != 1 {
+		t.Errorf("sent = %d, throttled = %d, want 2 and 1", r.sentCount.Load(), r.throttledCount.Load())
+	}
+}
+
+// TestInit_RateLimit verifies per-server overrides and validation.
+func TestInit_RateLimit(t *testing.T) {
+	r := NewHEPReporter().(*HEPReporter)
+	if err := r.Init(map[string]any{
+		"servers": []any{"10.0.0.1:9060", "10.0.0.2:9060"},
+		"rate_limit": map[string]any{
+			"servers": map[string]any{"10.0.0.2:9060": float64(500)},
+		},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if r.limiters[0] != nil {
+		t.Error("server without a limit got a token bucket")
+	}
+	if b := r.limiters[1]; b == nil || b.rate != 500 || b.burst != 500 {
+		t.Errorf("override bucket = %+v, want rate and burst 500", b)
+	}
+
+	for _, rl := range []map[string]any{
+		{"frames_per_second": float64(-1)},
+		{"burst": float64(0)},
+		{"servers": map[string]any{"10.0.0.9:9060": float64(10)}},
+		{"servers": []any{"10.0.0.1:9060"}},
+	} {
+		if err := NewHEPReporter().Init(map[string]any{
+			"servers":    []any{"10.0.0.1:9060"},
+			"rate_limit": rl,
+		}); err == nil {
+			t.Errorf("Init accepted rate_limit %v", rl)
+		}
+	}
+}
+
+// ─── Deduplication ─────────────────────────────────────────────────────────
+
+func sipPacket(ts time.Time, src string, firstLine, via, cseq, body string) *core.OutputPacket {
+	pkt := makePacket()
+	pkt.Timestamp = ts
+	pkt.SrcIP = netip.MustParseAddr(src)
+	pkt.RawPayload = []byte(firstLine + "\r\n" +
+		"Via: SIP/2.0/UDP " + via + ";branch=z9hG4bK-1\r\n" +
+		"Call-ID: abc-123@host\r\n" +
+		"From: <sip:alice@example.com>;tag=a1\r\n" +
+		"To: <sip:bob@example.com>\r\n" +
+		"CSeq:  " + cseq + "\r\n" +
+		"\r\n" + body)
+	if strings.HasPrefix(firstLine, "SIP/2.0 ") {
+		pkt.Labels[core.LabelSIPStatusCode] = firstLine[8:11]
+	} else {
+		pkt.Labels[core.LabelSIPMethod] = firstLine[:strings.IndexByte(firstLine, ' ')]
+	}
+	return pkt
+}
+
+// toTag sets the To tag of a packet built by sipPacket.
+func toTag(pkt *core.OutputPacket, tag string) *core.OutputPacket {
+	pkt.RawPayload = bytes.Replace(pkt.RawPayload, []byte("To: <sip:bob@example.com>"),
+		[]byte("t: <sip:bob@example.com;transport=udp> ; Tag = "+tag), 1)
+	return pkt
+}
+
+func TestTagParam(t *testing.T) {
+	for v, want := range map[string]string{
+		"<sip:bob@example.com>":                  "",
+		"<sip:bob@example.com;tag=uri>":          "",
+		"<sip:bob@example.com>;tag=b1":           "b1",
+		"Bob <sip:bob@example.com> ; TAG = b1;x": "b1",
+		"sip:bob@example.com;tag=b1":             "b1",
+	} {
+		if got := tagParam(v); got != want {
+			t.Errorf("tagParam(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestReport_Dedup(t *testing.T) {
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	r := NewHEPReporter().(*HEPReporter)
+	if err := r.Init(map[string]any{
+		"servers": []any{ln.LocalAddr().String()},
+		"dedup":   map[string]any{"window": "200ms"},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer r.Stop(ctx) //nolint:errcheck
+
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	const invite = "INVITE sip:bob@example.com SIP/2.0"
+	for _, tc := range []struct {
+		pkt  *core.OutputPacket
+		sent bool
+	}{
+		{sipPacket(base, "192.168.1.10", invite, "sbc.example.com", "1 INVITE", "v=0\r\n"), true},
+		// The same INVITE one hop later: other Via, other source
+		{sipPacket(base.Add(3*time.Millisecond), "10.0.0.5", invite, "proxy.example.com", "1 INVITE", "v=0\r\n"), false},
+		{sipPacket(base.Add(5*time.Millisecond), "10.0.0.1", "SIP/2.0 100 Trying", "sbc.example.com", "1 INVITE", ""), true},
+		{sipPacket(base.Add(6*time.Millisecond), "10.0.0.1", "SIP/2.0 180 Ringing", "sbc.example.com", "1 INVITE", ""), true},
+		// 180 of two forked branches: other To tags
+		{toTag(sipPacket(base.Add(6*time.Millisecond), "10.0.0.1", "SIP/2.0 180 Ringing", "sbc.example.com", "1 INVITE", ""), "b1"), true},
+		{toTag(sipPacket(base.Add(6*time.Millisecond), "10.0.0.1", "SIP/2.0 180 Ringing", "sbc.example.com", "1 INVITE", ""), "b2"), true},
+		{toTag(sipPacket(base.Add(8*time.Millisecond), "10.0.0.5", "SIP/2.0 180 Ringing", "proxy.example.com", "1 INVITE", ""), "b2"), false},
+		{sipPacket(base.Add(7*time.Millisecond), "10.0.0.1", invite, "sbc.example.com", "1 INVITE", "v=1\r\n"), true},
+		// Retransmission after the window
+		{sipPacket(base.Add(500*time.Millisecond), "192.168.1.10", invite, "sbc.example.com", "1 INVITE", "v=0\r\n"), true},
+	} {
+		before := r.sentCount.Load()
+		if err := r.Report(ctx, tc.pkt); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		if sent := r.sentCount.Load() > before; sent != tc.sent {
+			t.Errorf("%s at %v: sent = %v, want %v", tc.pkt.RawPayload[:18], tc.pkt.Timestamp.Sub(base), sent, tc.sent)
+		}
+	}
+	if r.dedupedCount.Load() != 2 {
+		t.Errorf("deduplicated = %d, want 2", r.dedupedCount.Load())
+	}
+
+	// Packets other than SIP are never deduplicated.
+	rtp := &core.OutputPacket{PayloadType: "rtp", Timestamp: base, Labels: core.Labels{core.LabelRTPCallID: "abc-123@host"}}
+	if r.dedup.duplicate(rtp) || r.dedup.duplicate(rtp) {
+		t.Error("RTP packet deduplicated")
+	}
+}
+
+func TestDedupFilter_ForgetAndCapacity(t *testing.T) {
+	f := DedupConfig{Window: time.Second, MaxEntries: 4}.filter()
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	pkt := func(cseq string) *core.OutputPacket {
+		return sipPacket(base, "192.168.1.10", "BYE sip:bob@example.com SIP/2.0", "a", cseq, "")
+	}
+
+	// A message that was not sent is sent again by its next copy.
+	f.duplicate(pkt("2 BYE"))
+	f.forget(pkt("2 BYE"))
+	if f.duplicate(pkt("2 BYE")) {
+		t.Error("forgotten message deduplicated")
+	}
+
+	// When full, the oldest messages are forgotten first.
+	f = DedupConfig{Window: time.Second, MaxEntries: 4}.filter()
+	for _, cseq := range []string{"3 BYE", "4 BYE", "5 BYE", "6 BYE"} {
+		f.duplicate(pkt(cseq))
+	}
+	if !f.duplicate(pkt("3 BYE")) || !f.duplicate(pkt("6 BYE")) {
+		t.Error("message within capacity not deduplicated")
+	}
+	f.duplicate(pkt("7 BYE"))
+	if f.duplicate(pkt("3 BYE")) || !f.duplicate(pkt("7 BYE")) {
+		t.Error("full filter did not forget its oldest messages")
+	}
+	if n := len(f.cur) + len(f.prev); n > 4 {
+		t.Errorf("full filter holds %d entries, want at most 4", n)
+	}
+}
+
+func TestDedupFilter_Generations(t *testing.T) {
+	f := DedupConfig{Window: time.Second, MaxEntries: 100}.filter()
+	base := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	pkt := func(cseq string, at time.Duration) *core.OutputPacket {
+		return sipPacket(base.Add(at), "192.168.1.10", "BYE sip:bob@example.com SIP/2.0", "a", cseq, "")
+	}
+
+	f.duplicate(pkt("1 BYE", 0))
+	f.duplicate(pkt("2 BYE", 900*time.Millisecond))
+	f.duplicate(pkt("3 BYE", 1200*time.Millisecond)) // starts a new generation
+	if !f.duplicate(pkt("2 BYE", 1500*time.Millisecond)) {
+		t.Error("copy within the window missed after a generation change")
+	}
+	if f.duplicate(pkt("1 BYE", 1500*time.Millisecond)) {
+		t.Error("copy after the window deduplicated")
+	}
+
+	// After two idle windows nothing is remembered: rotate clears both
+	// generations instead of keeping cur as prev.
+	f.duplicate(pkt("4 BYE", 5*time.Second))
+	if len(f.cur) != 1 || len(f.prev) != 0 {
+		t.Errorf("%d current and %d previous entries after idle windows, want 1 and 0", len(f.cur), len(f.prev))
+	}
+	if f.duplicate(pkt("3 BYE", 5*time.Second)) || !f.duplicate(pkt("4 BYE", 5500*time.Millisecond)) {
+		t.Error("filter after idle windows kept an old message or lost the new one")
+	}
+}
+
+func TestInit_Dedup(t *testing.T) {
+	r := NewHEPReporter().(*HEPReporter)
+	if err := r.Init(map[string]any{"servers": []any{"10.0.0.1:9060"}}); err != nil || r.dedup != nil {
+		t.Fatalf("Init without dedup: %v, filter %v", err, r.dedup)
+	}
+	for _, dc := range []map[string]any{
+		{},
+		{"window": "0s"},
+		{"window": "soon"},
+		{"window": "200ms", "max_entries": float64(0)},
+	} {
+		if err := NewHEPReporter().Init(map[string]any{
+			"servers": []any{"10.0.0.1:9060"},
+			"dedup":   dc,
+		}); err == nil {
+			t.Errorf("Init accepted dedup %v", dc)
+		}
+	}
+}
+
+func TestInit_InvalidTransport(t *testing.T) {
+	r := NewHEPReporter()
+	err := r.Init(map[string]any{"servers": []any{"127.0.0.1:9060"}, "transport": "tcp"})
+	if err == nil {
+		t.Error("expected error for unsupported transport")
+	}
+}
+
+// ─── Reporter end-to-end TLS test ──────────────────────────────────────────
+
+// selfSignedCert returns a certificate for 127.0.0.1 and writes it as a PEM
+// CA bundle to caFile.
+func selfSignedCert(t *testing.T) (cert tls.Certificate, caFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hep-collector"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile = filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, caFile
+}
+
+// TestReport_TLS sends two frames over a TLS stream and verifies both arrive
+// intact and back to back.
+func TestReport_TLS(t *testing.T) {
+	cert, caFile := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// Read two frames, delimited by the HEP length field.
+	received := make(chan [][]byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var frames [][]byte
+		for len(frames) < 2 {
+			hdr := make([]byte, 6)
+			if _, err := io.ReadFull(conn, hdr); err != nil {
+				return
+			}
+			frame := make([]byte, binary.BigEndian.Uint16(hdr[4:6]))
+			copy(frame, hdr)
+			if _, err := io.ReadFull(conn, frame[6:]); err != nil {
+				return
+			}
+			frames = append(frames, frame)
+		}
+		received <- frames
+	}()
+
+	r := NewHEPReporter()
+	if err := r.Init(map[string]any{
+		"servers":   []any{ln.Addr().String()},
+		"transport": "tls",
+		"tls":       map[string]any{"ca_cert": caFile},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	ctx := context.Background()
+	if err := r.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer r.Stop(ctx) //nolint:errcheck
+
+	for i := 0; i < 2; i++ {
+		if err := r.Report(ctx, makePacket()); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+	}
+
+	select {
+	case frames := <-received:
+		for _, frame := range frames {
+			if pf := parseFrame(t, frame); pf.magic != hepMagic {
+				t.Errorf("magic = %q, want %q", pf.magic, hepMagic)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for frames")
+	}
+}
+
+// TestStart_TLSUntrustedServer verifies certificate errors fail Start.
+func TestStart_TLSUntrustedServer(t *testing.T) {
+	cert, _ := selfSignedCert(t)
+	_, otherCA := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	r := NewHEPReporter()
+	if err := r.Init(map[string]any{
+		"servers":   []any{ln.Addr().String()},
+		"transport": "tls",
+		"tls":       map[string]any{"ca_cert": otherCA},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if err := r.Start(context.Background()); err == nil {
+		t.Error("Start succeeded against an untrusted certificate")
+	}
+}
@@ -0,0 +1,102 @@
+package hep
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig caps the frames sent to each server, so a collector sized
+// for a given rate is not flooded into dropping UDP. Frames over the limit
+// fail Report with core.ErrThrottled, which hands them to the reporter's
+// fallback (local spill) instead of losing them on the wire.
+type RateLimitConfig struct {
+	FramesPerSecond float64            `json:"frames_per_second"` // per server; 0 = unlimited
+	Burst           int                `json:"burst"`             // bucket size, default one second of frames
+	Servers         map[string]float64 `json:"servers"`           // server → frames_per_second override
+}
+
+// parseRateLimit reads the rate_limit reporter config for servers.
+func parseRateLimit(m map[string]any, servers []string) (RateLimitConfig, error) {
+	var rl RateLimitConfig
+	if v, ok := m["frames_per_second"].(float64); ok {
+		if v < 0 {
+			return rl, fmt.Errorf("rate_limit.frames_per_second must be >= 0")
+		}
+		rl.FramesPerSecond = v
+	}
+	if v, ok := m["burst"].(float64); ok {
+		if v < 1 || v != float64(int(v)) {
+			return rl, fmt.Errorf("rate_limit.burst must be a positive integer")
+		}
+		rl.Burst = int(v)
+	}
+	if v, ok := m["servers"]; ok {
+		raw, ok := v.(map[string]any)
+		if !ok {
+			return rl, fmt.Errorf("rate_limit.servers must be an object of server: frames_per_second")
+		}
+		rl.Servers = make(map[string]float64, len(raw))
+		for srv, v := range raw {
+			fps, ok := v.(float64)
+			if !ok || fps < 0 {
+				return rl, fmt.Errorf("rate_limit.servers.%s must be a number >= 0", srv)
+			}
+			if !slices.Contains(servers, srv) {
+				return rl, fmt.Errorf("rate_limit.servers: %q is not in servers", srv)
+			}
+			rl.Servers[srv] = fps
+		}
+	}
+	return rl, nil
+}
+
+// limiters returns one token bucket per server, nil for unlimited servers.
+func (rl RateLimitConfig) limiters(servers []string) []*tokenBucket {
+	buckets := make([]*tokenBucket, len(servers))
+	for i, srv := range servers {
+		fps := rl.FramesPerSecond
+		if v, ok := rl.Servers[srv]; ok {
+			fps = v
+		}
+		if fps == 0 {
+			continue
+		}
+		burst := rl.Burst
+		if burst == 0 {
+			burst = max(int(fps), 1)
+		}
+		buckets[i] = newTokenBucket(fps, burst)
+	}
+	return buckets
+}
+
+// tokenBucket admits rate frames per second with bursts of up to burst.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes a token if one is available at now.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
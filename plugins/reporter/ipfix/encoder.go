@@ -0,0 +1,241 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// IPFIX message layout (RFC 7011 §3):
+//
+//	Offset  Size  Description
+//	------  ----  -----------
+//	0       2     Version: 10
+//	2       2     Message length, including this header
+//	4       4     Export time, seconds since the epoch
+//	8       4     Sequence number: data records sent before this message
+//	12      4     Observation domain ID
+//	16      …     Sets
+//
+// Each set starts with a 4-byte header (set ID, length including the header).
+// Set ID 2 carries templates; IDs from 256 carry data records of the template
+// with that ID.
+const (
+	ipfixVersion    = 10
+	msgHeaderLen    = 16
+	setHeaderLen    = 4
+	templateSetID   = 2
+	templateIPv4ID  = 256
+	templateIPv6ID  = 257
+	varLen          = 65535 // field length of variable-length elements
+	enterpriseBit   = 0x8000
+	maxShortVarLen  = 254 // longer values use the 3-byte length prefix
+	maxVarValueLen  = 1024
+	defaultMaxBytes = 1400 // keeps messages within a 1500-byte MTU
+)
+
+// Information elements (IANA IPFIX registry) of the exported records.
+const (
+	ieOctetDeltaCount          = 1
+	iePacketDeltaCount         = 2
+	ieProtocolIdentifier       = 4
+	ieSourceTransportPort      = 7
+	ieSourceIPv4Address        = 8
+	ieDestinationTransportPort = 11
+	ieDestinationIPv4Address   = 12
+	ieSourceIPv6Address        = 27
+	ieDestinationIPv6Address   = 28
+	ieApplicationName          = 96
+	ieFlowEndReason            = 136
+	ieFlowStartMilliseconds    = 152
+	ieFlowEndMilliseconds      = 153
+
+	// ieCallID is the enterprise-specific element carrying the SIP Call-ID,
+	// under the enterprise number set by enterprise_number.
+	ieCallID = 1
+)
+
+// flowEndReason values (IANA registry).
+const (
+	endIdleTimeout   = 0x01
+	endActiveTimeout = 0x02
+	endForced        = 0x04
+)
+
+// field is one template field specifier.
+type field struct {
+	id         uint16
+	length     uint16
+	enterprise uint32 // 0 = IANA element
+}
+
+// templateFields returns the fields of the IPv4 or IPv6 template. The call_id
+// element is included only under an enterprise number.
+func templateFields(v6 bool, enterprise uint32) []field {
+	addrLen, src, dst := uint16(4), uint16(ieSourceIPv4Address), uint16(ieDestinationIPv4Address)
+	if v6 {
+		addrLen, src, dst = 16, ieSourceIPv6Address, ieDestinationIPv6Address
+	}
+	fields := []field{
+		{id: ieFlowStartMilliseconds, length: 8},
+		{id: ieFlowEndMilliseconds, length: 8},
+		{id: ieOctetDeltaCount, length: 8},
+		{id: iePacketDeltaCount, length: 8},
+		{id: src, length: addrLen},
+		{id: dst, length: addrLen},
+		{id: ieSourceTransportPort, length: 2},
+		{id: ieDestinationTransportPort, length: 2},
+		{id: ieProtocolIdentifier, length: 1},
+		{id: ieFlowEndReason, length: 1},
+		{id: ieApplicationName, length: varLen},
+	}
+	if enterprise != 0 {
+		fields = append(fields, field{id: ieCallID, length: varLen, enterprise: enterprise})
+	}
+	return fields
+}
+
+// appendTemplateSet appends a template set defining both templates.
+func appendTemplateSet(b []byte, enterprise uint32) []byte {
+	start := len(b)
+	b = binary.BigEndian.AppendUint16(b, templateSetID)
+	b = binary.BigEndian.AppendUint16(b, 0) // length, set below
+	for _, tmpl := range []struct {
+		id uint16
+		v6 bool
+	}{{templateIPv4ID, false}, {templateIPv6ID, true}} {
+		fields := templateFields(tmpl.v6, enterprise)
+		b = binary.BigEndian.AppendUint16(b, tmpl.id)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(fields)))
+		for _, f := range fields {
+			if f.enterprise != 0 {
+				b = binary.BigEndian.AppendUint16(b, f.id|enterpriseBit)
+				b = binary.BigEndian.AppendUint16(b, f.length)
+				b = binary.BigEndian.AppendUint32(b, f.enterprise)
+				continue
+			}
+			b = binary.BigEndian.AppendUint16(b, f.id)
+			b = binary.BigEndian.AppendUint16(b, f.length)
+		}
+	}
+	binary.BigEndian.PutUint16(b[start+2:], uint16(len(b)-start))
+	return b
+}
+
+// appendRecord appends the data record of a flow, in the field order of its
+// template.
+func appendRecord(b []byte, f *flow, reason uint8, enterprise uint32) []byte {
+	b = binary.BigEndian.AppendUint64(b, uint64(f.first.UnixMilli()))
+	b = binary.BigEndian.AppendUint64(b, uint64(f.last.UnixMilli()))
+	b = binary.BigEndian.AppendUint64(b, f.octets)
+	b = binary.BigEndian.AppendUint64(b, f.packets)
+	b = append(b, f.key.src.AsSlice()...)
+	b = append(b, f.key.dst.AsSlice()...)
+	b = binary.BigEndian.AppendUint16(b, f.key.srcPort)
+	b = binary.BigEndian.AppendUint16(b, f.key.dstPort)
+	b = append(b, f.key.proto, reason)
+	b = appendVarLen(b, f.app)
+	if enterprise != 0 {
+		b = appendVarLen(b, f.callID)
+	}
+	return b
+}
+
+// recordLen returns the encoded length of a flow's data record.
+func recordLen(f *flow, enterprise uint32) int {
+	n := 8*4 + 2*len(f.key.src.AsSlice()) + 2 + 2 + 1 + 1 + varLenSize(f.app)
+	if enterprise != 0 {
+		n += varLenSize(f.callID)
+	}
+	return n
+}
+
+// appendVarLen appends a variable-length value (RFC 7011 §7).
+func appendVarLen(b []byte, s string) []byte {
+	if len(s) > maxVarValueLen {
+		s = s[:maxVarValueLen]
+	}
+	if len(s) <= maxShortVarLen {
+		b = append(b, byte(len(s)))
+	} else {
+		b = append(b, 255)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	}
+	return append(b, s...)
+}
+
+func varLenSize(s string) int {
+	n := min(len(s), maxVarValueLen)
+	if n <= maxShortVarLen {
+		return 1 + n
+	}
+	return 3 + n
+}
+
+// messageBuilder packs templates and data records into messages of at most
+// maxBytes.
+type messageBuilder struct {
+	domainID   uint32
+	enterprise uint32
+	maxBytes   int
+
+	seq uint32 // data records exported so far
+
+	buf     []byte
+	setID   uint16 // template ID of the open data set; 0 = none
+	setAt   int    // offset of the open data set's header
+	records uint32 // data records in buf
+}
+
+// begin starts a message, with the template set when templates is true.
+func (m *messageBuilder) begin(templates bool) {
+	m.buf = append(m.buf[:0], make([]byte, msgHeaderLen)...)
+	m.setID, m.records = 0, 0
+	if templates {
+		m.buf = appendTemplateSet(m.buf, m.enterprise)
+	}
+}
+
+// add appends a flow's record to the current message. It returns false,
+// leaving the message unchanged, if the record does not fit.
+func (m *messageBuilder) add(f *flow, reason uint8) bool {
+	id := uint16(templateIPv4ID)
+	if f.key.src.Is6() {
+		id = templateIPv6ID
+	}
+	need := recordLen(f, m.enterprise)
+	if id != m.setID {
+		need += setHeaderLen
+	}
+	if len(m.buf)+need > m.maxBytes && m.records > 0 {
+		return false
+	}
+	if id != m.setID {
+		m.closeSet()
+		m.setID, m.setAt = id, len(m.buf)
+		m.buf = binary.BigEndian.AppendUint16(m.buf, id)
+		m.buf = binary.BigEndian.AppendUint16(m.buf, 0)
+	}
+	m.buf = appendRecord(m.buf, f, reason, m.enterprise)
+	m.records++
+	return true
+}
+
+func (m *messageBuilder) closeSet() {
+	if m.setID != 0 {
+		binary.BigEndian.PutUint16(m.buf[m.setAt+2:], uint16(len(m.buf)-m.setAt))
+		m.setID = 0
+	}
+}
+
+// finish completes the message header and returns the message, valid until
+// the next begin.
+func (m *messageBuilder) finish(now time.Time) []byte {
+	m.closeSet()
+	binary.BigEndian.PutUint16(m.buf[0:], ipfixVersion)
+	binary.BigEndian.PutUint16(m.buf[2:], uint16(len(m.buf)))
+	binary.BigEndian.PutUint32(m.buf[4:], uint32(now.Unix()))
+	binary.BigEndian.PutUint32(m.buf[8:], m.seq)
+	binary.BigEndian.PutUint32(m.buf[12:], m.domainID)
+	m.seq += m.records
+	return m.buf
+}
@@ -0,0 +1,392 @@
+// Package ipfix implements a reporter that aggregates packets into flows and
+// exports them as IPFIX (RFC 7011) records to a collector over UDP, giving
+// network teams standard flow telemetry from the same capture.
+//
+// A flow is a unidirectional 5-tuple. Each record carries the 5-tuple,
+// packet and octet counts, start and end times, the payload type as
+// applicationName and, under an enterprise number, the SIP Call-ID of the
+// flow. A flow is exported when it has been idle for idle_timeout, every
+// active_timeout while it stays active, and when the task stops. Packets
+// without a network context, e.g. rollup summaries or alerts, are skipped.
+//
+// Octet counts are rebuilt from the payload plus minimal IP and transport
+// headers, since packets do not carry the original frame; options and
+// payload cut by snap_len are not counted.
+//
+// Example task reporter configuration:
+//
+//	reporters:
+//	  - name: ipfix
+//	    config:
+//	      collector: "10.0.0.20:4739"
+//	      observation_domain_id: 7
+//	      idle_timeout: 15s
+//	      active_timeout: 60s
+//	      enterprise_number: 32473   # optional, exports call_id
+package ipfix
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultCollectorPort   = "4739"
+	defaultIdleTimeout     = 15 * time.Second
+	defaultActiveTimeout   = time.Minute
+	defaultTemplateRefresh = time.Minute
+	defaultMaxFlows        = 100000
+
+	expireInterval = time.Second
+)
+
+// Config represents IPFIX reporter configuration.
+type Config struct {
+	Collector           string        `json:"collector"`             // required, host[:port] (default port 4739)
+	ObservationDomainID uint32        `json:"observation_domain_id"` // default 0
+	IdleTimeout         time.Duration `json:"idle_timeout"`          // export flows idle this long, default 15s
+	ActiveTimeout       time.Duration `json:"active_timeout"`        // export long-lived flows this often, default 60s
+	TemplateRefresh     time.Duration `json:"template_refresh"`      // resend templates this often, default 60s
+	MaxFlows            int           `json:"max_flows"`             // tracked flows; packets of new flows beyond are dropped, default 100000
+	EnterpriseNumber    uint32        `json:"enterprise_number"`     // IANA PEN of the call_id element; 0 = no call_id
+}
+
+type flowKey struct {
+	src, dst         netip.Addr
+	srcPort, dstPort uint16
+	proto            uint8
+}
+
+// flow is one unidirectional flow being aggregated.
+type flow struct {
+	key     flowKey
+	first   time.Time // capture time of the first and last packet
+	last    time.Time
+	octets  uint64
+	packets uint64
+	app     string // payload type of the first packet
+	callID  string
+
+	started time.Time // wall clock, for active_timeout
+	seen    time.Time // wall clock, for idle_timeout
+}
+
+// IPFIXReporter exports flow records to an IPFIX collector.
+type IPFIXReporter struct {
+	name   string
+	config Config
+
+	mu           sync.Mutex
+	flows        map[flowKey]*flow
+	conn         net.Conn // nil until Start
+	msg          messageBuilder
+	templateSent time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	exported atomic.Uint64
+	dropped  atomic.Uint64
+	skipped  atomic.Uint64
+	errors   atomic.Uint64
+}
+
+// NewIPFIXReporter creates a new IPFIX reporter instance.
+func NewIPFIXReporter() plugin.Reporter {
+	return &IPFIXReporter{
+		name: "ipfix",
+		config: Config{
+			IdleTimeout:     defaultIdleTimeout,
+			ActiveTimeout:   defaultActiveTimeout,
+			TemplateRefresh: defaultTemplateRefresh,
+			MaxFlows:        defaultMaxFlows,
+		},
+		flows: make(map[flowKey]*flow),
+	}
+}
+
+// Name returns the plugin name.
+func (r *IPFIXReporter) Name() string {
+	return r.name
+}
+
+// Init initializes the reporter with configuration.
+func (r *IPFIXReporter) Init(config map[string]any) error {
+	if config == nil {
+		return fmt.Errorf("ipfix reporter: configuration is required")
+	}
+
+	collector, _ := config["collector"].(string)
+	if collector == "" {
+		return fmt.Errorf("ipfix reporter: collector is required")
+	}
+	if _, _, err := net.SplitHostPort(collector); err != nil {
+		collector = net.JoinHostPort(collector, defaultCollectorPort)
+	}
+	r.config.Collector = collector
+
+	for key, dst := range map[string]*uint32{
+		"observation_domain_id": &r.config.ObservationDomainID,
+		"enterprise_number":     &r.config.EnterpriseNumber,
+	} {
+		if v, ok := config[key].(float64); ok {
+			if v < 0 || v > 1<<32-1 || v != float64(uint32(v)) {
+				return fmt.Errorf("ipfix reporter: %s must be an integer in [0, %d], got %v", key, uint32(1<<32-1), v)
+			}
+			*dst = uint32(v)
+		}
+	}
+	for key, dst := range map[string]*time.Duration{
+		"idle_timeout":     &r.config.IdleTimeout,
+		"active_timeout":   &r.config.ActiveTimeout,
+		"template_refresh": &r.config.TemplateRefresh,
+	} {
+		v, ok := config[key].(string)
+		if !ok || v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("ipfix reporter: %s must be a positive duration, got %q", key, v)
+		}
+		*dst = d
+	}
+	if v, ok := config["max_flows"].(float64); ok {
+		if v < 1 {
+			return fmt.Errorf("ipfix reporter: max_flows must be >= 1, got %v", v)
+		}
+		r.config.MaxFlows = int(v)
+	}
+
+	r.msg = messageBuilder{
+		domainID:   r.config.ObservationDomainID,
+		enterprise: r.config.EnterpriseNumber,
+		maxBytes:   defaultMaxBytes,
+	}
+	return nil
+}
+
+// Start connects to the collector and starts exporting expired flows.
+func (r *IPFIXReporter) Start(_ context.Context) error {
+	addr, err := net.ResolveUDPAddr("udp", r.config.Collector)
+	if err != nil {
+		return fmt.Errorf("ipfix reporter: resolve %q: %w: %w", r.config.Collector, core.ErrTransient, err)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return fmt.Errorf("ipfix reporter: dial %q: %w: %w", r.config.Collector, core.ErrTransient, err)
+	}
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel, r.done = cancel, make(chan struct{})
+	go r.expireLoop(ctx)
+
+	slog.Info("ipfix reporter started",
+		"collector", r.config.Collector,
+		"observation_domain_id", r.config.ObservationDomainID,
+		"idle_timeout", r.config.IdleTimeout,
+		"active_timeout", r.config.ActiveTimeout)
+	return nil
+}
+
+// Stop closes the collector socket. Flows not yet exported by Flush are lost.
+func (r *IPFIXReporter) Stop(_ context.Context) error {
+	if r.cancel != nil {
+		r.cancel()
+		<-r.done
+		r.cancel = nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn != nil {
+		_ = r.conn.Close()
+		r.conn = nil
+	}
+	slog.Info("ipfix reporter stopped",
+		"exported", r.exported.Load(),
+		"dropped", r.dropped.Load(),
+		"skipped", r.skipped.Load(),
+		"errors", r.errors.Load())
+	return nil
+}
+
+// Report adds pkt to its flow.
+func (r *IPFIXReporter) Report(_ context.Context, pkt *core.OutputPacket) error {
+	if pkt == nil {
+		return fmt.Errorf("nil packet")
+	}
+	if !pkt.SrcIP.IsValid() || !pkt.DstIP.IsValid() || pkt.SrcIP.Unmap().Is4() != pkt.DstIP.Unmap().Is4() {
+		r.skipped.Add(1)
+		return nil
+	}
+
+	key := flowKey{
+		src:     pkt.SrcIP.Unmap(),
+		dst:     pkt.DstIP.Unmap(),
+		srcPort: pkt.SrcPort,
+		dstPort: pkt.DstPort,
+		proto:   pkt.Protocol,
+	}
+	ts := pkt.Timestamp
+	now := time.Now()
+	if ts.IsZero() {
+		ts = now
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.flows[key]
+	if !ok {
+		if len(r.flows) >= r.config.MaxFlows {
+			r.dropped.Add(1)
+			return nil
+		}
+		f = &flow{key: key, first: ts, app: pkt.PayloadType, started: now}
+		r.flows[key] = f
+	}
+	if ts.Before(f.first) {
+		f.first = ts
+	}
+	if ts.After(f.last) {
+		f.last = ts
+	}
+	f.packets++
+	f.octets += packetOctets(pkt)
+	f.seen = now
+	if f.callID == "" {
+		f.callID = pkt.CallID()
+	}
+	return nil
+}
+
+// Flush exports all flows, as when the task stops.
+func (r *IPFIXReporter) Flush(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.export(time.Now(), true)
+}
+
+// Pending returns the number of flows not yet exported.
+func (r *IPFIXReporter) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.flows)
+}
+
+func (r *IPFIXReporter) expireLoop(ctx context.Context) {
+	defer close(r.done)
+	ticker := time.NewTicker(expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			err := r.export(now, false)
+			r.mu.Unlock()
+			if err != nil {
+				slog.Warn("ipfix reporter: export failed", "collector", r.config.Collector, "error", err)
+			}
+		}
+	}
+}
+
+// export sends the flows that are idle or active for too long, or all flows
+// when all is true, and removes them. The caller holds r.mu.
+func (r *IPFIXReporter) export(now time.Time, all bool) error {
+	if r.conn == nil {
+		return nil
+	}
+	var firstErr error
+	open := false
+	send := func() {
+		msg := r.msg.finish(now)
+		if _, err := r.conn.Write(msg); err != nil {
+			r.errors.Add(1)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("ipfix reporter: send: %w", err)
+			}
+		}
+		open = false
+	}
+
+	for key, f := range r.flows {
+		var reason uint8
+		switch {
+		case all:
+			reason = endForced
+		case now.Sub(f.seen) >= r.config.IdleTimeout:
+			reason = endIdleTimeout
+		case now.Sub(f.started) >= r.config.ActiveTimeout:
+			reason = endActiveTimeout
+		default:
+			continue
+		}
+		if !open {
+			r.beginMessage(now)
+			open = true
+		}
+		if !r.msg.add(f, reason) {
+			send()
+			r.beginMessage(now)
+			open = true
+			r.msg.add(f, reason)
+		}
+		r.exported.Add(1)
+		delete(r.flows, key)
+	}
+	if open {
+		send()
+	}
+	return firstErr
+}
+
+// beginMessage starts a message, carrying the templates when they are due:
+// over UDP the collector may have missed or forgotten them (RFC 7011 §8.4).
+func (r *IPFIXReporter) beginMessage(now time.Time) {
+	templates := now.Sub(r.templateSent) >= r.config.TemplateRefresh
+	if templates {
+		r.templateSent = now
+	}
+	r.msg.begin(templates)
+}
+
+// packetOctets returns the IP length of pkt rebuilt from its payload. The
+// payload stripped by the rtp parser's payload_sample_packets is counted too.
+func packetOctets(pkt *core.OutputPacket) uint64 {
+	n := uint64(len(pkt.RawPayload))
+	if pkt.SrcIP.Unmap().Is4() {
+		n += 20
+	} else {
+		n += 40
+	}
+	switch pkt.Protocol {
+	case 6:
+		n += 20
+	case 17:
+		n += 8
+	}
+	if v := pkt.Labels[core.LabelRTPPayloadLen]; v != "" {
+		if l, err := strconv.ParseUint(v, 10, 64); err == nil {
+			n += l
+		}
+	}
+	return n
+}
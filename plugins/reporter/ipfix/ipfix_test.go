@@ -0,0 +1,277 @@
+package ipfix
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestIPFIXReporter_Init(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		wantErr bool
+	}{
+		{"minimal", map[string]any{"collector": "10.0.0.20"}, false},
+		{"full", map[string]any{"collector": "10.0.0.20:4739", "observation_domain_id": float64(7), "idle_timeout": "5s", "active_timeout": "30s", "template_refresh": "10s", "max_flows": float64(10), "enterprise_number": float64(32473)}, false},
+		{"nil config", nil, true},
+		{"no collector", map[string]any{}, true},
+		{"bad timeout", map[string]any{"collector": "10.0.0.20", "idle_timeout": "soon"}, true},
+		{"zero timeout", map[string]any{"collector": "10.0.0.20", "active_timeout": "0s"}, true},
+		{"bad max_flows", map[string]any{"collector": "10.0.0.20", "max_flows": float64(0)}, true},
+		{"bad domain", map[string]any{"collector": "10.0.0.20", "observation_domain_id": float64(-1)}, true},
+		{"fractional enterprise", map[string]any{"collector": "10.0.0.20", "enterprise_number": float64(1.5)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewIPFIXReporter().Init(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// record is a decoded data record.
+type record struct {
+	template         uint16
+	start, end       uint64
+	octets, packets  uint64
+	src, dst         netip.Addr
+	srcPort, dstPort uint16
+	proto, reason    uint8
+	app, callID      string
+}
+
+// message is a decoded IPFIX message.
+type message struct {
+	seq       uint32
+	domain    uint32
+	templates int // template records
+	records   []record
+}
+
+func decodeVarLen(b []byte) (string, []byte) {
+	n, b := int(b[0]), b[1:]
+	if n == 255 {
+		n, b = int(binary.BigEndian.Uint16(b)), b[2:]
+	}
+	return string(b[:n]), b[n:]
+}
+
+func decodeMessage(t *testing.T, b []byte, withCallID bool) message {
+	t.Helper()
+	if v := binary.BigEndian.Uint16(b[0:]); v != ipfixVersion {
+		t.Fatalf("version = %d", v)
+	}
+	if n := int(binary.BigEndian.Uint16(b[2:])); n != len(b) {
+		t.Fatalf("message length = %d, datagram %d", n, len(b))
+	}
+	m := message{seq: binary.BigEndian.Uint32(b[8:]), domain: binary.BigEndian.Uint32(b[12:])}
+	for rest := b[msgHeaderLen:]; len(rest) > 0; {
+		id, n := binary.BigEndian.Uint16(rest[0:]), int(binary.BigEndian.Uint16(rest[2:]))
+		set := rest[setHeaderLen:n]
+		rest = rest[n:]
+		if id == templateSetID {
+			for len(set) > 0 {
+				count := int(binary.BigEndian.Uint16(set[2:]))
+				set = set[4:]
+				for i := 0; i < count; i++ {
+					if binary.BigEndian.Uint16(set)&enterpriseBit != 0 {
+						set = set[4:]
+					}
+					set = set[4:]
+				}
+				m.templates++
+			}
+			continue
+		}
+		addrLen := 4
+		if id == templateIPv6ID {
+			addrLen = 16
+		}
+		for len(set) > 0 {
+			r := record{template: id}
+			r.start = binary.BigEndian.Uint64(set[0:])
+			r.end = binary.BigEndian.Uint64(set[8:])
+			r.octets = binary.BigEndian.Uint64(set[16:])
+			r.packets = binary.BigEndian.Uint64(set[24:])
+			set = set[32:]
+			r.src, _ = netip.AddrFromSlice(set[:addrLen])
+			r.dst, _ = netip.AddrFromSlice(set[addrLen : 2*addrLen])
+			set = set[2*addrLen:]
+			r.srcPort = binary.BigEndian.Uint16(set[0:])
+			r.dstPort = binary.BigEndian.Uint16(set[2:])
+			r.proto, r.reason = set[4], set[5]
+			r.app, set = decodeVarLen(set[6:])
+			if withCallID {
+				r.callID, set = decodeVarLen(set)
+			}
+			m.records = append(m.records, r)
+		}
+	}
+	return m
+}
+
+// startReporter starts a reporter exporting to a local collector socket.
+func startReporter(t *testing.T, config map[string]any) (*IPFIXReporter, *net.UDPConn) {
+	t.Helper()
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { collector.Close() })
+
+	config["collector"] = collector.LocalAddr().String()
+	r := NewIPFIXReporter().(*IPFIXReporter)
+	if err := r.Init(config); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Stop(context.Background()) })
+	return r, collector
+}
+
+func receive(t *testing.T, conn *net.UDPConn) []byte {
+	t.Helper()
+	buf := make([]byte, 65535)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func packet(src, dst string, ts time.Time, payloadLen int, labels core.Labels) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp:   ts,
+		SrcIP:       netip.MustParseAddr(src),
+		DstIP:       netip.MustParseAddr(dst),
+		SrcPort:     5060,
+		DstPort:     5062,
+		Protocol:    17,
+		PayloadType: "sip",
+		RawPayload:  make([]byte, payloadLen),
+		Labels:      labels,
+	}
+}
+
+func TestIPFIXReporter_Flush(t *testing.T) {
+	r, collector := startReporter(t, map[string]any{"observation_domain_id": float64(7), "enterprise_number": float64(32473)})
+	ctx := context.Background()
+	t0 := time.UnixMilli(1700000000000)
+
+	r.Report(ctx, packet("10.0.0.1", "10.0.0.2", t0, 100, core.Labels{core.LabelSIPCallID: "abc@host"}))
+	r.Report(ctx, packet("10.0.0.1", "10.0.0.2", t0.Add(time.Second), 50, nil))
+	r.Report(ctx, packet("2001:db8::1", "2001:db8::2", t0, 10, nil))
+	r.Report(ctx, &core.OutputPacket{PayloadType: "rollup"}) // no network context
+	if got := r.Pending(); got != 2 {
+		t.Errorf("Pending() = %d, want 2", got)
+	}
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := decodeMessage(t, receive(t, collector), true)
+	if m.domain != 7 || m.seq != 0 || m.templates != 2 {
+		t.Errorf("domain %d, seq %d, templates %d", m.domain, m.seq, m.templates)
+	}
+	if len(m.records) != 2 {
+		t.Fatalf("records = %d, want 2", len(m.records))
+	}
+	for _, rec := range m.records {
+		if rec.reason != endForced {
+			t.Errorf("reason = %d, want forced end", rec.reason)
+		}
+		switch rec.template {
+		case templateIPv4ID:
+			want := record{
+				template: templateIPv4ID,
+				start:    uint64(t0.UnixMilli()), end: uint64(t0.Add(time.Second).UnixMilli()),
+				octets: 2*(20+8) + 150, packets: 2,
+				src: netip.MustParseAddr("10.0.0.1"), dst: netip.MustParseAddr("10.0.0.2"),
+				srcPort: 5060, dstPort: 5062, proto: 17, reason: endForced,
+				app: "sip", callID: "abc@host",
+			}
+			if rec != want {
+				t.Errorf("IPv4 record = %+v, want %+v", rec, want)
+			}
+		case templateIPv6ID:
+			if rec.octets != 40+8+10 || rec.packets != 1 || rec.src != netip.MustParseAddr("2001:db8::1") || rec.callID != "" {
+				t.Errorf("IPv6 record = %+v", rec)
+			}
+		}
+	}
+	if r.skipped.Load() != 1 || r.Pending() != 0 {
+		t.Errorf("skipped %d, flows left %d", r.skipped.Load(), r.Pending())
+	}
+}
+
+func TestIPFIXReporter_Timeouts(t *testing.T) {
+	r, collector := startReporter(t, map[string]any{"idle_timeout": "10s", "active_timeout": "30s"})
+	ctx := context.Background()
+	r.Report(ctx, packet("10.0.0.1", "10.0.0.2", time.Time{}, 10, nil))
+	r.Report(ctx, packet("10.0.0.3", "10.0.0.4", time.Time{}, 10, nil))
+
+	r.mu.Lock()
+	r.flows[flowKey{src: netip.MustParseAddr("10.0.0.3"), dst: netip.MustParseAddr("10.0.0.4"), srcPort: 5060, dstPort: 5062, proto: 17}].seen = time.Now().Add(time.Minute)
+	r.export(time.Now().Add(15*time.Second), false) // first flow idle, second not
+	r.mu.Unlock()
+
+	m := decodeMessage(t, receive(t, collector), false)
+	if len(m.records) != 1 || m.records[0].reason != endIdleTimeout || m.records[0].src != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("records = %+v, want the idle flow", m.records)
+	}
+
+	r.mu.Lock()
+	r.export(time.Now().Add(45*time.Second), false)
+	r.mu.Unlock()
+
+	m = decodeMessage(t, receive(t, collector), false)
+	if len(m.records) != 1 || m.records[0].reason != endActiveTimeout {
+		t.Fatalf("records = %+v, want the active flow", m.records)
+	}
+	if m.seq != 1 || m.templates != 0 {
+		t.Errorf("seq %d, templates %d; want 1 and no template resend", m.seq, m.templates)
+	}
+}
+
+func TestIPFIXReporter_Limits(t *testing.T) {
+	r, collector := startReporter(t, map[string]any{"max_flows": float64(200)})
+	ctx := context.Background()
+	for i := range 250 {
+		src := netip.AddrFrom4([4]byte{10, 1, byte(i >> 8), byte(i)}).String()
+		r.Report(ctx, packet(src, "10.0.0.2", time.Time{}, 10, core.Labels{core.LabelRTPCallID: "call"}))
+	}
+	if r.dropped.Load() != 50 {
+		t.Errorf("dropped = %d, want 50", r.dropped.Load())
+	}
+	if err := r.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	total, messages := 0, 0
+	for total < 200 {
+		b := receive(t, collector)
+		if len(b) > defaultMaxBytes {
+			t.Errorf("message of %d bytes exceeds %d", len(b), defaultMaxBytes)
+		}
+		m := decodeMessage(t, b, false)
+		if m.seq != uint32(total) {
+			t.Errorf("seq = %d, want %d", m.seq, total)
+		}
+		total += len(m.records)
+		messages++
+	}
+	if total != 200 || messages < 2 {
+		t.Errorf("records %d in %d messages", total, messages)
+	}
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// envelopeFields are the top-level fields of the JSON value.
+var envelopeFields = []string{
+	"task_id", "agent_id", "pipeline_id", "timestamp",
+	"src_ip", "dst_ip", "src_port", "dst_port", "protocol", "payload_type",
+	"labels", "payload", "raw_payload", "raw_payload_len",
+	"stream_id", "stream", "removed_labels", // stream_context records
+}
+
+// FieldMapping reshapes the JSON value for downstream schemas: fields are
+// dropped, then renamed; labels likewise.
+type FieldMapping struct {
+	Rename        map[string]string `json:"rename"`         // envelope field → name in the value
+	Exclude       []string          `json:"exclude"`        // envelope fields left out
+	RenameLabels  map[string]string `json:"rename_labels"`  // label key → key in labels
+	ExcludeLabels []string          `json:"exclude_labels"` // regexps of label keys left out
+
+	excludeLabels []*regexp.Regexp
+}
+
+// parseFieldMapping reads the "fields" reporter config.
+func parseFieldMapping(m map[string]any) (FieldMapping, error) {
+	var fm FieldMapping
+	var err error
+	if fm.Rename, err = stringMap(m, "rename"); err != nil {
+		return fm, err
+	}
+	if fm.RenameLabels, err = stringMap(m, "rename_labels"); err != nil {
+		return fm, err
+	}
+	if fm.Exclude, err = stringList(m, "exclude"); err != nil {
+		return fm, err
+	}
+	if fm.ExcludeLabels, err = stringList(m, "exclude_labels"); err != nil {
+		return fm, err
+	}
+
+	for _, f := range fm.Exclude {
+		if !slices.Contains(envelopeFields, f) {
+			return fm, fmt.Errorf("fields.exclude: unknown field %q", f)
+		}
+	}
+	targets := make(map[string]string)
+	for _, f := range envelopeFields {
+		if _, renamed := fm.Rename[f]; !renamed && !slices.Contains(fm.Exclude, f) {
+			targets[f] = f
+		}
+	}
+	for from, to := range fm.Rename {
+		if !slices.Contains(envelopeFields, from) {
+			return fm, fmt.Errorf("fields.rename: unknown field %q", from)
+		}
+		if to == "" {
+			return fm, fmt.Errorf("fields.rename: empty name for %q", from)
+		}
+		if other, ok := targets[to]; ok {
+			return fm, fmt.Errorf("fields.rename: %q and %q both map to %q", from, other, to)
+		}
+		targets[to] = from
+	}
+
+	for _, expr := range fm.ExcludeLabels {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fm, fmt.Errorf("fields.exclude_labels: %w", err)
+		}
+		fm.excludeLabels = append(fm.excludeLabels, re)
+	}
+	return fm, nil
+}
+
+// isZero reports whether the mapping leaves the value unchanged.
+func (fm *FieldMapping) isZero() bool {
+	return len(fm.Rename) == 0 && len(fm.Exclude) == 0 &&
+		len(fm.RenameLabels) == 0 && len(fm.excludeLabels) == 0
+}
+
+// apply reshapes output in place. Labels are copied before they change.
+func (fm *FieldMapping) apply(output map[string]any) {
+	if labels, ok := output["labels"].(core.Labels); ok && (len(fm.RenameLabels) > 0 || len(fm.excludeLabels) > 0) {
+		output["labels"] = fm.mapLabels(labels)
+	}
+	if removed, ok := output["removed_labels"].([]string); ok && (len(fm.RenameLabels) > 0 || len(fm.excludeLabels) > 0) {
+		keys := make([]string, 0, len(removed))
+		for _, k := range removed {
+			if k, ok := fm.mapLabel(k); ok {
+				keys = append(keys, k)
+			}
+		}
+		output["removed_labels"] = keys
+	}
+	for _, f := range fm.Exclude {
+		delete(output, f)
+	}
+	for from, to := range fm.Rename {
+		if v, ok := output[from]; ok {
+			delete(output, from)
+			output[to] = v
+		}
+	}
+}
+
+func (fm *FieldMapping) mapLabels(labels core.Labels) core.Labels {
+	out := make(core.Labels, len(labels))
+	for k, v := range labels {
+		if k, ok := fm.mapLabel(k); ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// mapLabel returns the key of label k in the value, false if it is excluded.
+func (fm *FieldMapping) mapLabel(k string) (string, bool) {
+	if slices.ContainsFunc(fm.excludeLabels, func(re *regexp.Regexp) bool { return re.MatchString(k) }) {
+		return "", false
+	}
+	if to, ok := fm.RenameLabels[k]; ok {
+		return to, true
+	}
+	return k, true
+}
+
+func stringMap(m map[string]any, key string) (map[string]string, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	raw, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("fields.%s must be an object", key)
+	}
+	out := make(map[string]string, len(raw))
+	for k, v := range raw {
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("fields.%s.%s must be a string", key, k)
+		}
+		out[k] = s
+	}
+	return out, nil
+}
+
+func stringList(m map[string]any, key string) ([]string, error) {
+	v, ok := m[key]
+	if !ok {
+		return nil, nil
+	}
+	raw, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("fields.%s must be a list", key)
+	}
+	out := make([]string, len(raw))
+	for i, v := range raw {
+		s, ok := v.(string)
+		if !ok || s == "" {
+			return nil, fmt.Errorf("fields.%s[%d] must be a non-empty string", key, i)
+		}
+		out[i] = s
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func TestParseFieldMapping_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   string
+	}{
+		{"unknown field", map[string]any{"rename": map[string]any{"source": "src"}}, "unknown field"},
+		{"collision", map[string]any{"rename": map[string]any{"src_ip": "dst_ip"}}, "both map to"},
+		{"two renames", map[string]any{"rename": map[string]any{"src_ip": "addr", "dst_ip": "addr"}}, "both map to"},
+		{"bad exclude", map[string]any{"exclude": []any{"nope"}}, "unknown field"},
+		{"bad regexp", map[string]any{"exclude_labels": []any{"("}}, "exclude_labels"},
+		{"not a list", map[string]any{"exclude": "labels"}, "must be a list"},
+	}
+	for _, tt := range tests {
+		if _, err := parseFieldMapping(tt.fields); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// Renaming onto an excluded or renamed-away field is allowed
+	if _, err := parseFieldMapping(map[string]any{
+		"exclude": []any{"dst_ip"},
+		"rename":  map[string]any{"src_ip": "dst_ip", "task_id": "src_ip"},
+	}); err != nil {
+		t.Errorf("swap rename: %v", err)
+	}
+}
+
+func TestKafkaReporter_SerializeJSON_FieldMapping(t *testing.T) {
+	r := &KafkaReporter{}
+	if err := r.Init(map[string]any{
+		"brokers": []any{"localhost:9092"},
+		"topic":   "t",
+		"fields": map[string]any{
+			"rename":         map[string]any{"src_ip": "source_address"},
+			"exclude":        []any{"pipeline_id", "raw_payload"},
+			"rename_labels":  map[string]any{"sip.call_id": "call_id"},
+			"exclude_labels": []any{`^sip\.(from|to)_`},
+		},
+	}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	labels := core.Labels{
+		"sip.method":   "INVITE",
+		"sip.call_id":  "xyz789",
+		"sip.from_uri": "sip:alice@example.com",
+	}
+	data, err := r.serializeJSON(&core.OutputPacket{
+		TaskID:     "task-123",
+		PipelineID: 3,
+		SrcIP:      netip.MustParseAddr("2001:db8::1"),
+		Labels:     labels,
+		RawPayload: []byte("INVITE"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out["source_address"] != "2001:db8::1" {
+		t.Errorf("source_address = %v", out["source_address"])
+	}
+	for _, f := range []string{"src_ip", "pipeline_id", "raw_payload"} {
+		if _, ok := out[f]; ok {
+			t.Errorf("%s present, want excluded or renamed", f)
+		}
+	}
+	if out["raw_payload_len"] != float64(6) {
+		t.Errorf("raw_payload_len = %v, want 6", out["raw_payload_len"])
+	}
+	got, _ := out["labels"].(map[string]any)
+	if len(got) != 2 || got["call_id"] != "xyz789" || got["sip.method"] != "INVITE" {
+		t.Errorf("labels = %v, want sip.method and call_id", got)
+	}
+	if _, ok := labels["call_id"]; ok || len(labels) != 3 {
+		t.Errorf("packet labels modified: %v", labels)
+	}
+}
@@ -5,10 +5,13 @@ package kafka
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"strconv"
 	"sync/atomic"
 	"time"
@@ -16,7 +19,9 @@ import (
 	"github.com/segmentio/kafka-go"
 	"github.com/segmentio/kafka-go/compress"
 
+	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/tlspolicy"
 	"firestige.xyz/otus/pkg/plugin"
 )
 
@@ -29,12 +34,24 @@ const (
 	defaultProtocolFallback = "raw"
 )
 
+// Message key strategies (key_strategy).
+const (
+	keyStrategyFlow   = "flow"    // the 5-tuple
+	keyStrategyCallID = "call_id" // the call, 5-tuple for packets without one
+)
+
 // KafkaReporter sends packets to Kafka.
 type KafkaReporter struct {
 	name   string
 	writer *kafka.Writer
+	admin  topicAdmin // topic checks at Start; nil unless topic_check is set
 	config Config
 
+	streams *streamTable // nil unless stream_context is set
+
+	tlsPolicy *tlspolicy.Policy // agent-wide TLS policy, set before Init
+	tlsConfig *tls.Config       // built in Init; nil without TLS
+
 	// Statistics
 	reportedCount atomic.Uint64
 	errorCount    atomic.Uint64
@@ -60,6 +77,27 @@ type Config struct {
 	// "json" = JSON envelope (Phase 1 default)
 	// "binary" = future binary format via Payload interface (Phase 2)
 	Serialization string `json:"serialization"` // default "json"
+
+	// Partition key: flow (5-tuple) or call_id, which keeps the signaling
+	// and media of a call in one partition.
+	KeyStrategy string `json:"key_strategy"` // flow|call_id, default flow
+
+	// Reshaping of the JSON value (see fields.go)
+	Fields FieldMapping `json:"fields"`
+
+	// Topic checks at Start (see topics.go)
+	TopicCheck             string   `json:"topic_check"`              // none|check|create, default none
+	TopicProtocols         []string `json:"topic_protocols"`          // payload types routed with topic_prefix
+	TopicPartitions        int      `json:"topic_partitions"`         // for create, default 1
+	TopicReplicationFactor int      `json:"topic_replication_factor"` // for create, default 1
+
+	// Stream context mode (see streams.go)
+	StreamContext        bool          `json:"stream_context"`
+	StreamContextTypes   []string      `json:"stream_context_types"`   // default ["rtp"]
+	StreamContextRefresh time.Duration `json:"stream_context_refresh"` // default 30s
+
+	// TLS to the brokers; version and cipher suites follow the agent-wide policy.
+	TLS config.TLSConfig `json:"tls"`
 }
 
 // NewKafkaReporter creates a new Kafka reporter.
@@ -74,6 +112,11 @@ func (r *KafkaReporter) Name() string {
 	return r.name
 }
 
+// SetTLSPolicy implements plugin.TLSPolicyAware.
+func (r *KafkaReporter) SetTLSPolicy(p *tlspolicy.Policy) {
+	r.tlsPolicy = p
+}
+
 // Init initializes the reporter with configuration.
 func (r *KafkaReporter) Init(config map[string]any) error {
 	if config == nil {
@@ -87,6 +130,11 @@ func (r *KafkaReporter) Init(config map[string]any) error {
 		Compression:   defaultCompression,
 		MaxAttempts:   defaultMaxAttempts,
 		Serialization: defaultSerialization,
+		KeyStrategy:   keyStrategyFlow,
+
+		TopicCheck:             topicCheckNone,
+		TopicPartitions:        defaultTopicPartitions,
+		TopicReplicationFactor: defaultTopicReplicationFactor,
 	}
 
 	// Required: brokers
@@ -155,7 +203,98 @@ func (r *KafkaReporter) Init(config map[string]any) error {
 		}
 	}
 
+	// Optional: key_strategy
+	if strategy, ok := config["key_strategy"].(string); ok && strategy != "" {
+		switch strategy {
+		case keyStrategyFlow, keyStrategyCallID:
+			cfg.KeyStrategy = strategy
+		default:
+			return fmt.Errorf("invalid key_strategy: %s (must be flow or call_id)", strategy)
+		}
+	}
+
+	// Optional: field mapping of the JSON value
+	if fields, ok := config["fields"].(map[string]any); ok {
+		fm, err := parseFieldMapping(fields)
+		if err != nil {
+			return err
+		}
+		cfg.Fields = fm
+	}
+
+	// Optional: topic checks at Start
+	if check, ok := config["topic_check"].(string); ok && check != "" {
+		switch check {
+		case topicCheckNone, topicCheckVerify, topicCheckCreate:
+			cfg.TopicCheck = check
+		default:
+			return fmt.Errorf("invalid topic_check: %s (must be none, check or create)", check)
+		}
+	}
+	if protocols, ok := config["topic_protocols"].([]any); ok {
+		for i, p := range protocols {
+			proto, ok := p.(string)
+			if !ok || proto == "" {
+				return fmt.Errorf("invalid topic_protocols entry at index %d", i)
+			}
+			cfg.TopicProtocols = append(cfg.TopicProtocols, proto)
+		}
+	}
+	if partitions, ok := config["topic_partitions"].(float64); ok {
+		cfg.TopicPartitions = int(partitions)
+	}
+	if rf, ok := config["topic_replication_factor"].(float64); ok {
+		cfg.TopicReplicationFactor = int(rf)
+	}
+	if cfg.TopicCheck != topicCheckNone {
+		if cfg.TopicPrefix != "" && len(cfg.TopicProtocols) == 0 {
+			return fmt.Errorf("topic_protocols is required with topic_prefix when topic_check is %s", cfg.TopicCheck)
+		}
+		if cfg.TopicPartitions < 1 || cfg.TopicReplicationFactor < 1 {
+			return fmt.Errorf("topic_partitions and topic_replication_factor must be >= 1")
+		}
+	}
+
+	// Optional: stream context mode
+	if enabled, ok := config["stream_context"].(bool); ok {
+		cfg.StreamContext = enabled
+	}
+	cfg.StreamContextTypes = []string{"rtp"}
+	if types, ok := config["stream_context_types"].([]any); ok {
+		cfg.StreamContextTypes = nil
+		for i, t := range types {
+			pt, ok := t.(string)
+			if !ok || pt == "" {
+				return fmt.Errorf("invalid stream_context_types entry at index %d", i)
+			}
+			cfg.StreamContextTypes = append(cfg.StreamContextTypes, pt)
+		}
+	}
+	cfg.StreamContextRefresh = defaultStreamRefresh
+	if refresh, ok := config["stream_context_refresh"].(string); ok && refresh != "" {
+		d, err := time.ParseDuration(refresh)
+		if err != nil || d < time.Second {
+			return fmt.Errorf("invalid stream_context_refresh: %q (must be a duration of at least 1s)", refresh)
+		}
+		cfg.StreamContextRefresh = d
+	}
+
+	if tlsMap, ok := config["tls"].(map[string]any); ok {
+		cfg.TLS = tlspolicy.ParseConn(tlsMap)
+	}
+	tlsConfig, err := r.tlsPolicy.Client(cfg.TLS)
+	if err != nil {
+		return err
+	}
+	if cfg.TopicCheck != topicCheckNone {
+		r.admin = newClientAdmin(cfg.Brokers, tlsConfig)
+	}
+
 	r.config = cfg
+	r.tlsConfig = tlsConfig
+	if cfg.StreamContext {
+		r.streams = newStreamTable(cfg.StreamContextTypes, cfg.StreamContextRefresh)
+	}
 
 	// Create Kafka writer.
 	// Topic is always set per-message in Report()/ReportBatch() via resolveTopic() (ADR-027).
@@ -169,6 +308,9 @@ func (r *KafkaReporter) Init(config map[string]any) error {
 		MaxAttempts:  cfg.MaxAttempts,
 		Async:        false,
 	}
+	if tlsConfig != nil {
+		writerConfig.Dialer = &kafka.Dialer{Timeout: 10 * time.Second, DualStack: true, TLS: tlsConfig}
+	}
 
 	// Compression codec
 	switch cfg.Compression {
@@ -189,8 +331,13 @@ func (r *KafkaReporter) Init(config map[string]any) error {
 	return nil
 }
 
-// Start starts the reporter.
+// Start starts the reporter. With topic_check set, missing topics fail the
+// start (check) or are created first (create).
 func (r *KafkaReporter) Start(ctx context.Context) error {
+	if err := r.ensureTopics(ctx); err != nil {
+		return err
+	}
+
 	topicInfo := r.config.Topic
 	if r.config.TopicPrefix != "" {
 		topicInfo = r.config.TopicPrefix + "-{protocol}"
@@ -202,10 +349,27 @@ func (r *KafkaReporter) Start(ctx context.Context) error {
 		"batch_timeout", r.config.BatchTimeout,
 		"compression", r.config.Compression,
 		"serialization", r.config.Serialization,
+		"key_strategy", r.config.KeyStrategy,
+		"stream_context", r.config.StreamContext,
 	)
 	return nil
 }
 
+// HealthCheck implements plugin.HealthChecker: at least one broker must
+// accept a connection and, with TLS, complete the handshake.
+func (r *KafkaReporter) HealthCheck(ctx context.Context) error {
+	dialer := &kafka.Dialer{DualStack: true, TLS: r.tlsConfig}
+	var errs []error
+	for _, broker := range r.config.Brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("kafka reporter: no broker reachable: %w", errors.Join(errs...))
+}
+
 // Stop stops the reporter.
 func (r *KafkaReporter) Stop(ctx context.Context) error {
 	if r.writer != nil {
@@ -224,6 +388,20 @@ func (r *KafkaReporter) Stop(ctx context.Context) error {
 	return nil
 }
 
+// messageKey returns the partition key of pkt: with the call_id strategy
+// the call ID of the packet, otherwise (or without one) the flow as
+// "src:port-dst:port" with IPv6 addresses in brackets.
+func messageKey(pkt *core.OutputPacket, strategy string) []byte {
+	if strategy == keyStrategyCallID {
+		if id := pkt.CallID(); id != "" {
+			return []byte(id)
+		}
+	}
+	src := netip.AddrPortFrom(pkt.SrcIP, pkt.SrcPort)
+	dst := netip.AddrPortFrom(pkt.DstIP, pkt.DstPort)
+	return []byte(src.String() + "-" + dst.String())
+}
+
 // Report sends a packet to Kafka.
 // Envelope metadata is placed in Kafka Headers, payload data in Value (ADR-028).
 func (r *KafkaReporter) Report(ctx context.Context, pkt *core.OutputPacket) error {
@@ -231,35 +409,47 @@ func (r *KafkaReporter) Report(ctx context.Context, pkt *core.OutputPacket) erro
 		return fmt.Errorf("nil packet")
 	}
 
-	// Serialize payload to Value
-	value, err := r.serializeValue(pkt)
+	msg, err := r.buildMessage(pkt)
 	if err != nil {
 		r.errorCount.Add(1)
-		return fmt.Errorf("serialize packet failed: %w", err)
-	}
-
-	// Build Kafka message with envelope as Headers (ADR-028)
-	msg := kafka.Message{
-		Topic: r.resolveTopic(pkt),
-		Key:   []byte(fmt.Sprintf("%s:%d-%s:%d", pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)),
-		Value: value,
-		Time:  pkt.Timestamp,
+		return fmt.Errorf("serialize packet failed: %w: %w", core.ErrPermanent, err)
 	}
 
-	// Envelope → Kafka Headers
-	msg.Headers = r.buildHeaders(pkt)
-
 	// Send to Kafka
 	err = r.writer.WriteMessages(ctx, msg)
 	if err != nil {
 		r.errorCount.Add(1)
-		return fmt.Errorf("kafka write failed: %w", err)
+		r.streams.forget([]*core.OutputPacket{pkt})
+		return fmt.Errorf("kafka write failed: %w: %w", core.ErrTransient, err)
 	}
 
 	r.reportedCount.Add(1)
 	return nil
 }
 
+// buildMessage builds the Kafka message of pkt: envelope in headers, payload
+// in the value (ADR-028). Packets of stream_context payload types are sent
+// as open or delta records.
+func (r *KafkaReporter) buildMessage(pkt *core.OutputPacket) (kafka.Message, error) {
+	msg := kafka.Message{
+		Topic: r.resolveTopic(pkt),
+		Key:   messageKey(pkt, r.config.KeyStrategy),
+		Time:  pkt.Timestamp,
+	}
+	var err error
+	if rec, ok := r.streams.record(pkt); ok {
+		msg.Value, err = r.serializeStream(pkt, rec)
+		msg.Headers = r.buildStreamHeaders(pkt, rec)
+		if err != nil {
+			r.streams.forget([]*core.OutputPacket{pkt})
+		}
+	} else {
+		msg.Value, err = r.serializeValue(pkt)
+		msg.Headers = r.buildHeaders(pkt)
+	}
+	return msg, err
+}
+
 // resolveTopic returns the target topic for a packet (ADR-027).
 // With topic_prefix: "{prefix}-{protocol}" (e.g. "otus-sip", "otus-rtp").
 // With fixed topic: returns the configured topic directly.
@@ -274,6 +464,13 @@ func (r *KafkaReporter) resolveTopic(pkt *core.OutputPacket) string {
 	return r.config.Topic
 }
 
+// agentHeaders maps the agent_metadata labels to top-level headers.
+var agentHeaders = []struct{ label, key string }{
+	{core.LabelAgentVersion, "agent_version"},
+	{core.LabelAgentCommit, "agent_commit"},
+	{core.LabelAgentConfigHash, "config_hash"},
+}
+
 // buildHeaders creates Kafka headers from packet envelope metadata (ADR-028).
 // Envelope fields (task_id, agent_id, network context) go into headers so
 // Kafka Streams / consumers can filter without deserializing the value.
@@ -297,6 +494,18 @@ func (r *KafkaReporter) buildHeaders(pkt *core.OutputPacket) []kafka.Header {
 		headers = append(headers, kafka.Header{Key: "l." + k, Value: []byte(v)})
 	}
 
+	// Retention hint as a top-level header for storage tiers
+	if class := pkt.Labels[core.LabelRetentionClass]; class != "" {
+		headers = append(headers, kafka.Header{Key: "retention", Value: []byte(class)})
+	}
+
+	// Agent build (agent_metadata) as top-level headers
+	for _, h := range agentHeaders {
+		if v := pkt.Labels[h.label]; v != "" {
+			headers = append(headers, kafka.Header{Key: h.key, Value: []byte(v)})
+		}
+	}
+
 	return headers
 }
 
@@ -315,22 +524,18 @@ func (r *KafkaReporter) serializeValue(pkt *core.OutputPacket) ([]byte, error) {
 	}
 }
 
-// serializeJSON converts OutputPacket payload to JSON bytes.
+// serializeJSON converts OutputPacket payload to JSON bytes, reshaped by
+// the fields mapping.
 func (r *KafkaReporter) serializeJSON(pkt *core.OutputPacket) ([]byte, error) {
-	output := map[string]any{
-		"task_id":      pkt.TaskID,
-		"agent_id":     pkt.AgentID,
-		"pipeline_id":  pkt.PipelineID,
-		"timestamp":    pkt.Timestamp.UnixMilli(),
-		"src_ip":       pkt.SrcIP.String(),
-		"dst_ip":       pkt.DstIP.String(),
-		"src_port":     pkt.SrcPort,
-		"dst_port":     pkt.DstPort,
-		"protocol":     pkt.Protocol,
-		"payload_type": pkt.PayloadType,
-		"labels":       pkt.Labels,
+	output := jsonValue(pkt)
+	if !r.config.Fields.isZero() {
+		r.config.Fields.apply(output)
 	}
+	return json.Marshal(output)
+}
 
+// addPayload adds the typed and raw payload of pkt to a JSON value.
+func addPayload(output map[string]any, pkt *core.OutputPacket) {
 	// Typed payload (e.g. future structured types; SIP parser returns nil — labels carry
 	// the SIP metadata, raw bytes are preserved below).
 	if pkt.Payload != nil {
@@ -342,8 +547,26 @@ func (r *KafkaReporter) serializeJSON(pkt *core.OutputPacket) ([]byte, error) {
 		output["raw_payload"] = base64.StdEncoding.EncodeToString(pkt.RawPayload)
 		output["raw_payload_len"] = len(pkt.RawPayload)
 	}
+}
 
-	return json.Marshal(output)
+// jsonValue returns the fields of the JSON value of pkt.
+func jsonValue(pkt *core.OutputPacket) map[string]any {
+	output := map[string]any{
+		"task_id":      pkt.TaskID,
+		"agent_id":     pkt.AgentID,
+		"pipeline_id":  pkt.PipelineID,
+		"timestamp":    pkt.Timestamp.UnixMilli(),
+		"src_ip":       pkt.SrcIP.String(),
+		"dst_ip":       pkt.DstIP.String(),
+		"src_port":     pkt.SrcPort,
+		"dst_port":     pkt.DstPort,
+		"protocol":     pkt.Protocol,
+		"payload_type": pkt.PayloadType,
+		"labels":       pkt.Labels,
+	}
+
+	addPayload(output, pkt)
+	return output
 }
 
 // Flush forces any pending messages to be sent.
@@ -360,20 +583,13 @@ func (r *KafkaReporter) ReportBatch(ctx context.Context, pkts []*core.OutputPack
 			continue
 		}
 
-		value, err := r.serializeValue(pkt)
+		msg, err := r.buildMessage(pkt)
 		if err != nil {
 			r.errorCount.Add(1)
 			slog.Debug("batch serialize skip", "error", err)
 			continue
 		}
-
-		msgs = append(msgs, kafka.Message{
-			Topic:   r.resolveTopic(pkt),
-			Key:     []byte(fmt.Sprintf("%s:%d-%s:%d", pkt.SrcIP, pkt.SrcPort, pkt.DstIP, pkt.DstPort)),
-			Value:   value,
-			Time:    pkt.Timestamp,
-			Headers: r.buildHeaders(pkt),
-		})
+		msgs = append(msgs, msg)
 	}
 
 	if len(msgs) == 0 {
@@ -382,7 +598,8 @@ func (r *KafkaReporter) ReportBatch(ctx context.Context, pkts []*core.OutputPack
 
 	if err := r.writer.WriteMessages(ctx, msgs...); err != nil {
 		r.errorCount.Add(uint64(len(msgs)))
-		return fmt.Errorf("kafka batch write failed (%d msgs): %w", len(msgs), err)
+		r.streams.forget(pkts)
+		return fmt.Errorf("kafka batch write failed (%d msgs): %w: %w", len(msgs), core.ErrTransient, err)
 	}
 
 	r.reportedCount.Add(uint64(len(msgs)))
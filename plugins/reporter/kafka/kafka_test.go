@@ -2,12 +2,17 @@ package kafka
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"net/netip"
 	"testing"
 	"time"
 
+	"github.com/segmentio/kafka-go"
+
+	"firestige.xyz/otus/internal/config"
 	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/tlspolicy"
 )
 
 // ─── Init Tests ───
@@ -158,6 +163,39 @@ func TestKafkaReporter_ConfigDefaults(t *testing.T) {
 	}
 }
 
+func TestKafkaReporter_TLSPolicy(t *testing.T) {
+	policy, err := tlspolicy.New(config.TLSPolicyConfig{MinVersion: "1.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewKafkaReporter().(*KafkaReporter)
+	r.SetTLSPolicy(policy)
+	if err := r.Init(map[string]any{
+		"brokers": []any{"localhost:9093"},
+		"topic":   "test-topic",
+		"tls":     map[string]any{"enabled": true},
+	}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	transport, ok := r.writer.Transport.(*kafka.Transport)
+	if !ok || transport.TLS == nil {
+		t.Fatalf("writer transport = %#v, want TLS transport", r.writer.Transport)
+	}
+	if transport.TLS.MinVersion != tls.VersionTLS13 {
+		t.Errorf("MinVersion = %x, want TLS 1.3 from the policy", transport.TLS.MinVersion)
+	}
+
+	err = NewKafkaReporter().Init(map[string]any{
+		"brokers": []any{"localhost:9093"},
+		"topic":   "test-topic",
+		"tls":     map[string]any{"enabled": true, "ca_cert": "/nonexistent/ca.pem"},
+	})
+	if err == nil {
+		t.Error("Init succeeded with a missing CA bundle")
+	}
+}
+
 // ─── Topic Routing Tests (ADR-027) ───
 
 func TestKafkaReporter_ResolveTopic_FixedTopic(t *testing.T) {
@@ -269,6 +307,99 @@ func TestKafkaReporter_BuildHeaders_NoLabels(t *testing.T) {
 	}
 }
 
+func TestKafkaReporter_BuildHeaders_Retention(t *testing.T) {
+	r := &KafkaReporter{}
+	pkt := &core.OutputPacket{
+		Timestamp: time.Now(),
+		Labels:    core.Labels{core.LabelRetentionClass: "3d"},
+	}
+
+	hdr := make(map[string]string)
+	for _, h := range r.buildHeaders(pkt) {
+		hdr[h.Key] = string(h.Value)
+	}
+	if hdr["retention"] != "3d" {
+		t.Errorf("header[retention] = %q, want 3d", hdr["retention"])
+	}
+	if hdr["l."+core.LabelRetentionClass] != "3d" {
+		t.Errorf("header[l.%s] missing", core.LabelRetentionClass)
+	}
+}
+
+func TestKafkaReporter_BuildHeaders_AgentMetadata(t *testing.T) {
+	r := &KafkaReporter{}
+	pkt := &core.OutputPacket{
+		Timestamp: time.Now(),
+		Labels: core.Labels{
+			core.LabelAgentVersion:    "1.4.2",
+			core.LabelAgentCommit:     "3f2a9c1",
+			core.LabelAgentConfigHash: "0123456789abcdef",
+		},
+	}
+
+	hdr := make(map[string]string)
+	for _, h := range r.buildHeaders(pkt) {
+		hdr[h.Key] = string(h.Value)
+	}
+	if hdr["agent_version"] != "1.4.2" || hdr["agent_commit"] != "3f2a9c1" || hdr["config_hash"] != "0123456789abcdef" {
+		t.Errorf("headers = %v, want agent_version, agent_commit and config_hash", hdr)
+	}
+}
+
+func TestKafkaReporter_MessageKey(t *testing.T) {
+	tests := []struct {
+		src, dst string
+		want     string
+	}{
+		{"10.0.0.1", "10.0.0.2", "10.0.0.1:5060-10.0.0.2:5062"},
+		{"2001:db8::1", "2001:db8::2", "[2001:db8::1]:5060-[2001:db8::2]:5062"},
+	}
+	for _, tt := range tests {
+		pkt := &core.OutputPacket{
+			SrcIP:   netip.MustParseAddr(tt.src),
+			DstIP:   netip.MustParseAddr(tt.dst),
+			SrcPort: 5060,
+			DstPort: 5062,
+		}
+		if got := string(messageKey(pkt, keyStrategyFlow)); got != tt.want {
+			t.Errorf("messageKey = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestKafkaReporter_MessageKey_CallID(t *testing.T) {
+	flow := func(labels core.Labels) *core.OutputPacket {
+		return &core.OutputPacket{
+			SrcIP:   netip.MustParseAddr("10.0.0.1"),
+			DstIP:   netip.MustParseAddr("10.0.0.2"),
+			SrcPort: 40000,
+			DstPort: 40002,
+			Labels:  labels,
+		}
+	}
+	tests := []struct {
+		name string
+		pkt  *core.OutputPacket
+		want string
+	}{
+		{"sip", flow(core.Labels{core.LabelSIPCallID: "call-1"}), "call-1"},
+		{"rtp", flow(core.Labels{core.LabelRTPCallID: "call-1"}), "call-1"},
+		{"rtcp", flow(core.Labels{core.LabelRTCPCallID: "call-1"}), "call-1"},
+		{"uncorrelated", flow(core.Labels{core.LabelRTPSSRC: "0x00001111"}), "10.0.0.1:40000-10.0.0.2:40002"},
+	}
+	for _, tt := range tests {
+		if got := string(messageKey(tt.pkt, keyStrategyCallID)); got != tt.want {
+			t.Errorf("%s: messageKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if err := NewKafkaReporter().Init(map[string]any{
+		"brokers": []any{"localhost:9092"}, "topic": "t", "key_strategy": "ssrc",
+	}); err == nil {
+		t.Error("Init accepted key_strategy ssrc")
+	}
+}
+
 // ─── Serialization Tests ───
 
 func TestKafkaReporter_SerializeJSON(t *testing.T) {
@@ -0,0 +1,224 @@
+package kafka
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// Stream context mode (stream_context). Most labels of an RTP packet repeat
+// those of the previous packet of its stream: only rtp.seq, rtp.timestamp
+// and the like change. The first packet of a stream is sent as an "open"
+// record, the usual value plus a stream ID; later packets as "delta"
+// records carrying the stream ID, the timestamp, the labels that changed
+// and the payload. Every stream_context_refresh the next packet is sent as
+// an open record again, so consumers that start late or lost a message
+// resynchronise.
+//
+// Records of a stream share the message key (both key strategies), so they
+// are in one partition and in order.
+const (
+	defaultStreamRefresh = 30 * time.Second
+
+	streamOpen  = "open"
+	streamDelta = "delta"
+)
+
+// streamKey identifies a stream.
+type streamKey struct {
+	taskID      string
+	pipelineID  int
+	payloadType string
+	src, dst    netip.AddrPort
+	protocol    uint8
+	ssrc        string
+	callID      string // may change the message key
+}
+
+// streamState is what consumers know of a stream.
+type streamState struct {
+	id     string
+	labels core.Labels // as last sent
+	opened time.Time   // packet time of the last open record
+	last   time.Time   // packet time of the last record
+}
+
+// streamRecord is how one packet is sent.
+type streamRecord struct {
+	id      string
+	open    bool
+	labels  core.Labels // delta records: changed and added labels
+	removed []string    // delta records: labels no longer present
+}
+
+// streamTable tracks the streams of the stream_context payload types.
+type streamTable struct {
+	types   []string
+	refresh time.Duration
+
+	mu      sync.Mutex
+	prefix  string // random per reporter, so IDs are not reused after a restart
+	next    uint64
+	streams map[streamKey]*streamState
+	swept   time.Time
+}
+
+func newStreamTable(types []string, refresh time.Duration) *streamTable {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return &streamTable{
+		types:   types,
+		refresh: refresh,
+		prefix:  hex.EncodeToString(b),
+		streams: make(map[streamKey]*streamState),
+	}
+}
+
+func (t *streamTable) key(pkt *core.OutputPacket) streamKey {
+	return streamKey{
+		taskID:      pkt.TaskID,
+		pipelineID:  pkt.PipelineID,
+		payloadType: pkt.PayloadType,
+		src:         netip.AddrPortFrom(pkt.SrcIP, pkt.SrcPort),
+		dst:         netip.AddrPortFrom(pkt.DstIP, pkt.DstPort),
+		protocol:    pkt.Protocol,
+		ssrc:        pkt.Labels[core.LabelRTPSSRC],
+		callID:      pkt.CallID(),
+	}
+}
+
+// record returns how pkt is sent and records it as sent; ok is false for
+// payload types without stream context. A nil table has none.
+func (t *streamTable) record(pkt *core.OutputPacket) (rec streamRecord, ok bool) {
+	if t == nil || !slices.Contains(t.types, pkt.PayloadType) {
+		return rec, false
+	}
+	ts := pkt.Timestamp
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(ts)
+
+	key := t.key(pkt)
+	s := t.streams[key]
+	if s == nil {
+		t.next++
+		s = &streamState{id: t.prefix + "-" + strconv.FormatUint(t.next, 16)}
+		t.streams[key] = s
+	}
+	if s.labels == nil || ts.Sub(s.opened) >= t.refresh || ts.Before(s.opened) {
+		s.labels = maps.Clone(pkt.Labels)
+		s.opened, s.last = ts, ts
+		return streamRecord{id: s.id, open: true}, true
+	}
+
+	rec = streamRecord{id: s.id, labels: make(core.Labels)}
+	for k, v := range pkt.Labels {
+		if old, ok := s.labels[k]; !ok || old != v {
+			rec.labels[k] = v
+			s.labels[k] = v
+		}
+	}
+	for k := range s.labels {
+		if _, ok := pkt.Labels[k]; !ok {
+			rec.removed = append(rec.removed, k)
+			delete(s.labels, k)
+		}
+	}
+	slices.Sort(rec.removed)
+	s.last = ts
+	return rec, true
+}
+
+// forget drops the streams of pkts, whose records may not have reached
+// the brokers: their next packets open the streams again.
+func (t *streamTable) forget(pkts []*core.OutputPacket) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, pkt := range pkts {
+		if pkt != nil && slices.Contains(t.types, pkt.PayloadType) {
+			delete(t.streams, t.key(pkt))
+		}
+	}
+}
+
+// sweep drops streams idle for a refresh interval, about once per interval.
+// Their next packet would be sent as an open record anyway.
+func (t *streamTable) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.refresh {
+		return
+	}
+	t.swept = now
+	for key, s := range t.streams {
+		if now.Sub(s.last) >= t.refresh {
+			delete(t.streams, key)
+		}
+	}
+}
+
+// serializeStream returns the JSON value of a stream record. Open records
+// are the usual value; delta records carry only the timestamp, the changed
+// labels, the removed label keys and the payload.
+func (r *KafkaReporter) serializeStream(pkt *core.OutputPacket, rec streamRecord) ([]byte, error) {
+	var output map[string]any
+	if rec.open {
+		output = jsonValue(pkt)
+		output["stream"] = streamOpen
+	} else {
+		output = map[string]any{
+			"timestamp": pkt.Timestamp.UnixMilli(),
+			"labels":    rec.labels,
+			"stream":    streamDelta,
+		}
+		if len(rec.removed) > 0 {
+			output["removed_labels"] = rec.removed
+		}
+		addPayload(output, pkt)
+	}
+	output["stream_id"] = rec.id
+	if !r.config.Fields.isZero() {
+		r.config.Fields.apply(output)
+	}
+	return json.Marshal(output)
+}
+
+// buildStreamHeaders returns the headers of a stream record: those of
+// buildHeaders for open records; for delta records task_id, payload_type,
+// timestamp and the changed labels.
+func (r *KafkaReporter) buildStreamHeaders(pkt *core.OutputPacket, rec streamRecord) []kafka.Header {
+	var headers []kafka.Header
+	if rec.open {
+		headers = r.buildHeaders(pkt)
+	} else {
+		headers = make([]kafka.Header, 0, 5+len(rec.labels))
+		headers = append(headers,
+			kafka.Header{Key: "task_id", Value: []byte(pkt.TaskID)},
+			kafka.Header{Key: "payload_type", Value: []byte(pkt.PayloadType)},
+			kafka.Header{Key: "timestamp", Value: []byte(strconv.FormatInt(pkt.Timestamp.UnixMilli(), 10))},
+		)
+		for k, v := range rec.labels {
+			headers = append(headers, kafka.Header{Key: "l." + k, Value: []byte(v)})
+		}
+	}
+	kind := streamDelta
+	if rec.open {
+		kind = streamOpen
+	}
+	return append(headers,
+		kafka.Header{Key: "stream_id", Value: []byte(rec.id)},
+		kafka.Header{Key: "stream", Value: []byte(kind)},
+	)
+}
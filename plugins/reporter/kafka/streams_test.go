@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+func rtpPacket(ts time.Time, seq string) *core.OutputPacket {
+	return &core.OutputPacket{
+		TaskID:      "task-1",
+		Timestamp:   ts,
+		SrcIP:       netip.MustParseAddr("10.0.0.1"),
+		DstIP:       netip.MustParseAddr("10.0.0.2"),
+		SrcPort:     20000,
+		DstPort:     30000,
+		Protocol:    17,
+		PayloadType: "rtp",
+		Labels: core.Labels{
+			core.LabelRTPSSRC:  "0x12345678",
+			core.LabelRTPCodec: "PCMU",
+			core.LabelRTPSeq:   seq,
+		},
+		RawPayload: []byte{0x80, 0x00},
+	}
+}
+
+func newStreamReporter(t *testing.T, extra map[string]any) *KafkaReporter {
+	t.Helper()
+	cfg := map[string]any{
+		"brokers":        []any{"localhost:9092"},
+		"topic":          "otus",
+		"stream_context": true,
+	}
+	for k, v := range extra {
+		cfg[k] = v
+	}
+	r := NewKafkaReporter().(*KafkaReporter)
+	if err := r.Init(cfg); err != nil {
+		t.Fatalf("Init() error: %v", err)
+	}
+	return r
+}
+
+func decodeValue(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var v map[string]any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestStreamContext_OpenAndDelta(t *testing.T) {
+	r := newStreamReporter(t, map[string]any{"stream_context_refresh": "10s"})
+	base := time.Unix(1700000000, 0)
+
+	open, err := r.buildMessage(rtpPacket(base, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := decodeValue(t, open.Value)
+	id, _ := v["stream_id"].(string)
+	if v["stream"] != streamOpen || id == "" || v["src_ip"] != "10.0.0.1" || v["labels"].(map[string]any)[core.LabelRTPCodec] != "PCMU" {
+		t.Errorf("open record = %v", v)
+	}
+
+	pkt := rtpPacket(base.Add(20*time.Millisecond), "2")
+	delete(pkt.Labels, core.LabelRTPCodec)
+	delta, err := r.buildMessage(pkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v = decodeValue(t, delta.Value)
+	labels := v["labels"].(map[string]any)
+	if v["stream"] != streamDelta || v["stream_id"] != id || len(labels) != 1 || labels[core.LabelRTPSeq] != "2" {
+		t.Errorf("delta record = %v", v)
+	}
+	if removed, _ := v["removed_labels"].([]any); len(removed) != 1 || removed[0] != core.LabelRTPCodec {
+		t.Errorf("removed_labels = %v", v["removed_labels"])
+	}
+	if _, ok := v["src_ip"]; ok || v["raw_payload"] == nil {
+		t.Errorf("delta record = %v, want no envelope and the payload", v)
+	}
+	if len(delta.Headers) >= len(open.Headers) || string(delta.Key) != string(open.Key) {
+		t.Errorf("delta headers %d (open %d), key %q (open %q)", len(delta.Headers), len(open.Headers), delta.Key, open.Key)
+	}
+
+	// After the refresh interval the stream is opened again, same ID.
+	again, _ := r.buildMessage(rtpPacket(base.Add(10*time.Second), "3"))
+	if v := decodeValue(t, again.Value); v["stream"] != streamOpen || v["stream_id"] != id {
+		t.Errorf("refresh record = %v", v)
+	}
+
+	// Other payload types are unaffected.
+	sip, _ := r.buildMessage(&core.OutputPacket{PayloadType: "sip", Timestamp: base, Labels: core.Labels{}})
+	if _, ok := decodeValue(t, sip.Value)["stream"]; ok {
+		t.Error("sip packet sent as a stream record")
+	}
+}
+
+func TestStreamContext_ForgetAndNewStreams(t *testing.T) {
+	r := newStreamReporter(t, nil)
+	base := time.Unix(1700000000, 0)
+
+	first, _ := r.buildMessage(rtpPacket(base, "1"))
+	id := decodeValue(t, first.Value)["stream_id"]
+
+	// A failed write forgets the stream: the next packet opens a new one.
+	pkt := rtpPacket(base.Add(time.Millisecond), "2")
+	r.buildMessage(pkt)
+	r.streams.forget([]*core.OutputPacket{pkt})
+	msg, _ := r.buildMessage(rtpPacket(base.Add(2*time.Millisecond), "3"))
+	v := decodeValue(t, msg.Value)
+	if v["stream"] != streamOpen || v["stream_id"] == id {
+		t.Errorf("record after forget = %v, want a new stream", v)
+	}
+
+	// Another SSRC on the same 5-tuple is another stream.
+	other := rtpPacket(base.Add(3*time.Millisecond), "1")
+	other.Labels[core.LabelRTPSSRC] = "0x87654321"
+	msg, _ = r.buildMessage(other)
+	if v := decodeValue(t, msg.Value); v["stream"] != streamOpen {
+		t.Errorf("new SSRC record = %v", v)
+	}
+	if len(r.streams.streams) != 2 {
+		t.Errorf("%d streams tracked, want 2", len(r.streams.streams))
+	}
+
+	// Idle streams are swept after the refresh interval.
+	r.buildMessage(rtpPacket(base.Add(time.Minute), "4"))
+	if len(r.streams.streams) != 1 {
+		t.Errorf("%d streams tracked after sweep, want 1", len(r.streams.streams))
+	}
+}
+
+func TestStreamContext_FieldMapping(t *testing.T) {
+	r := newStreamReporter(t, map[string]any{
+		"fields": map[string]any{
+			"rename_labels":  map[string]any{core.LabelRTPCodec: "codec"},
+			"exclude_labels": []any{`^rtp\.marker$`},
+		},
+	})
+	base := time.Unix(1700000000, 0)
+	first := rtpPacket(base, "1")
+	first.Labels[core.LabelRTPMarker] = "true"
+	r.buildMessage(first)
+
+	pkt := rtpPacket(base.Add(time.Millisecond), "2")
+	delete(pkt.Labels, core.LabelRTPCodec)
+	msg, _ := r.buildMessage(pkt)
+	removed, _ := decodeValue(t, msg.Value)["removed_labels"].([]any)
+	if len(removed) != 1 || removed[0] != "codec" {
+		t.Errorf("removed_labels = %v, want [codec]", removed)
+	}
+}
+
+func TestStreamContext_InitErrors(t *testing.T) {
+	for _, extra := range []map[string]any{
+		{"stream_context_refresh": "10ms"},
+		{"stream_context_types": []any{""}},
+	} {
+		cfg := map[string]any{"brokers": []any{"localhost:9092"}, "topic": "otus", "stream_context": true}
+		for k, v := range extra {
+			cfg[k] = v
+		}
+		if err := NewKafkaReporter().Init(cfg); err == nil || !strings.Contains(err.Error(), "stream_context") {
+			t.Errorf("Init(%v) = %v, want a stream_context error", extra, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"firestige.xyz/otus/internal/core"
+)
+
+// Topic checks at Start (topic_check): with topic_prefix routing a missing
+// per-protocol topic only shows up as write errors once that protocol is
+// seen, so the expected topics can be verified, or created, up front.
+const (
+	topicCheckNone   = "none"   // default: no check
+	topicCheckVerify = "check"  // fail Start if a topic is missing
+	topicCheckCreate = "create" // create missing topics, fail Start on error
+
+	defaultTopicPartitions        = 1
+	defaultTopicReplicationFactor = 1
+	topicCheckTimeout             = 10 * time.Second
+)
+
+// topicAdmin is the subset of the Kafka admin API used for topic checks.
+type topicAdmin interface {
+	// missingTopics returns the topics that do not exist.
+	missingTopics(ctx context.Context, topics []string) ([]string, error)
+	createTopics(ctx context.Context, topics []kafka.TopicConfig) error
+}
+
+// clientAdmin implements topicAdmin with a kafka-go Client.
+type clientAdmin struct {
+	client *kafka.Client
+}
+
+func newClientAdmin(brokers []string, tlsConfig *tls.Config) *clientAdmin {
+	client := &kafka.Client{
+		Addr:    kafka.TCP(brokers...),
+		Timeout: topicCheckTimeout,
+	}
+	if tlsConfig != nil {
+		client.Transport = &kafka.Transport{TLS: tlsConfig}
+	}
+	return &clientAdmin{client: client}
+}
+
+func (a *clientAdmin) missingTopics(ctx context.Context, topics []string) ([]string, error) {
+	resp, err := a.client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+	if err != nil {
+		return nil, fmt.Errorf("metadata request failed: %w", err)
+	}
+
+	found := make(map[string]bool, len(resp.Topics))
+	for _, t := range resp.Topics {
+		switch {
+		case t.Error == nil:
+			found[t.Name] = true
+		case errors.Is(t.Error, kafka.UnknownTopicOrPartition):
+		default:
+			return nil, fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+	}
+
+	var missing []string
+	for _, topic := range topics {
+		if !found[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	return missing, nil
+}
+
+func (a *clientAdmin) createTopics(ctx context.Context, topics []kafka.TopicConfig) error {
+	resp, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: topics})
+	if err != nil {
+		return fmt.Errorf("create topics request failed: %w", err)
+	}
+	for topic, err := range resp.Errors {
+		// Another agent may have created it concurrently.
+		if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			return fmt.Errorf("create topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// expectedTopics lists the topics this reporter writes to: the fixed topic,
+// or one topic per configured protocol with topic_prefix.
+func (r *KafkaReporter) expectedTopics() []string {
+	if r.config.TopicPrefix == "" {
+		return []string{r.config.Topic}
+	}
+	topics := make([]string, 0, len(r.config.TopicProtocols))
+	for _, proto := range r.config.TopicProtocols {
+		topics = append(topics, r.config.TopicPrefix+"-"+proto)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// ensureTopics verifies (topic_check: check) or creates (topic_check: create)
+// the expected topics.
+func (r *KafkaReporter) ensureTopics(ctx context.Context) error {
+	if r.config.TopicCheck == topicCheckNone {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, topicCheckTimeout)
+	defer cancel()
+
+	topics := r.expectedTopics()
+	missing, err := r.admin.missingTopics(ctx, topics)
+	if err != nil {
+		return fmt.Errorf("kafka topic check failed: %w: %w", core.ErrTransient, err)
+	}
+	if len(missing) == 0 {
+		slog.Debug("kafka topics present", "topics", topics)
+		return nil
+	}
+
+	if r.config.TopicCheck == topicCheckVerify {
+		return fmt.Errorf("kafka topics missing: %v: %w", missing, core.ErrConfig)
+	}
+
+	configs := make([]kafka.TopicConfig, len(missing))
+	for i, topic := range missing {
+		configs[i] = kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     r.config.TopicPartitions,
+			ReplicationFactor: r.config.TopicReplicationFactor,
+		}
+	}
+	if err := r.admin.createTopics(ctx, configs); err != nil {
+		return fmt.Errorf("kafka topic creation failed: %w: %w", core.ErrTransient, err)
+	}
+	slog.Info("kafka topics created",
+		"topics", missing,
+		"partitions", r.config.TopicPartitions,
+		"replication_factor", r.config.TopicReplicationFactor)
+	return nil
+}
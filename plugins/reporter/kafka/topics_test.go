@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeAdmin is an in-memory topicAdmin.
+type fakeAdmin struct {
+	existing map[string]bool
+	created  []kafka.TopicConfig
+	err      error
+}
+
+func (f *fakeAdmin) missingTopics(_ context.Context, topics []string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	var missing []string
+	for _, topic := range topics {
+		if !f.existing[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	return missing, nil
+}
+
+func (f *fakeAdmin) createTopics(_ context.Context, topics []kafka.TopicConfig) error {
+	f.created = append(f.created, topics...)
+	for _, t := range topics {
+		f.existing[t.Topic] = true
+	}
+	return nil
+}
+
+func newTopicCheckReporter(t *testing.T, config map[string]any, admin *fakeAdmin) *KafkaReporter {
+	t.Helper()
+	r := NewKafkaReporter().(*KafkaReporter)
+	config["brokers"] = []any{"localhost:9092"}
+	if err := r.Init(config); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	r.admin = admin
+	return r
+}
+
+func TestEnsureTopics_CheckFailsOnMissing(t *testing.T) {
+	admin := &fakeAdmin{existing: map[string]bool{"otus-sip": true}}
+	r := newTopicCheckReporter(t, map[string]any{
+		"topic_prefix":    "otus",
+		"topic_check":     "check",
+		"topic_protocols": []any{"sip", "rtp"},
+	}, admin)
+
+	err := r.Start(context.Background())
+	if err == nil {
+		t.Fatal("Start() should fail when otus-rtp is missing")
+	}
+	if len(admin.created) != 0 {
+		t.Errorf("check mode created topics: %v", admin.created)
+	}
+
+	admin.existing["otus-rtp"] = true
+	if err := r.Start(context.Background()); err != nil {
+		t.Errorf("Start() error with all topics present: %v", err)
+	}
+}
+
+func TestEnsureTopics_CreateMissing(t *testing.T) {
+	admin := &fakeAdmin{existing: map[string]bool{"otus-sip": true}}
+	r := newTopicCheckReporter(t, map[string]any{
+		"topic_prefix":             "otus",
+		"topic_check":              "create",
+		"topic_protocols":          []any{"sip", "rtp", "raw"},
+		"topic_partitions":         float64(6),
+		"topic_replication_factor": float64(3),
+	}, admin)
+
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+	want := []kafka.TopicConfig{
+		{Topic: "otus-raw", NumPartitions: 6, ReplicationFactor: 3},
+		{Topic: "otus-rtp", NumPartitions: 6, ReplicationFactor: 3},
+	}
+	if !reflect.DeepEqual(admin.created, want) {
+		t.Errorf("created = %+v, want %+v", admin.created, want)
+	}
+}
+
+func TestEnsureTopics_FixedTopicAndErrors(t *testing.T) {
+	admin := &fakeAdmin{existing: map[string]bool{}, err: errors.New("connection refused")}
+	r := newTopicCheckReporter(t, map[string]any{
+		"topic":       "otus-all",
+		"topic_check": "check",
+	}, admin)
+
+	if got := r.expectedTopics(); !reflect.DeepEqual(got, []string{"otus-all"}) {
+		t.Errorf("expectedTopics() = %v", got)
+	}
+	if err := r.Start(context.Background()); err == nil {
+		t.Error("Start() should fail when the broker is unreachable")
+	}
+}
+
+func TestTopicCheckConfig_Invalid(t *testing.T) {
+	for name, config := range map[string]map[string]any{
+		"bad mode":            {"topic": "t", "topic_check": "maybe"},
+		"prefix no protos":    {"topic_prefix": "otus", "topic_check": "check"},
+		"zero partitions":     {"topic": "t", "topic_check": "create", "topic_partitions": float64(0)},
+		"non-string protocol": {"topic_prefix": "otus", "topic_check": "check", "topic_protocols": []any{1}},
+	} {
+		config["brokers"] = []any{"localhost:9092"}
+		if err := NewKafkaReporter().Init(config); err == nil {
+			t.Errorf("%s: expected Init error", name)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package pcap implements a reporter that archives packets into rotating pcap
+// files, optionally with the time and call-id indexes of internal/pcaparchive
+// so "otus pcap extract" can pull single calls out of large archives.
+//
+// Packets carry the application payload and the 5-tuple but not the original
+// frame, so each one is written as a rebuilt IPv4/IPv6 + UDP/TCP packet
+// (LINKTYPE_RAW). Packets without a network context, e.g. rollup summaries or
+// alerts, are skipped.
+//
+// Example task reporter configuration:
+//
+//	reporters:
+//	  - name: pcap
+//	    config:
+//	      dir: /var/lib/otus/archive
+//	      rotate_size_mb: 256
+//	      rotate_interval: 1h
+//	      index: true
+package pcap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/pcaparchive"
+	"firestige.xyz/otus/internal/rebuild"
+	"firestige.xyz/otus/pkg/plugin"
+)
+
+const (
+	defaultPrefix         = "otus"
+	defaultRotateSizeMB   = 256
+	defaultRotateInterval = time.Hour
+
+	// fileTimeFormat names archive files by the time they were opened, so
+	// lexical order is time order.
+	fileTimeFormat = "20060102T150405.000000000Z"
+)
+
+// Config represents pcap reporter configuration.
+type Config struct {
+	Dir            string        `json:"dir"`             // required, archive directory
+	Prefix         string        `json:"prefix"`          // file name prefix, default "otus"
+	RotateSize     int64         `json:"rotate_size_mb"`  // start a new file after this many MB, default 256
+	RotateInterval time.Duration `json:"rotate_interval"` // start a new file after this long, default 1h
+	Index          bool          `json:"index"`           // write .tidx / .cidx sidecars, default true
+	IndexInterval  time.Duration `json:"index_interval"`  // time index spacing, default 1s
+}
+
+// PcapReporter writes packets into an indexed pcap archive.
+type PcapReporter struct {
+	name   string
+	config Config
+
+	mu       sync.Mutex
+	writer   *pcaparchive.Writer // current file; nil until the first packet
+	openedAt time.Time
+	buf      gopacket.SerializeBuffer
+
+	written atomic.Uint64
+	skipped atomic.Uint64
+}
+
+// NewPcapReporter creates a new pcap reporter instance.
+func NewPcapReporter() plugin.Reporter {
+	return &PcapReporter{
+		name: "pcap",
+		config: Config{
+			Prefix:         defaultPrefix,
+			RotateSize:     defaultRotateSizeMB << 20,
+			RotateInterval: defaultRotateInterval,
+			Index:          true,
+			IndexInterval:  pcaparchive.DefaultIndexInterval,
+		},
+		buf: gopacket.NewSerializeBuffer(),
+	}
+}
+
+// Name returns the plugin name.
+func (r *PcapReporter) Name() string {
+	return r.name
+}
+
+// Init initializes the reporter with configuration.
+func (r *PcapReporter) Init(config map[string]any) error {
+	if config == nil {
+		return fmt.Errorf("pcap reporter: configuration is required")
+	}
+
+	dir, _ := config["dir"].(string)
+	if dir == "" {
+		return fmt.Errorf("pcap reporter: dir is required")
+	}
+	r.config.Dir = dir
+
+	if v, ok := config["prefix"].(string); ok && v != "" {
+		if filepath.Base(v) != v {
+			return fmt.Errorf("pcap reporter: prefix %q must not contain a path separator", v)
+		}
+		r.config.Prefix = v
+	}
+	if v, ok := config["rotate_size_mb"].(float64); ok {
+		if v < 1 {
+			return fmt.Errorf("pcap reporter: rotate_size_mb must be >= 1, got %v", v)
+		}
+		r.config.RotateSize = int64(v) << 20
+	}
+	for key, dst := range map[string]*time.Duration{
+		"rotate_interval": &r.config.RotateInterval,
+		"index_interval":  &r.config.IndexInterval,
+	} {
+		v, ok := config[key].(string)
+		if !ok || v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("pcap reporter: %s must be a positive duration, got %q", key, v)
+		}
+		*dst = d
+	}
+	if v, ok := config["index"].(bool); ok {
+		r.config.Index = v
+	}
+	return nil
+}
+
+// Start creates the archive directory.
+func (r *PcapReporter) Start(_ context.Context) error {
+	if err := os.MkdirAll(r.config.Dir, 0o750); err != nil {
+		return fmt.Errorf("pcap reporter: create directory %q: %w: %w", r.config.Dir, core.ErrConfig, err)
+	}
+	slog.Info("pcap reporter started", "dir", r.config.Dir, "index", r.config.Index)
+	return nil
+}
+
+// Stop closes the current archive file, writing its call index.
+func (r *PcapReporter) Stop(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.closeFile()
+	slog.Info("pcap reporter stopped", "written", r.written.Load(), "skipped", r.skipped.Load())
+	return err
+}
+
+// Report appends pkt to the current archive file, rotating it first when it
+// is full or old enough.
+func (r *PcapReporter) Report(_ context.Context, pkt *core.OutputPacket) error {
+	if pkt == nil {
+		return fmt.Errorf("nil packet")
+	}
+	if !pkt.SrcIP.IsValid() || !pkt.DstIP.IsValid() || len(pkt.RawPayload) == 0 {
+		r.skipped.Add(1)
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	frame, err := rebuild.Packet(r.buf, pkt)
+	if err != nil {
+		r.skipped.Add(1)
+		return fmt.Errorf("pcap reporter: %w: %w", core.ErrPermanent, err)
+	}
+	if err := r.rotate(time.Now()); err != nil {
+		return err
+	}
+
+	ts := pkt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	if err := r.writer.WritePacket(ts, frame, pkt.CallID()); err != nil {
+		return fmt.Errorf("pcap reporter: %w", err)
+	}
+	r.written.Add(1)
+	return nil
+}
+
+// Flush writes buffered packets to the current archive file.
+func (r *PcapReporter) Flush(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil {
+		return nil
+	}
+	return r.writer.Flush()
+}
+
+// rotate opens a new archive file when there is none or the current one
+// reached rotate_size_mb or rotate_interval.
+func (r *PcapReporter) rotate(now time.Time) error {
+	if r.writer != nil && r.writer.Size() < r.config.RotateSize && now.Sub(r.openedAt) < r.config.RotateInterval {
+		return nil
+	}
+	if err := r.closeFile(); err != nil {
+		slog.Warn("pcap reporter: closing archive file failed", "error", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.pcap", r.config.Prefix, now.UTC().Format(fileTimeFormat))
+	w, err := pcaparchive.Create(filepath.Join(r.config.Dir, name), r.config.Index, r.config.IndexInterval)
+	if err != nil {
+		return fmt.Errorf("pcap reporter: %w", err)
+	}
+	r.writer, r.openedAt = w, now
+	slog.Debug("pcap reporter: archive file opened", "path", w.Path())
+	return nil
+}
+
+func (r *PcapReporter) closeFile() error {
+	if r.writer == nil {
+		return nil
+	}
+	w := r.writer
+	r.writer = nil
+	if err := w.Close(); err != nil {
+		return err
+	}
+	slog.Debug("pcap reporter: archive file closed", "path", w.Path(), "packets", w.Packets())
+	return nil
+}
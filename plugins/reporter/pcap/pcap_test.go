@@ -0,0 +1,196 @@
+package pcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+
+	"firestige.xyz/otus/internal/core"
+	"firestige.xyz/otus/internal/pcaparchive"
+)
+
+func newTestReporter(t *testing.T, config map[string]any) *PcapReporter {
+	t.Helper()
+	r := NewPcapReporter().(*PcapReporter)
+	if err := r.Init(config); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	if err := r.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	return r
+}
+
+func sipPacket(callID string, ts time.Time) *core.OutputPacket {
+	return &core.OutputPacket{
+		Timestamp:   ts,
+		SrcIP:       netip.MustParseAddr("10.0.0.1"),
+		DstIP:       netip.MustParseAddr("10.0.0.2"),
+		SrcPort:     5060,
+		DstPort:     5060,
+		Protocol:    17,
+		PayloadType: "sip",
+		Labels:      core.Labels{core.LabelSIPCallID: callID},
+		RawPayload:  []byte("INVITE sip:bob@example.com SIP/2.0\r\nCall-ID: " + callID + "\r\n\r\n"),
+	}
+}
+
+func TestPcapReporter_Init(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		wantErr bool
+	}{
+		{"minimal", map[string]any{"dir": "/tmp/archive"}, false},
+		{"full", map[string]any{"dir": "/tmp/archive", "prefix": "edge1", "rotate_size_mb": float64(64), "rotate_interval": "10m", "index": false, "index_interval": "5s"}, false},
+		{"nil config", nil, true},
+		{"missing dir", map[string]any{}, true},
+		{"prefix with separator", map[string]any{"dir": "/tmp/archive", "prefix": "../x"}, true},
+		{"bad rotate_size_mb", map[string]any{"dir": "/tmp/archive", "rotate_size_mb": float64(0)}, true},
+		{"bad rotate_interval", map[string]any{"dir": "/tmp/archive", "rotate_interval": "soon"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPcapReporter().Init(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPcapReporter_ReportAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestReporter(t, map[string]any{"dir": dir})
+	ctx := context.Background()
+	base := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+
+	rtp := &core.OutputPacket{
+		Timestamp:  base.Add(time.Second),
+		SrcIP:      netip.MustParseAddr("2001:db8::1"),
+		DstIP:      netip.MustParseAddr("2001:db8::2"),
+		SrcPort:    10000,
+		DstPort:    20000,
+		Protocol:   17,
+		Labels:     core.Labels{core.LabelRTPCallID: "call-1"},
+		RawPayload: make([]byte, 172),
+	}
+	for _, pkt := range []*core.OutputPacket{
+		sipPacket("call-1", base),
+		sipPacket("call-2", base),
+		rtp,
+		{PayloadType: "rollup", Timestamp: base}, // no network context
+	} {
+		if err := r.Report(ctx, pkt); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+	}
+	if r.written.Load() != 3 || r.skipped.Load() != 1 {
+		t.Errorf("written=%d skipped=%d, want 3 and 1", r.written.Load(), r.skipped.Load())
+	}
+	if err := r.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	files, err := pcaparchive.Files([]string{dir})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("archive files = %v, %v", files, err)
+	}
+	if _, err := os.Stat(files[0] + pcaparchive.CallIndexExt); err != nil {
+		t.Fatalf("call index: %v", err)
+	}
+
+	var out bytes.Buffer
+	e, err := pcaparchive.NewExtractor(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, indexed, err := e.Call(files[0], "call-1", time.Time{}, time.Time{}); err != nil || !indexed || n != 2 {
+		t.Fatalf("Call = %d, %v, %v; want 2 packets", n, indexed, err)
+	}
+
+	rd, err := pcapgo.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []gopacket.Packet
+	for {
+		data, ci, err := rd.ReadPacketData()
+		if err != nil {
+			break
+		}
+		pkt := gopacket.NewPacket(data, rd.LinkType(), gopacket.Default)
+		pkt.Metadata().CaptureInfo = ci
+		got = append(got, pkt)
+	}
+	if len(got) != 2 {
+		t.Fatalf("extracted %d packets, want 2", len(got))
+	}
+
+	sip, ok := got[0].Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok || sip.DstPort != 5060 || !bytes.HasPrefix(sip.Payload, []byte("INVITE")) {
+		t.Errorf("first packet is not the SIP INVITE: %v", got[0])
+	}
+	if !got[0].Metadata().Timestamp.Equal(base) {
+		t.Errorf("timestamp = %v, want %v", got[0].Metadata().Timestamp, base)
+	}
+	if got[1].Layer(layers.LayerTypeIPv6) == nil || len(got[1].ApplicationLayer().Payload()) != 172 {
+		t.Errorf("second packet is not the IPv6 RTP packet: %v", got[1])
+	}
+}
+
+func TestPcapReporter_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	r := newTestReporter(t, map[string]any{"dir": dir, "prefix": "edge"})
+	r.config.RotateSize = 200 // bytes: two SIP packets per file
+	ctx := context.Background()
+
+	for i := 0; i < 6; i++ {
+		if err := r.Report(ctx, sipPacket("call-1", time.Now())); err != nil {
+			t.Fatalf("Report: %v", err)
+		}
+		time.Sleep(time.Millisecond) // distinct file names
+	}
+	if err := r.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "edge-*.pcap"))
+	if len(files) != 3 {
+		t.Fatalf("files = %v, want 3", files)
+	}
+	var out bytes.Buffer
+	e, _ := pcaparchive.NewExtractor(&out)
+	total := 0
+	for _, f := range files {
+		n, _, err := e.Call(f, "call-1", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += n
+	}
+	if total != 6 {
+		t.Errorf("extracted %d packets across rotated files, want 6", total)
+	}
+}
+
+func TestPcapReporter_UnbuildableFrameIsPermanent(t *testing.T) {
+	r := newTestReporter(t, map[string]any{"dir": t.TempDir()})
+	defer r.Stop(context.Background())
+
+	pkt := sipPacket("call-1", time.Now())
+	pkt.RawPayload = make([]byte, 70000) // exceeds the IPv4 total length
+	err := r.Report(context.Background(), pkt)
+	if !errors.Is(err, core.ErrPermanent) {
+		t.Errorf("Report error = %v, want ErrPermanent", err)
+	}
+}
@@ -12,10 +12,11 @@ VERSION="${VERSION:-$(git describe --tags --always --dirty 2>/dev/null || echo '
 BUILD_TIME="$(date -u '+%Y-%m-%d_%H:%M:%S_UTC')"
 GIT_COMMIT="$(git rev-parse --short HEAD 2>/dev/null || echo 'unknown')"
 
+BUILDINFO="firestige.xyz/otus/internal/buildinfo"
 LDFLAGS="-w -s -linkmode external -extldflags '-static'"
-LDFLAGS="$LDFLAGS -X 'main.Version=${VERSION}'"
-LDFLAGS="$LDFLAGS -X 'main.BuildTime=${BUILD_TIME}'"
-LDFLAGS="$LDFLAGS -X 'main.GitCommit=${GIT_COMMIT}'"
+LDFLAGS="$LDFLAGS -X '${BUILDINFO}.Version=${VERSION}'"
+LDFLAGS="$LDFLAGS -X '${BUILDINFO}.BuildTime=${BUILD_TIME}'"
+LDFLAGS="$LDFLAGS -X '${BUILDINFO}.GitCommit=${GIT_COMMIT}'"
 
 BUILD_TAGS="netgo,osusergo"
 OUTPUT_DIR="${OUTPUT_DIR:-./dist}"
@@ -0,0 +1,190 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/command"
+	"firestige.xyz/otus/internal/config"
+)
+
+const captureDir = "../../testdata/conformance"
+
+// flow is one capture replayed through a task with the Kafka and HEP
+// reporters. Its golden file, testdata/golden/<name>.json, holds what both
+// sinks must receive.
+type flow struct {
+	name    string
+	pcap    string
+	parsers []map[string]any
+}
+
+var flows = []flow{
+	{
+		name:    "sip_call",
+		pcap:    "sip_call.pcap",
+		parsers: []map[string]any{{"name": "sip"}, {"name": "rtp"}},
+	},
+	{
+		name:    "msrp_session",
+		pcap:    "msrp_session.pcap",
+		parsers: []map[string]any{{"name": "sip"}, {"name": "msrp"}},
+	},
+}
+
+// golden is the content of a golden file.
+type golden struct {
+	Kafka []KafkaRecord `json:"kafka"`
+	HEP   []HEPRecord   `json:"hep"`
+}
+
+func TestGoldenFlows(t *testing.T) {
+	client := startDaemon(t)
+	for _, f := range flows {
+		t.Run(f.name, func(t *testing.T) {
+			got := runFlow(t, client, f)
+			checkGolden(t, filepath.Join("testdata", "golden", f.name+".json"), got)
+		})
+	}
+}
+
+// runFlow replays the flow's capture through a new task, drains it and
+// collects what the sinks received.
+func runFlow(t *testing.T, client *command.UDSClient, f flow) golden {
+	t.Helper()
+	pcapPath := filepath.Join(captureDir, f.pcap)
+	fifo, write := replay(t, pcapPath)
+	taskID := "it-" + f.name
+	topic := fmt.Sprintf("otus-it-%d-%s", runID, f.name)
+
+	raw, _ := json.Marshal(map[string]any{
+		"id":      taskID,
+		"workers": 1,
+		"capture": map[string]any{
+			"name":      "pcapstream",
+			"interface": "replay",
+			"config":    map[string]any{"path": fifo, "reopen": false},
+		},
+		"parsers": f.parsers,
+		"reporters": []map[string]any{
+			{"name": "kafka", "config": map[string]any{"topic": topic, "batch_timeout": "10ms"}},
+			{"name": "hep", "config": map[string]any{"servers": []string{*hepAddr}, "capture_id": runID}},
+		},
+	})
+	tc, err := config.ParseTaskConfig(raw)
+	if err != nil {
+		t.Fatalf("task config: %v", err)
+	}
+
+	ctx := context.Background()
+	resp, err := client.TaskCreate(ctx, command.TaskCreateParams{Config: *tc})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("task_create: %v %+v", err, resp)
+	}
+	t.Cleanup(func() { client.TaskDelete(ctx, taskID) }) //nolint:errcheck
+
+	write()
+	waitCaptured(t, client, taskID, countPackets(t, pcapPath))
+
+	resp, err = client.TaskDrain(ctx, command.TaskDrainParams{TaskID: taskID, Timeout: "30s"})
+	if err != nil || resp.Error != nil {
+		t.Fatalf("task_drain: %v %+v", err, resp)
+	}
+
+	var got golden
+	want := readGolden(t, filepath.Join("testdata", "golden", f.name+".json"))
+	got.Kafka, err = readKafka(topic, len(want.Kafka), 20*time.Second)
+	if err != nil {
+		t.Fatalf("read Kafka: %v", err)
+	}
+	// UDP delivery to the sink is asynchronous; give the last frames a moment.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got.HEP, err = readHEP(runID)
+		if err != nil {
+			t.Fatalf("read HEP sink: %v", err)
+		}
+		if len(got.HEP) >= len(want.HEP) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return got
+}
+
+// waitCaptured waits until the task's capturer has read n packets.
+func waitCaptured(t *testing.T, client *command.UDSClient, taskID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		resp, err := client.TaskStatus(context.Background(), taskID)
+		if err != nil || resp.Error != nil {
+			t.Fatalf("task_status: %v %+v", err, resp)
+		}
+		var status struct {
+			Counters struct {
+				Session struct {
+					PacketsReceived uint64 `json:"packets_received"`
+				} `json:"session"`
+			} `json:"counters"`
+		}
+		b, _ := json.Marshal(resp.Result)
+		json.Unmarshal(b, &status) //nolint:errcheck
+		received := status.Counters.Session.PacketsReceived
+		if received >= uint64(n) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("capturer read %d of %d packets", received, n)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func readGolden(t *testing.T, path string) golden {
+	t.Helper()
+	var g golden
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && *update {
+		return g
+	}
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if err := json.Unmarshal(data, &g); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	return g
+}
+
+// checkGolden compares got with the golden file, or rewrites it with -update.
+func checkGolden(t *testing.T, path string, got golden) {
+	t.Helper()
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+
+	if *update {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if !bytes.Equal(want, data) {
+		t.Errorf("delivered messages differ from %s (rerun with -update if intended)\ngot:\n%s", path, data)
+	}
+}
@@ -0,0 +1,172 @@
+//go:build integration
+
+// Package integration runs the otus daemon end to end against Kafka and a
+// HEP sink in containers (docker-compose.yml) and compares what they receive
+// with golden files. Run it with "make test-integration"; pass -update to
+// rewrite the golden files after an intended output change.
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"firestige.xyz/otus/internal/command"
+)
+
+var (
+	update    = flag.Bool("update", false, "rewrite the golden files")
+	kafkaAddr = flag.String("kafka", "localhost:9092", "Kafka bootstrap server")
+	hepAddr   = flag.String("hep", "127.0.0.1:9060", "HEP sink address")
+	hepFile   = flag.String("hep-file", ".out/hep.bin", "file the HEP sink appends datagrams to")
+)
+
+// daemon is the otus daemon shared by all tests, started on first use.
+var daemon struct {
+	once   sync.Once
+	err    error
+	dir    string
+	cmd    *exec.Cmd
+	client *command.UDSClient
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if daemon.cmd != nil {
+		daemon.client.DaemonShutdown(context.Background()) //nolint:errcheck
+		daemon.cmd.Wait()                                  //nolint:errcheck
+	}
+	if daemon.dir != "" {
+		os.RemoveAll(daemon.dir)
+	}
+	os.Exit(code)
+}
+
+// startDaemon builds the otus binary and runs it in the foreground with a
+// config pointing at the containers, returning a client for its socket.
+func startDaemon(t *testing.T) *command.UDSClient {
+	t.Helper()
+	daemon.once.Do(func() {
+		daemon.err = launchDaemon()
+	})
+	if daemon.err != nil {
+		t.Fatalf("start daemon: %v", daemon.err)
+	}
+	return daemon.client
+}
+
+func launchDaemon() error {
+	dir, err := os.MkdirTemp("", "otus-integration-")
+	if err != nil {
+		return err
+	}
+	daemon.dir = dir
+
+	bin := filepath.Join(dir, "otus")
+	build := exec.Command("go", "build", "-o", bin, "../..")
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("build otus: %w", err)
+	}
+
+	cfgPath := filepath.Join(dir, "config.yml")
+	cfg := fmt.Sprintf(`otus:
+  node:
+    ip: "127.0.0.1"
+    hostname: "otus-integration"
+  data_dir: %q
+  max_tasks: 0
+  task_persistence:
+    enabled: false
+  metrics:
+    enabled: false
+  log:
+    level: "debug"
+  kafka:
+    brokers: [%q]
+`, dir, *kafkaAddr)
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o600); err != nil {
+		return err
+	}
+
+	socket := filepath.Join(dir, "otus.sock")
+	cmd := exec.Command(bin, "daemon", "-c", cfgPath, "-s", socket, "-p", filepath.Join(dir, "otus.pid"))
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start otus: %w", err)
+	}
+	daemon.cmd = cmd
+	daemon.client = command.NewUDSClient(socket, 30*time.Second)
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := daemon.client.Ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("daemon socket not ready: %w", err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// replay creates a FIFO for the pcapstream capturer and returns its path and
+// a function that writes the capture into it. The write blocks until the
+// capturer opens the FIFO, so it runs once the task has started.
+func replay(t *testing.T, pcapPath string) (fifo string, write func()) {
+	t.Helper()
+	fifo = filepath.Join(t.TempDir(), "replay.fifo")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatalf("mkfifo: %v", err)
+	}
+	data, err := os.ReadFile(pcapPath)
+	if err != nil {
+		t.Fatalf("read capture: %v", err)
+	}
+	return fifo, func() {
+		f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+		if err != nil {
+			t.Errorf("open fifo: %v", err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.Write(data); err != nil {
+			t.Errorf("write fifo: %v", err)
+		}
+	}
+}
+
+// countPackets returns the number of packets in a classic pcap file.
+func countPackets(t *testing.T, pcapPath string) int {
+	t.Helper()
+	data, err := os.ReadFile(pcapPath)
+	if err != nil {
+		t.Fatalf("read capture: %v", err)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if len(data) >= 4 && binary.BigEndian.Uint32(data) == 0xa1b2c3d4 {
+		order = binary.BigEndian
+	}
+	n := 0
+	for off := 24; off+16 <= len(data); n++ {
+		off += 16 + int(order.Uint32(data[off+8:]))
+	}
+	return n
+}
+
+// runID tells the data of this run apart from earlier runs in the same
+// containers: it names the Kafka topics and is the HEP capture ID.
+var runID = rand.Uint32N(1 << 31)
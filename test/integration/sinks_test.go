@@ -0,0 +1,180 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaRecord is the run-independent part of a Kafka message value: the
+// task, agent, pipeline and timestamp fields are left out.
+type KafkaRecord struct {
+	PayloadType   string            `json:"payload_type"`
+	Src           string            `json:"src"`
+	Dst           string            `json:"dst"`
+	Protocol      int               `json:"protocol"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	RawPayloadLen int               `json:"raw_payload_len,omitempty"`
+}
+
+// HEPRecord is the run-independent part of a HEPv3 frame: the timestamp and
+// capture ID chunks are left out.
+type HEPRecord struct {
+	ProtoType     uint8  `json:"proto_type"`
+	Src           string `json:"src"`
+	Dst           string `json:"dst"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+	From          string `json:"from,omitempty"`
+	To            string `json:"to,omitempty"`
+	PayloadLen    int    `json:"payload_len"`
+}
+
+// readKafka reads want messages from partition 0 of topic, or as many as
+// arrive within timeout.
+func readKafka(topic string, want int, timeout time.Duration) ([]KafkaRecord, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{*kafkaAddr},
+		Topic:     topic,
+		Partition: 0,
+		MaxWait:   500 * time.Millisecond,
+	})
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var records []KafkaRecord
+	for len(records) < want {
+		msg, err := r.ReadMessage(ctx)
+		if errors.Is(err, context.DeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var v struct {
+			SrcIP         string            `json:"src_ip"`
+			DstIP         string            `json:"dst_ip"`
+			SrcPort       uint16            `json:"src_port"`
+			DstPort       uint16            `json:"dst_port"`
+			Protocol      int               `json:"protocol"`
+			PayloadType   string            `json:"payload_type"`
+			Labels        map[string]string `json:"labels"`
+			RawPayloadLen int               `json:"raw_payload_len"`
+		}
+		if err := json.Unmarshal(msg.Value, &v); err != nil {
+			return nil, fmt.Errorf("offset %d: %w", msg.Offset, err)
+		}
+		records = append(records, KafkaRecord{
+			PayloadType:   v.PayloadType,
+			Src:           hostPort(v.SrcIP, v.SrcPort),
+			Dst:           hostPort(v.DstIP, v.DstPort),
+			Protocol:      v.Protocol,
+			Labels:        v.Labels,
+			RawPayloadLen: v.RawPayloadLen,
+		})
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// readHEP decodes the frames with captureID from the HEP sink's file.
+func readHEP(captureID uint32) ([]HEPRecord, error) {
+	data, err := os.ReadFile(*hepFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []HEPRecord
+	for len(data) > 0 {
+		if len(data) < 6 || string(data[:4]) != "HEP3" {
+			return nil, fmt.Errorf("HEP sink file: bad frame header")
+		}
+		size := int(binary.BigEndian.Uint16(data[4:6]))
+		if size < 6 || size > len(data) {
+			return nil, fmt.Errorf("HEP sink file: bad frame length %d", size)
+		}
+		rec, id := decodeHEP(data[6:size])
+		if id == captureID {
+			records = append(records, rec)
+		}
+		data = data[size:]
+	}
+	sortRecords(records)
+	return records, nil
+}
+
+// decodeHEP decodes the chunks of one frame.
+func decodeHEP(chunks []byte) (HEPRecord, uint32) {
+	var (
+		rec              HEPRecord
+		captureID        uint32
+		srcIP, dstIP     netip.Addr
+		srcPort, dstPort uint16
+	)
+	for len(chunks) >= 6 {
+		typ := binary.BigEndian.Uint16(chunks[2:4])
+		size := int(binary.BigEndian.Uint16(chunks[4:6]))
+		if size < 6 || size > len(chunks) {
+			break
+		}
+		v := chunks[6:size]
+		switch typ {
+		case 3, 4, 5, 6:
+			addr, _ := netip.AddrFromSlice(v)
+			if typ%2 == 1 {
+				srcIP = addr
+			} else {
+				dstIP = addr
+			}
+		case 7:
+			srcPort = binary.BigEndian.Uint16(v)
+		case 8:
+			dstPort = binary.BigEndian.Uint16(v)
+		case 11:
+			rec.ProtoType = v[0]
+		case 12:
+			captureID = binary.BigEndian.Uint32(v)
+		case 15:
+			rec.PayloadLen = len(v)
+		case 17:
+			rec.CorrelationID = string(v)
+		case 48:
+			rec.From = string(v)
+		case 49:
+			rec.To = string(v)
+		}
+		chunks = chunks[size:]
+	}
+	rec.Src = netip.AddrPortFrom(srcIP, srcPort).String()
+	rec.Dst = netip.AddrPortFrom(dstIP, dstPort).String()
+	return rec, captureID
+}
+
+func hostPort(ip string, port uint16) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return fmt.Sprintf("%s:%d", ip, port)
+	}
+	return netip.AddrPortFrom(addr, port).String()
+}
+
+// sortRecords orders records by their JSON form: delivery order across
+// pipelines and partitions is not part of the contract.
+func sortRecords[T any](records []T) {
+	key := func(r T) string {
+		b, _ := json.Marshal(r)
+		return string(b)
+	}
+	sort.SliceStable(records, func(i, j int) bool { return key(records[i]) < key(records[j]) })
+}